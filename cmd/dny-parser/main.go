@@ -0,0 +1,214 @@
+// dny-parser DNY协议帧离线解析工具
+//
+// 用法:
+//
+//	dny-parser -hex 444E590A00F36CA2040100960A9B03
+//	dny-parser -direction downlink 444E59...
+//	dny-parser -checksum-mode lenient 444E59...
+//	echo 444E59... | dny-parser -json
+//	dny-parser import 04A26CF3_20261015103000.dnycap
+//	dny-parser import -format jsonl -decode=false capture.jsonl
+//
+// 与HTTP接口 POST /api/v1/tools/parse-frame 共用 protocol.DiagnoseHexFrame 实现；帧无效时退出码为1。
+// -checksum-mode 按网关的上行校验和模式（strict|lenient|off，同配置 checksum.mode）输出网关对该帧的处置，与解码器共用 protocol.ChecksumPolicy。
+// import 子命令读取 GET /api/v1/device/{deviceId}/comm-log/export 导出的抓包（格式见 pkg/commlog/capture.go）并逐帧打印
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
+	hexFlag := flag.String("hex", "", "十六进制帧数据（为空时读取参数或标准输入）")
+	direction := flag.String("direction", "", "帧方向: uplink 或 downlink（为空时按上行解析）")
+	asJSON := flag.Bool("json", false, "以JSON格式输出")
+	checksumMode := flag.String("checksum-mode", "", "按网关校验和模式输出处置结论: strict | lenient | off（为空不输出）")
+	flag.Parse()
+
+	input := *hexFlag
+	if input == "" && flag.NArg() > 0 {
+		input = strings.Join(flag.Args(), "")
+	}
+	if input == "" {
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, int64(protocol.MaxDiagnoseFrameBytes*3+1)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取标准输入失败: %v\n", err)
+			os.Exit(2)
+		}
+		input = string(data)
+	}
+	if strings.TrimSpace(input) == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	diag, err := protocol.DiagnoseHexFrame(input, *direction)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "解析失败: %v\n", err)
+		os.Exit(2)
+	}
+	var decision *protocol.ChecksumDecision
+	if *checksumMode != "" {
+		policy := protocol.ChecksumPolicy{Mode: *checksumMode}
+		if err := policy.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "参数错误: %v\n", err)
+			os.Exit(2)
+		}
+		if diag.FrameType == "dny" {
+			data, _ := protocol.DecodeHexInput(input)
+			d := policy.Decide(data)
+			decision = &d
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if decision != nil {
+			_ = encoder.Encode(struct {
+				*protocol.FrameDiagnostics
+				ChecksumDecision *protocol.ChecksumDecision `json:"checksum_decision"`
+			}{diag, decision})
+		} else {
+			_ = encoder.Encode(diag)
+		}
+	} else {
+		printDiagnostics(diag)
+		if decision != nil {
+			printChecksumDecision(decision)
+		}
+	}
+	if !diag.Valid {
+		os.Exit(1)
+	}
+}
+
+func printDiagnostics(d *protocol.FrameDiagnostics) {
+	fmt.Printf("帧类型:     %s (%d 字节)\n", d.FrameType, d.TotalBytes)
+	if d.ICCID != "" {
+		fmt.Printf("ICCID:      %s\n", d.ICCID)
+	}
+	if d.FrameType == "dny" {
+		fmt.Printf("包头:       %s (有效: %v)\n", d.Header, d.HeaderValid)
+		fmt.Printf("长度:       声明 %d / 实际 %d\n", d.DeclaredLength, d.ActualLength)
+		fmt.Printf("物理ID:     %s\n", d.PhysicalID)
+		fmt.Printf("消息ID:     %s\n", d.MessageID)
+		fmt.Printf("命令:       %s %s\n", d.Command, d.CommandName)
+		if d.PayloadHex != "" {
+			fmt.Printf("负载:       %s\n", d.PayloadHex)
+		}
+		if d.Payload != nil {
+			payload, _ := json.MarshalIndent(d.Payload, "            ", "  ")
+			fmt.Printf("负载解码:   %s %s\n", d.PayloadType, payload)
+		}
+		if d.PayloadError != "" {
+			fmt.Printf("负载错误:   %s\n", d.PayloadError)
+		}
+		for _, c := range d.Checksums {
+			fmt.Printf("校验和:     %-24s 期望 %s 实际 %s 匹配 %v\n", c.Algorithm, c.Expected, c.Actual, c.Valid)
+		}
+	}
+	fmt.Printf("结果:       有效=%v\n", d.Valid)
+	for _, issue := range d.Errors {
+		fmt.Printf("  ✗ [偏移 %d, %d 字节] %s: %s\n", issue.Offset, issue.Length, issue.Field, issue.Message)
+	}
+}
+
+func printChecksumDecision(d *protocol.ChecksumDecision) {
+	var verdict string
+	switch {
+	case d.Mode == protocol.ChecksumModeOff:
+		verdict = "不校验，照常处理"
+	case d.Err == nil:
+		verdict = "校验和正确，照常处理"
+	case d.Accept:
+		verdict = "校验和错误，照常处理并计入 checksum_failures"
+	default:
+		verdict = "校验和错误，丢弃并应答NAK（物理ID为本连接已绑定的设备且命令已知时）"
+	}
+	fmt.Printf("网关处置:   [%s/%s] %s\n", d.Class, d.Mode, verdict)
+}
+
+// runImport 读取抓包文件（为空或"-"时读取标准输入）并逐帧打印，返回退出码
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", commlog.FormatBinary, "抓包格式: bin 或 jsonl")
+	decode := fs.Bool("decode", true, "逐帧解析DNY字段")
+	asJSON := fs.Bool("json", false, "以JSONL格式输出（每行一帧）")
+	_ = fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "打开抓包文件失败: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var records []commlog.Record
+	var err error
+	switch *format {
+	case commlog.FormatBinary:
+		records, err = commlog.ReadCapture(in)
+	case commlog.FormatJSONL:
+		records, err = commlog.ReadJSONL(in)
+	default:
+		err = fmt.Errorf("未知格式: %s", *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取抓包失败: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		if err := commlog.WriteJSONL(os.Stdout, records); err != nil {
+			fmt.Fprintf(os.Stderr, "输出失败: %v\n", err)
+			return 2
+		}
+		return 0
+	}
+	for i, rec := range records {
+		frameHex := strings.ToUpper(hex.EncodeToString(rec.Frame))
+		fmt.Printf("#%-5d %s  %-8s %4d 字节  %s\n", i+1, rec.Time.Format("2006-01-02 15:04:05.000000"), rec.Direction, len(rec.Frame), frameHex)
+		if !*decode {
+			continue
+		}
+		diag, err := protocol.DiagnoseHexFrame(frameHex, rec.Direction.String())
+		if err != nil {
+			fmt.Printf("       解析失败: %v\n", err)
+			continue
+		}
+		if diag.FrameType == "dny" {
+			fmt.Printf("       物理ID %s  消息ID %s  命令 %s %s  有效=%v\n", diag.PhysicalID, diag.MessageID, diag.Command, diag.CommandName, diag.Valid)
+		} else {
+			fmt.Printf("       %s  有效=%v\n", diag.FrameType, diag.Valid)
+		}
+		for _, issue := range diag.Errors {
+			fmt.Printf("       ✗ %s: %s\n", issue.Field, issue.Message)
+		}
+	}
+	if len(records) > 0 {
+		span := records[len(records)-1].Time.Sub(records[0].Time)
+		fmt.Printf("共 %d 帧，跨度 %s\n", len(records), span.Round(time.Millisecond))
+	} else {
+		fmt.Println("共 0 帧")
+	}
+	return 0
+}
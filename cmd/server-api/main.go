@@ -0,0 +1,224 @@
+// server-api 内部服务调用网关API的命令行工具，经 pkg/client 访问（与内部服务使用同一客户端）
+//
+// 用法:
+//
+//	server-api devices [-station station_01]
+//	server-api device 04A26CF3
+//	server-api ports 04A26CF3
+//	server-api search -limit 10 6CF3
+//	server-api start -device 04A26CF3 -port 1 -value 3600 -order ORD20261015001
+//	server-api stop -device 04A26CF3 -port 1 -order ORD20261015001
+//	server-api modify -device 04A26CF3 -port 1 -order ORD20261015001 -power 1200
+//
+// 网关地址、API Key名称与租户取自 -addr/-key/-tenant，未指定时读取环境变量 IOT_GATEWAY_ADDR、IOT_API_KEY_NAME、IOT_TENANT_ID。
+// 充电命令携带自动生成的幂等键（-idempotency-key 可指定），输出均为JSON
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/client"
+)
+
+const defaultAddr = "http://127.0.0.1:7055"
+
+type globalFlags struct {
+	addr, key, tenant, idempotencyKey string
+	timeout                           time.Duration
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	commands := map[string]func(args []string) int{
+		"devices": runDevices,
+		"device":  runDevice,
+		"ports":   runPorts,
+		"search":  runSearch,
+		"start":   runStart,
+		"stop":    runStop,
+		"modify":  runModify,
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(run(os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `用法: server-api <子命令> [选项] [参数]
+子命令:
+  devices   在线设备列表（-station、-type、-expand）
+  device    设备详情（参数: 设备ID）
+  ports     设备端口状态（参数: 设备ID）
+  search    搜索设备（参数: 查询串，-limit）
+  start     开始充电（-device -port -mode -value -order -balance）
+  stop      停止充电（-device -port -order）
+  modify    调整过载功率/最大时长（-device -port -order -power -max-duration）
+通用选项: -addr -key -tenant -timeout -idempotency-key（API版本 %s）
+`, client.APIVersion)
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *globalFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	g := &globalFlags{}
+	fs.StringVar(&g.addr, "addr", envOr("IOT_GATEWAY_ADDR", defaultAddr), "网关HTTP地址")
+	fs.StringVar(&g.key, "key", os.Getenv("IOT_API_KEY_NAME"), "调用方API Key名称")
+	fs.StringVar(&g.tenant, "tenant", os.Getenv("IOT_TENANT_ID"), "租户ID")
+	fs.DurationVar(&g.timeout, "timeout", time.Minute, "本次调用总超时（含重试）")
+	fs.StringVar(&g.idempotencyKey, "idempotency-key", "", "充电命令的幂等键，默认自动生成")
+	return fs, g
+}
+
+// invoke 创建客户端并执行调用，结果以JSON输出
+func invoke(g *globalFlags, fn func(ctx context.Context, c *client.Client) (interface{}, error)) int {
+	c, err := client.New(g.addr, g.key, g.tenant, client.WithUserAgent("server-api"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	if g.idempotencyKey != "" {
+		ctx = client.WithIdempotencyKey(ctx, g.idempotencyKey)
+	}
+	out, err := fn(ctx, c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.RequestID != "" {
+			fmt.Fprintf(os.Stderr, "链路追踪ID: %s\n", apiErr.RequestID)
+		}
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		fmt.Fprintf(os.Stderr, "输出失败: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// deviceArg 设备ID位置参数
+func deviceArg(fs *flag.FlagSet) (string, bool) {
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "需要 1 个设备ID")
+		return "", false
+	}
+	return fs.Arg(0), true
+}
+
+func runDevices(args []string) int {
+	fs, g := newFlagSet("devices")
+	station := fs.String("station", "", "按站点过滤")
+	deviceType := fs.Uint("type", 0, "按设备类型过滤")
+	expand := fs.Bool("expand", false, "已拆分设备展开为虚拟子设备")
+	_ = fs.Parse(args)
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		return c.ListDevices(ctx, client.ListDevicesOptions{StationID: *station, DeviceType: uint16(*deviceType), ExpandVirtual: *expand})
+	})
+}
+
+func runDevice(args []string) int {
+	fs, g := newFlagSet("device")
+	_ = fs.Parse(args)
+	id, ok := deviceArg(fs)
+	if !ok {
+		return 2
+	}
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		d, err := c.GetDevice(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return d.Raw, nil
+	})
+}
+
+func runPorts(args []string) int {
+	fs, g := newFlagSet("ports")
+	_ = fs.Parse(args)
+	id, ok := deviceArg(fs)
+	if !ok {
+		return 2
+	}
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		return c.GetPorts(ctx, id)
+	})
+}
+
+func runSearch(args []string) int {
+	fs, g := newFlagSet("search")
+	limit := fs.Int("limit", 0, "返回条数")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "需要 1 个查询串")
+		return 2
+	}
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		return c.Search(ctx, fs.Arg(0), *limit)
+	})
+}
+
+func runStart(args []string) int {
+	fs, g := newFlagSet("start")
+	var req client.StartChargingRequest
+	port, mode, value, balance := fs.Uint("port", 0, "端口号(1-8)"), fs.Uint("mode", 0, "0=按时间 1=按电量"), fs.Uint("value", 0, "时间(秒)/电量(0.1度)"), fs.Uint("balance", 0, "余额(分)")
+	fs.StringVar(&req.DeviceID, "device", "", "设备ID")
+	fs.StringVar(&req.OrderNo, "order", "", "订单号")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "试运行")
+	_ = fs.Parse(args)
+	req.Port, req.Mode, req.Value, req.Balance, req.TenantID = byte(*port), byte(*mode), uint16(*value), uint32(*balance), g.tenant
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		return c.StartCharging(ctx, req)
+	})
+}
+
+func runStop(args []string) int {
+	fs, g := newFlagSet("stop")
+	var req client.StopChargingRequest
+	port := fs.Uint("port", 0, "端口号(1-8，255由设备选择)")
+	fs.StringVar(&req.DeviceID, "device", "", "设备ID")
+	fs.StringVar(&req.OrderNo, "order", "", "订单号")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "试运行")
+	_ = fs.Parse(args)
+	req.Port = byte(*port)
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		return c.StopCharging(ctx, req)
+	})
+}
+
+func runModify(args []string) int {
+	fs, g := newFlagSet("modify")
+	var req client.ModifyChargingRequest
+	port, power, maxDuration := fs.Uint("port", 0, "端口号(1-8)"), fs.Uint("power", 0, "过载功率(瓦)"), fs.Uint("max-duration", 0, "最大充电时长(秒)，0表示不修改")
+	fs.StringVar(&req.DeviceID, "device", "", "设备ID")
+	fs.StringVar(&req.OrderNo, "order", "", "订单号")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "试运行")
+	_ = fs.Parse(args)
+	req.Port, req.OverloadPowerW, req.MaxChargeDurationSeconds, req.TenantID = byte(*port), uint16(*power), uint16(*maxDuration), g.tenant
+	return invoke(g, func(ctx context.Context, c *client.Client) (interface{}, error) {
+		return c.ModifyCharging(ctx, req)
+	})
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,229 @@
+// statedump-inspect 事故现场状态转储归档离线分析工具
+//
+// 用法:
+//
+//	statedump-inspect manifest statedump-20261015-103000.000.tar.gz
+//	statedump-inspect devices statedump-20261015-103000.000.tar.gz
+//	statedump-inspect timeline -device 04A26CF3 statedump-20261015-103000.000.tar.gz
+//	statedump-inspect diff old.tar.gz new.tar.gz
+//	statedump-inspect profile -name goroutine statedump-20261015-103000.000.tar.gz > goroutine.txt
+//
+// 归档由 POST /api/v1/admin/state-dump 或向网关进程发送 SIGUSR1 生成（格式见 pkg/statedump）。各子命令支持 -json 输出
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/bujia-iot/iot-zinx/pkg/statedump"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var code int
+	switch os.Args[1] {
+	case "manifest":
+		code = runManifest(os.Args[2:])
+	case "devices":
+		code = runDevices(os.Args[2:])
+	case "timeline":
+		code = runTimeline(os.Args[2:])
+	case "diff":
+		code = runDiff(os.Args[2:])
+	case "profile":
+		code = runProfile(os.Args[2:])
+	default:
+		usage()
+		code = 2
+	}
+	os.Exit(code)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `用法: statedump-inspect <子命令> [选项] 归档...
+子命令:
+  manifest  归档清单与各分段采集/写盘耗时
+  devices   在线设备、连接与跟踪中的命令数
+  timeline  合并单台设备的会话、命令与总线事件（-device 设备ID）
+  diff      比较两份归档（较早的在前）
+  profile   输出剖析原始内容（-name goroutine|heap）`)
+}
+
+func openArchive(fs *flag.FlagSet, want int) ([]*statedump.Archive, bool) {
+	if fs.NArg() != want {
+		fmt.Fprintf(os.Stderr, "需要 %d 个归档路径\n", want)
+		return nil, false
+	}
+	archives := make([]*statedump.Archive, 0, want)
+	for _, path := range fs.Args() {
+		a, err := statedump.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "打开归档 %s 失败: %v\n", path, err)
+			return nil, false
+		}
+		archives = append(archives, a)
+	}
+	return archives, true
+}
+
+func printJSON(v interface{}) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "输出失败: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func runManifest(args []string) int {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	_ = fs.Parse(args)
+	archives, ok := openArchive(fs, 1)
+	if !ok {
+		return 2
+	}
+	m := archives[0].Manifest
+	if *asJSON {
+		return printJSON(m)
+	}
+	fmt.Printf("主机:     %s (pid %d, %s)\n", m.Hostname, m.PID, m.GoVersion)
+	fmt.Printf("时间:     %s  触发: %s\n", m.CreatedAt.Format("2006-01-02 15:04:05.000"), m.Reason)
+	fmt.Printf("耗时:     采集 %.3fms  总计 %.3fms\n", m.CaptureMs, m.TotalMs)
+	if m.Truncated {
+		fmt.Println("注意:     超出大小上限，部分分段被跳过")
+	}
+	fmt.Printf("\n%-10s %-15s %12s %12s %12s  %s\n", "分段", "文件", "采集(ms)", "写盘(ms)", "字节", "错误")
+	for _, s := range m.Sections {
+		fmt.Printf("%-10s %-15s %12.3f %12.3f %12d  %s\n", s.Name, s.File, s.CaptureMs, s.WriteMs, s.Bytes, s.Error)
+	}
+	return 0
+}
+
+func runDevices(args []string) int {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	_ = fs.Parse(args)
+	archives, ok := openArchive(fs, 1)
+	if !ok {
+		return 2
+	}
+	a := archives[0]
+	devices, err := a.Devices()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取设备失败: %v\n", err)
+		return 2
+	}
+	if *asJSON {
+		return printJSON(devices)
+	}
+	sessions, _ := a.Sessions()
+	byDevice := make(map[string]statedump.SessionRecord, len(sessions))
+	for _, s := range sessions {
+		byDevice[s.DeviceID] = s
+	}
+	commands, _ := a.Commands()
+	pending := make(map[string]int)
+	for _, c := range commands {
+		pending[c.DeviceID]++
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].DeviceID < devices[j].DeviceID })
+	fmt.Printf("%-10s %-22s %-22s %-12s %6s %6s\n", "设备", "ICCID", "远端地址", "连接状态", "端口", "命令")
+	for _, d := range devices {
+		iccid, _ := d.Detail["iccid"].(string)
+		s := byDevice[d.DeviceID]
+		fmt.Printf("%-10s %-22s %-22s %-12s %6d %6d\n", d.DeviceID, iccid, s.RemoteAddr, s.State, len(d.Ports), pending[d.DeviceID])
+	}
+	fmt.Printf("\n共 %d 台在线设备，跟踪中命令 %d 条\n", len(devices), len(commands))
+	return 0
+}
+
+func runTimeline(args []string) int {
+	fs := flag.NewFlagSet("timeline", flag.ExitOnError)
+	deviceID := fs.String("device", "", "设备ID（8位十六进制）")
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	_ = fs.Parse(args)
+	if *deviceID == "" {
+		fmt.Fprintln(os.Stderr, "需要 -device 设备ID")
+		return 2
+	}
+	archives, ok := openArchive(fs, 1)
+	if !ok {
+		return 2
+	}
+	entries := archives[0].Timeline(*deviceID)
+	if *asJSON {
+		return printJSON(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("归档中没有设备 %s 的记录\n", *deviceID)
+		return 1
+	}
+	for _, e := range entries {
+		fmt.Printf("%s  %-9s %-12s %s\n", e.Timestamp.Format("2006-01-02 15:04:05.000"), e.Source, e.Type, e.Summary)
+	}
+	return 0
+}
+
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	_ = fs.Parse(args)
+	archives, ok := openArchive(fs, 2)
+	if !ok {
+		return 2
+	}
+	report := statedump.Diff(archives[0], archives[1])
+	if *asJSON {
+		return printJSON(report)
+	}
+	fmt.Printf("%s → %s\n", report.From, report.To)
+	fmt.Printf("\n新上线设备 (%d): %v\n", len(report.DevicesAdded), report.DevicesAdded)
+	fmt.Printf("已离线设备 (%d): %v\n", len(report.DevicesRemoved), report.DevicesRemoved)
+	fmt.Printf("\n状态变化的设备 (%d):\n", len(report.DevicesChanged))
+	for _, d := range report.DevicesChanged {
+		fmt.Printf("  %s\n", d.DeviceID)
+		printValueDiffs("    ", d.Fields)
+		printValueDiffs("    端口", d.Ports)
+	}
+	fmt.Printf("\n跟踪中命令: %v → %v\n", report.Commands.From, report.Commands.To)
+	printValueDiffs("  ", report.PendingChanged)
+	fmt.Printf("\n统计变化 (%d):\n", len(report.Stats))
+	printValueDiffs("  ", report.Stats)
+	fmt.Printf("\n配置变化 (%d):\n", len(report.Config))
+	printValueDiffs("  ", report.Config)
+	return 0
+}
+
+func printValueDiffs(indent string, diffs []statedump.ValueDiff) {
+	for _, d := range diffs {
+		fmt.Printf("%s%s: %v → %v\n", indent, d.Key, d.From, d.To)
+	}
+}
+
+func runProfile(args []string) int {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	name := fs.String("name", statedump.SectionGoroutine, "剖析名称: goroutine 或 heap（heap 为 pprof 二进制，可用 go tool pprof 分析）")
+	_ = fs.Parse(args)
+	archives, ok := openArchive(fs, 1)
+	if !ok {
+		return 2
+	}
+	data, found := archives[0].File(*name)
+	if !found {
+		fmt.Fprintf(os.Stderr, "归档中没有 %s 分段\n", *name)
+		return 1
+	}
+	if _, err := os.Stdout.Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "输出失败: %v\n", err)
+		return 2
+	}
+	return 0
+}
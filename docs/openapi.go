@@ -0,0 +1,9 @@
+package docs
+
+import _ "embed"
+
+// OpenAPISpec 由路由处理器的swag注解生成的OpenAPI(Swagger 2.0)规范，make swagger 重新生成；
+// 路由与规范的一致性由 test/openapi_contract_test.go 校验
+//
+//go:embed swagger.json
+var OpenAPISpec []byte
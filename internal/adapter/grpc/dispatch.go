@@ -0,0 +1,159 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// invoke 以HTTP请求调用HTTP API的处理链（body 按请求参数的JSON字段名编码），将响应转换为 Result；
+// HTTP状态码非2xx时返回对应的gRPC错误，Result 附在错误详情中
+func (s *Server) invoke(ctx context.Context, method, path string, query url.Values, body proto.Message) (*grpcapi.Result, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := protojson.Marshal(body)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "请求编码失败: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "请求构造失败: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range forwardedHeaders() {
+		if values := md.Get(header); len(values) > 0 {
+			req.Header.Set(header, values[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		req.RemoteAddr = p.Addr.String()
+	}
+
+	rec := newResponseRecorder()
+	s.handler.ServeHTTP(rec, req)
+	if requestID := rec.Header().Get(apihttp.HeaderRequestID); requestID != "" {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(apihttp.HeaderRequestID, requestID))
+	}
+
+	result, err := toResult(rec.status, rec.body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if code := httpStatusCode(rec.status); code != codes.OK {
+		st, detailErr := status.New(code, result.Message).WithDetails(result)
+		if detailErr != nil {
+			return nil, status.Error(code, result.Message)
+		}
+		return nil, st.Err()
+	}
+	return result, nil
+}
+
+// forwardedHeaders 转发为HTTP请求头的调用 metadata：链路追踪、调用方API Key名称与租户（与运维变更记录的请求头一致）
+func forwardedHeaders() []string {
+	headers := []string{apihttp.HeaderRequestID}
+	if l := changelog.GetGlobalLog(); l != nil {
+		opts := l.Options()
+		return append(headers, opts.KeyHeader, opts.TenantHeader)
+	}
+	return append(headers, "X-API-Key-Name", "X-Tenant-ID")
+}
+
+// toResult HTTP响应体 {code, message, data} 转换为 Result
+func toResult(httpStatus int, body []byte) (*grpcapi.Result, error) {
+	var resp struct {
+		Code    int32           `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, status.Errorf(codes.Internal, "响应解析失败(HTTP %d)", httpStatus)
+	}
+	result := &grpcapi.Result{HttpStatus: int32(httpStatus), Code: resp.Code, Message: resp.Message}
+	if len(resp.Data) > 0 && string(resp.Data) != "null" {
+		result.Data = &structpb.Value{}
+		if err := protojson.Unmarshal(resp.Data, result.Data); err != nil {
+			return nil, status.Errorf(codes.Internal, "响应数据转换失败: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// httpStatusCode HTTP状态码对应的gRPC错误码
+func httpStatusCode(httpStatus int) codes.Code {
+	switch {
+	case httpStatus >= 200 && httpStatus < 300:
+		return codes.OK
+	case httpStatus == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case httpStatus == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case httpStatus == http.StatusForbidden:
+		return codes.PermissionDenied
+	case httpStatus == http.StatusNotFound:
+		return codes.NotFound
+	case httpStatus == http.StatusConflict:
+		return codes.Aborted
+	case httpStatus == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case httpStatus == http.StatusMisdirectedRequest, httpStatus == http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case httpStatus == http.StatusGatewayTimeout, httpStatus == http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	case httpStatus == http.StatusNotImplemented:
+		return codes.Unimplemented
+	case httpStatus >= 400 && httpStatus < 500:
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
+
+// responseRecorder 截获HTTP处理链写出的状态码、响应头与响应体
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if !r.wrote {
+		r.status, r.wrote = code, true
+	}
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(data)
+}
@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Metrics gRPC调用指标：按服务/方法/结果码计数，按服务/方法累计耗时，当前订阅流数
+type Metrics struct {
+	mu            sync.Mutex
+	handled       map[handledKey]uint64
+	durations     map[methodKey]*durationStat
+	activeStreams int64
+}
+
+type methodKey struct {
+	service string
+	method  string
+}
+
+type handledKey struct {
+	methodKey
+	code string
+}
+
+type durationStat struct {
+	count uint64
+	sum   float64
+}
+
+// NewMetrics 创建指标
+func NewMetrics() *Metrics {
+	return &Metrics{handled: make(map[handledKey]uint64), durations: make(map[methodKey]*durationStat)}
+}
+
+// splitMethod "/pkg.Service/Method" 拆分为服务与方法名
+func splitMethod(fullMethod string) methodKey {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return methodKey{service: fullMethod[:i], method: fullMethod[i+1:]}
+	}
+	return methodKey{service: "unknown", method: fullMethod}
+}
+
+func (m *Metrics) observe(fullMethod string, code codes.Code, elapsed time.Duration) {
+	key := splitMethod(fullMethod)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handled[handledKey{methodKey: key, code: code.String()}]++
+	d, ok := m.durations[key]
+	if !ok {
+		d = &durationStat{}
+		m.durations[key] = d
+	}
+	d.count++
+	d.sum += elapsed.Seconds()
+}
+
+func (m *Metrics) streamStarted() {
+	m.mu.Lock()
+	m.activeStreams++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) streamFinished() {
+	m.mu.Lock()
+	m.activeStreams--
+	m.mu.Unlock()
+}
+
+// Handled 指定方法与结果码的已完成调用数（fullMethod 形如 /iotzinx.gateway.v1.DeviceQuery/GetDevice）
+func (m *Metrics) Handled(fullMethod string, code codes.Code) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.handled[handledKey{methodKey: splitMethod(fullMethod), code: code.String()}]
+}
+
+// WritePrometheus 以 Prometheus 文本格式写出指标
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	handled := make([]handledKey, 0, len(m.handled))
+	for k := range m.handled {
+		handled = append(handled, k)
+	}
+	sort.Slice(handled, func(i, j int) bool {
+		a, b := handled[i], handled[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	fmt.Fprint(w, "# HELP iot_grpc_server_handled_total RPCs completed on the gRPC server, by result code.\n# TYPE iot_grpc_server_handled_total counter\n")
+	for _, k := range handled {
+		fmt.Fprintf(w, "iot_grpc_server_handled_total{service=\"%s\",method=\"%s\",code=\"%s\"} %d\n", k.service, k.method, k.code, m.handled[k])
+	}
+
+	methods := make([]methodKey, 0, len(m.durations))
+	for k := range m.durations {
+		methods = append(methods, k)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].service != methods[j].service {
+			return methods[i].service < methods[j].service
+		}
+		return methods[i].method < methods[j].method
+	})
+	fmt.Fprint(w, "# HELP iot_grpc_server_handling_seconds Time spent handling RPCs (streams: whole stream lifetime).\n# TYPE iot_grpc_server_handling_seconds summary\n")
+	for _, k := range methods {
+		d := m.durations[k]
+		fmt.Fprintf(w, "iot_grpc_server_handling_seconds_sum{service=\"%s\",method=\"%s\"} %s\n", k.service, k.method, strconv.FormatFloat(d.sum, 'f', -1, 64))
+		fmt.Fprintf(w, "iot_grpc_server_handling_seconds_count{service=\"%s\",method=\"%s\"} %d\n", k.service, k.method, d.count)
+	}
+
+	fmt.Fprintf(w, "# HELP iot_grpc_server_active_streams Event subscription streams currently open.\n# TYPE iot_grpc_server_active_streams gauge\niot_grpc_server_active_streams %d\n", m.activeStreams)
+}
@@ -0,0 +1,134 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsCollectorName gRPC指标在 /metrics 中的注册名
+const MetricsCollectorName = "grpc"
+
+// Options gRPC服务器选项
+type Options struct {
+	SharedKey            string // 调用鉴权密钥（与HTTP API共用 httpApiServer.auth.sharedKey），为空时不鉴权
+	MaxConcurrentStreams uint32 // 单连接最大并发流，0表示不限
+}
+
+// Server gRPC服务器：设备查询与充电控制转发给HTTP API的处理链（同一实现、同一中间件），事件订阅直接读取事件总线
+type Server struct {
+	handler http.Handler
+	opts    Options
+	metrics *Metrics
+	server  *grpc.Server
+
+	stopOnce sync.Once
+	stopping chan struct{} // 停机时关闭：事件订阅流随即结束，不阻塞优雅停止
+}
+
+// NewServer 创建gRPC服务器，handler 为HTTP API的路由引擎
+func NewServer(handler http.Handler, opts Options) *Server {
+	s := &Server{handler: handler, opts: opts, metrics: NewMetrics(), stopping: make(chan struct{})}
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	}
+	if opts.MaxConcurrentStreams > 0 {
+		serverOpts = append(serverOpts, grpc.MaxConcurrentStreams(opts.MaxConcurrentStreams))
+	}
+	s.server = grpc.NewServer(serverOpts...)
+	grpcapi.RegisterDeviceQueryServer(s.server, &deviceQueryService{server: s})
+	grpcapi.RegisterChargeControlServer(s.server, &chargeControlService{server: s})
+	grpcapi.RegisterEventStreamServer(s.server, &eventStreamService{server: s})
+	return s
+}
+
+// Metrics 调用指标
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+// Serve 在指定监听上提供服务（阻塞，停止后返回nil）
+func (s *Server) Serve(ln net.Listener) error {
+	if err := s.server.Serve(ln); err != nil && err != grpc.ErrServerStopped {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 结束事件订阅流，停止接收新调用并等待进行中的调用完成，ctx 结束时强制关闭
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopping) })
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// authorize 校验调用 metadata 中的密钥（authorization: Bearer <key> 或 x-api-key: <key>）
+func (s *Server) authorize(ctx context.Context) error {
+	if s.opts.SharedKey == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if values := md.Get("authorization"); len(values) > 0 {
+		if v := strings.TrimSpace(values[0]); len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+			token = strings.TrimSpace(v[7:])
+		}
+	}
+	if token == "" {
+		if values := md.Get("x-api-key"); len(values) > 0 {
+			token = strings.TrimSpace(values[0])
+		}
+	}
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "缺少调用凭证")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.SharedKey)) != 1 {
+		return status.Error(codes.Unauthenticated, "调用凭证无效")
+	}
+	return nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	var resp interface{}
+	err := s.authorize(ctx)
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	s.metrics.observe(info.FullMethod, status.Code(err), time.Since(start))
+	return resp, err
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := s.authorize(ss.Context())
+	if err == nil {
+		s.metrics.streamStarted()
+		err = handler(srv, ss)
+		s.metrics.streamFinished()
+	}
+	s.metrics.observe(info.FullMethod, status.Code(err), time.Since(start))
+	return err
+}
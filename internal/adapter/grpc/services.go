@@ -0,0 +1,206 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/grpcapi"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// eventStreamBuffer 每个事件订阅流的队列长度
+const eventStreamBuffer = 256
+
+// deviceQueryService 设备查询（转发 GET /api/v1/device/...）
+type deviceQueryService struct {
+	grpcapi.UnimplementedDeviceQueryServer
+	server *Server
+}
+
+func (s *deviceQueryService) GetDevice(ctx context.Context, req *grpcapi.GetDeviceRequest) (*grpcapi.Result, error) {
+	path, err := devicePath(req.GetDeviceId(), "status")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if req.GetVerbose() {
+		query.Set("verbose", "true")
+	}
+	return s.server.invoke(ctx, http.MethodGet, path, query, nil)
+}
+
+func (s *deviceQueryService) ListDevices(ctx context.Context, req *grpcapi.ListDevicesRequest) (*grpcapi.Result, error) {
+	query := url.Values{}
+	if req.GetVirtual() != "" {
+		query.Set("virtual", req.GetVirtual())
+	}
+	if req.GetStationId() != "" {
+		query.Set("stationId", req.GetStationId())
+	}
+	if req.GetDeviceType() != 0 {
+		query.Set("deviceType", strconv.Itoa(int(req.GetDeviceType())))
+	}
+	return s.server.invoke(ctx, http.MethodGet, "/api/v1/devices", query, nil)
+}
+
+func (s *deviceQueryService) GetPortStatus(ctx context.Context, req *grpcapi.GetPortStatusRequest) (*grpcapi.Result, error) {
+	path, err := devicePath(req.GetDeviceId(), "ports")
+	if err != nil {
+		return nil, err
+	}
+	return s.server.invoke(ctx, http.MethodGet, path, nil, nil)
+}
+
+// devicePath 设备路由路径；设备ID为空时与HTTP接口的参数校验结果一致
+func devicePath(deviceID, action string) (string, error) {
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		result := &grpcapi.Result{HttpStatus: http.StatusBadRequest, Code: 400, Message: "设备ID不能为空"}
+		st, _ := status.New(codes.InvalidArgument, result.Message).WithDetails(result)
+		return "", st.Err()
+	}
+	return "/api/v1/device/" + url.PathEscape(deviceID) + "/" + action, nil
+}
+
+// chargeControlService 充电控制（转发 /api/v1/charging/...，幂等与并发保护由HTTP处理器统一执行）
+type chargeControlService struct {
+	grpcapi.UnimplementedChargeControlServer
+	server *Server
+}
+
+func (s *chargeControlService) StartCharging(ctx context.Context, req *grpcapi.StartChargingRequest) (*grpcapi.Result, error) {
+	return s.server.invoke(ctx, http.MethodPost, "/api/v1/charging/start", nil, req)
+}
+
+func (s *chargeControlService) StopCharging(ctx context.Context, req *grpcapi.StopChargingRequest) (*grpcapi.Result, error) {
+	return s.server.invoke(ctx, http.MethodPost, "/api/v1/charging/stop", nil, req)
+}
+
+func (s *chargeControlService) UpdateChargingPower(ctx context.Context, req *grpcapi.UpdateChargingPowerRequest) (*grpcapi.Result, error) {
+	return s.server.invoke(ctx, http.MethodPost, "/api/v1/charging/update_power", nil, req)
+}
+
+func (s *chargeControlService) ListChargingSessions(ctx context.Context, req *grpcapi.ListChargingSessionsRequest) (*grpcapi.Result, error) {
+	query := url.Values{}
+	if req.GetDeviceId() != "" {
+		query.Set("deviceId", req.GetDeviceId())
+	}
+	return s.server.invoke(ctx, http.MethodGet, "/api/v1/charging/sessions", query, nil)
+}
+
+// eventStreamService 事件总线订阅
+type eventStreamService struct {
+	grpcapi.UnimplementedEventStreamServer
+	server *Server
+}
+
+// Subscribe 按主题与设备过滤推送事件；after>0 时先回放序号大于该值的保留事件，回放与实时事件之间不重复不遗漏
+func (s *eventStreamService) Subscribe(req *grpcapi.SubscribeRequest, stream grpc.ServerStreamingServer[grpcapi.Event]) error {
+	topics := make([]events.Topic, 0, len(req.GetTopics()))
+	for _, t := range req.GetTopics() {
+		topic := events.Topic(strings.TrimSpace(t))
+		if !isKnownTopic(topic) {
+			return status.Errorf(codes.InvalidArgument, "未知事件主题: %s", t)
+		}
+		topics = append(topics, topic)
+	}
+	opts := events.SubscribeOptions{
+		Name:   "grpc",
+		Topics: topics,
+		Buffer: eventStreamBuffer,
+		Replay: req.GetAfter() > 0,
+		After:  req.GetAfter(),
+	}
+	if p, ok := peer.FromContext(stream.Context()); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		opts.Name = "grpc:" + host
+	}
+	if deviceID := strings.TrimSpace(req.GetDeviceId()); deviceID != "" {
+		if v, ok := virtual.Resolve(deviceID); ok {
+			deviceID = v.ParentID
+		} else if standard, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(deviceID); err == nil {
+			deviceID = standard
+		}
+		opts.Filter = func(ev events.Event) bool { return ev.DeviceID == deviceID }
+	}
+
+	sub := events.GetGlobalBus().Subscribe(opts)
+	defer sub.Close()
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.server.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		ev, ok := sub.Next(ctx)
+		if !ok {
+			select {
+			case <-s.server.stopping:
+				return status.Error(codes.Unavailable, "服务器正在停止")
+			default:
+			}
+			if err := stream.Context().Err(); err != nil {
+				return status.FromContextError(err).Err()
+			}
+			return nil
+		}
+		if err := stream.Send(toEvent(ev)); err != nil {
+			return err
+		}
+	}
+}
+
+func isKnownTopic(topic events.Topic) bool {
+	for _, t := range events.AllTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// toEvent 总线事件转换为 Event，负载按JSON编码转换（通知事件使用对外DTO，与SSE推送一致），无法转换的负载置空
+func toEvent(ev events.Event) *grpcapi.Event {
+	msg := &grpcapi.Event{
+		Seq:        ev.Seq,
+		Topic:      string(ev.Topic),
+		Type:       ev.Type,
+		DeviceId:   ev.DeviceID,
+		TimeUnixMs: ev.Time.UnixMilli(),
+	}
+	payload := ev.Payload
+	if n, ok := payload.(*notification.NotificationEvent); ok {
+		payload = notification.ToDTO(n)
+	}
+	if payload == nil {
+		return msg
+	}
+	if data, err := json.Marshal(payload); err == nil {
+		value := &structpb.Value{}
+		if protojson.Unmarshal(data, value) == nil {
+			msg.Payload = value
+		}
+	}
+	return msg
+}
@@ -0,0 +1,454 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/selftest"
+	"github.com/bujia-iot/iot-zinx/pkg/standby"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandlers 运维管理相关 HTTP 处理器
+type AdminHandlers struct {
+	deviceGateway *gateway.DeviceGateway
+}
+
+// NewAdminHandlers 创建运维管理处理器
+func NewAdminHandlers() *AdminHandlers {
+	return &AdminHandlers{deviceGateway: gateway.GetGlobalDeviceGateway()}
+}
+
+// HandleICCIDConflicts 查询ICCID冲突
+// @Summary 查询ICCID冲突
+// @Description 列出同一ICCID从不同来源地址并发接入的冲突记录（疑似SIM卡克隆或错误配置）
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Router /api/v1/admin/iccid-conflicts [get]
+func (h *AdminHandlers) HandleICCIDConflicts(c *gin.Context) {
+	conflicts := h.deviceGateway.GetICCIDConflicts()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"conflicts": conflicts, "total": len(conflicts)}})
+}
+
+// HandleRegistrationBackfill 查询注册补齐统计
+// @Summary 查询注册补齐统计
+// @Description 启动（或大规模断连）后对已上报ICCID未注册连接的主动注册请求情况：窗口状态、请求数、主动请求注册与自发注册数量
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=gateway.RegistrationBackfillStats} "查询成功"
+// @Router /api/v1/admin/registration-backfill [get]
+func (h *AdminHandlers) HandleRegistrationBackfill(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.deviceGateway.GetRegistrationBackfill().Stats()})
+}
+
+// HandleFrameJournal 查询关键帧预写日志状态
+// @Summary 查询关键帧预写日志状态
+// @Description 关键帧（结算等）应答前预写日志的状态：是否降级、段数、占用空间、未处理条目、重放与重发去重次数
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=journal.Stats} "查询成功"
+// @Router /api/v1/admin/frame-journal [get]
+func (h *AdminHandlers) HandleFrameJournal(c *gin.Context) {
+	stats := journal.Stats{}
+	if j := journal.GetGlobalJournal(); j != nil {
+		stats = j.Stats()
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: stats})
+}
+
+// HandleHeartbeatTuning 查询自适应心跳间隔状态
+// @Summary 查询自适应心跳间隔状态
+// @Description 全局开关、演练模式、各设备的连接稳定性分级、推荐间隔与设备已确认间隔、最近一次评估结果
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=gateway.HeartbeatTuningStatus} "查询成功"
+// @Router /api/v1/admin/heartbeat-tuning [get]
+func (h *AdminHandlers) HandleHeartbeatTuning(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.deviceGateway.GetHeartbeatTuner().Status()})
+}
+
+// HandleUpdateHeartbeatTuning 切换自适应心跳开关
+// @Summary 切换自适应心跳开关
+// @Description 运行时关闭/开启自适应心跳（全局开关）或切换演练模式；已下发到设备的间隔不回滚
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body HeartbeatTuningParams true "开关参数"
+// @Success 200 {object} APIResponse{data=gateway.HeartbeatTuningStatus} "切换成功"
+// @Router /api/v1/admin/heartbeat-tuning [post]
+func (h *AdminHandlers) HandleUpdateHeartbeatTuning(c *gin.Context) {
+	var params HeartbeatTuningParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	tuner := h.deviceGateway.GetHeartbeatTuner()
+	if params.Enabled != nil {
+		tuner.SetEnabled(*params.Enabled)
+	}
+	if params.DryRun != nil {
+		tuner.SetDryRun(*params.DryRun)
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: tuner.Status()})
+}
+
+// HandleConformanceViolations 查询协议一致性违规
+// @Summary 查询协议一致性违规
+// @Description 严格模式下被NAK或丢弃的违规帧（新→旧）：连接、设备、命令、违反的规则与问题字节；宽松模式下返回空列表
+// @Tags system
+// @Produce json
+// @Param limit query int false "返回条数" default(100)
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Router /api/v1/admin/conformance-violations [get]
+func (h *AdminHandlers) HandleConformanceViolations(c *gin.Context) {
+	var q ConformanceViolationQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	checker := protocol.GetGlobalConformanceChecker()
+	if checker == nil {
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+			"mode": config.ConformanceModePermissive, "items": []protocol.ConformanceViolation{}, "total": 0,
+		}})
+		return
+	}
+	items, total := checker.Violations(q.Limit)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"mode": config.ConformanceModeStrict, "rules": checker.Rules(), "items": items, "total": total,
+	}})
+}
+
+// HandleGarbageData 查询连接杂散数据诊断
+// @Summary 查询连接杂散数据诊断
+// @Description 首个报文之前被丢弃的前导杂散数据（如路由器AT指令回显）与报文间跳过的字节：返回多次出现杂散数据或超过预算被关闭的连接（含已关闭连接）
+// @Tags system
+// @Produce json
+// @Param minEvents query int false "杂散数据出现次数下限" default(2)
+// @Success 200 {object} APIResponse{data=protocol.GarbageReport} "查询成功"
+// @Router /api/v1/admin/garbage-data [get]
+func (h *AdminHandlers) HandleGarbageData(c *gin.Context) {
+	var q GarbageDataQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: protocol.GetGlobalGarbageTracker().Report(q.MinEvents)})
+}
+
+// HandleHandlerPanics 查询处理器panic隔离记录
+// @Summary 查询处理器panic隔离记录
+// @Description 处理器panic时隔离的原始帧与解码状态（新→旧，列表不含堆栈）、各命令panic计数与因反复panic被隔离的设备；指定 id 返回含堆栈与复现包路径的完整记录
+// @Tags system
+// @Produce json
+// @Param limit query int false "返回条数" default(50)
+// @Param id query string false "隔离记录ID"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 404 {object} APIResponse "隔离记录不存在"
+// @Router /api/v1/admin/handler-panics [get]
+func (h *AdminHandlers) HandleHandlerPanics(c *gin.Context) {
+	var q HandlerPanicQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	guard := handlerguard.GetGlobalGuard()
+	if q.ID != "" {
+		rec, ok := guard.Record(q.ID)
+		if !ok {
+			c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "隔离记录不存在"})
+			return
+		}
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: rec})
+		return
+	}
+	records := guard.Records(q.Limit)
+	for i := range records {
+		records[i].Stack = ""
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"stats": guard.Stats(), "items": records}})
+}
+
+// HandleEventBusStats 查询内部事件总线统计
+// @Summary 查询内部事件总线统计
+// @Description 各主题的发布数与保留窗口，各订阅者（通知投递、SSE连接）的积压、丢弃与回放统计
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=events.BusStats} "查询成功"
+// @Router /api/v1/admin/event-bus [get]
+func (h *AdminHandlers) HandleEventBusStats(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: events.GetGlobalBus().Stats()})
+}
+
+// HandleNotificationRouteDryRun 通知路由模拟
+// @Summary 通知路由模拟
+// @Description 对样例事件执行端点路由规则（事件类型/租户/设备类型选择器），返回各端点是否接收及未匹配原因，不实际投递
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body NotificationRouteDryRunParams true "样例事件"
+// @Success 200 {object} APIResponse{data=object} "模拟成功"
+// @Router /api/v1/admin/notification-routes/dry-run [post]
+func (h *AdminHandlers) HandleNotificationRouteDryRun(c *gin.Context) {
+	var params NotificationRouteDryRunParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	deviceID := params.DeviceID
+	if deviceID != "" {
+		processor := &utils.DeviceIDProcessor{}
+		standardDeviceID, err := processor.SmartConvertDeviceID(deviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+			return
+		}
+		deviceID = standardDeviceID
+	}
+
+	event, decisions, err := notification.GetGlobalNotificationIntegrator().DryRunRoute(notification.NotificationEvent{
+		EventType:  params.EventType,
+		DeviceID:   deviceID,
+		PortNumber: params.PortNumber,
+		TenantID:   params.TenantID,
+		DeviceType: params.DeviceType,
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error()})
+		return
+	}
+	matched := make([]string, 0, len(decisions))
+	for _, d := range decisions {
+		if d.Matched {
+			matched = append(matched, d.Endpoint)
+		}
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"event":     gin.H{"event_type": event.EventType, "device_id": event.DeviceID, "port_number": event.PortNumber, "tenant_id": event.TenantID, "device_type": event.DeviceType},
+		"matched":   matched,
+		"unrouted":  len(matched) == 0,
+		"decisions": decisions,
+	}})
+}
+
+// indexCheckTimeout 手动索引健康检查的安全超时，超时后返回已检查部分的结果
+const indexCheckTimeout = 30 * time.Second
+
+// HandleIndexCheck 立即执行设备索引健康检查
+// @Summary 立即执行设备索引健康检查
+// @Description 同步检查设备ID→ICCID索引与设备组、连接会话的一致性并尝试修复，返回检查数、健康数、修复明细（修复前后ICCID）、无法修复项（具体校验错误）与耗时；超时（30秒）时 incomplete=true。与定时检查互斥，正在执行时返回409
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=core.IndexCheckResult} "检查完成"
+// @Failure 409 {object} APIResponse "已有检查正在执行"
+// @Router /api/v1/admin/index-check [post]
+func (h *AdminHandlers) HandleIndexCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), indexCheckTimeout)
+	defer cancel()
+	result, err := h.deviceGateway.RunIndexHealthCheck(ctx)
+	if errors.Is(err, core.ErrIndexCheckRunning) {
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: result})
+}
+
+// HandleSelfTest 最近一次协议自检结果
+// @Summary 最近一次协议自检结果
+// @Description 返回最近一次协议编解码自检（启动时执行或经 POST 按需执行）的结果：各已注册命令的帧往返与双算法校验和、负载结构体编解码、充电控制黄金向量、ICCID/link/DNY字节流解码，含通过数、耗时与网关版本，用于发布后验证
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=selftest.Report} "查询成功"
+// @Failure 404 {object} APIResponse "尚未执行自检"
+// @Router /api/v1/admin/self-test [get]
+func (h *AdminHandlers) HandleSelfTest(c *gin.Context) {
+	report, ok := selftest.Last()
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "尚未执行协议自检"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: report})
+}
+
+// HandleRunSelfTest 立即执行协议自检
+// @Summary 立即执行协议自检
+// @Description 同步执行一次协议编解码自检并保存为最近一次结果；有检查未通过时 data.ok=false，失败项附带错误说明
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=selftest.Report} "自检完成"
+// @Router /api/v1/admin/self-test [post]
+func (h *AdminHandlers) HandleRunSelfTest(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: selftest.Run(selftest.TriggerManual)})
+}
+
+// HandleStateDump 转储事故现场状态
+// @Summary 转储事故现场状态
+// @Description 将设备注册表、连接会话、待应答命令、端口状态、最近总线事件、统计、脱敏配置与 goroutine/heap 剖析写入一个 .tar.gz 归档（目录与大小上限见 stateDump 配置），返回归档路径与各分段的采集/写盘耗时；各分段从快照复制后再序列化，不长时间持有全局锁。按保留策略清理旧归档。离线分析使用 cmd/statedump-inspect；进程收到 SIGUSR1 时同样转储
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=statedump.Result} "转储完成"
+// @Failure 409 {object} APIResponse "已有转储正在执行"
+// @Failure 500 {object} APIResponse "写入归档失败"
+// @Failure 503 {object} APIResponse "状态转储未启用"
+// @Router /api/v1/admin/state-dump [post]
+func (h *AdminHandlers) HandleStateDump(c *gin.Context) {
+	dumper := statedump.GetGlobalDumper()
+	if dumper == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "状态转储未启用"})
+		return
+	}
+	result, err := dumper.Dump("api")
+	if errors.Is(err, statedump.ErrDumpRunning) {
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: result})
+}
+
+// HandleLastIndexCheck 最近一次定时索引健康检查结果
+// @Summary 最近一次定时索引健康检查结果
+// @Description 返回最近一次定时（每10分钟）设备索引健康检查的结构化结果；启动后尚未执行时返回404
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=core.IndexCheckResult} "查询成功"
+// @Failure 404 {object} APIResponse "尚无定时检查结果"
+// @Router /api/v1/admin/index-check/last [get]
+func (h *AdminHandlers) HandleLastIndexCheck(c *gin.Context) {
+	result, ok := h.deviceGateway.LastIndexHealthCheck()
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "尚无定时索引健康检查结果"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: result})
+}
+
+// HandleGroupCompaction 设备组惰性压缩统计
+// @Summary 设备组惰性压缩统计
+// @Description 返回压缩配置、累计重建的设备组与映射数、被重建映射的峰值条目数、估算回收字节（重建前后 HeapAlloc 差）、最近一次执行情况，以及顶层映射（连接、设备组、设备索引）的写入/删除计数与墓碑占比
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=core.GroupCompactionStats} "查询成功"
+// @Failure 503 {object} APIResponse "TCP管理器未初始化"
+// @Router /api/v1/admin/group-compaction [get]
+func (h *AdminHandlers) HandleGroupCompaction(c *gin.Context) {
+	stats, err := h.deviceGateway.GroupCompactionStats()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: stats})
+}
+
+// HandleRunGroupCompaction 立即执行设备组惰性压缩
+// @Summary 立即执行设备组惰性压缩
+// @Description 同步执行一次压缩：条目数远低于历史峰值的设备组按实际大小重建 Devices/VirtualDevices 映射，返回扫描与重建数及估算回收字节
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=core.CompactionResult} "执行完成"
+// @Failure 503 {object} APIResponse "TCP管理器未初始化"
+// @Router /api/v1/admin/group-compaction [post]
+func (h *AdminHandlers) HandleRunGroupCompaction(c *gin.Context) {
+	result, err := h.deviceGateway.CompactDeviceGroups()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: result})
+}
+
+// HandleTakeoverStatus 查询热备复制与接管状态
+// @Summary 查询热备复制与接管状态
+// @Description 主实例返回当前或最近一次接管的阶段、各阶段耗时与连接关闭进度，以及热备最近的应用进度；热备实例返回已应用的复制序号、是否已激活与交接设备的重新注册进度
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=standby.Status} "查询成功"
+// @Failure 503 {object} APIResponse "未启用热备"
+// @Router /api/v1/admin/takeover [get]
+func (h *AdminHandlers) HandleTakeoverStatus(c *gin.Context) {
+	ctrl := standby.GetGlobalController()
+	if ctrl == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用热备（standby.role）"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: ctrl.Status()})
+}
+
+// HandleBeginTakeover 发起热备接管
+// @Summary 发起热备接管
+// @Description 仅主实例可发起，异步依次执行：同步（等待热备应用最新交接状态）→ 停止接入新连接 → 激活热备 → 分批关闭设备连接 → 完成；rehearsal=true 为演练，执行除关闭连接以外的全部阶段，完成后主实例恢复接入、热备退回待命。进度经 GET /api/v1/admin/takeover 查询
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body TakeoverParams false "接管参数"
+// @Success 200 {object} APIResponse{data=standby.Handover} "已发起"
+// @Failure 409 {object} APIResponse "已有进行中的接管"
+// @Failure 503 {object} APIResponse "未启用热备或本实例不是主实例"
+// @Router /api/v1/admin/takeover [post]
+func (h *AdminHandlers) HandleBeginTakeover(c *gin.Context) {
+	var params TakeoverParams
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+			return
+		}
+	}
+	ctrl := standby.GetGlobalController()
+	if ctrl == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用热备（standby.role）"})
+		return
+	}
+	handover, err := ctrl.BeginTakeover(params.Rehearsal)
+	if errors.Is(err, standby.ErrHandoverRunning) {
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error(), Data: handover})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: handover})
+}
+
+// HandleAbortTakeover 中止进行中的热备接管
+// @Summary 中止进行中的热备接管
+// @Description 中止后主实例恢复接入新连接，热备收到中止信号后退回待命（已激活时停止接入）；已关闭的连接不会恢复，设备重连到恢复接入的实例
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=standby.Handover} "已中止"
+// @Failure 409 {object} APIResponse "没有进行中的接管"
+// @Failure 503 {object} APIResponse "未启用热备"
+// @Router /api/v1/admin/takeover/abort [post]
+func (h *AdminHandlers) HandleAbortTakeover(c *gin.Context) {
+	ctrl := standby.GetGlobalController()
+	if ctrl == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用热备（standby.role）"})
+		return
+	}
+	handover, err := ctrl.Abort()
+	if err != nil {
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: handover})
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/anomaly"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/gin-gonic/gin"
+)
+
+// AnomalyHandlers 心跳数据异常检测 HTTP 处理器
+type AnomalyHandlers struct{}
+
+// NewAnomalyHandlers 创建异常检测处理器
+func NewAnomalyHandlers() *AnomalyHandlers { return &AnomalyHandlers{} }
+
+// detector 全局异常检测器，未启用时返回503
+func (h *AnomalyHandlers) detector(c *gin.Context) (*anomaly.Detector, bool) {
+	d := anomaly.GetGlobalDetector()
+	if d == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "心跳数据异常检测未启用"})
+		return nil, false
+	}
+	return d, true
+}
+
+// HandleDeviceAnomalies 设备心跳数据异常事件
+// @Summary 设备心跳数据异常事件
+// @Description 设备温度、电压、信号强度与端口功率的进行中异常事件（open）、最近事件（episodes，新→旧，含已恢复）与各指标当前基线。
+// @Description 持续偏离基线超过 anomalyDetection.sigmaThreshold（kind=deviation）或连续单调变化（kind=trend）时开启事件，peakDeviation 为峰值偏离的σ数。虚拟子设备返回其物理设备的事件
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID（可为虚拟子设备ID）"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 404 {object} APIResponse "该设备暂无心跳数据样本"
+// @Failure 503 {object} APIResponse "异常检测未启用"
+// @Router /api/v1/device/{deviceId}/anomalies [get]
+func (h *AnomalyHandlers) HandleDeviceAnomalies(c *gin.Context) {
+	rawID := c.Param("deviceId")
+	deviceID := rawID
+	if v, ok := virtual.Resolve(rawID); ok {
+		deviceID = v.ParentID
+	} else {
+		standard, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(rawID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+			return
+		}
+		deviceID = standard
+	}
+	d, ok := h.detector(c)
+	if !ok {
+		return
+	}
+	report, found := d.Device(deviceID)
+	if !found {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "该设备暂无心跳数据样本", Data: gin.H{"deviceId": rawID, "standardId": deviceID}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId":   rawID,
+		"standardId": deviceID,
+		"severity":   report.Severity,
+		"open":       report.Open,
+		"episodes":   report.Episodes,
+		"baselines":  report.Baselines,
+	}})
+}
+
+// HandleFleetAnomalies 全部设备心跳数据异常
+// @Summary 全部设备心跳数据异常
+// @Description 有异常事件的设备按严重度（进行中事件的最大峰值偏离σ数）从高到低排序，同严重度按最近事件开启时间从新到旧；state=all 时包含仅有已恢复事件的设备（严重度为0）
+// @Tags device
+// @Produce json
+// @Param state query string false "open: 只返回有进行中事件的设备 | all，默认open"
+// @Param limit query int false "返回设备数，默认100"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 503 {object} APIResponse "异常检测未启用"
+// @Router /api/v1/anomalies [get]
+func (h *AnomalyHandlers) HandleFleetAnomalies(c *gin.Context) {
+	var q AnomalyFleetQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	d, ok := h.detector(c)
+	if !ok {
+		return
+	}
+	reports := d.Fleet(q.State == "open")
+	total := len(reports)
+	if len(reports) > q.Limit {
+		reports = reports[:q.Limit]
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"state":          q.State,
+		"trackedDevices": d.Devices(),
+		"total":          total,
+		"devices":        reports,
+	}})
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandlers 设备合规审计 HTTP 处理器
+type AuditHandlers struct{}
+
+// NewAuditHandlers 创建审计处理器
+func NewAuditHandlers() *AuditHandlers { return &AuditHandlers{} }
+
+// HandleCreateAudit 创建审计
+// @Summary 创建设备合规审计
+// @Description 定义审计规则（字段路径/运算符/期望值），可选择立即执行或定时执行
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body AuditCreateParams true "审计定义"
+// @Success 200 {object} APIResponse{data=object} "创建成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Router /api/v1/audits [post]
+func (h *AuditHandlers) HandleCreateAudit(c *gin.Context) {
+	var req AuditCreateParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+
+	a := &audit.Audit{
+		ID:             strings.TrimSpace(req.ID),
+		Name:           req.Name,
+		StaleThreshold: time.Duration(req.StaleThresholdMinutes) * time.Minute,
+		Interval:       time.Duration(req.IntervalMinutes) * time.Minute,
+	}
+	for _, r := range req.Rules {
+		a.Rules = append(a.Rules, audit.Rule{Field: r.Field, Operator: r.Operator, Expected: r.Expected})
+	}
+
+	engine := audit.GetGlobalEngine()
+	created, err := engine.CreateAudit(a)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+
+	data := gin.H{"audit": created}
+	if req.RunNow {
+		report, err := engine.Run(created.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "审计执行失败: " + err.Error(), Data: data})
+			return
+		}
+		data["report"] = report
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: data})
+}
+
+// HandleRunAudit 立即执行审计
+// @Summary 立即执行审计
+// @Tags system
+// @Produce json
+// @Param id path string true "审计ID"
+// @Success 200 {object} APIResponse{data=object} "执行成功"
+// @Router /api/v1/audits/{id}/run [post]
+func (h *AuditHandlers) HandleRunAudit(c *gin.Context) {
+	var uri AuditIDURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "审计ID不能为空"})
+		return
+	}
+	report, err := audit.GetGlobalEngine().Run(uri.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: report})
+}
+
+// HandleAuditReport 获取审计报告
+// @Summary 获取审计报告
+// @Description 返回最近一次执行的报告，列出不合规与数据过期(unknown)设备；format=csv 导出CSV
+// @Tags system
+// @Produce json
+// @Produce text/csv
+// @Param id path string true "审计ID"
+// @Param format query string false "json 或 csv"
+// @Success 200 {object} APIResponse{data=object} "获取成功"
+// @Failure 404 {object} APIResponse "审计或报告不存在"
+// @Router /api/v1/audits/{id}/report [get]
+func (h *AuditHandlers) HandleAuditReport(c *gin.Context) {
+	var uri AuditIDURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "审计ID不能为空"})
+		return
+	}
+	var q AuditReportQuery
+	_ = c.ShouldBindQuery(&q)
+
+	engine := audit.GetGlobalEngine()
+	if _, ok := engine.GetAudit(uri.ID); !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "审计不存在"})
+		return
+	}
+	report, ok := engine.GetReport(uri.ID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "审计尚未执行，暂无报告"})
+		return
+	}
+
+	if strings.EqualFold(q.Format, "csv") {
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "导出CSV失败: " + err.Error()})
+			return
+		}
+		filename := fmt.Sprintf("audit_%s_%s.csv", report.AuditID, report.GeneratedAt.Format("20060102150405"))
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: report})
+}
+
+// HandleListAudits 列出审计定义
+// @Summary 列出审计定义
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "获取成功"
+// @Router /api/v1/audits [get]
+func (h *AuditHandlers) HandleListAudits(c *gin.Context) {
+	audits := audit.GetGlobalEngine().ListAudits()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"audits": audits, "total": len(audits)}})
+}
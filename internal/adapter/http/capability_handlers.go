@@ -0,0 +1,150 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// requireFirmwareSupport 下发前校验设备固件能力，不支持时返回422及 UNSUPPORTED_BY_FIRMWARE，不再下发注定超时的帧
+func requireFirmwareSupport(c *gin.Context, gw *gateway.DeviceGateway, standardDeviceID string, commands ...byte) bool {
+	err := gw.CheckCommandSupported(standardDeviceID, commands...)
+	if err == nil {
+		return true
+	}
+	var unsupported *capability.UnsupportedError
+	if !errors.As(err, &unsupported) {
+		return true
+	}
+	c.JSON(http.StatusUnprocessableEntity, APIResponse{Code: 422, Message: "设备固件不支持该功能", Data: gin.H{
+		"deviceId":        standardDeviceID,
+		"errorCode":       capability.ErrorCodeUnsupportedByFirmware,
+		"command":         capability.FormatCommand(unsupported.Command),
+		"firmwareVersion": unsupported.Version,
+		"capabilities":    unsupported.Set,
+		"error":           unsupported.Error(),
+	}})
+	return false
+}
+
+// HandleCapabilities 设备能力矩阵与单设备例外
+// @Summary 设备能力矩阵与单设备例外
+// @Description 返回当前生效的能力矩阵（基础命令与各版本范围规则）、未知版本策略、最近一次热加载错误与全部单设备例外
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=capability.Status} "查询成功"
+// @Router /api/v1/admin/capabilities [get]
+func (h *AdminHandlers) HandleCapabilities(c *gin.Context) {
+	registry := capability.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "未启用设备能力矩阵", Data: capability.Status{}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: registry.Status()})
+}
+
+// HandleReloadCapabilities 立即重新加载能力矩阵
+// @Summary 立即重新加载能力矩阵
+// @Description 重新读取并校验能力矩阵文件，校验失败时返回错误原因并继续使用旧矩阵；成功后在线设备的能力集立即重新推导
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=capability.Status} "加载成功"
+// @Failure 422 {object} APIResponse "矩阵校验失败"
+// @Failure 503 {object} APIResponse "未启用设备能力矩阵"
+// @Router /api/v1/admin/capabilities/reload [post]
+func (h *AdminHandlers) HandleReloadCapabilities(c *gin.Context) {
+	registry := capability.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用设备能力矩阵"})
+		return
+	}
+	if err := registry.Reload(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{Code: 422, Message: "能力矩阵校验失败，继续使用旧矩阵", Data: gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "能力矩阵已重新加载", Data: registry.Status()})
+}
+
+// HandleSetCapabilityOverride 设置单设备能力例外
+// @Summary 设置单设备能力例外
+// @Description 在能力矩阵推导结果上为单台设备追加(allow)或移除(deny)命令，用于版本上报有误等例外；设置后立即生效并持久化
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param request body CapabilityOverrideParams true "例外参数"
+// @Success 200 {object} APIResponse{data=CapabilityOverrideResponse} "设置成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 503 {object} APIResponse "未启用设备能力矩阵"
+// @Router /api/v1/admin/capabilities/overrides/{deviceId} [put]
+func (h *AdminHandlers) HandleSetCapabilityOverride(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	registry := capability.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用设备能力矩阵"})
+		return
+	}
+	var params CapabilityOverrideParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	override, err := registry.SetOverride(capability.Override{
+		DeviceID: standardDeviceID,
+		Allow:    params.Allow,
+		Deny:     params.Deny,
+		Reason:   params.Reason,
+	})
+	if override.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "例外已生效但持久化失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: CapabilityOverrideResponse{
+		Override:     override,
+		Capabilities: h.deviceGateway.GetDeviceCapabilities(standardDeviceID),
+	}})
+}
+
+// HandleDeleteCapabilityOverride 删除单设备能力例外
+// @Summary 删除单设备能力例外
+// @Description 删除后设备能力集恢复为能力矩阵推导结果
+// @Tags system
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse "删除成功"
+// @Failure 404 {object} APIResponse "设备没有能力例外"
+// @Router /api/v1/admin/capabilities/overrides/{deviceId} [delete]
+func (h *AdminHandlers) HandleDeleteCapabilityOverride(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	registry := capability.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备没有能力例外"})
+		return
+	}
+	removed, err := registry.RemoveOverride(standardDeviceID)
+	if !removed {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备没有能力例外"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "例外已删除但持久化失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId":     standardDeviceID,
+		"capabilities": h.deviceGateway.GetDeviceCapabilities(standardDeviceID),
+	}})
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCapturedResponseBytes 变更记录从响应中提取结果消息时最多缓存的字节数
+const maxCapturedResponseBytes = 4096
+
+// ChangeLogMiddleware 运维变更记录中间件：记录所有变更类调用（POST/PUT/PATCH/DELETE）的调用方、请求体、
+// 目标设备、调用前后的设备状态快照与结果；快照尽力采集（有超时），不阻塞也不影响调用本身
+func ChangeLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := changelog.GetGlobalLog()
+		endpoint := c.FullPath()
+		if l == nil || endpoint == "" || !isMutatingMethod(c.Request.Method) || l.Excluded(endpoint) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var raw []byte
+		if c.Request.Body != nil {
+			raw, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		}
+		opts := l.Options()
+		rec := changelog.Record{
+			Timestamp: start,
+			KeyName:   strings.TrimSpace(c.GetHeader(opts.KeyHeader)),
+			Tenant:    strings.TrimSpace(c.GetHeader(opts.TenantHeader)),
+			ClientIP:  c.ClientIP(),
+			Method:    c.Request.Method,
+			Endpoint:  endpoint,
+			Path:      c.Request.URL.Path,
+		}
+		var body map[string]interface{}
+		_ = json.Unmarshal(raw, &body)
+		if rec.Tenant == "" {
+			rec.Tenant, _ = body["tenantId"].(string)
+		}
+		rec.Devices = changeTargetDevices(c, body)
+		rec.RequestBody, rec.BodyTruncated = l.PrepareBody(raw)
+
+		var beforeTruncated, afterTruncated bool
+		var beforeErr, afterErr string
+		rec.Before, beforeTruncated, beforeErr = l.CaptureSnapshots(rec.Devices)
+
+		capture := &changeLogResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = capture
+		c.Next()
+		c.Writer = capture.ResponseWriter
+
+		rec.After, afterTruncated, afterErr = l.CaptureSnapshots(rec.Devices)
+		rec.SnapshotTruncated = beforeTruncated || afterTruncated
+		rec.SnapshotError = beforeErr
+		if rec.SnapshotError == "" {
+			rec.SnapshotError = afterErr
+		}
+		rec.CorrelationID = GetCorrelationID(c)
+		rec.Status = c.Writer.Status()
+		rec.Message = capture.message()
+		rec.DurationMs = time.Since(start).Milliseconds()
+		l.Append(rec)
+	}
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// changeTargetDevices 从路径参数与请求体（deviceId/device_id/deviceIds）提取目标设备，统一为标准设备ID，虚拟子设备记为其物理设备
+func changeTargetDevices(c *gin.Context, body map[string]interface{}) []string {
+	var candidates []string
+	if id := c.Param("deviceId"); id != "" {
+		candidates = append(candidates, id)
+	}
+	for _, key := range []string{"deviceId", "device_id"} {
+		if id, ok := body[key].(string); ok && id != "" {
+			candidates = append(candidates, id)
+		}
+	}
+	if ids, ok := body["deviceIds"].([]interface{}); ok {
+		for _, v := range ids {
+			if id, ok := v.(string); ok && id != "" {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+
+	processor := &utils.DeviceIDProcessor{}
+	seen := make(map[string]struct{}, len(candidates))
+	devices := make([]string, 0, len(candidates))
+	for _, id := range candidates {
+		if v, ok := virtual.Resolve(id); ok {
+			id = v.ParentID
+		} else if standard, err := processor.SmartConvertDeviceID(id); err == nil {
+			id = standard
+		}
+		if _, dup := seen[id]; dup {
+			continue
+		}
+		seen[id] = struct{}{}
+		devices = append(devices, id)
+	}
+	return devices
+}
+
+// changeLogResponseWriter 缓存响应体前若干字节，用于提取结果消息
+type changeLogResponseWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *changeLogResponseWriter) Write(data []byte) (int, error) {
+	w.keep(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *changeLogResponseWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *changeLogResponseWriter) keep(data []byte) {
+	if remaining := maxCapturedResponseBytes - w.buf.Len(); remaining > 0 {
+		if len(data) > remaining {
+			data = data[:remaining]
+		}
+		w.buf.Write(data)
+	}
+}
+
+// message 响应中的 message 字段（附带 data.errorCode），非JSON或超长时为空
+func (w *changeLogResponseWriter) message() string {
+	var resp struct {
+		Message string `json:"message"`
+		Data    struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(w.buf.Bytes(), &resp) != nil {
+		return ""
+	}
+	if resp.Data.ErrorCode != "" {
+		return resp.Message + " (" + resp.Data.ErrorCode + ")"
+	}
+	return resp.Message
+}
+
+// HandleChangeLog 运维变更记录查询与导出
+// @Summary 运维变更记录
+// @Description 按设备、调用方API Key、接口与时间范围查询变更类API调用记录（按时间倒序），含脱敏请求体、调用前后设备状态快照与结果；format=csv 时导出CSV
+// @Tags system
+// @Produce json
+// @Produce text/csv
+// @Param deviceId query string false "目标设备ID"
+// @Param key query string false "调用方API Key名称"
+// @Param endpoint query string false "接口（路由模板或路径包含该字符串）"
+// @Param from query int false "起始时间（Unix秒）"
+// @Param to query int false "结束时间（Unix秒）"
+// @Param limit query int false "返回条数，默认200"
+// @Param format query string false "json 或 csv"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 503 {object} APIResponse "未启用运维变更记录"
+// @Router /api/v1/admin/changelog [get]
+func (h *AdminHandlers) HandleChangeLog(c *gin.Context) {
+	l := changelog.GetGlobalLog()
+	if l == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用运维变更记录"})
+		return
+	}
+	var q ChangeLogQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	filter := changelog.Filter{KeyName: q.Key, Endpoint: q.Endpoint, Limit: q.Limit}
+	if q.DeviceID != "" {
+		filter.DeviceID = q.DeviceID
+		if v, ok := virtual.Resolve(q.DeviceID); ok {
+			filter.DeviceID = v.ParentID
+		} else if standard, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(q.DeviceID); err == nil {
+			filter.DeviceID = standard
+		}
+	}
+	if q.From > 0 {
+		filter.From = time.Unix(q.From, 0)
+	}
+	if q.To > 0 {
+		filter.To = time.Unix(q.To, 0)
+	}
+	records := l.Query(filter)
+
+	if strings.EqualFold(q.Format, "csv") {
+		var buf bytes.Buffer
+		if err := changelog.WriteCSV(&buf, records); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "导出CSV失败: " + err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=changelog_"+time.Now().Format("20060102150405")+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"records": records,
+		"total":   len(records),
+		"stats":   l.Stats(),
+	}})
+}
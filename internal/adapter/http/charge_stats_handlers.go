@@ -0,0 +1,92 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/chargestats"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 未指定起始时间时的默认区间
+	defaultChargingStatsHourRange = 24 * time.Hour
+	defaultChargingStatsDayRange  = 30 * 24 * time.Hour
+	// defaultChargingStatsTenantHeader 未配置时的租户范围请求头
+	defaultChargingStatsTenantHeader = "X-Tenant-ID"
+)
+
+// ChargeStatsHandlers 充电统计看板 HTTP 处理器
+type ChargeStatsHandlers struct{}
+
+// NewChargeStatsHandlers 创建充电统计处理器
+func NewChargeStatsHandlers() *ChargeStatsHandlers { return &ChargeStatsHandlers{} }
+
+// HandleChargingStats 充电统计看板
+// @Summary 充电统计看板
+// @Description 按小时或自然日时间桶返回对齐的图表序列：开始、完成、失败、取消、重启中断的订单数，结算电量合计与均值、平均会话时长、使用设备数（去重）。
+// @Description 数据来自增量维护的汇总（订单变更与结算日志存储），不扫描历史记录；没有数据的时间桶为0，尚未结束或早于统计覆盖起点（coverageStart）的桶 partial 为 true。
+// @Description 时间桶按配置时区的本地整点与自然日对齐，夏令时切换日的天桶为23或25小时（见 bucketSeconds）。
+// @Description 请求携带租户范围请求头（默认 X-Tenant-ID）时只能查询该租户，tenant 参数与之不符返回403
+// @Tags system
+// @Produce json
+// @Param from query int false "起始时间（Unix秒）"
+// @Param to query int false "结束时间（Unix秒，不含）"
+// @Param bucket query string false "时间桶宽度：hour 或 day，默认 hour"
+// @Param tenant query string false "租户ID，为空表示全部租户"
+// @Success 200 {object} APIResponse{data=chargestats.Series} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 403 {object} APIResponse "超出租户范围"
+// @Failure 503 {object} APIResponse "充电统计未启用"
+// @Router /api/v1/stats/charging [get]
+func (h *ChargeStatsHandlers) HandleChargingStats(c *gin.Context) {
+	stats := chargestats.GetGlobalAggregator()
+	if stats == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "充电统计未启用（chargeStats.enabled）"})
+		return
+	}
+	var q ChargingStatsQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+
+	tenant := strings.TrimSpace(q.Tenant)
+	header := config.GetConfig().ChargeStats.TenantHeader
+	if header == "" {
+		header = defaultChargingStatsTenantHeader
+	}
+	if scope := strings.TrimSpace(c.GetHeader(header)); scope != "" {
+		if tenant != "" && tenant != scope {
+			c.JSON(http.StatusForbidden, APIResponse{Code: 403, Message: "只能查询本租户的充电统计", Data: gin.H{"tenant": tenant, "scope": scope}})
+			return
+		}
+		tenant = scope
+	}
+
+	query := chargestats.Query{Tenant: tenant, Bucket: q.Bucket}
+	if q.To > 0 {
+		query.To = time.Unix(q.To, 0)
+	}
+	if q.From > 0 {
+		query.From = time.Unix(q.From, 0)
+	} else {
+		end := query.To
+		if end.IsZero() {
+			end = time.Now()
+		}
+		if q.Bucket == chargestats.BucketDay {
+			query.From = end.Add(-defaultChargingStatsDayRange)
+		} else {
+			query.From = end.Add(-defaultChargingStatsHourRange)
+		}
+	}
+	series, err := stats.Query(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: series})
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/chargepolicy"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// 试运行检查项
+const (
+	dryRunCheckParams          = "params"           // 请求参数与设备ID格式
+	dryRunCheckVirtualTarget   = "virtual_target"   // 虚拟子设备寻址转换
+	dryRunCheckChargingPolicy  = "charging_policy"  // 充电参数护栏
+	dryRunCheckDeviceOnline    = "device_online"    // 设备在线（本实例持有连接）
+	dryRunCheckFirmwareSupport = "firmware_support" // 设备固件支持0x82
+	dryRunCheckOrderConflict   = "order_conflict"   // 端口进行中订单与状态机（并发/幂等保护）
+	dryRunCheckChargeQueue     = "charge_queue"     // 同一订单是否已在设备侧排队
+	dryRunCheckOrderMatch      = "order_match"      // 停止/调整的订单与进行中订单一致
+	dryRunCheckCommandBuild    = "command_build"    // 促销咨询、命令参数校验与DNY帧构造
+)
+
+// DryRunCheck 试运行的单项检查结果
+type DryRunCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ChargingDryRunStats 充电控制试运行计数（与真实下发分开统计）
+type ChargingDryRunStats struct {
+	Total    int64            `json:"total"`
+	Passed   int64            `json:"passed"`   // 全部检查通过（含排队/幂等等不下发的成功响应）
+	Rejected int64            `json:"rejected"` // 任一检查未通过
+	ByAction map[string]int64 `json:"byAction"` // start | stop | update_power
+}
+
+var (
+	chargingDryRunMu    sync.Mutex
+	chargingDryRunStats = ChargingDryRunStats{ByAction: make(map[string]int64)}
+)
+
+// GetChargingDryRunStats 充电控制试运行计数快照
+func GetChargingDryRunStats() ChargingDryRunStats {
+	chargingDryRunMu.Lock()
+	defer chargingDryRunMu.Unlock()
+	snapshot := chargingDryRunStats
+	snapshot.ByAction = make(map[string]int64, len(chargingDryRunStats.ByAction))
+	for action, n := range chargingDryRunStats.ByAction {
+		snapshot.ByAction[action] = n
+	}
+	return snapshot
+}
+
+// chargingDryRun 单次充电控制试运行：按顺序记录已通过的检查项，未通过的检查沿用真实请求的错误响应
+type chargingDryRun struct {
+	action string
+	checks []DryRunCheck
+}
+
+// newChargingDryRun 请求体 dryRun=true 或查询参数 dryRun=true 时开启试运行（非试运行返回nil），响应带 X-Dry-Run 头
+func newChargingDryRun(c *gin.Context, action string, requested bool) *chargingDryRun {
+	if !requested {
+		requested, _ = strconv.ParseBool(c.Query("dryRun"))
+	}
+	if !requested {
+		return nil
+	}
+	c.Header("X-Dry-Run", "true")
+	return &chargingDryRun{action: action}
+}
+
+// pass 记录通过的检查项（非试运行时无操作）
+func (d *chargingDryRun) pass(name, detail string) {
+	if d == nil {
+		return
+	}
+	d.checks = append(d.checks, DryRunCheck{Name: name, Passed: true, Detail: detail})
+}
+
+// apply 在响应中标记试运行并附检查结果
+func (d *chargingDryRun) apply(resp *ChargingActionResponse) {
+	if d == nil {
+		return
+	}
+	resp.DryRun = true
+	resp.Checks = d.checks
+}
+
+// finish 请求结束时计数并记录日志：非200响应视为下一项检查未通过
+func (d *chargingDryRun) finish(c *gin.Context) {
+	if d == nil {
+		return
+	}
+	status := c.Writer.Status()
+	passed := status == http.StatusOK
+
+	chargingDryRunMu.Lock()
+	chargingDryRunStats.Total++
+	chargingDryRunStats.ByAction[d.action]++
+	if passed {
+		chargingDryRunStats.Passed++
+	} else {
+		chargingDryRunStats.Rejected++
+	}
+	chargingDryRunMu.Unlock()
+
+	names := make([]string, 0, len(d.checks))
+	for _, check := range d.checks {
+		names = append(names, check.Name)
+	}
+	logger.WithFields(logrus.Fields{
+		"correlationID": GetCorrelationID(c),
+		"action":        d.action,
+		"passed":        passed,
+		"status":        status,
+		"checks":        names,
+	}).Info("充电控制试运行（未下发）")
+}
+
+// policyWarningsDetail 护栏检查的说明：接近上限的参数
+func policyWarningsDetail(warnings []chargepolicy.Violation) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d项参数接近上限", len(warnings))
+}
+
+// promotionDetail 命令构造检查的说明：生效的促销
+func promotionDetail(promo *gateway.AppliedPromotion) string {
+	if promo == nil {
+		return ""
+	}
+	return "促销已生效: " + promo.Tag
+}
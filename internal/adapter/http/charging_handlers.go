@@ -1,15 +1,26 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/bujia-iot/iot-zinx/pkg/chargepolicy"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/idempotency"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
 	"github.com/gin-gonic/gin"
 )
 
+// 开始充电的业务错误码
+const (
+	ErrorCodeDuplicateOrder      = "DUPLICATE_ORDER"       // 幂等窗口内重复提交的订单号
+	ErrorCodeSessionLimitReached = "SESSION_LIMIT_REACHED" // 设备并发充电会话已达上限
+)
+
 // ChargingHandlers 充电相关 HTTP 处理器
 type ChargingHandlers struct {
 	deviceGateway *gateway.DeviceGateway
@@ -20,12 +31,31 @@ func NewChargingHandlers() *ChargingHandlers {
 }
 
 // HandleStartCharging 开始充电 - 修复CVE-High-001
+// @Summary 开始充电
+// @Description 校验充电参数护栏、设备在线、固件能力与端口订单状态后下发0x82开始充电；端口繁忙时设备侧排队。
+// @Description dryRun=true（请求体或查询参数）时执行全部校验并返回将下发的帧，不下发、不创建会话。
+// @Description 设备配置了并发会话上限时，超出满功率名额且智能降功率已启用的请求以降功率接入（响应 overloadPowerW）
+// @Tags charging
+// @Accept json
+// @Produce json
+// @Param request body ChargingStartParams true "充电参数"
+// @Param dryRun query bool false "试运行"
+// @Param Idempotency-Key header string false "调用方幂等键：同一键的重试在窗口内重放首个应答（响应头 Idempotent-Replayed: true），首个请求执行中返回409（errorCode=IDEMPOTENCY_IN_FLIGHT），请求体不同返回422（errorCode=IDEMPOTENCY_KEY_REUSED）"
+// @Success 200 {object} APIResponse{data=ChargingActionResponse} "充电启动成功（或试运行通过）"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 409 {object} APIResponse "充电状态冲突，幂等窗口内重复的订单号（errorCode=DUPLICATE_ORDER），或设备并发会话已达上限（errorCode=SESSION_LIMIT_REACHED，附进行中的端口）"
+// @Failure 421 {object} APIResponse "设备由其他网关实例持有"
+// @Failure 422 {object} APIResponse "充电参数超出策略限制或固件不支持"
+// @Failure 503 {object} APIResponse "设备不在线"
+// @Router /api/v1/charging/start [post]
 func (h *ChargingHandlers) HandleStartCharging(c *gin.Context) {
 	var req ChargingStartParams
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误", Data: gin.H{"error": err.Error()}})
 		return
 	}
+	dry := newChargingDryRun(c, "start", req.DryRun)
+	defer dry.finish(c)
 
 	// 参数验证增强
 	if req.DeviceID == "" {
@@ -36,6 +66,13 @@ func (h *ChargingHandlers) HandleStartCharging(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "订单号不能为空", Data: nil})
 		return
 	}
+	target, ok := h.translateVirtualTarget(c, &req.DeviceID, &req.Port)
+	if !ok {
+		return
+	}
+	if target != nil {
+		dry.pass(dryRunCheckVirtualTarget, target.VirtualID)
+	}
 	if req.Port == 0 {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "端口号不能为0", Data: nil})
 		return
@@ -47,52 +84,199 @@ func (h *ChargingHandlers) HandleStartCharging(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、六位十六进制(A26CF3)、八位十六进制(04A26CF3)"}})
 		return
 	}
+	dry.pass(dryRunCheckParams, standardDeviceID)
+
+	// 充电参数护栏：超限直接拒绝，接近上限放行并在响应中标记
+	policyParams := chargepolicy.Params{RateMode: &req.Mode, Balance: req.Balance}
+	if req.Mode == 0 {
+		policyParams.ChargeDuration = uint32(req.Value)
+	}
+	policyWarnings, ok := enforceChargingPolicy(c, standardDeviceID, req.TenantID, policyParams)
+	if !ok {
+		return
+	}
+	dry.pass(dryRunCheckChargingPolicy, policyWarningsDetail(policyWarnings))
 
 	// 设备在线状态验证
 	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
 		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "设备不在线", Data: nil})
 		return
 	}
+	dry.pass(dryRunCheckDeviceOnline, "")
+
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, constants.CmdChargeControl) {
+		return
+	}
+	dry.pass(dryRunCheckFirmwareSupport, "")
 
 	// 幂等性检查 - 检查是否已有进行中的订单
 	if err := h.checkChargingIdempotency(standardDeviceID, int(req.Port), req.OrderNo); err != nil {
 		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: "充电状态冲突", Data: gin.H{"error": err.Error()}})
 		return
 	}
+	dry.pass(dryRunCheckOrderConflict, "")
+
+	// 同一订单已在设备侧排队：不重复下发，返回排队信息（协议未提供预计等待时长，返回待充端口与超时时间）
+	correlationID := GetCorrelationID(c)
+	if queued, ok := h.deviceGateway.GetChargeQueue().Get(standardDeviceID, int(req.Port)); ok && queued.OrderNo == req.OrderNo {
+		resp := ChargingActionResponse{
+			DeviceID:       req.DeviceID,
+			StandardID:     standardDeviceID,
+			Port:           req.Port,
+			OrderNo:        req.OrderNo,
+			Action:         "start",
+			State:          gateway.StateQueued.String(),
+			Queue:          &queued,
+			PolicyWarnings: policyWarnings,
+			Timestamp:      time.Now().Unix(),
+			CorrelationID:  correlationID,
+		}
+		target.apply(&resp)
+		dry.pass(dryRunCheckChargeQueue, "同一订单已在设备侧排队，不重复下发")
+		dry.apply(&resp)
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "充电排队中", Data: resp})
+		return
+	}
+	dry.pass(dryRunCheckChargeQueue, "")
 
-	// 发送充电命令
-	if err := h.deviceGateway.SendChargingCommandWithParams(standardDeviceID, req.Port, 0x01, req.OrderNo, req.Mode, req.Value, req.Balance); err != nil {
-		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "充电启动失败", Data: gin.H{"error": err.Error()}})
+	chargeReq := gateway.ChargeRequest{
+		DeviceID: standardDeviceID,
+		TenantID: req.TenantID,
+		Port:     int(req.Port),
+		OrderNo:  req.OrderNo,
+		Mode:     req.Mode,
+		Value:    req.Value,
+		Balance:  req.Balance,
+	}
+	if dry != nil {
+		promo, preview, err := h.deviceGateway.PreviewChargingCommand(chargeReq, 0x01)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "充电启动失败", Data: gin.H{"error": err.Error(), "correlationId": correlationID}})
+			return
+		}
+		dry.pass(dryRunCheckCommandBuild, promotionDetail(promo))
+		resp := ChargingActionResponse{
+			DeviceID:       req.DeviceID,
+			StandardID:     standardDeviceID,
+			Port:           req.Port,
+			OrderNo:        req.OrderNo,
+			Mode:           req.Mode,
+			Value:          req.Value,
+			Balance:        req.Balance,
+			Action:         "start",
+			Promotion:      promo,
+			PolicyWarnings: policyWarnings,
+			Timestamp:      time.Now().Unix(),
+			CorrelationID:  correlationID,
+			Packet:         &preview,
+		}
+		if promo != nil {
+			resp.Mode, resp.Value, resp.Balance = promo.Mode, promo.Value, promo.Balance
+		}
+		target.apply(&resp)
+		dry.apply(&resp)
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "试运行通过，未下发", Data: resp})
+		return
+	}
+
+	// 订单号幂等窗口：窗口内重复提交同一订单号不再下发；下发失败时撤销登记以便立即重试
+	guard := idempotency.GetGlobalGuard()
+	idempotencyKey := fmt.Sprintf("charge:%s:%d:%s", standardDeviceID, req.Port, req.OrderNo)
+	if guard != nil {
+		if fresh, source := guard.Claim(idempotencyKey); !fresh {
+			c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: "幂等窗口内重复的订单号", Data: gin.H{
+				"errorCode":  ErrorCodeDuplicateOrder,
+				"orderNo":    req.OrderNo,
+				"ttlSeconds": int(guard.TTL().Seconds()),
+				"source":     source,
+			}})
+			return
+		}
+	}
+
+	// 发送充电命令（携带链路追踪ID，下发前经过促销策略）
+	promo, err := h.deviceGateway.StartChargingWithRequest(correlationID, chargeReq)
+	if err != nil {
+		if guard != nil {
+			guard.Release(idempotencyKey)
+		}
+		var limitErr *gateway.SessionLimitError
+		if errors.As(err, &limitErr) {
+			c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: "设备并发充电会话已达上限", Data: gin.H{
+				"errorCode":     ErrorCodeSessionLimitReached,
+				"deviceId":      limitErr.DeviceID,
+				"maxConcurrent": limitErr.MaxConcurrent,
+				"activePorts":   limitErr.ActivePorts,
+				"error":         limitErr.Error(),
+				"correlationId": correlationID,
+			}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "充电启动失败", Data: gin.H{"error": err.Error(), "correlationId": correlationID}})
 		return
 	}
 
 	resp := ChargingActionResponse{
-		DeviceID:   req.DeviceID,
-		StandardID: standardDeviceID,
-		Port:       req.Port,
-		OrderNo:    req.OrderNo,
-		Mode:       req.Mode,
-		Value:      req.Value,
-		Balance:    req.Balance,
-		Action:     "start",
-		Timestamp:  time.Now().Unix(),
+		DeviceID:       req.DeviceID,
+		StandardID:     standardDeviceID,
+		Port:           req.Port,
+		OrderNo:        req.OrderNo,
+		Mode:           req.Mode,
+		Value:          req.Value,
+		Balance:        req.Balance,
+		Action:         "start",
+		Promotion:      promo,
+		PolicyWarnings: policyWarnings,
+		Timestamp:      time.Now().Unix(),
+		CorrelationID:  correlationID,
 	}
+	if promo != nil {
+		resp.Mode, resp.Value, resp.Balance = promo.Mode, promo.Value, promo.Balance
+	}
+	if order := h.deviceGateway.GetOrderManager().GetOrder(standardDeviceID, int(req.Port)); order != nil && order.OrderNo == req.OrderNo {
+		resp.OverloadPowerW = order.OverloadPowerW
+	}
+	target.apply(&resp)
 	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "充电启动成功", Data: resp})
 }
 
 // HandleStopCharging 停止充电 - 修复CVE-High-003
+// @Summary 停止充电
+// @Description 校验订单与端口进行中订单一致后下发0x82停止充电；dryRun=true 时只校验并返回将下发的帧
+// @Tags charging
+// @Accept json
+// @Produce json
+// @Param request body ChargingStopParams true "停止参数"
+// @Param dryRun query bool false "试运行"
+// @Param Idempotency-Key header string false "调用方幂等键：同一键的重试在窗口内重放首个应答（响应头 Idempotent-Replayed: true），首个请求执行中返回409（errorCode=IDEMPOTENCY_IN_FLIGHT），请求体不同返回422（errorCode=IDEMPOTENCY_KEY_REUSED）"
+// @Success 200 {object} APIResponse{data=ChargingActionResponse} "停止充电成功（或试运行通过）"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 409 {object} APIResponse "订单校验失败"
+// @Failure 421 {object} APIResponse "设备由其他网关实例持有"
+// @Failure 422 {object} APIResponse "同一幂等键携带了不同的请求体"
+// @Failure 503 {object} APIResponse "设备不在线"
+// @Router /api/v1/charging/stop [post]
 func (h *ChargingHandlers) HandleStopCharging(c *gin.Context) {
 	var req ChargingStopParams
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误", Data: gin.H{"error": err.Error()}})
 		return
 	}
+	dry := newChargingDryRun(c, "stop", req.DryRun)
+	defer dry.finish(c)
 
 	// 参数验证增强
 	if req.DeviceID == "" {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空", Data: nil})
 		return
 	}
+	target, ok := h.translateVirtualTarget(c, &req.DeviceID, &req.Port)
+	if !ok {
+		return
+	}
 	if req.Port == 0 {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "端口号不能为0", Data: nil})
 		return
@@ -104,12 +288,20 @@ func (h *ChargingHandlers) HandleStopCharging(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、六位十六进制(A26CF3)、八位十六进制(04A26CF3)"}})
 		return
 	}
+	if target != nil {
+		dry.pass(dryRunCheckVirtualTarget, target.VirtualID)
+	}
+	dry.pass(dryRunCheckParams, standardDeviceID)
 
 	// 设备在线状态验证
 	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
 		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "设备不在线", Data: nil})
 		return
 	}
+	dry.pass(dryRunCheckDeviceOnline, "")
 
 	// 订单匹配校验 - 修复CVE-High-003
 	// 调整为幂等：无进行中会话或已停止时返回200，并标注idempotent
@@ -126,6 +318,9 @@ func (h *ChargingHandlers) HandleStopCharging(c *gin.Context) {
 				Action:     "stop",
 				Timestamp:  time.Now().Unix(),
 			}
+			target.apply(&resp)
+			dry.pass(dryRunCheckOrderMatch, "无进行中会话，幂等返回不下发")
+			dry.apply(&resp)
 			c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "充电已停止(幂等)", Data: gin.H{"idempotent": true, "detail": resp}})
 			return
 		}
@@ -133,42 +328,169 @@ func (h *ChargingHandlers) HandleStopCharging(c *gin.Context) {
 		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: "订单校验失败", Data: gin.H{"error": err.Error()}})
 		return
 	}
+	dry.pass(dryRunCheckOrderMatch, "")
+
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, constants.CmdChargeControl) {
+		return
+	}
+	dry.pass(dryRunCheckFirmwareSupport, "")
 
-	// 发送停止充电命令
-	if err := h.deviceGateway.SendChargingCommandWithParams(standardDeviceID, req.Port, 0x00, req.OrderNo, 0, 0, 0); err != nil {
-		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "停止充电失败", Data: gin.H{"error": err.Error()}})
+	// 发送停止充电命令（携带链路追踪ID）
+	correlationID := GetCorrelationID(c)
+	if dry != nil {
+		_, preview, err := h.deviceGateway.PreviewChargingCommand(gateway.ChargeRequest{DeviceID: standardDeviceID, Port: int(req.Port), OrderNo: req.OrderNo}, 0x00)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "停止充电失败", Data: gin.H{"error": err.Error(), "correlationId": correlationID}})
+			return
+		}
+		dry.pass(dryRunCheckCommandBuild, "")
+		resp := ChargingActionResponse{
+			DeviceID:      req.DeviceID,
+			StandardID:    standardDeviceID,
+			Port:          req.Port,
+			OrderNo:       req.OrderNo,
+			Action:        "stop",
+			Timestamp:     time.Now().Unix(),
+			CorrelationID: correlationID,
+			Packet:        &preview,
+		}
+		target.apply(&resp)
+		dry.apply(&resp)
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "试运行通过，未下发", Data: resp})
+		return
+	}
+	if err := h.deviceGateway.SendChargingCommandWithCorrelation(correlationID, standardDeviceID, req.Port, 0x00, req.OrderNo, 0, 0, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "停止充电失败", Data: gin.H{"error": err.Error(), "correlationId": correlationID}})
 		return
 	}
 
 	resp := ChargingActionResponse{
-		DeviceID:   req.DeviceID,
-		StandardID: standardDeviceID,
-		Port:       req.Port,
-		OrderNo:    req.OrderNo,
-		Action:     "stop",
-		Timestamp:  time.Now().Unix(),
+		DeviceID:      req.DeviceID,
+		StandardID:    standardDeviceID,
+		Port:          req.Port,
+		OrderNo:       req.OrderNo,
+		Action:        "stop",
+		Timestamp:     time.Now().Unix(),
+		CorrelationID: correlationID,
 	}
+	target.apply(&resp)
 	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "充电已停止", Data: resp})
 }
 
+// virtualChargeTarget 虚拟子设备寻址的转换结果（nil表示按物理设备寻址）
+type virtualChargeTarget struct {
+	gateway.VirtualTarget
+}
+
+// apply 在响应中回填虚拟设备ID与虚拟端口
+func (t *virtualChargeTarget) apply(resp *ChargingActionResponse) {
+	if t == nil {
+		return
+	}
+	resp.VirtualDeviceID = t.VirtualID
+	resp.VirtualPort = t.VirtualPort
+}
+
+// translateVirtualTarget 请求寻址虚拟子设备时，将设备ID与端口改写为物理设备ID与映射后的物理端口
+// 返回false表示已写入错误响应
+func (h *ChargingHandlers) translateVirtualTarget(c *gin.Context, deviceID *string, port *byte) (*virtualChargeTarget, bool) {
+	target, isVirtual, err := h.deviceGateway.ResolveVirtualTarget(*deviceID, int(*port))
+	if !isVirtual {
+		return nil, true
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "虚拟设备端口错误: " + err.Error()})
+		return nil, false
+	}
+	*deviceID = target.ParentID
+	*port = byte(target.PhysicalPort)
+	return &virtualChargeTarget{VirtualTarget: target}, true
+}
+
 // HandleUpdateChargingPower 调整过载功率/最大时长
+// @Summary 调整充电过载功率/最大时长
+// @Description 对进行中的订单下发0x82仅更新过载功率与最大充电时长；dryRun=true 时只校验并返回将下发的帧
+// @Tags charging
+// @Accept json
+// @Produce json
+// @Param request body UpdateChargingPowerParams true "调整参数"
+// @Param dryRun query bool false "试运行"
+// @Param Idempotency-Key header string false "调用方幂等键：同一键的重试在窗口内重放首个应答（响应头 Idempotent-Replayed: true），首个请求执行中返回409（errorCode=IDEMPOTENCY_IN_FLIGHT），请求体不同返回422（errorCode=IDEMPOTENCY_KEY_REUSED）"
+// @Success 200 {object} APIResponse{data=ChargingActionResponse} "调整成功（或试运行通过）"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 404 {object} APIResponse "设备不在线"
+// @Failure 409 {object} APIResponse "订单不匹配"
+// @Failure 421 {object} APIResponse "设备由其他网关实例持有"
+// @Failure 422 {object} APIResponse "充电参数超出策略限制或固件不支持"
+// @Router /api/v1/charging/update_power [post]
 func (h *ChargingHandlers) HandleUpdateChargingPower(c *gin.Context) {
 	var req UpdateChargingPowerParams
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误", Data: gin.H{"error": err.Error()}})
 		return
 	}
+	dry := newChargingDryRun(c, "update_power", req.DryRun)
+	defer dry.finish(c)
+	target, ok := h.translateVirtualTarget(c, &req.DeviceID, &req.Port)
+	if !ok {
+		return
+	}
+	if target != nil {
+		dry.pass(dryRunCheckVirtualTarget, target.VirtualID)
+	}
 	processor := &utils.DeviceIDProcessor{}
 	standardDeviceID, err := processor.SmartConvertDeviceID(req.DeviceID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
 		return
 	}
+	dry.pass(dryRunCheckParams, standardDeviceID)
+	policyWarnings, ok := enforceChargingPolicy(c, standardDeviceID, req.TenantID, chargepolicy.Params{
+		MaxPower:          uint32(req.OverloadPowerW),
+		MaxChargeDuration: uint32(req.MaxChargeDurationSeconds),
+	})
+	if !ok {
+		return
+	}
+	dry.pass(dryRunCheckChargingPolicy, policyWarningsDetail(policyWarnings))
 	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
 		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线"})
 		return
 	}
-	if err := h.deviceGateway.UpdateChargingOverloadPower(standardDeviceID, req.Port, req.OrderNo, req.OverloadPowerW, req.MaxChargeDurationSeconds); err != nil {
+	dry.pass(dryRunCheckDeviceOnline, "")
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, constants.CmdChargeControl) {
+		return
+	}
+	dry.pass(dryRunCheckFirmwareSupport, "")
+	if dry != nil {
+		preview, err := h.deviceGateway.PreviewOverloadUpdate(standardDeviceID, req.Port, req.OrderNo, req.OverloadPowerW, req.MaxChargeDurationSeconds)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "更新失败", Data: gin.H{"error": err.Error()}})
+			return
+		}
+		dry.pass(dryRunCheckOrderMatch, "")
+		dry.pass(dryRunCheckCommandBuild, "")
+		resp := ChargingActionResponse{
+			DeviceID:                 req.DeviceID,
+			StandardID:               standardDeviceID,
+			Port:                     req.Port,
+			OrderNo:                  req.OrderNo,
+			OverloadPowerW:           req.OverloadPowerW,
+			MaxChargeDurationSeconds: req.MaxChargeDurationSeconds,
+			Action:                   "update_power",
+			PolicyWarnings:           policyWarnings,
+			Timestamp:                time.Now().Unix(),
+			Packet:                   &preview,
+		}
+		target.apply(&resp)
+		dry.apply(&resp)
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "试运行通过，未下发", Data: resp})
+		return
+	}
+	if err := h.deviceGateway.UpdateChargingOverloadPowerWithCorrelation(GetCorrelationID(c), standardDeviceID, req.Port, req.OrderNo, req.OverloadPowerW, req.MaxChargeDurationSeconds); err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "更新失败", Data: gin.H{"error": err.Error()}})
 		return
 	}
@@ -180,8 +502,10 @@ func (h *ChargingHandlers) HandleUpdateChargingPower(c *gin.Context) {
 		OverloadPowerW:           req.OverloadPowerW,
 		MaxChargeDurationSeconds: req.MaxChargeDurationSeconds,
 		Action:                   "update_power",
+		PolicyWarnings:           policyWarnings,
 		Timestamp:                time.Now().Unix(),
 	}
+	target.apply(&resp)
 	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "更新成功", Data: resp})
 }
 
@@ -195,12 +519,12 @@ func (h *ChargingHandlers) checkChargingIdempotency(deviceID string, port int, o
 			if existingOrder.Status == gateway.OrderStatusCharging {
 				return nil // 幂等，返回成功
 			}
-			if existingOrder.Status == gateway.OrderStatusPending {
-				return nil // 正在处理中，返回成功
+			if existingOrder.Status == gateway.OrderStatusPending || existingOrder.Status == gateway.OrderStatusQueued {
+				return nil // 正在处理中/设备侧排队中，返回成功
 			}
 		} else {
 			// 不同订单，检查是否有冲突
-			if existingOrder.Status == gateway.OrderStatusCharging || existingOrder.Status == gateway.OrderStatusPending {
+			if existingOrder.Status == gateway.OrderStatusCharging || existingOrder.Status == gateway.OrderStatusPending || existingOrder.Status == gateway.OrderStatusQueued {
 				return fmt.Errorf("端口已有进行中的订单: %s (状态: %s)",
 					existingOrder.OrderNo, existingOrder.Status.String())
 			}
@@ -244,3 +568,117 @@ func (h *ChargingHandlers) validateOrderForStop(deviceID string, port int, order
 
 	return nil
 }
+
+// HandleChargingSession 按订单号查询充电会话
+// @Summary 充电会话详情
+// @Description 按订单号查询充电会话的生命周期状态、状态转换历史、功率心跳统计与结算电量/时长
+// @Tags charging
+// @Produce json
+// @Param orderNo path string true "订单号"
+// @Success 200 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/charging/sessions/{orderNo} [get]
+func (h *ChargingHandlers) HandleChargingSession(c *gin.Context) {
+	orderNo := c.Param("orderNo")
+	session, ok := h.deviceGateway.GetChargingSessions().Get(orderNo)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: gateway.ErrSessionNotFound.Error() + ": " + orderNo})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "success", Data: session})
+}
+
+// HandleChargeQueue 设备侧排队中的充电请求
+// @Summary 排队中的充电请求
+// @Description 列出设备应答待充端口位图而处于排队状态的充电请求（协议未提供预计等待时长）
+// @Tags charging
+// @Produce json
+// @Success 200 {object} APIResponse
+// @Router /api/v1/charging/queue [get]
+func (h *ChargingHandlers) HandleChargeQueue(c *gin.Context) {
+	queued := h.deviceGateway.GetChargeQueue().List()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "success", Data: gin.H{
+		"total": len(queued),
+		"items": queued,
+	}})
+}
+
+// HandleChargingSessions 进行中的充电会话
+// @Summary 进行中的充电会话
+// @Description 列出进行中（待启动/充电中/排队）的充电会话，含生效的促销信息与会话生命周期状态；
+// @Description 指定 state 时改为按生命周期状态列出会话（all 为全部，含已结束会话）并返回最近的异常事件
+// @Tags charging
+// @Produce json
+// @Param deviceId query string false "设备ID（可为虚拟子设备ID），按设备过滤"
+// @Param state query string false "生命周期状态: requested/started/charging/settling/completed/failed/refunding/all"
+// @Success 200 {object} APIResponse
+// @Failure 400 {object} APIResponse
+// @Router /api/v1/charging/sessions [get]
+func (h *ChargingHandlers) HandleChargingSessions(c *gin.Context) {
+	deviceID := c.Query("deviceId")
+	virtualID := ""
+	if v, ok := virtual.Resolve(deviceID); ok {
+		deviceID, virtualID = v.ParentID, v.VirtualID
+	} else if deviceID != "" {
+		processor := &utils.DeviceIDProcessor{}
+		standardDeviceID, err := processor.SmartConvertDeviceID(deviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+			return
+		}
+		deviceID = standardDeviceID
+	}
+
+	if state := c.Query("state"); state != "" {
+		filter := gateway.SessionFilter{DeviceID: deviceID}
+		if state != "all" {
+			parsed, ok := gateway.ParseSessionState(state)
+			if !ok {
+				c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "state取值无效: " + state})
+				return
+			}
+			filter.State = parsed
+		}
+		sessions := h.deviceGateway.GetChargingSessions().List(filter)
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "success", Data: gin.H{
+			"total":     len(sessions),
+			"items":     sessions,
+			"anomalies": h.deviceGateway.GetChargingSessions().Anomalies(),
+		}})
+		return
+	}
+
+	chargingSessions := h.deviceGateway.GetChargingSessions()
+	sessions := make([]gin.H, 0)
+	for _, order := range h.deviceGateway.GetOrderManager().ListActiveOrders() {
+		if deviceID != "" && order.DeviceID != deviceID {
+			continue
+		}
+		session := gin.H{
+			"deviceId":  order.DeviceID,
+			"port":      order.Port,
+			"orderNo":   order.OrderNo,
+			"status":    order.Status.String(),
+			"mode":      order.Mode,
+			"value":     order.Value,
+			"balance":   order.Balance,
+			"startTime": order.StartTime.Unix(),
+			"promotion": order.Promotion,
+		}
+		if lifecycle, ok := chargingSessions.Get(order.OrderNo); ok {
+			session["lifecycle"] = lifecycle.State
+		}
+		if v, virtualPort, ok := virtual.LookupPort(order.DeviceID, order.Port); ok {
+			session["virtualDeviceId"] = v.VirtualID
+			session["virtualPort"] = virtualPort
+		}
+		if virtualID != "" && session["virtualDeviceId"] != virtualID {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "success", Data: gin.H{
+		"total": len(sessions),
+		"items": sessions,
+	}})
+}
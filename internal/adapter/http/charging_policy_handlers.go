@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/chargepolicy"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// chargingPolicyTenant 策略租户：资产映射的租户优先（调用方不能借 tenantId 套用更宽松的策略），未映射时取请求携带的租户
+func chargingPolicyTenant(standardDeviceID, requestTenant string) string {
+	if info, ok := asset.Lookup(standardDeviceID); ok && info.TenantID != "" {
+		return info.TenantID
+	}
+	return requestTenant
+}
+
+// enforceChargingPolicy 下发前按充电参数策略校验，超限时返回422及 VALIDATION_FAILED；通过时返回告警带内的告警
+func enforceChargingPolicy(c *gin.Context, standardDeviceID, requestTenant string, params chargepolicy.Params) ([]chargepolicy.Violation, bool) {
+	checker := chargepolicy.GetGlobalChecker()
+	if checker == nil {
+		return nil, true
+	}
+	tenantID := chargingPolicyTenant(standardDeviceID, requestTenant)
+	result := checker.Check(tenantID, params)
+	if !result.OK() {
+		logger.WithFields(logrus.Fields{
+			"deviceId":   standardDeviceID,
+			"tenantId":   tenantID,
+			"violations": result.Violations,
+		}).Warn("充电参数超出策略限制，拒绝下发")
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{Code: 422, Message: "充电参数超出策略限制", Data: gin.H{
+			"deviceId":   standardDeviceID,
+			"errorCode":  chargepolicy.ErrorCodeValidationFailed,
+			"tenantId":   tenantID,
+			"violations": result.Violations,
+			"error":      result.Violations[0].Message,
+		}})
+		return nil, false
+	}
+	if len(result.Warnings) > 0 {
+		logger.WithFields(logrus.Fields{
+			"deviceId": standardDeviceID,
+			"tenantId": tenantID,
+			"warnings": result.Warnings,
+		}).Info("充电参数接近策略上限")
+	}
+	return result.Warnings, true
+}
+
+// HandleChargingPolicy 充电参数策略（只读）
+// @Summary 充电参数策略
+// @Description 返回全局与各租户生效的充电参数上限（chargeDuration、maxChargeDuration、maxPower、balance）、允许的计费模式、告警带与校验计数，供客户端预校验表单；指定 tenantId 时 data.effective 为该租户生效限制（未配置的租户回退全局）
+// @Tags charging
+// @Produce json
+// @Param tenantId query string false "租户ID"
+// @Success 200 {object} APIResponse{data=object} "查询成功（status 为 chargepolicy.Status）"
+// @Router /api/v1/policies/charging [get]
+func (h *ChargingHandlers) HandleChargingPolicy(c *gin.Context) {
+	checker := chargepolicy.GetGlobalChecker()
+	if checker == nil {
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "未启用充电参数策略", Data: gin.H{"status": chargepolicy.Status{}}})
+		return
+	}
+	data := gin.H{"status": checker.Status()}
+	if tenantID := c.Query("tenantId"); tenantID != "" {
+		data["effective"] = checker.Effective(tenantID)
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: data})
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// CommLogHandlers 设备通信日志 HTTP 处理器
+type CommLogHandlers struct{}
+
+// NewCommLogHandlers 创建通信日志处理器
+func NewCommLogHandlers() *CommLogHandlers { return &CommLogHandlers{} }
+
+// HandleExportCommLog 导出设备通信日志
+// @Summary 导出设备通信日志
+// @Description 导出设备最近收发的原始帧（旧→新）。format=bin 为二进制抓包（magic "DNYC"、版本号，每条记录含Unix纳秒时间戳、方向字节、帧长与帧数据，格式见 pkg/commlog/capture.go），供厂商分析工具导入或 dny-parser import 查看；format=jsonl 每行一帧的JSON。虚拟子设备导出其物理设备的通信日志
+// @Tags device
+// @Produce application/octet-stream
+// @Produce application/x-ndjson
+// @Param deviceId path string true "设备ID（可为虚拟子设备ID）"
+// @Param format query string false "导出格式: bin | jsonl，默认bin"
+// @Success 200 {file} file "抓包文件"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 404 {object} APIResponse "该设备暂无通信记录"
+// @Failure 503 {object} APIResponse "通信日志未启用"
+// @Router /api/v1/device/{deviceId}/comm-log/export [get]
+func (h *CommLogHandlers) HandleExportCommLog(c *gin.Context) {
+	var q CommLogExportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	rawID := c.Param("deviceId")
+	deviceID := rawID
+	if v, ok := virtual.Resolve(rawID); ok {
+		deviceID = v.ParentID
+	} else {
+		standard, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(rawID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+			return
+		}
+		deviceID = standard
+	}
+
+	log := commlog.GetGlobalLog()
+	if log == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "通信日志未启用"})
+		return
+	}
+	records := log.Records(deviceID)
+	if len(records) == 0 {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "该设备暂无通信记录", Data: gin.H{"deviceId": rawID, "standardId": deviceID}})
+		return
+	}
+
+	filename := fmt.Sprintf("%s_%s", deviceID, time.Now().Format("20060102150405"))
+	var err error
+	switch q.Format {
+	case commlog.FormatJSONL:
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".jsonl"))
+		c.Status(http.StatusOK)
+		err = commlog.WriteJSONL(c.Writer, records)
+	default:
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".dnycap"))
+		c.Status(http.StatusOK)
+		err = commlog.WriteCapture(c.Writer, records)
+	}
+	if err != nil {
+		// 响应头已写出，只能记录日志
+		logger.WithFields(logrus.Fields{"deviceId": deviceID, "format": q.Format, "error": err.Error()}).Warn("导出通信日志失败")
+	}
+}
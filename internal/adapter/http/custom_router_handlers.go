@@ -0,0 +1,19 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/extension"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleCustomRouters 已注册的自定义处理器
+// @Summary 已注册的自定义处理器
+// @Description 扩展包经 extension.RegisterCustomRouter 注册的命令处理器：装配状态（active/override/conflict/disabled/failed）、未加载原因、处理器类型，以及交给处理器的帧数与panic次数
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=[]extension.HandlerInfo} "查询成功"
+// @Router /api/v1/admin/custom-routers [get]
+func (h *AdminHandlers) HandleCustomRouters(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: extension.GetGlobalRegistry().Handlers()})
+}
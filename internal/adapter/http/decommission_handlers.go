@@ -0,0 +1,152 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleDeviceDecommission 设备停用
+// @Summary 设备停用
+// @Description 写入停用归档（最后状态快照、端口累计电量、停用原因与操作人）并将设备加入注册黑名单，随后断开在线连接、
+// @Description 清除设备参数缓存与站点/搜索中的最近状态。此后设备注册以 DECOMMISSIONED 拒绝并告警，不计入网关汇总与合规审计
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param request body DeviceDecommissionRequest true "停用原因与操作人"
+// @Success 200 {object} APIResponse{data=decommission.Record}
+// @Failure 409 {object} APIResponse "设备已停用"
+// @Failure 421 {object} APIResponse "设备连接在其他网关实例"
+// @Router /api/v1/device/{deviceId}/decommission [post]
+func (h *DeviceHandlers) HandleDeviceDecommission(c *gin.Context) {
+	standardDeviceID, req, ok := bindDecommissionRequest(c)
+	if !ok {
+		return
+	}
+	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) && respondRemoteOwner(c, standardDeviceID) {
+		return
+	}
+
+	record, err := h.deviceGateway.DecommissionDevice(GetCorrelationID(c), standardDeviceID, req.Reason, req.Operator)
+	if err != nil {
+		if errors.Is(err, decommission.ErrAlreadyDecommissioned) {
+			existing, _ := decommission.GetGlobalRegistry().Get(standardDeviceID)
+			c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: "设备已停用", Data: gin.H{
+				"deviceId":         standardDeviceID,
+				"errorCode":        decommission.ErrorCodeDecommissioned,
+				"decommissionedAt": existing.DecommissionedAt,
+				"operator":         existing.Operator,
+			}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "设备停用失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "设备已停用", Data: record})
+}
+
+// HandleDeviceRecommission 设备重新启用
+// @Summary 设备重新启用
+// @Description 解除注册黑名单，设备下次注册按正常流程接入；停用归档保留并记录重新启用原因与操作人
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param request body DeviceDecommissionRequest true "重新启用原因与操作人"
+// @Success 200 {object} APIResponse{data=decommission.Record}
+// @Failure 404 {object} APIResponse "设备未停用"
+// @Router /api/v1/device/{deviceId}/recommission [post]
+func (h *DeviceHandlers) HandleDeviceRecommission(c *gin.Context) {
+	standardDeviceID, req, ok := bindDecommissionRequest(c)
+	if !ok {
+		return
+	}
+	record, err := h.deviceGateway.RecommissionDevice(standardDeviceID, req.Reason, req.Operator)
+	if err != nil {
+		if errors.Is(err, decommission.ErrNotDecommissioned) {
+			c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备未停用", Data: gin.H{"deviceId": standardDeviceID}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "设备重新启用失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "设备已重新启用", Data: record})
+}
+
+// HandleArchivedDevices 停用归档列表
+// @Summary 停用归档列表
+// @Description 已停用（及曾停用后重新启用）设备的归档记录，按停用时间新→旧
+// @Tags device
+// @Produce json
+// @Param status query string false "decommissioned | recommissioned，为空返回全部"
+// @Success 200 {object} APIResponse
+// @Router /api/v1/devices/archived [get]
+func (h *DeviceHandlers) HandleArchivedDevices(c *gin.Context) {
+	var query ArchivedDevicesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	registry := decommission.GetGlobalRegistry()
+	records := registry.List(query.Status)
+	decommissioned, recommissioned := registry.Counts()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"total":          len(records),
+		"decommissioned": decommissioned,
+		"recommissioned": recommissioned,
+		"devices":        records,
+	}})
+}
+
+// HandleArchivedDevice 单个设备停用归档
+// @Summary 单个设备停用归档
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse{data=decommission.Record}
+// @Failure 404 {object} APIResponse "无停用归档"
+// @Router /api/v1/devices/archived/{deviceId} [get]
+func (h *DeviceHandlers) HandleArchivedDevice(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	record, ok := decommission.GetGlobalRegistry().Get(standardDeviceID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备无停用归档", Data: gin.H{"deviceId": standardDeviceID}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: record})
+}
+
+// bindDecommissionRequest 解析设备ID与停用/重新启用请求体，失败时已写出400响应
+func bindDecommissionRequest(c *gin.Context) (string, DeviceDecommissionRequest, bool) {
+	var req DeviceDecommissionRequest
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return "", req, false
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
+		return "", req, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: reason 与 operator 必填"})
+		return "", req, false
+	}
+	return standardDeviceID, req, true
+}
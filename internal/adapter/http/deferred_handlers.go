@@ -0,0 +1,84 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// deferCommand 设备离线时暂存命令并返回202，设备下次注册后下发
+func (h *DeviceHandlers) deferCommand(c *gin.Context, deviceID, kind string, params interface{}, delivery DeferredDeliveryParams) {
+	originator := delivery.Originator
+	if originator == "" {
+		originator = c.ClientIP()
+	}
+	cmd, err := h.deviceGateway.GetDeferredQueue().Enqueue(gateway.DeferredRequest{
+		DeviceID:      deviceID,
+		Kind:          kind,
+		Params:        params,
+		Originator:    originator,
+		CorrelationID: GetCorrelationID(c),
+		CallbackURL:   delivery.CallbackURL,
+		TTL:           time.Duration(delivery.TTLSeconds) * time.Second,
+	})
+	if errors.Is(err, gateway.ErrDeferredQueueFull) {
+		c.JSON(http.StatusTooManyRequests, APIResponse{Code: 429, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, APIResponse{Code: 0, Message: "设备离线，命令已暂存，设备上线后下发", Data: cmd})
+}
+
+// HandleDeviceDeferred 设备延迟命令
+// @Summary 设备延迟命令
+// @Description 查询设备待下发（入队顺序）与已结束（新→旧）的延迟命令，已结束状态包括 delivered/failed/expired/cancelled
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse{data=object}
+// @Router /api/v1/device/{deviceId}/deferred [get]
+func (h *DeviceHandlers) HandleDeviceDeferred(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	pending, history := h.deviceGateway.GetDeferredQueue().List(standardDeviceID)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId": standardDeviceID,
+		"pending":  pending,
+		"history":  history,
+	}})
+}
+
+// HandleCancelDeferred 取消延迟命令
+// @Summary 取消延迟命令
+// @Description 取消尚未下发的延迟命令；正在下发的命令返回409
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param commandId path string true "延迟命令ID"
+// @Success 200 {object} APIResponse{data=gateway.DeferredCommand}
+// @Failure 404 {object} APIResponse
+// @Failure 409 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/deferred/{commandId} [delete]
+func (h *DeviceHandlers) HandleCancelDeferred(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	cmd, err := h.deviceGateway.GetDeferredQueue().Cancel(standardDeviceID, c.Param("commandId"))
+	switch {
+	case errors.Is(err, gateway.ErrDeferredNotFound):
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+	case errors.Is(err, gateway.ErrDeferredInProgress):
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error(), Data: cmd})
+	default:
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "已取消", Data: cmd})
+	}
+}
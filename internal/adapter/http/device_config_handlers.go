@@ -0,0 +1,304 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxConfigReadTimeoutSeconds 设备配置读取最长等待时间
+const maxConfigReadTimeoutSeconds = 60
+
+// HandleDeviceConfig 读取设备配置
+// @Summary 读取设备配置
+// @Description 下发0x90~0x93参数查询并组装为结构化配置文档（缺失分段自动补发查询），完整结果缓存供核对使用；cached=true 时直接返回缓存
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param cached query bool false "返回最近一次读取的缓存"
+// @Param timeout query int false "读取等待秒数(1-60)，默认为 补发间隔×最大轮数"
+// @Success 200 {object} APIResponse{data=gateway.DeviceConfigDocument}
+// @Failure 504 {object} APIResponse{data=gateway.DeviceConfigDocument}
+// @Router /api/v1/device/{deviceId}/config [get]
+func (h *DeviceHandlers) HandleDeviceConfig(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("cached") == "true" {
+		doc, exists := h.deviceGateway.GetConfigReader().Cached(standardDeviceID)
+		if !exists {
+			c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备配置尚未读取"})
+			return
+		}
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: doc})
+		return
+	}
+
+	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: gin.H{"deviceId": standardDeviceID, "isOnline": false}})
+		return
+	}
+	timeoutSeconds, _ := strconv.Atoi(c.Query("timeout"))
+	if timeoutSeconds < 0 || timeoutSeconds > maxConfigReadTimeoutSeconds {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "timeout 取值范围为 1-60 秒"})
+		return
+	}
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, gateway.ConfigQueryCommands()...) {
+		return
+	}
+
+	doc, err := h.deviceGateway.ReadDeviceConfig(GetCorrelationID(c), standardDeviceID, time.Duration(timeoutSeconds)*time.Second)
+	if errors.Is(err, gateway.ErrConfigReadIncomplete) {
+		c.JSON(http.StatusGatewayTimeout, APIResponse{Code: 504, Message: err.Error(), Data: doc})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "读取设备配置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: doc})
+}
+
+// HandleVerifyDeviceConfig 核对设备配置
+// @Summary 核对设备配置
+// @Description 将设备配置（缓存或重新读取）与黄金模板逐字段核对，返回字段级差异；设备离线且 deliverWhen=online 时暂存核对请求并返回202，设备下次注册后重新读取配置核对
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param request body DeviceConfigVerifyParams true "核对参数"
+// @Success 200 {object} APIResponse{data=gateway.ConfigVerifyResult}
+// @Success 202 {object} APIResponse{data=gateway.DeferredCommand}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/config/verify [post]
+func (h *DeviceHandlers) HandleVerifyDeviceConfig(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	var params DeviceConfigVerifyParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if params.DeliverWhen == gateway.DeliverWhenOnline && !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		if _, ok := h.deviceGateway.GetConfigTemplates().Get(params.Template, params.Version); !ok {
+			c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: gateway.ErrConfigTemplateNotFound.Error()})
+			return
+		}
+		h.deferCommand(c, standardDeviceID, gateway.DeferredKindConfigVerify, gateway.DeferredConfigVerifyParams{Template: params.Template, Version: params.Version}, params.DeferredDeliveryParams)
+		return
+	}
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, gateway.ConfigQueryCommands()...) {
+		return
+	}
+
+	result, err := h.deviceGateway.VerifyDeviceConfig(GetCorrelationID(c), standardDeviceID, params.Template, params.Version, params.Refresh)
+	if errors.Is(err, gateway.ErrConfigTemplateNotFound) {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "读取设备配置失败: " + err.Error()})
+		return
+	}
+	message := "设备配置与模板一致"
+	if !result.Match {
+		message = "设备配置与模板不一致"
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: message, Data: result})
+}
+
+// HandleDeviceParameters 设备运行参数
+// @Summary 设备运行参数
+// @Description 返回设备最近上报（主动上报或查询应答）的 0x90/0x91 运行参数；partial=true 表示固件上报的数据被截断，
+// @Description 仅解析了现有字段；lastParametersAt/ageSeconds 用于判断配置是否过期
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse{data=DeviceParametersResponse}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/parameters [get]
+func (h *DeviceHandlers) HandleDeviceParameters(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	params, exists := h.deviceGateway.GetDeviceParameters(standardDeviceID)
+	if !exists {
+		if !h.deviceGateway.IsDeviceOnline(standardDeviceID) && respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备尚未上报运行参数", Data: gin.H{"deviceId": standardDeviceID}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: DeviceParametersResponse{
+		DeviceID:   standardDeviceID,
+		Parameters: params,
+		AgeSeconds: int64(time.Since(params.LastParametersAt).Seconds()),
+	}})
+}
+
+// bindStandardDeviceID 绑定路径中的设备ID并转换为标准格式，失败时已写入400响应
+func bindStandardDeviceID(c *gin.Context) (string, bool) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return "", false
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return "", false
+	}
+	return standardDeviceID, true
+}
+
+// ConfigTemplateHandlers 黄金配置模板 HTTP 处理器
+type ConfigTemplateHandlers struct {
+	store *gateway.ConfigTemplateStore
+}
+
+func NewConfigTemplateHandlers() *ConfigTemplateHandlers {
+	return &ConfigTemplateHandlers{store: gateway.GetGlobalDeviceGateway().GetConfigTemplates()}
+}
+
+// HandleListConfigTemplates 配置模板列表
+// @Summary 配置模板列表
+// @Description 返回各模板的最新版本
+// @Tags config-template
+// @Produce json
+// @Success 200 {object} APIResponse
+// @Router /api/v1/config-templates [get]
+func (h *ConfigTemplateHandlers) HandleListConfigTemplates(c *gin.Context) {
+	items := h.store.List()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"total": len(items), "items": items}})
+}
+
+// HandleCreateConfigTemplate 创建配置模板
+// @Summary 创建配置模板
+// @Description 创建版本1的黄金配置模板；分段与字段名称需为设备配置文档中的已知字段
+// @Tags config-template
+// @Accept json
+// @Produce json
+// @Param request body ConfigTemplateParams true "模板内容"
+// @Success 200 {object} APIResponse{data=gateway.ConfigTemplate}
+// @Failure 409 {object} APIResponse
+// @Router /api/v1/config-templates [post]
+func (h *ConfigTemplateHandlers) HandleCreateConfigTemplate(c *gin.Context) {
+	var params ConfigTemplateParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	tpl, err := h.store.Create(params.Name, params.Description, params.Sections)
+	if err != nil {
+		h.respondStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "模板已创建", Data: tpl})
+}
+
+// HandleGetConfigTemplate 获取配置模板
+// @Summary 获取配置模板
+// @Tags config-template
+// @Produce json
+// @Param name path string true "模板名称"
+// @Param version query int false "模板版本，缺省为最新版本"
+// @Success 200 {object} APIResponse{data=gateway.ConfigTemplate}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/config-templates/{name} [get]
+func (h *ConfigTemplateHandlers) HandleGetConfigTemplate(c *gin.Context) {
+	version, _ := strconv.Atoi(c.Query("version"))
+	tpl, ok := h.store.Get(c.Param("name"), version)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "配置模板不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: tpl})
+}
+
+// HandleConfigTemplateVersions 配置模板版本历史
+// @Summary 配置模板版本历史
+// @Description 返回模板全部版本（新→旧）
+// @Tags config-template
+// @Produce json
+// @Param name path string true "模板名称"
+// @Success 200 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/config-templates/{name}/versions [get]
+func (h *ConfigTemplateHandlers) HandleConfigTemplateVersions(c *gin.Context) {
+	versions := h.store.Versions(c.Param("name"))
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "配置模板不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"total": len(versions), "items": versions}})
+}
+
+// HandleUpdateConfigTemplate 更新配置模板
+// @Summary 更新配置模板
+// @Description 生成新版本，历史版本保留可按 version 核对
+// @Tags config-template
+// @Accept json
+// @Produce json
+// @Param name path string true "模板名称"
+// @Param request body ConfigTemplateParams true "模板内容"
+// @Success 200 {object} APIResponse{data=gateway.ConfigTemplate}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/config-templates/{name} [put]
+func (h *ConfigTemplateHandlers) HandleUpdateConfigTemplate(c *gin.Context) {
+	var params ConfigTemplateParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	tpl, err := h.store.Update(c.Param("name"), params.Description, params.Sections)
+	if err != nil {
+		h.respondStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "模板已更新", Data: tpl})
+}
+
+// HandleDeleteConfigTemplate 删除配置模板
+// @Summary 删除配置模板
+// @Description 删除模板及其全部版本
+// @Tags config-template
+// @Produce json
+// @Param name path string true "模板名称"
+// @Success 200 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/config-templates/{name} [delete]
+func (h *ConfigTemplateHandlers) HandleDeleteConfigTemplate(c *gin.Context) {
+	if err := h.store.Delete(c.Param("name")); err != nil {
+		h.respondStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "模板已删除"})
+}
+
+func (h *ConfigTemplateHandlers) respondStoreError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gateway.ErrConfigTemplateNotFound):
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+	case errors.Is(err, gateway.ErrConfigTemplateExists):
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+	}
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceGroupHandlers 设备组查询处理器
+type DeviceGroupHandlers struct {
+	tcpManager *core.TCPManager
+}
+
+// NewDeviceGroupHandlers 基于全局TCP管理器创建设备组查询处理器
+func NewDeviceGroupHandlers() *DeviceGroupHandlers {
+	return NewDeviceGroupHandlersWithManager(core.GetGlobalTCPManager())
+}
+
+// NewDeviceGroupHandlersWithManager 基于指定TCP管理器创建设备组查询处理器
+func NewDeviceGroupHandlersWithManager(tcpManager *core.TCPManager) *DeviceGroupHandlers {
+	return &DeviceGroupHandlers{tcpManager: tcpManager}
+}
+
+// HandleDeviceGroup 按ICCID查询设备组
+// @Summary 按ICCID查询设备组
+// @Description 同一SIM卡（ICCID）共享连接的设备组：连接ID与来源地址、主设备、创建与最近活动时间，以及各成员设备的状态与心跳时间（按设备ID排序）
+// @Tags device
+// @Produce json
+// @Param iccid path string true "设备组ICCID"
+// @Success 200 {object} APIResponse{data=DeviceGroupView} "查询成功"
+// @Failure 400 {object} APIResponse "ICCID不能为空"
+// @Failure 404 {object} APIResponse "设备组不存在"
+// @Router /api/v1/group/{iccid} [get]
+func (h *DeviceGroupHandlers) HandleDeviceGroup(c *gin.Context) {
+	var uri DeviceGroupURI
+	if err := c.ShouldBindUri(&uri); err != nil || strings.TrimSpace(uri.ICCID) == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "ICCID不能为空"})
+		return
+	}
+	value, ok := h.tcpManager.GetDeviceGroups().Load(strings.TrimSpace(uri.ICCID))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备组不存在", Data: gin.H{"iccid": uri.ICCID}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: deviceGroupView(h.tcpManager, value.(*core.DeviceGroup))})
+}
+
+// HandleDeviceGroups 设备组列表
+// @Summary 设备组列表
+// @Description 全部设备组及其成员设备数，按设备数从多到少排序（相同时按ICCID），便于发现承载设备数异常的SIM卡；minDevices 过滤设备数不足的组
+// @Tags device
+// @Produce json
+// @Param minDevices query int false "最少设备数" default(0)
+// @Success 200 {object} APIResponse{data=DeviceGroupList} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Router /api/v1/groups [get]
+func (h *DeviceGroupHandlers) HandleDeviceGroups(c *gin.Context) {
+	var q DeviceGroupListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	groups := make([]DeviceGroupSummary, 0)
+	h.tcpManager.GetDeviceGroups().Range(func(_, value interface{}) bool {
+		view := deviceGroupView(h.tcpManager, value.(*core.DeviceGroup))
+		if view.DeviceCount >= q.MinDevices {
+			groups = append(groups, DeviceGroupSummary{
+				ICCID:         view.ICCID,
+				ConnID:        view.ConnID,
+				RemoteAddr:    view.RemoteAddr,
+				PrimaryDevice: view.PrimaryDevice,
+				DeviceCount:   view.DeviceCount,
+				LastActivity:  view.LastActivity,
+			})
+		}
+		return true
+	})
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].DeviceCount != groups[j].DeviceCount {
+			return groups[i].DeviceCount > groups[j].DeviceCount
+		}
+		return groups[i].ICCID < groups[j].ICCID
+	})
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: DeviceGroupList{Groups: groups, Total: len(groups)}})
+}
+
+// deviceGroupView 在组读锁内复制设备组快照，成员设备按设备ID排序
+func deviceGroupView(tcpManager *core.TCPManager, group *core.DeviceGroup) DeviceGroupView {
+	group.RLock()
+	view := DeviceGroupView{
+		ICCID:         group.ICCID,
+		ConnID:        group.ConnID,
+		PrimaryDevice: group.PrimaryDevice,
+		CreatedAt:     group.CreatedAt,
+		LastActivity:  group.LastActivity,
+		Devices:       make([]DeviceGroupMember, 0, len(group.Devices)),
+	}
+	devices := make([]*core.Device, 0, len(group.Devices))
+	for _, device := range group.Devices {
+		devices = append(devices, device)
+	}
+	group.RUnlock()
+
+	for _, device := range devices {
+		device.RLock()
+		view.Devices = append(view.Devices, DeviceGroupMember{
+			DeviceID:       device.DeviceID,
+			PhysicalID:     utils.FormatPhysicalID(device.PhysicalID),
+			Status:         string(device.Status),
+			State:          string(device.State),
+			RegisteredAt:   device.RegisteredAt,
+			LastActivity:   device.LastActivity,
+			LastHeartbeat:  device.LastHeartbeat,
+			HeartbeatCount: device.HeartbeatCount,
+		})
+		device.RUnlock()
+	}
+	sort.Slice(view.Devices, func(i, j int) bool { return view.Devices[i].DeviceID < view.Devices[j].DeviceID })
+	view.DeviceCount = len(view.Devices)
+	if session, ok := tcpManager.GetSessionByConnID(view.ConnID); ok {
+		view.RemoteAddr = session.RemoteAddr
+	}
+	return view
+}
@@ -1,13 +1,23 @@
 package http
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/devicesession"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
 	"github.com/gin-gonic/gin"
 )
 
+// maxRebootWaitSeconds 重启长轮询最长等待时间
+const maxRebootWaitSeconds = 60
+
 // DeviceHandlers 设备相关 HTTP 处理器
 type DeviceHandlers struct {
 	deviceGateway *gateway.DeviceGateway
@@ -18,12 +28,29 @@ func NewDeviceHandlers() *DeviceHandlers {
 }
 
 // HandleDeviceStatus 获取设备状态
+// @Summary 设备状态详情
+// @Description 在线设备的注册信息、连接状态与端口概况；虚拟子设备返回其映射视图；设备由集群其他实例持有时返回421及持有者。
+// @Description 只读副本模式下从主实例发布的快照应答（仅物理设备ID），附 dataSource=replica 与快照时间 stateAt
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID（十进制/6位或8位十六进制，可为虚拟子设备ID）"
+// @Param virtual query string false "expand：附带已拆分设备的虚拟子设备"
+// @Param verbose query bool false "附带连接级诊断信息（自适应读超时、协议方言绑定）"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "设备ID格式错误"
+// @Failure 404 {object} APIResponse "设备不在线"
+// @Failure 421 {object} APIResponse "设备由其他网关实例持有"
+// @Param noCache query bool false "true：绕过设备详情缓存重新组装"
+// @Router /api/v1/device/{deviceId}/status [get]
 func (h *DeviceHandlers) HandleDeviceStatus(c *gin.Context) {
 	var uri DeviceStatusURI
 	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
 		return
 	}
+	if h.respondVirtualDetail(c, uri.DeviceID) {
+		return
+	}
 	processor := &utils.DeviceIDProcessor{}
 	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
 	if err != nil {
@@ -31,53 +58,219 @@ func (h *DeviceHandlers) HandleDeviceStatus(c *gin.Context) {
 		return
 	}
 	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
 		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: gin.H{"deviceId": uri.DeviceID, "standardId": standardDeviceID, "isOnline": false}})
 		return
 	}
-	detail, err := h.deviceGateway.GetDeviceDetail(standardDeviceID)
+	detail, err := h.deviceDetail(c, standardDeviceID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "获取设备信息失败"})
 		return
 	}
+	detail["owner"] = selfOwner()
+	if c.Query("virtual") == "expand" {
+		if virtuals := h.deviceGateway.ExpandVirtualDetails(detail, standardDeviceID); virtuals != nil {
+			detail["virtuals"] = virtuals
+		}
+	}
+	// 详细模式：附带连接级诊断信息
+	if c.Query("verbose") == "true" {
+		if deadline, ok := h.deviceGateway.GetDeviceReadDeadline(standardDeviceID); ok {
+			detail["readDeadline"] = deadline
+		}
+		if binding, ok := h.deviceGateway.GetDeviceDialect(standardDeviceID); ok {
+			detail["dialectBinding"] = binding
+		}
+	}
 	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: detail})
 }
 
+// HandleDevicePorts 设备端口状态
+// @Summary 设备端口状态
+// @Description 各端口最近上报的状态与功率，附带进行中的订单；虚拟子设备只返回其映射端口（按虚拟端口编号）。
+// @Description 端口由功率心跳(0x06)与充电控制应答(0x82)维护：state 为 idle/charging/fault/occupied_no_charge，附电压、进行中订单电量与 lastUpdate；
+// @Description 超过 stations.portStaleSeconds 未上报的端口 stale=true，不再展示最后功率。
+// @Description 只读副本模式下返回主实例快照中的端口状态，附 dataSource=replica 与快照时间 stateAt
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID（可为虚拟子设备ID）"
+// @Success 200 {object} APIResponse "查询成功"
+// @Failure 400 {object} APIResponse "设备ID格式错误"
+// @Failure 404 {object} APIResponse "设备不在线"
+// @Router /api/v1/device/{deviceId}/ports [get]
+func (h *DeviceHandlers) HandleDevicePorts(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	standardDeviceID := ""
+	v, isVirtual := virtual.Resolve(uri.DeviceID)
+	if isVirtual {
+		standardDeviceID = v.ParentID
+	} else {
+		processor := &utils.DeviceIDProcessor{}
+		id, err := processor.SmartConvertDeviceID(uri.DeviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
+			return
+		}
+		standardDeviceID = id
+	}
+	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: gin.H{"deviceId": uri.DeviceID, "standardId": standardDeviceID, "isOnline": false}})
+		return
+	}
+
+	ports := h.deviceGateway.GetDevicePortStatus(standardDeviceID)
+	data := gin.H{"deviceId": uri.DeviceID, "standardId": standardDeviceID, "isOnline": true}
+	if isVirtual {
+		data["deviceId"], data["parentDeviceId"] = v.VirtualID, v.ParentID
+		mapped := make([]gateway.DevicePortStatus, 0, len(v.Ports))
+		for _, p := range ports {
+			if vp, ok := v.VirtualPort(p.Port); ok {
+				p.Port = vp
+				mapped = append(mapped, p)
+			}
+		}
+		ports = mapped
+	}
+	data["ports"] = ports
+	data["total"] = len(ports)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: data})
+}
+
 // HandleDeviceList 获取设备列表
+// @Summary 在线设备列表
+// @Description 本实例持有连接的在线设备详情，可按站点与设备类型过滤；virtual=expand 时已拆分设备以其虚拟子设备代替。
+// @Description 只读副本模式下列出主实例快照中的全部在线设备（不展开虚拟子设备），附 dataSource=replica、stateAt、stalenessMs 与 stale。
+// @Description 启用设备会话持久化时，重启前已注册、尚未重新接入的设备以 isOnline=false、recovering=true 附在列表末尾。
+// @Description 在线设备附 portSummary（portsTotal/portsCharging/portsFault/portsStale），超过 stations.portStaleSeconds 未上报的端口只计入 portsStale
+// @Tags device
+// @Produce json
+// @Param virtual query string false "expand：已拆分设备展开为虚拟子设备"
+// @Param stationId query string false "按站点过滤"
+// @Param deviceType query int false "按设备类型过滤，0表示不限"
+// @Param noCache query bool false "true：绕过设备详情缓存重新组装"
+// @Success 200 {object} APIResponse{data=object} "查询成功（devices/total/online/recovering）"
+// @Router /api/v1/devices [get]
 func (h *DeviceHandlers) HandleDeviceList(c *gin.Context) {
 	var q DeviceListQuery
 	_ = c.ShouldBindQuery(&q)
 	onlineDevices := h.deviceGateway.GetAllOnlineDevices()
+	expand := q.Virtual == "expand"
+	owner := selfOwner()
 	var deviceList []map[string]interface{}
 	for _, deviceID := range onlineDevices {
-		if detail, err := h.deviceGateway.GetDeviceDetail(deviceID); err == nil {
+		if detail, err := h.deviceDetail(c, deviceID); err == nil {
+			if !q.matches(detail) {
+				continue
+			}
+			detail["owner"] = owner
+			// 端口汇总不经详情缓存，保证与 /device/{deviceId}/ports 一致
+			detail["portSummary"] = h.deviceGateway.GetDevicePortSummary(deviceID)
+			// 展开模式：已拆分的物理设备以其虚拟子设备代替
+			if expand {
+				if virtuals := h.deviceGateway.ExpandVirtualDetails(detail, deviceID); virtuals != nil {
+					deviceList = append(deviceList, virtuals...)
+					continue
+				}
+			}
 			deviceList = append(deviceList, detail)
 		}
 	}
-	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"devices": deviceList, "total": len(onlineDevices), "online": len(onlineDevices)}})
+	recovering := 0
+	for _, detail := range recoveringDeviceDetails() {
+		if q.matches(detail) {
+			deviceList = append(deviceList, detail)
+			recovering++
+		}
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"devices": deviceList, "total": len(onlineDevices) + recovering, "online": len(onlineDevices), "recovering": recovering}})
+}
+
+// recoveringDeviceDetails 重启前已注册、尚未重新接入的设备（设备会话持久化未启用时为空）
+func recoveringDeviceDetails() []map[string]interface{} {
+	registry := devicesession.GetGlobalRegistry()
+	if registry == nil {
+		return nil
+	}
+	records := registry.Recovering()
+	owner := selfOwner()
+	details := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		details = append(details, map[string]interface{}{
+			"deviceId":        rec.DeviceID,
+			"physicalId":      rec.PhysicalID,
+			"deviceNumber":    utils.FormatPhysicalIDForDisplay(rec.PhysicalID),
+			"iccid":           rec.ICCID,
+			"deviceType":      rec.DeviceType,
+			"isOnline":        false,
+			"recovering":      true,
+			"lastHeartbeat":   rec.LastHeartbeat.Format("2006-01-02 15:04:05"),
+			"lastHeartbeatTs": rec.LastHeartbeat.Unix(),
+			"owner":           owner,
+		})
+	}
+	return details
 }
 
 // HandleQueryDeviceStatus 查询设备状态（与 HandleDeviceStatus 类似）
+// @Summary 查询设备状态
+// @Description 与设备状态详情相同，但不要求本实例判定在线（兼容旧调用方）
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID（可为虚拟子设备ID）"
+// @Param noCache query bool false "true：绕过设备详情缓存重新组装"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "设备ID格式错误"
+// @Failure 404 {object} APIResponse "设备不存在或离线"
+// @Failure 421 {object} APIResponse "设备由其他网关实例持有"
+// @Router /api/v1/device/{deviceId}/query [get]
 func (h *DeviceHandlers) HandleQueryDeviceStatus(c *gin.Context) {
 	var uri DeviceStatusURI
 	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
 		return
 	}
+	if h.respondVirtualDetail(c, uri.DeviceID) {
+		return
+	}
 	processor := &utils.DeviceIDProcessor{}
 	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
 		return
 	}
-	detail, err := h.deviceGateway.GetDeviceDetail(standardDeviceID)
+	detail, err := h.deviceDetail(c, standardDeviceID)
 	if err != nil {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
 		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不存在或离线"})
 		return
 	}
+	detail["owner"] = selfOwner()
 	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "获取设备状态成功", Data: detail})
 }
 
 // HandleDeviceLocate 设备定位
+// @Summary 设备定位
+// @Description 下发0x96声光定位命令，设备在指定秒数内鸣响闪灯
+// @Tags command
+// @Accept json
+// @Produce json
+// @Param request body DeviceLocateRequest true "定位参数"
+// @Success 200 {object} APIResponse "命令已下发"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 422 {object} APIResponse "设备固件不支持该命令"
+// @Failure 500 {object} APIResponse "发送失败"
+// @Router /api/v1/device/locate [post]
 func (h *DeviceHandlers) HandleDeviceLocate(c *gin.Context) {
 	var req DeviceLocateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -90,7 +283,10 @@ func (h *DeviceHandlers) HandleDeviceLocate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
 		return
 	}
-	if err := h.deviceGateway.SendLocationCommand(standardDeviceID, int(req.LocateTime)); err != nil {
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, constants.CmdDeviceLocate) {
+		return
+	}
+	if err := h.deviceGateway.SendLocationCommandWithCorrelation(GetCorrelationID(c), standardDeviceID, int(req.LocateTime)); err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "发送定位命令失败: " + err.Error()})
 		return
 	}
@@ -104,3 +300,456 @@ func (h *DeviceHandlers) HandleDeviceLocate(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "定位命令发送成功", Data: gin.H{"deviceId": resp.DeviceID, "standardId": resp.StandardID, "action": resp.Action, "locateTime": req.LocateTime}})
 }
+
+// HandleDeviceReboot 设备远程重启
+// @Summary 设备远程重启
+// @Description 下发0x31重启命令。存在进行中的充电会话时返回409，force=true时先停止会话再重启；wait>0时长轮询等待设备重新注册（最长60秒）；
+// @Description 设备离线且 deliverWhen=online 时暂存重启命令并返回202，设备下次注册后下发
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param force query bool false "强制重启"
+// @Param wait query int false "等待设备重新注册的秒数(0-60)"
+// @Param deliverWhen query string false "online：设备离线时暂存，上线后下发"
+// @Success 200 {object} APIResponse{data=DeviceRebootResponse}
+// @Success 202 {object} APIResponse{data=gateway.DeferredCommand}
+// @Failure 409 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/reboot [post]
+func (h *DeviceHandlers) HandleDeviceReboot(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	var params DeviceRebootParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+			return
+		}
+	}
+	if params.Wait < 0 || params.Wait > maxRebootWaitSeconds {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: fmt.Sprintf("wait 取值范围为0-%d秒", maxRebootWaitSeconds)})
+		return
+	}
+
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
+		return
+	}
+	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		if params.DeliverWhen == gateway.DeliverWhenOnline {
+			h.deferCommand(c, standardDeviceID, gateway.DeferredKindReboot, gateway.DeferredRebootParams{Force: params.Force}, params.DeferredDeliveryParams)
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "设备不在线"})
+		return
+	}
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, constants.CmdRebootMain) {
+		return
+	}
+
+	record, err := h.deviceGateway.RebootDevice(GetCorrelationID(c), standardDeviceID, params.Force)
+	if err != nil {
+		var activeErr *gateway.ActiveSessionsError
+		if errors.As(err, &activeErr) {
+			sessions := make([]gin.H, 0, len(activeErr.Sessions))
+			for _, s := range activeErr.Sessions {
+				sessions = append(sessions, gin.H{
+					"port":      s.Port,
+					"orderNo":   s.OrderNo,
+					"status":    s.Status.String(),
+					"startTime": s.StartTime.Unix(),
+				})
+			}
+			c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: "设备存在进行中的充电会话", Data: gin.H{
+				"deviceId": standardDeviceID,
+				"sessions": sessions,
+				"hint":     "确认中断会话后使用 force=true 重启",
+				"error":    err.Error(),
+			}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "设备重启失败: " + err.Error()})
+		return
+	}
+
+	if params.Wait > 0 {
+		if latest, ok := h.deviceGateway.GetRebootTracker().Wait(standardDeviceID, record.ID, time.Duration(params.Wait)*time.Second); ok {
+			record = latest
+		}
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "重启命令发送成功", Data: DeviceRebootResponse{
+		RebootRecord: record,
+		CameBack:     record.Status == gateway.RebootStatusCompleted,
+	}})
+}
+
+// HandleDeviceReboots 设备远程重启记录
+// @Summary 设备远程重启记录
+// @Description 返回设备最近的远程重启记录（新→旧）
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/reboots [get]
+func (h *DeviceHandlers) HandleDeviceReboots(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	records := h.deviceGateway.GetRebootTracker().History(standardDeviceID)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId": standardDeviceID,
+		"total":    len(records),
+		"items":    records,
+	}})
+}
+
+// HandleDeviceSearch 设备模糊搜索
+// @Summary 设备模糊搜索
+// @Description 按设备ID、物理ID、ICCID、资产编码与远端IP做不区分大小写的子串/后缀匹配，覆盖在线设备与近期离线设备；结果按匹配程度排序并标出匹配字段
+// @Tags device
+// @Produce json
+// @Param q query string true "查询串（至少4个字符）"
+// @Param limit query int false "返回条数" default(20)
+// @Success 200 {object} APIResponse{data=[]gateway.DeviceSearchMatch} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Router /api/v1/search [get]
+func (h *DeviceHandlers) HandleDeviceSearch(c *gin.Context) {
+	var q DeviceSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	matches, err := h.deviceGateway.SearchDevices(q.Q, q.Limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+	if matches == nil {
+		matches = []gateway.DeviceSearchMatch{}
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: matches})
+}
+
+// HandleDeviceTimeline 设备时间线
+// @Summary 设备时间线
+// @Description 按时间顺序合并连接/注册、下发命令及结果、远程重启、充电状态转换、ICCID冲突与通知事件，每条标注来源子系统、摘要与下钻用的记录ID；各来源为有界存储，仅包含仍保留的记录
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param from query int false "起始时间（Unix秒）"
+// @Param to query int false "结束时间（Unix秒）"
+// @Param types query string false "条目类型，逗号分隔"
+// @Param cursor query string false "分页游标"
+// @Param limit query int false "每页条数" default(100)
+// @Success 200 {object} APIResponse{data=gateway.TimelinePage} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Router /api/v1/device/{deviceId}/timeline [get]
+func (h *DeviceHandlers) HandleDeviceTimeline(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	var q DeviceTimelineQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+
+	query := gateway.TimelineQuery{Cursor: q.Cursor, Limit: q.Limit}
+	if q.From > 0 {
+		query.From = time.Unix(q.From, 0)
+	}
+	if q.To > 0 {
+		query.To = time.Unix(q.To, 0)
+	}
+	for _, t := range strings.Split(q.Types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			if query.Types == nil {
+				query.Types = map[string]bool{}
+			}
+			query.Types[t] = true
+		}
+	}
+
+	page, err := h.deviceGateway.GetDeviceTimeline(standardDeviceID, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: page})
+}
+
+// deviceDetail 设备详情：默认经短TTL缓存，noCache=true 时直接组装
+func (h *DeviceHandlers) deviceDetail(c *gin.Context, deviceID string) (map[string]interface{}, error) {
+	if c.Query("noCache") == "true" {
+		h.deviceGateway.GetDetailCache().NoteBypass()
+		return h.deviceGateway.GetDeviceDetailUncached(deviceID)
+	}
+	return h.deviceGateway.GetDeviceDetail(deviceID)
+}
+
+// respondVirtualDetail 设备ID为虚拟子设备时直接返回虚拟设备详情
+func (h *DeviceHandlers) respondVirtualDetail(c *gin.Context, deviceID string) bool {
+	v, ok := virtual.Resolve(deviceID)
+	if !ok {
+		return false
+	}
+	if !h.deviceGateway.IsDeviceOnline(v.ParentID) {
+		if respondRemoteOwner(c, v.ParentID) {
+			return true
+		}
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: gin.H{"deviceId": v.VirtualID, "parentDeviceId": v.ParentID, "isOnline": false}})
+		return true
+	}
+	detail, err := h.deviceGateway.GetVirtualDeviceDetail(v.VirtualID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "获取设备信息失败"})
+		return true
+	}
+	detail["owner"] = selfOwner()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: detail})
+	return true
+}
+
+// HandleVirtualSplit 拆分虚拟子设备
+// @Summary 拆分虚拟子设备
+// @Description 将多端口机柜按端口拆分为可独立寻址的虚拟子设备（派生ID如 04A26CF3-P01），映射持久化并在设备重连后恢复
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "物理设备ID"
+// @Param request body VirtualSplitParams true "拆分参数"
+// @Success 200 {object} APIResponse
+// @Failure 409 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/virtual-split [post]
+func (h *DeviceHandlers) HandleVirtualSplit(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	var req VirtualSplitParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
+		return
+	}
+
+	plan := virtual.SplitPlan{PortsPerVirtual: req.PortsPerVirtual, TotalPorts: req.TotalPorts}
+	for _, m := range req.Mapping {
+		plan.Mapping = append(plan.Mapping, virtual.PortMapping{Suffix: m.Suffix, Ports: m.Ports})
+	}
+	virtuals, err := h.deviceGateway.SplitVirtualDevices(standardDeviceID, plan)
+	if err != nil {
+		var splitErr *virtual.AlreadySplitError
+		if errors.As(err, &splitErr) {
+			c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error(), Data: gin.H{"deviceId": standardDeviceID, "virtuals": h.deviceGateway.GetVirtualDevices(standardDeviceID)}})
+			return
+		}
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "拆分失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "拆分成功", Data: gin.H{
+		"deviceId": standardDeviceID,
+		"virtuals": virtuals,
+	}})
+}
+
+// HandleGetVirtualSplit 查询虚拟子设备拆分
+// @Summary 查询虚拟子设备拆分
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "物理设备ID"
+// @Success 200 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/virtual-split [get]
+func (h *DeviceHandlers) HandleGetVirtualSplit(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	virtuals := h.deviceGateway.GetVirtualDevices(standardDeviceID)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId": standardDeviceID,
+		"split":    len(virtuals) > 0,
+		"virtuals": virtuals,
+	}})
+}
+
+// HandleDeleteVirtualSplit 删除虚拟子设备拆分
+// @Summary 删除虚拟子设备拆分
+// @Description 删除拆分后虚拟子设备的会话与上报数据归并回物理设备
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "物理设备ID"
+// @Success 200 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/virtual-split [delete]
+func (h *DeviceHandlers) HandleDeleteVirtualSplit(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	if len(h.deviceGateway.GetVirtualDevices(standardDeviceID)) == 0 {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备未拆分虚拟子设备"})
+		return
+	}
+	removed, sessions, err := h.deviceGateway.MergeVirtualDevices(standardDeviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "删除拆分失败: " + err.Error()})
+		return
+	}
+	merged := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		merged = append(merged, gin.H{
+			"port":    s.Port,
+			"orderNo": s.OrderNo,
+			"status":  s.Status.String(),
+		})
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "已归并回物理设备", Data: gin.H{
+		"deviceId":       standardDeviceID,
+		"removed":        removed,
+		"mergedSessions": merged,
+	}})
+}
+
+// HandleSetSIMPair 声明双卡设备SIM卡对
+// @Summary 声明双卡设备SIM卡对
+// @Description 声明设备的主副卡ICCID；设备在卡对内切换ICCID时视为同一设备的SIM卡切换，身份、充电会话与统计保持连续
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param request body SIMPairParams true "SIM卡对"
+// @Success 200 {object} APIResponse
+// @Failure 409 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/sim-pair [post]
+func (h *DeviceHandlers) HandleSetSIMPair(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	var req SIMPairParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	if req.PrimaryICCID == req.SecondaryICCID {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "主副卡ICCID不能相同"})
+		return
+	}
+	pair, err := h.deviceGateway.DeclareSIMPair(standardDeviceID, req.PrimaryICCID, req.SecondaryICCID)
+	if err != nil {
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "SIM卡对已声明", Data: pair})
+}
+
+// HandleGetSIMPair 查询双卡设备SIM卡对
+// @Summary 查询双卡设备SIM卡对
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/sim-pair [get]
+func (h *DeviceHandlers) HandleGetSIMPair(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	pair, ok := h.deviceGateway.GetSIMPair(standardDeviceID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备未声明SIM卡对"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: pair})
+}
+
+// HandleDeleteSIMPair 删除双卡设备SIM卡对
+// @Summary 删除双卡设备SIM卡对
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/sim-pair [delete]
+func (h *DeviceHandlers) HandleDeleteSIMPair(c *gin.Context) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return
+	}
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	if !h.deviceGateway.RemoveSIMPair(standardDeviceID) {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备未声明SIM卡对"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "SIM卡对已删除", Data: gin.H{"deviceId": standardDeviceID}})
+}
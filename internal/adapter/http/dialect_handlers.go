@@ -0,0 +1,71 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleDialects 协议方言与各连接的绑定
+// @Summary 协议方言与各连接的绑定
+// @Description 已注册的协议方言（消息ID字节序、注册了编解码器的命令）与当前各连接的方言绑定：来源（default/listener/detected/manual）、注册完成后的锁定时间与设备ID
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=DialectStatus} "查询成功"
+// @Router /api/v1/admin/dialects [get]
+func (h *AdminHandlers) HandleDialects(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: DialectStatus{
+		Listener:    config.GetConfig().TCPServer.Dialect,
+		Dialects:    dialect.All(),
+		Connections: dialect.GetGlobalTracker().Snapshot(),
+	}})
+}
+
+// HandleSetConnectionDialect 指定连接的协议方言
+// @Summary 指定连接的协议方言
+// @Description 在设备注册完成前手动指定连接的协议方言（之后的注册帧特征识别不再覆盖）；设备注册完成后方言已锁定，返回409
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param connId path int true "连接ID"
+// @Param request body DialectBindParams true "方言"
+// @Success 200 {object} APIResponse{data=dialect.Binding} "指定成功"
+// @Failure 400 {object} APIResponse "参数错误或未知方言"
+// @Failure 404 {object} APIResponse "连接不存在"
+// @Failure 409 {object} APIResponse "设备已完成注册，方言不可切换"
+// @Router /api/v1/admin/dialects/connections/{connId} [put]
+func (h *AdminHandlers) HandleSetConnectionDialect(c *gin.Context) {
+	var uri ConnectionURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	var req DialectBindParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if _, ok := core.GetGlobalTCPManager().GetSessionByConnID(uri.ConnID); !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "连接不存在"})
+		return
+	}
+	tracker := dialect.GetGlobalTracker()
+	err := tracker.Bind(uri.ConnID, dialect.Name(req.Dialect), dialect.SourceManual)
+	switch {
+	case errors.Is(err, dialect.ErrUnknownDialect):
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	case errors.Is(err, dialect.ErrLocked):
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: err.Error()})
+		return
+	}
+	binding, _ := tracker.Get(uri.ConnID)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: binding})
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	apperrors "github.com/bujia-iot/iot-zinx/pkg/errors"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// 同步发送原始命令的等待时间
+const (
+	defaultDNYCommandTimeoutSeconds = 10
+	maxDNYCommandTimeoutSeconds     = 60
+)
+
+// HandleSendDNYCommand 发送原始DNY命令
+// @Summary 发送原始DNY命令
+// @Description 按命令码与十六进制数据构包下发。默认发送后立即返回消息ID；sync=true（查询参数或请求体）时按消息ID等待设备应答帧，
+// @Description 返回应答数据及解码结果，超时（默认10秒，最长60秒）返回504并附消息ID，便于事后关联
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param sync query bool false "同步等待设备应答"
+// @Param timeoutSec query int false "同步等待超时秒数(1-60)"
+// @Param request body DNYCommandRequest true "命令参数"
+// @Success 200 {object} APIResponse{data=DNYCommandResponse}
+// @Failure 400 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Failure 409 {object} APIResponse "设备否定应答"
+// @Failure 503 {object} APIResponse "设备组命令队列已满或等待时限内无法写入"
+// @Failure 504 {object} APIResponse{data=DNYCommandResponse} "等待应答超时"
+// @Router /api/v1/command/dny [post]
+func (h *DeviceHandlers) HandleSendDNYCommand(c *gin.Context) {
+	var req DNYCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if v := c.Query("sync"); v != "" {
+		sync, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "sync 应为 true 或 false"})
+			return
+		}
+		req.Sync = sync
+	}
+	if v := c.Query("timeoutSec"); v != "" {
+		timeoutSec, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "timeoutSec 应为整数"})
+			return
+		}
+		req.TimeoutSec = timeoutSec
+	}
+	if req.TimeoutSec == 0 {
+		req.TimeoutSec = defaultDNYCommandTimeoutSeconds
+	}
+	if req.TimeoutSec < 0 || req.TimeoutSec > maxDNYCommandTimeoutSeconds {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: fmt.Sprintf("timeoutSec 取值范围为1-%d秒", maxDNYCommandTimeoutSeconds)})
+		return
+	}
+	data, err := protocol.DecodeHexInput(req.Data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "data 不是合法的十六进制: " + err.Error()})
+		return
+	}
+
+	processor := &utils.DeviceIDProcessor{}
+	standardDeviceID, err := processor.SmartConvertDeviceID(req.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return
+	}
+	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: gin.H{"deviceId": standardDeviceID, "isOnline": false}})
+		return
+	}
+	if !requireFirmwareSupport(c, h.deviceGateway, standardDeviceID, req.Command) {
+		return
+	}
+
+	opts := network.CommandOptions{CorrelationID: GetCorrelationID(c)}
+	result := DNYCommandResponse{DeviceID: standardDeviceID, Command: fmt.Sprintf("0x%02X", req.Command), Sync: req.Sync}
+	if !req.Sync {
+		handle, err := h.deviceGateway.SendCommandToDeviceWithOptions(c.Request.Context(), standardDeviceID, req.Command, data, opts)
+		if commandQueueUnavailable(err) {
+			c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "命令发送失败: " + err.Error()})
+			return
+		}
+		if handle != nil {
+			result.MessageID = handle.MessageID()
+		}
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "命令发送成功", Data: result})
+		return
+	}
+
+	begin := time.Now()
+	messageID, resp, err := h.deviceGateway.SendCommandAndWaitResponse(c.Request.Context(), standardDeviceID, req.Command, data, opts, time.Duration(req.TimeoutSec)*time.Second)
+	result.MessageID = messageID
+	switch {
+	case apperrors.IsErrCode(err, apperrors.ErrCommandTimeout):
+		c.JSON(http.StatusGatewayTimeout, APIResponse{Code: 504, Message: err.Error(), Data: result})
+		return
+	case apperrors.IsErrCode(err, apperrors.ErrDeviceRejected):
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error(), Data: result})
+		return
+	case commandQueueUnavailable(err):
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error(), Data: result})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "命令发送失败: " + err.Error(), Data: result})
+		return
+	}
+	result.ReplyData = hex.EncodeToString(resp.Payload)
+	result.ReplyLength = len(resp.Payload)
+	result.ReplyFrame = hex.EncodeToString(resp.RawFrame)
+	result.ElapsedMs = resp.ReceivedAt.Sub(begin).Milliseconds()
+	result.Decoded = protocol.DiagnoseFrame(resp.RawFrame, protocol.FrameDirectionUplink)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: result})
+}
+
+// commandQueueUnavailable 设备组出站队列已满或期限内轮不到写入（调用方可稍后重试）
+func commandQueueUnavailable(err error) bool {
+	return errors.Is(err, core.ErrCommandQueueFull) || errors.Is(err, core.ErrCommandQueueBusy)
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/gin-gonic/gin"
+)
+
+// EnergyHandlers 端口累计电量 HTTP 处理器
+type EnergyHandlers struct{}
+
+// NewEnergyHandlers 创建端口电量处理器
+func NewEnergyHandlers() *EnergyHandlers { return &EnergyHandlers{} }
+
+// HandlePortEnergy 单端口累计电量
+// @Summary 端口累计电量
+// @Description 端口跟踪以来的累计电量、当月电量与最近12个月历史（结算为准，未收到结算的会话按功率积分补记），附进行中会话的积分电量与维护阈值标记；设备离线也可查询
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID（可为虚拟子设备ID）"
+// @Param port path int true "业务端口(1-based)，虚拟子设备为虚拟端口"
+// @Success 200 {object} APIResponse{data=object} "查询成功（energy 为 energy.PortEnergy）"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 404 {object} APIResponse "该端口暂无电量记录"
+// @Router /api/v1/device/{deviceId}/ports/{port}/energy [get]
+func (h *EnergyHandlers) HandlePortEnergy(c *gin.Context) {
+	var uri PortEnergyURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	deviceID, port, ok := resolvePhysicalPort(c, uri.DeviceID, uri.Port)
+	if !ok {
+		return
+	}
+
+	result, ok := energy.GetGlobalCounters().Port(deviceID, port, time.Now())
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "该端口暂无电量记录", Data: gin.H{"deviceId": uri.DeviceID, "standardId": deviceID, "port": port}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId":     uri.DeviceID,
+		"port":         uri.Port,
+		"standardId":   deviceID,
+		"physicalPort": port,
+		"energy":       result,
+	}})
+}
+
+// HandleEnergyReport 全部端口累计电量报告
+// @Summary 端口累计电量报告
+// @Description 全部端口按累计电量从高到低排序，累计电量达到维护阈值的端口标记 overThreshold，供安排线缆更换
+// @Tags device
+// @Produce json
+// @Param thresholdKWh query number false "维护阈值(kWh)，默认使用配置 energyCounters.thresholdKWh"
+// @Param overOnly query bool false "只返回达到阈值的端口"
+// @Param limit query int false "返回条数，默认500"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Router /api/v1/energy/ports [get]
+func (h *EnergyHandlers) HandleEnergyReport(c *gin.Context) {
+	var q EnergyReportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	counters := energy.GetGlobalCounters()
+	threshold := q.ThresholdKWh
+	if threshold <= 0 {
+		threshold = counters.Options().ThresholdKWh
+	}
+	all := counters.Report(threshold, time.Now())
+
+	over := 0
+	ports := make([]energy.PortEnergy, 0, len(all))
+	for _, p := range all {
+		if p.OverThreshold {
+			over++
+		} else if q.OverOnly {
+			continue
+		}
+		if len(ports) < q.Limit {
+			ports = append(ports, p)
+		}
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"thresholdKWh":  threshold,
+		"trackedPorts":  len(all),
+		"overThreshold": over,
+		"total":         len(ports),
+		"ports":         ports,
+	}})
+}
+
+// resolvePhysicalPort 路径中的设备ID与业务端口解析为物理设备ID与端口（虚拟子设备映射到父设备端口），失败时已写出400响应
+func resolvePhysicalPort(c *gin.Context, deviceID string, port int) (string, int, bool) {
+	if v, ok := virtual.Resolve(deviceID); ok {
+		physicalPort, err := v.PhysicalPort(port)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "虚拟设备端口错误: " + err.Error()})
+			return "", 0, false
+		}
+		return v.ParentID, physicalPort, true
+	}
+	standard, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(deviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+		return "", 0, false
+	}
+	return standard, port, true
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/fleetalert"
+	"github.com/gin-gonic/gin"
+)
+
+// FleetAlertHandlers 全网在线设备数告警 HTTP 处理器
+type FleetAlertHandlers struct{}
+
+// NewFleetAlertHandlers 创建在线设备数告警处理器
+func NewFleetAlertHandlers() *FleetAlertHandlers { return &FleetAlertHandlers{} }
+
+// HandleFleetAlerts 全网在线设备数告警
+// @Summary 全网在线设备数告警
+// @Description 进行中的告警（active）、最近告警（history，新→旧，含已恢复）、生效的规则与最大窗口内的在线设备数样本。
+// @Description rate_of_change 规则在在线数较窗口内最高值下降 dropPercent 且至少 minDrop 台时告警；告警附窗口内离线的ICCID与前缀分布，scope=site 表示离线集中在少数前缀（单站点），gateway 表示分散（网关整体）
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 503 {object} APIResponse "在线设备数告警未启用"
+// @Router /api/v1/admin/fleet-alerts [get]
+func (h *FleetAlertHandlers) HandleFleetAlerts(c *gin.Context) {
+	m := fleetalert.GetGlobalMonitor()
+	if m == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "在线设备数告警未启用"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"active":  m.Active(),
+		"history": m.History(),
+		"rules":   m.Options().Rules,
+		"samples": m.Samples(),
+	}})
+}
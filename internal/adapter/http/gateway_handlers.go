@@ -1,10 +1,16 @@
 package http
 
 import (
+	"math"
 	"net/http"
 	"time"
 
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/framededup"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
 	"github.com/gin-gonic/gin"
 )
@@ -34,16 +40,61 @@ func (h *DeviceGatewayHandlers) HandleHealthCheck(c *gin.Context) {
 		"data": gin.H{
 			"status":    "ok",
 			"timestamp": time.Now(),
-			"version":   "2.0.0",
+			"version":   gateway.GatewayVersion,
 			"uptime":    "运行中",
 			"gateway":   "DeviceGateway统一架构",
 		},
 	})
 }
 
+// 就绪检查状态
+const (
+	ReadyStatusReady    = "ready"
+	ReadyStatusDegraded = "degraded" // 就绪但部分依赖不可用，按降级策略服务
+	ReadyStatusDown     = "down"
+)
+
+// HandleReadyz 就绪检查
+// @Summary 就绪检查
+// @Description 供负载均衡探测：HTTP与TCP服务均已启动且未进入停机摘流时返回200，否则返回503（status=down）；warnings 列出需要关注但不影响就绪的状态（如通知暂存积压）。
+// @Description 依赖不可用但服务按降级策略继续运行（如Redis降级）时仍返回200，status=degraded 并在 degraded 中列出原因，与 status=ready 区分
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse
+// @Failure 503 {object} APIResponse
+// @Router /readyz [get]
+func (h *DeviceGatewayHandlers) HandleReadyz(c *gin.Context) {
+	readiness := lifecycle.GetReadiness()
+	ready, components := readiness.Status()
+	data := gin.H{
+		"ready":      ready,
+		"status":     ReadyStatusReady,
+		"draining":   readiness.IsDraining(),
+		"components": components,
+	}
+	if warnings := readiness.Warnings(); len(warnings) > 0 {
+		data["warnings"] = warnings
+	}
+	degraded := readiness.Degradations()
+	if len(degraded) > 0 {
+		data["status"] = ReadyStatusDegraded
+		data["degraded"] = degraded
+	}
+	if !ready {
+		data["status"] = ReadyStatusDown
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "服务未就绪", Data: data})
+		return
+	}
+	if len(degraded) > 0 {
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "就绪（降级运行）", Data: data})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "就绪", Data: data})
+}
+
 // HandleSystemStats 系统统计信息
 // @Summary 获取系统统计信息
-// @Description 获取设备网关的统计信息，包括设备数量、连接状态等
+// @Description 获取设备网关的统计信息，包括设备数量、连接状态、下发命令的待应答/重发中/放弃数（commands）、启用时的流量日志写入与抽样计数（traffic_log）等；只读副本模式下返回主实例快照中的统计计数（多个主实例时按实例分列），附 dataSource=replica 与快照时间 stateAt
 // @Tags system
 // @Accept json
 // @Produce json
@@ -51,6 +102,16 @@ func (h *DeviceGatewayHandlers) HandleHealthCheck(c *gin.Context) {
 // @Router /api/v1/stats [get]
 func (h *DeviceGatewayHandlers) HandleSystemStats(c *gin.Context) {
 	stats := h.deviceGateway.GetDeviceStatistics()
+	stats["charging_dry_run"] = GetChargingDryRunStats() // 试运行不下发，与命令统计分开
+	stats["handler_panics"] = handlerguard.GetGlobalGuard().Stats()
+	stats["commands"] = network.GetCommandManager().Stats()
+	if d := framededup.GetGlobalDeduper(); d != nil {
+		stats["frame_dedup"] = d.Stats()
+	}
+	if l := logger.GetTrafficLogger(); l != nil {
+		stats["traffic_log"] = l.Stats()
+	}
+	stats["device_detail_cache"] = h.deviceGateway.GetDetailCache().Stats()
 
 	// 合并通知系统统计（若启用）并做字段兼容
 	notif := notification.GetGlobalNotificationIntegrator()
@@ -61,11 +122,18 @@ func (h *DeviceGatewayHandlers) HandleSystemStats(c *gin.Context) {
 				"total_success":       svcStats.TotalSuccess,
 				"total_failed":        svcStats.TotalFailed,
 				"total_retried":       svcStats.TotalRetried,
+				"total_dead_lettered": svcStats.TotalDeadLettered,
 				"avg_response_time":   svcStats.AvgResponseTime.String(),
 				"queue_length":        notif.GetQueueLength(),
 				"retry_queue_length":  notif.GetRetryQueueLength(),
 				"dropped_by_sampling": svcStats.DroppedBySampling,
 				"dropped_by_throttle": svcStats.DroppedByThrottle,
+				"unrouted":            svcStats.Unrouted,
+				"endpoint_stats":      svcStats.EndpointStats,
+				"tenant_stats":        svcStats.TenantStats,
+				"suppressed_dups":     svcStats.SuppressedDuplicates,
+				"spool":               svcStats.Spool,
+				"fan_out":             svcStats.FanOut,
 			}
 			// 顶层兼容字段
 			stats["total_sent"] = svcStats.TotalSent
@@ -86,3 +154,28 @@ func (h *DeviceGatewayHandlers) HandleSystemStats(c *gin.Context) {
 		"data":    stats,
 	})
 }
+
+// HandleFleetSummary 仪表盘汇总
+// @Summary 获取仪表盘汇总数据
+// @Description 服务端一次性计算设备总数/在线/离线、按类型分布、连接数、充电会话、近1小时充电开始/结束、活跃告警（critical/high/warning）、近1小时通知成功率及网关运行信息
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=SummaryResponse} "获取汇总成功"
+// @Router /api/v1/summary [get]
+func (h *DeviceGatewayHandlers) HandleFleetSummary(c *gin.Context) {
+	now := time.Now()
+	resp := SummaryResponse{FleetSummary: h.deviceGateway.GetFleetSummary(now)}
+
+	notif := notification.GetGlobalNotificationIntegrator()
+	if sent, success, rate, ok := notif.GetRecentDeliveryStats(now); ok {
+		resp.Notifications = NotificationSummary{
+			Enabled:     true,
+			Sent:        sent,
+			Success:     success,
+			SuccessRate: math.Round(rate*100) / 100,
+			QueueLength: notif.GetQueueLength(),
+		}
+	}
+
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "获取汇总成功", Data: resp})
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// maxGroupBroadcastWaitSeconds 组广播长轮询最长等待时间
+const maxGroupBroadcastWaitSeconds = 60
+
+// HandleGroupBroadcast 设备组广播
+// @Summary 设备组广播
+// @Description 向同一ICCID共享连接的全部在线设备广播参数：逐台渲染帧（替换各自物理ID），按连接节奏连续下发而不逐台等待应答，返回202与广播ID。
+// @Description 支持 time-sync（0x22下发服务器时间，设备不应答，下发即为 sent）与 power-params（0x85设置最大充电时长与过载功率，逐台跟踪应答）；
+// @Description rate-push 因AP3000协议无设备侧费率表返回400。广播开始后加入设备组的设备不在本次广播内；wait>0时长轮询等待广播结束（最长60秒）
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param iccid path string true "设备组ICCID"
+// @Param request body GroupBroadcastParams true "广播参数"
+// @Success 202 {object} APIResponse{data=gateway.GroupBroadcast}
+// @Failure 400 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device-groups/{iccid}/broadcasts [post]
+func (h *DeviceHandlers) HandleGroupBroadcast(c *gin.Context) {
+	iccid := c.Param("iccid")
+	var params GroupBroadcastParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if params.Wait < 0 || params.Wait > maxGroupBroadcastWaitSeconds {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: fmt.Sprintf("wait 取值范围为0-%d秒", maxGroupBroadcastWaitSeconds)})
+		return
+	}
+
+	tracker := h.deviceGateway.GetGroupBroadcasts()
+	broadcast, err := h.deviceGateway.BroadcastToGroup(gateway.GroupBroadcastRequest{
+		ICCID:         iccid,
+		Type:          params.Type,
+		CorrelationID: GetCorrelationID(c),
+		MaxChargeTime: params.MaxChargeTime,
+		OverloadPower: params.OverloadPower,
+	})
+	switch {
+	case errors.Is(err, gateway.ErrDeviceGroupEmpty):
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+
+	if params.Wait > 0 {
+		if latest, ok := tracker.Wait(iccid, broadcast.ID, time.Duration(params.Wait)*time.Second); ok {
+			broadcast = latest
+		}
+	}
+	c.JSON(http.StatusAccepted, APIResponse{Code: 0, Message: "组广播已开始", Data: broadcast})
+}
+
+// HandleGroupBroadcastStatus 设备组广播结果
+// @Summary 设备组广播结果
+// @Description 查询组广播的汇总结果：各设备下发状态（pending/sent/acked/timeout/failed/skipped）及计数；广播期间断开的设备记为 skipped
+// @Tags device
+// @Produce json
+// @Param iccid path string true "设备组ICCID"
+// @Param id path string true "广播ID"
+// @Success 200 {object} APIResponse{data=gateway.GroupBroadcast}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device-groups/{iccid}/broadcasts/{id} [get]
+func (h *DeviceHandlers) HandleGroupBroadcastStatus(c *gin.Context) {
+	broadcast, ok := h.deviceGateway.GetGroupBroadcasts().Get(c.Param("iccid"), c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: gateway.ErrGroupBroadcastNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: broadcast})
+}
@@ -0,0 +1,303 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// 入站webhook请求头
+const (
+	HeaderHookSource    = "X-Hook-Source"
+	HeaderHookTimestamp = "X-Hook-Timestamp" // Unix秒
+	HeaderHookNonce     = "X-Hook-Nonce"
+	HeaderHookSignature = "X-Hook-Signature" // hex(HMAC-SHA256(secret, 时间戳.nonce.请求体))，可带 sha256= 前缀
+)
+
+// 入站webhook命令类型
+const (
+	HookCommandChargeStart = "charge_start"
+	HookCommandChargeStop  = "charge_stop"
+	HookCommandLocate      = "locate"
+	HookCommandParamSet    = "param_set"
+)
+
+const (
+	defaultHookWindowSeconds  = 300
+	defaultHookNonceCacheSize = 10000
+	maxHookBodyBytes          = 64 << 10
+	maxHookNonceLen           = 128
+	problemContentType        = "application/problem+json"
+)
+
+type hookSource struct {
+	cfg     config.WebhookSourceConfig
+	allowed map[string]bool
+	limiter *utils.RollingCounter
+}
+
+// HookHandlers 入站webhook处理器：验签 + 防重放 + 限流后映射到现有命令操作
+type HookHandlers struct {
+	enabled  bool
+	window   time.Duration
+	sources  map[string]*hookSource
+	nonces   *utils.LRUSet
+	commands map[string]gin.HandlerFunc
+	now      func() time.Time
+}
+
+// NewHookHandlers 按全局配置创建入站webhook处理器
+func NewHookHandlers(charging *ChargingHandlers, device *DeviceHandlers) *HookHandlers {
+	return NewHookHandlersWithConfig(config.GetConfig().WebhookReceiver, charging, device)
+}
+
+// NewHookHandlersWithConfig 按指定配置创建入站webhook处理器
+func NewHookHandlersWithConfig(cfg config.WebhookReceiverConfig, charging *ChargingHandlers, device *DeviceHandlers) *HookHandlers {
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+	if window <= 0 {
+		window = defaultHookWindowSeconds * time.Second
+	}
+	cacheSize := cfg.NonceCacheSize
+	if cacheSize <= 0 {
+		cacheSize = defaultHookNonceCacheSize
+	}
+	h := &HookHandlers{
+		enabled: cfg.Enabled,
+		window:  window,
+		sources: make(map[string]*hookSource, len(cfg.Sources)),
+		nonces:  utils.NewLRUSet(cacheSize),
+		commands: map[string]gin.HandlerFunc{
+			HookCommandChargeStart: charging.HandleStartCharging,
+			HookCommandChargeStop:  charging.HandleStopCharging,
+			HookCommandLocate:      device.HandleDeviceLocate,
+			HookCommandParamSet:    charging.HandleUpdateChargingPower,
+		},
+		now: time.Now,
+	}
+	for _, sc := range cfg.Sources {
+		if sc.Name == "" || sc.Secret == "" {
+			logger.WithFields(logrus.Fields{"source": sc.Name}).Warn("⚠️ 入站webhook来源缺少名称或密钥，已忽略")
+			continue
+		}
+		src := &hookSource{cfg: sc}
+		if len(sc.AllowedCommands) > 0 {
+			src.allowed = make(map[string]bool, len(sc.AllowedCommands))
+			for _, cmd := range sc.AllowedCommands {
+				src.allowed[strings.TrimSpace(cmd)] = true
+			}
+		}
+		if sc.RateLimitPerMinute > 0 {
+			src.limiter = utils.NewRollingCounter(time.Minute)
+		}
+		h.sources[sc.Name] = src
+	}
+	return h
+}
+
+// SignHookRequest 计算入站webhook签名（供调用方与测试使用）
+func SignHookRequest(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HandleHookCommand 入站webhook命令
+// @Summary 入站webhook命令
+// @Description 订单平台推送命令（charge_start/charge_stop/locate/param_set）。需携带 X-Hook-Source、X-Hook-Timestamp、X-Hook-Nonce、X-Hook-Signature；时间戳超出窗口或nonce重复视为重放。错误以 application/problem+json 返回
+// @Tags hooks
+// @Accept json
+// @Produce json,application/problem+json
+// @Security HookSignature
+// @Param X-Hook-Source header string true "来源名称"
+// @Param X-Hook-Timestamp header string true "Unix秒时间戳"
+// @Param X-Hook-Nonce header string true "一次性随机串"
+// @Param X-Hook-Signature header string true "hex(HMAC-SHA256(secret, 时间戳.nonce.请求体))"
+// @Param request body HookCommandRequest true "命令"
+// @Success 200 {object} APIResponse
+// @Failure 400 {object} ProblemDetails
+// @Failure 401 {object} ProblemDetails
+// @Failure 403 {object} ProblemDetails
+// @Failure 409 {object} ProblemDetails
+// @Failure 429 {object} ProblemDetails
+// @Router /api/v1/hooks/commands [post]
+func (h *HookHandlers) HandleHookCommand(c *gin.Context) {
+	if !h.enabled {
+		h.problem(c, http.StatusNotFound, "入站webhook未启用", "")
+		return
+	}
+
+	sourceName := c.GetHeader(HeaderHookSource)
+	src, ok := h.sources[sourceName]
+	if !ok {
+		h.problem(c, http.StatusUnauthorized, "未知的webhook来源", fmt.Sprintf("来源 %q 未配置", sourceName))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxHookBodyBytes+1))
+	if err != nil || len(body) > maxHookBodyBytes {
+		h.problem(c, http.StatusBadRequest, "请求体无效", "请求体读取失败或超过64KB")
+		return
+	}
+
+	timestamp := c.GetHeader(HeaderHookTimestamp)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		h.problem(c, http.StatusUnauthorized, "时间戳无效", "X-Hook-Timestamp 需为Unix秒")
+		return
+	}
+	now := h.now()
+	if skew := now.Sub(time.Unix(sec, 0)); skew > h.window || skew < -h.window {
+		h.problem(c, http.StatusUnauthorized, "请求已过期", fmt.Sprintf("时间戳偏差 %s 超出窗口 %s", skew.Truncate(time.Second), h.window))
+		return
+	}
+
+	nonce := c.GetHeader(HeaderHookNonce)
+	if nonce == "" || len(nonce) > maxHookNonceLen {
+		h.problem(c, http.StatusUnauthorized, "nonce无效", fmt.Sprintf("X-Hook-Nonce 不能为空且不超过%d字符", maxHookNonceLen))
+		return
+	}
+
+	signature := strings.TrimPrefix(c.GetHeader(HeaderHookSignature), "sha256=")
+	expected := SignHookRequest(src.cfg.Secret, timestamp, nonce, body)
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		h.problem(c, http.StatusUnauthorized, "签名校验失败", "")
+		return
+	}
+
+	// 验签通过后再记录nonce，避免伪造请求占满缓存
+	if !h.nonces.Add(sourceName + ":" + nonce) {
+		h.problem(c, http.StatusConflict, "重复的请求", "nonce已使用，疑似重放")
+		return
+	}
+
+	if src.limiter != nil {
+		if src.limiter.Sum(now) >= int64(src.cfg.RateLimitPerMinute) {
+			c.Header("Retry-After", "60")
+			h.problem(c, http.StatusTooManyRequests, "请求过于频繁", fmt.Sprintf("来源 %s 每分钟上限 %d", sourceName, src.cfg.RateLimitPerMinute))
+			return
+		}
+		src.limiter.AddAt(now, 1)
+	}
+
+	var req HookCommandRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Type == "" || len(req.Params) == 0 {
+		h.problem(c, http.StatusBadRequest, "命令格式错误", "需包含 type 与 params")
+		return
+	}
+	handler, ok := h.commands[req.Type]
+	if !ok {
+		h.problem(c, http.StatusBadRequest, "不支持的命令类型", req.Type)
+		return
+	}
+	if src.allowed != nil && !src.allowed[req.Type] {
+		h.problem(c, http.StatusForbidden, "命令类型未授权", fmt.Sprintf("来源 %s 不允许 %s", sourceName, req.Type))
+		return
+	}
+
+	status, resp := h.dispatch(c, handler, req.Params)
+	requestID := GetCorrelationID(c)
+	logger.WithFields(logrus.Fields{
+		"source":        sourceName,
+		"command":       req.Type,
+		"nonce":         nonce,
+		"correlationID": requestID,
+		"status":        status,
+	}).Info("📥 入站webhook命令已受理")
+
+	if status >= http.StatusBadRequest {
+		p := ProblemDetails{Title: resp.Message, Status: status, Detail: req.Type}
+		if data, ok := resp.Data.(map[string]interface{}); ok {
+			if e, ok := data["error"].(string); ok {
+				p.Detail = e
+			}
+			p.Errors = data
+		}
+		h.writeProblem(c, p)
+		return
+	}
+	c.JSON(status, APIResponse{Code: resp.Code, Message: resp.Message, Data: gin.H{
+		"source":    sourceName,
+		"command":   req.Type,
+		"requestId": requestID,
+		"result":    resp.Data,
+	}})
+}
+
+// dispatch 以 params 为请求体调用现有命令处理器，截获其响应
+func (h *HookHandlers) dispatch(c *gin.Context, handler gin.HandlerFunc, params json.RawMessage) (int, APIResponse) {
+	original := c.Writer
+	captured := &capturedResponse{ResponseWriter: original, status: http.StatusOK}
+	c.Writer = captured
+	c.Request.Body = io.NopCloser(bytes.NewReader(params))
+	c.Request.ContentLength = int64(len(params))
+	handler(c)
+	c.Writer = original
+	original.Header().Del("Content-Type")
+
+	var resp APIResponse
+	if err := json.Unmarshal(captured.body.Bytes(), &resp); err != nil {
+		return http.StatusInternalServerError, APIResponse{Code: 500, Message: "命令响应解析失败"}
+	}
+	return captured.status, resp
+}
+
+func (h *HookHandlers) problem(c *gin.Context, status int, title, detail string) {
+	h.writeProblem(c, ProblemDetails{Title: title, Status: status, Detail: detail})
+}
+
+func (h *HookHandlers) writeProblem(c *gin.Context, p ProblemDetails) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	p.Instance = c.Request.URL.Path
+	p.RequestID = GetCorrelationID(c)
+	logger.WithFields(logrus.Fields{
+		"source":        c.GetHeader(HeaderHookSource),
+		"status":        p.Status,
+		"title":         p.Title,
+		"detail":        p.Detail,
+		"correlationID": p.RequestID,
+		"clientIP":      c.ClientIP(),
+	}).Warn("⚠️ 入站webhook请求未执行")
+	data, _ := json.Marshal(p)
+	c.Data(p.Status, problemContentType, data)
+}
+
+// capturedResponse 截获内部处理器写出的状态码与响应体
+type capturedResponse struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *capturedResponse) WriteHeader(code int) { w.status = code }
+
+func (w *capturedResponse) WriteHeaderNow() {}
+
+func (w *capturedResponse) Write(data []byte) (int, error) { return w.body.Write(data) }
+
+func (w *capturedResponse) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+
+func (w *capturedResponse) Status() int { return w.status }
+
+func (w *capturedResponse) Size() int { return w.body.Len() }
+
+func (w *capturedResponse) Written() bool { return w.body.Len() > 0 }
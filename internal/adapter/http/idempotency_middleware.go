@@ -0,0 +1,88 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/pkg/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HeaderIdempotencyKey 调用方生成的幂等键：同一键的重试重放首个应答，不再次下发
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed 响应头：本次应答为同一幂等键首个请求的重放
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	// ErrorCodeIdempotencyInFlight 同一幂等键的首个请求仍在执行（附 Retry-After）
+	ErrorCodeIdempotencyInFlight = "IDEMPOTENCY_IN_FLIGHT"
+	// ErrorCodeIdempotencyKeyReused 同一幂等键携带了不同的请求体
+	ErrorCodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+
+	maxIdempotencyKeyLen = 128
+)
+
+// IdempotencyKeyMiddleware 按 Idempotency-Key 请求头去重：键按调用方（API Key名称+租户）、接口与键值隔离；
+// 首个请求得到确定结果（非5xx）后，窗口内的重试重放该应答；5xx 撤销登记，允许同一键重试。未携带请求头时不处理
+func IdempotencyKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := idempotency.GetGlobalResponses()
+		key := strings.TrimSpace(c.GetHeader(HeaderIdempotencyKey))
+		if store == nil || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "Idempotency-Key 过长"})
+			return
+		}
+		var raw []byte
+		if c.Request.Body != nil {
+			raw, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		}
+		sum := sha256.Sum256(raw)
+		scoped := strings.Join([]string{c.GetHeader("X-API-Key-Name"), c.GetHeader("X-Tenant-ID"), c.Request.Method, c.FullPath(), key}, "\x00")
+
+		resp, state := store.Begin(scoped, hex.EncodeToString(sum[:]))
+		switch state {
+		case idempotency.KeyReplay:
+			c.Header(HeaderIdempotentReplayed, "true")
+			c.Data(resp.Status, resp.ContentType, resp.Body)
+			c.Abort()
+			return
+		case idempotency.KeyInFlight:
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, APIResponse{Code: 409, Message: "同一幂等键的请求仍在执行", Data: gin.H{"errorCode": ErrorCodeIdempotencyInFlight}})
+			return
+		case idempotency.KeyMismatch:
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, APIResponse{Code: 422, Message: "同一幂等键不能用于不同的请求", Data: gin.H{"errorCode": ErrorCodeIdempotencyKeyReused}})
+			return
+		}
+
+		capture := &capturedResponse{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = capture
+		completed := false
+		defer func() {
+			// 处理器panic：撤销登记，避免同一键在窗口内一直视为进行中
+			if !completed {
+				c.Writer = capture.ResponseWriter
+				store.Abort(scoped)
+			}
+		}()
+		c.Next()
+		completed = true
+		c.Writer = capture.ResponseWriter
+		if capture.status >= http.StatusInternalServerError {
+			store.Abort(scoped)
+		} else {
+			store.Complete(scoped, idempotency.Response{Status: capture.status, ContentType: c.Writer.Header().Get("Content-Type"), Body: capture.body.Bytes()})
+		}
+		c.Writer.WriteHeader(capture.status)
+		_, _ = c.Writer.Write(capture.body.Bytes())
+	}
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleLowData 低流量模式分配与分类表
+// @Summary 低流量模式分配与分类表
+// @Description 返回当前生效的低流量模式分配（租户/ICCID/排除）、各租户生效行为、可抑制的应答与主动查询分类表、最近一次热加载错误与累计流量
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=lowdata.Status} "查询成功"
+// @Router /api/v1/admin/low-data [get]
+func (h *AdminHandlers) HandleLowData(c *gin.Context) {
+	registry := lowdata.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "未启用低流量模式", Data: lowdata.Status{Classification: lowdata.Classification()}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: registry.Status()})
+}
+
+// HandleReloadLowData 立即重新加载低流量模式分配
+// @Summary 立即重新加载低流量模式分配
+// @Description 重新读取并校验分配文件，校验失败时返回错误原因并继续使用旧分配；成功后各连接的下一帧即按新分配处理
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=lowdata.Status} "加载成功"
+// @Failure 422 {object} APIResponse "分配校验失败"
+// @Failure 503 {object} APIResponse "未启用低流量模式"
+// @Router /api/v1/admin/low-data/reload [post]
+func (h *AdminHandlers) HandleReloadLowData(c *gin.Context) {
+	registry := lowdata.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用低流量模式"})
+		return
+	}
+	if err := registry.Reload(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{Code: 422, Message: "低流量模式分配校验失败，继续使用旧分配", Data: gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "低流量模式分配已重新加载", Data: registry.Status()})
+}
+
+// HandleTrafficReport 低流量连接的下行流量报告
+// @Summary 低流量连接的下行流量报告
+// @Description 按连接列出低流量模式下的实发帧数与字节、被抑制的帧（按类型）及估算节省的字节（被抑制帧若发送将产生的字节 + 合并写入省下的报文开销）；字节数含每次写入的TCP/IP报头估算
+// @Tags system
+// @Produce json
+// @Param tenantId query string false "按租户过滤"
+// @Param iccid query string false "按ICCID过滤"
+// @Success 200 {object} APIResponse{data=lowdata.TrafficReport} "查询成功"
+// @Router /api/v1/traffic/report [get]
+func (h *AdminHandlers) HandleTrafficReport(c *gin.Context) {
+	registry := lowdata.GetGlobalRegistry()
+	if registry == nil {
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "未启用低流量模式", Data: lowdata.TrafficReport{Connections: []lowdata.ConnTraffic{}}})
+		return
+	}
+	report := registry.Traffic(lowdata.TrafficFilter{TenantID: c.Query("tenantId"), ICCID: c.Query("iccid")})
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: report})
+}
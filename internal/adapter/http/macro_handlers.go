@@ -0,0 +1,121 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMacroWaitSeconds 宏执行长轮询最长等待时间
+const maxMacroWaitSeconds = 60
+
+// HandleListMacros 可用的设备宏
+// @Summary 可用的设备宏
+// @Description 列出已注册的宏（内置宏与配置中的自定义宏）及其步骤
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse{data=[]gateway.MacroDefinition}
+// @Router /api/v1/device/{deviceId}/macros [get]
+func (h *DeviceHandlers) HandleListMacros(c *gin.Context) {
+	if _, ok := bindStandardDeviceID(c); !ok {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.deviceGateway.GetMacroEngine().Definitions()})
+}
+
+// HandleRunMacro 执行设备宏
+// @Summary 执行设备宏
+// @Description 按序执行宏的各步骤（如 safe_port_reset：停止充电(如有) → 等待确认 → 切断并恢复过载功率 → 状态查询），返回202与执行ID；
+// @Description 任一步失败或超过整体超时即中止，并逆序执行已定义的回滚步骤。同一设备同时只执行一个宏，进行中时返回409；wait>0时长轮询等待执行结束（最长60秒）
+// @Tags device
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param name path string true "宏名称"
+// @Param request body MacroRunParams false "宏参数"
+// @Success 202 {object} APIResponse{data=gateway.MacroExecution}
+// @Failure 404 {object} APIResponse
+// @Failure 409 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/macros/{name} [post]
+func (h *DeviceHandlers) HandleRunMacro(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	var params MacroRunParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+			return
+		}
+	}
+	if params.Wait < 0 || params.Wait > maxMacroWaitSeconds {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: fmt.Sprintf("wait 取值范围为0-%d秒", maxMacroWaitSeconds)})
+		return
+	}
+	if !h.deviceGateway.IsDeviceOnline(standardDeviceID) {
+		if respondRemoteOwner(c, standardDeviceID) {
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "设备不在线"})
+		return
+	}
+
+	engine := h.deviceGateway.GetMacroEngine()
+	exec, err := engine.Start(c.Param("name"), gateway.MacroRequest{
+		DeviceID:      standardDeviceID,
+		Port:          params.Port,
+		Originator:    c.ClientIP(),
+		CorrelationID: GetCorrelationID(c),
+	})
+	switch {
+	case errors.Is(err, gateway.ErrMacroNotFound):
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+		return
+	case errors.Is(err, gateway.ErrMacroBusy):
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+
+	if params.Wait > 0 {
+		if latest, ok := engine.Wait(standardDeviceID, exec.ID, time.Duration(params.Wait)*time.Second); ok {
+			exec = latest
+		}
+	}
+	c.JSON(http.StatusAccepted, APIResponse{Code: 0, Message: "宏已开始执行", Data: exec})
+}
+
+// HandleMacroExecution 宏执行状态
+// @Summary 宏执行状态
+// @Description 查询宏执行记录与各步骤的实时状态（pending/running/succeeded/skipped/failed/aborted）及回滚结果
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param executionId path string true "宏执行ID"
+// @Success 200 {object} APIResponse{data=gateway.MacroExecution}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/macros/executions/{executionId} [get]
+func (h *DeviceHandlers) HandleMacroExecution(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	exec, exists := h.deviceGateway.GetMacroEngine().Get(standardDeviceID, c.Param("executionId"))
+	if !exists {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: gateway.ErrMacroExecutionNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: exec})
+}
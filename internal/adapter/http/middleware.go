@@ -0,0 +1,41 @@
+package http
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderRequestID 链路追踪请求头，调用方可传入，否则由网关生成
+	HeaderRequestID = "X-Request-ID"
+	// ContextKeyCorrelationID gin上下文中的链路追踪ID键
+	ContextKeyCorrelationID = "correlationID"
+
+	maxCorrelationIDLen = 64
+)
+
+// CorrelationIDMiddleware 链路追踪中间件
+// 接收或生成 X-Request-ID，写入gin上下文与响应头；访问日志由 gin 日志中间件统一记录
+func CorrelationIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		correlationID := strings.TrimSpace(c.GetHeader(HeaderRequestID))
+		if correlationID == "" || len(correlationID) > maxCorrelationIDLen {
+			correlationID = uuid.New().String()
+		}
+		c.Set(ContextKeyCorrelationID, correlationID)
+		c.Header(HeaderRequestID, correlationID)
+		c.Next()
+	}
+}
+
+// GetCorrelationID 获取当前请求的链路追踪ID
+func GetCorrelationID(c *gin.Context) string {
+	if v, ok := c.Get(ContextKeyCorrelationID); ok {
+		if id, ok := v.(string); ok {
+			return id
+		}
+	}
+	return ""
+}
@@ -1,6 +1,19 @@
 package http
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
+	"github.com/bujia-iot/iot-zinx/pkg/chargepolicy"
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/shaping"
+)
 
 // APIResponse API统一响应结构
 // @Description API统一响应格式
@@ -41,22 +54,35 @@ type SendCommandRequest struct {
 }
 
 // DNYCommandRequest DNY协议命令请求
-// @Description DNY协议命令发送请求
+// @Description DNY协议原始命令发送请求；sync=true 时等待设备应答帧后返回
 type DNYCommandRequest struct {
 	DeviceID   string `json:"deviceId" binding:"required" example:"04ceaa40"` // 设备ID
 	Command    byte   `json:"command" binding:"required" example:"129"`       // DNY命令码 (0x81=129)
 	Data       string `json:"data" example:"01020304"`                        // 十六进制数据字符串
-	WaitReply  bool   `json:"waitReply" example:"false"`                      // 是否等待回复
-	TimeoutSec int    `json:"timeoutSec" example:"5"`                         // 超时时间(秒)
+	Sync       bool   `json:"sync" example:"true"`                            // 同步等待设备应答（也可用查询参数 sync=true）
+	TimeoutSec int    `json:"timeoutSec" example:"10"`                        // 同步等待超时(秒)，默认10，最大60
 }
 
 // DNYCommandResponse DNY协议命令响应
-// @Description DNY协议命令发送响应
+// @Description 异步发送仅返回消息ID；同步发送附带设备应答帧及解码结果
 type DNYCommandResponse struct {
-	Success     bool   `json:"success" example:"true"`            // 发送是否成功
-	Message     string `json:"message" example:"命令发送成功"`          // 响应消息
-	ReplyData   string `json:"replyData,omitempty" example:"00"`  // 回复数据(十六进制)
-	ReplyLength int    `json:"replyLength,omitempty" example:"1"` // 回复数据长度
+	DeviceID    string                     `json:"deviceId" example:"04CEAA40"`       // 标准设备ID
+	MessageID   uint16                     `json:"messageId" example:"6008"`          // 下发命令的消息ID
+	Command     string                     `json:"command" example:"0x81"`            // 命令码
+	Sync        bool                       `json:"sync" example:"true"`               // 是否同步等待了应答
+	ReplyData   string                     `json:"replyData,omitempty" example:"00"`  // 应答数据(十六进制)
+	ReplyLength int                        `json:"replyLength,omitempty" example:"1"` // 应答数据长度
+	ReplyFrame  string                     `json:"replyFrame,omitempty"`              // 完整应答帧(十六进制)
+	ElapsedMs   int64                      `json:"elapsedMs,omitempty" example:"320"` // 发送到收到应答的耗时(毫秒)
+	Decoded     *protocol.FrameDiagnostics `json:"decoded,omitempty"`                 // 应答帧解码结果
+}
+
+// DeviceParametersResponse 设备运行参数
+// @Description 设备最近上报的 0x90/0x91 运行参数
+type DeviceParametersResponse struct {
+	DeviceID   string                        `json:"deviceId" example:"04CEAA40"` // 标准设备ID
+	Parameters dny_protocol.DeviceParameters `json:"parameters"`                  // 运行参数（字段偏移见 dny_protocol）
+	AgeSeconds int64                         `json:"ageSeconds" example:"120"`    // 距最近一次上报的秒数
 }
 
 // ChargingStopRequest 停止充电请求
@@ -117,6 +143,8 @@ type ChargingStartParams struct {
 	Value    uint16 `json:"value" binding:"required" example:"60" minimum:"1" swaggertype:"integer" description:"充电值: 时间(秒)/电量(0.1度)"`
 	OrderNo  string `json:"orderNo" binding:"required" example:"ORDER_20250619001" swaggertype:"string" description:"订单号"`
 	Balance  uint32 `json:"balance" example:"1000" swaggertype:"integer" description:"余额(分)，可选"`
+	TenantID string `json:"tenantId" example:"tenant_a" swaggertype:"string" description:"租户ID，可选（用于促销范围匹配；设备未映射租户时用于匹配充电参数策略）"`
+	DryRun   bool   `json:"dryRun" example:"false" description:"试运行：完整校验并返回构造的0x82帧，不下发、不创建会话"`
 }
 
 // ChargingStopParams 停止充电请求参数
@@ -125,6 +153,7 @@ type ChargingStopParams struct {
 	DeviceID string `json:"deviceId" binding:"required" example:"04ceaa40" swaggertype:"string" description:"设备ID"`
 	Port     byte   `json:"port" example:"1" enum:"1,2,3,4,5,6,7,8,255" swaggertype:"integer" description:"端口号: 1-8或255(设备智能选择端口)"`
 	OrderNo  string `json:"orderNo" example:"ORDER_20250619001" swaggertype:"string" description:"订单号，可选"`
+	DryRun   bool   `json:"dryRun" example:"false" description:"试运行：完整校验并返回构造的0x82帧，不下发"`
 }
 
 // DeviceLocateRequest 设备定位请求参数
@@ -142,6 +171,8 @@ type UpdateChargingPowerParams struct {
 	OrderNo                  string `json:"orderNo" binding:"required" example:"ORDER_20250619001" swaggertype:"string" description:"订单号(需与进行中订单一致)"`
 	OverloadPowerW           uint16 `json:"overloadPowerW" binding:"required" example:"120" swaggertype:"integer" description:"过载功率(瓦)"`
 	MaxChargeDurationSeconds uint16 `json:"maxChargeDurationSeconds" example:"0" swaggertype:"integer" description:"最大充电时长(秒), 0表示不修改"`
+	TenantID                 string `json:"tenantId" example:"tenant_a" swaggertype:"string" description:"租户ID，可选（设备未映射租户时用于匹配充电参数策略）"`
+	DryRun                   bool   `json:"dryRun" example:"false" description:"试运行：完整校验并返回构造的0x82帧，不下发"`
 }
 
 // DeviceStatusURI 设备状态URI参数
@@ -153,8 +184,89 @@ type DeviceStatusURI struct {
 // DeviceListQuery 设备列表查询参数
 // @Description 设备列表查询参数绑定
 type DeviceListQuery struct {
-	Page  int `form:"page,default=1" binding:"min=1" example:"1"`
-	Limit int `form:"limit,default=50" binding:"min=1,max=200" example:"50"`
+	Page       int    `form:"page,default=1" binding:"min=1" example:"1"`
+	Limit      int    `form:"limit,default=50" binding:"min=1,max=200" example:"50"`
+	Virtual    string `form:"virtual" example:"expand"`       // expand: 已拆分设备展开为虚拟子设备；默认collapse
+	StationID  string `form:"stationId" example:"station_01"` // 按站点过滤
+	DeviceType uint16 `form:"deviceType" example:"0"`         // 按设备类型过滤，0表示不限
+}
+
+// matches 设备详情是否满足过滤条件
+func (q DeviceListQuery) matches(detail map[string]interface{}) bool {
+	if q.StationID != "" {
+		if stationID, _ := detail["stationId"].(string); stationID != q.StationID {
+			return false
+		}
+	}
+	if q.DeviceType != 0 {
+		if deviceType, _ := detail["deviceType"].(uint16); deviceType != q.DeviceType {
+			return false
+		}
+	}
+	return true
+}
+
+// DeviceTimelineQuery 设备时间线查询参数
+// @Description 设备时间线查询参数绑定
+type DeviceTimelineQuery struct {
+	From   int64  `form:"from" example:"1718755200"`          // 起始时间（Unix秒），0表示不限
+	To     int64  `form:"to" example:"0"`                     // 结束时间（Unix秒），0表示不限
+	Types  string `form:"types" example:"connection,command"` // 条目类型，逗号分隔：connection, registration, command, settlement, alarm, charging, notification
+	Cursor string `form:"cursor"`                             // 上一页返回的 nextCursor
+	Limit  int    `form:"limit,default=100" binding:"min=1,max=500" example:"100"`
+}
+
+// ChangeLogQuery 运维变更记录查询参数
+// @Description 运维变更记录查询参数绑定
+type ChangeLogQuery struct {
+	DeviceID string `form:"deviceId" example:"04A26CF3"`        // 目标设备
+	Key      string `form:"key" example:"ops-console"`          // 调用方API Key名称
+	Endpoint string `form:"endpoint" example:"/charging/start"` // 路由模板或请求路径包含该字符串
+	From     int64  `form:"from" example:"1718755200"`          // 起始时间（Unix秒），0表示不限
+	To       int64  `form:"to" example:"0"`                     // 结束时间（Unix秒），0表示不限
+	Limit    int    `form:"limit,default=200" binding:"min=1,max=5000" example:"200"`
+	Format   string `form:"format" example:"json"` // json 或 csv
+}
+
+// SessionArchiveQuery 连接会话归档查询参数
+// @Description 连接会话归档查询参数绑定
+type SessionArchiveQuery struct {
+	IP       string `form:"ip" example:"10.20.30.40"`             // 设备来源IP
+	ICCID    string `form:"iccid" example:"89860429162390043211"` // SIM卡ICCID
+	DeviceID string `form:"deviceId" example:"04A26CF3"`          // 会话中注册过的设备
+	From     int64  `form:"from" example:"1718755200"`            // 起始时间（Unix秒），与会话起止时间有交集即匹配，0表示不限
+	To       int64  `form:"to" example:"0"`                       // 结束时间（Unix秒），0表示不限
+	Page     int    `form:"page,default=1" binding:"min=1" example:"1"`
+	Limit    int    `form:"limit,default=100" binding:"min=1,max=1000" example:"100"`
+	Format   string `form:"format" example:"json"` // json 或 csv（csv 导出全部匹配记录，不分页）
+}
+
+// DeviceSearchQuery 设备模糊搜索参数
+type DeviceSearchQuery struct {
+	Q     string `form:"q" binding:"required" example:"6CF3"`                   // 查询串（至少4个字符），支持 "..."/"*" 通配与IP的x段，如 8986...8297、112.23.x.x
+	Limit int    `form:"limit,default=20" binding:"min=1,max=100" example:"20"` // 返回条数
+}
+
+// ConformanceViolationQuery 协议一致性违规查询参数
+// @Description 协议一致性违规查询参数绑定
+type ConformanceViolationQuery struct {
+	Limit int `form:"limit,default=100" binding:"min=1,max=1000" example:"100"`
+}
+
+// GarbageDataQuery 杂散数据诊断查询参数
+type GarbageDataQuery struct {
+	MinEvents int `form:"minEvents,default=2" binding:"min=1" example:"2"` // 杂散数据出现次数下限（超过预算的连接始终返回）
+}
+
+// HandlerPanicQuery 处理器panic隔离记录查询参数
+type HandlerPanicQuery struct {
+	Limit int    `form:"limit,default=50" binding:"min=1,max=1000" example:"50"`
+	ID    string `form:"id" example:"20261015-083000.000000-000001"` // 指定隔离记录ID时返回含堆栈的完整记录
+}
+
+// TakeoverParams 热备接管参数
+type TakeoverParams struct {
+	Rehearsal bool `json:"rehearsal" example:"true"` // 演练：不关闭设备连接，完成后恢复原状
 }
 
 // NotificationQuery 通知筛选查询参数（SSE与最近列表共用）
@@ -166,20 +278,416 @@ type NotificationQuery struct {
 	Port       string `form:"port" example:"1"`
 	Since      int64  `form:"since" example:"0"`
 	Limit      int    `form:"limit,default=100" example:"100"`
+	Cursor     uint64 `form:"cursor" example:"0"` // SSE回放游标：回放序号大于该值的事件（也可通过 Last-Event-ID 头传入）
 }
 
 // ChargingActionResponse 充电操作统一响应体
 // @Description 充电启动/停止/参数调整等操作返回
 type ChargingActionResponse struct {
-	DeviceID                 string `json:"deviceId"`
-	StandardID               string `json:"standardId"`
-	Port                     byte   `json:"port"`
-	OrderNo                  string `json:"orderNo,omitempty"`
-	Mode                     byte   `json:"mode,omitempty"`
-	Value                    uint16 `json:"value,omitempty"`
-	Balance                  uint32 `json:"balance,omitempty"`
-	OverloadPowerW           uint16 `json:"overloadPowerW,omitempty"`
-	MaxChargeDurationSeconds uint16 `json:"maxChargeDurationSeconds,omitempty"`
-	Action                   string `json:"action"`
-	Timestamp                int64  `json:"timestamp"`
+	DeviceID                 string                    `json:"deviceId"`
+	StandardID               string                    `json:"standardId"`
+	Port                     byte                      `json:"port"`
+	OrderNo                  string                    `json:"orderNo,omitempty"`
+	Mode                     byte                      `json:"mode,omitempty"`
+	Value                    uint16                    `json:"value,omitempty"`
+	Balance                  uint32                    `json:"balance,omitempty"`
+	OverloadPowerW           uint16                    `json:"overloadPowerW,omitempty"`
+	MaxChargeDurationSeconds uint16                    `json:"maxChargeDurationSeconds,omitempty"`
+	Action                   string                    `json:"action"`
+	State                    string                    `json:"state,omitempty"`          // 会话状态，如queued表示设备侧排队
+	Queue                    *gateway.QueuedCharge     `json:"queue,omitempty"`          // 排队信息（待充端口、排队时间、超时时间）
+	Promotion                *gateway.AppliedPromotion `json:"promotion,omitempty"`      // 生效的促销（计费参数已按促销覆盖）
+	PolicyWarnings           []chargepolicy.Violation  `json:"policyWarnings,omitempty"` // 接近充电参数策略上限的参数（已放行）
+	Timestamp                int64                     `json:"timestamp"`
+	CorrelationID            string                    `json:"correlationId,omitempty"`   // 链路追踪ID，与响应头X-Request-ID一致
+	VirtualDeviceID          string                    `json:"virtualDeviceId,omitempty"` // 按虚拟子设备寻址时的虚拟设备ID（deviceId/port 为转换后的物理设备与端口）
+	VirtualPort              int                       `json:"virtualPort,omitempty"`     // 虚拟端口
+	DryRun                   bool                      `json:"dryRun,omitempty"`          // 试运行：命令未下发、未创建会话
+	Checks                   []DryRunCheck             `json:"checks,omitempty"`          // 试运行已执行的检查及结果
+	Packet                   *gateway.CommandPreview   `json:"packet,omitempty"`          // 试运行构造的0x82帧（hex）
+}
+
+// AuditRuleParams 审计规则参数
+// @Description 单条审计规则：字段路径 + 运算符 + 期望值
+type AuditRuleParams struct {
+	Field    string `json:"field" binding:"required" example:"firmware_version"` // 字段路径
+	Operator string `json:"operator" binding:"required" example:"version_gte"`   // eq, ne, gt, gte, lt, lte, version_gte, version_lte, contains
+	Expected string `json:"expected" example:"1.2.0"`                            // 期望值
+}
+
+// AuditCreateParams 创建审计请求参数
+// @Description 创建设备合规审计
+type AuditCreateParams struct {
+	ID                    string            `json:"id" example:"weekly_firmware"`         // 审计ID，为空自动生成
+	Name                  string            `json:"name" example:"固件版本周检"`                // 审计名称
+	Rules                 []AuditRuleParams `json:"rules" binding:"required,min=1"`       // 审计规则（全部满足视为合规）
+	StaleThresholdMinutes int               `json:"staleThresholdMinutes" example:"1440"` // 数据过期阈值(分钟)
+	IntervalMinutes       int               `json:"intervalMinutes" example:"0"`          // 定时执行间隔(分钟)，0表示仅按需
+	RunNow                bool              `json:"runNow" example:"true"`                // 创建后立即执行
+}
+
+// AuditIDURI 审计ID路径参数
+type AuditIDURI struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+// AuditReportQuery 审计报告查询参数
+type AuditReportQuery struct {
+	Format string `form:"format" example:"json"` // json 或 csv
+}
+
+// PortEnergyURI 端口电量路径参数
+type PortEnergyURI struct {
+	DeviceID string `uri:"deviceId" binding:"required" example:"04A26CF3"`
+	Port     int    `uri:"port" binding:"required,min=1" example:"1"` // 业务端口(1-based)，虚拟子设备为虚拟端口
+}
+
+// AvailabilityQuery 端口可用率查询参数
+type AvailabilityQuery struct {
+	Month string `form:"month" example:"2026-09"` // 统计月份 YYYY-MM，默认当月
+}
+
+// EnergyReportQuery 端口电量报告查询参数
+type EnergyReportQuery struct {
+	ThresholdKWh float64 `form:"thresholdKWh" binding:"min=0" example:"5000"`               // 维护阈值(kWh)，0表示使用配置值
+	OverOnly     bool    `form:"overOnly" example:"false"`                                  // 只返回达到阈值的端口
+	Limit        int     `form:"limit,default=500" binding:"min=1,max=10000" example:"500"` // 返回条数
+}
+
+// CommLogExportQuery 通信日志导出查询参数
+type CommLogExportQuery struct {
+	Format string `form:"format,default=bin" binding:"oneof=bin jsonl" example:"bin"` // bin: 二进制抓包 | jsonl: 每行一帧的JSON
+}
+
+// AnomalyFleetQuery 全部设备异常事件查询参数
+type AnomalyFleetQuery struct {
+	State string `form:"state,default=open" binding:"oneof=open all" example:"open"` // open: 只返回有进行中事件的设备 | all: 含仅有已恢复事件的设备
+	Limit int    `form:"limit,default=100" binding:"min=1,max=10000" example:"100"`  // 返回设备数
+}
+
+// ResponseShapingParams 响应塑形规则参数
+// @Description 按预设名称启用或直接定义规则；规则到期自动失效
+type ResponseShapingParams struct {
+	Preset     string `json:"preset" example:"slow-charging"` // 配置中的预设规则名称，route/apiKey/methods 可覆盖预设
+	TTLSeconds int    `json:"ttlSeconds" example:"600"`       // 有效期(秒)，0表示默认有效期
+	shaping.RuleSpec
+}
+
+// ReconcileRunQuery 按需对账参数
+type ReconcileRunQuery struct {
+	Date string `form:"date" example:"2026-10-13"` // 对账日期 YYYY-MM-DD，默认前一天
+}
+
+// SettlementQuery 结算查询参数
+// @Description 结算查询参数绑定
+type SettlementQuery struct {
+	DeviceID string `form:"deviceId" example:"04A26CF3"` // 设备ID，为空时查询全部设备
+	From     int64  `form:"from" example:"1718755200"`   // 接收时间起（Unix秒），0表示不限
+	To       int64  `form:"to" example:"0"`              // 接收时间止（Unix秒，不含），0表示不限
+	AfterSeq uint64 `form:"afterSeq" example:"0"`        // 翻页游标：上一页返回的 nextAfterSeq
+	Limit    int    `form:"limit,default=100" binding:"min=1,max=1000" example:"100"`
+}
+
+// SettlementOrderURI 结算订单号路径参数
+type SettlementOrderURI struct {
+	OrderNo string `uri:"orderNo" binding:"required" example:"ORD20261014001"`
+}
+
+// ReconcileDateURI 对账报告日期路径参数
+type ReconcileDateURI struct {
+	Date string `uri:"date" binding:"required" example:"2026-10-13"`
+}
+
+// ReconcileReportQuery 对账报告查询参数
+type ReconcileReportQuery struct {
+	Format string `form:"format" example:"json"` // json 或 csv
+}
+
+// ParseFrameParams 帧解析请求参数
+// @Description 离线解析一帧DNY协议数据，不影响任何设备状态
+type ParseFrameParams struct {
+	Hex       string `json:"hex" binding:"required" example:"444E590A00F36CA2040100960A9B03"` // 十六进制帧数据，允许空格/冒号/0x分隔
+	Direction string `json:"direction" example:"uplink"`                                      // uplink(设备→服务器) 或 downlink(服务器→设备)，为空时按上行解析
+}
+
+// NotificationSummary 通知投递汇总（近1小时）
+// @Description 通知服务未启用时 enabled=false，其余字段为0
+type NotificationSummary struct {
+	Enabled     bool    `json:"enabled" example:"true"`       // 通知服务是否启用
+	Sent        int64   `json:"sent" example:"120"`           // 近1小时投递次数
+	Success     int64   `json:"success" example:"118"`        // 近1小时投递成功次数
+	SuccessRate float64 `json:"success_rate" example:"98.33"` // 近1小时成功率(%)，无投递时为100
+	QueueLength int     `json:"queue_length" example:"0"`     // 当前待投递事件数
+}
+
+// SummaryResponse 仪表盘汇总响应
+// @Description 首页仪表盘一次性汇总数据，字段保持稳定
+type SummaryResponse struct {
+	gateway.FleetSummary
+	Notifications NotificationSummary `json:"notifications"` // 通知投递汇总
+}
+
+// DeviceRebootParams 设备远程重启参数（支持query或JSON body）
+// @Description 存在进行中的充电会话时需 force=true 才会重启
+type DeviceRebootParams struct {
+	Force bool `json:"force" form:"force" example:"false"` // 强制重启：先停止进行中的会话并标记为 interrupted_by_reboot
+	Wait  int  `json:"wait" form:"wait" example:"30"`      // 长轮询等待设备重新注册的秒数，0表示不等待，最大60
+	DeferredDeliveryParams
+}
+
+// DeferredDeliveryParams 延迟下发参数（支持延迟下发的接口共用）
+// @Description deliverWhen=online 且设备离线时暂存命令并返回202，设备下次注册后按序下发
+type DeferredDeliveryParams struct {
+	DeliverWhen string `json:"deliverWhen" form:"deliverWhen" example:"online"`                       // online：设备离线时暂存，上线后下发
+	TTLSeconds  int    `json:"ttlSeconds" form:"ttlSeconds" example:"86400"`                          // 暂存有效期(秒)，0使用默认值，过期以 expired 结束
+	CallbackURL string `json:"callbackUrl" form:"callbackUrl" example:"https://ops.example.com/hook"` // 命令结束后POST结果的地址
+	Originator  string `json:"originator" form:"originator" example:"ops-console"`                    // 发起方标识，为空时记录来源地址
+}
+
+// MacroRunParams 设备宏参数（支持query或JSON body）
+type MacroRunParams struct {
+	Port int `json:"port" form:"port" example:"1"` // 端口号(1-based)，端口级宏必填
+	Wait int `json:"wait" form:"wait" example:"0"` // 长轮询等待执行结束的秒数，0表示不等待，最大60
+}
+
+// GroupBroadcastParams 设备组广播参数
+type GroupBroadcastParams struct {
+	Type          string `json:"type" binding:"required" example:"time-sync"` // 广播类型：time-sync | power-params（rate-push 协议不支持）
+	MaxChargeTime int    `json:"maxChargeTime" example:"36000"`               // power-params：最大充电时长(秒)
+	OverloadPower int    `json:"overloadPower" example:"2200"`                // power-params：过载功率(W)
+	Wait          int    `json:"wait" example:"0"`                            // 长轮询等待广播结束的秒数，0表示不等待，最大60
+}
+
+// DeviceRebootResponse 设备远程重启响应
+type DeviceRebootResponse struct {
+	gateway.RebootRecord
+	CameBack bool `json:"came_back" example:"true"` // 设备是否已在窗口内重新注册
+}
+
+// DeviceDecommissionRequest 设备停用/重新启用请求
+type DeviceDecommissionRequest struct {
+	Reason   string `json:"reason" binding:"required" example:"设备报废"`        // 停用（或重新启用）原因
+	Operator string `json:"operator" binding:"required" example:"ops-zhang"` // 操作人
+}
+
+// ArchivedDevicesQuery 停用归档查询参数
+type ArchivedDevicesQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=decommissioned recommissioned" example:"decommissioned"` // 为空返回全部
+}
+
+// VirtualPortMappingParams 虚拟子设备显式端口映射
+type VirtualPortMappingParams struct {
+	Suffix string `json:"suffix" example:"P01"` // 虚拟ID后缀，为空按序号生成 P01/P02...
+	Ports  []int  `json:"ports" example:"1,2"`  // 物理端口(1-based)
+}
+
+// VirtualSplitParams 虚拟子设备拆分参数
+// @Description 按 portsPerVirtual+totalPorts 均分，或按 mapping 显式指定（二选一）
+type VirtualSplitParams struct {
+	PortsPerVirtual int                        `json:"portsPerVirtual" example:"1"` // 每个虚拟设备的端口数
+	TotalPorts      int                        `json:"totalPorts" example:"12"`     // 物理设备总端口数
+	Mapping         []VirtualPortMappingParams `json:"mapping"`                     // 显式映射
+}
+
+// SIMPairParams 双卡设备SIM卡对
+type SIMPairParams struct {
+	PrimaryICCID   string `json:"primaryIccid" binding:"required" example:"89860404192080617692"`   // 主卡ICCID
+	SecondaryICCID string `json:"secondaryIccid" binding:"required" example:"89860404192080617693"` // 副卡ICCID
+}
+
+// HookCommandRequest 入站webhook命令
+// @Description 第三方平台推送的命令，params 与对应API的请求体一致
+type HookCommandRequest struct {
+	Type   string          `json:"type" binding:"required" example:"charge_start" enums:"charge_start,charge_stop,locate,param_set" description:"命令类型"`
+	Params json.RawMessage `json:"params" binding:"required" swaggertype:"object" description:"命令参数：charge_start/charge_stop/param_set 同 /charging/start、/charging/stop、/charging/update_power，locate 同 /device/locate"`
+}
+
+// ProblemDetails RFC 7807 problem+json 错误响应
+// @Description 标准问题详情错误响应（Content-Type: application/problem+json）
+type ProblemDetails struct {
+	Type     string `json:"type" example:"about:blank"`
+	Title    string `json:"title" example:"签名校验失败"`
+	Status   int    `json:"status" example:"401"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty" example:"/api/v1/hooks/commands"`
+	// 扩展成员
+	RequestID string      `json:"requestId,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
+}
+
+// DeviceConfigVerifyParams 设备配置核对参数
+// @Description 与服务器端黄金模板逐字段核对；无缓存或 refresh=true 时先读取设备配置
+type DeviceConfigVerifyParams struct {
+	Template string `json:"template" binding:"required" example:"station-default"` // 模板名称
+	Version  int    `json:"version" example:"0"`                                   // 模板版本，0表示最新版本
+	Refresh  bool   `json:"refresh" example:"false"`                               // 忽略缓存，重新读取设备配置
+	DeferredDeliveryParams
+}
+
+// ConfigTemplateParams 黄金配置模板创建/更新参数
+// @Description sections 为 分段 → 字段 → 期望值，仅列出需要核对的字段
+type ConfigTemplateParams struct {
+	Name        string                            `json:"name" example:"station-default"` // 模板名称（创建时必填，更新时以路径为准）
+	Description string                            `json:"description" example:"新站点标准配置"`
+	Sections    map[string]map[string]interface{} `json:"sections" binding:"required" swaggertype:"object"`
+}
+
+// HeartbeatTuningParams 自适应心跳开关参数
+// @Description 字段为空表示保持不变
+type HeartbeatTuningParams struct {
+	Enabled *bool `json:"enabled" example:"false"` // 全局开关
+	DryRun  *bool `json:"dry_run" example:"true"`  // 演练模式：仅报告拟调整，不下发
+}
+
+// NotificationRouteDryRunParams 通知路由模拟参数
+// @Description 样例事件；tenant_id/device_type 为空时按 device_id 从资产映射与在线设备信息补全
+type NotificationRouteDryRunParams struct {
+	EventType  string `json:"event_type" binding:"required" example:"charging_start"` // 事件类型
+	DeviceID   string `json:"device_id" example:"04A26CF3"`                           // 设备ID
+	PortNumber int    `json:"port_number" example:"1"`                                // 端口号(1-based)
+	TenantID   string `json:"tenant_id" example:"operator-a"`                         // 租户（运营商）
+	DeviceType string `json:"device_type" example:"4"`                                // 设备类型码（十进制）
+}
+
+// DeviceOwnerResponse 设备归属实例
+// @Description 持有设备TCP连接的网关实例；未启用集群模式时恒为本实例
+type DeviceOwnerResponse struct {
+	DeviceID       string        `json:"deviceId" example:"04A26CF3"`
+	Owner          cluster.Owner `json:"owner"`
+	ClusterEnabled bool          `json:"clusterEnabled" example:"true"`
+}
+
+// SessionLimitParams 设备并发充电会话上限参数
+// @Description maxConcurrent=0 表示该设备不限制（覆盖全局默认）；reducedPowerSlots 与 reducedPowerW 需同时配置，仅在智能降功率启用时生效
+type SessionLimitParams struct {
+	MaxConcurrent     int    `json:"maxConcurrent" binding:"min=0" example:"3"`     // 同时充电（含待启动/排队）的端口数上限
+	ReducedPowerSlots int    `json:"reducedPowerSlots" binding:"min=0" example:"1"` // 达到上限后仍可降功率接入的会话数
+	ReducedPowerW     int    `json:"reducedPowerW" binding:"min=0" example:"800"`   // 降功率接入会话的过载功率(瓦)
+	Reason            string `json:"reason" example:"机柜供电容量只允许3路同时充电"`              // 配置原因
+}
+
+// PowerProfileParams 站点功率时段参数
+// @Description 时段按本地时间 HH:MM 定义，结束早于开始表示跨零点；不在任何时段内时以 capacityW 为预算
+type PowerProfileParams struct {
+	Name      string                `json:"name" example:"峰谷电价"`                                // 名称
+	CapacityW int                   `json:"capacityW" binding:"required,min=1" example:"20000"` // 站点供电容量(瓦)
+	Windows   []gateway.PowerWindow `json:"windows"`                                            // 时段（按顺序匹配，重叠时取第一个）
+}
+
+// PowerOverrideParams 站点功率人工覆盖参数
+type PowerOverrideParams struct {
+	BudgetW         int    `json:"budgetW" binding:"required,min=1" example:"8000"`       // 覆盖期间的站点预算(瓦)
+	DurationMinutes int    `json:"durationMinutes" binding:"required,min=1" example:"60"` // 有效时长(分钟)，到期后恢复按时段
+	Reason          string `json:"reason" example:"变压器检修"`                                // 覆盖原因
+}
+
+// CapabilityOverrideParams 单设备能力例外参数
+// @Description 命令码为16进制（0x8A 或 8A）；deny 优先于 allow 与能力矩阵
+type CapabilityOverrideParams struct {
+	Allow  []string `json:"allow" example:"0x8A"`           // 额外支持的命令
+	Deny   []string `json:"deny" example:"0x90"`            // 不支持的命令
+	Reason string   `json:"reason" example:"现场已升级，版本号上报有误"` // 例外原因
+}
+
+// CapabilityOverrideResponse 单设备能力例外设置结果
+// @Description capabilities 为叠加例外后设备当前的能力集，设备不在线时为 null
+type CapabilityOverrideResponse struct {
+	Override     capability.Override `json:"override"`
+	Capabilities *capability.Set     `json:"capabilities"`
+}
+
+// ConnectionURI 连接ID路径参数
+type ConnectionURI struct {
+	ConnID uint64 `uri:"connId" binding:"required" example:"12"`
+}
+
+// DialectBindParams 连接协议方言指定参数
+type DialectBindParams struct {
+	Dialect string `json:"dialect" binding:"required" example:"vendor_b"` // ap3000 | vendor_b
+}
+
+// ReplayApproveParams 停机积压重放批准参数
+type ReplayApproveParams struct {
+	Categories    []string `json:"categories,omitempty" example:"notification_spool"` // 为空时批准全部待审批类别
+	RatePerSecond float64  `json:"ratePerSecond,omitempty" example:"2"`               // 重放速率(条/秒)，未指定时使用默认速率
+}
+
+// DialectStatus 协议方言与各连接的绑定
+type DialectStatus struct {
+	Listener    string            `json:"listener"` // 监听器固定的方言，空表示按注册帧特征识别
+	Dialects    []dialect.Dialect `json:"dialects"`
+	Connections []dialect.Binding `json:"connections"`
+}
+
+// PayloadCryptoStatus 数据域加密状态
+type PayloadCryptoStatus struct {
+	Stats payloadcrypto.Stats  `json:"stats"`
+	Links []payloadcrypto.Link `json:"links"` // 注册帧声明了密钥ID的连接
+}
+
+// ChargingStatsQuery 充电统计看板查询参数
+// @Description 充电统计看板查询参数绑定
+type ChargingStatsQuery struct {
+	From   int64  `form:"from" example:"1718755200"`                                   // 起始时间（Unix秒），所在时间桶为第一个桶；0 表示小时桶最近24小时、天桶最近30天
+	To     int64  `form:"to" example:"0"`                                              // 结束时间（Unix秒，不含），0 或晚于当前时间时截止到当前时间所在的桶
+	Bucket string `form:"bucket,default=hour" binding:"oneof=hour day" example:"hour"` // 时间桶宽度：hour 或 day
+	Tenant string `form:"tenant" example:"tenant_a"`                                   // 租户ID，为空表示全部租户（携带租户范围请求头时默认为该租户）
+}
+
+// TraceSamplingParams 协议会话抽样参数
+// @Description 字段为空表示保持不变；名单传空数组表示清空
+type TraceSamplingParams struct {
+	Rate           *float64  `json:"rate" example:"0.01"`                        // 新连接抽样比例 [0,1]
+	WatchDeviceIDs *[]string `json:"watchDeviceIds" example:"04A228CD"`          // 关注设备ID（整体替换）
+	WatchICCIDs    *[]string `json:"watchIccids" example:"89860404D91623904882"` // 关注ICCID（整体替换）
+}
+
+// DeviceGroupURI 设备组路径参数
+type DeviceGroupURI struct {
+	ICCID string `uri:"iccid" binding:"required" example:"89860404D91623904882"`
+}
+
+// DeviceGroupListQuery 设备组列表查询参数
+type DeviceGroupListQuery struct {
+	MinDevices int `form:"minDevices" binding:"min=0" example:"2"` // 只返回设备数不少于该值的组
+}
+
+// DeviceGroupMember 设备组成员设备
+type DeviceGroupMember struct {
+	DeviceID       string    `json:"deviceId" example:"04A228CD"`
+	PhysicalID     string    `json:"physicalId" example:"04A228CD"`
+	Status         string    `json:"status" example:"online"`
+	State          string    `json:"state" example:"online"`
+	RegisteredAt   time.Time `json:"registeredAt"`
+	LastActivity   time.Time `json:"lastActivity"`
+	LastHeartbeat  time.Time `json:"lastHeartbeat"`
+	HeartbeatCount int64     `json:"heartbeatCount" example:"12"`
+}
+
+// DeviceGroupView 设备组详情
+type DeviceGroupView struct {
+	ICCID         string              `json:"iccid" example:"89860404D91623904882"`
+	ConnID        uint64              `json:"connId" example:"12"`
+	RemoteAddr    string              `json:"remoteAddr" example:"10.0.0.1:52011"` // 连接已清理时为空
+	PrimaryDevice string              `json:"primaryDevice" example:"04A228CD"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	LastActivity  time.Time           `json:"lastActivity"`
+	DeviceCount   int                 `json:"deviceCount" example:"2"`
+	Devices       []DeviceGroupMember `json:"devices"`
+}
+
+// DeviceGroupSummary 设备组列表项
+type DeviceGroupSummary struct {
+	ICCID         string    `json:"iccid" example:"89860404D91623904882"`
+	ConnID        uint64    `json:"connId" example:"12"`
+	RemoteAddr    string    `json:"remoteAddr" example:"10.0.0.1:52011"`
+	PrimaryDevice string    `json:"primaryDevice" example:"04A228CD"`
+	DeviceCount   int       `json:"deviceCount" example:"2"`
+	LastActivity  time.Time `json:"lastActivity"`
+}
+
+// DeviceGroupList 设备组列表
+type DeviceGroupList struct {
+	Groups []DeviceGroupSummary `json:"groups"`
+	Total  int                  `json:"total" example:"1"`
 }
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/bujia-iot/iot-zinx/pkg/events"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
 	"github.com/gin-gonic/gin"
 )
@@ -15,7 +16,20 @@ type NotificationHandlers struct{}
 
 func NewNotificationHandlers() *NotificationHandlers { return &NotificationHandlers{} }
 
-// HandleNotificationStream SSE推送流
+// HandleNotificationStream SSE推送流（每条事件带 id，断线重连时按 Last-Event-ID 回放错过的事件）
+// @Summary 通知事件SSE推送流
+// @Description text/event-stream 推送实时通知事件，每条事件带 id（事件总线序号）；携带 cursor 或 Last-Event-ID 时回放其后的事件，否则先补发最近50条
+// @Tags notification
+// @Produce text/event-stream
+// @Param event_types query string false "事件类型，逗号分隔"
+// @Param device_id query string false "设备ID"
+// @Param orderNo query string false "订单号"
+// @Param port query string false "端口号"
+// @Param since query int false "起始时间（Unix秒）"
+// @Param cursor query int false "回放游标：回放序号大于该值的事件"
+// @Param Last-Event-ID header string false "断线重连时的最后事件ID（优先于cursor）"
+// @Success 200 {string} string "事件流（data 为 notification.NotificationEventDTO）"
+// @Router /api/v1/notifications/stream [get]
 func (h *NotificationHandlers) HandleNotificationStream(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
@@ -42,39 +56,45 @@ func (h *NotificationHandlers) HandleNotificationStream(c *gin.Context) {
 		}
 	}
 
-	_, ch, cancel := notification.GetGlobalRecorder().Subscribe(200)
-	defer cancel()
-
-	// 补发最近
-	recent := notification.GetGlobalRecorder().RecentFiltered(50, f)
-	for _, ev := range recent {
-		dto := notification.ToDTO(ev)
-		b, _ := json.Marshal(dto)
-		_, _ = c.Writer.Write([]byte("data: "))
-		_, _ = c.Writer.Write(b)
-		_, _ = c.Writer.Write([]byte("\n\n"))
-		c.Writer.Flush()
+	// 订阅事件总线：携带游标（Last-Event-ID 或 cursor）时回放错过的事件，否则补发最近50条
+	opts := events.SubscribeOptions{
+		Name:   "sse:" + c.ClientIP(),
+		Buffer: 200,
+		Filter: func(ev events.Event) bool {
+			payload, ok := ev.Payload.(*notification.NotificationEvent)
+			return ok && notification.GetGlobalRecorder().Matches(payload, f)
+		},
+		Replay:      true,
+		ReplayLimit: 50,
+	}
+	cursor := q.Cursor
+	if lastID := strings.TrimSpace(c.GetHeader("Last-Event-ID")); lastID != "" {
+		if v, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+			cursor = v
+		}
+	}
+	if cursor > 0 {
+		opts.After = cursor
+		opts.ReplayLimit = 0
 	}
+	sub := events.GetGlobalBus().Subscribe(opts)
+	defer sub.Close()
 
-	// 实时推送
 	notify := c.Writer.CloseNotify()
 	for {
-		select {
-		case <-notify:
-			return
-		case ev, ok := <-ch:
-			if !ok {
-				return
-			}
-			if !notification.GetGlobalRecorder().Matches(ev, f) {
-				continue
-			}
-			dto := notification.ToDTO(ev)
+		for ev, ok := sub.TryNext(); ok; ev, ok = sub.TryNext() {
+			dto := notification.ToDTO(ev.Payload.(*notification.NotificationEvent))
 			b, _ := json.Marshal(dto)
+			_, _ = c.Writer.Write([]byte("id: " + strconv.FormatUint(ev.Seq, 10) + "\n"))
 			_, _ = c.Writer.Write([]byte("data: "))
 			_, _ = c.Writer.Write(b)
 			_, _ = c.Writer.Write([]byte("\n\n"))
 			c.Writer.Flush()
+		}
+		select {
+		case <-notify:
+			return
+		case <-sub.Ready():
 		case <-c.Request.Context().Done():
 			return
 		}
@@ -82,6 +102,18 @@ func (h *NotificationHandlers) HandleNotificationStream(c *gin.Context) {
 }
 
 // HandleNotificationRecent 最近事件
+// @Summary 最近通知事件
+// @Description 内存记录器中最近的通知事件（旧→新，取最近 limit 条），筛选参数与SSE推送流相同
+// @Tags notification
+// @Produce json
+// @Param event_types query string false "事件类型，逗号分隔"
+// @Param device_id query string false "设备ID"
+// @Param orderNo query string false "订单号"
+// @Param port query string false "端口号"
+// @Param since query int false "起始时间（Unix秒）"
+// @Param limit query int false "返回条数" default(100)
+// @Success 200 {object} APIResponse{data=[]notification.NotificationEventDTO} "查询成功"
+// @Router /api/v1/notifications/recent [get]
 func (h *NotificationHandlers) HandleNotificationRecent(c *gin.Context) {
 	var q NotificationQuery
 	_ = c.ShouldBindQuery(&q)
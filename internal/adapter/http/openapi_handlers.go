@@ -0,0 +1,19 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/docs"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleOpenAPISpec 机器可读的API规范
+// @Summary OpenAPI规范
+// @Description 由路由处理器注解生成的OpenAPI(Swagger 2.0)规范，包含鉴权方式、problem+json错误结构与分页参数；Swagger UI（/swagger/index.html）加载同一份规范
+// @Tags system
+// @Produce json
+// @Success 200 {object} object "Swagger 2.0 文档"
+// @Router /api/v1/openapi.json [get]
+func (h *ToolHandlers) HandleOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", docs.OpenAPISpec)
+}
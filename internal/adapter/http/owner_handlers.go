@@ -0,0 +1,82 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HeaderGatewayInstance 响应头：处理本次请求的网关实例ID
+	HeaderGatewayInstance = "X-Gateway-Instance"
+	// HeaderGatewayOwner 响应头：设备归属其他实例时的归属实例ID
+	HeaderGatewayOwner = "X-Gateway-Owner"
+
+	// ErrorCodeDeviceNotFound 设备不在本实例时响应中的错误码
+	ErrorCodeDeviceNotFound = "DEVICE_NOT_FOUND"
+)
+
+// InstanceMiddleware 在响应头中标注处理请求的网关实例，供共享API域名后的调用方做会话亲和
+func InstanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(HeaderGatewayInstance, cluster.GetGlobalOwnership().Self().InstanceID)
+		c.Next()
+	}
+}
+
+// respondRemoteOwner 设备未连接到本实例但归属其他实例时返回421及重定向提示；
+// 未启用集群模式或无实例登记时返回false，由调用方按原逻辑返回404
+func respondRemoteOwner(c *gin.Context, standardDeviceID string) bool {
+	owner, ok := cluster.GetGlobalOwnership().LookupRemote(standardDeviceID)
+	if !ok {
+		return false
+	}
+	data := gin.H{
+		"deviceId":  standardDeviceID,
+		"errorCode": ErrorCodeDeviceNotFound,
+		"owner":     owner,
+	}
+	if owner.APIBaseURL != "" {
+		data["redirect"] = strings.TrimRight(owner.APIBaseURL, "/") + c.Request.URL.RequestURI()
+	}
+	c.Header(HeaderGatewayOwner, owner.InstanceID)
+	c.JSON(http.StatusMisdirectedRequest, APIResponse{Code: 421, Message: "设备连接在其他网关实例", Data: data})
+	return true
+}
+
+// HandleDeviceOwner 查询设备归属实例
+// @Summary 查询设备归属实例
+// @Description 返回持有设备TCP连接的网关实例（实例ID与API基础地址），供API网关路由；未启用集群模式时恒为本实例
+// @Tags device
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse{data=DeviceOwnerResponse}
+// @Failure 404 {object} APIResponse
+// @Router /api/v1/device/{deviceId}/owner [get]
+func (h *DeviceHandlers) HandleDeviceOwner(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	ownership := cluster.GetGlobalOwnership()
+	owner, found := ownership.Lookup(standardDeviceID)
+	if !found {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "没有网关实例持有该设备连接", Data: gin.H{
+			"deviceId":  standardDeviceID,
+			"errorCode": ErrorCodeDeviceNotFound,
+		}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: DeviceOwnerResponse{
+		DeviceID:       standardDeviceID,
+		Owner:          owner,
+		ClusterEnabled: ownership.Enabled(),
+	}})
+}
+
+// selfOwner 本实例归属信息（设备详情与列表项附带）
+func selfOwner() cluster.Owner {
+	return cluster.GetGlobalOwnership().Self()
+}
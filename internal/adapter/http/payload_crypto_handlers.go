@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
+	"github.com/gin-gonic/gin"
+)
+
+// HandlePayloadCrypto 数据域加密状态
+// @Summary 数据域加密状态
+// @Description 注册帧声明了密钥ID的加密连接（密钥ID、设备、当前使用的密钥代次、加解密帧数与失败次数），以及按原因统计的解密失败计数（unknown_key/key_store/too_short/auth_failed/encrypt）
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=PayloadCryptoStatus} "查询成功"
+// @Failure 503 {object} APIResponse "未启用数据域加密"
+// @Router /api/v1/admin/payload-crypto [get]
+func (h *AdminHandlers) HandlePayloadCrypto(c *gin.Context) {
+	m := payloadcrypto.GetGlobalManager()
+	if m == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用数据域加密"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: PayloadCryptoStatus{
+		Stats: m.Stats(),
+		Links: m.Links(),
+	}})
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleStationPowerProfile 站点功率时段与当前预算
+// @Summary 站点功率时段与当前预算
+// @Description 返回站点的时段定义、当前命中的时段或人工覆盖、目标预算、已输入智能降功率控制器的预算（爬坡中与目标不同）及各端口分配的上限
+// @Tags station
+// @Produce json
+// @Param stationId path string true "站点ID"
+// @Success 200 {object} APIResponse{data=gateway.StationPowerStatus} "获取成功"
+// @Failure 404 {object} APIResponse "站点未配置功率时段"
+// @Router /api/v1/stations/{stationId}/power-profile [get]
+func (h *StationHandlers) HandleStationPowerProfile(c *gin.Context) {
+	status, ok := h.deviceGateway.GetPowerProfiles().Status(c.Param("stationId"), time.Now())
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: gateway.ErrPowerProfileNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: status})
+}
+
+// HandleSetStationPowerProfile 设置站点功率时段
+// @Summary 设置站点功率时段
+// @Description 整体替换站点的时段定义并持久化；立即评估，预算按配置的步长与间隔向新目标爬坡，并在站点进行中的会话间重新分配端口上限
+// @Tags station
+// @Accept json
+// @Produce json
+// @Param stationId path string true "站点ID"
+// @Param request body PowerProfileParams true "时段定义"
+// @Success 200 {object} APIResponse{data=gateway.StationPowerStatus} "设置成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 500 {object} APIResponse "持久化失败"
+// @Router /api/v1/stations/{stationId}/power-profile [put]
+func (h *StationHandlers) HandleSetStationPowerProfile(c *gin.Context) {
+	var params PowerProfileParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	profile := gateway.PowerProfile{StationID: c.Param("stationId"), Name: params.Name, CapacityW: params.CapacityW, Windows: params.Windows}
+	if err := gateway.ValidatePowerProfile(profile); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+	scheduler := h.deviceGateway.GetPowerProfiles()
+	if _, err := scheduler.SetProfile(profile); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "持久化失败: " + err.Error()})
+		return
+	}
+	status, _ := scheduler.Status(profile.StationID, time.Now())
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: status})
+}
+
+// HandleDeleteStationPowerProfile 删除站点功率时段
+// @Summary 删除站点功率时段
+// @Description 删除时段定义与人工覆盖，站点不再受预算约束；已下发的端口上限保持到会话结束
+// @Tags station
+// @Produce json
+// @Param stationId path string true "站点ID"
+// @Success 200 {object} APIResponse "删除成功"
+// @Failure 404 {object} APIResponse "站点未配置功率时段"
+// @Failure 500 {object} APIResponse "持久化失败"
+// @Router /api/v1/stations/{stationId}/power-profile [delete]
+func (h *StationHandlers) HandleDeleteStationPowerProfile(c *gin.Context) {
+	stationID := c.Param("stationId")
+	if err := h.deviceGateway.GetPowerProfiles().DeleteProfile(stationID); err != nil {
+		writePowerProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"stationId": stationID}})
+}
+
+// HandleSetStationPowerOverride 设置站点功率人工覆盖
+// @Summary 设置站点功率人工覆盖
+// @Description 有效期内覆盖优先于时段定义（站点需已配置时段），切换同样按步长爬坡；到期后自动恢复按时段
+// @Tags station
+// @Accept json
+// @Produce json
+// @Param stationId path string true "站点ID"
+// @Param request body PowerOverrideParams true "覆盖参数"
+// @Success 200 {object} APIResponse{data=gateway.StationPowerStatus} "设置成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 404 {object} APIResponse "站点未配置功率时段"
+// @Failure 500 {object} APIResponse "持久化失败"
+// @Router /api/v1/stations/{stationId}/power-override [put]
+func (h *StationHandlers) HandleSetStationPowerOverride(c *gin.Context) {
+	var params PowerOverrideParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	stationID := c.Param("stationId")
+	scheduler := h.deviceGateway.GetPowerProfiles()
+	override := gateway.PowerOverride{
+		StationID: stationID,
+		BudgetW:   params.BudgetW,
+		Reason:    params.Reason,
+		ExpiresAt: time.Now().Add(time.Duration(params.DurationMinutes) * time.Minute),
+	}
+	if err := gateway.ValidatePowerOverride(override, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+	if _, err := scheduler.SetOverride(override); err != nil {
+		writePowerProfileError(c, err)
+		return
+	}
+	status, _ := scheduler.Status(stationID, time.Now())
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: status})
+}
+
+// HandleDeleteStationPowerOverride 结束站点功率人工覆盖
+// @Summary 结束站点功率人工覆盖
+// @Description 提前结束人工覆盖，预算按步长爬坡回到当前时段的目标
+// @Tags station
+// @Produce json
+// @Param stationId path string true "站点ID"
+// @Success 200 {object} APIResponse{data=gateway.StationPowerStatus} "已结束"
+// @Failure 404 {object} APIResponse "站点没有生效的人工覆盖"
+// @Failure 500 {object} APIResponse "持久化失败"
+// @Router /api/v1/stations/{stationId}/power-override [delete]
+func (h *StationHandlers) HandleDeleteStationPowerOverride(c *gin.Context) {
+	stationID := c.Param("stationId")
+	scheduler := h.deviceGateway.GetPowerProfiles()
+	if err := scheduler.ClearOverride(stationID); err != nil {
+		writePowerProfileError(c, err)
+		return
+	}
+	status, _ := scheduler.Status(stationID, time.Now())
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: status})
+}
+
+// writePowerProfileError 时段/覆盖不存在返回404，其余为持久化失败
+func writePowerProfileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gateway.ErrPowerProfileNotFound), errors.Is(err, gateway.ErrPowerOverrideNotFound):
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: err.Error()})
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/gin-gonic/gin"
+)
+
+// ReconcileHandlers 日终对账 HTTP 处理器
+type ReconcileHandlers struct{}
+
+// NewReconcileHandlers 创建对账处理器
+func NewReconcileHandlers() *ReconcileHandlers { return &ReconcileHandlers{} }
+
+// HandleRunReconcile 按需执行对账
+// @Summary 按需执行日终对账
+// @Description 将指定日期开始的充电会话与收到的结算按订单号匹配（次日零点后宽限期内到达的结算计入当日），生成并保存报告
+// @Tags system
+// @Produce json
+// @Param date query string false "对账日期 YYYY-MM-DD，默认前一天"
+// @Success 200 {object} APIResponse{data=reconcile.Report} "对账完成"
+// @Failure 400 {object} APIResponse "日期错误"
+// @Failure 409 {object} APIResponse "该日期正在对账"
+// @Router /api/v1/admin/reconcile [post]
+func (h *ReconcileHandlers) HandleRunReconcile(c *gin.Context) {
+	var q ReconcileRunQuery
+	_ = c.ShouldBindQuery(&q)
+
+	day := time.Now().AddDate(0, 0, -1)
+	if q.Date != "" {
+		parsed, err := reconcile.ParseDate(q.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+			return
+		}
+		day = parsed
+	}
+
+	report, err := reconcile.GetGlobalReconciler().Run(day, reconcile.TriggerManual)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, reconcile.ErrRunInProgress) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, APIResponse{Code: status, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "对账完成", Data: report})
+}
+
+// HandleListReconcileReports 列出保留的对账报告
+// @Summary 列出日终对账报告
+// @Description 返回保留期内各日期报告的摘要（匹配数、缺失结算数、无会话结算数、电量与费用合计）
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "获取成功"
+// @Router /api/v1/admin/reconcile/reports [get]
+func (h *ReconcileHandlers) HandleListReconcileReports(c *gin.Context) {
+	reports := reconcile.GetGlobalReconciler().ListReports()
+	summaries := make([]map[string]interface{}, 0, len(reports))
+	for _, r := range reports {
+		summaries = append(summaries, r.Summary())
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{"reports": summaries, "total": len(summaries)}})
+}
+
+// HandleReconcileReport 获取对账报告
+// @Summary 获取日终对账报告
+// @Description 返回指定日期报告明细，format=csv 时导出CSV（每个会话/结算一行）
+// @Tags system
+// @Produce json
+// @Produce text/csv
+// @Param date path string true "对账日期 YYYY-MM-DD"
+// @Param format query string false "json 或 csv"
+// @Success 200 {object} APIResponse{data=reconcile.Report} "获取成功"
+// @Failure 404 {object} APIResponse "报告不存在"
+// @Router /api/v1/admin/reconcile/reports/{date} [get]
+func (h *ReconcileHandlers) HandleReconcileReport(c *gin.Context) {
+	var uri ReconcileDateURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "对账日期不能为空"})
+		return
+	}
+	var q ReconcileReportQuery
+	_ = c.ShouldBindQuery(&q)
+
+	report, ok := reconcile.GetGlobalReconciler().GetReport(uri.Date)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "该日期暂无对账报告"})
+		return
+	}
+
+	if strings.EqualFold(q.Format, "csv") {
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "导出CSV失败: " + err.Error()})
+			return
+		}
+		filename := fmt.Sprintf("reconcile_%s.csv", report.Date)
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: report})
+}
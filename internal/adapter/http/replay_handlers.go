@@ -0,0 +1,128 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
+	"github.com/gin-gonic/gin"
+)
+
+// replayCoordinator 全局积压重放协调器，未启用时返回503
+func replayCoordinator(c *gin.Context) *replay.Coordinator {
+	coordinator := replay.GetGlobalCoordinator()
+	if coordinator == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用停机积压重放审批（postOutageReplay.enabled）"})
+	}
+	return coordinator
+}
+
+// replayError 积压重放操作错误的响应码
+func replayError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, replay.ErrUnknownCategory):
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+	case errors.Is(err, replay.ErrNotHeld), errors.Is(err, replay.ErrInvalidState):
+		c.JSON(http.StatusConflict, APIResponse{Code: 409, Message: err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+	}
+}
+
+// HandleReplayPlan 停机积压重放计划
+// @Summary 停机积压重放计划
+// @Description 本次启动的停机时长与暂缓阈值，以及各类别（deferred_commands/notification_spool/frame_journal）的待重放条数、积压时长范围、预计下行量、重放速率、状态（released/pending_approval/running/paused/completed）与进度
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=replay.Plan} "查询成功"
+// @Failure 503 {object} APIResponse "未启用停机积压重放审批"
+// @Router /api/v1/admin/replay-plan [get]
+func (h *AdminHandlers) HandleReplayPlan(c *gin.Context) {
+	coordinator := replayCoordinator(c)
+	if coordinator == nil {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: coordinator.Plan()})
+}
+
+// HandleApproveReplay 批准停机积压重放
+// @Summary 批准停机积压重放
+// @Description 批准待审批类别按速率重放（categories 为空时批准全部），ratePerSecond 未指定时使用 postOutageReplay.ratePerSecond；重放完成的类别恢复由子系统常规流程处理
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body ReplayApproveParams false "批准范围与速率"
+// @Success 200 {object} APIResponse{data=replay.Plan} "已批准"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 404 {object} APIResponse "未知的重放类别"
+// @Failure 409 {object} APIResponse "本次启动未暂缓重放"
+// @Failure 503 {object} APIResponse "未启用停机积压重放审批"
+// @Router /api/v1/admin/replay-plan/approve [post]
+func (h *AdminHandlers) HandleApproveReplay(c *gin.Context) {
+	var params ReplayApproveParams
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&params); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+			return
+		}
+	}
+	coordinator := replayCoordinator(c)
+	if coordinator == nil {
+		return
+	}
+	if _, err := coordinator.Approve(replay.ApproveRequest{
+		Categories:    params.Categories,
+		RatePerSecond: params.RatePerSecond,
+		ApprovedBy:    c.ClientIP(),
+	}); err != nil {
+		replayError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: coordinator.Plan()})
+}
+
+// HandlePauseReplay 暂停类别的积压重放
+// @Summary 暂停类别的积压重放
+// @Description 暂停重放中的类别：当前条目处理完后不再发送，恢复前该类别仍不经子系统常规流程重放
+// @Tags system
+// @Produce json
+// @Param category path string true "重放类别" Enums(deferred_commands, notification_spool, frame_journal)
+// @Success 200 {object} APIResponse{data=replay.Plan} "已暂停"
+// @Failure 404 {object} APIResponse "未知的重放类别"
+// @Failure 409 {object} APIResponse "类别不在重放中"
+// @Failure 503 {object} APIResponse "未启用停机积压重放审批"
+// @Router /api/v1/admin/replay-plan/{category}/pause [post]
+func (h *AdminHandlers) HandlePauseReplay(c *gin.Context) {
+	coordinator := replayCoordinator(c)
+	if coordinator == nil {
+		return
+	}
+	if err := coordinator.Pause(c.Param("category")); err != nil {
+		replayError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: coordinator.Plan()})
+}
+
+// HandleResumeReplay 恢复类别的积压重放
+// @Summary 恢复类别的积压重放
+// @Description 恢复已暂停的类别，按原速率继续重放
+// @Tags system
+// @Produce json
+// @Param category path string true "重放类别" Enums(deferred_commands, notification_spool, frame_journal)
+// @Success 200 {object} APIResponse{data=replay.Plan} "已恢复"
+// @Failure 404 {object} APIResponse "未知的重放类别"
+// @Failure 409 {object} APIResponse "类别不在重放中"
+// @Failure 503 {object} APIResponse "未启用停机积压重放审批"
+// @Router /api/v1/admin/replay-plan/{category}/resume [post]
+func (h *AdminHandlers) HandleResumeReplay(c *gin.Context) {
+	coordinator := replayCoordinator(c)
+	if coordinator == nil {
+		return
+	}
+	if err := coordinator.Resume(c.Param("category")); err != nil {
+		replayError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: coordinator.Plan()})
+}
@@ -0,0 +1,219 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HeaderDataSource 响应头：只读副本应答的数据来源
+	HeaderDataSource = "X-Data-Source"
+	// HeaderDataStateAt 响应头：只读副本所用快照的发布时间（RFC3339）
+	HeaderDataStateAt = "X-Data-State-At"
+
+	// ErrorCodeReplicaReadOnly 只读副本拒绝写操作时响应中的错误码
+	ErrorCodeReplicaReadOnly = "REPLICA_READ_ONLY"
+	// ErrorCodeReplicaNoState 只读副本尚未读到主实例快照时响应中的错误码
+	ErrorCodeReplicaNoState = "REPLICA_NO_STATE"
+	// ErrorCodeReplicaNoHistory 只读副本无可读取的端口状态历史时响应中的错误码
+	ErrorCodeReplicaNoHistory = "REPLICA_NO_HISTORY"
+)
+
+// replicaSafeRoutes 不修改任何状态的非GET接口，只读副本照常处理
+var replicaSafeRoutes = map[string]bool{
+	"/api/v1/tools/parse-frame":                 true,
+	"/api/v1/admin/notification-routes/dry-run": true,
+}
+
+// ReplicaReadOnlyMiddleware 只读副本：写操作返回503及主实例地址
+func ReplicaReadOnlyMiddleware(reader *replica.Reader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if replicaSafeRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+		data := gin.H{"errorCode": ErrorCodeReplicaReadOnly, "dataSource": replica.DataSourceReplica}
+		if primary := reader.PrimaryURL(); primary != "" {
+			data["primary"] = primary
+			data["redirect"] = primary + c.Request.URL.RequestURI()
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "只读副本不支持写操作，请求主实例", Data: data})
+	}
+}
+
+// ReplicaHandlers 只读副本的查询处理器：从主实例发布的状态快照应答，响应标注数据来源与快照时间
+type ReplicaHandlers struct {
+	reader *replica.Reader
+}
+
+// NewReplicaHandlers 创建只读副本查询处理器
+func NewReplicaHandlers(reader *replica.Reader) *ReplicaHandlers {
+	return &ReplicaHandlers{reader: reader}
+}
+
+// view 读取副本视图，失败时返回503
+func (h *ReplicaHandlers) view(c *gin.Context) (*replica.View, bool) {
+	v, err := h.reader.View()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error(), Data: gin.H{"errorCode": ErrorCodeReplicaNoState, "dataSource": replica.DataSourceReplica}})
+		return nil, false
+	}
+	return v, true
+}
+
+// mark 标注数据来源与时效
+func (h *ReplicaHandlers) mark(c *gin.Context, data gin.H, stateAt time.Time) gin.H {
+	now := time.Now()
+	c.Header(HeaderDataSource, replica.DataSourceReplica)
+	c.Header(HeaderDataStateAt, stateAt.Format(time.RFC3339Nano))
+	data["dataSource"] = replica.DataSourceReplica
+	data["stateAt"] = stateAt
+	data["stalenessMs"] = now.Sub(stateAt).Milliseconds()
+	data["stale"] = h.reader.IsStale(stateAt, now)
+	return data
+}
+
+// deviceDetail 复制快照中的设备详情（快照为各请求共享）
+func (h *ReplicaHandlers) deviceDetail(v *replica.View, d replica.DeviceSnapshot) gin.H {
+	detail := make(gin.H, len(d.Detail)+1)
+	for k, val := range d.Detail {
+		detail[k] = val
+	}
+	detail["owner"] = cluster.Owner{InstanceID: v.Owner(d.DeviceID)}
+	return detail
+}
+
+// standardDeviceID 解析设备ID，格式错误时返回400
+func (h *ReplicaHandlers) standardDeviceID(c *gin.Context) (string, string, bool) {
+	var uri DeviceStatusURI
+	if err := c.ShouldBindUri(&uri); err != nil || uri.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "设备ID不能为空"})
+		return "", "", false
+	}
+	standardDeviceID, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(uri.DeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error(), Data: gin.H{"hint": "支持格式: 十进制(10644723)、6位十六进制(A26CF3)、8位十六进制(04A26CF3)"}})
+		return "", "", false
+	}
+	return uri.DeviceID, standardDeviceID, true
+}
+
+// HandleDeviceList 副本设备列表（路由与 DeviceHandlers.HandleDeviceList 相同）
+func (h *ReplicaHandlers) HandleDeviceList(c *gin.Context) {
+	var q DeviceListQuery
+	_ = c.ShouldBindQuery(&q)
+	v, ok := h.view(c)
+	if !ok {
+		return
+	}
+	devices := v.Devices()
+	deviceList := make([]gin.H, 0, len(devices))
+	for _, d := range devices {
+		if q.StationID != "" && d.StationID != q.StationID {
+			continue
+		}
+		if q.DeviceType != 0 && d.DeviceType != q.DeviceType {
+			continue
+		}
+		deviceList = append(deviceList, h.deviceDetail(v, d))
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.mark(c, gin.H{"devices": deviceList, "total": len(devices), "online": len(devices)}, v.StateAt)})
+}
+
+// HandleDeviceStatus 副本设备详情（路由与 DeviceHandlers.HandleDeviceStatus 相同）
+func (h *ReplicaHandlers) HandleDeviceStatus(c *gin.Context) {
+	deviceID, standardDeviceID, ok := h.standardDeviceID(c)
+	if !ok {
+		return
+	}
+	v, ok := h.view(c)
+	if !ok {
+		return
+	}
+	d, found := v.Device(standardDeviceID)
+	if !found {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: h.mark(c, gin.H{"deviceId": deviceID, "standardId": standardDeviceID, "isOnline": false}, v.StateAt)})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.mark(c, h.deviceDetail(v, d), v.StateAt)})
+}
+
+// HandleDevicePorts 副本设备端口状态（路由与 DeviceHandlers.HandleDevicePorts 相同）
+func (h *ReplicaHandlers) HandleDevicePorts(c *gin.Context) {
+	deviceID, standardDeviceID, ok := h.standardDeviceID(c)
+	if !ok {
+		return
+	}
+	v, ok := h.view(c)
+	if !ok {
+		return
+	}
+	d, found := v.Device(standardDeviceID)
+	if !found {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "设备不在线", Data: h.mark(c, gin.H{"deviceId": deviceID, "standardId": standardDeviceID, "isOnline": false}, v.StateAt)})
+		return
+	}
+	data := gin.H{"deviceId": deviceID, "standardId": standardDeviceID, "isOnline": true, "ports": d.Ports, "total": len(d.Ports)}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.mark(c, data, v.StateAt)})
+}
+
+// HandleSystemStats 副本统计信息（路由与 DeviceGatewayHandlers.HandleSystemStats 相同）
+func (h *ReplicaHandlers) HandleSystemStats(c *gin.Context) {
+	v, ok := h.view(c)
+	if !ok {
+		return
+	}
+	stats := gin.H(v.Stats())
+	stats["publishedInstances"] = len(v.States)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "获取统计信息成功", Data: h.mark(c, stats, v.StateAt)})
+}
+
+// HandlePortAvailability 副本端口状态历史（路由与 EnergyHandlers.HandlePortAvailability 相同），时效以主实例持久化历史的时间为准
+func (h *ReplicaHandlers) HandlePortAvailability(c *gin.Context) {
+	var uri PortEnergyURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	now := time.Now()
+	month, ok := bindAvailabilityMonth(c, now)
+	if !ok {
+		return
+	}
+	deviceID, port, ok := resolvePhysicalPort(c, uri.DeviceID, uri.Port)
+	if !ok {
+		return
+	}
+	tracker, savedAt, err := h.reader.History()
+	if err != nil {
+		code := ErrorCodeReplicaNoState
+		if errors.Is(err, replica.ErrNoHistory) {
+			code = ErrorCodeReplicaNoHistory
+		}
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: err.Error(), Data: gin.H{"errorCode": code, "dataSource": replica.DataSourceReplica}})
+		return
+	}
+	report, ok := tracker.Port(deviceID, port, month, now)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "该端口暂无状态历史", Data: h.mark(c, gin.H{"deviceId": uri.DeviceID, "standardId": deviceID, "port": port}, savedAt)})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: h.mark(c, gin.H{
+		"deviceId":     uri.DeviceID,
+		"port":         uri.Port,
+		"standardId":   deviceID,
+		"physicalPort": port,
+		"availability": report,
+	}, savedAt)})
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/sessionarchive"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleSessionArchive 连接会话归档查询与导出
+// @Summary 连接会话归档
+// @Description 按来源IP、ICCID、设备与时间范围查询已关闭的连接会话（按断开时间倒序分页），含起止时间、收发字节数与断开原因；format=csv 时导出全部匹配记录
+// @Tags system
+// @Produce json
+// @Produce text/csv
+// @Param ip query string false "设备来源IP"
+// @Param iccid query string false "ICCID"
+// @Param deviceId query string false "设备ID"
+// @Param from query int false "起始时间（Unix秒）"
+// @Param to query int false "结束时间（Unix秒）"
+// @Param page query int false "页码，默认1"
+// @Param limit query int false "每页条数，默认100"
+// @Param format query string false "json 或 csv"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 503 {object} APIResponse "未启用连接会话归档"
+// @Router /api/v1/admin/session-archive [get]
+func (h *AdminHandlers) HandleSessionArchive(c *gin.Context) {
+	archive := sessionarchive.GetGlobalArchive()
+	if archive == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用连接会话归档"})
+		return
+	}
+	var q SessionArchiveQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	query := sessionarchive.Query{
+		IP:     strings.TrimSpace(q.IP),
+		ICCID:  strings.TrimSpace(q.ICCID),
+		Offset: (q.Page - 1) * q.Limit,
+		Limit:  q.Limit,
+	}
+	if q.DeviceID != "" {
+		query.DeviceID = q.DeviceID
+		if v, ok := virtual.Resolve(q.DeviceID); ok {
+			query.DeviceID = v.ParentID
+		} else if standard, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(q.DeviceID); err == nil {
+			query.DeviceID = standard
+		}
+	}
+	if q.From > 0 {
+		query.From = time.Unix(q.From, 0)
+	}
+	if q.To > 0 {
+		query.To = time.Unix(q.To, 0)
+	}
+	csvExport := strings.EqualFold(q.Format, "csv")
+	if csvExport {
+		query.Offset, query.Limit = 0, 0
+	}
+	page, err := archive.Search(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "查询连接会话归档失败: " + err.Error()})
+		return
+	}
+
+	if csvExport {
+		var buf bytes.Buffer
+		if err := sessionarchive.WriteCSV(&buf, page.Records); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "导出CSV失败: " + err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=session_archive_"+time.Now().Format("20060102150405")+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"records": page.Records,
+		"total":   page.Total,
+		"page":    q.Page,
+		"limit":   q.Limit,
+		"stats":   archive.Stats(),
+	}})
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleSessionLimits 设备并发充电会话上限
+// @Summary 设备并发充电会话上限
+// @Description 返回全局默认上限与全部单独配置的设备上限；设备当前占用的端口见设备详情 sessionLimit
+// @Tags charging
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Router /api/v1/charging/session-limits [get]
+func (h *ChargingHandlers) HandleSessionLimits(c *gin.Context) {
+	limiter := h.deviceGateway.GetSessionLimiter()
+	limits := limiter.List()
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"defaultMaxConcurrent": limiter.DefaultMax(),
+		"limits":               limits,
+		"total":                len(limits),
+	}})
+}
+
+// HandleSetSessionLimit 设置设备并发充电会话上限
+// @Summary 设置设备并发充电会话上限
+// @Description 按供电容量限制设备同时充电（含待启动/排队）的端口数，立即对后续开始充电生效并持久化，已进行的会话不受影响
+// @Tags charging
+// @Accept json
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Param request body SessionLimitParams true "上限参数"
+// @Success 200 {object} APIResponse{data=gateway.SessionLimitStatus} "设置成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 500 {object} APIResponse "持久化失败"
+// @Router /api/v1/device/{deviceId}/session-limit [put]
+func (h *ChargingHandlers) HandleSetSessionLimit(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	var params SessionLimitParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	limit := gateway.SessionLimit{
+		DeviceID:          standardDeviceID,
+		MaxConcurrent:     params.MaxConcurrent,
+		ReducedPowerSlots: params.ReducedPowerSlots,
+		ReducedPowerW:     params.ReducedPowerW,
+		Reason:            params.Reason,
+	}
+	if err := gateway.ValidateSessionLimit(limit); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: err.Error()})
+		return
+	}
+	limiter := h.deviceGateway.GetSessionLimiter()
+	if _, err := limiter.Set(limit); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "持久化失败: " + err.Error()})
+		return
+	}
+	status, _ := limiter.Status(standardDeviceID)
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: status})
+}
+
+// HandleDeleteSessionLimit 删除设备并发充电会话上限
+// @Summary 删除设备并发充电会话上限
+// @Description 删除后设备恢复使用全局默认上限
+// @Tags charging
+// @Produce json
+// @Param deviceId path string true "设备ID"
+// @Success 200 {object} APIResponse "删除成功"
+// @Failure 404 {object} APIResponse "设备未单独配置上限"
+// @Failure 500 {object} APIResponse "持久化失败"
+// @Router /api/v1/device/{deviceId}/session-limit [delete]
+func (h *ChargingHandlers) HandleDeleteSessionLimit(c *gin.Context) {
+	standardDeviceID, ok := bindStandardDeviceID(c)
+	if !ok {
+		return
+	}
+	limiter := h.deviceGateway.GetSessionLimiter()
+	if err := limiter.Delete(standardDeviceID); err != nil {
+		if errors.Is(err, gateway.ErrSessionLimitNotFound) {
+			c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"deviceId":             standardDeviceID,
+		"defaultMaxConcurrent": limiter.DefaultMax(),
+	}})
+}
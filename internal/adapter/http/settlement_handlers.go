@@ -0,0 +1,123 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// SettlementHandlers 结算查询 HTTP 处理器
+type SettlementHandlers struct{}
+
+// NewSettlementHandlers 创建结算查询处理器
+func NewSettlementHandlers() *SettlementHandlers { return &SettlementHandlers{} }
+
+// settlementStore 获取结算日志存储，未启用时应答503
+func settlementStore(c *gin.Context) (*settlement.Store, bool) {
+	store := settlement.GetGlobalStore()
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "结算日志存储未启用"})
+		return nil, false
+	}
+	return store, true
+}
+
+// HandleListSettlements 按设备与接收时间查询结算
+// @Summary 查询结算记录
+// @Description 从结算日志存储按接收时间区间扫描（可按设备过滤），按写入序号升序返回，含原始帧；more 为 true 时以 nextAfterSeq 继续翻页
+// @Tags charging
+// @Produce json
+// @Param deviceId query string false "设备ID"
+// @Param from query int false "接收时间起（Unix秒）"
+// @Param to query int false "接收时间止（Unix秒，不含）"
+// @Param afterSeq query int false "翻页游标"
+// @Param limit query int false "返回条数，默认100，最大1000"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 503 {object} APIResponse "结算日志存储未启用"
+// @Router /api/v1/settlements [get]
+func (h *SettlementHandlers) HandleListSettlements(c *gin.Context) {
+	var q SettlementQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	store, ok := settlementStore(c)
+	if !ok {
+		return
+	}
+	query := settlement.Query{DeviceID: q.DeviceID, AfterSeq: q.AfterSeq, Limit: q.Limit}
+	if q.DeviceID != "" {
+		processor := &utils.DeviceIDProcessor{}
+		standardDeviceID, err := processor.SmartConvertDeviceID(q.DeviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "DeviceID格式错误: " + err.Error()})
+			return
+		}
+		query.DeviceID = standardDeviceID
+	}
+	if q.From > 0 {
+		query.From = time.Unix(q.From, 0)
+	}
+	if q.To > 0 {
+		query.To = time.Unix(q.To, 0)
+	}
+
+	records, more, err := store.Scan(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "查询结算失败: " + err.Error()})
+		return
+	}
+	if records == nil {
+		records = []settlement.Record{}
+	}
+	nextAfterSeq := q.AfterSeq
+	if len(records) > 0 {
+		nextAfterSeq = records[len(records)-1].Seq
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"settlements":  records,
+		"count":        len(records),
+		"more":         more,
+		"nextAfterSeq": nextAfterSeq,
+	}})
+}
+
+// HandleGetSettlement 按订单号查询结算
+// @Summary 按订单号查询结算
+// @Description 返回该订单最近一条结算及全部版本（设备对同一订单上报过不同内容时有多条，完全相同的重发写入时已去重）
+// @Tags charging
+// @Produce json
+// @Param orderNo path string true "订单号"
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Failure 404 {object} APIResponse "结算不存在"
+// @Failure 503 {object} APIResponse "结算日志存储未启用"
+// @Router /api/v1/settlements/{orderNo} [get]
+func (h *SettlementHandlers) HandleGetSettlement(c *gin.Context) {
+	var uri SettlementOrderURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "订单号不能为空"})
+		return
+	}
+	store, ok := settlementStore(c)
+	if !ok {
+		return
+	}
+	records, err := store.Lookup(uri.OrderNo)
+	if err != nil {
+		if errors.Is(err, settlement.ErrNotFound) {
+			c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{Code: 500, Message: "查询结算失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"settlement": records[len(records)-1],
+		"revisions":  records,
+	}})
+}
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/shaping"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// HeaderSyntheticFault 注入故障的响应标记头（如 "rule=shape-1; latency=1.5s; error=503"）
+const HeaderSyntheticFault = "X-Synthetic-Fault"
+
+// responseShapingAdminRoute 塑形规则管理接口本身不参与塑形，避免规则把自己锁死
+const responseShapingAdminRoute = "/api/v1/admin/response-shaping"
+
+// ResponseShapingMiddleware 预发环境响应塑形：按匹配规则注入延迟、错误响应（不执行处理器）或截断列表响应，
+// 受影响的响应带 X-Synthetic-Fault 头并逐条记录日志；未启用时直接放行
+func ResponseShapingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := shaping.GetGlobalShaper()
+		route := c.FullPath()
+		if s == nil || route == "" || strings.HasPrefix(route, responseShapingAdminRoute) {
+			c.Next()
+			return
+		}
+		apiKey := strings.TrimSpace(c.GetHeader(s.Options().KeyHeader))
+		decision, ok := s.Shape(c.Request.Method, route, c.Request.URL.Path, apiKey, time.Now())
+		if !ok {
+			c.Next()
+			return
+		}
+		c.Header(HeaderSyntheticFault, decision.Marker())
+		defer func() {
+			logger.WithFields(logrus.Fields{
+				"ruleId":        decision.RuleID,
+				"marker":        decision.Marker(),
+				"apiKey":        apiKey,
+				"method":        c.Request.Method,
+				"path":          c.Request.URL.Path,
+				"status":        c.Writer.Status(),
+				"correlationID": GetCorrelationID(c),
+			}).Info("响应塑形：已注入合成故障")
+		}()
+
+		if decision.Latency > 0 {
+			timer := time.NewTimer(decision.Latency)
+			select {
+			case <-timer.C:
+			case <-c.Request.Context().Done():
+				timer.Stop()
+				c.Abort()
+				return
+			}
+		}
+		if decision.Error != "" {
+			writeSyntheticError(c, decision.Error)
+			c.Abort()
+			return
+		}
+		if !decision.PartialPage {
+			c.Next()
+			return
+		}
+
+		capture := &capturedResponse{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = capture
+		c.Next()
+		c.Writer = capture.ResponseWriter
+		body := capture.body.Bytes()
+		if capture.status == http.StatusOK {
+			if truncated, ok := truncateListResponse(body); ok {
+				body = truncated
+			}
+		}
+		c.Writer.WriteHeader(capture.status)
+		_, _ = c.Writer.Write(body)
+	}
+}
+
+// writeSyntheticError 写出与真实错误格式一致的注入错误
+func writeSyntheticError(c *gin.Context, kind string) {
+	switch kind {
+	case shaping.ErrorTooManyRequests:
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, APIResponse{Code: 429, Message: "请求过于频繁"})
+	case shaping.ErrorCommandTimeout:
+		data, _ := json.Marshal(ProblemDetails{
+			Type:      "about:blank",
+			Title:     shaping.ErrorCommandTimeout,
+			Status:    http.StatusGatewayTimeout,
+			Detail:    "设备未在超时时间内应答",
+			Instance:  c.Request.URL.Path,
+			RequestID: GetCorrelationID(c),
+		})
+		c.Data(http.StatusGatewayTimeout, problemContentType, data)
+	default:
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "服务暂不可用"})
+	}
+}
+
+// truncateListResponse 列表响应（data 含 total 与数组字段）只保留第一个数组字段的前一半条目，total 不变
+func truncateListResponse(body []byte) ([]byte, bool) {
+	var resp map[string]json.RawMessage
+	if json.Unmarshal(body, &resp) != nil {
+		return nil, false
+	}
+	var data map[string]json.RawMessage
+	if json.Unmarshal(resp["data"], &data) != nil {
+		return nil, false
+	}
+	if _, ok := data["total"]; !ok {
+		return nil, false
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var items []json.RawMessage
+		if json.Unmarshal(data[k], &items) != nil || len(items) < 2 {
+			continue
+		}
+		data[k], _ = json.Marshal(items[:len(items)/2])
+		resp["data"], _ = json.Marshal(data)
+		out, err := json.Marshal(resp)
+		return out, err == nil
+	}
+	return nil, false
+}
+
+// HandleResponseShaping 查询响应塑形状态与生效规则
+// @Summary 查询响应塑形规则
+// @Description 预发环境响应塑形的启用状态、部署环境、可用预设与生效中的规则（含到期时间与已塑形响应数）
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "查询成功"
+// @Router /api/v1/admin/response-shaping [get]
+func (h *AdminHandlers) HandleResponseShaping(c *gin.Context) {
+	environment := config.GetConfig().Environment
+	s := shaping.GetGlobalShaper()
+	if s == nil {
+		reason := "未启用响应塑形"
+		if !shaping.EnvironmentAllowed(environment) {
+			reason = shaping.ErrEnvironmentNotAllowed.Error()
+		}
+		c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+			"enabled":     false,
+			"environment": environment,
+			"reason":      reason,
+			"rules":       []shaping.Rule{},
+		}})
+		return
+	}
+	opts := s.Options()
+	presets := make([]shaping.RuleSpec, 0, len(opts.Presets))
+	for _, p := range opts.Presets {
+		presets = append(presets, p)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	rules := s.Rules(time.Now())
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"enabled":      true,
+		"environment":  environment,
+		"keyHeader":    opts.KeyHeader,
+		"markerHeader": HeaderSyntheticFault,
+		"presets":      presets,
+		"rules":        rules,
+		"total":        len(rules),
+	}})
+}
+
+// HandleCreateShapingRule 下发响应塑形规则
+// @Summary 下发响应塑形规则
+// @Description 按预设名称或直接定义规则（路由、调用方API Key、延迟、错误概率与类型、不完整分页概率），到期自动失效；部署环境不在 development/staging/test 允许列表内时拒绝
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body ResponseShapingParams true "规则参数"
+// @Success 200 {object} APIResponse{data=shaping.Rule} "规则已生效"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 403 {object} APIResponse "部署环境不允许启用"
+// @Failure 503 {object} APIResponse "未启用响应塑形"
+// @Router /api/v1/admin/response-shaping [post]
+func (h *AdminHandlers) HandleCreateShapingRule(c *gin.Context) {
+	s, ok := requireShaper(c)
+	if !ok {
+		return
+	}
+	var params ResponseShapingParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	rule, err := s.Add(params.Preset, params.RuleSpec, time.Duration(params.TTLSeconds)*time.Second, time.Now())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, shaping.ErrUnknownPreset) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, APIResponse{Code: status, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "规则已生效", Data: rule})
+}
+
+// HandleDeleteShapingRule 删除响应塑形规则
+// @Summary 删除响应塑形规则
+// @Description 提前结束指定规则
+// @Tags system
+// @Produce json
+// @Param ruleId path string true "规则ID"
+// @Success 200 {object} APIResponse "已删除"
+// @Failure 404 {object} APIResponse "规则不存在或已到期"
+// @Router /api/v1/admin/response-shaping/{ruleId} [delete]
+func (h *AdminHandlers) HandleDeleteShapingRule(c *gin.Context) {
+	s, ok := requireShaper(c)
+	if !ok {
+		return
+	}
+	if !s.Remove(c.Param("ruleId")) {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "规则不存在或已到期"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "已删除"})
+}
+
+// HandleClearShapingRules 清除全部响应塑形规则
+// @Summary 清除全部响应塑形规则
+// @Description 立即结束所有生效中的规则
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse "已清除"
+// @Router /api/v1/admin/response-shaping [delete]
+func (h *AdminHandlers) HandleClearShapingRules(c *gin.Context) {
+	s, ok := requireShaper(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "已清除", Data: gin.H{"removed": s.Clear()}})
+}
+
+// requireShaper 获取全局规则集，未启用时写入错误响应（部署环境不允许时403，其余503）
+func requireShaper(c *gin.Context) (*shaping.Shaper, bool) {
+	if s := shaping.GetGlobalShaper(); s != nil {
+		return s, true
+	}
+	if !shaping.EnvironmentAllowed(config.GetConfig().Environment) {
+		c.JSON(http.StatusForbidden, APIResponse{Code: 403, Message: shaping.ErrEnvironmentNotAllowed.Error()})
+		return nil, false
+	}
+	c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用响应塑形"})
+	return nil, false
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/sla"
+	"github.com/gin-gonic/gin"
+)
+
+// SLAHandlers 租户命令成功率SLA HTTP 处理器
+type SLAHandlers struct{}
+
+// NewSLAHandlers 创建SLA处理器
+func NewSLAHandlers() *SLAHandlers { return &SLAHandlers{} }
+
+// HandleTenantSLA 租户命令成功率SLA
+// @Summary 租户命令成功率SLA
+// @Description 租户 1h/24h/30d 滑动窗口的命令成功率（分钟/小时/天时间桶，按UTC对齐）与失败分类分布：success、device_timeout、device_rejected、gateway_error、device_offline。
+// @Description successRate 只扣减 attributableClasses 中的网关可归责失败（默认 gateway_error、device_timeout），rawSuccessRate 为全部命令中的成功比例；
+// @Description 资产映射中未标注租户的设备计入 _unassigned。activeAlerts 为该租户进行中的24h成功率告警，recentAlerts 为最近告警（新→旧）
+// @Tags system
+// @Produce json
+// @Param tenant path string true "租户ID"
+// @Success 200 {object} APIResponse{data=sla.TenantSLA} "查询成功"
+// @Failure 404 {object} APIResponse "租户没有命令统计"
+// @Failure 503 {object} APIResponse "SLA统计未启用"
+// @Router /api/v1/tenants/{tenant}/sla [get]
+func (h *SLAHandlers) HandleTenantSLA(c *gin.Context) {
+	tracker := sla.GetGlobalTracker()
+	if tracker == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "SLA统计未启用（sla.enabled）"})
+		return
+	}
+	snapshot, ok := tracker.Snapshot(c.Param("tenant"))
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "租户没有命令统计", Data: gin.H{"tenantId": c.Param("tenant")}})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: snapshot})
+}
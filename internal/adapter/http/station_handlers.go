@@ -0,0 +1,134 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// metricsCollectors 其他组件（如gRPC服务器）注册的指标输出，按名称排序追加到 /metrics
+var (
+	metricsCollectorsMu sync.RWMutex
+	metricsCollectors   = make(map[string]func(w io.Writer))
+)
+
+// RegisterMetricsCollector 注册附加指标输出（同名覆盖，fn为nil时移除），fn 以 Prometheus 文本格式写出
+func RegisterMetricsCollector(name string, fn func(w io.Writer)) {
+	metricsCollectorsMu.Lock()
+	defer metricsCollectorsMu.Unlock()
+	if fn == nil {
+		delete(metricsCollectors, name)
+		return
+	}
+	metricsCollectors[name] = fn
+}
+
+// StationHandlers 站点聚合 HTTP 处理器
+type StationHandlers struct {
+	deviceGateway *gateway.DeviceGateway
+}
+
+// NewStationHandlers 创建站点处理器
+func NewStationHandlers() *StationHandlers {
+	return &StationHandlers{deviceGateway: gateway.GetGlobalDeviceGateway()}
+}
+
+// HandleListStations 站点列表
+// @Summary 站点列表
+// @Description 按资产映射的 station_id 汇总各站点的设备数、在线数、端口数（充电/空闲/故障）与当前总功率；离线设备占比超过阈值的站点标记为降级
+// @Tags station
+// @Produce json
+// @Success 200 {object} APIResponse{data=object} "获取成功"
+// @Router /api/v1/stations [get]
+func (h *StationHandlers) HandleListStations(c *gin.Context) {
+	aggregator := h.deviceGateway.GetStationAggregator()
+	stations := aggregator.ListStations()
+	degraded := 0
+	for _, s := range stations {
+		if s.Degraded {
+			degraded++
+		}
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: gin.H{
+		"stations":   stations,
+		"total":      len(stations),
+		"degraded":   degraded,
+		"unassigned": aggregator.UnassignedDevices(),
+	}})
+}
+
+// HandleStationDetail 站点详情
+// @Summary 站点详情
+// @Description 返回站点汇总及其下各设备的在线状态、端口分布与当前功率
+// @Tags station
+// @Produce json
+// @Param stationId path string true "站点ID"
+// @Success 200 {object} APIResponse{data=gateway.StationDetail} "获取成功"
+// @Failure 404 {object} APIResponse "站点不存在"
+// @Router /api/v1/stations/{stationId} [get]
+func (h *StationHandlers) HandleStationDetail(c *gin.Context) {
+	stationID := c.Param("stationId")
+	detail, ok := h.deviceGateway.GetStationAggregator().GetStation(stationID)
+	if !ok {
+		c.JSON(http.StatusNotFound, APIResponse{Code: 404, Message: "站点不存在或没有已知设备"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: detail})
+}
+
+// HandleMetrics Prometheus 指标
+// @Summary Prometheus 指标
+// @Description 以 Prometheus 文本格式导出按站点标注的聚合指标，用于站点级故障告警
+// @Tags system
+// @Produce plain
+// @Success 200 {string} string "指标文本"
+// @Router /metrics [get]
+func (h *StationHandlers) HandleMetrics(c *gin.Context) {
+	stations := h.deviceGateway.GetStationAggregator().ListStations()
+
+	var b strings.Builder
+	gauge := func(name, help string, value func(s gateway.StationSummary) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, s := range stations {
+			fmt.Fprintf(&b, "%s{station=\"%s\"} %s\n", name, escapeLabelValue(s.StationID), strconv.FormatFloat(value(s), 'f', -1, 64))
+		}
+	}
+	gauge("iot_station_devices", "Devices mapped to the station.", func(s gateway.StationSummary) float64 { return float64(s.DeviceCount) })
+	gauge("iot_station_devices_online", "Online devices of the station.", func(s gateway.StationSummary) float64 { return float64(s.OnlineCount) })
+	gauge("iot_station_ports", "Ports of the station.", func(s gateway.StationSummary) float64 { return float64(s.TotalPorts) })
+	gauge("iot_station_ports_charging", "Charging ports of online devices.", func(s gateway.StationSummary) float64 { return float64(s.PortsCharging) })
+	gauge("iot_station_ports_idle", "Idle ports of online devices.", func(s gateway.StationSummary) float64 { return float64(s.PortsIdle) })
+	gauge("iot_station_ports_faulted", "Faulted ports of online devices.", func(s gateway.StationSummary) float64 { return float64(s.PortsFaulted) })
+	gauge("iot_station_power_watts", "Current power draw of the station in watts.", func(s gateway.StationSummary) float64 { return s.PowerW })
+	gauge("iot_station_degraded", "1 when the offline device fraction exceeds the configured threshold.", func(s gateway.StationSummary) float64 {
+		if s.Degraded {
+			return 1
+		}
+		return 0
+	})
+
+	metricsCollectorsMu.RLock()
+	names := make([]string, 0, len(metricsCollectors))
+	for name := range metricsCollectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metricsCollectors[name](&b)
+	}
+	metricsCollectorsMu.RUnlock()
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// escapeLabelValue Prometheus 标签值转义
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+// maxParseFrameHexChars 请求中hex字段的最大字符数（按每字节2位十六进制+1位分隔符计）
+const maxParseFrameHexChars = protocol.MaxDiagnoseFrameBytes * 3
+
+// ToolHandlers 协议调试工具 HTTP 处理器（纯计算，不访问设备状态）
+type ToolHandlers struct{}
+
+// NewToolHandlers 创建协议工具处理器
+func NewToolHandlers() *ToolHandlers {
+	return &ToolHandlers{}
+}
+
+// HandleParseFrame 解析协议帧
+// @Summary 解析DNY协议帧
+// @Description 对一帧十六进制数据做逐字段诊断：包头、声明/实际长度、物理ID、消息ID、命令名称、已知命令的载荷解码、两种校验算法的期望/实际值及带字节偏移的校验错误。与 dny-parser 命令行工具共用实现
+// @Tags tools
+// @Accept json
+// @Produce json
+// @Param request body ParseFrameParams true "帧解析参数"
+// @Success 200 {object} APIResponse{data=protocol.FrameDiagnostics} "解析完成（帧是否有效见 data.valid）"
+// @Failure 400 {object} APIResponse "参数错误或非法十六进制"
+// @Failure 413 {object} APIResponse "输入超过最大长度"
+// @Router /api/v1/tools/parse-frame [post]
+func (h *ToolHandlers) HandleParseFrame(c *gin.Context) {
+	var req ParseFrameParams
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if len(req.Hex) > maxParseFrameHexChars {
+		c.JSON(http.StatusRequestEntityTooLarge, APIResponse{Code: 413, Message: "输入超过最大长度"})
+		return
+	}
+
+	diag, err := protocol.DiagnoseHexFrame(req.Hex, req.Direction)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, protocol.ErrFrameTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, APIResponse{Code: status, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: diag})
+}
+
+// HandleProtocolCommands 协议命令码表
+// @Summary 协议命令码表
+// @Description 返回全部DNY命令码及其名称、描述、分类与方向（upstream=设备上报，downstream=服务器下发），与网关日志中的命令名称同源
+// @Tags tools
+// @Produce json
+// @Success 200 {object} APIResponse{data=[]dny_protocol.CommandEntry} "获取成功"
+// @Router /api/v1/protocol/commands [get]
+func (h *ToolHandlers) HandleProtocolCommands(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: dny_protocol.Commands()})
+}
+
+// HandleProtocolEnums 协议枚举表
+// @Summary 协议枚举表
+// @Description 返回应答码、充电命令、充电控制应答、计费模式、停止原因、主机/通讯模块/RTC/设备类型等枚举的取值与名称
+// @Tags tools
+// @Produce json
+// @Success 200 {object} APIResponse{data=[]dny_protocol.ProtocolEnum} "获取成功"
+// @Router /api/v1/protocol/enums [get]
+func (h *ToolHandlers) HandleProtocolEnums(c *gin.Context) {
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: dny_protocol.Enums()})
+}
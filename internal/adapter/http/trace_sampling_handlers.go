@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/bujia-iot/iot-zinx/pkg/tracesample"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleTraceSampling 查询协议会话抽样跟踪状态
+// @Summary 查询协议会话抽样跟踪状态
+// @Description 当前抽样比例、关注名单、正在跟踪的连接、跟踪目录占用与上限、因空间不足丢弃的记录数
+// @Tags system
+// @Produce json
+// @Success 200 {object} APIResponse{data=tracesample.Status} "查询成功"
+// @Failure 503 {object} APIResponse "未启用协议会话抽样跟踪"
+// @Router /api/v1/admin/trace-sampling [get]
+func (h *AdminHandlers) HandleTraceSampling(c *gin.Context) {
+	sampler := tracesample.GetGlobalSampler()
+	if sampler == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用协议会话抽样跟踪"})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: sampler.Status()})
+}
+
+// HandleUpdateTraceSampling 热更新抽样比例与关注名单
+// @Summary 热更新协议会话抽样比例与关注名单
+// @Description 新比例对之后接入的连接生效，新关注名单对之后确定身份的连接生效；正在跟踪的连接记录到断开
+// @Tags system
+// @Accept json
+// @Produce json
+// @Param request body TraceSamplingParams true "抽样参数"
+// @Success 200 {object} APIResponse{data=tracesample.Status} "更新成功"
+// @Failure 400 {object} APIResponse "参数错误"
+// @Failure 503 {object} APIResponse "未启用协议会话抽样跟踪"
+// @Router /api/v1/admin/trace-sampling [post]
+func (h *AdminHandlers) HandleUpdateTraceSampling(c *gin.Context) {
+	sampler := tracesample.GetGlobalSampler()
+	if sampler == nil {
+		c.JSON(http.StatusServiceUnavailable, APIResponse{Code: 503, Message: "未启用协议会话抽样跟踪"})
+		return
+	}
+	var params TraceSamplingParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+		return
+	}
+	if params.Rate != nil {
+		if err := sampler.SetRate(*params.Rate); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{Code: 400, Message: "参数错误: " + err.Error()})
+			return
+		}
+	}
+	if params.WatchDeviceIDs != nil || params.WatchICCIDs != nil {
+		status := sampler.Status()
+		deviceIDs, iccids := status.WatchDeviceIDs, status.WatchICCIDs
+		if params.WatchDeviceIDs != nil {
+			deviceIDs = *params.WatchDeviceIDs
+		}
+		if params.WatchICCIDs != nil {
+			iccids = *params.WatchICCIDs
+		}
+		sampler.SetWatchList(deviceIDs, iccids)
+	}
+	c.JSON(http.StatusOK, APIResponse{Code: 0, Message: "成功", Data: sampler.Status()})
+}
@@ -0,0 +1,591 @@
+// Package bootstrap 按固定依赖顺序构造并装配网关各组件
+//
+// 启动顺序：配置 → 日志 → 协议自检 → TCP管理器 → 命令管理器 → 设备网关 → Redis → 消息ID序列 → 虚拟子设备 → 集群设备归属 →
+// 只读副本 → 通知系统（注册跨组件回调）→ 审计/资产/促销/降功率 → 关键帧日志（重放）→ HTTP/TCP服务器 → 装配自检。
+// 只读副本模式不创建TCP服务器、不下发命令，并跳过会回写共享状态的组件（消息ID序列、电量计数、端口状态历史、集群归属、对账、关键帧日志）。
+// 库代码不再调用 os.Exit，致命错误逐级返回给入口程序处理。
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/internal/ports"
+	"github.com/bujia-iot/iot-zinx/pkg/anomaly"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/audit"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/chargepolicy"
+	"github.com/bujia-iot/iot-zinx/pkg/chargestats"
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/bujia-iot/iot-zinx/pkg/devicesession"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/fleetalert"
+	"github.com/bujia-iot/iot-zinx/pkg/framededup"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
+	"github.com/bujia-iot/iot-zinx/pkg/idempotency"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
+	"github.com/bujia-iot/iot-zinx/pkg/selftest"
+	"github.com/bujia-iot/iot-zinx/pkg/sessionarchive"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/bujia-iot/iot-zinx/pkg/shaping"
+	"github.com/bujia-iot/iot-zinx/pkg/sla"
+	"github.com/bujia-iot/iot-zinx/pkg/standby"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump/capture"
+	"github.com/bujia-iot/iot-zinx/pkg/tracesample"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/sirupsen/logrus"
+)
+
+const indexCheckInterval = 10 * time.Minute
+
+// Options 启动选项
+type Options struct {
+	ConfigFile string // 配置文件路径，为空时沿用当前已加载的配置
+	CoreOnly   bool   // 仅初始化进程内组件：不初始化日志文件、不连接Redis等外部依赖、不创建服务器（测试使用）
+	ReadOnly   bool   // 以只读副本模式启动（命令行 -read-only），与配置 replica.readOnly 任一开启即生效
+}
+
+// Application 启动完成的网关应用，两个入口程序共用
+type Application struct {
+	Config         *config.Config
+	Logger         *logger.ImprovedLogger
+	TCPManager     *core.TCPManager
+	CommandManager *network.CommandManager
+	Gateway        *gateway.DeviceGateway
+	Notification   *notification.NotificationIntegrator
+	FrameJournal   *journal.Journal      // 关键帧预写日志，未启用时为nil
+	Reconciler     *reconcile.Reconciler // 日终对账（CoreOnly 模式下为nil）
+	Settlements    *settlement.Store     // 结算日志存储，未启用时为nil
+	HTTPServer     *ports.HTTPServer
+	TCPServer      *ports.TCPServer
+	SelfTest       *selftest.Report // 启动协议自检结果
+	ReadOnly       bool             // 只读副本模式：仅HTTP API，数据来自主实例发布的状态快照
+
+	PersistenceReport *persistence.Report // 启动时持久化数据的版本迁移结果
+
+	steps []string // 已完成的启动步骤（按执行顺序）
+}
+
+// New 按依赖顺序构造并装配所有组件；任一必需步骤失败即返回错误
+func New(ctx context.Context, opts Options) (*Application, error) {
+	app := &Application{}
+
+	if opts.ConfigFile != "" {
+		if err := config.Load(opts.ConfigFile); err != nil {
+			return nil, fmt.Errorf("加载配置文件失败: %w", err)
+		}
+	}
+	app.Config = config.GetConfig()
+	app.ReadOnly = opts.ReadOnly || app.Config.Replica.ReadOnly
+	// 持久化数据版本策略须在任何存储加载之前生效（设备网关构造时即加载延迟命令队列）
+	if err := persistence.Default().Configure(app.Config.Persistence); err != nil {
+		return nil, err
+	}
+	app.step("config")
+
+	// 事件总线：通知集成器与SSE等内部消费者共用，须先于发布事件的组件创建
+	events.InitGlobalBus(events.Options{
+		TopicCapacity:    app.Config.EventBus.TopicCapacity,
+		SubscriberBuffer: app.Config.EventBus.SubscriberBuffer,
+	})
+	app.step("event_bus")
+
+	if !opts.CoreOnly {
+		improvedLogger, err := setupLogger(app.Config.Logger)
+		if err != nil {
+			return nil, err
+		}
+		app.Logger = improvedLogger
+		utils.SetupImprovedZinxLogger(improvedLogger)
+		app.step("logger")
+	}
+
+	// 协议自检：编解码回归时在接入任何设备之前中止启动（可配置为降级启动）
+	app.SelfTest = selftest.Run(selftest.TriggerStartup)
+	if !app.SelfTest.OK {
+		if !app.Config.SelfTest.AllowDegradedStart {
+			logger.WithFields(logrus.Fields{"failures": app.SelfTest.Failures()}).Error("❌ 协议自检失败，中止启动")
+			return nil, fmt.Errorf("%s", app.SelfTest.Summary())
+		}
+		logger.WithFields(logrus.Fields{"failures": app.SelfTest.Failures()}).Warn("⚠️ 协议自检失败，按配置降级启动")
+	}
+	app.step("self_test")
+
+	// 核心组件：设备网关构造时依赖TCP管理器与命令管理器（注入连接清理回调）
+	app.TCPManager = core.InitGlobalTCPManager(nil)
+	capability.OnChange(app.TCPManager.RefreshDeviceCapabilities)
+	app.step("tcp_manager")
+	app.CommandManager = network.InitCommandManager()
+	retryCfg := app.Config.DeviceConnection.CommandRetry
+	app.CommandManager.SetRetryPolicy(network.RetryPolicy{
+		Interval:    time.Duration(retryCfg.IntervalMs) * time.Millisecond,
+		MaxRetries:  commandMaxRetries(retryCfg.MaxRetries),
+		Exponential: retryCfg.Exponential,
+		MaxInterval: time.Duration(retryCfg.MaxIntervalMs) * time.Millisecond,
+	})
+	app.step("command_manager")
+	app.Gateway = gateway.InitializeGlobalDeviceGateway()
+	app.Gateway.SetReadOnly(app.ReadOnly)
+	app.wireCommandFailures()
+	app.step("gateway")
+
+	if !opts.CoreOnly {
+		// Redis与虚拟子设备注册表失败不影响核心功能
+		if err := redis.InitClient(); err != nil {
+			warn("Redis连接失败，但不影响核心功能", err)
+		}
+		// 运行中Redis不可达时各功能按统一策略降级运行，/readyz 报告 degraded，恢复后回放暂存写入
+		redis.InitGlobalHealth(ctx)
+		lifecycle.GetReadiness().AddDegradationCheck("redis", redis.DegradedReason)
+		idempotency.InitGlobalGuard()
+		idempotency.InitGlobalResponses()
+		app.step("redis")
+		// 只读副本不下发命令也不接收上报，且不得以自身（空的）状态覆盖主实例在共享存储中的记录
+		if !app.ReadOnly {
+			// 消息ID序列须在任何命令下发之前恢复，避免重启后重复设备最近见过的消息ID
+			if err := msgid.InitGlobalSequence(ctx); err != nil {
+				warn("恢复消息ID序列失败，本次从内存序列开始分配", err)
+			}
+			app.step("message_id")
+			// 停机积压重放审批：须在延迟命令、通知暂存与关键帧日志开始常规重放之前根据停机时长决定是否暂缓
+			if coordinator, err := replay.InitGlobalCoordinator(); err != nil {
+				warn("初始化停机积压重放审批失败，积压工作照常自动重放", err)
+			} else if coordinator != nil {
+				coordinator.Register(replay.CategoryDeferredCommands, "等待设备上线的延迟命令", app.Gateway.GetDeferredQueue().ReplaySource())
+				app.step("post_outage_replay")
+			}
+			if err := energy.InitGlobalCounters(ctx); err != nil {
+				warn("恢复端口累计电量失败，本次从内存计数开始累计", err)
+			}
+			app.step("energy_counters")
+			if err := availability.InitGlobalTracker(ctx); err != nil {
+				warn("恢复端口状态历史失败，本次从内存开始记录", err)
+			}
+			app.step("port_availability")
+			if err := app.Gateway.AttachChargingSessionStore(config.GetConfig().ChargingSessions); err != nil {
+				warn("恢复充电会话失败，本次从内存开始跟踪", err)
+			}
+			app.step("charging_sessions")
+		}
+		commlog.InitGlobalLog()
+		app.step("comm_log")
+		// 只读副本不接收心跳，不做异常检测
+		if app.ReadOnly {
+			anomaly.SetGlobalDetector(nil)
+		} else {
+			anomaly.InitGlobalDetector()
+		}
+		app.step("anomaly_detection")
+		// 全网在线设备数告警：只读副本不持有设备连接，不采样
+		if app.ReadOnly {
+			fleetalert.SetGlobalMonitor(nil)
+		} else {
+			fleetalert.InitGlobalMonitor(ctx, app.Gateway.OnlineDevicesByICCID)
+		}
+		app.step("fleet_alerts")
+		// 租户命令成功率SLA：只读副本不下发命令，不统计
+		if app.ReadOnly {
+			sla.SetGlobalTracker(nil)
+		} else {
+			sla.InitGlobalTracker(ctx)
+		}
+		app.wireSLA()
+		app.step("sla")
+		// 连接会话归档：只读副本不持有设备连接，不归档
+		if app.ReadOnly {
+			sessionarchive.SetGlobalArchive(nil)
+		} else if err := sessionarchive.InitGlobalArchive(ctx); err != nil {
+			warn("初始化连接会话归档失败，已关闭的连接将不被归档", err)
+		}
+		app.wireSessionArchive()
+		app.step("session_archive")
+		// 协议会话抽样跟踪：须在TCP服务器接入设备之前设置；只读副本不持有设备连接
+		if app.ReadOnly {
+			tracesample.SetGlobalSampler(nil)
+		} else if err := tracesample.InitGlobalSampler(ctx); err != nil {
+			warn("初始化协议会话抽样跟踪失败，连接将不被抽样", err)
+		}
+		app.wireTraceSampling()
+		app.step("trace_sampling")
+		// 数据域加密：须在TCP服务器接入设备之前加载密钥；只读副本不处理设备帧
+		if app.ReadOnly {
+			payloadcrypto.SetGlobalManager(nil)
+		} else if err := payloadcrypto.InitGlobalManager(); err != nil {
+			warn("初始化数据域加密失败，声明了密钥ID的设备帧将无法解密", err)
+		}
+		app.step("payload_crypto")
+		// 处理器panic恢复：须在TCP服务器注册路由之前加载已隔离的记录；只读副本不处理设备帧
+		if !app.ReadOnly {
+			if _, err := handlerguard.InitGlobalGuard(); err != nil {
+				warn("打开处理器panic隔离目录失败，隔离记录仅保存在内存中", err)
+			}
+		}
+		app.step("handler_guard")
+		// 重复帧抑制：只读副本不处理设备帧
+		if !app.ReadOnly {
+			if _, err := framededup.InitGlobalDeduper(); err != nil {
+				warn("frameDedup.commands 配置无效，按默认命令（注册）抑制重复帧", err)
+			}
+		} else {
+			framededup.SetGlobalDeduper(nil)
+		}
+		app.step("frame_dedup")
+		// 停用黑名单须在TCP服务器接入设备之前恢复，否则重启后已停用设备可重新注册
+		if err := decommission.InitGlobalRegistry(); err != nil {
+			warn("恢复设备停用归档失败，黑名单仅保存在内存中", err)
+		}
+		app.step("decommission")
+		if err := virtual.InitGlobalRegistry(); err != nil {
+			warn("初始化虚拟子设备注册表失败", err)
+		}
+		app.step("virtual_registry")
+		// 集群设备归属：Redis不可用时退化为单实例（所有设备归属本实例）；只读副本不持有设备
+		if !app.ReadOnly {
+			if err := cluster.InitGlobalOwnership(ctx, app.Gateway); err != nil {
+				warn("初始化集群设备归属失败", err)
+			}
+			app.step("cluster_ownership")
+		}
+		// 设备会话持久化：须在TCP服务器接入设备之前载入恢复中设备；Redis不可用时不影响设备接入；只读副本不持有设备
+		if app.ReadOnly {
+			devicesession.SetGlobalRegistry(nil)
+		} else if err := devicesession.InitGlobalRegistry(ctx, app.Gateway.IsDeviceOnline); err != nil {
+			warn("初始化设备会话持久化失败", err)
+		}
+		app.wireDeviceSessions()
+		app.step("device_sessions")
+		// 只读副本：主实例发布状态快照，副本读取快照；副本无法读取快照时无数据可提供，中止启动
+		if err := replica.InitGlobal(ctx, app.Gateway, app.ReadOnly); err != nil {
+			if app.ReadOnly {
+				return nil, err
+			}
+			warn("只读副本状态发布未启动", err)
+		}
+		app.step("replica")
+	}
+
+	// 通知系统：必须在TCP管理器与设备网关之后，回调才能注册到真实实例
+	if err := notification.InitGlobalNotificationIntegrator(ctx); err != nil {
+		warn("初始化通知系统失败", err)
+	}
+	app.Notification = notification.GetGlobalNotificationIntegrator()
+	app.wireNotifications()
+	if source := app.Notification.SpoolReplaySource(); source != nil {
+		replay.GetGlobalCoordinator().Register(replay.CategoryNotificationSpool, "重试用尽后暂存的通知", source)
+	}
+	app.step("notification")
+
+	if !opts.CoreOnly {
+		if err := audit.InitGlobalEngine(ctx); err != nil {
+			warn("初始化合规审计引擎失败", err)
+		}
+		if err := asset.InitGlobalResolver(ctx); err != nil {
+			warn("初始化资产解析器失败", err)
+		}
+		// 设备能力矩阵：须在TCP服务器接入设备之前加载，注册时才能推导能力集
+		if err := capability.InitGlobalRegistry(ctx); err != nil {
+			warn("加载设备能力矩阵失败，不做固件能力校验", err)
+		}
+		if err := chargepolicy.InitGlobalChecker(ctx); err != nil {
+			warn("加载充电参数策略失败，不做充电参数限制", err)
+		}
+		if err := lowdata.InitGlobalRegistry(ctx); err != nil {
+			warn("加载低流量模式分配失败，不启用低流量模式", err)
+		}
+		// 运维变更记录：快照读取网关内存状态
+		if err := changelog.InitGlobalLog(ctx); err != nil {
+			warn("初始化运维变更记录失败，不记录变更", err)
+		} else if l := changelog.GetGlobalLog(); l != nil {
+			l.SetSnapshotter(func(deviceID string) interface{} {
+				return app.Gateway.DeviceStateSnapshot(deviceID)
+			})
+		}
+		// 响应塑形仅用于预发环境，environment 为 production 时拒绝启用
+		if err := shaping.InitGlobalShaper(); err != nil {
+			warn("响应塑形未启用", err)
+		}
+		if err := gateway.InitPromotionPolicy(); err != nil {
+			warn("初始化充电促销策略失败", err)
+		}
+		gateway.InitDynamicPowerController()
+		statedump.InitGlobalDumper(capture.Sections(app.Config.StateDump.EventLimit))
+		app.step("extensions")
+
+		if !app.ReadOnly {
+			// 结算日志存储：须在对账接入与关键帧日志重放之前打开（启动时重建索引）
+			store, err := settlement.InitGlobalStore()
+			if err != nil {
+				warn("打开结算日志存储失败，结算不再落盘即应答", err)
+			}
+			if store != nil {
+				app.Settlements = store
+				app.step("settlement_store")
+			}
+
+			// 对账台账：须在关键帧日志重放之前接入，重放的结算才能记入台账
+			if err := reconcile.InitGlobalReconciler(ctx); err != nil {
+				warn("初始化日终对账失败，台账仅保存在内存中", err)
+			}
+			app.Reconciler = reconcile.GetGlobalReconciler()
+			app.wireReconciliation()
+			app.step("reconciliation")
+
+			// 充电统计看板：须在关键帧日志重放之前接入，重放的结算才能计入统计
+			if err := chargestats.InitGlobalAggregator(ctx); err != nil {
+				warn("初始化充电统计失败，/api/v1/stats/charging 不可用", err)
+			}
+			app.wireChargeStats()
+			app.step("charge_stats")
+
+			// 关键帧日志：须在TCP服务器接收新帧之前重放上次未处理完的帧
+			frameJournal, err := journal.InitGlobalJournal()
+			if err != nil {
+				warn("打开关键帧预写日志失败，关键帧改为处理完成后再应答", err)
+			}
+			if frameJournal != nil {
+				app.FrameJournal = frameJournal
+				app.wireFrameJournal()
+				coordinator := replay.GetGlobalCoordinator()
+				coordinator.Register(replay.CategoryFrameJournal, "关键帧预写日志中未处理的上行帧", handlers.FrameJournalReplaySource(frameJournal))
+				if !coordinator.Held(replay.CategoryFrameJournal) {
+					handlers.ReplayFrameJournal(frameJournal)
+				}
+				app.step("frame_journal")
+			}
+			// 各子系统的积压均已登记：开始写入存活时间标记，配置了自动批准时开始按速率重放
+			if coordinator := replay.GetGlobalCoordinator(); coordinator != nil {
+				coordinator.Start()
+			}
+		}
+
+		app.HTTPServer = ports.NewHTTPServer()
+		if app.ReadOnly {
+			// 只读副本仅启动HTTP API
+			lifecycle.GetReadiness().Expect(lifecycle.ComponentHTTP)
+		} else {
+			// 两个服务均启动后 /readyz 才返回就绪
+			lifecycle.GetReadiness().Expect(lifecycle.ComponentHTTP, lifecycle.ComponentTCP)
+			// 按连接自适应读超时：告警阶段向设备下发网络状态查询作为探测（低流量模式下不探测，等待设备心跳）
+			network.InitGlobalReadDeadlineTracker().SetProbe(func(deviceID string) error {
+				return app.Gateway.SendProactivePoll(deviceID, lowdata.PollReadDeadlineProbe, constants.CmdNetworkStatus, nil)
+			})
+			app.TCPServer = ports.NewTCPServer()
+		}
+		app.step("servers")
+		// 热备：主实例复制交接状态并可发起接管；热备实例在接管激活前不接受设备连接
+		if !app.ReadOnly {
+			if err := app.wireStandby(ctx); err != nil {
+				warn("热备复制未启动", err)
+			} else if standby.GetGlobalController() != nil {
+				app.step("standby")
+			}
+		}
+	}
+
+	if err := app.finishPersistenceMigration(); err != nil {
+		return nil, err
+	}
+	app.step("persistence")
+
+	if err := app.VerifyWiring(); err != nil {
+		return nil, err
+	}
+	app.step("verify")
+
+	logger.WithFields(logrus.Fields{
+		"audit":    "startup",
+		"version":  app.SelfTest.Version,
+		"readOnly": app.ReadOnly,
+		"steps":    app.steps,
+		"selfTest": logrus.Fields{
+			"ok":         app.SelfTest.OK,
+			"passed":     app.SelfTest.Passed,
+			"total":      app.SelfTest.Total,
+			"durationMs": app.SelfTest.DurationMs,
+		},
+	}).Info("✅ 应用启动装配完成")
+	return app, nil
+}
+
+// Steps 已完成的启动步骤（按执行顺序）
+func (a *Application) Steps() []string {
+	return append([]string(nil), a.steps...)
+}
+
+func (a *Application) step(name string) {
+	a.steps = append(a.steps, name)
+}
+
+// Run 启动HTTP/TCP服务（只读副本仅HTTP）并阻塞到上下文取消（收到信号）或TCP服务启动失败，随后执行分阶段停机
+func (a *Application) Run(ctx context.Context) error {
+	if a.HTTPServer == nil || (a.TCPServer == nil && !a.ReadOnly) {
+		return fmt.Errorf("应用以 CoreOnly 模式启动，未创建服务器")
+	}
+
+	tcpErr := make(chan error, 1)
+	go func() {
+		if err := a.HTTPServer.Start(); err != nil {
+			warn("HTTP API服务器启动失败", err)
+		}
+	}()
+	if a.TCPServer != nil {
+		go func() {
+			if err := a.TCPServer.Start(); err != nil {
+				tcpErr <- err
+			}
+		}()
+		a.startIndexHealthChecker(ctx)
+		network.GetReadDeadlineTracker().Start(ctx)
+		a.CommandManager.Start()
+	}
+
+	a.startStateDumpSignal(ctx)
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.Info("接收到停止信号，开始关闭...")
+	case err := <-tcpErr:
+		runErr = fmt.Errorf("TCP服务器启动失败: %w", err)
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Error("TCP服务器启动失败，开始关闭...")
+	}
+	a.Shutdown("signal")
+	return runErr
+}
+
+// Shutdown 协调停机（摘流 → 拒绝新连接 → 排空命令 → 停HTTP → 关TCP）并释放外部依赖
+func (a *Application) Shutdown(reason string) {
+	ports.GracefulShutdown(reason, a.HTTPServer, a.TCPServer)
+	if a.CommandManager != nil {
+		a.CommandManager.Stop()
+	}
+	// 先中断进行中的积压重放（未完成的类别下次启动继续暂缓），再停止其依赖的通知与日志
+	replay.StopGlobalCoordinator()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := notification.StopGlobalNotificationIntegrator(stopCtx); err != nil {
+		warn("停止通知系统失败", err)
+	} else {
+		logger.Info("通知系统已停止")
+	}
+
+	audit.StopGlobalEngine()
+	reconcile.StopGlobalReconciler()
+	journal.StopGlobalJournal()
+	settlement.StopGlobalStore()
+	fleetalert.StopGlobalMonitor()
+	sla.StopGlobalTracker()
+	sessionarchive.StopGlobalArchive()
+	chargestats.StopGlobalAggregator()
+	tracesample.StopGlobalSampler()
+	devicesession.StopGlobalRegistry()
+	cluster.StopGlobalOwnership()
+	replica.StopGlobal()
+	standby.StopGlobal()
+	availability.StopGlobalTracker()
+	energy.StopGlobalCounters()
+	msgid.StopGlobalSequence()
+
+	redis.StopGlobalHealth()
+	if err := redis.Close(); err != nil {
+		warn("关闭Redis连接失败", err)
+	}
+	logger.StopTrafficLogger()
+}
+
+// startIndexHealthChecker 定期检查设备索引一致性（随上下文取消）
+func (a *Application) startIndexHealthChecker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(indexCheckInterval)
+		defer ticker.Stop()
+		a.TCPManager.PeriodicIndexHealthCheck()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("索引健康检查已停止")
+				return
+			case <-ticker.C:
+				a.TCPManager.PeriodicIndexHealthCheck()
+			}
+		}
+	}()
+}
+
+func setupLogger(loggerConfig config.LoggerConfig) (*logger.ImprovedLogger, error) {
+	improvedLogger := logger.NewImprovedLogger()
+	if err := improvedLogger.InitImproved(&loggerConfig); err != nil {
+		return nil, fmt.Errorf("初始化日志系统失败: %w", err)
+	}
+	if loggerConfig.EnableFile {
+		if err := improvedLogger.InitCommunicationLogger(loggerConfig.FileDir); err != nil {
+			warn("初始化通信日志失败", err)
+		}
+	}
+	if traffic := logger.InitTrafficLogger(loggerConfig.Traffic, loggerConfig.FileDir); traffic != nil {
+		logger.WithFields(logrus.Fields{
+			"file":        loggerConfig.Traffic.File,
+			"sampleRates": loggerConfig.Traffic.SampleRates,
+		}).Info("DNY流量日志已启用")
+	}
+	return improvedLogger, nil
+}
+
+// commandMaxRetries 配置的重发次数：0使用默认值，负数表示不重发
+func commandMaxRetries(configured int) int {
+	switch {
+	case configured == 0:
+		return network.CommandRetryCount
+	case configured < 0:
+		return 0
+	}
+	return configured
+}
+
+func warn(message string, err error) {
+	logger.WithFields(logrus.Fields{"error": err.Error()}).Warn(message)
+}
+
+var (
+	testApp     *Application
+	testAppOnce sync.Once
+)
+
+// InitForTest 以 CoreOnly 模式初始化全局组件（仅初始化一次），供测试在访问 Get* 全局实例前调用
+func InitForTest() *Application {
+	testAppOnce.Do(func() {
+		app, err := New(context.Background(), Options{CoreOnly: true})
+		if err != nil {
+			panic("bootstrap: 测试初始化失败: " + err.Error())
+		}
+		testApp = app
+	})
+	return testApp
+}
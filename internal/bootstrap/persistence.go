@@ -0,0 +1,57 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/sirupsen/logrus"
+)
+
+// 启动数据迁移在运维变更记录中的标识
+const (
+	persistenceAuditMethod   = "STARTUP"
+	persistenceAuditEndpoint = "startup/persistence-migration"
+)
+
+// finishPersistenceMigration 全部持久化存储加载完成后汇总迁移结果：存在版本未知且被拒绝的记录时中止启动，
+// 否则将各类型的迁移计数写入运维变更记录留痕
+func (a *Application) finishPersistenceMigration() error {
+	report := persistence.Default().Report()
+	a.PersistenceReport = &report
+
+	if len(report.Refused) > 0 {
+		logger.WithFields(logrus.Fields{
+			"audit":   "persistence_migration",
+			"refused": report.Refused,
+		}).Error("❌ 持久化数据版本高于当前程序支持的版本，拒绝启动")
+		return fmt.Errorf("%w: %s（请升级程序，或配置 persistence.unknownVersionPolicy=archive 归档后跳过）",
+			persistence.ErrFutureVersion, strings.Join(report.Refused, ", "))
+	}
+
+	logger.WithFields(logrus.Fields{
+		"audit":    "persistence_migration",
+		"policy":   report.Policy,
+		"migrated": report.Migrated(),
+		"types":    report.Types,
+	}).Info("持久化数据版本检查完成")
+
+	l := changelog.GetGlobalLog()
+	if l == nil || len(report.Types) == 0 {
+		return nil
+	}
+	body, _ := json.Marshal(report)
+	l.Append(changelog.Record{
+		KeyName:     "system",
+		Method:      persistenceAuditMethod,
+		Endpoint:    persistenceAuditEndpoint,
+		Path:        persistenceAuditEndpoint,
+		RequestBody: string(body),
+		Status:      200,
+		Message:     fmt.Sprintf("启动数据迁移 %d 条: %s", report.Migrated(), report.Summary()),
+	})
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump"
+	"github.com/sirupsen/logrus"
+)
+
+// startStateDumpSignal 收到 SIGUSR1 时转储事故现场状态（随上下文取消）
+func (a *Application) startStateDumpSignal(ctx context.Context) {
+	if !a.Config.StateDump.SignalEnable || statedump.GetGlobalDumper() == nil {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				if _, err := statedump.GetGlobalDumper().Dump("signal"); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Error("SIGUSR1 状态转储失败")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package bootstrap
+
+import "context"
+
+// startStateDumpSignal Windows 没有 SIGUSR1，仅支持经 POST /api/v1/admin/state-dump 转储
+func (a *Application) startStateDumpSignal(context.Context) {}
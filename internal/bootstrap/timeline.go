@@ -0,0 +1,75 @@
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// notificationTimelineTypes 通知事件类型 → 设备时间线条目类型（未列出的归为通知投递）
+var notificationTimelineTypes = map[string]string{
+	notification.EventTypeDeviceOnline:       gateway.TimelineTypeConnection,
+	notification.EventTypeDeviceOffline:      gateway.TimelineTypeConnection,
+	notification.EventTypeDeviceRegister:     gateway.TimelineTypeRegistration,
+	notification.EventTypeSIMFailover:        gateway.TimelineTypeConnection,
+	notification.EventTypeSettlement:         gateway.TimelineTypeSettlement,
+	notification.EventTypeDeviceError:        gateway.TimelineTypeAlarm,
+	notification.EventTypePortError:          gateway.TimelineTypeAlarm,
+	notification.EventTypeICCIDConflict:      gateway.TimelineTypeAlarm,
+	notification.EventTypeChargingFailed:     gateway.TimelineTypeAlarm,
+	notification.EventTypeChargeQueueTimeout: gateway.TimelineTypeAlarm,
+	notification.EventTypeChargingStart:      gateway.TimelineTypeCharging,
+	notification.EventTypeChargingEnd:        gateway.TimelineTypeCharging,
+	notification.EventTypeChargeQueued:       gateway.TimelineTypeCharging,
+
+	notification.EventTypeDeviceDecommissioned:       gateway.TimelineTypeRegistration,
+	notification.EventTypeDeviceRecommissioned:       gateway.TimelineTypeRegistration,
+	notification.EventTypeDeviceRegistrationRejected: gateway.TimelineTypeAlarm,
+	notification.EventTypeDeviceAnomaly:              gateway.TimelineTypeAlarm,
+	notification.EventTypeCommandFailed:              gateway.TimelineTypeAlarm,
+}
+
+// notificationTimelineDetailKeys 摘要中展示的事件字段（按顺序）
+var notificationTimelineDetailKeys = []string{"orderNo", "reason", "stop_reason", "total_fee", "error", "from_iccid", "to_iccid", "metric", "direction"}
+
+// collectNotificationTimeline 从通知事件记录器（内存环形缓冲）读取设备相关事件
+// 远程重启事件由重启记录提供，这里跳过避免重复
+func collectNotificationTimeline(deviceID string, from, _ time.Time) ([]gateway.TimelineEntry, error) {
+	filter := &notification.Filter{DeviceID: deviceID}
+	if !from.IsZero() {
+		filter.SinceUnix = from.Unix()
+	}
+	var entries []gateway.TimelineEntry
+	for _, ev := range notification.GetGlobalRecorder().RecentFiltered(0, filter) {
+		switch ev.EventType {
+		case notification.EventTypeDeviceRebootIssued, notification.EventTypeDeviceRebootCompleted, notification.EventTypeDeviceRebootFailed:
+			continue
+		}
+		entryType, ok := notificationTimelineTypes[ev.EventType]
+		if !ok {
+			entryType = gateway.TimelineTypeNotification
+		}
+		summary := "通知 " + ev.EventType
+		for _, key := range notificationTimelineDetailKeys {
+			if v, ok := ev.Data[key]; ok && fmt.Sprint(v) != "" {
+				summary += fmt.Sprintf(" %s=%v", key, v)
+			}
+		}
+		entry := gateway.TimelineEntry{
+			Timestamp: ev.Timestamp,
+			Source:    gateway.TimelineSourceNotification,
+			Type:      entryType,
+			Summary:   summary,
+			RefID:     ev.EventID,
+			Data:      map[string]interface{}{"event_type": ev.EventType},
+		}
+		if ev.PortNumber > 0 {
+			port := ev.PortNumber
+			entry.Port = &port
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,584 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/anomaly"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/chargestats"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/bujia-iot/iot-zinx/pkg/devicesession"
+	"github.com/bujia-iot/iot-zinx/pkg/fleetalert"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/bujia-iot/iot-zinx/pkg/sessionarchive"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/bujia-iot/iot-zinx/pkg/sla"
+	"github.com/bujia-iot/iot-zinx/pkg/standby"
+	"github.com/bujia-iot/iot-zinx/pkg/tracesample"
+)
+
+// 跨组件回调名称（装配自检与日志使用）
+const (
+	CallbackCommandSweep   = "tcp_manager.connection_cleanup → command_manager"
+	CallbackPortStatus     = "port_manager.status_change → notification"
+	CallbackICCID          = "iccid_conflict → notification"
+	CallbackChargeQueue    = "charge_queue → notification"
+	CallbackReboot         = "reboot_tracker → notification"
+	CallbackDecommission   = "decommission → notification"
+	CallbackFrameJournal   = "frame_journal.alert → notification"
+	CallbackReconcile      = "order_manager.change → reconcile_ledger"
+	CallbackAnomaly        = "anomaly_detector.episode → notification"
+	CallbackRedisHealth    = "redis_health.transition → notification"
+	CallbackFleetAlert     = "fleet_monitor.alert → notification"
+	CallbackSLA            = "command_manager.outcome → sla_tracker"
+	CallbackSLAAlert       = "sla_tracker.alert → notification"
+	CallbackSessionArchive = "tcp_manager.connection_closed → session_archive"
+	CallbackChargeStats    = "order_manager.change → charge_stats"
+	CallbackChargeSettled  = "settlement_store.append → charge_stats"
+	CallbackTraceSampling  = "tcp_manager.connection_accept → trace_sampler"
+	CallbackDeviceSessions = "tcp_manager.device_activity → device_sessions"
+	CallbackCommandFailed  = "command_manager.failure → gateway"
+	CallbackCommandNotify  = "command_manager.failure → notification"
+)
+
+// wireNotifications 将核心组件事件接入通知系统（通知未启用时不注册）
+func (a *Application) wireNotifications() {
+	n := a.Notification
+	if n == nil || !n.IsEnabled() {
+		return
+	}
+
+	lifecycle.GetReadiness().AddWarningCheck("notification_spool", n.SpoolWarning)
+
+	core.GetPortManager().RegisterStatusChangeCallback(func(deviceID string, portNumber int, oldStatus, newStatus string, data map[string]interface{}) {
+		n.NotifyPortStatusChange(deviceID, portNumber, oldStatus, newStatus, data)
+	})
+
+	a.TCPManager.GetICCIDConflictDetector().RegisterHandler(func(conflict core.ICCIDConflict) {
+		deviceID := ""
+		if len(conflict.Incoming.DeviceIDs) > 0 {
+			deviceID = conflict.Incoming.DeviceIDs[0]
+		}
+		n.NotifyICCIDConflict(deviceID, map[string]interface{}{
+			"iccid":                 conflict.ICCID,
+			"policy":                conflict.Policy,
+			"ip_match":              conflict.IPMatch,
+			"effective_iccid":       conflict.EffectiveICCID,
+			"existing_conn_id":      conflict.Existing.ConnID,
+			"existing_remote_addr":  conflict.Existing.RemoteAddr,
+			"existing_device_ids":   conflict.Existing.DeviceIDs,
+			"existing_connected_at": conflict.Existing.ConnectedAt.Unix(),
+			"incoming_conn_id":      conflict.Incoming.ConnID,
+			"incoming_remote_addr":  conflict.Incoming.RemoteAddr,
+			"detected_at":           conflict.DetectedAt.Unix(),
+		})
+	})
+
+	a.TCPManager.GetSIMPairRegistry().RegisterHandler(func(failover core.SIMFailover) {
+		n.NotifySIMFailover(failover.DeviceID, map[string]interface{}{
+			"from_iccid":   failover.FromICCID,
+			"to_iccid":     failover.ToICCID,
+			"from_conn_id": failover.FromConnID,
+			"to_conn_id":   failover.ToConnID,
+			"overlap":      failover.Overlap,
+			"failover_at":  failover.At.Unix(),
+		})
+	})
+
+	a.Gateway.GetChargeQueue().RegisterHandler(func(event gateway.ChargeQueueEvent) {
+		data := map[string]interface{}{
+			"orderNo":        event.Charge.OrderNo,
+			"wait_ports":     fmt.Sprintf("0x%04X", event.Charge.WaitPorts),
+			"waiting_ports":  event.Charge.WaitingPorts,
+			"queued_at":      event.Charge.QueuedAt.Unix(),
+			"correlation_id": event.Charge.CorrelationID,
+		}
+		switch event.Type {
+		case gateway.ChargeQueueEventQueued:
+			data["deadline"] = event.Charge.Deadline.Unix()
+			n.NotifyChargeQueued(event.Charge.DeviceID, event.Charge.Port, data)
+		case gateway.ChargeQueueEventStarted:
+			data["from_queue"] = true
+			data["waited_seconds"] = int64(event.Waited.Seconds())
+			n.NotifyChargeQueueStarted(event.Charge.DeviceID, event.Charge.Port, data)
+		case gateway.ChargeQueueEventTimeout:
+			data["waited_seconds"] = int64(event.Waited.Seconds())
+			data["auto_cancelled"] = event.AutoCancelled
+			if event.CancelError != "" {
+				data["cancel_error"] = event.CancelError
+			}
+			n.NotifyChargeQueueTimeout(event.Charge.DeviceID, event.Charge.Port, data)
+		}
+	})
+
+	a.Gateway.GetRebootTracker().RegisterHandler(func(event gateway.RebootEvent) {
+		data := map[string]interface{}{
+			"reboot_id":      event.Record.ID,
+			"force":          event.Record.Force,
+			"issued_at":      event.Record.IssuedAt.Unix(),
+			"deadline":       event.Record.Deadline.Unix(),
+			"correlation_id": event.Record.CorrelationID,
+		}
+		if len(event.Record.InterruptedOrders) > 0 {
+			data["interrupted_orders"] = event.Record.InterruptedOrders
+		}
+		if event.Record.CompletedAt != nil {
+			data["completed_at"] = event.Record.CompletedAt.Unix()
+			data["elapsed_seconds"] = int64(event.Record.CompletedAt.Sub(event.Record.IssuedAt).Seconds())
+		}
+		eventType := notification.EventTypeDeviceRebootIssued
+		switch event.Type {
+		case gateway.RebootEventCompleted:
+			eventType = notification.EventTypeDeviceRebootCompleted
+		case gateway.RebootEventFailed:
+			eventType = notification.EventTypeDeviceRebootFailed
+			data["error"] = event.Record.Error
+		}
+		n.NotifyDeviceReboot(eventType, event.Record.DeviceID, data)
+	})
+
+	decommission.GetGlobalRegistry().RegisterHandler(func(event decommission.Event) {
+		data := map[string]interface{}{
+			"reason":            event.Record.Reason,
+			"operator":          event.Record.Operator,
+			"decommissioned_at": event.Record.DecommissionedAt.Unix(),
+		}
+		eventType := notification.EventTypeDeviceDecommissioned
+		switch event.Type {
+		case decommission.EventDecommissioned:
+			data["was_online"] = event.Record.WasOnline
+			data["correlation_id"] = event.Record.CorrelationID
+		case decommission.EventRecommissioned:
+			eventType = notification.EventTypeDeviceRecommissioned
+			data["recommission_reason"] = event.Record.Recommission.Reason
+			data["recommission_operator"] = event.Record.Recommission.Operator
+			data["recommissioned_at"] = event.Record.Recommission.At.Unix()
+		case decommission.EventRegistrationRejected:
+			eventType = notification.EventTypeDeviceRegistrationRejected
+			data["error_code"] = decommission.ErrorCodeDecommissioned
+			data["remote_addr"] = event.RemoteAddr
+			data["rejected_registrations"] = event.Record.RejectedRegistrations
+		}
+		n.NotifyDeviceDecommission(eventType, event.Record.DeviceID, data)
+	})
+
+	if detector := anomaly.GetGlobalDetector(); detector != nil {
+		detector.RegisterHandler(func(ep anomaly.Episode) {
+			n.NotifyDeviceAnomaly(ep.DeviceID, ep.Port, map[string]interface{}{
+				"episode_id":      ep.ID,
+				"metric":          ep.Metric,
+				"kind":            ep.Kind,
+				"direction":       ep.Direction,
+				"value":           ep.StartValue,
+				"baseline_mean":   ep.BaselineMean,
+				"baseline_stddev": ep.BaselineStd,
+				"deviation_sigma": ep.PeakDeviation,
+				"started_at":      ep.StartedAt.Unix(),
+			})
+		})
+	}
+
+	// 降级与恢复各通知一次（redis_degraded / redis_recovered）
+	if health := redis.GetGlobalHealth(); health.Client() != nil {
+		health.RegisterHandler(func(t redis.Transition) {
+			if t.To == redis.StatusDegraded {
+				n.NotifyRedisDegraded(map[string]interface{}{
+					"reason":   t.Reason,
+					"since":    t.At.Unix(),
+					"policies": redis.DegradationPolicies,
+				})
+				return
+			}
+			n.NotifyRedisRecovered(map[string]interface{}{
+				"degraded_seconds": int64(t.Duration.Seconds()),
+				"replayed":         t.Replayed,
+				"dropped":          t.Dropped,
+			})
+		})
+	}
+
+	// 全网在线设备数告警：开启与恢复各通知一次
+	if monitor := fleetalert.GetGlobalMonitor(); monitor != nil {
+		monitor.RegisterHandler(func(alert fleetalert.Alert) {
+			data := map[string]interface{}{
+				"alert_id":     alert.ID,
+				"rule":         alert.Rule,
+				"rule_type":    alert.Type,
+				"reference":    alert.Reference,
+				"online":       alert.Online,
+				"drop":         alert.Drop,
+				"drop_percent": alert.DropPercent,
+				"started_at":   alert.StartedAt.Unix(),
+			}
+			if alert.State == fleetalert.StateResolved {
+				data["lowest"] = alert.Lowest
+				data["peak_drop_percent"] = alert.PeakPercent
+				data["resolved_at"] = alert.ResolvedAt.Unix()
+				n.NotifyFleetOnlineRecovered(data)
+				return
+			}
+			data["window_seconds"] = alert.WindowSecs
+			data["disconnected_devices"] = alert.DisconnectedDevices
+			data["disconnected_iccid_count"] = alert.DisconnectedICCIDs
+			data["disconnected_iccids"] = alert.ICCIDs
+			data["iccid_prefixes"] = alert.Prefixes
+			data["scope"] = alert.Scope
+			n.NotifyFleetOnlineDrop(data)
+		})
+	}
+
+	// 租户命令成功率SLA告警：按租户路由，开启与恢复各通知一次
+	if tracker := sla.GetGlobalTracker(); tracker != nil {
+		tracker.RegisterHandler(func(alert sla.Alert) {
+			data := map[string]interface{}{
+				"alert_id":              alert.ID,
+				"rule":                  alert.Rule,
+				"tenant_id":             alert.TenantID,
+				"threshold_percent":     alert.ThresholdPercent,
+				"success_rate":          alert.SuccessRate,
+				"counted":               alert.Counted,
+				"attributable_failures": alert.AttributableFailures,
+				"dominant_failure":      alert.DominantFailure,
+				"dominant_count":        alert.DominantCount,
+				"failures":              alert.Failures,
+				"window":                sla.Window24h,
+				"started_at":            alert.StartedAt.Unix(),
+			}
+			if alert.State == sla.StateResolved {
+				data["lowest_rate"] = alert.LowestRate
+				data["resolved_at"] = alert.ResolvedAt.Unix()
+				n.NotifyTenantSLARecovered(alert.TenantID, data)
+				return
+			}
+			n.NotifyTenantSLABreached(alert.TenantID, data)
+		})
+	}
+
+	// 命令重发耗尽：command_failed（开始充电命令附订单号与端口）；网关的失败回调先注册，订单已置为失败
+	a.CommandManager.RegisterFailureHandler(func(failure network.CommandFailure) {
+		data := map[string]interface{}{
+			"command":        fmt.Sprintf("0x%02X", failure.Command),
+			"message_id":     fmt.Sprintf("0x%04X", failure.MessageID),
+			"attempts":       failure.Attempts,
+			"outcome":        failure.Outcome,
+			"reason":         failure.Reason,
+			"failed_at":      failure.At.Unix(),
+			"correlation_id": failure.CorrelationID,
+		}
+		port := 0
+		if p, orderNo, ok := gateway.StartChargeOrder(failure.Data); ok && failure.Command == constants.CmdChargeControl {
+			port = p
+			data["orderNo"] = orderNo
+		}
+		n.NotifyCommandFailed(failure.DeviceID, port, data)
+	})
+
+	// 通知事件记录作为设备时间线的可选来源
+	gateway.RegisterTimelineSource(gateway.TimelineSourceNotification, collectNotificationTimeline)
+
+	logger.Info("✅ 通知回调已注册（端口状态/ICCID冲突/充电排队/远程重启/设备停用/心跳异常/Redis降级/在线设备数告警/租户SLA告警/命令失败/设备时间线）")
+}
+
+// wireCommandFailures 命令放弃重发时由网关将未得到应答的开始充电订单置为失败（须在通知回调之前注册）
+func (a *Application) wireCommandFailures() {
+	a.CommandManager.RegisterFailureHandler(a.Gateway.OnCommandFailed)
+}
+
+// wireSLA 命令结束结果按设备所属租户计入SLA统计（统计未启用时移除观察者）
+func (a *Application) wireSLA() {
+	tracker := sla.GetGlobalTracker()
+	if tracker == nil {
+		network.SetCommandOutcomeObserver(nil)
+		return
+	}
+	network.SetCommandOutcomeObserver(func(result network.CommandResult) {
+		tenant := ""
+		if info, ok := asset.Lookup(result.DeviceID); ok {
+			tenant = info.TenantID
+		}
+		tracker.Record(tenant, sla.Class(result.Outcome))
+	})
+}
+
+// wireSessionArchive 已关闭的连接会话提交到归档队列（归档未启用时移除观察者）
+func (a *Application) wireSessionArchive() {
+	archive := sessionarchive.GetGlobalArchive()
+	if archive == nil {
+		a.TCPManager.SetClosedSessionObserver(nil)
+		return
+	}
+	a.TCPManager.SetClosedSessionObserver(func(s core.ClosedSession) {
+		archive.Submit(sessionarchive.FromClosedSession(s))
+	})
+}
+
+// wireTraceSampling 新连接接入与身份确定时交由抽样决定是否跟踪（抽样未启用时移除）
+func (a *Application) wireTraceSampling() {
+	sampler := tracesample.GetGlobalSampler()
+	if sampler == nil {
+		a.TCPManager.SetConnTraceSampler(nil)
+		return
+	}
+	a.TCPManager.SetConnTraceSampler(sampler)
+}
+
+// wireDeviceSessions 设备注册与心跳提交到设备会话持久化（未启用时移除观察者）
+func (a *Application) wireDeviceSessions() {
+	registry := devicesession.GetGlobalRegistry()
+	if registry == nil {
+		a.TCPManager.SetDeviceActivityObserver(nil)
+		return
+	}
+	a.TCPManager.SetDeviceActivityObserver(registry.Observe)
+}
+
+// wireChargeStats 订单开始与结束、新落盘的结算按设备所属租户计入充电统计（统计未启用时不注册）
+func (a *Application) wireChargeStats() {
+	stats := chargestats.GetGlobalAggregator()
+	if stats == nil {
+		return
+	}
+	a.Gateway.GetOrderManager().RegisterChangeHandler(func(order gateway.OrderState) {
+		ev := chargestats.OrderEvent{
+			OrderNo:   order.OrderNo,
+			DeviceID:  order.DeviceID,
+			Status:    order.Status.String(),
+			StartTime: order.StartTime,
+			UpdatedAt: order.LastUpdate,
+		}
+		if order.EndTime != nil {
+			ev.EndTime = *order.EndTime
+		}
+		if info, ok := asset.Lookup(order.DeviceID); ok {
+			ev.TenantID = info.TenantID
+		}
+		stats.RecordOrder(ev)
+	})
+	if a.Settlements == nil {
+		return
+	}
+	a.Settlements.RegisterAppendHandler(func(rec settlement.Record) {
+		ev := chargestats.SettlementEvent{
+			OrderNo:    rec.OrderNo,
+			DeviceID:   rec.DeviceID,
+			EnergyWh:   rec.EnergyWh,
+			StartTime:  rec.StartTime,
+			EndTime:    rec.EndTime,
+			ReceivedAt: rec.ReceivedAt,
+		}
+		if info, ok := asset.Lookup(rec.DeviceID); ok {
+			ev.TenantID = info.TenantID
+		}
+		stats.RecordSettlement(ev)
+	})
+}
+
+// wireFrameJournal 关键帧日志降级/恢复告警接入通知系统
+func (a *Application) wireFrameJournal() {
+	n := a.Notification
+	if a.FrameJournal == nil || n == nil || !n.IsEnabled() {
+		return
+	}
+	a.FrameJournal.RegisterAlertHandler(func(alert journal.Alert) {
+		n.NotifyFrameJournalDegraded(map[string]interface{}{
+			"alert":           alert.Type,
+			"reason":          alert.Reason,
+			"total_bytes":     alert.TotalBytes,
+			"max_total_bytes": alert.MaxTotalBytes,
+			"pending":         alert.Pending,
+			"at":              alert.At.Unix(),
+		})
+	})
+}
+
+// wireReconciliation 订单变更记入对账台账，结算日志存储作为对账结算来源；配置开启时定时对账报告接入通知系统
+func (a *Application) wireReconciliation() {
+	if a.Reconciler == nil {
+		return
+	}
+	if a.Settlements != nil {
+		a.Reconciler.SetSettlementSource(settlement.ReconcileSource(a.Settlements))
+	}
+	ledger := a.Reconciler.Ledger()
+	a.Gateway.GetOrderManager().RegisterChangeHandler(func(order gateway.OrderState) {
+		rec := reconcile.SessionRecord{
+			OrderNo:   order.OrderNo,
+			DeviceID:  order.DeviceID,
+			Port:      order.Port,
+			Mode:      order.Mode,
+			Value:     order.Value,
+			StartTime: order.StartTime,
+			Status:    order.Status.String(),
+			Reason:    order.ErrorReason,
+			UpdatedAt: order.LastUpdate,
+			QueuedAt:  order.QueuedAt,
+		}
+		if order.Promotion != nil {
+			rec.PromotionTag = order.Promotion.Tag
+		}
+		if info, ok := asset.Lookup(order.DeviceID); ok {
+			rec.Tenant = info.TenantID
+		}
+		ledger.RecordSession(rec)
+	})
+
+	n := a.Notification
+	if !a.Config.Reconciliation.Notify || n == nil || !n.IsEnabled() {
+		return
+	}
+	a.Reconciler.RegisterHandler(func(report *reconcile.Report) {
+		data := report.Summary()
+		missing := make([]string, 0, len(report.MissingSettlements))
+		for _, s := range report.MissingSettlements {
+			missing = append(missing, s.OrderNo)
+		}
+		orphans := make([]string, 0, len(report.OrphanSettlements))
+		for _, s := range report.OrphanSettlements {
+			orphans = append(orphans, s.OrderNo)
+		}
+		data["missing_order_nos"] = missing
+		data["orphan_order_nos"] = orphans
+		n.NotifyReconciliationReport(data)
+	})
+}
+
+// ExpectedCallbacks 按当前配置应当注册的跨组件回调
+func (a *Application) ExpectedCallbacks() []string {
+	expected := []string{CallbackCommandSweep, CallbackCommandFailed}
+	if a.Notification != nil && a.Notification.IsEnabled() {
+		expected = append(expected, CallbackPortStatus, CallbackICCID, CallbackChargeQueue, CallbackReboot, CallbackDecommission, CallbackCommandNotify)
+		if a.FrameJournal != nil {
+			expected = append(expected, CallbackFrameJournal)
+		}
+		if anomaly.GetGlobalDetector() != nil {
+			expected = append(expected, CallbackAnomaly)
+		}
+		if redis.GetGlobalHealth().Client() != nil {
+			expected = append(expected, CallbackRedisHealth)
+		}
+		if fleetalert.GetGlobalMonitor() != nil {
+			expected = append(expected, CallbackFleetAlert)
+		}
+		if sla.GetGlobalTracker() != nil {
+			expected = append(expected, CallbackSLAAlert)
+		}
+	}
+	if sla.GetGlobalTracker() != nil {
+		expected = append(expected, CallbackSLA)
+	}
+	if sessionarchive.GetGlobalArchive() != nil {
+		expected = append(expected, CallbackSessionArchive)
+	}
+	if a.Reconciler != nil {
+		expected = append(expected, CallbackReconcile)
+	}
+	if chargestats.GetGlobalAggregator() != nil {
+		expected = append(expected, CallbackChargeStats)
+		if a.Settlements != nil {
+			expected = append(expected, CallbackChargeSettled)
+		}
+	}
+	if tracesample.GetGlobalSampler() != nil {
+		expected = append(expected, CallbackTraceSampling)
+	}
+	if devicesession.GetGlobalRegistry() != nil {
+		expected = append(expected, CallbackDeviceSessions)
+	}
+	return expected
+}
+
+// RegisteredCallbacks 检查目标组件后返回实际已注册的跨组件回调
+func (a *Application) RegisteredCallbacks() map[string]bool {
+	// 订单变更回调由对账台账与充电统计共用：充电统计注册在对账台账之后
+	orderHandlers := a.Gateway.GetOrderManager().ChangeHandlerCount()
+	reconcileHandlers := 0
+	if a.Reconciler != nil {
+		reconcileHandlers = 1
+	}
+	// 命令失败回调由网关与通知共用：通知注册在网关之后
+	failureHandlers := a.CommandManager.FailureHandlerCount()
+	return map[string]bool{
+		CallbackCommandSweep:   a.TCPManager.HasConnectionCleanupHandler(),
+		CallbackCommandFailed:  failureHandlers > 0,
+		CallbackCommandNotify:  failureHandlers > 1,
+		CallbackPortStatus:     core.GetPortManager().CallbackCount() > 0,
+		CallbackICCID:          a.TCPManager.GetICCIDConflictDetector().HandlerCount() > 0,
+		CallbackChargeQueue:    a.Gateway.GetChargeQueue().HandlerCount() > 0,
+		CallbackReboot:         a.Gateway.GetRebootTracker().HandlerCount() > 0,
+		CallbackDecommission:   decommission.GetGlobalRegistry().HandlerCount() > 0,
+		CallbackFrameJournal:   a.FrameJournal != nil && a.FrameJournal.HandlerCount() > 0,
+		CallbackReconcile:      orderHandlers > 0,
+		CallbackAnomaly:        anomaly.GetGlobalDetector().HandlerCount() > 0,
+		CallbackRedisHealth:    redis.GetGlobalHealth().HandlerCount() > 0,
+		CallbackFleetAlert:     fleetalert.GetGlobalMonitor().HandlerCount() > 0,
+		CallbackSLA:            network.HasCommandOutcomeObserver(),
+		CallbackSLAAlert:       sla.GetGlobalTracker().HandlerCount() > 0,
+		CallbackSessionArchive: a.TCPManager.HasClosedSessionObserver(),
+		CallbackChargeStats:    orderHandlers > reconcileHandlers,
+		CallbackChargeSettled:  a.Settlements != nil && a.Settlements.AppendHandlerCount() > 0,
+		CallbackTraceSampling:  a.TCPManager.HasConnTraceSampler(),
+		CallbackDeviceSessions: a.TCPManager.HasDeviceActivityObserver(),
+	}
+}
+
+// VerifyWiring 装配自检：应注册的回调缺失时返回错误，避免回调静默失效
+func (a *Application) VerifyWiring() error {
+	registered := a.RegisteredCallbacks()
+	var missing []string
+	for _, name := range a.ExpectedCallbacks() {
+		if !registered[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("跨组件回调未注册: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// wireStandby 热备控制器接入网关交接状态与TCP服务器接入控制；热备实例启动后先停止接入，设备重新注册时延续交接前的统计
+func (a *Application) wireStandby(ctx context.Context) error {
+	if a.TCPServer == nil {
+		return nil
+	}
+	tcpServer := a.TCPServer
+	if a.Config.Standby.Role == standby.RoleStandby {
+		_ = tcpServer.StopAccepting(ctx)
+	}
+	c, err := standby.InitGlobal(ctx, standby.Hooks{
+		Export:  a.Gateway.ExportHandoverState,
+		Import:  a.Gateway.ImportHandoverState,
+		Restore: a.Gateway.RestoreHandoverDevice,
+		StopAccepting: func() {
+			_ = tcpServer.StopAccepting(context.Background())
+		},
+		ResumeAccepting: tcpServer.ResumeAccepting,
+		Connections: func() []uint64 {
+			var ids []uint64
+			a.TCPManager.GetConnections().Range(func(key, _ interface{}) bool {
+				ids = append(ids, key.(uint64))
+				return true
+			})
+			return ids
+		},
+		CloseConnection: func(connID uint64) bool {
+			return a.TCPManager.DisconnectConnection(connID, "handover")
+		},
+	})
+	if err != nil || c == nil {
+		return err
+	}
+	a.Gateway.RegisterRegistrationHandler(c.OnDeviceRegistered)
+	return nil
+}
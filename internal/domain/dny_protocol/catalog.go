@@ -0,0 +1,235 @@
+package dny_protocol
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// 协议目录：命令码与各类枚举的权威名称表，供日志、HTTP查询接口与前端/合作方共用。
+// 命令码表来源于 pkg/constants 的统一命令注册表，枚举表集中定义在本文件，
+// 协议文档更新时只需修改这里（见 docs/协议/AP3000-设备与服务器通信协议.md）
+
+// 命令方向
+const (
+	DirectionUpstream   = "upstream"   // 设备上报
+	DirectionDownstream = "downstream" // 服务器下发
+)
+
+// 结算停止原因（0x03 结算消费信息上传中的停止原因字段）
+const (
+	StopReasonFull             = 0x01 // 充满自停
+	StopReasonMaxDuration      = 0x02 // 达到最大充电时间
+	StopReasonPresetTime       = 0x03 // 达到预设时间
+	StopReasonPresetEnergy     = 0x04 // 达到预设电量
+	StopReasonUnplugged        = 0x05 // 用户拔出
+	StopReasonOverload         = 0x06 // 负载过大
+	StopReasonServerStop       = 0x07 // 服务器控制停止
+	StopReasonDynamicOverload  = 0x08 // 动态过载
+	StopReasonLowPower         = 0x09 // 功率过小
+	StopReasonAmbientOverTemp  = 0x0A // 环境温度过高
+	StopReasonPortOverTemp     = 0x0B // 端口温度过高
+	StopReasonOverCurrent      = 0x0C // 过流
+	StopReasonUnpluggedStuck   = 0x0D // 用户拔出-1
+	StopReasonNoPower          = 0x0E // 无功率停止
+	StopReasonPrecheckFailed   = 0x0F // 预检-继电器坏或保险丝断
+	StopReasonFlooded          = 0x10 // 水浸断电
+	StopReasonFireThisPort     = 0x11 // 灭火结算（本端口）
+	StopReasonFireOtherPort    = 0x12 // 灭火结算（非本端口）
+	StopReasonPasswordOpen     = 0x13 // 用户密码开柜断电
+	StopReasonDoorNotClosed    = 0x14 // 未关好柜门
+	StopReasonExternalStop     = 0x15 // 外部操作停止
+	StopReasonCardStop         = 0x16 // 刷卡操作停止
+	StopReasonServerForceStop  = 0x17 // 服务器强制停止
+	StopReasonFireSystem       = 0x18 // 消防系统触发停止
+	StopReasonStorageError     = 0x19 // 存储器错误
+	StopReasonOverVoltage      = 0x1A // 过压
+	StopReasonUnderVoltage     = 0x1B // 欠压
+	StopReasonLowPowerShutdown = 0x1C // 低功率断电
+)
+
+// CommandEntry 命令码目录项
+type CommandEntry struct {
+	Code        uint8  `json:"code"`
+	Hex         string `json:"hex"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Direction   string `json:"direction"` // upstream/downstream
+}
+
+// EnumValue 枚举取值
+type EnumValue struct {
+	Value       int    `json:"value"`
+	Hex         string `json:"hex"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// ProtocolEnum 协议枚举表
+type ProtocolEnum struct {
+	Key    string      `json:"key"`
+	Name   string      `json:"name"`
+	Field  string      `json:"field"` // 所在的命令与字段
+	Values []EnumValue `json:"values"`
+}
+
+func enumValue(value int, name, description string) EnumValue {
+	return EnumValue{Value: value, Hex: fmt.Sprintf("0x%02X", value), Name: name, Description: description}
+}
+
+// protocolEnums 枚举表（顺序即接口返回顺序）
+var protocolEnums = []ProtocolEnum{
+	{Key: "responseCode", Name: "通用应答码", Field: "设备应答的结果字段", Values: []EnumValue{
+		enumValue(constants.StatusSuccess, "成功", ""),
+		enumValue(constants.StatusError, "错误", ""),
+	}},
+	{Key: "chargeCommand", Name: "充电命令", Field: "0x82 充电命令", Values: []EnumValue{
+		enumValue(ChargeCommandStop, "停止充电", ""),
+		enumValue(ChargeCommandStart, "开始充电", ""),
+		enumValue(ChargeCommandQuery, "查询状态", ""),
+	}},
+	{Key: "chargeResponse", Name: "充电控制应答", Field: "0x82 设备应答", Values: []EnumValue{
+		enumValue(constants.ChargeStatusSuccess, "成功", ""),
+		enumValue(constants.ChargeStatusNoCharger, "端口未插充电器", ""),
+		enumValue(constants.ChargeStatusSameState, "端口状态相同", "端口已处于目标状态"),
+		enumValue(constants.ChargeStatusPortFault, "端口故障", ""),
+		enumValue(constants.ChargeStatusInvalidPort, "无此端口号", ""),
+		enumValue(constants.ChargeStatusPowerOverload, "多路设备功率超标", ""),
+		enumValue(constants.ChargeStatusStorageCorrupted, "存储器损坏", ""),
+	}},
+	{Key: "rateMode", Name: "计费模式", Field: "0x82 费率模式", Values: []EnumValue{
+		enumValue(RateModeTime, "按时间计费", "充电时长/电量字段为时长(秒)"),
+		enumValue(RateModeEnergy, "按电量计费", "充电时长/电量字段为电量"),
+	}},
+	{Key: "stopReason", Name: "停止原因", Field: "0x03 停止原因", Values: []EnumValue{
+		enumValue(StopReasonFull, "充满自停", ""),
+		enumValue(StopReasonMaxDuration, "达到最大充电时间", ""),
+		enumValue(StopReasonPresetTime, "达到预设时间", ""),
+		enumValue(StopReasonPresetEnergy, "达到预设电量", ""),
+		enumValue(StopReasonUnplugged, "用户拔出", ""),
+		enumValue(StopReasonOverload, "负载过大", ""),
+		enumValue(StopReasonServerStop, "服务器控制停止", ""),
+		enumValue(StopReasonDynamicOverload, "动态过载", ""),
+		enumValue(StopReasonLowPower, "功率过小", ""),
+		enumValue(StopReasonAmbientOverTemp, "环境温度过高", "仅适用于AP262、AP360"),
+		enumValue(StopReasonPortOverTemp, "端口温度过高", "仅适用于AP262"),
+		enumValue(StopReasonOverCurrent, "过流", ""),
+		enumValue(StopReasonUnpluggedStuck, "用户拔出-1", "可能是插座弹片卡住"),
+		enumValue(StopReasonNoPower, "无功率停止", "可能是接触不良或保险丝烧断故障"),
+		enumValue(StopReasonPrecheckFailed, "预检-继电器坏或保险丝断", ""),
+		enumValue(StopReasonFlooded, "水浸断电", ""),
+		enumValue(StopReasonFireThisPort, "灭火结算（本端口）", ""),
+		enumValue(StopReasonFireOtherPort, "灭火结算（非本端口）", ""),
+		enumValue(StopReasonPasswordOpen, "用户密码开柜断电", ""),
+		enumValue(StopReasonDoorNotClosed, "未关好柜门", ""),
+		enumValue(StopReasonExternalStop, "外部操作停止", ""),
+		enumValue(StopReasonCardStop, "刷卡操作停止", ""),
+		enumValue(StopReasonServerForceStop, "服务器强制停止", "主要用于充电柜强制开柜门"),
+		enumValue(StopReasonFireSystem, "消防系统触发停止", ""),
+		enumValue(StopReasonStorageError, "存储器错误", ""),
+		enumValue(StopReasonOverVoltage, "过压", ""),
+		enumValue(StopReasonUnderVoltage, "欠压", ""),
+		enumValue(StopReasonLowPowerShutdown, "低功率断电", ""),
+	}},
+	{Key: "hostType", Name: "主机类型", Field: "0x11 主机类型", Values: []EnumValue{
+		enumValue(HostType485Old, "旧款485主机", ""),
+		enumValue(HostTypeLORAOld, "旧款LORA主机", ""),
+		enumValue(HostTypeLORANew, "新款LORA主机", ""),
+		enumValue(HostType433, "433无线主机", ""),
+		enumValue(HostTypeAP262LORA, "AP262 LORA主机", ""),
+		enumValue(HostTypeAP262, "AP262合装主机", ""),
+		enumValue(HostTypeLeakage, "漏保主机", ""),
+	}},
+	{Key: "commType", Name: "通讯模块类型", Field: "0x11 通讯模块类型", Values: []EnumValue{
+		enumValue(CommTypeWIFI, "WIFI(B2)", ""),
+		enumValue(CommType2G_GM3, "2G（GM3）", ""),
+		enumValue(CommType4G_7S4, "4G（7S4/G405）", ""),
+		enumValue(CommType2G_GM35, "2G（GM35）", ""),
+		enumValue(CommTypeNB_M5311, "NB（M5311）", ""),
+		enumValue(CommType4G_GM5, "4G-CAT1（GM5）", ""),
+		enumValue(CommType4G_OpenCpu, "OpenCpu 4G-CAT1（GM5）", ""),
+		enumValue(CommType4G_GM6, "4G-CAT1（GM6）", ""),
+	}},
+	{Key: "rtcType", Name: "RTC模块类型", Field: "0x11 RTC模块类型", Values: []EnumValue{
+		enumValue(RTCTypeNone, "无RTC模块", ""),
+		enumValue(RTCTypeSD2068, "SD2068", ""),
+		enumValue(RTCTypeBM8563, "BM8563", ""),
+	}},
+	{Key: "deviceType", Name: "设备类型", Field: "0x20 设备类型", Values: []EnumValue{
+		enumValue(constants.DeviceTypeOld485Single, "老款485单模", ""),
+		enumValue(constants.DeviceTypeOld485Dual, "老款485双模", ""),
+		enumValue(constants.DeviceTypeNew485Single, "新款485单模", ""),
+		enumValue(constants.DeviceTypeNew485Dual, "新款485双模", ""),
+		enumValue(constants.DeviceTypeWiFiSingle, "WiFi单模", ""),
+		enumValue(constants.DeviceTypeWiFiDual, "WiFi双模", ""),
+		enumValue(constants.DeviceType4GSingle, "4G单模", ""),
+		enumValue(constants.DeviceType4GDual, "4G双模", ""),
+		enumValue(constants.DeviceTypeEthernetSingle, "以太网单模", ""),
+		enumValue(constants.DeviceTypeEthernetDual, "以太网双模", ""),
+		enumValue(constants.DeviceTypeNew485SingleF460, "新款485双模F460", ""),
+	}},
+}
+
+// Commands 全部已知命令码（按命令码排序）
+func Commands() []CommandEntry {
+	all := constants.GetGlobalCommandRegistry().GetAllCommands()
+	list := make([]CommandEntry, 0, len(all))
+	for code, info := range all {
+		direction := DirectionUpstream
+		if constants.IsServerCommand(code) {
+			direction = DirectionDownstream
+		}
+		list = append(list, CommandEntry{
+			Code:        code,
+			Hex:         fmt.Sprintf("0x%02X", code),
+			Name:        info.Name,
+			Description: info.Description,
+			Category:    info.Category,
+			Direction:   direction,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Enums 全部协议枚举表
+func Enums() []ProtocolEnum {
+	list := make([]ProtocolEnum, len(protocolEnums))
+	for i, e := range protocolEnums {
+		e.Values = append([]EnumValue(nil), e.Values...)
+		list[i] = e
+	}
+	return list
+}
+
+// IsKnownCommand 命令码是否在目录中
+func IsKnownCommand(command uint8) bool {
+	return constants.GetGlobalCommandRegistry().IsRegistered(command)
+}
+
+// CommandLabel 日志用命令标识：十六进制命令码加名称，如 "0x82 服务器开始、停止充电操作"
+func CommandLabel(command uint8) string {
+	return constants.CommandLabel(command)
+}
+
+// EnumName 按枚举表键与取值查询名称，未知取值返回 "未知(0xNN)"
+func EnumName(key string, value int) string {
+	for _, e := range protocolEnums {
+		if e.Key != key {
+			continue
+		}
+		for _, v := range e.Values {
+			if v.Value == value {
+				return v.Name
+			}
+		}
+	}
+	return fmt.Sprintf("未知(0x%02X)", value)
+}
+
+// StopReasonName 结算停止原因名称
+func StopReasonName(reason uint8) string {
+	return EnumName("stopReason", int(reason))
+}
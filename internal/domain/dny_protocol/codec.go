@@ -0,0 +1,40 @@
+package dny_protocol
+
+import "github.com/bujia-iot/iot-zinx/pkg/constants"
+
+// DNY帧布局（多字节字段均为小端序，各字段长度见 pkg/constants）：
+// 包头"DNY"(3) + 长度(2) + 物理ID(4) + 消息ID(2) + 命令(1) + 数据(N) + 校验(2)
+// 长度字段 = 物理ID + 消息ID + 命令 + 数据 + 校验，即长度字段之后直到帧尾的字节数
+// 校验 = 从包头"DNY"到数据末尾（不含校验本身）的逐字节无符号累加和，取低16位
+
+// MaxDataLen 长度字段（uint16）可表示的最大数据长度
+const MaxDataLen = 0xFFFF - (constants.PhysicalIDSize + constants.MessageIDSize + constants.CommandSize + constants.ChecksumSize)
+
+// LengthFieldValue 数据长度为 dataLen 时长度字段的值
+func LengthFieldValue(dataLen int) uint16 {
+	return uint16(constants.PhysicalIDSize + constants.MessageIDSize + constants.CommandSize + dataLen + constants.ChecksumSize)
+}
+
+// Checksum DNY校验和：b 为从包头开始到数据末尾的字节
+func Checksum(b []byte) uint16 {
+	var sum uint16
+	for _, c := range b {
+		sum += uint16(c)
+	}
+	return sum
+}
+
+// BuildFrame 构建DNY帧，全部构建入口（统一构建器、Zinx封包、充电控制包）共用此实现；
+// 数据长度超过 MaxDataLen 时长度字段无法表示，调用方需先按 constants.MaxPacketSize 限制
+func BuildFrame(physicalID uint32, messageID uint16, command uint8, data []byte) []byte {
+	contentLen := LengthFieldValue(len(data))
+	packet := make([]byte, 0, constants.MinHeaderSize+int(contentLen))
+	packet = append(packet, constants.ProtocolHeader...)
+	packet = append(packet, byte(contentLen), byte(contentLen>>8))
+	packet = append(packet, byte(physicalID), byte(physicalID>>8), byte(physicalID>>16), byte(physicalID>>24))
+	packet = append(packet, byte(messageID), byte(messageID>>8))
+	packet = append(packet, command)
+	packet = append(packet, data...)
+	checksum := Checksum(packet)
+	return append(packet, byte(checksum), byte(checksum>>8))
+}
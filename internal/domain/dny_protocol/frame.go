@@ -205,50 +205,5 @@ func BuildChargeControlPacket(
 	data[36] = 0
 
 	// 构建完整的DNY协议包
-	return buildDNYPacket(physicalID, messageID, constants.CmdChargeControl, data)
-}
-
-// buildDNYPacket 构建DNY协议数据包的通用实现 (临时保留)
-// 🔧 与协议保持一致：长度字段包含校验；小端序；校验为包头至数据的累加和
-func buildDNYPacket(physicalID uint32, messageID uint16, command uint8, data []byte) []byte {
-	// 计算内容长度：PhysicalID(4) + MessageID(2) + Command(1) + Data(N) + Checksum(2)
-	contentLen := 4 + 2 + 1 + len(data) + 2
-
-	// 预分配缓冲
-	packet := make([]byte, 0, 3+2+contentLen)
-
-	// 包头 "DNY"
-	packet = append(packet, 'D', 'N', 'Y')
-
-	// 长度字段（小端）
-	packet = append(packet, byte(contentLen), byte(contentLen>>8))
-
-	// 物理ID（小端）
-	packet = append(packet,
-		byte(physicalID),
-		byte(physicalID>>8),
-		byte(physicalID>>16),
-		byte(physicalID>>24))
-
-	// 消息ID（小端）
-	packet = append(packet, byte(messageID), byte(messageID>>8))
-
-	// 命令
-	packet = append(packet, command)
-
-	// 数据
-	if len(data) > 0 {
-		packet = append(packet, data...)
-	}
-
-	// 校验和：从包头到当前位置的简单累加（不含校验本身）
-	var checksum uint16
-	for i := 0; i < len(packet); i++ {
-		checksum += uint16(packet[i])
-	}
-
-	// 写入校验（小端）
-	packet = append(packet, byte(checksum), byte(checksum>>8))
-
-	return packet
+	return BuildFrame(physicalID, messageID, constants.CmdChargeControl, data)
 }
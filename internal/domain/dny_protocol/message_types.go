@@ -3,9 +3,11 @@ package dny_protocol
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 )
 
@@ -94,11 +96,7 @@ func (d *DeviceRegisterData) UnmarshalBinary(data []byte) error {
 		return fmt.Errorf("invalid work mode: %d, expected range 0-3", workMode)
 	}
 
-	// 电源板版本号 (2字节, 小端序) - 可选字段
-	var powerBoardVersion uint16
-	if len(data) >= 8 {
-		powerBoardVersion = binary.LittleEndian.Uint16(data[6:8])
-	}
+	// 电源板版本号 (2字节, 小端序) - 可选字段，暂不使用
 
 	// 设备分时计费功能 (1字节) - 可选字段
 	// TODO： 根据实际业务需求处理此字段
@@ -121,9 +119,6 @@ func (d *DeviceRegisterData) UnmarshalBinary(data []byte) error {
 
 	d.Timestamp = time.Now()
 
-	fmt.Printf("🔧 设备注册解析成功: 固件版本=%d, 端口数=%d, 虚拟ID=%d, 设备类型=%d, 工作模式=%d, 电源板版本=%d, 数据长度=%d\n",
-		firmwareVersion, portCount, virtualID, d.DeviceType, workMode, powerBoardVersion, len(data))
-
 	return nil
 }
 
@@ -223,17 +218,9 @@ func (s *SwipeCardRequestData) UnmarshalBinary(data []byte) error {
 	}
 
 	// 卡号2 (N字节) - 如果需要可以扩展处理
-	if cardNumber2Length > 0 {
-		cardNumber2 := data[13 : 13+cardNumber2Length]
-		fmt.Printf("🔧 刷卡数据包含卡号2: 长度=%d, 内容=%s\n", cardNumber2Length, string(cardNumber2))
-	}
-
 	// 设置默认设备状态
 	s.DeviceStatus = 0 // 正常状态
 
-	fmt.Printf("🔧 刷卡请求解析成功: 卡号=%s, 卡类型=%d, 端口号=%d, 时间戳=%d\n",
-		s.CardNumber, s.CardType, s.GunNumber, timestamp)
-
 	return nil
 }
 
@@ -299,12 +286,25 @@ func (s *SettlementData) MarshalBinary() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// 结算载荷校验错误（处理器按错误类型计数）
+var (
+	ErrSettlementTooShort = errors.New("结算数据长度不足")
+	ErrSettlementOrderNo  = errors.New("结算订单编号含非ASCII可见字符")
+)
+
 func (s *SettlementData) UnmarshalBinary(data []byte) error {
 	// 🔧 关键修复：根据AP3000协议文档，结算数据(0x03)数据格式
 	// 协议格式：充电时长(2字节) + 最大功率(2字节) + 耗电量(2字节) + 端口号(1字节) + 在线/离线启动(1字节) + 卡号(4字节) + 停止原因(1字节) + 订单编号(16字节) + 第二最大功率(2字节) + 时间戳(4字节) + 占位时长(2字节)
 	// 总共：2+2+2+1+1+4+1+16+2+4+2 = 37字节，但基础功能35字节即可
 	if len(data) < 35 {
-		return fmt.Errorf("insufficient data length: %d, expected at least 35 for settlement", len(data))
+		return fmt.Errorf("%w: %d字节，至少需要35字节", ErrSettlementTooShort, len(data))
+	}
+	// 订单编号 (16字节) 先行校验，不合法时不修改任何字段
+	orderNo := bytes.TrimRight(data[13:29], "\x00")
+	for i, b := range orderNo {
+		if b < 0x20 || b > 0x7E {
+			return fmt.Errorf("%w: 第%d字节为0x%02X", ErrSettlementOrderNo, i, b)
+		}
 	}
 
 	// 充电时长 (2字节, 小端序) - 转换为开始时间和结束时间
@@ -331,7 +331,7 @@ func (s *SettlementData) UnmarshalBinary(data []byte) error {
 	s.StopReason = data[12]
 
 	// 订单编号 (16字节)
-	s.OrderID = string(bytes.TrimRight(data[13:29], "\x00"))
+	s.OrderID = string(orderNo)
 
 	// 第二最大功率 (2字节, 小端序) - 如果数据足够长
 	if len(data) >= 31 {
@@ -342,6 +342,8 @@ func (s *SettlementData) UnmarshalBinary(data []byte) error {
 	if len(data) >= 35 {
 		timestamp := binary.LittleEndian.Uint32(data[31:35])
 		s.EndTime = time.Unix(int64(timestamp), 0)
+		// 开始时间按设备结束时间倒推，保证结束-开始即为上报的充电时长
+		s.StartTime = s.EndTime.Add(-time.Duration(chargeDuration) * time.Second)
 	}
 
 	// 占位时长 (2字节, 小端序) - 如果数据足够长，充电柜专用
@@ -354,9 +356,6 @@ func (s *SettlementData) UnmarshalBinary(data []byte) error {
 	s.ServiceFee = 0
 	s.TotalFee = 0
 
-	fmt.Printf("🔧 结算数据解析成功: 订单号=%s, 卡号=%s, 充电时长=%d秒, 耗电量=%d, 端口号=%d, 停止原因=%d\n",
-		s.OrderID, s.CardNumber, chargeDuration, s.ElectricEnergy, s.GunNumber, s.StopReason)
-
 	return nil
 }
 
@@ -780,6 +779,217 @@ func (d *DeviceHeartbeatData) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
+// NetworkStatusData 设备联网状态应答数据 (0x81)
+type NetworkStatusData struct {
+	Status uint8  // 设备状态 (1字节)
+	Extra  []byte // 状态之后的附加数据（固件相关，原样保留）
+}
+
+func (n *NetworkStatusData) MarshalBinary() ([]byte, error) {
+	return append([]byte{n.Status}, n.Extra...), nil
+}
+
+func (n *NetworkStatusData) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("insufficient data length: %d, minimum required: 1", len(data))
+	}
+	n.Status = data[0]
+	n.Extra = append([]byte(nil), data[1:]...)
+	return nil
+}
+
+// 设备运行参数（0x90/0x91 上报或查询应答），内容与 0x83/0x84 设置指令相同，多字节字段均为小端序。
+//
+// 0x90 运行参数1.1（完整11字节）:
+//
+//	偏移  0  拔出功率                 2字节
+//	偏移  2  拔出功率识别时间(秒)     2字节
+//	偏移  4  浮充百分比(1-100)        1字节
+//	偏移  5  浮充状态识别时间(秒)     2字节
+//	偏移  7  浮充时间(秒)             2字节
+//	偏移  9  心跳包上报间隔(秒)       2字节
+//
+// 0x91 运行参数1.2（完整23字节）:
+//
+//	偏移  0  动态过载功率             2字节
+//	偏移  2  动态过载识别时间(秒)     2字节
+//	偏移  4  动态过载开始时间(秒)     2字节
+//	偏移  6  拔出干扰功率             1字节
+//	偏移  7  拔出干扰功率判断时间(秒) 2字节
+//	偏移  9  浮充识别第二次时间点(秒) 2字节
+//	偏移 11  浮充状态第二次识别时间   2字节
+//	偏移 13  最小功率                 2字节
+//	偏移 15  判断最小功率时间点(秒)   2字节
+//	偏移 17  第二最大功率时间点(秒)   2字节
+//	偏移 19  环境报警温度             1字节
+//	偏移 20  端口报警温度             1字节
+//	偏移 21  判断用户拔出(光耦)       1字节 0=打开，其他关闭
+//	偏移 22  二维码灯                 1字节 0=打开，1=关闭
+//
+// 部分固件版本缺少最后4字节：解析已有字段，缺失字段置零、记入 Missing 并标记 Partial
+const (
+	RunParams11Length = 11
+	RunParams12Length = 23
+)
+
+// RunParams11 运行参数1.1 (0x90)
+type RunParams11 struct {
+	UnplugPower        uint16   `json:"unplug_power"`
+	UnplugDetectTime   uint16   `json:"unplug_detect_time"`
+	FloatChargePercent uint8    `json:"float_charge_percent"`
+	FloatDetectTime    uint16   `json:"float_detect_time"`
+	FloatChargeTime    uint16   `json:"float_charge_time"`
+	HeartbeatInterval  uint16   `json:"heartbeat_interval"`
+	Partial            bool     `json:"partial"`           // 数据被截断
+	Missing            []string `json:"missing,omitempty"` // 截断缺失的字段
+}
+
+func (r *RunParams11) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, RunParams11Length)
+	binary.LittleEndian.PutUint16(buf[0:], r.UnplugPower)
+	binary.LittleEndian.PutUint16(buf[2:], r.UnplugDetectTime)
+	buf[4] = r.FloatChargePercent
+	binary.LittleEndian.PutUint16(buf[5:], r.FloatDetectTime)
+	binary.LittleEndian.PutUint16(buf[7:], r.FloatChargeTime)
+	binary.LittleEndian.PutUint16(buf[9:], r.HeartbeatInterval)
+	return buf, nil
+}
+
+func (r *RunParams11) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("insufficient data length: %d, minimum required: 2", len(data))
+	}
+	p := paramReader{data: data}
+	r.UnplugPower = p.u16("unplug_power")
+	r.UnplugDetectTime = p.u16("unplug_detect_time")
+	r.FloatChargePercent = p.u8("float_charge_percent")
+	r.FloatDetectTime = p.u16("float_detect_time")
+	r.FloatChargeTime = p.u16("float_charge_time")
+	r.HeartbeatInterval = p.u16("heartbeat_interval")
+	r.Missing = p.missing
+	r.Partial = len(p.missing) > 0
+	return nil
+}
+
+// RunParams12 运行参数1.2 (0x91)
+type RunParams12 struct {
+	DynamicOverloadPower      uint16   `json:"dynamic_overload_power"`
+	DynamicOverloadDetectTime uint16   `json:"dynamic_overload_detect_time"`
+	DynamicOverloadStartTime  uint16   `json:"dynamic_overload_start_time"`
+	UnplugInterferencePower   uint8    `json:"unplug_interference_power"`
+	UnplugInterferenceTime    uint16   `json:"unplug_interference_time"`
+	FloatSecondDetectPoint    uint16   `json:"float_second_detect_point"`
+	FloatSecondDetectTime     uint16   `json:"float_second_detect_time"`
+	MinPower                  uint16   `json:"min_power"`
+	MinPowerCheckPoint        uint16   `json:"min_power_check_point"`
+	SecondMaxPowerPoint       uint16   `json:"second_max_power_point"`
+	AmbientAlarmTemp          uint8    `json:"ambient_alarm_temp"`
+	PortAlarmTemp             uint8    `json:"port_alarm_temp"`
+	OptocouplerUnplug         uint8    `json:"optocoupler_unplug"`
+	QRCodeLight               uint8    `json:"qrcode_light"`
+	Partial                   bool     `json:"partial"`           // 数据被截断
+	Missing                   []string `json:"missing,omitempty"` // 截断缺失的字段
+}
+
+func (r *RunParams12) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, RunParams12Length)
+	binary.LittleEndian.PutUint16(buf[0:], r.DynamicOverloadPower)
+	binary.LittleEndian.PutUint16(buf[2:], r.DynamicOverloadDetectTime)
+	binary.LittleEndian.PutUint16(buf[4:], r.DynamicOverloadStartTime)
+	buf[6] = r.UnplugInterferencePower
+	binary.LittleEndian.PutUint16(buf[7:], r.UnplugInterferenceTime)
+	binary.LittleEndian.PutUint16(buf[9:], r.FloatSecondDetectPoint)
+	binary.LittleEndian.PutUint16(buf[11:], r.FloatSecondDetectTime)
+	binary.LittleEndian.PutUint16(buf[13:], r.MinPower)
+	binary.LittleEndian.PutUint16(buf[15:], r.MinPowerCheckPoint)
+	binary.LittleEndian.PutUint16(buf[17:], r.SecondMaxPowerPoint)
+	buf[19] = r.AmbientAlarmTemp
+	buf[20] = r.PortAlarmTemp
+	buf[21] = r.OptocouplerUnplug
+	buf[22] = r.QRCodeLight
+	return buf, nil
+}
+
+func (r *RunParams12) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("insufficient data length: %d, minimum required: 2", len(data))
+	}
+	p := paramReader{data: data}
+	r.DynamicOverloadPower = p.u16("dynamic_overload_power")
+	r.DynamicOverloadDetectTime = p.u16("dynamic_overload_detect_time")
+	r.DynamicOverloadStartTime = p.u16("dynamic_overload_start_time")
+	r.UnplugInterferencePower = p.u8("unplug_interference_power")
+	r.UnplugInterferenceTime = p.u16("unplug_interference_time")
+	r.FloatSecondDetectPoint = p.u16("float_second_detect_point")
+	r.FloatSecondDetectTime = p.u16("float_second_detect_time")
+	r.MinPower = p.u16("min_power")
+	r.MinPowerCheckPoint = p.u16("min_power_check_point")
+	r.SecondMaxPowerPoint = p.u16("second_max_power_point")
+	r.AmbientAlarmTemp = p.u8("ambient_alarm_temp")
+	r.PortAlarmTemp = p.u8("port_alarm_temp")
+	r.OptocouplerUnplug = p.u8("optocoupler_unplug")
+	r.QRCodeLight = p.u8("qrcode_light")
+	r.Missing = p.missing
+	r.Partial = len(p.missing) > 0
+	return nil
+}
+
+// DeviceParameters 设备最近上报的运行参数（0x90/0x91 分段合并）
+type DeviceParameters struct {
+	RunParams11      *RunParams11 `json:"run_params_1_1,omitempty"` // 0x90
+	RunParams12      *RunParams12 `json:"run_params_1_2,omitempty"` // 0x91
+	Partial          bool         `json:"partial"`                  // 任一分段被截断
+	LastParametersAt time.Time    `json:"last_parameters_at"`       // 最近一次上报时间，用于判断配置是否过期
+}
+
+// Apply 解析一帧 0x90/0x91 数据并替换对应分段（其余分段保留）
+func (p *DeviceParameters) Apply(command uint8, payload []byte, at time.Time) error {
+	switch command {
+	case constants.CmdQueryParam1:
+		section := &RunParams11{}
+		if err := section.UnmarshalBinary(payload); err != nil {
+			return err
+		}
+		p.RunParams11 = section
+	case constants.CmdQueryParam2:
+		section := &RunParams12{}
+		if err := section.UnmarshalBinary(payload); err != nil {
+			return err
+		}
+		p.RunParams12 = section
+	default:
+		return fmt.Errorf("非运行参数上报命令: 0x%02X", command)
+	}
+	p.Partial = (p.RunParams11 != nil && p.RunParams11.Partial) || (p.RunParams12 != nil && p.RunParams12.Partial)
+	p.LastParametersAt = at
+	return nil
+}
+
+// paramReader 按字段顺序读取小端参数，数据不足的字段置零并记入 missing
+type paramReader struct {
+	data    []byte
+	offset  int
+	missing []string
+}
+
+func (p *paramReader) u8(name string) uint8 {
+	defer func() { p.offset++ }()
+	if p.offset+1 > len(p.data) {
+		p.missing = append(p.missing, name)
+		return 0
+	}
+	return p.data[p.offset]
+}
+
+func (p *paramReader) u16(name string) uint16 {
+	defer func() { p.offset += 2 }()
+	if p.offset+2 > len(p.data) {
+		p.missing = append(p.missing, name)
+		return 0
+	}
+	return binary.LittleEndian.Uint16(p.data[p.offset:])
+}
+
 // 辅助函数：写入时间字节 (6字节: 年月日时分秒)
 func writeTimeBytes(buf *bytes.Buffer, t time.Time) {
 	year := uint16(t.Year())
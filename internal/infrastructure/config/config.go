@@ -9,6 +9,7 @@ import (
 
 // Config 是应用程序配置的结构体
 type Config struct {
+	Environment      string                 `mapstructure:"environment"` // 部署环境: development | staging | test | production（测试功能仅前三者允许启用）
 	TCPServer        TCPServerConfig        `mapstructure:"tcpServer"`
 	HTTPAPIServer    HTTPAPIServerConfig    `mapstructure:"httpApiServer"`
 	Redis            RedisConfig            `mapstructure:"redis"`
@@ -19,6 +20,63 @@ type Config struct {
 	Retry            RetryConfig            `mapstructure:"retry"`
 	Notification     NotificationConfig     `mapstructure:"notification"`
 	SmartCharging    SmartChargingConfig    `mapstructure:"smartCharging"`
+	ChargeQueue      ChargeQueueConfig      `mapstructure:"chargeQueue"`
+	SessionLimits    SessionLimitsConfig    `mapstructure:"sessionLimits"`
+	PowerProfiles    PowerProfilesConfig    `mapstructure:"powerProfiles"`
+	Audit            AuditConfig            `mapstructure:"audit"`
+	AssetResolver    AssetResolverConfig    `mapstructure:"assetResolver"`
+	Promotion        PromotionConfig        `mapstructure:"promotion"`
+	Reboot           RebootConfig           `mapstructure:"reboot"`
+	VirtualDevice    VirtualDeviceConfig    `mapstructure:"virtualDevice"`
+	WebhookReceiver  WebhookReceiverConfig  `mapstructure:"webhookReceiver"`
+	Shutdown         ShutdownConfig         `mapstructure:"shutdown"`
+	DeviceConfig     DeviceConfigReadConfig `mapstructure:"deviceConfig"`
+
+	RegistrationBackfill RegistrationBackfillConfig `mapstructure:"registrationBackfill"`
+	FrameJournal         FrameJournalConfig         `mapstructure:"frameJournal"`
+	Conformance          ConformanceConfig          `mapstructure:"conformance"`
+	Checksum             ChecksumConfig             `mapstructure:"checksum"`
+	HeartbeatTuning      HeartbeatTuningConfig      `mapstructure:"heartbeatTuning"`
+	EventBus             EventBusConfig             `mapstructure:"eventBus"`
+	Reconciliation       ReconciliationConfig       `mapstructure:"reconciliation"`
+	GarbagePreamble      GarbagePreambleConfig      `mapstructure:"garbagePreamble"`
+	Cluster              ClusterConfig              `mapstructure:"cluster"`
+	Stations             StationsConfig             `mapstructure:"stations"`
+	DeferredCommands     DeferredCommandsConfig     `mapstructure:"deferredCommands"`
+	Macros               MacrosConfig               `mapstructure:"macros"`
+	SelfTest             SelfTestConfig             `mapstructure:"selfTest"`
+	MessageID            MessageIDConfig            `mapstructure:"messageId"`
+	Capabilities         CapabilitiesConfig         `mapstructure:"capabilities"`
+	ReadDeadline         ReadDeadlineConfig         `mapstructure:"readDeadline"`
+	ChangeLog            ChangeLogConfig            `mapstructure:"changeLog"`
+	GRPCServer           GRPCServerConfig           `mapstructure:"grpcServer"`
+	EnergyCounters       EnergyCountersConfig       `mapstructure:"energyCounters"`
+	PortAvailability     PortAvailabilityConfig     `mapstructure:"portAvailability"`
+	ResponseShaping      ResponseShapingConfig      `mapstructure:"responseShaping"`
+	CommLog              CommLogConfig              `mapstructure:"commLog"`
+	AnomalyDetection     AnomalyDetectionConfig     `mapstructure:"anomalyDetection"`
+	ChargingPolicy       ChargingPolicyConfig       `mapstructure:"chargingPolicy"`
+	LowData              LowDataConfig              `mapstructure:"lowData"`
+	Decommission         DecommissionConfig         `mapstructure:"decommission"`
+	GroupBroadcast       GroupBroadcastConfig       `mapstructure:"groupBroadcast"`
+	Persistence          PersistenceConfig          `mapstructure:"persistence"`
+	Replica              ReplicaConfig              `mapstructure:"replica"`
+	SettlementStore      SettlementStoreConfig      `mapstructure:"settlementStore"`
+	FleetAlerts          FleetAlertsConfig          `mapstructure:"fleetAlerts"`
+	HandlerGuard         HandlerGuardConfig         `mapstructure:"handlerGuard"`
+	FrameDedup           FrameDedupConfig           `mapstructure:"frameDedup"`
+	Standby              StandbyConfig              `mapstructure:"standby"`
+	DetailCache          DetailCacheConfig          `mapstructure:"detailCache"`
+	StateDump            StateDumpConfig            `mapstructure:"stateDump"`
+	PostOutageReplay     PostOutageReplayConfig     `mapstructure:"postOutageReplay"`
+	SLA                  SLAConfig                  `mapstructure:"sla"`
+	Extensions           ExtensionsConfig           `mapstructure:"extensions"`
+	SessionArchive       SessionArchiveConfig       `mapstructure:"sessionArchive"`
+	PayloadCrypto        PayloadCryptoConfig        `mapstructure:"payloadCrypto"`
+	ChargeStats          ChargeStatsConfig          `mapstructure:"chargeStats"`
+	TraceSampling        TraceSamplingConfig        `mapstructure:"traceSampling"`
+	DeviceSessions       DeviceSessionsConfig       `mapstructure:"deviceSessions"`
+	ChargingSessions     ChargingSessionsConfig     `mapstructure:"chargingSessions"`
 }
 
 // TCPServerConfig TCP服务器配置
@@ -37,6 +95,12 @@ type TCPServerConfig struct {
 	SendBufferSize    int `mapstructure:"sendBufferSize" yaml:"sendBufferSize"`
 	ReceiveBufferSize int `mapstructure:"receiveBufferSize" yaml:"receiveBufferSize"`
 
+	// 协议一致性模式（覆盖全局 conformance.mode，空表示沿用全局）
+	Conformance string `mapstructure:"conformance" yaml:"conformance"`
+
+	// 协议方言（ap3000 | vendor_b，空表示按注册帧特征识别）
+	Dialect string `mapstructure:"dialect" yaml:"dialect"`
+
 	// TCP选项
 	KeepAlive              bool `mapstructure:"keepAlive" yaml:"keepAlive"`
 	KeepAlivePeriodSeconds int  `mapstructure:"keepAlivePeriodSeconds" yaml:"keepAlivePeriodSeconds"`
@@ -73,8 +137,11 @@ type HTTPAPIServerConfig struct {
 
 // IdempotencyConfig 幂等配置
 type IdempotencyConfig struct {
-	Enabled    bool `mapstructure:"enabled"`    // 启用订单号幂等保护
-	TTLSeconds int  `mapstructure:"ttlSeconds"` // 幂等窗口时间（秒）
+	Enabled       bool `mapstructure:"enabled"`       // 启用订单号幂等保护
+	TTLSeconds    int  `mapstructure:"ttlSeconds"`    // 幂等窗口时间（秒）
+	LocalCapacity int  `mapstructure:"localCapacity"` // 进程内LRU容量（未配置Redis或Redis降级时使用），默认10000
+	KeyTTLSeconds int  `mapstructure:"keyTtlSeconds"` // Idempotency-Key 应答重放窗口（秒），默认86400
+	KeyCapacity   int  `mapstructure:"keyCapacity"`   // Idempotency-Key 应答重放表容量，默认10000
 }
 
 // AuthConfig 认证配置
@@ -93,13 +160,19 @@ type RedisConfig struct {
 	DialTimeout  int    `mapstructure:"dialTimeout"`
 	ReadTimeout  int    `mapstructure:"readTimeout"`
 	WriteTimeout int    `mapstructure:"writeTimeout"`
+
+	// 运行中可用性探测：连续失败达到阈值进入降级运行（各功能降级策略见 redis.DegradationPolicies），恢复后回放暂存写入
+	HealthCheckIntervalSeconds int `mapstructure:"healthCheckIntervalSeconds"` // 探测间隔(秒)，默认5
+	FailureThreshold           int `mapstructure:"failureThreshold"`           // 连续探测失败次数阈值，默认2
+	SpoolMaxBytes              int `mapstructure:"spoolMaxBytes"`              // 降级期间本地暂存写入上限(字节)，超出丢弃最早的暂存，默认8MiB
 }
 
 // LoggerConfig 统一日志配置
 type LoggerConfig struct {
 	// 基础配置
 	Level            string `mapstructure:"level"`            // 日志级别
-	Format           string `mapstructure:"format"`           // 输出格式: json, text
+	Format           string `mapstructure:"format"`           // 输出格式: json, text, ecs-json
+	ServiceName      string `mapstructure:"serviceName"`      // ecs-json 格式下的 service.name
 	EnableConsole    bool   `mapstructure:"enableConsole"`    // 是否输出到控制台
 	EnableStructured bool   `mapstructure:"enableStructured"` // 是否启用结构化日志
 	LogHexDump       bool   `mapstructure:"logHexDump"`       // 是否记录十六进制数据
@@ -115,6 +188,20 @@ type LoggerConfig struct {
 	MaxBackups   int    `mapstructure:"maxBackups"`   // 按大小轮转: 最大备份文件数
 	MaxAgeDays   int    `mapstructure:"maxAgeDays"`   // 保留天数
 	Compress     bool   `mapstructure:"compress"`     // 是否压缩旧文件
+
+	Traffic TrafficLogConfig `mapstructure:"traffic"` // DNY流量日志
+}
+
+// TrafficLogConfig DNY流量日志配置：每帧一行JSON（方向、连接、设备、命令、消息ID、长度、十六进制、解析/写入结果），按大小轮转
+type TrafficLogConfig struct {
+	Enabled           bool               `mapstructure:"enabled"`
+	File              string             `mapstructure:"file"`              // 文件名，相对路径位于 fileDir 下，默认 traffic.log
+	MaxSizeMB         int                `mapstructure:"maxSizeMB"`         // 单个文件上限(MB)，默认100
+	MaxBackups        int                `mapstructure:"maxBackups"`        // 保留的轮转文件数，默认5
+	Compress          bool               `mapstructure:"compress"`          // 是否压缩轮转文件
+	MaxHexBytes       int                `mapstructure:"maxHexBytes"`       // 十六进制记录的最大字节数，默认256
+	DefaultSampleRate *float64           `mapstructure:"defaultSampleRate"` // 未单独配置的命令的抽样率，不配置为1（全量），0 表示只记录 sampleRates 中列出的命令
+	SampleRates       map[string]float64 `mapstructure:"sampleRates"`       // 命令码(0x21)或帧类别(iccid/link/error) → 抽样率(0~1)
 }
 
 // TimeoutsConfig 超时配置
@@ -132,7 +219,71 @@ type DeviceConnectionConfig struct {
 	// 生产环境建议设置为 7 分钟 (420 秒)
 	HeartbeatWarningThreshold int                    `mapstructure:"heartbeatWarningThreshold" yaml:"heartbeatWarningThreshold"`
 	SessionTimeoutMinutes     int                    `mapstructure:"sessionTimeoutMinutes" yaml:"sessionTimeoutMinutes"`
-	Timeouts                  DifferentiatedTimeouts `mapstructure:"timeouts" yaml:"timeouts"` // 🔧 新增：差异化超时配置
+	Timeouts                  DifferentiatedTimeouts `mapstructure:"timeouts" yaml:"timeouts"`               // 🔧 新增：差异化超时配置
+	ICCIDConflict             ICCIDConflictConfig    `mapstructure:"iccidConflict" yaml:"iccidConflict"`     // 🔧 新增：ICCID冲突检测配置
+	SIMPair                   SIMPairConfig          `mapstructure:"simPair" yaml:"simPair"`                 // 双卡设备SIM卡对配置
+	SendFailure               SendFailureConfig      `mapstructure:"sendFailure" yaml:"sendFailure"`         // 发送失败保护配置
+	GroupCompaction           GroupCompactionConfig  `mapstructure:"groupCompaction" yaml:"groupCompaction"` // 设备组惰性压缩配置
+	CommandQueue              CommandQueueConfig     `mapstructure:"commandQueue" yaml:"commandQueue"`       // 设备组出站命令队列配置
+	CommandRetry              CommandRetryConfig     `mapstructure:"commandRetry" yaml:"commandRetry"`       // 未确认命令重发策略
+	// 按设备类型覆盖心跳超时（秒），键为设备类型（十进制或0x前缀十六进制），未配置的类型使用 heartbeatTimeoutSeconds
+	HeartbeatTimeoutByType map[string]int `mapstructure:"heartbeatTimeoutByType" yaml:"heartbeatTimeoutByType"`
+}
+
+// SendFailureConfig 发送失败保护配置：连续发送失败或发送阻塞过久时主动关闭连接
+type SendFailureConfig struct {
+	Enabled           bool `mapstructure:"enabled" yaml:"enabled"`                     // 是否启用
+	Threshold         int  `mapstructure:"threshold" yaml:"threshold"`                 // 连续发送失败次数超过该值时关闭连接
+	WriteBlockSeconds int  `mapstructure:"writeBlockSeconds" yaml:"writeBlockSeconds"` // 单次发送阻塞超过该时长且失败时立即关闭连接
+}
+
+// CommandQueueConfig 设备组出站命令队列配置：同一ICCID下的设备共享连接，命令串行写入，需要应答的命令确认后才写入下一条
+type CommandQueueConfig struct {
+	MaxDepth              int `mapstructure:"maxDepth" yaml:"maxDepth"`                           // 每个设备组排队（含正在执行）的命令数上限，超出时拒绝；0 取 maxWaitSeconds/confirmTimeoutSeconds
+	ConfirmTimeoutSeconds int `mapstructure:"confirmTimeoutSeconds" yaml:"confirmTimeoutSeconds"` // 等待设备应答的最长时间(秒)，超时后继续写入下一条
+	MaxWaitSeconds        int `mapstructure:"maxWaitSeconds" yaml:"maxWaitSeconds"`               // 调用方未设置期限时等待排队写入的最长时间(秒)，默认30
+}
+
+// CommandRetryConfig 未确认命令重发策略：超时未应答时在原连接上按原消息ID重发，重发耗尽后放弃并通知失败回调
+type CommandRetryConfig struct {
+	IntervalMs    int  `mapstructure:"intervalMs" yaml:"intervalMs"`       // 每次发送后等待应答的时长(毫秒)，0使用默认15000
+	MaxRetries    int  `mapstructure:"maxRetries" yaml:"maxRetries"`       // 重发次数上限（不含首次发送），负数表示不重发，0使用默认2
+	Exponential   bool `mapstructure:"exponential" yaml:"exponential"`     // 指数退避：第n次重发后等待 intervalMs×2^n
+	MaxIntervalMs int  `mapstructure:"maxIntervalMs" yaml:"maxIntervalMs"` // 指数退避的单次等待上限(毫秒)，0不限
+}
+
+// GroupCompactionConfig 设备组惰性压缩配置：条目数远低于历史峰值的设备组按实际大小重建映射，回收 map 不缩容占用的内存
+type GroupCompactionConfig struct {
+	Enabled         bool    `mapstructure:"enabled" yaml:"enabled"`                 // 是否启用
+	IntervalSeconds int     `mapstructure:"intervalSeconds" yaml:"intervalSeconds"` // 巡检间隔(秒)
+	MinPeak         int     `mapstructure:"minPeak" yaml:"minPeak"`                 // 历史峰值达到该值的映射才考虑重建
+	ShrinkRatio     float64 `mapstructure:"shrinkRatio" yaml:"shrinkRatio"`         // 当前条目数 ≤ 峰值 × shrinkRatio 时重建
+	MinChurn        int64   `mapstructure:"minChurn" yaml:"minChurn"`               // 顶层映射删除次数达到该值才计算墓碑占比
+	ChurnRatio      float64 `mapstructure:"churnRatio" yaml:"churnRatio"`           // 顶层映射 删除/写入 超过该值标记墓碑偏多
+}
+
+// SIMPairConfig 双卡设备SIM卡对配置
+type SIMPairConfig struct {
+	HistoryWindowSeconds int             `mapstructure:"historyWindowSeconds" yaml:"historyWindowSeconds"` // 旧卡在该时间内有连接才视为切换
+	SettleWindowSeconds  int             `mapstructure:"settleWindowSeconds" yaml:"settleWindowSeconds"`   // 切换稳定期：期间旧卡抢占存活的新卡连接时拒绝
+	Pairs                []SIMPairOption `mapstructure:"pairs" yaml:"pairs"`                               // 预先声明的SIM卡对
+}
+
+// SIMPairOption 单台双卡设备的SIM卡对
+type SIMPairOption struct {
+	DeviceID       string `mapstructure:"deviceId" yaml:"deviceId"`
+	PrimaryICCID   string `mapstructure:"primaryIccid" yaml:"primaryIccid"`
+	SecondaryICCID string `mapstructure:"secondaryIccid" yaml:"secondaryIccid"`
+}
+
+// ICCIDConflictConfig ICCID冲突检测配置
+type ICCIDConflictConfig struct {
+	Enabled          bool   `mapstructure:"enabled" yaml:"enabled"`                   // 是否启用冲突检测
+	Policy           string `mapstructure:"policy" yaml:"policy"`                     // 冲突策略: log-only(默认，仅告警不关闭旧连接), allow-takeover, reject-new, allow-both-with-suffix
+	WindowSeconds    int    `mapstructure:"windowSeconds" yaml:"windowSeconds"`       // 检测窗口：旧连接在该时间内有活动才视为冲突
+	IPMatch          string `mapstructure:"ipMatch" yaml:"ipMatch"`                   // 来源地址相似度规则: exact, subnet24
+	RetentionMinutes int    `mapstructure:"retentionMinutes" yaml:"retentionMinutes"` // 冲突记录保留时长（分钟）
+	MaxRecords       int    `mapstructure:"maxRecords" yaml:"maxRecords"`             // 冲突记录最大条数
 }
 
 // DifferentiatedTimeouts 差异化超时配置
@@ -197,14 +348,58 @@ func LoadConfig(configPath string) error {
 
 // NotificationConfig 通知配置
 type NotificationConfig struct {
-	Enabled        bool                    `mapstructure:"enabled"`
-	QueueSize      int                     `mapstructure:"queue_size"`
-	Workers        int                     `mapstructure:"workers"`
-	PortStatusSync PortStatusSyncConfig    `mapstructure:"port_status_sync"`
-	Endpoints      []NotificationEndpoint  `mapstructure:"endpoints"`
-	Retry          NotificationRetryConfig `mapstructure:"retry"`
-	Sampling       map[string]int          `mapstructure:"sampling"`
-	Throttle       map[string]string       `mapstructure:"throttle"`
+	Enabled        bool                     `mapstructure:"enabled"`
+	QueueSize      int                      `mapstructure:"queue_size"`
+	Workers        int                      `mapstructure:"workers"`
+	PortStatusSync PortStatusSyncConfig     `mapstructure:"port_status_sync"`
+	Endpoints      []NotificationEndpoint   `mapstructure:"endpoints"`
+	Retry          NotificationRetryConfig  `mapstructure:"retry"`
+	Sampling       map[string]int           `mapstructure:"sampling"`
+	Throttle       map[string]string        `mapstructure:"throttle"`
+	Spool          NotificationSpoolConfig  `mapstructure:"spool"`
+	FanOut         NotificationFanOutConfig `mapstructure:"fan_out"`
+
+	DeadLetter     NotificationDeadLetterConfig     `mapstructure:"dead_letter"`
+	CircuitBreaker NotificationCircuitBreakerConfig `mapstructure:"circuit_breaker"`
+}
+
+// NotificationDeadLetterConfig 死信落地：未启用暂存时，重试用尽的关键事件写入Redis列表（不可用时写入文件），不再静默丢弃
+type NotificationDeadLetterConfig struct {
+	File       string `mapstructure:"file"`        // 死信文件（每行一条JSON），为空时位于 spool.dir 的上级目录（notification_deadletter.jsonl）
+	RedisKey   string `mapstructure:"redis_key"`   // Redis列表键，默认 notify:deadletter
+	MaxEntries int    `mapstructure:"max_entries"` // Redis列表保留的最新记录数，默认10000
+}
+
+// NotificationFanOutConfig 全局出站限流：路由后、分发到端点前按令牌桶限速，关键事件优先；
+// 低优先级事件排队超过上限后按端点汇总为 notification_digest 摘要事件
+type NotificationFanOutConfig struct {
+	Enabled        bool    `mapstructure:"enabled"`
+	RatePerSecond  float64 `mapstructure:"rate_per_second"` // 每秒分发事件数
+	Burst          int     `mapstructure:"burst"`           // 突发容量，0表示等于每秒事件数
+	QueueDepth     int     `mapstructure:"queue_depth"`     // 每个优先级类别的排队上限
+	DigestInterval string  `mapstructure:"digest_interval"` // 摘要汇总周期，如 "10s"
+}
+
+// NotificationCircuitBreakerConfig 端点熔断：连续失败或窗口内失败率过高时暂停向该端点投递，冷却后放行探测请求
+type NotificationCircuitBreakerConfig struct {
+	Enabled             bool    `mapstructure:"enabled"`
+	ConsecutiveFailures int     `mapstructure:"consecutive_failures"` // 连续失败次数阈值
+	FailureRate         float64 `mapstructure:"failure_rate"`         // 窗口内失败率阈值（百分比）
+	MinRequests         int     `mapstructure:"min_requests"`         // 按失败率熔断所需的窗口内最少请求数
+	Window              string  `mapstructure:"window"`               // 失败率统计窗口，如 "1m"
+	CoolDown            string  `mapstructure:"cool_down"`            // 熔断冷却时间，如 "30s"
+	HalfOpenProbes      int     `mapstructure:"half_open_probes"`     // 半开状态探测请求数
+}
+
+// NotificationSpoolConfig 重试用尽事件的磁盘暂存：端点长时间不可用期间的事件在恢复后按序重新投递
+type NotificationSpoolConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Dir             string `mapstructure:"dir"`               // 暂存目录
+	MaxBytes        int64  `mapstructure:"max_bytes"`         // 暂存总大小上限(字节)，超过时丢弃最旧的日志段
+	SegmentMaxBytes int64  `mapstructure:"segment_max_bytes"` // 单个日志段上限(字节)
+	MaxAge          string `mapstructure:"max_age"`           // 事件超过该时长仍未投递成功则放弃，如 "24h"
+	ReplayInterval  string `mapstructure:"replay_interval"`   // 定时重新投递间隔，如 "1m"（启动时立即执行一轮）
+	WarnBytes       int64  `mapstructure:"warn_bytes"`        // 超过该值时 /readyz 告警（不影响就绪），0表示容量上限的80%
 }
 
 // PortStatusSyncConfig 端口状态同步配置
@@ -222,6 +417,18 @@ type NotificationEndpoint struct {
 	Timeout    string            `mapstructure:"timeout"`
 	EventTypes []string          `mapstructure:"event_types"`
 	Enabled    bool              `mapstructure:"enabled"`
+
+	// 路由选择器：为空表示不限；声明了 tenants 的端点不接收未标注租户的事件
+	Tenants     []string `mapstructure:"tenants"`      // 租户（运营商）选择器
+	DeviceTypes []string `mapstructure:"device_types"` // 设备类型选择器（十进制设备类型码，如 "4"）
+
+	RateLimitPerSecond int `mapstructure:"rate_limit_per_second"` // 暂存重新投递的速率上限（次/秒），0不限
+
+	// webhook 签名密钥：非空时对请求体做 HMAC-SHA256 签名，十六进制摘要放在 X-IoT-Signature，签名时间放在 X-IoT-Timestamp
+	Secret string `mapstructure:"secret"`
+
+	Concurrency int `mapstructure:"concurrency"` // 端点投递并发数，默认2
+	QueueSize   int `mapstructure:"queue_size"`  // 端点投递队列大小，默认1000
 }
 
 // NotificationRetryConfig 重试配置
@@ -244,8 +451,640 @@ type SmartChargingConfig struct {
 	SampleRate             int     `mapstructure:"sampleRate"`             // 心跳采样率(1表示每条)
 }
 
+// ChargeQueueConfig 设备侧排队（0x82应答待充端口位图）处理配置
+type ChargeQueueConfig struct {
+	Enabled        bool `mapstructure:"enabled"`        // 是否识别排队状态（关闭时按原逻辑视为充电开始）
+	TimeoutSeconds int  `mapstructure:"timeoutSeconds"` // 排队超时(秒)，超时后通知
+	AutoCancel     bool `mapstructure:"autoCancel"`     // 超时后是否自动下发停止并取消订单
+}
+
+// SessionLimitsConfig 设备并发充电会话上限（按供电容量限制同一设备同时充电的端口数）
+type SessionLimitsConfig struct {
+	DefaultMaxConcurrent int    `mapstructure:"defaultMaxConcurrent"` // 未单独配置的设备默认上限，0表示不限制
+	FilePath             string `mapstructure:"filePath"`             // 设备上限持久化文件，为空时仅保存在内存
+}
+
+// PowerProfilesConfig 站点功率时段预算（按时段给站点设定总功率预算，经智能降功率控制器分配到端口）
+type PowerProfilesConfig struct {
+	FilePath            string `mapstructure:"filePath"`            // 时段定义与人工覆盖持久化文件，为空时仅保存在内存
+	RampStepW           int    `mapstructure:"rampStepW"`           // 预算切换时每步最大变化(瓦)，0表示直接切换
+	RampIntervalSeconds int    `mapstructure:"rampIntervalSeconds"` // 评估与爬坡间隔(秒)，默认30
+}
+
+// DetailCacheConfig 设备详情短TTL缓存（同设备并发请求共享一次组装，设备事件到达时立即失效）
+type DetailCacheConfig struct {
+	TTLMs      int `mapstructure:"ttlMs"`      // 缓存有效期(毫秒)，默认1000，负数禁用缓存
+	MaxDevices int `mapstructure:"maxDevices"` // 缓存设备数上限（超出按LRU淘汰），默认2000
+}
+
+// StateDumpConfig 事故现场状态转储（设备、会话、待应答命令、最近事件、统计、脱敏配置与运行时剖析打包为一个压缩归档）
+type StateDumpConfig struct {
+	Dir          string `mapstructure:"dir"`          // 归档输出目录
+	MaxBytes     int64  `mapstructure:"maxBytes"`     // 单个归档大小上限(字节)，超出后跳过剩余分段，默认64MB
+	MaxDumps     int    `mapstructure:"maxDumps"`     // 保留的归档数上限（超过后删除最旧的），默认10
+	MaxAgeHours  int    `mapstructure:"maxAgeHours"`  // 归档保留时长(小时)，0表示不按时间清理
+	EventLimit   int    `mapstructure:"eventLimit"`   // 转储的最近事件数上限，默认5000
+	SignalEnable bool   `mapstructure:"signalEnable"` // 收到 SIGUSR1 时转储（非Windows）
+}
+
+// PostOutageReplayConfig 长时间停机后的积压重放审批：停机超过阈值时延迟命令、通知暂存与关键帧日志暂缓重放，批准后按速率重放
+type PostOutageReplayConfig struct {
+	Enabled                  bool    `mapstructure:"enabled"`
+	StateFile                string  `mapstructure:"stateFile"`                // 存活时间标记文件
+	DowntimeThresholdSeconds int     `mapstructure:"downtimeThresholdSeconds"` // 停机超过该时长(秒)时暂缓重放，默认3600
+	MarkIntervalSeconds      int     `mapstructure:"markIntervalSeconds"`      // 存活时间标记写入间隔(秒)，默认30
+	AutoApprove              bool    `mapstructure:"autoApprove"`              // 无人值守站点：启动完成后自动批准（仍按速率重放）
+	RatePerSecond            float64 `mapstructure:"ratePerSecond"`            // 默认重放速率(条/秒)，0表示不限速
+}
+
+// AssetResolverConfig 设备ID↔业务资产映射配置
+type AssetResolverConfig struct {
+	Type string                  `mapstructure:"type"` // 解析器类型: 空(禁用)/file/http
+	File AssetFileResolverConfig `mapstructure:"file"`
+	HTTP AssetHTTPResolverConfig `mapstructure:"http"`
+}
+
+// AssetFileResolverConfig 静态映射文件解析器配置
+type AssetFileResolverConfig struct {
+	Path                  string `mapstructure:"path"`                  // 映射文件路径(.csv/.yaml/.yml)
+	ReloadIntervalSeconds int    `mapstructure:"reloadIntervalSeconds"` // 文件变更检查间隔(秒)，0表示不热加载
+}
+
+// AssetHTTPResolverConfig HTTP资产服务解析器配置
+type AssetHTTPResolverConfig struct {
+	URL                string            `mapstructure:"url"`                // 查询地址，支持 {deviceId} 占位符
+	Headers            map[string]string `mapstructure:"headers"`            // 附加请求头
+	TimeoutMillis      int               `mapstructure:"timeoutMillis"`      // 单次请求超时(毫秒)
+	CacheTTLSeconds    int               `mapstructure:"cacheTTLSeconds"`    // 命中缓存时长(秒)
+	NegativeTTLSeconds int               `mapstructure:"negativeTTLSeconds"` // 未命中缓存时长(秒)
+	MaxConcurrent      int               `mapstructure:"maxConcurrent"`      // 后台并发查询上限
+	FailureThreshold   int               `mapstructure:"failureThreshold"`   // 连续失败熔断阈值
+	OpenSeconds        int               `mapstructure:"openSeconds"`        // 熔断持续时长(秒)
+}
+
+// PromotionConfig 充电促销策略配置（开始充电前覆盖设备侧计费参数）
+type PromotionConfig struct {
+	Enabled bool                  `mapstructure:"enabled"` // 是否启用促销策略
+	Rules   []PromotionRuleConfig `mapstructure:"rules"`   // 促销规则，按顺序匹配，首条命中生效
+}
+
+// PromotionRuleConfig 促销规则
+type PromotionRuleConfig struct {
+	ID              string   `mapstructure:"id"`
+	Tag             string   `mapstructure:"tag"`             // 会话促销标签
+	Start           string   `mapstructure:"start"`           // 生效开始时间 "2006-01-02 15:04:05"，空表示不限
+	End             string   `mapstructure:"end"`             // 生效结束时间，空表示不限
+	Weekdays        []int    `mapstructure:"weekdays"`        // 生效星期(0=周日)，空表示每天
+	DailyStart      string   `mapstructure:"dailyStart"`      // 每日生效开始 "HH:MM"，空表示全天
+	DailyEnd        string   `mapstructure:"dailyEnd"`        // 每日生效结束 "HH:MM"
+	DeviceIDs       []string `mapstructure:"deviceIds"`       // 限定设备，空表示不限
+	ICCIDs          []string `mapstructure:"iccids"`          // 限定ICCID，空表示不限
+	Tenants         []string `mapstructure:"tenants"`         // 限定租户（开始充电请求携带），空表示不限
+	Free            bool     `mapstructure:"free"`            // 免费会话：结算费用非0视为对账差异
+	RateMode        *int     `mapstructure:"rateMode"`        // 覆盖计费模式 0=按时间 1=按电量，不配置表示不覆盖
+	DurationSeconds int      `mapstructure:"durationSeconds"` // 覆盖充电时长/电量值，0不覆盖
+	Balance         uint32   `mapstructure:"balance"`         // 覆盖余额(分)，0不覆盖
+}
+
+// RebootConfig 远程重启配置
+type RebootConfig struct {
+	ReconnectWindowSeconds int `mapstructure:"reconnectWindowSeconds"` // 重启后等待设备重新注册的时长(秒)，超时判为失败
+}
+
+// PersistenceConfig 持久化数据版本兼容：读取到高于当前程序支持版本的记录时的处理方式
+type PersistenceConfig struct {
+	UnknownVersionPolicy string `mapstructure:"unknownVersionPolicy"` // refuse（默认，拒绝启动）| archive（原样归档后跳过）
+	ArchiveDir           string `mapstructure:"archiveDir"`           // archive 策略的归档目录
+}
+
+// ReplicaConfig 只读副本：主实例定期将设备状态快照写入Redis，只读副本仅启动HTTP API并从快照应答报表类查询
+type ReplicaConfig struct {
+	ReadOnly               bool   `mapstructure:"readOnly"`               // 以只读副本模式启动（不启动TCP监听、不下发命令），命令行 -read-only 等效
+	Publish                bool   `mapstructure:"publish"`                // 主实例是否发布状态快照
+	PublishIntervalSeconds int    `mapstructure:"publishIntervalSeconds"` // 主实例发布间隔(秒)
+	RedisKey               string `mapstructure:"redisKey"`               // 状态快照的Redis哈希键（每个主实例一个字段）
+	RefreshIntervalSeconds int    `mapstructure:"refreshIntervalSeconds"` // 副本读取快照的缓存时间(秒)
+	MaxStalenessSeconds    int    `mapstructure:"maxStalenessSeconds"`    // 快照发布时间早于该时长时响应标记 stale
+	PrimaryURL             string `mapstructure:"primaryUrl"`             // 主实例API地址，副本拒绝写操作时在响应中返回
+}
+
+// GroupBroadcastConfig 设备组广播：同一ICCID共享连接的多台设备批量下发参数
+type GroupBroadcastConfig struct {
+	SendIntervalMs    int `mapstructure:"sendIntervalMs"`    // 同一连接上相邻两帧的最小间隔(毫秒)
+	AckTimeoutSeconds int `mapstructure:"ackTimeoutSeconds"` // 全部帧下发后等待各设备应答的超时(秒)
+	HistorySize       int `mapstructure:"historySize"`       // 保留的广播记录数
+}
+
+// DeviceConfigReadConfig 设备配置读取（0x90~0x93 参数查询）与黄金模板配置
+type DeviceConfigReadConfig struct {
+	RetryIntervalSeconds int    `mapstructure:"retryIntervalSeconds"` // 分段未到齐时补发查询的间隔(秒)
+	MaxAttempts          int    `mapstructure:"maxAttempts"`          // 单次读取的最大查询轮数（含首轮）
+	TemplateFile         string `mapstructure:"templateFile"`         // 黄金模板持久化文件，为空时仅保存在内存
+}
+
+// RegistrationBackfillConfig 注册补齐配置：进程启动（或大规模断连）后的窗口内，
+// 对已上报ICCID但迟迟未注册的连接下发0x81查询，促使设备立即发送0x20注册包
+type RegistrationBackfillConfig struct {
+	Enabled                     bool `mapstructure:"enabled"`
+	DelaySeconds                int  `mapstructure:"delaySeconds"`                // 连接建立（或窗口激活）后等待设备自行注册的时长(秒)
+	WindowSeconds               int  `mapstructure:"windowSeconds"`               // 补齐窗口时长(秒)，窗口外不下发任何请求
+	RatePerSecond               int  `mapstructure:"ratePerSecond"`               // 每秒最多下发的请求数（避免数千连接同时下发）
+	MaxAttempts                 int  `mapstructure:"maxAttempts"`                 // 单连接最大请求次数
+	RetryIntervalSeconds        int  `mapstructure:"retryIntervalSeconds"`        // 同一连接两次请求的间隔(秒)
+	MassDisconnectThreshold     int  `mapstructure:"massDisconnectThreshold"`     // 统计窗口内断开连接数达到该值时重新激活补齐窗口，0表示不检测
+	MassDisconnectWindowSeconds int  `mapstructure:"massDisconnectWindowSeconds"` // 大规模断连统计窗口(秒)
+}
+
+// FrameJournalConfig 关键业务帧预写日志配置：指定命令在发送应答前落盘，下游交接完成后标记，崩溃后启动重放
+type FrameJournalConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Dir             string `mapstructure:"dir"`             // 日志目录
+	Commands        []int  `mapstructure:"commands"`        // 需预写的上行命令
+	SegmentMaxBytes int64  `mapstructure:"segmentMaxBytes"` // 单个日志段上限(字节)，超过后轮转
+	MaxTotalBytes   int64  `mapstructure:"maxTotalBytes"`   // 日志总大小上限(字节)，超过后降级为处理后应答并告警
+	RetentionHours  int    `mapstructure:"retentionHours"`  // 已处理日志段及幂等键的保留时长(小时)
+}
+
+// SettlementStoreConfig 结算日志存储配置：结算连同原始帧追加写入段文件，fsync后才应答，供结算查询与对账
+type SettlementStoreConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`
+	Dir              string `mapstructure:"dir"`              // 存储目录
+	SegmentMaxBytes  int64  `mapstructure:"segmentMaxBytes"`  // 单个段文件上限(字节)，超过后轮转
+	RetentionDays    int    `mapstructure:"retentionDays"`    // 段保留天数，按段最后写入时间整段删除
+	SyncMaxLatencyMs int    `mapstructure:"syncMaxLatencyMs"` // 合并fsync的最长等待(毫秒)，负数表示每条立即fsync
+	SyncMaxBatch     int    `mapstructure:"syncMaxBatch"`     // 单次fsync最多合并的写入数
+}
+
+// 协议一致性模式
+const (
+	ConformanceModePermissive = "permissive" // 宽松：兼容老固件，不做额外校验（默认）
+	ConformanceModeStrict     = "strict"     // 严格：违反厂商协议规范的帧应答NAK或丢弃并记录
+)
+
+// ConformanceConfig 协议一致性配置（设备厂商认证时使用严格模式）
+type ConformanceConfig struct {
+	Mode                   string `mapstructure:"mode"`                   // permissive | strict
+	MessageIDWindowSeconds int    `mapstructure:"messageIdWindowSeconds"` // 消息ID单调递增的检查窗口(秒)，超过窗口未收到帧则重新计数
+	MaxViolations          int    `mapstructure:"maxViolations"`          // 保留的违规记录条数
+}
+
+// EffectiveMode 监听器的生效模式：监听器覆盖优先，其次全局，默认宽松
+func (c ConformanceConfig) EffectiveMode(listenerOverride string) string {
+	if listenerOverride != "" {
+		return listenerOverride
+	}
+	if c.Mode != "" {
+		return c.Mode
+	}
+	return ConformanceModePermissive
+}
+
+// ChecksumConfig 上行DNY帧校验和配置：strict 丢弃并应答NAK（仅当物理ID为本连接已绑定的设备且命令已知），lenient 照常处理但计数并记录日志，off 不校验
+type ChecksumConfig struct {
+	Mode    string            `mapstructure:"mode"`    // strict | lenient | off，空为 lenient
+	Classes map[string]string `mapstructure:"classes"` // 按命令分类覆盖模式：heartbeat/registration/charging/configuration/upgrade/query/control/time/unknown
+}
+
+// GarbagePreambleConfig 连接前导杂散数据配置：部分路由器PPP重拨时会在ICCID之前发送AT指令回显等杂散字节
+type GarbagePreambleConfig struct {
+	BudgetBytes int `mapstructure:"budgetBytes"` // 首个可识别报文（ICCID/link/DNY）之前允许丢弃的字节数，超过后以 garbage_preamble 原因关闭连接
+	HistorySize int `mapstructure:"historySize"` // 诊断保留的已关闭连接记录数
+}
+
+// ClusterConfig 多实例部署配置：持有设备TCP连接的实例在Redis中登记设备归属，API响应携带归属实例供网关路由
+type ClusterConfig struct {
+	Enabled                bool   `mapstructure:"enabled"`                // 是否启用集群模式（关闭时所有设备视为归属本实例）
+	InstanceID             string `mapstructure:"instanceId"`             // 实例ID，为空时使用主机名
+	AdvertiseURL           string `mapstructure:"advertiseUrl"`           // 本实例对外公布的API基础地址，如 http://10.0.0.11:7055
+	KeyPrefix              string `mapstructure:"keyPrefix"`              // 归属键前缀
+	OwnerTTLSeconds        int    `mapstructure:"ownerTtlSeconds"`        // 归属键过期时间(秒)，实例崩溃后到期自动失效
+	RefreshIntervalSeconds int    `mapstructure:"refreshIntervalSeconds"` // 归属续期周期(秒)，须小于过期时间
+	LookupCacheSeconds     int    `mapstructure:"lookupCacheSeconds"`     // 远端归属查询结果的缓存时间(秒)
+}
+
+// StationsConfig 站点聚合配置（设备按资产映射的 station_id 归属站点）
+type StationsConfig struct {
+	DegradedOfflineFraction float64 `mapstructure:"degradedOfflineFraction"` // 离线设备占比超过该值判为站点降级，默认0.5
+	RemapIntervalSeconds    int     `mapstructure:"remapIntervalSeconds"`    // 定期按资产映射重新归属设备的周期（HTTP解析器无重新加载通知），默认300
+	PortStaleSeconds        int     `mapstructure:"portStaleSeconds"`        // 端口超过该时长未上报状态即标记为过期，不再展示最后功率，默认180
+}
+
+// DeferredCommandsConfig 延迟命令配置：设备离线时按 deliverWhen=online 暂存命令，设备注册后按序下发
+type DeferredCommandsConfig struct {
+	File                   string `mapstructure:"file"`                   // 待下发队列持久化文件，为空时仅保存在内存
+	MaxPerDevice           int    `mapstructure:"maxPerDevice"`           // 单设备待下发命令上限
+	DefaultTTLSeconds      int    `mapstructure:"defaultTtlSeconds"`      // 未指定有效期时的默认有效期(秒)
+	MaxTTLSeconds          int    `mapstructure:"maxTtlSeconds"`          // 有效期上限(秒)
+	HistorySize            int    `mapstructure:"historySize"`            // 单设备保留的已结束命令数
+	CallbackTimeoutSeconds int    `mapstructure:"callbackTimeoutSeconds"` // 结果回调请求超时(秒)
+}
+
+// MacrosConfig 设备宏配置：按序执行的多步运维命令，任一步失败即中止并执行已定义的回滚步骤
+type MacrosConfig struct {
+	TimeoutSeconds     int                     `mapstructure:"timeoutSeconds"`     // 宏整体超时(秒)，宏定义未指定时使用
+	StepTimeoutSeconds int                     `mapstructure:"stepTimeoutSeconds"` // 单步等待设备应答的超时(秒)，回滚步骤同样适用
+	HistorySize        int                     `mapstructure:"historySize"`        // 保留的已结束执行记录数
+	Definitions        []MacroDefinitionConfig `mapstructure:"definitions"`        // 自定义宏（与内置宏同名时覆盖）
+}
+
+// MacroDefinitionConfig 自定义宏定义
+type MacroDefinitionConfig struct {
+	Name           string            `mapstructure:"name"`
+	Description    string            `mapstructure:"description"`
+	TimeoutSeconds int               `mapstructure:"timeoutSeconds"`
+	Steps          []MacroStepConfig `mapstructure:"steps"`
+}
+
+// MacroStepConfig 宏步骤：action 为内置步骤动作（stop_charge、await_stop_confirm、read_power_params、
+// set_overload_power、restore_power_params、query_status）
+type MacroStepConfig struct {
+	Name           string `mapstructure:"name"`           // 步骤名，为空时使用动作名
+	Action         string `mapstructure:"action"`         // 步骤动作
+	Value          int    `mapstructure:"value"`          // 动作参数（如 set_overload_power 的过载功率W）
+	TimeoutSeconds int    `mapstructure:"timeoutSeconds"` // 单步超时(秒)，为0时使用全局单步超时
+}
+
+// MessageIDConfig 下行消息ID序列持久化：定期及停机时保存序列位置，重启后跳跃恢复，
+// 避免设备按最近收到的消息ID去重而丢弃重启后的前几条命令
+type MessageIDConfig struct {
+	Store                  string `mapstructure:"store"`                  // 持久化方式: file | redis | memory（默认file）
+	FilePath               string `mapstructure:"filePath"`               // file 模式的序列文件路径
+	RedisKey               string `mapstructure:"redisKey"`               // redis 模式的存储键（多实例须各自不同）
+	PersistIntervalSeconds int    `mapstructure:"persistIntervalSeconds"` // 定期持久化间隔(秒)
+	RestoreGap             int    `mapstructure:"restoreGap"`             // 恢复时在持久化值之后跳过的ID数，须覆盖一个持久化间隔内的最大分配量
+}
+
+// CapabilitiesConfig 设备固件能力矩阵：按设备类型与固件版本推导支持的下行命令，API下发前校验
+type CapabilitiesConfig struct {
+	MatrixFile            string `mapstructure:"matrixFile"`            // 能力矩阵文件(.yaml)，为空时不做能力校验
+	ReloadIntervalSeconds int    `mapstructure:"reloadIntervalSeconds"` // 矩阵文件变更检查间隔(秒)，0表示不热加载
+	UnknownVersionPolicy  string `mapstructure:"unknownVersionPolicy"`  // 版本未知或不在矩阵范围内: minimal(仅基础命令) | full(全部命令)
+	OverridesFile         string `mapstructure:"overridesFile"`         // 单设备例外持久化文件，为空时仅保存在内存
+}
+
+// ChargingPolicyConfig 充电参数护栏：按租户限制充电时长、功率、余额与计费模式，超限拒绝、接近上限告警
+type ChargingPolicyConfig struct {
+	PolicyFile            string `mapstructure:"policyFile"`            // 策略文件(.yaml)，为空时不做限制
+	ReloadIntervalSeconds int    `mapstructure:"reloadIntervalSeconds"` // 策略文件变更检查间隔(秒)，0表示不热加载
+}
+
+// LowDataConfig 低流量模式：按租户或ICCID抑制可选应答、合并下行帧并抑制非必要主动查询，用于按流量计费的SIM卡
+type LowDataConfig struct {
+	PolicyFile            string `mapstructure:"policyFile"`            // 模式分配文件(.yaml)，为空时不启用
+	ReloadIntervalSeconds int    `mapstructure:"reloadIntervalSeconds"` // 分配文件变更检查间隔(秒)，0表示不热加载
+	CoalesceWindowMs      int    `mapstructure:"coalesceWindowMs"`      // 下行帧合并窗口(毫秒)，默认50
+	CoalesceMaxBytes      int    `mapstructure:"coalesceMaxBytes"`      // 合并批次字节上限，达到后立即写出，默认1024
+	TimeSyncDedupSeconds  int    `mapstructure:"timeSyncDedupSeconds"`  // 对时去重窗口(秒)，默认60
+	PacketOverheadBytes   int    `mapstructure:"packetOverheadBytes"`   // 估算节省字节时每个TCP报文的报头开销，默认40
+}
+
+// DecommissionConfig 设备停用归档：归档记录同时作为注册黑名单，须持久化以免重启后停用设备静默重新接入
+type DecommissionConfig struct {
+	Store                       string `mapstructure:"store"`                       // 持久化方式: file | redis | memory（默认file）
+	FilePath                    string `mapstructure:"filePath"`                    // file 模式的归档文件路径
+	RedisKey                    string `mapstructure:"redisKey"`                    // redis 模式的存储键
+	RejectNotifyIntervalSeconds int    `mapstructure:"rejectNotifyIntervalSeconds"` // 同一停用设备注册被拒告警的最小间隔(秒)
+}
+
+// ReadDeadlineConfig 按连接自适应读超时：已注册设备按帧间隔EWMA推导读超时，超时先告警探测再断开
+type ReadDeadlineConfig struct {
+	PreRegistrationSeconds int     `mapstructure:"preRegistrationSeconds"` // 未注册连接的读超时(秒)，超时直接断开
+	Factor                 float64 `mapstructure:"factor"`                 // 有效读超时 = 帧间隔EWMA × factor
+	MinSeconds             int     `mapstructure:"minSeconds"`             // 有效读超时下限(秒)
+	MaxSeconds             int     `mapstructure:"maxSeconds"`             // 有效读超时上限(秒)，尚无帧间隔样本时采用
+	EWMAAlpha              float64 `mapstructure:"ewmaAlpha"`              // EWMA平滑系数(0,1]
+	ProbeGraceSeconds      int     `mapstructure:"probeGraceSeconds"`      // 告警并下发探测后的宽限期(秒)，期间仍无任何帧则断开
+	CheckIntervalSeconds   int     `mapstructure:"checkIntervalSeconds"`   // 巡检间隔(秒)
+}
+
+// ChangeLogConfig 运维变更记录：记录所有变更类API调用的调用方、请求体、目标设备、前后状态快照与结果
+type ChangeLogConfig struct {
+	Enabled           bool     `mapstructure:"enabled"`
+	Capacity          int      `mapstructure:"capacity"`          // 保留条数（内存与持久化均只保留最近这些条）
+	Store             string   `mapstructure:"store"`             // 持久化方式: memory | file | redis
+	FilePath          string   `mapstructure:"filePath"`          // file 模式的记录文件(JSON Lines)
+	RedisKey          string   `mapstructure:"redisKey"`          // redis 模式的列表键
+	MaxBodyBytes      int      `mapstructure:"maxBodyBytes"`      // 请求体超过该长度截断
+	MaxSnapshotBytes  int      `mapstructure:"maxSnapshotBytes"`  // 单台设备状态快照超过该长度截断
+	SnapshotTimeoutMs int      `mapstructure:"snapshotTimeoutMs"` // 单次快照采集超时(毫秒)，超时不采集也不影响调用
+	RedactFields      []string `mapstructure:"redactFields"`      // 请求体中需脱敏的字段名（不区分大小写，任意层级）
+	KeyHeader         string   `mapstructure:"keyHeader"`         // 调用方API Key名称请求头（由网关前置鉴权层设置）
+	TenantHeader      string   `mapstructure:"tenantHeader"`      // 租户请求头
+	ExcludeEndpoints  []string `mapstructure:"excludeEndpoints"`  // 不记录的变更方法路由模板（只读性质的POST等）
+}
+
+// GRPCServerConfig gRPC服务器配置（面向内部高频调用方，与HTTP API共用实现与鉴权密钥）
+type GRPCServerConfig struct {
+	Enabled              bool   `mapstructure:"enabled"`              // 默认关闭
+	Host                 string `mapstructure:"host"`                 // 监听地址
+	Port                 int    `mapstructure:"port"`                 // 监听端口（与HTTP端口分开）
+	MaxConcurrentStreams int    `mapstructure:"maxConcurrentStreams"` // 单连接最大并发流，0表示不限
+}
+
+// EnergyCountersConfig 端口累计电量计数器：结算为准、功率积分补记，按月结转并保留12个月历史，供维护按电量安排线缆更换
+type EnergyCountersConfig struct {
+	Store                  string  `mapstructure:"store"`                  // 持久化方式: file | redis | memory（默认file）
+	FilePath               string  `mapstructure:"filePath"`               // file 模式的状态文件路径
+	RedisKey               string  `mapstructure:"redisKey"`               // redis 模式的存储键
+	ThresholdKWh           float64 `mapstructure:"thresholdKWh"`           // 维护阈值(kWh)，端口累计电量达到该值在报告中标记，0表示不标记
+	SettlementGraceSeconds int     `mapstructure:"settlementGraceSeconds"` // 积分会话最后一个功率样本后等待结算的时长(秒)，超时按积分补记
+	FlushIntervalSeconds   int     `mapstructure:"flushIntervalSeconds"`   // 巡检（补记、月度结转）与持久化间隔(秒)
+}
+
+// PortAvailabilityConfig 端口状态历史：记录端口状态转换并按天聚合各状态时长，供 SLA 报告按月计算端口可用率
+type PortAvailabilityConfig struct {
+	Store                   string `mapstructure:"store"`                   // 持久化方式: file | redis | memory（默认file）
+	FilePath                string `mapstructure:"filePath"`                // file 模式的状态文件路径
+	RedisKey                string `mapstructure:"redisKey"`                // redis 模式的存储键
+	MaxTransitionsPerDevice int    `mapstructure:"maxTransitionsPerDevice"` // 单设备保留的最近状态转换条数
+	RetentionDays           int    `mapstructure:"retentionDays"`           // 按天聚合的保留天数
+	RestartGraceSeconds     int    `mapstructure:"restartGraceSeconds"`     // 重启后等待设备重新上报的时长(秒)，超时未上报的端口推断为离线
+	FlushIntervalSeconds    int    `mapstructure:"flushIntervalSeconds"`    // 聚合与持久化间隔(秒)
+}
+
+// CommLogConfig 设备通信日志：按设备保存最近收发的原始帧，可导出二进制抓包供厂商分析工具离线分析
+type CommLogConfig struct {
+	Enabled         bool `mapstructure:"enabled"`         // 是否记录
+	FramesPerDevice int  `mapstructure:"framesPerDevice"` // 单设备保留的最近帧数
+	MaxDevices      int  `mapstructure:"maxDevices"`      // 保留缓冲的设备数上限，超出时淘汰最久无收发的设备
+}
+
+// FleetAlertsConfig 全网在线设备数告警：定时采样在线设备数，按规则检测绝对值下限或窗口内下降比例
+type FleetAlertsConfig struct {
+	Enabled               bool                   `mapstructure:"enabled"`
+	SampleIntervalSeconds int                    `mapstructure:"sampleIntervalSeconds"` // 采样间隔(秒)
+	ICCIDPrefixLength     int                    `mapstructure:"iccidPrefixLength"`     // 按ICCID前缀聚合离线设备的前缀长度
+	SiteShare             float64                `mapstructure:"siteShare"`             // 单一前缀占离线设备比例达到该值判定为单站点故障
+	MaxListedICCIDs       int                    `mapstructure:"maxListedIccids"`       // 告警中列出的离线ICCID数上限
+	HistorySize           int                    `mapstructure:"historySize"`           // 保留的告警记录数
+	Rules                 []FleetAlertRuleConfig `mapstructure:"rules"`
+}
+
+// FleetAlertRuleConfig 在线设备数告警规则
+type FleetAlertRuleConfig struct {
+	Name          string  `mapstructure:"name"`
+	Type          string  `mapstructure:"type"`          // threshold | rate_of_change
+	MinOnline     int     `mapstructure:"minOnline"`     // threshold：在线设备数低于该值告警
+	WindowSeconds int     `mapstructure:"windowSeconds"` // rate_of_change：统计窗口(秒)
+	DropPercent   float64 `mapstructure:"dropPercent"`   // rate_of_change：较窗口内最高值下降的百分比达到该值告警
+	MinDrop       int     `mapstructure:"minDrop"`       // rate_of_change：下降的设备数至少为该值（避免小规模网络频繁告警）
+}
+
+// SLAConfig 按租户统计命令成功率（1h/24h/30d 滑动窗口），24h成功率低于规则阈值时告警
+type SLAConfig struct {
+	Enabled                 bool                 `mapstructure:"enabled"`
+	AttributableClasses     []string             `mapstructure:"attributableClasses"`     // 计入SLA的失败分类，默认 gateway_error、device_timeout
+	MaxTenants              int                  `mapstructure:"maxTenants"`              // 统计的租户数上限
+	EvaluateIntervalSeconds int                  `mapstructure:"evaluateIntervalSeconds"` // 定时判定告警的间隔(秒)
+	HistorySize             int                  `mapstructure:"historySize"`             // 保留的告警记录数
+	Rules                   []SLAAlertRuleConfig `mapstructure:"rules"`
+}
+
+// SLAAlertRuleConfig 租户SLA告警规则
+type SLAAlertRuleConfig struct {
+	Name              string   `mapstructure:"name"`
+	MinSuccessPercent float64  `mapstructure:"minSuccessPercent"` // 24h成功率低于该百分比告警
+	MinCommands       uint64   `mapstructure:"minCommands"`       // 24h窗口计入SLA的命令数至少为该值
+	Tenants           []string `mapstructure:"tenants"`           // 适用的租户，为空表示全部
+}
+
+// AnomalyDetectionConfig 心跳数据异常检测：按设备对温度、电压、信号强度与端口功率维护EWMA基线，持续偏离或单调变化时记录异常事件
+type AnomalyDetectionConfig struct {
+	Enabled           bool    `mapstructure:"enabled"`           // 是否检测
+	Alpha             float64 `mapstructure:"alpha"`             // EWMA 平滑系数 (0,1)
+	SigmaThreshold    float64 `mapstructure:"sigmaThreshold"`    // 偏离基线超过该σ数计为异常样本
+	SustainSamples    int     `mapstructure:"sustainSamples"`    // 连续异常样本数达到该值开启偏离事件
+	TrendWindow       int     `mapstructure:"trendWindow"`       // 连续单调变化的样本数达到该值开启趋势事件
+	TrendSigma        float64 `mapstructure:"trendSigma"`        // 趋势事件要求的累计变化（基线σ数）
+	WarmupSamples     int     `mapstructure:"warmupSamples"`     // 基线建立所需样本数，期间不检测
+	ResolveSamples    int     `mapstructure:"resolveSamples"`    // 连续正常样本数达到该值关闭事件
+	EpisodesPerDevice int     `mapstructure:"episodesPerDevice"` // 单设备保留的最近事件数
+	MaxDevices        int     `mapstructure:"maxDevices"`        // 跟踪的设备数上限，超出时淘汰最久无样本的设备
+}
+
+// ResponseShapingConfig 预发环境响应塑形：按路由与调用方API Key注入延迟、错误与不完整分页，供合作方验证客户端韧性；
+// 规则经运维接口下发并带有效期，environment 为 production 时拒绝启用
+type ResponseShapingConfig struct {
+	Enabled           bool                    `mapstructure:"enabled"`           // 默认关闭
+	KeyHeader         string                  `mapstructure:"keyHeader"`         // 调用方API Key名称请求头，为空时沿用 changeLog.keyHeader
+	DefaultTTLSeconds int                     `mapstructure:"defaultTtlSeconds"` // 规则默认有效期(秒)
+	MaxTTLSeconds     int                     `mapstructure:"maxTtlSeconds"`     // 规则有效期上限(秒)
+	MaxLatencyMs      int                     `mapstructure:"maxLatencyMs"`      // 单条规则注入延迟上限(毫秒)
+	Presets           []ResponseShapingPreset `mapstructure:"presets"`           // 预设规则，经运维接口按名称启用
+}
+
+// ResponseShapingPreset 响应塑形预设规则
+type ResponseShapingPreset struct {
+	Name            string   `mapstructure:"name"`
+	Route           string   `mapstructure:"route"`           // 路由模板或请求路径，以*结尾为前缀匹配，"*" 匹配全部
+	Methods         []string `mapstructure:"methods"`         // 为空匹配全部方法
+	APIKey          string   `mapstructure:"apiKey"`          // 调用方API Key名称，为空匹配全部调用方
+	LatencyMs       int      `mapstructure:"latencyMs"`       // 固定延迟
+	LatencyJitterMs int      `mapstructure:"latencyJitterMs"` // 额外随机延迟上限
+	ErrorRate       float64  `mapstructure:"errorRate"`       // 注入错误的概率 [0,1]
+	Errors          []string `mapstructure:"errors"`          // 429 | 503 | COMMAND_TIMEOUT
+	PartialPageRate float64  `mapstructure:"partialPageRate"` // 列表响应只返回部分条目的概率 [0,1]
+}
+
+// SelfTestConfig 启动协议自检配置（编解码往返、双算法校验和、充电控制黄金向量、字节流解码）
+type SelfTestConfig struct {
+	AllowDegradedStart bool `mapstructure:"allowDegradedStart"` // 自检失败时仍继续启动（仅记录告警），默认失败即中止启动
+}
+
+// EventBusConfig 内部事件总线配置
+type EventBusConfig struct {
+	TopicCapacity    int `mapstructure:"topicCapacity"`    // 每个主题保留的最近事件数（回放窗口）
+	SubscriberBuffer int `mapstructure:"subscriberBuffer"` // 订阅者默认队列长度，积压超过时丢弃最旧事件
+}
+
+// ReconciliationConfig 日终对账配置：当日开始的充电会话与收到的结算按订单号匹配
+type ReconciliationConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`       // 是否启用定时对账（台账记录与按需对账不受影响）
+	RunAt         string `mapstructure:"runAt"`         // 每日定时对账时间 HH:MM（本地时区），对账前一自然日
+	GraceMinutes  int    `mapstructure:"graceMinutes"`  // 次日零点后继续等待结算的宽限期(分钟)
+	RetentionDays int    `mapstructure:"retentionDays"` // 对账报告保留天数
+	Dir           string `mapstructure:"dir"`           // 会话/结算台账与报告目录，为空时仅保存在内存
+	Notify        bool   `mapstructure:"notify"`        // 定时对账完成后发送 reconciliation_report 通知
+}
+
+// HeartbeatTuningConfig 自适应心跳间隔配置：按连接稳定性（断连次数、命令往返时延）推荐心跳间隔，
+// 与设备已确认的间隔相差超过阈值时经0x83下发（同一设备冷却期内不重复下发）
+type HeartbeatTuningConfig struct {
+	Enabled                 bool `mapstructure:"enabled"`                 // 全局开关（运行时可经运维接口关闭）
+	DryRun                  bool `mapstructure:"dryRun"`                  // 仅报告拟调整的设备，不下发任何命令
+	MinIntervalSeconds      int  `mapstructure:"minIntervalSeconds"`      // 推荐间隔下限（不稳定连接）
+	MaxIntervalSeconds      int  `mapstructure:"maxIntervalSeconds"`      // 推荐间隔上限（稳定连接）
+	ChangeThresholdSeconds  int  `mapstructure:"changeThresholdSeconds"`  // 推荐值与已确认值相差超过该值才下发
+	CooldownSeconds         int  `mapstructure:"cooldownSeconds"`         // 同一设备两次下发的最小间隔，避免振荡
+	EvaluateIntervalSeconds int  `mapstructure:"evaluateIntervalSeconds"` // 评估周期
+	ChurnWindowSeconds      int  `mapstructure:"churnWindowSeconds"`      // 断连次数统计窗口
+	UnstableDisconnects     int  `mapstructure:"unstableDisconnects"`     // 窗口内断连次数达到该值判为不稳定
+	StableRTTMillis         int  `mapstructure:"stableRttMillis"`         // 平滑往返时延不超过该值才可判为稳定
+	UnstableRTTMillis       int  `mapstructure:"unstableRttMillis"`       // 平滑往返时延达到该值判为不稳定
+}
+
+// VirtualDeviceConfig 虚拟子设备（多端口机柜按端口拆分）映射持久化配置
+type VirtualDeviceConfig struct {
+	Store    string `mapstructure:"store"`    // 持久化方式: file | redis | memory（默认file）
+	FilePath string `mapstructure:"filePath"` // file 模式的映射文件路径
+	RedisKey string `mapstructure:"redisKey"` // redis 模式的存储键
+}
+
+// WebhookReceiverConfig 入站webhook（第三方平台推送命令）接收配置
+type WebhookReceiverConfig struct {
+	Enabled        bool                  `mapstructure:"enabled"`
+	WindowSeconds  int                   `mapstructure:"windowSeconds"`  // 时间戳允许偏差(秒)，超出视为重放
+	NonceCacheSize int                   `mapstructure:"nonceCacheSize"` // 已见nonce的LRU容量
+	Sources        []WebhookSourceConfig `mapstructure:"sources"`
+}
+
+// WebhookSourceConfig 入站webhook来源配置
+type WebhookSourceConfig struct {
+	Name               string   `mapstructure:"name"`               // 来源名称，对应请求头 X-Hook-Source
+	Secret             string   `mapstructure:"secret"`             // HMAC-SHA256 签名密钥
+	AllowedCommands    []string `mapstructure:"allowedCommands"`    // 允许的命令类型，为空表示全部允许
+	RateLimitPerMinute int      `mapstructure:"rateLimitPerMinute"` // 每分钟请求上限，0不限制
+}
+
+// ShutdownConfig 停机协调配置（滚动发布时HTTP与TCP按序停止）
+type ShutdownConfig struct {
+	LBDrainDelaySeconds        int    `mapstructure:"lbDrainDelaySeconds"`        // /readyz 标记未就绪后等待LB摘流的时长(秒)，0不等待
+	CommandDrainTimeoutSeconds int    `mapstructure:"commandDrainTimeoutSeconds"` // 排空阶段的总时限(秒)：停机通知、等待命令应答与关闭连接都在此时限内完成
+	GracePeriodSeconds         int    `mapstructure:"gracePeriodSeconds"`         // 停机宽限期(秒)：发送停机通知与等待已下发命令应答共用的最长时间，到期关闭设备连接；受排空阶段总时限约束
+	HTTPShutdownTimeoutSeconds int    `mapstructure:"httpShutdownTimeoutSeconds"` // 等待进行中HTTP请求完成的最长时间(秒)
+	DrainNotifyCommand         int    `mapstructure:"drainNotifyCommand"`         // 停机前向各设备组主设备下发的通知命令（如 0x81），0 不通知
+	DrainNotifyData            string `mapstructure:"drainNotifyData"`            // 通知命令的数据域（十六进制，如 "FE" 保留状态字节）
+}
+
+// AuditConfig 设备合规审计配置
+type AuditConfig struct {
+	Enabled               bool              `mapstructure:"enabled"`               // 是否启用定时审计
+	StaleThresholdMinutes int               `mapstructure:"staleThresholdMinutes"` // 默认数据过期阈值(分钟)，过期设备判为unknown
+	Audits                []AuditDefinition `mapstructure:"audits"`                // 预置审计定义
+}
+
+// AuditDefinition 审计定义
+type AuditDefinition struct {
+	ID                    string            `mapstructure:"id"`
+	Name                  string            `mapstructure:"name"`
+	IntervalMinutes       int               `mapstructure:"intervalMinutes"`       // 定时执行间隔(分钟)，0表示仅按需执行
+	StaleThresholdMinutes int               `mapstructure:"staleThresholdMinutes"` // 覆盖默认过期阈值
+	Rules                 []AuditRuleConfig `mapstructure:"rules"`
+}
+
+// AuditRuleConfig 审计规则配置
+type AuditRuleConfig struct {
+	Field    string `mapstructure:"field"`    // 字段路径
+	Operator string `mapstructure:"operator"` // eq, ne, gt, gte, lt, lte, version_gte, version_lte, contains
+	Expected string `mapstructure:"expected"` // 期望值
+}
+
 // FormatHTTPAddress 格式化HTTP服务器地址为host:port格式
 func FormatHTTPAddress() string {
 	cfg := GetConfig().HTTPAPIServer
 	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 }
+
+// FormatGRPCAddress 格式化gRPC服务器地址
+func FormatGRPCAddress() string {
+	cfg := GetConfig().GRPCServer
+	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+}
+
+// HandlerGuardConfig 处理器panic恢复：隔离触发panic的原始帧并可生成复现包，同一设备短时间内反复panic时隔离该设备
+type HandlerGuardConfig struct {
+	QuarantineDir           string `mapstructure:"quarantineDir"`           // 隔离记录持久化目录，为空仅保存在内存
+	MaxRecords              int    `mapstructure:"maxRecords"`              // 保留的隔离记录数上限（超过后删除最旧的）
+	ReproDir                string `mapstructure:"reproDir"`                // 复现包输出目录（帧十六进制+go test骨架），为空不生成
+	DeviceWindowSeconds     int    `mapstructure:"deviceWindowSeconds"`     // 统计同一设备panic次数的窗口(秒)
+	DevicePanicThreshold    int    `mapstructure:"devicePanicThreshold"`    // 窗口内panic达到该次数时隔离设备
+	DeviceQuarantineSeconds int    `mapstructure:"deviceQuarantineSeconds"` // 设备隔离时长(秒)，期间该设备的帧不再交给处理器
+}
+
+// FrameDedupConfig 重复帧抑制：应答丢失时设备会重发同一帧，窗口内 (物理ID, 消息ID, 命令) 相同的帧只交给处理器一次，重发帧只重放应答
+type FrameDedupConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	WindowSeconds int      `mapstructure:"windowSeconds"` // 判定重发的窗口(秒)，默认30
+	Capacity      int      `mapstructure:"capacity"`      // 每个连接记录的最近帧数，默认64
+	Commands      []string `mapstructure:"commands"`      // 参与抑制的命令码，如 ["0x20"]；为空时使用默认的注册
+}
+
+// ExtensionsConfig 自定义处理器扩展：扩展包启动前经 extension.RegisterCustomRouter 注册的处理器在装配路由时加载
+type ExtensionsConfig struct {
+	Disabled        []string `mapstructure:"disabled"`        // 不加载的自定义处理器命令码，如 ["0x42"]
+	OverrideBuiltin []string `mapstructure:"overrideBuiltin"` // 允许自定义处理器覆盖内置处理器的命令码；未列出时冲突的自定义处理器不加载
+}
+
+// SessionArchiveConfig 连接会话归档：连接关闭时异步记录来源地址、ICCID、设备、起止时间、收发字节数与断开原因，按天写入只追加文件
+type SessionArchiveConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Dir           string `mapstructure:"dir"`           // 归档目录（每天一个 sessions-YYYY-MM-DD.jsonl 文件）
+	RetentionDays int    `mapstructure:"retentionDays"` // 保留天数，过期的日文件自动删除
+	MaxTotalMB    int    `mapstructure:"maxTotalMB"`    // 归档文件总大小上限(MB)，超过时从最早的日文件开始删除
+	QueueSize     int    `mapstructure:"queueSize"`     // 待写入队列长度，满时丢弃并计数（不阻塞连接清理）
+}
+
+// PayloadCryptoConfig DNY数据域加密：注册帧声明了密钥ID的连接，上下行数据域以 AES-128-GCM 加解密，未声明的设备不受影响
+type PayloadCryptoConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	Store              string `mapstructure:"store"`              // 密钥存储: file | redis
+	KeyFile            string `mapstructure:"keyFile"`            // file 模式的密钥文件（修改后自动重新加载）
+	RedisKeyPrefix     string `mapstructure:"redisKeyPrefix"`     // redis 模式的密钥哈希键前缀（后接密钥ID）
+	CacheSeconds       int    `mapstructure:"cacheSeconds"`       // redis 模式本地缓存密钥的时长(秒)
+	RotationGraceHours int    `mapstructure:"rotationGraceHours"` // 密钥轮换后上一代密钥仍被接受的时长(小时)
+}
+
+// ChargeStatsConfig 充电统计看板：按租户增量维护小时桶与天桶汇总（订单开始与结束结果、结算电量与时长、使用设备数）
+type ChargeStatsConfig struct {
+	Enabled                 bool   `mapstructure:"enabled"`
+	Timezone                string `mapstructure:"timezone"`                // 时间桶对齐的时区（如 Asia/Shanghai），为空使用本地时区
+	HourRetentionDays       int    `mapstructure:"hourRetentionDays"`       // 小时桶保留天数
+	DayRetentionDays        int    `mapstructure:"dayRetentionDays"`        // 天桶保留天数
+	MaxTenants              int    `mapstructure:"maxTenants"`              // 分租户统计的租户数上限，超出后新租户只计入全部租户汇总
+	MaxBuckets              int    `mapstructure:"maxBuckets"`              // 单次查询返回的时间桶上限
+	SnapshotFile            string `mapstructure:"snapshotFile"`            // 汇总快照文件，为空不持久化（重启后从零统计）
+	SnapshotIntervalSeconds int    `mapstructure:"snapshotIntervalSeconds"` // 快照间隔(秒)
+	TenantHeader            string `mapstructure:"tenantHeader"`            // 租户范围请求头：携带时只能查询该租户
+}
+
+// TraceSamplingConfig 协议会话抽样跟踪：按比例抽样新连接（关注名单强制抽样），完整收发字节与解码结果写入轮转的抓包文件
+type TraceSamplingConfig struct {
+	Enabled              bool     `mapstructure:"enabled"`
+	Dir                  string   `mapstructure:"dir"`                  // 跟踪文件目录
+	Rate                 float64  `mapstructure:"rate"`                 // 新连接抽样比例 [0,1]，可经管理接口热更新
+	WatchDeviceIDs       []string `mapstructure:"watchDeviceIds"`       // 关注设备ID，注册后强制抽样
+	WatchICCIDs          []string `mapstructure:"watchIccids"`          // 关注ICCID，上报后强制抽样
+	MaxFileMB            int      `mapstructure:"maxFileMB"`            // 单个跟踪文件大小上限(MB)，超过后轮转
+	MaxTotalMB           int      `mapstructure:"maxTotalMB"`           // 跟踪目录总大小上限(MB)，超出时删除最早的文件
+	MaxActive            int      `mapstructure:"maxActive"`            // 同时按比例抽样的连接数上限
+	FlushIntervalSeconds int      `mapstructure:"flushIntervalSeconds"` // 缓冲刷写间隔(秒)
+}
+
+// DeviceSessionsConfig 设备会话持久化：注册与心跳时将设备身份写入Redis，重启后载入为恢复中状态直至设备重新接入
+type DeviceSessionsConfig struct {
+	Enabled                   bool   `mapstructure:"enabled"`
+	KeyPrefix                 string `mapstructure:"keyPrefix"`                 // 会话键前缀
+	TTLSeconds                int    `mapstructure:"ttlSeconds"`                // 会话键过期时间(秒)，超过该时长未接入的设备不再恢复
+	HeartbeatWriteIntervalSec int    `mapstructure:"heartbeatWriteIntervalSec"` // 同一设备心跳写入的最小间隔(秒)，注册总是立即写入
+	QueueSize                 int    `mapstructure:"queueSize"`                 // 异步写入队列长度，队列满时丢弃本次写入
+}
+
+// StandbyConfig 热备实例与计划内接管：主实例经Redis复制交接状态，热备实例应用后待命，接管时由热备接入设备
+type StandbyConfig struct {
+	Role                   string `mapstructure:"role"`                   // primary / standby，为空不启用
+	RedisKey               string `mapstructure:"redisKey"`               // 复制记录的Redis哈希键（每个实例一个字段）
+	PublishIntervalSeconds int    `mapstructure:"publishIntervalSeconds"` // 主实例发布交接状态的间隔(秒)
+	PollIntervalSeconds    int    `mapstructure:"pollIntervalSeconds"`    // 读取对端记录的间隔(秒)
+	SyncTimeoutSeconds     int    `mapstructure:"syncTimeoutSeconds"`     // 接管时等待热备应用最新状态的时限(秒)
+	ActivateTimeoutSeconds int    `mapstructure:"activateTimeoutSeconds"` // 接管时等待热备激活确认的时限(秒)
+	CloseBatchSize         int    `mapstructure:"closeBatchSize"`         // 每批关闭的设备连接数
+	CloseBatchIntervalMs   int    `mapstructure:"closeBatchIntervalMs"`   // 批次间隔(毫秒)
+}
+
+// ChargingSessionsConfig 充电会话生命周期跟踪：按订单跟踪 requested→started→charging→settling→completed/failed/refunding
+type ChargingSessionsConfig struct {
+	RequestedTimeoutSeconds int    `mapstructure:"requestedTimeoutSeconds"` // 下发后一直未收到设备应答的会话超时(秒)，超时置为failed
+	RetentionSeconds        int    `mapstructure:"retentionSeconds"`        // 已结束会话的保留时长(秒)
+	Store                   string `mapstructure:"store"`                   // 持久化方式: memory | redis（默认memory）
+	RedisKey                string `mapstructure:"redisKey"`                // redis 模式的存储键
+}
@@ -0,0 +1,227 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 参与就绪判定的服务组件
+const (
+	ComponentHTTP = "http"
+	ComponentTCP  = "tcp"
+)
+
+// WarningCheck 就绪告警检查：返回非空描述表示需要关注，不影响就绪判定
+type WarningCheck func() string
+
+// DegradationCheck 降级检查：返回非空描述表示依赖不可用、服务按降级策略继续运行（就绪但降级）
+type DegradationCheck func() string
+
+// Readiness 服务就绪状态：所有预期组件均已启动且未进入摘流时为就绪
+type Readiness struct {
+	mutex        sync.RWMutex
+	components   map[string]bool
+	draining     bool
+	warnings     map[string]WarningCheck
+	degradations map[string]DegradationCheck
+}
+
+// NewReadiness 创建就绪状态
+func NewReadiness() *Readiness {
+	return &Readiness{components: make(map[string]bool), warnings: make(map[string]WarningCheck), degradations: make(map[string]DegradationCheck)}
+}
+
+// AddDegradationCheck 注册降级检查（同名覆盖）
+func (r *Readiness) AddDegradationCheck(name string, check DegradationCheck) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.degradations[name] = check
+}
+
+// Degradations 执行降级检查，返回 名称 → 降级描述（仅包含处于降级的检查）
+func (r *Readiness) Degradations() map[string]string {
+	r.mutex.RLock()
+	checks := make(map[string]DegradationCheck, len(r.degradations))
+	for name, check := range r.degradations {
+		checks[name] = check
+	}
+	r.mutex.RUnlock()
+
+	degraded := make(map[string]string)
+	for name, check := range checks {
+		if msg := check(); msg != "" {
+			degraded[name] = msg
+		}
+	}
+	return degraded
+}
+
+// AddWarningCheck 注册就绪告警检查（同名覆盖）
+func (r *Readiness) AddWarningCheck(name string, check WarningCheck) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.warnings[name] = check
+}
+
+// Warnings 执行告警检查，返回 名称 → 告警描述（仅包含有告警的检查）
+func (r *Readiness) Warnings() map[string]string {
+	r.mutex.RLock()
+	checks := make(map[string]WarningCheck, len(r.warnings))
+	for name, check := range r.warnings {
+		checks[name] = check
+	}
+	r.mutex.RUnlock()
+
+	warnings := make(map[string]string)
+	for name, check := range checks {
+		if msg := check(); msg != "" {
+			warnings[name] = msg
+		}
+	}
+	return warnings
+}
+
+// Expect 声明需要启动完成的组件
+func (r *Readiness) Expect(components ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, c := range components {
+		if _, ok := r.components[c]; !ok {
+			r.components[c] = false
+		}
+	}
+}
+
+// MarkStarted 标记组件已启动
+func (r *Readiness) MarkStarted(component string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.components[component] = true
+}
+
+// BeginDrain 进入摘流：此后就绪检查始终失败
+func (r *Readiness) BeginDrain() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.draining = true
+}
+
+// IsDraining 是否已进入摘流
+func (r *Readiness) IsDraining() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.draining
+}
+
+// Status 返回是否就绪及各组件启动状态
+func (r *Readiness) Status() (bool, map[string]bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	ready := !r.draining
+	components := make(map[string]bool, len(r.components))
+	for c, started := range r.components {
+		components[c] = started
+		if !started {
+			ready = false
+		}
+	}
+	return ready, components
+}
+
+var globalReadiness = NewReadiness()
+
+// GetReadiness 获取全局就绪状态
+func GetReadiness() *Readiness {
+	return globalReadiness
+}
+
+// ===============================
+// 分阶段停机
+// ===============================
+
+// Phase 停机阶段，Timeout>0 时为该阶段的上下文设置超时
+type Phase struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// PhaseResult 停机阶段执行结果
+type PhaseResult struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ShutdownSummary 停机汇总
+type ShutdownSummary struct {
+	Reason    string        `json:"reason"`
+	StartedAt time.Time     `json:"started_at"`
+	TotalMs   int64         `json:"total_ms"`
+	Phases    []PhaseResult `json:"phases"`
+}
+
+// RunPhases 按顺序执行停机阶段；单个阶段失败不中断后续阶段，每阶段与最终汇总均记录日志
+func RunPhases(reason string, phases []Phase) ShutdownSummary {
+	summary := ShutdownSummary{Reason: reason, StartedAt: time.Now()}
+	for i, phase := range phases {
+		start := time.Now()
+		err := runPhase(phase)
+		elapsed := time.Since(start)
+
+		result := PhaseResult{Name: phase.Name, DurationMs: elapsed.Milliseconds()}
+		fields := logrus.Fields{
+			"phase":    phase.Name,
+			"step":     i + 1,
+			"total":    len(phases),
+			"duration": elapsed.String(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+			fields["error"] = result.Error
+			logger.WithFields(fields).Warn("⚠️ 停机阶段完成（有错误）")
+		} else {
+			logger.WithFields(fields).Info("⏹️ 停机阶段完成")
+		}
+		summary.Phases = append(summary.Phases, result)
+	}
+	summary.TotalMs = time.Since(summary.StartedAt).Milliseconds()
+
+	logger.WithFields(logrus.Fields{
+		"audit":     "shutdown",
+		"reason":    summary.Reason,
+		"startedAt": summary.StartedAt.Format(time.RFC3339),
+		"totalMs":   summary.TotalMs,
+		"phases":    summary.Phases,
+	}).Info("📋 停机汇总")
+	return summary
+}
+
+func runPhase(phase Phase) error {
+	ctx := context.Background()
+	if phase.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, phase.Timeout)
+		defer cancel()
+	}
+	return phase.Run(ctx)
+}
+
+// Wait 在上下文取消前等待指定时长（用于LB摘流等待阶段）
+func Wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FormatECSJSON ECS（Elastic Common Schema）兼容的JSON日志格式，供SIEM直接采集
+const FormatECSJSON = "ecs-json"
+
+// ECSVersion 输出文档遵循的ECS版本
+const ECSVersion = "8.11.0"
+
+// DefaultECSServiceName 未配置 serviceName 时使用的服务名
+const DefaultECSServiceName = "iot-zinx-gateway"
+
+// ECSFieldMap 现有日志字段名 → ECS字段名。未列出的字段输出到 labels.<原字段名>。
+// 新增日志字段需要映射到ECS标准字段时只需在此表中补充
+var ECSFieldMap = map[string]string{
+	// 事件
+	"action":    "event.action",
+	"operation": "event.action",
+	"event":     "event.action",
+	"command":   "event.code",
+	"commandID": "event.code",
+	"cmd":       "event.code",
+	"source":    "event.module", // Zinx日志适配器标记为 source=zinx
+
+	// 网络与连接
+	"remoteAddr": "source.address", // ip:port 形式会同时拆分出 source.ip/source.port
+	"remoteIP":   "source.ip",
+	"clientIP":   "source.ip",
+	"localAddr":  "destination.address",
+	"dataLen":    "network.bytes",
+	"payloadLen": "network.bytes",
+	"dataLength": "network.bytes",
+
+	// 错误
+	"error":     "error.message",
+	"err":       "error.message",
+	"errorType": "error.type",
+
+	// 设备与链路追踪
+	"deviceID":      "device.id",
+	"deviceId":      "device.id",
+	"correlationID": "trace.id",
+	"traceID":       "trace.id",
+}
+
+// ECSFormatter 将logrus日志条目序列化为ECS文档：
+// 固定输出 @timestamp、log.level、message、ecs.version、service.name，
+// 已知字段按 ECSFieldMap 改名，未知字段嵌套在 labels 下
+type ECSFormatter struct {
+	ServiceName string
+	FieldMap    map[string]string // 为空时使用 ECSFieldMap
+}
+
+// NewECSFormatter 创建ECS格式化器
+func NewECSFormatter(serviceName string) *ECSFormatter {
+	if serviceName == "" {
+		serviceName = DefaultECSServiceName
+	}
+	return &ECSFormatter{ServiceName: serviceName}
+}
+
+// IsECSFormat 配置的日志格式是否为ECS JSON
+func IsECSFormat(format string) bool {
+	return strings.ToLower(format) == FormatECSJSON
+}
+
+// Format 实现 logrus.Formatter
+func (f *ECSFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	fieldMap := f.FieldMap
+	if fieldMap == nil {
+		fieldMap = ECSFieldMap
+	}
+
+	doc := map[string]interface{}{
+		"@timestamp":   entry.Time.UTC().Format(time.RFC3339Nano),
+		"log.level":    entry.Level.String(),
+		"message":      entry.Message,
+		"ecs.version":  ECSVersion,
+		"service.name": f.ServiceName,
+	}
+	if entry.HasCaller() {
+		doc["log.origin.function"] = entry.Caller.Function
+		doc["log.origin.file.name"] = entry.Caller.File
+		doc["log.origin.file.line"] = entry.Caller.Line
+	}
+
+	// 按字段名排序处理，多个字段映射到同一ECS字段时结果稳定：先到者占用，其余进入labels
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := map[string]string{}
+	for _, k := range keys {
+		value := entry.Data[k]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		target, mapped := fieldMap[k]
+		if mapped {
+			if _, taken := doc[target]; !taken {
+				doc[target] = value
+				if target == "source.address" {
+					setECSAddressParts(doc, "source", value)
+				}
+				continue
+			}
+		}
+		labels[k] = ecsLabelValue(value)
+	}
+	if len(labels) > 0 {
+		doc["labels"] = labels
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ECS log entry: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// setECSAddressParts 将 ip:port 形式的地址拆分为 <prefix>.ip 与 <prefix>.port
+func setECSAddressParts(doc map[string]interface{}, prefix string, value interface{}) {
+	addr, ok := value.(string)
+	if !ok {
+		if s, isStringer := value.(fmt.Stringer); isStringer {
+			addr = s.String()
+		}
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) == nil {
+		return
+	}
+	if _, taken := doc[prefix+".ip"]; !taken {
+		doc[prefix+".ip"] = host
+	}
+	var portNum int
+	if _, err := fmt.Sscanf(port, "%d", &portNum); err == nil {
+		doc[prefix+".port"] = portNum
+	}
+}
+
+// ecsLabelValue ECS规定 labels 取值为keyword，统一转为字符串
+func ecsLabelValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	}
+	if data, err := json.Marshal(value); err == nil {
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
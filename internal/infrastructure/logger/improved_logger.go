@@ -32,12 +32,16 @@ type ImprovedLogger struct {
 
 // InitCommunicationLogger 初始化专用通信日志
 func (il *ImprovedLogger) InitCommunicationLogger(logDir string) error {
-	// 设置通信日志格式
-	il.communicationLog.SetFormatter(&logrus.TextFormatter{
-		TimestampFormat: constants.TimeFormatDefault,
-		FullTimestamp:   true,
-		DisableColors:   true, // 文件日志不需要颜色
-	})
+	// 设置通信日志格式（启用ECS格式时与主日志保持一致）
+	if il.config != nil && IsECSFormat(il.config.Format) {
+		il.communicationLog.SetFormatter(NewECSFormatter(il.config.ServiceName))
+	} else {
+		il.communicationLog.SetFormatter(&logrus.TextFormatter{
+			TimestampFormat: constants.TimeFormatDefault,
+			FullTimestamp:   true,
+			DisableColors:   true, // 文件日志不需要颜色
+		})
+	}
 
 	// 设置日志级别为Info，确保记录所有通信日志
 	il.communicationLog.SetLevel(logrus.InfoLevel)
@@ -93,7 +97,9 @@ func (il *ImprovedLogger) InitImproved(cfg *config.LoggerConfig) error {
 	il.logger.SetLevel(level)
 
 	// 2. 根据配置设置日志格式
-	if strings.ToLower(cfg.Format) == "json" {
+	if IsECSFormat(cfg.Format) {
+		il.logger.SetFormatter(NewECSFormatter(cfg.ServiceName))
+	} else if strings.ToLower(cfg.Format) == "json" {
 		il.logger.SetFormatter(&logrus.JSONFormatter{
 			TimestampFormat: constants.TimeFormatDefault,
 			// 添加更多有用的字段
@@ -215,7 +221,9 @@ func (il *ImprovedLogger) InitWithConsole(cfg *config.LoggerConfig) error {
 	il.logger.SetLevel(level)
 
 	// 设置日志格式
-	if strings.ToLower(cfg.Format) == "json" {
+	if IsECSFormat(cfg.Format) {
+		il.logger.SetFormatter(NewECSFormatter(cfg.ServiceName))
+	} else if strings.ToLower(cfg.Format) == "json" {
 		il.logger.SetFormatter(&logrus.JSONFormatter{
 			TimestampFormat: constants.TimeFormatDefault,
 		})
@@ -503,7 +511,7 @@ func LogCommunication(direction string, fields logrus.Fields, message string) {
 func LogSendData(deviceID string, commandID uint8, messageID uint16, connID uint64, payloadLen int, description string) {
 	LogCommunication("SEND", logrus.Fields{
 		"deviceID":    deviceID,
-		"commandID":   fmt.Sprintf("0x%02X", commandID),
+		"commandID":   constants.CommandLabel(commandID),
 		"messageID":   fmt.Sprintf("0x%04X", messageID),
 		"connID":      connID,
 		"payloadLen":  payloadLen,
@@ -511,6 +519,31 @@ func LogSendData(deviceID string, commandID uint8, messageID uint16, connID uint
 	}, "数据发送")
 }
 
+// LogSendDataWithCorrelation 记录发送数据（携带链路追踪ID）
+func LogSendDataWithCorrelation(correlationID string, deviceID string, commandID uint8, messageID uint16, connID uint64, payloadLen int, description string) {
+	LogCommunication("SEND", logrus.Fields{
+		"correlationID": correlationID,
+		"deviceID":      deviceID,
+		"commandID":     constants.CommandLabel(commandID),
+		"messageID":     fmt.Sprintf("0x%04X", messageID),
+		"connID":        connID,
+		"payloadLen":    payloadLen,
+		"description":   description,
+	}, "数据发送")
+}
+
+// LogReceiveAckWithCorrelation 记录设备应答（携带对应下发命令的链路追踪ID）
+func LogReceiveAckWithCorrelation(correlationID string, deviceID string, commandID uint8, messageID uint16, connID uint64, confirmed bool) {
+	LogCommunication("RECV", logrus.Fields{
+		"correlationID": correlationID,
+		"deviceID":      deviceID,
+		"commandID":     constants.CommandLabel(commandID),
+		"messageID":     fmt.Sprintf("0x%04X", messageID),
+		"connID":        connID,
+		"confirmed":     confirmed,
+	}, "命令应答")
+}
+
 // LogReceiveData 记录接收数据
 func LogReceiveData(connID uint64, dataLen int, messageType string, deviceID string, commandID uint8) {
 	LogCommunication("RECV", logrus.Fields{
@@ -518,6 +551,6 @@ func LogReceiveData(connID uint64, dataLen int, messageType string, deviceID str
 		"dataLen":     dataLen,
 		"messageType": messageType,
 		"deviceID":    deviceID,
-		"commandID":   fmt.Sprintf("0x%02X", commandID),
+		"commandID":   constants.CommandLabel(commandID),
 	}, "数据接收")
 }
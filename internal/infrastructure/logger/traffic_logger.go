@@ -0,0 +1,287 @@
+package logger
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// 流量日志方向
+const (
+	TrafficInbound  = "in"
+	TrafficOutbound = "out"
+)
+
+// 流量日志帧类别（非标准帧的抽样键）
+const (
+	TrafficKindDNY   = "dny"
+	TrafficKindICCID = "iccid"
+	TrafficKindLink  = "link"
+	TrafficKindError = "error"
+	TrafficKindRaw   = "raw" // 非DNY格式的下行数据
+)
+
+const (
+	defaultTrafficFile        = "traffic.log"
+	defaultTrafficMaxSizeMB   = 100
+	defaultTrafficMaxBackups  = 5
+	defaultTrafficMaxHexBytes = 256
+)
+
+// TrafficRecord 一帧的流量日志（每帧一行JSON）
+type TrafficRecord struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"` // in: 设备上行, out: 网关下行
+	ConnID    uint64    `json:"connId"`
+	DeviceID  string    `json:"deviceId,omitempty"`
+	Kind      string    `json:"kind"`                // dny/iccid/link/error/raw
+	Command   string    `json:"command,omitempty"`   // 0x82
+	MessageID string    `json:"messageId,omitempty"` // 0x0102，同一命令的下行与应答一致
+	Length    int       `json:"length"`
+	Hex       string    `json:"hex"`
+	Truncated bool      `json:"truncated,omitempty"` // 十六进制只记录前 MaxHexBytes 字节
+	Result    string    `json:"result"`              // 上行为解析结果，下行为写入结果：ok 或错误信息
+}
+
+// TrafficFrame 记录流量日志的一帧
+type TrafficFrame struct {
+	Direction string
+	ConnID    uint64
+	DeviceID  string
+	Kind      string
+	Command   uint8
+	MessageID uint16
+	Data      []byte
+	Err       error
+}
+
+// sampleKey 抽样键：标准帧为命令码（0x21），其余为帧类别
+func (f TrafficFrame) sampleKey() string {
+	if f.Kind == TrafficKindDNY {
+		return fmt.Sprintf("0x%02X", f.Command)
+	}
+	return f.Kind
+}
+
+// TrafficOptions 流量日志选项
+type TrafficOptions struct {
+	MaxHexBytes       int                // 十六进制截断长度
+	DefaultSampleRate *float64           // 未单独配置的命令的抽样率，nil 为1（全量），0 只记录 SampleRates 中列出的键
+	SampleRates       map[string]float64 // 抽样键 → 抽样率(0~1)
+}
+
+// TrafficStats 流量日志统计
+type TrafficStats struct {
+	Written int64            `json:"written"` // 写入的行数
+	Sampled int64            `json:"sampled"` // 按抽样率跳过的帧
+	Errors  int64            `json:"errors"`  // 写入失败
+	ByKey   map[string]int64 `json:"by_key"`  // 抽样键 → 经过的帧数
+}
+
+// TrafficLogger DNY流量日志：每帧一行JSON，按命令抽样（心跳等高频帧低抽样率，充电控制与结算全量）
+type TrafficLogger struct {
+	opts        TrafficOptions
+	defaultRate float64
+	out         io.Writer
+
+	mu      sync.Mutex
+	seen    map[string]int64
+	written int64
+	sampled int64
+	errors  int64
+}
+
+// NewTrafficLogger 创建写入 out 的流量日志
+func NewTrafficLogger(opts TrafficOptions, out io.Writer) *TrafficLogger {
+	if opts.MaxHexBytes <= 0 {
+		opts.MaxHexBytes = defaultTrafficMaxHexBytes
+	}
+	defaultRate := 1.0
+	if opts.DefaultSampleRate != nil {
+		defaultRate = clampSampleRate(*opts.DefaultSampleRate)
+	}
+	// 配置文件的键名会被转为小写（0x8a），统一为命令码的大写形式
+	rates := make(map[string]float64, len(opts.SampleRates))
+	for key, rate := range opts.SampleRates {
+		if strings.HasPrefix(strings.ToLower(key), "0x") {
+			key = "0x" + strings.ToUpper(key[2:])
+		}
+		rates[key] = rate
+	}
+	opts.SampleRates = rates
+	return &TrafficLogger{opts: opts, defaultRate: defaultRate, out: out, seen: make(map[string]int64)}
+}
+
+// clampSampleRate 抽样率限定在 0~1
+func clampSampleRate(rate float64) float64 {
+	switch {
+	case rate < 0:
+		return 0
+	case rate > 1:
+		return 1
+	}
+	return rate
+}
+
+// sampleRate 抽样键的抽样率
+func (l *TrafficLogger) sampleRate(key string) float64 {
+	if rate, ok := l.opts.SampleRates[key]; ok {
+		return clampSampleRate(rate)
+	}
+	return l.defaultRate
+}
+
+// keep 按抽样键计数抽样：第n帧在 ⌊n×rate⌋ 递增时记录，抽样结果确定且均匀（rate=0.01 即每100帧记录1帧）
+func (l *TrafficLogger) keep(key string) bool {
+	rate := l.sampleRate(key)
+	l.seen[key]++
+	n := l.seen[key]
+	if rate >= 1 {
+		return true
+	}
+	return int64(float64(n)*rate) > int64(float64(n-1)*rate)
+}
+
+// Log 按抽样率记录一帧
+func (l *TrafficLogger) Log(frame TrafficFrame) {
+	l.mu.Lock()
+	if !l.keep(frame.sampleKey()) {
+		l.sampled++
+		l.mu.Unlock()
+		return
+	}
+	l.mu.Unlock()
+
+	record := TrafficRecord{
+		Time:      time.Now(),
+		Direction: frame.Direction,
+		ConnID:    frame.ConnID,
+		DeviceID:  frame.DeviceID,
+		Kind:      frame.Kind,
+		Length:    len(frame.Data),
+		Result:    "ok",
+	}
+	if frame.Kind == TrafficKindDNY {
+		record.Command = fmt.Sprintf("0x%02X", frame.Command)
+		record.MessageID = fmt.Sprintf("0x%04X", frame.MessageID)
+	}
+	data := frame.Data
+	if len(data) > l.opts.MaxHexBytes {
+		data = data[:l.opts.MaxHexBytes]
+		record.Truncated = true
+	}
+	record.Hex = hex.EncodeToString(data)
+	if frame.Err != nil {
+		record.Result = frame.Err.Error()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		l.mu.Lock()
+		l.errors++
+		l.mu.Unlock()
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(line); err != nil {
+		l.errors++
+		return
+	}
+	l.written++
+}
+
+// Stats 统计快照
+func (l *TrafficLogger) Stats() TrafficStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := TrafficStats{Written: l.written, Sampled: l.sampled, Errors: l.errors, ByKey: make(map[string]int64, len(l.seen))}
+	for key, n := range l.seen {
+		stats.ByKey[key] = n
+	}
+	return stats
+}
+
+// Close 关闭输出（输出实现 io.Closer 时）
+func (l *TrafficLogger) Close() error {
+	if closer, ok := l.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalTrafficLogger atomic.Pointer[TrafficLogger]
+
+// GetTrafficLogger 获取全局流量日志（未启用时为nil）
+func GetTrafficLogger() *TrafficLogger {
+	return globalTrafficLogger.Load()
+}
+
+// SetTrafficLogger 替换全局流量日志（测试使用，传nil关闭）
+func SetTrafficLogger(l *TrafficLogger) {
+	globalTrafficLogger.Store(l)
+}
+
+// InitTrafficLogger 按配置创建全局流量日志，写入日志目录下按大小轮转的文件；未启用时清空
+func InitTrafficLogger(cfg config.TrafficLogConfig, fileDir string) *TrafficLogger {
+	if !cfg.Enabled {
+		globalTrafficLogger.Store(nil)
+		return nil
+	}
+	file := cfg.File
+	if file == "" {
+		file = defaultTrafficFile
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(fileDir, file)
+	}
+	maxSize := cfg.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = defaultTrafficMaxSizeMB
+	}
+	maxBackups := cfg.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = defaultTrafficMaxBackups
+	}
+	l := NewTrafficLogger(TrafficOptions{
+		MaxHexBytes:       cfg.MaxHexBytes,
+		DefaultSampleRate: cfg.DefaultSampleRate,
+		SampleRates:       cfg.SampleRates,
+	}, &lumberjack.Logger{
+		Filename:   file,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		Compress:   cfg.Compress,
+		LocalTime:  true,
+	})
+	globalTrafficLogger.Store(l)
+	return l
+}
+
+// StopTrafficLogger 关闭全局流量日志
+func StopTrafficLogger() {
+	if l := globalTrafficLogger.Swap(nil); l != nil {
+		_ = l.Close()
+	}
+}
+
+// LogTraffic 记录一帧到全局流量日志（未启用时忽略）
+func LogTraffic(frame TrafficFrame) {
+	if l := globalTrafficLogger.Load(); l != nil {
+		l.Log(frame)
+	}
+}
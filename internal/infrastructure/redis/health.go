@@ -0,0 +1,429 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Status Redis可用状态
+type Status string
+
+const (
+	StatusDisabled Status = "disabled" // 未配置Redis（或启动时连接失败），各功能使用本地存储
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded" // 运行中Redis不可达：各功能按降级策略继续服务，恢复后自动回切
+)
+
+const (
+	defaultProbeInterval    = 5 * time.Second
+	defaultProbeTimeout     = time.Second
+	defaultFailureThreshold = 2
+	defaultSpoolMaxBytes    = 8 << 20
+)
+
+// ErrSpoolFull 降级期间写入超过本地暂存上限
+var ErrSpoolFull = errors.New("Redis不可用且本地暂存已满")
+
+// Policy 功能在Redis降级期间的处理方式
+type Policy struct {
+	Feature  string `json:"feature"`
+	Behavior string `json:"behavior"`
+}
+
+// DegradationPolicies 依赖Redis的功能在降级期间的统一策略（启动时连接失败的功能在初始化时已选择本地存储，不在此列）
+var DegradationPolicies = []Policy{
+	{Feature: "idempotency", Behavior: "订单号幂等窗口改用进程内LRU，仅对本实例有效，进入降级后首次使用记录告警"},
+	{Feature: "persistence", Behavior: "快照与变更记录写入有界本地暂存（同一键只保留最新值），恢复后按写入顺序回放；超出上限丢弃最早的暂存"},
+	{Feature: "ownership", Behavior: "按单实例模式运行：本实例在线设备归属本实例，不查询也不代理其他实例，恢复后下一次续期重新登记"},
+	{Feature: "notification_retry", Behavior: "通知重试与死信改用内存队列"},
+	{Feature: "replica", Behavior: "主实例暂停发布状态快照，只读副本沿用最近一次读取的快照并按时效标记stale"},
+}
+
+// Transition 可用状态变化
+type Transition struct {
+	From     Status        `json:"from"`
+	To       Status        `json:"to"`
+	At       time.Time     `json:"at"`
+	Reason   string        `json:"reason,omitempty"`   // 进入降级时最近一次探测错误
+	Duration time.Duration `json:"duration,omitempty"` // 恢复时降级持续时长
+	Replayed int           `json:"replayed,omitempty"` // 恢复时回放的暂存写入数
+	Dropped  int           `json:"dropped,omitempty"`  // 降级期间因超出暂存上限丢弃的写入数
+}
+
+// HealthOptions 可用性探测配置
+type HealthOptions struct {
+	Interval         time.Duration // 探测间隔
+	ProbeTimeout     time.Duration // 单次探测（及回放单条写入）超时
+	FailureThreshold int           // 连续失败次数达到该值判定降级
+	SpoolMaxBytes    int           // 本地暂存上限（字节）
+}
+
+// HealthStats 可用状态快照
+type HealthStats struct {
+	Status              Status    `json:"status"`
+	Since               time.Time `json:"since"`
+	LastError           string    `json:"lastError,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	SpoolEntries        int       `json:"spoolEntries"`
+	SpoolBytes          int       `json:"spoolBytes"`
+	SpoolDropped        int       `json:"spoolDropped"`
+	Policies            []Policy  `json:"policies"`
+}
+
+// spoolEntry 暂存的写入：replace 为 true 时同键的旧暂存被新值取代
+type spoolEntry struct {
+	key     string
+	size    int
+	replace bool
+	apply   func(ctx context.Context, c *redis.Client) error
+}
+
+// Health Redis可用性闸门：后台探测翻转可用状态，降级期间暂存写入并在恢复后回放
+type Health struct {
+	client *redis.Client
+	opts   HealthOptions
+
+	mu         sync.Mutex
+	status     Status
+	since      time.Time
+	lastErr    string
+	failures   int
+	spool      []spoolEntry
+	spoolBytes int
+	dropped    int
+	handlers   []func(Transition)
+
+	// 直接写入持读锁、回放持写锁：回放期间的新写入排在暂存之后，不会被旧值覆盖
+	writeMu sync.RWMutex
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// NewHealth 创建可用性闸门；client 为 nil 时状态恒为 disabled
+func NewHealth(client *redis.Client, opts HealthOptions) *Health {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultProbeInterval
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = defaultProbeTimeout
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	if opts.SpoolMaxBytes <= 0 {
+		opts.SpoolMaxBytes = defaultSpoolMaxBytes
+	}
+	status := StatusUp
+	if client == nil {
+		status = StatusDisabled
+	}
+	return &Health{client: client, opts: opts, status: status, since: time.Now(), stopCh: make(chan struct{})}
+}
+
+// Client 闸门探测的客户端
+func (h *Health) Client() *redis.Client {
+	if h == nil {
+		return nil
+	}
+	return h.client
+}
+
+// Status 当前可用状态
+func (h *Health) Status() Status {
+	if h == nil {
+		return StatusDisabled
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Degraded 已配置Redis但当前不可达
+func (h *Health) Degraded() bool {
+	return h.Status() == StatusDegraded
+}
+
+// RegisterHandler 注册状态变化回调（降级与恢复各回调一次，在探测协程中执行）
+func (h *Health) RegisterHandler(handler func(Transition)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers = append(h.handlers, handler)
+}
+
+// HandlerCount 已注册的状态变化回调数
+func (h *Health) HandlerCount() int {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.handlers)
+}
+
+// Stats 可用状态快照
+func (h *Health) Stats() HealthStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HealthStats{
+		Status:              h.status,
+		Since:               h.since,
+		LastError:           h.lastErr,
+		ConsecutiveFailures: h.failures,
+		SpoolEntries:        len(h.spool),
+		SpoolBytes:          h.spoolBytes,
+		SpoolDropped:        h.dropped,
+		Policies:            DegradationPolicies,
+	}
+}
+
+// DegradedReason 降级时返回描述（用于就绪检查），否则返回空
+func (h *Health) DegradedReason() string {
+	if h == nil {
+		return ""
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.status != StatusDegraded {
+		return ""
+	}
+	return fmt.Sprintf("Redis自 %s 起不可用（%s），按降级策略继续服务，本地暂存 %d 条写入待回放",
+		h.since.Format(time.RFC3339), h.lastErr, len(h.spool))
+}
+
+// Probe 执行一次探测：连续失败达到阈值进入降级；探测成功时先回放暂存，回放完成后才恢复
+func (h *Health) Probe() {
+	if h == nil || h.client == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.ProbeTimeout)
+	err := h.client.Ping(ctx).Err()
+	cancel()
+	if err != nil {
+		h.onFailure(err)
+		return
+	}
+	h.mu.Lock()
+	h.failures = 0
+	pending := len(h.spool) > 0 || h.status == StatusDegraded
+	h.mu.Unlock()
+	if pending {
+		h.recover()
+	}
+}
+
+func (h *Health) onFailure(err error) {
+	h.mu.Lock()
+	h.failures++
+	h.lastErr = err.Error()
+	if h.status != StatusUp || h.failures < h.opts.FailureThreshold {
+		h.mu.Unlock()
+		return
+	}
+	t := Transition{From: h.status, To: StatusDegraded, At: time.Now(), Reason: h.lastErr}
+	h.status, h.since, h.dropped = StatusDegraded, t.At, 0
+	handlers := append([]func(Transition){}, h.handlers...)
+	h.mu.Unlock()
+
+	logger.WithFields(logrus.Fields{"error": t.Reason, "failures": h.opts.FailureThreshold}).Error("🔴 Redis不可用，进入降级运行")
+	for _, handler := range handlers {
+		handler(t)
+	}
+}
+
+// recover 按顺序回放暂存；回放失败时保持当前状态等待下次探测
+func (h *Health) recover() {
+	h.writeMu.Lock()
+	replayed := 0
+	for {
+		h.mu.Lock()
+		if len(h.spool) == 0 {
+			break // 持锁切换状态
+		}
+		entry := h.spool[0]
+		h.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), h.opts.ProbeTimeout)
+		err := entry.apply(ctx, h.client)
+		cancel()
+		if err != nil {
+			h.writeMu.Unlock()
+			logger.WithFields(logrus.Fields{"key": entry.key, "replayed": replayed, "error": err.Error()}).Warn("回放Redis暂存写入失败，等待下次探测")
+			return
+		}
+		h.mu.Lock()
+		h.spoolBytes -= entry.size
+		h.spool = h.spool[1:]
+		h.mu.Unlock()
+		replayed++
+	}
+	defer h.writeMu.Unlock()
+	if h.status != StatusDegraded {
+		h.mu.Unlock()
+		if replayed > 0 {
+			logger.WithFields(logrus.Fields{"replayed": replayed}).Info("Redis暂存写入已回放")
+		}
+		return
+	}
+	t := Transition{From: StatusDegraded, To: StatusUp, At: time.Now(), Duration: time.Since(h.since), Replayed: replayed, Dropped: h.dropped}
+	h.status, h.since, h.lastErr = StatusUp, t.At, ""
+	handlers := append([]func(Transition){}, h.handlers...)
+	h.mu.Unlock()
+
+	logger.WithFields(logrus.Fields{"duration": t.Duration.String(), "replayed": replayed, "dropped": t.Dropped}).Info("🟢 Redis已恢复，结束降级运行")
+	for _, handler := range handlers {
+		handler(t)
+	}
+}
+
+// write 执行写入：可用且无待回放暂存时直接写，降级期间或写入失败时暂存
+func (h *Health) write(ctx context.Context, entry spoolEntry) error {
+	h.writeMu.RLock()
+	defer h.writeMu.RUnlock()
+	h.mu.Lock()
+	direct := h.status == StatusUp && len(h.spool) == 0
+	h.mu.Unlock()
+	if direct {
+		err := entry.apply(ctx, h.client)
+		if err == nil {
+			return nil
+		}
+		logger.WithFields(logrus.Fields{"key": entry.key, "error": err.Error()}).Warn("Redis写入失败，已暂存待恢复后回放")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.spoolLocked(entry)
+}
+
+func (h *Health) spoolLocked(entry spoolEntry) error {
+	if entry.size > h.opts.SpoolMaxBytes {
+		h.dropped++
+		return ErrSpoolFull
+	}
+	if entry.replace {
+		for i, e := range h.spool {
+			if e.replace && e.key == entry.key {
+				h.spoolBytes -= e.size
+				h.spool = append(h.spool[:i], h.spool[i+1:]...)
+				break
+			}
+		}
+	}
+	for h.spoolBytes+entry.size > h.opts.SpoolMaxBytes && len(h.spool) > 0 {
+		h.spoolBytes -= h.spool[0].size
+		h.spool = h.spool[1:]
+		h.dropped++
+	}
+	h.spool = append(h.spool, entry)
+	h.spoolBytes += entry.size
+	return nil
+}
+
+// Start 启动周期探测（随上下文取消或 Stop 停止）
+func (h *Health) Start(ctx context.Context) {
+	if h == nil || h.client == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(h.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.stopCh:
+				return
+			case <-ticker.C:
+				h.Probe()
+			}
+		}
+	}()
+}
+
+// Stop 停止探测；仍有未回放的暂存时记录告警（进程退出后丢失）
+func (h *Health) Stop() {
+	if h == nil {
+		return
+	}
+	h.stopOnce.Do(func() {
+		close(h.stopCh)
+		h.mu.Lock()
+		pending := len(h.spool)
+		h.mu.Unlock()
+		if pending > 0 {
+			logger.WithFields(logrus.Fields{"entries": pending}).Warn("停止时仍有Redis暂存写入未回放，将丢失")
+		}
+	})
+}
+
+// ===============================
+// 全局闸门
+// ===============================
+
+var globalHealth atomic.Pointer[Health]
+
+// GetGlobalHealth 获取全局可用性闸门（未初始化时为 nil）
+func GetGlobalHealth() *Health {
+	return globalHealth.Load()
+}
+
+// SetGlobalHealth 设置全局可用性闸门（测试或自定义装配使用）
+func SetGlobalHealth(h *Health) {
+	globalHealth.Store(h)
+}
+
+// InitGlobalHealth 按配置为全局客户端创建可用性闸门并启动探测；须在 InitClient 之后调用
+func InitGlobalHealth(ctx context.Context) *Health {
+	cfg := config.GetConfig().Redis
+	h := NewHealth(GetClient(), HealthOptions{
+		Interval:         time.Duration(cfg.HealthCheckIntervalSeconds) * time.Second,
+		FailureThreshold: cfg.FailureThreshold,
+		SpoolMaxBytes:    cfg.SpoolMaxBytes,
+	})
+	SetGlobalHealth(h)
+	h.Start(ctx)
+	return h
+}
+
+// StopGlobalHealth 停止全局可用性闸门的探测
+func StopGlobalHealth() {
+	GetGlobalHealth().Stop()
+}
+
+// Degraded 全局闸门是否处于降级（未初始化视为未降级）
+func Degraded() bool {
+	return GetGlobalHealth().Degraded()
+}
+
+// DegradedReason 全局闸门的降级描述（用于就绪检查）
+func DegradedReason() string {
+	return GetGlobalHealth().DegradedReason()
+}
+
+// SetOrSpool 写入快照键（覆盖写，无过期）：client 为全局闸门的客户端时，降级期间或写入失败暂存（同键仅保留最新值），恢复后回放
+func SetOrSpool(ctx context.Context, client *redis.Client, key string, value []byte) error {
+	set := func(ctx context.Context, c *redis.Client) error { return c.Set(ctx, key, value, 0).Err() }
+	h := GetGlobalHealth()
+	if h == nil || h.client == nil || h.client != client {
+		return set(ctx, client)
+	}
+	return h.write(ctx, spoolEntry{key: key, size: len(key) + len(value), replace: true, apply: set})
+}
+
+// ExecOrSpool 执行不可合并的写入（如追加列表）：语义同 SetOrSpool，暂存按写入顺序回放
+func ExecOrSpool(ctx context.Context, client *redis.Client, key string, size int, apply func(ctx context.Context, c *redis.Client) error) error {
+	h := GetGlobalHealth()
+	if h == nil || h.client == nil || h.client != client {
+		return apply(ctx, client)
+	}
+	return h.write(ctx, spoolEntry{key: key, size: len(key) + size, apply: apply})
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
 	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
@@ -125,7 +128,7 @@ func (h *ChargeControlHandler) processChargeControl(result *protocol.DNYParseRes
 		"connID":     conn.GetConnID(),
 		"physicalId": utils.FormatCardNumber(physicalID),
 		"messageID":  messageID,
-		"command":    fmt.Sprintf("0x%02X", result.Command),
+		"command":    dny_protocol.CommandLabel(result.Command),
 		"dataLen":    len(data),
 		"dataHex":    fmt.Sprintf("%X", data),
 	}).Info("📥 收到充电控制响应")
@@ -243,26 +246,53 @@ func (h *ChargeControlHandler) processChargeControl(result *protocol.DNYParseRes
 	}).Debug("ChargeControlHandler: skip sending 0x82 ack")
 
 	// 确认命令，停止 CommandManager 的重试/超时
+	// 同时取回下发时关联的链路追踪ID，用于应答日志与第三方回调
+	var correlationID string
 	if cmdMgr := network.GetCommandManager(); cmdMgr != nil {
-		confirmed := cmdMgr.ConfirmCommand(physicalID, messageID, 0x82)
+		var confirmed bool
+		confirmed, correlationID = cmdMgr.ConfirmCommandWithCorrelation(physicalID, messageID, 0x82)
+		logger.LogReceiveAckWithCorrelation(correlationID, deviceID, 0x82, messageID, conn.GetConnID(), confirmed)
 		logger.WithFields(logrus.Fields{
-			"deviceId":  fmt.Sprintf("%08X", physicalID),
-			"messageID": fmt.Sprintf("0x%04X", messageID),
-			"command":   "0x82",
-			"confirmed": confirmed,
+			"correlationID": correlationID,
+			"deviceId":      fmt.Sprintf("%08X", physicalID),
+			"messageID":     fmt.Sprintf("0x%04X", messageID),
+			"command":       "0x82",
+			"confirmed":     confirmed,
+			"statusDesc":    description,
 		}).Info("确认 0x82 命令完成")
 	}
 
+	// 充电会话：设备受理转为started，拒绝转为failed
+	if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+		gw.GetChargingSessions().OnChargeResponse(deviceID, int(displayPort), orderNumber, isExecuted, description, time.Now())
+		// 端口状态：受理开始充电（端口有进行中订单且未排队）时置为充电中，功率与电量以后续功率心跳为准
+		if isExecuted && status == ChargeStatusSuccess && !gateway.IsPortQueued(portNumber, waitingPorts) {
+			if order := gw.GetOrderManager().GetOrder(deviceID, int(displayPort)); order != nil && (order.Status == gateway.OrderStatusPending || order.Status == gateway.OrderStatusCharging) {
+				gw.GetStationAggregator().OnChargeAccepted(deviceID, int(displayPort), order.OrderNo, time.Now())
+			}
+		}
+	}
+
+	// 设备受理但端口繁忙（待充端口位图包含本端口）：会话置为排队，由排队跟踪器发出charge_queued通知
+	queued := false
+	if isExecuted && status == ChargeStatusSuccess && gateway.IsPortQueued(portNumber, waitingPorts) {
+		if gw := gateway.GetGlobalDeviceGateway(); gw != nil && gw.IsChargeQueueEnabled() {
+			gw.MarkChargeQueued(deviceID, int(displayPort), orderNumber, waitingPorts, correlationID)
+			queued = true
+		}
+	}
+
 	// 成功与失败回调第三方
 	integrator := notification.GetGlobalNotificationIntegrator()
 	if integrator != nil && integrator.IsEnabled() {
 		// 协议端口为0-based，集成器内部会+1对外
 
 		sessionData := notification.ChargeResponse{
-			Port:       portNumber,
-			Status:     fmt.Sprintf("0x%02X", status),
-			StatusDesc: description,
-			OrderNo:    orderNumber,
+			Port:          portNumber,
+			Status:        fmt.Sprintf("0x%02X", status),
+			StatusDesc:    description,
+			OrderNo:       orderNumber,
+			CorrelationID: correlationID,
 		}
 
 		decoded := &protocol.DecodedDNYFrame{
@@ -274,9 +304,12 @@ func (h *ChargeControlHandler) processChargeControl(result *protocol.DNYParseRes
 			Payload:   result.Data,
 		}
 
-		if isExecuted && status == ChargeStatusSuccess {
+		switch {
+		case queued:
+			// 排队中不发送充电开始，待端口状态上报实际开始充电后再通知
+		case isExecuted && status == ChargeStatusSuccess:
 			integrator.NotifyChargingStart(decoded, conn, sessionData)
-		} else {
+		default:
 			integrator.NotifyChargingFailed(decoded, conn, sessionData)
 		}
 	}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
+	"github.com/sirupsen/logrus"
+)
+
+// criticalFrame 关键帧预写状态
+type criticalFrame struct {
+	journal   *journal.Journal
+	entryID   string
+	journaled bool // 已预写：可先应答再交接
+	duplicate bool // 幂等键已处理（设备重发）：仅应答，不再交接
+}
+
+// criticalFrameKey 幂等键：设备重发的同一帧载荷相同
+func criticalFrameKey(deviceID string, command byte, payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return fmt.Sprintf("%s:%02X:%X", deviceID, command, sum[:8])
+}
+
+// beginCriticalFrame 发送应答前预写关键帧
+// 日志未启用、已降级或写入失败时 journaled=false，调用方应处理完成后再应答（设备未收到应答会重发）
+func beginCriticalFrame(decodedFrame *protocol.DecodedDNYFrame, conn ziface.IConnection, physicalID uint32) *criticalFrame {
+	j := journal.GetGlobalJournal()
+	frame := &criticalFrame{journal: j}
+	if !j.IsCritical(decodedFrame.Command) {
+		return frame
+	}
+
+	deviceID := decodedFrame.DeviceID
+	key := criticalFrameKey(deviceID, decodedFrame.Command, decodedFrame.Payload)
+	if j.IsProcessed(key) {
+		j.RecordDuplicate()
+		frame.duplicate = true
+		return frame
+	}
+
+	entry, err := j.Append(journal.Entry{
+		Key:        key,
+		Command:    decodedFrame.Command,
+		DeviceID:   deviceID,
+		PhysicalID: physicalID,
+		MessageID:  decodedFrame.MessageID,
+		Payload:    decodedFrame.Payload,
+		RawFrame:   decodedFrame.RawData,
+		ConnID:     conn.GetConnID(),
+		RemoteAddr: conn.RemoteAddr().String(),
+	})
+	if err != nil {
+		if !errors.Is(err, journal.ErrJournalDegraded) {
+			logger.WithFields(logrus.Fields{
+				"deviceID": deviceID,
+				"command":  dny_protocol.CommandLabel(decodedFrame.Command),
+				"error":    err.Error(),
+			}).Error("❌ 关键帧预写失败，改为处理完成后再应答")
+		}
+		return frame
+	}
+	frame.entryID = entry.ID
+	frame.journaled = true
+	return frame
+}
+
+// finish 下游交接完成后标记日志条目
+func (f *criticalFrame) finish() {
+	if !f.journaled {
+		return
+	}
+	if err := f.journal.MarkProcessed(f.entryID); err != nil {
+		// 标记失败时条目将在下次启动时重放
+		logger.WithFields(logrus.Fields{
+			"entryID": f.entryID,
+			"error":   err.Error(),
+		}).Error("❌ 关键帧日志标记已处理失败")
+	}
+}
+
+// ReplayFrameJournal 启动时经正常处理流程重放未处理的关键帧（原连接已不存在，不再发送应答）
+func ReplayFrameJournal(j *journal.Journal) journal.ReplayResult {
+	return replayFrameJournal(j, nil)
+}
+
+// FrameJournalReplaySource 停机积压重放：批准后按接收顺序、积压重放速率重放未处理的关键帧
+func FrameJournalReplaySource(j *journal.Journal) replay.Source {
+	return frameJournalReplaySource{j: j}
+}
+
+type frameJournalReplaySource struct {
+	j *journal.Journal
+}
+
+func (s frameJournalReplaySource) Items() []replay.Item {
+	pending := s.j.Pending()
+	items := make([]replay.Item, 0, len(pending))
+	for _, entry := range pending {
+		items = append(items, replay.Item{ID: entry.ID, At: entry.ReceivedAt, Outbound: 1})
+	}
+	return items
+}
+
+func (s frameJournalReplaySource) Run(ctl *replay.Control) error {
+	result := replayFrameJournal(s.j, ctl)
+	for i := 0; i < result.Duplicate; i++ {
+		ctl.Record(replay.OutcomeSkipped)
+	}
+	if ctl.Stopped() {
+		return replay.ErrStopped
+	}
+	return nil
+}
+
+// replayFrameJournal 重放未处理的关键帧；ctl 非nil时每条重放前按积压重放节奏等待并记录结果
+func replayFrameJournal(j *journal.Journal, ctl *replay.Control) journal.ReplayResult {
+	result := j.Replay(func(entry journal.Entry) error {
+		if !ctl.Wait() {
+			return replay.ErrStopped
+		}
+		err := replayJournalEntry(entry)
+		if err != nil {
+			ctl.Record(replay.OutcomeFailed)
+		} else {
+			ctl.Record(replay.OutcomeReplayed)
+		}
+		return err
+	})
+	if result.Total > 0 {
+		logger.WithFields(logrus.Fields{
+			"total":     result.Total,
+			"replayed":  result.Replayed,
+			"duplicate": result.Duplicate,
+			"failed":    result.Failed,
+		}).Info("📼 关键帧预写日志重放完成")
+	}
+	return result
+}
+
+// replayJournalEntry 经正常处理流程重放单个关键帧
+func replayJournalEntry(entry journal.Entry) error {
+	rawPhysicalID := make([]byte, 4)
+	binary.LittleEndian.PutUint32(rawPhysicalID, entry.PhysicalID)
+	decodedFrame := &protocol.DecodedDNYFrame{
+		FrameType:       protocol.FrameTypeStandard,
+		RawData:         entry.RawFrame,
+		RawPhysicalID:   rawPhysicalID,
+		DeviceID:        entry.DeviceID,
+		MessageID:       entry.MessageID,
+		Command:         entry.Command,
+		Payload:         entry.Payload,
+		IsChecksumValid: true,
+	}
+	switch entry.Command {
+	case constants.CmdSettlement:
+		return (&SettlementHandler{}).replaySettlement(decodedFrame, entry)
+	default:
+		return fmt.Errorf("命令 0x%02X 无重放处理器", entry.Command)
+	}
+}
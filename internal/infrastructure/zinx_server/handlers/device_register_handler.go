@@ -3,16 +3,18 @@ package handlers
 import (
 	"encoding/hex"
 	"fmt"
-	"net"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
-	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -120,6 +122,11 @@ func (h *DeviceRegisterHandler) processDeviceRegistration(decodedFrame *protocol
 		return
 	}
 
+	// 已停用设备：拒绝注册并断开连接，需先重新启用（recommission）
+	if h.rejectDecommissioned(deviceId, uint32(physicalId), messageID, conn) {
+		return
+	}
+
 	// � 智能注册决策
 	decision := h.analyzeRegistrationRequest(deviceId, conn)
 
@@ -267,37 +274,36 @@ func (h *DeviceRegisterHandler) handleDeviceRegister(deviceId string, physicalId
 	}
 	conn.SetProperty("connState", constants.ConnStatusActiveRegistered)
 
-	// 6. 重置TCP ReadDeadline
-	now := time.Now()
-	defaultReadDeadlineSeconds := config.GetConfig().TCPServer.DefaultReadDeadlineSeconds
-	if defaultReadDeadlineSeconds <= 0 {
-		defaultReadDeadlineSeconds = 300 // 默认5分钟
-		logger.Warnf("DeviceRegisterHandler: DefaultReadDeadlineSeconds 配置错误或未配置，使用默认值: %ds", defaultReadDeadlineSeconds)
-	}
-	defaultReadDeadline := time.Duration(defaultReadDeadlineSeconds) * time.Second
-	if tcpConn, ok := conn.GetConnection().(*net.TCPConn); ok {
-		if err := tcpConn.SetReadDeadline(now.Add(defaultReadDeadline)); err != nil {
-			logger.WithFields(logrus.Fields{
-				"connID":              conn.GetConnID(),
-				"deviceId":            deviceId,
-				"iccid":               iccidFromProp,
-				"error":               err,
-				"readDeadlineSeconds": defaultReadDeadlineSeconds,
-			}).Error("DeviceRegisterHandler: 设置ReadDeadline失败")
-		}
+	// 更新设备参数缓存（固件/类型，供合规审计使用）
+	h.updateDeviceParamCache(deviceId, iccidFromProp, data)
+
+	// 锁定连接的协议方言（注册完成后不再切换）并记录到设备
+	dialectName := dialect.GetGlobalTracker().MarkRegistered(conn.GetConnID(), deviceId)
+	encrypted := false
+	if m := payloadcrypto.GetGlobalManager(); m != nil {
+		encrypted = m.MarkRegistered(conn.GetConnID(), deviceId)
+	}
+	if device, ok := tcpManager.GetDeviceByID(deviceId); ok {
+		device.Lock()
+		device.Dialect = string(dialectName)
+		device.Encrypted = encrypted
+		device.Unlock()
 	}
 
+	// 6. 切换为按帧间隔自适应的读超时
+	now := time.Now()
+	network.GetReadDeadlineTracker().MarkRegistered(conn, deviceId, now)
+
 	// 7. 记录设备注册信息
 	logger.WithFields(logrus.Fields{
-		"connID":            conn.GetConnID(),
-		"physicalIdHex":     utils.FormatPhysicalID(physicalId),
-		"physicalIdStr":     deviceId,
-		"iccid":             iccidFromProp,
-		"connState":         constants.ConnStatusActiveRegistered,
-		"readDeadlineSetTo": now.Add(defaultReadDeadline).Format(time.RFC3339),
-		"remoteAddr":        conn.RemoteAddr().String(),
-		"timestamp":         now.Format(constants.TimeFormatDefault),
-	}).Info("设备注册成功，连接状态更新为Active，ReadDeadline已重置")
+		"connID":        conn.GetConnID(),
+		"physicalIdHex": utils.FormatPhysicalID(physicalId),
+		"physicalIdStr": deviceId,
+		"iccid":         iccidFromProp,
+		"connState":     constants.ConnStatusActiveRegistered,
+		"remoteAddr":    conn.RemoteAddr().String(),
+		"timestamp":     now.Format(constants.TimeFormatDefault),
+	}).Info("设备注册成功，连接状态更新为Active，已切换自适应读超时")
 
 	// 8. 发送设备上线通知
 	integrator := notification.GetGlobalNotificationIntegrator()
@@ -317,7 +323,8 @@ func (h *DeviceRegisterHandler) handleDeviceRegister(deviceId string, physicalId
 	// 9. � 新架构：通过DeviceGateway处理设备上线事件
 	deviceGateway := gateway.GetGlobalDeviceGateway()
 	if deviceGateway != nil {
-		// DeviceGateway会自动处理设备上线状态更新
+		// DeviceGateway会自动处理设备上线状态更新；重新挂载虚拟子设备，远程重启后的重新注册视为重启完成
+		deviceGateway.OnDeviceRegistered(deviceId)
 		logger.WithFields(logrus.Fields{
 			"deviceId": deviceId,
 			"iccid":    iccidFromProp,
@@ -386,6 +393,26 @@ func (h *DeviceRegisterHandler) sendRegisterErrorResponse(deviceId string, physi
 	}).Warn("设备注册失败响应已发送")
 }
 
+// rejectDecommissioned 已停用设备的注册以 DECOMMISSIONED 拒绝并断开连接（告警按最小间隔发送），返回是否已拒绝
+func (h *DeviceRegisterHandler) rejectDecommissioned(deviceId string, physicalId uint32, messageID uint16, conn ziface.IConnection) bool {
+	record, blocked := decommission.GetGlobalRegistry().RejectRegistration(deviceId, conn.RemoteAddr().String(), time.Now())
+	if !blocked {
+		return false
+	}
+	logger.WithFields(logrus.Fields{
+		"connID":           conn.GetConnID(),
+		"deviceId":         deviceId,
+		"remoteAddr":       conn.RemoteAddr().String(),
+		"decommissionedAt": record.DecommissionedAt.Format(constants.TimeFormatDefault),
+		"rejected":         record.RejectedRegistrations,
+	}).Warn("已停用设备尝试注册，拒绝并断开连接")
+	h.sendRegisterErrorResponse(deviceId, physicalId, messageID, conn, decommission.ErrorCodeDecommissioned)
+	if tm := core.GetGlobalTCPManager(); tm == nil || !tm.DisconnectConnection(conn.GetConnID(), gateway.CleanupReasonDecommissioned) {
+		conn.Stop()
+	}
+	return true
+}
+
 // 🚀 智能注册分析（重构：使用统一TCP管理器）
 func (h *DeviceRegisterHandler) analyzeRegistrationRequest(deviceId string, conn ziface.IConnection) *RegistrationDecision {
 	now := time.Now()
@@ -583,6 +610,21 @@ func (h *DeviceRegisterHandler) sendDeviceRegisterNotification(deviceId string,
 	integrator.NotifyDeviceRegister(deviceId, registerData)
 }
 
+// updateDeviceParamCache 将注册包中的设备类型与固件版本写入参数缓存
+func (h *DeviceRegisterHandler) updateDeviceParamCache(deviceId string, iccid string, data []byte) {
+	deviceInfo := h.parseDeviceRegisterData(data)
+	values := map[string]interface{}{
+		core.ParamKeyICCID: iccid,
+	}
+	if v, ok := deviceInfo["device_type"]; ok {
+		values[core.ParamKeyDeviceType] = v
+	}
+	if v, ok := deviceInfo["firmware_version"]; ok {
+		values[core.ParamKeyFirmwareVersion] = v
+	}
+	core.GetDeviceParamCache().UpdateMany(deviceId, values)
+}
+
 // parseDeviceRegisterData 解析设备注册包数据
 func (h *DeviceRegisterHandler) parseDeviceRegisterData(data []byte) map[string]interface{} {
 	deviceInfo := make(map[string]interface{})
@@ -5,6 +5,7 @@ import (
 
 	"github.com/aceld/zinx/ziface"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
 	"github.com/sirupsen/logrus"
@@ -95,9 +96,12 @@ func (h *DeviceVersionHandler) processDeviceVersion(frame *protocol.DecodedDNYFr
 		// 🔧 修复：从Device获取和更新设备类型和版本信息
 		device, exists := tcpManager.GetDeviceByID(deviceID)
 		if exists {
-			// 更新设备类型和版本信息
+			// 更新设备类型和版本信息，并按新版本重新推导固件能力
+			device.Lock()
 			device.DeviceType = deviceType
 			device.DeviceVersion = deviceVersion
+			device.Capabilities = capability.Resolve(device.DeviceID, deviceType, deviceVersion)
+			device.Unlock()
 
 			logger.WithFields(logrus.Fields{
 				"deviceID":      deviceID,
@@ -113,6 +117,12 @@ func (h *DeviceVersionHandler) processDeviceVersion(frame *protocol.DecodedDNYFr
 		}
 	}
 
+	// 更新设备参数缓存（供合规审计使用）
+	core.GetDeviceParamCache().UpdateMany(deviceID, map[string]interface{}{
+		core.ParamKeyDeviceType:    deviceType,
+		core.ParamKeyDeviceVersion: deviceVersion,
+	})
+
 	// 记录设备版本信息
 	logger.WithFields(logrus.Fields{
 		"deviceID":      deviceID,
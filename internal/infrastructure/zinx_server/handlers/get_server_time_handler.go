@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
@@ -177,6 +178,6 @@ func (h *GetServerTimeHandler) sendRegistrationRequiredResponse(conn ziface.ICon
 		"connID":     conn.GetConnID(),
 		"physicalId": utils.FormatCardNumber(physicalId),
 		"messageId":  fmt.Sprintf("0x%04X", messageId),
-		"command":    fmt.Sprintf("0x%02X", command),
+		"command":    dny_protocol.CommandLabel(command),
 	}).Info("📋 设备需要先完成注册流程才能获取服务器时间")
 }
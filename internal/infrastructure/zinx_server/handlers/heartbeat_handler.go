@@ -8,10 +8,12 @@ import (
 
 	"github.com/aceld/zinx/ziface"
 	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
-	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/anomaly"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
 	"github.com/sirupsen/logrus"
@@ -95,7 +97,7 @@ func (h *HeartbeatHandler) processHeartbeat(decodedFrame *protocol.DecodedDNYFra
 			"connID":     conn.GetConnID(),
 			"dataLen":    len(data),
 			"minDataLen": minDataLen,
-			"command":    fmt.Sprintf("0x%02X", decodedFrame.Command),
+			"command":    dny_protocol.CommandLabel(decodedFrame.Command),
 			"deviceId":   deviceId,
 		}).Warn("心跳数据长度不足，可能是无效的心跳包")
 
@@ -253,15 +255,6 @@ func (h *HeartbeatHandler) processHeartbeat(decodedFrame *protocol.DecodedDNYFra
 
 	// 发送设备心跳通知
 	h.sendDeviceHeartbeatNotification(decodedFrame, conn, deviceId, iccid, data)
-
-	// 重置TCP ReadDeadline，避免读超时导致误断连
-	if tcpConn := conn.GetConnection(); tcpConn != nil {
-		defaultReadDeadlineSeconds := config.GetConfig().TCPServer.DefaultReadDeadlineSeconds
-		if defaultReadDeadlineSeconds <= 0 {
-			defaultReadDeadlineSeconds = 300
-		}
-		_ = tcpConn.SetReadDeadline(time.Now().Add(time.Duration(defaultReadDeadlineSeconds) * time.Second))
-	}
 }
 
 // updateHeartbeatTime 更新心跳时间 - 使用统一架构
@@ -333,6 +326,24 @@ func (h *HeartbeatHandler) parseSimplifiedHeartbeatPortStatus(data []byte, devic
 	// 🔧 关键修复：监控充电状态变化
 	h.monitorChargingStatusChanges(deviceId, portStatuses, conn, deviceSession)
 
+	// 站点聚合与端口状态历史：全部端口状态
+	now := time.Now()
+	if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+		gw.GetStationAggregator().OnPortStatuses(deviceId, portStatuses, now)
+	}
+	availability.GetGlobalTracker().OnPortStatuses(deviceId, portStatuses, now)
+
+	// 异常检测：电压，以及端口状态之后的信号强度与温度（温度0表示无传感器）
+	if detector := anomaly.GetGlobalDetector(); detector != nil {
+		detector.Observe(deviceId, anomaly.MetricVoltage, 0, notification.FormatVoltage(voltage), now)
+		if len(data) >= expectedLen+2 {
+			detector.Observe(deviceId, anomaly.MetricSignal, 0, float64(data[expectedLen]), now)
+			if raw := data[expectedLen+1]; raw != 0 {
+				detector.Observe(deviceId, anomaly.MetricTemperature, 0, float64(notification.FormatTemperature(raw)), now)
+			}
+		}
+	}
+
 	// 发送端口心跳状态通知
 	h.sendPortHeartbeatNotification(deviceId, portStatuses, voltage, conn)
 
@@ -395,6 +406,11 @@ func (h *HeartbeatHandler) monitorChargingStatusChanges(deviceId string, portSta
 				"chargingStatus": chargingStatus,
 				"source":         "HeartbeatHandler-0x21",
 			}).Warn("🚨 充电状态监控：设备正在充电")
+
+			// 设备侧排队的端口开始充电：会话由排队转为充电中
+			if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+				gw.OnPortStatusReport(deviceId, portNumber, status)
+			}
 		} else {
 			// 非充电状态使用DEBUG级别，减少日志噪音
 			logger.WithFields(logFields).Debug("🔌 设备端口状态：未充电")
@@ -485,7 +501,7 @@ func (h *HeartbeatHandler) sendDeviceHeartbeatNotification(decodedFrame *protoco
 	heartbeatData := map[string]interface{}{
 		"device_id":      deviceId,
 		"iccid":          iccid,
-		"command":        fmt.Sprintf("0x%02X", decodedFrame.Command),
+		"command":        dny_protocol.CommandLabel(decodedFrame.Command),
 		"message_id":     fmt.Sprintf("0x%04X", decodedFrame.MessageID),
 		"data_length":    len(data),
 		"conn_id":        conn.GetConnID(),
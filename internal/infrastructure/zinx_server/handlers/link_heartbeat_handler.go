@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/aceld/zinx/ziface"
-	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/network"
@@ -80,31 +79,7 @@ func (h *LinkHeartbeatHandler) Handle(request ziface.IRequest) {
 	// 连接级 keepalive：仅更新连接活跃度，不更新设备心跳（一个ICCID可对应多设备）
 	network.UpdateConnectionActivity(conn)
 
-	// 2. 重置TCP ReadDeadline - 使用优化后的配置
-	defaultReadDeadlineSeconds := config.GetConfig().TCPServer.DefaultReadDeadlineSeconds
-	if defaultReadDeadlineSeconds <= 0 {
-		defaultReadDeadlineSeconds = 90 // 默认值，以防配置错误
-		logger.Warnf("LinkHeartbeatHandler: DefaultReadDeadlineSeconds 配置错误或未配置，使用默认值: %ds", defaultReadDeadlineSeconds)
-	}
-	heartbeatReadDeadline := time.Duration(defaultReadDeadlineSeconds) * time.Second
-
-	tcpConn := conn.GetConnection()
-	if tcpConn != nil {
-		if err := tcpConn.SetReadDeadline(time.Now().Add(heartbeatReadDeadline)); err != nil {
-			logger.WithFields(logrus.Fields{
-				"connID":              conn.GetConnID(),
-				"error":               err,
-				"readDeadlineSeconds": defaultReadDeadlineSeconds,
-			}).Error("LinkHeartbeatHandler: 设置ReadDeadline失败")
-		} else {
-			logger.WithFields(logrus.Fields{
-				"connID":              conn.GetConnID(),
-				"readDeadlineSeconds": defaultReadDeadlineSeconds,
-			}).Debug("LinkHeartbeatHandler: 成功更新ReadDeadline")
-		}
-	} else {
-		logger.WithField("connID", conn.GetConnID()).Warn("LinkHeartbeatHandler: 无法获取TCP连接以设置ReadDeadline")
-	}
+	// 读超时由解码器的帧观察回调统一顺延（自适应读超时），此处无需重置
 
 	// 🔧 修复：从连接属性获取设备ID信息用于日志记录
 	var deviceID string
@@ -113,12 +88,11 @@ func (h *LinkHeartbeatHandler) Handle(request ziface.IRequest) {
 	}
 
 	logger.WithFields(logrus.Fields{
-		"connID":            conn.GetConnID(),
-		"remoteAddr":        conn.RemoteAddr().String(),
-		"heartbeat":         "link",
-		"deviceID":          deviceID,
-		"readDeadlineReset": fmt.Sprintf("%ds", defaultReadDeadlineSeconds),
-		"timestamp":         time.Now().Format(constants.TimeFormatDefault),
+		"connID":     conn.GetConnID(),
+		"remoteAddr": conn.RemoteAddr().String(),
+		"heartbeat":  "link",
+		"deviceID":   deviceID,
+		"timestamp":  time.Now().Format(constants.TimeFormatDefault),
 	}).Debug("link心跳处理完成")
 }
 
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
@@ -65,7 +66,7 @@ func (h *MainHeartbeatHandler) ValidateFrame(decodedFrame *protocol.DecodedDNYFr
 	// 根据日志分析，实际心跳数据长度可能为7字节，而不是期望的更长数据
 	if len(decodedFrame.Payload) < 1 {
 		logger.WithFields(logrus.Fields{
-			"command":    fmt.Sprintf("0x%02X", decodedFrame.Command),
+			"command":    dny_protocol.CommandLabel(decodedFrame.Command),
 			"payloadLen": len(decodedFrame.Payload),
 		}).Warn("主机心跳数据长度较短，但继续处理")
 	}
@@ -11,6 +11,7 @@ import (
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -62,6 +63,28 @@ func (h *ParameterSettingHandler) Handle(request ziface.IRequest) {
 	h.processParameterSetting(decodedFrame, conn, deviceSession)
 }
 
+// processParameterSettingAck 处理设备对参数设置命令的应答
+func (h *ParameterSettingHandler) processParameterSettingAck(decodedFrame *protocol.DecodedDNYFrame, physicalId uint32, deviceId string, status byte) {
+	command := uint8(decodedFrame.Command)
+	confirmed := network.GetCommandManager().ConfirmCommand(physicalId, decodedFrame.MessageID, command)
+
+	tuned := false
+	if command == constants.CmdParamSetting {
+		if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+			tuned = gw.OnRunParamsAck(deviceId, status)
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"deviceId":  deviceId,
+		"messageID": fmt.Sprintf("0x%04X", decodedFrame.MessageID),
+		"command":   dny_protocol.CommandLabel(command),
+		"status":    status,
+		"confirmed": confirmed,
+		"tuned":     tuned,
+	}).Info("收到参数设置应答")
+}
+
 // processParameterSetting 处理参数设置业务逻辑
 func (h *ParameterSettingHandler) processParameterSetting(decodedFrame *protocol.DecodedDNYFrame, conn ziface.IConnection, deviceSession *core.ConnectionSession) {
 	// 从RawPhysicalID提取uint32值
@@ -72,6 +95,12 @@ func (h *ParameterSettingHandler) processParameterSetting(decodedFrame *protocol
 	// 生成设备ID
 	deviceId := utils.FormatPhysicalID(physicalId)
 
+	// 设备对服务器下发的0x83/0x84的应答（1字节：0=成功，1=参数错误），确认命令后结束，不再回复
+	if len(data) == 1 {
+		h.processParameterSettingAck(decodedFrame, physicalId, deviceId, data[0])
+		return
+	}
+
 	// 解析参数设置数据
 	paramData := &dny_protocol.ParameterSettingData{}
 	if err := paramData.UnmarshalBinary(data); err != nil {
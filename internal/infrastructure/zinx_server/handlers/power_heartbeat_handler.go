@@ -6,9 +6,13 @@ import (
 	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/anomaly"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
@@ -208,6 +212,7 @@ func (h *PowerHeartbeatHandler) processPowerHeartbeat(decodedFrame *protocol.Dec
 		var chargeDuration uint16 = 0
 		var cumulativeEnergy uint16 = 0
 		var realtimePower uint16 = 0
+		var voltage uint16 = 0
 		var orderNumber string = ""
 
 		if len(data) >= 8 {
@@ -238,6 +243,9 @@ func (h *PowerHeartbeatHandler) processPowerHeartbeat(decodedFrame *protocol.Dec
 			// 兼容旧格式：[端口号(1)][电流(2)][功率(2)][电压(2)][保留(1)]
 			powerHalfW := binary.LittleEndian.Uint16(data[3:5]) // 功率，单位0.5W
 			realtimePower = powerHalfW
+			if len(data) >= 7 {
+				voltage = binary.LittleEndian.Uint16(data[5:7]) // 电压(伏)
+			}
 		}
 
 		// 🔧 关键修复：记录充电状态变化
@@ -280,8 +288,26 @@ func (h *PowerHeartbeatHandler) processPowerHeartbeat(decodedFrame *protocol.Dec
 			}
 		}
 
+		// 站点聚合与端口状态：状态、实时功率、电压与进行中订单电量；端口状态历史
+		now := time.Now()
+		if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+			gw.GetStationAggregator().OnPortSample(deviceId, int(portNumber)+1, gateway.PortSample{
+				Status:   portStatus,
+				PowerW:   notification.FormatPower(realtimePower),
+				VoltageV: float64(voltage),
+				EnergyWh: uint32(cumulativeEnergy),
+				OrderNo:  orderNumber,
+			}, now)
+		}
+		availability.GetGlobalTracker().OnPortStatus(deviceId, int(portNumber)+1, portStatus, now)
+
 		// 🔧 新增：充电状态变化通知
 		if isCharging {
+			// 设备侧排队的端口开始充电：会话由排队转为充电中
+			if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+				gw.OnPortStatusReport(deviceId, int(portNumber)+1, portStatus)
+			}
+
 			logger.WithFields(logrus.Fields{
 				"deviceId":         deviceId,
 				"portNumber":       portNumber + 1,
@@ -313,7 +339,7 @@ func (h *PowerHeartbeatHandler) processPowerHeartbeat(decodedFrame *protocol.Dec
 
 	// 智能降功率：将06心跳回调到控制器
 	if isCharging {
-		port1 := int(logFields["portNumber"].(int))
+		port1 := int(logFields["portNumber"].(uint8))             // 日志字段为协议端口+1(uint8)
 		realtimePower := int(logFields["realtimePower"].(uint16)) // 原始单位0.1W
 		orderNo := ""
 		if v, ok := logFields["orderNumber"].(string); ok {
@@ -322,6 +348,16 @@ func (h *PowerHeartbeatHandler) processPowerHeartbeat(decodedFrame *protocol.Dec
 		// 转换为瓦
 		realtimeW := int(notification.FormatPower(uint16(realtimePower)))
 		gateway.GetDynamicPowerController().OnPowerHeartbeat(deviceId, port1, orderNo, realtimeW, true, time.Now())
+		if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+			gw.GetMeteringTracker().OnPowerSample(deviceId, port1-1, orderNo, notification.FormatPower(uint16(realtimePower)), time.Now())
+			gw.GetChargingSessions().OnPowerHeartbeat(deviceId, port1, orderNo, gateway.PowerSample{
+				PowerW:          notification.FormatPower(uint16(realtimePower)),
+				EnergyWh:        uint32(logFields["cumulativeEnergy"].(uint16)),
+				DurationSeconds: int64(logFields["chargeDuration"].(uint16)),
+			}, time.Now())
+		}
+		energy.GetGlobalCounters().OnPowerSample(deviceId, port1, orderNo, notification.FormatPower(uint16(realtimePower)), time.Now())
+		anomaly.Observe(deviceId, anomaly.MetricPower, port1, notification.FormatPower(uint16(realtimePower)))
 
 		// 推送充电功率实时数据（charging_power）
 		integrator := notification.GetGlobalNotificationIntegrator()
@@ -333,7 +369,7 @@ func (h *PowerHeartbeatHandler) processPowerHeartbeat(decodedFrame *protocol.Dec
 				"realtime_power_raw": uint16(realtimePower),
 				"charge_duration":    logFields["chargeDuration"],
 				"message_id":         fmt.Sprintf("0x%04X", decodedFrame.MessageID),
-				"command":            fmt.Sprintf("0x%02X", decodedFrame.Command),
+				"command":            dny_protocol.CommandLabel(decodedFrame.Command),
 				"power_time":         time.Now().Unix(),
 				"orderNo":            logFields["orderNumber"],
 				"power":              notification.FormatPower(uint16(realtimePower)),
@@ -377,7 +413,7 @@ func (h *PowerHeartbeatHandler) sendPowerHeartbeatNotification(decodedFrame *pro
 		"realtime_power_raw":    realtimePower,
 		"conn_id":               conn.GetConnID(),
 		"remote_addr":           conn.RemoteAddr().String(),
-		"command":               fmt.Sprintf("0x%02X", decodedFrame.Command),
+		"command":               dny_protocol.CommandLabel(decodedFrame.Command),
 		"message_id":            fmt.Sprintf("0x%04X", decodedFrame.MessageID),
 		"heartbeat_time":        time.Now().Unix(),
 	}
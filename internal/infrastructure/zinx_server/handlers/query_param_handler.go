@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// QueryParamHandler 处理参数查询应答 (命令ID: 0x90~0x93，内容为 0x83~0x86 设置参数)
+// 设备也会主动周期上报 0x90/0x91 运行参数（无对应的待应答命令）；两种来源的运行参数均记录到设备属性。
+// 不对上报应答：服务器下发同命令码即为查询，会触发设备再次上报
+type QueryParamHandler struct {
+	protocol.SimpleHandlerBase
+}
+
+// NewQueryParamHandler 创建参数查询应答处理器
+func NewQueryParamHandler() *QueryParamHandler {
+	return &QueryParamHandler{}
+}
+
+// Handle 确认查询命令、记录运行参数并将分段交给设备配置读取器组装
+func (h *QueryParamHandler) Handle(request ziface.IRequest) {
+	conn := request.GetConnection()
+
+	decodedFrame, err := h.ExtractDecodedFrame(request)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"connID": conn.GetConnID(),
+			"error":  err.Error(),
+		}).Error("❌ 参数查询应答：提取DNY帧数据失败")
+		return
+	}
+
+	physicalID, err := decodedFrame.GetPhysicalIDAsUint32()
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"connID":   conn.GetConnID(),
+			"deviceID": decodedFrame.DeviceID,
+			"error":    err.Error(),
+		}).Error("❌ 参数查询应答：无法获取物理ID")
+		return
+	}
+	deviceID := utils.FormatPhysicalID(physicalID)
+	command := decodedFrame.Command
+
+	confirmed := network.GetCommandManager().ConfirmCommand(physicalID, decodedFrame.MessageID, command)
+
+	stored := false
+	if command == constants.CmdQueryParam1 || command == constants.CmdQueryParam2 {
+		if tm := core.GetGlobalTCPManager(); tm != nil {
+			if params, err := tm.UpdateDeviceParameters(deviceID, command, decodedFrame.Payload, time.Now()); err != nil {
+				logger.WithFields(logrus.Fields{
+					"connID":   conn.GetConnID(),
+					"deviceID": deviceID,
+					"command":  dny_protocol.CommandLabel(command),
+					"error":    err.Error(),
+				}).Warn("运行参数解析失败")
+			} else {
+				stored = true
+				if params.Partial {
+					logger.WithFields(logrus.Fields{
+						"deviceID": deviceID,
+						"command":  dny_protocol.CommandLabel(command),
+						"dataLen":  len(decodedFrame.Payload),
+					}).Info("运行参数数据被截断，已解析现有字段")
+				}
+			}
+		}
+	}
+
+	accepted := false
+	if gw := gateway.GetGlobalDeviceGateway(); gw != nil {
+		accepted = gw.HandleConfigSection(deviceID, command, decodedFrame.Payload)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"connID":    conn.GetConnID(),
+		"deviceID":  deviceID,
+		"messageID": fmt.Sprintf("0x%04X", decodedFrame.MessageID),
+		"command":   dny_protocol.CommandLabel(command),
+		"dataHex":   fmt.Sprintf("%X", decodedFrame.Payload),
+		"confirmed": confirmed,
+		"accepted":  accepted,
+		"stored":    stored,
+	}).Info("收到参数查询应答")
+}
@@ -1,12 +1,80 @@
 package handlers
 
 import (
+	"fmt"
+
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/extension"
+	"github.com/bujia-iot/iot-zinx/pkg/framededup"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
 )
 
-// RegisterRouters 注册所有路由
-func RegisterRouters(server ziface.IServer) {
+// RouteAdder 路由注册目标（ziface.IServer 满足该接口）
+type RouteAdder interface {
+	AddRouter(msgID uint32, router ziface.IRouter)
+}
+
+// routeTable 待装配的路由：先登记内置处理器，再叠加自定义处理器，最后统一注册到服务器
+type routeTable struct {
+	order   []uint32
+	routers map[uint32]ziface.IRouter
+}
+
+// addRouter 登记内置处理器
+func addRouter(table *routeTable, msgID uint32, router ziface.IRouter) {
+	if _, exists := table.routers[msgID]; exists {
+		panic(fmt.Sprintf("重复注册处理器: msgID=0x%02X", msgID))
+	}
+	table.order = append(table.order, msgID)
+	table.routers[msgID] = router
+}
+
+// RegisterRouters 注册所有路由：内置处理器与扩展包注册的自定义处理器，
+// 每个处理器外层包装panic恢复：panic时隔离原始帧并记录现场，连接与worker不受影响；
+// 其内包装重复帧抑制：设备重发的帧只重放应答，不再交给处理器
+func RegisterRouters(server RouteAdder) {
+	table := &routeTable{routers: make(map[uint32]ziface.IRouter)}
+	registerBuiltinRouters(table)
+	applyCustomRouters(table)
+	for _, msgID := range table.order {
+		server.AddRouter(msgID, handlerguard.Wrap(msgID, framededup.Wrap(msgID, table.routers[msgID])))
+	}
+}
+
+// applyCustomRouters 叠加自定义处理器；与内置命令码冲突的仅在配置显式允许时覆盖
+func applyCustomRouters(table *routeTable) {
+	cfg := config.GetConfig().Extensions
+	disabled, err := extension.ParseCommands(cfg.Disabled)
+	if err != nil {
+		logger.Errorf("extensions.disabled 配置无效，已忽略: %v", err)
+	}
+	override, err := extension.ParseCommands(cfg.OverrideBuiltin)
+	if err != nil {
+		logger.Errorf("extensions.overrideBuiltin 配置无效，不允许任何覆盖: %v", err)
+		override = nil
+	}
+	bindings := extension.GetGlobalRegistry().Bind(extension.BindOptions{
+		Builtin: func(msgID uint32) bool {
+			_, exists := table.routers[msgID]
+			return exists
+		},
+		Disabled:        disabled,
+		OverrideBuiltin: override,
+	})
+	for _, b := range bindings {
+		msgID := uint32(b.Command)
+		if !b.Override {
+			table.order = append(table.order, msgID)
+		}
+		table.routers[msgID] = b.Router
+	}
+}
+
+// registerBuiltinRouters 登记内置处理器
+func registerBuiltinRouters(server *routeTable) {
 	// ============================================================================
 	// 注册消息处理路由
 	// 说明：DNY解码器会处理原始数据，根据不同情况设置消息ID：
@@ -17,48 +85,53 @@ func RegisterRouters(server ziface.IServer) {
 
 	// 一、特殊消息处理器（非DNY协议数据，没有标准DNY包头）
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.MsgIDICCID, &SimCardHandler{})               // SIM卡号/ICCID处理 - 处理20位纯数字ICCID上报
-	server.AddRouter(constants.MsgIDLinkHeartbeat, &LinkHeartbeatHandler{}) // link心跳处理 - 处理"link"字符串心跳
+	addRouter(server, constants.MsgIDICCID, &SimCardHandler{})               // SIM卡号/ICCID处理 - 处理20位纯数字ICCID上报
+	addRouter(server, constants.MsgIDLinkHeartbeat, &LinkHeartbeatHandler{}) // link心跳处理 - 处理"link"字符串心跳
 
 	// 用于处理无法识别的数据类型（解析错误或格式不符合预期）
-	server.AddRouter(constants.MsgIDUnknown, &NonDNYDataHandler{}) // 处理解析失败或未知类型的数据
+	addRouter(server, constants.MsgIDUnknown, &NonDNYDataHandler{}) // 处理解析失败或未知类型的数据
 
 	// 二、心跳类消息处理器
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.CmdHeartbeat, &HeartbeatHandler{})         // 0x01 设备心跳包(旧版)
-	server.AddRouter(constants.CmdDeviceHeart, &HeartbeatHandler{})       // 0x21 设备心跳包/分机心跳
-	server.AddRouter(constants.CmdMainHeartbeat, &MainHeartbeatHandler{}) // 0x11 主机心跳
+	addRouter(server, constants.CmdHeartbeat, &HeartbeatHandler{})         // 0x01 设备心跳包(旧版)
+	addRouter(server, constants.CmdDeviceHeart, &HeartbeatHandler{})       // 0x21 设备心跳包/分机心跳
+	addRouter(server, constants.CmdMainHeartbeat, &MainHeartbeatHandler{}) // 0x11 主机心跳
 	// server.AddRouter(constants.CmdPowerHeartbeat, NewPowerHeartbeatHandler())         // 0x06 功率心跳 - 已删除
 	// server.AddRouter(constants.CmdPortPowerHeartbeat, NewPortPowerHeartbeatHandler()) // 0x26 端口充电时功率心跳包（扩展版本） - 已删除
 
 	// 三、设备注册与状态查询
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.CmdDeviceRegister, &DeviceRegisterHandler{}) // 0x20 设备注册包
-	server.AddRouter(constants.CmdNetworkStatus, &DeviceStatusHandler{})    // 0x81 查询设备联网状态
+	addRouter(server, constants.CmdDeviceRegister, &DeviceRegisterHandler{}) // 0x20 设备注册包
+	addRouter(server, constants.CmdNetworkStatus, &DeviceStatusHandler{})    // 0x81 查询设备联网状态
 
 	// 四、时间同步
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.CmdDeviceTime, NewGetServerTimeHandler())    // 0x22 设备获取服务器时间
-	server.AddRouter(constants.CmdGetServerTime, NewGetServerTimeHandler()) // 0x12 主机获取服务器时间
+	addRouter(server, constants.CmdDeviceTime, NewGetServerTimeHandler())    // 0x22 设备获取服务器时间
+	addRouter(server, constants.CmdGetServerTime, NewGetServerTimeHandler()) // 0x12 主机获取服务器时间
 
 	// 五、业务逻辑
 	// ----------------------------------------------------------------------------
 	// server.AddRouter(constants.CmdSwipeCard, &SwipeCardHandler{})                           // 0x02 刷卡操作 - 已删除
-	server.AddRouter(constants.CmdChargeControl, &ChargeControlHandler{}) // 0x82 充电控制 - 简化版
-	server.AddRouter(constants.CmdSettlement, &SettlementHandler{})       // 0x03 结算消费信息上传 - 已删除
+	addRouter(server, constants.CmdChargeControl, &ChargeControlHandler{}) // 0x82 充电控制 - 简化版
+	addRouter(server, constants.CmdSettlement, &SettlementHandler{})       // 0x03 结算消费信息上传 - 已删除
 	// server.AddRouter(constants.CmdTimeBillingSettlement, NewTimeBillingSettlementHandler()) // 0x23 分时收费结算专用 - 已删除
 
 	// 六、参数设置
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.CmdParamSetting, &ParameterSettingHandler{}) // 0x83 设置运行参数1.1
+	addRouter(server, constants.CmdParamSetting, &ParameterSettingHandler{})     // 0x83 设置运行参数1.1
+	addRouter(server, constants.CmdQueryParam1, NewQueryParamHandler())          // 0x90 查询运行参数1.1（设备配置读取）
+	addRouter(server, constants.CmdQueryParam2, NewQueryParamHandler())          // 0x91 查询运行参数1.2
+	addRouter(server, constants.CmdQueryParam3, NewQueryParamHandler())          // 0x92 查询运行参数2
+	addRouter(server, constants.CmdQueryParam4, NewQueryParamHandler())          // 0x93 查询用户卡参数
+	addRouter(server, constants.CmdMaxTimeAndPower, NewMaxTimeAndPowerHandler()) // 0x85 设置最大充电时长、过载功率（设备宏）
 
 	// 七、设备管理
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.CmdDeviceLocate, NewDeviceLocateHandler()) // 0x96 声光寻找设备功能 - 🔧 重新启用以处理设备定位响应
+	addRouter(server, constants.CmdDeviceLocate, NewDeviceLocateHandler()) // 0x96 声光寻找设备功能 - 🔧 重新启用以处理设备定位响应
 
 	// 七、设备版本信息
 	// ----------------------------------------------------------------------------
-	server.AddRouter(constants.CmdDeviceVersion, &DeviceVersionHandler{}) // 0x35 上传分机版本号与设备类型
+	addRouter(server, constants.CmdDeviceVersion, &DeviceVersionHandler{}) // 0x35 上传分机版本号与设备类型
 
 	// 八、🔧 修复：添加缺失的命令处理器，解决"api msgID = X is not FOUND!"错误
 	// ----------------------------------------------------------------------------
@@ -79,12 +152,7 @@ func RegisterRouters(server ziface.IServer) {
 	// server.AddRouter(constants.CmdOrderConfirm, &GenericCommandHandler{})       // 0x04 充电端口订单确认 - 已删除
 	// server.AddRouter(constants.CmdUpgradeRequest, &GenericCommandHandler{})     // 0x05 设备主动请求升级 - 已删除
 	// server.AddRouter(constants.CmdParamSetting2, NewParamSetting2Handler())     // 0x84 设置运行参数1.2 - 已删除
-	// server.AddRouter(constants.CmdMaxTimeAndPower, NewMaxTimeAndPowerHandler()) // 0x85 设置最大充电时长、过载功率 - 已删除
 	// server.AddRouter(constants.CmdModifyCharge, NewModifyChargeHandler())       // 0x8A 服务器修改充电时长/电量 - 已删除
-	// server.AddRouter(constants.CmdQueryParam1, NewQueryParamHandler())          // 0x90 查询运行参数1.1 - 已删除
-	// server.AddRouter(constants.CmdQueryParam2, NewQueryParamHandler())          // 0x91 查询运行参数1.2 - 已删除
-	// server.AddRouter(constants.CmdQueryParam3, NewQueryParamHandler())          // 0x92 查询运行参数2 - 已删除
-	// server.AddRouter(constants.CmdQueryParam4, NewQueryParamHandler())          // 0x93 查询用户卡参数 - 已删除
 	// server.AddRouter(constants.CmdRebootMain, &GenericCommandHandler{})         // 0x31 重启主机指令 - 已删除
 	// server.AddRouter(constants.CmdRebootComm, &GenericCommandHandler{})         // 0x32 重启通讯模块 - 已删除
 	// server.AddRouter(constants.CmdClearUpgrade, &GenericCommandHandler{})       // 0x33 清空升级分机数据 - 已删除
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,9 +11,13 @@ import (
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
 	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
 	"github.com/bujia-iot/iot-zinx/pkg/notification"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -72,24 +77,23 @@ func (h *SettlementHandler) processSettlement(decodedFrame *protocol.DecodedDNYF
 
 	deviceId := utils.FormatPhysicalID(physicalId)
 
-	// 检查数据长度
-	if len(data) < 8 {
-		logger.WithFields(logrus.Fields{
-			"connID":     conn.GetConnID(),
-			"physicalId": utils.FormatCardNumber(physicalId),
-			"messageID":  fmt.Sprintf("0x%04X", messageID),
-			"dataLen":    len(data),
-		}).Error("结算数据长度不足")
-		return
-	}
-
-	// 解析结算数据
+	// 解析结算数据：长度不足或订单编号不合法的载荷按原因计数后应答失败
 	settlementData := &dny_protocol.SettlementData{}
 	if err := settlementData.UnmarshalBinary(data); err != nil {
+		reason := settlement.RejectOther
+		switch {
+		case errors.Is(err, dny_protocol.ErrSettlementTooShort):
+			reason = settlement.RejectTooShort
+		case errors.Is(err, dny_protocol.ErrSettlementOrderNo):
+			reason = settlement.RejectOrderNo
+		}
+		settlement.RecordRejected(reason)
 		logger.WithFields(logrus.Fields{
 			"connID":     conn.GetConnID(),
 			"physicalId": utils.FormatCardNumber(physicalId),
 			"messageID":  fmt.Sprintf("0x%04X", messageID),
+			"dataLen":    len(data),
+			"reason":     reason,
 			"error":      err.Error(),
 		}).Error("解析结算数据失败")
 
@@ -126,10 +130,81 @@ func (h *SettlementHandler) processSettlement(decodedFrame *protocol.DecodedDNYF
 		"uploadTime":     time.Now().Format(constants.TimeFormatDefault),
 	}).Info("结算数据解析成功")
 
+	command := decodedFrame.Command
+
+	// 结算日志存储：fsync完成后才应答；写入失败应答失败由设备重发，载荷相同的重发已在写入时去重
+	if store := settlement.GetGlobalStore(); store != nil {
+		if _, duplicate, err := store.Append(settlement.Record{
+			OrderNo:    settlementData.OrderID,
+			DeviceID:   deviceId,
+			Port:       int(settlementData.GunNumber),
+			CardNumber: settlementData.CardNumber,
+			EnergyWh:   settlementData.ElectricEnergy,
+			ChargeFee:  settlementData.ChargeFee,
+			ServiceFee: settlementData.ServiceFee,
+			TotalFee:   settlementData.TotalFee,
+			StartTime:  settlementData.StartTime,
+			EndTime:    settlementData.EndTime,
+			StopReason: settlementData.StopReason,
+			MessageID:  messageID,
+			Payload:    data,
+			RawFrame:   decodedFrame.RawData,
+		}); err != nil {
+			logger.WithFields(logrus.Fields{
+				"connID":   conn.GetConnID(),
+				"deviceId": deviceId,
+				"orderNo":  settlementData.OrderID,
+				"error":    err.Error(),
+			}).Error("❌ 结算写入日志存储失败，应答失败等待设备重发")
+			h.sendSettlementResponse(conn, physicalId, messageID, command, false)
+			return
+		} else if duplicate {
+			logger.WithFields(logrus.Fields{
+				"deviceId": deviceId,
+				"orderNo":  settlementData.OrderID,
+			}).Debug("结算日志存储已有相同载荷的记录（设备重发）")
+		}
+	}
+
+	// 关键帧预写：落盘后先应答再交接，崩溃后由启动重放补齐；未预写时处理完成后再应答
+	frame := beginCriticalFrame(decodedFrame, conn, physicalId)
+	switch {
+	case frame.duplicate:
+		logger.WithFields(logrus.Fields{
+			"connID":   conn.GetConnID(),
+			"deviceId": deviceId,
+			"orderNo":  settlementData.OrderID,
+		}).Warn("⚠️ 结算帧已处理过（设备重发），仅应答不再交接")
+		h.sendSettlementResponse(conn, physicalId, messageID, command, true)
+	case frame.journaled:
+		h.sendSettlementResponse(conn, physicalId, messageID, command, true)
+		h.handoffSettlement(decodedFrame, conn, settlementData, deviceId, nil)
+		frame.finish()
+	default:
+		success := h.handoffSettlement(decodedFrame, conn, settlementData, deviceId, nil)
+		h.sendSettlementResponse(conn, physicalId, messageID, command, success)
+	}
+
+	// 更新心跳时间并标记在线，保持API状态一致
+	// 🔧 修复：直接使用设备ID更新心跳，不需要获取session
+	if tcpManager := core.GetGlobalTCPManager(); tcpManager != nil {
+		_ = tcpManager.UpdateHeartbeat(decodedFrame.DeviceID)
+	}
+}
+
+// handoffSettlement 结算下游交接：促销对账、结算/充电结束通知、清理订单与状态机
+// replay 非空表示从预写日志重放（原连接已断开，conn 为 nil）
+func (h *SettlementHandler) handoffSettlement(decodedFrame *protocol.DecodedDNYFrame, conn ziface.IConnection, settlementData *dny_protocol.SettlementData, deviceId string, replay *journal.Entry) bool {
 	// 🚀 新架构：使用DeviceGateway处理结算
 	deviceGateway := gateway.GetGlobalDeviceGateway()
 	success := false
 
+	// 促销会话对账：免费会话设备仍上报费用视为差异（需在清理订单前完成）
+	var promoCheck *gateway.PromotionSettlementCheck
+	if deviceGateway != nil {
+		promoCheck = deviceGateway.CheckPromotionSettlement(settlementData.OrderID, settlementData.TotalFee)
+	}
+
 	if deviceGateway != nil {
 		// 通过DeviceGateway处理结算逻辑
 		// 这里可以根据实际需求实现结算处理逻辑
@@ -140,6 +215,11 @@ func (h *SettlementHandler) processSettlement(decodedFrame *protocol.DecodedDNYF
 		}).Info("结算数据已通过DeviceGateway处理")
 	}
 
+	receivedAt := time.Now()
+	if replay != nil {
+		receivedAt = replay.ReceivedAt
+	}
+
 	// 发送结算通知和充电结束通知
 	integrator := notification.GetGlobalNotificationIntegrator()
 	if integrator.IsEnabled() {
@@ -157,6 +237,19 @@ func (h *SettlementHandler) processSettlement(decodedFrame *protocol.DecodedDNYF
 			"stop_reason":   settlementData.StopReason,
 			"settlement_id": fmt.Sprintf("SETTLE_%s_%d", deviceId, time.Now().Unix()),
 		}
+		if promoCheck != nil {
+			notificationData["promotion"] = promoCheck.Promotion
+			notificationData["promotion_discrepancy"] = promoCheck.Discrepancy
+			if promoCheck.Discrepancy {
+				notificationData["discrepancy_reason"] = promoCheck.Reason
+			}
+		}
+		if replay != nil {
+			notificationData["conn_id"] = replay.ConnID
+			notificationData["remote_addr"] = replay.RemoteAddr
+			notificationData["replayed"] = true
+			notificationData["received_at"] = replay.ReceivedAt.Unix()
+		}
 
 		// 发送结算通知
 		integrator.NotifySettlement(decodedFrame, conn, notificationData)
@@ -173,27 +266,74 @@ func (h *SettlementHandler) processSettlement(decodedFrame *protocol.DecodedDNYF
 			StopReason:          settlementData.StopReason,
 			SettlementTriggered: true,
 		}
+		if replay != nil {
+			chargingEndData.RemoteAddr = replay.RemoteAddr
+		}
 		integrator.NotifyChargingEnd(decodedFrame, conn, chargingEndData)
+
+		// 富化结算：结算字段 + 会话记录 + 设备上下文 + 计量积分对比，供计费系统单条消费
+		if deviceGateway != nil {
+			doc := deviceGateway.EnrichSettlement(gateway.SettledCharge{
+				OrderNo:    settlementData.OrderID,
+				DeviceID:   deviceId,
+				Port:       int(settlementData.GunNumber),
+				CardNumber: settlementData.CardNumber,
+				EnergyWh:   settlementData.ElectricEnergy,
+				ChargeFee:  settlementData.ChargeFee,
+				ServiceFee: settlementData.ServiceFee,
+				TotalFee:   settlementData.TotalFee,
+				StartTime:  settlementData.StartTime,
+				EndTime:    settlementData.EndTime,
+				StopReason: settlementData.StopReason,
+				ReceivedAt: receivedAt,
+				Replayed:   replay != nil,
+			})
+			integrator.NotifyEnrichedSettlement(deviceId, int(settlementData.GunNumber), doc.ToMap())
+		}
 	}
 
+	// 记入对账台账（重放帧以首次接收时间计，保证零点前收到的结算仍归入当日）
+	reconcile.GetGlobalReconciler().Ledger().RecordSettlement(reconcile.SettlementRecord{
+		OrderNo:    settlementData.OrderID,
+		DeviceID:   deviceId,
+		Port:       int(settlementData.GunNumber),
+		EnergyWh:   settlementData.ElectricEnergy,
+		ChargeFee:  settlementData.ChargeFee,
+		ServiceFee: settlementData.ServiceFee,
+		TotalFee:   settlementData.TotalFee,
+		StartTime:  settlementData.StartTime,
+		EndTime:    settlementData.EndTime,
+		StopReason: settlementData.StopReason,
+		ReceivedAt: receivedAt,
+		Replayed:   replay != nil,
+	})
+
+	// 端口累计电量以结算为准（协议端口0-based，计数器按1-based业务端口；同一订单的积分值被替换）
+	energy.GetGlobalCounters().OnSettlement(deviceId, int(settlementData.GunNumber)+1, settlementData.OrderID, float64(settlementData.ElectricEnergy), receivedAt)
+
 	// 💡 结算完成后，清理该端口的订单与状态机，释放以便下一单
 	if deviceGateway != nil {
+		// 充电会话经settling转为completed/refunding；未知订单或非法转换已记入会话异常
+		_, _ = deviceGateway.GetChargingSessions().OnSettlement(deviceId, int(settlementData.GunNumber)+1, settlementData.OrderID, gateway.SettlementReport{
+			EnergyWh:        settlementData.ElectricEnergy,
+			DurationSeconds: int64(settlementData.EndTime.Sub(settlementData.StartTime).Seconds()),
+			StopReason:      settlementData.StopReason,
+		}, receivedAt)
+
 		// 协议端口为0-based，SettlementData.GunNumber 即协议端口
 		port := int(settlementData.GunNumber)
 		deviceGateway.FinalizeChargingSession(deviceId, port, settlementData.OrderID, "settlement received (0x03)")
 	}
+	return success
+}
 
-	// 构建响应数据
-	var responseData []byte
+// sendSettlementResponse 发送结算应答
+func (h *SettlementHandler) sendSettlementResponse(conn ziface.IConnection, physicalId uint32, messageID uint16, command byte, success bool) {
+	responseData := []byte{constants.StatusError}
 	if success {
 		responseData = []byte{constants.StatusSuccess}
-	} else {
-		responseData = []byte{constants.StatusError}
 	}
 
-	command := decodedFrame.Command
-
-	// 发送响应
 	if err := protocol.SendDNYResponse(conn, physicalId, messageID, uint8(command), responseData); err != nil {
 		logger.WithFields(logrus.Fields{
 			"connID":     conn.GetConnID(),
@@ -210,10 +350,14 @@ func (h *SettlementHandler) processSettlement(decodedFrame *protocol.DecodedDNYF
 		"messageID":  fmt.Sprintf("0x%04X", messageID),
 		"success":    success,
 	}).Debug("结算响应发送成功")
+}
 
-	// 更新心跳时间并标记在线，保持API状态一致
-	// 🔧 修复：直接使用设备ID更新心跳，不需要获取session
-	if tcpManager := core.GetGlobalTCPManager(); tcpManager != nil {
-		_ = tcpManager.UpdateHeartbeat(decodedFrame.DeviceID)
+// replaySettlement 重放预写日志中的结算帧：原连接已断开，仅执行下游交接
+func (h *SettlementHandler) replaySettlement(decodedFrame *protocol.DecodedDNYFrame, entry journal.Entry) error {
+	settlementData := &dny_protocol.SettlementData{}
+	if err := settlementData.UnmarshalBinary(decodedFrame.Payload); err != nil {
+		return fmt.Errorf("解析结算数据失败: %w", err)
 	}
+	h.handoffSettlement(decodedFrame, nil, settlementData, entry.DeviceID, &entry)
+	return nil
 }
@@ -2,11 +2,9 @@ package handlers
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/aceld/zinx/ziface"
 	"github.com/aceld/zinx/znet"
-	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
@@ -42,7 +40,6 @@ func (h *SimCardHandler) Handle(request ziface.IRequest) {
 	// 验证ICCID格式 - 符合ITU-T E.118标准
 	if len(data) == constants.IotSimCardLength && h.isValidICCIDStrict(data) {
 		iccidStr := string(data)
-		now := time.Now()
 
 		// 将ICCID存入连接属性中（兼容）并同步到TCPManager（唯一事实来源）
 		conn.SetProperty(constants.PropKeyICCID, iccidStr)
@@ -73,36 +70,13 @@ func (h *SimCardHandler) Handle(request ziface.IRequest) {
 			}
 		}
 
-		// 重置TCP ReadDeadline
-		defaultReadDeadlineSeconds := config.GetConfig().TCPServer.DefaultReadDeadlineSeconds
-		if defaultReadDeadlineSeconds <= 0 {
-			defaultReadDeadlineSeconds = 300 // 默认5分钟
-			logger.Warnf("SimCardHandler: DefaultReadDeadlineSeconds 配置错误或未配置，使用默认值: %ds", defaultReadDeadlineSeconds)
-		}
-		defaultReadDeadline := time.Duration(defaultReadDeadlineSeconds) * time.Second
-
-		tcpConn := conn.GetConnection()
-		if tcpConn != nil {
-			if err := tcpConn.SetReadDeadline(now.Add(defaultReadDeadline)); err != nil {
-				logger.WithFields(logrus.Fields{
-					"connID":  conn.GetConnID(),
-					"iccid":   iccidStr,
-					"timeout": defaultReadDeadline.String(),
-					"error":   err,
-				}).Error("SimCardHandler: 设置ReadDeadline失败")
-			}
-		} else {
-			logger.WithField("connID", conn.GetConnID()).Warn("SimCardHandler: 无法获取TCP连接以设置ReadDeadline")
-		}
-
 		logger.WithFields(logrus.Fields{
-			"connID":            conn.GetConnID(),
-			"remoteAddr":        conn.RemoteAddr().String(),
-			"iccid":             iccidStr,
-			"connState":         constants.ConnStatusICCIDReceived,
-			"readDeadlineSetTo": now.Add(defaultReadDeadline).Format(time.RFC3339),
-			"dataLen":           len(data),
-		}).Info("SimCardHandler: 收到有效ICCID，更新连接状态并重置ReadDeadline")
+			"connID":     conn.GetConnID(),
+			"remoteAddr": conn.RemoteAddr().String(),
+			"iccid":      iccidStr,
+			"connState":  constants.ConnStatusICCIDReceived,
+			"dataLen":    len(data),
+		}).Info("SimCardHandler: 收到有效ICCID，更新连接状态")
 
 	} else {
 		logger.WithFields(logrus.Fields{
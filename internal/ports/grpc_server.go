@@ -0,0 +1,44 @@
+package ports
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	apigrpc "github.com/bujia-iot/iot-zinx/internal/adapter/grpc"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+)
+
+// GRPCServer 封装gRPC服务器（与HTTP API共用路由处理链与鉴权密钥，随HTTP API服务器启停）
+type GRPCServer struct {
+	addr   string
+	server *apigrpc.Server
+}
+
+// NewGRPCServer 创建gRPC服务器，handler 为HTTP API的路由引擎；调用指标并入 /metrics
+func NewGRPCServer(handler http.Handler) *GRPCServer {
+	cfg := config.GetConfig()
+	server := apigrpc.NewServer(handler, apigrpc.Options{
+		SharedKey:            cfg.HTTPAPIServer.Auth.SharedKey,
+		MaxConcurrentStreams: uint32(max(cfg.GRPCServer.MaxConcurrentStreams, 0)),
+	})
+	apihttp.RegisterMetricsCollector(apigrpc.MetricsCollectorName, server.Metrics().WritePrometheus)
+	return &GRPCServer{addr: config.FormatGRPCAddress(), server: server}
+}
+
+// Start 启动gRPC服务器（阻塞，Shutdown 后返回nil）
+func (s *GRPCServer) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	logger.Infof("gRPC服务器启动在 %s", s.addr)
+	return s.server.Serve(ln)
+}
+
+// Shutdown 停止接收新调用并等待进行中的调用完成，超时后强制关闭事件订阅流
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
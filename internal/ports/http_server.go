@@ -1,26 +1,86 @@
 package ports
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
 	_ "github.com/bujia-iot/iot-zinx/docs" // Swagger文档
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/internal/router"
 	"github.com/gin-gonic/gin"
 )
 
-// StartHTTPServer 启动HTTP API服务器
-func StartHTTPServer() error {
+// HTTPServer 封装HTTP API服务器（支持优雅关闭）；启用gRPC接口时同时承载gRPC服务器
+type HTTPServer struct {
+	server *http.Server
+	grpc   *GRPCServer
+}
+
+// NewHTTPServer 创建HTTP API服务器
+func NewHTTPServer() *HTTPServer {
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
 	// 创建Gin引擎
 	r := gin.Default()
 
+	// 链路追踪：接收或生成 X-Request-ID，贯穿命令下发与设备应答
+	r.Use(apihttp.CorrelationIDMiddleware())
+	// 多实例部署：响应头标注处理请求的实例
+	r.Use(apihttp.InstanceMiddleware())
+	// 预发环境响应塑形：注入的错误不执行处理器，因此位于变更记录之前
+	r.Use(apihttp.ResponseShapingMiddleware())
+	// 运维变更记录：记录所有变更类API调用
+	r.Use(apihttp.ChangeLogMiddleware())
+
 	// 🚀 新架构：注册基于DeviceGateway的API路由
 	router.RegisterUnifiedAPIHandlers(r)
 
-	// 启动HTTP服务器
-	addr := config.FormatHTTPAddress()
-	logger.Infof("HTTP API服务器启动在 %s", addr)
-	return r.Run(addr)
+	s := &HTTPServer{server: &http.Server{Addr: config.FormatHTTPAddress(), Handler: r}}
+	// gRPC接口（默认关闭）：复用同一路由引擎
+	if config.GetConfig().GRPCServer.Enabled {
+		s.grpc = NewGRPCServer(r)
+	}
+	return s
+}
+
+// Start 启动HTTP API服务器（阻塞，Shutdown 后返回nil）
+func (s *HTTPServer) Start() error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	logger.Infof("HTTP API服务器启动在 %s", s.server.Addr)
+	if s.grpc != nil {
+		go func() {
+			if err := s.grpc.Start(); err != nil {
+				logger.Errorf("gRPC服务器启动失败: %v", err)
+			}
+		}()
+	}
+	lifecycle.GetReadiness().MarkStarted(lifecycle.ComponentHTTP)
+	if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 停止接收新请求并等待进行中的请求完成（gRPC服务器一并停止）
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	if s.grpc != nil {
+		if err := s.grpc.Shutdown(ctx); err != nil {
+			logger.Warnf("gRPC服务器停止超时，已强制关闭: %v", err)
+		}
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// StartHTTPServer 启动HTTP API服务器
+func StartHTTPServer() error {
+	return NewHTTPServer().Start()
 }
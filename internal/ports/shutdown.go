@@ -0,0 +1,144 @@
+package ports
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+)
+
+const (
+	defaultCommandDrainTimeout = 15 * time.Second
+	defaultDrainGracePeriod    = 10 * time.Second
+	defaultHTTPShutdownTimeout = 10 * time.Second
+	commandDrainPollInterval   = 200 * time.Millisecond
+	connectionCloseAllowance   = 5 * time.Second // 宽限期之外留给停机通知与关闭连接的时间
+)
+
+// 停机阶段名称
+const (
+	ShutdownPhaseMarkUnready      = "mark_unready"
+	ShutdownPhaseLBDrain          = "lb_drain"
+	ShutdownPhaseStopTCPAccept    = "stop_tcp_accept"
+	ShutdownPhaseDrainConnections = "drain_connections"
+	ShutdownPhaseStopHTTP         = "stop_http"
+	ShutdownPhaseCloseTCP         = "close_tcp"
+)
+
+// GracefulShutdown 按序协调HTTP与TCP停机，避免LB仍在转发API请求时TCP侧已关闭：
+// 标记未就绪 → 等待LB摘流 → 拒绝新TCP连接（已有连接与HTTP继续服务）→ 排空设备连接（拒绝新注册、通知设备、
+// 宽限期内等待命令应答后关闭连接）→ 停止HTTP → 关闭TCP监听
+// 各入口程序共用此流程
+func GracefulShutdown(reason string, httpServer *HTTPServer, tcpServer *TCPServer) lifecycle.ShutdownSummary {
+	return lifecycle.RunPhases(reason, ShutdownPhases(config.GetConfig().Shutdown, httpServer, tcpServer))
+}
+
+// ShutdownPhases 构造停机阶段序列（httpServer/tcpServer 为nil时对应阶段为空操作）
+func ShutdownPhases(cfg config.ShutdownConfig, httpServer *HTTPServer, tcpServer *TCPServer) []lifecycle.Phase {
+	drainTimeout := time.Duration(cfg.CommandDrainTimeoutSeconds) * time.Second
+	if drainTimeout <= 0 {
+		drainTimeout = defaultCommandDrainTimeout
+	}
+	grace := time.Duration(cfg.GracePeriodSeconds) * time.Second
+	if grace <= 0 {
+		grace = defaultDrainGracePeriod
+	}
+	httpTimeout := time.Duration(cfg.HTTPShutdownTimeoutSeconds) * time.Second
+	if httpTimeout <= 0 {
+		httpTimeout = defaultHTTPShutdownTimeout
+	}
+	lbDelay := time.Duration(cfg.LBDrainDelaySeconds) * time.Second
+
+	return []lifecycle.Phase{
+		{Name: ShutdownPhaseMarkUnready, Run: func(context.Context) error {
+			lifecycle.GetReadiness().BeginDrain()
+			return nil
+		}},
+		{Name: ShutdownPhaseLBDrain, Run: func(ctx context.Context) error {
+			return lifecycle.Wait(ctx, lbDelay)
+		}},
+		{Name: ShutdownPhaseStopTCPAccept, Run: func(ctx context.Context) error {
+			if tcpServer == nil {
+				return nil
+			}
+			return tcpServer.StopAccepting(ctx)
+		}},
+		{Name: ShutdownPhaseDrainConnections, Timeout: drainTimeout + connectionCloseAllowance, Run: func(ctx context.Context) error {
+			if tcpServer == nil {
+				return drainCommands(ctx)
+			}
+			return drainConnections(ctx, cfg, grace)
+		}},
+		{Name: ShutdownPhaseStopHTTP, Timeout: httpTimeout, Run: func(ctx context.Context) error {
+			if httpServer == nil {
+				return nil
+			}
+			return httpServer.Shutdown(ctx)
+		}},
+		{Name: ShutdownPhaseCloseTCP, Run: func(ctx context.Context) error {
+			if tcpServer == nil {
+				return nil
+			}
+			return tcpServer.Close(ctx)
+		}},
+	}
+}
+
+// drainConnections 排空TCP管理器中的设备连接：宽限期结束时仍未应答的命令数作为阶段错误记入停机汇总
+func drainConnections(ctx context.Context, cfg config.ShutdownConfig, grace time.Duration) error {
+	result := core.GetGlobalTCPManager().Drain(ctx, core.DrainOptions{
+		GracePeriod: grace,
+		Pending:     network.GetCommandManager().PendingCount,
+		Notify:      drainNotifier(cfg),
+	})
+	if result.PendingAtClose > 0 {
+		return fmt.Errorf("宽限期结束仍有 %d 条命令未应答，已关闭 %d 个连接", result.PendingAtClose, result.Closed)
+	}
+	return nil
+}
+
+// drainNotifier 按配置构造停机通知（未配置命令、数据域格式错误或设备网关未初始化时不通知）
+func drainNotifier(cfg config.ShutdownConfig) func(ctx context.Context, iccid, deviceID string) error {
+	if cfg.DrainNotifyCommand <= 0 || cfg.DrainNotifyCommand > 0xFF {
+		return nil
+	}
+	payload, err := hex.DecodeString(strings.ReplaceAll(cfg.DrainNotifyData, " ", ""))
+	if err != nil {
+		logger.WithField("error", err.Error()).Warn("停机通知数据域不是有效的十六进制，不发送停机通知")
+		return nil
+	}
+	g := gateway.GetGlobalDeviceGateway()
+	if g == nil {
+		return nil
+	}
+	command := byte(cfg.DrainNotifyCommand)
+	return func(ctx context.Context, _, deviceID string) error {
+		return g.SendUnacknowledged(ctx, "shutdown", deviceID, command, payload)
+	}
+}
+
+// drainCommands 等待已下发命令全部应答或失败，超时返回剩余数量
+func drainCommands(ctx context.Context) error {
+	cmdMgr := network.GetCommandManager()
+	ticker := time.NewTicker(commandDrainPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := cmdMgr.PendingCount()
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("命令排空超时，仍有 %d 条命令未应答", pending)
+		case <-ticker.C:
+		}
+	}
+}
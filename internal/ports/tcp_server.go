@@ -1,18 +1,35 @@
 package ports
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/zconf"
 	"github.com/aceld/zinx/ziface"
 	"github.com/aceld/zinx/znet"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
 	"github.com/bujia-iot/iot-zinx/pkg"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/extension"
+	"github.com/bujia-iot/iot-zinx/pkg/framededup"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
 	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/bujia-iot/iot-zinx/pkg/standby"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 // TCPServer 封装TCP服务器功能
@@ -20,13 +37,21 @@ type TCPServer struct {
 	server           ziface.IServer    // Zinx服务器实例
 	cfg              *config.Config    // 配置文件实例
 	heartbeatManager *HeartbeatManager // HeartbeatManager 心跳管理器实例
+	decoder          ziface.IDecoder   // DNY协议解码器（连接关闭时释放半包缓存）
+
+	accepting atomic.Bool   // 是否接受新连接（停机摘流后拒绝新连接，已有连接继续服务）
+	closed    chan struct{} // Close 后关闭
+	closeOnce sync.Once
 }
 
 // NewTCPServer 创建新的TCP服务器实例
 func NewTCPServer() *TCPServer {
-	return &TCPServer{
-		cfg: config.GetConfig(),
+	s := &TCPServer{
+		cfg:    config.GetConfig(),
+		closed: make(chan struct{}),
 	}
+	s.accepting.Store(true)
+	return s
 }
 
 // StartTCPServer 配置并启动Zinx TCP服务器
@@ -43,7 +68,9 @@ func (s *TCPServer) Start() error {
 	}
 
 	// 启动心跳管理器 - 必须在其他组件之前启动
-	s.startHeartbeatManager()
+	if err := s.startHeartbeatManager(); err != nil {
+		return err
+	}
 
 	// 🚀 启动优先级2和3的定期清理任务
 	s.startMaintenanceTasks()
@@ -57,6 +84,67 @@ func (s *TCPServer) Start() error {
 	// 在启动Zinx服务前对齐TCPManager心跳超时配置，确保API在线判定一致
 	if tm := core.GetGlobalTCPManager(); tm != nil {
 		tm.SetHeartbeatTimeout(time.Duration(s.cfg.DeviceConnection.HeartbeatTimeoutSeconds) * time.Second)
+		for key, seconds := range s.cfg.DeviceConnection.HeartbeatTimeoutByType {
+			deviceType, err := strconv.ParseUint(key, 0, 16)
+			if err != nil {
+				logger.WithFields(logrus.Fields{"deviceType": key, "error": err.Error()}).Warn("心跳超时按类型配置的设备类型无效，已忽略")
+				continue
+			}
+			tm.SetHeartbeatTimeoutForType(uint16(deviceType), time.Duration(seconds)*time.Second)
+		}
+
+		conflictCfg := s.cfg.DeviceConnection.ICCIDConflict
+		tm.SetICCIDConflictConfig(&core.ICCIDConflictConfig{
+			Enabled:    conflictCfg.Enabled,
+			Policy:     conflictCfg.Policy,
+			Window:     time.Duration(conflictCfg.WindowSeconds) * time.Second,
+			IPMatch:    conflictCfg.IPMatch,
+			Retention:  time.Duration(conflictCfg.RetentionMinutes) * time.Minute,
+			MaxRecords: conflictCfg.MaxRecords,
+		})
+
+		sendFailureCfg := s.cfg.DeviceConnection.SendFailure
+		tm.SetSendFailureConfig(&core.SendFailureConfig{
+			Enabled:    sendFailureCfg.Enabled,
+			Threshold:  sendFailureCfg.Threshold,
+			WriteBlock: time.Duration(sendFailureCfg.WriteBlockSeconds) * time.Second,
+		})
+
+		queueCfg := s.cfg.DeviceConnection.CommandQueue
+		tm.SetCommandQueueConfig(&core.CommandQueueConfig{
+			MaxDepth:       queueCfg.MaxDepth,
+			ConfirmTimeout: time.Duration(queueCfg.ConfirmTimeoutSeconds) * time.Second,
+			MaxWait:        time.Duration(queueCfg.MaxWaitSeconds) * time.Second,
+		})
+
+		compactionCfg := s.cfg.DeviceConnection.GroupCompaction
+		tm.SetGroupCompactionConfig(&core.GroupCompactionConfig{
+			Enabled:     compactionCfg.Enabled,
+			Interval:    time.Duration(compactionCfg.IntervalSeconds) * time.Second,
+			MinPeak:     compactionCfg.MinPeak,
+			ShrinkRatio: compactionCfg.ShrinkRatio,
+			MinChurn:    compactionCfg.MinChurn,
+			ChurnRatio:  compactionCfg.ChurnRatio,
+		})
+
+		simCfg := s.cfg.DeviceConnection.SIMPair
+		simPairs := tm.GetSIMPairRegistry()
+		simPairs.SetWindows(time.Duration(simCfg.HistoryWindowSeconds)*time.Second, time.Duration(simCfg.SettleWindowSeconds)*time.Second)
+		processor := &utils.DeviceIDProcessor{}
+		for _, p := range simCfg.Pairs {
+			deviceID, err := processor.SmartConvertDeviceID(p.DeviceID)
+			if err == nil {
+				_, err = simPairs.Declare(core.SIMPair{
+					DeviceID:       deviceID,
+					PrimaryICCID:   p.PrimaryICCID,
+					SecondaryICCID: p.SecondaryICCID,
+					Source:         core.SIMPairSourceConfig,
+				})
+			}
+			if err != nil {
+				logger.WithFields(logrus.Fields{"deviceID": p.DeviceID, "error": err.Error()}).Warn("📶 SIM卡对配置无效，已忽略")
+			}
+		}
 	}
 
 	// � 新架构：DeviceGateway统一管理TCP连接，无需单独的API适配器
@@ -85,7 +173,6 @@ func (s *TCPServer) initialize() error {
 	s.server = znet.NewUserConfServer(zconf.GlobalObject)
 	if s.server == nil {
 		errMsg := "创建Zinx服务器实例失败"
-		fmt.Printf("❌ %s\n", errMsg)
 		logger.Error(errMsg)
 		return fmt.Errorf("%s", errMsg)
 	}
@@ -94,29 +181,151 @@ func (s *TCPServer) initialize() error {
 	dnyDecoder := pkg.Protocol.NewDNYDecoder()
 	if dnyDecoder == nil {
 		errMsg := "创建DNY协议解码器失败"
-		fmt.Printf("❌ %s\n", errMsg)
 		logger.Error(errMsg)
 		return fmt.Errorf("%s", errMsg)
 	}
+	s.configureConformance(dnyDecoder)
+	s.configureGarbagePreamble(dnyDecoder)
+	if err := s.configureChecksum(dnyDecoder); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	if err := s.configureDialect(dnyDecoder); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	if dny, ok := dnyDecoder.(*protocol.DNY_Decoder); ok {
+		dny.SetFrameObserver(func(conn ziface.IConnection, at time.Time) {
+			network.GetReadDeadlineTracker().OnFrame(conn, at)
+		})
+		dny.SetNegativeAckHandler(func(_ ziface.IConnection, msg *dny_protocol.Message) bool {
+			return network.GetCommandManager().HandleNegativeAck(msg)
+		})
+		dny.SetResponseObserver(func(_ ziface.IConnection, msg *dny_protocol.Message) {
+			network.GetCommandResponseTracker().Deliver(msg)
+		})
+	}
 	s.server.SetDecoder(dnyDecoder)
+	s.decoder = dnyDecoder
 
 	return nil
 }
 
+// configureConformance 按监听器配置启用协议一致性严格模式（默认宽松，行为不变）
+func (s *TCPServer) configureConformance(decoder ziface.IDecoder) {
+	mode := s.cfg.Conformance.EffectiveMode(s.cfg.TCPServer.Conformance)
+	if mode != config.ConformanceModeStrict {
+		return
+	}
+	dny, ok := decoder.(*protocol.DNY_Decoder)
+	if !ok {
+		logger.Warn("⚠️ 解码器不支持一致性检查，严格模式未生效")
+		return
+	}
+	checker := protocol.InitGlobalConformanceChecker(protocol.ConformanceOptions{
+		MessageIDWindow: time.Duration(s.cfg.Conformance.MessageIDWindowSeconds) * time.Second,
+		MaxViolations:   s.cfg.Conformance.MaxViolations,
+	})
+	dny.SetConformance(checker)
+	logger.WithFields(logrus.Fields{
+		"port":  s.cfg.TCPServer.Port,
+		"rules": len(checker.Rules()),
+	}).Warn("🛡️ 协议一致性严格模式已启用：违规帧将被NAK或丢弃")
+}
+
+// configureDialect 按监听器配置固定协议方言（未配置时按注册帧特征识别）
+func (s *TCPServer) configureDialect(decoder ziface.IDecoder) error {
+	name, err := dialect.Parse(s.cfg.TCPServer.Dialect)
+	if err != nil {
+		return fmt.Errorf("tcpServer.dialect 配置无效: %w", err)
+	}
+	dny, ok := decoder.(*protocol.DNY_Decoder)
+	if !ok || name == "" {
+		return nil
+	}
+	dny.SetListenerDialect(name)
+	logger.WithFields(logrus.Fields{
+		"port":    s.cfg.TCPServer.Port,
+		"dialect": name,
+	}).Info("监听器已固定协议方言")
+	return nil
+}
+
+// configureChecksum 按命令分类设置上行帧校验和模式
+func (s *TCPServer) configureChecksum(decoder ziface.IDecoder) error {
+	verifier, err := protocol.InitGlobalChecksumVerifier(protocol.ChecksumPolicy{
+		Mode:    s.cfg.Checksum.Mode,
+		Classes: s.cfg.Checksum.Classes,
+	})
+	if err != nil {
+		return fmt.Errorf("checksum 配置无效: %w", err)
+	}
+	if dny, ok := decoder.(*protocol.DNY_Decoder); ok {
+		dny.SetChecksumVerifier(verifier)
+	}
+	policy := verifier.Policy()
+	logger.WithFields(logrus.Fields{
+		"port":    s.cfg.TCPServer.Port,
+		"mode":    policy.Mode,
+		"classes": policy.Classes,
+	}).Info("上行帧校验和模式已配置")
+	return nil
+}
+
+// configureGarbagePreamble 按配置设置前导杂散数据预算
+func (s *TCPServer) configureGarbagePreamble(decoder ziface.IDecoder) {
+	dny, ok := decoder.(*protocol.DNY_Decoder)
+	if !ok {
+		return
+	}
+	dny.SetGarbageTracker(protocol.InitGlobalGarbageTracker(protocol.GarbageOptions{
+		BudgetBytes: s.cfg.GarbagePreamble.BudgetBytes,
+		HistorySize: s.cfg.GarbagePreamble.HistorySize,
+	}))
+}
+
 // registerRoutes 注册路由
 func (s *TCPServer) registerRoutes() {
 	handlers.RegisterRouters(s.server)
+	apihttp.RegisterMetricsCollector(handlerguard.MetricsCollectorName, func(w io.Writer) {
+		handlerguard.GetGlobalGuard().WritePrometheus(w)
+	})
+	apihttp.RegisterMetricsCollector(framededup.MetricsCollectorName, func(w io.Writer) {
+		if d := framededup.GetGlobalDeduper(); d != nil {
+			d.WritePrometheus(w)
+		}
+	})
+	apihttp.RegisterMetricsCollector(extension.MetricsCollectorName, func(w io.Writer) {
+		extension.GetGlobalRegistry().WritePrometheus(w)
+	})
+	apihttp.RegisterMetricsCollector(protocol.ChecksumMetricsCollectorName, func(w io.Writer) {
+		protocol.GetGlobalChecksumVerifier().WritePrometheus(w)
+	})
+	apihttp.RegisterMetricsCollector(settlement.RejectMetricsCollectorName, settlement.WriteRejectsPrometheus)
+	apihttp.RegisterMetricsCollector(standby.MetricsCollectorName, func(w io.Writer) {
+		if c := standby.GetGlobalController(); c != nil {
+			c.WritePrometheus(w)
+		}
+	})
 }
 
 // setupConnectionHooks 设置连接钩子
 func (s *TCPServer) setupConnectionHooks() {
 	// 简化：直接设置连接回调
 	s.server.SetOnConnStart(func(conn ziface.IConnection) {
+		// 停机摘流期间拒绝新连接，设备将重连到其他实例
+		if !s.accepting.Load() {
+			logger.Infof("停机摘流中，拒绝新TCP连接: connID=%d remote=%s", conn.GetConnID(), conn.RemoteAddrString())
+			conn.Stop()
+			return
+		}
 		// 连接建立时的处理
 		tcpManager := core.GetGlobalTCPManager()
 		if tcpManager != nil {
 			tcpManager.RegisterConnection(conn)
 		}
+		// 未注册阶段使用短而固定的读超时
+		network.GetReadDeadlineTracker().OnConnect(conn, time.Now())
 	})
 
 	s.server.SetOnConnStop(func(conn ziface.IConnection) {
@@ -125,11 +334,19 @@ func (s *TCPServer) setupConnectionHooks() {
 		if tcpManager != nil {
 			tcpManager.UnregisterConnection(conn.GetConnID())
 		}
+		network.GetReadDeadlineTracker().Forget(conn.GetConnID())
+		if d := framededup.GetGlobalDeduper(); d != nil {
+			d.Forget(conn.GetConnID())
+		}
+		// 释放解码器缓存的半包
+		if releaser, ok := s.decoder.(interface{ ReleaseConnection(connID uint64) }); ok {
+			releaser.ReleaseConnection(conn.GetConnID())
+		}
 	})
 }
 
-// startHeartbeatManager 启动心跳管理器
-func (s *TCPServer) startHeartbeatManager() {
+// startHeartbeatManager 启动心跳管理器（失败时返回错误，由入口程序决定退出）
+func (s *TCPServer) startHeartbeatManager() error {
 	// 从配置中获取心跳间隔时间
 	heartbeatInterval := time.Duration(s.cfg.DeviceConnection.HeartbeatIntervalSeconds) * time.Second
 	heartbeatTimeout := time.Duration(s.cfg.DeviceConnection.HeartbeatTimeoutSeconds) * time.Second
@@ -141,22 +358,22 @@ func (s *TCPServer) startHeartbeatManager() {
 
 	// 验证心跳管理器初始化
 	if !s.heartbeatManager.IsInitialized() {
-		logger.Fatal("❌ 心跳管理器初始化失败，服务器无法启动")
-		return
+		logger.Error("❌ 心跳管理器初始化失败，服务器无法启动")
+		return fmt.Errorf("心跳管理器初始化失败")
 	}
 
 	logger.Info("✅ 心跳管理器实例创建成功")
 
 	// 安全设置全局活动更新器
 	if err := network.SetGlobalActivityUpdater(s.heartbeatManager); err != nil {
-		logger.Fatal("❌ GlobalActivityUpdater设置失败")
-		return
+		logger.Error("❌ GlobalActivityUpdater设置失败")
+		return fmt.Errorf("GlobalActivityUpdater设置失败: %w", err)
 	}
 
 	// 验证全局设置是否成功
 	if !network.IsGlobalActivityUpdaterSet() {
-		logger.Fatal("❌ GlobalActivityUpdater验证失败，服务器无法启动")
-		return
+		logger.Error("❌ GlobalActivityUpdater验证失败，服务器无法启动")
+		return fmt.Errorf("GlobalActivityUpdater验证失败")
 	}
 
 	logger.Info("✅ GlobalActivityUpdater设置成功")
@@ -166,6 +383,7 @@ func (s *TCPServer) startHeartbeatManager() {
 
 	// 调用诊断函数验证全局状态
 	network.DiagnoseGlobalActivityUpdater()
+	return nil
 }
 
 // startMaintenanceTasks 启动维护任务（优先级2和3的定期清理）
@@ -208,7 +426,6 @@ func (s *TCPServer) startServer() error {
 	defer func() {
 		if r := recover(); r != nil {
 			errMsg := fmt.Sprintf("TCP服务器启动过程中发生panic: %v", r)
-			fmt.Printf("❌ %s\n", errMsg)
 			logger.Error(errMsg)
 		}
 	}()
@@ -231,12 +448,40 @@ func (s *TCPServer) startServer() error {
 	select {
 	case err := <-startChan:
 		errMsg := fmt.Sprintf("TCP服务器启动失败: %v", err)
-		fmt.Printf("❌ %s\n", errMsg)
 		logger.Error(errMsg)
 		return err
 	case <-time.After(2 * time.Second):
 		// 2秒后如果没有错误，认为启动成功
 		logger.Info("TCP服务器启动成功")
-		select {} // 永远阻塞
+		lifecycle.GetReadiness().MarkStarted(lifecycle.ComponentTCP)
+		<-s.closed
+		return nil
 	}
 }
+
+// StopAccepting 停止接受新连接，已建立的连接继续服务
+func (s *TCPServer) StopAccepting(_ context.Context) error {
+	s.accepting.Store(false)
+	return nil
+}
+
+// ResumeAccepting 恢复接受新连接（热备接管激活、接管演练结束或中止时）
+func (s *TCPServer) ResumeAccepting() {
+	s.accepting.Store(true)
+}
+
+// Accepting 是否接受新连接
+func (s *TCPServer) Accepting() bool {
+	return s.accepting.Load()
+}
+
+// Close 关闭所有连接并停止监听
+func (s *TCPServer) Close(_ context.Context) error {
+	s.closeOnce.Do(func() {
+		if s.server != nil {
+			s.server.Stop()
+		}
+		close(s.closed)
+	})
+	return nil
+}
@@ -2,6 +2,7 @@ package router
 
 import (
 	"github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -13,9 +14,34 @@ func RegisterUnifiedAPIHandlers(r *gin.Engine) {
 	deviceHandlers := http.NewDeviceHandlers()
 	chargingHandlers := http.NewChargingHandlers()
 	notificationHandlers := http.NewNotificationHandlers()
+	adminHandlers := http.NewAdminHandlers()
+	auditHandlers := http.NewAuditHandlers()
+	reconcileHandlers := http.NewReconcileHandlers()
+	settlementHandlers := http.NewSettlementHandlers()
+	fleetAlertHandlers := http.NewFleetAlertHandlers()
+	slaHandlers := http.NewSLAHandlers()
+	chargeStatsHandlers := http.NewChargeStatsHandlers()
+	hookHandlers := http.NewHookHandlers(chargingHandlers, deviceHandlers)
+	toolHandlers := http.NewToolHandlers()
+	configTemplateHandlers := http.NewConfigTemplateHandlers()
+	stationHandlers := http.NewStationHandlers()
+	energyHandlers := http.NewEnergyHandlers()
+	commLogHandlers := http.NewCommLogHandlers()
+	anomalyHandlers := http.NewAnomalyHandlers()
+	deviceGroupHandlers := http.NewDeviceGroupHandlers()
 
-	// Swagger文档
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// 报表类查询：只读副本模式下改由主实例发布的状态快照应答
+	deviceList, deviceStatus, devicePorts := deviceHandlers.HandleDeviceList, deviceHandlers.HandleDeviceStatus, deviceHandlers.HandleDevicePorts
+	portAvailability, systemStats := energyHandlers.HandlePortAvailability, http.NewDeviceGatewayHandlers().HandleSystemStats
+	reader := replica.GetGlobalReader()
+	if reader != nil {
+		replicaHandlers := http.NewReplicaHandlers(reader)
+		deviceList, deviceStatus, devicePorts = replicaHandlers.HandleDeviceList, replicaHandlers.HandleDeviceStatus, replicaHandlers.HandleDevicePorts
+		portAvailability, systemStats = replicaHandlers.HandlePortAvailability, replicaHandlers.HandleSystemStats
+	}
+
+	// Swagger文档（UI加载 /api/v1/openapi.json）
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/api/v1/openapi.json")))
 
 	// 内置静态测试页
 	r.Static("/web", "./web")
@@ -23,22 +49,100 @@ func RegisterUnifiedAPIHandlers(r *gin.Engine) {
 		c.File("web/index.html")
 	})
 
+	// 就绪检查（负载均衡探测，停机时先于服务关闭返回503）
+	r.GET("/readyz", http.NewDeviceGatewayHandlers().HandleReadyz)
+
+	// Prometheus 指标（按站点聚合）
+	r.GET("/metrics", stationHandlers.HandleMetrics)
+
 	// API路由组 v1版本
 	api := r.Group("/api/v1")
+	if reader != nil {
+		// 只读副本：写操作返回503并指向主实例
+		api.Use(http.ReplicaReadOnlyMiddleware(reader))
+	}
 	{
 		// 🚀 设备相关API
-		api.GET("/devices", deviceHandlers.HandleDeviceList)
-		api.GET("/device/:deviceId/status", deviceHandlers.HandleDeviceStatus)
+		api.GET("/devices", deviceList)
+		api.GET("/devices/archived", deviceHandlers.HandleArchivedDevices)
+		api.GET("/devices/archived/:deviceId", deviceHandlers.HandleArchivedDevice)
+		api.GET("/device/:deviceId/status", deviceStatus)
+		api.GET("/device/:deviceId/ports", devicePorts)
+		api.GET("/device/:deviceId/ports/:port/energy", energyHandlers.HandlePortEnergy)
+		api.GET("/device/:deviceId/ports/:port/availability", portAvailability)
+		api.GET("/device/:deviceId/comm-log/export", commLogHandlers.HandleExportCommLog)
+		api.GET("/device/:deviceId/anomalies", anomalyHandlers.HandleDeviceAnomalies)
+		api.GET("/device/:deviceId/owner", deviceHandlers.HandleDeviceOwner)
+		api.PUT("/device/:deviceId/session-limit", chargingHandlers.HandleSetSessionLimit)
+		api.DELETE("/device/:deviceId/session-limit", chargingHandlers.HandleDeleteSessionLimit)
 		api.POST("/device/locate", deviceHandlers.HandleDeviceLocate)
+		api.POST("/command/dny", deviceHandlers.HandleSendDNYCommand)
+		api.GET("/search", deviceHandlers.HandleDeviceSearch)
+		api.POST("/device/:deviceId/reboot", deviceHandlers.HandleDeviceReboot)
+		api.GET("/device/:deviceId/reboots", deviceHandlers.HandleDeviceReboots)
+		api.POST("/device/:deviceId/decommission", deviceHandlers.HandleDeviceDecommission)
+		api.POST("/device/:deviceId/recommission", deviceHandlers.HandleDeviceRecommission)
+		api.GET("/device/:deviceId/timeline", deviceHandlers.HandleDeviceTimeline)
+		api.POST("/device/:deviceId/virtual-split", deviceHandlers.HandleVirtualSplit)
+		api.GET("/device/:deviceId/virtual-split", deviceHandlers.HandleGetVirtualSplit)
+		api.DELETE("/device/:deviceId/virtual-split", deviceHandlers.HandleDeleteVirtualSplit)
+		api.POST("/device/:deviceId/sim-pair", deviceHandlers.HandleSetSIMPair)
+		api.GET("/device/:deviceId/sim-pair", deviceHandlers.HandleGetSIMPair)
+		api.DELETE("/device/:deviceId/sim-pair", deviceHandlers.HandleDeleteSIMPair)
+		api.GET("/device/:deviceId/config", deviceHandlers.HandleDeviceConfig)
+		api.GET("/device/:deviceId/parameters", deviceHandlers.HandleDeviceParameters)
+		api.POST("/device/:deviceId/config/verify", deviceHandlers.HandleVerifyDeviceConfig)
+		api.GET("/device/:deviceId/deferred", deviceHandlers.HandleDeviceDeferred)
+		api.DELETE("/device/:deviceId/deferred/:commandId", deviceHandlers.HandleCancelDeferred)
+		api.GET("/device/:deviceId/macros", deviceHandlers.HandleListMacros)
+		api.POST("/device/:deviceId/macros/:name", deviceHandlers.HandleRunMacro)
+		api.GET("/device/:deviceId/macros/executions/:executionId", deviceHandlers.HandleMacroExecution)
+		api.POST("/device-groups/:iccid/broadcasts", deviceHandlers.HandleGroupBroadcast)
+		api.GET("/device-groups/:iccid/broadcasts/:id", deviceHandlers.HandleGroupBroadcastStatus)
+		api.GET("/groups", deviceGroupHandlers.HandleDeviceGroups)
+		api.GET("/group/:iccid", deviceGroupHandlers.HandleDeviceGroup)
+
+		// 🚀 站点聚合API
+		api.GET("/stations", stationHandlers.HandleListStations)
+		api.GET("/stations/:stationId", stationHandlers.HandleStationDetail)
+		api.GET("/stations/:stationId/availability", stationHandlers.HandleStationAvailability)
+		api.GET("/stations/:stationId/power-profile", stationHandlers.HandleStationPowerProfile)
+		api.PUT("/stations/:stationId/power-profile", stationHandlers.HandleSetStationPowerProfile)
+		api.DELETE("/stations/:stationId/power-profile", stationHandlers.HandleDeleteStationPowerProfile)
+		api.PUT("/stations/:stationId/power-override", stationHandlers.HandleSetStationPowerOverride)
+		api.DELETE("/stations/:stationId/power-override", stationHandlers.HandleDeleteStationPowerOverride)
+
+		// 🚀 端口累计电量API（维护按电量安排线缆更换）
+		api.GET("/energy/ports", energyHandlers.HandleEnergyReport)
+
+		// 🚀 心跳数据异常检测API（硬件故障前兆）
+		api.GET("/anomalies", anomalyHandlers.HandleFleetAnomalies)
+
+		// 🚀 黄金配置模板API
+		api.GET("/config-templates", configTemplateHandlers.HandleListConfigTemplates)
+		api.POST("/config-templates", configTemplateHandlers.HandleCreateConfigTemplate)
+		api.GET("/config-templates/:name", configTemplateHandlers.HandleGetConfigTemplate)
+		api.GET("/config-templates/:name/versions", configTemplateHandlers.HandleConfigTemplateVersions)
+		api.PUT("/config-templates/:name", configTemplateHandlers.HandleUpdateConfigTemplate)
+		api.DELETE("/config-templates/:name", configTemplateHandlers.HandleDeleteConfigTemplate)
 
 		// 🚀 充电控制API
-		api.POST("/charging/start", chargingHandlers.HandleStartCharging)
-		api.POST("/charging/stop", chargingHandlers.HandleStopCharging)
-		api.POST("/charging/update_power", chargingHandlers.HandleUpdateChargingPower)
+		// 携带 Idempotency-Key 时同一键的重试重放首个应答
+		idempotencyKey := http.IdempotencyKeyMiddleware()
+		api.POST("/charging/start", idempotencyKey, chargingHandlers.HandleStartCharging)
+		api.POST("/charging/stop", idempotencyKey, chargingHandlers.HandleStopCharging)
+		api.POST("/charging/update_power", idempotencyKey, chargingHandlers.HandleUpdateChargingPower)
+		api.GET("/charging/queue", chargingHandlers.HandleChargeQueue)
+		api.GET("/charging/sessions", chargingHandlers.HandleChargingSessions)
+		api.GET("/charging/sessions/:orderNo", chargingHandlers.HandleChargingSession)
+		api.GET("/charging/session-limits", chargingHandlers.HandleSessionLimits)
+		api.GET("/policies/charging", chargingHandlers.HandleChargingPolicy)
 
 		// 🚀 系统监控API（保留在原处理器以复用实现）
 		api.GET("/health", http.NewDeviceGatewayHandlers().HandleHealthCheck)
-		api.GET("/stats", http.NewDeviceGatewayHandlers().HandleSystemStats)
+		api.GET("/stats", systemStats)
+		api.GET("/stats/charging", chargeStatsHandlers.HandleChargingStats)
+		api.GET("/summary", http.NewDeviceGatewayHandlers().HandleFleetSummary)
 
 		// 🚀 设备查询API
 		api.GET("/device/:deviceId/query", deviceHandlers.HandleQueryDeviceStatus)
@@ -46,5 +150,78 @@ func RegisterUnifiedAPIHandlers(r *gin.Engine) {
 		// 🚀 通知事件接口
 		api.GET("/notifications/stream", notificationHandlers.HandleNotificationStream)
 		api.GET("/notifications/recent", notificationHandlers.HandleNotificationRecent)
+
+		// 🚀 运维管理API
+		api.GET("/admin/iccid-conflicts", adminHandlers.HandleICCIDConflicts)
+		api.GET("/admin/registration-backfill", adminHandlers.HandleRegistrationBackfill)
+		api.GET("/admin/frame-journal", adminHandlers.HandleFrameJournal)
+		api.GET("/admin/conformance-violations", adminHandlers.HandleConformanceViolations)
+		api.GET("/admin/event-bus", adminHandlers.HandleEventBusStats)
+		api.GET("/admin/garbage-data", adminHandlers.HandleGarbageData)
+		api.GET("/admin/handler-panics", adminHandlers.HandleHandlerPanics)
+		api.GET("/admin/custom-routers", adminHandlers.HandleCustomRouters)
+		api.GET("/admin/takeover", adminHandlers.HandleTakeoverStatus)
+		api.POST("/admin/takeover", adminHandlers.HandleBeginTakeover)
+		api.POST("/admin/takeover/abort", adminHandlers.HandleAbortTakeover)
+		api.POST("/admin/index-check", adminHandlers.HandleIndexCheck)
+		api.GET("/admin/index-check/last", adminHandlers.HandleLastIndexCheck)
+		api.GET("/admin/group-compaction", adminHandlers.HandleGroupCompaction)
+		api.POST("/admin/group-compaction", adminHandlers.HandleRunGroupCompaction)
+		api.POST("/admin/state-dump", adminHandlers.HandleStateDump)
+		api.GET("/admin/self-test", adminHandlers.HandleSelfTest)
+		api.POST("/admin/self-test", adminHandlers.HandleRunSelfTest)
+		api.GET("/admin/capabilities", adminHandlers.HandleCapabilities)
+		api.POST("/admin/capabilities/reload", adminHandlers.HandleReloadCapabilities)
+		api.PUT("/admin/capabilities/overrides/:deviceId", adminHandlers.HandleSetCapabilityOverride)
+		api.DELETE("/admin/capabilities/overrides/:deviceId", adminHandlers.HandleDeleteCapabilityOverride)
+		api.GET("/admin/low-data", adminHandlers.HandleLowData)
+		api.POST("/admin/low-data/reload", adminHandlers.HandleReloadLowData)
+		api.GET("/traffic/report", adminHandlers.HandleTrafficReport)
+		api.GET("/admin/dialects", adminHandlers.HandleDialects)
+		api.PUT("/admin/dialects/connections/:connId", adminHandlers.HandleSetConnectionDialect)
+		api.GET("/admin/payload-crypto", adminHandlers.HandlePayloadCrypto)
+		api.GET("/admin/replay-plan", adminHandlers.HandleReplayPlan)
+		api.POST("/admin/replay-plan/approve", adminHandlers.HandleApproveReplay)
+		api.POST("/admin/replay-plan/:category/pause", adminHandlers.HandlePauseReplay)
+		api.POST("/admin/replay-plan/:category/resume", adminHandlers.HandleResumeReplay)
+		api.GET("/admin/heartbeat-tuning", adminHandlers.HandleHeartbeatTuning)
+		api.POST("/admin/heartbeat-tuning", adminHandlers.HandleUpdateHeartbeatTuning)
+		api.POST("/admin/notification-routes/dry-run", adminHandlers.HandleNotificationRouteDryRun)
+		api.GET("/admin/changelog", adminHandlers.HandleChangeLog)
+		api.GET("/admin/session-archive", adminHandlers.HandleSessionArchive)
+		api.GET("/admin/trace-sampling", adminHandlers.HandleTraceSampling)
+		api.POST("/admin/trace-sampling", adminHandlers.HandleUpdateTraceSampling)
+		api.GET("/admin/response-shaping", adminHandlers.HandleResponseShaping)
+		api.POST("/admin/response-shaping", adminHandlers.HandleCreateShapingRule)
+		api.DELETE("/admin/response-shaping", adminHandlers.HandleClearShapingRules)
+		api.DELETE("/admin/response-shaping/:ruleId", adminHandlers.HandleDeleteShapingRule)
+		api.POST("/admin/reconcile", reconcileHandlers.HandleRunReconcile)
+		api.GET("/admin/reconcile/reports", reconcileHandlers.HandleListReconcileReports)
+		api.GET("/admin/reconcile/reports/:date", reconcileHandlers.HandleReconcileReport)
+		api.GET("/admin/fleet-alerts", fleetAlertHandlers.HandleFleetAlerts)
+
+		// 租户命令成功率SLA
+		api.GET("/tenants/:tenant/sla", slaHandlers.HandleTenantSLA)
+
+		// 结算查询（结算日志存储）
+		api.GET("/settlements", settlementHandlers.HandleListSettlements)
+		api.GET("/settlements/:orderNo", settlementHandlers.HandleGetSettlement)
+
+		// 🚀 合规审计API
+		api.GET("/audits", auditHandlers.HandleListAudits)
+		api.POST("/audits", auditHandlers.HandleCreateAudit)
+		api.POST("/audits/:id/run", auditHandlers.HandleRunAudit)
+		api.GET("/audits/:id/report", auditHandlers.HandleAuditReport)
+
+		// 🚀 入站webhook（第三方平台推送命令）
+		api.POST("/hooks/commands", hookHandlers.HandleHookCommand)
+
+		// 🚀 协议工具API
+		api.POST("/tools/parse-frame", toolHandlers.HandleParseFrame)
+		api.GET("/protocol/commands", toolHandlers.HandleProtocolCommands)
+		api.GET("/protocol/enums", toolHandlers.HandleProtocolEnums)
+
+		// 🚀 API规范（由处理器注解生成）
+		api.GET("/openapi.json", toolHandlers.HandleOpenAPISpec)
 	}
 }
@@ -11,9 +11,20 @@
 // @license.name MIT
 // @license.url https://opensource.org/licenses/MIT
 
-// @host localhost:8080
 // @BasePath /
 
+// @securityDefinitions.apikey ApiKeyName
+// @in header
+// @name X-API-Key-Name
+// @description 调用方API Key名称，由网关前置鉴权层校验凭证后设置（请求头名称可通过 changeLog.keyHeader 配置），用于变更记录与响应整形规则匹配
+
+// @securityDefinitions.apikey HookSignature
+// @in header
+// @name X-Hook-Signature
+// @description 入站webhook签名：hex(HMAC-SHA256(secret, 时间戳.nonce.请求体))，需同时携带 X-Hook-Source、X-Hook-Timestamp、X-Hook-Nonce
+
+// @security ApiKeyName
+
 // @tag.name device "设备管理"
 // @tag.description "设备状态查询和管理相关接口"
 
@@ -24,7 +35,22 @@
 // @tag.description "充电控制和管理相关接口"
 
 // @tag.name system "系统监控"
-// @tag.description "系统健康检查和监控相关接口"
+// @tag.description "系统健康检查、监控与运维管理相关接口"
+
+// @tag.name station "站点聚合"
+// @tag.description "站点汇总、可用率与指标相关接口"
+
+// @tag.name config-template "配置模板"
+// @tag.description "设备黄金配置模板相关接口"
+
+// @tag.name notification "通知事件"
+// @tag.description "通知事件推送与查询相关接口"
+
+// @tag.name hooks "入站webhook"
+// @tag.description "第三方平台推送命令，错误以 application/problem+json 返回"
+
+// @tag.name tools "协议工具"
+// @tag.description "DNY帧解析与协议枚举相关接口"
 
 package main
 
@@ -34,162 +60,35 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
-	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/bootstrap"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
-	"github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
-	"github.com/bujia-iot/iot-zinx/internal/ports"
-	"github.com/bujia-iot/iot-zinx/pkg/core"
-	"github.com/bujia-iot/iot-zinx/pkg/gateway"
-	"github.com/bujia-iot/iot-zinx/pkg/notification"
-	"github.com/bujia-iot/iot-zinx/pkg/utils"
 )
 
-var configFile = flag.String("config", "configs/gateway.yaml", "配置文件路径")
-
-const indexCheckInterval = 10 * time.Minute
-
-func startHTTP(improvedLogger *logger.ImprovedLogger) {
-	if err := ports.StartHTTPServer(); err != nil {
-		improvedLogger.Warn("HTTP API服务器启动失败", map[string]interface{}{
-			"error": err.Error(),
-		})
-	}
-}
-
-func startTCP(improvedLogger *logger.ImprovedLogger) {
-	if err := ports.StartTCPServer(); err != nil {
-		improvedLogger.Error("TCP服务器启动失败", map[string]interface{}{
-			"error": err.Error(),
-		})
-		os.Exit(1)
-	}
-}
-
-func startIndexHealthChecker(ctx context.Context, improvedLogger *logger.ImprovedLogger) {
-	tcpManager := core.GetGlobalTCPManager()
-	if tcpManager == nil {
-		return
-	}
-	go func() {
-		ticker := time.NewTicker(indexCheckInterval)
-		defer ticker.Stop()
-		tcpManager.PeriodicIndexHealthCheck()
-		for {
-			select {
-			case <-ctx.Done():
-				improvedLogger.Info("索引健康检查已停止", map[string]interface{}{
-					"component": "index_health_checker",
-				})
-				return
-			case <-ticker.C:
-				tcpManager.PeriodicIndexHealthCheck()
-			}
-		}
-	}()
-}
-
-func loadConfigOrExit() {
-	if err := config.Load(*configFile); err != nil {
-		logger.Error("加载配置文件失败: " + err.Error())
-		os.Exit(1)
-	}
-}
-
-func setupLoggerOrExit() *logger.ImprovedLogger {
-	loggerConfig := config.GetConfig().Logger
-	improvedLogger := logger.NewImprovedLogger()
-	if err := improvedLogger.InitImproved(&loggerConfig); err != nil {
-		logger.Error("初始化日志系统失败: " + err.Error())
-		os.Exit(1)
-	}
-	if loggerConfig.EnableFile {
-		if err := improvedLogger.InitCommunicationLogger(loggerConfig.FileDir); err != nil {
-			improvedLogger.Warn("初始化通信日志失败", map[string]interface{}{
-				"error": err.Error(),
-			})
-		}
-	}
-	return improvedLogger
-}
-
-func initNotification(ctx context.Context, improvedLogger *logger.ImprovedLogger) {
-	if err := notification.InitGlobalNotificationIntegrator(ctx); err != nil {
-		improvedLogger.Error("初始化通知系统失败", map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
-	}
-
-	if notification.GetGlobalNotificationIntegrator().IsEnabled() {
-		portManager := core.GetPortManager()
-		portManager.RegisterStatusChangeCallback(func(deviceID string, portNumber int, oldStatus, newStatus string, data map[string]interface{}) {
-			notification.GetGlobalNotificationIntegrator().NotifyPortStatusChange(deviceID, portNumber, oldStatus, newStatus, data)
-		})
-		improvedLogger.Info("端口状态变化通知已启用", map[string]interface{}{
-			"callback_registered": true,
-		})
-	}
-}
+var (
+	configFile = flag.String("config", "configs/gateway.yaml", "配置文件路径")
+	readOnly   = flag.Bool("read-only", false, "以只读副本模式启动：仅启动HTTP API，数据来自主实例发布到Redis的状态快照")
+)
 
 func main() {
 	// 解析命令行参数
 	flag.Parse()
 
-	loadConfigOrExit()
-	improvedLogger := setupLoggerOrExit()
-
-	// 设置Zinx框架日志
-	utils.SetupImprovedZinxLogger(improvedLogger)
-
-	// 初始化全局DeviceGateway
-	gateway.InitializeGlobalDeviceGateway()
-
-	// 初始化Redis（非致命错误）
-	if err := redis.InitClient(); err != nil {
-		improvedLogger.Warn("Redis连接失败，但不影响核心功能", map[string]interface{}{
-			"error": err.Error(),
-		})
-	}
-
 	// 可取消上下文（系统信号）
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// 初始化通知系统
-	initNotification(ctx, improvedLogger)
-
-	// 初始化智能降功率控制器（按配置开关）
-	gateway.InitDynamicPowerController()
-
-	// 启动HTTP/TCP服务
-	go startHTTP(improvedLogger)
-	go startTCP(improvedLogger)
-
-	// 启动定期索引健康检查（可取消）
-	startIndexHealthChecker(ctx, improvedLogger)
-
-	// 等待中断信号
-	<-ctx.Done()
-	improvedLogger.Info("接收到停止信号，开始关闭...", nil)
-
-	// 停止通知系统
-	if err := notification.StopGlobalNotificationIntegrator(ctx); err != nil {
-		improvedLogger.Error("停止通知系统失败", map[string]interface{}{
-			"error": err.Error(),
-		})
-	} else {
-		improvedLogger.Info("通知系统已停止", map[string]interface{}{
-			"component": "notification",
-			"status":    "stopped",
-		})
+	// 按依赖顺序构造并装配所有组件（配置 → 日志 → 核心 → 通知 → 扩展 → 服务器）
+	app, err := bootstrap.New(ctx, bootstrap.Options{ConfigFile: *configFile, ReadOnly: *readOnly})
+	if err != nil {
+		logger.Error("应用启动失败: " + err.Error())
+		os.Exit(1)
 	}
 
-	// 关闭Redis连接
-	if err := redis.Close(); err != nil {
-		improvedLogger.Error("关闭Redis连接失败", map[string]interface{}{
-			"error": err.Error(),
-		})
+	// 启动HTTP/TCP服务，等待停止信号后执行分阶段停机
+	if err := app.Run(ctx); err != nil {
+		logger.Error(err.Error())
+		stop()
+		os.Exit(1)
 	}
 }
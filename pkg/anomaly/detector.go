@@ -0,0 +1,535 @@
+// Package anomaly 心跳数据异常检测：按设备对心跳上报的温度、电压、信号强度与端口功率维护EWMA均值/方差基线，
+// 持续偏离基线超过阈值（σ）或在窗口内单调变化时开启异常事件，恢复正常后关闭。现场数据表明温度持续攀升、
+// 功率剧烈波动的设备往往在数日内故障，异常事件供运维提前安排检修。
+// 每个样本 O(1) 处理；单设备序列数与事件数有上限，内存固定。
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+)
+
+// 指标
+const (
+	MetricTemperature = "temperature" // 设备温度(℃)
+	MetricVoltage     = "voltage"     // 供电电压(V)
+	MetricSignal      = "signal"      // 信号强度(0-31)
+	MetricPower       = "power"       // 端口充电功率(W)，按端口分别建立基线
+)
+
+// 异常类型与方向
+const (
+	KindDeviation = "deviation" // 持续偏离基线
+	KindTrend     = "trend"     // 窗口内单调变化
+
+	DirectionHigh    = "high"
+	DirectionLow     = "low"
+	DirectionRising  = "rising"
+	DirectionFalling = "falling"
+)
+
+const (
+	defaultAlpha             = 0.1
+	defaultSigmaThreshold    = 3.0
+	defaultSustainSamples    = 3
+	defaultTrendWindow       = 8
+	defaultTrendSigma        = 3.0
+	defaultWarmupSamples     = 10
+	defaultResolveSamples    = 3
+	defaultEpisodesPerDevice = 20
+	defaultMaxDevices        = 20000
+
+	maxPowerPorts = 32 // 功率按端口建立基线的端口上限：单设备最多 3+32 条序列
+)
+
+// minStdDev 各指标标准差下限：基线几乎恒定时（如整数温度长期不变）避免微小波动被放大为数个σ
+var minStdDev = map[string]float64{
+	MetricTemperature: 0.5,
+	MetricVoltage:     1,
+	MetricSignal:      1,
+	MetricPower:       5,
+}
+
+// Options 检测选项
+type Options struct {
+	Alpha             float64 // EWMA 平滑系数 (0,1)，越大基线跟随越快
+	SigmaThreshold    float64 // 偏离基线超过该σ数计为异常样本
+	SustainSamples    int     // 连续异常样本数达到该值开启偏离事件
+	TrendWindow       int     // 连续单调变化的样本数达到该值（且累计变化超过 TrendSigma）开启趋势事件
+	TrendSigma        float64 // 趋势事件要求的累计变化（基线σ数）
+	WarmupSamples     int     // 基线建立所需样本数，期间只学习不检测
+	ResolveSamples    int     // 连续正常样本数达到该值关闭事件
+	EpisodesPerDevice int     // 单设备保留的最近事件数
+	MaxDevices        int     // 跟踪的设备数上限，超出时淘汰最久无样本的设备
+}
+
+// Episode 异常事件
+type Episode struct {
+	ID            string     `json:"id"`
+	DeviceID      string     `json:"deviceId"`
+	Metric        string     `json:"metric"`
+	Port          int        `json:"port,omitempty"` // 功率指标的端口（1-based）
+	Kind          string     `json:"kind"`
+	Direction     string     `json:"direction"`
+	StartedAt     time.Time  `json:"startedAt"`
+	LastSampleAt  time.Time  `json:"lastSampleAt"`
+	BaselineMean  float64    `json:"baselineMean"`   // 开启时的基线均值
+	BaselineStd   float64    `json:"baselineStdDev"` // 开启时的基线标准差（含下限）
+	StartValue    float64    `json:"startValue"`
+	PeakValue     float64    `json:"peakValue"`
+	PeakDeviation float64    `json:"peakDeviation"` // 峰值偏离开启时基线的σ数，即严重度
+	Samples       int        `json:"samples"`       // 事件期间的样本数
+	Resolved      bool       `json:"resolved"`
+	ResolvedAt    *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Baseline 序列基线
+type Baseline struct {
+	Metric   string    `json:"metric"`
+	Port     int       `json:"port,omitempty"`
+	Mean     float64   `json:"mean"`
+	StdDev   float64   `json:"stdDev"`
+	Samples  int64     `json:"samples"`
+	Last     float64   `json:"last"`
+	LastAt   time.Time `json:"lastAt"`
+	WarmedUp bool      `json:"warmedUp"`
+}
+
+// DeviceReport 设备异常情况
+type DeviceReport struct {
+	DeviceID  string     `json:"deviceId"`
+	Severity  float64    `json:"severity"` // 进行中事件的最大峰值偏离，无进行中事件时为0
+	Open      []Episode  `json:"open"`     // 进行中事件
+	Episodes  []Episode  `json:"episodes"` // 最近事件（新→旧，含进行中）
+	Baselines []Baseline `json:"baselines,omitempty"`
+}
+
+// Handler 异常事件开启回调
+type Handler func(Episode)
+
+type seriesKey struct {
+	metric string
+	port   int
+}
+
+// series 单个指标序列：EWMA基线、连续异常计数、单调趋势与进行中事件
+type series struct {
+	mean, variance float64
+	samples        int64
+	last           float64
+	lastAt         time.Time
+
+	outliers int     // 连续偏离样本数
+	trendDir int     // 当前单调方向：1 上升，-1 下降，0 无
+	trendLen int     // 单调变化的样本数
+	trendRef float64 // 单调段起点的值
+
+	normal int      // 事件开启后连续正常样本数
+	open   *Episode // 进行中事件
+}
+
+// device 单设备状态：序列与最近事件环形缓冲
+type device struct {
+	series   map[seriesKey]*series
+	episodes []*Episode
+	next     int
+	count    int
+	lastAt   time.Time
+}
+
+func (d *device) record(ep *Episode) {
+	d.episodes[d.next] = ep
+	d.next = (d.next + 1) % len(d.episodes)
+	if d.count < len(d.episodes) {
+		d.count++
+	}
+}
+
+// Detector 心跳数据异常检测器
+type Detector struct {
+	opts Options
+
+	mu       sync.Mutex
+	devices  map[string]*device
+	seq      uint64
+	handlers []Handler
+}
+
+// NewDetector 创建检测器，非正数选项使用默认值
+func NewDetector(opts Options) *Detector {
+	if opts.Alpha <= 0 || opts.Alpha >= 1 {
+		opts.Alpha = defaultAlpha
+	}
+	if opts.SigmaThreshold <= 0 {
+		opts.SigmaThreshold = defaultSigmaThreshold
+	}
+	if opts.SustainSamples <= 0 {
+		opts.SustainSamples = defaultSustainSamples
+	}
+	if opts.TrendWindow <= 0 {
+		opts.TrendWindow = defaultTrendWindow
+	}
+	if opts.TrendSigma <= 0 {
+		opts.TrendSigma = defaultTrendSigma
+	}
+	if opts.WarmupSamples <= 0 {
+		opts.WarmupSamples = defaultWarmupSamples
+	}
+	if opts.ResolveSamples <= 0 {
+		opts.ResolveSamples = defaultResolveSamples
+	}
+	if opts.EpisodesPerDevice <= 0 {
+		opts.EpisodesPerDevice = defaultEpisodesPerDevice
+	}
+	if opts.MaxDevices <= 0 {
+		opts.MaxDevices = defaultMaxDevices
+	}
+	return &Detector{opts: opts, devices: make(map[string]*device)}
+}
+
+// Options 检测选项（已补全默认值）
+func (d *Detector) Options() Options {
+	return d.opts
+}
+
+// RegisterHandler 注册异常事件开启回调
+func (d *Detector) RegisterHandler(handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, handler)
+}
+
+// HandlerCount 已注册的回调数量
+func (d *Detector) HandlerCount() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.handlers)
+}
+
+// Observe 输入一个样本（port 仅功率指标使用，1-based）；检测器为nil（未启用）、未知指标或端口越界时忽略
+func (d *Detector) Observe(deviceID, metric string, port int, value float64, at time.Time) {
+	if d == nil || deviceID == "" || math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	if _, known := minStdDev[metric]; !known {
+		return
+	}
+	if metric != MetricPower {
+		port = 0
+	} else if port < 1 || port > maxPowerPorts {
+		return
+	}
+	d.mu.Lock()
+	dev, ok := d.devices[deviceID]
+	if !ok {
+		if len(d.devices) >= d.opts.MaxDevices {
+			d.evictOldestLocked()
+		}
+		dev = &device{series: make(map[seriesKey]*series), episodes: make([]*Episode, d.opts.EpisodesPerDevice)}
+		d.devices[deviceID] = dev
+	}
+	key := seriesKey{metric: metric, port: port}
+	s, ok := dev.series[key]
+	if !ok {
+		s = &series{}
+		dev.series[key] = s
+	}
+	dev.lastAt = at
+	opened := d.observeLocked(deviceID, dev, key, s, value, at)
+	var handlers []Handler
+	if opened != nil {
+		handlers = append(handlers, d.handlers...)
+	}
+	d.mu.Unlock()
+
+	for _, h := range handlers {
+		h(*opened)
+	}
+}
+
+// observeLocked 更新序列并判定事件开启/关闭，返回新开启事件的副本
+func (d *Detector) observeLocked(deviceID string, dev *device, key seriesKey, s *series, x float64, at time.Time) *Episode {
+	defer func() { s.last, s.lastAt = x, at }()
+
+	if s.samples < int64(d.opts.WarmupSamples) {
+		s.samples++
+		s.learn(x, math.Max(d.opts.Alpha, 1/float64(s.samples)))
+		s.trackTrend(x)
+		return nil
+	}
+
+	std := s.stdDev(key.metric)
+	z := (x - s.mean) / std
+	outlier := math.Abs(z) > d.opts.SigmaThreshold
+	if outlier {
+		s.outliers++
+	} else {
+		s.outliers = 0
+	}
+	s.trackTrend(x)
+	trendDev := math.Abs(x-s.trendRef) / std
+	trending := s.trendLen >= d.opts.TrendWindow && trendDev >= d.opts.TrendSigma
+
+	var opened *Episode
+	if s.open == nil {
+		switch {
+		case s.outliers >= d.opts.SustainSamples:
+			opened = d.openLocked(deviceID, dev, key, s, KindDeviation, deviationDirection(z), std, x, math.Abs(z), at)
+		case trending:
+			opened = d.openLocked(deviceID, dev, key, s, KindTrend, trendDirection(s.trendDir), std, x, math.Max(math.Abs(z), trendDev), at)
+		}
+	} else {
+		ep := s.open
+		ep.Samples++
+		ep.LastSampleAt = at
+		// 事件期间以开启时的基线衡量偏离，基线随后的变化不影响严重度
+		deviation := math.Abs(x-ep.BaselineMean) / ep.BaselineStd
+		if deviation > ep.PeakDeviation {
+			ep.PeakDeviation, ep.PeakValue = deviation, x
+		}
+		if outlier || trending {
+			s.normal = 0
+		} else if s.normal++; s.normal >= d.opts.ResolveSamples {
+			resolvedAt := at
+			ep.Resolved, ep.ResolvedAt = true, &resolvedAt
+			s.open, s.normal = nil, 0
+		}
+	}
+
+	// 偏离样本不进入基线，避免持续异常被基线吸收
+	if !outlier {
+		s.samples++
+		s.learn(x, d.opts.Alpha)
+	}
+	if opened != nil {
+		cp := *opened
+		return &cp
+	}
+	return nil
+}
+
+func (d *Detector) openLocked(deviceID string, dev *device, key seriesKey, s *series, kind, direction string, std, x, deviation float64, at time.Time) *Episode {
+	d.seq++
+	ep := &Episode{
+		ID:            fmt.Sprintf("anm_%d_%d", at.UnixMilli(), d.seq),
+		DeviceID:      deviceID,
+		Metric:        key.metric,
+		Port:          key.port,
+		Kind:          kind,
+		Direction:     direction,
+		StartedAt:     at,
+		LastSampleAt:  at,
+		BaselineMean:  s.mean,
+		BaselineStd:   std,
+		StartValue:    x,
+		PeakValue:     x,
+		PeakDeviation: deviation,
+		Samples:       1,
+	}
+	s.open, s.normal = ep, 0
+	dev.record(ep)
+	return ep
+}
+
+func (d *Detector) evictOldestLocked() {
+	var oldestID string
+	var oldest time.Time
+	for id, dev := range d.devices {
+		if oldestID == "" || dev.lastAt.Before(oldest) {
+			oldestID, oldest = id, dev.lastAt
+		}
+	}
+	delete(d.devices, oldestID)
+}
+
+// learn 以系数 alpha 更新EWMA均值与方差
+func (s *series) learn(x, alpha float64) {
+	if s.samples == 1 {
+		s.mean, s.variance = x, 0
+		return
+	}
+	diff := x - s.mean
+	incr := alpha * diff
+	s.mean += incr
+	s.variance = (1 - alpha) * (s.variance + diff*incr)
+}
+
+// trackTrend 更新单调段：与上一样本相等时单调段延续但不计数
+func (s *series) trackTrend(x float64) {
+	if s.lastAt.IsZero() {
+		s.trendRef = x
+		return
+	}
+	dir := 0
+	switch {
+	case x > s.last:
+		dir = 1
+	case x < s.last:
+		dir = -1
+	default:
+		return
+	}
+	if dir != s.trendDir {
+		s.trendDir, s.trendLen, s.trendRef = dir, 0, s.last
+	}
+	s.trendLen++
+}
+
+func (s *series) stdDev(metric string) float64 {
+	return math.Max(math.Sqrt(s.variance), minStdDev[metric])
+}
+
+func deviationDirection(z float64) string {
+	if z > 0 {
+		return DirectionHigh
+	}
+	return DirectionLow
+}
+
+func trendDirection(dir int) string {
+	if dir > 0 {
+		return DirectionRising
+	}
+	return DirectionFalling
+}
+
+// Device 设备异常情况
+func (d *Detector) Device(deviceID string) (DeviceReport, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dev, ok := d.devices[deviceID]
+	if !ok {
+		return DeviceReport{}, false
+	}
+	report := d.reportLocked(deviceID, dev)
+	report.Baselines = make([]Baseline, 0, len(dev.series))
+	for key, s := range dev.series {
+		report.Baselines = append(report.Baselines, Baseline{
+			Metric:   key.metric,
+			Port:     key.port,
+			Mean:     s.mean,
+			StdDev:   s.stdDev(key.metric),
+			Samples:  s.samples,
+			Last:     s.last,
+			LastAt:   s.lastAt,
+			WarmedUp: s.samples >= int64(d.opts.WarmupSamples),
+		})
+	}
+	sort.Slice(report.Baselines, func(i, j int) bool {
+		a, b := report.Baselines[i], report.Baselines[j]
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		return a.Port < b.Port
+	})
+	return report, true
+}
+
+// Fleet 有异常事件的设备，按严重度从高到低（同严重度按最近事件开启时间从新到旧）；openOnly 时只返回有进行中事件的设备
+func (d *Detector) Fleet(openOnly bool) []DeviceReport {
+	d.mu.Lock()
+	reports := make([]DeviceReport, 0)
+	for id, dev := range d.devices {
+		if dev.count == 0 {
+			continue
+		}
+		report := d.reportLocked(id, dev)
+		if openOnly && len(report.Open) == 0 {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if !a.Episodes[0].StartedAt.Equal(b.Episodes[0].StartedAt) {
+			return a.Episodes[0].StartedAt.After(b.Episodes[0].StartedAt)
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	return reports
+}
+
+// reportLocked 复制设备事件（新→旧）并计算严重度
+func (d *Detector) reportLocked(deviceID string, dev *device) DeviceReport {
+	report := DeviceReport{DeviceID: deviceID, Open: make([]Episode, 0), Episodes: make([]Episode, 0, dev.count)}
+	for i := 1; i <= dev.count; i++ {
+		ep := *dev.episodes[(dev.next-i+len(dev.episodes))%len(dev.episodes)]
+		report.Episodes = append(report.Episodes, ep)
+		if !ep.Resolved {
+			report.Open = append(report.Open, ep)
+			report.Severity = math.Max(report.Severity, ep.PeakDeviation)
+		}
+	}
+	return report
+}
+
+// Devices 跟踪的设备数
+func (d *Detector) Devices() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.devices)
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalDetector atomic.Pointer[Detector]
+
+func init() {
+	globalDetector.Store(NewDetector(Options{}))
+}
+
+// GetGlobalDetector 获取全局异常检测器（配置关闭时为nil）
+func GetGlobalDetector() *Detector {
+	return globalDetector.Load()
+}
+
+// SetGlobalDetector 设置全局异常检测器
+func SetGlobalDetector(d *Detector) {
+	globalDetector.Store(d)
+}
+
+// InitGlobalDetector 按配置创建全局异常检测器；关闭时不再检测
+func InitGlobalDetector() *Detector {
+	cfg := config.GetConfig().AnomalyDetection
+	if !cfg.Enabled {
+		globalDetector.Store(nil)
+		return nil
+	}
+	d := NewDetector(Options{
+		Alpha:             cfg.Alpha,
+		SigmaThreshold:    cfg.SigmaThreshold,
+		SustainSamples:    cfg.SustainSamples,
+		TrendWindow:       cfg.TrendWindow,
+		TrendSigma:        cfg.TrendSigma,
+		WarmupSamples:     cfg.WarmupSamples,
+		ResolveSamples:    cfg.ResolveSamples,
+		EpisodesPerDevice: cfg.EpisodesPerDevice,
+		MaxDevices:        cfg.MaxDevices,
+	})
+	globalDetector.Store(d)
+	return d
+}
+
+// Observe 向全局检测器输入一个样本
+func Observe(deviceID, metric string, port int, value float64) {
+	GetGlobalDetector().Observe(deviceID, metric, port, value, time.Now())
+}
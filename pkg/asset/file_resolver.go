@@ -0,0 +1,192 @@
+package asset
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// FileResolver 基于静态映射文件的资产解析器
+// CSV: 表头 device_id,asset_code,station_id,label[,tenant_id]
+// YAML: 设备ID为键的映射，或带 device_id 字段的列表
+type FileResolver struct {
+	path    string
+	assets  atomic.Value // map[string]AssetInfo
+	modTime time.Time
+	size    int64
+}
+
+// NewFileResolver 创建文件解析器并立即加载
+func NewFileResolver(path string) (*FileResolver, error) {
+	r := &FileResolver{path: path}
+	r.assets.Store(map[string]AssetInfo{})
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Resolve 查询资产信息
+func (r *FileResolver) Resolve(deviceID string) (AssetInfo, bool) {
+	info, ok := r.assets.Load().(map[string]AssetInfo)[normalizeDeviceID(deviceID)]
+	return info, ok
+}
+
+// Count 当前映射条数
+func (r *FileResolver) Count() int {
+	return len(r.assets.Load().(map[string]AssetInfo))
+}
+
+// Reload 重新加载映射文件，失败时保留旧映射
+func (r *FileResolver) Reload() error {
+	stat, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("读取资产映射文件失败: %w", err)
+	}
+	f, err := os.Open(r.path)
+	if err != nil {
+		return fmt.Errorf("打开资产映射文件失败: %w", err)
+	}
+	defer f.Close()
+
+	var assets map[string]AssetInfo
+	switch strings.ToLower(filepath.Ext(r.path)) {
+	case ".csv":
+		assets, err = parseAssetCSV(f)
+	case ".yaml", ".yml":
+		assets, err = parseAssetYAML(f)
+	default:
+		err = fmt.Errorf("不支持的资产映射文件格式: %s", r.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.assets.Store(assets)
+	r.modTime = stat.ModTime()
+	r.size = stat.Size()
+	logger.WithFields(logrus.Fields{
+		"path":  r.path,
+		"count": len(assets),
+	}).Info("资产映射文件已加载")
+	if GetGlobalResolver() == r {
+		notifyReload()
+	}
+	return nil
+}
+
+// Watch 定期检查文件变更并热加载，随ctx取消退出
+func (r *FileResolver) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stat, err := os.Stat(r.path)
+				if err != nil || (stat.ModTime().Equal(r.modTime) && stat.Size() == r.size) {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					logger.WithFields(logrus.Fields{
+						"path":  r.path,
+						"error": err,
+					}).Warn("资产映射文件热加载失败，继续使用旧映射")
+				}
+			}
+		}
+	}()
+}
+
+func parseAssetCSV(rd io.Reader) (map[string]AssetInfo, error) {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析资产映射CSV失败: %w", err)
+	}
+	assets := make(map[string]AssetInfo, len(records))
+	if len(records) == 0 {
+		return assets, nil
+	}
+
+	// 按表头定位列，缺省按 device_id,asset_code,station_id,label,tenant_id 顺序
+	columns := map[string]int{"device_id": 0, "asset_code": 1, "station_id": 2, "label": 3, "tenant_id": 4}
+	start := 0
+	if strings.EqualFold(strings.TrimSpace(records[0][0]), "device_id") {
+		columns = make(map[string]int, len(records[0]))
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		start = 1
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	for _, row := range records[start:] {
+		deviceID := normalizeDeviceID(field(row, "device_id"))
+		info := AssetInfo{
+			AssetCode: field(row, "asset_code"),
+			StationID: field(row, "station_id"),
+			Label:     field(row, "label"),
+			TenantID:  field(row, "tenant_id"),
+		}
+		if deviceID == "" || info.IsEmpty() {
+			continue
+		}
+		assets[deviceID] = info
+	}
+	return assets, nil
+}
+
+func parseAssetYAML(rd io.Reader) (map[string]AssetInfo, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("读取资产映射YAML失败: %w", err)
+	}
+	assets := make(map[string]AssetInfo)
+
+	var byID map[string]AssetInfo
+	if err := yaml.Unmarshal(data, &byID); err == nil {
+		for id, info := range byID {
+			if id = normalizeDeviceID(id); id != "" && !info.IsEmpty() {
+				assets[id] = info
+			}
+		}
+		return assets, nil
+	}
+
+	var list []struct {
+		DeviceID  string `yaml:"device_id"`
+		AssetInfo `yaml:",inline"`
+	}
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析资产映射YAML失败: %w", err)
+	}
+	for _, item := range list {
+		if id := normalizeDeviceID(item.DeviceID); id != "" && !item.AssetInfo.IsEmpty() {
+			assets[id] = item.AssetInfo
+		}
+	}
+	return assets, nil
+}
@@ -0,0 +1,244 @@
+package asset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHTTPTimeout      = 500 * time.Millisecond
+	defaultCacheTTL         = 10 * time.Minute
+	defaultNegativeTTL      = time.Minute
+	defaultMaxConcurrent    = 4
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+	maxAssetResponseBytes   = 64 << 10
+)
+
+// HTTPResolverOptions HTTP资产解析器参数
+type HTTPResolverOptions struct {
+	URL              string            // 查询地址，{deviceId} 占位符替换为设备ID；无占位符时追加 ?deviceId=
+	Headers          map[string]string // 附加请求头（如鉴权）
+	Timeout          time.Duration     // 单次请求超时
+	CacheTTL         time.Duration     // 命中结果缓存时长
+	NegativeTTL      time.Duration     // 未命中(404)结果缓存时长
+	MaxConcurrent    int               // 后台并发查询上限
+	FailureThreshold int               // 连续失败次数达到阈值后熔断
+	OpenDuration     time.Duration     // 熔断持续时长，到期后放行一次探测
+}
+
+type assetCacheEntry struct {
+	info      AssetInfo
+	found     bool
+	expiresAt time.Time
+}
+
+// HTTPResolver 基于业务资产服务的解析器
+// Resolve 只读缓存，不在调用方协程内发起网络请求：缓存未命中时后台异步查询，
+// 本次返回未解析（或过期的旧值），因此资产服务再慢也不会拖慢设备API
+type HTTPResolver struct {
+	opts   HTTPResolverOptions
+	client *http.Client
+
+	mutex    sync.RWMutex
+	cache    map[string]assetCacheEntry
+	inflight map[string]struct{}
+
+	// 熔断状态
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	sem chan struct{}
+}
+
+// NewHTTPResolver 创建HTTP资产解析器
+func NewHTTPResolver(opts HTTPResolverOptions) (*HTTPResolver, error) {
+	if strings.TrimSpace(opts.URL) == "" {
+		return nil, fmt.Errorf("资产服务地址不能为空")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultHTTPTimeout
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = defaultCacheTTL
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultNegativeTTL
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = defaultMaxConcurrent
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = defaultOpenDuration
+	}
+	return &HTTPResolver{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		cache:    make(map[string]assetCacheEntry),
+		inflight: make(map[string]struct{}),
+		sem:      make(chan struct{}, opts.MaxConcurrent),
+	}, nil
+}
+
+// Resolve 查询资产信息（仅读缓存，未命中时触发后台查询）
+func (r *HTTPResolver) Resolve(deviceID string) (AssetInfo, bool) {
+	deviceID = normalizeDeviceID(deviceID)
+	if deviceID == "" {
+		return AssetInfo{}, false
+	}
+	now := time.Now()
+
+	r.mutex.RLock()
+	entry, cached := r.cache[deviceID]
+	r.mutex.RUnlock()
+	if cached && now.Before(entry.expiresAt) {
+		return entry.info, entry.found
+	}
+
+	r.refreshAsync(deviceID, now)
+	// 过期的命中结果在刷新完成前继续使用
+	return entry.info, cached && entry.found
+}
+
+// IsOpen 熔断器是否处于打开状态
+func (r *HTTPResolver) IsOpen() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return time.Now().Before(r.openUntil)
+}
+
+// refreshAsync 后台刷新单个设备（去重、限并发、受熔断控制）
+func (r *HTTPResolver) refreshAsync(deviceID string, now time.Time) {
+	r.mutex.Lock()
+	if _, ok := r.inflight[deviceID]; ok {
+		r.mutex.Unlock()
+		return
+	}
+	probe := false
+	if !r.openUntil.IsZero() {
+		if now.Before(r.openUntil) || r.probing {
+			r.mutex.Unlock()
+			return
+		}
+		// 熔断到期：半开状态只放行一次探测
+		r.probing = true
+		probe = true
+	}
+	select {
+	case r.sem <- struct{}{}:
+	default:
+		if probe {
+			r.probing = false
+		}
+		r.mutex.Unlock()
+		return
+	}
+	r.inflight[deviceID] = struct{}{}
+	r.mutex.Unlock()
+
+	go func() {
+		defer func() { <-r.sem }()
+		info, found, err := r.fetch(deviceID)
+		r.complete(deviceID, info, found, err)
+	}()
+}
+
+// fetch 请求资产服务
+func (r *HTTPResolver) fetch(deviceID string) (AssetInfo, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+	defer cancel()
+
+	target := r.opts.URL
+	if strings.Contains(target, "{deviceId}") {
+		target = strings.ReplaceAll(target, "{deviceId}", url.PathEscape(deviceID))
+	} else {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "deviceId=" + url.QueryEscape(deviceID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return AssetInfo{}, false, err
+	}
+	for k, v := range r.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return AssetInfo{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return AssetInfo{}, false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return AssetInfo{}, false, fmt.Errorf("资产服务返回状态码 %d", resp.StatusCode)
+	}
+
+	// 兼容 {asset_code,...} 与 {"data":{asset_code,...}} 两种响应
+	var body struct {
+		AssetInfo
+		Data *AssetInfo `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAssetResponseBytes)).Decode(&body); err != nil {
+		return AssetInfo{}, false, fmt.Errorf("解析资产服务响应失败: %w", err)
+	}
+	info := body.AssetInfo
+	if body.Data != nil {
+		info = *body.Data
+	}
+	return info, !info.IsEmpty(), nil
+}
+
+// complete 写回查询结果并更新熔断状态
+func (r *HTTPResolver) complete(deviceID string, info AssetInfo, found bool, err error) {
+	now := time.Now()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.inflight, deviceID)
+	r.probing = false
+
+	if err != nil {
+		r.failures++
+		if r.failures >= r.opts.FailureThreshold {
+			r.openUntil = now.Add(r.opts.OpenDuration)
+			logger.WithFields(logrus.Fields{
+				"deviceID": deviceID,
+				"failures": r.failures,
+				"openFor":  r.opts.OpenDuration.String(),
+				"error":    err,
+			}).Warn("资产服务连续查询失败，已熔断")
+		}
+		return
+	}
+
+	if !r.openUntil.IsZero() {
+		logger.WithFields(logrus.Fields{"deviceID": deviceID}).Info("资产服务探测成功，熔断已恢复")
+	}
+	r.failures = 0
+	r.openUntil = time.Time{}
+
+	ttl := r.opts.CacheTTL
+	if !found {
+		ttl = r.opts.NegativeTTL
+	}
+	r.cache[deviceID] = assetCacheEntry{info: info, found: found, expiresAt: now.Add(ttl)}
+}
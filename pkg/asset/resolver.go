@@ -0,0 +1,107 @@
+package asset
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ===============================
+// 全局实例
+// ===============================
+
+type resolverHolder struct {
+	resolver Resolver
+}
+
+var globalResolver atomic.Value // resolverHolder
+
+// GetGlobalResolver 获取全局资产解析器，未配置时返回nil
+func GetGlobalResolver() Resolver {
+	if h, ok := globalResolver.Load().(resolverHolder); ok {
+		return h.resolver
+	}
+	return nil
+}
+
+// SetGlobalResolver 设置全局资产解析器（nil 表示禁用），视为映射变更并通知重新加载回调
+func SetGlobalResolver(r Resolver) {
+	globalResolver.Store(resolverHolder{resolver: r})
+	notifyReload()
+}
+
+var (
+	reloadMu       sync.RWMutex
+	reloadHandlers []func()
+)
+
+// OnReload 注册映射变更回调（映射文件热加载成功或更换解析器后调用），用于依赖映射的缓存重新归属
+func OnReload(handler func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHandlers = append(reloadHandlers, handler)
+}
+
+func notifyReload() {
+	reloadMu.RLock()
+	handlers := append([]func(){}, reloadHandlers...)
+	reloadMu.RUnlock()
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
+// Lookup 通过全局解析器查询资产信息，未配置解析器时返回false
+func Lookup(deviceID string) (AssetInfo, bool) {
+	r := GetGlobalResolver()
+	if r == nil || deviceID == "" {
+		return AssetInfo{}, false
+	}
+	return r.Resolve(deviceID)
+}
+
+// InitGlobalResolver 按配置初始化全局资产解析器
+func InitGlobalResolver(ctx context.Context) error {
+	cfg := config.GetConfig().AssetResolver
+
+	var r Resolver
+	switch cfg.Type {
+	case "":
+		SetGlobalResolver(nil)
+		return nil
+	case ResolverTypeFile:
+		fr, err := NewFileResolver(cfg.File.Path)
+		if err != nil {
+			return err
+		}
+		fr.Watch(ctx, time.Duration(cfg.File.ReloadIntervalSeconds)*time.Second)
+		r = fr
+	case ResolverTypeHTTP:
+		hr, err := NewHTTPResolver(HTTPResolverOptions{
+			URL:              cfg.HTTP.URL,
+			Headers:          cfg.HTTP.Headers,
+			Timeout:          time.Duration(cfg.HTTP.TimeoutMillis) * time.Millisecond,
+			CacheTTL:         time.Duration(cfg.HTTP.CacheTTLSeconds) * time.Second,
+			NegativeTTL:      time.Duration(cfg.HTTP.NegativeTTLSeconds) * time.Second,
+			MaxConcurrent:    cfg.HTTP.MaxConcurrent,
+			FailureThreshold: cfg.HTTP.FailureThreshold,
+			OpenDuration:     time.Duration(cfg.HTTP.OpenSeconds) * time.Second,
+		})
+		if err != nil {
+			return err
+		}
+		r = hr
+	default:
+		return fmt.Errorf("不支持的资产解析器类型: %s", cfg.Type)
+	}
+
+	SetGlobalResolver(r)
+	logger.WithFields(logrus.Fields{"type": cfg.Type}).Info("资产解析器已启用")
+	return nil
+}
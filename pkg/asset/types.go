@@ -0,0 +1,33 @@
+package asset
+
+import "strings"
+
+// 解析器类型
+const (
+	ResolverTypeFile = "file" // 静态映射文件（CSV/YAML，支持热加载）
+	ResolverTypeHTTP = "http" // 业务资产服务HTTP查询（带缓存与熔断）
+)
+
+// AssetInfo 业务资产信息
+type AssetInfo struct {
+	AssetCode string `json:"asset_code" yaml:"asset_code"` // 资产编码，如 ST-0142-P3
+	StationID string `json:"station_id" yaml:"station_id"` // 所属站点
+	Label     string `json:"label" yaml:"label"`           // 展示名称
+	TenantID  string `json:"tenant_id" yaml:"tenant_id"`   // 所属租户（运营商），用于通知路由
+}
+
+// IsEmpty 是否为空资产信息
+func (a AssetInfo) IsEmpty() bool {
+	return a.AssetCode == "" && a.StationID == "" && a.Label == "" && a.TenantID == ""
+}
+
+// Resolver 设备ID → 业务资产映射
+// Resolve 必须是非阻塞或严格有界的调用，不得拖慢设备API
+type Resolver interface {
+	Resolve(deviceID string) (AssetInfo, bool)
+}
+
+// normalizeDeviceID 统一设备ID格式（8位大写十六进制）
+func normalizeDeviceID(deviceID string) string {
+	return strings.ToUpper(strings.TrimSpace(deviceID))
+}
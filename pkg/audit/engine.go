@@ -0,0 +1,405 @@
+package audit
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStaleThreshold = 24 * time.Hour
+	scheduleTick          = time.Minute
+)
+
+// SnapshotSource 审计数据源，返回设备参数快照
+type SnapshotSource func() []core.DeviceParamSnapshot
+
+// Engine 设备合规审计引擎
+// 审计在参数快照上执行，不持有TCPManager/参数缓存的锁，避免阻塞业务热路径
+type Engine struct {
+	mutex          sync.RWMutex
+	audits         map[string]*Audit
+	reports        map[string]*Report
+	running        map[string]bool
+	source         SnapshotSource
+	staleThreshold time.Duration
+	cancel         context.CancelFunc
+}
+
+// NewEngine 创建审计引擎
+func NewEngine(source SnapshotSource, staleThreshold time.Duration) *Engine {
+	if source == nil {
+		source = DefaultSnapshotSource
+	}
+	if staleThreshold <= 0 {
+		staleThreshold = defaultStaleThreshold
+	}
+	return &Engine{
+		audits:         make(map[string]*Audit),
+		reports:        make(map[string]*Report),
+		running:        make(map[string]bool),
+		source:         source,
+		staleThreshold: staleThreshold,
+	}
+}
+
+// DefaultSnapshotSource 默认数据源：参数缓存 + 当前在线但尚无缓存的设备；已停用设备不参与审计
+func DefaultSnapshotSource() []core.DeviceParamSnapshot {
+	decommissions := decommission.GetGlobalRegistry()
+	cached := core.GetDeviceParamCache().Snapshot()
+	snapshots := make([]core.DeviceParamSnapshot, 0, len(cached))
+	known := make(map[string]struct{}, len(cached))
+	for _, s := range cached {
+		known[s.DeviceID] = struct{}{}
+		if !decommissions.IsDecommissioned(s.DeviceID) {
+			snapshots = append(snapshots, s)
+		}
+	}
+	if tm := core.GetGlobalTCPManager(); tm != nil {
+		tm.GetDeviceIndex().Range(func(key, _ interface{}) bool {
+			deviceID := key.(string)
+			if _, ok := known[deviceID]; !ok && !decommissions.IsDecommissioned(deviceID) {
+				snapshots = append(snapshots, core.DeviceParamSnapshot{
+					DeviceID:   deviceID,
+					Values:     map[string]interface{}{},
+					VerifiedAt: map[string]time.Time{},
+				})
+			}
+			return true
+		})
+	}
+	return snapshots
+}
+
+// CreateAudit 新增审计定义
+func (e *Engine) CreateAudit(a *Audit) (*Audit, error) {
+	if a == nil {
+		return nil, fmt.Errorf("审计定义不能为空")
+	}
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	if a.ID == "" {
+		a.ID = "audit_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+	}
+	if a.Name == "" {
+		a.Name = a.ID
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if _, exists := e.audits[a.ID]; exists {
+		return nil, fmt.Errorf("审计 %s 已存在", a.ID)
+	}
+	e.audits[a.ID] = a
+	cp := *a
+	return &cp, nil
+}
+
+// GetAudit 获取审计定义
+func (e *Engine) GetAudit(id string) (*Audit, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	a, ok := e.audits[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *a
+	return &cp, true
+}
+
+// ListAudits 列出全部审计定义
+func (e *Engine) ListAudits() []Audit {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	list := make([]Audit, 0, len(e.audits))
+	for _, a := range e.audits {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// GetReport 获取审计最近一次报告
+func (e *Engine) GetReport(id string) (*Report, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	r, ok := e.reports[id]
+	return r, ok
+}
+
+// Run 立即执行审计并返回报告
+func (e *Engine) Run(id string) (*Report, error) {
+	e.mutex.Lock()
+	a, ok := e.audits[id]
+	if !ok {
+		e.mutex.Unlock()
+		return nil, fmt.Errorf("审计 %s 不存在", id)
+	}
+	if e.running[id] {
+		e.mutex.Unlock()
+		return nil, fmt.Errorf("审计 %s 正在执行中", id)
+	}
+	e.running[id] = true
+	audit := *a
+	e.mutex.Unlock()
+
+	report := e.evaluate(&audit, e.source(), time.Now())
+
+	e.mutex.Lock()
+	e.running[id] = false
+	if stored, exists := e.audits[id]; exists {
+		stored.LastRunAt = report.GeneratedAt
+	}
+	e.reports[id] = report
+	e.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"auditID":      id,
+		"total":        report.TotalDevices,
+		"compliant":    report.Compliant,
+		"nonCompliant": report.NonCompliant,
+		"unknown":      report.Unknown,
+		"duration":     report.Duration,
+	}).Info("合规审计执行完成")
+
+	return report, nil
+}
+
+// evaluate 在快照上执行审计
+func (e *Engine) evaluate(a *Audit, snapshots []core.DeviceParamSnapshot, now time.Time) *Report {
+	start := time.Now()
+	stale := a.StaleThreshold
+	if stale <= 0 {
+		stale = e.staleThreshold
+	}
+
+	report := &Report{
+		AuditID:     a.ID,
+		AuditName:   a.Name,
+		Rules:       a.Rules,
+		GeneratedAt: now,
+		Devices:     make([]DeviceResult, 0),
+	}
+
+	for _, snap := range snapshots {
+		result := DeviceResult{
+			DeviceID: snap.DeviceID,
+			Status:   StatusCompliant,
+			Values:   make(map[string]interface{}, len(a.Rules)),
+		}
+		var missing []string
+		for _, rule := range a.Rules {
+			value, ok := lookupField(snap.Values, rule.Field)
+			if !ok {
+				missing = append(missing, rule.Field)
+				continue
+			}
+			result.Values[rule.Field] = value
+
+			verifiedAt := snap.VerifiedAt[strings.SplitN(rule.Field, ".", 2)[0]]
+			if verifiedAt.IsZero() {
+				verifiedAt = snap.LastVerified
+			}
+			if result.LastVerified.IsZero() || verifiedAt.Before(result.LastVerified) {
+				result.LastVerified = verifiedAt
+			}
+			if !evaluate(rule, value) {
+				result.FailedRules = append(result.FailedRules, rule.String())
+			}
+		}
+
+		switch {
+		case len(missing) > 0:
+			result.Status = StatusUnknown
+			result.Reason = "缺少字段: " + strings.Join(missing, ",")
+		case result.LastVerified.IsZero() || now.Sub(result.LastVerified) > stale:
+			result.Status = StatusUnknown
+			result.Reason = fmt.Sprintf("数据已过期(超过%s未确认)", stale)
+		case len(result.FailedRules) > 0:
+			result.Status = StatusNonCompliant
+		}
+
+		report.TotalDevices++
+		switch result.Status {
+		case StatusCompliant:
+			report.Compliant++
+		case StatusNonCompliant:
+			report.NonCompliant++
+			report.Devices = append(report.Devices, result)
+		default:
+			report.Unknown++
+			report.Devices = append(report.Devices, result)
+		}
+	}
+
+	sort.Slice(report.Devices, func(i, j int) bool {
+		if report.Devices[i].Status != report.Devices[j].Status {
+			return report.Devices[i].Status == StatusNonCompliant
+		}
+		return report.Devices[i].DeviceID < report.Devices[j].DeviceID
+	})
+	report.Duration = time.Since(start).String()
+	return report
+}
+
+// Start 启动定时审计
+func (e *Engine) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	e.mutex.Lock()
+	e.cancel = cancel
+	e.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				for _, id := range e.dueAudits(now) {
+					if _, err := e.Run(id); err != nil {
+						logger.WithFields(logrus.Fields{"auditID": id, "error": err}).Warn("定时合规审计执行失败")
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定时审计
+func (e *Engine) Stop() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+}
+
+// dueAudits 返回到期需要执行的审计
+func (e *Engine) dueAudits(now time.Time) []string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	var due []string
+	for id, a := range e.audits {
+		if a.Interval <= 0 || e.running[id] {
+			continue
+		}
+		if a.LastRunAt.IsZero() || now.Sub(a.LastRunAt) >= a.Interval {
+			due = append(due, id)
+		}
+	}
+	return due
+}
+
+// WriteCSV 以CSV格式导出报告
+func (r *Report) WriteCSV(w io.Writer) error {
+	fields := make([]string, 0, len(r.Rules))
+	seen := make(map[string]struct{})
+	for _, rule := range r.Rules {
+		if _, ok := seen[rule.Field]; !ok {
+			seen[rule.Field] = struct{}{}
+			fields = append(fields, rule.Field)
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	header := append([]string{"device_id", "status"}, fields...)
+	header = append(header, "last_verified", "failed_rules", "reason")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, d := range r.Devices {
+		row := []string{d.DeviceID, d.Status}
+		for _, f := range fields {
+			if v, ok := d.Values[f]; ok {
+				row = append(row, fmt.Sprintf("%v", v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		lastVerified := ""
+		if !d.LastVerified.IsZero() {
+			lastVerified = d.LastVerified.Format(time.RFC3339)
+		}
+		row = append(row, lastVerified, strings.Join(d.FailedRules, "; "), d.Reason)
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalEngine atomic.Pointer[Engine]
+
+// GetGlobalEngine 获取全局审计引擎（首次使用时以默认数据源创建）
+func GetGlobalEngine() *Engine {
+	if e := globalEngine.Load(); e != nil {
+		return e
+	}
+	globalEngine.CompareAndSwap(nil, NewEngine(nil, defaultStaleThreshold))
+	return globalEngine.Load()
+}
+
+// SetGlobalEngine 替换全局审计引擎，返回原引擎（测试注入数据源）
+func SetGlobalEngine(e *Engine) *Engine {
+	return globalEngine.Swap(e)
+}
+
+// InitGlobalEngine 按配置初始化全局审计引擎并启动定时任务
+func InitGlobalEngine(ctx context.Context) error {
+	cfg := config.GetConfig().Audit
+	engine := NewEngine(nil, time.Duration(cfg.StaleThresholdMinutes)*time.Minute)
+
+	for _, def := range cfg.Audits {
+		a := &Audit{
+			ID:             def.ID,
+			Name:           def.Name,
+			StaleThreshold: time.Duration(def.StaleThresholdMinutes) * time.Minute,
+			Interval:       time.Duration(def.IntervalMinutes) * time.Minute,
+		}
+		for _, r := range def.Rules {
+			a.Rules = append(a.Rules, Rule{Field: r.Field, Operator: r.Operator, Expected: r.Expected})
+		}
+		if _, err := engine.CreateAudit(a); err != nil {
+			return fmt.Errorf("加载审计 %s 失败: %w", def.ID, err)
+		}
+	}
+
+	// 加载完成后再发布，并发的 GetGlobalEngine 不会拿到半初始化的引擎
+	globalEngine.Store(engine)
+	if cfg.Enabled {
+		engine.Start(ctx)
+	}
+	return nil
+}
+
+// StopGlobalEngine 停止全局审计引擎
+func StopGlobalEngine() {
+	if e := globalEngine.Load(); e != nil {
+		e.Stop()
+	}
+}
@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 规则运算符
+const (
+	OperatorEq         = "eq"          // 等于
+	OperatorNe         = "ne"          // 不等于
+	OperatorGt         = "gt"          // 大于（数值）
+	OperatorGte        = "gte"         // 大于等于（数值）
+	OperatorLt         = "lt"          // 小于（数值）
+	OperatorLte        = "lte"         // 小于等于（数值）
+	OperatorVersionGte = "version_gte" // 版本号大于等于
+	OperatorVersionLte = "version_lte" // 版本号小于等于
+	OperatorContains   = "contains"    // 字符串包含
+)
+
+// 设备审计结论
+const (
+	StatusCompliant    = "compliant"     // 合规
+	StatusNonCompliant = "non_compliant" // 不合规
+	StatusUnknown      = "unknown"       // 数据缺失或过期，无法判定
+)
+
+// Rule 审计规则
+type Rule struct {
+	Field    string `json:"field"`    // 字段路径，如 firmware_version、params.max_power
+	Operator string `json:"operator"` // 运算符
+	Expected string `json:"expected"` // 期望值
+}
+
+// String 规则描述
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s %s", r.Field, r.Operator, r.Expected)
+}
+
+// Validate 校验规则
+func (r Rule) Validate() error {
+	if strings.TrimSpace(r.Field) == "" {
+		return fmt.Errorf("规则字段不能为空")
+	}
+	switch r.Operator {
+	case OperatorEq, OperatorNe, OperatorContains, OperatorVersionGte, OperatorVersionLte:
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		if _, err := strconv.ParseFloat(r.Expected, 64); err != nil {
+			return fmt.Errorf("规则 %s 的期望值必须为数值", r.String())
+		}
+	default:
+		return fmt.Errorf("不支持的运算符: %s", r.Operator)
+	}
+	return nil
+}
+
+// Audit 审计定义（所有规则同时满足视为合规）
+type Audit struct {
+	ID             string        `json:"id"`
+	Name           string        `json:"name"`
+	Rules          []Rule        `json:"rules"`
+	StaleThreshold time.Duration `json:"stale_threshold"` // 数据超过该时长未确认视为 unknown
+	Interval       time.Duration `json:"interval"`        // 定时执行间隔，0 表示仅按需执行
+	CreatedAt      time.Time     `json:"created_at"`
+	LastRunAt      time.Time     `json:"last_run_at"`
+}
+
+// Validate 校验审计定义
+func (a *Audit) Validate() error {
+	if len(a.Rules) == 0 {
+		return fmt.Errorf("审计规则不能为空")
+	}
+	for _, r := range a.Rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeviceResult 单设备审计结果
+type DeviceResult struct {
+	DeviceID     string                 `json:"device_id"`
+	Status       string                 `json:"status"`
+	Values       map[string]interface{} `json:"values"`        // 规则字段的当前值
+	LastVerified time.Time              `json:"last_verified"` // 规则字段中最旧的确认时间
+	FailedRules  []string               `json:"failed_rules,omitempty"`
+	Reason       string                 `json:"reason,omitempty"`
+}
+
+// Report 审计报告（仅列出不合规与未知设备）
+type Report struct {
+	AuditID      string         `json:"audit_id"`
+	AuditName    string         `json:"audit_name"`
+	Rules        []Rule         `json:"rules"`
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Duration     string         `json:"duration"`
+	TotalDevices int            `json:"total_devices"`
+	Compliant    int            `json:"compliant"`
+	NonCompliant int            `json:"non_compliant"`
+	Unknown      int            `json:"unknown"`
+	Devices      []DeviceResult `json:"devices"`
+}
+
+// lookupField 按字段路径取值，支持直接键与点分嵌套map
+func lookupField(values map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := values[path]; ok {
+		return v, true
+	}
+	parts := strings.Split(path, ".")
+	var current interface{} = values
+	for _, p := range parts {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// evaluate 计算单条规则
+func evaluate(r Rule, actual interface{}) bool {
+	actualStr := strings.TrimSpace(fmt.Sprintf("%v", actual))
+	expected := strings.TrimSpace(r.Expected)
+
+	switch r.Operator {
+	case OperatorEq, OperatorNe:
+		equal := actualStr == expected
+		if a, errA := strconv.ParseFloat(actualStr, 64); errA == nil {
+			if e, errE := strconv.ParseFloat(expected, 64); errE == nil {
+				equal = a == e
+			}
+		}
+		if r.Operator == OperatorEq {
+			return equal
+		}
+		return !equal
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		a, err := strconv.ParseFloat(actualStr, 64)
+		if err != nil {
+			return false
+		}
+		e, _ := strconv.ParseFloat(expected, 64)
+		switch r.Operator {
+		case OperatorGt:
+			return a > e
+		case OperatorGte:
+			return a >= e
+		case OperatorLt:
+			return a < e
+		default:
+			return a <= e
+		}
+	case OperatorVersionGte:
+		return compareVersion(actualStr, expected) >= 0
+	case OperatorVersionLte:
+		return compareVersion(actualStr, expected) <= 0
+	case OperatorContains:
+		return strings.Contains(actualStr, expected)
+	}
+	return false
+}
+
+// compareVersion 比较版本号（按非数字字符切分逐段比较数值）
+func compareVersion(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb int
+		if i < len(pa) {
+			va = pa[i]
+		}
+		if i < len(pb) {
+			vb = pb[i]
+		}
+		if va != vb {
+			if va > vb {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	fields := strings.FieldsFunc(v, func(r rune) bool { return r < '0' || r > '9' })
+	parts := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, _ := strconv.Atoi(f)
+		parts = append(parts, n)
+	}
+	return parts
+}
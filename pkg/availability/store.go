@@ -0,0 +1,46 @@
+package availability
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+)
+
+// 持久化方式
+const (
+	StoreTypeFile   = persistence.StoreTypeFile
+	StoreTypeRedis  = persistence.StoreTypeRedis
+	StoreTypeMemory = persistence.StoreTypeMemory
+)
+
+// SnapshotRecordType 状态历史的持久化类型（加载时旧版本立即迁移并回写）
+const (
+	SnapshotRecordType    = "port_availability"
+	snapshotRecordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(SnapshotRecordType, snapshotRecordVersion)
+}
+
+// Snapshot 持久化的端口状态历史：各设备端口当前状态、按天聚合与最近的状态转换
+type Snapshot struct {
+	Devices []DeviceHistory `json:"devices"`
+	SavedAt time.Time       `json:"savedAt"`
+}
+
+// Store 端口状态历史持久化
+type Store = persistence.Store[Snapshot]
+
+var storeCodec = persistence.Codec{RecordType: SnapshotRecordType, Label: "端口状态历史"}
+
+// NewFileStore 创建文件持久化
+func NewFileStore(path string) *persistence.FileStore[Snapshot] {
+	return persistence.NewFileStore[Snapshot](path, storeCodec)
+}
+
+// NewRedisStore 创建Redis持久化
+func NewRedisStore(client *redis.Client, key string) *persistence.RedisStore[Snapshot] {
+	return persistence.NewRedisStore[Snapshot](client, key, storeCodec)
+}
@@ -0,0 +1,661 @@
+// Package availability 端口可用率：记录端口状态转换（设备上报或推断），按天聚合各端口在各状态的时长并持久化，
+// 供客户 SLA 报告按月计算端口可用率。网关重启造成的未知时段计为未监控时长，不计入停机。
+package availability
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFilePath       = "./data/port_availability.json"
+	defaultRedisKey       = "iot:port_availability"
+	defaultMaxTransitions = 500
+	defaultRetentionDays  = 400 // 覆盖上一年同月，满足按月对比
+	defaultRestartGrace   = 5 * time.Minute
+	defaultFlushInterval  = 60 * time.Second
+	dayLayout             = "2006-01-02"
+	monthLayout           = "2006-01"
+)
+
+// 端口状态
+const (
+	StateAvailable   = "available"   // 空闲、充电中等可提供服务的状态
+	StateFaulted     = "faulted"     // 设备上报的故障状态
+	StateOffline     = "offline"     // 设备离线
+	StateUnmonitored = "unmonitored" // 网关未在监控（重启间隙等未知时段），不计入停机
+)
+
+// 状态来源
+const (
+	SourceDevice   = "device"   // 设备心跳上报的端口状态
+	SourceInferred = "inferred" // 由设备离线、网关重启等推断
+)
+
+// StateForStatus 协议端口状态 → 可用率状态：空闲/充电中/插枪未充/已充满/浮充为可用，其余为故障（与站点聚合分类一致）
+func StateForStatus(status uint8) string {
+	switch status {
+	case 0x00, 0x01, 0x02, 0x03, 0x05:
+		return StateAvailable
+	default:
+		return StateFaulted
+	}
+}
+
+// Transition 端口状态转换
+type Transition struct {
+	Port   int       `json:"port"` // 业务端口(1-based)
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	At     time.Time `json:"at"`
+	Source string    `json:"source"`
+}
+
+// DayBucket 端口单日各状态时长(秒)，日期按网关本地时区划分
+type DayBucket struct {
+	Date               string  `json:"date"` // YYYY-MM-DD
+	AvailableSeconds   float64 `json:"availableSeconds"`
+	FaultedSeconds     float64 `json:"faultedSeconds"`
+	OfflineSeconds     float64 `json:"offlineSeconds"`
+	UnmonitoredSeconds float64 `json:"unmonitoredSeconds"`
+}
+
+func (b *DayBucket) add(state string, seconds float64) {
+	switch state {
+	case StateAvailable:
+		b.AvailableSeconds += seconds
+	case StateFaulted:
+		b.FaultedSeconds += seconds
+	case StateOffline:
+		b.OfflineSeconds += seconds
+	default:
+		b.UnmonitoredSeconds += seconds
+	}
+}
+
+// PortHistory 端口当前状态与按天聚合的状态时长
+type PortHistory struct {
+	Port         int         `json:"port"`
+	State        string      `json:"state"`
+	Since        time.Time   `json:"since"`        // 当前状态开始时间
+	AccruedUntil time.Time   `json:"accruedUntil"` // 已计入按天聚合的截止时间
+	Days         []DayBucket `json:"days"`         // 按日期升序，保留 RetentionDays 天
+}
+
+// DeviceHistory 设备各端口的状态历史
+type DeviceHistory struct {
+	DeviceID    string         `json:"deviceId"`
+	Ports       []*PortHistory `json:"ports"`       // 按端口号升序
+	Transitions []Transition   `json:"transitions"` // 最近的状态转换（旧→新），超出上限丢弃最旧的
+}
+
+func (d *DeviceHistory) port(port int) *PortHistory {
+	for _, p := range d.Ports {
+		if p.Port == port {
+			return p
+		}
+	}
+	return nil
+}
+
+// Totals 统计区间内各状态时长与可用率
+type Totals struct {
+	AvailableSeconds   float64  `json:"availableSeconds"`
+	FaultedSeconds     float64  `json:"faultedSeconds"`
+	OfflineSeconds     float64  `json:"offlineSeconds"`
+	UnmonitoredSeconds float64  `json:"unmonitoredSeconds"` // 含跟踪开始前与网关重启间隙
+	MonitoredSeconds   float64  `json:"monitoredSeconds"`   // 可用 + 故障 + 离线
+	UptimePercent      *float64 `json:"uptimePercent"`      // 可用时长 / 监控时长，无监控时长时为 null
+}
+
+func (t *Totals) merge(o Totals) {
+	t.AvailableSeconds += o.AvailableSeconds
+	t.FaultedSeconds += o.FaultedSeconds
+	t.OfflineSeconds += o.OfflineSeconds
+	t.UnmonitoredSeconds += o.UnmonitoredSeconds
+	t.MonitoredSeconds += o.MonitoredSeconds
+}
+
+func (t *Totals) finish() {
+	if t.MonitoredSeconds > 0 {
+		uptime := math.Round(t.AvailableSeconds/t.MonitoredSeconds*100000) / 1000
+		t.UptimePercent = &uptime
+	}
+}
+
+// PortReport 端口月度可用率
+type PortReport struct {
+	DeviceID     string       `json:"deviceId"`
+	Port         int          `json:"port"`
+	Month        string       `json:"month"`
+	From         time.Time    `json:"from"`
+	To           time.Time    `json:"to"` // 当月截至查询时刻
+	CurrentState string       `json:"currentState"`
+	CurrentSince time.Time    `json:"currentSince"`
+	Days         []DayBucket  `json:"days"`
+	Transitions  []Transition `json:"transitions"` // 当月该端口的状态转换（仍在保留范围内的）
+	Totals
+}
+
+// DeviceRollup 设备全部端口的月度汇总
+type DeviceRollup struct {
+	DeviceID string `json:"deviceId"`
+	Ports    int    `json:"ports"`
+	Totals
+}
+
+// Rollup 多台设备（站点）的月度可用率汇总，时长为各端口之和
+type Rollup struct {
+	Month     string         `json:"month"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Ports     int            `json:"ports"`
+	Devices   []DeviceRollup `json:"devices"`
+	Untracked []string       `json:"untracked"` // 无端口状态历史的设备
+	Totals
+}
+
+// Options 跟踪器选项
+type Options struct {
+	StoreType      string
+	MaxTransitions int           // 单设备保留的状态转换条数
+	RetentionDays  int           // 按天聚合的保留天数
+	RestartGrace   time.Duration // 重启后等待设备重新上报的时长，超时仍未上报的端口推断为离线
+	FlushInterval  time.Duration // 定期聚合与持久化间隔
+}
+
+// Tracker 端口状态历史跟踪器
+type Tracker struct {
+	store Store
+	opts  Options
+
+	mu        sync.Mutex
+	devices   map[string]*DeviceHistory
+	resumedAt time.Time // 重启恢复时刻，重启宽限期结束后清零
+	dirty     bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTracker 创建跟踪器并从持久化记录恢复（恢复的端口须经 Resume 标记重启间隙）
+func NewTracker(store Store, opts Options) (*Tracker, error) {
+	if opts.MaxTransitions <= 0 {
+		opts.MaxTransitions = defaultMaxTransitions
+	}
+	if opts.RetentionDays <= 0 {
+		opts.RetentionDays = defaultRetentionDays
+	}
+	if opts.RestartGrace <= 0 {
+		opts.RestartGrace = defaultRestartGrace
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.StoreType == "" {
+		opts.StoreType = StoreTypeMemory
+	}
+	t := &Tracker{store: store, opts: opts, devices: make(map[string]*DeviceHistory)}
+	if store == nil {
+		return t, nil
+	}
+	snapshot, err := store.Load()
+	if err != nil {
+		return t, err
+	}
+	if snapshot != nil {
+		for i := range snapshot.Devices {
+			d := snapshot.Devices[i]
+			t.devices[d.DeviceID] = &d
+		}
+	}
+	return t, nil
+}
+
+// Options 跟踪器选项
+func (t *Tracker) Options() Options {
+	return t.opts
+}
+
+// Resume 网关启动时调用：恢复的端口从最后聚合时刻起转为未监控（停机期间状态未知），
+// 重启宽限期内未重新上报的端口在宽限期结束时推断为离线；返回转为未监控的端口数
+func (t *Tracker) Resume(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	resumed := 0
+	for _, d := range t.devices {
+		for _, p := range d.Ports {
+			if p.State != StateUnmonitored {
+				t.transitionLocked(d, p, StateUnmonitored, SourceInferred, p.AccruedUntil)
+				resumed++
+			}
+		}
+	}
+	t.resumedAt = now
+	return resumed
+}
+
+// OnPortStatuses 设备心跳上报的全部端口状态（下标0为端口1）
+func (t *Tracker) OnPortStatuses(deviceID string, statuses []uint8, now time.Time) {
+	if deviceID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, status := range statuses {
+		t.setLocked(deviceID, i+1, StateForStatus(status), SourceDevice, now)
+	}
+}
+
+// OnPortStatus 设备上报的单端口状态（port 为1-based业务端口）
+func (t *Tracker) OnPortStatus(deviceID string, port int, status uint8, now time.Time) {
+	if deviceID == "" || port < 1 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setLocked(deviceID, port, StateForStatus(status), SourceDevice, now)
+}
+
+// OnDeviceOffline 设备离线：已知端口全部推断为离线，直到设备重新上报端口状态
+func (t *Tracker) OnDeviceOffline(deviceID string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.devices[deviceID]
+	if !ok {
+		return
+	}
+	for _, p := range d.Ports {
+		t.transitionLocked(d, p, StateOffline, SourceInferred, now)
+	}
+}
+
+// Sweep 巡检：重启宽限期结束时把仍未上报的端口推断为离线，全部端口按当前状态聚合到 now，清理超出保留天数的聚合
+func (t *Tracker) Sweep(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.resumedAt.IsZero() {
+		if deadline := t.resumedAt.Add(t.opts.RestartGrace); !now.Before(deadline) {
+			inferred := 0
+			for _, d := range t.devices {
+				for _, p := range d.Ports {
+					if p.State == StateUnmonitored {
+						t.transitionLocked(d, p, StateOffline, SourceInferred, deadline)
+						inferred++
+					}
+				}
+			}
+			if inferred > 0 {
+				logger.WithFields(logrus.Fields{"ports": inferred}).Info("重启宽限期内未重新上报的端口已推断为离线")
+			}
+			t.resumedAt = time.Time{}
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -t.opts.RetentionDays).In(time.Local).Format(dayLayout)
+	for _, d := range t.devices {
+		for _, p := range d.Ports {
+			accrueLocked(p, now)
+			i := 0
+			for i < len(p.Days) && p.Days[i].Date < cutoff {
+				i++
+			}
+			if i > 0 {
+				p.Days = append([]DayBucket(nil), p.Days[i:]...)
+			}
+		}
+	}
+	if len(t.devices) > 0 {
+		t.dirty = true
+	}
+}
+
+// Port 端口指定月份的可用率（month 为当月1日零点，本地时区），端口无历史时返回false
+func (t *Tracker) Port(deviceID string, port int, month, now time.Time) (PortReport, bool) {
+	from, to := monthRange(month, now)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.devices[deviceID]
+	if !ok {
+		return PortReport{}, false
+	}
+	p := d.port(port)
+	if p == nil {
+		return PortReport{}, false
+	}
+	accrueLocked(p, now)
+	t.dirty = true
+
+	report := PortReport{
+		DeviceID:     deviceID,
+		Port:         port,
+		Month:        from.Format(monthLayout),
+		From:         from,
+		To:           to,
+		CurrentState: p.State,
+		CurrentSince: p.Since,
+		Days:         []DayBucket{},
+		Transitions:  []Transition{},
+	}
+	report.Totals, report.Days = portTotals(p, from, to)
+	for _, tr := range d.Transitions {
+		if tr.Port == port && !tr.At.Before(from) && tr.At.Before(to) {
+			report.Transitions = append(report.Transitions, tr)
+		}
+	}
+	return report, true
+}
+
+// Rollup 多台设备全部端口指定月份的可用率汇总（站点级），可用率按全部端口的可用时长/监控时长计算
+func (t *Tracker) Rollup(deviceIDs []string, month, now time.Time) Rollup {
+	from, to := monthRange(month, now)
+	rollup := Rollup{Month: from.Format(monthLayout), From: from, To: to, Devices: []DeviceRollup{}, Untracked: []string{}}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, deviceID := range deviceIDs {
+		d, ok := t.devices[deviceID]
+		if !ok || len(d.Ports) == 0 {
+			rollup.Untracked = append(rollup.Untracked, deviceID)
+			continue
+		}
+		dev := DeviceRollup{DeviceID: deviceID, Ports: len(d.Ports)}
+		for _, p := range d.Ports {
+			accrueLocked(p, now)
+			totals, _ := portTotals(p, from, to)
+			dev.merge(totals)
+		}
+		dev.finish()
+		rollup.Ports += dev.Ports
+		rollup.merge(dev.Totals)
+		rollup.Devices = append(rollup.Devices, dev)
+	}
+	t.dirty = true
+	rollup.finish()
+	sort.Slice(rollup.Devices, func(i, j int) bool { return rollup.Devices[i].DeviceID < rollup.Devices[j].DeviceID })
+	sort.Strings(rollup.Untracked)
+	return rollup
+}
+
+// Flush 有变更时持久化当前状态
+func (t *Tracker) Flush() error {
+	if t.store == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	snapshot := t.snapshotLocked()
+	t.dirty = false
+	t.mu.Unlock()
+
+	if err := t.store.Save(snapshot); err != nil {
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start 启动定期聚合与持久化（随上下文取消或 Stop 结束）
+func (t *Tracker) Start(ctx context.Context) {
+	t.mu.Lock()
+	if t.cancel != nil {
+		t.mu.Unlock()
+		return
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.done = make(chan struct{})
+	t.mu.Unlock()
+
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.opts.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				t.Sweep(now)
+				if err := t.Flush(); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("持久化端口状态历史失败")
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定期任务，聚合到停机时刻并持久化（下次启动从该时刻起计为未监控）
+func (t *Tracker) Stop() error {
+	t.mu.Lock()
+	cancel, done := t.cancel, t.done
+	t.cancel = nil
+	t.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	t.Sweep(time.Now())
+	return t.Flush()
+}
+
+// setLocked 端口状态更新：首次出现的端口从 at 开始跟踪（此前计为未监控）
+func (t *Tracker) setLocked(deviceID string, port int, state, source string, at time.Time) {
+	d, ok := t.devices[deviceID]
+	if !ok {
+		d = &DeviceHistory{DeviceID: deviceID}
+		t.devices[deviceID] = d
+	}
+	p := d.port(port)
+	if p == nil {
+		p = &PortHistory{Port: port, State: StateUnmonitored, Since: at, AccruedUntil: at}
+		d.Ports = append(d.Ports, p)
+		sort.Slice(d.Ports, func(i, j int) bool { return d.Ports[i].Port < d.Ports[j].Port })
+	}
+	t.transitionLocked(d, p, state, source, at)
+}
+
+// transitionLocked 聚合旧状态到 at 后切换状态并记录转换（状态未变时只聚合），早于已聚合时刻的 at 按已聚合时刻处理
+func (t *Tracker) transitionLocked(d *DeviceHistory, p *PortHistory, state, source string, at time.Time) {
+	if at.Before(p.AccruedUntil) {
+		at = p.AccruedUntil
+	}
+	accrueLocked(p, at)
+	t.dirty = true
+	if p.State == state {
+		return
+	}
+	d.Transitions = append(d.Transitions, Transition{Port: p.Port, From: p.State, To: state, At: at, Source: source})
+	if over := len(d.Transitions) - t.opts.MaxTransitions; over > 0 {
+		d.Transitions = append([]Transition(nil), d.Transitions[over:]...)
+	}
+	p.State, p.Since = state, at
+}
+
+func (t *Tracker) snapshotLocked() Snapshot {
+	snapshot := Snapshot{Devices: make([]DeviceHistory, 0, len(t.devices)), SavedAt: time.Now()}
+	for _, d := range t.devices {
+		cp := DeviceHistory{DeviceID: d.DeviceID, Transitions: append([]Transition(nil), d.Transitions...)}
+		for _, p := range d.Ports {
+			pc := *p
+			pc.Days = append([]DayBucket(nil), p.Days...)
+			cp.Ports = append(cp.Ports, &pc)
+		}
+		snapshot.Devices = append(snapshot.Devices, cp)
+	}
+	sort.Slice(snapshot.Devices, func(i, j int) bool { return snapshot.Devices[i].DeviceID < snapshot.Devices[j].DeviceID })
+	return snapshot
+}
+
+// accrueLocked 把端口当前状态从已聚合时刻到 to 的时长按本地日期拆分计入按天聚合
+func accrueLocked(p *PortHistory, to time.Time) {
+	from := p.AccruedUntil
+	if !to.After(from) {
+		return
+	}
+	for from.Before(to) {
+		local := from.In(time.Local)
+		end := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, time.Local)
+		if end.After(to) {
+			end = to
+		}
+		date := local.Format(dayLayout)
+		n := len(p.Days)
+		if n == 0 || p.Days[n-1].Date != date {
+			p.Days = append(p.Days, DayBucket{Date: date})
+			n++
+		}
+		p.Days[n-1].add(p.State, end.Sub(from).Seconds())
+		from = end
+	}
+	p.AccruedUntil = to
+}
+
+// portTotals 端口在 [from, to) 内的状态时长与当月的按天聚合；区间内未聚合到的时长（跟踪开始前）计为未监控
+func portTotals(p *PortHistory, from, to time.Time) (Totals, []DayBucket) {
+	var totals Totals
+	days := []DayBucket{}
+	prefix := from.Format(monthLayout) + "-"
+	for _, b := range p.Days {
+		if !strings.HasPrefix(b.Date, prefix) {
+			continue
+		}
+		days = append(days, b)
+		totals.AvailableSeconds += b.AvailableSeconds
+		totals.FaultedSeconds += b.FaultedSeconds
+		totals.OfflineSeconds += b.OfflineSeconds
+	}
+	totals.MonitoredSeconds = totals.AvailableSeconds + totals.FaultedSeconds + totals.OfflineSeconds
+	if elapsed := to.Sub(from).Seconds(); elapsed > totals.MonitoredSeconds {
+		totals.UnmonitoredSeconds = elapsed - totals.MonitoredSeconds
+	}
+	totals.finish()
+	return totals, days
+}
+
+// monthRange 月份的统计区间 [当月1日零点, 下月1日零点与 now 的较早者)
+func monthRange(month, now time.Time) (time.Time, time.Time) {
+	local := month.In(time.Local)
+	from := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, 0)
+	if now.Before(to) {
+		to = now
+	}
+	if to.Before(from) {
+		to = from
+	}
+	return from, to
+}
+
+// ParseMonth 解析查询月份 YYYY-MM（本地时区），为空时取 now 所在月份；不接受晚于当月的月份
+func ParseMonth(month string, now time.Time) (time.Time, error) {
+	current := time.Date(now.In(time.Local).Year(), now.In(time.Local).Month(), 1, 0, 0, 0, 0, time.Local)
+	if month == "" {
+		return current, nil
+	}
+	t, err := time.ParseInLocation(monthLayout, month, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("月份格式应为 YYYY-MM: %s", month)
+	}
+	if t.After(current) {
+		return time.Time{}, fmt.Errorf("月份不能晚于当月: %s", month)
+	}
+	return t, nil
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalTracker atomic.Pointer[Tracker]
+
+func init() {
+	t, _ := NewTracker(nil, Options{})
+	globalTracker.Store(t)
+}
+
+// GetGlobalTracker 获取全局端口状态历史跟踪器（未按配置初始化时为仅内存的跟踪器）
+func GetGlobalTracker() *Tracker {
+	return globalTracker.Load()
+}
+
+// SetGlobalTracker 设置全局端口状态历史跟踪器
+func SetGlobalTracker(t *Tracker) {
+	globalTracker.Store(t)
+}
+
+// InitGlobalTracker 按配置创建全局跟踪器、恢复持久化历史（重启间隙计为未监控）并启动定期聚合（需在Redis初始化之后调用）
+func InitGlobalTracker(ctx context.Context) error {
+	cfg := config.GetConfig().PortAvailability
+
+	var store Store
+	storeType := cfg.Store
+	switch storeType {
+	case "", StoreTypeFile:
+		storeType = StoreTypeFile
+		path := cfg.FilePath
+		if path == "" {
+			path = defaultFilePath
+		}
+		store = NewFileStore(path)
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("端口状态历史配置为redis存储，但Redis未连接")
+		}
+		key := cfg.RedisKey
+		if key == "" {
+			key = defaultRedisKey
+		}
+		store = NewRedisStore(client, key)
+	case StoreTypeMemory:
+	default:
+		return fmt.Errorf("不支持的端口状态历史存储方式: %s", cfg.Store)
+	}
+
+	t, err := NewTracker(store, Options{
+		StoreType:      storeType,
+		MaxTransitions: cfg.MaxTransitionsPerDevice,
+		RetentionDays:  cfg.RetentionDays,
+		RestartGrace:   time.Duration(cfg.RestartGraceSeconds) * time.Second,
+		FlushInterval:  time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	resumed := t.Resume(time.Now())
+	globalTracker.Store(t)
+	t.Start(ctx)
+
+	t.mu.Lock()
+	devices := len(t.devices)
+	t.mu.Unlock()
+	logger.WithFields(logrus.Fields{
+		"store":   storeType,
+		"devices": devices,
+		"resumed": resumed,
+	}).Info("端口状态历史已初始化")
+	return nil
+}
+
+// StopGlobalTracker 停止定期聚合并持久化最终状态
+func StopGlobalTracker() {
+	if err := GetGlobalTracker().Stop(); err != nil {
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("停机时持久化端口状态历史失败")
+	}
+}
@@ -0,0 +1,294 @@
+// Package capability 设备固件能力：按设备类型与固件版本从能力矩阵推导设备支持的下行命令，
+// API在下发前校验，老固件不支持的命令（如0x8A修改充电、0x90~0x93参数查询）直接返回 UNSUPPORTED_BY_FIRMWARE，
+// 不再下发注定超时的帧。矩阵只约束其中出现过的命令，未列出的命令（如各类应答）不受限制。
+package capability
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// 版本未知（未上报、无法解析或不在任何规则范围内）时的处理策略
+const (
+	PolicyMinimal = "minimal" // 仅允许矩阵中的基础命令
+	PolicyFull    = "full"    // 允许全部受管命令（按新固件处理）
+)
+
+// 能力集来源
+const (
+	SourceMatrix   = "matrix"   // 命中矩阵规则
+	SourceFallback = "fallback" // 版本未知，按回退策略
+	SourceOverride = "override" // 在矩阵结果上叠加了单设备例外
+)
+
+// ErrorCodeUnsupportedByFirmware 设备固件不支持请求命令时响应中的错误码
+const ErrorCodeUnsupportedByFirmware = "UNSUPPORTED_BY_FIRMWARE"
+
+// Rule 矩阵规则：设备类型与版本范围（均含边界）命中时，在基础命令之上支持的命令
+type Rule struct {
+	Name        string   `json:"name"`
+	DeviceTypes []uint16 `json:"deviceTypes,omitempty"` // 为空表示所有设备类型
+	MinVersion  string   `json:"minVersion,omitempty"`  // 为空表示不限下界
+	MaxVersion  string   `json:"maxVersion,omitempty"`  // 为空表示不限上界
+	Commands    []byte   `json:"-"`
+}
+
+// Matrix 能力矩阵（加载后只读）
+type Matrix struct {
+	Minimal  []byte // 所有固件均支持的基础命令
+	Rules    []Rule // 按顺序匹配，首条命中生效
+	governed map[byte]bool
+}
+
+// matrixFile 矩阵文件结构
+type matrixFile struct {
+	Minimal []string `yaml:"minimal"`
+	Rules   []struct {
+		Name        string   `yaml:"name"`
+		DeviceTypes []uint16 `yaml:"deviceTypes"`
+		MinVersion  string   `yaml:"minVersion"`
+		MaxVersion  string   `yaml:"maxVersion"`
+		Commands    []string `yaml:"commands"`
+	} `yaml:"rules"`
+}
+
+// ParseMatrix 解析并校验能力矩阵（YAML），任何一处错误都拒绝整个矩阵
+func ParseMatrix(data []byte) (*Matrix, error) {
+	var file matrixFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析能力矩阵失败: %w", err)
+	}
+
+	m := &Matrix{governed: make(map[byte]bool)}
+	minimal, err := parseCommands(file.Minimal)
+	if err != nil {
+		return nil, fmt.Errorf("minimal: %w", err)
+	}
+	m.Minimal = minimal
+
+	names := make(map[string]bool, len(file.Rules))
+	for i, raw := range file.Rules {
+		if raw.Name == "" {
+			return nil, fmt.Errorf("第%d条规则缺少name", i+1)
+		}
+		if names[raw.Name] {
+			return nil, fmt.Errorf("规则名重复: %s", raw.Name)
+		}
+		names[raw.Name] = true
+		if raw.MinVersion != "" && versionParts(raw.MinVersion) == nil {
+			return nil, fmt.Errorf("规则 %s 的minVersion无法解析: %s", raw.Name, raw.MinVersion)
+		}
+		if raw.MaxVersion != "" && versionParts(raw.MaxVersion) == nil {
+			return nil, fmt.Errorf("规则 %s 的maxVersion无法解析: %s", raw.Name, raw.MaxVersion)
+		}
+		if raw.MinVersion != "" && raw.MaxVersion != "" && CompareVersion(raw.MinVersion, raw.MaxVersion) > 0 {
+			return nil, fmt.Errorf("规则 %s 的版本范围无效: %s > %s", raw.Name, raw.MinVersion, raw.MaxVersion)
+		}
+		commands, err := parseCommands(raw.Commands)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %s: %w", raw.Name, err)
+		}
+		m.Rules = append(m.Rules, Rule{
+			Name:        raw.Name,
+			DeviceTypes: raw.DeviceTypes,
+			MinVersion:  raw.MinVersion,
+			MaxVersion:  raw.MaxVersion,
+			Commands:    commands,
+		})
+	}
+
+	for _, cmd := range m.Minimal {
+		m.governed[cmd] = true
+	}
+	for _, rule := range m.Rules {
+		for _, cmd := range rule.Commands {
+			m.governed[cmd] = true
+		}
+	}
+	return m, nil
+}
+
+// parseCommands 解析命令码（"0x8A" 或 "8A"），须为协议中已登记的命令
+func parseCommands(values []string) ([]byte, error) {
+	commands := make([]byte, 0, len(values))
+	for _, value := range values {
+		text := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(value), "0x"), "0X")
+		code, err := strconv.ParseUint(text, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("命令码格式错误: %q", value)
+		}
+		if _, ok := constants.GetCommandInfo(uint8(code)); !ok {
+			return nil, fmt.Errorf("未知命令: %s", value)
+		}
+		commands = append(commands, byte(code))
+	}
+	return commands, nil
+}
+
+// Governed 命令是否受矩阵约束
+func (m *Matrix) Governed(cmd byte) bool {
+	return m.governed[cmd]
+}
+
+// Match 返回首条命中设备类型与版本的规则；版本无法解析时不命中任何规则
+func (m *Matrix) Match(deviceType uint16, version string) (*Rule, bool) {
+	if versionParts(version) == nil {
+		return nil, false
+	}
+	for i := range m.Rules {
+		rule := &m.Rules[i]
+		if len(rule.DeviceTypes) > 0 && !containsType(rule.DeviceTypes, deviceType) {
+			continue
+		}
+		if rule.MinVersion != "" && CompareVersion(version, rule.MinVersion) < 0 {
+			continue
+		}
+		if rule.MaxVersion != "" && CompareVersion(version, rule.MaxVersion) > 0 {
+			continue
+		}
+		return rule, true
+	}
+	return nil, false
+}
+
+// Resolve 推导设备能力集：命中规则时为基础命令加规则命令，否则按回退策略
+func (m *Matrix) Resolve(deviceType uint16, version, policy string) *Set {
+	set := &Set{
+		DeviceType: deviceType,
+		Version:    version,
+		ResolvedAt: time.Now(),
+		governed:   make(map[byte]bool, len(m.governed)),
+		supported:  make(map[byte]bool, len(m.governed)),
+	}
+	for cmd := range m.governed {
+		set.governed[cmd] = true
+	}
+	for _, cmd := range m.Minimal {
+		set.supported[cmd] = true
+	}
+
+	if rule, ok := m.Match(deviceType, version); ok {
+		set.Source = SourceMatrix
+		set.Rule = rule.Name
+		for _, cmd := range rule.Commands {
+			set.supported[cmd] = true
+		}
+	} else {
+		set.Source = SourceFallback
+		set.Policy = policy
+		if policy == PolicyFull {
+			for cmd := range m.governed {
+				set.supported[cmd] = true
+			}
+		}
+	}
+	set.refreshLists()
+	return set
+}
+
+// Set 设备能力集
+type Set struct {
+	Source      string    `json:"source"`           // matrix | fallback | override
+	Rule        string    `json:"rule,omitempty"`   // 命中的矩阵规则
+	Policy      string    `json:"policy,omitempty"` // 回退时采用的策略
+	DeviceType  uint16    `json:"deviceType"`
+	Version     string    `json:"version"`
+	Supported   []string  `json:"supported"`   // 支持的受管命令
+	Unsupported []string  `json:"unsupported"` // 不支持的受管命令（API直接拒绝）
+	Override    *Override `json:"override,omitempty"`
+	ResolvedAt  time.Time `json:"resolvedAt"`
+
+	governed  map[byte]bool
+	supported map[byte]bool
+}
+
+// Supports 设备是否支持命令；nil 能力集（未启用矩阵或尚未注册）与不受约束的命令均视为支持
+func (s *Set) Supports(cmd byte) bool {
+	if s == nil || !s.governed[cmd] {
+		return true
+	}
+	return s.supported[cmd]
+}
+
+// applyOverride 在能力集上叠加单设备例外（allow 追加支持，deny 优先移除）
+func (s *Set) applyOverride(o Override) {
+	for _, cmd := range o.allow {
+		s.governed[cmd] = true
+		s.supported[cmd] = true
+	}
+	for _, cmd := range o.deny {
+		s.governed[cmd] = true
+		delete(s.supported, cmd)
+	}
+	s.Source = SourceOverride
+	s.Override = &o
+	s.refreshLists()
+}
+
+func (s *Set) refreshLists() {
+	s.Supported, s.Unsupported = []string{}, []string{}
+	for cmd := range s.governed {
+		if s.supported[cmd] {
+			s.Supported = append(s.Supported, FormatCommand(cmd))
+		} else {
+			s.Unsupported = append(s.Unsupported, FormatCommand(cmd))
+		}
+	}
+	sort.Strings(s.Supported)
+	sort.Strings(s.Unsupported)
+}
+
+// FormatCommand 命令码的展示格式（0x8A）
+func FormatCommand(cmd byte) string {
+	return fmt.Sprintf("0x%02X", cmd)
+}
+
+func containsType(types []uint16, t uint16) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareVersion 按数字段比较固件版本（"V2.31" 与 "2.31" 等价），a<b 返回-1，相等返回0，a>b 返回1
+func CompareVersion(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts 提取版本号中的数字段，不含数字时返回 nil（视为未知版本）
+func versionParts(v string) []int {
+	fields := strings.FieldsFunc(v, func(r rune) bool { return r < '0' || r > '9' })
+	if len(fields) == 0 {
+		return nil
+	}
+	parts := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, _ := strconv.Atoi(f)
+		parts = append(parts, n)
+	}
+	return parts
+}
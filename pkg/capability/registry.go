@@ -0,0 +1,396 @@
+package capability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// Override 单设备能力例外（如个别设备已升级但版本上报有误）
+type Override struct {
+	DeviceID  string    `json:"deviceId"`
+	Allow     []string  `json:"allow,omitempty"` // 额外支持的命令
+	Deny      []string  `json:"deny,omitempty"`  // 不支持的命令（优先于 allow 与矩阵）
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	allow []byte
+	deny  []byte
+}
+
+// UnsupportedError 设备固件不支持请求的命令
+type UnsupportedError struct {
+	DeviceID string
+	Command  byte
+	Version  string
+	Set      *Set
+}
+
+func (e *UnsupportedError) Error() string {
+	version := e.Version
+	if version == "" {
+		version = "未知"
+	}
+	return fmt.Sprintf("设备 %s 固件(%s)不支持命令 %s", e.DeviceID, version, FormatCommand(e.Command))
+}
+
+// Status 能力矩阵状态（运维接口）
+type Status struct {
+	Enabled       bool       `json:"enabled"`
+	MatrixFile    string     `json:"matrixFile"`
+	Policy        string     `json:"unknownVersionPolicy"`
+	Minimal       []string   `json:"minimal"`
+	Rules         []RuleView `json:"rules"`
+	LoadedAt      time.Time  `json:"loadedAt"`
+	LastLoadError string     `json:"lastLoadError,omitempty"` // 最近一次热加载失败原因（继续使用旧矩阵）
+	Overrides     []Override `json:"overrides"`
+}
+
+// RuleView 规则的展示格式
+type RuleView struct {
+	Rule
+	Commands []string `json:"commands"`
+}
+
+// Registry 能力矩阵与单设备例外；矩阵可热加载，加载失败保留旧矩阵
+type Registry struct {
+	path          string
+	policy        string
+	overridesPath string
+
+	matrix atomic.Pointer[Matrix]
+
+	mu            sync.Mutex
+	modTime       time.Time
+	size          int64
+	loadedAt      time.Time
+	lastLoadError string
+	overrides     map[string]Override
+}
+
+// NewRegistry 创建注册表：path 为空时不加载矩阵（不做能力校验），overridesPath 为空时例外仅保存在内存
+func NewRegistry(path, policy, overridesPath string) (*Registry, error) {
+	switch policy {
+	case "":
+		policy = PolicyFull
+	case PolicyMinimal, PolicyFull:
+	default:
+		return nil, fmt.Errorf("不支持的未知版本策略: %s", policy)
+	}
+	r := &Registry{path: path, policy: policy, overridesPath: overridesPath, overrides: make(map[string]Override)}
+	if path != "" {
+		if err := r.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.loadOverrides(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetMatrix 直接替换矩阵（nil 表示禁用能力校验）
+func (r *Registry) SetMatrix(m *Matrix) {
+	r.matrix.Store(m)
+	r.mu.Lock()
+	r.loadedAt = time.Now()
+	r.lastLoadError = ""
+	r.mu.Unlock()
+	r.changed()
+}
+
+// Reload 重新加载矩阵文件，校验失败时保留旧矩阵
+func (r *Registry) Reload() error {
+	if r.path == "" {
+		return fmt.Errorf("未配置设备能力矩阵文件")
+	}
+	stat, err := os.Stat(r.path)
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(r.path); err == nil {
+			var m *Matrix
+			if m, err = ParseMatrix(data); err == nil {
+				r.matrix.Store(m)
+				r.mu.Lock()
+				r.modTime, r.size = stat.ModTime(), stat.Size()
+				r.loadedAt = time.Now()
+				r.lastLoadError = ""
+				r.mu.Unlock()
+				logger.WithFields(logrus.Fields{
+					"path":  r.path,
+					"rules": len(m.Rules),
+				}).Info("设备能力矩阵已加载")
+				r.changed()
+				return nil
+			}
+		}
+	}
+	err = fmt.Errorf("加载设备能力矩阵失败: %w", err)
+	r.mu.Lock()
+	r.lastLoadError = err.Error()
+	r.mu.Unlock()
+	return err
+}
+
+// Watch 定期检查矩阵文件变更并热加载，随ctx取消退出
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || r.path == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stat, err := os.Stat(r.path)
+				r.mu.Lock()
+				unchanged := err != nil || (stat.ModTime().Equal(r.modTime) && stat.Size() == r.size)
+				if err == nil {
+					r.modTime, r.size = stat.ModTime(), stat.Size()
+				}
+				r.mu.Unlock()
+				if unchanged {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					logger.WithFields(logrus.Fields{
+						"path":  r.path,
+						"error": err,
+					}).Warn("设备能力矩阵热加载失败，继续使用旧矩阵")
+				}
+			}
+		}
+	}()
+}
+
+// Resolve 推导设备能力集并叠加单设备例外；未加载矩阵时返回 nil（不做校验）
+func (r *Registry) Resolve(deviceID string, deviceType uint16, version string) *Set {
+	m := r.matrix.Load()
+	if m == nil {
+		return nil
+	}
+	set := m.Resolve(deviceType, version, r.policy)
+	r.mu.Lock()
+	override, ok := r.overrides[deviceID]
+	r.mu.Unlock()
+	if ok {
+		set.applyOverride(override)
+	}
+	return set
+}
+
+// SetOverride 设置单设备例外（命令码须为已登记命令）
+func (r *Registry) SetOverride(o Override) (Override, error) {
+	if o.DeviceID == "" {
+		return Override{}, fmt.Errorf("设备ID不能为空")
+	}
+	if len(o.Allow) == 0 && len(o.Deny) == 0 {
+		return Override{}, fmt.Errorf("allow 与 deny 不能同时为空")
+	}
+	if err := o.parse(); err != nil {
+		return Override{}, err
+	}
+	o.UpdatedAt = time.Now()
+	r.mu.Lock()
+	r.overrides[o.DeviceID] = o
+	err := r.saveOverridesLocked()
+	r.mu.Unlock()
+	r.changed()
+	return o, err
+}
+
+// RemoveOverride 删除单设备例外，不存在时返回 false
+func (r *Registry) RemoveOverride(deviceID string) (bool, error) {
+	r.mu.Lock()
+	if _, ok := r.overrides[deviceID]; !ok {
+		r.mu.Unlock()
+		return false, nil
+	}
+	delete(r.overrides, deviceID)
+	err := r.saveOverridesLocked()
+	r.mu.Unlock()
+	r.changed()
+	return true, err
+}
+
+// Status 矩阵与例外状态
+func (r *Registry) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := Status{
+		MatrixFile:    r.path,
+		Policy:        r.policy,
+		LoadedAt:      r.loadedAt,
+		LastLoadError: r.lastLoadError,
+		Minimal:       []string{},
+		Rules:         []RuleView{},
+		Overrides:     make([]Override, 0, len(r.overrides)),
+	}
+	if m := r.matrix.Load(); m != nil {
+		status.Enabled = true
+		status.Minimal = formatCommands(m.Minimal)
+		for _, rule := range m.Rules {
+			status.Rules = append(status.Rules, RuleView{Rule: rule, Commands: formatCommands(rule.Commands)})
+		}
+	}
+	for _, o := range r.overrides {
+		status.Overrides = append(status.Overrides, o)
+	}
+	sort.Slice(status.Overrides, func(i, j int) bool { return status.Overrides[i].DeviceID < status.Overrides[j].DeviceID })
+	return status
+}
+
+func (o *Override) parse() error {
+	var err error
+	if o.allow, err = parseCommands(o.Allow); err != nil {
+		return fmt.Errorf("allow: %w", err)
+	}
+	if o.deny, err = parseCommands(o.Deny); err != nil {
+		return fmt.Errorf("deny: %w", err)
+	}
+	o.Allow, o.Deny = formatCommands(o.allow), formatCommands(o.deny)
+	return nil
+}
+
+// loadOverrides 读取持久化的单设备例外，文件不存在视为无例外
+func (r *Registry) loadOverrides() error {
+	if r.overridesPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.overridesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取设备能力例外文件失败: %w", err)
+	}
+	var list []Override
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("解析设备能力例外文件失败: %w", err)
+	}
+	for _, o := range list {
+		if err := o.parse(); err != nil {
+			return fmt.Errorf("设备 %s 的能力例外无效: %w", o.DeviceID, err)
+		}
+		r.overrides[o.DeviceID] = o
+	}
+	return nil
+}
+
+// saveOverridesLocked 持久化单设备例外（先写临时文件再重命名）
+func (r *Registry) saveOverridesLocked() error {
+	if r.overridesPath == "" {
+		return nil
+	}
+	list := make([]Override, 0, len(r.overrides))
+	for _, o := range r.overrides {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(r.overridesPath); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建设备能力例外目录失败: %w", err)
+		}
+	}
+	tmp := r.overridesPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入设备能力例外文件失败: %w", err)
+	}
+	return os.Rename(tmp, r.overridesPath)
+}
+
+// changed 矩阵或例外变更后通知回调（仅全局注册表）
+func (r *Registry) changed() {
+	if GetGlobalRegistry() == r {
+		notifyChange()
+	}
+}
+
+func formatCommands(commands []byte) []string {
+	out := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		out = append(out, FormatCommand(cmd))
+	}
+	return out
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalRegistry atomic.Pointer[Registry]
+
+// GetGlobalRegistry 获取全局能力注册表，未初始化时返回nil
+func GetGlobalRegistry() *Registry {
+	return globalRegistry.Load()
+}
+
+// SetGlobalRegistry 设置全局能力注册表（nil 表示禁用），并通知变更回调
+func SetGlobalRegistry(r *Registry) {
+	globalRegistry.Store(r)
+	notifyChange()
+}
+
+var (
+	changeMu       sync.RWMutex
+	changeHandlers []func()
+)
+
+// OnChange 注册能力变更回调（矩阵热加载、例外增删或更换注册表后调用），用于刷新在线设备上保存的能力集
+func OnChange(handler func()) {
+	changeMu.Lock()
+	defer changeMu.Unlock()
+	changeHandlers = append(changeHandlers, handler)
+}
+
+func notifyChange() {
+	changeMu.RLock()
+	handlers := append([]func(){}, changeHandlers...)
+	changeMu.RUnlock()
+	for _, handler := range handlers {
+		handler()
+	}
+}
+
+// Resolve 通过全局注册表推导设备能力集，未启用时返回nil
+func Resolve(deviceID string, deviceType uint16, version string) *Set {
+	r := GetGlobalRegistry()
+	if r == nil {
+		return nil
+	}
+	return r.Resolve(deviceID, deviceType, version)
+}
+
+// InitGlobalRegistry 按配置初始化全局能力注册表并启动矩阵文件热加载
+func InitGlobalRegistry(ctx context.Context) error {
+	cfg := config.GetConfig().Capabilities
+	r, err := NewRegistry(cfg.MatrixFile, cfg.UnknownVersionPolicy, cfg.OverridesFile)
+	if err != nil {
+		return err
+	}
+	r.Watch(ctx, time.Duration(cfg.ReloadIntervalSeconds)*time.Second)
+	SetGlobalRegistry(r)
+	logger.WithFields(logrus.Fields{
+		"matrixFile": cfg.MatrixFile,
+		"policy":     r.policy,
+	}).Info("设备能力矩阵已启用")
+	return nil
+}
@@ -0,0 +1,569 @@
+// Package changelog 运维变更记录：记录所有改变设备或网关状态的API调用（调用方、请求体、目标设备、前后状态快照与结果），供审计追溯
+package changelog
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// 默认参数
+const (
+	defaultCapacity         = 5000
+	defaultMaxBodyBytes     = 4096
+	defaultMaxSnapshotBytes = 8192
+	defaultSnapshotTimeout  = 100 * time.Millisecond
+	defaultFilePath         = "./data/changelog.jsonl"
+	defaultRedisKey         = "iot:changelog"
+	defaultKeyHeader        = "X-API-Key-Name"
+	defaultTenantHeader     = "X-Tenant-ID"
+	maxSnapshotDevices      = 16   // 单次请求最多采集快照的设备数
+	persistQueueSize        = 1024 // 持久化队列，满时丢弃（内存中仍保留）
+	redactedValue           = "***"
+	truncatedSuffix         = "...(truncated)"
+)
+
+// 调用结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Record 一次变更类API调用
+type Record struct {
+	ID                uint64                     `json:"id"`
+	Timestamp         time.Time                  `json:"timestamp"`
+	CorrelationID     string                     `json:"correlationId,omitempty"`
+	KeyName           string                     `json:"keyName,omitempty"` // 调用方API Key名称（不记录密钥本身）
+	Tenant            string                     `json:"tenant,omitempty"`
+	ClientIP          string                     `json:"clientIp"`
+	Method            string                     `json:"method"`
+	Endpoint          string                     `json:"endpoint"` // 路由模板，如 /api/v1/device/:deviceId/reboot
+	Path              string                     `json:"path"`
+	Devices           []string                   `json:"devices,omitempty"`
+	RequestBody       string                     `json:"requestBody,omitempty"` // 已脱敏
+	BodyTruncated     bool                       `json:"bodyTruncated,omitempty"`
+	Before            map[string]json.RawMessage `json:"before,omitempty"` // deviceID → 调用前状态快照
+	After             map[string]json.RawMessage `json:"after,omitempty"`  // deviceID → 调用后状态快照
+	SnapshotTruncated bool                       `json:"snapshotTruncated,omitempty"`
+	SnapshotError     string                     `json:"snapshotError,omitempty"` // 快照尽力采集，失败或超时不影响调用本身
+	Status            int                        `json:"status"`
+	Outcome           string                     `json:"outcome"`
+	Message           string                     `json:"message,omitempty"`
+	DurationMs        int64                      `json:"durationMs"`
+}
+
+// Filter 查询条件（空值表示不限）
+type Filter struct {
+	DeviceID string
+	KeyName  string
+	Endpoint string // 路由模板或请求路径包含该字符串
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// Options 变更记录参数
+type Options struct {
+	Capacity         int           // 内存保留条数
+	MaxBodyBytes     int           // 请求体超过该长度截断
+	MaxSnapshotBytes int           // 单台设备快照超过该长度截断
+	SnapshotTimeout  time.Duration // 单次快照采集超时
+	RedactFields     []string      // 请求体中需脱敏的字段名（不区分大小写，任意层级）
+	KeyHeader        string        // 调用方API Key名称请求头
+	TenantHeader     string        // 租户请求头
+	ExcludeEndpoints []string      // 不记录的变更方法路由模板（只读性质的POST等）
+	Store            Store         // 持久化，nil表示仅内存
+	StoreType        string
+}
+
+// Snapshotter 采集设备当前状态快照
+type Snapshotter func(deviceID string) interface{}
+
+// Log 有界的变更记录（内存环形保留最近 Capacity 条，可选异步持久化）
+type Log struct {
+	opts    Options
+	redact  map[string]struct{}
+	exclude map[string]struct{}
+	nextID  atomic.Uint64
+
+	mu      sync.RWMutex
+	records []Record // 按时间先后
+	start   int      // 环形起点
+
+	snapshot atomic.Value // Snapshotter
+	persist  chan Record
+	dropped  atomic.Int64
+	lastErr  atomic.Value // string
+}
+
+// NewLog 创建变更记录（未设置的参数取默认值）
+func NewLog(opts Options) *Log {
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultCapacity
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if opts.MaxSnapshotBytes <= 0 {
+		opts.MaxSnapshotBytes = defaultMaxSnapshotBytes
+	}
+	if opts.SnapshotTimeout <= 0 {
+		opts.SnapshotTimeout = defaultSnapshotTimeout
+	}
+	if opts.KeyHeader == "" {
+		opts.KeyHeader = defaultKeyHeader
+	}
+	if opts.TenantHeader == "" {
+		opts.TenantHeader = defaultTenantHeader
+	}
+	if opts.StoreType == "" {
+		opts.StoreType = StoreTypeMemory
+	}
+	l := &Log{
+		opts:    opts,
+		redact:  make(map[string]struct{}, len(opts.RedactFields)),
+		exclude: make(map[string]struct{}, len(opts.ExcludeEndpoints)),
+		records: make([]Record, 0, opts.Capacity),
+	}
+	for _, f := range opts.RedactFields {
+		l.redact[strings.ToLower(strings.TrimSpace(f))] = struct{}{}
+	}
+	for _, e := range opts.ExcludeEndpoints {
+		l.exclude[strings.TrimSpace(e)] = struct{}{}
+	}
+	if opts.Store != nil {
+		l.persist = make(chan Record, persistQueueSize)
+	}
+	return l
+}
+
+// Options 生效的参数
+func (l *Log) Options() Options {
+	return l.opts
+}
+
+// SetSnapshotter 设置设备状态快照采集函数
+func (l *Log) SetSnapshotter(fn Snapshotter) {
+	l.snapshot.Store(fn)
+}
+
+// Excluded 路由是否不记录
+func (l *Log) Excluded(endpoint string) bool {
+	_, ok := l.exclude[endpoint]
+	return ok
+}
+
+// Restore 从持久化恢复最近的记录（启动时调用）
+func (l *Log) Restore() error {
+	if l.opts.Store == nil {
+		return nil
+	}
+	records, err := l.opts.Store.LoadRecent(l.opts.Capacity)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, rec := range records {
+		l.appendLocked(rec)
+		if rec.ID > l.nextID.Load() {
+			l.nextID.Store(rec.ID)
+		}
+	}
+	return nil
+}
+
+// Append 记录一次调用（分配ID），持久化异步进行，队列满时仅保留在内存
+func (l *Log) Append(rec Record) Record {
+	rec.ID = l.nextID.Add(1)
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	if rec.Outcome == "" {
+		rec.Outcome = OutcomeSuccess
+		if rec.Status >= 400 {
+			rec.Outcome = OutcomeFailure
+		}
+	}
+	l.mu.Lock()
+	l.appendLocked(rec)
+	l.mu.Unlock()
+
+	if l.persist != nil {
+		select {
+		case l.persist <- rec:
+		default:
+			l.dropped.Add(1)
+		}
+	}
+	return rec
+}
+
+func (l *Log) appendLocked(rec Record) {
+	if len(l.records) < l.opts.Capacity {
+		l.records = append(l.records, rec)
+		return
+	}
+	l.records[l.start] = rec
+	l.start = (l.start + 1) % len(l.records)
+}
+
+// Query 按条件查询，按时间倒序
+func (l *Log) Query(f Filter) []Record {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	result := make([]Record, 0)
+	n := len(l.records)
+	for i := n - 1; i >= 0; i-- {
+		rec := l.records[(l.start+i)%n]
+		if !f.match(rec) {
+			continue
+		}
+		result = append(result, rec)
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func (f Filter) match(rec Record) bool {
+	if f.KeyName != "" && rec.KeyName != f.KeyName {
+		return false
+	}
+	if f.Endpoint != "" && !strings.Contains(rec.Endpoint, f.Endpoint) && !strings.Contains(rec.Path, f.Endpoint) {
+		return false
+	}
+	if !f.From.IsZero() && rec.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && rec.Timestamp.After(f.To) {
+		return false
+	}
+	if f.DeviceID != "" {
+		for _, d := range rec.Devices {
+			if strings.EqualFold(d, f.DeviceID) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// PrepareBody 请求体脱敏并截断：JSON按字段名脱敏，非JSON原样记录
+func (l *Log) PrepareBody(raw []byte) (string, bool) {
+	if len(raw) == 0 {
+		return "", false
+	}
+	body := string(raw)
+	if len(l.redact) > 0 {
+		var v interface{}
+		if json.Unmarshal(raw, &v) == nil {
+			if data, err := json.Marshal(l.redactValue(v)); err == nil {
+				body = string(data)
+			}
+		}
+	}
+	return truncate(body, l.opts.MaxBodyBytes)
+}
+
+func (l *Log) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if _, ok := l.redact[strings.ToLower(k)]; ok {
+				val[k] = redactedValue
+				continue
+			}
+			val[k] = l.redactValue(child)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = l.redactValue(child)
+		}
+	}
+	return v
+}
+
+// CaptureSnapshots 尽力采集设备状态快照：超时、panic或序列化失败只记录错误，不影响调用本身
+func (l *Log) CaptureSnapshots(deviceIDs []string) (map[string]json.RawMessage, bool, string) {
+	fn, _ := l.snapshot.Load().(Snapshotter)
+	if fn == nil || len(deviceIDs) == 0 {
+		return nil, false, ""
+	}
+	if len(deviceIDs) > maxSnapshotDevices {
+		deviceIDs = deviceIDs[:maxSnapshotDevices]
+	}
+
+	type result struct {
+		snapshots map[string]json.RawMessage
+		truncated bool
+		err       string
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			if p := recover(); p != nil {
+				r.snapshots, r.truncated = nil, false
+				r.err = fmt.Sprintf("快照采集异常: %v", p)
+			}
+			done <- r
+		}()
+		r.snapshots = make(map[string]json.RawMessage, len(deviceIDs))
+		for _, id := range deviceIDs {
+			data, err := json.Marshal(fn(id))
+			if err != nil {
+				r.err = "快照序列化失败: " + err.Error()
+				continue
+			}
+			if len(data) > l.opts.MaxSnapshotBytes {
+				preview, _ := truncate(string(data), l.opts.MaxSnapshotBytes)
+				data, _ = json.Marshal(preview)
+				r.truncated = true
+			}
+			r.snapshots[id] = data
+		}
+	}()
+
+	timer := time.NewTimer(l.opts.SnapshotTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.snapshots, r.truncated, r.err
+	case <-timer.C:
+		return nil, false, "快照采集超时"
+	}
+}
+
+// truncate 超过 limit 字节时截断（不切断UTF-8字符）并追加标记
+func truncate(s string, limit int) (string, bool) {
+	if len(s) <= limit {
+		return s, false
+	}
+	cut := limit
+	for cut > 0 && cut < len(s) && s[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	return s[:cut] + truncatedSuffix, true
+}
+
+// Start 启动异步持久化（批量写入），随ctx取消写完队列后退出
+func (l *Log) Start(ctx context.Context) {
+	if l.persist == nil {
+		return
+	}
+	go func() {
+		batch := make([]Record, 0, 64)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := l.opts.Store.Append(batch); err != nil {
+				l.lastErr.Store(err.Error())
+				logger.WithFields(logrus.Fields{"records": len(batch), "error": err.Error()}).Warn("变更记录持久化失败，仅保留在内存")
+			}
+			batch = batch[:0]
+		}
+		for {
+			select {
+			case rec := <-l.persist:
+				batch = append(batch, rec)
+				// 取尽已排队的记录再写，减少写入次数
+				for drained := false; !drained && len(batch) < cap(batch); {
+					select {
+					case more := <-l.persist:
+						batch = append(batch, more)
+					default:
+						drained = true
+					}
+				}
+				flush()
+			case <-ctx.Done():
+				for {
+					select {
+					case rec := <-l.persist:
+						batch = append(batch, rec)
+					default:
+						flush()
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stats 统计信息
+func (l *Log) Stats() map[string]interface{} {
+	l.mu.RLock()
+	retained := len(l.records)
+	l.mu.RUnlock()
+	stats := map[string]interface{}{
+		"store":    l.opts.StoreType,
+		"capacity": l.opts.Capacity,
+		"retained": retained,
+		"dropped":  l.dropped.Load(),
+	}
+	if err, ok := l.lastErr.Load().(string); ok && err != "" {
+		stats["lastPersistError"] = err
+	}
+	return stats
+}
+
+// WriteCSV 导出CSV（快照为JSON文本）
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	header := []string{"id", "timestamp", "keyName", "tenant", "clientIp", "method", "endpoint", "path", "devices",
+		"status", "outcome", "message", "durationMs", "requestBody", "bodyTruncated", "before", "after", "snapshotTruncated", "snapshotError", "correlationId"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		row := []string{
+			strconv.FormatUint(rec.ID, 10),
+			rec.Timestamp.Format(time.RFC3339),
+			rec.KeyName,
+			rec.Tenant,
+			rec.ClientIP,
+			rec.Method,
+			rec.Endpoint,
+			rec.Path,
+			strings.Join(rec.Devices, ";"),
+			strconv.Itoa(rec.Status),
+			rec.Outcome,
+			rec.Message,
+			strconv.FormatInt(rec.DurationMs, 10),
+			rec.RequestBody,
+			strconv.FormatBool(rec.BodyTruncated),
+			snapshotText(rec.Before),
+			snapshotText(rec.After),
+			strconv.FormatBool(rec.SnapshotTruncated),
+			rec.SnapshotError,
+			rec.CorrelationID,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func snapshotText(snapshots map[string]json.RawMessage) string {
+	if len(snapshots) == 0 {
+		return ""
+	}
+	ids := make([]string, 0, len(snapshots))
+	for id := range snapshots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, id := range ids {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(id)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(snapshots[id])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalLog atomic.Pointer[Log]
+
+// GetGlobalLog 获取全局变更记录（未启用时为nil）
+func GetGlobalLog() *Log {
+	return globalLog.Load()
+}
+
+// SetGlobalLog 替换全局变更记录（传nil关闭记录）
+func SetGlobalLog(l *Log) {
+	globalLog.Store(l)
+}
+
+// InitGlobalLog 按配置创建全局变更记录、恢复持久化记录并启动异步持久化（需在Redis初始化之后调用）
+func InitGlobalLog(ctx context.Context) error {
+	cfg := config.GetConfig().ChangeLog
+	if !cfg.Enabled {
+		SetGlobalLog(nil)
+		return nil
+	}
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+
+	var store Store
+	storeType := cfg.Store
+	switch storeType {
+	case "", StoreTypeMemory:
+		storeType = StoreTypeMemory
+	case StoreTypeFile:
+		path := cfg.FilePath
+		if path == "" {
+			path = defaultFilePath
+		}
+		store = NewFileStore(path, capacity)
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("变更记录配置为redis存储，但Redis未连接")
+		}
+		key := cfg.RedisKey
+		if key == "" {
+			key = defaultRedisKey
+		}
+		store = NewRedisStore(client, key, capacity)
+	default:
+		return fmt.Errorf("不支持的变更记录存储方式: %s", cfg.Store)
+	}
+
+	l := NewLog(Options{
+		Capacity:         capacity,
+		MaxBodyBytes:     cfg.MaxBodyBytes,
+		MaxSnapshotBytes: cfg.MaxSnapshotBytes,
+		SnapshotTimeout:  time.Duration(cfg.SnapshotTimeoutMs) * time.Millisecond,
+		RedactFields:     cfg.RedactFields,
+		KeyHeader:        cfg.KeyHeader,
+		TenantHeader:     cfg.TenantHeader,
+		ExcludeEndpoints: cfg.ExcludeEndpoints,
+		Store:            store,
+		StoreType:        storeType,
+	})
+	if err := l.Restore(); err != nil {
+		logger.WithFields(logrus.Fields{"store": storeType, "error": err.Error()}).Warn("恢复变更记录失败，从空记录开始")
+	}
+	l.Start(ctx)
+	SetGlobalLog(l)
+
+	logger.WithFields(logrus.Fields{
+		"store":    storeType,
+		"capacity": capacity,
+		"restored": len(l.Query(Filter{})),
+	}).Info("运维变更记录已启用")
+	return nil
+}
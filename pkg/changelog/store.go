@@ -0,0 +1,237 @@
+package changelog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+)
+
+// 持久化方式
+const (
+	StoreTypeMemory = "memory"
+	StoreTypeFile   = "file"
+	StoreTypeRedis  = "redis"
+)
+
+// RecordType 变更记录的持久化类型（每条记录一个信封，旧版本在读取时迁移，不回写）
+const (
+	RecordType    = "changelog_record"
+	recordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(RecordType, recordVersion)
+}
+
+// decodeRecord 解析一条变更记录（无信封的旧格式视为版本1；版本未知的记录按持久化策略计入报告后跳过）
+func decodeRecord(data []byte) (Record, bool) {
+	var rec Record
+	_, err := persistence.Decode(RecordType, data, &rec)
+	return rec, err == nil
+}
+
+// Store 变更记录持久化（保留最近 capacity 条）
+type Store interface {
+	Append(records []Record) error
+	LoadRecent(limit int) ([]Record, error) // 按时间先后返回最近 limit 条
+}
+
+// FileStore JSON Lines 文件持久化：追加写入，行数超过保留上限两倍时压缩为最近 capacity 条
+type FileStore struct {
+	path     string
+	capacity int
+
+	mu    sync.Mutex
+	lines int
+}
+
+// NewFileStore 创建文件持久化
+func NewFileStore(path string, capacity int) *FileStore {
+	return &FileStore{path: path, capacity: capacity}
+}
+
+// Append 追加记录
+func (s *FileStore) Append(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, rec := range records {
+		data, err := persistence.Encode(RecordType, rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建变更记录目录失败: %w", err)
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开变更记录文件失败: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入变更记录文件失败: %w", err)
+	}
+	s.lines += len(records)
+	if s.capacity > 0 && s.lines > 2*s.capacity {
+		return s.compactLocked()
+	}
+	return nil
+}
+
+// LoadRecent 读取最近 limit 条记录，文件不存在视为无记录，无法解析的行跳过
+func (s *FileStore) LoadRecent(limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, lines, err := s.readLocked(limit)
+	if err != nil {
+		return nil, err
+	}
+	s.lines = lines
+	return records, nil
+}
+
+func (s *FileStore) readLocked(limit int) ([]Record, int, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取变更记录文件失败: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		lines++
+		rec, ok := decodeRecord(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		records = append(records, rec)
+		if limit > 0 && len(records) > limit {
+			records = records[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("读取变更记录文件失败: %w", err)
+	}
+	return records, lines, nil
+}
+
+// compactLocked 只保留最近 capacity 条（先写临时文件再重命名）
+func (s *FileStore) compactLocked() error {
+	records, _, err := s.readLocked(s.capacity)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, rec := range records {
+		data, err := persistence.Encode(RecordType, rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("压缩变更记录文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("压缩变更记录文件失败: %w", err)
+	}
+	s.lines = len(records)
+	return nil
+}
+
+// RedisStore Redis列表持久化（RPUSH后LTRIM保留最近 capacity 条）
+type RedisStore struct {
+	client   *redis.Client
+	key      string
+	capacity int
+	timeout  time.Duration
+}
+
+// NewRedisStore 创建Redis持久化
+func NewRedisStore(client *redis.Client, key string, capacity int) *RedisStore {
+	return &RedisStore{client: client, key: key, capacity: capacity, timeout: 3 * time.Second}
+}
+
+// Append 追加记录
+func (s *RedisStore) Append(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(records))
+	for _, rec := range records {
+		data, err := persistence.Encode(RecordType, rec)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	size := 0
+	for _, v := range values {
+		size += len(v.([]byte))
+	}
+	// Redis降级期间暂存，恢复后按顺序追加
+	return infraredis.ExecOrSpool(ctx, s.client, s.key, size, func(ctx context.Context, c *redis.Client) error {
+		pipe := c.TxPipeline()
+		pipe.RPush(ctx, s.key, values...)
+		if s.capacity > 0 {
+			pipe.LTrim(ctx, s.key, int64(-s.capacity), -1)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("写入Redis变更记录失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// LoadRecent 读取最近 limit 条记录
+func (s *RedisStore) LoadRecent(limit int) ([]Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	start := int64(0)
+	if limit > 0 {
+		start = int64(-limit)
+	}
+	items, err := s.client.LRange(ctx, s.key, start, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取Redis变更记录失败: %w", err)
+	}
+	records := make([]Record, 0, len(items))
+	for _, item := range items {
+		if rec, ok := decodeRecord([]byte(item)); ok {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
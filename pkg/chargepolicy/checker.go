@@ -0,0 +1,221 @@
+package chargepolicy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// LimitStats 单项限制的拒绝与告警次数
+type LimitStats struct {
+	Rejected uint64 `json:"rejected"`
+	Warned   uint64 `json:"warned"`
+}
+
+// Stats 校验计数
+type Stats struct {
+	Checks   uint64                `json:"checks"`
+	Rejected uint64                `json:"rejected"` // 被拒绝的请求数
+	Warned   uint64                `json:"warned"`   // 放行但带告警的请求数
+	ByLimit  map[string]LimitStats `json:"byLimit"`
+}
+
+// Status 策略状态（只读接口返回）
+type Status struct {
+	Enabled       bool                 `json:"enabled"`
+	PolicyFile    string               `json:"policyFile,omitempty"`
+	LoadedAt      time.Time            `json:"loadedAt"`
+	LastLoadError string               `json:"lastLoadError,omitempty"` // 最近一次热加载失败原因（继续使用旧策略）
+	Policy        Policy               `json:"policy"`
+	Global        Effective            `json:"global"`
+	Tenants       map[string]Effective `json:"tenants,omitempty"` // 各租户生效限制
+	Stats         Stats                `json:"stats"`
+}
+
+// Checker 充电参数策略：策略文件可热加载，加载失败保留旧策略
+type Checker struct {
+	path   string
+	policy atomic.Pointer[Policy]
+
+	mu            sync.Mutex
+	modTime       time.Time
+	size          int64
+	loadedAt      time.Time
+	lastLoadError string
+	stats         Stats
+}
+
+// NewChecker 创建策略校验器：path 为空时策略为空（不做限制），可通过 SetPolicy 设置
+func NewChecker(path string) (*Checker, error) {
+	c := &Checker{path: path, stats: Stats{ByLimit: make(map[string]LimitStats)}}
+	c.policy.Store(&Policy{})
+	if path != "" {
+		if err := c.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// SetPolicy 直接替换策略
+func (c *Checker) SetPolicy(p *Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	c.policy.Store(p)
+	c.mu.Lock()
+	c.loadedAt = time.Now()
+	c.lastLoadError = ""
+	c.mu.Unlock()
+	return nil
+}
+
+// Reload 重新加载策略文件，校验失败时保留旧策略
+func (c *Checker) Reload() error {
+	if c.path == "" {
+		return fmt.Errorf("未配置充电参数策略文件")
+	}
+	stat, err := os.Stat(c.path)
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(c.path); err == nil {
+			var p *Policy
+			if p, err = ParsePolicy(data); err == nil {
+				c.policy.Store(p)
+				c.mu.Lock()
+				c.modTime, c.size = stat.ModTime(), stat.Size()
+				c.loadedAt = time.Now()
+				c.lastLoadError = ""
+				c.mu.Unlock()
+				logger.WithFields(logrus.Fields{
+					"path":    c.path,
+					"tenants": len(p.Tenants),
+				}).Info("充电参数策略已加载")
+				return nil
+			}
+		}
+	}
+	err = fmt.Errorf("加载充电参数策略失败: %w", err)
+	c.mu.Lock()
+	c.lastLoadError = err.Error()
+	c.mu.Unlock()
+	return err
+}
+
+// Watch 定期检查策略文件变更并热加载，随ctx取消退出
+func (c *Checker) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || c.path == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stat, err := os.Stat(c.path)
+				c.mu.Lock()
+				unchanged := err != nil || (stat.ModTime().Equal(c.modTime) && stat.Size() == c.size)
+				if err == nil {
+					c.modTime, c.size = stat.ModTime(), stat.Size()
+				}
+				c.mu.Unlock()
+				if unchanged {
+					continue
+				}
+				if err := c.Reload(); err != nil {
+					logger.WithFields(logrus.Fields{
+						"path":  c.path,
+						"error": err,
+					}).Warn("充电参数策略热加载失败，继续使用旧策略")
+				}
+			}
+		}
+	}()
+}
+
+// Effective 租户生效限制
+func (c *Checker) Effective(tenantID string) Effective {
+	return c.policy.Load().Effective(tenantID)
+}
+
+// Check 按租户生效限制校验参数并计数
+func (c *Checker) Check(tenantID string, params Params) Result {
+	result := c.Effective(tenantID).Check(params)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Checks++
+	if !result.OK() {
+		c.stats.Rejected++
+	} else if len(result.Warnings) > 0 {
+		c.stats.Warned++
+	}
+	for _, v := range result.Violations {
+		s := c.stats.ByLimit[v.Limit]
+		s.Rejected++
+		c.stats.ByLimit[v.Limit] = s
+	}
+	for _, v := range result.Warnings {
+		s := c.stats.ByLimit[v.Limit]
+		s.Warned++
+		c.stats.ByLimit[v.Limit] = s
+	}
+	return result
+}
+
+// Status 当前策略、各租户生效限制与计数
+func (c *Checker) Status() Status {
+	p := c.policy.Load()
+	status := Status{Enabled: true, PolicyFile: c.path, Policy: *p, Global: p.Effective("")}
+	if len(p.Tenants) > 0 {
+		status.Tenants = make(map[string]Effective, len(p.Tenants))
+		for _, id := range p.TenantIDs() {
+			status.Tenants[id] = p.Effective(id)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status.LoadedAt, status.LastLoadError = c.loadedAt, c.lastLoadError
+	status.Stats = Stats{Checks: c.stats.Checks, Rejected: c.stats.Rejected, Warned: c.stats.Warned, ByLimit: make(map[string]LimitStats, len(c.stats.ByLimit))}
+	for k, v := range c.stats.ByLimit {
+		status.Stats.ByLimit[k] = v
+	}
+	return status
+}
+
+var globalChecker atomic.Pointer[Checker]
+
+// GetGlobalChecker 获取全局策略校验器（未启用时为nil）
+func GetGlobalChecker() *Checker {
+	return globalChecker.Load()
+}
+
+// SetGlobalChecker 设置全局策略校验器
+func SetGlobalChecker(c *Checker) {
+	globalChecker.Store(c)
+}
+
+// InitGlobalChecker 按配置加载策略文件并启动热加载；未配置策略文件时不做限制
+func InitGlobalChecker(ctx context.Context) error {
+	cfg := config.GetConfig().ChargingPolicy
+	if cfg.PolicyFile == "" {
+		return nil
+	}
+	c, err := NewChecker(cfg.PolicyFile)
+	if err != nil {
+		return err
+	}
+	c.Watch(ctx, time.Duration(cfg.ReloadIntervalSeconds)*time.Second)
+	SetGlobalChecker(c)
+	logger.WithFields(logrus.Fields{"policyFile": cfg.PolicyFile}).Info("充电参数策略已启用")
+	return nil
+}
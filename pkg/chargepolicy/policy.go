@@ -0,0 +1,244 @@
+// Package chargepolicy 充电参数护栏：按租户（未配置时回退全局）限制充电时长、最大充电时长、过载功率与余额上限
+// 及允许的计费模式，超限请求以 VALIDATION_FAILED 拒绝；接近上限的“告警带”内请求放行但在响应中标记并计数。
+// 策略文件可热加载，加载失败保留旧策略。
+package chargepolicy
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrorCodeValidationFailed 充电参数超出策略限制时响应中的错误码
+const ErrorCodeValidationFailed = "VALIDATION_FAILED"
+
+// 限制项名称（与API字段语义一致）
+const (
+	LimitChargeDuration    = "chargeDuration"    // 按时间充电的时长(秒)
+	LimitMaxChargeDuration = "maxChargeDuration" // 最大充电时长(秒)
+	LimitMaxPower          = "maxPower"          // 过载功率(W)
+	LimitBalance           = "balance"           // 余额(分)
+	LimitRateMode          = "rateMode"          // 计费模式
+)
+
+// 限制来源
+const (
+	ScopeGlobal = "global"
+	ScopeTenant = "tenant"
+)
+
+// Limits 一组限制（全局 defaults 或某个租户）；租户未填写的项继承全局，全局未填写的项不限
+type Limits struct {
+	ChargeDuration    *uint32 `yaml:"chargeDuration" json:"chargeDuration,omitempty"`       // 按时间充电时长上限(秒)
+	MaxChargeDuration *uint32 `yaml:"maxChargeDuration" json:"maxChargeDuration,omitempty"` // 最大充电时长上限(秒)
+	MaxPower          *uint32 `yaml:"maxPower" json:"maxPower,omitempty"`                   // 过载功率上限(W)
+	Balance           *uint32 `yaml:"balance" json:"balance,omitempty"`                     // 余额上限(分)
+	RateModes         []uint8 `yaml:"rateModes" json:"rateModes,omitempty"`                 // 允许的计费模式（0=按时间 1=按电量）
+}
+
+func (l Limits) max(name string) *uint32 {
+	switch name {
+	case LimitChargeDuration:
+		return l.ChargeDuration
+	case LimitMaxChargeDuration:
+		return l.MaxChargeDuration
+	case LimitMaxPower:
+		return l.MaxPower
+	case LimitBalance:
+		return l.Balance
+	}
+	return nil
+}
+
+// numericLimits 数值上限项（按检查与展示顺序）
+var numericLimits = []string{LimitChargeDuration, LimitMaxChargeDuration, LimitMaxPower, LimitBalance}
+
+// Policy 策略文件内容
+type Policy struct {
+	WarnBandPercent float64           `yaml:"warnBandPercent" json:"warnBandPercent"` // 告警带：超过上限的 (100-warnBandPercent)% 即告警，0表示不告警
+	Defaults        Limits            `yaml:"defaults" json:"defaults"`
+	Tenants         map[string]Limits `yaml:"tenants" json:"tenants,omitempty"`
+}
+
+// ParsePolicy 解析并校验策略文件
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("解析充电参数策略失败: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate 校验策略
+func (p *Policy) Validate() error {
+	if p.WarnBandPercent < 0 || p.WarnBandPercent >= 100 {
+		return fmt.Errorf("warnBandPercent 须在 [0,100) 内: %v", p.WarnBandPercent)
+	}
+	check := func(scope string, l Limits) error {
+		for _, mode := range l.RateModes {
+			if mode > 1 {
+				return fmt.Errorf("%s rateModes 包含无效计费模式: %d", scope, mode)
+			}
+		}
+		return nil
+	}
+	if err := check("defaults", p.Defaults); err != nil {
+		return err
+	}
+	for tenant, l := range p.Tenants {
+		if tenant == "" {
+			return fmt.Errorf("租户名称不能为空")
+		}
+		if err := check("tenants."+tenant, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Limit 生效的单项数值上限
+type Limit struct {
+	Max    uint32 `json:"max"`
+	WarnAt uint32 `json:"warnAt"` // 超过该值（且不超过 max）告警
+	Scope  string `json:"scope"`  // global | tenant
+}
+
+// Effective 租户生效的限制（租户覆盖项优先，其余取全局），供客户端预校验表单
+type Effective struct {
+	TenantID        string           `json:"tenantId,omitempty"`
+	WarnBandPercent float64          `json:"warnBandPercent"`
+	Limits          map[string]Limit `json:"limits"`                  // 未列出的项不限
+	RateModes       []uint8          `json:"rateModes,omitempty"`     // 为空表示不限
+	RateModeScope   string           `json:"rateModeScope,omitempty"` // global | tenant
+}
+
+// Effective 计算租户生效限制；tenantID 为空或未配置时只有全局限制
+func (p *Policy) Effective(tenantID string) Effective {
+	tenant, hasTenant := p.Tenants[tenantID]
+	e := Effective{WarnBandPercent: p.WarnBandPercent, Limits: make(map[string]Limit)}
+	if hasTenant {
+		e.TenantID = tenantID
+	}
+	for _, name := range numericLimits {
+		scope, max := ScopeGlobal, p.Defaults.max(name)
+		if hasTenant && tenant.max(name) != nil {
+			scope, max = ScopeTenant, tenant.max(name)
+		}
+		if max == nil {
+			continue
+		}
+		e.Limits[name] = Limit{Max: *max, WarnAt: warnAt(*max, p.WarnBandPercent), Scope: scope}
+	}
+	switch {
+	case hasTenant && tenant.RateModes != nil:
+		e.RateModes, e.RateModeScope = tenant.RateModes, ScopeTenant
+	case len(p.Defaults.RateModes) > 0:
+		e.RateModes, e.RateModeScope = p.Defaults.RateModes, ScopeGlobal
+	}
+	return e
+}
+
+// TenantIDs 已配置的租户（排序）
+func (p *Policy) TenantIDs() []string {
+	ids := make([]string, 0, len(p.Tenants))
+	for id := range p.Tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func warnAt(max uint32, bandPercent float64) uint32 {
+	if bandPercent <= 0 {
+		return max
+	}
+	return uint32(float64(max) * (100 - bandPercent) / 100)
+}
+
+// Params 待校验的充电参数，数值为0表示请求未携带该项
+type Params struct {
+	RateMode          *uint8
+	ChargeDuration    uint32
+	MaxChargeDuration uint32
+	MaxPower          uint32
+	Balance           uint32
+}
+
+func (p Params) value(name string) uint32 {
+	switch name {
+	case LimitChargeDuration:
+		return p.ChargeDuration
+	case LimitMaxChargeDuration:
+		return p.MaxChargeDuration
+	case LimitMaxPower:
+		return p.MaxPower
+	case LimitBalance:
+		return p.Balance
+	}
+	return 0
+}
+
+// Violation 违反（或接近）的限制
+type Violation struct {
+	Limit   string  `json:"limit"`
+	Value   uint32  `json:"value"`
+	Max     uint32  `json:"max,omitempty"`
+	WarnAt  uint32  `json:"warnAt,omitempty"`
+	Allowed []uint8 `json:"allowed,omitempty"` // rateMode 允许值
+	Scope   string  `json:"scope"`
+	Message string  `json:"message"`
+}
+
+// Result 校验结果
+type Result struct {
+	TenantID   string      `json:"tenantId,omitempty"` // 命中租户策略时为租户ID
+	Violations []Violation `json:"violations,omitempty"`
+	Warnings   []Violation `json:"warnings,omitempty"`
+}
+
+// OK 未违反任何限制
+func (r Result) OK() bool { return len(r.Violations) == 0 }
+
+// Check 按生效限制校验参数：超过上限拒绝，落在告警带内放行并告警
+func (e Effective) Check(params Params) Result {
+	result := Result{TenantID: e.TenantID}
+	for _, name := range numericLimits {
+		limit, ok := e.Limits[name]
+		value := params.value(name)
+		if !ok || value == 0 {
+			continue
+		}
+		v := Violation{Limit: name, Value: value, Max: limit.Max, WarnAt: limit.WarnAt, Scope: limit.Scope}
+		switch {
+		case value > limit.Max:
+			v.Message = fmt.Sprintf("%s=%d 超过上限 %d（%s）", name, value, limit.Max, limit.Scope)
+			result.Violations = append(result.Violations, v)
+		case value > limit.WarnAt:
+			v.Message = fmt.Sprintf("%s=%d 接近上限 %d（%s）", name, value, limit.Max, limit.Scope)
+			result.Warnings = append(result.Warnings, v)
+		}
+	}
+	if params.RateMode != nil && len(e.RateModes) > 0 {
+		allowed := false
+		for _, mode := range e.RateModes {
+			if mode == *params.RateMode {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			result.Violations = append(result.Violations, Violation{
+				Limit:   LimitRateMode,
+				Value:   uint32(*params.RateMode),
+				Allowed: e.RateModes,
+				Scope:   e.RateModeScope,
+				Message: fmt.Sprintf("rateMode=%d 不在允许列表 %v 内（%s）", *params.RateMode, e.RateModes, e.RateModeScope),
+			})
+		}
+	}
+	return result
+}
@@ -0,0 +1,782 @@
+// Package chargestats 充电统计看板：按租户增量维护小时桶与天桶汇总——订单开始与结束结果来自订单变更，
+// 电量与会话时长来自结算日志存储，查询时只读取区间内的时间桶，不扫描历史记录。
+// 时间桶按配置时区的本地整点与自然日对齐（夏令时切换日为23或25小时，回拨时重复的本地小时是两个桶），
+// 汇总定期快照到本地文件，重启后恢复。
+package chargestats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 时间桶宽度
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+// UnassignedTenant 资产映射中未标注租户的设备计入的租户
+const UnassignedTenant = "_unassigned"
+
+// 订单结束结果（与订单状态取值一致）
+const (
+	StatusCharging    = "charging"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusCancelled   = "cancelled"
+	StatusInterrupted = "interrupted_by_reboot"
+)
+
+const (
+	defaultHourRetentionDays = 31
+	defaultDayRetentionDays  = 400
+	defaultMaxTenants        = 5000
+	defaultMaxBuckets        = 2000
+	defaultSnapshotInterval  = 5 * time.Minute
+	pruneInterval            = time.Hour
+	orderMarkTTL             = 72 * time.Hour // 订单去重标记保留时长（结算通常在订单结束后数分钟内到达）
+	snapshotVersion          = 1
+	allTenantsKey            = "" // 全部租户汇总
+)
+
+var (
+	// ErrInvalidBucket 时间桶宽度不是 hour 或 day
+	ErrInvalidBucket = errors.New("bucket 只支持 hour 或 day")
+	// ErrInvalidRange 起止时间无效
+	ErrInvalidRange = errors.New("from 须早于 to")
+	// ErrTooManyBuckets 区间内的时间桶超过上限
+	ErrTooManyBuckets = errors.New("时间桶数量超过上限")
+)
+
+// OrderEvent 订单创建或状态变更
+type OrderEvent struct {
+	OrderNo   string
+	DeviceID  string
+	TenantID  string
+	Status    string
+	StartTime time.Time
+	EndTime   time.Time // 零值时取变更时间
+	UpdatedAt time.Time
+}
+
+// SettlementEvent 已落盘的结算
+type SettlementEvent struct {
+	OrderNo    string
+	DeviceID   string
+	TenantID   string
+	EnergyWh   uint32
+	StartTime  time.Time
+	EndTime    time.Time
+	ReceivedAt time.Time
+}
+
+// counters 单个时间桶的计数
+type counters struct {
+	Started         uint64              `json:"started"`
+	Completed       uint64              `json:"completed"`
+	Failed          uint64              `json:"failed"`
+	Cancelled       uint64              `json:"cancelled"`
+	Interrupted     uint64              `json:"interrupted"`
+	Settled         uint64              `json:"settled"` // 计入电量与时长的结算数
+	EnergyWh        uint64              `json:"energyWh"`
+	DurationSeconds uint64              `json:"durationSeconds"`
+	Devices         map[string]struct{} `json:"devices"`
+}
+
+// rollup 租户的小时桶与天桶，键为桶起点（Unix秒）
+type rollup struct {
+	Hours map[int64]*counters `json:"hours"`
+	Days  map[int64]*counters `json:"days"`
+}
+
+func newRollup() *rollup {
+	return &rollup{Hours: make(map[int64]*counters), Days: make(map[int64]*counters)}
+}
+
+func (r *rollup) bucket(buckets map[int64]*counters, start int64) *counters {
+	c := buckets[start]
+	if c == nil {
+		c = &counters{Devices: make(map[string]struct{})}
+		buckets[start] = c
+	}
+	return c
+}
+
+// orderMark 订单已计入的事件，防止状态重复通知或设备重发不同载荷的结算被重复计数
+type orderMark struct {
+	Started bool      `json:"started,omitempty"`
+	Ended   bool      `json:"ended,omitempty"`
+	Settled bool      `json:"settled,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Options 统计选项
+type Options struct {
+	Location         *time.Location // 时间桶对齐的时区，nil 为本地时区
+	HourRetention    time.Duration
+	DayRetention     time.Duration
+	MaxTenants       int
+	MaxBuckets       int
+	SnapshotFile     string // 为空不持久化
+	SnapshotInterval time.Duration
+}
+
+// Aggregator 充电统计增量汇总
+type Aggregator struct {
+	opts    Options
+	nowFunc atomic.Pointer[func() time.Time]
+
+	mu      sync.Mutex
+	tenants map[string]*rollup // allTenantsKey 为全部租户汇总
+	orders  map[string]*orderMark
+	since   time.Time // 统计起点（首次启动或快照中记录的起点）
+	dropped uint64
+	dirty   bool // 上次快照后有新的计数
+	pruned  time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// New 创建统计；配置了快照文件时从快照恢复（快照损坏或时区不一致时从零统计）
+func New(opts Options) *Aggregator {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.HourRetention <= 0 {
+		opts.HourRetention = defaultHourRetentionDays * 24 * time.Hour
+	}
+	if opts.DayRetention <= 0 {
+		opts.DayRetention = defaultDayRetentionDays * 24 * time.Hour
+	}
+	if opts.MaxTenants <= 0 {
+		opts.MaxTenants = defaultMaxTenants
+	}
+	if opts.MaxBuckets <= 0 {
+		opts.MaxBuckets = defaultMaxBuckets
+	}
+	if opts.SnapshotInterval <= 0 {
+		opts.SnapshotInterval = defaultSnapshotInterval
+	}
+	a := &Aggregator{
+		opts:    opts,
+		tenants: map[string]*rollup{allTenantsKey: newRollup()},
+		orders:  make(map[string]*orderMark),
+		since:   time.Now(),
+	}
+	if opts.SnapshotFile != "" {
+		if err := a.loadSnapshot(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.WithFields(logrus.Fields{"file": opts.SnapshotFile, "error": err.Error()}).Warn("充电统计快照无法恢复，从零开始统计")
+		}
+	}
+	return a
+}
+
+// SetNowFunc 替换时钟（测试使用）；尚未计入任何订单时统计起点同时设为新时钟的当前时间
+func (a *Aggregator) SetNowFunc(now func() time.Time) {
+	if now == nil {
+		a.nowFunc.Store(nil)
+		return
+	}
+	a.nowFunc.Store(&now)
+	a.mu.Lock()
+	if len(a.orders) == 0 {
+		a.since = now()
+	}
+	a.mu.Unlock()
+}
+
+func (a *Aggregator) now() time.Time {
+	if fn := a.nowFunc.Load(); fn != nil {
+		return (*fn)()
+	}
+	return time.Now()
+}
+
+// Location 时间桶对齐的时区
+func (a *Aggregator) Location() *time.Location {
+	return a.opts.Location
+}
+
+// hourStart 所在本地整点的起点（按本地分秒回退，半小时时区与夏令时切换同样对齐到本地整点）
+func (a *Aggregator) hourStart(t time.Time) time.Time {
+	lt := t.In(a.opts.Location)
+	return lt.Add(-time.Duration(lt.Minute())*time.Minute - time.Duration(lt.Second())*time.Second - time.Duration(lt.Nanosecond()))
+}
+
+// dayStart 所在本地自然日的零点
+func (a *Aggregator) dayStart(t time.Time) time.Time {
+	y, m, d := t.In(a.opts.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, a.opts.Location)
+}
+
+// bucketStart 所在时间桶的起点
+func (a *Aggregator) bucketStart(bucket string, t time.Time) time.Time {
+	if bucket == BucketDay {
+		return a.dayStart(t)
+	}
+	return a.hourStart(t)
+}
+
+// nextBucket 下一个时间桶的起点
+func (a *Aggregator) nextBucket(bucket string, start time.Time) time.Time {
+	if bucket == BucketDay {
+		y, m, d := start.In(a.opts.Location).Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, a.opts.Location)
+	}
+	next := a.hourStart(start.Add(time.Hour))
+	if !next.After(start) {
+		next = start.Add(time.Hour)
+	}
+	return next
+}
+
+// addLocked 将一次计数计入租户与全部租户汇总的小时桶和天桶
+func (a *Aggregator) addLocked(tenantID, deviceID string, at time.Time, apply func(c *counters)) {
+	if tenantID == "" {
+		tenantID = UnassignedTenant
+	}
+	targets := []*rollup{a.tenants[allTenantsKey]}
+	if r, ok := a.tenants[tenantID]; ok {
+		targets = append(targets, r)
+	} else if len(a.tenants)-1 < a.opts.MaxTenants {
+		r = newRollup()
+		a.tenants[tenantID] = r
+		targets = append(targets, r)
+	} else {
+		a.dropped++
+		if a.dropped == 1 || a.dropped%1000 == 0 {
+			logger.WithFields(logrus.Fields{"tenantId": tenantID, "maxTenants": a.opts.MaxTenants, "dropped": a.dropped}).Warn("充电统计租户数已达上限，新租户只计入全部租户汇总")
+		}
+	}
+	hour, day := a.hourStart(at).Unix(), a.dayStart(at).Unix()
+	for _, r := range targets {
+		for _, c := range []*counters{r.bucket(r.Hours, hour), r.bucket(r.Days, day)} {
+			apply(c)
+			if deviceID != "" {
+				c.Devices[deviceID] = struct{}{}
+			}
+		}
+	}
+	a.dirty = true
+}
+
+func (a *Aggregator) markLocked(orderNo string, now time.Time) *orderMark {
+	m := a.orders[orderNo]
+	if m == nil {
+		m = &orderMark{}
+		a.orders[orderNo] = m
+	}
+	m.At = now
+	return m
+}
+
+// RecordOrder 计入订单变更：首次进入充电计为开始（按开始时间分桶），首次进入结束状态计为对应结果（按结束时间分桶）
+func (a *Aggregator) RecordOrder(ev OrderEvent) {
+	if a == nil || ev.OrderNo == "" {
+		return
+	}
+	ended := ev.Status == StatusCompleted || ev.Status == StatusFailed || ev.Status == StatusCancelled || ev.Status == StatusInterrupted
+	if ev.Status != StatusCharging && !ended {
+		return
+	}
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := a.markLocked(ev.OrderNo, now)
+	if ev.Status == StatusCharging {
+		if m.Started {
+			return
+		}
+		m.Started = true
+		at := ev.StartTime
+		if at.IsZero() {
+			at = now
+		}
+		a.addLocked(ev.TenantID, ev.DeviceID, at, func(c *counters) { c.Started++ })
+		return
+	}
+	if m.Ended {
+		return
+	}
+	m.Ended = true
+	at := ev.EndTime
+	if at.IsZero() {
+		at = ev.UpdatedAt
+	}
+	if at.IsZero() {
+		at = now
+	}
+	a.addLocked(ev.TenantID, ev.DeviceID, at, func(c *counters) {
+		switch ev.Status {
+		case StatusCompleted:
+			c.Completed++
+		case StatusFailed:
+			c.Failed++
+		case StatusCancelled:
+			c.Cancelled++
+		default:
+			c.Interrupted++
+		}
+	})
+}
+
+// RecordSettlement 计入结算电量与会话时长（按结算的结束时间分桶，设备时钟无效时取接收时间）；同一订单只计入首条结算
+func (a *Aggregator) RecordSettlement(ev SettlementEvent) {
+	if a == nil || ev.OrderNo == "" {
+		return
+	}
+	now := a.now()
+	at := ev.EndTime
+	if at.IsZero() || at.Before(ev.StartTime) || (!ev.ReceivedAt.IsZero() && at.After(ev.ReceivedAt.Add(time.Hour))) {
+		at = ev.ReceivedAt
+	}
+	if at.IsZero() {
+		at = now
+	}
+	var duration uint64
+	if !ev.StartTime.IsZero() && ev.EndTime.After(ev.StartTime) {
+		duration = uint64(ev.EndTime.Sub(ev.StartTime) / time.Second)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m := a.markLocked(ev.OrderNo, now)
+	if m.Settled {
+		return
+	}
+	m.Settled = true
+	a.addLocked(ev.TenantID, ev.DeviceID, at, func(c *counters) {
+		c.Settled++
+		c.EnergyWh += uint64(ev.EnergyWh)
+		c.DurationSeconds += duration
+	})
+}
+
+// Query 查询条件
+type Query struct {
+	Tenant string    // 为空表示全部租户
+	Bucket string    // hour | day
+	From   time.Time // 起点所在的时间桶为第一个桶
+	To     time.Time // 不含；晚于当前时间时截止到当前时间所在的桶
+}
+
+// Totals 区间合计
+type Totals struct {
+	Started            uint64  `json:"started"`
+	Completed          uint64  `json:"completed"`
+	Failed             uint64  `json:"failed"`
+	Cancelled          uint64  `json:"cancelled"`
+	Interrupted        uint64  `json:"interrupted"`
+	Settled            uint64  `json:"settled"`
+	EnergyWh           uint64  `json:"energyWh"`
+	AvgEnergyWh        float64 `json:"avgEnergyWh"`
+	AvgDurationSeconds float64 `json:"avgDurationSeconds"`
+	UniqueDevices      int     `json:"uniqueDevices"` // 区间内去重（不是各桶之和）
+}
+
+// Series 按时间桶对齐的图表序列：各数组长度相同，下标对应同一个时间桶，没有数据的桶为0
+type Series struct {
+	Tenant             string    `json:"tenant"` // 为空表示全部租户
+	Bucket             string    `json:"bucket"`
+	Timezone           string    `json:"timezone"`
+	From               time.Time `json:"from"`          // 第一个桶的起点
+	To                 time.Time `json:"to"`            // 最后一个桶的终点
+	CoverageStart      time.Time `json:"coverageStart"` // 统计覆盖的起点：早于该时间的桶数据不完整
+	GeneratedAt        time.Time `json:"generatedAt"`
+	Timestamps         []int64   `json:"timestamps"`    // 桶起点（Unix秒）
+	Labels             []string  `json:"labels"`        // 桶起点的本地时间（RFC3339，含时区偏移）
+	BucketSeconds      []int64   `json:"bucketSeconds"` // 桶时长（夏令时切换时小时桶不变，天桶为23或25小时）
+	Partial            []bool    `json:"partial"`       // 桶尚未结束，或早于统计覆盖起点
+	Started            []uint64  `json:"started"`
+	Completed          []uint64  `json:"completed"`
+	Failed             []uint64  `json:"failed"`
+	Cancelled          []uint64  `json:"cancelled"`
+	Interrupted        []uint64  `json:"interrupted"` // 远程重启中断
+	Settled            []uint64  `json:"settled"`     // 计入电量与时长的结算数
+	EnergyWh           []uint64  `json:"energyWh"`
+	AvgEnergyWh        []float64 `json:"avgEnergyWh"`
+	AvgDurationSeconds []float64 `json:"avgDurationSeconds"`
+	UniqueDevices      []int     `json:"uniqueDevices"`
+	Totals             Totals    `json:"totals"`
+}
+
+// average 保留两位小数的均值，无样本时为0
+func average(sum, n uint64) float64 {
+	if n == 0 {
+		return 0
+	}
+	return float64(int64(float64(sum)*100/float64(n)+0.5)) / 100
+}
+
+// Query 按时间桶返回对齐序列；租户没有数据时返回全0序列
+func (a *Aggregator) Query(q Query) (Series, error) {
+	if q.Bucket != BucketHour && q.Bucket != BucketDay {
+		return Series{}, ErrInvalidBucket
+	}
+	now := a.now()
+	to := q.To
+	if to.IsZero() || to.After(now) {
+		to = now.Add(time.Nanosecond) // 包含当前时间所在的桶
+	}
+	if q.From.IsZero() || !q.From.Before(to) {
+		return Series{}, ErrInvalidRange
+	}
+	start := a.bucketStart(q.Bucket, q.From)
+	var bounds []time.Time
+	for cur := start; cur.Before(to); cur = a.nextBucket(q.Bucket, cur) {
+		if len(bounds) >= a.opts.MaxBuckets {
+			return Series{}, fmt.Errorf("%w（%d）", ErrTooManyBuckets, a.opts.MaxBuckets)
+		}
+		bounds = append(bounds, cur)
+	}
+	end := a.nextBucket(q.Bucket, bounds[len(bounds)-1])
+	retention := a.opts.HourRetention
+	if q.Bucket == BucketDay {
+		retention = a.opts.DayRetention
+	}
+
+	n := len(bounds)
+	s := Series{
+		Tenant:             q.Tenant,
+		Bucket:             q.Bucket,
+		Timezone:           a.opts.Location.String(),
+		From:               bounds[0],
+		To:                 end,
+		GeneratedAt:        now,
+		Timestamps:         make([]int64, n),
+		Labels:             make([]string, n),
+		BucketSeconds:      make([]int64, n),
+		Partial:            make([]bool, n),
+		Started:            make([]uint64, n),
+		Completed:          make([]uint64, n),
+		Failed:             make([]uint64, n),
+		Cancelled:          make([]uint64, n),
+		Interrupted:        make([]uint64, n),
+		Settled:            make([]uint64, n),
+		EnergyWh:           make([]uint64, n),
+		AvgEnergyWh:        make([]float64, n),
+		AvgDurationSeconds: make([]float64, n),
+		UniqueDevices:      make([]int, n),
+	}
+	devices := make(map[string]struct{})
+	var durationSeconds uint64
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s.CoverageStart = a.since
+	if oldest := now.Add(-retention); oldest.After(s.CoverageStart) {
+		s.CoverageStart = oldest
+	}
+	var buckets map[int64]*counters
+	if r := a.tenants[q.Tenant]; r != nil {
+		buckets = r.Hours
+		if q.Bucket == BucketDay {
+			buckets = r.Days
+		}
+	}
+	for i, b := range bounds {
+		next := end
+		if i+1 < n {
+			next = bounds[i+1]
+		}
+		s.Timestamps[i] = b.Unix()
+		s.Labels[i] = b.Format(time.RFC3339)
+		s.BucketSeconds[i] = int64(next.Sub(b) / time.Second)
+		s.Partial[i] = next.After(now) || b.Before(s.CoverageStart)
+		c := buckets[b.Unix()]
+		if c == nil {
+			continue
+		}
+		s.Started[i], s.Completed[i], s.Failed[i], s.Cancelled[i], s.Interrupted[i] = c.Started, c.Completed, c.Failed, c.Cancelled, c.Interrupted
+		s.Settled[i], s.EnergyWh[i] = c.Settled, c.EnergyWh
+		s.AvgEnergyWh[i] = average(c.EnergyWh, c.Settled)
+		s.AvgDurationSeconds[i] = average(c.DurationSeconds, c.Settled)
+		s.UniqueDevices[i] = len(c.Devices)
+
+		s.Totals.Started += c.Started
+		s.Totals.Completed += c.Completed
+		s.Totals.Failed += c.Failed
+		s.Totals.Cancelled += c.Cancelled
+		s.Totals.Interrupted += c.Interrupted
+		s.Totals.Settled += c.Settled
+		s.Totals.EnergyWh += c.EnergyWh
+		durationSeconds += c.DurationSeconds
+		for d := range c.Devices {
+			devices[d] = struct{}{}
+		}
+	}
+	s.Totals.AvgEnergyWh = average(s.Totals.EnergyWh, s.Totals.Settled)
+	s.Totals.AvgDurationSeconds = average(durationSeconds, s.Totals.Settled)
+	s.Totals.UniqueDevices = len(devices)
+	return s, nil
+}
+
+// Stats 统计概况
+type Stats struct {
+	Since          time.Time `json:"since"`
+	Timezone       string    `json:"timezone"`
+	Tenants        []string  `json:"tenants"` // 有统计数据的租户
+	HourBuckets    int       `json:"hourBuckets"`
+	DayBuckets     int       `json:"dayBuckets"`
+	TrackedOrders  int       `json:"trackedOrders"`  // 去重标记中的订单数
+	DroppedTenants uint64    `json:"droppedTenants"` // 超出租户上限、只计入全部租户汇总的次数
+}
+
+// Stats 统计概况
+func (a *Aggregator) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := Stats{Since: a.since, Timezone: a.opts.Location.String(), Tenants: make([]string, 0, len(a.tenants)), TrackedOrders: len(a.orders), DroppedTenants: a.dropped}
+	for tenant, r := range a.tenants {
+		st.HourBuckets += len(r.Hours)
+		st.DayBuckets += len(r.Days)
+		if tenant != allTenantsKey {
+			st.Tenants = append(st.Tenants, tenant)
+		}
+	}
+	sort.Strings(st.Tenants)
+	return st
+}
+
+// Prune 删除超过保留期的时间桶、没有数据的租户与过期的订单去重标记
+func (a *Aggregator) Prune() {
+	now := a.now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	hourCutoff := now.Add(-a.opts.HourRetention).Unix()
+	dayCutoff := a.dayStart(now.Add(-a.opts.DayRetention)).Unix()
+	for tenant, r := range a.tenants {
+		for start := range r.Hours {
+			if start < hourCutoff {
+				delete(r.Hours, start)
+			}
+		}
+		for start := range r.Days {
+			if start < dayCutoff {
+				delete(r.Days, start)
+			}
+		}
+		if tenant != allTenantsKey && len(r.Hours) == 0 && len(r.Days) == 0 {
+			delete(a.tenants, tenant)
+		}
+	}
+	for orderNo, m := range a.orders {
+		if now.Sub(m.At) > orderMarkTTL {
+			delete(a.orders, orderNo)
+		}
+	}
+	a.pruned = now
+}
+
+// snapshot 快照文件内容
+type snapshot struct {
+	Version  int                   `json:"version"`
+	Timezone string                `json:"timezone"`
+	Since    time.Time             `json:"since"`
+	SavedAt  time.Time             `json:"savedAt"`
+	Tenants  map[string]*rollup    `json:"tenants"`
+	Orders   map[string]*orderMark `json:"orders"`
+}
+
+// SaveSnapshot 将汇总写入快照文件（先写临时文件再改名，避免崩溃时留下半个快照）；上次快照后没有新计数时跳过
+func (a *Aggregator) SaveSnapshot() error {
+	if a.opts.SnapshotFile == "" {
+		return nil
+	}
+	a.mu.Lock()
+	if !a.dirty {
+		a.mu.Unlock()
+		return nil
+	}
+	a.dirty = false
+	body, err := json.Marshal(snapshot{
+		Version:  snapshotVersion,
+		Timezone: a.opts.Location.String(),
+		Since:    a.since,
+		SavedAt:  a.now(),
+		Tenants:  a.tenants,
+		Orders:   a.orders,
+	})
+	a.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("序列化充电统计快照失败: %w", err)
+	}
+	if err := a.writeSnapshot(body); err != nil {
+		a.mu.Lock()
+		a.dirty = true
+		a.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (a *Aggregator) writeSnapshot(body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(a.opts.SnapshotFile), 0o755); err != nil {
+		return fmt.Errorf("创建充电统计快照目录失败: %w", err)
+	}
+	tmp := a.opts.SnapshotFile + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("写入充电统计快照失败: %w", err)
+	}
+	return os.Rename(tmp, a.opts.SnapshotFile)
+}
+
+// loadSnapshot 从快照文件恢复汇总
+func (a *Aggregator) loadSnapshot() error {
+	raw, err := os.ReadFile(a.opts.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return fmt.Errorf("解析快照失败: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("快照版本 %d 不支持", snap.Version)
+	}
+	if snap.Timezone != a.opts.Location.String() {
+		return fmt.Errorf("快照时区 %s 与配置时区 %s 不一致", snap.Timezone, a.opts.Location)
+	}
+	tenants := map[string]*rollup{allTenantsKey: newRollup()}
+	for tenant, r := range snap.Tenants {
+		if r == nil {
+			continue
+		}
+		for _, buckets := range []map[int64]*counters{r.Hours, r.Days} {
+			for _, c := range buckets {
+				if c.Devices == nil {
+					c.Devices = make(map[string]struct{})
+				}
+			}
+		}
+		if r.Hours == nil {
+			r.Hours = make(map[int64]*counters)
+		}
+		if r.Days == nil {
+			r.Days = make(map[int64]*counters)
+		}
+		tenants[tenant] = r
+	}
+	if snap.Orders == nil {
+		snap.Orders = make(map[string]*orderMark)
+	}
+	a.mu.Lock()
+	a.tenants, a.orders, a.since = tenants, snap.Orders, snap.Since
+	a.mu.Unlock()
+	return nil
+}
+
+// Start 定期清理过期时间桶并保存快照
+func (a *Aggregator) Start(ctx context.Context) {
+	a.mu.Lock()
+	if a.cancel != nil {
+		a.mu.Unlock()
+		return
+	}
+	ctx, a.cancel = context.WithCancel(ctx)
+	a.done = make(chan struct{})
+	done := a.done
+	a.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(a.opts.SnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.mu.Lock()
+				prune := a.now().Sub(a.pruned) >= pruneInterval
+				a.mu.Unlock()
+				if prune {
+					a.Prune()
+				}
+				if err := a.SaveSnapshot(); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("保存充电统计快照失败")
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定期任务并保存最后一次快照
+func (a *Aggregator) Stop() {
+	a.mu.Lock()
+	cancel, done := a.cancel, a.done
+	a.cancel, a.done = nil, nil
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	if err := a.SaveSnapshot(); err != nil {
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("保存充电统计快照失败")
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalAggregator atomic.Pointer[Aggregator]
+
+// GetGlobalAggregator 获取全局统计（未启用时为nil）
+func GetGlobalAggregator() *Aggregator {
+	return globalAggregator.Load()
+}
+
+// SetGlobalAggregator 设置全局统计
+func SetGlobalAggregator(a *Aggregator) {
+	globalAggregator.Store(a)
+}
+
+// InitGlobalAggregator 按配置创建全局统计并开始定期快照；未启用时不创建
+func InitGlobalAggregator(ctx context.Context) error {
+	cfg := config.GetConfig().ChargeStats
+	if !cfg.Enabled {
+		SetGlobalAggregator(nil)
+		return nil
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			SetGlobalAggregator(nil)
+			return fmt.Errorf("充电统计时区 %q 无效: %w", cfg.Timezone, err)
+		}
+	}
+	a := New(Options{
+		Location:         loc,
+		HourRetention:    time.Duration(cfg.HourRetentionDays) * 24 * time.Hour,
+		DayRetention:     time.Duration(cfg.DayRetentionDays) * 24 * time.Hour,
+		MaxTenants:       cfg.MaxTenants,
+		MaxBuckets:       cfg.MaxBuckets,
+		SnapshotFile:     cfg.SnapshotFile,
+		SnapshotInterval: time.Duration(cfg.SnapshotIntervalSeconds) * time.Second,
+	})
+	a.Start(ctx)
+	SetGlobalAggregator(a)
+	return nil
+}
+
+// StopGlobalAggregator 停止全局统计并保存快照
+func StopGlobalAggregator() {
+	if a := globalAggregator.Load(); a != nil {
+		a.Stop()
+	}
+}
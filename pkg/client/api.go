@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListDevices 本实例持有连接的在线设备（GET /devices）
+func (c *Client) ListDevices(ctx context.Context, opts ListDevicesOptions) (*DeviceList, error) {
+	q := url.Values{}
+	if opts.StationID != "" {
+		q.Set("stationId", opts.StationID)
+	}
+	if opts.DeviceType != 0 {
+		q.Set("deviceType", strconv.Itoa(int(opts.DeviceType)))
+	}
+	if opts.ExpandVirtual {
+		q.Set("virtual", "expand")
+	}
+	var out DeviceList
+	if _, err := c.do(ctx, call{method: http.MethodGet, path: "/devices", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDevice 设备详情（GET /device/{deviceId}/status）；设备不在线时返回 ErrNotFound，由其他实例持有时返回 ErrMisdirected
+func (c *Client) GetDevice(ctx context.Context, deviceID string) (*Device, error) {
+	if deviceID == "" {
+		return nil, errEmptyDeviceID
+	}
+	var out Device
+	if _, err := c.do(ctx, call{method: http.MethodGet, path: "/device/" + url.PathEscape(deviceID) + "/status"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPorts 设备端口状态（GET /device/{deviceId}/ports）
+func (c *Client) GetPorts(ctx context.Context, deviceID string) (*DevicePorts, error) {
+	if deviceID == "" {
+		return nil, errEmptyDeviceID
+	}
+	var out DevicePorts
+	if _, err := c.do(ctx, call{method: http.MethodGet, path: "/device/" + url.PathEscape(deviceID) + "/ports"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Search 按设备ID、物理ID、ICCID、资产编码或IP模糊搜索设备（GET /search），limit 为0时使用网关默认值
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]SearchMatch, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var out []SearchMatch
+	if _, err := c.do(ctx, call{method: http.MethodGet, path: "/search", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StartCharging 开始充电（POST /charging/start），携带幂等键，重试不会重复下发
+func (c *Client) StartCharging(ctx context.Context, req StartChargingRequest) (*ChargingResult, error) {
+	return c.charging(ctx, "/charging/start", req)
+}
+
+// StopCharging 停止充电（POST /charging/stop），携带幂等键
+func (c *Client) StopCharging(ctx context.Context, req StopChargingRequest) (*ChargingResult, error) {
+	return c.charging(ctx, "/charging/stop", req)
+}
+
+// ModifyCharging 调整进行中订单的过载功率/最大时长（POST /charging/update_power），携带幂等键
+func (c *Client) ModifyCharging(ctx context.Context, req ModifyChargingRequest) (*ChargingResult, error) {
+	return c.charging(ctx, "/charging/update_power", req)
+}
+
+func (c *Client) charging(ctx context.Context, path string, body interface{}) (*ChargingResult, error) {
+	key := idempotencyKey(ctx)
+	var out ChargingResult
+	res, err := c.do(ctx, call{method: http.MethodPost, path: path, body: body, idempotencyKey: key}, &out)
+	if err != nil {
+		return nil, err
+	}
+	out.IdempotencyKey, out.Replayed = key, res.replayed
+	return &out, nil
+}
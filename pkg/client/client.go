@@ -0,0 +1,256 @@
+// Package client 网关HTTP API（/api/v1）的类型化Go客户端，供内部服务调用。
+//
+// 客户端按API Key名称与租户标识调用方；充电类操作自动生成 Idempotency-Key，重试时复用同一键，
+// 网关对同一键重放首个应答而不再次下发。只有幂等方法（GET/PUT/DELETE）或携带幂等键的请求会重试，
+// 重试遵循响应的 Retry-After。错误响应（含 application/problem+json）映射为 *APIError，可用 errors.Is 与本包的错误变量比较。
+//
+// 客户端版本与API版本一致（APIVersion），API不兼容变更时两者同步升级。
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// APIVersion 客户端对应的API版本（与OpenAPI规范 info.version 一致）
+	APIVersion = "1.0"
+	// BasePath API路由前缀
+	BasePath = "/api/v1"
+
+	// HeaderAPIKeyName 调用方API Key名称
+	HeaderAPIKeyName = "X-API-Key-Name"
+	// HeaderTenantID 调用方租户
+	HeaderTenantID = "X-Tenant-ID"
+	// HeaderIdempotencyKey 幂等键
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed 响应头：应答为同一幂等键首个请求的重放
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// HeaderRequestID 链路追踪ID
+	HeaderRequestID = "X-Request-ID"
+
+	defaultTimeout = 30 * time.Second
+	maxErrorBody   = 64 << 10
+)
+
+// Client 网关API客户端，可并发使用
+type Client struct {
+	baseURL   *url.URL
+	apiKey    string
+	tenant    string
+	userAgent string
+	http      *http.Client
+	retry     RetryPolicy
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义 http.Client（默认超时30秒）
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.http = hc
+		}
+	}
+}
+
+// WithRetryPolicy 替换重试策略
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// WithUserAgent 追加调用方标识到 User-Agent
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		if ua != "" {
+			c.userAgent = ua + " " + c.userAgent
+		}
+	}
+}
+
+// New 创建客户端；baseURL 为网关HTTP地址（如 http://gateway:7055），apiKey 为调用方API Key名称，tenant 可为空
+func New(baseURL, apiKey, tenant string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("网关地址无效: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("网关地址无效: %q", baseURL)
+	}
+	c := &Client{
+		baseURL:   u,
+		apiKey:    apiKey,
+		tenant:    tenant,
+		userAgent: "iot-zinx-client/" + APIVersion,
+		http:      &http.Client{Timeout: defaultTimeout},
+		retry:     DefaultRetryPolicy(),
+		sleep:     sleepContext,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey 为本次调用指定幂等键（如业务订单号派生的键，调用方进程重启后重试仍可去重）；未指定时客户端自动生成
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// NewIdempotencyKey 生成随机幂等键
+func NewIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// call 单次逻辑调用
+type call struct {
+	method         string
+	path           string
+	query          url.Values
+	body           interface{}
+	idempotencyKey string
+}
+
+// result 成功应答
+type result struct {
+	replayed  bool
+	requestID string
+}
+
+// do 执行调用（含重试），成功时将响应 data 解码到 out
+func (c *Client) do(ctx context.Context, req call, out interface{}) (result, error) {
+	var payload []byte
+	if req.body != nil {
+		var err error
+		if payload, err = json.Marshal(req.body); err != nil {
+			return result{}, fmt.Errorf("请求体编码失败: %w", err)
+		}
+	}
+	retryable := isIdempotentMethod(req.method) || req.idempotencyKey != ""
+	for attempt := 1; ; attempt++ {
+		res, err := c.attempt(ctx, req, payload, out)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return result{}, ctx.Err()
+		}
+		delay, ok := c.retry.next(attempt, err)
+		if !retryable || !ok {
+			return result{}, err
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return result{}, err
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, req call, payload []byte, out interface{}) (result, error) {
+	u := *c.baseURL
+	u.Path += BasePath + req.path
+	u.RawQuery = req.query.Encode()
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return result{}, err
+	}
+	httpReq.Header.Set("Accept", "application/json, application/problem+json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set(HeaderAPIKeyName, c.apiKey)
+	}
+	if c.tenant != "" {
+		httpReq.Header.Set(HeaderTenantID, c.tenant)
+	}
+	if req.idempotencyKey != "" {
+		httpReq.Header.Set(HeaderIdempotencyKey, req.idempotencyKey)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return result{}, &transportError{err: err}
+	}
+	defer resp.Body.Close()
+	res := result{replayed: resp.Header.Get(HeaderIdempotentReplayed) == "true", requestID: resp.Header.Get(HeaderRequestID)}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return res, parseError(resp, data)
+	}
+	var envelope struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return res, &transportError{err: fmt.Errorf("响应解析失败(HTTP %d): %w", resp.StatusCode, err)}
+	}
+	if envelope.Code != 0 {
+		return res, &APIError{Status: resp.StatusCode, Message: envelope.Message, RequestID: res.requestID, Data: envelope.Data}
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, out); err != nil {
+			return res, fmt.Errorf("响应数据解析失败: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// transportError 网络错误或响应不完整：请求可能已到达网关，只在可安全重试时重试
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string { return "网关请求失败: " + e.err.Error() }
+
+func (e *transportError) Unwrap() error { return e.err }
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// idempotencyKey 本次调用的幂等键：上下文指定的优先，否则生成
+func idempotencyKey(ctx context.Context) string {
+	if key, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok && key != "" {
+		return key
+	}
+	return NewIdempotencyKey()
+}
+
+var errEmptyDeviceID = errors.New("设备ID不能为空")
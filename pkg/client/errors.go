@@ -0,0 +1,154 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// 网关错误码（响应 data.errorCode，或 problem+json 的 title）
+const (
+	CodeDuplicateOrder       = "DUPLICATE_ORDER"
+	CodeSessionLimitReached  = "SESSION_LIMIT_REACHED"
+	CodeDeviceNotFound       = "DEVICE_NOT_FOUND"
+	CodeCommandTimeout       = "COMMAND_TIMEOUT"
+	CodeReplicaReadOnly      = "REPLICA_READ_ONLY"
+	CodeIdempotencyInFlight  = "IDEMPOTENCY_IN_FLIGHT"
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// 错误类别，用 errors.Is(err, client.ErrXxx) 判断；同一错误可同时属于错误码类别与HTTP状态类别
+var (
+	ErrBadRequest          = errors.New("请求参数错误")
+	ErrUnauthorized        = errors.New("调用未授权")
+	ErrNotFound            = errors.New("资源不存在或设备不在线")
+	ErrConflict            = errors.New("状态冲突")
+	ErrMisdirected         = errors.New("设备由其他网关实例持有")
+	ErrUnprocessable       = errors.New("请求无法执行")
+	ErrTooManyRequests     = errors.New("请求过于频繁")
+	ErrUnavailable         = errors.New("网关暂不可用")
+	ErrCommandTimeout      = errors.New("设备命令超时")
+	ErrDuplicateOrder      = errors.New("幂等窗口内重复的订单号")
+	ErrSessionLimitReached = errors.New("设备并发充电会话已达上限")
+	ErrReadOnlyReplica     = errors.New("只读副本不支持写操作")
+	ErrIdempotencyKeyReuse = errors.New("同一幂等键用于不同的请求")
+)
+
+var codeErrors = map[string]error{
+	CodeDuplicateOrder:       ErrDuplicateOrder,
+	CodeSessionLimitReached:  ErrSessionLimitReached,
+	CodeCommandTimeout:       ErrCommandTimeout,
+	CodeReplicaReadOnly:      ErrReadOnlyReplica,
+	CodeIdempotencyKeyReused: ErrIdempotencyKeyReuse,
+}
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrBadRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrUnauthorized,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusMisdirectedRequest:  ErrMisdirected,
+	http.StatusUnprocessableEntity: ErrUnprocessable,
+	http.StatusTooManyRequests:     ErrTooManyRequests,
+	http.StatusServiceUnavailable:  ErrUnavailable,
+	http.StatusGatewayTimeout:      ErrCommandTimeout,
+}
+
+// APIError 网关返回的错误响应
+type APIError struct {
+	Status     int             // HTTP状态码
+	Code       string          // 错误码（见 Code* 常量），网关未给出时为空
+	Message    string          // 响应 message，或 problem+json 的 title
+	Detail     string          // problem+json 的 detail
+	RequestID  string          // 链路追踪ID
+	RetryAfter time.Duration   // 响应 Retry-After
+	Data       json.RawMessage // 响应 data（如重复订单的 ttlSeconds、会话上限的 activePorts）
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("网关返回 HTTP %d", e.Status)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Detail != "" {
+		msg += "（" + e.Detail + "）"
+	}
+	return msg
+}
+
+// Is 按错误码与HTTP状态匹配错误类别
+func (e *APIError) Is(target error) bool {
+	if err, ok := codeErrors[e.Code]; ok && err == target {
+		return true
+	}
+	return statusErrors[e.Status] == target
+}
+
+// problemDetails RFC 7807 problem+json
+type problemDetails struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Detail    string          `json:"detail"`
+	RequestID string          `json:"requestId"`
+	Errors    json.RawMessage `json:"errors"`
+}
+
+// parseError 错误响应转换为 *APIError：problem+json 的 title 为错误码形式（如 COMMAND_TIMEOUT）时作为 Code，
+// 其余响应取 {code, message, data} 中的 data.errorCode
+func parseError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		Status:     resp.StatusCode,
+		RequestID:  resp.Header.Get(HeaderRequestID),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/problem+json" {
+		var p problemDetails
+		if json.Unmarshal(body, &p) == nil {
+			e.Message, e.Detail, e.Data = p.Title, p.Detail, p.Errors
+			if isErrorCode(p.Title) {
+				e.Code = p.Title
+			}
+			if e.RequestID == "" {
+				e.RequestID = p.RequestID
+			}
+		}
+		return e
+	}
+	var envelope struct {
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(body, &envelope) != nil {
+		e.Message = http.StatusText(resp.StatusCode)
+		return e
+	}
+	e.Message, e.Data = envelope.Message, envelope.Data
+	var data struct {
+		ErrorCode string `json:"errorCode"`
+	}
+	if json.Unmarshal(envelope.Data, &data) == nil {
+		e.Code = data.ErrorCode
+	}
+	return e
+}
+
+// isErrorCode 大写字母、数字与下划线组成的错误码
+func isErrorCode(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
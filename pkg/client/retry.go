@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy 重试策略：指数退避（附±20%抖动），响应携带 Retry-After 时按其等待
+type RetryPolicy struct {
+	MaxAttempts   int           // 总尝试次数（含首次），1 表示不重试
+	BaseDelay     time.Duration // 首次重试的退避时间
+	MaxDelay      time.Duration // 退避上限
+	MaxRetryAfter time.Duration // 可接受的 Retry-After 上限，超出时不再重试而直接返回错误
+}
+
+// DefaultRetryPolicy 默认策略：最多3次尝试，退避200ms起、上限5秒，Retry-After 不超过30秒
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second, MaxRetryAfter: 30 * time.Second}
+}
+
+// next 第 attempt 次尝试失败后是否重试及等待时间
+func (p RetryPolicy) next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !retryableError(err) {
+		return 0, false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if p.MaxRetryAfter > 0 && apiErr.RetryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+	delay := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay += time.Duration((rand.Float64()*0.4 - 0.2) * float64(delay))
+	}
+	return delay, true
+}
+
+// retryableError 网络错误、限流、网关暂不可用/超时，以及同一幂等键的首个请求仍在执行
+func retryableError(err error) bool {
+	var transport *transportError
+	if errors.As(err, &transport) {
+		return true
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return apiErr.Code != CodeReplicaReadOnly
+	case http.StatusConflict:
+		return apiErr.Code == CodeIdempotencyInFlight
+	}
+	return false
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或HTTP日期）
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Device 设备详情（/device/{deviceId}/status 与设备列表条目）；Raw 保留完整响应，未列出的字段从中读取
+type Device struct {
+	DeviceID        string   `json:"deviceId"`
+	PhysicalID      uint32   `json:"physicalId"`
+	DeviceNumber    string   `json:"deviceNumber"`
+	ICCID           string   `json:"iccid"`
+	DeviceType      uint16   `json:"deviceType"`
+	DeviceVersion   string   `json:"deviceVersion"`
+	Dialect         string   `json:"dialect,omitempty"`
+	IsOnline        bool     `json:"isOnline"`
+	RemoteAddr      string   `json:"remoteAddr,omitempty"`
+	LastHeartbeatTs int64    `json:"lastHeartbeatTs"`
+	ConnectedAtTs   int64    `json:"connectedAtTs,omitempty"`
+	RegisteredAtTs  int64    `json:"registeredAtTs,omitempty"`
+	StationID       string   `json:"stationId,omitempty"`
+	AssetCode       string   `json:"assetCode,omitempty"`
+	VirtualDevices  []string `json:"virtualDevices,omitempty"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON 解码已知字段并保留原始响应
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type plain Device
+	if err := json.Unmarshal(data, (*plain)(d)); err != nil {
+		return err
+	}
+	d.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// ListDevicesOptions 设备列表过滤条件
+type ListDevicesOptions struct {
+	StationID     string // 按站点过滤
+	DeviceType    uint16 // 按设备类型过滤，0表示不限
+	ExpandVirtual bool   // 已拆分设备展开为虚拟子设备
+}
+
+// DeviceList 在线设备列表
+type DeviceList struct {
+	Devices []Device `json:"devices"`
+	Total   int      `json:"total"`
+	Online  int      `json:"online"`
+}
+
+// PortStatus 端口状态
+type PortStatus struct {
+	Port        int        `json:"port"`
+	Status      uint8      `json:"status"`
+	State       string     `json:"state,omitempty"` // idle/charging/fault/occupied_no_charge
+	PowerW      float64    `json:"powerW"`
+	VoltageV    float64    `json:"voltageV,omitempty"`
+	EnergyWh    uint32     `json:"energyWh"` // 进行中订单的累计电量
+	LastUpdate  *time.Time `json:"lastUpdate,omitempty"`
+	Stale       bool       `json:"stale"`    // 超过过期窗口未上报
+	Reported    bool       `json:"reported"` // 是否收到过该端口的状态上报
+	OrderNo     string     `json:"orderNo,omitempty"`
+	OrderStatus string     `json:"orderStatus,omitempty"`
+}
+
+// DevicePorts 设备端口状态
+type DevicePorts struct {
+	DeviceID       string       `json:"deviceId"`
+	StandardID     string       `json:"standardId"`
+	ParentDeviceID string       `json:"parentDeviceId,omitempty"` // 按虚拟子设备查询时的物理设备ID
+	IsOnline       bool         `json:"isOnline"`
+	Ports          []PortStatus `json:"ports"`
+	Total          int          `json:"total"`
+}
+
+// SearchMatch 设备搜索结果
+type SearchMatch struct {
+	DeviceID     string    `json:"deviceId"`
+	PhysicalID   string    `json:"physicalId"`
+	ICCID        string    `json:"iccid"`
+	AssetCode    string    `json:"assetCode,omitempty"`
+	RemoteIP     string    `json:"remoteIp,omitempty"`
+	Online       bool      `json:"online"`
+	LastSeen     time.Time `json:"lastSeen"`
+	MatchedField string    `json:"matchedField"`
+	MatchedValue string    `json:"matchedValue"`
+	Highlight    string    `json:"highlight"`
+}
+
+// StartChargingRequest 开始充电
+type StartChargingRequest struct {
+	DeviceID string `json:"deviceId"`
+	Port     byte   `json:"port"`
+	Mode     byte   `json:"mode"`  // 0=按时间 1=按电量
+	Value    uint16 `json:"value"` // 时间(秒)/电量(0.1度)
+	OrderNo  string `json:"orderNo"`
+	Balance  uint32 `json:"balance,omitempty"` // 余额(分)
+	TenantID string `json:"tenantId,omitempty"`
+	DryRun   bool   `json:"dryRun,omitempty"`
+}
+
+// StopChargingRequest 停止充电
+type StopChargingRequest struct {
+	DeviceID string `json:"deviceId"`
+	Port     byte   `json:"port"` // 1-8，255 由设备选择端口
+	OrderNo  string `json:"orderNo,omitempty"`
+	DryRun   bool   `json:"dryRun,omitempty"`
+}
+
+// ModifyChargingRequest 调整进行中订单的过载功率与最大充电时长
+type ModifyChargingRequest struct {
+	DeviceID                 string `json:"deviceId"`
+	Port                     byte   `json:"port"`
+	OrderNo                  string `json:"orderNo"`
+	OverloadPowerW           uint16 `json:"overloadPowerW"`
+	MaxChargeDurationSeconds uint16 `json:"maxChargeDurationSeconds,omitempty"` // 0表示不修改
+	TenantID                 string `json:"tenantId,omitempty"`
+	DryRun                   bool   `json:"dryRun,omitempty"`
+}
+
+// ChargingResult 充电操作结果
+type ChargingResult struct {
+	DeviceID                 string          `json:"deviceId"`
+	StandardID               string          `json:"standardId"`
+	Port                     byte            `json:"port"`
+	OrderNo                  string          `json:"orderNo,omitempty"`
+	Mode                     byte            `json:"mode,omitempty"`
+	Value                    uint16          `json:"value,omitempty"`
+	Balance                  uint32          `json:"balance,omitempty"`
+	OverloadPowerW           uint16          `json:"overloadPowerW,omitempty"`
+	MaxChargeDurationSeconds uint16          `json:"maxChargeDurationSeconds,omitempty"`
+	Action                   string          `json:"action"`
+	State                    string          `json:"state,omitempty"` // queued 表示设备侧排队
+	Queue                    json.RawMessage `json:"queue,omitempty"`
+	Promotion                json.RawMessage `json:"promotion,omitempty"`
+	Timestamp                int64           `json:"timestamp"`
+	CorrelationID            string          `json:"correlationId,omitempty"`
+	VirtualDeviceID          string          `json:"virtualDeviceId,omitempty"`
+	VirtualPort              int             `json:"virtualPort,omitempty"`
+	DryRun                   bool            `json:"dryRun,omitempty"`
+	Packet                   json.RawMessage `json:"packet,omitempty"` // 试运行构造的0x82帧
+
+	IdempotencyKey string `json:"-"` // 本次调用使用的幂等键
+	Replayed       bool   `json:"-"` // 应答为同一幂等键首个请求的重放（命令未再次下发）
+}
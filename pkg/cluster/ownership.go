@@ -0,0 +1,327 @@
+// Package cluster 多实例部署时的设备归属：持有设备TCP连接的实例在共享存储中登记归属，
+// API调用方据此把设备请求路由（或代理）到归属实例。未启用集群模式时所有设备均归属本实例。
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultOwnerTTL        = 90 * time.Second
+	defaultRefreshInterval = 30 * time.Second
+	defaultLookupCacheTTL  = 5 * time.Second
+	defaultKeyPrefix       = "iot:device_owner:"
+	storeTimeout           = time.Second
+)
+
+// Owner 设备归属实例
+type Owner struct {
+	InstanceID string `json:"instanceId"`
+	APIBaseURL string `json:"apiBaseUrl,omitempty"`
+	Self       bool   `json:"self"`                // 是否为处理本次请求的实例（查询时计算）
+	ClaimedAt  int64  `json:"claimedAt,omitempty"` // 最近一次登记时间（Unix秒）
+}
+
+// LocalDevices 本实例持有连接的设备（由设备网关实现）
+type LocalDevices interface {
+	IsDeviceOnline(deviceID string) bool
+	GetAllOnlineDevices() []string
+}
+
+// Options 设备归属配置
+type Options struct {
+	Enabled         bool
+	InstanceID      string
+	APIBaseURL      string
+	OwnerTTL        time.Duration // 归属键过期时间：实例崩溃后其登记的设备在此时间后自动失效
+	RefreshInterval time.Duration // 续期/对账周期，须小于 OwnerTTL
+	LookupCacheTTL  time.Duration // 远端归属查询结果的本地缓存时间
+	Store           Store
+	Local           LocalDevices
+}
+
+type cacheEntry struct {
+	owner     Owner
+	found     bool
+	expiresAt time.Time
+}
+
+// Ownership 设备归属登记与查询
+type Ownership struct {
+	opts Options
+
+	mu         sync.Mutex
+	claimed    map[string]bool
+	cache      map[string]cacheEntry
+	standalone bool // Redis降级期间按单实例运行
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	now      func() time.Time
+}
+
+// NewOwnership 创建设备归属管理；未启用或缺少存储时退化为单实例模式
+func NewOwnership(opts Options) *Ownership {
+	if opts.InstanceID == "" {
+		opts.InstanceID = defaultInstanceID()
+	}
+	if opts.OwnerTTL <= 0 {
+		opts.OwnerTTL = defaultOwnerTTL
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = defaultRefreshInterval
+	}
+	if opts.RefreshInterval >= opts.OwnerTTL {
+		opts.RefreshInterval = opts.OwnerTTL / 3
+	}
+	if opts.LookupCacheTTL <= 0 {
+		opts.LookupCacheTTL = defaultLookupCacheTTL
+	}
+	if opts.Store == nil {
+		opts.Enabled = false
+	}
+	return &Ownership{
+		opts:    opts,
+		claimed: make(map[string]bool),
+		cache:   make(map[string]cacheEntry),
+		stopCh:  make(chan struct{}),
+		now:     time.Now,
+	}
+}
+
+// Enabled 是否处于集群模式
+func (o *Ownership) Enabled() bool {
+	return o != nil && o.opts.Enabled
+}
+
+// Self 本实例的归属信息
+func (o *Ownership) Self() Owner {
+	if o == nil {
+		return Owner{InstanceID: defaultInstanceID(), Self: true}
+	}
+	return Owner{InstanceID: o.opts.InstanceID, APIBaseURL: o.opts.APIBaseURL, Self: true}
+}
+
+// Lookup 查询设备归属实例：本实例在线的设备或非集群模式直接返回本实例，
+// 否则读取共享归属键（带短时缓存）；无实例登记时返回false
+func (o *Ownership) Lookup(deviceID string) (Owner, bool) {
+	if !o.Enabled() {
+		return o.Self(), true
+	}
+	if o.opts.Local != nil && o.opts.Local.IsDeviceOnline(deviceID) {
+		return o.Self(), true
+	}
+	// Redis降级期间按单实例运行：不查询共享归属，其他实例的设备视为无归属
+	if infraredis.Degraded() {
+		return Owner{}, false
+	}
+
+	now := o.now()
+	o.mu.Lock()
+	if e, ok := o.cache[deviceID]; ok && now.Before(e.expiresAt) {
+		o.mu.Unlock()
+		return e.owner, e.found
+	}
+	o.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	owner, found, err := o.opts.Store.Get(ctx, deviceID)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"deviceId": deviceID, "error": err.Error()}).Debug("查询设备归属失败")
+		return Owner{}, false
+	}
+	// 归属键指向本实例但本实例并未持有连接：连接已断开、键尚未过期，视为无归属
+	if found && owner.InstanceID == o.opts.InstanceID {
+		found = false
+	}
+	if !found {
+		owner = Owner{}
+	}
+
+	o.mu.Lock()
+	o.cache[deviceID] = cacheEntry{owner: owner, found: found, expiresAt: now.Add(o.opts.LookupCacheTTL)}
+	o.mu.Unlock()
+	return owner, found
+}
+
+// LookupRemote 查询归属于其他实例的设备，设备在本实例或无归属时返回false
+func (o *Ownership) LookupRemote(deviceID string) (Owner, bool) {
+	if !o.Enabled() {
+		return Owner{}, false
+	}
+	owner, found := o.Lookup(deviceID)
+	if !found || owner.Self {
+		return Owner{}, false
+	}
+	return owner, true
+}
+
+// Sync 登记（续期）本实例在线设备的归属，释放已不在本实例在线的设备
+func (o *Ownership) Sync() {
+	if !o.Enabled() || o.opts.Local == nil {
+		return
+	}
+	// Redis降级期间跳过登记，恢复后的首次续期重新登记全部在线设备（期间过期的归属键随之恢复）
+	if infraredis.Degraded() {
+		o.mu.Lock()
+		o.standalone = true
+		o.mu.Unlock()
+		return
+	}
+	o.mu.Lock()
+	if o.standalone {
+		o.standalone = false
+		o.cache = make(map[string]cacheEntry)
+		logger.Info("Redis已恢复，设备归属恢复集群模式")
+	}
+	o.mu.Unlock()
+	online := o.opts.Local.GetAllOnlineDevices()
+	current := make(map[string]bool, len(online))
+	owner := Owner{InstanceID: o.opts.InstanceID, APIBaseURL: o.opts.APIBaseURL, ClaimedAt: o.now().Unix()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.opts.RefreshInterval)
+	defer cancel()
+	failed := 0
+	for _, deviceID := range online {
+		current[deviceID] = true
+		if err := o.opts.Store.Claim(ctx, deviceID, owner, o.opts.OwnerTTL); err != nil {
+			failed++
+		}
+	}
+
+	o.mu.Lock()
+	var released []string
+	for deviceID := range o.claimed {
+		if !current[deviceID] {
+			released = append(released, deviceID)
+		}
+	}
+	o.claimed = current
+	o.mu.Unlock()
+
+	for _, deviceID := range released {
+		_ = o.opts.Store.Release(ctx, deviceID, o.opts.InstanceID)
+	}
+	if failed > 0 {
+		logger.WithFields(logrus.Fields{"failed": failed, "total": len(online)}).Warn("登记设备归属失败")
+	}
+}
+
+// Start 启动周期登记（随上下文取消或 Stop 停止）
+func (o *Ownership) Start(ctx context.Context) {
+	if !o.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(o.opts.RefreshInterval)
+		defer ticker.Stop()
+		o.Sync()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-o.stopCh:
+				return
+			case <-ticker.C:
+				o.Sync()
+			}
+		}
+	}()
+}
+
+// Stop 停止周期登记并释放本实例登记的归属，设备重连到其他实例后立即可查
+func (o *Ownership) Stop() {
+	if !o.Enabled() {
+		return
+	}
+	o.stopOnce.Do(func() {
+		close(o.stopCh)
+		o.mu.Lock()
+		claimed := o.claimed
+		o.claimed = make(map[string]bool)
+		o.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for deviceID := range claimed {
+			_ = o.opts.Store.Release(ctx, deviceID, o.opts.InstanceID)
+		}
+	})
+}
+
+func defaultInstanceID() string {
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "gateway"
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalOwnership *Ownership
+
+// GetGlobalOwnership 获取全局设备归属管理（未初始化时为nil，方法按单实例模式处理）
+func GetGlobalOwnership() *Ownership {
+	return globalOwnership
+}
+
+// SetGlobalOwnership 设置全局设备归属管理
+func SetGlobalOwnership(o *Ownership) {
+	globalOwnership = o
+}
+
+// InitGlobalOwnership 按配置初始化全局设备归属管理（需在Redis初始化之后调用）
+func InitGlobalOwnership(ctx context.Context, local LocalDevices) error {
+	cfg := config.GetConfig().Cluster
+	opts := Options{
+		Enabled:         cfg.Enabled,
+		InstanceID:      cfg.InstanceID,
+		APIBaseURL:      cfg.AdvertiseURL,
+		OwnerTTL:        time.Duration(cfg.OwnerTTLSeconds) * time.Second,
+		RefreshInterval: time.Duration(cfg.RefreshIntervalSeconds) * time.Second,
+		LookupCacheTTL:  time.Duration(cfg.LookupCacheSeconds) * time.Second,
+		Local:           local,
+	}
+	var err error
+	if cfg.Enabled {
+		if client := infraredis.GetClient(); client != nil {
+			prefix := cfg.KeyPrefix
+			if prefix == "" {
+				prefix = defaultKeyPrefix
+			}
+			opts.Store = NewRedisStore(client, prefix)
+		} else {
+			err = fmt.Errorf("集群模式需要Redis存储设备归属，但Redis未连接，按单实例运行")
+		}
+	}
+
+	o := NewOwnership(opts)
+	SetGlobalOwnership(o)
+	o.Start(ctx)
+	if o.Enabled() {
+		logger.WithFields(logrus.Fields{
+			"instanceId": o.opts.InstanceID,
+			"apiBaseUrl": o.opts.APIBaseURL,
+		}).Info("集群设备归属已启用")
+	}
+	return err
+}
+
+// StopGlobalOwnership 停止全局设备归属管理
+func StopGlobalOwnership() {
+	if globalOwnership != nil {
+		globalOwnership.Stop()
+	}
+}
@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store 设备归属键存储（多实例共享）
+type Store interface {
+	// Claim 写入（覆盖）设备归属并设置过期时间：持有TCP连接的实例即为归属实例，后连接者生效
+	Claim(ctx context.Context, deviceID string, owner Owner, ttl time.Duration) error
+	// Release 仅当设备当前归属于 instanceID 时删除归属键，避免误删设备已迁移到的新实例的键
+	Release(ctx context.Context, deviceID, instanceID string) error
+	// Get 查询设备归属，不存在时返回false
+	Get(ctx context.Context, deviceID string) (Owner, bool, error)
+}
+
+// RedisStore Redis归属键存储（每台设备一个键，值为JSON）
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// releaseScript 比较实例ID后删除（原子操作）
+var releaseScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if not v then return 0 end
+local ok, owner = pcall(cjson.decode, v)
+if ok and owner["instanceId"] == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// NewRedisStore 创建Redis归属键存储
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) key(deviceID string) string {
+	return s.prefix + deviceID
+}
+
+// Claim 写入设备归属
+func (s *RedisStore) Claim(ctx context.Context, deviceID string, owner Owner, ttl time.Duration) error {
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(deviceID), data, ttl).Err()
+}
+
+// Release 删除本实例持有的设备归属
+func (s *RedisStore) Release(ctx context.Context, deviceID, instanceID string) error {
+	return releaseScript.Run(ctx, s.client, []string{s.key(deviceID)}, instanceID).Err()
+}
+
+// Get 查询设备归属
+func (s *RedisStore) Get(ctx context.Context, deviceID string) (Owner, bool, error) {
+	data, err := s.client.Get(ctx, s.key(deviceID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Owner{}, false, nil
+	}
+	if err != nil {
+		return Owner{}, false, fmt.Errorf("读取设备归属失败: %w", err)
+	}
+	var owner Owner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return Owner{}, false, fmt.Errorf("解析设备归属失败: %w", err)
+	}
+	return owner, true, nil
+}
+
+// MemoryStore 进程内归属键存储（单机调试与测试使用，多个 Ownership 可共享同一实例模拟多实例）
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	owner     Owner
+	expiresAt time.Time
+}
+
+// NewMemoryStore 创建进程内归属键存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+// Claim 写入设备归属
+func (s *MemoryStore) Claim(_ context.Context, deviceID string, owner Owner, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[deviceID] = memoryEntry{owner: owner, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+// Release 删除本实例持有的设备归属
+func (s *MemoryStore) Release(_ context.Context, deviceID, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[deviceID]; ok && e.owner.InstanceID == instanceID {
+		delete(s.entries, deviceID)
+	}
+	return nil
+}
+
+// Get 查询设备归属（已过期视为不存在）
+func (s *MemoryStore) Get(_ context.Context, deviceID string) (Owner, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[deviceID]
+	if !ok {
+		return Owner{}, false, nil
+	}
+	if !s.now().Before(e.expiresAt) {
+		delete(s.entries, deviceID)
+		return Owner{}, false, nil
+	}
+	return e.owner, true, nil
+}
@@ -0,0 +1,167 @@
+package commlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 二进制抓包格式（供厂商桌面分析工具导入），所有整数均为大端序：
+//
+//	文件头（6字节）:
+//	  magic    [4]byte  "DNYC"
+//	  version  uint16   CaptureVersion
+//	每条记录（13字节 + 帧长）:
+//	  timestamp int64   Unix纳秒时间戳
+//	  direction uint8   1=上行(设备→网关) 2=下行(网关→设备) 3=注释(UTF-8文本，抽样跟踪中的解码结果)
+//	  length    uint32  帧字节数
+//	  frame     [length]byte 原始帧
+//
+// 文件在最后一条记录之后结束，不含记录数与尾部校验
+const (
+	CaptureMagic   = "DNYC"
+	CaptureVersion = uint16(1)
+
+	// MaxCaptureFrameBytes 单条记录帧长上限，防止损坏文件导致超大分配
+	MaxCaptureFrameBytes = 64 * 1024
+)
+
+// 导出格式
+const (
+	FormatBinary = "bin"
+	FormatJSONL  = "jsonl"
+)
+
+// ErrBadCapture 抓包文件格式错误
+var ErrBadCapture = errors.New("无效的抓包文件")
+
+// 抓包文件头与记录头长度
+const (
+	CaptureHeaderSize       = 6
+	CaptureRecordHeaderSize = 13
+)
+
+// AppendCaptureHeader 追加二进制抓包文件头
+func AppendCaptureHeader(dst []byte) []byte {
+	dst = append(dst, CaptureMagic...)
+	return binary.BigEndian.AppendUint16(dst, CaptureVersion)
+}
+
+// AppendCaptureRecord 追加一条二进制抓包记录
+func AppendCaptureRecord(dst []byte, at time.Time, dir Direction, frame []byte) []byte {
+	dst = binary.BigEndian.AppendUint64(dst, uint64(at.UnixNano()))
+	dst = append(dst, byte(dir))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(frame)))
+	return append(dst, frame...)
+}
+
+// WriteCapture 按二进制抓包格式写出记录
+func WriteCapture(w io.Writer, records []Record) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(AppendCaptureHeader(nil)); err != nil {
+		return err
+	}
+	var buf []byte
+	for _, rec := range records {
+		buf = AppendCaptureRecord(buf[:0], rec.Time, rec.Direction, rec.Frame)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadCapture 读取二进制抓包文件
+func ReadCapture(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 6)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: 读取文件头失败: %v", ErrBadCapture, err)
+	}
+	if string(header[:4]) != CaptureMagic {
+		return nil, fmt.Errorf("%w: magic %q", ErrBadCapture, header[:4])
+	}
+	if version := binary.BigEndian.Uint16(header[4:]); version != CaptureVersion {
+		return nil, fmt.Errorf("%w: 不支持的版本 %d", ErrBadCapture, version)
+	}
+
+	var records []Record
+	var prefix [13]byte
+	for {
+		if _, err := io.ReadFull(br, prefix[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("%w: 第%d条记录头不完整", ErrBadCapture, len(records)+1)
+		}
+		length := binary.BigEndian.Uint32(prefix[9:13])
+		if length > MaxCaptureFrameBytes {
+			return nil, fmt.Errorf("%w: 第%d条记录帧长 %d 超过上限", ErrBadCapture, len(records)+1, length)
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(br, frame); err != nil {
+			return nil, fmt.Errorf("%w: 第%d条记录帧数据不完整", ErrBadCapture, len(records)+1)
+		}
+		records = append(records, Record{
+			Time:      time.Unix(0, int64(binary.BigEndian.Uint64(prefix[0:8]))),
+			Direction: Direction(prefix[8]),
+			Frame:     frame,
+		})
+	}
+}
+
+// JSONRecord JSONL导出的单行
+type JSONRecord struct {
+	Timestamp int64  `json:"timestamp"` // Unix纳秒
+	Time      string `json:"time"`      // RFC3339Nano，便于阅读
+	Direction string `json:"direction"` // uplink | downlink | annotation
+	Length    int    `json:"length"`
+	Hex       string `json:"hex"`
+}
+
+// WriteJSONL 每条记录一行JSON写出
+func WriteJSONL(w io.Writer, records []Record) error {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	for _, rec := range records {
+		if err := encoder.Encode(JSONRecord{
+			Timestamp: rec.Time.UnixNano(),
+			Time:      rec.Time.Format(time.RFC3339Nano),
+			Direction: rec.Direction.String(),
+			Length:    len(rec.Frame),
+			Hex:       hex.EncodeToString(rec.Frame),
+		}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadJSONL 读取JSONL导出
+func ReadJSONL(r io.Reader) ([]Record, error) {
+	decoder := json.NewDecoder(r)
+	var records []Record
+	for {
+		var line JSONRecord
+		if err := decoder.Decode(&line); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("%w: 第%d行: %v", ErrBadCapture, len(records)+1, err)
+		}
+		dir, err := ParseDirection(line.Direction)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 第%d行: %v", ErrBadCapture, len(records)+1, err)
+		}
+		frame, err := hex.DecodeString(line.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 第%d行帧数据: %v", ErrBadCapture, len(records)+1, err)
+		}
+		records = append(records, Record{Time: time.Unix(0, line.Timestamp), Direction: dir, Frame: frame})
+	}
+}
@@ -0,0 +1,210 @@
+package commlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+)
+
+// 默认容量
+const (
+	DefaultFramesPerDevice = 200
+	DefaultMaxDevices      = 5000
+)
+
+// Direction 帧方向
+type Direction byte
+
+const (
+	DirectionUplink     Direction = 1 // 设备 → 网关
+	DirectionDownlink   Direction = 2 // 网关 → 设备
+	DirectionAnnotation Direction = 3 // 注释记录（抽样跟踪中的解码结果等），帧内容为UTF-8文本
+)
+
+// String 方向名称
+func (d Direction) String() string {
+	switch d {
+	case DirectionUplink:
+		return "uplink"
+	case DirectionDownlink:
+		return "downlink"
+	case DirectionAnnotation:
+		return "annotation"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(d))
+	}
+}
+
+// ParseDirection 解析方向名称
+func ParseDirection(s string) (Direction, error) {
+	switch s {
+	case "uplink":
+		return DirectionUplink, nil
+	case "downlink":
+		return DirectionDownlink, nil
+	case "annotation":
+		return DirectionAnnotation, nil
+	default:
+		return 0, fmt.Errorf("未知帧方向: %q", s)
+	}
+}
+
+// Record 一条通信记录
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Frame     []byte
+}
+
+// ring 单设备定长环形缓冲
+type ring struct {
+	records   []Record
+	next      int
+	count     int
+	lastWrite time.Time
+}
+
+func (r *ring) append(rec Record) {
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % len(r.records)
+	if r.count < len(r.records) {
+		r.count++
+	}
+	r.lastWrite = rec.Time
+}
+
+func (r *ring) snapshot() []Record {
+	out := make([]Record, 0, r.count)
+	start := (r.next - r.count + len(r.records)) % len(r.records)
+	for i := 0; i < r.count; i++ {
+		out = append(out, r.records[(start+i)%len(r.records)])
+	}
+	return out
+}
+
+// Log 按设备保存最近收发帧的环形缓冲，超过设备上限时淘汰最久未写入的设备
+type Log struct {
+	mu              sync.Mutex
+	framesPerDevice int
+	maxDevices      int
+	devices         map[string]*ring
+}
+
+// NewLog 创建通信日志，非正数容量使用默认值
+func NewLog(framesPerDevice, maxDevices int) *Log {
+	if framesPerDevice <= 0 {
+		framesPerDevice = DefaultFramesPerDevice
+	}
+	if maxDevices <= 0 {
+		maxDevices = DefaultMaxDevices
+	}
+	return &Log{framesPerDevice: framesPerDevice, maxDevices: maxDevices, devices: make(map[string]*ring)}
+}
+
+// Append 记录一帧（复制帧数据，调用方可复用缓冲区）
+func (l *Log) Append(deviceID string, dir Direction, frame []byte, at time.Time) {
+	if l == nil || deviceID == "" || len(frame) == 0 {
+		return
+	}
+	rec := Record{Time: at, Direction: dir, Frame: append([]byte(nil), frame...)}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.devices[deviceID]
+	if !ok {
+		if len(l.devices) >= l.maxDevices {
+			l.evictOldestLocked()
+		}
+		r = &ring{records: make([]Record, l.framesPerDevice)}
+		l.devices[deviceID] = r
+	}
+	r.append(rec)
+}
+
+func (l *Log) evictOldestLocked() {
+	var oldestID string
+	var oldest time.Time
+	for id, r := range l.devices {
+		if oldestID == "" || r.lastWrite.Before(oldest) {
+			oldestID, oldest = id, r.lastWrite
+		}
+	}
+	delete(l.devices, oldestID)
+}
+
+// Records 设备缓冲中的帧（旧→新）
+func (l *Log) Records(deviceID string) []Record {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.devices[deviceID]
+	if !ok {
+		return nil
+	}
+	return r.snapshot()
+}
+
+// Devices 当前有缓冲的设备数
+func (l *Log) Devices() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.devices)
+}
+
+// FramesPerDevice 单设备缓冲帧数
+func (l *Log) FramesPerDevice() int { return l.framesPerDevice }
+
+// DNYPhysicalID 从DNY帧中取物理ID（"DNY"+2字节长度之后的4字节小端），非DNY帧返回空串
+func DNYPhysicalID(frame []byte) string {
+	if len(frame) < 9 || frame[0] != 'D' || frame[1] != 'N' || frame[2] != 'Y' {
+		return ""
+	}
+	return fmt.Sprintf("%08X", binary.LittleEndian.Uint32(frame[5:9]))
+}
+
+var globalLog atomic.Pointer[Log]
+
+func init() {
+	globalLog.Store(NewLog(0, 0))
+}
+
+// GetGlobalLog 获取全局通信日志
+func GetGlobalLog() *Log {
+	return globalLog.Load()
+}
+
+// SetGlobalLog 设置全局通信日志
+func SetGlobalLog(l *Log) {
+	globalLog.Store(l)
+}
+
+// InitGlobalLog 按配置创建全局通信日志；关闭时不再记录
+func InitGlobalLog() *Log {
+	cfg := config.GetConfig().CommLog
+	if !cfg.Enabled {
+		globalLog.Store(nil)
+		return nil
+	}
+	l := NewLog(cfg.FramesPerDevice, cfg.MaxDevices)
+	globalLog.Store(l)
+	return l
+}
+
+// RecordUplink 记录设备上行帧
+func RecordUplink(deviceID string, frame []byte) {
+	GetGlobalLog().Append(deviceID, DirectionUplink, frame, time.Now())
+}
+
+// RecordDownlink 记录下行DNY帧（设备ID取自帧内物理ID）
+func RecordDownlink(frame []byte) {
+	GetGlobalLog().Append(DNYPhysicalID(frame), DirectionDownlink, frame, time.Now())
+}
@@ -85,6 +85,9 @@ const (
 	CmdUpgradeMain    = 0xE2 // 设备固件升级(主机统一)
 	CmdUpgradeOld     = 0xF8 // 设备固件升级(旧版)
 	CmdUpgradeMainNew = 0xFA // 主机固件升级（新版）
+
+	// 否定应答（厂商约定，协议文档未定义）
+	CmdErrorReply = 0xFF // 通用错误应答：部分老固件对无法识别的命令以此回复，数据为[原命令, 错误码]或仅[错误码]
 )
 
 // ============================================================================
@@ -24,6 +24,8 @@ func initDefaultCommands() {
 		// 充电控制类命令
 		{ID: CmdSwipeCard, Name: "刷卡操作", Description: "刷卡操作", Category: CategoryCharging, Priority: 1},
 		{ID: CmdSettlement, Name: "结算消费信息上传", Description: "结算消费信息上传", Category: CategoryCharging, Priority: 2},
+		{ID: CmdTimeBillingSettlement, Name: "分时收费结算", Description: "分时收费结算专用（2025-2-10新增）", Category: CategoryCharging, Priority: 2},
+		{ID: CmdPortPowerHeartbeat, Name: "端口充电时功率心跳包(扩展)", Description: "端口充电时功率心跳包（扩展版本）", Category: CategoryHeartbeat, Priority: 5},
 		{ID: CmdOrderConfirm, Name: "充电端口订单确认", Description: "充电端口订单确认", Category: CategoryCharging, Priority: 1},
 		{ID: CmdChargeControl, Name: "服务器开始、停止充电操作", Description: "服务器开始、停止充电操作", Category: CategoryCharging, Priority: 1},
 		{ID: CmdModifyCharge, Name: "服务器修改充电时长/电量", Description: "服务器修改充电时长/电量", Category: CategoryCharging, Priority: 2},
@@ -73,6 +75,9 @@ func initDefaultCommands() {
 		{ID: CmdUpgradeMain, Name: "设备固件升级(主机统一)", Description: "设备固件升级(主机统一)", Category: CategoryUpgrade, Priority: 3},
 		{ID: CmdUpgradeOld, Name: "设备固件升级(旧版)", Description: "设备固件升级(旧版)", Category: CategoryUpgrade, Priority: 3},
 		{ID: CmdUpgradeMainNew, Name: "主机固件升级（新版）", Description: "主机固件升级（新版）", Category: CategoryUpgrade, Priority: 3},
+
+		// 否定应答
+		{ID: CmdErrorReply, Name: "通用错误应答", Description: "老固件对无法识别的命令的否定应答（厂商约定）", Category: CategoryUnknown, Priority: 5},
 	}
 
 	// 批量注册命令
@@ -151,3 +151,11 @@ func GetCommandDescription(commandID uint8) string {
 func GetCommandInfo(commandID uint8) (*CommandInfo, bool) {
 	return GetGlobalCommandRegistry().GetCommandInfo(commandID)
 }
+
+// CommandLabel 日志用命令标识：十六进制命令码加名称，如 "0x82 服务器开始、停止充电操作"
+func CommandLabel(commandID uint8) string {
+	if info, exists := GetCommandInfo(commandID); exists {
+		return fmt.Sprintf("0x%02X %s", commandID, info.Name)
+	}
+	return fmt.Sprintf("0x%02X 未知命令", commandID)
+}
@@ -105,6 +105,8 @@ const (
 	StatusSuccess = 0x00 // 成功
 	StatusError   = 0xFF // 错误
 
+	StatusUnknownCommand = 0xFE // 未知命令（部分固件以原命令码应答此状态）
+
 	// 充电控制状态码（0x82命令响应）
 	ChargeStatusSuccess          = 0x00 // 成功
 	ChargeStatusNoCharger        = 0x01 // 端口未插充电器
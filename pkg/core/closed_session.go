@@ -0,0 +1,125 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ClosedSession 已关闭连接的会话摘要（连接清理时生成，供会话归档使用）
+type ClosedSession struct {
+	ConnID         uint64
+	RemoteAddr     string
+	ICCID          string
+	DeviceIDs      []string
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+	BytesIn        int64
+	BytesOut       int64
+	Reason         string
+}
+
+// ClosedSessionObserver 连接关闭观察者，在连接清理中同步调用，实现须快速返回（耗时操作应异步进行）
+type ClosedSessionObserver func(ClosedSession)
+
+// SetClosedSessionObserver 设置连接关闭观察者（重复设置时覆盖，nil 表示移除）
+func (m *TCPManager) SetClosedSessionObserver(observer ClosedSessionObserver) {
+	if observer == nil {
+		m.closedObserver.Store(nil)
+		return
+	}
+	m.closedObserver.Store(&observer)
+}
+
+// HasClosedSessionObserver 是否已设置连接关闭观察者（装配自检用）
+func (m *TCPManager) HasClosedSessionObserver() bool {
+	return m.closedObserver.Load() != nil
+}
+
+// notifyClosed 通知连接关闭观察者
+func (m *TCPManager) notifyClosed(session *ConnectionSession, iccid string, deviceIDs []string, reason string) {
+	observer := m.closedObserver.Load()
+	if observer == nil {
+		return
+	}
+	session.mutex.RLock()
+	closed := ClosedSession{
+		ConnID:         session.ConnID,
+		RemoteAddr:     session.RemoteAddr,
+		ICCID:          iccid,
+		DeviceIDs:      deviceIDs,
+		ConnectedAt:    session.ConnectedAt,
+		DisconnectedAt: time.Now(),
+		Reason:         reason,
+	}
+	session.mutex.RUnlock()
+	closed.BytesIn = atomic.LoadInt64(&session.DataBytesIn)
+	closed.BytesOut = atomic.LoadInt64(&session.DataBytesOut)
+	(*observer)(closed)
+}
+
+// RecordConnTraffic 累计连接收发的字节数（TCP管理器未初始化或连接已清理时忽略）
+func RecordConnTraffic(connID uint64, bytesIn, bytesOut int) {
+	session := lookupConnSession(connID)
+	if session == nil {
+		return
+	}
+	if bytesIn > 0 {
+		atomic.AddInt64(&session.DataBytesIn, int64(bytesIn))
+	}
+	if bytesOut > 0 {
+		atomic.AddInt64(&session.DataBytesOut, int64(bytesOut))
+	}
+}
+
+// RecordConnInbound 累计连接收到的字节数；连接被抽样时记录收到的原始字节并返回抽样记录（供解码后追加注释），
+// 未抽样的连接只多一次判空，返回nil
+func RecordConnInbound(connID uint64, data []byte) ConnTrace {
+	session := lookupConnSession(connID)
+	if session == nil {
+		return nil
+	}
+	atomic.AddInt64(&session.DataBytesIn, int64(len(data)))
+	trace := session.connTrace()
+	if trace != nil {
+		trace.Frame(true, data, time.Now())
+	}
+	return trace
+}
+
+// RecordConnChecksumFailure 累计连接收到的校验和错误帧数（供设备详情识别长期劣化的链路）
+func RecordConnChecksumFailure(connID uint64) {
+	if session := lookupConnSession(connID); session != nil {
+		atomic.AddInt64(&session.ChecksumFailures, 1)
+	}
+}
+
+// RecordConnDuplicateFrame 累计连接上被重复帧抑制拦截的设备重发帧数（应答丢失时设备会重发同一帧）
+func RecordConnDuplicateFrame(connID uint64) {
+	if session := lookupConnSession(connID); session != nil {
+		atomic.AddInt64(&session.DuplicateFrames, 1)
+	}
+}
+
+// RecordConnOutbound 累计连接发出的字节数；连接被抽样时记录发出的原始字节
+func RecordConnOutbound(connID uint64, data []byte) {
+	session := lookupConnSession(connID)
+	if session == nil {
+		return
+	}
+	atomic.AddInt64(&session.DataBytesOut, int64(len(data)))
+	if trace := session.connTrace(); trace != nil {
+		trace.Frame(false, data, time.Now())
+	}
+}
+
+func lookupConnSession(connID uint64) *ConnectionSession {
+	m := globalTCPManager.Load()
+	if m == nil {
+		return nil
+	}
+	value, ok := m.connections.Load(connID)
+	if !ok {
+		return nil
+	}
+	return value.(*ConnectionSession)
+}
@@ -0,0 +1,286 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCommandQueueFull 设备组出站命令队列已满
+var ErrCommandQueueFull = errors.New("设备组命令队列已满")
+
+// ErrCommandQueueBusy 设备组队列中排在前面的命令按最长应答等待计算，调用方的期限内无法轮到写入
+var ErrCommandQueueBusy = errors.New("设备组命令队列繁忙，期限内无法写入")
+
+// ErrCommandWriterUnset 未设置命令写入器，无法经设备组队列下发命令
+var ErrCommandWriterUnset = errors.New("命令写入器未设置")
+
+// CommandQueueConfig 设备组出站命令队列配置
+// 同一ICCID下的设备共享一条TCP连接，并发下发的命令交错写入会破坏帧，设备将两条命令都丢弃；
+// 每个设备组的命令经队列由单个写入协程依次写入，需要应答的命令在确认（或超时）后才写入下一条。
+// 入队时两项限制同时生效，先触及者拒绝：排队深度达到 MaxDepth 返回 ErrCommandQueueFull；
+// 深度×ConfirmTimeout 超出调用方剩余期限（未设置期限时为 MaxWait）返回 ErrCommandQueueBusy。
+// MaxDepth 未设置时取 MaxWait/ConfirmTimeout，两项限制对未设置期限的调用方在同一深度生效
+type CommandQueueConfig struct {
+	MaxDepth       int           `json:"max_depth"`       // 每个设备组排队（含正在执行）的命令数上限，超出时拒绝；<=0 取 MaxWait/ConfirmTimeout
+	ConfirmTimeout time.Duration `json:"confirm_timeout"` // 等待设备应答的最长时间，超时后继续写入下一条
+	MaxWait        time.Duration `json:"max_wait"`        // 调用方未设置期限时，等待排队写入的最长时间
+}
+
+// DefaultCommandQueueConfig 默认设备组出站命令队列配置（深度上限 30s/5s=6）
+func DefaultCommandQueueConfig() *CommandQueueConfig {
+	cfg := &CommandQueueConfig{
+		ConfirmTimeout: 5 * time.Second,
+		MaxWait:        30 * time.Second,
+	}
+	cfg.MaxDepth = waitBoundDepth(cfg.MaxWait, cfg.ConfirmTimeout)
+	return cfg
+}
+
+// waitBoundDepth 未设置期限的调用方在 maxWait 内能轮到写入的排队深度上限（至少1）
+func waitBoundDepth(maxWait, confirmTimeout time.Duration) int {
+	if depth := int(maxWait / confirmTimeout); depth > 1 {
+		return depth
+	}
+	return 1
+}
+
+// SetCommandQueueConfig 设置设备组出站命令队列配置（nil 忽略，非法值回退默认，MaxDepth 未设置时按等待时长推导）
+func (m *TCPManager) SetCommandQueueConfig(config *CommandQueueConfig) {
+	if config == nil {
+		return
+	}
+	cfg := *config
+	defaults := DefaultCommandQueueConfig()
+	if cfg.ConfirmTimeout <= 0 {
+		cfg.ConfirmTimeout = defaults.ConfirmTimeout
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = defaults.MaxWait
+	}
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = waitBoundDepth(cfg.MaxWait, cfg.ConfirmTimeout)
+	}
+	m.commandQueue.Store(&cfg)
+}
+
+// GetCommandQueueConfig 获取当前设备组出站命令队列配置副本
+func (m *TCPManager) GetCommandQueueConfig() CommandQueueConfig {
+	if cfg := m.commandQueue.Load(); cfg != nil {
+		return *cfg
+	}
+	return *DefaultCommandQueueConfig()
+}
+
+// CommandWait 等待已写入命令的设备应答，timeout 内确认返回nil
+type CommandWait func(timeout time.Duration) error
+
+// CommandWrite 在设备组写入协程中执行的一次命令写入：conn 为设备组当前连接，返回等待应答的函数（不跟踪应答时为nil）
+type CommandWrite func(conn ziface.IConnection) (CommandWait, error)
+
+// CommandWriter 构包并写入命令（由上层注入，避免core依赖协议构包与命令管理器）
+type CommandWriter func(conn ziface.IConnection, deviceID string, cmd byte, data []byte) (CommandWait, error)
+
+// SetCommandWriter 设置 SendCommandToDevice 使用的命令写入器（重复设置时覆盖，nil 表示移除）
+func (m *TCPManager) SetCommandWriter(writer CommandWriter) {
+	if writer == nil {
+		m.commandWriter.Store(nil)
+		return
+	}
+	m.commandWriter.Store(&writer)
+}
+
+// HasCommandWriter 是否已设置命令写入器
+func (m *TCPManager) HasCommandWriter() bool {
+	return m.commandWriter.Load() != nil
+}
+
+// needConfirmation 命令写入后是否须等待设备应答才写入同组的下一条（设备不应答的下发服务器时间写入即完成）
+func needConfirmation(cmd byte) bool {
+	switch cmd {
+	case constants.CmdDeviceTime, constants.CmdGetServerTime:
+		return false
+	}
+	return true
+}
+
+// queuedCommand 设备组队列中的一条命令
+type queuedCommand struct {
+	deviceID string
+	cmd      byte
+	write    CommandWrite
+	done     chan error // 写入完成（不含等待应答）时回传写入结果
+}
+
+// commandQueue 设备组出站命令队列（受自身互斥锁保护，与设备组锁无关）
+type commandQueue struct {
+	mu      sync.Mutex
+	pending []*queuedCommand
+	active  bool // 写入协程正在执行一条命令（写入或等待应答）
+	running bool // 写入协程存活，队列清空后退出
+}
+
+// push 入队，返回是否需要启动写入协程；队列已满，或排在前面的命令各自等满应答时长后超出调用方期限时拒绝
+func (q *commandQueue) push(job *queuedCommand, maxDepth int, confirmTimeout time.Duration, deadline time.Time) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	depth := len(q.pending)
+	if q.active {
+		depth++
+	}
+	if depth >= maxDepth {
+		return false, ErrCommandQueueFull
+	}
+	if depth > 0 && time.Until(deadline) < time.Duration(depth)*confirmTimeout {
+		return false, ErrCommandQueueBusy
+	}
+	q.pending = append(q.pending, job)
+	if q.running {
+		return false, nil
+	}
+	q.running = true
+	return true, nil
+}
+
+// next 结束上一条命令并取出下一条，队列已空时标记写入协程退出并返回nil
+func (q *commandQueue) next() *queuedCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		q.active = false
+		q.running = false
+		return nil
+	}
+	job := q.pending[0]
+	q.pending[0] = nil
+	q.pending = q.pending[1:]
+	q.active = true
+	return job
+}
+
+// remove 撤回尚未被写入协程取出的命令，已取出（正在写入）时返回false
+func (q *commandQueue) remove(job *queuedCommand) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, pending := range q.pending {
+		if pending == job {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// depth 排队与正在执行的命令数
+func (q *commandQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active {
+		return len(q.pending) + 1
+	}
+	return len(q.pending)
+}
+
+// deviceGroupOf 设备所在的设备组
+func (m *TCPManager) deviceGroupOf(deviceID string) (*DeviceGroup, bool) {
+	iccid, ok := m.deviceIndex.Load(deviceID)
+	if !ok {
+		return nil, false
+	}
+	group, ok := m.deviceGroups.Load(iccid.(string))
+	if !ok {
+		return nil, false
+	}
+	return group.(*DeviceGroup), true
+}
+
+// SendCommandToDevice 经设备组出站队列下发命令（由注入的命令写入器构包发送），命令写入连接后返回写入结果
+func (m *TCPManager) SendCommandToDevice(ctx context.Context, deviceID string, cmd byte, data []byte) error {
+	writer := m.commandWriter.Load()
+	if writer == nil {
+		return ErrCommandWriterUnset
+	}
+	return m.EnqueueCommand(ctx, deviceID, cmd, func(conn ziface.IConnection) (CommandWait, error) {
+		return (*writer)(conn, deviceID, cmd, data)
+	})
+}
+
+// EnqueueCommand 将一次命令写入排入设备所在设备组的出站队列，阻塞至该命令写入完成并返回写入结果。
+// 同组命令由单个写入协程依次执行，需要应答的命令写入后等待确认（或超时）再执行下一条；
+// ctx 未设置期限时按 MaxWait 等待。期限内轮不到写入时立即返回 ErrCommandQueueBusy，
+// 排队期间 ctx 结束则撤回命令并返回 ctx 的错误（已开始写入的命令等待写入结果）
+func (m *TCPManager) EnqueueCommand(ctx context.Context, deviceID string, cmd byte, write CommandWrite) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	group, ok := m.deviceGroupOf(deviceID)
+	if !ok {
+		return fmt.Errorf("设备 %s 不在线", deviceID)
+	}
+	cfg := m.GetCommandQueueConfig()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxWait)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	job := &queuedCommand{deviceID: deviceID, cmd: cmd, write: write, done: make(chan error, 1)}
+	start, err := group.commands.push(job, cfg.MaxDepth, cfg.ConfirmTimeout, deadline)
+	if err != nil {
+		return err
+	}
+	if start {
+		go m.runCommandQueue(group)
+	}
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		if group.commands.remove(job) {
+			return fmt.Errorf("等待设备组命令队列写入: %w", ctx.Err())
+		}
+		return <-job.done
+	}
+}
+
+// runCommandQueue 设备组写入协程：依次写入排队的命令，队列清空后退出
+func (m *TCPManager) runCommandQueue(group *DeviceGroup) {
+	for job := group.commands.next(); job != nil; job = group.commands.next() {
+		group.mutex.RLock()
+		conn := group.Connection
+		group.mutex.RUnlock()
+		if conn == nil {
+			job.done <- fmt.Errorf("设备 %s 的连接不存在", job.deviceID)
+			continue
+		}
+		wait, err := job.write(conn)
+		job.done <- err
+		if err != nil || wait == nil || !needConfirmation(job.cmd) {
+			continue
+		}
+		if waitErr := wait(m.GetCommandQueueConfig().ConfirmTimeout); waitErr != nil {
+			logger.WithFields(logrus.Fields{
+				"deviceID": job.deviceID,
+				"iccid":    group.ICCID,
+				"command":  fmt.Sprintf("0x%02X", job.cmd),
+				"error":    waitErr.Error(),
+			}).Debug("命令未在等待时间内确认，继续写入设备组的下一条命令")
+		}
+	}
+}
+
+// CommandQueueDepth 设备所在设备组排队与正在执行的命令数（设备不存在时为0）
+func (m *TCPManager) CommandQueueDepth(deviceID string) int {
+	group, ok := m.deviceGroupOf(deviceID)
+	if !ok {
+		return 0
+	}
+	return group.commands.depth()
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"time"
+)
+
+// ConnTrace 抽样连接的完整协议会话记录（实现见 pkg/tracesample），在收发路径上同步调用，实现须快速返回
+type ConnTrace interface {
+	Frame(uplink bool, data []byte, at time.Time) // 连接上收到或发出的原始字节
+	Note(text string, at time.Time)               // 解码结果等注释
+	Close(reason string)                          // 连接关闭
+}
+
+// ConnTraceSampler 连接抽样决策：接入时按比例抽样；ICCID或设备ID确定后按关注名单强制抽样。返回nil表示不抽样
+type ConnTraceSampler interface {
+	Accept(connID uint64, remoteAddr string) ConnTrace
+	Identify(connID uint64, remoteAddr, iccid, deviceID string) ConnTrace
+}
+
+// SetConnTraceSampler 设置连接抽样决策（nil 表示停止对新连接抽样，已抽样的连接记录到断开）
+func (m *TCPManager) SetConnTraceSampler(sampler ConnTraceSampler) {
+	if sampler == nil {
+		m.traceSampler.Store(nil)
+		return
+	}
+	m.traceSampler.Store(&sampler)
+}
+
+// HasConnTraceSampler 是否已设置连接抽样决策（装配自检用）
+func (m *TCPManager) HasConnTraceSampler() bool {
+	return m.traceSampler.Load() != nil
+}
+
+// sampleOnAccept 新连接接入时的抽样决策
+func (m *TCPManager) sampleOnAccept(session *ConnectionSession) {
+	sampler := m.traceSampler.Load()
+	if sampler == nil {
+		return
+	}
+	if trace := (*sampler).Accept(session.ConnID, session.RemoteAddr); trace != nil {
+		session.trace.Store(&trace)
+	}
+}
+
+// sampleOnIdentify 连接身份确定后按关注名单强制抽样（已抽样的连接不重复）
+func (m *TCPManager) sampleOnIdentify(session *ConnectionSession, iccid, deviceID string) {
+	sampler := m.traceSampler.Load()
+	if sampler == nil || session.trace.Load() != nil {
+		return
+	}
+	if trace := (*sampler).Identify(session.ConnID, session.RemoteAddr, iccid, deviceID); trace != nil {
+		session.trace.CompareAndSwap(nil, &trace)
+	}
+}
+
+// closeTrace 连接清理时结束抽样记录
+func (session *ConnectionSession) closeTrace(reason string) {
+	if trace := session.trace.Swap(nil); trace != nil {
+		(*trace).Close(reason)
+	}
+}
+
+// connTrace 连接的抽样记录（未抽样时为nil）
+func (session *ConnectionSession) connTrace() ConnTrace {
+	if trace := session.trace.Load(); trace != nil {
+		return *trace
+	}
+	return nil
+}
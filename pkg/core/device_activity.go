@@ -0,0 +1,49 @@
+package core
+
+import "time"
+
+// DeviceActivity 设备注册或心跳时的身份快照（供设备会话持久化使用）
+type DeviceActivity struct {
+	DeviceID      string
+	ICCID         string
+	PhysicalID    uint32
+	DeviceType    uint16
+	LastHeartbeat time.Time
+	Registered    bool // true：设备注册；false：心跳
+}
+
+// DeviceActivityObserver 设备活动观察者，在注册与心跳路径中同步调用，实现须快速返回（耗时操作应异步进行）
+type DeviceActivityObserver func(DeviceActivity)
+
+// SetDeviceActivityObserver 设置设备活动观察者（重复设置时覆盖，nil 表示移除）
+func (m *TCPManager) SetDeviceActivityObserver(observer DeviceActivityObserver) {
+	if observer == nil {
+		m.activityObserver.Store(nil)
+		return
+	}
+	m.activityObserver.Store(&observer)
+}
+
+// HasDeviceActivityObserver 是否已设置设备活动观察者（装配自检用）
+func (m *TCPManager) HasDeviceActivityObserver() bool {
+	return m.activityObserver.Load() != nil
+}
+
+// notifyDeviceActivity 通知设备活动观察者
+func (m *TCPManager) notifyDeviceActivity(device *Device, registered bool) {
+	observer := m.activityObserver.Load()
+	if observer == nil || device == nil {
+		return
+	}
+	device.mutex.RLock()
+	activity := DeviceActivity{
+		DeviceID:      device.DeviceID,
+		ICCID:         device.ICCID,
+		PhysicalID:    device.PhysicalID,
+		DeviceType:    device.DeviceType,
+		LastHeartbeat: device.LastHeartbeat,
+		Registered:    registered,
+	}
+	device.mutex.RUnlock()
+	(*observer)(activity)
+}
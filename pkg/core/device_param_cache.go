@@ -0,0 +1,129 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+)
+
+// 设备参数缓存常用字段
+const (
+	ParamKeyDeviceType      = "device_type"      // 设备类型
+	ParamKeyFirmwareVersion = "firmware_version" // 固件版本
+	ParamKeyDeviceVersion   = "device_version"   // 分机版本号(0x35上报)
+	ParamKeyICCID           = "iccid"            // ICCID
+)
+
+// DeviceParamSnapshot 设备参数快照
+// 与TCPManager的严格在线视图不同，参数缓存在设备离线后仍保留，供审计/查询使用
+type DeviceParamSnapshot struct {
+	DeviceID     string                 `json:"device_id"`
+	Values       map[string]interface{} `json:"values"`
+	VerifiedAt   map[string]time.Time   `json:"verified_at"` // 每个字段最近一次被设备确认的时间
+	LastVerified time.Time              `json:"last_verified"`
+}
+
+// DeviceParamCache 设备参数/固件缓存
+type DeviceParamCache struct {
+	mutex   sync.RWMutex
+	devices map[string]*DeviceParamSnapshot
+}
+
+var (
+	globalDeviceParamCache     *DeviceParamCache
+	globalDeviceParamCacheOnce sync.Once
+)
+
+// GetDeviceParamCache 获取全局设备参数缓存
+func GetDeviceParamCache() *DeviceParamCache {
+	globalDeviceParamCacheOnce.Do(func() {
+		globalDeviceParamCache = NewDeviceParamCache()
+		logger.Info("设备参数缓存已初始化")
+	})
+	return globalDeviceParamCache
+}
+
+// NewDeviceParamCache 创建设备参数缓存
+func NewDeviceParamCache() *DeviceParamCache {
+	return &DeviceParamCache{
+		devices: make(map[string]*DeviceParamSnapshot),
+	}
+}
+
+// Update 更新设备的单个参数
+func (c *DeviceParamCache) Update(deviceID, key string, value interface{}) {
+	c.UpdateMany(deviceID, map[string]interface{}{key: value})
+}
+
+// UpdateMany 批量更新设备参数（同一时间戳）
+func (c *DeviceParamCache) UpdateMany(deviceID string, values map[string]interface{}) {
+	if deviceID == "" || len(values) == 0 {
+		return
+	}
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	snap, ok := c.devices[deviceID]
+	if !ok {
+		snap = &DeviceParamSnapshot{
+			DeviceID:   deviceID,
+			Values:     make(map[string]interface{}),
+			VerifiedAt: make(map[string]time.Time),
+		}
+		c.devices[deviceID] = snap
+	}
+	for k, v := range values {
+		snap.Values[k] = v
+		snap.VerifiedAt[k] = now
+	}
+	snap.LastVerified = now
+}
+
+// Get 获取单个设备的参数快照副本
+func (c *DeviceParamCache) Get(deviceID string) (DeviceParamSnapshot, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	snap, ok := c.devices[deviceID]
+	if !ok {
+		return DeviceParamSnapshot{}, false
+	}
+	return snap.copy(), true
+}
+
+// Snapshot 获取全部设备参数快照副本（调用方可在锁外任意遍历）
+func (c *DeviceParamCache) Snapshot() []DeviceParamSnapshot {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	result := make([]DeviceParamSnapshot, 0, len(c.devices))
+	for _, snap := range c.devices {
+		result = append(result, snap.copy())
+	}
+	return result
+}
+
+// Remove 移除设备参数缓存
+func (c *DeviceParamCache) Remove(deviceID string) {
+	c.mutex.Lock()
+	delete(c.devices, deviceID)
+	c.mutex.Unlock()
+}
+
+// copy 深拷贝快照
+func (s *DeviceParamSnapshot) copy() DeviceParamSnapshot {
+	cp := DeviceParamSnapshot{
+		DeviceID:     s.DeviceID,
+		Values:       make(map[string]interface{}, len(s.Values)),
+		VerifiedAt:   make(map[string]time.Time, len(s.VerifiedAt)),
+		LastVerified: s.LastVerified,
+	}
+	for k, v := range s.Values {
+		cp.Values[k] = v
+	}
+	for k, v := range s.VerifiedAt {
+		cp.VerifiedAt[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+)
+
+// DevicePropertyParameters Device.Properties 中设备运行参数（0x90/0x91）的键
+const DevicePropertyParameters = "parameters"
+
+// UpdateDeviceParameters 解析设备上报的运行参数（0x90/0x91）并合并到 Device.Properties，返回合并后的副本
+func (m *TCPManager) UpdateDeviceParameters(deviceID string, command uint8, payload []byte, at time.Time) (dny_protocol.DeviceParameters, error) {
+	device, exists := m.GetDeviceByID(deviceID)
+	if !exists {
+		return dny_protocol.DeviceParameters{}, fmt.Errorf("设备 %s 不存在", deviceID)
+	}
+
+	device.Lock()
+	defer device.Unlock()
+	// 写时复制：Properties 中的参数对象一经存入不再修改，读取方可直接持有
+	var params dny_protocol.DeviceParameters
+	if existing, ok := device.Properties[DevicePropertyParameters].(*dny_protocol.DeviceParameters); ok {
+		params = *existing
+	}
+	if err := params.Apply(command, payload, at); err != nil {
+		return dny_protocol.DeviceParameters{}, err
+	}
+	if device.Properties == nil {
+		device.Properties = make(map[string]interface{})
+	}
+	device.Properties[DevicePropertyParameters] = &params
+	return params, nil
+}
+
+// GetDeviceParameters 设备最近上报的运行参数
+func (m *TCPManager) GetDeviceParameters(deviceID string) (dny_protocol.DeviceParameters, bool) {
+	device, exists := m.GetDeviceByID(deviceID)
+	if !exists {
+		return dny_protocol.DeviceParameters{}, false
+	}
+	device.RLock()
+	defer device.RUnlock()
+	params, ok := device.Properties[DevicePropertyParameters].(*dny_protocol.DeviceParameters)
+	if !ok {
+		return dny_protocol.DeviceParameters{}, false
+	}
+	return *params, true
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDraining 停机排空中，不再接受新的连接与设备注册
+var ErrDraining = errors.New("网关停机排空中，拒绝新的注册")
+
+const drainPollInterval = 100 * time.Millisecond
+
+// DrainReasonShutdown 停机排空关闭连接的原因
+const DrainReasonShutdown = "server_drain"
+
+// DrainOptions 停机排空选项
+type DrainOptions struct {
+	GracePeriod time.Duration                                           // 停机通知与等待待应答命令共用的宽限期，<=0 不等待
+	Pending     func() int                                              // 待应答命令数（由上层注入，避免core依赖命令管理器），nil 视为0
+	Notify      func(ctx context.Context, iccid, deviceID string) error // 向设备组发送停机通知（deviceID 为组的主设备），须在 ctx 结束时返回；nil 不通知
+}
+
+// DrainResult 停机排空结果
+type DrainResult struct {
+	Groups         int   `json:"groups"`           // 排空开始时的设备组数
+	Notified       int   `json:"notified"`         // 已发送停机通知的设备组数
+	NotifyFailed   int   `json:"notify_failed"`    // 停机通知发送失败的设备组数
+	NotifySkipped  int   `json:"notify_skipped"`   // ctx 取消后未再通知的设备组数
+	PendingAtStart int   `json:"pending_at_start"` // 排空开始时的待应答命令数
+	PendingAtClose int   `json:"pending_at_close"` // 宽限期结束关闭连接时仍未应答的命令数
+	Closed         int   `json:"closed"`           // 关闭的连接数
+	DurationMs     int64 `json:"duration_ms"`
+}
+
+// IsDraining 是否处于停机排空中
+func (m *TCPManager) IsDraining() bool {
+	return m.draining.Load()
+}
+
+// Drain 停机排空：拒绝新的连接与设备注册 → 向各设备组发送停机通知 → 在宽限期内等待待应答命令确认 → 关闭全部连接，
+// 最后输出排空汇总与连接统计。停机通知与等待共用宽限期（队列卡住的设备组不会拖延关闭连接）；
+// 宽限期结束或 ctx 取消时停止发送剩余的停机通知、不再等待，直接关闭连接
+func (m *TCPManager) Drain(ctx context.Context, opts DrainOptions) DrainResult {
+	start := time.Now()
+	m.draining.Store(true)
+	graceCtx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.GracePeriod > 0 {
+		graceCtx, cancel = context.WithTimeout(ctx, opts.GracePeriod)
+	}
+	defer cancel()
+	pending := func() int {
+		if opts.Pending == nil {
+			return 0
+		}
+		return opts.Pending()
+	}
+	result := DrainResult{PendingAtStart: pending()}
+
+	targets := m.drainTargets()
+	result.Groups = len(targets)
+	if opts.Notify != nil {
+		for i, t := range targets {
+			if graceCtx.Err() != nil {
+				result.NotifySkipped = len(targets) - i
+				logger.WithFields(logrus.Fields{"skipped": result.NotifySkipped, "error": graceCtx.Err().Error()}).Warn("宽限期已结束或停机排空已取消，不再发送剩余的停机通知")
+				break
+			}
+			if err := opts.Notify(graceCtx, t.iccid, t.deviceID); err != nil {
+				result.NotifyFailed++
+				logger.WithFields(logrus.Fields{"iccid": t.iccid, "deviceID": t.deviceID, "error": err.Error()}).Warn("停机通知发送失败")
+				continue
+			}
+			result.Notified++
+		}
+	}
+
+	result.PendingAtClose = m.waitPending(graceCtx, opts.GracePeriod, pending)
+
+	var connIDs []uint64
+	m.connections.Range(func(key, _ interface{}) bool {
+		connIDs = append(connIDs, key.(uint64))
+		return true
+	})
+	for _, connID := range connIDs {
+		if m.DisconnectConnection(connID, DrainReasonShutdown) {
+			result.Closed++
+		}
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	stats := m.GetStats()
+	fields := logrus.Fields{
+		"audit":             "tcp_drain",
+		"groups":            result.Groups,
+		"notified":          result.Notified,
+		"notifyFailed":      result.NotifyFailed,
+		"notifySkipped":     result.NotifySkipped,
+		"pendingAtStart":    result.PendingAtStart,
+		"pendingAtClose":    result.PendingAtClose,
+		"closed":            result.Closed,
+		"durationMs":        result.DurationMs,
+		"totalConnections":  stats.TotalConnections,
+		"sendFailures":      stats.SendFailures,
+		"writeFailedClosed": stats.WriteFailedDisconnects,
+	}
+	if result.PendingAtClose > 0 {
+		logger.WithFields(fields).Warn("TCP连接排空完成，仍有命令未应答")
+	} else {
+		logger.WithFields(fields).Info("TCP连接排空完成")
+	}
+	return result
+}
+
+type drainTarget struct {
+	iccid    string
+	deviceID string
+}
+
+// drainTargets 各设备组的通知目标：主设备，未记录主设备时取设备ID最小的成员；无设备的组不通知
+func (m *TCPManager) drainTargets() []drainTarget {
+	var targets []drainTarget
+	m.deviceGroups.Range(func(key, value interface{}) bool {
+		group := value.(*DeviceGroup)
+		group.mutex.RLock()
+		deviceID := group.PrimaryDevice
+		if _, ok := group.Devices[deviceID]; !ok {
+			deviceID = ""
+			for id := range group.Devices {
+				if deviceID == "" || id < deviceID {
+					deviceID = id
+				}
+			}
+		}
+		group.mutex.RUnlock()
+		if deviceID != "" {
+			targets = append(targets, drainTarget{iccid: key.(string), deviceID: deviceID})
+		}
+		return true
+	})
+	sort.Slice(targets, func(i, j int) bool { return targets[i].iccid < targets[j].iccid })
+	return targets
+}
+
+// waitPending 在宽限期（graceCtx 的期限）内等待待应答命令清零，返回结束时的剩余数量
+func (m *TCPManager) waitPending(graceCtx context.Context, grace time.Duration, pending func() int) int {
+	remaining := pending()
+	if remaining == 0 || grace <= 0 {
+		return remaining
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for remaining > 0 {
+		select {
+		case <-graceCtx.Done():
+			return pending()
+		case <-ticker.C:
+			remaining = pending()
+		}
+	}
+	return 0
+}
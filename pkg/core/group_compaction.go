@@ -0,0 +1,287 @@
+package core
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// GroupCompactionConfig 设备组惰性压缩配置
+// Go 的 map 删除条目后不会缩容：曾短暂挂载大量设备（如配额事故中的180台幽灵设备）的设备组，
+// 清理后仍长期持有扩容后的桶数组。巡检时当前条目数远低于历史峰值的组按实际大小重建映射
+type GroupCompactionConfig struct {
+	Enabled     bool          `json:"enabled"`
+	Interval    time.Duration `json:"interval"`     // 巡检间隔
+	MinPeak     int           `json:"min_peak"`     // 历史峰值达到该值的映射才考虑重建（小映射重建无收益）
+	ShrinkRatio float64       `json:"shrink_ratio"` // 当前条目数 ≤ 峰值 × shrinkRatio 时重建
+	MinChurn    int64         `json:"min_churn"`    // 顶层映射删除次数达到该值才计算墓碑占比
+	ChurnRatio  float64       `json:"churn_ratio"`  // 顶层映射 删除/写入 超过该值视为墓碑偏多
+}
+
+// DefaultGroupCompactionConfig 默认设备组压缩配置
+func DefaultGroupCompactionConfig() *GroupCompactionConfig {
+	return &GroupCompactionConfig{
+		Enabled:     true,
+		Interval:    5 * time.Minute,
+		MinPeak:     32,
+		ShrinkRatio: 0.25,
+		MinChurn:    10000,
+		ChurnRatio:  0.9,
+	}
+}
+
+// mapChurn 顶层 sync.Map 的近似写入/删除计数（重复删除同一键也计数，仅作估算）
+type mapChurn struct {
+	stores  atomic.Int64
+	deletes atomic.Int64
+}
+
+func (c *mapChurn) stored()  { c.stores.Add(1) }
+func (c *mapChurn) deleted() { c.deletes.Add(1) }
+
+// MapChurnStats 顶层映射写入/删除统计
+type MapChurnStats struct {
+	Name           string  `json:"name"`
+	Live           int     `json:"live"`
+	Stores         int64   `json:"stores"`
+	Deletes        int64   `json:"deletes"`
+	TombstoneRatio float64 `json:"tombstone_ratio"` // 删除/写入
+	TombstoneHeavy bool    `json:"tombstone_heavy"` // 达到 minChurn 且超过 churnRatio
+}
+
+// GroupCompactionStats 设备组压缩统计（管理诊断）
+type GroupCompactionStats struct {
+	Config                  GroupCompactionConfig `json:"config"`
+	Runs                    int64                 `json:"runs"`
+	GroupsCompacted         int64                 `json:"groups_compacted"`          // 累计重建的设备组数
+	MapsRebuilt             int64                 `json:"maps_rebuilt"`              // 累计重建的组内映射数（Devices/VirtualDevices）
+	EntriesAtPeak           int64                 `json:"entries_at_peak"`           // 被重建映射的历史峰值条目数之和
+	EstimatedBytesReclaimed int64                 `json:"estimated_bytes_reclaimed"` // 累计估算回收字节（重建前后 HeapAlloc 差）
+	LastRunAt               time.Time             `json:"last_run_at,omitempty"`
+	LastDurationMs          int64                 `json:"last_duration_ms"`
+	LastGroupsCompacted     int                   `json:"last_groups_compacted"`
+	LastHeapBefore          uint64                `json:"last_heap_before,omitempty"` // 最近一次有重建时重建前的 HeapAlloc
+	LastHeapAfter           uint64                `json:"last_heap_after,omitempty"`  // 最近一次有重建时重建并GC后的 HeapAlloc
+	TopLevel                []MapChurnStats       `json:"top_level"`
+	// 顶层 sync.Map 不重建：Go 1.24 起 sync.Map 为哈希前缀树，删除时释放节点，不存在墓碑堆积；
+	// 且 GetDeviceIndex/GetDeviceGroups/GetConnections 对外暴露指针，替换会使持有方读到旧映射。
+	// 墓碑占比仅供观察
+}
+
+// CompactionResult 单次压缩结果
+type CompactionResult struct {
+	GroupsScanned           int    `json:"groups_scanned"`
+	GroupsCompacted         int    `json:"groups_compacted"`
+	MapsRebuilt             int    `json:"maps_rebuilt"`
+	EntriesAtPeak           int    `json:"entries_at_peak"`
+	LiveEntries             int    `json:"live_entries"` // 被重建映射当前条目数之和
+	HeapBefore              uint64 `json:"heap_before,omitempty"`
+	HeapAfter               uint64 `json:"heap_after,omitempty"`
+	EstimatedBytesReclaimed int64  `json:"estimated_bytes_reclaimed"`
+	DurationMs              int64  `json:"duration_ms"`
+}
+
+// groupCompaction 压缩配置与累计统计
+type groupCompaction struct {
+	config atomic.Pointer[GroupCompactionConfig]
+	mu     sync.Mutex
+	stats  GroupCompactionStats
+}
+
+// notePeak 记录组内映射的历史峰值（调用方持有写锁）
+func (dg *DeviceGroup) notePeak() {
+	if n := len(dg.Devices); n > dg.peakDevices {
+		dg.peakDevices = n
+	}
+	if n := len(dg.VirtualDevices); n > dg.peakVirtual {
+		dg.peakVirtual = n
+	}
+}
+
+func shouldRebuild(live, peak int, cfg *GroupCompactionConfig) bool {
+	return peak >= cfg.MinPeak && float64(live) <= float64(peak)*cfg.ShrinkRatio
+}
+
+// needsCompaction 读锁下判断组是否需要重建
+func (dg *DeviceGroup) needsCompaction(cfg *GroupCompactionConfig) bool {
+	dg.mutex.RLock()
+	defer dg.mutex.RUnlock()
+	return shouldRebuild(len(dg.Devices), dg.peakDevices, cfg) || shouldRebuild(len(dg.VirtualDevices), dg.peakVirtual, cfg)
+}
+
+// compact 写锁下将稀疏的 Devices/VirtualDevices 重建为按实际大小分配的新映射，峰值重置为当前条目数
+func (dg *DeviceGroup) compact(cfg *GroupCompactionConfig) (rebuilt, peak, live int) {
+	dg.mutex.Lock()
+	defer dg.mutex.Unlock()
+	dg.notePeak()
+	if shouldRebuild(len(dg.Devices), dg.peakDevices, cfg) {
+		devices := make(map[string]*Device, len(dg.Devices))
+		for id, d := range dg.Devices {
+			devices[id] = d
+		}
+		rebuilt, peak, live = rebuilt+1, peak+dg.peakDevices, live+len(devices)
+		dg.Devices, dg.peakDevices = devices, len(devices)
+	}
+	if shouldRebuild(len(dg.VirtualDevices), dg.peakVirtual, cfg) {
+		var virtuals map[string]*VirtualDevice
+		if len(dg.VirtualDevices) > 0 {
+			virtuals = make(map[string]*VirtualDevice, len(dg.VirtualDevices))
+			for id, v := range dg.VirtualDevices {
+				virtuals[id] = v
+			}
+		}
+		rebuilt, peak, live = rebuilt+1, peak+dg.peakVirtual, live+len(virtuals)
+		dg.VirtualDevices, dg.peakVirtual = virtuals, len(virtuals)
+	}
+	return rebuilt, peak, live
+}
+
+// SetGroupCompactionConfig 设置设备组压缩配置（nil 忽略，非法值回退默认）
+func (m *TCPManager) SetGroupCompactionConfig(config *GroupCompactionConfig) {
+	if config == nil {
+		return
+	}
+	cfg := *config
+	defaults := DefaultGroupCompactionConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+	if cfg.MinPeak <= 0 {
+		cfg.MinPeak = defaults.MinPeak
+	}
+	if cfg.ShrinkRatio <= 0 || cfg.ShrinkRatio >= 1 {
+		cfg.ShrinkRatio = defaults.ShrinkRatio
+	}
+	if cfg.MinChurn <= 0 {
+		cfg.MinChurn = defaults.MinChurn
+	}
+	if cfg.ChurnRatio <= 0 || cfg.ChurnRatio > 1 {
+		cfg.ChurnRatio = defaults.ChurnRatio
+	}
+	m.compaction.config.Store(&cfg)
+}
+
+// GetGroupCompactionConfig 获取当前设备组压缩配置副本
+func (m *TCPManager) GetGroupCompactionConfig() GroupCompactionConfig {
+	if cfg := m.compaction.config.Load(); cfg != nil {
+		return *cfg
+	}
+	return *DefaultGroupCompactionConfig()
+}
+
+// CompactDeviceGroups 执行一次压缩：先在读锁下筛选稀疏的组，有候选时在重建前后采样 HeapAlloc
+// （重建后执行一次GC，使旧桶数组计入回收）估算回收字节；无候选时不采样、不触发GC
+func (m *TCPManager) CompactDeviceGroups() CompactionResult {
+	cfg := m.GetGroupCompactionConfig()
+	start := time.Now()
+	var result CompactionResult
+	var candidates []*DeviceGroup
+	m.deviceGroups.Range(func(_, value interface{}) bool {
+		result.GroupsScanned++
+		if group := value.(*DeviceGroup); group.needsCompaction(&cfg) {
+			candidates = append(candidates, group)
+		}
+		return true
+	})
+
+	if len(candidates) > 0 {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		result.HeapBefore = ms.HeapAlloc
+		for _, group := range candidates {
+			rebuilt, peak, live := group.compact(&cfg)
+			if rebuilt == 0 {
+				continue
+			}
+			result.GroupsCompacted++
+			result.MapsRebuilt += rebuilt
+			result.EntriesAtPeak += peak
+			result.LiveEntries += live
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		result.HeapAfter = ms.HeapAlloc
+		if result.HeapBefore > result.HeapAfter {
+			result.EstimatedBytesReclaimed = int64(result.HeapBefore - result.HeapAfter)
+		}
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	c := &m.compaction
+	c.mu.Lock()
+	c.stats.Runs++
+	c.stats.GroupsCompacted += int64(result.GroupsCompacted)
+	c.stats.MapsRebuilt += int64(result.MapsRebuilt)
+	c.stats.EntriesAtPeak += int64(result.EntriesAtPeak)
+	c.stats.EstimatedBytesReclaimed += result.EstimatedBytesReclaimed
+	c.stats.LastRunAt = start
+	c.stats.LastDurationMs = result.DurationMs
+	c.stats.LastGroupsCompacted = result.GroupsCompacted
+	if result.GroupsCompacted > 0 {
+		c.stats.LastHeapBefore, c.stats.LastHeapAfter = result.HeapBefore, result.HeapAfter
+	}
+	c.mu.Unlock()
+
+	if result.GroupsCompacted > 0 {
+		logger.WithFields(logrus.Fields{
+			"groupsCompacted":         result.GroupsCompacted,
+			"mapsRebuilt":             result.MapsRebuilt,
+			"entriesAtPeak":           result.EntriesAtPeak,
+			"liveEntries":             result.LiveEntries,
+			"estimatedBytesReclaimed": result.EstimatedBytesReclaimed,
+			"durationMs":              result.DurationMs,
+		}).Info("🧹 设备组惰性压缩完成")
+	}
+	return result
+}
+
+// GetGroupCompactionStats 设备组压缩累计统计与顶层映射墓碑占比
+func (m *TCPManager) GetGroupCompactionStats() GroupCompactionStats {
+	cfg := m.GetGroupCompactionConfig()
+	m.compaction.mu.Lock()
+	stats := m.compaction.stats
+	m.compaction.mu.Unlock()
+	stats.Config = cfg
+	stats.TopLevel = []MapChurnStats{
+		churnStats("connections", &m.connections, &m.connChurn, &cfg),
+		churnStats("device_groups", &m.deviceGroups, &m.groupChurn, &cfg),
+		churnStats("device_index", &m.deviceIndex, &m.indexChurn, &cfg),
+	}
+	return stats
+}
+
+func churnStats(name string, sm *sync.Map, churn *mapChurn, cfg *GroupCompactionConfig) MapChurnStats {
+	s := MapChurnStats{Name: name, Stores: churn.stores.Load(), Deletes: churn.deletes.Load()}
+	sm.Range(func(_, _ interface{}) bool { s.Live++; return true })
+	if s.Stores > 0 {
+		s.TombstoneRatio = float64(s.Deletes) / float64(s.Stores)
+	}
+	s.TombstoneHeavy = s.Deletes >= cfg.MinChurn && s.TombstoneRatio > cfg.ChurnRatio
+	return s
+}
+
+// startGroupCompactor 按配置间隔执行设备组压缩
+func (m *TCPManager) startGroupCompactor() {
+	interval := m.GetGroupCompactionConfig().Interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			cfg := m.GetGroupCompactionConfig()
+			if cfg.Interval != interval {
+				interval = cfg.Interval
+				ticker.Reset(interval)
+			}
+			if cfg.Enabled {
+				m.CompactDeviceGroups()
+			}
+		}
+	}
+}
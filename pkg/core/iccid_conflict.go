@@ -0,0 +1,381 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ICCID冲突处理策略
+const (
+	ICCIDConflictPolicyLogOnly             = "log-only"               // 仅记录并告警，保持原有行为：新连接照常注册，不关闭旧连接
+	ICCIDConflictPolicyAllowTakeover       = "allow-takeover"         // 新连接接管设备组（旧连接被清理）
+	ICCIDConflictPolicyRejectNew           = "reject-new"             // 拒绝新连接的注册
+	ICCIDConflictPolicyAllowBothWithSuffix = "allow-both-with-suffix" // 两者并存，新连接使用带后缀的ICCID分组
+)
+
+// ICCID来源地址相似度判定规则
+const (
+	ICCIDIPMatchExact    = "exact"    // IP完全一致才视为同一来源
+	ICCIDIPMatchSubnet24 = "subnet24" // 同一/24网段视为同一来源（兼容运营商NAT地址漂移）
+)
+
+// ICCIDConflictConfig ICCID冲突检测配置
+type ICCIDConflictConfig struct {
+	Enabled    bool          `json:"enabled"`
+	Policy     string        `json:"policy"`
+	Window     time.Duration `json:"window"`      // 检测窗口：旧连接在窗口内有活动才视为存活冲突
+	IPMatch    string        `json:"ip_match"`    // exact / subnet24
+	Retention  time.Duration `json:"retention"`   // 冲突记录保留时长
+	MaxRecords int           `json:"max_records"` // 冲突记录最大条数
+}
+
+// DefaultICCIDConflictConfig 默认ICCID冲突检测配置（仅记录告警，保持原有注册行为）
+func DefaultICCIDConflictConfig() *ICCIDConflictConfig {
+	return &ICCIDConflictConfig{
+		Enabled:    true,
+		Policy:     ICCIDConflictPolicyLogOnly,
+		Window:     5 * time.Minute,
+		IPMatch:    ICCIDIPMatchSubnet24,
+		Retention:  24 * time.Hour,
+		MaxRecords: 500,
+	}
+}
+
+// ICCIDConnectionInfo 参与冲突判定的连接信息
+type ICCIDConnectionInfo struct {
+	ConnID       uint64    `json:"conn_id"`
+	RemoteAddr   string    `json:"remote_addr"`
+	DeviceIDs    []string  `json:"device_ids"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// ICCIDConflict ICCID冲突记录
+type ICCIDConflict struct {
+	ICCID          string              `json:"iccid"`
+	Existing       ICCIDConnectionInfo `json:"existing"`
+	Incoming       ICCIDConnectionInfo `json:"incoming"`
+	Policy         string              `json:"policy"`
+	IPMatch        string              `json:"ip_match"`
+	EffectiveICCID string              `json:"effective_iccid"` // 实际使用的分组键（allow-both-with-suffix 时带后缀）
+	DetectedAt     time.Time           `json:"detected_at"`
+	Count          int                 `json:"count"` // 同一对连接的重复检测次数
+}
+
+// ICCIDConflictHandler 冲突告警回调
+type ICCIDConflictHandler func(conflict ICCIDConflict)
+
+// ICCIDConflictDetector ICCID冲突检测器
+// 识别SIM卡克隆或错误配置导致的"同一ICCID、不同来源地址"并发在线
+type ICCIDConflictDetector struct {
+	config   *ICCIDConflictConfig
+	records  []*ICCIDConflict
+	handlers []ICCIDConflictHandler
+	mutex    sync.RWMutex
+}
+
+// NewICCIDConflictDetector 创建ICCID冲突检测器
+func NewICCIDConflictDetector(config *ICCIDConflictConfig) *ICCIDConflictDetector {
+	if config == nil {
+		config = DefaultICCIDConflictConfig()
+	}
+	return &ICCIDConflictDetector{
+		config:  normalizeICCIDConflictConfig(config),
+		records: make([]*ICCIDConflict, 0),
+	}
+}
+
+// normalizeICCIDConflictConfig 补全非法或缺省配置
+func normalizeICCIDConflictConfig(config *ICCIDConflictConfig) *ICCIDConflictConfig {
+	defaults := DefaultICCIDConflictConfig()
+	cfg := *config
+	switch cfg.Policy {
+	case ICCIDConflictPolicyLogOnly, ICCIDConflictPolicyAllowTakeover, ICCIDConflictPolicyRejectNew, ICCIDConflictPolicyAllowBothWithSuffix:
+	default:
+		cfg.Policy = defaults.Policy
+	}
+	switch cfg.IPMatch {
+	case ICCIDIPMatchExact, ICCIDIPMatchSubnet24:
+	default:
+		cfg.IPMatch = defaults.IPMatch
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaults.Retention
+	}
+	if cfg.MaxRecords <= 0 {
+		cfg.MaxRecords = defaults.MaxRecords
+	}
+	return &cfg
+}
+
+// SetConfig 更新检测配置
+func (d *ICCIDConflictDetector) SetConfig(config *ICCIDConflictConfig) {
+	if config == nil {
+		return
+	}
+	d.mutex.Lock()
+	d.config = normalizeICCIDConflictConfig(config)
+	d.mutex.Unlock()
+}
+
+// GetConfig 获取当前检测配置副本
+func (d *ICCIDConflictDetector) GetConfig() ICCIDConflictConfig {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return *d.config
+}
+
+// RegisterHandler 注册冲突告警回调
+func (d *ICCIDConflictDetector) RegisterHandler(handler ICCIDConflictHandler) {
+	if handler == nil {
+		return
+	}
+	d.mutex.Lock()
+	d.handlers = append(d.handlers, handler)
+	d.mutex.Unlock()
+}
+
+// HandlerCount 已注册的冲突告警回调数量
+func (d *ICCIDConflictDetector) HandlerCount() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.handlers)
+}
+
+// Detect 判定新连接是否与已有设备组构成ICCID冲突，不构成冲突返回nil
+// 以下情况不视为冲突：同一连接、旧连接在检测窗口内无活动、来源地址在相似度规则内（正常重连/NAT漂移）
+func (d *ICCIDConflictDetector) Detect(iccid string, existing, incoming ICCIDConnectionInfo, now time.Time) *ICCIDConflict {
+	cfg := d.GetConfig()
+	if !cfg.Enabled || iccid == "" {
+		return nil
+	}
+	if existing.ConnID == incoming.ConnID {
+		return nil
+	}
+	lastActivity := existing.LastActivity
+	if lastActivity.IsZero() {
+		lastActivity = existing.ConnectedAt
+	}
+	if lastActivity.IsZero() || now.Sub(lastActivity) > cfg.Window {
+		return nil
+	}
+	if IsSameAddressRange(existing.RemoteAddr, incoming.RemoteAddr, cfg.IPMatch) {
+		return nil
+	}
+
+	return &ICCIDConflict{
+		ICCID:          iccid,
+		Existing:       existing,
+		Incoming:       incoming,
+		Policy:         cfg.Policy,
+		IPMatch:        cfg.IPMatch,
+		EffectiveICCID: iccid,
+		DetectedAt:     now,
+		Count:          1,
+	}
+}
+
+// Record 记录冲突并触发告警回调（同一ICCID、同一对连接只告警一次）
+func (d *ICCIDConflictDetector) Record(conflict *ICCIDConflict) {
+	if conflict == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	d.pruneLocked(conflict.DetectedAt)
+	for _, r := range d.records {
+		if r.ICCID == conflict.ICCID && r.Existing.ConnID == conflict.Existing.ConnID && r.Incoming.ConnID == conflict.Incoming.ConnID {
+			r.Count++
+			r.DetectedAt = conflict.DetectedAt
+			d.mutex.Unlock()
+			return
+		}
+	}
+	record := *conflict
+	d.records = append(d.records, &record)
+	if len(d.records) > d.config.MaxRecords {
+		d.records = d.records[len(d.records)-d.config.MaxRecords:]
+	}
+	handlers := make([]ICCIDConflictHandler, len(d.handlers))
+	copy(handlers, d.handlers)
+	d.mutex.Unlock()
+
+	for _, handler := range handlers {
+		go handler(record)
+	}
+}
+
+// GetConflicts 获取保留期内的冲突记录（按检测时间倒序）
+func (d *ICCIDConflictDetector) GetConflicts() []ICCIDConflict {
+	d.mutex.Lock()
+	d.pruneLocked(time.Now())
+	result := make([]ICCIDConflict, 0, len(d.records))
+	for i := len(d.records) - 1; i >= 0; i-- {
+		result = append(result, *d.records[i])
+	}
+	d.mutex.Unlock()
+	return result
+}
+
+// pruneLocked 清理过期记录（调用前需加锁）
+func (d *ICCIDConflictDetector) pruneLocked(now time.Time) {
+	kept := d.records[:0]
+	for _, r := range d.records {
+		if now.Sub(r.DetectedAt) <= d.config.Retention {
+			kept = append(kept, r)
+		}
+	}
+	d.records = kept
+}
+
+// SuffixedICCID 生成并存策略下的分组键
+func SuffixedICCID(iccid string, connID uint64) string {
+	return fmt.Sprintf("%s#%d", iccid, connID)
+}
+
+// IsSameAddressRange 判断两个远程地址是否属于同一来源
+// mode=exact 要求IP一致；mode=subnet24 对IPv4比较前24位，IPv6退化为完全一致
+func IsSameAddressRange(addrA, addrB, mode string) bool {
+	ipA := parseRemoteIP(addrA)
+	ipB := parseRemoteIP(addrB)
+	if ipA == nil || ipB == nil {
+		// 地址无法解析时不做冲突判定，避免误报
+		return true
+	}
+	if ipA.Equal(ipB) {
+		return true
+	}
+	if mode != ICCIDIPMatchSubnet24 {
+		return false
+	}
+	v4A, v4B := ipA.To4(), ipB.To4()
+	if v4A == nil || v4B == nil {
+		return false
+	}
+	mask := net.CIDRMask(24, 32)
+	return v4A.Mask(mask).Equal(v4B.Mask(mask))
+}
+
+// parseRemoteIP 解析 host:port 或纯IP形式的远程地址
+func parseRemoteIP(addr string) net.IP {
+	if addr == "" {
+		return nil
+	}
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	return net.ParseIP(host)
+}
+
+// ===============================
+// TCPManager 集成
+// ===============================
+
+// GetICCIDConflictDetector 获取ICCID冲突检测器
+func (m *TCPManager) GetICCIDConflictDetector() *ICCIDConflictDetector {
+	return m.iccidConflicts
+}
+
+// SetICCIDConflictConfig 设置ICCID冲突检测配置（用于对齐配置文件）
+func (m *TCPManager) SetICCIDConflictConfig(config *ICCIDConflictConfig) {
+	m.iccidConflicts.SetConfig(config)
+}
+
+// GetICCIDConflicts 获取当前ICCID冲突记录
+func (m *TCPManager) GetICCIDConflicts() []ICCIDConflict {
+	return m.iccidConflicts.GetConflicts()
+}
+
+// resolveICCIDConflict 注册前检测ICCID冲突，返回实际使用的分组键
+func (m *TCPManager) resolveICCIDConflict(session *ConnectionSession, deviceID, iccid string) (string, error) {
+	groupInterface, exists := m.deviceGroups.Load(iccid)
+	if !exists {
+		return iccid, nil
+	}
+	group := groupInterface.(*DeviceGroup)
+
+	group.mutex.RLock()
+	existingConnID := group.ConnID
+	existing := ICCIDConnectionInfo{
+		ConnID:       group.ConnID,
+		DeviceIDs:    make([]string, 0, len(group.Devices)),
+		ConnectedAt:  group.CreatedAt,
+		LastActivity: group.LastActivity,
+	}
+	_, deviceInGroup := group.Devices[deviceID]
+	for id := range group.Devices {
+		existing.DeviceIDs = append(existing.DeviceIDs, id)
+	}
+	group.mutex.RUnlock()
+
+	if existingConnID == session.ConnID {
+		return iccid, nil
+	}
+	if existingSession, ok := m.GetSessionByConnID(existingConnID); ok {
+		existing.RemoteAddr = existingSession.RemoteAddr
+		existing.ConnectedAt = existingSession.ConnectedAt
+	}
+
+	now := time.Now()
+	incoming := ICCIDConnectionInfo{
+		ConnID:       session.ConnID,
+		RemoteAddr:   session.RemoteAddr,
+		DeviceIDs:    []string{deviceID},
+		ConnectedAt:  session.ConnectedAt,
+		LastActivity: now,
+	}
+
+	conflict := m.iccidConflicts.Detect(iccid, existing, incoming, now)
+	if conflict == nil {
+		return iccid, nil
+	}
+
+	fields := logrus.Fields{
+		"iccid":              iccid,
+		"deviceID":           deviceID,
+		"existingConnID":     existing.ConnID,
+		"existingRemoteAddr": existing.RemoteAddr,
+		"incomingConnID":     incoming.ConnID,
+		"incomingRemoteAddr": incoming.RemoteAddr,
+		"policy":             conflict.Policy,
+		"ipMatch":            conflict.IPMatch,
+	}
+
+	switch conflict.Policy {
+	case ICCIDConflictPolicyRejectNew:
+		m.iccidConflicts.Record(conflict)
+		logger.WithFields(fields).Error("[ICCID-CONFLICT] 检测到ICCID冲突，拒绝新连接注册")
+		return "", fmt.Errorf("ICCID %s 已被连接 %d (%s) 占用，拒绝来自 %s 的注册", iccid, existing.ConnID, existing.RemoteAddr, incoming.RemoteAddr)
+
+	case ICCIDConflictPolicyAllowBothWithSuffix:
+		// 同一设备ID无法同时存在于两个分组，退化为接管
+		if !deviceInGroup {
+			conflict.EffectiveICCID = SuffixedICCID(iccid, session.ConnID)
+			m.iccidConflicts.Record(conflict)
+			fields["effectiveICCID"] = conflict.EffectiveICCID
+			logger.WithFields(fields).Error("[ICCID-CONFLICT] 检测到ICCID冲突，新连接使用后缀分组并存")
+			return conflict.EffectiveICCID, nil
+		}
+		fallthrough
+
+	case ICCIDConflictPolicyAllowTakeover:
+		m.iccidConflicts.Record(conflict)
+		logger.WithFields(fields).Error("[ICCID-CONFLICT] 检测到ICCID冲突，新连接接管设备组")
+		m.cleanupConnection(existing.ConnID, "iccid-takeover")
+		return iccid, nil
+
+	default:
+		m.iccidConflicts.Record(conflict)
+		logger.WithFields(fields).Error("[ICCID-CONFLICT] 检测到ICCID冲突，仅记录告警，新连接照常注册")
+		return iccid, nil
+	}
+}
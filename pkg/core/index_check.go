@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 索引健康检查触发方式
+const (
+	IndexCheckTriggerScheduled = "scheduled" // 定时检查
+	IndexCheckTriggerManual    = "manual"    // 运维手动触发
+)
+
+// ErrIndexCheckRunning 已有索引健康检查在执行（定时与手动检查互斥）
+var ErrIndexCheckRunning = errors.New("索引健康检查正在执行")
+
+// IndexRepair 修复成功的索引记录
+type IndexRepair struct {
+	DeviceID    string `json:"deviceId"`
+	BeforeICCID string `json:"beforeIccid"` // 修复前索引指向的ICCID
+	AfterICCID  string `json:"afterIccid"`  // 修复后索引指向的ICCID
+	Problem     string `json:"problem"`     // 修复前的校验错误
+}
+
+// IndexUnrepairable 无法修复的索引记录
+type IndexUnrepairable struct {
+	DeviceID        string `json:"deviceId"`
+	ICCID           string `json:"iccid"`
+	ValidationError string `json:"validationError"`
+	RepairError     string `json:"repairError"`
+}
+
+// IndexCheckResult 一次索引健康检查的结果
+type IndexCheckResult struct {
+	Trigger        string              `json:"trigger"`
+	StartedAt      time.Time           `json:"startedAt"`
+	DurationMs     int64               `json:"durationMs"`
+	DevicesChecked int                 `json:"devicesChecked"`
+	Healthy        int                 `json:"healthy"`
+	Repaired       []IndexRepair       `json:"repaired"`
+	Unrepairable   []IndexUnrepairable `json:"unrepairable"`
+	Incomplete     bool                `json:"incomplete,omitempty"` // 超时或取消，未检查全部设备
+}
+
+// RunIndexHealthCheck 检查全部设备索引并尝试修复不一致项；ctx 取消或超时时返回已检查部分的结果（Incomplete=true）。
+// 同一时刻只允许一次检查，已有检查在执行时返回 ErrIndexCheckRunning；定时检查的结果保存为最近一次结果
+func (m *TCPManager) RunIndexHealthCheck(ctx context.Context, trigger string) (*IndexCheckResult, error) {
+	if !m.indexCheckMu.TryLock() {
+		return nil, ErrIndexCheckRunning
+	}
+	defer m.indexCheckMu.Unlock()
+
+	result := &IndexCheckResult{
+		Trigger:      trigger,
+		StartedAt:    time.Now(),
+		Repaired:     []IndexRepair{},
+		Unrepairable: []IndexUnrepairable{},
+	}
+
+	m.deviceIndex.Range(func(key, value interface{}) bool {
+		if ctx.Err() != nil {
+			result.Incomplete = true
+			return false
+		}
+		deviceID := key.(string)
+		result.DevicesChecked++
+
+		valid, err := m.ValidateDeviceIndex(deviceID)
+		if valid {
+			result.Healthy++
+			return true
+		}
+		before, _ := value.(string)
+		if repairErr := m.RepairDeviceIndex(deviceID); repairErr != nil {
+			result.Unrepairable = append(result.Unrepairable, IndexUnrepairable{
+				DeviceID:        deviceID,
+				ICCID:           before,
+				ValidationError: errorString(err),
+				RepairError:     repairErr.Error(),
+			})
+			return true
+		}
+		after := before
+		if v, ok := m.deviceIndex.Load(deviceID); ok {
+			after, _ = v.(string)
+		}
+		result.Repaired = append(result.Repaired, IndexRepair{
+			DeviceID:    deviceID,
+			BeforeICCID: before,
+			AfterICCID:  after,
+			Problem:     errorString(err),
+		})
+		return true
+	})
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+
+	m.stats.mutex.Lock()
+	m.stats.IndexChecks++
+	m.stats.IndexHealthy += int64(result.Healthy)
+	m.stats.IndexRepaired += int64(len(result.Repaired))
+	m.stats.IndexUnrepairable += int64(len(result.Unrepairable))
+	m.stats.LastIndexCheckAt = result.StartedAt
+	if trigger == IndexCheckTriggerScheduled {
+		m.lastIndexCheck = result
+	}
+	m.stats.mutex.Unlock()
+
+	return result, nil
+}
+
+// LastIndexHealthCheck 最近一次定时索引健康检查的结果
+func (m *TCPManager) LastIndexHealthCheck() (*IndexCheckResult, bool) {
+	m.stats.mutex.RLock()
+	defer m.stats.mutex.RUnlock()
+	return m.lastIndexCheck, m.lastIndexCheck != nil
+}
+
+// PeriodicIndexHealthCheck 定期索引健康检查
+func (m *TCPManager) PeriodicIndexHealthCheck() {
+	result, err := m.RunIndexHealthCheck(context.Background(), IndexCheckTriggerScheduled)
+	if err != nil {
+		logger.WithField("error", err.Error()).Warn("跳过定期索引健康检查")
+		return
+	}
+
+	for _, r := range result.Unrepairable {
+		logger.WithFields(logrus.Fields{
+			"deviceID":        r.DeviceID,
+			"iccid":           r.ICCID,
+			"validationError": r.ValidationError,
+			"repairError":     r.RepairError,
+		}).Error("索引修复失败")
+	}
+	logger.WithFields(logrus.Fields{
+		"healthyCount": result.Healthy,
+		"repairCount":  len(result.Repaired),
+		"errorCount":   len(result.Unrepairable),
+		"totalChecked": result.DevicesChecked,
+		"durationMs":   result.DurationMs,
+	}).Info("🔍 定期索引健康检查完成")
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -106,6 +106,13 @@ func (pm *PortManager) RegisterStatusChangeCallback(callback PortStatusChangeCal
 	}).Debug("注册端口状态变化回调函数")
 }
 
+// CallbackCount 已注册的端口状态变化回调数量
+func (pm *PortManager) CallbackCount() int {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return len(pm.statusChangeCallbacks)
+}
+
 // SetDebounceInterval 设置防抖间隔
 func (pm *PortManager) SetDebounceInterval(interval time.Duration) {
 	pm.mutex.Lock()
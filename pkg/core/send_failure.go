@@ -0,0 +1,120 @@
+package core
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// CleanupReasonWriteFailed 连接因持续发送失败被主动关闭
+const CleanupReasonWriteFailed = "write_failed"
+
+// SendFailureConfig 发送失败保护配置
+// 对端停止读取但TCP未断开时，发送缓冲区会长期阻塞，设备看似在线而下发全部失败；
+// 连续失败超过阈值或单次发送阻塞过久时主动关闭连接，促使设备重连
+type SendFailureConfig struct {
+	Enabled    bool          `json:"enabled"`
+	Threshold  int           `json:"threshold"`   // 连续发送失败次数超过该值时关闭连接
+	WriteBlock time.Duration `json:"write_block"` // 单次发送（含重试）阻塞超过该时长且失败时立即关闭连接
+}
+
+// DefaultSendFailureConfig 默认发送失败保护配置
+func DefaultSendFailureConfig() *SendFailureConfig {
+	return &SendFailureConfig{
+		Enabled:    true,
+		Threshold:  5,
+		WriteBlock: 30 * time.Second,
+	}
+}
+
+// SendHealth 连接发送健康计数（诊断快照）
+type SendHealth struct {
+	SendFailures            int64     `json:"send_failures"`             // 累计发送失败次数
+	ConsecutiveSendFailures int64     `json:"consecutive_send_failures"` // 连续发送失败次数，任一次发送成功即清零
+	LastSendError           string    `json:"last_send_error,omitempty"`
+	LastSendFailureAt       time.Time `json:"last_send_failure_at,omitempty"`
+}
+
+// GetSendHealth 获取连接发送健康计数
+func (s *ConnectionSession) GetSendHealth() SendHealth {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.sendHealth
+}
+
+// SetSendFailureConfig 设置发送失败保护配置（nil 忽略，非法值回退默认）
+func (m *TCPManager) SetSendFailureConfig(config *SendFailureConfig) {
+	if config == nil {
+		return
+	}
+	cfg := *config
+	defaults := DefaultSendFailureConfig()
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaults.Threshold
+	}
+	if cfg.WriteBlock <= 0 {
+		cfg.WriteBlock = defaults.WriteBlock
+	}
+	m.sendFailure.Store(&cfg)
+}
+
+// GetSendFailureConfig 获取当前发送失败保护配置副本
+func (m *TCPManager) GetSendFailureConfig() SendFailureConfig {
+	if cfg := m.sendFailure.Load(); cfg != nil {
+		return *cfg
+	}
+	return *DefaultSendFailureConfig()
+}
+
+// RecordSendResult 记录一次下发结果（由统一发送器回调），elapsed 为本次发送含重试的总耗时。
+// 成功时清零连续失败计数；失败时累加计数，连续失败超过阈值或阻塞超过写截止时长时
+// 以 write_failed 原因清理并关闭连接。返回连接是否因此被关闭
+func (m *TCPManager) RecordSendResult(connID uint64, err error, elapsed time.Duration) bool {
+	session, ok := m.GetSessionByConnID(connID)
+	if !ok {
+		return false
+	}
+
+	session.mutex.Lock()
+	if err == nil {
+		session.sendHealth.ConsecutiveSendFailures = 0
+		session.mutex.Unlock()
+		return false
+	}
+	now := time.Now()
+	session.sendHealth.SendFailures++
+	session.sendHealth.ConsecutiveSendFailures++
+	session.sendHealth.LastSendError = err.Error()
+	session.sendHealth.LastSendFailureAt = now
+	health := session.sendHealth
+	session.mutex.Unlock()
+
+	m.stats.mutex.Lock()
+	m.stats.SendFailures++
+	m.stats.mutex.Unlock()
+
+	cfg := m.GetSendFailureConfig()
+	blocked := elapsed >= cfg.WriteBlock
+	if !cfg.Enabled || (health.ConsecutiveSendFailures <= int64(cfg.Threshold) && !blocked) {
+		return false
+	}
+
+	logger.WithFields(logrus.Fields{
+		"connID":              connID,
+		"remoteAddr":          session.RemoteAddr,
+		"consecutiveFailures": health.ConsecutiveSendFailures,
+		"totalFailures":       health.SendFailures,
+		"elapsed":             elapsed.String(),
+		"blocked":             blocked,
+		"error":               health.LastSendError,
+	}).Warn("连接持续发送失败，主动关闭以促使设备重连")
+
+	if !m.DisconnectConnection(connID, CleanupReasonWriteFailed) {
+		return false
+	}
+	m.stats.mutex.Lock()
+	m.stats.WriteFailedDisconnects++
+	m.stats.mutex.Unlock()
+	return true
+}
@@ -0,0 +1,393 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// CleanupReasonSIMFailover 双卡设备切换SIM卡时清理旧卡连接的原因（上层据此保持会话与稳定性统计的连续性）
+const CleanupReasonSIMFailover = "sim_failover"
+
+// SIM卡对来源
+const (
+	SIMPairSourceConfig = "config"
+	SIMPairSourceAPI    = "api"
+)
+
+const (
+	defaultSIMHistoryWindow = 24 * time.Hour
+	defaultSIMSettleWindow  = 30 * time.Second
+)
+
+// SIMPair 双卡设备的SIM卡对声明
+type SIMPair struct {
+	DeviceID       string    `json:"device_id"`
+	PrimaryICCID   string    `json:"primary_iccid"`
+	SecondaryICCID string    `json:"secondary_iccid"`
+	Source         string    `json:"source"` // config / api
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SIMUsage 单张SIM卡的连接统计（流量/资费按ICCID核算）
+type SIMUsage struct {
+	Connections        int64     `json:"connections"`
+	LastConnectedAt    time.Time `json:"last_connected_at,omitempty"`
+	LastDisconnectedAt time.Time `json:"last_disconnected_at,omitempty"`
+}
+
+// SIMPairStatus SIM卡对状态（设备详情展示）
+type SIMPairStatus struct {
+	SIMPair
+	ActiveICCID    string               `json:"active_iccid"`
+	PairedICCID    string               `json:"paired_iccid"`
+	LastFailoverAt *time.Time           `json:"last_failover_at,omitempty"`
+	Failovers      int64                `json:"failovers"`
+	Usage          map[string]*SIMUsage `json:"usage"` // ICCID → 连接统计
+}
+
+// SIMFailover SIM卡切换事件
+type SIMFailover struct {
+	DeviceID   string    `json:"device_id"`
+	FromICCID  string    `json:"from_iccid"`
+	ToICCID    string    `json:"to_iccid"`
+	FromConnID uint64    `json:"from_conn_id,omitempty"`
+	ToConnID   uint64    `json:"to_conn_id"`
+	Overlap    bool      `json:"overlap"` // 切换时旧卡连接仍然存活（两张卡短暂同时在线）
+	At         time.Time `json:"at"`
+}
+
+// SIMFailoverHandler SIM卡切换回调
+type SIMFailoverHandler func(failover SIMFailover)
+
+// simPairEntry 卡对运行状态
+type simPairEntry struct {
+	pair           SIMPair
+	active         string
+	lastFailoverAt time.Time
+	failovers      int64
+	usage          map[string]*SIMUsage
+}
+
+// SIMPairRegistry 双卡设备SIM卡对注册表：设备在卡对内切换ICCID时视为同一设备的故障切换，
+// 设备身份、充电会话与统计保持连续，连接级统计仍按ICCID分别记录
+type SIMPairRegistry struct {
+	mutex         sync.RWMutex
+	pairs         map[string]*simPairEntry // deviceID → 卡对
+	byICCID       map[string]string        // iccid → deviceID
+	handlers      []SIMFailoverHandler
+	historyWindow time.Duration // 旧卡在该时长内有连接记录才视为切换（否则按首次启用处理）
+	settleWindow  time.Duration // 切换后的稳定期：期间旧卡重新注册且新卡连接存活时拒绝，避免两张卡交替抢占
+}
+
+// NewSIMPairRegistry 创建SIM卡对注册表
+func NewSIMPairRegistry() *SIMPairRegistry {
+	return &SIMPairRegistry{
+		pairs:         make(map[string]*simPairEntry),
+		byICCID:       make(map[string]string),
+		historyWindow: defaultSIMHistoryWindow,
+		settleWindow:  defaultSIMSettleWindow,
+	}
+}
+
+// SetWindows 设置切换判定窗口与切换稳定期（<=0 保持不变）
+func (r *SIMPairRegistry) SetWindows(historyWindow, settleWindow time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if historyWindow > 0 {
+		r.historyWindow = historyWindow
+	}
+	if settleWindow > 0 {
+		r.settleWindow = settleWindow
+	}
+}
+
+// Declare 声明（或更新）设备的SIM卡对；ICCID已属于其他设备的卡对时返回错误
+func (r *SIMPairRegistry) Declare(pair SIMPair) (SIMPairStatus, error) {
+	if pair.DeviceID == "" || pair.PrimaryICCID == "" || pair.SecondaryICCID == "" {
+		return SIMPairStatus{}, fmt.Errorf("设备ID与主副卡ICCID均不能为空")
+	}
+	if pair.PrimaryICCID == pair.SecondaryICCID {
+		return SIMPairStatus{}, fmt.Errorf("主副卡ICCID不能相同")
+	}
+	if pair.CreatedAt.IsZero() {
+		pair.CreatedAt = time.Now()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, iccid := range []string{pair.PrimaryICCID, pair.SecondaryICCID} {
+		if owner, ok := r.byICCID[iccid]; ok && owner != pair.DeviceID {
+			return SIMPairStatus{}, fmt.Errorf("ICCID %s 已属于设备 %s 的SIM卡对", iccid, owner)
+		}
+	}
+
+	entry, exists := r.pairs[pair.DeviceID]
+	if exists {
+		delete(r.byICCID, entry.pair.PrimaryICCID)
+		delete(r.byICCID, entry.pair.SecondaryICCID)
+		entry.pair = pair
+		if entry.active != pair.PrimaryICCID && entry.active != pair.SecondaryICCID {
+			entry.active = ""
+		}
+	} else {
+		entry = &simPairEntry{pair: pair, usage: make(map[string]*SIMUsage)}
+		r.pairs[pair.DeviceID] = entry
+	}
+	r.byICCID[pair.PrimaryICCID] = pair.DeviceID
+	r.byICCID[pair.SecondaryICCID] = pair.DeviceID
+
+	logger.WithFields(logrus.Fields{
+		"deviceID":  pair.DeviceID,
+		"primary":   pair.PrimaryICCID,
+		"secondary": pair.SecondaryICCID,
+		"source":    pair.Source,
+	}).Info("📶 已声明双卡设备SIM卡对")
+	return entry.status(), nil
+}
+
+// Remove 删除设备的SIM卡对
+func (r *SIMPairRegistry) Remove(deviceID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry, ok := r.pairs[deviceID]
+	if !ok {
+		return false
+	}
+	delete(r.byICCID, entry.pair.PrimaryICCID)
+	delete(r.byICCID, entry.pair.SecondaryICCID)
+	delete(r.pairs, deviceID)
+	return true
+}
+
+// Get 设备的SIM卡对状态
+func (r *SIMPairRegistry) Get(deviceID string) (SIMPairStatus, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	entry, ok := r.pairs[deviceID]
+	if !ok {
+		return SIMPairStatus{}, false
+	}
+	return entry.status(), true
+}
+
+// List 全部SIM卡对（按设备ID排序）
+func (r *SIMPairRegistry) List() []SIMPairStatus {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	list := make([]SIMPairStatus, 0, len(r.pairs))
+	for _, entry := range r.pairs {
+		list = append(list, entry.status())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// RegisterHandler 注册SIM卡切换回调
+func (r *SIMPairRegistry) RegisterHandler(handler SIMFailoverHandler) {
+	if handler == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers = append(r.handlers, handler)
+}
+
+// HandlerCount 已注册的切换回调数量
+func (r *SIMPairRegistry) HandlerCount() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.handlers)
+}
+
+func (r *SIMPairRegistry) emit(failover SIMFailover) {
+	r.mutex.RLock()
+	handlers := append([]SIMFailoverHandler(nil), r.handlers...)
+	r.mutex.RUnlock()
+	for _, h := range handlers {
+		h(failover)
+	}
+}
+
+// noteDisconnect 记录卡对内ICCID的连接断开
+func (r *SIMPairRegistry) noteDisconnect(deviceID, iccid string, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if entry, ok := r.pairs[deviceID]; ok && entry.inPair(iccid) {
+		entry.usageOf(iccid).LastDisconnectedAt = now
+	}
+}
+
+func (e *simPairEntry) inPair(iccid string) bool {
+	return iccid == e.pair.PrimaryICCID || iccid == e.pair.SecondaryICCID
+}
+
+func (e *simPairEntry) sibling(iccid string) string {
+	if iccid == e.pair.PrimaryICCID {
+		return e.pair.SecondaryICCID
+	}
+	return e.pair.PrimaryICCID
+}
+
+func (e *simPairEntry) usageOf(iccid string) *SIMUsage {
+	u, ok := e.usage[iccid]
+	if !ok {
+		u = &SIMUsage{}
+		e.usage[iccid] = u
+	}
+	return u
+}
+
+func (e *simPairEntry) status() SIMPairStatus {
+	s := SIMPairStatus{
+		SIMPair:     e.pair,
+		ActiveICCID: e.active,
+		Failovers:   e.failovers,
+		Usage:       make(map[string]*SIMUsage, len(e.usage)),
+	}
+	if e.active != "" {
+		s.PairedICCID = e.sibling(e.active)
+	}
+	if !e.lastFailoverAt.IsZero() {
+		at := e.lastFailoverAt
+		s.LastFailoverAt = &at
+	}
+	for iccid, u := range e.usage {
+		copied := *u
+		s.Usage[iccid] = &copied
+	}
+	return s
+}
+
+// simFailoverPlan 注册时判定的SIM卡切换（carry 为旧卡下的设备信息，迁移到新卡设备组）
+type simFailoverPlan struct {
+	failover SIMFailover
+	carry    *Device
+}
+
+// ===============================
+// TCPManager 集成
+// ===============================
+
+// GetSIMPairRegistry 获取双卡设备SIM卡对注册表
+func (m *TCPManager) GetSIMPairRegistry() *SIMPairRegistry {
+	return m.simPairs
+}
+
+// resolveSIMFailover 设备注册时判定是否为卡对内的SIM卡切换：
+// 旧卡仍在线或在判定窗口内有连接记录时视为切换，返回迁移计划；切换稳定期内旧卡抢占存活的新卡连接时拒绝注册
+func (m *TCPManager) resolveSIMFailover(session *ConnectionSession, deviceID, iccid string, now time.Time) (*simFailoverPlan, error) {
+	r := m.simPairs
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry, ok := r.pairs[deviceID]
+	if !ok || !entry.inPair(iccid) {
+		return nil, nil
+	}
+
+	existing, online := m.GetSessionByDeviceID(deviceID)
+	otherConnAlive := online && existing.ConnID != session.ConnID
+
+	if entry.active == "" || entry.active == iccid {
+		// 同一连接重复注册不重复计数
+		if !online || otherConnAlive {
+			u := entry.usageOf(iccid)
+			u.Connections++
+			u.LastConnectedAt = now
+		}
+		entry.active = iccid
+		return nil, nil
+	}
+
+	from := entry.active
+	if otherConnAlive && !entry.lastFailoverAt.IsZero() && now.Sub(entry.lastFailoverAt) < r.settleWindow {
+		logger.WithFields(logrus.Fields{
+			"deviceID":    deviceID,
+			"iccid":       iccid,
+			"activeICCID": from,
+			"connID":      session.ConnID,
+		}).Warn("📶 SIM卡切换稳定期内旧卡重新注册，保持当前卡连接")
+		return nil, fmt.Errorf("设备 %s 刚切换到SIM卡 %s，稳定期内拒绝SIM卡 %s 的注册", deviceID, from, iccid)
+	}
+
+	fromUsage := entry.usageOf(from)
+	recent := online || (!fromUsage.LastDisconnectedAt.IsZero() && now.Sub(fromUsage.LastDisconnectedAt) <= r.historyWindow)
+
+	u := entry.usageOf(iccid)
+	u.Connections++
+	u.LastConnectedAt = now
+	entry.active = iccid
+	if !recent {
+		return nil, nil
+	}
+
+	entry.lastFailoverAt = now
+	entry.failovers++
+	plan := &simFailoverPlan{failover: SIMFailover{
+		DeviceID:  deviceID,
+		FromICCID: from,
+		ToICCID:   iccid,
+		ToConnID:  session.ConnID,
+		Overlap:   otherConnAlive,
+		At:        now,
+	}}
+	if online {
+		plan.failover.FromConnID = existing.ConnID
+	}
+	if device, ok := m.GetDeviceByID(deviceID); ok {
+		device.RLock()
+		carry := &Device{
+			RegisteredAt:   device.RegisteredAt,
+			LastHeartbeat:  device.LastHeartbeat,
+			HeartbeatCount: device.HeartbeatCount,
+			DeviceType:     device.DeviceType,
+			DeviceVersion:  device.DeviceVersion,
+			Properties:     make(map[string]interface{}, len(device.Properties)),
+		}
+		for k, v := range device.Properties {
+			carry.Properties[k] = v
+		}
+		device.RUnlock()
+		plan.carry = carry
+	}
+	return plan, nil
+}
+
+// applySIMCarryOver 将旧卡下的设备信息迁移到新卡设备组中的设备（注册时间、心跳计数、型号与扩展属性）
+func (m *TCPManager) applySIMCarryOver(deviceID string, plan *simFailoverPlan) {
+	if plan == nil || plan.carry == nil {
+		return
+	}
+	device, ok := m.GetDeviceByID(deviceID)
+	if !ok {
+		return
+	}
+	device.Lock()
+	defer device.Unlock()
+	if !plan.carry.RegisteredAt.IsZero() {
+		device.RegisteredAt = plan.carry.RegisteredAt
+	}
+	device.HeartbeatCount += plan.carry.HeartbeatCount
+	if device.LastHeartbeat.IsZero() {
+		device.LastHeartbeat = plan.carry.LastHeartbeat
+	}
+	if device.DeviceType == 0 {
+		device.DeviceType = plan.carry.DeviceType
+	}
+	if device.DeviceVersion == "" {
+		device.DeviceVersion = plan.carry.DeviceVersion
+	}
+	if device.Properties == nil {
+		device.Properties = make(map[string]interface{})
+	}
+	for k, v := range plan.carry.Properties {
+		if _, exists := device.Properties[k]; !exists {
+			device.Properties[k] = v
+		}
+	}
+}
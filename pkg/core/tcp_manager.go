@@ -3,10 +3,12 @@ package core
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -32,6 +34,50 @@ type TCPManager struct {
 
 	// 内部控制
 	heartbeatWatcherStarted bool
+
+	// ICCID冲突检测（SIM克隆/错误配置）
+	iccidConflicts *ICCIDConflictDetector
+
+	// 双卡设备SIM卡对（卡对内切换ICCID时保持设备连续性）
+	simPairs *SIMPairRegistry
+
+	// 连接清理回调（由上层注入，避免core依赖命令管理器）
+	cleanupHandler atomic.Value // ConnectionCleanupHandler
+
+	// 连接关闭观察者（会话归档）
+	closedObserver atomic.Pointer[ClosedSessionObserver]
+
+	// 设备活动观察者（设备会话持久化）
+	activityObserver atomic.Pointer[DeviceActivityObserver]
+
+	// 协议会话抽样决策
+	traceSampler atomic.Pointer[ConnTraceSampler]
+
+	// 停机排空中：拒绝新的连接与设备注册
+	draining atomic.Bool
+
+	// 发送失败保护配置（未设置时使用默认值）
+	sendFailure atomic.Pointer[SendFailureConfig]
+
+	// 设备组出站命令队列配置与命令写入器（由上层注入）
+	commandQueue  atomic.Pointer[CommandQueueConfig]
+	commandWriter atomic.Pointer[CommandWriter]
+
+	// 设备组惰性压缩与顶层映射写入/删除计数
+	compaction                        groupCompaction
+	connChurn, groupChurn, indexChurn mapChurn
+
+	// 索引健康检查：定时与手动检查互斥；最近一次定时检查结果受 stats.mutex 保护
+	indexCheckMu   sync.Mutex
+	lastIndexCheck *IndexCheckResult
+}
+
+// ConnectionCleanupHandler 连接清理回调：connID 为被清理的连接，deviceIDs 为该连接下被移除的设备
+type ConnectionCleanupHandler func(connID uint64, deviceIDs []string, reason string)
+
+// SetConnectionCleanupHandler 设置连接清理回调（重复设置时覆盖）
+func (m *TCPManager) SetConnectionCleanupHandler(handler ConnectionCleanupHandler) {
+	m.cleanupHandler.Store(handler)
 }
 
 // ConnectionSession 连接会话数据结构
@@ -53,8 +99,16 @@ type ConnectionSession struct {
 	LastDisconnect time.Time `json:"last_disconnect"`
 
 	// === 连接级别统计 ===
-	DataBytesIn  int64 `json:"data_bytes_in"`
-	DataBytesOut int64 `json:"data_bytes_out"`
+	DataBytesIn      int64 `json:"data_bytes_in"`
+	DataBytesOut     int64 `json:"data_bytes_out"`
+	ChecksumFailures int64 `json:"checksum_failures"` // 上行帧校验和错误次数（原子累加）
+	DuplicateFrames  int64 `json:"duplicate_frames"`  // 被重复帧抑制拦截的设备重发次数（原子累加）
+
+	// === 发送健康计数（受 mutex 保护，通过 GetSendHealth 读取） ===
+	sendHealth SendHealth
+
+	// === 协议会话抽样记录（未抽样时为nil） ===
+	trace atomic.Pointer[ConnTrace]
 
 	// === 扩展属性 ===
 	Properties map[string]interface{} `json:"properties"`
@@ -70,11 +124,21 @@ type DeviceGroup struct {
 	ICCID         string             `json:"iccid"`
 	ConnID        uint64             `json:"conn_id"`
 	Connection    ziface.IConnection `json:"-"`
-	Devices       map[string]*Device `json:"devices"` // deviceID → device info (单一数据源)
-	PrimaryDevice string             `json:"primary_device"`
+	Devices       map[string]*Device `json:"devices"`        // deviceID → device info (单一数据源)
+	PrimaryDevice string             `json:"primary_device"` // 组内首个注册的设备
 	CreatedAt     time.Time          `json:"created_at"`
 	LastActivity  time.Time          `json:"last_activity"`
 	mutex         sync.RWMutex       `json:"-"`
+
+	// VirtualDevices 虚拟子设备（virtualID → 虚拟设备），由虚拟拆分注册表在设备注册/拆分时挂载
+	VirtualDevices map[string]*VirtualDevice `json:"virtual_devices,omitempty"`
+
+	// 组内映射的历史峰值条目数（受 mutex 保护），供惰性压缩判断
+	peakDevices int
+	peakVirtual int
+
+	// 出站命令队列：组内设备共享连接，命令串行写入
+	commands commandQueue
 }
 
 // RLock 获取读锁
@@ -115,6 +179,9 @@ type Device struct {
 	LastCommandCode byte                            `json:"last_command_code"`
 	LastCommandSize int                             `json:"last_command_size"`
 	Properties      map[string]interface{}          `json:"properties"`
+	Capabilities    *capability.Set                 `json:"capabilities,omitempty"` // 固件能力集，未启用能力矩阵时为nil
+	Dialect         string                          `json:"dialect,omitempty"`      // 协议方言，注册完成时按连接识别结果记录
+	Encrypted       bool                            `json:"encrypted"`              // 数据域是否加密，注册完成时按注册帧的密钥ID声明记录
 	mutex           sync.RWMutex                    `json:"-"`
 }
 
@@ -143,6 +210,8 @@ type TCPManagerConfig struct {
 	HeartbeatTimeout  time.Duration `json:"heartbeat_timeout"`
 	CleanupInterval   time.Duration `json:"cleanup_interval"`
 	EnableDebugLog    bool          `json:"enable_debug_log"`
+	// 按设备类型（Device.DeviceType）覆盖心跳超时，未配置的类型使用 HeartbeatTimeout
+	HeartbeatTimeoutByType map[uint16]time.Duration `json:"heartbeat_timeout_by_type"`
 }
 
 // TCPManagerStats TCP管理器统计信息
@@ -153,7 +222,18 @@ type TCPManagerStats struct {
 	OnlineDevices     int64     `json:"online_devices"`
 	LastConnectionAt  time.Time `json:"last_connection_at"`
 	LastUpdateAt      time.Time `json:"last_update_at"`
-	mutex             sync.RWMutex
+
+	// 索引健康检查累计计数（按分类）
+	IndexChecks       int64     `json:"index_checks"`
+	IndexHealthy      int64     `json:"index_healthy"`
+	IndexRepaired     int64     `json:"index_repaired"`
+	IndexUnrepairable int64     `json:"index_unrepairable"`
+	LastIndexCheckAt  time.Time `json:"last_index_check_at"`
+
+	// 发送失败累计计数与因持续发送失败主动关闭的连接数
+	SendFailures           int64 `json:"send_failures"`
+	WriteFailedDisconnects int64 `json:"write_failed_disconnects"`
+	mutex                  sync.RWMutex
 }
 
 // NewTCPManager 创建TCP管理器
@@ -170,9 +250,11 @@ func NewTCPManager(config *TCPManagerConfig) *TCPManager {
 	}
 
 	return &TCPManager{
-		config:   config,
-		stats:    &TCPManagerStats{},
-		stopChan: make(chan struct{}),
+		config:         config,
+		stats:          &TCPManagerStats{},
+		stopChan:       make(chan struct{}),
+		iccidConflicts: NewICCIDConflictDetector(nil),
+		simPairs:       NewSIMPairRegistry(),
 	}
 }
 
@@ -224,6 +306,9 @@ func (m *TCPManager) RegisterConnection(conn ziface.IConnection) (*ConnectionSes
 	if conn == nil {
 		return nil, fmt.Errorf("连接对象不能为空")
 	}
+	if m.draining.Load() {
+		return nil, ErrDraining
+	}
 
 	connID := conn.GetConnID()
 
@@ -240,8 +325,12 @@ func (m *TCPManager) RegisterConnection(conn ziface.IConnection) (*ConnectionSes
 	// 创建新的连接会话
 	session := NewConnectionSession(conn)
 
+	// 接入时抽样：须在存储会话之前决定，首帧即可记录
+	m.sampleOnAccept(session)
+
 	// 存储连接会话
 	m.connections.Store(connID, session)
+	m.connChurn.stored()
 
 	// 更新统计信息
 	m.stats.mutex.Lock()
@@ -271,6 +360,9 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 	if iccid == "" {
 		return fmt.Errorf("ICCID不能为空")
 	}
+	if m.draining.Load() {
+		return ErrDraining
+	}
 
 	connID := conn.GetConnID()
 
@@ -282,6 +374,18 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 
 	session := sessionInterface.(*ConnectionSession)
 
+	// 🔧 ICCID冲突检测：同一ICCID已有存活设备组且来源地址不同，按策略处理
+	iccid, err := m.resolveICCIDConflict(session, deviceID, iccid)
+	if err != nil {
+		return err
+	}
+
+	// 📶 双卡设备：卡对内切换ICCID视为同一设备的SIM卡切换
+	failover, err := m.resolveSIMFailover(session, deviceID, iccid, time.Now())
+	if err != nil {
+		return err
+	}
+
 	// 🔧 检查设备是否已注册（避免重复注册导致的索引不一致）
 	alreadyExists := false
 	if existingSession, existsOld := m.GetSessionByDeviceID(deviceID); existsOld {
@@ -291,8 +395,12 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 			logger.WithFields(logrus.Fields{"deviceID": deviceID, "connID": connID}).Debug("[REGISTER] 同一连接重复注册，更新信息")
 		} else {
 			// 不同连接重连：清理旧连接（严格在线视图）
-			logger.WithFields(logrus.Fields{"deviceID": deviceID, "oldConnID": existingSession.ConnID, "newConnID": connID}).Warn("[REGISTER] 设备跨连接重连，清理旧连接")
-			m.cleanupConnection(existingSession.ConnID, "re-register")
+			reason := "re-register"
+			if failover != nil {
+				reason = CleanupReasonSIMFailover
+			}
+			logger.WithFields(logrus.Fields{"deviceID": deviceID, "oldConnID": existingSession.ConnID, "newConnID": connID, "reason": reason}).Warn("[REGISTER] 设备跨连接重连，清理旧连接")
+			m.cleanupConnection(existingSession.ConnID, reason)
 			alreadyExists = false // 旧连接已清理，当作新设备统计
 		}
 	}
@@ -350,6 +458,10 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 					Properties:   make(map[string]interface{}),
 				}
 			}
+			deviceGroup.notePeak()
+			if deviceGroup.PrimaryDevice == "" {
+				deviceGroup.PrimaryDevice = deviceID
+			}
 			deviceGroup.LastActivity = time.Now()
 		} else {
 			// 🔧 修复：创建新设备组，只存储设备信息
@@ -364,11 +476,15 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 				LastActivity: time.Now(),
 				Properties:   make(map[string]interface{}),
 			}
+			deviceGroup.PrimaryDevice = deviceID // 组内首个注册的设备
+			deviceGroup.notePeak()
 			m.deviceGroups.Store(iccid, deviceGroup)
+			m.groupChurn.stored()
 		}
 
 		// 建立设备索引映射
 		m.deviceIndex.Store(deviceID, iccid)
+		m.indexChurn.stored()
 		return nil
 	})
 	if err != nil {
@@ -386,6 +502,17 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 		return fmt.Errorf("设备组创建失败")
 	}
 
+	if failover != nil {
+		m.applySIMCarryOver(deviceID, failover)
+		logger.WithFields(logrus.Fields{
+			"deviceID":  deviceID,
+			"fromICCID": failover.failover.FromICCID,
+			"toICCID":   iccid,
+			"overlap":   failover.failover.Overlap,
+		}).Warn("📶 双卡设备SIM卡切换，设备身份与会话保持连续")
+		m.simPairs.emit(failover.failover)
+	}
+
 	// 更新统计信息（仅对新设备或被视为重新接入的设备计数）
 	if !alreadyExists {
 		m.stats.mutex.Lock()
@@ -410,6 +537,11 @@ func (m *TCPManager) RegisterDevice(conn ziface.IConnection, deviceID, physicalI
 		"connID":     connID,
 	}).Info("设备注册成功")
 
+	m.sampleOnIdentify(session, iccid, deviceID)
+	if device, ok := m.GetDeviceByID(deviceID); ok {
+		m.notifyDeviceActivity(device, true)
+	}
+
 	// 🔧 新增：注册后立即验证索引一致性
 	if valid, err := m.ValidateDeviceIndex(deviceID); !valid {
 		logger.WithFields(logrus.Fields{
@@ -463,6 +595,7 @@ func (m *TCPManager) RebuildDeviceIndex(deviceID string, session *ConnectionSess
 
 	// 🚀 新架构：重建设备索引映射 (deviceID → iccid)
 	m.deviceIndex.Store(deviceID, iccid)
+	m.indexChurn.stored()
 
 	// 🔧 关键修复：确保设备在DeviceGroup中正确存在
 	if groupInterface, exists := m.deviceGroups.Load(iccid); exists {
@@ -486,6 +619,7 @@ func (m *TCPManager) RebuildDeviceIndex(deviceID string, session *ConnectionSess
 				LastActivity: time.Now(),
 				Properties:   make(map[string]interface{}),
 			}
+			group.notePeak()
 			logger.WithField("deviceID", deviceID).Info("🔧 重建设备组中的设备条目")
 		} else {
 			// 🔧 修复：更新现有设备的PhysicalID和活动时间，使用mutex保护
@@ -541,6 +675,7 @@ func (m *TCPManager) GetSessionByDeviceID(deviceID string) (*ConnectionSession,
 	if !exists {
 		// 设备组不存在，清理无效的设备索引
 		m.deviceIndex.Delete(deviceID)
+		m.indexChurn.deleted()
 		return nil, false
 	}
 
@@ -551,6 +686,7 @@ func (m *TCPManager) GetSessionByDeviceID(deviceID string) (*ConnectionSession,
 	if !exists {
 		// 连接会话不存在，清理无效的设备索引
 		m.deviceIndex.Delete(deviceID)
+		m.indexChurn.deleted()
 		return nil, false
 	}
 
@@ -562,6 +698,7 @@ func (m *TCPManager) GetSessionByDeviceID(deviceID string) (*ConnectionSession,
 	if !deviceExists {
 		// 设备不在组中，清理无效的设备索引
 		m.deviceIndex.Delete(deviceID)
+		m.indexChurn.deleted()
 		return nil, false
 	}
 
@@ -655,6 +792,7 @@ func (m *TCPManager) UpdateHeartbeat(deviceID string) error {
 		if foundGroup != nil {
 			// 修复设备索引
 			m.deviceIndex.Store(deviceID, foundICCID)
+			m.indexChurn.stored()
 			logger.WithFields(logrus.Fields{
 				"deviceID": deviceID,
 				"iccid":    foundICCID,
@@ -691,6 +829,7 @@ func (m *TCPManager) UpdateHeartbeat(deviceID string) error {
 	// 更新设备组活动时间
 	group.LastActivity = now
 	group.mutex.Unlock()
+	m.notifyDeviceActivity(device, false)
 
 	// 🔧 修复：更新连接会话信息，通过ConnID获取
 	if sessionInterface, sessionExists := m.connections.Load(group.ConnID); sessionExists {
@@ -711,6 +850,39 @@ func (m *TCPManager) SetHeartbeatTimeout(timeout time.Duration) {
 	}
 }
 
+// SetHeartbeatTimeoutForType 设置指定设备类型的心跳超时，d<=0 时移除覆盖、回落到全局超时；运行时调整下一轮检查即生效
+func (m *TCPManager) SetHeartbeatTimeoutForType(deviceType uint16, d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.config == nil {
+		return
+	}
+	// 写时复制：配置中的映射可能由调用方持有
+	byType := make(map[uint16]time.Duration, len(m.config.HeartbeatTimeoutByType)+1)
+	for t, timeout := range m.config.HeartbeatTimeoutByType {
+		byType[t] = timeout
+	}
+	if d > 0 {
+		byType[deviceType] = d
+	} else {
+		delete(byType, deviceType)
+	}
+	m.config.HeartbeatTimeoutByType = byType
+}
+
+// HeartbeatTimeoutFor 设备类型的有效心跳超时；byType 表示是否来自按类型覆盖
+func (m *TCPManager) HeartbeatTimeoutFor(deviceType uint16) (timeout time.Duration, byType bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.config == nil {
+		return 0, false
+	}
+	if timeout, ok := m.config.HeartbeatTimeoutByType[deviceType]; ok && timeout > 0 {
+		return timeout, true
+	}
+	return m.config.HeartbeatTimeout, false
+}
+
 // UpdateConnectionStateByConnID 按连接更新连接状态
 func (m *TCPManager) UpdateConnectionStateByConnID(connID uint64, state constants.DeviceConnectionState) error {
 	session, exists := m.GetSessionByConnID(connID)
@@ -738,6 +910,7 @@ func (m *TCPManager) UpdateICCIDByConnID(connID uint64, iccid string) error {
 	session.UpdatedAt = time.Now()
 	session.mutex.Unlock()
 
+	m.sampleOnIdentify(session, iccid, "")
 	return nil
 }
 
@@ -757,6 +930,7 @@ func (m *TCPManager) Start() error {
 	if !m.heartbeatWatcherStarted {
 		m.heartbeatWatcherStarted = true
 		go m.startHeartbeatWatcher()
+		go m.startGroupCompactor()
 	}
 	return nil
 }
@@ -789,22 +963,40 @@ func (m *TCPManager) GetStats() *TCPManagerStats {
 		OnlineDevices:     m.stats.OnlineDevices,
 		LastConnectionAt:  m.stats.LastConnectionAt,
 		LastUpdateAt:      m.stats.LastUpdateAt,
+		IndexChecks:       m.stats.IndexChecks,
+		IndexHealthy:      m.stats.IndexHealthy,
+		IndexRepaired:     m.stats.IndexRepaired,
+		IndexUnrepairable: m.stats.IndexUnrepairable,
+		LastIndexCheckAt:  m.stats.LastIndexCheckAt,
+
+		SendFailures:           m.stats.SendFailures,
+		WriteFailedDisconnects: m.stats.WriteFailedDisconnects,
 	}
 }
 
 // === 全局实例 ===
 
-var (
-	globalTCPManager     *TCPManager
-	globalTCPManagerOnce sync.Once
-)
+var globalTCPManager atomic.Pointer[TCPManager]
+
+// InitGlobalTCPManager 初始化全局TCP管理器（由 bootstrap 调用；重复调用返回已有实例）
+func InitGlobalTCPManager(config *TCPManagerConfig) *TCPManager {
+	globalTCPManager.CompareAndSwap(nil, NewTCPManager(config))
+	return globalTCPManager.Load()
+}
 
 // GetGlobalTCPManager 获取全局TCP管理器
+// 未初始化时panic：依赖方在TCP管理器就绪前访问属于启动顺序错误，不能静默创建新实例
 func GetGlobalTCPManager() *TCPManager {
-	globalTCPManagerOnce.Do(func() {
-		globalTCPManager = NewTCPManager(nil)
-	})
-	return globalTCPManager
+	if m := globalTCPManager.Load(); m != nil {
+		return m
+	}
+	panic("core: TCP管理器尚未初始化，请先执行 bootstrap.New（测试使用 bootstrap.InitForTest）")
+}
+
+// HasConnectionCleanupHandler 是否已设置连接清理回调（启动自检用）
+func (m *TCPManager) HasConnectionCleanupHandler() bool {
+	handler, ok := m.cleanupHandler.Load().(ConnectionCleanupHandler)
+	return ok && handler != nil
 }
 
 // === 适配器接口支持方法 ===
@@ -969,9 +1161,16 @@ func (m *TCPManager) RegisterDeviceWithDetails(conn ziface.IConnection, deviceID
 	// 这里需要通过deviceID找到对应的Device并更新
 	if device, exists := m.GetDeviceByID(deviceID); exists {
 		device.Lock()
-		device.DeviceType = deviceType
-		device.DeviceVersion = deviceVersion
+		// 未携带的字段保持原值（SIM卡切换时已从旧卡迁移）
+		if deviceType != 0 {
+			device.DeviceType = deviceType
+		}
+		if deviceVersion != "" {
+			device.DeviceVersion = deviceVersion
+		}
+		device.Capabilities = capability.Resolve(device.DeviceID, device.DeviceType, device.DeviceVersion)
 		device.Unlock()
+		m.notifyDeviceActivity(device, true)
 	}
 
 	logger.WithFields(logrus.Fields{
@@ -993,28 +1192,21 @@ func (m *TCPManager) UnregisterConnection(connID uint64) error {
 
 // GetDeviceDetail 获取设备详细信息（API专用）
 func (m *TCPManager) GetDeviceDetail(deviceID string) (map[string]interface{}, error) {
-	fmt.Printf("🔍 [TCPManager.GetDeviceDetail] 开始获取设备详情: deviceID=%s\n", deviceID)
-
 	// 🔧 简化：直接使用已有的智能查找方法
 	device, exists := m.GetDeviceByID(deviceID)
 	if !exists {
-		fmt.Printf("❌ [TCPManager.GetDeviceDetail] 设备不存在: deviceID=%s\n", deviceID)
 		return nil, fmt.Errorf("设备不存在")
 	}
 
 	// 通过设备索引找到ICCID和设备组
 	iccidInterface, exists := m.deviceIndex.Load(device.DeviceID)
 	if !exists {
-		fmt.Printf("❌ [TCPManager.GetDeviceDetail] 设备索引不存在: deviceID=%s\n", device.DeviceID)
 		return nil, fmt.Errorf("设备索引不存在")
 	}
 
 	iccid := iccidInterface.(string)
-	fmt.Printf("🔍 [TCPManager.GetDeviceDetail] 找到ICCID: deviceID=%s, iccid=%s\n", device.DeviceID, iccid)
-
 	groupInterface, exists := m.deviceGroups.Load(iccid)
 	if !exists {
-		fmt.Printf("❌ [TCPManager.GetDeviceDetail] 设备组不存在: iccid=%s\n", iccid)
 		return nil, fmt.Errorf("设备组不存在")
 	}
 
@@ -1022,16 +1214,10 @@ func (m *TCPManager) GetDeviceDetail(deviceID string) (map[string]interface{}, e
 	group.mutex.RLock()
 	defer group.mutex.RUnlock()
 
-	fmt.Printf("🔍 [TCPManager.GetDeviceDetail] 设备组信息: iccid=%s, 设备数=%d\n",
-		group.ICCID, len(group.Devices))
-
 	// 🔧 修复：获取会话信息，通过ConnID获取
 	var session *ConnectionSession
 	if sessionInterface, exists := m.connections.Load(group.ConnID); exists {
 		session = sessionInterface.(*ConnectionSession)
-		fmt.Printf("✅ [TCPManager.GetDeviceDetail] 找到会话: deviceID=%s, sessionID=%s\n", device.DeviceID, session.SessionID)
-	} else {
-		fmt.Printf("⚠️ [TCPManager.GetDeviceDetail] 未找到会话: deviceID=%s\n", device.DeviceID)
 	}
 
 	// 格式化时间的辅助函数
@@ -1053,6 +1239,9 @@ func (m *TCPManager) GetDeviceDetail(deviceID string) (map[string]interface{}, e
 		"iccid":             group.ICCID,
 		"deviceType":        device.DeviceType,
 		"deviceVersion":     device.DeviceVersion,
+		"capabilities":      device.Capabilities,
+		"dialect":           device.Dialect,
+		"encrypted":         device.Encrypted,
 		"isOnline":          true,
 		"lastActivity":      lastActStr,
 		"lastActivityTs":    lastActTs,
@@ -1064,6 +1253,15 @@ func (m *TCPManager) GetDeviceDetail(deviceID string) (map[string]interface{}, e
 		"lastCommandSize":   device.LastCommandSize,
 		"groupDeviceCount":  len(group.Devices),
 		"groupSessionCount": 1, // 🔧 修复：每个设备组只有一个连接会话
+		"commandQueueDepth": group.commands.depth(),
+	}
+
+	// ⏱️ 有效心跳超时：按设备类型覆盖优先，否则为全局超时
+	heartbeatTimeout, byType := m.HeartbeatTimeoutFor(device.DeviceType)
+	detail["heartbeatTimeoutSeconds"] = int64(heartbeatTimeout / time.Second)
+	detail["heartbeatTimeoutSource"] = "global"
+	if byType {
+		detail["heartbeatTimeoutSource"] = "deviceType"
 	}
 
 	if session != nil {
@@ -1077,9 +1275,28 @@ func (m *TCPManager) GetDeviceDetail(deviceID string) (map[string]interface{}, e
 		detail["connectedAtTs"] = connAtTs
 		detail["registeredAt"] = regAtStr
 		detail["registeredAtTs"] = regAtTs
-	}
 
-	fmt.Printf("✅ [TCPManager.GetDeviceDetail] 设备详情构建完成: deviceID=%s, keys=%d\n", deviceID, len(detail))
+		sendHealth := session.GetSendHealth()
+		lastFailStr, lastFailTs := formatTime(sendHealth.LastSendFailureAt)
+		detail["sendFailures"] = sendHealth.SendFailures
+		detail["consecutiveSendFailures"] = sendHealth.ConsecutiveSendFailures
+		detail["lastSendError"] = sendHealth.LastSendError
+		detail["lastSendFailureAt"] = lastFailStr
+		detail["lastSendFailureAtTs"] = lastFailTs
+		detail["checksumFailures"] = atomic.LoadInt64(&session.ChecksumFailures)
+		detail["duplicateFrames"] = atomic.LoadInt64(&session.DuplicateFrames)
+	}
+
+	// 📶 双卡设备：当前使用卡、备用卡与最近一次切换时间
+	if pair, ok := m.simPairs.Get(device.DeviceID); ok {
+		detail["activeIccid"] = pair.ActiveICCID
+		detail["pairedIccid"] = pair.PairedICCID
+		detail["lastFailoverAt"] = ""
+		if pair.LastFailoverAt != nil {
+			detail["lastFailoverAt"] = pair.LastFailoverAt.Format("2006-01-02 15:04:05")
+		}
+		detail["simUsage"] = pair.Usage
+	}
 
 	return detail, nil
 }
@@ -1098,6 +1315,25 @@ func (m *TCPManager) GetDeviceGroups() *sync.Map {
 	return &m.deviceGroups
 }
 
+// RefreshDeviceCapabilities 按当前能力矩阵与单设备例外重新推导所有在线设备的能力集（矩阵热加载或例外变更后调用）
+func (m *TCPManager) RefreshDeviceCapabilities() {
+	m.deviceGroups.Range(func(_, value interface{}) bool {
+		group := value.(*DeviceGroup)
+		group.mutex.RLock()
+		devices := make([]*Device, 0, len(group.Devices))
+		for _, device := range group.Devices {
+			devices = append(devices, device)
+		}
+		group.mutex.RUnlock()
+		for _, device := range devices {
+			device.Lock()
+			device.Capabilities = capability.Resolve(device.DeviceID, device.DeviceType, device.DeviceVersion)
+			device.Unlock()
+		}
+		return true
+	})
+}
+
 // GetConnections 获取连接映射（connID → *ConnectionSession）
 func (m *TCPManager) GetConnections() *sync.Map {
 	return &m.connections
@@ -1114,8 +1350,7 @@ func (m *TCPManager) cleanupConnection(connID uint64, reason string) {
 	if !exists {
 		return
 	}
-	// 🔧 修复：获取连接会话（用于后续可能的扩展）
-	_ = sessionInterface.(*ConnectionSession)
+	session := sessionInterface.(*ConnectionSession)
 
 	// 🔧 修复：找到所属设备组，通过遍历设备组查找ConnID匹配的组
 	var iccid string
@@ -1132,6 +1367,7 @@ func (m *TCPManager) cleanupConnection(connID uint64, reason string) {
 		return true
 	})
 
+	var removedDeviceIDs []string
 	if foundGroup != nil {
 		group := foundGroup
 		group.mutex.Lock()
@@ -1140,12 +1376,20 @@ func (m *TCPManager) cleanupConnection(connID uint64, reason string) {
 		for deviceID := range group.Devices {
 			// 删除 deviceIndex 映射
 			m.deviceIndex.Delete(deviceID)
+			m.indexChurn.deleted()
+			removedDeviceIDs = append(removedDeviceIDs, deviceID)
 			removedDevices++
 		}
 		// 🔧 修复：清空组并删除组，移除Sessions映射
 		group.Devices = map[string]*Device{}
 		group.mutex.Unlock()
 		m.deviceGroups.Delete(iccid)
+		m.groupChurn.deleted()
+
+		now := time.Now()
+		for _, deviceID := range removedDeviceIDs {
+			m.simPairs.noteDisconnect(deviceID, iccid, now)
+		}
 
 		// 更新统计
 		m.stats.mutex.Lock()
@@ -1177,7 +1421,16 @@ func (m *TCPManager) cleanupConnection(connID uint64, reason string) {
 	}
 
 	// 最后删除连接映射
-	m.connections.Delete(connID)
+	if _, loaded := m.connections.LoadAndDelete(connID); loaded {
+		m.connChurn.deleted()
+		m.notifyClosed(session, iccid, removedDeviceIDs, reason)
+		session.closeTrace(reason)
+	}
+
+	// 通知上层（如立即失败该连接上待应答的命令）；在所有锁外调用
+	if handler, ok := m.cleanupHandler.Load().(ConnectionCleanupHandler); ok && handler != nil {
+		handler(connID, removedDeviceIDs, reason)
+	}
 }
 
 // DisconnectByDeviceID 根据设备ID断开并清理
@@ -1193,6 +1446,19 @@ func (m *TCPManager) DisconnectByDeviceID(deviceID string, reason string) bool {
 	return true
 }
 
+// DisconnectConnection 按指定原因清理连接（含其下设备）并关闭，连接不存在时返回false
+func (m *TCPManager) DisconnectConnection(connID uint64, reason string) bool {
+	session, ok := m.GetSessionByConnID(connID)
+	if !ok {
+		return false
+	}
+	m.cleanupConnection(connID, reason)
+	if session.Connection != nil {
+		session.Connection.Stop()
+	}
+	return true
+}
+
 // markDeviceOffline 心跳超时处理（严格在线视图=整体清理连接）
 func (m *TCPManager) markDeviceOffline(deviceID string) {
 	session, ok := m.GetSessionByDeviceID(deviceID)
@@ -1204,48 +1470,71 @@ func (m *TCPManager) markDeviceOffline(deviceID string) {
 
 // startHeartbeatWatcher 周期检测心跳超时
 func (m *TCPManager) startHeartbeatWatcher() {
-	interval := 30 * time.Second
-	if m.config != nil && m.config.HeartbeatTimeout > 0 {
-		half := m.config.HeartbeatTimeout / 2
-		if half < interval {
-			interval = half
-		}
-		if interval < 5*time.Second {
-			interval = 5 * time.Second
-		}
-	}
-	ticker := time.NewTicker(interval)
+	ticker := time.NewTicker(m.heartbeatCheckInterval())
 	defer ticker.Stop()
 	for {
 		select {
 		case <-m.stopChan:
 			return
-		case <-ticker.C:
-			timeout := m.config.HeartbeatTimeout
-			if timeout <= 0 {
-				continue
+		case now := <-ticker.C:
+			m.SweepHeartbeatTimeouts(now)
+			// 超时配置可在运行时调整，按最短超时重新计算检查间隔
+			ticker.Reset(m.heartbeatCheckInterval())
+		}
+	}
+}
+
+// heartbeatCheckInterval 心跳检查间隔：最短超时（全局与各设备类型）的一半，限定在5秒到30秒之间
+func (m *TCPManager) heartbeatCheckInterval() time.Duration {
+	interval := 30 * time.Second
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.config == nil {
+		return interval
+	}
+	shortest := m.config.HeartbeatTimeout
+	for _, timeout := range m.config.HeartbeatTimeoutByType {
+		if timeout > 0 && (shortest <= 0 || timeout < shortest) {
+			shortest = timeout
+		}
+	}
+	if shortest > 0 && shortest/2 < interval {
+		interval = shortest / 2
+	}
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+	return interval
+}
+
+// SweepHeartbeatTimeouts 按各设备的有效心跳超时执行一次检查，清理超时设备的连接，返回被清理的设备ID
+func (m *TCPManager) SweepHeartbeatTimeouts(now time.Time) []string {
+	var expired []string
+	// 遍历设备组
+	m.deviceGroups.Range(func(key, value interface{}) bool {
+		group := value.(*DeviceGroup)
+		group.mutex.RLock()
+		for deviceID, dev := range group.Devices {
+			dev.RLock()
+			deviceType := dev.DeviceType
+			last := dev.LastHeartbeat
+			if last.IsZero() {
+				last = dev.LastActivity
+			}
+			dev.RUnlock()
+			timeout, _ := m.HeartbeatTimeoutFor(deviceType)
+			if timeout > 0 && !last.IsZero() && now.Sub(last) > timeout {
+				expired = append(expired, deviceID)
 			}
-			now := time.Now()
-			// 遍历设备组
-			m.deviceGroups.Range(func(key, value interface{}) bool {
-				group := value.(*DeviceGroup)
-				group.mutex.RLock()
-				for deviceID, dev := range group.Devices {
-					last := dev.LastHeartbeat
-					if last.IsZero() {
-						last = dev.LastActivity
-					}
-					if !last.IsZero() && now.Sub(last) > timeout {
-						group.mutex.RUnlock() // 释放读锁再清理
-						m.markDeviceOffline(deviceID)
-						group.mutex.RLock() // 重新获取读锁继续
-					}
-				}
-				group.mutex.RUnlock()
-				return true
-			})
 		}
+		group.mutex.RUnlock()
+		return true
+	})
+	// 清理会修改设备组，须在遍历结束后进行
+	for _, deviceID := range expired {
+		m.markDeviceOffline(deviceID)
 	}
+	return expired
 }
 
 // RecalculateStats 重新计算统计（调试 / 兜底）
@@ -1444,6 +1733,7 @@ func (m *TCPManager) RepairDeviceIndex(deviceID string) error {
 
 	// 重建索引映射
 	m.deviceIndex.Store(deviceID, foundICCID)
+	m.indexChurn.stored()
 
 	logger.WithFields(logrus.Fields{
 		"deviceID": deviceID,
@@ -1492,44 +1782,3 @@ func (m *TCPManager) AtomicDeviceIndexOperation(deviceID, iccid string, operatio
 
 	return nil
 }
-
-// PeriodicIndexHealthCheck 定期索引健康检查
-func (m *TCPManager) PeriodicIndexHealthCheck() {
-	logger.Info("🔍 开始定期索引健康检查")
-
-	var healthyCount, repairCount, errorCount int
-
-	// 检查所有设备索引
-	m.deviceIndex.Range(func(key, value interface{}) bool {
-		deviceID := key.(string)
-
-		if valid, err := m.ValidateDeviceIndex(deviceID); valid {
-			healthyCount++
-		} else {
-			logger.WithFields(logrus.Fields{
-				"deviceID": deviceID,
-				"error":    err,
-			}).Warn("发现索引不一致，尝试修复")
-
-			if repairErr := m.RepairDeviceIndex(deviceID); repairErr == nil {
-				repairCount++
-				logger.WithField("deviceID", deviceID).Info("索引修复成功")
-			} else {
-				errorCount++
-				logger.WithFields(logrus.Fields{
-					"deviceID": deviceID,
-					"error":    repairErr,
-				}).Error("索引修复失败")
-			}
-		}
-
-		return true
-	})
-
-	logger.WithFields(logrus.Fields{
-		"healthyCount": healthyCount,
-		"repairCount":  repairCount,
-		"errorCount":   errorCount,
-		"totalChecked": healthyCount + repairCount + errorCount,
-	}).Info("🔍 定期索引健康检查完成")
-}
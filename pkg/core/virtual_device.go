@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// VirtualDevice 虚拟子设备：多端口机柜在同一物理ID下上报，业务侧按端口拆分为独立可寻址的设备
+type VirtualDevice struct {
+	VirtualID string    `json:"virtual_id"` // 派生ID，如 04A26CF3-P01
+	ParentID  string    `json:"parent_id"`  // 物理设备ID
+	Ports     []int     `json:"ports"`      // 映射的物理业务端口(1-based)，虚拟端口n对应Ports[n-1]
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PhysicalPort 虚拟端口(1-based)转换为物理业务端口
+// 单端口虚拟设备允许省略端口(0)
+func (v *VirtualDevice) PhysicalPort(virtualPort int) (int, error) {
+	if virtualPort == 0 && len(v.Ports) == 1 {
+		return v.Ports[0], nil
+	}
+	if virtualPort < 1 || virtualPort > len(v.Ports) {
+		return 0, fmt.Errorf("虚拟设备 %s 端口 %d 超出范围(1-%d)", v.VirtualID, virtualPort, len(v.Ports))
+	}
+	return v.Ports[virtualPort-1], nil
+}
+
+// VirtualPort 物理业务端口转换为虚拟端口(1-based)
+func (v *VirtualDevice) VirtualPort(physicalPort int) (int, bool) {
+	for i, p := range v.Ports {
+		if p == physicalPort {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// SetVirtualDevices 将物理设备的虚拟子设备挂载到其设备组（替换该设备原有的虚拟子设备，nil表示移除）
+// 设备未在线时返回false，待设备注册后再挂载
+func (m *TCPManager) SetVirtualDevices(parentID string, virtuals []*VirtualDevice) bool {
+	iccidInterface, exists := m.deviceIndex.Load(parentID)
+	if !exists {
+		return false
+	}
+	groupInterface, exists := m.deviceGroups.Load(iccidInterface.(string))
+	if !exists {
+		return false
+	}
+
+	group := groupInterface.(*DeviceGroup)
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	for id, v := range group.VirtualDevices {
+		if v.ParentID == parentID {
+			delete(group.VirtualDevices, id)
+		}
+	}
+	if len(virtuals) == 0 {
+		return true
+	}
+	if group.VirtualDevices == nil {
+		group.VirtualDevices = make(map[string]*VirtualDevice, len(virtuals))
+	}
+	for _, v := range virtuals {
+		group.VirtualDevices[v.VirtualID] = v
+	}
+	group.notePeak()
+	return true
+}
+
+// GetVirtualDevices 获取设备组中挂载在物理设备下的虚拟子设备（按ID排序）
+func (m *TCPManager) GetVirtualDevices(parentID string) []*VirtualDevice {
+	iccidInterface, exists := m.deviceIndex.Load(parentID)
+	if !exists {
+		return nil
+	}
+	groupInterface, exists := m.deviceGroups.Load(iccidInterface.(string))
+	if !exists {
+		return nil
+	}
+
+	group := groupInterface.(*DeviceGroup)
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	var list []*VirtualDevice
+	for _, v := range group.VirtualDevices {
+		if v.ParentID == parentID {
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].VirtualID < list[j].VirtualID })
+	return list
+}
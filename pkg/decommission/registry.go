@@ -0,0 +1,401 @@
+// Package decommission 设备停用：停用时归档设备最后状态快照与端口累计电量，并将设备加入黑名单，
+// 此后该物理ID的注册请求以 DECOMMISSIONED 拒绝并告警；重新启用（recommission）解除黑名单，归档记录保留可查。
+// 已停用设备不计入网关汇总与合规审计。
+package decommission
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFilePath             = "./data/decommissioned_devices.json"
+	defaultRedisKey             = "iot:decommissioned_devices"
+	defaultRejectNotifyInterval = time.Hour
+)
+
+// ErrorCodeDecommissioned 已停用设备注册被拒绝时的原因码
+const ErrorCodeDecommissioned = "DECOMMISSIONED"
+
+// 归档状态
+const (
+	StatusDecommissioned = "decommissioned" // 已停用，注册被拒绝
+	StatusRecommissioned = "recommissioned" // 已重新启用，归档保留
+)
+
+// 事件类型
+const (
+	EventDecommissioned       = "decommissioned"
+	EventRecommissioned       = "recommissioned"
+	EventRegistrationRejected = "registration_rejected"
+)
+
+var (
+	// ErrAlreadyDecommissioned 设备已停用
+	ErrAlreadyDecommissioned = errors.New("设备已停用")
+	// ErrNotDecommissioned 设备未停用
+	ErrNotDecommissioned = errors.New("设备未停用")
+)
+
+// Recommission 重新启用信息
+type Recommission struct {
+	Reason   string    `json:"reason"`
+	Operator string    `json:"operator"`
+	At       time.Time `json:"at"`
+}
+
+// Record 设备停用归档记录
+type Record struct {
+	DeviceID         string                 `json:"deviceId"`
+	Status           string                 `json:"status"`
+	Reason           string                 `json:"reason"`
+	Operator         string                 `json:"operator"`
+	CorrelationID    string                 `json:"correlationId,omitempty"`
+	DecommissionedAt time.Time              `json:"decommissionedAt"`
+	WasOnline        bool                   `json:"wasOnline"`        // 停用时是否在线（在线设备已断开）
+	Snapshot         map[string]interface{} `json:"snapshot"`         // 停用前最后的设备状态快照
+	Energy           []energy.PortCounter   `json:"energy,omitempty"` // 端口累计电量（生命周期计数）
+
+	// 停用后被拒绝的注册（计数在内存中累加，随下一次停用/启用变更持久化）
+	RejectedRegistrations int64      `json:"rejectedRegistrations"`
+	LastRejectedAt        *time.Time `json:"lastRejectedAt,omitempty"`
+	LastRejectedAddr      string     `json:"lastRejectedAddr,omitempty"`
+
+	Recommission *Recommission `json:"recommission,omitempty"`
+
+	lastNotifiedAt time.Time
+}
+
+// Blocked 是否仍在黑名单中
+func (r *Record) Blocked() bool {
+	return r.Status == StatusDecommissioned
+}
+
+func (r *Record) snapshot() Record {
+	cp := *r
+	cp.Energy = append([]energy.PortCounter(nil), r.Energy...)
+	if r.LastRejectedAt != nil {
+		at := *r.LastRejectedAt
+		cp.LastRejectedAt = &at
+	}
+	if r.Recommission != nil {
+		rc := *r.Recommission
+		cp.Recommission = &rc
+	}
+	return cp
+}
+
+// Event 停用相关事件
+type Event struct {
+	Type       string
+	Record     Record
+	RemoteAddr string // registration_rejected 时为发起注册的连接地址
+}
+
+// Handler 停用事件处理函数（通知等外部集成由调用方注册）
+type Handler func(event Event)
+
+// Registry 设备停用归档与注册黑名单
+type Registry struct {
+	mutex                sync.RWMutex
+	records              map[string]*Record
+	store                Store
+	rejectNotifyInterval time.Duration
+	handlers             []Handler
+}
+
+// NewRegistry 创建注册表并从持久化加载归档（store 为 nil 时仅内存保存）；
+// rejectNotifyInterval 为同一设备注册被拒告警的最小间隔，避免设备反复重连时告警风暴
+func NewRegistry(store Store, rejectNotifyInterval time.Duration) (*Registry, error) {
+	if rejectNotifyInterval <= 0 {
+		rejectNotifyInterval = defaultRejectNotifyInterval
+	}
+	r := &Registry{
+		records:              make(map[string]*Record),
+		store:                store,
+		rejectNotifyInterval: rejectNotifyInterval,
+	}
+	if store == nil {
+		return r, nil
+	}
+	records, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		return r, nil
+	}
+	for _, rec := range *records {
+		if rec == nil || rec.DeviceID == "" {
+			continue
+		}
+		r.records[rec.DeviceID] = rec
+	}
+	return r, nil
+}
+
+// RegisterHandler 注册停用事件处理函数
+func (r *Registry) RegisterHandler(handler Handler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers = append(r.handlers, handler)
+}
+
+// HandlerCount 已注册的停用事件处理函数数量
+func (r *Registry) HandlerCount() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.handlers)
+}
+
+// IsDecommissioned 设备是否已停用（在黑名单中）
+func (r *Registry) IsDecommissioned(deviceID string) bool {
+	if r == nil {
+		return false
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	rec, ok := r.records[deviceID]
+	return ok && rec.Blocked()
+}
+
+// Get 获取设备归档记录
+func (r *Registry) Get(deviceID string) (Record, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	rec, ok := r.records[deviceID]
+	if !ok {
+		return Record{}, false
+	}
+	return rec.snapshot(), true
+}
+
+// List 归档记录（按停用时间新→旧），status 为空时返回全部
+func (r *Registry) List(status string) []Record {
+	r.mutex.RLock()
+	list := make([]Record, 0, len(r.records))
+	for _, rec := range r.records {
+		if status == "" || rec.Status == status {
+			list = append(list, rec.snapshot())
+		}
+	}
+	r.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].DecommissionedAt.Equal(list[j].DecommissionedAt) {
+			return list[i].DecommissionedAt.After(list[j].DecommissionedAt)
+		}
+		return list[i].DeviceID < list[j].DeviceID
+	})
+	return list
+}
+
+// Counts 已停用与已重新启用的设备数
+func (r *Registry) Counts() (decommissioned, recommissioned int) {
+	if r == nil {
+		return 0, 0
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, rec := range r.records {
+		if rec.Blocked() {
+			decommissioned++
+		} else {
+			recommissioned++
+		}
+	}
+	return decommissioned, recommissioned
+}
+
+// Decommission 写入归档并加入黑名单；持久化失败时不生效。重新启用过的设备再次停用时覆盖旧归档
+func (r *Registry) Decommission(rec Record) (Record, error) {
+	if rec.DeviceID == "" {
+		return Record{}, fmt.Errorf("设备ID不能为空")
+	}
+	if rec.DecommissionedAt.IsZero() {
+		rec.DecommissionedAt = time.Now()
+	}
+	rec.Status = StatusDecommissioned
+	rec.RejectedRegistrations, rec.LastRejectedAt, rec.LastRejectedAddr = 0, nil, ""
+	rec.Recommission = nil
+
+	r.mutex.Lock()
+	previous, exists := r.records[rec.DeviceID]
+	if exists && previous.Blocked() {
+		r.mutex.Unlock()
+		return Record{}, ErrAlreadyDecommissioned
+	}
+	stored := rec
+	r.records[rec.DeviceID] = &stored
+	if err := r.saveLocked(); err != nil {
+		if exists {
+			r.records[rec.DeviceID] = previous
+		} else {
+			delete(r.records, rec.DeviceID)
+		}
+		r.mutex.Unlock()
+		return Record{}, err
+	}
+	result := stored.snapshot()
+	r.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"deviceID":  rec.DeviceID,
+		"reason":    rec.Reason,
+		"operator":  rec.Operator,
+		"wasOnline": rec.WasOnline,
+	}).Warn("设备已停用并加入注册黑名单")
+	r.emit(Event{Type: EventDecommissioned, Record: result})
+	return result, nil
+}
+
+// Recommission 解除黑名单，归档记录保留并标记重新启用信息
+func (r *Registry) Recommission(deviceID, reason, operator string, now time.Time) (Record, error) {
+	r.mutex.Lock()
+	rec, ok := r.records[deviceID]
+	if !ok || !rec.Blocked() {
+		r.mutex.Unlock()
+		return Record{}, ErrNotDecommissioned
+	}
+	rec.Status = StatusRecommissioned
+	rec.Recommission = &Recommission{Reason: reason, Operator: operator, At: now}
+	if err := r.saveLocked(); err != nil {
+		rec.Status, rec.Recommission = StatusDecommissioned, nil
+		r.mutex.Unlock()
+		return Record{}, err
+	}
+	result := rec.snapshot()
+	r.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"deviceID": deviceID,
+		"reason":   reason,
+		"operator": operator,
+	}).Info("设备已重新启用，解除注册黑名单")
+	r.emit(Event{Type: EventRecommissioned, Record: result})
+	return result, nil
+}
+
+// RejectRegistration 已停用设备发起注册时调用：累加拒绝计数并按最小间隔告警；设备未停用时返回 false
+func (r *Registry) RejectRegistration(deviceID, remoteAddr string, now time.Time) (Record, bool) {
+	r.mutex.Lock()
+	rec, ok := r.records[deviceID]
+	if !ok || !rec.Blocked() {
+		r.mutex.Unlock()
+		return Record{}, false
+	}
+	rec.RejectedRegistrations++
+	at := now
+	rec.LastRejectedAt, rec.LastRejectedAddr = &at, remoteAddr
+	notify := rec.lastNotifiedAt.IsZero() || now.Sub(rec.lastNotifiedAt) >= r.rejectNotifyInterval
+	if notify {
+		rec.lastNotifiedAt = now
+	}
+	result := rec.snapshot()
+	r.mutex.Unlock()
+
+	if notify {
+		r.emit(Event{Type: EventRegistrationRejected, Record: result, RemoteAddr: remoteAddr})
+	}
+	return result, true
+}
+
+func (r *Registry) saveLocked() error {
+	if r.store == nil {
+		return nil
+	}
+	records := make([]*Record, 0, len(r.records))
+	for _, rec := range r.records {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].DeviceID < records[j].DeviceID })
+	if err := r.store.Save(records); err != nil {
+		return fmt.Errorf("持久化设备停用归档失败: %w", err)
+	}
+	return nil
+}
+
+func (r *Registry) emit(event Event) {
+	r.mutex.RLock()
+	handlers := append([]Handler(nil), r.handlers...)
+	r.mutex.RUnlock()
+	for _, h := range handlers {
+		h(event)
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalRegistry atomic.Pointer[Registry]
+
+func init() {
+	r, _ := NewRegistry(nil, 0)
+	globalRegistry.Store(r)
+}
+
+// GetGlobalRegistry 获取全局停用注册表（未按配置初始化时为仅内存的注册表）
+func GetGlobalRegistry() *Registry {
+	return globalRegistry.Load()
+}
+
+// SetGlobalRegistry 设置全局停用注册表
+func SetGlobalRegistry(r *Registry) {
+	globalRegistry.Store(r)
+}
+
+// IsDecommissioned 设备是否已停用（全局注册表）
+func IsDecommissioned(deviceID string) bool {
+	return GetGlobalRegistry().IsDecommissioned(deviceID)
+}
+
+// InitGlobalRegistry 按配置创建全局停用注册表并恢复归档（需在Redis初始化之后、TCP服务器接入设备之前调用）
+func InitGlobalRegistry() error {
+	cfg := config.GetConfig().Decommission
+
+	var store Store
+	switch cfg.Store {
+	case "", StoreTypeFile:
+		path := cfg.FilePath
+		if path == "" {
+			path = defaultFilePath
+		}
+		store = NewFileStore(path)
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("设备停用归档配置为redis存储，但Redis未连接")
+		}
+		key := cfg.RedisKey
+		if key == "" {
+			key = defaultRedisKey
+		}
+		store = NewRedisStore(client, key)
+	case StoreTypeMemory:
+	default:
+		return fmt.Errorf("不支持的设备停用归档存储方式: %s", cfg.Store)
+	}
+
+	r, err := NewRegistry(store, time.Duration(cfg.RejectNotifyIntervalSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+	SetGlobalRegistry(r)
+	decommissioned, recommissioned := r.Counts()
+	logger.WithFields(logrus.Fields{
+		"store":          cfg.Store,
+		"decommissioned": decommissioned,
+		"recommissioned": recommissioned,
+	}).Info("设备停用注册表已初始化")
+	return nil
+}
@@ -0,0 +1,38 @@
+package decommission
+
+import (
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store 停用归档持久化（归档记录即黑名单的唯一数据源）
+type Store = persistence.Store[[]*Record]
+
+// 持久化方式
+const (
+	StoreTypeFile   = persistence.StoreTypeFile
+	StoreTypeRedis  = persistence.StoreTypeRedis
+	StoreTypeMemory = persistence.StoreTypeMemory
+)
+
+// ArchiveRecordType 停用归档的持久化类型（加载时旧版本立即迁移并回写）
+const (
+	ArchiveRecordType    = "decommission_records"
+	archiveRecordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(ArchiveRecordType, archiveRecordVersion)
+}
+
+var storeCodec = persistence.Codec{RecordType: ArchiveRecordType, Label: "设备停用归档", Indent: true}
+
+// NewFileStore 创建文件持久化
+func NewFileStore(path string) *persistence.FileStore[[]*Record] {
+	return persistence.NewFileStore[[]*Record](path, storeCodec)
+}
+
+// NewRedisStore 创建Redis持久化（整体JSON存储在单个键下）
+func NewRedisStore(client *redis.Client, key string) *persistence.RedisStore[[]*Record] {
+	return persistence.NewRedisStore[[]*Record](client, key, storeCodec)
+}
@@ -0,0 +1,295 @@
+// Package devicesession 设备会话持久化：设备注册与心跳时将设备身份写入Redis，
+// 重启后载入为恢复中状态（设备列表以离线+恢复中展示），设备重新接入后移出恢复中状态。
+// Redis不可用时写入失败只计数与记录日志，不影响设备接入。
+// 与只读副本的周期状态快照相互独立：会话在注册时即写入，不依赖 replica.publish，停机前刚注册的设备同样能恢复。
+package devicesession
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKeyPrefix              = "iot:device_session:"
+	defaultTTL                    = 24 * time.Hour
+	defaultHeartbeatWriteInterval = time.Minute
+	defaultQueueSize              = 4096
+	storeTimeout                  = time.Second
+)
+
+// Options 设备会话持久化选项
+type Options struct {
+	Store                  Store
+	TTL                    time.Duration              // 会话过期时间，超过该时长未接入的设备不再恢复
+	HeartbeatWriteInterval time.Duration              // 同一设备心跳写入的最小间隔，注册总是立即写入
+	QueueSize              int                        // 异步写入队列长度
+	Online                 func(deviceID string) bool // 设备当前是否在线（载入时跳过已重新接入的设备），nil 视为全部离线
+}
+
+// Stats 设备会话持久化统计
+type Stats struct {
+	Written    int64 `json:"written"`    // 已写入次数
+	Throttled  int64 `json:"throttled"`  // 心跳写入间隔内跳过的次数
+	Dropped    int64 `json:"dropped"`    // 队列满丢弃的次数
+	Failed     int64 `json:"failed"`     // 写入失败次数（Redis不可用等）
+	Recovering int   `json:"recovering"` // 当前恢复中的设备数
+}
+
+// Registry 设备会话持久化：异步写入会话并维护重启后的恢复中设备
+type Registry struct {
+	opts  Options
+	queue chan Record
+
+	mu         sync.Mutex
+	lastWrite  map[string]time.Time // 设备最近一次入队写入的时间（心跳节流）
+	recovering map[string]Record
+
+	written   atomic.Int64
+	throttled atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+
+	stopCh   chan struct{}
+	done     chan struct{}
+	started  atomic.Bool
+	stopOnce sync.Once
+}
+
+// NewRegistry 创建设备会话持久化（未启动写入前 Observe 仅入队）
+func NewRegistry(opts Options) *Registry {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+	if opts.HeartbeatWriteInterval <= 0 {
+		opts.HeartbeatWriteInterval = defaultHeartbeatWriteInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	return &Registry{
+		opts:       opts,
+		queue:      make(chan Record, opts.QueueSize),
+		lastWrite:  make(map[string]time.Time),
+		recovering: make(map[string]Record),
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Observe 设备注册或心跳：移出恢复中状态，并按心跳节流将会话提交到写入队列（队列满时丢弃，不阻塞设备处理）
+func (r *Registry) Observe(a core.DeviceActivity) {
+	if a.DeviceID == "" || a.ICCID == "" {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	delete(r.recovering, a.DeviceID)
+	if !a.Registered {
+		if last, ok := r.lastWrite[a.DeviceID]; ok && now.Sub(last) < r.opts.HeartbeatWriteInterval {
+			r.mu.Unlock()
+			r.throttled.Add(1)
+			return
+		}
+	}
+	r.lastWrite[a.DeviceID] = now
+	r.mu.Unlock()
+
+	rec := Record{
+		DeviceID:      a.DeviceID,
+		ICCID:         a.ICCID,
+		PhysicalID:    a.PhysicalID,
+		DeviceType:    a.DeviceType,
+		LastHeartbeat: a.LastHeartbeat,
+	}
+	if rec.LastHeartbeat.IsZero() {
+		rec.LastHeartbeat = now
+	}
+	select {
+	case r.queue <- rec:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Recover 载入Redis中的设备会话为恢复中状态（已在线的设备跳过），返回载入数量
+func (r *Registry) Recover(ctx context.Context) (int, error) {
+	if r.opts.Store == nil {
+		return 0, nil
+	}
+	loadCtx, cancel := context.WithTimeout(ctx, 10*storeTimeout)
+	defer cancel()
+	records, err := r.opts.Store.LoadAll(loadCtx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	loaded := 0
+	for _, rec := range records {
+		if r.opts.Online != nil && r.opts.Online(rec.DeviceID) {
+			continue
+		}
+		r.recovering[rec.DeviceID] = rec
+		loaded++
+	}
+	return loaded, err
+}
+
+// Recovering 恢复中的设备（按设备ID排序）：重启前已注册、重启后尚未重新接入且未过期
+func (r *Registry) Recovering() []Record {
+	cutoff := time.Now().Add(-r.opts.TTL)
+	r.mu.Lock()
+	records := make([]Record, 0, len(r.recovering))
+	for id, rec := range r.recovering {
+		if rec.LastHeartbeat.Before(cutoff) {
+			delete(r.recovering, id)
+			continue
+		}
+		records = append(records, rec)
+	}
+	r.mu.Unlock()
+	if r.opts.Online != nil {
+		kept := records[:0]
+		for _, rec := range records {
+			if !r.opts.Online(rec.DeviceID) {
+				kept = append(kept, rec)
+			}
+		}
+		records = kept
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].DeviceID < records[j].DeviceID })
+	return records
+}
+
+// Stats 统计快照
+func (r *Registry) Stats() Stats {
+	r.mu.Lock()
+	recovering := len(r.recovering)
+	r.mu.Unlock()
+	return Stats{
+		Written:    r.written.Load(),
+		Throttled:  r.throttled.Load(),
+		Dropped:    r.dropped.Load(),
+		Failed:     r.failed.Load(),
+		Recovering: recovering,
+	}
+}
+
+// Start 启动后台写入
+func (r *Registry) Start(ctx context.Context) {
+	if !r.started.CompareAndSwap(false, true) {
+		return
+	}
+	go r.run(ctx)
+}
+
+// Stop 写完已入队的会话后停止后台写入
+func (r *Registry) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+		if r.started.Load() {
+			<-r.done
+		}
+	})
+}
+
+func (r *Registry) run(ctx context.Context) {
+	defer close(r.done)
+	for {
+		select {
+		case rec := <-r.queue:
+			r.save(rec)
+		case <-ctx.Done():
+			return
+		case <-r.stopCh:
+			for {
+				select {
+				case rec := <-r.queue:
+					r.save(rec)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Registry) save(rec Record) {
+	if r.opts.Store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := r.opts.Store.Save(ctx, rec, r.opts.TTL); err != nil {
+		// 首次失败与此后每100次失败记录一次，避免Redis宕机时刷屏
+		if n := r.failed.Add(1); n == 1 || n%100 == 0 {
+			logger.WithFields(logrus.Fields{
+				"deviceID": rec.DeviceID,
+				"failed":   n,
+				"error":    err.Error(),
+			}).Warn("设备会话写入Redis失败")
+		}
+		return
+	}
+	r.written.Add(1)
+}
+
+var globalRegistry atomic.Pointer[Registry]
+
+// GetGlobalRegistry 获取全局设备会话持久化（未启用时为nil）
+func GetGlobalRegistry() *Registry {
+	return globalRegistry.Load()
+}
+
+// SetGlobalRegistry 替换全局设备会话持久化（传nil关闭）
+func SetGlobalRegistry(r *Registry) {
+	globalRegistry.Store(r)
+}
+
+// InitGlobalRegistry 按配置创建全局设备会话持久化并载入恢复中设备（需在Redis初始化之后、TCP服务器接入设备之前调用）。
+// Redis未连接时不启用；载入失败时返回错误但保留注册表，此后的写入失败只计数
+func InitGlobalRegistry(ctx context.Context, online func(deviceID string) bool) error {
+	cfg := config.GetConfig().DeviceSessions
+	if !cfg.Enabled {
+		SetGlobalRegistry(nil)
+		return nil
+	}
+	client := infraredis.GetClient()
+	if client == nil {
+		SetGlobalRegistry(nil)
+		return fmt.Errorf("设备会话持久化需要Redis，但Redis未连接，重启后不恢复设备会话")
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	r := NewRegistry(Options{
+		Store:                  NewRedisStore(client, prefix),
+		TTL:                    time.Duration(cfg.TTLSeconds) * time.Second,
+		HeartbeatWriteInterval: time.Duration(cfg.HeartbeatWriteIntervalSec) * time.Second,
+		QueueSize:              cfg.QueueSize,
+		Online:                 online,
+	})
+	loaded, err := r.Recover(ctx)
+	r.Start(ctx)
+	SetGlobalRegistry(r)
+	if err != nil {
+		return fmt.Errorf("载入设备会话失败（已载入%d台）: %w", loaded, err)
+	}
+	logger.WithField("recovering", loaded).Info("设备会话已载入，等待设备重新接入")
+	return nil
+}
+
+// StopGlobalRegistry 写完队列后停止全局设备会话持久化
+func StopGlobalRegistry() {
+	if r := globalRegistry.Load(); r != nil {
+		r.Stop()
+	}
+}
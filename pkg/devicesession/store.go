@@ -0,0 +1,120 @@
+package devicesession
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Record 持久化的设备会话（每台设备一个Redis哈希）
+type Record struct {
+	DeviceID      string    `json:"deviceId"`
+	ICCID         string    `json:"iccid"`
+	PhysicalID    uint32    `json:"physicalId"`
+	DeviceType    uint16    `json:"deviceType"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+}
+
+// Store 设备会话存储
+type Store interface {
+	// Save 写入（覆盖）设备会话并刷新过期时间
+	Save(ctx context.Context, rec Record, ttl time.Duration) error
+	// LoadAll 读取全部未过期的设备会话
+	LoadAll(ctx context.Context) ([]Record, error)
+}
+
+const (
+	fieldICCID         = "iccid"
+	fieldPhysicalID    = "physicalId"
+	fieldLastHeartbeat = "lastHeartbeat"
+	fieldDeviceType    = "deviceType"
+
+	scanBatch = 500
+)
+
+// RedisStore Redis设备会话存储：键为 前缀+设备ID，字段 iccid/physicalId/lastHeartbeat(Unix秒)/deviceType
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore 创建Redis设备会话存储
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) key(deviceID string) string {
+	return s.prefix + deviceID
+}
+
+// Save 写入设备会话（HSET 与 EXPIRE 在同一事务中执行）
+func (s *RedisStore) Save(ctx context.Context, rec Record, ttl time.Duration) error {
+	key := s.key(rec.DeviceID)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			fieldICCID, rec.ICCID,
+			fieldPhysicalID, rec.PhysicalID,
+			fieldLastHeartbeat, rec.LastHeartbeat.Unix(),
+			fieldDeviceType, rec.DeviceType,
+		)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// LoadAll 按前缀扫描读取全部设备会话（字段缺失或无法解析的记录跳过）
+func (s *RedisStore) LoadAll(ctx context.Context) ([]Record, error) {
+	var records []Record
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, s.prefix+"*", scanBatch).Result()
+		if err != nil {
+			return records, fmt.Errorf("扫描设备会话失败: %w", err)
+		}
+		if len(keys) > 0 {
+			cmds := make([]*redis.MapStringStringCmd, len(keys))
+			if _, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i, key := range keys {
+					cmds[i] = pipe.HGetAll(ctx, key)
+				}
+				return nil
+			}); err != nil {
+				return records, fmt.Errorf("读取设备会话失败: %w", err)
+			}
+			for i, cmd := range cmds {
+				if rec, ok := parseRecord(strings.TrimPrefix(keys[i], s.prefix), cmd.Val()); ok {
+					records = append(records, rec)
+				}
+			}
+		}
+		if next == 0 {
+			return records, nil
+		}
+		cursor = next
+	}
+}
+
+// parseRecord 哈希字段还原为设备会话（键在扫描与读取之间过期时字段为空）
+func parseRecord(deviceID string, fields map[string]string) (Record, bool) {
+	iccid := fields[fieldICCID]
+	if deviceID == "" || iccid == "" {
+		return Record{}, false
+	}
+	physicalID, err := strconv.ParseUint(fields[fieldPhysicalID], 10, 32)
+	if err != nil {
+		return Record{}, false
+	}
+	rec := Record{DeviceID: deviceID, ICCID: iccid, PhysicalID: uint32(physicalID)}
+	if deviceType, err := strconv.ParseUint(fields[fieldDeviceType], 10, 16); err == nil {
+		rec.DeviceType = uint16(deviceType)
+	}
+	if ts, err := strconv.ParseInt(fields[fieldLastHeartbeat], 10, 64); err == nil && ts > 0 {
+		rec.LastHeartbeat = time.Unix(ts, 0)
+	}
+	return rec, true
+}
@@ -0,0 +1,240 @@
+package dialect
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// AP3000标准载荷（多字节字段小端序）：
+//   注册 0x20：固件版本(2) + 端口数(1) + 虚拟ID(1) + 设备类型(1) + 工作模式(1) + [电源板版本(2)]
+//   心跳 0x21：电压(2) + 端口数(1) + 端口状态(n) + [信号强度(1) + 环境温度(1)]
+//   充电控制应答 0x82：状态(1) + 订单编号(16) + 端口号(1) + 待充端口(2)，或简短应答 端口号(1) + 状态(1)
+//   结算 0x03：时长(2) + 最大功率(2) + 耗电量(2) + 端口号(1) + 启动方式(1) + 卡号(4) + 停止原因(1) + 订单编号(16) +
+//             第二最大功率(2) + 时间戳(4) + 占位时长(2)
+
+const (
+	registerMinLen        = 6
+	registerFullLen       = 8
+	chargeControlRespLen  = 20
+	chargeControlShortLen = 2
+	settlementLen         = 37
+)
+
+func init() {
+	RegisterDialect(&Dialect{Name: AP3000, Description: "AP3000标准协议"})
+	mustRegisterCodec(AP3000, constants.CmdDeviceRegister, ap3000Register{})
+	mustRegisterCodec(AP3000, constants.CmdDeviceHeart, ap3000Heartbeat{})
+	mustRegisterCodec(AP3000, constants.CmdChargeControl, ap3000ChargeControlResponse{})
+	mustRegisterCodec(AP3000, constants.CmdSettlement, ap3000Settlement{})
+}
+
+func mustRegisterCodec(name Name, command uint8, codec Codec) {
+	if err := RegisterCodec(name, command, codec); err != nil {
+		panic(err)
+	}
+}
+
+type ap3000Register struct{}
+
+func (ap3000Register) Decode(p []byte) (interface{}, error) {
+	if len(p) != registerMinLen && len(p) != registerFullLen {
+		return nil, fmt.Errorf("注册载荷长度 %d 无效，应为%d或%d字节", len(p), registerMinLen, registerFullLen)
+	}
+	r := Register{
+		FirmwareVersion: binary.LittleEndian.Uint16(p[0:2]),
+		PortCount:       p[2],
+		VirtualID:       p[3],
+		DeviceType:      p[4],
+		WorkMode:        p[5],
+	}
+	if len(p) == registerFullLen {
+		r.PowerBoardVersion = binary.LittleEndian.Uint16(p[6:8])
+		r.HasPowerBoard = true
+	}
+	return r, validateRegister(r)
+}
+
+func (ap3000Register) Encode(v interface{}) ([]byte, error) {
+	r, err := asRegister(v)
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, registerMinLen, registerFullLen)
+	binary.LittleEndian.PutUint16(p[0:2], r.FirmwareVersion)
+	p[2], p[3], p[4], p[5] = r.PortCount, r.VirtualID, r.DeviceType, r.WorkMode
+	if r.HasPowerBoard {
+		p = binary.LittleEndian.AppendUint16(p, r.PowerBoardVersion)
+	}
+	return p, nil
+}
+
+type ap3000Heartbeat struct{}
+
+func (ap3000Heartbeat) Decode(p []byte) (interface{}, error) {
+	if len(p) < 3 {
+		return nil, fmt.Errorf("心跳载荷过短: %d字节", len(p))
+	}
+	n := int(p[2])
+	h := Heartbeat{Voltage: binary.LittleEndian.Uint16(p[0:2])}
+	switch len(p) {
+	case 3 + n:
+	case 5 + n:
+		h.SignalStrength, h.Temperature, h.HasEnvironment = p[3+n], p[4+n], true
+	default:
+		return nil, fmt.Errorf("心跳载荷长度 %d 与端口数 %d 不符", len(p), n)
+	}
+	h.PortStatuses = append([]uint8{}, p[3:3+n]...)
+	return h, nil
+}
+
+func (ap3000Heartbeat) Encode(v interface{}) ([]byte, error) {
+	h, err := asHeartbeat(v)
+	if err != nil {
+		return nil, err
+	}
+	p := binary.LittleEndian.AppendUint16(make([]byte, 0, 5+len(h.PortStatuses)), h.Voltage)
+	p = append(p, uint8(len(h.PortStatuses)))
+	p = append(p, h.PortStatuses...)
+	if h.HasEnvironment {
+		p = append(p, h.SignalStrength, h.Temperature)
+	}
+	return p, nil
+}
+
+type ap3000ChargeControlResponse struct{}
+
+func (ap3000ChargeControlResponse) Decode(p []byte) (interface{}, error) {
+	switch len(p) {
+	case chargeControlShortLen:
+		return ChargeControlResponse{Port: p[0], Status: p[1], Short: true}, nil
+	case chargeControlRespLen:
+		return ChargeControlResponse{
+			Status:       p[0],
+			OrderNo:      orderNo(p[1:17]),
+			Port:         p[17],
+			WaitingPorts: binary.LittleEndian.Uint16(p[18:20]),
+		}, nil
+	}
+	return nil, fmt.Errorf("充电控制应答载荷长度 %d 无效，应为2或20字节", len(p))
+}
+
+func (ap3000ChargeControlResponse) Encode(v interface{}) ([]byte, error) {
+	r, err := asChargeControlResponse(v)
+	if err != nil {
+		return nil, err
+	}
+	if r.Short {
+		return []byte{r.Port, r.Status}, nil
+	}
+	p := make([]byte, chargeControlRespLen)
+	p[0] = r.Status
+	if err := putOrderNo(p[1:17], r.OrderNo); err != nil {
+		return nil, err
+	}
+	p[17] = r.Port
+	binary.LittleEndian.PutUint16(p[18:20], r.WaitingPorts)
+	return p, nil
+}
+
+type ap3000Settlement struct{}
+
+func (ap3000Settlement) Decode(p []byte) (interface{}, error) {
+	if len(p) != settlementLen {
+		return nil, fmt.Errorf("结算载荷长度 %d 无效，应为%d字节", len(p), settlementLen)
+	}
+	return Settlement{
+		Duration:       binary.LittleEndian.Uint16(p[0:2]),
+		MaxPower:       binary.LittleEndian.Uint16(p[2:4]),
+		Energy:         binary.LittleEndian.Uint16(p[4:6]),
+		Port:           p[6],
+		StartMode:      p[7],
+		CardID:         binary.LittleEndian.Uint32(p[8:12]),
+		StopReason:     p[12],
+		OrderNo:        orderNo(p[13:29]),
+		SecondMaxPower: binary.LittleEndian.Uint16(p[29:31]),
+		Timestamp:      binary.LittleEndian.Uint32(p[31:35]),
+		OccupyDuration: binary.LittleEndian.Uint16(p[35:37]),
+	}, nil
+}
+
+func (ap3000Settlement) Encode(v interface{}) ([]byte, error) {
+	s, err := asSettlement(v)
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, settlementLen)
+	binary.LittleEndian.PutUint16(p[0:2], s.Duration)
+	binary.LittleEndian.PutUint16(p[2:4], s.MaxPower)
+	binary.LittleEndian.PutUint16(p[4:6], s.Energy)
+	p[6], p[7] = s.Port, s.StartMode
+	binary.LittleEndian.PutUint32(p[8:12], s.CardID)
+	p[12] = s.StopReason
+	if err := putOrderNo(p[13:29], s.OrderNo); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint16(p[29:31], s.SecondMaxPower)
+	binary.LittleEndian.PutUint32(p[31:35], s.Timestamp)
+	binary.LittleEndian.PutUint16(p[35:37], s.OccupyDuration)
+	return p, nil
+}
+
+// validateRegister 注册字段取值范围（用于方言特征识别，与注册处理器的校验一致）
+func validateRegister(r Register) error {
+	if r.FirmwareVersion == 0 || r.FirmwareVersion > 9999 {
+		return fmt.Errorf("固件版本 %d 超出范围", r.FirmwareVersion)
+	}
+	if r.PortCount == 0 || r.PortCount > 32 {
+		return fmt.Errorf("端口数 %d 超出范围", r.PortCount)
+	}
+	switch r.DeviceType {
+	case 0x01, 0x02, 0x04:
+	default:
+		return fmt.Errorf("设备类型 0x%02X 无效", r.DeviceType)
+	}
+	if r.WorkMode > 3 {
+		return fmt.Errorf("工作模式 %d 超出范围", r.WorkMode)
+	}
+	return nil
+}
+
+func asRegister(v interface{}) (Register, error) {
+	switch r := v.(type) {
+	case Register:
+		return r, nil
+	case *Register:
+		return *r, nil
+	}
+	return Register{}, typeError("Register", v)
+}
+
+func asHeartbeat(v interface{}) (Heartbeat, error) {
+	switch h := v.(type) {
+	case Heartbeat:
+		return h, nil
+	case *Heartbeat:
+		return *h, nil
+	}
+	return Heartbeat{}, typeError("Heartbeat", v)
+}
+
+func asChargeControlResponse(v interface{}) (ChargeControlResponse, error) {
+	switch r := v.(type) {
+	case ChargeControlResponse:
+		return r, nil
+	case *ChargeControlResponse:
+		return *r, nil
+	}
+	return ChargeControlResponse{}, typeError("ChargeControlResponse", v)
+}
+
+func asSettlement(v interface{}) (Settlement, error) {
+	switch s := v.(type) {
+	case Settlement:
+		return s, nil
+	case *Settlement:
+		return *s, nil
+	}
+	return Settlement{}, typeError("Settlement", v)
+}
@@ -0,0 +1,218 @@
+// Package dialect DNY协议方言：兼容DNY帧格式但字段排列不同的厂商设备的一致性适配层。
+//
+// 网关内部只使用AP3000标准格式（处理器、一致性检查、命令跟踪均按标准格式解析），
+// 方言设备的上行帧在解码器中按命令查找方言编解码器，解码为共用的类型化结构后重新编码为标准格式；
+// 下行帧在发送前按方言调整消息ID字节序。未注册编解码器的命令只调整消息ID，载荷原样透传。
+//
+// 每个连接的方言在首个注册帧(0x20)按报文特征识别，或由监听器配置固定；设备注册完成后锁定，不再切换。
+package dialect
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// Name 方言名称
+type Name string
+
+// 内置方言
+const (
+	AP3000  Name = "ap3000"   // 标准AP3000协议（网关内部格式）
+	VendorB Name = "vendor_b" // 第二厂商：注册字段顺序不同、消息ID大端序、结算停止原因枚举不同
+)
+
+// DNY帧内各字段偏移
+const (
+	offsetMessageID = 9
+	offsetPayload   = 12
+	frameOverhead   = offsetPayload + constants.ChecksumSize
+)
+
+var (
+	// ErrUnknownDialect 未注册的方言
+	ErrUnknownDialect = errors.New("未知的协议方言")
+	// ErrLocked 设备已完成注册，方言不可再切换
+	ErrLocked = errors.New("设备已完成注册，协议方言不可切换")
+)
+
+// Codec 方言编解码器：方言载荷与共用类型化结构（Register/Heartbeat/ChargeControlResponse/Settlement）互转
+type Codec interface {
+	Decode(payload []byte) (interface{}, error)
+	Encode(v interface{}) ([]byte, error)
+}
+
+// Dialect 方言描述
+type Dialect struct {
+	Name               Name   `json:"name"`
+	Description        string `json:"description"`
+	MessageIDBigEndian bool   `json:"messageIdBigEndian"` // 消息ID按大端序传输
+	Commands           []byte `json:"commands"`           // 注册了编解码器的命令
+
+	codecs map[uint8]Codec
+}
+
+var (
+	registryMu sync.RWMutex
+	dialects   = map[Name]*Dialect{}
+)
+
+// RegisterDialect 注册方言（同名覆盖）
+func RegisterDialect(d *Dialect) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if d.codecs == nil {
+		d.codecs = make(map[uint8]Codec)
+	}
+	dialects[d.Name] = d
+}
+
+// RegisterCodec 为方言的某个命令注册编解码器
+func RegisterCodec(name Name, command uint8, codec Codec) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	d, ok := dialects[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownDialect, name)
+	}
+	if _, exists := d.codecs[command]; !exists {
+		d.Commands = append(d.Commands, command)
+		sort.Slice(d.Commands, func(i, j int) bool { return d.Commands[i] < d.Commands[j] })
+	}
+	d.codecs[command] = codec
+	return nil
+}
+
+// Lookup 按名称查找方言
+func Lookup(name Name) (*Dialect, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// LookupCodec 查找方言某个命令的编解码器
+func LookupCodec(name Name, command uint8) (Codec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	d, ok := dialects[name]
+	if !ok {
+		return nil, false
+	}
+	codec, ok := d.codecs[command]
+	return codec, ok
+}
+
+// All 已注册的方言（按名称排序）
+func All() []Dialect {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]Dialect, 0, len(dialects))
+	for _, d := range dialects {
+		out = append(out, Dialect{Name: d.Name, Description: d.Description, MessageIDBigEndian: d.MessageIDBigEndian,
+			Commands: append([]byte(nil), d.Commands...)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Parse 校验方言名称（空字符串返回空名称，表示未配置）
+func Parse(s string) (Name, error) {
+	if s == "" {
+		return "", nil
+	}
+	if _, ok := Lookup(Name(s)); !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownDialect, s)
+	}
+	return Name(s), nil
+}
+
+// Decode 将方言载荷解码为类型化结构
+func Decode(name Name, command uint8, payload []byte) (interface{}, error) {
+	codec, ok := LookupCodec(name, command)
+	if !ok {
+		return nil, fmt.Errorf("方言 %s 未注册命令 %s 的编解码器", name, dny_protocol.CommandLabel(command))
+	}
+	return codec.Decode(payload)
+}
+
+// Encode 将类型化结构编码为方言载荷
+func Encode(name Name, command uint8, v interface{}) ([]byte, error) {
+	codec, ok := LookupCodec(name, command)
+	if !ok {
+		return nil, fmt.Errorf("方言 %s 未注册命令 %s 的编解码器", name, dny_protocol.CommandLabel(command))
+	}
+	return codec.Encode(v)
+}
+
+// WireMessageID 帧中消息ID字段的两个字节按小端序读出的值在该方言下对应的消息ID
+func WireMessageID(name Name, wire uint16) uint16 {
+	if d, ok := Lookup(name); ok && d.MessageIDBigEndian {
+		return wire>>8 | wire<<8
+	}
+	return wire
+}
+
+// ToCanonical 将方言上行帧的消息ID与载荷转换为标准格式：wireMessageID 为按小端序读出的消息ID字段
+func ToCanonical(name Name, command uint8, wireMessageID uint16, payload []byte) (uint16, []byte, error) {
+	messageID := WireMessageID(name, wireMessageID)
+	if name == AP3000 {
+		return messageID, payload, nil
+	}
+	codec, ok := LookupCodec(name, command)
+	if !ok {
+		return messageID, payload, nil
+	}
+	v, err := codec.Decode(payload)
+	if err != nil {
+		return messageID, nil, fmt.Errorf("方言 %s 解码 %s 失败: %w", name, dny_protocol.CommandLabel(command), err)
+	}
+	canonical, err := Encode(AP3000, command, v)
+	if err != nil {
+		return messageID, nil, err
+	}
+	return messageID, canonical, nil
+}
+
+// FromCanonical 将网关构建的标准下行帧转换为方言格式（调整消息ID字节序并重算校验）；无需转换时返回原帧
+func FromCanonical(name Name, frame []byte) []byte {
+	d, ok := Lookup(name)
+	if !ok || !d.MessageIDBigEndian || len(frame) < frameOverhead || string(frame[:len(constants.ProtocolHeader)]) != constants.ProtocolHeader {
+		return frame
+	}
+	out := make([]byte, len(frame))
+	copy(out, frame)
+	messageID := binary.LittleEndian.Uint16(frame[offsetMessageID:])
+	binary.BigEndian.PutUint16(out[offsetMessageID:], messageID)
+	checksum := dny_protocol.Checksum(out[:len(out)-constants.ChecksumSize])
+	binary.LittleEndian.PutUint16(out[len(out)-constants.ChecksumSize:], checksum)
+	return out
+}
+
+// BuildFrame 按方言构建帧：v 为类型化结构时经方言编解码器编码，为 []byte 时作为载荷原样使用
+func BuildFrame(name Name, physicalID uint32, messageID uint16, command uint8, v interface{}) ([]byte, error) {
+	payload, ok := v.([]byte)
+	if !ok {
+		var err error
+		if payload, err = Encode(name, command, v); err != nil {
+			return nil, err
+		}
+	}
+	return FromCanonical(name, dny_protocol.BuildFrame(physicalID, messageID, command, payload)), nil
+}
+
+// DetectRegister 按注册帧(0x20)载荷特征识别方言，无法识别时返回false
+func DetectRegister(payload []byte) (Name, bool) {
+	if isVendorBRegister(payload) {
+		return VendorB, true
+	}
+	if _, err := (ap3000Register{}).Decode(payload); err == nil {
+		return AP3000, true
+	}
+	return "", false
+}
@@ -0,0 +1,155 @@
+package dialect
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source 连接方言的来源
+type Source string
+
+const (
+	SourceDefault  Source = "default"  // 未识别，按标准协议处理
+	SourceListener Source = "listener" // 监听器配置固定
+	SourceDetected Source = "detected" // 按注册帧特征识别
+	SourceManual   Source = "manual"   // 注册完成前手动指定
+)
+
+// Binding 连接的方言绑定
+type Binding struct {
+	ConnID   uint64     `json:"connId"`
+	Dialect  Name       `json:"dialect"`
+	Source   Source     `json:"source"`
+	DeviceID string     `json:"deviceId,omitempty"` // 注册完成后记录
+	BoundAt  time.Time  `json:"boundAt"`
+	LockedAt *time.Time `json:"lockedAt,omitempty"` // 注册完成时间，之后不可切换
+}
+
+// Locked 是否已随设备注册完成锁定
+func (b Binding) Locked() bool {
+	return b.LockedAt != nil
+}
+
+// Tracker 各连接的方言绑定
+type Tracker struct {
+	mu    sync.RWMutex
+	conns map[uint64]*Binding
+}
+
+// NewTracker 创建连接方言跟踪器
+func NewTracker() *Tracker {
+	return &Tracker{conns: make(map[uint64]*Binding)}
+}
+
+// Get 连接的方言绑定，未绑定时返回false
+func (t *Tracker) Get(connID uint64) (Binding, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	b, ok := t.conns[connID]
+	if !ok {
+		return Binding{}, false
+	}
+	return *b, true
+}
+
+// Dialect 连接当前使用的方言（未绑定时为标准协议）
+func (t *Tracker) Dialect(connID uint64) Name {
+	if b, ok := t.Get(connID); ok {
+		return b.Dialect
+	}
+	return AP3000
+}
+
+// Bind 绑定或切换连接方言；注册完成后返回 ErrLocked
+func (t *Tracker) Bind(connID uint64, name Name, source Source) error {
+	if _, ok := Lookup(name); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownDialect, name)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok := t.conns[connID]; ok {
+		if b.Locked() {
+			if b.Dialect == name {
+				return nil
+			}
+			return fmt.Errorf("%w（连接%d已按 %s 注册）", ErrLocked, connID, b.Dialect)
+		}
+		// 监听器固定或手动指定的方言不被特征识别覆盖
+		if source == SourceDetected && (b.Source == SourceListener || b.Source == SourceManual) {
+			return nil
+		}
+	}
+	t.conns[connID] = &Binding{ConnID: connID, Dialect: name, Source: source, BoundAt: time.Now()}
+	return nil
+}
+
+// MarkRegistered 设备注册完成：锁定连接方言并返回（未绑定的连接按标准协议锁定）
+func (t *Tracker) MarkRegistered(connID uint64, deviceID string) Name {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.conns[connID]
+	if !ok {
+		b = &Binding{ConnID: connID, Dialect: AP3000, Source: SourceDefault, BoundAt: time.Now()}
+		t.conns[connID] = b
+	}
+	if b.LockedAt == nil {
+		now := time.Now()
+		b.LockedAt = &now
+	}
+	b.DeviceID = deviceID
+	return b.Dialect
+}
+
+// Outbound 将标准下行帧转换为连接方言的格式
+func (t *Tracker) Outbound(connID uint64, frame []byte) []byte {
+	name := t.Dialect(connID)
+	if name == AP3000 {
+		return frame
+	}
+	return FromCanonical(name, frame)
+}
+
+// Release 连接关闭时清除绑定
+func (t *Tracker) Release(connID uint64) {
+	t.mu.Lock()
+	delete(t.conns, connID)
+	t.mu.Unlock()
+}
+
+// Snapshot 全部连接的方言绑定（按连接ID排序）
+func (t *Tracker) Snapshot() []Binding {
+	t.mu.RLock()
+	out := make([]Binding, 0, len(t.conns))
+	for _, b := range t.conns {
+		out = append(out, *b)
+	}
+	t.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ConnID < out[j].ConnID })
+	return out
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalTracker atomic.Pointer[Tracker]
+
+// GetGlobalTracker 获取全局连接方言跟踪器（未初始化时创建）
+func GetGlobalTracker() *Tracker {
+	if t := globalTracker.Load(); t != nil {
+		return t
+	}
+	t := NewTracker()
+	if !globalTracker.CompareAndSwap(nil, t) {
+		return globalTracker.Load()
+	}
+	return t
+}
+
+// SetGlobalTracker 替换全局连接方言跟踪器（测试使用）
+func SetGlobalTracker(t *Tracker) {
+	globalTracker.Store(t)
+}
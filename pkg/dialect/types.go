@@ -0,0 +1,71 @@
+package dialect
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// 各方言共用的类型化结构：字段覆盖标准载荷的全部内容，标准格式与方言格式互转无信息丢失
+
+// orderNoSize 订单编号字段长度
+const orderNoSize = 16
+
+// Register 设备注册(0x20)
+type Register struct {
+	FirmwareVersion   uint16 `json:"firmwareVersion"`
+	PortCount         uint8  `json:"portCount"`
+	VirtualID         uint8  `json:"virtualId"`
+	DeviceType        uint8  `json:"deviceType"`
+	WorkMode          uint8  `json:"workMode"`
+	PowerBoardVersion uint16 `json:"powerBoardVersion"`
+	HasPowerBoard     bool   `json:"hasPowerBoard"` // 携带电源板版本号
+}
+
+// Heartbeat 设备心跳(0x21)
+type Heartbeat struct {
+	Voltage        uint16  `json:"voltage"` // 0.01V
+	PortStatuses   []uint8 `json:"portStatuses"`
+	SignalStrength uint8   `json:"signalStrength"`
+	Temperature    uint8   `json:"temperature"`
+	HasEnvironment bool    `json:"hasEnvironment"` // 携带信号强度与环境温度
+}
+
+// ChargeControlResponse 充电控制应答(0x82)
+type ChargeControlResponse struct {
+	Status       uint8  `json:"status"`
+	OrderNo      string `json:"orderNo"`
+	Port         uint8  `json:"port"`
+	WaitingPorts uint16 `json:"waitingPorts"`
+	Short        bool   `json:"short"` // 仅含端口号与状态的简短应答
+}
+
+// Settlement 结算(0x03)；StopReason 为标准(AP3000)停止原因枚举
+type Settlement struct {
+	Duration       uint16 `json:"duration"` // 秒
+	MaxPower       uint16 `json:"maxPower"`
+	Energy         uint16 `json:"energy"`
+	Port           uint8  `json:"port"`
+	StartMode      uint8  `json:"startMode"` // 在线/离线启动
+	CardID         uint32 `json:"cardId"`
+	StopReason     uint8  `json:"stopReason"`
+	OrderNo        string `json:"orderNo"`
+	SecondMaxPower uint16 `json:"secondMaxPower"`
+	Timestamp      uint32 `json:"timestamp"`
+	OccupyDuration uint16 `json:"occupyDuration"`
+}
+
+func putOrderNo(buf []byte, orderNo string) error {
+	if len(orderNo) > orderNoSize {
+		return fmt.Errorf("订单编号超过%d字节: %q", orderNoSize, orderNo)
+	}
+	copy(buf[:orderNoSize], orderNo)
+	return nil
+}
+
+func orderNo(buf []byte) string {
+	return string(bytes.TrimRight(buf[:orderNoSize], "\x00"))
+}
+
+func typeError(want string, v interface{}) error {
+	return fmt.Errorf("编解码器需要 %s，实际为 %T", want, v)
+}
@@ -0,0 +1,226 @@
+package dialect
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// 第二厂商方言（帧结构与校验同AP3000，消息ID大端序，载荷内其余多字节字段仍为小端序）：
+//   注册 0x20（固定9字节）：特征字节0xE5 + 设备类型(1) + 工作模式(1) + 端口数(1) + 虚拟ID(1) + 固件版本(2) + 电源板版本(2)
+//   心跳 0x21：端口数(1) + 端口状态(n) + 电压(2) + 信号强度(1) + 环境温度(1)
+//   充电控制应答 0x82（固定20字节）：端口号(1) + 状态(1) + 订单编号(16) + 待充端口(2)
+//   结算 0x03（固定37字节）：订单编号(16) + 端口号(1) + 停止原因(1，厂商枚举) + 时长(2) + 耗电量(2) + 最大功率(2) +
+//                          第二最大功率(2) + 启动方式(1) + 卡号(4) + 时间戳(4) + 占位时长(2)
+
+const (
+	vendorBRegisterMagic = 0xE5
+	vendorBRegisterLen   = 9
+)
+
+// 厂商停止原因枚举
+const (
+	VendorBStopFull          = 0x00 // 充满
+	VendorBStopUnplugged     = 0x01 // 拔枪
+	VendorBStopServer        = 0x02 // 平台停止
+	VendorBStopPresetTime    = 0x03 // 到达预设时间
+	VendorBStopPresetEnergy  = 0x04 // 到达预设电量
+	VendorBStopOverload      = 0x05 // 过载
+	VendorBStopOverCurrent   = 0x06 // 过流
+	VendorBStopOverTemp      = 0x07 // 端口过温
+	VendorBStopNoPower       = 0x08 // 无功率
+	VendorBStopCard          = 0x09 // 刷卡停止
+	VendorBStopOverVoltage   = 0x0A // 过压
+	VendorBStopUnderVoltage  = 0x0B // 欠压
+	VendorBStopLowPower      = 0x0C // 功率过小
+	VendorBStopMaxDuration   = 0x0D // 达到最大充电时间
+	VendorBStopServerForce   = 0x0E // 平台强制停止
+	VendorBStopUnknownReason = 0xFF // 厂商未细分的其他原因
+)
+
+// vendorBStopReasons 厂商停止原因 → 标准停止原因；未列出的取值映射为0（未知）
+var vendorBStopReasons = map[uint8]uint8{
+	VendorBStopFull:         dny_protocol.StopReasonFull,
+	VendorBStopUnplugged:    dny_protocol.StopReasonUnplugged,
+	VendorBStopServer:       dny_protocol.StopReasonServerStop,
+	VendorBStopPresetTime:   dny_protocol.StopReasonPresetTime,
+	VendorBStopPresetEnergy: dny_protocol.StopReasonPresetEnergy,
+	VendorBStopOverload:     dny_protocol.StopReasonOverload,
+	VendorBStopOverCurrent:  dny_protocol.StopReasonOverCurrent,
+	VendorBStopOverTemp:     dny_protocol.StopReasonPortOverTemp,
+	VendorBStopNoPower:      dny_protocol.StopReasonNoPower,
+	VendorBStopCard:         dny_protocol.StopReasonCardStop,
+	VendorBStopOverVoltage:  dny_protocol.StopReasonOverVoltage,
+	VendorBStopUnderVoltage: dny_protocol.StopReasonUnderVoltage,
+	VendorBStopLowPower:     dny_protocol.StopReasonLowPower,
+	VendorBStopMaxDuration:  dny_protocol.StopReasonMaxDuration,
+	VendorBStopServerForce:  dny_protocol.StopReasonServerForceStop,
+}
+
+// standardToVendorBStop 标准停止原因 → 厂商停止原因（编码方向，模拟器使用）
+var standardToVendorBStop = func() map[uint8]uint8 {
+	m := make(map[uint8]uint8, len(vendorBStopReasons))
+	for vendor, standard := range vendorBStopReasons {
+		m[standard] = vendor
+	}
+	return m
+}()
+
+// VendorBStopReason 厂商停止原因对应的标准停止原因，无对应取值时返回false
+func VendorBStopReason(vendor uint8) (uint8, bool) {
+	standard, ok := vendorBStopReasons[vendor]
+	return standard, ok
+}
+
+func init() {
+	RegisterDialect(&Dialect{Name: VendorB, Description: "第二厂商DNY兼容协议（注册字段重排、消息ID大端序、独立停止原因枚举）", MessageIDBigEndian: true})
+	mustRegisterCodec(VendorB, constants.CmdDeviceRegister, vendorBRegister{})
+	mustRegisterCodec(VendorB, constants.CmdDeviceHeart, vendorBHeartbeat{})
+	mustRegisterCodec(VendorB, constants.CmdChargeControl, vendorBChargeControlResponse{})
+	mustRegisterCodec(VendorB, constants.CmdSettlement, vendorBSettlement{})
+}
+
+// isVendorBRegister 注册帧特征：固定9字节且以0xE5开头（标准注册载荷为6或8字节），其余字段取值有效
+func isVendorBRegister(p []byte) bool {
+	if len(p) != vendorBRegisterLen || p[0] != vendorBRegisterMagic {
+		return false
+	}
+	_, err := (vendorBRegister{}).Decode(p)
+	return err == nil
+}
+
+type vendorBRegister struct{}
+
+func (vendorBRegister) Decode(p []byte) (interface{}, error) {
+	if len(p) != vendorBRegisterLen {
+		return nil, fmt.Errorf("注册载荷长度 %d 无效，应为%d字节", len(p), vendorBRegisterLen)
+	}
+	if p[0] != vendorBRegisterMagic {
+		return nil, fmt.Errorf("注册载荷特征字节 0x%02X 无效", p[0])
+	}
+	r := Register{
+		DeviceType:        p[1],
+		WorkMode:          p[2],
+		PortCount:         p[3],
+		VirtualID:         p[4],
+		FirmwareVersion:   binary.LittleEndian.Uint16(p[5:7]),
+		PowerBoardVersion: binary.LittleEndian.Uint16(p[7:9]),
+		HasPowerBoard:     true,
+	}
+	return r, validateRegister(r)
+}
+
+func (vendorBRegister) Encode(v interface{}) ([]byte, error) {
+	r, err := asRegister(v)
+	if err != nil {
+		return nil, err
+	}
+	p := []byte{vendorBRegisterMagic, r.DeviceType, r.WorkMode, r.PortCount, r.VirtualID}
+	p = binary.LittleEndian.AppendUint16(p, r.FirmwareVersion)
+	return binary.LittleEndian.AppendUint16(p, r.PowerBoardVersion), nil
+}
+
+type vendorBHeartbeat struct{}
+
+func (vendorBHeartbeat) Decode(p []byte) (interface{}, error) {
+	if len(p) < 1 || len(p) != 5+int(p[0]) {
+		return nil, fmt.Errorf("心跳载荷长度 %d 与端口数不符", len(p))
+	}
+	n := int(p[0])
+	return Heartbeat{
+		PortStatuses:   append([]uint8{}, p[1:1+n]...),
+		Voltage:        binary.LittleEndian.Uint16(p[1+n : 3+n]),
+		SignalStrength: p[3+n],
+		Temperature:    p[4+n],
+		HasEnvironment: true,
+	}, nil
+}
+
+func (vendorBHeartbeat) Encode(v interface{}) ([]byte, error) {
+	h, err := asHeartbeat(v)
+	if err != nil {
+		return nil, err
+	}
+	p := append([]byte{uint8(len(h.PortStatuses))}, h.PortStatuses...)
+	p = binary.LittleEndian.AppendUint16(p, h.Voltage)
+	return append(p, h.SignalStrength, h.Temperature), nil
+}
+
+type vendorBChargeControlResponse struct{}
+
+func (vendorBChargeControlResponse) Decode(p []byte) (interface{}, error) {
+	if len(p) != chargeControlRespLen {
+		return nil, fmt.Errorf("充电控制应答载荷长度 %d 无效，应为%d字节", len(p), chargeControlRespLen)
+	}
+	return ChargeControlResponse{
+		Port:         p[0],
+		Status:       p[1],
+		OrderNo:      orderNo(p[2:18]),
+		WaitingPorts: binary.LittleEndian.Uint16(p[18:20]),
+	}, nil
+}
+
+func (vendorBChargeControlResponse) Encode(v interface{}) ([]byte, error) {
+	r, err := asChargeControlResponse(v)
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, chargeControlRespLen)
+	p[0], p[1] = r.Port, r.Status
+	if err := putOrderNo(p[2:18], r.OrderNo); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint16(p[18:20], r.WaitingPorts)
+	return p, nil
+}
+
+type vendorBSettlement struct{}
+
+func (vendorBSettlement) Decode(p []byte) (interface{}, error) {
+	if len(p) != settlementLen {
+		return nil, fmt.Errorf("结算载荷长度 %d 无效，应为%d字节", len(p), settlementLen)
+	}
+	// 未列出的厂商停止原因映射为0（未知），结算照常入账
+	stopReason := vendorBStopReasons[p[17]]
+	return Settlement{
+		OrderNo:        orderNo(p[0:16]),
+		Port:           p[16],
+		StopReason:     stopReason,
+		Duration:       binary.LittleEndian.Uint16(p[18:20]),
+		Energy:         binary.LittleEndian.Uint16(p[20:22]),
+		MaxPower:       binary.LittleEndian.Uint16(p[22:24]),
+		SecondMaxPower: binary.LittleEndian.Uint16(p[24:26]),
+		StartMode:      p[26],
+		CardID:         binary.LittleEndian.Uint32(p[27:31]),
+		Timestamp:      binary.LittleEndian.Uint32(p[31:35]),
+		OccupyDuration: binary.LittleEndian.Uint16(p[35:37]),
+	}, nil
+}
+
+func (vendorBSettlement) Encode(v interface{}) ([]byte, error) {
+	s, err := asSettlement(v)
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, settlementLen)
+	if err := putOrderNo(p[0:16], s.OrderNo); err != nil {
+		return nil, err
+	}
+	p[16] = s.Port
+	stopReason, ok := standardToVendorBStop[s.StopReason]
+	if !ok {
+		stopReason = VendorBStopUnknownReason
+	}
+	p[17] = stopReason
+	binary.LittleEndian.PutUint16(p[18:20], s.Duration)
+	binary.LittleEndian.PutUint16(p[20:22], s.Energy)
+	binary.LittleEndian.PutUint16(p[22:24], s.MaxPower)
+	binary.LittleEndian.PutUint16(p[24:26], s.SecondMaxPower)
+	p[26] = s.StartMode
+	binary.LittleEndian.PutUint32(p[27:31], s.CardID)
+	binary.LittleEndian.PutUint32(p[31:35], s.Timestamp)
+	binary.LittleEndian.PutUint16(p[35:37], s.OccupyDuration)
+	return p, nil
+}
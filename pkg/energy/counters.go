@@ -0,0 +1,614 @@
+// Package energy 端口累计电量计数器：按设备+端口累计跟踪以来的总电量与当月电量，供维护按电量安排线缆更换。
+// 电量以结算为准；未收到结算的会话按功率心跳积分补记，同一订单结算与积分不重复计入（结算到达时以结算替换积分值）。
+// 每月结转时保存上月电量并清零当月计数，保留最近12个月的历史。
+package energy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFilePath      = "./data/port_energy.json"
+	defaultRedisKey      = "iot:port_energy"
+	defaultGrace         = 30 * time.Minute
+	defaultFlushInterval = 30 * time.Second
+	orderRetention       = 7 * 24 * time.Hour // 已计入订单的保留时长：期间到达的重复结算被忽略，迟到结算修正积分值
+	maxSampleGap         = 10 * time.Minute   // 相邻功率样本间隔超过该值不积分（与计量积分一致）
+	historyMonths        = 12
+	monthLayout          = "2006-01"
+)
+
+// 电量来源
+const (
+	SourceSettlement = "settlement" // 设备结算上报（权威）
+	SourceIntegrated = "integrated" // 功率心跳积分（结算缺失时补记）
+)
+
+// MonthlyEnergy 已结转月份的电量
+type MonthlyEnergy struct {
+	Month    string  `json:"month"` // YYYY-MM
+	EnergyWh float64 `json:"energyWh"`
+	Sessions int     `json:"sessions"`
+}
+
+// PortCounter 端口累计电量（端口为1-based业务端口）
+type PortCounter struct {
+	DeviceID           string          `json:"deviceId"`
+	Port               int             `json:"port"`
+	TotalWh            float64         `json:"totalWh"` // 跟踪以来的累计电量
+	Month              string          `json:"month"`   // 当月 YYYY-MM
+	MonthWh            float64         `json:"monthWh"`
+	MonthSessions      int             `json:"monthSessions"`
+	Sessions           int             `json:"sessions"`
+	SettledSessions    int             `json:"settledSessions"`    // 以结算计入的会话数
+	IntegratedSessions int             `json:"integratedSessions"` // 以功率积分补记的会话数
+	TrackingSince      time.Time       `json:"trackingSince"`
+	LastUpdated        time.Time       `json:"lastUpdated"`
+	History            []MonthlyEnergy `json:"history"` // 最近12个已结转月份，新→旧
+}
+
+// OrderRecord 已计入的订单（用于去重与迟到结算修正）
+type OrderRecord struct {
+	DeviceID string    `json:"deviceId"`
+	Port     int       `json:"port"`
+	Source   string    `json:"source"`
+	EnergyWh float64   `json:"energyWh"`
+	Month    string    `json:"month"` // 计入的月份
+	At       time.Time `json:"at"`
+}
+
+// PendingIntegration 进行中的功率积分会话（结算到达时丢弃，宽限期内未收到结算则补记）
+type PendingIntegration struct {
+	DeviceID   string    `json:"deviceId"`
+	Port       int       `json:"port"`
+	OrderNo    string    `json:"orderNo"`
+	EnergyWh   float64   `json:"energyWh"`
+	LastPowerW float64   `json:"lastPowerW"`
+	LastAt     time.Time `json:"lastAt"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+// PortEnergy 端口电量查询结果
+type PortEnergy struct {
+	PortCounter
+	TotalKWh          float64 `json:"totalKWh"`
+	MonthKWh          float64 `json:"monthKWh"`
+	InProgressOrderNo string  `json:"inProgressOrderNo,omitempty"`
+	InProgressWh      float64 `json:"inProgressWh"` // 进行中会话已积分的电量（尚未计入累计）
+	ThresholdKWh      float64 `json:"thresholdKWh"` // 0表示未设置维护阈值
+	OverThreshold     bool    `json:"overThreshold"`
+}
+
+// Options 计数器选项
+type Options struct {
+	StoreType       string
+	ThresholdKWh    float64       // 维护阈值(kWh)，累计电量达到该值标记 overThreshold，0表示不标记
+	SettlementGrace time.Duration // 积分会话最后一个样本后等待结算的时长，超时按积分补记
+	FlushInterval   time.Duration // 定期巡检（补记、结转）与持久化间隔
+}
+
+type portKey struct {
+	deviceID string
+	port     int
+}
+
+// Counters 端口电量计数器
+type Counters struct {
+	store Store
+	opts  Options
+
+	mu      sync.Mutex
+	ports   map[portKey]*PortCounter
+	orders  map[string]*OrderRecord
+	pending map[portKey]*PendingIntegration
+	month   string // 最近一次结转检查的月份
+	dirty   bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCounters 创建计数器并从持久化记录恢复
+func NewCounters(store Store, opts Options) (*Counters, error) {
+	if opts.SettlementGrace <= 0 {
+		opts.SettlementGrace = defaultGrace
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.StoreType == "" {
+		opts.StoreType = StoreTypeMemory
+	}
+	c := &Counters{
+		store:   store,
+		opts:    opts,
+		ports:   make(map[portKey]*PortCounter),
+		orders:  make(map[string]*OrderRecord),
+		pending: make(map[portKey]*PendingIntegration),
+	}
+	if store == nil {
+		return c, nil
+	}
+	snapshot, err := store.Load()
+	if err != nil {
+		return c, err
+	}
+	if snapshot != nil {
+		for i := range snapshot.Ports {
+			p := snapshot.Ports[i]
+			c.ports[portKey{p.DeviceID, p.Port}] = &p
+		}
+		for orderNo, rec := range snapshot.Orders {
+			rec := rec
+			c.orders[orderNo] = &rec
+		}
+		for i := range snapshot.Pending {
+			p := snapshot.Pending[i]
+			c.pending[portKey{p.DeviceID, p.Port}] = &p
+		}
+	}
+	return c, nil
+}
+
+// Options 计数器选项
+func (c *Counters) Options() Options {
+	return c.opts
+}
+
+// OnSettlement 计入结算电量（port 为1-based业务端口）。同一订单已以结算计入时忽略并返回false；
+// 已以积分补记时以结算值替换积分值；进行中的积分会话直接丢弃
+func (c *Counters) OnSettlement(deviceID string, port int, orderNo string, energyWh float64, at time.Time) bool {
+	if deviceID == "" || port < 1 {
+		return false
+	}
+	key := portKey{deviceID, port}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.pending[key]; ok && p.OrderNo == orderNo {
+		delete(c.pending, key)
+	}
+	if orderNo != "" {
+		if rec, ok := c.orders[orderNo]; ok {
+			if rec.Source == SourceSettlement {
+				return false
+			}
+			counter := c.creditLocked(portKey{rec.DeviceID, rec.Port}, energyWh-rec.EnergyWh, 0, rec.Month, at)
+			counter.IntegratedSessions--
+			counter.SettledSessions++
+			rec.Source, rec.EnergyWh, rec.At = SourceSettlement, energyWh, at
+			return true
+		}
+	}
+
+	month := at.Format(monthLayout)
+	counter := c.creditLocked(key, energyWh, 1, month, at)
+	counter.Sessions++
+	counter.SettledSessions++
+	if orderNo != "" {
+		c.orders[orderNo] = &OrderRecord{DeviceID: deviceID, Port: port, Source: SourceSettlement, EnergyWh: energyWh, Month: month, At: at}
+	}
+	return true
+}
+
+// OnPowerSample 功率心跳样本（port 为1-based业务端口，powerW 单位瓦）按梯形积分累计进行中会话的电量；
+// 无订单号的样本无法与结算对应，不积分
+func (c *Counters) OnPowerSample(deviceID string, port int, orderNo string, powerW float64, at time.Time) {
+	if deviceID == "" || port < 1 || orderNo == "" {
+		return
+	}
+	key := portKey{deviceID, port}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, committed := c.orders[orderNo]; committed {
+		return
+	}
+	p, ok := c.pending[key]
+	if ok && p.OrderNo != orderNo {
+		c.commitPendingLocked(key, p)
+		ok = false
+	}
+	c.dirty = true
+	if !ok {
+		c.pending[key] = &PendingIntegration{DeviceID: deviceID, Port: port, OrderNo: orderNo, LastPowerW: powerW, LastAt: at, StartedAt: at}
+		return
+	}
+	if !at.After(p.LastAt) {
+		return
+	}
+	if gap := at.Sub(p.LastAt); gap <= maxSampleGap {
+		p.EnergyWh += (p.LastPowerW + powerW) / 2 * gap.Hours()
+	}
+	p.LastPowerW, p.LastAt = powerW, at
+}
+
+// Sweep 巡检：宽限期内未收到结算的积分会话按积分补记，跨月时结转全部端口，清理过期的订单记录；返回补记的会话数
+func (c *Counters) Sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	committed := 0
+	for key, p := range c.pending {
+		if now.Sub(p.LastAt) > c.opts.SettlementGrace {
+			c.commitPendingLocked(key, p)
+			committed++
+		}
+	}
+
+	month := now.Format(monthLayout)
+	if month != c.month {
+		rolled := 0
+		for _, counter := range c.ports {
+			if rollLocked(counter, month) {
+				rolled++
+			}
+		}
+		if rolled > 0 {
+			c.dirty = true
+			logger.WithFields(logrus.Fields{"month": month, "ports": rolled}).Info("端口月度电量已结转")
+		}
+		c.month = month
+	}
+
+	retention := orderRetention
+	if retention < 2*c.opts.SettlementGrace {
+		retention = 2 * c.opts.SettlementGrace
+	}
+	for orderNo, rec := range c.orders {
+		if now.Sub(rec.At) > retention {
+			delete(c.orders, orderNo)
+			c.dirty = true
+		}
+	}
+	return committed
+}
+
+// Port 查询端口电量（查询时按当前月份结转）
+func (c *Counters) Port(deviceID string, port int, now time.Time) (PortEnergy, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := portKey{deviceID, port}
+	counter, ok := c.ports[key]
+	if !ok {
+		if p, inProgress := c.pending[key]; inProgress {
+			return c.viewLocked(&PortCounter{DeviceID: deviceID, Port: port, Month: now.Format(monthLayout), TrackingSince: p.StartedAt}, c.opts.ThresholdKWh), true
+		}
+		return PortEnergy{}, false
+	}
+	if rollLocked(counter, now.Format(monthLayout)) {
+		c.dirty = true
+	}
+	return c.viewLocked(counter, c.opts.ThresholdKWh), true
+}
+
+// DeviceCounters 设备全部端口的累计电量（按端口号排序，查询时按当前月份结转），供设备停用归档
+func (c *Counters) DeviceCounters(deviceID string, now time.Time) []PortCounter {
+	month := now.Format(monthLayout)
+	c.mu.Lock()
+	var list []PortCounter
+	for key, counter := range c.ports {
+		if key.deviceID != deviceID {
+			continue
+		}
+		if rollLocked(counter, month) {
+			c.dirty = true
+		}
+		cp := *counter
+		cp.History = append([]MonthlyEnergy(nil), counter.History...)
+		list = append(list, cp)
+	}
+	c.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Port < list[j].Port })
+	return list
+}
+
+// Report 全部端口按累计电量从高到低排序；thresholdKWh<=0 时使用配置的维护阈值
+func (c *Counters) Report(thresholdKWh float64, now time.Time) []PortEnergy {
+	if thresholdKWh <= 0 {
+		thresholdKWh = c.opts.ThresholdKWh
+	}
+	month := now.Format(monthLayout)
+	c.mu.Lock()
+	list := make([]PortEnergy, 0, len(c.ports))
+	for _, counter := range c.ports {
+		if rollLocked(counter, month) {
+			c.dirty = true
+		}
+		list = append(list, c.viewLocked(counter, thresholdKWh))
+	}
+	c.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TotalWh != list[j].TotalWh {
+			return list[i].TotalWh > list[j].TotalWh
+		}
+		if list[i].DeviceID != list[j].DeviceID {
+			return list[i].DeviceID < list[j].DeviceID
+		}
+		return list[i].Port < list[j].Port
+	})
+	return list
+}
+
+// Flush 有变更时持久化当前状态
+func (c *Counters) Flush() error {
+	if c.store == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	snapshot := c.snapshotLocked()
+	c.dirty = false
+	c.mu.Unlock()
+
+	if err := c.store.Save(snapshot); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start 启动定期巡检与持久化（随上下文取消或 Stop 结束）
+func (c *Counters) Start(ctx context.Context) {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.mu.Unlock()
+		return
+	}
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	c.mu.Unlock()
+
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.opts.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				c.Sweep(now)
+				if err := c.Flush(); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("持久化端口电量失败")
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定期任务并持久化最终状态（进行中的积分会话随状态保存，重启后继续等待结算）
+func (c *Counters) Stop() error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel = nil
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return c.Flush()
+}
+
+// creditLocked 向端口计入电量（可为负的修正值）与会话数，按计入月份记入当月或对应的历史月份
+func (c *Counters) creditLocked(key portKey, wh float64, sessions int, month string, at time.Time) *PortCounter {
+	counter, ok := c.ports[key]
+	if !ok {
+		counter = &PortCounter{DeviceID: key.deviceID, Port: key.port, Month: month, TrackingSince: at}
+		c.ports[key] = counter
+	}
+	rollLocked(counter, month)
+	switch {
+	case month == counter.Month:
+		counter.MonthWh = nonNegative(counter.MonthWh + wh)
+		counter.MonthSessions += sessions
+	case month >= monthsBefore(counter.Month, historyMonths):
+		i := sort.Search(len(counter.History), func(i int) bool { return counter.History[i].Month <= month })
+		if i == len(counter.History) || counter.History[i].Month != month {
+			counter.History = append(counter.History, MonthlyEnergy{})
+			copy(counter.History[i+1:], counter.History[i:])
+			counter.History[i] = MonthlyEnergy{Month: month}
+		}
+		counter.History[i].EnergyWh = nonNegative(counter.History[i].EnergyWh + wh)
+		counter.History[i].Sessions += sessions
+	}
+	counter.TotalWh = nonNegative(counter.TotalWh + wh)
+	counter.LastUpdated = at
+	c.dirty = true
+	return counter
+}
+
+// commitPendingLocked 按积分值补记会话（该订单已计入时仅丢弃）
+func (c *Counters) commitPendingLocked(key portKey, p *PendingIntegration) {
+	delete(c.pending, key)
+	c.dirty = true
+	if _, ok := c.orders[p.OrderNo]; ok {
+		return
+	}
+	month := p.LastAt.Format(monthLayout)
+	counter := c.creditLocked(key, p.EnergyWh, 1, month, p.LastAt)
+	counter.Sessions++
+	counter.IntegratedSessions++
+	c.orders[p.OrderNo] = &OrderRecord{DeviceID: p.DeviceID, Port: p.Port, Source: SourceIntegrated, EnergyWh: p.EnergyWh, Month: month, At: p.LastAt}
+	logger.WithFields(logrus.Fields{
+		"deviceId": p.DeviceID,
+		"port":     p.Port,
+		"orderNo":  p.OrderNo,
+		"energyWh": p.EnergyWh,
+	}).Info("未收到结算，按功率积分补记端口电量")
+}
+
+func (c *Counters) viewLocked(counter *PortCounter, thresholdKWh float64) PortEnergy {
+	view := PortEnergy{
+		PortCounter:  *counter,
+		TotalKWh:     counter.TotalWh / 1000,
+		MonthKWh:     counter.MonthWh / 1000,
+		ThresholdKWh: thresholdKWh,
+	}
+	view.History = append([]MonthlyEnergy(nil), counter.History...)
+	if p, ok := c.pending[portKey{counter.DeviceID, counter.Port}]; ok {
+		view.InProgressOrderNo, view.InProgressWh = p.OrderNo, p.EnergyWh
+	}
+	view.OverThreshold = thresholdKWh > 0 && view.TotalKWh >= thresholdKWh
+	return view
+}
+
+func (c *Counters) snapshotLocked() Snapshot {
+	snapshot := Snapshot{
+		Ports:   make([]PortCounter, 0, len(c.ports)),
+		Orders:  make(map[string]OrderRecord, len(c.orders)),
+		Pending: make([]PendingIntegration, 0, len(c.pending)),
+		SavedAt: time.Now(),
+	}
+	for _, counter := range c.ports {
+		snapshot.Ports = append(snapshot.Ports, *counter)
+	}
+	sort.Slice(snapshot.Ports, func(i, j int) bool {
+		if snapshot.Ports[i].DeviceID != snapshot.Ports[j].DeviceID {
+			return snapshot.Ports[i].DeviceID < snapshot.Ports[j].DeviceID
+		}
+		return snapshot.Ports[i].Port < snapshot.Ports[j].Port
+	})
+	for orderNo, rec := range c.orders {
+		snapshot.Orders[orderNo] = *rec
+	}
+	for _, p := range c.pending {
+		snapshot.Pending = append(snapshot.Pending, *p)
+	}
+	return snapshot
+}
+
+// rollLocked 端口当月不是 month 时结转：当月电量存入历史并清零，历史只保留最近12个月；返回是否结转
+func rollLocked(counter *PortCounter, month string) bool {
+	if counter.Month == "" {
+		counter.Month = month
+		return true
+	}
+	if month <= counter.Month {
+		return false
+	}
+	counter.History = append([]MonthlyEnergy{{Month: counter.Month, EnergyWh: counter.MonthWh, Sessions: counter.MonthSessions}}, counter.History...)
+	cutoff := monthsBefore(month, historyMonths)
+	for i, h := range counter.History {
+		if h.Month < cutoff {
+			counter.History = counter.History[:i]
+			break
+		}
+	}
+	counter.Month, counter.MonthWh, counter.MonthSessions = month, 0, 0
+	return true
+}
+
+// monthsBefore month 之前 n 个月的月份（YYYY-MM）
+func monthsBefore(month string, n int) string {
+	t, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return month
+	}
+	return t.AddDate(0, -n, 0).Format(monthLayout)
+}
+
+func nonNegative(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalCounters atomic.Pointer[Counters]
+
+func init() {
+	c, _ := NewCounters(nil, Options{})
+	globalCounters.Store(c)
+}
+
+// GetGlobalCounters 获取全局端口电量计数器（未按配置初始化时为仅内存的计数器）
+func GetGlobalCounters() *Counters {
+	return globalCounters.Load()
+}
+
+// SetGlobalCounters 设置全局端口电量计数器
+func SetGlobalCounters(c *Counters) {
+	globalCounters.Store(c)
+}
+
+// InitGlobalCounters 按配置创建全局计数器、恢复持久化状态并启动定期巡检（需在Redis初始化之后调用）
+func InitGlobalCounters(ctx context.Context) error {
+	cfg := config.GetConfig().EnergyCounters
+
+	var store Store
+	storeType := cfg.Store
+	switch storeType {
+	case "", StoreTypeFile:
+		storeType = StoreTypeFile
+		path := cfg.FilePath
+		if path == "" {
+			path = defaultFilePath
+		}
+		store = NewFileStore(path)
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("端口电量计数器配置为redis存储，但Redis未连接")
+		}
+		key := cfg.RedisKey
+		if key == "" {
+			key = defaultRedisKey
+		}
+		store = NewRedisStore(client, key)
+	case StoreTypeMemory:
+	default:
+		return fmt.Errorf("不支持的端口电量存储方式: %s", cfg.Store)
+	}
+
+	c, err := NewCounters(store, Options{
+		StoreType:       storeType,
+		ThresholdKWh:    cfg.ThresholdKWh,
+		SettlementGrace: time.Duration(cfg.SettlementGraceSeconds) * time.Second,
+		FlushInterval:   time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	c.Sweep(time.Now())
+	globalCounters.Store(c)
+	c.Start(ctx)
+
+	c.mu.Lock()
+	ports, pending := len(c.ports), len(c.pending)
+	c.mu.Unlock()
+	logger.WithFields(logrus.Fields{
+		"store":        storeType,
+		"ports":        ports,
+		"pending":      pending,
+		"thresholdKWh": cfg.ThresholdKWh,
+	}).Info("端口电量计数器已初始化")
+	return nil
+}
+
+// StopGlobalCounters 停止定期巡检并持久化最终状态
+func StopGlobalCounters() {
+	if err := GetGlobalCounters().Stop(); err != nil {
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("停机时持久化端口电量失败")
+	}
+}
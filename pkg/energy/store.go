@@ -0,0 +1,48 @@
+package energy
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+)
+
+// 持久化方式
+const (
+	StoreTypeFile   = persistence.StoreTypeFile
+	StoreTypeRedis  = persistence.StoreTypeRedis
+	StoreTypeMemory = persistence.StoreTypeMemory
+)
+
+// SnapshotRecordType 计数器状态的持久化类型（单个快照，加载时旧版本立即迁移并回写）
+const (
+	SnapshotRecordType    = "energy_counters"
+	snapshotRecordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(SnapshotRecordType, snapshotRecordVersion)
+}
+
+// Snapshot 持久化的计数器状态：端口累计、已计入订单台账与未结束的积分会话
+type Snapshot struct {
+	Ports   []PortCounter          `json:"ports"`
+	Orders  map[string]OrderRecord `json:"orders"`
+	Pending []PendingIntegration   `json:"pending"`
+	SavedAt time.Time              `json:"savedAt"`
+}
+
+// Store 端口电量计数器持久化
+type Store = persistence.Store[Snapshot]
+
+var storeCodec = persistence.Codec{RecordType: SnapshotRecordType, Label: "端口电量"}
+
+// NewFileStore 创建文件持久化
+func NewFileStore(path string) *persistence.FileStore[Snapshot] {
+	return persistence.NewFileStore[Snapshot](path, storeCodec)
+}
+
+// NewRedisStore 创建Redis持久化
+func NewRedisStore(client *redis.Client, key string) *persistence.RedisStore[Snapshot] {
+	return persistence.NewRedisStore[Snapshot](client, key, storeCodec)
+}
@@ -49,6 +49,12 @@ const (
 	// Redis缓存相关错误
 	ErrRedisConnectionFailed
 	ErrRedisOperationFailed
+
+	// 设备连接断开（待应答命令被提前终止）
+	ErrDeviceDisconnected
+
+	// 设备以否定应答拒绝命令（固件不认识或不支持）
+	ErrDeviceRejected
 )
 
 // AppError 应用程序自定义错误类型
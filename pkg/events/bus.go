@@ -0,0 +1,288 @@
+package events
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Topic 事件主题
+type Topic string
+
+// 事件主题
+const (
+	TopicDevice   Topic = "device"   // 设备生命周期（上线/离线/注册/重启/SIM卡切换）
+	TopicPort     Topic = "port"     // 端口状态
+	TopicCharging Topic = "charging" // 充电与结算
+	TopicAlarm    Topic = "alarm"    // 告警（设备/端口故障、ICCID冲突、充电失败等）
+	TopicSystem   Topic = "system"   // 网关自身事件
+)
+
+// AllTopics 全部主题
+var AllTopics = []Topic{TopicDevice, TopicPort, TopicCharging, TopicAlarm, TopicSystem}
+
+const (
+	defaultTopicCapacity    = 1000
+	defaultSubscriberBuffer = 256
+)
+
+// Event 总线事件：Seq 为全局递增序号（跨主题），订阅者以此作为回放游标
+type Event struct {
+	Seq      uint64      `json:"seq"`
+	Topic    Topic       `json:"topic"`
+	Type     string      `json:"type"`
+	DeviceID string      `json:"device_id,omitempty"`
+	Time     time.Time   `json:"time"`
+	Payload  interface{} `json:"payload"`
+}
+
+// Options 事件总线选项
+type Options struct {
+	TopicCapacity    int // 每个主题保留的最近事件数
+	SubscriberBuffer int // 订阅者默认队列长度
+}
+
+// topicRing 单个主题的环形缓冲
+type topicRing struct {
+	items      []Event
+	next       int
+	size       int
+	published  uint64
+	evictedSeq uint64 // 最近一次被覆盖的事件序号（游标早于该值说明有事件已无法回放）
+}
+
+func (r *topicRing) push(ev Event) {
+	if r.size == len(r.items) {
+		r.evictedSeq = r.items[r.next].Seq
+	} else {
+		r.size++
+	}
+	r.items[r.next] = ev
+	r.next = (r.next + 1) % len(r.items)
+	r.published++
+}
+
+// each 按旧→新遍历
+func (r *topicRing) each(fn func(Event)) {
+	start := (r.next - r.size + len(r.items)) % len(r.items)
+	for i := 0; i < r.size; i++ {
+		fn(r.items[(start+i)%len(r.items)])
+	}
+}
+
+// Bus 有界内存事件总线：按主题保留最近事件，订阅者可实时跟随或携带游标回放错过的事件；
+// 订阅者处理不过来时丢弃其队列中最旧的事件并计数，发布方永不阻塞
+type Bus struct {
+	mu      sync.RWMutex
+	opts    Options
+	seq     uint64
+	rings   map[Topic]*topicRing
+	subs    map[uint64]*Subscription
+	nextSub uint64
+}
+
+// NewBus 创建事件总线
+func NewBus(opts Options) *Bus {
+	if opts.TopicCapacity <= 0 {
+		opts.TopicCapacity = defaultTopicCapacity
+	}
+	if opts.SubscriberBuffer <= 0 {
+		opts.SubscriberBuffer = defaultSubscriberBuffer
+	}
+	return &Bus{
+		opts:  opts,
+		rings: make(map[Topic]*topicRing),
+		subs:  make(map[uint64]*Subscription),
+	}
+}
+
+// Publish 发布事件并分发给订阅者，返回带序号的事件
+func (b *Bus) Publish(topic Topic, eventType, deviceID string, payload interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	ev := Event{Seq: b.seq, Topic: topic, Type: eventType, DeviceID: deviceID, Time: time.Now(), Payload: payload}
+	ring, ok := b.rings[topic]
+	if !ok {
+		ring = &topicRing{items: make([]Event, b.opts.TopicCapacity)}
+		b.rings[topic] = ring
+	}
+	ring.push(ev)
+	for _, sub := range b.subs {
+		if sub.accepts(ev) {
+			sub.enqueue(ev)
+		}
+	}
+	return ev
+}
+
+// Head 最新事件序号
+func (b *Bus) Head() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.seq
+}
+
+// SubscribeOptions 订阅选项
+type SubscribeOptions struct {
+	Name        string           // 订阅者名称（统计展示）
+	Topics      []Topic          // 为空表示全部主题
+	Buffer      int              // 队列长度，<=0 使用总线默认值
+	Filter      func(Event) bool // 额外过滤条件（回放与实时均生效）
+	Replay      bool             // 是否回放保留的历史事件
+	After       uint64           // 回放序号大于该值的事件（断线重连时传入最后收到的序号）
+	ReplayLimit int              // 回放条数上限（保留最新的），<=0 不限
+}
+
+// Subscribe 订阅事件；回放与注册在同一把锁内完成，回放与实时事件之间不会重复或遗漏
+func (b *Bus) Subscribe(opts SubscribeOptions) *Subscription {
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = b.opts.SubscriberBuffer
+	}
+	sub := &Subscription{
+		bus:    b,
+		name:   opts.Name,
+		filter: opts.Filter,
+		queue:  make([]Event, buffer),
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if len(opts.Topics) > 0 {
+		sub.topics = make(map[Topic]bool, len(opts.Topics))
+		for _, t := range opts.Topics {
+			sub.topics[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if opts.Replay {
+		var replay []Event
+		for topic, ring := range b.rings {
+			if sub.topics != nil && !sub.topics[topic] {
+				continue
+			}
+			if ring.evictedSeq > opts.After {
+				sub.replayGap = true
+			}
+			ring.each(func(ev Event) {
+				if ev.Seq > opts.After && (sub.filter == nil || sub.filter(ev)) {
+					replay = append(replay, ev)
+				}
+			})
+		}
+		sort.Slice(replay, func(i, j int) bool { return replay[i].Seq < replay[j].Seq })
+		if opts.ReplayLimit > 0 && len(replay) > opts.ReplayLimit {
+			replay = replay[len(replay)-opts.ReplayLimit:]
+		}
+		for _, ev := range replay {
+			sub.enqueue(ev)
+		}
+		sub.replayed = uint64(len(replay))
+	}
+	b.nextSub++
+	sub.id = b.nextSub
+	b.subs[sub.id] = sub
+	return sub
+}
+
+func (b *Bus) unsubscribe(id uint64) {
+	b.mu.Lock()
+	delete(b.subs, id)
+	b.mu.Unlock()
+}
+
+// Recent 各主题保留的最近事件（按序号旧→新），limit<=0 返回全部保留事件
+func (b *Bus) Recent(limit int) []Event {
+	b.mu.RLock()
+	var recent []Event
+	for _, ring := range b.rings {
+		ring.each(func(ev Event) { recent = append(recent, ev) })
+	}
+	b.mu.RUnlock()
+	sort.Slice(recent, func(i, j int) bool { return recent[i].Seq < recent[j].Seq })
+	if limit > 0 && len(recent) > limit {
+		recent = recent[len(recent)-limit:]
+	}
+	return recent
+}
+
+// TopicStats 主题统计
+type TopicStats struct {
+	Published  uint64 `json:"published"`
+	Retained   int    `json:"retained"`
+	OldestSeq  uint64 `json:"oldest_seq"`
+	EvictedSeq uint64 `json:"evicted_seq"`
+}
+
+// BusStats 总线统计
+type BusStats struct {
+	HeadSeq          uint64               `json:"head_seq"`
+	TopicCapacity    int                  `json:"topic_capacity"`
+	SubscriberBuffer int                  `json:"subscriber_buffer"`
+	Topics           map[Topic]TopicStats `json:"topics"`
+	Subscribers      []SubscriberStats    `json:"subscribers"`
+}
+
+// Stats 总线与各订阅者统计
+func (b *Bus) Stats() BusStats {
+	b.mu.RLock()
+	stats := BusStats{
+		HeadSeq:          b.seq,
+		TopicCapacity:    b.opts.TopicCapacity,
+		SubscriberBuffer: b.opts.SubscriberBuffer,
+		Topics:           make(map[Topic]TopicStats, len(b.rings)),
+	}
+	for topic, ring := range b.rings {
+		ts := TopicStats{Published: ring.published, Retained: ring.size, EvictedSeq: ring.evictedSeq}
+		if ring.size > 0 {
+			ts.OldestSeq = ring.items[(ring.next-ring.size+len(ring.items))%len(ring.items)].Seq
+		}
+		stats.Topics[topic] = ts
+	}
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	now := time.Now()
+	for _, sub := range subs {
+		stats.Subscribers = append(stats.Subscribers, sub.stats(now))
+	}
+	sort.Slice(stats.Subscribers, func(i, j int) bool { return stats.Subscribers[i].ID < stats.Subscribers[j].ID })
+	return stats
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalBus atomic.Pointer[Bus]
+
+// GetGlobalBus 获取全局事件总线（未初始化时按默认选项创建）
+func GetGlobalBus() *Bus {
+	if b := globalBus.Load(); b != nil {
+		return b
+	}
+	return InitGlobalBus(Options{})
+}
+
+// InitGlobalBus 创建全局事件总线（已存在时直接返回）
+func InitGlobalBus(opts Options) *Bus {
+	if b := globalBus.Load(); b != nil {
+		return b
+	}
+	b := NewBus(opts)
+	if !globalBus.CompareAndSwap(nil, b) {
+		return globalBus.Load()
+	}
+	return b
+}
+
+// SetGlobalBus 替换全局事件总线（测试使用）
+func SetGlobalBus(b *Bus) {
+	globalBus.Store(b)
+}
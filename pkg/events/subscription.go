@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subscription 事件订阅：有界队列，满时丢弃最旧事件
+type Subscription struct {
+	id     uint64
+	name   string
+	bus    *Bus
+	topics map[Topic]bool // nil 表示全部主题
+	filter func(Event) bool
+
+	mu        sync.Mutex
+	queue     []Event // 环形队列
+	head      int
+	size      int
+	delivered uint64 // 进入队列的事件数
+	dropped   uint64 // 因队列已满被丢弃的事件数
+	consumed  uint64
+	lastSeq   uint64 // 最近一次取出的事件序号
+	replayed  uint64
+	replayGap bool // 回放游标早于保留窗口，部分事件已无法回放
+	closed    bool
+
+	ready chan struct{} // 有新事件时通知（容量1）
+	done  chan struct{}
+}
+
+func (s *Subscription) accepts(ev Event) bool {
+	if s.topics != nil && !s.topics[ev.Topic] {
+		return false
+	}
+	return s.filter == nil || s.filter(ev)
+}
+
+// enqueue 入队（调用方持有总线锁，不阻塞）
+func (s *Subscription) enqueue(ev Event) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if s.size == len(s.queue) {
+		s.head = (s.head + 1) % len(s.queue)
+		s.size--
+		s.dropped++
+	}
+	s.queue[(s.head+s.size)%len(s.queue)] = ev
+	s.size++
+	s.delivered++
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// TryNext 非阻塞取出下一条事件
+func (s *Subscription) TryNext() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size == 0 {
+		return Event{}, false
+	}
+	ev := s.queue[s.head]
+	s.queue[s.head] = Event{}
+	s.head = (s.head + 1) % len(s.queue)
+	s.size--
+	s.consumed++
+	s.lastSeq = ev.Seq
+	return ev, true
+}
+
+// Next 阻塞取出下一条事件，ctx 结束或订阅关闭时返回false
+func (s *Subscription) Next(ctx context.Context) (Event, bool) {
+	for {
+		if ev, ok := s.TryNext(); ok {
+			return ev, true
+		}
+		select {
+		case <-s.ready:
+		case <-s.done:
+			return Event{}, false
+		case <-ctx.Done():
+			return Event{}, false
+		}
+	}
+}
+
+// Ready 有新事件时可读（配合 TryNext 在 select 中使用）
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done 订阅关闭后可读
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// ReplayGap 回放游标是否早于保留窗口（部分错过的事件已被覆盖）
+func (s *Subscription) ReplayGap() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replayGap
+}
+
+// Close 取消订阅（可重复调用）
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s.id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+}
+
+// SubscriberStats 订阅者统计：Pending 为积压事件数，PendingAge 为最旧积压事件的等待时长
+type SubscriberStats struct {
+	ID         uint64        `json:"id"`
+	Name       string        `json:"name"`
+	Topics     []string      `json:"topics"`
+	Buffer     int           `json:"buffer"`
+	Pending    int           `json:"pending"`
+	PendingAge time.Duration `json:"pending_age"`
+	Delivered  uint64        `json:"delivered"`
+	Dropped    uint64        `json:"dropped"`
+	Consumed   uint64        `json:"consumed"`
+	Replayed   uint64        `json:"replayed"`
+	ReplayGap  bool          `json:"replay_gap"`
+	LastSeq    uint64        `json:"last_seq"`
+}
+
+// Stats 订阅者统计
+func (s *Subscription) Stats() SubscriberStats {
+	return s.stats(time.Now())
+}
+
+func (s *Subscription) stats(now time.Time) SubscriberStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := SubscriberStats{
+		ID:        s.id,
+		Name:      s.name,
+		Buffer:    len(s.queue),
+		Pending:   s.size,
+		Delivered: s.delivered,
+		Dropped:   s.dropped,
+		Consumed:  s.consumed,
+		Replayed:  s.replayed,
+		ReplayGap: s.replayGap,
+		LastSeq:   s.lastSeq,
+	}
+	if s.size > 0 {
+		st.PendingAge = now.Sub(s.queue[s.head].Time)
+	}
+	for t := range s.topics {
+		st.Topics = append(st.Topics, string(t))
+	}
+	sort.Strings(st.Topics)
+	return st
+}
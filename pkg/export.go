@@ -1,21 +1,18 @@
 package pkg
 
 import (
-	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
 	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
 )
 
 // === 简化的全局变量 ===
 
-// 简化的消息ID计数器
-var messageIDCounter uint64
-
 // 全局统一发送器实例
 var globalUnifiedSender *network.UnifiedSender
 
@@ -89,15 +86,7 @@ var Protocol = struct {
 	SendDNYPacket: func(conn ziface.IConnection, packet []byte) error {
 		return globalUnifiedSender.SendDNYPacket(conn, packet)
 	},
-	GetNextMessageID: func() uint16 {
-		// 简化的消息ID生成器
-		newValue := atomic.AddUint64(&messageIDCounter, 1)
-		messageID := uint16(newValue % 65535)
-		if messageID == 0 {
-			messageID = 1
-		}
-		return messageID
-	},
+	GetNextMessageID: msgid.Next, // 全局序列，重启后从持久化位置跳跃恢复
 }
 
 // === 简化的初始化函数 ===
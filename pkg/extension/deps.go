@@ -0,0 +1,100 @@
+package extension
+
+import (
+	"fmt"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// HandlerDeps 自定义处理器可使用的网关能力，是扩展对外承诺的接口：
+// 扩展只应通过这里取得发送、会话、日志与事件能力，不直接依赖 internal 包或全局单例，
+// 以便网关升级时扩展无需修改。各方法在处理器运行期间调用（工厂函数中只保存 deps，不要求网关已初始化）
+type HandlerDeps interface {
+	// Sender 向设备应答与下发命令
+	Sender() Sender
+	// Sessions 连接会话查询与心跳刷新
+	Sessions() SessionAccessor
+	// Logger 带 component=extension 与命令码字段的日志
+	Logger() *logrus.Entry
+	// Events 发布内部事件（SSE与通知订阅方可见）
+	Events() EventPublisher
+}
+
+// Sender 下行发送
+type Sender interface {
+	// Reply 按上行帧的物理ID与消息ID直接应答（不经命令管理器跟踪）
+	Reply(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte) error
+	// SendCommand 经设备网关下发命令：遵循限流、能力矩阵与低流量模式，由命令管理器跟踪应答与重试
+	SendCommand(deviceID string, command byte, data []byte) error
+}
+
+// SessionAccessor 连接会话访问
+type SessionAccessor interface {
+	// SessionByConn 连接对应的会话（设备尚未注册时 DeviceID 为空）
+	SessionByConn(conn ziface.IConnection) (*core.ConnectionSession, bool)
+	// SessionByDeviceID 设备当前连接的会话
+	SessionByDeviceID(deviceID string) (*core.ConnectionSession, bool)
+	// TouchHeartbeat 刷新设备心跳时间（自定义上报帧视同设备在线时调用）
+	TouchHeartbeat(deviceID string) error
+}
+
+// EventPublisher 内部事件发布
+type EventPublisher interface {
+	Publish(topic events.Topic, eventType, deviceID string, payload interface{}) events.Event
+}
+
+// gatewayDeps 基于网关全局组件的 HandlerDeps 实现
+type gatewayDeps struct {
+	log *logrus.Entry
+}
+
+func newDeps(cmd byte) HandlerDeps {
+	return &gatewayDeps{log: logger.WithFields(logrus.Fields{
+		"component": "extension",
+		"command":   fmt.Sprintf("0x%02X", cmd),
+	})}
+}
+
+func (d *gatewayDeps) Sender() Sender            { return gatewaySender{} }
+func (d *gatewayDeps) Sessions() SessionAccessor { return tcpSessions{} }
+func (d *gatewayDeps) Logger() *logrus.Entry     { return d.log }
+func (d *gatewayDeps) Events() EventPublisher    { return busPublisher{} }
+
+type gatewaySender struct{}
+
+func (gatewaySender) Reply(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte) error {
+	return protocol.SendDNYResponse(conn, physicalID, messageID, command, data)
+}
+
+func (gatewaySender) SendCommand(deviceID string, command byte, data []byte) error {
+	return gateway.GetGlobalDeviceGateway().SendCommandToDevice(deviceID, command, data)
+}
+
+type tcpSessions struct{}
+
+func (tcpSessions) SessionByConn(conn ziface.IConnection) (*core.ConnectionSession, bool) {
+	if conn == nil {
+		return nil, false
+	}
+	return core.GetGlobalTCPManager().GetSessionByConnID(conn.GetConnID())
+}
+
+func (tcpSessions) SessionByDeviceID(deviceID string) (*core.ConnectionSession, bool) {
+	return core.GetGlobalTCPManager().GetSessionByDeviceID(deviceID)
+}
+
+func (tcpSessions) TouchHeartbeat(deviceID string) error {
+	return core.GetGlobalTCPManager().UpdateHeartbeat(deviceID)
+}
+
+type busPublisher struct{}
+
+func (busPublisher) Publish(topic events.Topic, eventType, deviceID string, payload interface{}) events.Event {
+	return events.GetGlobalBus().Publish(topic, eventType, deviceID, payload)
+}
@@ -0,0 +1,60 @@
+// Package example 自定义处理器扩展示例：处理 0x42 报警推送（内置路由未处理该命令）。
+// 启用方式：在 main 中匿名导入本包（import _ "github.com/bujia-iot/iot-zinx/pkg/extension/example"），
+// 包初始化时注册处理器，服务器装配路由时加载。站点扩展可按本包的结构编写，只通过 extension.HandlerDeps 使用网关能力
+package example
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/extension"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// EventTypeAlarm 报警推送发布的事件类型
+const EventTypeAlarm = "device_alarm_pushed"
+
+// alarmAck 报警推送应答：0x00 表示已接收
+var alarmAck = []byte{0x00}
+
+func init() {
+	if err := extension.RegisterCustomRouter(constants.CmdAlarm, NewAlarmRouter); err != nil {
+		panic(err)
+	}
+}
+
+// AlarmRouter 0x42 报警推送处理器：刷新心跳、发布报警事件并应答设备
+type AlarmRouter struct {
+	protocol.SimpleHandlerBase
+	deps extension.HandlerDeps
+}
+
+// NewAlarmRouter 处理器工厂
+func NewAlarmRouter(deps extension.HandlerDeps) ziface.IRouter {
+	return &AlarmRouter{deps: deps}
+}
+
+// Handle 处理报警推送
+func (r *AlarmRouter) Handle(request ziface.IRequest) {
+	frame, err := r.ExtractDecodedFrame(request)
+	if err != nil || frame.FrameType != protocol.FrameTypeStandard {
+		r.deps.Logger().WithError(err).Warn("报警推送帧解码失败")
+		return
+	}
+	_ = r.deps.Sessions().TouchHeartbeat(frame.DeviceID)
+
+	alarm := map[string]interface{}{"payloadHex": hex.EncodeToString(frame.Payload)}
+	if len(frame.Payload) > 0 {
+		alarm["alarmType"] = frame.Payload[0]
+	}
+	r.deps.Events().Publish(events.TopicAlarm, EventTypeAlarm, frame.DeviceID, alarm)
+
+	physicalID := binary.LittleEndian.Uint32(frame.RawPhysicalID)
+	if err := r.deps.Sender().Reply(request.GetConnection(), physicalID, frame.MessageID, constants.CmdAlarm, alarmAck); err != nil {
+		r.deps.Logger().WithFields(logrus.Fields{"deviceId": frame.DeviceID, "error": err.Error()}).Warn("报警推送应答失败")
+	}
+}
@@ -0,0 +1,302 @@
+// Package extension 自定义协议处理器扩展：站点特有的设备命令无需修改 internal/ports 或 zinx_server，
+// 在扩展包中调用 RegisterCustomRouter 注册处理器工厂，并在 main 中匿名导入该扩展包即可。
+// 处理器在服务器装配路由时创建，与内置处理器一样经 handlerguard 包装（panic恢复、设备隔离与按命令计数），
+// 另按处理器统计帧数与异常次数（GET /api/v1/admin/custom-routers 与 /metrics）。
+// 与内置命令码冲突的处理器默认不加载，须在配置 extensions.overrideBuiltin 中显式列出命令码才会覆盖内置处理器。
+package extension
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsCollectorName /metrics 中自定义处理器指标的注册名
+const MetricsCollectorName = "custom_routers"
+
+// 自定义处理器装配状态
+const (
+	StatusPending  = "pending"  // 已注册，路由尚未装配
+	StatusActive   = "active"   // 已加载
+	StatusOverride = "override" // 已加载并覆盖内置处理器
+	StatusConflict = "conflict" // 与内置命令码冲突且未允许覆盖，未加载（内置处理器保持不变）
+	StatusDisabled = "disabled" // 配置禁用，未加载
+	StatusFailed   = "failed"   // 工厂函数panic或返回nil，未加载
+)
+
+var (
+	// ErrSealed 路由已装配后注册
+	ErrSealed = errors.New("路由已装配，自定义处理器须在服务器启动前注册")
+	// ErrDuplicate 同一命令码重复注册自定义处理器
+	ErrDuplicate = errors.New("该命令码已注册自定义处理器")
+)
+
+// Factory 自定义处理器工厂，装配路由时以该命令专属的 HandlerDeps 调用一次
+type Factory func(deps HandlerDeps) ziface.IRouter
+
+// HandlerInfo 自定义处理器诊断信息
+type HandlerInfo struct {
+	Command      string    `json:"command"`           // 命令码，如 "0x42"
+	Label        string    `json:"label"`             // 命令标识（含协议登记的名称）
+	Handler      string    `json:"handler,omitempty"` // 处理器类型
+	Status       string    `json:"status"`
+	Detail       string    `json:"detail,omitempty"` // 未加载原因
+	RegisteredAt time.Time `json:"registeredAt"`
+	Frames       uint64    `json:"frames"`   // 交给处理器的帧数
+	Failures     uint64    `json:"failures"` // 处理器panic次数（已由 handlerguard 恢复）
+}
+
+// BindOptions 装配选项
+type BindOptions struct {
+	Builtin         func(msgID uint32) bool // 命令码是否已有内置处理器
+	Disabled        []byte                  // 不加载的命令码
+	OverrideBuiltin []byte                  // 允许覆盖内置处理器的命令码
+}
+
+// Binding 装配结果：需加入路由表的自定义处理器（已带计数包装）
+type Binding struct {
+	Command  byte
+	Router   ziface.IRouter
+	Override bool // 替换内置处理器
+}
+
+// registration 已注册的自定义处理器
+type registration struct {
+	cmd          byte
+	factory      Factory
+	registeredAt time.Time
+	handler      string
+	status       string
+	detail       string
+	frames       atomic.Uint64
+	failures     atomic.Uint64
+}
+
+// Registry 自定义处理器注册表（并发安全）
+type Registry struct {
+	mu      sync.Mutex
+	entries map[byte]*registration
+	sealed  bool
+}
+
+// NewRegistry 创建注册表
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[byte]*registration)}
+}
+
+// Register 注册命令码的自定义处理器工厂；路由装配后注册返回 ErrSealed
+func (r *Registry) Register(cmd byte, factory Factory) error {
+	if factory == nil {
+		return fmt.Errorf("命令 0x%02X 的处理器工厂为空", cmd)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sealed {
+		return fmt.Errorf("%w: 0x%02X", ErrSealed, cmd)
+	}
+	if _, exists := r.entries[cmd]; exists {
+		return fmt.Errorf("%w: 0x%02X", ErrDuplicate, cmd)
+	}
+	r.entries[cmd] = &registration{cmd: cmd, factory: factory, registeredAt: time.Now(), status: StatusPending}
+	return nil
+}
+
+// Bind 装配路由：按配置跳过禁用与未允许覆盖的冲突命令，调用工厂创建处理器；之后的注册被拒绝。
+// 工厂函数panic或返回nil时仅该处理器不加载，不影响其他路由
+func (r *Registry) Bind(opts BindOptions) []Binding {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sealed = true
+
+	disabled, override := commandSet(opts.Disabled), commandSet(opts.OverrideBuiltin)
+	cmds := make([]byte, 0, len(r.entries))
+	for cmd := range r.entries {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i] < cmds[j] })
+
+	var bindings []Binding
+	for _, cmd := range cmds {
+		entry := r.entries[cmd]
+		entry.handler, entry.detail = "", ""
+		builtin := opts.Builtin != nil && opts.Builtin(uint32(cmd))
+		switch {
+		case disabled[cmd]:
+			entry.status, entry.detail = StatusDisabled, "extensions.disabled"
+		case builtin && !override[cmd]:
+			entry.status, entry.detail = StatusConflict, "与内置处理器冲突，需在 extensions.overrideBuiltin 中显式允许覆盖"
+		default:
+			router, err := build(entry)
+			if err != nil {
+				entry.status, entry.detail = StatusFailed, err.Error()
+				break
+			}
+			entry.handler = fmt.Sprintf("%T", router)
+			entry.status = StatusActive
+			if builtin {
+				entry.status = StatusOverride
+			}
+			bindings = append(bindings, Binding{Command: cmd, Router: &countedRouter{entry: entry, inner: router}, Override: builtin})
+		}
+		logEntry(entry)
+	}
+	return bindings
+}
+
+// build 调用工厂创建处理器，工厂panic时返回错误
+func build(entry *registration) (router ziface.IRouter, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			router, err = nil, fmt.Errorf("处理器工厂panic: %v", p)
+		}
+	}()
+	router = entry.factory(newDeps(entry.cmd))
+	if router == nil {
+		return nil, errors.New("处理器工厂返回nil")
+	}
+	return router, nil
+}
+
+func logEntry(entry *registration) {
+	fields := logrus.Fields{
+		"command": constants.CommandLabel(entry.cmd),
+		"handler": entry.handler,
+		"status":  entry.status,
+	}
+	switch entry.status {
+	case StatusActive:
+		logger.WithFields(fields).Info("已加载自定义处理器")
+	case StatusOverride:
+		logger.WithFields(fields).Warn("自定义处理器已覆盖内置处理器")
+	case StatusDisabled:
+		logger.WithFields(fields).Info("自定义处理器已按配置禁用")
+	default:
+		fields["detail"] = entry.detail
+		logger.WithFields(fields).Error("自定义处理器未加载")
+	}
+}
+
+func commandSet(cmds []byte) map[byte]bool {
+	set := make(map[byte]bool, len(cmds))
+	for _, cmd := range cmds {
+		set[cmd] = true
+	}
+	return set
+}
+
+// Handlers 已注册的自定义处理器（按命令码排序）
+func (r *Registry) Handlers() []HandlerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]HandlerInfo, 0, len(r.entries))
+	for _, entry := range r.entries {
+		out = append(out, HandlerInfo{
+			Command:      fmt.Sprintf("0x%02X", entry.cmd),
+			Label:        constants.CommandLabel(entry.cmd),
+			Handler:      entry.handler,
+			Status:       entry.status,
+			Detail:       entry.detail,
+			RegisteredAt: entry.registeredAt,
+			Frames:       entry.frames.Load(),
+			Failures:     entry.failures.Load(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Command < out[j].Command })
+	return out
+}
+
+// WritePrometheus 输出已加载的自定义处理器的帧数与异常次数
+func (r *Registry) WritePrometheus(w io.Writer) {
+	var loaded []HandlerInfo
+	for _, h := range r.Handlers() {
+		if h.Status == StatusActive || h.Status == StatusOverride {
+			loaded = append(loaded, h)
+		}
+	}
+	fmt.Fprintf(w, "# HELP iot_custom_router_frames_total Frames dispatched to custom routers per command.\n# TYPE iot_custom_router_frames_total counter\n")
+	for _, h := range loaded {
+		fmt.Fprintf(w, "iot_custom_router_frames_total{command=%q,handler=%q} %d\n", h.Command, h.Handler, h.Frames)
+	}
+	fmt.Fprintf(w, "# HELP iot_custom_router_failures_total Custom router panics recovered per command.\n# TYPE iot_custom_router_failures_total counter\n")
+	for _, h := range loaded {
+		fmt.Fprintf(w, "iot_custom_router_failures_total{command=%q,handler=%q} %d\n", h.Command, h.Handler, h.Failures)
+	}
+}
+
+// countedRouter 统计帧数与panic次数的处理器包装（panic继续向外抛出，由 handlerguard 恢复）
+type countedRouter struct {
+	entry *registration
+	inner ziface.IRouter
+}
+
+func (r *countedRouter) PreHandle(ziface.IRequest) {}
+
+func (r *countedRouter) Handle(request ziface.IRequest) {
+	r.entry.frames.Add(1)
+	completed := false
+	defer func() {
+		if !completed {
+			r.entry.failures.Add(1)
+		}
+	}()
+	r.inner.PreHandle(request)
+	r.inner.Handle(request)
+	r.inner.PostHandle(request)
+	completed = true
+}
+
+func (r *countedRouter) PostHandle(ziface.IRequest) {}
+
+// Unwrap 被包装的处理器
+func (r *countedRouter) Unwrap() ziface.IRouter {
+	return r.inner
+}
+
+var globalRegistry atomic.Pointer[Registry]
+
+func init() {
+	globalRegistry.Store(NewRegistry())
+}
+
+// GetGlobalRegistry 获取全局注册表
+func GetGlobalRegistry() *Registry {
+	return globalRegistry.Load()
+}
+
+// SetGlobalRegistry 替换全局注册表（测试使用；nil 表示重置为空注册表）
+func SetGlobalRegistry(r *Registry) {
+	if r == nil {
+		r = NewRegistry()
+	}
+	globalRegistry.Store(r)
+}
+
+// RegisterCustomRouter 在全局注册表中注册命令码的自定义处理器工厂，须在服务器启动前调用（通常在扩展包的 init 中）
+func RegisterCustomRouter(cmd byte, factory func(deps HandlerDeps) ziface.IRouter) error {
+	return GetGlobalRegistry().Register(cmd, factory)
+}
+
+// ParseCommands 解析配置中的命令码（"0x42" 或 "42"）
+func ParseCommands(values []string) ([]byte, error) {
+	commands := make([]byte, 0, len(values))
+	for _, value := range values {
+		text := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(value), "0x"), "0X")
+		code, err := strconv.ParseUint(text, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("命令码格式错误: %q", value)
+		}
+		commands = append(commands, byte(code))
+	}
+	return commands, nil
+}
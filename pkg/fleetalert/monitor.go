@@ -0,0 +1,552 @@
+// Package fleetalert 全网在线设备数告警：定时采样在线设备数（按ICCID聚合），按规则检测绝对值下限（threshold）
+// 或窗口内较最高值的下降比例（rate_of_change）。大规模网络中绝对值阈值触发过晚、小规模网络中又频繁误报，
+// 骨干网中断或错误发布引起的快速掉线以下降比例检测；告警附窗口内离线的ICCID及前缀分布，
+// 少数前缀集中掉线判定为单站点故障，分散掉线判定为网关整体故障。
+// 告警经历 firing → resolved 生命周期，开启与恢复均回调，最近记录保存在环形缓冲中。
+package fleetalert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 规则类型
+const (
+	RuleThreshold    = "threshold"      // 在线设备数低于下限
+	RuleRateOfChange = "rate_of_change" // 窗口内较最高值下降比例
+)
+
+// 告警状态与故障范围
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+
+	ScopeSite    = "site"    // 离线设备集中在少数ICCID前缀（单站点/单批次SIM）
+	ScopeGateway = "gateway" // 离线设备分散在多个前缀（网关或骨干网整体故障）
+)
+
+const (
+	defaultSampleInterval  = 30 * time.Second
+	defaultPrefixLength    = 15
+	defaultSiteShare       = 0.8
+	defaultMaxListedICCIDs = 50
+	defaultHistorySize     = 200
+	maxListedPrefixes      = 10
+)
+
+// Rule 告警规则
+type Rule struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	MinOnline   int           `json:"minOnline,omitempty"` // threshold：在线设备数低于该值告警
+	Window      time.Duration `json:"-"`                   // rate_of_change：统计窗口
+	WindowSecs  int           `json:"windowSeconds,omitempty"`
+	DropPercent float64       `json:"dropPercent,omitempty"` // rate_of_change：较窗口内最高值下降的百分比
+	MinDrop     int           `json:"minDrop,omitempty"`     // rate_of_change：下降的设备数下限
+}
+
+// Options 监控选项
+type Options struct {
+	SampleInterval  time.Duration
+	PrefixLength    int     // ICCID前缀长度
+	SiteShare       float64 // 单一前缀占离线设备比例达到该值判定为单站点故障
+	MaxListedICCIDs int     // 告警中列出的离线ICCID数上限
+	HistorySize     int     // 保留的告警记录数
+	Rules           []Rule
+}
+
+// Sample 在线设备数样本
+type Sample struct {
+	At     time.Time `json:"at"`
+	Online int       `json:"online"`
+}
+
+// PrefixCount ICCID前缀的离线统计
+type PrefixCount struct {
+	Prefix  string `json:"prefix"`
+	ICCIDs  int    `json:"iccids"`
+	Devices int    `json:"devices"`
+}
+
+// Alert 在线设备数告警
+type Alert struct {
+	ID          string     `json:"id"`
+	Rule        string     `json:"rule"`
+	Type        string     `json:"type"`
+	State       string     `json:"state"`
+	StartedAt   time.Time  `json:"startedAt"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+	WindowSecs  int        `json:"windowSeconds,omitempty"`
+	Reference   int        `json:"reference"`   // 窗口内最高在线数（threshold 为下限值）
+	Online      int        `json:"online"`      // 开启时的在线数
+	Lowest      int        `json:"lowest"`      // 告警期间的最低在线数
+	Drop        int        `json:"drop"`        // 开启时较参考值下降的设备数
+	DropPercent float64    `json:"dropPercent"` // 开启时的下降百分比
+	PeakPercent float64    `json:"peakDropPercent"`
+
+	// 窗口内离线情况（开启时统计，下降继续扩大时更新）
+	DisconnectedDevices int           `json:"disconnectedDevices"`
+	DisconnectedICCIDs  int           `json:"disconnectedIccidCount"`
+	ICCIDs              []string      `json:"disconnectedIccids"` // 最多 MaxListedICCIDs 个，按离线设备数从多到少
+	Prefixes            []PrefixCount `json:"prefixes"`           // 按离线设备数从多到少
+	Scope               string        `json:"scope,omitempty"`    // site | gateway
+}
+
+// Handler 告警开启/恢复回调
+type Handler func(Alert)
+
+// disconnect 采样间离线的设备（同一ICCID下在线设备数减少）
+type disconnect struct {
+	at      time.Time
+	iccid   string
+	devices int
+}
+
+// ruleState 规则进行中的告警
+type ruleState struct {
+	rule   Rule
+	active *Alert
+}
+
+// Monitor 全网在线设备数监控
+type Monitor struct {
+	opts   Options
+	source func() map[string]int // ICCID → 在线设备数
+
+	mu          sync.Mutex
+	rules       []*ruleState
+	samples     []Sample
+	disconnects []disconnect
+	previous    map[string]int
+	maxWindow   time.Duration
+	history     []*Alert
+	next        int
+	count       int
+	seq         uint64
+	handlers    []Handler
+	cancel      context.CancelFunc
+}
+
+// NewMonitor 创建监控，source 返回各ICCID的在线设备数；非正数选项使用默认值，无效规则忽略
+func NewMonitor(opts Options, source func() map[string]int) *Monitor {
+	if opts.SampleInterval <= 0 {
+		opts.SampleInterval = defaultSampleInterval
+	}
+	if opts.PrefixLength <= 0 {
+		opts.PrefixLength = defaultPrefixLength
+	}
+	if opts.SiteShare <= 0 || opts.SiteShare > 1 {
+		opts.SiteShare = defaultSiteShare
+	}
+	if opts.MaxListedICCIDs <= 0 {
+		opts.MaxListedICCIDs = defaultMaxListedICCIDs
+	}
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = defaultHistorySize
+	}
+	m := &Monitor{source: source, history: make([]*Alert, opts.HistorySize)}
+	rules := opts.Rules
+	opts.Rules = nil
+	for _, rule := range rules {
+		if err := validateRule(&rule); err != nil {
+			logger.WithFields(logrus.Fields{"rule": rule.Name, "error": err.Error()}).Warn("忽略无效的在线设备数告警规则")
+			continue
+		}
+		opts.Rules = append(opts.Rules, rule)
+		m.rules = append(m.rules, &ruleState{rule: rule})
+		if rule.Window > m.maxWindow {
+			m.maxWindow = rule.Window
+		}
+	}
+	m.opts = opts
+	return m
+}
+
+func validateRule(rule *Rule) error {
+	if rule.Type == "" {
+		rule.Type = RuleRateOfChange
+	}
+	if rule.Window <= 0 && rule.WindowSecs > 0 {
+		rule.Window = time.Duration(rule.WindowSecs) * time.Second
+	}
+	rule.WindowSecs = int(rule.Window / time.Second)
+	switch rule.Type {
+	case RuleThreshold:
+		if rule.MinOnline <= 0 {
+			return fmt.Errorf("threshold 规则需配置 minOnline")
+		}
+	case RuleRateOfChange:
+		if rule.Window <= 0 || rule.DropPercent <= 0 || rule.DropPercent > 100 {
+			return fmt.Errorf("rate_of_change 规则需配置 windowSeconds 与 dropPercent(0,100]")
+		}
+	default:
+		return fmt.Errorf("未知的规则类型: %s", rule.Type)
+	}
+	if rule.Name == "" {
+		rule.Name = fmt.Sprintf("%s_%d", rule.Type, rule.WindowSecs)
+	}
+	return nil
+}
+
+// Options 监控选项（已补全默认值，仅含有效规则）
+func (m *Monitor) Options() Options {
+	return m.opts
+}
+
+// RegisterHandler 注册告警开启/恢复回调
+func (m *Monitor) RegisterHandler(handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers = append(m.handlers, handler)
+}
+
+// HandlerCount 已注册的回调数量
+func (m *Monitor) HandlerCount() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.handlers)
+}
+
+// Observe 输入一次采样（ICCID → 在线设备数）：与上次采样比较记录离线的ICCID，逐条规则判定告警开启/恢复
+func (m *Monitor) Observe(at time.Time, online map[string]int) {
+	if m == nil {
+		return
+	}
+	total := 0
+	for _, n := range online {
+		total += n
+	}
+
+	m.mu.Lock()
+	if m.previous != nil {
+		for iccid, before := range m.previous {
+			if lost := before - online[iccid]; lost > 0 {
+				m.disconnects = append(m.disconnects, disconnect{at: at, iccid: iccid, devices: lost})
+			}
+		}
+	}
+	m.previous = make(map[string]int, len(online))
+	for iccid, n := range online {
+		m.previous[iccid] = n
+	}
+	m.samples = append(m.samples, Sample{At: at, Online: total})
+	m.pruneLocked(at)
+
+	var fired []Alert
+	for _, rs := range m.rules {
+		if alert := m.evaluateLocked(rs, at, total); alert != nil {
+			fired = append(fired, *alert)
+		}
+	}
+	handlers := append([]Handler(nil), m.handlers...)
+	m.mu.Unlock()
+
+	for _, alert := range fired {
+		logger.WithFields(logrus.Fields{
+			"rule":        alert.Rule,
+			"state":       alert.State,
+			"reference":   alert.Reference,
+			"online":      alert.Online,
+			"dropPercent": alert.DropPercent,
+			"scope":       alert.Scope,
+		}).Warn("📉 全网在线设备数告警")
+		for _, h := range handlers {
+			h(alert)
+		}
+	}
+}
+
+// pruneLocked 删除超出最大窗口的样本与离线记录（保留窗口起点之前的最后一个样本）
+func (m *Monitor) pruneLocked(at time.Time) {
+	cutoff := at.Add(-m.maxWindow)
+	keep := 0
+	for keep < len(m.samples)-1 && m.samples[keep+1].At.Before(cutoff) {
+		keep++
+	}
+	m.samples = append(m.samples[:0], m.samples[keep:]...)
+	drop := 0
+	for drop < len(m.disconnects) && m.disconnects[drop].at.Before(cutoff) {
+		drop++
+	}
+	m.disconnects = append(m.disconnects[:0], m.disconnects[drop:]...)
+}
+
+// evaluateLocked 判定规则，告警开启或恢复时返回其副本
+func (m *Monitor) evaluateLocked(rs *ruleState, at time.Time, online int) *Alert {
+	rule := rs.rule
+	reference, drop, percent, breached := 0, 0, 0.0, false
+	switch rule.Type {
+	case RuleThreshold:
+		reference = rule.MinOnline
+		breached = online < rule.MinOnline
+		drop = rule.MinOnline - online
+		percent = float64(drop) * 100 / float64(rule.MinOnline)
+	case RuleRateOfChange:
+		reference = m.peakLocked(at.Add(-rule.Window))
+		if reference > 0 {
+			drop = reference - online
+			percent = float64(drop) * 100 / float64(reference)
+			breached = percent >= rule.DropPercent && drop >= rule.MinDrop
+		}
+	}
+
+	if rs.active == nil {
+		if !breached {
+			return nil
+		}
+		m.seq++
+		alert := &Alert{
+			ID:          fmt.Sprintf("fleet_%d_%d", at.UnixMilli(), m.seq),
+			Rule:        rule.Name,
+			Type:        rule.Type,
+			State:       StateFiring,
+			StartedAt:   at,
+			WindowSecs:  rule.WindowSecs,
+			Reference:   reference,
+			Online:      online,
+			Lowest:      online,
+			Drop:        drop,
+			DropPercent: percent,
+			PeakPercent: percent,
+		}
+		m.describeLocked(alert, at.Add(-rule.Window))
+		rs.active = alert
+		m.recordLocked(alert)
+		cp := *alert
+		return &cp
+	}
+
+	alert := rs.active
+	if online < alert.Lowest {
+		alert.Lowest = online
+	}
+	if percent > alert.PeakPercent {
+		// 下降继续扩大时按当前窗口重新统计离线情况
+		alert.PeakPercent = percent
+		m.describeLocked(alert, at.Add(-rule.Window))
+	}
+	if breached {
+		return nil
+	}
+	resolvedAt := at
+	alert.State, alert.ResolvedAt = StateResolved, &resolvedAt
+	rs.active = nil
+	cp := *alert
+	return &cp
+}
+
+// peakLocked 窗口内（含窗口起点之前的最后一个样本）的最高在线数
+func (m *Monitor) peakLocked(from time.Time) int {
+	peak := 0
+	for i, s := range m.samples {
+		if s.At.Before(from) && i+1 < len(m.samples) && !m.samples[i+1].At.After(from) {
+			continue
+		}
+		if s.Online > peak {
+			peak = s.Online
+		}
+	}
+	return peak
+}
+
+// describeLocked 汇总窗口内离线的ICCID与前缀分布并判定故障范围（threshold 规则无窗口，统计最近一次采样间的离线）
+func (m *Monitor) describeLocked(alert *Alert, from time.Time) {
+	alert.DisconnectedDevices = 0
+	byICCID := make(map[string]int)
+	for _, d := range m.disconnects {
+		if !d.at.Before(from) {
+			byICCID[d.iccid] += d.devices
+		}
+	}
+	byPrefix := make(map[string]*PrefixCount)
+	iccids := make([]string, 0, len(byICCID))
+	for iccid, devices := range byICCID {
+		iccids = append(iccids, iccid)
+		alert.DisconnectedDevices += devices
+		prefix := iccid
+		if len(prefix) > m.opts.PrefixLength {
+			prefix = prefix[:m.opts.PrefixLength]
+		}
+		pc, ok := byPrefix[prefix]
+		if !ok {
+			pc = &PrefixCount{Prefix: prefix}
+			byPrefix[prefix] = pc
+		}
+		pc.ICCIDs++
+		pc.Devices += devices
+	}
+	sort.Slice(iccids, func(i, j int) bool {
+		if byICCID[iccids[i]] != byICCID[iccids[j]] {
+			return byICCID[iccids[i]] > byICCID[iccids[j]]
+		}
+		return iccids[i] < iccids[j]
+	})
+	alert.DisconnectedICCIDs = len(iccids)
+	if len(iccids) > m.opts.MaxListedICCIDs {
+		iccids = iccids[:m.opts.MaxListedICCIDs]
+	}
+	alert.ICCIDs = iccids
+
+	alert.Prefixes = make([]PrefixCount, 0, len(byPrefix))
+	for _, pc := range byPrefix {
+		alert.Prefixes = append(alert.Prefixes, *pc)
+	}
+	sort.Slice(alert.Prefixes, func(i, j int) bool {
+		a, b := alert.Prefixes[i], alert.Prefixes[j]
+		if a.Devices != b.Devices {
+			return a.Devices > b.Devices
+		}
+		return a.Prefix < b.Prefix
+	})
+	if len(alert.Prefixes) > maxListedPrefixes {
+		alert.Prefixes = alert.Prefixes[:maxListedPrefixes]
+	}
+	if alert.DisconnectedDevices > 0 {
+		alert.Scope = ScopeGateway
+		if float64(alert.Prefixes[0].Devices) >= m.opts.SiteShare*float64(alert.DisconnectedDevices) {
+			alert.Scope = ScopeSite
+		}
+	}
+}
+
+func (m *Monitor) recordLocked(alert *Alert) {
+	m.history[m.next] = alert
+	m.next = (m.next + 1) % len(m.history)
+	if m.count < len(m.history) {
+		m.count++
+	}
+}
+
+// Active 进行中的告警
+func (m *Monitor) Active() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	active := make([]Alert, 0)
+	for _, rs := range m.rules {
+		if rs.active != nil {
+			active = append(active, *rs.active)
+		}
+	}
+	return active
+}
+
+// History 最近的告警（新→旧，含进行中）
+func (m *Monitor) History() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := make([]Alert, 0, m.count)
+	for i := 1; i <= m.count; i++ {
+		history = append(history, *m.history[(m.next-i+len(m.history))%len(m.history)])
+	}
+	return history
+}
+
+// Samples 最大窗口内的在线设备数样本（旧→新）
+func (m *Monitor) Samples() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Sample(nil), m.samples...)
+}
+
+// Start 按采样间隔定时采样
+func (m *Monitor) Start(ctx context.Context) {
+	if m.source == nil {
+		return
+	}
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.mu.Unlock()
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(m.opts.SampleInterval)
+		defer ticker.Stop()
+		m.Observe(time.Now(), m.source())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				m.Observe(now, m.source())
+			}
+		}
+	}()
+}
+
+// Stop 停止定时采样
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalMonitor atomic.Pointer[Monitor]
+
+// GetGlobalMonitor 获取全局监控（未启用时为nil）
+func GetGlobalMonitor() *Monitor {
+	return globalMonitor.Load()
+}
+
+// SetGlobalMonitor 设置全局监控
+func SetGlobalMonitor(m *Monitor) {
+	globalMonitor.Store(m)
+}
+
+// InitGlobalMonitor 按配置创建全局监控并开始采样；未启用时不创建
+func InitGlobalMonitor(ctx context.Context, source func() map[string]int) *Monitor {
+	cfg := config.GetConfig().FleetAlerts
+	if !cfg.Enabled {
+		globalMonitor.Store(nil)
+		return nil
+	}
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		rules = append(rules, Rule{
+			Name:        r.Name,
+			Type:        r.Type,
+			MinOnline:   r.MinOnline,
+			WindowSecs:  r.WindowSeconds,
+			DropPercent: r.DropPercent,
+			MinDrop:     r.MinDrop,
+		})
+	}
+	m := NewMonitor(Options{
+		SampleInterval:  time.Duration(cfg.SampleIntervalSeconds) * time.Second,
+		PrefixLength:    cfg.ICCIDPrefixLength,
+		SiteShare:       cfg.SiteShare,
+		MaxListedICCIDs: cfg.MaxListedICCIDs,
+		HistorySize:     cfg.HistorySize,
+		Rules:           rules,
+	}, source)
+	globalMonitor.Store(m)
+	m.Start(ctx)
+	return m
+}
+
+// StopGlobalMonitor 停止全局监控的定时采样
+func StopGlobalMonitor() {
+	if m := globalMonitor.Load(); m != nil {
+		m.Stop()
+	}
+}
@@ -0,0 +1,347 @@
+// Package framededup 重复帧抑制：网络较差时设备收不到应答会重发同一帧，
+// 按连接记录最近的 (物理ID, 消息ID, 命令)，窗口内的重发帧不再交给处理器，只原样重放首次的成功应答使设备停止重试；
+// 处理器应答失败时（等待设备重发）清除该帧的记录，重发帧照常交给处理器。
+package framededup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/extension"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsCollectorName /metrics 中重复帧抑制指标的注册名
+const MetricsCollectorName = "frame_dedup"
+
+const (
+	defaultWindow   = 30 * time.Second
+	defaultCapacity = 64
+)
+
+// defaultCommands 未配置时参与抑制的命令：注册（重发会重复触发上线通知与会话转换）；
+// 结算的重发已由关键帧预写与结算日志存储按载荷去重，不默认抑制
+var defaultCommands = []byte{constants.CmdDeviceRegister}
+
+// Options 重复帧抑制选项
+type Options struct {
+	Window   time.Duration // 判定重发的窗口
+	Capacity int           // 每个连接记录的最近帧数
+	Commands []byte        // 参与抑制的命令码
+}
+
+// Key 帧标识
+type Key struct {
+	PhysicalID uint32
+	MessageID  uint16
+	Command    uint8
+}
+
+// Stats 统计快照
+type Stats struct {
+	Duplicates    int64            `json:"duplicates"`     // 被抑制的重发帧
+	ByCommand     map[string]int64 `json:"by_command"`     // 命令码 → 被抑制次数
+	AcksReplayed  int64            `json:"acks_replayed"`  // 重放的应答
+	Connections   int              `json:"connections"`    // 有记录的连接数
+	WindowSeconds int              `json:"window_seconds"` // 判定重发的窗口(秒)
+	Capacity      int              `json:"capacity"`
+	Commands      []string         `json:"commands"`
+}
+
+// entry 最近处理过的帧；ack 为处理器发出的应答载荷（处理器尚未应答或该命令无应答时为nil）
+type entry struct {
+	key    Key
+	seenAt time.Time
+	ack    []byte
+}
+
+// connCache 单个连接最近处理过的帧（环形，写满后覆盖最旧的）
+type connCache struct {
+	entries []entry
+	next    int
+}
+
+func (c *connCache) find(key Key) *entry {
+	for i := range c.entries {
+		if c.entries[i].key == key {
+			return &c.entries[i]
+		}
+	}
+	return nil
+}
+
+// Deduper 重复帧抑制器
+type Deduper struct {
+	opts     Options
+	commands map[uint8]bool
+	now      func() time.Time
+
+	mu        sync.Mutex
+	conns     map[uint64]*connCache
+	byCommand map[uint8]int64
+	replayed  int64
+}
+
+// New 创建重复帧抑制器
+func New(opts Options) *Deduper {
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultCapacity
+	}
+	if len(opts.Commands) == 0 {
+		opts.Commands = defaultCommands
+	}
+	commands := make(map[uint8]bool, len(opts.Commands))
+	for _, cmd := range opts.Commands {
+		commands[cmd] = true
+	}
+	return &Deduper{
+		opts:      opts,
+		commands:  commands,
+		now:       time.Now,
+		conns:     make(map[uint64]*connCache),
+		byCommand: make(map[uint8]int64),
+	}
+}
+
+// Options 当前生效的选项
+func (d *Deduper) Options() Options {
+	return d.opts
+}
+
+// SetClock 替换时钟（测试使用）
+func (d *Deduper) SetClock(now func() time.Time) {
+	d.now = now
+}
+
+// Applies 命令是否参与抑制
+func (d *Deduper) Applies(command uint8) bool {
+	return d.commands[command]
+}
+
+// Check 登记一帧：窗口内已处理过同一帧时返回 duplicate=true 与首次的应答（处理器尚未应答时为nil）；
+// 否则记录该帧并返回 false，调用方继续交给处理器
+func (d *Deduper) Check(connID uint64, key Key) (duplicate bool, ack []byte) {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, ok := d.conns[connID]
+	if !ok {
+		c = &connCache{entries: make([]entry, 0, d.opts.Capacity)}
+		d.conns[connID] = c
+	}
+	if e := c.find(key); e != nil {
+		if now.Sub(e.seenAt) < d.opts.Window {
+			d.byCommand[key.Command]++
+			if e.ack != nil {
+				d.replayed++
+			}
+			return true, e.ack
+		}
+		// 窗口外的同一帧（消息ID回绕）按新帧处理
+		*e = entry{key: key, seenAt: now}
+		return false, nil
+	}
+	if len(c.entries) < d.opts.Capacity {
+		c.entries = append(c.entries, entry{key: key, seenAt: now})
+	} else {
+		c.entries[c.next] = entry{key: key, seenAt: now}
+		c.next = (c.next + 1) % d.opts.Capacity
+	}
+	return false, nil
+}
+
+// RecordAck 记录处理器对某帧发出的成功应答，供该帧重发时重放；
+// 失败应答（首字节非成功状态）表示处理器等待设备重发，清除该帧的记录使重发照常交给处理器。未登记的帧忽略
+func (d *Deduper) RecordAck(connID uint64, key Key, data []byte) {
+	if !d.Applies(key.Command) {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, ok := d.conns[connID]
+	if !ok {
+		return
+	}
+	e := c.find(key)
+	if e == nil {
+		return
+	}
+	if len(data) > 0 && data[0] != constants.StatusSuccess {
+		// 置为窗口外，下次同一帧按新帧处理
+		e.seenAt = time.Time{}
+		e.ack = nil
+		return
+	}
+	e.ack = append([]byte(nil), data...)
+}
+
+// Forget 连接关闭时释放其记录
+func (d *Deduper) Forget(connID uint64) {
+	d.mu.Lock()
+	delete(d.conns, connID)
+	d.mu.Unlock()
+}
+
+// Stats 统计快照
+func (d *Deduper) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := Stats{
+		ByCommand:     make(map[string]int64, len(d.byCommand)),
+		AcksReplayed:  d.replayed,
+		Connections:   len(d.conns),
+		WindowSeconds: int(d.opts.Window / time.Second),
+		Capacity:      d.opts.Capacity,
+	}
+	for cmd, n := range d.byCommand {
+		stats.Duplicates += n
+		stats.ByCommand[fmt.Sprintf("0x%02X", cmd)] = n
+	}
+	for _, cmd := range d.opts.Commands {
+		stats.Commands = append(stats.Commands, fmt.Sprintf("0x%02X", cmd))
+	}
+	return stats
+}
+
+// WritePrometheus 以 Prometheus 文本格式写出各命令被抑制的重发帧数
+func (d *Deduper) WritePrometheus(w io.Writer) {
+	d.mu.Lock()
+	commands := make([]uint8, 0, len(d.byCommand))
+	for cmd := range d.byCommand {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i] < commands[j] })
+	fmt.Fprintf(w, "# HELP iot_frame_duplicates_total Retransmitted device frames suppressed per command.\n# TYPE iot_frame_duplicates_total counter\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "iot_frame_duplicates_total{command=\"0x%02X\"} %d\n", cmd, d.byCommand[cmd])
+	}
+	fmt.Fprintf(w, "# HELP iot_frame_duplicate_acks_replayed_total Acks replayed for suppressed retransmissions.\n# TYPE iot_frame_duplicate_acks_replayed_total counter\n")
+	fmt.Fprintf(w, "iot_frame_duplicate_acks_replayed_total %d\n", d.replayed)
+	d.mu.Unlock()
+}
+
+// Wrap 包装处理器：参与抑制的命令在处理前查重，重发帧只重放应答
+func Wrap(msgID uint32, router ziface.IRouter) ziface.IRouter {
+	return &dedupRouter{msgID: msgID, inner: router}
+}
+
+// dedupRouter 带重复帧抑制的处理器，调用时使用当前全局抑制器（未启用时直接交给处理器）
+type dedupRouter struct {
+	msgID uint32
+	inner ziface.IRouter
+}
+
+func (r *dedupRouter) PreHandle(ziface.IRequest) {}
+
+// Handle 重发帧只重放应答；其余帧在同一次调用内依次执行 PreHandle/Handle/PostHandle
+func (r *dedupRouter) Handle(request ziface.IRequest) {
+	if d := GetGlobalDeduper(); d != nil && r.msgID <= 0xFF && d.Applies(uint8(r.msgID)) && d.suppress(request) {
+		return
+	}
+	r.inner.PreHandle(request)
+	r.inner.Handle(request)
+	r.inner.PostHandle(request)
+}
+
+func (r *dedupRouter) PostHandle(ziface.IRequest) {}
+
+// Unwrap 被包装的处理器
+func (r *dedupRouter) Unwrap() ziface.IRouter {
+	return r.inner
+}
+
+// suppress 按帧头查重：重发帧计数、重放首次应答并返回 true；非标准帧或解码失败时不拦截
+func (d *Deduper) suppress(request ziface.IRequest) bool {
+	conn := request.GetConnection()
+	if conn == nil {
+		return false
+	}
+	frame, err := (&protocol.SimpleHandlerBase{}).ExtractDecodedFrame(request)
+	if err != nil || frame == nil || frame.FrameType != protocol.FrameTypeStandard {
+		return false
+	}
+	physicalID, err := frame.GetPhysicalIDAsUint32()
+	if err != nil {
+		return false
+	}
+	key := Key{PhysicalID: physicalID, MessageID: frame.MessageID, Command: frame.Command}
+	duplicate, ack := d.Check(conn.GetConnID(), key)
+	if !duplicate {
+		return false
+	}
+	core.RecordConnDuplicateFrame(conn.GetConnID())
+	fields := logrus.Fields{
+		"connID":    conn.GetConnID(),
+		"deviceId":  frame.DeviceID,
+		"messageID": fmt.Sprintf("0x%04X", frame.MessageID),
+		"command":   fmt.Sprintf("0x%02X", frame.Command),
+		"ackReplay": ack != nil,
+	}
+	if ack != nil {
+		if err := protocol.SendDNYResponse(conn, physicalID, frame.MessageID, frame.Command, ack); err != nil {
+			fields["error"] = err.Error()
+		}
+	}
+	logger.WithFields(fields).Info("设备重发帧已抑制，不再交给处理器")
+	return true
+}
+
+// recordResponse 应答观察者：记录处理器发出的应答
+func recordResponse(connID uint64, physicalID uint32, messageID uint16, command uint8, data []byte) {
+	if d := GetGlobalDeduper(); d != nil {
+		d.RecordAck(connID, Key{PhysicalID: physicalID, MessageID: messageID, Command: command}, data)
+	}
+}
+
+func init() {
+	protocol.RegisterDNYResponseObserver(recordResponse)
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalDeduper atomic.Pointer[Deduper]
+
+// GetGlobalDeduper 获取全局重复帧抑制器（未启用时为nil）
+func GetGlobalDeduper() *Deduper {
+	return globalDeduper.Load()
+}
+
+// InitGlobalDeduper 按配置创建全局重复帧抑制器；未启用时清空，命令码配置无效时使用默认命令
+func InitGlobalDeduper() (*Deduper, error) {
+	cfg := config.GetConfig().FrameDedup
+	if !cfg.Enabled {
+		globalDeduper.Store(nil)
+		return nil, nil
+	}
+	commands, err := extension.ParseCommands(cfg.Commands)
+	if err != nil {
+		commands = nil
+	}
+	d := New(Options{
+		Window:   time.Duration(cfg.WindowSeconds) * time.Second,
+		Capacity: cfg.Capacity,
+		Commands: commands,
+	})
+	globalDeduper.Store(d)
+	return d, err
+}
+
+// SetGlobalDeduper 替换全局重复帧抑制器（测试使用，传nil关闭）
+func SetGlobalDeduper(d *Deduper) {
+	globalDeduper.Store(d)
+}
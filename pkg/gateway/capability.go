@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
+)
+
+// GetDeviceCapabilities 设备当前的固件能力集（注册或版本上报时推导），未启用能力矩阵或设备不在线时返回nil
+func (g *DeviceGateway) GetDeviceCapabilities(deviceID string) *capability.Set {
+	if g.tcpManager == nil {
+		return nil
+	}
+	device, ok := g.tcpManager.GetDeviceByID(deviceID)
+	if !ok {
+		return nil
+	}
+	device.RLock()
+	defer device.RUnlock()
+	return device.Capabilities
+}
+
+// CheckCommandSupported 校验设备固件是否支持全部命令，不支持时返回 *capability.UnsupportedError；
+// 设备不在线时不拦截（由在线校验处理）
+func (g *DeviceGateway) CheckCommandSupported(deviceID string, commands ...byte) error {
+	if g.tcpManager == nil {
+		return nil
+	}
+	device, ok := g.tcpManager.GetDeviceByID(deviceID)
+	if !ok {
+		return nil
+	}
+	device.RLock()
+	set, version := device.Capabilities, device.DeviceVersion
+	device.RUnlock()
+	for _, cmd := range commands {
+		if !set.Supports(cmd) {
+			return &capability.UnsupportedError{DeviceID: device.DeviceID, Command: cmd, Version: version, Set: set}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 排队事件类型
+const (
+	ChargeQueueEventQueued  = "queued"  // 设备应答待充端口位图，请求进入排队
+	ChargeQueueEventStarted = "started" // 端口状态上报显示已开始充电
+	ChargeQueueEventTimeout = "timeout" // 排队超时
+)
+
+const (
+	defaultChargeQueueTimeout = 10 * time.Minute
+	chargeQueueCheckInterval  = 5 * time.Second
+)
+
+// QueuedCharge 设备侧排队中的充电请求
+// 注：AP3000协议未提供预计等待时长，仅能给出待充端口位图
+type QueuedCharge struct {
+	DeviceID      string    `json:"device_id"`
+	Port          int       `json:"port"` // 业务端口(从1开始)
+	OrderNo       string    `json:"orderNo"`
+	WaitPorts     uint16    `json:"wait_ports"`    // 原始待充端口位图
+	WaitingPorts  []int     `json:"waiting_ports"` // 位图展开后的等待端口(从1开始)
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	QueuedAt      time.Time `json:"queued_at"`
+	Deadline      time.Time `json:"deadline"`
+	TimedOut      bool      `json:"timed_out"` // 已超时告警但未自动取消
+}
+
+// ChargeQueueEvent 排队状态变化事件
+type ChargeQueueEvent struct {
+	Type          string        `json:"type"`
+	Charge        QueuedCharge  `json:"charge"`
+	Waited        time.Duration `json:"waited"`
+	AutoCancelled bool          `json:"auto_cancelled"`
+	CancelError   string        `json:"cancel_error,omitempty"`
+	At            time.Time     `json:"at"`
+}
+
+// ChargeQueueHandler 排队事件处理函数
+type ChargeQueueHandler func(event ChargeQueueEvent)
+
+// ChargeQueueTracker 设备侧排队跟踪器
+type ChargeQueueTracker struct {
+	mutex      sync.RWMutex
+	queued     map[string]*QueuedCharge // key: deviceID:port
+	enabled    bool
+	timeout    time.Duration
+	autoCancel bool
+	handlers   []ChargeQueueHandler
+}
+
+// NewChargeQueueTracker 创建排队跟踪器
+func NewChargeQueueTracker(cfg config.ChargeQueueConfig) *ChargeQueueTracker {
+	t := &ChargeQueueTracker{queued: make(map[string]*QueuedCharge)}
+	t.SetConfig(cfg)
+	return t
+}
+
+// SetConfig 更新排队配置
+func (t *ChargeQueueTracker) SetConfig(cfg config.ChargeQueueConfig) {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultChargeQueueTimeout
+	}
+	t.mutex.Lock()
+	t.enabled = cfg.Enabled
+	t.timeout = timeout
+	t.autoCancel = cfg.AutoCancel
+	t.mutex.Unlock()
+}
+
+// IsEnabled 是否启用排队识别
+func (t *ChargeQueueTracker) IsEnabled() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.enabled
+}
+
+// RegisterHandler 注册排队事件处理函数
+func (t *ChargeQueueTracker) RegisterHandler(handler ChargeQueueHandler) {
+	if handler == nil {
+		return
+	}
+	t.mutex.Lock()
+	t.handlers = append(t.handlers, handler)
+	t.mutex.Unlock()
+}
+
+// HandlerCount 已注册的排队事件处理函数数量
+func (t *ChargeQueueTracker) HandlerCount() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.handlers)
+}
+
+// Enqueue 记录排队请求（同端口重复应答时刷新位图，保留首次排队时间）
+func (t *ChargeQueueTracker) Enqueue(charge QueuedCharge, now time.Time) QueuedCharge {
+	key := makeChargeQueueKey(charge.DeviceID, charge.Port)
+	charge.WaitingPorts = expandWaitPorts(charge.WaitPorts)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if existing, ok := t.queued[key]; ok && existing.OrderNo == charge.OrderNo {
+		existing.WaitPorts = charge.WaitPorts
+		existing.WaitingPorts = charge.WaitingPorts
+		return *existing
+	}
+	charge.QueuedAt = now
+	charge.Deadline = now.Add(t.timeout)
+	t.queued[key] = &charge
+	return charge
+}
+
+// Get 获取端口排队信息
+func (t *ChargeQueueTracker) Get(deviceID string, port int) (QueuedCharge, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if c, ok := t.queued[makeChargeQueueKey(deviceID, port)]; ok {
+		return *c, true
+	}
+	return QueuedCharge{}, false
+}
+
+// List 列出全部排队请求（按排队时间升序）
+func (t *ChargeQueueTracker) List() []QueuedCharge {
+	t.mutex.RLock()
+	list := make([]QueuedCharge, 0, len(t.queued))
+	for _, c := range t.queued {
+		list = append(list, *c)
+	}
+	t.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].QueuedAt.Before(list[j].QueuedAt) })
+	return list
+}
+
+// Resolve 移除端口排队信息
+func (t *ChargeQueueTracker) Resolve(deviceID string, port int) (QueuedCharge, bool) {
+	key := makeChargeQueueKey(deviceID, port)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	c, ok := t.queued[key]
+	if !ok {
+		return QueuedCharge{}, false
+	}
+	delete(t.queued, key)
+	return *c, true
+}
+
+// collectExpired 收集到期且尚未告警的排队请求
+// 自动取消模式下直接移除；否则标记TimedOut，保留跟踪以便设备稍后开始充电时仍可转换状态
+func (t *ChargeQueueTracker) collectExpired(now time.Time) ([]QueuedCharge, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var expired []QueuedCharge
+	for key, c := range t.queued {
+		if c.TimedOut || now.Before(c.Deadline) {
+			continue
+		}
+		if t.autoCancel {
+			delete(t.queued, key)
+		} else {
+			c.TimedOut = true
+		}
+		expired = append(expired, *c)
+	}
+	return expired, t.autoCancel
+}
+
+// emit 分发排队事件（锁外执行处理函数）
+func (t *ChargeQueueTracker) emit(event ChargeQueueEvent) {
+	t.mutex.RLock()
+	handlers := make([]ChargeQueueHandler, len(t.handlers))
+	copy(handlers, t.handlers)
+	t.mutex.RUnlock()
+	for _, h := range handlers {
+		h(event)
+	}
+}
+
+func makeChargeQueueKey(deviceID string, port int) string {
+	return fmt.Sprintf("%s:%d", deviceID, port)
+}
+
+// expandWaitPorts 展开待充端口位图（bit0表示1号端口）
+func expandWaitPorts(waitPorts uint16) []int {
+	ports := make([]int, 0)
+	for i := 0; i < 16; i++ {
+		if waitPorts&(1<<uint(i)) != 0 {
+			ports = append(ports, i+1)
+		}
+	}
+	return ports
+}
+
+// IsPortQueued 判断0x82应答的待充端口位图是否表示当前端口排队
+// protocolPort 为协议端口(从0开始)，0xFF表示设备智能选择端口
+func IsPortQueued(protocolPort uint8, waitPorts uint16) bool {
+	if waitPorts == 0 {
+		return false
+	}
+	if protocolPort == 0xFF {
+		return true
+	}
+	return protocolPort < 16 && waitPorts&(1<<uint(protocolPort)) != 0
+}
+
+// ===============================
+// 网关集成
+// ===============================
+
+// GetChargeQueue 获取排队跟踪器
+func (g *DeviceGateway) GetChargeQueue() *ChargeQueueTracker {
+	return g.chargeQueue
+}
+
+// IsChargeQueueEnabled 是否启用排队识别
+func (g *DeviceGateway) IsChargeQueueEnabled() bool {
+	return g.chargeQueue != nil && g.chargeQueue.IsEnabled()
+}
+
+// MarkChargeQueued 设备受理充电但端口繁忙：会话置为排队，而非充电中
+func (g *DeviceGateway) MarkChargeQueued(deviceID string, port int, orderNo string, waitPorts uint16, correlationID string) QueuedCharge {
+	charge := g.chargeQueue.Enqueue(QueuedCharge{
+		DeviceID:      deviceID,
+		Port:          port,
+		OrderNo:       orderNo,
+		WaitPorts:     waitPorts,
+		CorrelationID: correlationID,
+	}, time.Now())
+
+	if order := g.orderManager.GetOrder(deviceID, port); order != nil && order.Status != OrderStatusQueued {
+		_ = g.orderManager.UpdateOrderStatus(deviceID, port, OrderStatusQueued, "设备端口繁忙，排队等待")
+	}
+	sm := g.stateMachineManager.GetOrCreateStateMachine(deviceID, port)
+	if orderNo != "" {
+		sm.SetOrderNo(orderNo)
+	}
+	if err := sm.TransitionTo(StateQueued, ReasonDeviceResponse, map[string]interface{}{"wait_ports": fmt.Sprintf("0x%04X", waitPorts)}); err != nil {
+		logger.WithFields(logrus.Fields{
+			"correlationID": correlationID,
+			"deviceID":      deviceID,
+			"port":          port,
+			"error":         err.Error(),
+		}).Warn("排队状态转换失败")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": correlationID,
+		"deviceID":      deviceID,
+		"port":          port,
+		"orderNo":       orderNo,
+		"waitPorts":     fmt.Sprintf("0x%04X", waitPorts),
+		"waitingPorts":  charge.WaitingPorts,
+		"deadline":      charge.Deadline.Format(time.RFC3339),
+	}).Info("⏳ 充电请求设备侧排队")
+
+	g.chargeQueue.emit(ChargeQueueEvent{Type: ChargeQueueEventQueued, Charge: charge, At: time.Now()})
+	return charge
+}
+
+// OnPortStatusReport 端口状态上报（心跳/功率心跳），排队端口开始充电时转换会话状态
+// port 为业务端口(从1开始)，返回是否发生排队→充电转换
+func (g *DeviceGateway) OnPortStatusReport(deviceID string, port int, protocolStatus uint8) bool {
+	if g.chargeQueue == nil || (protocolStatus != 1 && protocolStatus != 5) {
+		return false
+	}
+	charge, ok := g.chargeQueue.Resolve(deviceID, port)
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	if order := g.orderManager.GetOrder(deviceID, port); order != nil && order.Status == OrderStatusQueued {
+		_ = g.orderManager.UpdateOrderStatus(deviceID, port, OrderStatusCharging, "排队结束，设备开始充电")
+	}
+	if sm := g.stateMachineManager.GetStateMachine(deviceID, port); sm != nil {
+		_ = sm.TransitionTo(StateCharging, ReasonHeartbeat, map[string]interface{}{"from_queue": true})
+	}
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": charge.CorrelationID,
+		"deviceID":      deviceID,
+		"port":          port,
+		"orderNo":       charge.OrderNo,
+		"waited":        now.Sub(charge.QueuedAt).String(),
+	}).Info("⚡ 排队结束，端口开始充电")
+
+	g.chargeQueue.emit(ChargeQueueEvent{Type: ChargeQueueEventStarted, Charge: charge, Waited: now.Sub(charge.QueuedAt), At: now})
+	return true
+}
+
+// CheckChargeQueueTimeouts 检查排队超时：告警，并按配置自动下发停止、取消订单
+func (g *DeviceGateway) CheckChargeQueueTimeouts(now time.Time) []ChargeQueueEvent {
+	expired, autoCancel := g.chargeQueue.collectExpired(now)
+	events := make([]ChargeQueueEvent, 0, len(expired))
+	for _, charge := range expired {
+		event := ChargeQueueEvent{
+			Type:   ChargeQueueEventTimeout,
+			Charge: charge,
+			Waited: now.Sub(charge.QueuedAt),
+			At:     now,
+		}
+		if autoCancel {
+			if err := g.SendChargingCommandWithCorrelation(charge.CorrelationID, charge.DeviceID, uint8(charge.Port), 0x00, charge.OrderNo, 0, 0, 0); err != nil {
+				event.CancelError = err.Error()
+			}
+			if order := g.orderManager.GetOrder(charge.DeviceID, charge.Port); order != nil && order.Status == OrderStatusQueued {
+				_ = g.orderManager.UpdateOrderStatus(charge.DeviceID, charge.Port, OrderStatusCancelled, "排队超时自动取消")
+			}
+			g.FinalizeChargingSession(charge.DeviceID, charge.Port, charge.OrderNo, "charge queue timeout auto-cancel")
+			event.AutoCancelled = true
+		}
+
+		logger.WithFields(logrus.Fields{
+			"correlationID": charge.CorrelationID,
+			"deviceID":      charge.DeviceID,
+			"port":          charge.Port,
+			"orderNo":       charge.OrderNo,
+			"waited":        event.Waited.String(),
+			"autoCancelled": event.AutoCancelled,
+			"cancelError":   event.CancelError,
+		}).Warn("⏰ 充电排队超时")
+
+		g.chargeQueue.emit(event)
+		events = append(events, event)
+	}
+	return events
+}
+
+// startChargeQueueWorker 启动排队超时检查协程
+func (g *DeviceGateway) startChargeQueueWorker() {
+	go func() {
+		ticker := time.NewTicker(chargeQueueCheckInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			g.CheckChargeQueueTimeouts(now)
+		}
+	}()
+}
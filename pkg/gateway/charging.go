@@ -1,11 +1,15 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/sirupsen/logrus"
 )
 
@@ -36,7 +40,7 @@ func (g *DeviceGateway) SendChargingCommand(deviceID string, port uint8, action
 		logger.WithFields(logrus.Fields{
 			"deviceID":     deviceID,
 			"command":      "CHARGE_CONTROL",
-			"commandID":    fmt.Sprintf("0x%02X", constants.CmdChargeControl),
+			"commandID":    dny_protocol.CommandLabel(constants.CmdChargeControl),
 			"port":         port,
 			"protocolPort": protocolPort,
 			"action":       actionStr,
@@ -50,7 +54,7 @@ func (g *DeviceGateway) SendChargingCommand(deviceID string, port uint8, action
 	logger.WithFields(logrus.Fields{
 		"deviceID":     deviceID,
 		"command":      "CHARGE_CONTROL",
-		"commandID":    fmt.Sprintf("0x%02X", constants.CmdChargeControl),
+		"commandID":    dny_protocol.CommandLabel(constants.CmdChargeControl),
 		"port":         port,
 		"protocolPort": protocolPort,
 		"action":       actionStr,
@@ -66,33 +70,176 @@ func (g *DeviceGateway) SendChargingCommand(deviceID string, port uint8, action
 
 // SendChargingCommandWithParams 发送完整参数的充电控制命令（0x82）
 func (g *DeviceGateway) SendChargingCommandWithParams(deviceID string, port uint8, action uint8, orderNo string, mode uint8, value uint16, balance uint32) error {
-	if deviceID == "" {
-		return fmt.Errorf("设备ID不能为空")
+	return g.SendChargingCommandWithCorrelation("", deviceID, port, action, orderNo, mode, value, balance)
+}
+
+// SendChargingCommandWithCorrelation 发送完整参数的充电控制命令（0x82），并携带链路追踪ID
+func (g *DeviceGateway) SendChargingCommandWithCorrelation(correlationID string, deviceID string, port uint8, action uint8, orderNo string, mode uint8, value uint16, balance uint32) error {
+	req := ChargeRequest{DeviceID: deviceID, Port: int(port), OrderNo: orderNo, Mode: mode, Value: value, Balance: balance}
+	_, _, err := g.sendChargingCommand(correlationID, req, action)
+	return err
+}
+
+// StartChargingWithRequest 开始充电（0x82），返回生效的促销（未命中为nil）
+func (g *DeviceGateway) StartChargingWithRequest(correlationID string, req ChargeRequest) (*AppliedPromotion, error) {
+	promo, _, err := g.sendChargingCommand(correlationID, req, 0x01)
+	return promo, err
+}
+
+// sendChargingCommand 下发0x82，返回生效的促销与可等待设备应答的命令句柄
+func (g *DeviceGateway) sendChargingCommand(correlationID string, req ChargeRequest, action uint8) (*AppliedPromotion, *network.CommandHandle, error) {
+	// 设备并发会话上限：校验与预占在下发前完成，订单创建（或下发失败）后归还预占
+	var admission *SessionAdmission
+	if action == 0x01 && g.sessionLimits != nil {
+		var err error
+		if admission, err = g.sessionLimits.Admit(req.DeviceID, req.Port); err != nil {
+			logger.WithFields(logrus.Fields{
+				"correlationID": correlationID,
+				"deviceID":      req.DeviceID,
+				"port":          req.Port,
+				"orderNo":       req.OrderNo,
+				"error":         err.Error(),
+			}).Warn("设备并发充电会话已达上限，拒绝开始充电")
+			return nil, nil, err
+		}
+		defer admission.Release()
+		if admission.Reduced {
+			req.OverloadPowerW = uint16(admission.OverloadPowerW)
+		}
 	}
-	if port == 0 {
-		return fmt.Errorf("端口号不能为0")
+
+	// 站点设置了功率预算：新会话按接入后的分配上限开始充电，订单创建后站点内其余会话重新分配
+	budgetStation, budgeted := "", false
+	if action == 0x01 && g.stations != nil {
+		budgetStation = g.stations.StationOf(req.DeviceID)
+		if limitW, ok := GetDynamicPowerController().AdmissionLimit(budgetStation, req.DeviceID, req.Port, int(req.OverloadPowerW)); ok {
+			req.OverloadPowerW = uint16(limitW)
+			budgeted = true
+		}
 	}
-	if len(orderNo) > 16 {
-		return fmt.Errorf("订单号长度超过限制：当前%d字节，最大16字节，订单号：%s", len(orderNo), orderNo)
+
+	req, promo, commandData, maxChargeDuration, err := g.buildChargingPayload(req, action)
+	if err != nil {
+		return nil, nil, err
+	}
+	deviceID, port, orderNo := req.DeviceID, uint8(req.Port), req.OrderNo
+	mode, actualValue, balance := req.Mode, req.Value, req.Balance
+
+	// 充电会话在下发前创建，避免设备应答先于会话到达
+	if action == 0x01 && orderNo != "" {
+		g.chargingSessions.OnRequested(deviceID, int(port), orderNo, time.Now())
+	}
+	handle, err := g.SendCommandToDeviceWithOptions(context.Background(), deviceID, constants.CmdChargeControl, commandData, network.CommandOptions{CorrelationID: correlationID})
+	if err != nil {
+		if action == 0x01 && orderNo != "" {
+			g.chargingSessions.OnRequestFailed(orderNo, err.Error(), time.Now())
+		}
+		logger.WithFields(logrus.Fields{
+			"correlationID": correlationID,
+			"deviceID":      deviceID,
+			"port":          port,
+			"orderNo":       orderNo,
+			"error":         err.Error(),
+		}).Error("❌ 完整参数充电控制命令发送失败")
+		return nil, nil, fmt.Errorf("发送充电控制命令失败: %v", err)
+	}
+
+	actionStr := actionDescStop
+	if action == 0x01 {
+		actionStr = actionDescStart
+	}
+	modeStr := "按时间"
+	if mode == 1 {
+		modeStr = "按电量"
+	}
+	logger.WithFields(logrus.Fields{
+		"correlationID":     correlationID,
+		"deviceID":          deviceID,
+		"port":              port,
+		"action":            actionStr,
+		"orderNo":           orderNo,
+		"mode":              modeStr,
+		"value":             actualValue,
+		"maxChargeDuration": maxChargeDuration,
+		"balance":           balance,
+		"unit":              getValueUnit(mode),
+		"promotion":         promotionTag(promo),
+		"overloadPowerW":    req.OverloadPowerW,
+	}).Info("🔧 修复最大充电时长后的完整参数充电控制命令发送成功")
+
+	// 🔧 修复CVE-Critical-001: 使用订单管理器替换简单的OrderContext
+	if action == 0x01 && orderNo != "" {
+		// 创建订单记录到订单管理器
+		if err := g.orderManager.CreateOrder(deviceID, int(port), orderNo, mode, actualValue, balance); err != nil {
+			logger.WithFields(logrus.Fields{
+				"correlationID": correlationID,
+				"deviceID":      deviceID,
+				"port":          port,
+				"orderNo":       orderNo,
+				"error":         err.Error(),
+			}).Warn("订单管理器创建订单失败，但充电命令已发送")
+			// 不返回错误，因为充电命令已经发送成功
+		} else {
+			// 订单创建成功，更新状态为充电中
+			g.orderManager.UpdateOrderStatus(deviceID, int(port), OrderStatusCharging, "充电命令发送成功")
+			if promo != nil {
+				_ = g.orderManager.SetOrderPromotion(deviceID, int(port), promo)
+			}
+			// 超出满功率名额降功率接入：记录过载功率并交由智能降功率从该值开始调整
+			if admission != nil && admission.Reduced {
+				_ = g.orderManager.SetOrderOverloadPower(deviceID, int(port), uint16(admission.OverloadPowerW))
+				GetDynamicPowerController().SeedOverload(deviceID, int(port), orderNo, admission.OverloadPowerW, time.Now())
+			}
+			if budgeted {
+				GetDynamicPowerController().NoteBudgetAdmission(budgetStation, deviceID, int(port), orderNo, int(req.OverloadPowerW))
+			}
+		}
+	}
+
+	return promo, handle, nil
+}
+
+// buildChargingPayload 校验参数并构造0x82命令数据（开始充电时先咨询促销策略），返回生效的请求、促销与最大充电时长
+func (g *DeviceGateway) buildChargingPayload(req ChargeRequest, action uint8) (ChargeRequest, *AppliedPromotion, []byte, uint16, error) {
+	if req.DeviceID == "" {
+		return req, nil, nil, 0, fmt.Errorf("设备ID不能为空")
+	}
+	if req.Port <= 0 {
+		return req, nil, nil, 0, fmt.Errorf("端口号不能为0")
+	}
+	if req.Port > 0xFF {
+		return req, nil, nil, 0, fmt.Errorf("端口号超出范围：%d", req.Port)
+	}
+	if len(req.OrderNo) > 16 {
+		return req, nil, nil, 0, fmt.Errorf("订单号长度超过限制：当前%d字节，最大16字节，订单号：%s", len(req.OrderNo), req.OrderNo)
 	}
 	if action > 1 {
-		return fmt.Errorf("充电动作无效：%d，有效值：0(停止)或1(开始)", action)
+		return req, nil, nil, 0, fmt.Errorf("充电动作无效：%d，有效值：0(停止)或1(开始)", action)
 	}
+
+	// 开始充电前咨询促销策略，可覆盖计费模式/余额/时长
+	var promo *AppliedPromotion
+	if action == 0x01 {
+		req, promo = g.applyPromotion(req)
+	}
+	port, orderNo := uint8(req.Port), req.OrderNo
+	mode, value, balance := req.Mode, req.Value, req.Balance
+
 	if action == 0x01 {
 		if mode > 1 {
-			return fmt.Errorf("充电模式无效：%d，有效值：0(按时间)或1(按电量)", mode)
+			return req, nil, nil, 0, fmt.Errorf("充电模式无效：%d，有效值：0(按时间)或1(按电量)", mode)
 		}
 		if mode == 0 && value == 0 {
-			return fmt.Errorf("按时间充电时，充电时长不能为0秒")
+			return req, nil, nil, 0, fmt.Errorf("按时间充电时，充电时长不能为0秒")
 		}
 		if mode == 1 && value == 0 {
-			return fmt.Errorf("按电量充电时，充电电量不能为0")
+			return req, nil, nil, 0, fmt.Errorf("按电量充电时，充电电量不能为0")
 		}
 		if balance == 0 {
-			return fmt.Errorf("余额不能为0")
+			return req, nil, nil, 0, fmt.Errorf("余额不能为0")
 		}
 		if value == 0 {
-			return fmt.Errorf("充电值不能为0")
+			return req, nil, nil, 0, fmt.Errorf("充电值不能为0")
 		}
 	}
 
@@ -129,7 +276,7 @@ func (g *DeviceGateway) SendChargingCommandWithParams(deviceID string, port uint
 	commandData[25] = byte(maxChargeDuration)
 	commandData[26] = byte(maxChargeDuration >> 8)
 
-	overloadPower := uint16(0)
+	overloadPower := req.OverloadPowerW // 0表示不限制
 	commandData[27] = byte(overloadPower)
 	commandData[28] = byte(overloadPower >> 8)
 	commandData[29] = 0 // 二维码灯：0=打开
@@ -141,48 +288,53 @@ func (g *DeviceGateway) SendChargingCommandWithParams(deviceID string, port uint
 	commandData[35] = 0 // 强制带充满自停
 	commandData[36] = 0 // 充满功率(单位1W)，此处关闭
 
-	if err := g.SendCommandToDevice(deviceID, constants.CmdChargeControl, commandData); err != nil {
-		return fmt.Errorf("发送充电控制命令失败: %v", err)
+	return req, promo, commandData, maxChargeDuration, nil
+}
+
+// StartChargeOrder 从0x82命令数据中取出开始充电的业务端口(从1开始)与订单号；非完整参数的开始充电命令返回 ok=false
+func StartChargeOrder(commandData []byte) (port int, orderNo string, ok bool) {
+	if len(commandData) < 25 || commandData[6] != 0x01 {
+		return 0, "", false
 	}
+	orderNo = string(bytes.TrimRight(commandData[9:25], "\x00"))
+	return int(commandData[5]) + 1, orderNo, orderNo != ""
+}
 
-	actionStr := actionDescStop
-	if action == 0x01 {
-		actionStr = actionDescStart
+// OnCommandFailed 命令放弃重发（命令管理器失败回调）：开始充电命令始终未得到设备应答时，
+// 仍在等待应答的充电会话与对应订单置为失败；设备已通过应答或功率心跳受理的订单不受影响
+func (g *DeviceGateway) OnCommandFailed(failure network.CommandFailure) {
+	if failure.Command != constants.CmdChargeControl {
+		return
 	}
-	modeStr := "按时间"
-	if mode == 1 {
-		modeStr = "按电量"
+	port, orderNo, ok := StartChargeOrder(failure.Data)
+	if !ok {
+		return
+	}
+	reason := fmt.Sprintf("开始充电命令发送%d次未得到设备应答: %s", failure.Attempts, failure.Reason)
+	if !g.chargingSessions.OnRequestUnanswered(orderNo, reason, failure.At) {
+		return
+	}
+	if order := g.orderManager.GetOrder(failure.DeviceID, port); order != nil && order.OrderNo == orderNo &&
+		(order.Status == OrderStatusPending || order.Status == OrderStatusCharging) {
+		_ = g.orderManager.UpdateOrderStatus(failure.DeviceID, port, OrderStatusFailed, reason)
 	}
 	logger.WithFields(logrus.Fields{
-		"deviceID":          deviceID,
-		"port":              port,
-		"action":            actionStr,
-		"orderNo":           orderNo,
-		"mode":              modeStr,
-		"value":             actualValue,
-		"maxChargeDuration": maxChargeDuration,
-		"balance":           balance,
-		"unit":              getValueUnit(mode),
-	}).Info("🔧 修复最大充电时长后的完整参数充电控制命令发送成功")
+		"correlationID": failure.CorrelationID,
+		"deviceID":      failure.DeviceID,
+		"port":          port,
+		"orderNo":       orderNo,
+		"messageID":     fmt.Sprintf("0x%04X", failure.MessageID),
+		"attempts":      failure.Attempts,
+		"outcome":       failure.Outcome,
+	}).Warn("开始充电命令重发耗尽未得到应答，订单已置为失败")
+}
 
-	// 🔧 修复CVE-Critical-001: 使用订单管理器替换简单的OrderContext
-	if action == 0x01 && orderNo != "" {
-		// 创建订单记录到订单管理器
-		if err := g.orderManager.CreateOrder(deviceID, int(port), orderNo, mode, actualValue, balance); err != nil {
-			logger.WithFields(logrus.Fields{
-				"deviceID": deviceID,
-				"port":     port,
-				"orderNo":  orderNo,
-				"error":    err.Error(),
-			}).Warn("订单管理器创建订单失败，但充电命令已发送")
-			// 不返回错误，因为充电命令已经发送成功
-		} else {
-			// 订单创建成功，更新状态为充电中
-			g.orderManager.UpdateOrderStatus(deviceID, int(port), OrderStatusCharging, "充电命令发送成功")
-		}
+// promotionTag 促销标签（日志用）
+func promotionTag(promo *AppliedPromotion) string {
+	if promo == nil {
+		return ""
 	}
-
-	return nil
+	return promo.Tag
 }
 
 // SendStopChargingCommand 发送停止充电命令
@@ -192,20 +344,51 @@ func (g *DeviceGateway) SendStopChargingCommand(deviceID string, port uint8, ord
 
 // UpdateChargingOverloadPower 仅更新过载功率/最大充电时长
 func (g *DeviceGateway) UpdateChargingOverloadPower(deviceID string, port uint8, orderNo string, overloadPowerW uint16, maxChargeDurationSeconds uint16) error {
+	return g.UpdateChargingOverloadPowerWithCorrelation("", deviceID, port, orderNo, overloadPowerW, maxChargeDurationSeconds)
+}
+
+// UpdateChargingOverloadPowerWithCorrelation 仅更新过载功率/最大充电时长，并将链路追踪ID写入命令条目与通信日志
+func (g *DeviceGateway) UpdateChargingOverloadPowerWithCorrelation(correlationID string, deviceID string, port uint8, orderNo string, overloadPowerW uint16, maxChargeDurationSeconds uint16) error {
+	payload, mode, value, balance, err := g.buildOverloadPayload(deviceID, port, orderNo, overloadPowerW, maxChargeDurationSeconds)
+	if err != nil {
+		return err
+	}
+
+	if err := g.SendCommandToDeviceWithCorrelation(correlationID, deviceID, constants.CmdChargeControl, payload); err != nil {
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"correlationID":            correlationID,
+		"deviceID":                 deviceID,
+		"port":                     port,
+		"orderNo":                  orderNo,
+		"overloadPowerW":           overloadPowerW,
+		"maxChargeDurationSeconds": maxChargeDurationSeconds,
+		"ctxMode":                  mode,
+		"ctxValue":                 value,
+		"ctxBalance":               balance,
+	}).Info("已下发0x82仅更新过载功率/最大时长")
+
+	return nil
+}
+
+// buildOverloadPayload 校验订单并构造仅更新过载功率/最大充电时长的0x82命令数据，返回沿用的订单计费参数
+func (g *DeviceGateway) buildOverloadPayload(deviceID string, port uint8, orderNo string, overloadPowerW uint16, maxChargeDurationSeconds uint16) ([]byte, uint8, uint16, uint32, error) {
 	if deviceID == "" {
-		return fmt.Errorf("设备ID不能为空")
+		return nil, 0, 0, 0, fmt.Errorf("设备ID不能为空")
 	}
 	if port == 0 {
-		return fmt.Errorf("端口号不能为0")
+		return nil, 0, 0, 0, fmt.Errorf("端口号不能为0")
 	}
 	if len(orderNo) > 16 {
-		return fmt.Errorf("订单号长度超过限制：%d", len(orderNo))
+		return nil, 0, 0, 0, fmt.Errorf("订单号长度超过限制：%d", len(orderNo))
 	}
 	if g.tcpManager == nil {
-		return fmt.Errorf("TCP管理器未初始化")
+		return nil, 0, 0, 0, fmt.Errorf("TCP管理器未初始化")
 	}
 	if !g.IsDeviceOnline(deviceID) {
-		return fmt.Errorf("设备不在线")
+		return nil, 0, 0, 0, fmt.Errorf("设备不在线")
 	}
 
 	// 🔧 修复CVE-Critical-001: 使用订单管理器获取订单信息
@@ -218,9 +401,9 @@ func (g *DeviceGateway) UpdateChargingOverloadPower(deviceID string, port uint8,
 			value = order.Value
 			balance = order.Balance
 		} else if order != nil {
-			return fmt.Errorf("订单号不匹配，当前订单: %s，请求更新订单: %s", order.OrderNo, orderNo)
+			return nil, 0, 0, 0, fmt.Errorf("订单号不匹配，当前订单: %s，请求更新订单: %s", order.OrderNo, orderNo)
 		} else {
-			return fmt.Errorf("未找到端口 %s:%d 上的进行中订单", deviceID, port)
+			return nil, 0, 0, 0, fmt.Errorf("未找到端口 %s:%d 上的进行中订单", deviceID, port)
 		}
 	}
 
@@ -249,22 +432,7 @@ func (g *DeviceGateway) UpdateChargingOverloadPower(deviceID string, port uint8,
 	payload[35] = 0
 	payload[36] = 0
 
-	if err := g.SendCommandToDevice(deviceID, constants.CmdChargeControl, payload); err != nil {
-		return err
-	}
-
-	logger.WithFields(logrus.Fields{
-		"deviceID":                 deviceID,
-		"port":                     port,
-		"orderNo":                  orderNo,
-		"overloadPowerW":           overloadPowerW,
-		"maxChargeDurationSeconds": maxChargeDurationSeconds,
-		"ctxMode":                  mode,
-		"ctxValue":                 value,
-		"ctxBalance":               balance,
-	}).Info("已下发0x82仅更新过载功率/最大时长")
-
-	return nil
+	return payload, mode, value, balance, nil
 }
 
 func getValueUnit(mode uint8) string {
@@ -0,0 +1,626 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// SessionState 充电会话生命周期状态
+type SessionState string
+
+// 充电会话状态
+const (
+	SessionRequested SessionState = "requested" // 已下发开始充电命令，等待设备应答
+	SessionStarted   SessionState = "started"   // 设备受理（0x82应答成功）
+	SessionCharging  SessionState = "charging"  // 收到充电中的功率心跳(0x06)
+	SessionSettling  SessionState = "settling"  // 收到结算(0x03)，核算电量与时长
+	SessionCompleted SessionState = "completed" // 结算完成
+	SessionFailed    SessionState = "failed"    // 设备拒绝、下发失败或应答超时
+	SessionRefunding SessionState = "refunding" // 结算电量为0，待退款
+)
+
+// sessionTransitions 合法的状态转换
+var sessionTransitions = map[SessionState][]SessionState{
+	SessionRequested: {SessionStarted, SessionFailed},
+	SessionStarted:   {SessionCharging, SessionSettling, SessionFailed},
+	SessionCharging:  {SessionSettling},
+	SessionSettling:  {SessionCompleted, SessionRefunding},
+}
+
+// ParseSessionState 解析会话状态名
+func ParseSessionState(name string) (SessionState, bool) {
+	switch s := SessionState(name); s {
+	case SessionRequested, SessionStarted, SessionCharging, SessionSettling, SessionCompleted, SessionFailed, SessionRefunding:
+		return s, true
+	}
+	return "", false
+}
+
+// IsTerminal 是否为结束状态
+func (s SessionState) IsTerminal() bool {
+	return s == SessionCompleted || s == SessionFailed || s == SessionRefunding
+}
+
+// CanTransitionTo 是否允许转换到目标状态
+func (s SessionState) CanTransitionTo(to SessionState) bool {
+	for _, next := range sessionTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// 会话事件（状态历史与异常记录的触发来源）
+const (
+	SessionEventRequested  = "requested"       // 下发开始充电命令
+	SessionEventSendFailed = "send_failed"     // 命令下发失败
+	SessionEventResponse   = "charge_response" // 0x82应答
+	SessionEventPower      = "power_heartbeat" // 0x06功率心跳
+	SessionEventSettlement = "settlement"      // 0x03结算
+	SessionEventExpired    = "expired"         // 等待应答超时
+	SessionEventUnanswered = "command_failed"  // 开始充电命令重发耗尽仍未应答
+)
+
+const (
+	defaultSessionRequestedTimeout = 5 * time.Minute
+	defaultSessionRetention        = 24 * time.Hour
+	defaultSessionRedisKey         = "iot:charging_sessions"
+	sessionAnomalyLimit            = 200
+	sessionCheckInterval           = 30 * time.Second
+)
+
+// ChargingSessionRecordType 充电会话的持久化类型（单个快照，加载时旧版本立即迁移并回写）
+const (
+	ChargingSessionRecordType    = "charging_sessions"
+	chargingSessionRecordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(ChargingSessionRecordType, chargingSessionRecordVersion)
+}
+
+// ErrSessionNotFound 充电会话不存在
+var ErrSessionNotFound = errors.New("充电会话不存在")
+
+// SessionTransition 会话状态转换记录
+type SessionTransition struct {
+	From  SessionState `json:"from,omitempty"`
+	To    SessionState `json:"to"`
+	Event string       `json:"event"`
+	At    time.Time    `json:"at"`
+}
+
+// ChargingSession 单个订单的充电会话
+type ChargingSession struct {
+	DeviceID        string              `json:"deviceId"`
+	Port            int                 `json:"port"` // 业务端口(从1开始)
+	OrderNo         string              `json:"orderNo"`
+	State           SessionState        `json:"state"`
+	RequestedAt     time.Time           `json:"requestedAt"`
+	StartedAt       *time.Time          `json:"startedAt,omitempty"`
+	SettledAt       *time.Time          `json:"settledAt,omitempty"`
+	EndedAt         *time.Time          `json:"endedAt,omitempty"`
+	EnergyWh        uint32              `json:"energyWh"`        // 结算电量，结算前为功率心跳累计电量
+	DurationSeconds int64               `json:"durationSeconds"` // 结算充电时长，结算前为功率心跳充电时长
+	LastPowerW      float64             `json:"lastPowerW"`
+	PeakPowerW      float64             `json:"peakPowerW"`
+	Heartbeats      int                 `json:"heartbeats"` // 收到的功率心跳数
+	StopReason      uint8               `json:"stopReason,omitempty"`
+	FailureReason   string              `json:"failureReason,omitempty"`
+	UpdatedAt       time.Time           `json:"updatedAt"`
+	History         []SessionTransition `json:"history"`
+}
+
+// SessionAnomaly 非法状态转换或未知订单事件
+type SessionAnomaly struct {
+	DeviceID string       `json:"deviceId"`
+	Port     int          `json:"port"`
+	OrderNo  string       `json:"orderNo"`
+	Event    string       `json:"event"`
+	State    SessionState `json:"state,omitempty"` // 事件到达时会话所处状态，未知订单为空
+	Reason   string       `json:"reason"`
+	At       time.Time    `json:"at"`
+}
+
+// SessionFilter 会话列表过滤条件（零值不过滤）
+type SessionFilter struct {
+	DeviceID string
+	State    SessionState
+}
+
+// PowerSample 功率心跳中与会话相关的字段
+type PowerSample struct {
+	PowerW          float64
+	EnergyWh        uint32
+	DurationSeconds int64
+}
+
+// SettlementReport 结算中与会话相关的字段
+type SettlementReport struct {
+	EnergyWh        uint32
+	DurationSeconds int64
+	StopReason      uint8
+}
+
+// ChargingSessionStore 充电会话持久化
+type ChargingSessionStore interface {
+	Load() ([]ChargingSession, error) // 无记录时返回 nil, nil
+	Save(sessions []ChargingSession) error
+}
+
+// ChargingSessionManager 按订单跟踪充电会话生命周期：0x82应答、0x06功率心跳与0x03结算驱动状态转换，
+// 非法转换与未知订单的结算不改变会话，记入异常
+type ChargingSessionManager struct {
+	mutex            sync.RWMutex
+	sessions         map[string]*ChargingSession // key: orderNo
+	active           map[string]string           // key: deviceID:port → 未结束会话的orderNo
+	anomalies        []SessionAnomaly
+	requestedTimeout time.Duration
+	retention        time.Duration
+
+	store ChargingSessionStore
+	dirty bool
+}
+
+// NewChargingSessionManager 创建充电会话管理器
+func NewChargingSessionManager(cfg config.ChargingSessionsConfig) *ChargingSessionManager {
+	m := &ChargingSessionManager{
+		sessions: make(map[string]*ChargingSession),
+		active:   make(map[string]string),
+	}
+	m.SetConfig(cfg)
+	return m
+}
+
+// SetConfig 更新超时与保留配置
+func (m *ChargingSessionManager) SetConfig(cfg config.ChargingSessionsConfig) {
+	timeout := time.Duration(cfg.RequestedTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultSessionRequestedTimeout
+	}
+	retention := time.Duration(cfg.RetentionSeconds) * time.Second
+	if retention <= 0 {
+		retention = defaultSessionRetention
+	}
+	m.mutex.Lock()
+	m.requestedTimeout = timeout
+	m.retention = retention
+	m.mutex.Unlock()
+}
+
+// OnRequested 即将下发开始充电命令：创建会话；同端口仍在等待应答的旧会话置为失败
+func (m *ChargingSessionManager) OnRequested(deviceID string, port int, orderNo string, now time.Time) {
+	if orderNo == "" {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if existing, ok := m.sessions[orderNo]; ok && !existing.State.IsTerminal() {
+		m.flagLocked(existing.DeviceID, existing.Port, orderNo, SessionEventRequested, existing.State, "订单已有进行中的会话", now)
+		return
+	}
+	key := makeSessionPortKey(deviceID, port)
+	claimPort := true
+	if prev, ok := m.sessions[m.active[key]]; ok && !prev.State.IsTerminal() {
+		if prev.State == SessionRequested {
+			prev.FailureReason = fmt.Sprintf("同端口新订单%s取代", orderNo)
+			m.transitionLocked(prev, SessionFailed, SessionEventRequested, now)
+		} else {
+			// 端口仍在充电：新会话只按订单号跟踪，端口索引保留给进行中的会话
+			claimPort = false
+		}
+	}
+	m.sessions[orderNo] = &ChargingSession{
+		DeviceID:    deviceID,
+		Port:        port,
+		OrderNo:     orderNo,
+		State:       SessionRequested,
+		RequestedAt: now,
+		UpdatedAt:   now,
+		History:     []SessionTransition{{To: SessionRequested, Event: SessionEventRequested, At: now}},
+	}
+	if claimPort {
+		m.active[key] = orderNo
+	}
+	m.dirty = true
+}
+
+// OnRequestFailed 开始充电命令未能下发：会话置为失败
+func (m *ChargingSessionManager) OnRequestFailed(orderNo, reason string, now time.Time) {
+	m.failRequested(orderNo, reason, SessionEventSendFailed, now)
+}
+
+// OnRequestUnanswered 开始充电命令重发耗尽仍未得到应答：仍在等待应答的会话置为失败，返回是否转换
+// （已收到应答或功率心跳的会话说明设备已受理，不受影响）
+func (m *ChargingSessionManager) OnRequestUnanswered(orderNo, reason string, now time.Time) bool {
+	return m.failRequested(orderNo, reason, SessionEventUnanswered, now)
+}
+
+func (m *ChargingSessionManager) failRequested(orderNo, reason, event string, now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s, ok := m.sessions[orderNo]
+	if !ok || s.State != SessionRequested {
+		return false
+	}
+	s.FailureReason = reason
+	m.transitionLocked(s, SessionFailed, event, now)
+	return true
+}
+
+// OnChargeResponse 设备0x82应答：受理置为started，拒绝置为failed；
+// 简短应答不含订单号时按端口匹配等待应答的会话。非requested状态的应答（如停止充电的应答）不改变会话
+func (m *ChargingSessionManager) OnChargeResponse(deviceID string, port int, orderNo string, accepted bool, reason string, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s := m.lookupLocked(deviceID, port, orderNo)
+	if s == nil {
+		if orderNo != "" {
+			m.flagLocked(deviceID, port, orderNo, SessionEventResponse, "", "未知订单的充电控制应答", now)
+		}
+		return
+	}
+	if s.State != SessionRequested {
+		return
+	}
+	if accepted {
+		s.StartedAt = timePtr(now)
+		m.transitionLocked(s, SessionStarted, SessionEventResponse, now)
+		return
+	}
+	s.FailureReason = reason
+	m.transitionLocked(s, SessionFailed, SessionEventResponse, now)
+}
+
+// OnPowerHeartbeat 充电中的功率心跳：started转为charging并记录功率、累计电量与时长。
+// 未知订单（如刷卡离线启动）不跟踪；已结束会话仍收到功率心跳记入异常
+func (m *ChargingSessionManager) OnPowerHeartbeat(deviceID string, port int, orderNo string, sample PowerSample, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s := m.lookupLocked(deviceID, port, orderNo)
+	if s == nil {
+		return
+	}
+	switch s.State {
+	case SessionRequested:
+		// 应答丢失但设备已开始充电：功率心跳即视为受理
+		s.StartedAt = timePtr(now)
+		m.transitionLocked(s, SessionStarted, SessionEventPower, now)
+		fallthrough
+	case SessionStarted:
+		m.transitionLocked(s, SessionCharging, SessionEventPower, now)
+	case SessionCharging:
+	default:
+		m.flagLocked(deviceID, port, s.OrderNo, SessionEventPower, s.State, "会话已结束仍收到功率心跳", now)
+		return
+	}
+	s.Heartbeats++
+	s.LastPowerW = sample.PowerW
+	if sample.PowerW > s.PeakPowerW {
+		s.PeakPowerW = sample.PowerW
+	}
+	s.EnergyWh = sample.EnergyWh
+	s.DurationSeconds = sample.DurationSeconds
+	s.UpdatedAt = now
+	m.dirty = true
+}
+
+// OnSettlement 设备结算：经settling转为completed（电量为0时转为refunding），返回结算后的会话。
+// 未知订单、未受理或已失败的会话收到结算记入异常并返回 ErrSessionNotFound 或非法转换错误；同一结算重复上报不重复处理
+func (m *ChargingSessionManager) OnSettlement(deviceID string, port int, orderNo string, report SettlementReport, now time.Time) (ChargingSession, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s, ok := m.sessions[orderNo]
+	if !ok || orderNo == "" {
+		m.flagLocked(deviceID, port, orderNo, SessionEventSettlement, "", "未知订单的结算", now)
+		return ChargingSession{}, ErrSessionNotFound
+	}
+	if (s.State == SessionCompleted || s.State == SessionRefunding) && s.SettledAt != nil {
+		return s.clone(), nil
+	}
+	if !s.State.CanTransitionTo(SessionSettling) {
+		m.flagLocked(deviceID, port, orderNo, SessionEventSettlement, s.State, fmt.Sprintf("%s状态的会话不能结算", s.State), now)
+		return s.clone(), fmt.Errorf("非法的会话状态转换: %s → %s", s.State, SessionSettling)
+	}
+	m.transitionLocked(s, SessionSettling, SessionEventSettlement, now)
+	s.SettledAt = timePtr(now)
+	s.EnergyWh = report.EnergyWh
+	s.DurationSeconds = report.DurationSeconds
+	s.StopReason = report.StopReason
+	if report.EnergyWh > 0 {
+		m.transitionLocked(s, SessionCompleted, SessionEventSettlement, now)
+	} else {
+		m.transitionLocked(s, SessionRefunding, SessionEventSettlement, now)
+	}
+	return s.clone(), nil
+}
+
+// ExpireRequested 等待应答超时的会话置为失败，返回超时的订单号
+func (m *ChargingSessionManager) ExpireRequested(now time.Time) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var expired []string
+	for orderNo, s := range m.sessions {
+		if s.State == SessionRequested && now.Sub(s.RequestedAt) > m.requestedTimeout {
+			s.FailureReason = fmt.Sprintf("%s内未收到设备应答", m.requestedTimeout)
+			m.transitionLocked(s, SessionFailed, SessionEventExpired, now)
+			expired = append(expired, orderNo)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// Prune 移除超过保留时长的已结束会话，返回移除数量
+func (m *ChargingSessionManager) Prune(now time.Time) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	removed := 0
+	for orderNo, s := range m.sessions {
+		if s.State.IsTerminal() && s.EndedAt != nil && now.Sub(*s.EndedAt) > m.retention {
+			delete(m.sessions, orderNo)
+			removed++
+		}
+	}
+	if removed > 0 {
+		m.dirty = true
+	}
+	return removed
+}
+
+// Get 按订单号查询会话
+func (m *ChargingSessionManager) Get(orderNo string) (ChargingSession, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if s, ok := m.sessions[orderNo]; ok {
+		return s.clone(), true
+	}
+	return ChargingSession{}, false
+}
+
+// List 列出会话（按下发时间升序）
+func (m *ChargingSessionManager) List(filter SessionFilter) []ChargingSession {
+	m.mutex.RLock()
+	list := make([]ChargingSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		if filter.DeviceID != "" && s.DeviceID != filter.DeviceID {
+			continue
+		}
+		if filter.State != "" && s.State != filter.State {
+			continue
+		}
+		list = append(list, s.clone())
+	}
+	m.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].RequestedAt.Equal(list[j].RequestedAt) {
+			return list[i].OrderNo < list[j].OrderNo
+		}
+		return list[i].RequestedAt.Before(list[j].RequestedAt)
+	})
+	return list
+}
+
+// Anomalies 最近的异常记录（按时间升序）
+func (m *ChargingSessionManager) Anomalies() []SessionAnomaly {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]SessionAnomaly(nil), m.anomalies...)
+}
+
+// AttachStore 挂接持久化并载入已保存的会话（内存中同订单号的会话优先）
+func (m *ChargingSessionManager) AttachStore(store ChargingSessionStore) (int, error) {
+	sessions, err := store.Load()
+	if err != nil {
+		return 0, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.store = store
+	loaded := 0
+	for i := range sessions {
+		s := sessions[i]
+		if _, exists := m.sessions[s.OrderNo]; exists || s.OrderNo == "" {
+			continue
+		}
+		m.sessions[s.OrderNo] = &s
+		if !s.State.IsTerminal() {
+			m.active[makeSessionPortKey(s.DeviceID, s.Port)] = s.OrderNo
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// Flush 有变化时写入持久化
+func (m *ChargingSessionManager) Flush() error {
+	m.mutex.Lock()
+	if m.store == nil || !m.dirty {
+		m.mutex.Unlock()
+		return nil
+	}
+	store := m.store
+	all := make([]ChargingSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		all = append(all, s.clone())
+	}
+	m.dirty = false
+	m.mutex.Unlock()
+
+	if err := store.Save(all); err != nil {
+		m.mutex.Lock()
+		m.dirty = true
+		m.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// lookupLocked 按订单号查找会话，订单号为空时按端口查找未结束的会话
+func (m *ChargingSessionManager) lookupLocked(deviceID string, port int, orderNo string) *ChargingSession {
+	if orderNo != "" {
+		return m.sessions[orderNo]
+	}
+	return m.sessions[m.active[makeSessionPortKey(deviceID, port)]]
+}
+
+// transitionLocked 执行状态转换并记录历史；进入结束状态时释放端口
+func (m *ChargingSessionManager) transitionLocked(s *ChargingSession, to SessionState, event string, now time.Time) {
+	s.History = append(s.History, SessionTransition{From: s.State, To: to, Event: event, At: now})
+	s.State = to
+	s.UpdatedAt = now
+	if to.IsTerminal() {
+		s.EndedAt = timePtr(now)
+		key := makeSessionPortKey(s.DeviceID, s.Port)
+		if m.active[key] == s.OrderNo {
+			delete(m.active, key)
+		}
+	}
+	m.dirty = true
+
+	logger.WithFields(logrus.Fields{
+		"deviceID": s.DeviceID,
+		"port":     s.Port,
+		"orderNo":  s.OrderNo,
+		"from":     s.History[len(s.History)-1].From,
+		"to":       to,
+		"event":    event,
+	}).Info("充电会话状态变更")
+}
+
+// flagLocked 记录异常（保留最近 sessionAnomalyLimit 条）
+func (m *ChargingSessionManager) flagLocked(deviceID string, port int, orderNo, event string, state SessionState, reason string, now time.Time) {
+	anomaly := SessionAnomaly{DeviceID: deviceID, Port: port, OrderNo: orderNo, Event: event, State: state, Reason: reason, At: now}
+	m.anomalies = append(m.anomalies, anomaly)
+	if len(m.anomalies) > sessionAnomalyLimit {
+		m.anomalies = m.anomalies[len(m.anomalies)-sessionAnomalyLimit:]
+	}
+	logger.WithFields(logrus.Fields{
+		"deviceID": deviceID,
+		"port":     port,
+		"orderNo":  orderNo,
+		"event":    event,
+		"state":    state,
+		"reason":   reason,
+	}).Warn("⚠️ 充电会话异常事件")
+}
+
+func (s *ChargingSession) clone() ChargingSession {
+	c := *s
+	c.History = append([]SessionTransition(nil), s.History...)
+	return c
+}
+
+func makeSessionPortKey(deviceID string, port int) string {
+	return fmt.Sprintf("%s:%d", deviceID, port)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// RedisChargingSessionStore Redis持久化（JSON存储在单个键下）
+type RedisChargingSessionStore struct {
+	client  *redis.Client
+	key     string
+	timeout time.Duration
+}
+
+// NewRedisChargingSessionStore 创建Redis持久化
+func NewRedisChargingSessionStore(client *redis.Client, key string) *RedisChargingSessionStore {
+	if key == "" {
+		key = defaultSessionRedisKey
+	}
+	return &RedisChargingSessionStore{client: client, key: key, timeout: 3 * time.Second}
+}
+
+// Load 读取会话，键不存在视为无记录
+func (s *RedisChargingSessionStore) Load() ([]ChargingSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	data, err := s.client.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取Redis充电会话失败: %w", err)
+	}
+	var sessions []ChargingSession
+	migrated, err := persistence.Decode(ChargingSessionRecordType, data, &sessions)
+	if errors.Is(err, persistence.ErrRecordArchived) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析Redis充电会话失败: %w", err)
+	}
+	if migrated {
+		if err := s.Save(sessions); err != nil {
+			return nil, fmt.Errorf("回写迁移后的Redis充电会话失败: %w", err)
+		}
+	}
+	return sessions, nil
+}
+
+// Save 写入会话
+func (s *RedisChargingSessionStore) Save(sessions []ChargingSession) error {
+	data, err := persistence.Encode(ChargingSessionRecordType, sessions)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return infraredis.SetOrSpool(ctx, s.client, s.key, data)
+}
+
+// GetChargingSessions 获取充电会话管理器
+func (g *DeviceGateway) GetChargingSessions() *ChargingSessionManager {
+	return g.chargingSessions
+}
+
+// AttachChargingSessionStore 按配置挂接充电会话持久化（store=redis 时需已连接Redis）
+func (g *DeviceGateway) AttachChargingSessionStore(cfg config.ChargingSessionsConfig) error {
+	switch cfg.Store {
+	case "", "memory":
+		return nil
+	case "redis":
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("充电会话配置为redis存储，但Redis未连接")
+		}
+		loaded, err := g.chargingSessions.AttachStore(NewRedisChargingSessionStore(client, cfg.RedisKey))
+		if err != nil {
+			return err
+		}
+		logger.WithFields(logrus.Fields{"loaded": loaded}).Info("充电会话已从Redis恢复")
+		return nil
+	default:
+		return fmt.Errorf("不支持的充电会话存储方式: %s", cfg.Store)
+	}
+}
+
+// startChargingSessionWorker 定期检查等待应答超时、清理过期会话并持久化
+func (g *DeviceGateway) startChargingSessionWorker() {
+	go func() {
+		ticker := time.NewTicker(sessionCheckInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			g.chargingSessions.ExpireRequested(now)
+			g.chargingSessions.Prune(now)
+			if err := g.chargingSessions.Flush(); err != nil {
+				logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("充电会话持久化失败")
+			}
+		}
+	}()
+}
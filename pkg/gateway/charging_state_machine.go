@@ -20,6 +20,7 @@ const (
 	StateCompleted                          // 充电完成
 	StateFault                              // 故障状态
 	StateEmergencyStop                      // 紧急停止
+	StateQueued                             // 设备侧排队（端口繁忙，等待开始充电）
 )
 
 // String 返回充电状态的字符串表示
@@ -39,6 +40,8 @@ func (s ChargingState) String() string {
 		return "fault"
 	case StateEmergencyStop:
 		return "emergency_stop"
+	case StateQueued:
+		return "queued"
 	default:
 		return fmt.Sprintf("unknown(%d)", int(s))
 	}
@@ -82,6 +85,7 @@ type ChargingStateMachine struct {
 	mutex        sync.RWMutex
 	lastUpdate   time.Time
 	stateHistory []StateChange // 状态变更历史
+	closed       bool          // 已关闭，停止投递状态变更事件
 }
 
 // NewChargingStateMachine 创建新的充电状态机
@@ -94,11 +98,14 @@ func NewChargingStateMachine(deviceID string, port int) *ChargingStateMachine {
 		lastUpdate:   time.Now(),
 		stateHistory: make([]StateChange, 0, 50), // 保留最近50个状态变更
 		transitions: map[ChargingState][]ChargingState{
-			// 空闲状态可以转换到：已插枪、故障
-			StateIdle: {StatePlugged, StateFault},
+			// 空闲状态可以转换到：已插枪、排队、故障
+			StateIdle: {StatePlugged, StateQueued, StateFault},
 
-			// 已插枪可以转换到：正在充电、空闲、故障
-			StatePlugged: {StateCharging, StateIdle, StateFault},
+			// 已插枪可以转换到：正在充电、排队、空闲、故障
+			StatePlugged: {StateCharging, StateQueued, StateIdle, StateFault},
+
+			// 排队可以转换到：正在充电（设备开始执行）、空闲（超时取消/停止）、已插枪、故障
+			StateQueued: {StateCharging, StateIdle, StatePlugged, StateFault},
 
 			// 正在充电可以转换到：浮充、完成、故障、紧急停止、空闲（拔枪）
 			StateCharging: {StateFloatCharging, StateCompleted, StateFault, StateEmergencyStop, StateIdle},
@@ -201,8 +208,8 @@ func (csm *ChargingStateMachine) TransitionTo(newState ChargingState, reason Sta
 		"data":      data,
 	}).Info("🔄 充电状态机状态转换")
 
-	// 异步发送状态变更事件
-	go func() {
+	// 非阻塞投递状态变更事件（持锁投递，避免与Close并发导致向已关闭通道发送）
+	if !csm.closed {
 		select {
 		case csm.stateChanges <- change:
 		default:
@@ -213,7 +220,7 @@ func (csm *ChargingStateMachine) TransitionTo(newState ChargingState, reason Sta
 				"change":   change,
 			}).Warn("状态变更队列已满，丢弃事件")
 		}
-	}()
+	}
 
 	return nil
 }
@@ -308,10 +315,15 @@ func (csm *ChargingStateMachine) CanStartCharging() bool {
 	return state == StateIdle || state == StatePlugged
 }
 
-// CanStopCharging 判断是否可以停止充电
+// CanStopCharging 判断是否可以停止充电（排队中的请求同样允许取消）
 func (csm *ChargingStateMachine) CanStopCharging() bool {
 	state := csm.GetCurrentState()
-	return state == StateCharging || state == StateFloatCharging
+	return state == StateCharging || state == StateFloatCharging || state == StateQueued
+}
+
+// IsQueued 判断是否处于设备侧排队状态
+func (csm *ChargingStateMachine) IsQueued() bool {
+	return csm.GetCurrentState() == StateQueued
 }
 
 // GetStateChanges 获取状态变更通道（用于监听状态变更）
@@ -321,9 +333,12 @@ func (csm *ChargingStateMachine) GetStateChanges() <-chan StateChange {
 
 // Close 关闭状态机
 func (csm *ChargingStateMachine) Close() {
-	if csm.stateChanges != nil {
+	csm.mutex.Lock()
+	if csm.stateChanges != nil && !csm.closed {
 		close(csm.stateChanges)
 	}
+	csm.closed = true
+	csm.mutex.Unlock()
 
 	logger.WithFields(logrus.Fields{
 		"deviceID":   csm.deviceID,
@@ -0,0 +1,309 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 模板存储错误
+var (
+	ErrConfigTemplateNotFound = errors.New("配置模板不存在")
+	ErrConfigTemplateExists   = errors.New("配置模板已存在")
+)
+
+// 字段核对结果
+const (
+	ConfigDiffMatch    = "match"
+	ConfigDiffMismatch = "mismatch"
+	ConfigDiffMissing  = "missing" // 设备未返回该字段（分段缺失或旧固件无此字段）
+)
+
+// ConfigTemplate 黄金配置模板（每次更新生成新版本）
+type ConfigTemplate struct {
+	Name        string                            `json:"name"`
+	Version     int                               `json:"version"`
+	Description string                            `json:"description,omitempty"`
+	Sections    map[string]map[string]interface{} `json:"sections"` // 仅列出需要核对的字段
+	UpdatedAt   time.Time                         `json:"updated_at"`
+}
+
+// ConfigTemplateStore 黄金配置模板存储（内存，配置了文件路径时每次变更整体写入JSON文件）
+type ConfigTemplateStore struct {
+	mutex     sync.RWMutex
+	templates map[string][]ConfigTemplate // name → 各版本（旧→新）
+	path      string
+}
+
+// NewConfigTemplateStore 创建模板存储，path为空时仅保存在内存
+func NewConfigTemplateStore(path string) *ConfigTemplateStore {
+	s := &ConfigTemplateStore{templates: make(map[string][]ConfigTemplate), path: path}
+	if err := s.load(); err != nil {
+		logger.WithFields(logrus.Fields{"path": path, "error": err.Error()}).Warn("加载配置模板文件失败，使用空模板库")
+	}
+	return s
+}
+
+// ValidateConfigTemplate 校验模板分段与字段名称均为已知字段
+func ValidateConfigTemplate(sections map[string]map[string]interface{}) error {
+	if len(sections) == 0 {
+		return fmt.Errorf("模板至少需要一个分段")
+	}
+	for name, fields := range sections {
+		spec, ok := configSectionByName(name)
+		if !ok {
+			return fmt.Errorf("未知配置分段: %s", name)
+		}
+		for field := range fields {
+			if !spec.hasField(field) {
+				return fmt.Errorf("分段 %s 不存在字段: %s", name, field)
+			}
+		}
+	}
+	return nil
+}
+
+func (s configSectionSpec) hasField(name string) bool {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Create 创建模板（版本1）
+func (s *ConfigTemplateStore) Create(name, description string, sections map[string]map[string]interface{}) (ConfigTemplate, error) {
+	if name == "" {
+		return ConfigTemplate{}, fmt.Errorf("模板名称不能为空")
+	}
+	if err := ValidateConfigTemplate(sections); err != nil {
+		return ConfigTemplate{}, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.templates[name]; exists {
+		return ConfigTemplate{}, fmt.Errorf("%w: %s", ErrConfigTemplateExists, name)
+	}
+	tpl := ConfigTemplate{Name: name, Version: 1, Description: description, Sections: sections, UpdatedAt: time.Now()}
+	s.templates[name] = []ConfigTemplate{tpl}
+	return tpl, s.saveLocked()
+}
+
+// Update 更新模板（生成新版本，历史版本保留）
+func (s *ConfigTemplateStore) Update(name, description string, sections map[string]map[string]interface{}) (ConfigTemplate, error) {
+	if err := ValidateConfigTemplate(sections); err != nil {
+		return ConfigTemplate{}, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	versions, exists := s.templates[name]
+	if !exists {
+		return ConfigTemplate{}, fmt.Errorf("%w: %s", ErrConfigTemplateNotFound, name)
+	}
+	tpl := ConfigTemplate{
+		Name:        name,
+		Version:     versions[len(versions)-1].Version + 1,
+		Description: description,
+		Sections:    sections,
+		UpdatedAt:   time.Now(),
+	}
+	s.templates[name] = append(versions, tpl)
+	return tpl, s.saveLocked()
+}
+
+// Get 获取模板指定版本，version<=0 返回最新版本
+func (s *ConfigTemplateStore) Get(name string, version int) (ConfigTemplate, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	versions := s.templates[name]
+	if len(versions) == 0 {
+		return ConfigTemplate{}, false
+	}
+	if version <= 0 {
+		return versions[len(versions)-1], true
+	}
+	for _, tpl := range versions {
+		if tpl.Version == version {
+			return tpl, true
+		}
+	}
+	return ConfigTemplate{}, false
+}
+
+// Versions 模板全部版本（新→旧）
+func (s *ConfigTemplateStore) Versions(name string) []ConfigTemplate {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	versions := s.templates[name]
+	list := make([]ConfigTemplate, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		list = append(list, versions[i])
+	}
+	return list
+}
+
+// List 各模板的最新版本（按名称排序）
+func (s *ConfigTemplateStore) List() []ConfigTemplate {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	list := make([]ConfigTemplate, 0, len(s.templates))
+	for _, versions := range s.templates {
+		list = append(list, versions[len(versions)-1])
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete 删除模板及其全部版本
+func (s *ConfigTemplateStore) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.templates[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrConfigTemplateNotFound, name)
+	}
+	delete(s.templates, name)
+	return s.saveLocked()
+}
+
+func (s *ConfigTemplateStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取配置模板文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.templates); err != nil {
+		return fmt.Errorf("解析配置模板文件失败: %w", err)
+	}
+	return nil
+}
+
+// saveLocked 写入模板文件（先写临时文件再重命名），调用方持有写锁
+func (s *ConfigTemplateStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.templates, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建配置模板目录失败: %w", err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入配置模板文件失败: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// ConfigFieldDiff 字段级核对结果
+type ConfigFieldDiff struct {
+	Section  string      `json:"section"`
+	Field    string      `json:"field"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Status   string      `json:"status"` // match | mismatch | missing
+}
+
+// ConfigVerifyResult 设备配置与模板的核对结果
+type ConfigVerifyResult struct {
+	DeviceID        string            `json:"device_id"`
+	Template        string            `json:"template"`
+	TemplateVersion int               `json:"template_version"`
+	ReadAt          time.Time         `json:"read_at"`
+	Match           bool              `json:"match"`
+	Mismatched      int               `json:"mismatched"`
+	Missing         int               `json:"missing"`
+	Diffs           []ConfigFieldDiff `json:"diffs"`
+}
+
+// DiffConfig 按模板列出的字段逐项核对设备配置（按协议字段顺序输出）；
+// 数值按JSON表示比较（模板中的 1 与 1.0 等价），16进制字符串忽略大小写
+func DiffConfig(doc DeviceConfigDocument, tpl ConfigTemplate) ConfigVerifyResult {
+	result := ConfigVerifyResult{
+		DeviceID:        doc.DeviceID,
+		Template:        tpl.Name,
+		TemplateVersion: tpl.Version,
+		ReadAt:          doc.ReadAt,
+		Diffs:           []ConfigFieldDiff{},
+	}
+	for _, spec := range deviceConfigSections {
+		expectedFields, ok := tpl.Sections[spec.Name]
+		if !ok {
+			continue
+		}
+		actualFields := doc.Sections[spec.Name]
+		for _, f := range spec.Fields {
+			expected, ok := expectedFields[f.Name]
+			if !ok {
+				continue
+			}
+			diff := ConfigFieldDiff{Section: spec.Name, Field: f.Name, Expected: expected}
+			actual, present := actualFields[f.Name]
+			switch {
+			case !present:
+				diff.Status = ConfigDiffMissing
+				result.Missing++
+			case configValueKey(actual) == configValueKey(expected):
+				diff.Actual = actual
+				diff.Status = ConfigDiffMatch
+			default:
+				diff.Actual = actual
+				diff.Status = ConfigDiffMismatch
+				result.Mismatched++
+			}
+			result.Diffs = append(result.Diffs, diff)
+		}
+	}
+	result.Match = result.Mismatched == 0 && result.Missing == 0
+	return result
+}
+
+func configValueKey(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strings.ToUpper(s)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// GetConfigTemplates 获取黄金配置模板存储
+func (g *DeviceGateway) GetConfigTemplates() *ConfigTemplateStore {
+	return g.configTemplates
+}
+
+// VerifyDeviceConfig 将设备配置与模板核对；refresh=true 或无缓存时先重新读取设备配置
+func (g *DeviceGateway) VerifyDeviceConfig(correlationID, deviceID, templateName string, version int, refresh bool) (ConfigVerifyResult, error) {
+	tpl, ok := g.configTemplates.Get(templateName, version)
+	if !ok {
+		return ConfigVerifyResult{}, fmt.Errorf("%w: %s(version=%d)", ErrConfigTemplateNotFound, templateName, version)
+	}
+	doc, cached := g.configReader.Cached(deviceID)
+	if refresh || !cached {
+		var err error
+		if doc, err = g.ReadDeviceConfig(correlationID, deviceID, 0); err != nil && !errors.Is(err, ErrConfigReadIncomplete) {
+			return ConfigVerifyResult{}, err
+		}
+	}
+	return DiffConfig(doc, tpl), nil
+}
@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+)
+
+// CleanupReasonDecommissioned 设备停用时断开连接的清理原因
+const CleanupReasonDecommissioned = "decommissioned"
+
+// DecommissionDevice 停用设备：采集最后状态快照与端口累计电量写入归档并加入注册黑名单（持久化失败时不做任何变更），
+// 随后断开在线连接，清除设备参数缓存、站点聚合与搜索索引中保留的最近状态
+func (g *DeviceGateway) DecommissionDevice(correlationID, deviceID, reason, operator string) (decommission.Record, error) {
+	now := time.Now()
+	online := g.IsDeviceOnline(deviceID)
+	record, err := decommission.GetGlobalRegistry().Decommission(decommission.Record{
+		DeviceID:         deviceID,
+		Reason:           reason,
+		Operator:         operator,
+		CorrelationID:    correlationID,
+		DecommissionedAt: now,
+		WasOnline:        online,
+		Snapshot:         g.DeviceStateSnapshot(deviceID),
+		Energy:           energy.GetGlobalCounters().DeviceCounters(deviceID, now),
+	})
+	if err != nil {
+		return decommission.Record{}, err
+	}
+
+	// 先入黑名单再断开：断开后设备立即重连的注册请求也会被拒绝
+	if online && g.tcpManager != nil {
+		g.tcpManager.DisconnectByDeviceID(deviceID, CleanupReasonDecommissioned)
+	}
+	core.GetDeviceParamCache().Remove(deviceID)
+	g.stations.RemoveDevice(deviceID)
+	g.search.Remove(deviceID)
+	return record, nil
+}
+
+// RecommissionDevice 重新启用设备：解除注册黑名单，设备下次注册按正常流程接入
+func (g *DeviceGateway) RecommissionDevice(deviceID, reason, operator string) (decommission.Record, error) {
+	return decommission.GetGlobalRegistry().Recommission(deviceID, reason, operator, time.Now())
+}
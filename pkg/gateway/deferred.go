@@ -0,0 +1,674 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// 延迟命令类型
+const (
+	DeferredKindReboot       = "reboot"        // 远程重启，参数 DeferredRebootParams
+	DeferredKindConfigVerify = "config_verify" // 重新读取设备配置并与模板核对，参数 DeferredConfigVerifyParams
+)
+
+// 延迟命令状态
+const (
+	DeferredStatusPending    = "pending"    // 等待设备上线
+	DeferredStatusDelivering = "delivering" // 正在下发
+	DeferredStatusDelivered  = "delivered"  // 已下发并得到设备应答
+	DeferredStatusFailed     = "failed"     // 下发失败
+	DeferredStatusExpired    = "expired"    // 有效期内设备未上线
+	DeferredStatusCancelled  = "cancelled"  // 已取消
+)
+
+// DeliverWhenOnline 请求参数 deliverWhen 取值：设备离线时暂存，下次注册后下发
+const DeliverWhenOnline = "online"
+
+const (
+	defaultDeferredMaxPerDevice    = 20
+	defaultDeferredTTL             = 24 * time.Hour
+	defaultDeferredMaxTTL          = 7 * 24 * time.Hour
+	defaultDeferredHistorySize     = 50
+	defaultDeferredCallbackTimeout = 5 * time.Second
+	deferredSweepInterval          = 30 * time.Second
+)
+
+// DeferredRecordType 待下发队列的持久化类型（单个文件，加载时旧版本立即迁移并回写）
+const (
+	DeferredRecordType    = "deferred_commands"
+	deferredRecordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(DeferredRecordType, deferredRecordVersion)
+}
+
+var (
+	// ErrDeferredQueueFull 设备待下发命令已达上限
+	ErrDeferredQueueFull = errors.New("设备待下发命令已达上限")
+	// ErrDeferredNotFound 延迟命令不存在或已结束
+	ErrDeferredNotFound = errors.New("延迟命令不存在或已结束")
+	// ErrDeferredInProgress 延迟命令正在下发，无法取消
+	ErrDeferredInProgress = errors.New("延迟命令正在下发，无法取消")
+	// ErrDeferredUnsupported 不支持延迟下发的命令类型
+	ErrDeferredUnsupported = errors.New("不支持延迟下发的命令类型")
+)
+
+// DeferredCommand 延迟命令
+type DeferredCommand struct {
+	ID            string          `json:"id"`
+	DeviceID      string          `json:"deviceId"`
+	Kind          string          `json:"kind"`
+	Params        json.RawMessage `json:"params,omitempty"`
+	Originator    string          `json:"originator,omitempty"` // 发起方（调用方标识或来源地址）
+	CorrelationID string          `json:"correlationId,omitempty"`
+	CallbackURL   string          `json:"callbackUrl,omitempty"` // 结束后以POST推送本结构
+	CreatedAt     time.Time       `json:"createdAt"`
+	ExpiresAt     time.Time       `json:"expiresAt"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	Result        interface{}     `json:"result,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	CompletedAt   time.Time       `json:"completedAt,omitempty"`
+}
+
+// DeferredRequest 延迟命令请求
+type DeferredRequest struct {
+	DeviceID      string
+	Kind          string
+	Params        interface{}
+	Originator    string
+	CorrelationID string
+	CallbackURL   string
+	TTL           time.Duration // <=0 使用默认有效期，超过上限时截断
+}
+
+// DeferredRebootParams 延迟重启参数
+type DeferredRebootParams struct {
+	Force bool `json:"force"`
+}
+
+// DeferredConfigVerifyParams 延迟配置核对参数
+type DeferredConfigVerifyParams struct {
+	Template string `json:"template"`
+	Version  int    `json:"version"`
+}
+
+// DeferredExecutor 延迟命令执行器：经统一发送路径下发（由命令管理器跟踪应答），返回结果或错误
+type DeferredExecutor func(cmd DeferredCommand) (interface{}, error)
+
+// DeferredQueue 按设备持久化的延迟命令队列：设备注册后按入队顺序逐条下发，
+// 下发过程中设备再次注册不会并发下发，而是在本轮结束后补充一轮（处理期间新入队的命令）
+type DeferredQueue struct {
+	path            string
+	maxPerDevice    int
+	defaultTTL      time.Duration
+	maxTTL          time.Duration
+	historySize     int
+	callbackTimeout time.Duration
+	online          func(deviceID string) bool
+
+	mu        sync.Mutex
+	pending   map[string][]*DeferredCommand // 设备 → 入队顺序
+	history   map[string][]DeferredCommand  // 设备 → 已结束（新→旧）
+	draining  map[string]bool
+	redrain   map[string]bool
+	executors map[string]DeferredExecutor
+
+	callbackClient *http.Client
+	now            func() time.Time
+}
+
+// NewDeferredQueue 创建延迟命令队列并加载持久化的待下发命令；online 用于判断下发失败是否因设备再次离线
+func NewDeferredQueue(cfg config.DeferredCommandsConfig, online func(deviceID string) bool) *DeferredQueue {
+	q := &DeferredQueue{
+		path:            cfg.File,
+		maxPerDevice:    cfg.MaxPerDevice,
+		defaultTTL:      time.Duration(cfg.DefaultTTLSeconds) * time.Second,
+		maxTTL:          time.Duration(cfg.MaxTTLSeconds) * time.Second,
+		historySize:     cfg.HistorySize,
+		callbackTimeout: time.Duration(cfg.CallbackTimeoutSeconds) * time.Second,
+		online:          online,
+		pending:         make(map[string][]*DeferredCommand),
+		history:         make(map[string][]DeferredCommand),
+		draining:        make(map[string]bool),
+		redrain:         make(map[string]bool),
+		executors:       make(map[string]DeferredExecutor),
+		now:             time.Now,
+	}
+	if q.maxPerDevice <= 0 {
+		q.maxPerDevice = defaultDeferredMaxPerDevice
+	}
+	if q.defaultTTL <= 0 {
+		q.defaultTTL = defaultDeferredTTL
+	}
+	if q.maxTTL <= 0 {
+		q.maxTTL = defaultDeferredMaxTTL
+	}
+	if q.historySize <= 0 {
+		q.historySize = defaultDeferredHistorySize
+	}
+	if q.callbackTimeout <= 0 {
+		q.callbackTimeout = defaultDeferredCallbackTimeout
+	}
+	q.callbackClient = &http.Client{Timeout: q.callbackTimeout}
+	if err := q.load(); err != nil {
+		logger.WithFields(logrus.Fields{"path": q.path, "error": err.Error()}).Error("加载延迟命令失败")
+	}
+	return q
+}
+
+// RegisterExecutor 注册命令类型的执行器（同名覆盖）
+func (q *DeferredQueue) RegisterExecutor(kind string, executor DeferredExecutor) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.executors[kind] = executor
+}
+
+// Enqueue 暂存命令，等待设备下次注册后下发
+func (q *DeferredQueue) Enqueue(req DeferredRequest) (DeferredCommand, error) {
+	if req.DeviceID == "" {
+		return DeferredCommand{}, fmt.Errorf("设备ID不能为空")
+	}
+	if req.CallbackURL != "" && !strings.HasPrefix(req.CallbackURL, "http://") && !strings.HasPrefix(req.CallbackURL, "https://") {
+		return DeferredCommand{}, fmt.Errorf("回调地址必须为 http(s) URL")
+	}
+	var params json.RawMessage
+	if req.Params != nil {
+		data, err := json.Marshal(req.Params)
+		if err != nil {
+			return DeferredCommand{}, fmt.Errorf("命令参数无法序列化: %w", err)
+		}
+		params = data
+	}
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = q.defaultTTL
+	}
+	if ttl > q.maxTTL {
+		ttl = q.maxTTL
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.executors[req.Kind]; !ok {
+		return DeferredCommand{}, fmt.Errorf("%w: %s", ErrDeferredUnsupported, req.Kind)
+	}
+	if len(q.pending[req.DeviceID]) >= q.maxPerDevice {
+		return DeferredCommand{}, fmt.Errorf("%w(%d)", ErrDeferredQueueFull, q.maxPerDevice)
+	}
+	now := q.now()
+	cmd := &DeferredCommand{
+		ID:            "deferred_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12],
+		DeviceID:      req.DeviceID,
+		Kind:          req.Kind,
+		Params:        params,
+		Originator:    req.Originator,
+		CorrelationID: req.CorrelationID,
+		CallbackURL:   req.CallbackURL,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+		Status:        DeferredStatusPending,
+	}
+	q.pending[req.DeviceID] = append(q.pending[req.DeviceID], cmd)
+	q.saveLocked()
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": req.CorrelationID,
+		"deviceID":      req.DeviceID,
+		"deferredID":    cmd.ID,
+		"kind":          req.Kind,
+		"expiresAt":     cmd.ExpiresAt.Format(time.RFC3339),
+	}).Info("📥 设备离线，命令已暂存，待设备上线后下发")
+	return *cmd, nil
+}
+
+// List 设备的待下发命令（入队顺序）与已结束命令（新→旧）
+func (q *DeferredQueue) List(deviceID string) ([]DeferredCommand, []DeferredCommand) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := make([]DeferredCommand, 0, len(q.pending[deviceID]))
+	for _, cmd := range q.pending[deviceID] {
+		pending = append(pending, *cmd)
+	}
+	return pending, append([]DeferredCommand(nil), q.history[deviceID]...)
+}
+
+// Pending 全部设备的待下发命令（按设备、入队顺序）
+func (q *DeferredQueue) Pending() []DeferredCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	all := make([]DeferredCommand, 0)
+	for _, cmds := range q.pending {
+		for _, cmd := range cmds {
+			all = append(all, *cmd)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].CreatedAt.Before(all[j].CreatedAt) })
+	return all
+}
+
+// Import 导入其他实例交接过来的待下发命令（已存在的ID与已过期的命令跳过），返回导入数
+func (q *DeferredQueue) Import(cmds []DeferredCommand) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	known := make(map[string]bool)
+	for _, pending := range q.pending {
+		for _, cmd := range pending {
+			known[cmd.ID] = true
+		}
+	}
+	now := q.now()
+	imported := 0
+	for _, cmd := range cmds {
+		if known[cmd.ID] || !now.Before(cmd.ExpiresAt) {
+			continue
+		}
+		c := cmd
+		c.Status = DeferredStatusPending
+		q.pending[c.DeviceID] = append(q.pending[c.DeviceID], &c)
+		known[c.ID] = true
+		imported++
+	}
+	if imported > 0 {
+		q.saveLocked()
+	}
+	return imported
+}
+
+// PendingCount 全部设备的待下发命令数
+func (q *DeferredQueue) PendingCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, cmds := range q.pending {
+		n += len(cmds)
+	}
+	return n
+}
+
+// Cancel 取消待下发的命令；正在下发的命令不可取消
+func (q *DeferredQueue) Cancel(deviceID, id string) (DeferredCommand, error) {
+	q.mu.Lock()
+	cmds := q.pending[deviceID]
+	for i, cmd := range cmds {
+		if cmd.ID != id {
+			continue
+		}
+		if cmd.Status == DeferredStatusDelivering {
+			q.mu.Unlock()
+			return *cmd, ErrDeferredInProgress
+		}
+		q.setPendingLocked(deviceID, append(cmds[:i:i], cmds[i+1:]...))
+		cmd.Status = DeferredStatusCancelled
+		done := q.finishLocked(cmd)
+		q.saveLocked()
+		q.mu.Unlock()
+		q.notify(done)
+		return done, nil
+	}
+	q.mu.Unlock()
+	return DeferredCommand{}, ErrDeferredNotFound
+}
+
+// ExpireDue 结束已超过有效期的待下发命令（状态 expired），返回结束的命令
+func (q *DeferredQueue) ExpireDue() []DeferredCommand {
+	q.mu.Lock()
+	now := q.now()
+	var expired []DeferredCommand
+	for deviceID, cmds := range q.pending {
+		kept := cmds[:0]
+		for _, cmd := range cmds {
+			if cmd.Status == DeferredStatusPending && !now.Before(cmd.ExpiresAt) {
+				cmd.Status = DeferredStatusExpired
+				cmd.Error = "有效期内设备未上线"
+				expired = append(expired, q.finishLocked(cmd))
+				continue
+			}
+			kept = append(kept, cmd)
+		}
+		q.setPendingLocked(deviceID, kept)
+	}
+	if len(expired) > 0 {
+		q.saveLocked()
+	}
+	q.mu.Unlock()
+
+	for _, cmd := range expired {
+		logger.WithFields(logrus.Fields{
+			"deviceID":   cmd.DeviceID,
+			"deferredID": cmd.ID,
+			"kind":       cmd.Kind,
+			"createdAt":  cmd.CreatedAt.Format(time.RFC3339),
+		}).Warn("⌛ 延迟命令已过期，设备在有效期内未上线")
+		q.notify(cmd)
+	}
+	return expired
+}
+
+// Drain 设备注册后按入队顺序下发待下发命令（同步执行，调用方通常在独立协程中调用）。
+// 该设备已在下发中时只标记补充一轮并立即返回false；下发失败且设备已离线时命令保留并停止本轮；
+// 停机积压暂缓重放期间不下发，返回false，批准后由积压重放统一按速率下发
+func (q *DeferredQueue) Drain(deviceID string) bool {
+	if replay.GetGlobalCoordinator().Held(replay.CategoryDeferredCommands) {
+		logger.WithFields(logrus.Fields{"deviceID": deviceID}).Debug("停机积压暂缓重放，延迟命令等待批准后下发")
+		return false
+	}
+	return q.drain(deviceID, nil)
+}
+
+// drain 逐条下发设备的待下发命令；ctl 非nil时每条下发前按积压重放节奏等待并记录结果
+func (q *DeferredQueue) drain(deviceID string, ctl *replay.Control) bool {
+	q.mu.Lock()
+	if q.draining[deviceID] {
+		q.redrain[deviceID] = true
+		q.mu.Unlock()
+		return false
+	}
+	q.draining[deviceID] = true
+	q.mu.Unlock()
+
+	for {
+		q.ExpireDue()
+		for q.hasPending(deviceID) && ctl.Wait() && q.deliverNext(deviceID, ctl) {
+		}
+
+		q.mu.Lock()
+		if q.redrain[deviceID] {
+			delete(q.redrain, deviceID)
+			q.mu.Unlock()
+			continue
+		}
+		delete(q.draining, deviceID)
+		q.mu.Unlock()
+		return true
+	}
+}
+
+func (q *DeferredQueue) hasPending(deviceID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending[deviceID]) > 0
+}
+
+// deliverNext 下发队首命令，返回是否继续下发后续命令
+func (q *DeferredQueue) deliverNext(deviceID string, ctl *replay.Control) bool {
+	q.mu.Lock()
+	cmds := q.pending[deviceID]
+	if len(cmds) == 0 {
+		q.mu.Unlock()
+		return false
+	}
+	cmd := cmds[0]
+	executor := q.executors[cmd.Kind]
+	cmd.Status = DeferredStatusDelivering
+	cmd.Attempts++
+	snapshot := *cmd
+	q.mu.Unlock()
+
+	var result interface{}
+	err := ErrDeferredUnsupported
+	if executor != nil {
+		result, err = executor(snapshot)
+	}
+
+	q.mu.Lock()
+	if err != nil && executor != nil && q.online != nil && !q.online(deviceID) {
+		// 下发途中设备再次离线：保留命令等待下次注册
+		cmd.Status = DeferredStatusPending
+		cmd.Error = err.Error()
+		q.saveLocked()
+		q.mu.Unlock()
+		ctl.Record(replay.OutcomeFailed)
+		logger.WithFields(logrus.Fields{
+			"deviceID":   deviceID,
+			"deferredID": cmd.ID,
+			"error":      err.Error(),
+		}).Warn("延迟命令下发时设备再次离线，等待下次上线")
+		return false
+	}
+	q.removePendingLocked(deviceID, cmd)
+	outcome := replay.OutcomeReplayed
+	if err != nil {
+		cmd.Status = DeferredStatusFailed
+		cmd.Error = err.Error()
+		outcome = replay.OutcomeFailed
+	} else {
+		cmd.Status = DeferredStatusDelivered
+		cmd.Error = ""
+		cmd.Result = result
+	}
+	done := q.finishLocked(cmd)
+	q.saveLocked()
+	q.mu.Unlock()
+	ctl.Record(outcome)
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": cmd.CorrelationID,
+		"deviceID":      deviceID,
+		"deferredID":    cmd.ID,
+		"kind":          cmd.Kind,
+		"status":        done.Status,
+		"error":         done.Error,
+		"waited":        done.CompletedAt.Sub(done.CreatedAt).Truncate(time.Second).String(),
+	}).Info("📤 延迟命令已下发")
+	q.notify(done)
+	return true
+}
+
+func (q *DeferredQueue) removePendingLocked(deviceID string, target *DeferredCommand) {
+	cmds := q.pending[deviceID]
+	for i, cmd := range cmds {
+		if cmd == target {
+			q.setPendingLocked(deviceID, append(cmds[:i:i], cmds[i+1:]...))
+			return
+		}
+	}
+}
+
+func (q *DeferredQueue) setPendingLocked(deviceID string, cmds []*DeferredCommand) {
+	if len(cmds) == 0 {
+		delete(q.pending, deviceID)
+		return
+	}
+	q.pending[deviceID] = cmds
+}
+
+// finishLocked 记录结束时间并写入历史，返回快照
+func (q *DeferredQueue) finishLocked(cmd *DeferredCommand) DeferredCommand {
+	cmd.CompletedAt = q.now()
+	done := *cmd
+	history := append([]DeferredCommand{done}, q.history[cmd.DeviceID]...)
+	if len(history) > q.historySize {
+		history = history[:q.historySize]
+	}
+	q.history[cmd.DeviceID] = history
+	return done
+}
+
+// notify 异步推送结束结果到回调地址（尽力而为，失败只记录日志）
+func (q *DeferredQueue) notify(cmd DeferredCommand) {
+	if cmd.CallbackURL == "" {
+		return
+	}
+	go func() {
+		body, err := json.Marshal(cmd)
+		if err != nil {
+			return
+		}
+		resp, err := q.callbackClient.Post(cmd.CallbackURL, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("HTTP %d", resp.StatusCode)
+			}
+		}
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"deferredID":  cmd.ID,
+				"callbackUrl": cmd.CallbackURL,
+				"error":       err.Error(),
+			}).Warn("延迟命令结果回调失败")
+		}
+	}()
+}
+
+// load 加载持久化的待下发命令；上次退出时正在下发的命令恢复为待下发（至少下发一次）
+func (q *DeferredQueue) load() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cmds []*DeferredCommand
+	migrated, err := persistence.Decode(DeferredRecordType, data, &cmds)
+	if errors.Is(err, persistence.ErrRecordArchived) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(cmds, func(i, j int) bool { return cmds[i].CreatedAt.Before(cmds[j].CreatedAt) })
+	for _, cmd := range cmds {
+		cmd.Status = DeferredStatusPending
+		q.pending[cmd.DeviceID] = append(q.pending[cmd.DeviceID], cmd)
+	}
+	if migrated {
+		q.saveLocked()
+	}
+	return nil
+}
+
+// saveLocked 持久化全部待下发命令（先写临时文件再重命名），失败只记录日志
+func (q *DeferredQueue) saveLocked() {
+	if q.path == "" {
+		return
+	}
+	all := make([]*DeferredCommand, 0)
+	for _, cmds := range q.pending {
+		all = append(all, cmds...)
+	}
+	var data []byte
+	encoded, err := persistence.Encode(DeferredRecordType, all)
+	if err == nil {
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, encoded, "", "  "); err == nil {
+			data = buf.Bytes()
+		}
+	}
+	if err == nil {
+		if dir := filepath.Dir(q.path); dir != "" {
+			err = os.MkdirAll(dir, 0o755)
+		}
+	}
+	if err == nil {
+		tmp := q.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, q.path)
+		}
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{"path": q.path, "error": err.Error()}).Error("保存延迟命令失败")
+	}
+}
+
+// ===============================
+// 网关集成
+// ===============================
+
+// registerDeferredExecutors 注册支持延迟下发的命令类型
+func (g *DeviceGateway) registerDeferredExecutors() {
+	g.deferred.RegisterExecutor(DeferredKindReboot, func(cmd DeferredCommand) (interface{}, error) {
+		var params DeferredRebootParams
+		if len(cmd.Params) > 0 {
+			if err := json.Unmarshal(cmd.Params, &params); err != nil {
+				return nil, err
+			}
+		}
+		return g.RebootDevice(cmd.CorrelationID, cmd.DeviceID, params.Force)
+	})
+	g.deferred.RegisterExecutor(DeferredKindConfigVerify, func(cmd DeferredCommand) (interface{}, error) {
+		var params DeferredConfigVerifyParams
+		if err := json.Unmarshal(cmd.Params, &params); err != nil {
+			return nil, err
+		}
+		return g.VerifyDeviceConfig(cmd.CorrelationID, cmd.DeviceID, params.Template, params.Version, true)
+	})
+}
+
+// startDeferredWorker 定期结束已过期的延迟命令
+func (g *DeviceGateway) startDeferredWorker() {
+	go func() {
+		ticker := time.NewTicker(deferredSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			g.deferred.ExpireDue()
+		}
+	}()
+}
+
+// GetDeferredQueue 获取延迟命令队列
+func (g *DeviceGateway) GetDeferredQueue() *DeferredQueue {
+	return g.deferred
+}
+
+// ReplaySource 停机积压重放：批准后按入队时间逐台下发在线设备的待下发命令；
+// 离线设备的命令保留，重放结束后随设备注册按常规流程下发
+func (q *DeferredQueue) ReplaySource() replay.Source {
+	return deferredReplaySource{q: q}
+}
+
+type deferredReplaySource struct {
+	q *DeferredQueue
+}
+
+func (s deferredReplaySource) Items() []replay.Item {
+	pending := s.q.Pending()
+	items := make([]replay.Item, 0, len(pending))
+	for _, cmd := range pending {
+		items = append(items, replay.Item{ID: cmd.ID, At: cmd.CreatedAt, Outbound: 1})
+	}
+	return items
+}
+
+func (s deferredReplaySource) Run(ctl *replay.Control) error {
+	var devices []string
+	seen := make(map[string]bool)
+	for _, cmd := range s.q.Pending() {
+		if !seen[cmd.DeviceID] {
+			seen[cmd.DeviceID] = true
+			devices = append(devices, cmd.DeviceID)
+		}
+	}
+	for _, deviceID := range devices {
+		if s.q.online != nil && !s.q.online(deviceID) {
+			continue
+		}
+		s.q.drain(deviceID, ctl)
+		if ctl.Stopped() {
+			return replay.ErrStopped
+		}
+	}
+	return nil
+}
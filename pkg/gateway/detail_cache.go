@@ -0,0 +1,216 @@
+package gateway
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+)
+
+const (
+	defaultDetailCacheTTL        = time.Second
+	defaultDetailCacheMaxDevices = 2000
+	detailCacheSubscriberName    = "device-detail-cache"
+)
+
+// DetailCacheStats 设备详情缓存统计
+type DetailCacheStats struct {
+	Enabled       bool   `json:"enabled"`
+	TTLMs         int64  `json:"ttlMs"`
+	Size          int    `json:"size"`
+	MaxDevices    int    `json:"maxDevices"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Coalesced     uint64 `json:"coalesced"` // 等待同一设备进行中的组装、共享其结果的请求数
+	Bypassed      uint64 `json:"bypassed"`  // noCache 请求数
+	Invalidations uint64 `json:"invalidations"`
+	Evictions     uint64 `json:"evictions"` // 超出设备数上限按LRU淘汰
+}
+
+type detailEntry struct {
+	deviceID string
+	detail   map[string]interface{}
+	cachedAt time.Time
+}
+
+// detailCall 进行中的详情组装；stale 表示组装期间设备已失效，结果只返回给等待者不写入缓存
+type detailCall struct {
+	done   chan struct{}
+	detail map[string]interface{}
+	err    error
+	stale  bool
+}
+
+// DeviceDetailCache 设备详情短TTL缓存：同一设备的并发请求共享一次组装（singleflight），
+// 设备事件（状态变化、心跳、命令完成等）到达时立即失效，按设备LRU限制条目数。组装失败不缓存。
+// 返回的详情为浅拷贝，调用方可增删顶层字段，嵌套值只读
+type DeviceDetailCache struct {
+	ttl        time.Duration
+	maxDevices int
+
+	mu       sync.Mutex
+	order    *list.List // 最近访问在前
+	items    map[string]*list.Element
+	inflight map[string]*detailCall
+	stats    DetailCacheStats
+	sub      *events.Subscription
+}
+
+// NewDeviceDetailCache 创建设备详情缓存；ttlMs 为负数时禁用（每次都组装）
+func NewDeviceDetailCache(cfg config.DetailCacheConfig) *DeviceDetailCache {
+	c := &DeviceDetailCache{
+		ttl:        time.Duration(cfg.TTLMs) * time.Millisecond,
+		maxDevices: cfg.MaxDevices,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		inflight:   make(map[string]*detailCall),
+	}
+	if cfg.TTLMs == 0 {
+		c.ttl = defaultDetailCacheTTL
+	}
+	if c.maxDevices <= 0 {
+		c.maxDevices = defaultDetailCacheMaxDevices
+	}
+	return c
+}
+
+// Enabled 是否启用缓存
+func (c *DeviceDetailCache) Enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+// Get 返回设备详情：未过期的缓存直接返回；同一设备已有进行中的组装时等待并共享其结果；否则调用 load 组装并缓存
+func (c *DeviceDetailCache) Get(deviceID string, load func(deviceID string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if !c.Enabled() {
+		return load(deviceID)
+	}
+	c.mu.Lock()
+	if e, ok := c.items[deviceID]; ok {
+		entry := e.Value.(*detailEntry)
+		if time.Since(entry.cachedAt) < c.ttl {
+			c.order.MoveToFront(e)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return copyDetail(entry.detail), nil
+		}
+		c.removeLocked(e)
+	}
+	if call, ok := c.inflight[deviceID]; ok {
+		c.stats.Coalesced++
+		c.mu.Unlock()
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		return copyDetail(call.detail), nil
+	}
+	call := &detailCall{done: make(chan struct{})}
+	c.inflight[deviceID] = call
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	defer close(call.done)
+	call.detail, call.err = load(deviceID)
+
+	c.mu.Lock()
+	delete(c.inflight, deviceID)
+	if call.err == nil && !call.stale {
+		c.items[deviceID] = c.order.PushFront(&detailEntry{deviceID: deviceID, detail: call.detail, cachedAt: time.Now()})
+		for c.order.Len() > c.maxDevices {
+			c.removeLocked(c.order.Back())
+			c.stats.Evictions++
+		}
+	}
+	c.mu.Unlock()
+	if call.err != nil {
+		return nil, call.err
+	}
+	return copyDetail(call.detail), nil
+}
+
+// NoteBypass 记录一次 noCache 请求（由调用方直接组装）
+func (c *DeviceDetailCache) NoteBypass() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.stats.Bypassed++
+	c.mu.Unlock()
+}
+
+// Invalidate 失效设备的缓存；进行中的组装结果不再写入缓存
+func (c *DeviceDetailCache) Invalidate(deviceID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[deviceID]; ok {
+		c.removeLocked(e)
+		c.stats.Invalidations++
+	}
+	if call, ok := c.inflight[deviceID]; ok {
+		call.stale = true
+	}
+}
+
+// Stats 缓存统计
+func (c *DeviceDetailCache) Stats() DetailCacheStats {
+	if c == nil {
+		return DetailCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Enabled = c.ttl > 0
+	stats.TTLMs = c.ttl.Milliseconds()
+	stats.Size = c.order.Len()
+	stats.MaxDevices = c.maxDevices
+	return stats
+}
+
+// SubscribeInvalidation 订阅事件总线，设备相关事件到达时失效该设备的缓存（订阅者处理不过来时丢弃的事件由TTL兜底）
+func (c *DeviceDetailCache) SubscribeInvalidation(bus *events.Bus) {
+	if !c.Enabled() || bus == nil {
+		return
+	}
+	c.sub = bus.Subscribe(events.SubscribeOptions{
+		Name:   detailCacheSubscriberName,
+		Buffer: 1024,
+		Filter: func(ev events.Event) bool { return ev.DeviceID != "" },
+	})
+	go func() {
+		for {
+			select {
+			case <-c.sub.Ready():
+			case <-c.sub.Done():
+				return
+			}
+			for ev, ok := c.sub.TryNext(); ok; ev, ok = c.sub.TryNext() {
+				c.Invalidate(ev.DeviceID)
+			}
+		}
+	}()
+}
+
+// Close 取消事件订阅
+func (c *DeviceDetailCache) Close() {
+	if c != nil && c.sub != nil {
+		c.sub.Close()
+	}
+}
+
+func (c *DeviceDetailCache) removeLocked(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.items, e.Value.(*detailEntry).deviceID)
+}
+
+func copyDetail(detail map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(detail)+4)
+	for k, v := range detail {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,404 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultConfigRetryInterval = 5 * time.Second
+	defaultConfigMaxAttempts   = 3
+)
+
+// 设备配置分段名称（0x90~0x93 查询应答，内容对应 0x83~0x86 设置指令）
+const (
+	ConfigSectionRunParams11 = "run_params_1_1" // 0x90 → 0x83 运行参数1.1
+	ConfigSectionRunParams12 = "run_params_1_2" // 0x91 → 0x84 运行参数1.2
+	ConfigSectionRunParams2  = "run_params_2"   // 0x92 → 0x85 最大充电时长/过载功率/过欠压
+	ConfigSectionCardParams  = "card_params"    // 0x93 → 0x86 用户卡参数
+)
+
+// ErrConfigReadIncomplete 查询轮数用尽或超时后仍有分段未到达
+var ErrConfigReadIncomplete = errors.New("设备配置读取不完整")
+
+// configField 分段字段（小端无符号整数，hex=true 时按16进制字符串输出）
+type configField struct {
+	Name string
+	Size int
+	Hex  bool
+}
+
+// configSectionSpec 配置分段定义
+type configSectionSpec struct {
+	Name    string
+	Command byte
+	Fields  []configField
+}
+
+// deviceConfigSections 配置分段定义（按协议 §4.9.1 与 0x83~0x86 字段顺序）
+var deviceConfigSections = []configSectionSpec{
+	{Name: ConfigSectionRunParams11, Command: constants.CmdQueryParam1, Fields: []configField{
+		{Name: "unplug_power", Size: 2},
+		{Name: "unplug_detect_time", Size: 2},
+		{Name: "float_charge_percent", Size: 1},
+		{Name: "float_detect_time", Size: 2},
+		{Name: "float_charge_time", Size: 2},
+		{Name: "heartbeat_interval", Size: 2},
+	}},
+	{Name: ConfigSectionRunParams12, Command: constants.CmdQueryParam2, Fields: []configField{
+		{Name: "dynamic_overload_power", Size: 2},
+		{Name: "dynamic_overload_detect_time", Size: 2},
+		{Name: "dynamic_overload_start_time", Size: 2},
+		{Name: "unplug_interference_power", Size: 1},
+		{Name: "unplug_interference_time", Size: 2},
+		{Name: "float_second_detect_point", Size: 2},
+		{Name: "float_second_detect_time", Size: 2},
+		{Name: "min_power", Size: 2},
+		{Name: "min_power_check_point", Size: 2},
+		{Name: "second_max_power_point", Size: 2},
+		{Name: "ambient_alarm_temp", Size: 1},
+		{Name: "port_alarm_temp", Size: 1},
+		{Name: "optocoupler_unplug", Size: 1},
+		{Name: "qrcode_light", Size: 1},
+	}},
+	{Name: ConfigSectionRunParams2, Command: constants.CmdQueryParam3, Fields: []configField{
+		{Name: "max_charge_time", Size: 2},
+		{Name: "overload_power", Size: 2},
+		{Name: "over_voltage", Size: 2},  // 0.1V（2024-08-07新增，旧固件无此字段）
+		{Name: "under_voltage", Size: 2}, // 0.1V（2024-08-07新增，旧固件无此字段）
+	}},
+	{Name: ConfigSectionCardParams, Command: constants.CmdQueryParam4, Fields: []configField{
+		{Name: "card_sector", Size: 1},
+		{Name: "card_password", Size: 6, Hex: true},
+		{Name: "new_card_password", Size: 6, Hex: true},
+	}},
+}
+
+// IsConfigQueryCommand 是否为配置分段查询命令（0x90~0x93）
+func IsConfigQueryCommand(command byte) bool {
+	_, ok := configSectionByCommand(command)
+	return ok
+}
+
+func configSectionByCommand(command byte) (configSectionSpec, bool) {
+	for _, spec := range deviceConfigSections {
+		if spec.Command == command {
+			return spec, true
+		}
+	}
+	return configSectionSpec{}, false
+}
+
+func configSectionByName(name string) (configSectionSpec, bool) {
+	for _, spec := range deviceConfigSections {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return configSectionSpec{}, false
+}
+
+// DecodeConfigSection 按分段字段表解码查询应答；旧固件缺少的尾部字段不输出
+func DecodeConfigSection(command byte, payload []byte) (string, map[string]interface{}, error) {
+	spec, ok := configSectionByCommand(command)
+	if !ok {
+		return "", nil, fmt.Errorf("非配置查询命令: 0x%02X", command)
+	}
+	if len(payload) < spec.Fields[0].Size {
+		return spec.Name, nil, fmt.Errorf("分段 %s 数据长度不足: %d", spec.Name, len(payload))
+	}
+
+	values := make(map[string]interface{}, len(spec.Fields))
+	offset := 0
+	for _, f := range spec.Fields {
+		if offset+f.Size > len(payload) {
+			break
+		}
+		raw := payload[offset : offset+f.Size]
+		offset += f.Size
+		switch {
+		case f.Hex:
+			values[f.Name] = fmt.Sprintf("%X", raw)
+		case f.Size == 1:
+			values[f.Name] = int(raw[0])
+		default:
+			values[f.Name] = int(binary.LittleEndian.Uint16(raw))
+		}
+	}
+	return spec.Name, values, nil
+}
+
+// DeviceConfigDocument 组装后的设备配置文档
+type DeviceConfigDocument struct {
+	DeviceID string                            `json:"device_id"`
+	ReadAt   time.Time                         `json:"read_at"`
+	Complete bool                              `json:"complete"`
+	Attempts int                               `json:"attempts"`          // 实际查询轮数
+	Sections map[string]map[string]interface{} `json:"sections"`          // 分段 → 字段 → 值
+	Raw      map[string]string                 `json:"raw"`               // 分段 → 原始应答(HEX)
+	Missing  []string                          `json:"missing,omitempty"` // 未到达的分段
+}
+
+// ConfigQuerySender 下发单个分段查询命令
+type ConfigQuerySender func(correlationID, deviceID string, command byte) error
+
+// configReadState 进行中的配置读取
+type configReadState struct {
+	sections map[byte][]byte
+	arrived  chan struct{} // 分段到达通知（缓冲1）
+}
+
+// DeviceConfigReader 设备配置读取：下发分段查询、按命令码组装应答（到达顺序无关）、缺失分段补发查询
+type DeviceConfigReader struct {
+	mutex         sync.Mutex
+	pending       map[string]*configReadState     // deviceID → 进行中的读取
+	cache         map[string]DeviceConfigDocument // deviceID → 最近一次完整读取
+	send          ConfigQuerySender
+	retryInterval time.Duration
+	maxAttempts   int
+}
+
+// NewDeviceConfigReader 创建设备配置读取器
+func NewDeviceConfigReader(cfg config.DeviceConfigReadConfig, send ConfigQuerySender) *DeviceConfigReader {
+	retryInterval := time.Duration(cfg.RetryIntervalSeconds) * time.Second
+	if retryInterval <= 0 {
+		retryInterval = defaultConfigRetryInterval
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultConfigMaxAttempts
+	}
+	return &DeviceConfigReader{
+		pending:       make(map[string]*configReadState),
+		cache:         make(map[string]DeviceConfigDocument),
+		send:          send,
+		retryInterval: retryInterval,
+		maxAttempts:   maxAttempts,
+	}
+}
+
+// SetRetryPolicy 设置补发间隔与最大查询轮数
+func (r *DeviceConfigReader) SetRetryPolicy(retryInterval time.Duration, maxAttempts int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if retryInterval > 0 {
+		r.retryInterval = retryInterval
+	}
+	if maxAttempts > 0 {
+		r.maxAttempts = maxAttempts
+	}
+}
+
+// Read 下发全部分段查询并等待组装；每轮结束仍缺失的分段重新查询，
+// 轮数用尽或超过timeout（<=0时为 补发间隔×最大轮数）仍不完整时返回已到达部分与 ErrConfigReadIncomplete
+func (r *DeviceConfigReader) Read(correlationID, deviceID string, timeout time.Duration) (DeviceConfigDocument, error) {
+	r.mutex.Lock()
+	if _, busy := r.pending[deviceID]; busy {
+		r.mutex.Unlock()
+		return DeviceConfigDocument{}, fmt.Errorf("设备 %s 的配置读取正在进行", deviceID)
+	}
+	state := &configReadState{sections: make(map[byte][]byte), arrived: make(chan struct{}, 1)}
+	r.pending[deviceID] = state
+	retryInterval, maxAttempts := r.retryInterval, r.maxAttempts
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		delete(r.pending, deviceID)
+		r.mutex.Unlock()
+	}()
+
+	if timeout <= 0 {
+		timeout = retryInterval * time.Duration(maxAttempts)
+	}
+	deadline := time.Now().Add(timeout)
+
+	attempts := 0
+	for attempts < maxAttempts && time.Now().Before(deadline) {
+		missing := r.missingCommands(state)
+		if len(missing) == 0 {
+			break
+		}
+		attempts++
+		if attempts > 1 {
+			logger.WithFields(logrus.Fields{
+				"correlationID": correlationID,
+				"deviceID":      deviceID,
+				"attempt":       attempts,
+				"missing":       commandNames(missing),
+			}).Warn("🔁 设备配置分段未到齐，补发查询")
+		}
+		for _, cmd := range missing {
+			if err := r.send(correlationID, deviceID, cmd); err != nil {
+				return DeviceConfigDocument{}, fmt.Errorf("下发配置查询0x%02X失败: %w", cmd, err)
+			}
+		}
+
+		roundEnd := time.Now().Add(retryInterval)
+		if roundEnd.After(deadline) {
+			roundEnd = deadline
+		}
+		r.waitRound(state, roundEnd)
+	}
+
+	doc := r.assemble(deviceID, state, attempts)
+	if !doc.Complete {
+		logger.WithFields(logrus.Fields{
+			"correlationID": correlationID,
+			"deviceID":      deviceID,
+			"attempts":      attempts,
+			"missing":       doc.Missing,
+		}).Warn("⚠️ 设备配置读取不完整")
+		return doc, fmt.Errorf("%w: 缺失分段 %v", ErrConfigReadIncomplete, doc.Missing)
+	}
+
+	r.mutex.Lock()
+	r.cache[deviceID] = doc
+	r.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": correlationID,
+		"deviceID":      deviceID,
+		"attempts":      attempts,
+	}).Info("✅ 设备配置读取完成")
+	return doc, nil
+}
+
+// OnSection 接收分段查询应答；设备无进行中的读取时返回false
+func (r *DeviceConfigReader) OnSection(deviceID string, command byte, payload []byte) bool {
+	if !IsConfigQueryCommand(command) {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	state, ok := r.pending[deviceID]
+	if !ok {
+		return false
+	}
+	state.sections[command] = append([]byte(nil), payload...)
+	select {
+	case state.arrived <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Cached 设备最近一次完整读取的配置
+func (r *DeviceConfigReader) Cached(deviceID string) (DeviceConfigDocument, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	doc, ok := r.cache[deviceID]
+	return doc, ok
+}
+
+// waitRound 等待全部分段到达或本轮结束
+func (r *DeviceConfigReader) waitRound(state *configReadState, roundEnd time.Time) {
+	timer := time.NewTimer(time.Until(roundEnd))
+	defer timer.Stop()
+	for {
+		select {
+		case <-state.arrived:
+			if len(r.missingCommands(state)) == 0 {
+				return
+			}
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+func (r *DeviceConfigReader) missingCommands(state *configReadState) []byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var missing []byte
+	for _, spec := range deviceConfigSections {
+		if _, ok := state.sections[spec.Command]; !ok {
+			missing = append(missing, spec.Command)
+		}
+	}
+	return missing
+}
+
+// assemble 按分段定义顺序解码已到达的分段
+func (r *DeviceConfigReader) assemble(deviceID string, state *configReadState, attempts int) DeviceConfigDocument {
+	doc := DeviceConfigDocument{
+		DeviceID: deviceID,
+		ReadAt:   time.Now(),
+		Attempts: attempts,
+		Sections: make(map[string]map[string]interface{}),
+		Raw:      make(map[string]string),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, spec := range deviceConfigSections {
+		payload, ok := state.sections[spec.Command]
+		if !ok {
+			doc.Missing = append(doc.Missing, spec.Name)
+			continue
+		}
+		doc.Raw[spec.Name] = fmt.Sprintf("%X", payload)
+		_, values, err := DecodeConfigSection(spec.Command, payload)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"deviceID": deviceID, "section": spec.Name, "error": err.Error()}).Warn("设备配置分段解码失败")
+			doc.Missing = append(doc.Missing, spec.Name)
+			continue
+		}
+		doc.Sections[spec.Name] = values
+	}
+	doc.Complete = len(doc.Missing) == 0
+	return doc
+}
+
+func commandNames(commands []byte) []string {
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		if spec, ok := configSectionByCommand(cmd); ok {
+			names = append(names, spec.Name)
+		}
+	}
+	return names
+}
+
+// ConfigQueryCommands 配置读取下发的分段查询命令（0x90~0x93）
+func ConfigQueryCommands() []byte {
+	commands := make([]byte, 0, len(deviceConfigSections))
+	for _, spec := range deviceConfigSections {
+		commands = append(commands, spec.Command)
+	}
+	return commands
+}
+
+// GetConfigReader 获取设备配置读取器
+func (g *DeviceGateway) GetConfigReader() *DeviceConfigReader {
+	return g.configReader
+}
+
+// ReadDeviceConfig 读取设备配置（0x90~0x93 分段查询），完整读取结果缓存供核对使用
+func (g *DeviceGateway) ReadDeviceConfig(correlationID, deviceID string, timeout time.Duration) (DeviceConfigDocument, error) {
+	return g.configReader.Read(correlationID, deviceID, timeout)
+}
+
+// HandleConfigSection 设备配置查询应答入口（由0x90~0x93处理器调用）；运行参数1.1同时更新已确认的心跳间隔
+func (g *DeviceGateway) HandleConfigSection(deviceID string, command byte, payload []byte) bool {
+	if command == constants.CmdQueryParam1 && g.heartbeatTuner != nil {
+		g.heartbeatTuner.ObserveRunParams(deviceID, payload, time.Now())
+	}
+	return g.configReader.OnSection(deviceID, command, payload)
+}
+
+// sendConfigQuery 经统一发送路径下发分段查询（无数据域），由命令管理器跟踪应答
+func (g *DeviceGateway) sendConfigQuery(correlationID, deviceID string, command byte) error {
+	_, err := g.SendCommandToDeviceWithOptions(context.Background(), deviceID, command, nil, network.CommandOptions{CorrelationID: correlationID})
+	return err
+}
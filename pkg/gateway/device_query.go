@@ -1,16 +1,30 @@
 package gateway
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
-// GetDeviceDetail 获取设备详细信息
+// GetDeviceDetail 获取设备详细信息：经短TTL缓存，同一设备的并发请求共享一次组装；
+// 返回的 map 可增删顶层字段，嵌套值与其他请求共享，不得修改
 func (g *DeviceGateway) GetDeviceDetail(deviceID string) (map[string]interface{}, error) {
+	return g.detailCache.Get(deviceID, g.GetDeviceDetailUncached)
+}
+
+// GetDeviceDetailUncached 绕过缓存直接组装设备详情（?noCache=true）
+func (g *DeviceGateway) GetDeviceDetailUncached(deviceID string) (map[string]interface{}, error) {
 	logger.WithFields(logrus.Fields{
 		"action":   "GetDeviceDetail",
 		"deviceID": deviceID,
@@ -39,6 +53,48 @@ func (g *DeviceGateway) GetDeviceDetail(deviceID string) (map[string]interface{}
 		return nil, err
 	}
 
+	// 附带业务资产信息（未配置解析器或未登记的设备不输出）
+	if info, ok := asset.Lookup(deviceID); ok {
+		result["assetCode"] = info.AssetCode
+		result["stationId"] = info.StationID
+		result["assetLabel"] = info.Label
+	}
+
+	// 已拆分虚拟子设备时附带虚拟设备ID列表
+	if virtuals := g.GetVirtualDevices(deviceID); len(virtuals) > 0 {
+		ids := make([]string, 0, len(virtuals))
+		for _, v := range virtuals {
+			ids = append(ids, v.VirtualID)
+		}
+		result["virtualDevices"] = ids
+	}
+
+	// 自适应心跳：推荐间隔与设备已确认间隔
+	if g.heartbeatTuner != nil {
+		if state, ok := g.heartbeatTuner.Get(deviceID); ok {
+			result["heartbeatTuning"] = state
+		}
+	}
+
+	// 低流量模式：分配来源与生效行为（未分配的设备不输出）
+	if mode, ok := g.LowDataMode(deviceID); ok {
+		result["lowDataMode"] = mode
+	}
+
+	// 并发充电会话上限：生效上限与占用端口
+	if g.sessionLimits != nil {
+		if status, ok := g.sessionLimits.Status(deviceID); ok {
+			result["sessionLimit"] = status
+		}
+	}
+
+	// 设备否定应答的命令（固件实际不支持的命令，供能力探测参考）
+	if physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID); err == nil {
+		if stats, ok := network.GetCommandManager().GetRejectionStats(physicalID); ok {
+			result["commandRejections"] = stats
+		}
+	}
+
 	logger.WithFields(logrus.Fields{
 		"action":   "GetDeviceDetail",
 		"deviceID": deviceID,
@@ -47,6 +103,149 @@ func (g *DeviceGateway) GetDeviceDetail(deviceID string) (map[string]interface{}
 	return result, nil
 }
 
+// GetDetailCache 设备详情缓存
+func (g *DeviceGateway) GetDetailCache() *DeviceDetailCache {
+	return g.detailCache
+}
+
+// GetDeviceReadDeadline 设备所在连接的自适应读超时状态（帧间隔EWMA、有效读超时、告警/断开时间点），设备不在线时返回false
+func (g *DeviceGateway) GetDeviceReadDeadline(deviceID string) (network.ReadDeadlineStatus, bool) {
+	if g.tcpManager == nil {
+		return network.ReadDeadlineStatus{}, false
+	}
+	conn, ok := g.tcpManager.GetConnectionByDeviceID(deviceID)
+	if !ok || conn == nil {
+		return network.ReadDeadlineStatus{}, false
+	}
+	return network.GetReadDeadlineTracker().Status(conn.GetConnID())
+}
+
+// GetDeviceDialect 设备所在连接的协议方言绑定（来源与注册锁定时间），设备不在线或连接未绑定时返回false
+func (g *DeviceGateway) GetDeviceDialect(deviceID string) (dialect.Binding, bool) {
+	if g.tcpManager == nil {
+		return dialect.Binding{}, false
+	}
+	conn, ok := g.tcpManager.GetConnectionByDeviceID(deviceID)
+	if !ok || conn == nil {
+		return dialect.Binding{}, false
+	}
+	return dialect.GetGlobalTracker().Get(conn.GetConnID())
+}
+
+// GetDeviceParameters 设备最近上报的运行参数（0x90/0x91），设备不在线或尚未上报时返回false
+func (g *DeviceGateway) GetDeviceParameters(deviceID string) (dny_protocol.DeviceParameters, bool) {
+	if g.tcpManager == nil {
+		return dny_protocol.DeviceParameters{}, false
+	}
+	return g.tcpManager.GetDeviceParameters(deviceID)
+}
+
+// 端口状态分类（DevicePortStatus.State）
+const (
+	PortStateIdle             = "idle"               // 空闲
+	PortStateCharging         = "charging"           // 充电中/浮充
+	PortStateFault            = "fault"              // 故障
+	PortStateOccupiedNoCharge = "occupied_no_charge" // 有充电器但未充电（未启动或已充满）
+)
+
+// PortStateOf 协议端口状态 → 端口状态分类
+func PortStateOf(status uint8) string {
+	switch status {
+	case 0x00:
+		return PortStateIdle
+	case 0x01, 0x05:
+		return PortStateCharging
+	case 0x02, 0x03:
+		return PortStateOccupiedNoCharge
+	default:
+		return PortStateFault
+	}
+}
+
+// DevicePortStatus 端口状态：最近上报的端口状态与功率，附带该端口进行中的订单。
+// 超过过期窗口未上报的端口标记为stale，功率与电压不再展示
+type DevicePortStatus struct {
+	Port        int        `json:"port"` // 业务端口(从1开始)
+	Status      uint8      `json:"status"`
+	State       string     `json:"state,omitempty"` // idle/charging/fault/occupied_no_charge，未上报过时为空
+	PowerW      float64    `json:"powerW"`
+	VoltageV    float64    `json:"voltageV,omitempty"`
+	EnergyWh    uint32     `json:"energyWh"`             // 进行中订单的累计电量
+	LastUpdate  *time.Time `json:"lastUpdate,omitempty"` // 最近一次端口上报时间
+	Stale       bool       `json:"stale"`                // 超过过期窗口未上报
+	Reported    bool       `json:"reported"`             // 是否收到过该端口的状态上报
+	OrderNo     string     `json:"orderNo,omitempty"`
+	OrderStatus string     `json:"orderStatus,omitempty"`
+}
+
+// DevicePortSummary 设备端口汇总（设备列表使用）
+type DevicePortSummary struct {
+	PortsTotal    int `json:"portsTotal"`
+	PortsCharging int `json:"portsCharging"`
+	PortsFault    int `json:"portsFault"`
+	PortsStale    int `json:"portsStale"`
+}
+
+// GetDevicePortStatus 设备各端口状态（按端口号排序）：端口状态上报与进行中订单合并，只读取内存状态，不访问设备
+func (g *DeviceGateway) GetDevicePortStatus(deviceID string) []DevicePortStatus {
+	byPort := make(map[int]*DevicePortStatus)
+	if g.stations != nil {
+		now := time.Now()
+		window := g.stations.PortStaleWindow()
+		for _, p := range g.stations.DevicePorts(deviceID) {
+			ps := &DevicePortStatus{Port: p.Port, Status: p.Status, State: PortStateOf(p.Status), PowerW: p.PowerW, VoltageV: p.VoltageV, EnergyWh: p.EnergyWh, Reported: true}
+			if !p.UpdatedAt.IsZero() {
+				updated := p.UpdatedAt
+				ps.LastUpdate = &updated
+				if now.Sub(updated) > window {
+					ps.Stale, ps.PowerW, ps.VoltageV = true, 0, 0
+				}
+			}
+			byPort[p.Port] = ps
+		}
+	}
+	if g.orderManager != nil {
+		for _, order := range g.orderManager.ListActiveOrders() {
+			if order.DeviceID != deviceID {
+				continue
+			}
+			ps, ok := byPort[order.Port]
+			if !ok {
+				ps = &DevicePortStatus{Port: order.Port}
+				byPort[order.Port] = ps
+			}
+			ps.OrderNo = order.OrderNo
+			ps.OrderStatus = order.Status.String()
+		}
+	}
+	ports := make([]DevicePortStatus, 0, len(byPort))
+	for _, ps := range byPort {
+		ports = append(ports, *ps)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// GetDevicePortSummary 设备端口汇总：只统计上报过状态的端口，过期端口单独计数，不计入充电/故障
+func (g *DeviceGateway) GetDevicePortSummary(deviceID string) DevicePortSummary {
+	var summary DevicePortSummary
+	for _, p := range g.GetDevicePortStatus(deviceID) {
+		if !p.Reported {
+			continue
+		}
+		summary.PortsTotal++
+		switch {
+		case p.Stale:
+			summary.PortsStale++
+		case p.State == PortStateCharging:
+			summary.PortsCharging++
+		case p.State == PortStateFault:
+			summary.PortsFault++
+		}
+	}
+	return summary
+}
+
 // GetDeviceStatistics 获取网关统计信息
 func (g *DeviceGateway) GetDeviceStatistics() map[string]interface{} {
 	stats := make(map[string]interface{})
@@ -83,9 +282,113 @@ func (g *DeviceGateway) GetDeviceStatistics() map[string]interface{} {
 	stats["groupCount"] = groupCount
 	stats["totalDeviceCount"] = totalDevices
 
+	// 索引健康检查累计计数
+	tcpStats := g.tcpManager.GetStats()
+	stats["indexHealth"] = map[string]interface{}{
+		"checks":       tcpStats.IndexChecks,
+		"healthy":      tcpStats.IndexHealthy,
+		"repaired":     tcpStats.IndexRepaired,
+		"unrepairable": tcpStats.IndexUnrepairable,
+		"lastCheckAt":  tcpStats.LastIndexCheckAt,
+	}
+
+	// 发送健康：累计发送失败、因持续发送失败关闭的连接数，及当前存在连续失败的连接
+	failingConnections := make([]map[string]interface{}, 0)
+	g.tcpManager.GetConnections().Range(func(_, value interface{}) bool {
+		session := value.(*core.ConnectionSession)
+		if health := session.GetSendHealth(); health.ConsecutiveSendFailures > 0 {
+			failingConnections = append(failingConnections, map[string]interface{}{
+				"connId":                  session.ConnID,
+				"remoteAddr":              session.RemoteAddr,
+				"sendFailures":            health.SendFailures,
+				"consecutiveSendFailures": health.ConsecutiveSendFailures,
+				"lastSendError":           health.LastSendError,
+				"lastSendFailureAt":       health.LastSendFailureAt,
+			})
+		}
+		return true
+	})
+	stats["sendHealth"] = map[string]interface{}{
+		"sendFailures":           tcpStats.SendFailures,
+		"writeFailedDisconnects": tcpStats.WriteFailedDisconnects,
+		"failingConnections":     failingConnections,
+	}
+
+	// 下行消息ID序列位置（重启恢复来源与持久化状态）
+	stats["messageIdSequence"] = msgid.GetGlobalSequence().Status()
+
 	// 时间统计
 	stats["timestamp"] = time.Now().Unix()
 	stats["formattedTime"] = time.Now().Format("2006-01-02 15:04:05")
 
 	return stats
 }
+
+// GetICCIDConflicts 获取当前ICCID冲突记录（疑似SIM克隆/错误配置）
+func (g *DeviceGateway) GetICCIDConflicts() []core.ICCIDConflict {
+	if g.tcpManager == nil {
+		return []core.ICCIDConflict{}
+	}
+	return g.tcpManager.GetICCIDConflicts()
+}
+
+// RunIndexHealthCheck 立即执行设备索引健康检查（与定时检查互斥）
+func (g *DeviceGateway) RunIndexHealthCheck(ctx context.Context) (*core.IndexCheckResult, error) {
+	if g.tcpManager == nil {
+		return nil, fmt.Errorf("TCP管理器未初始化")
+	}
+	return g.tcpManager.RunIndexHealthCheck(ctx, core.IndexCheckTriggerManual)
+}
+
+// LastIndexHealthCheck 最近一次定时索引健康检查结果
+func (g *DeviceGateway) LastIndexHealthCheck() (*core.IndexCheckResult, bool) {
+	if g.tcpManager == nil {
+		return nil, false
+	}
+	return g.tcpManager.LastIndexHealthCheck()
+}
+
+// CompactDeviceGroups 立即执行一次设备组惰性压缩
+func (g *DeviceGateway) CompactDeviceGroups() (core.CompactionResult, error) {
+	if g.tcpManager == nil {
+		return core.CompactionResult{}, fmt.Errorf("TCP管理器未初始化")
+	}
+	return g.tcpManager.CompactDeviceGroups(), nil
+}
+
+// GroupCompactionStats 设备组压缩累计统计
+func (g *DeviceGateway) GroupCompactionStats() (core.GroupCompactionStats, error) {
+	if g.tcpManager == nil {
+		return core.GroupCompactionStats{}, fmt.Errorf("TCP管理器未初始化")
+	}
+	return g.tcpManager.GetGroupCompactionStats(), nil
+}
+
+// DeclareSIMPair 声明双卡设备的SIM卡对（API来源）
+func (g *DeviceGateway) DeclareSIMPair(deviceID, primaryICCID, secondaryICCID string) (core.SIMPairStatus, error) {
+	if g.tcpManager == nil {
+		return core.SIMPairStatus{}, fmt.Errorf("TCP管理器未初始化")
+	}
+	return g.tcpManager.GetSIMPairRegistry().Declare(core.SIMPair{
+		DeviceID:       deviceID,
+		PrimaryICCID:   primaryICCID,
+		SecondaryICCID: secondaryICCID,
+		Source:         core.SIMPairSourceAPI,
+	})
+}
+
+// GetSIMPair 获取设备的SIM卡对状态
+func (g *DeviceGateway) GetSIMPair(deviceID string) (core.SIMPairStatus, bool) {
+	if g.tcpManager == nil {
+		return core.SIMPairStatus{}, false
+	}
+	return g.tcpManager.GetSIMPairRegistry().Get(deviceID)
+}
+
+// RemoveSIMPair 删除设备的SIM卡对
+func (g *DeviceGateway) RemoveSIMPair(deviceID string) bool {
+	if g.tcpManager == nil {
+		return false
+	}
+	return g.tcpManager.GetSIMPairRegistry().Remove(deviceID)
+}
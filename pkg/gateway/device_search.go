@@ -0,0 +1,377 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+)
+
+const (
+	// SearchMinQueryLength 查询串（去掉通配符后）的最少字符数，避免极短查询匹配全部设备
+	SearchMinQueryLength = 4
+	// SearchDefaultLimit 默认返回条数
+	SearchDefaultLimit = 20
+	// SearchMaxLimit 单次查询返回条数上限
+	SearchMaxLimit = 100
+
+	searchOfflineRetention = 7 * 24 * time.Hour // 离线设备快照保留时长
+	searchMaxOffline       = 50000              // 离线设备快照数量上限，超过时淘汰最早离线的
+)
+
+// 可搜索字段（顺序即同等匹配程度下的排序优先级）
+const (
+	SearchFieldDeviceID   = "deviceId"
+	SearchFieldPhysicalID = "physicalId"
+	SearchFieldICCID      = "iccid"
+	SearchFieldAssetCode  = "assetCode"
+	SearchFieldRemoteIP   = "remoteIp"
+)
+
+// ErrSearchQueryTooShort 查询串过短
+var ErrSearchQueryTooShort = fmt.Errorf("查询至少需要%d个字符", SearchMinQueryLength)
+
+// DeviceSearchRecord 设备搜索快照
+type DeviceSearchRecord struct {
+	DeviceID   string    `json:"deviceId"`
+	PhysicalID string    `json:"physicalId"` // 十六进制物理ID
+	ICCID      string    `json:"iccid"`
+	AssetCode  string    `json:"assetCode,omitempty"`
+	RemoteIP   string    `json:"remoteIp,omitempty"`
+	Online     bool      `json:"online"`
+	LastSeen   time.Time `json:"lastSeen"` // 在线设备为最近注册时间，离线设备为离线时间
+}
+
+// DeviceSearchMatch 搜索结果
+type DeviceSearchMatch struct {
+	DeviceSearchRecord
+	MatchedField string `json:"matchedField"`
+	MatchedValue string `json:"matchedValue"`
+	Highlight    string `json:"highlight"`  // 匹配部分用 [] 标出，如 04A2[6CF3]
+	MatchStart   int    `json:"matchStart"` // 匹配区间在 MatchedValue 中的字节偏移 [start, end)
+	MatchEnd     int    `json:"matchEnd"`
+	score        int
+}
+
+// searchEntry 索引项：字段值预先转为小写，查询时只做子串比较
+type searchEntry struct {
+	record DeviceSearchRecord
+	fields [5]searchField
+}
+
+type searchField struct {
+	name  string
+	value string
+	lower string
+}
+
+// DeviceSearchIndex 设备搜索索引：在线设备在注册时写入，断开时转为离线快照保留一段时间，
+// 使刚离线的设备仍可被找到；索引按设备增量更新，查询只对预先转小写的字段做子串比较，
+// 不访问连接与设备表（10万设备单次查询在毫秒级）
+type DeviceSearchIndex struct {
+	mu           sync.RWMutex
+	entries      map[string]*searchEntry
+	offlineCount int
+	lastPrune    time.Time
+
+	offlineRetention time.Duration
+	maxOffline       int
+}
+
+// NewDeviceSearchIndex 创建设备搜索索引
+func NewDeviceSearchIndex() *DeviceSearchIndex {
+	return &DeviceSearchIndex{
+		entries:          make(map[string]*searchEntry),
+		offlineRetention: searchOfflineRetention,
+		maxOffline:       searchMaxOffline,
+	}
+}
+
+// Upsert 写入或更新设备快照
+func (x *DeviceSearchIndex) Upsert(record DeviceSearchRecord) {
+	if record.DeviceID == "" {
+		return
+	}
+	entry := newSearchEntry(record)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if old, ok := x.entries[record.DeviceID]; ok && !old.record.Online {
+		x.offlineCount--
+	}
+	if !record.Online {
+		x.offlineCount++
+	}
+	x.entries[record.DeviceID] = entry
+}
+
+// MarkOffline 设备断开：保留最后已知信息作为离线快照
+func (x *DeviceSearchIndex) MarkOffline(deviceID string, now time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entry, ok := x.entries[deviceID]
+	if !ok || !entry.record.Online {
+		return
+	}
+	record := entry.record
+	record.Online = false
+	record.LastSeen = now
+	x.entries[deviceID] = newSearchEntry(record)
+	x.offlineCount++
+	// 全量清理的开销与设备数成正比，只在超过上限或距上次清理超过1小时时执行
+	if x.offlineCount > x.maxOffline || now.Sub(x.lastPrune) > time.Hour {
+		x.pruneLocked(now)
+	}
+}
+
+// Remove 删除设备快照（设备停用时调用，停用设备不再出现在搜索结果中）
+func (x *DeviceSearchIndex) Remove(deviceID string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entry, ok := x.entries[deviceID]
+	if !ok {
+		return
+	}
+	if !entry.record.Online {
+		x.offlineCount--
+	}
+	delete(x.entries, deviceID)
+}
+
+// pruneLocked 清理过期离线快照，超过数量上限时淘汰最早离线的
+func (x *DeviceSearchIndex) pruneLocked(now time.Time) {
+	x.lastPrune = now
+	var offline []*searchEntry
+	for id, e := range x.entries {
+		if e.record.Online {
+			continue
+		}
+		if now.Sub(e.record.LastSeen) > x.offlineRetention {
+			delete(x.entries, id)
+			continue
+		}
+		offline = append(offline, e)
+	}
+	x.offlineCount = len(offline)
+	if len(offline) <= x.maxOffline {
+		return
+	}
+	sort.Slice(offline, func(i, j int) bool { return offline[i].record.LastSeen.Before(offline[j].record.LastSeen) })
+	for _, e := range offline[:len(offline)-x.maxOffline] {
+		delete(x.entries, e.record.DeviceID)
+	}
+	x.offlineCount = x.maxOffline
+}
+
+// Size 索引中的设备数
+func (x *DeviceSearchIndex) Size() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// Search 按设备ID、物理ID、ICCID、资产编码、远端IP做不区分大小写的子串匹配，返回排序后的前 limit 条。
+// 查询中的 "..." 或 "*" 表示任意字符（如 8986...8297），IP 中的 x 段表示任意段（如 112.23.x.x）
+func (x *DeviceSearchIndex) Search(query string, limit int, now time.Time) ([]DeviceSearchMatch, error) {
+	parts := parseSearchQuery(query)
+	length := 0
+	for _, p := range parts {
+		length += len(p)
+	}
+	if length < SearchMinQueryLength {
+		return nil, ErrSearchQueryTooShort
+	}
+	if limit <= 0 {
+		limit = SearchDefaultLimit
+	}
+	if limit > SearchMaxLimit {
+		limit = SearchMaxLimit
+	}
+
+	x.mu.RLock()
+	var matches []DeviceSearchMatch
+	for _, e := range x.entries {
+		if !e.record.Online && now.Sub(e.record.LastSeen) > x.offlineRetention {
+			continue
+		}
+		if m, ok := e.match(parts); ok {
+			matches = append(matches, m)
+		}
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.Online != b.Online {
+			return a.Online
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func newSearchEntry(record DeviceSearchRecord) *searchEntry {
+	e := &searchEntry{record: record}
+	values := [5][2]string{
+		{SearchFieldDeviceID, record.DeviceID},
+		{SearchFieldPhysicalID, record.PhysicalID},
+		{SearchFieldICCID, record.ICCID},
+		{SearchFieldAssetCode, record.AssetCode},
+		{SearchFieldRemoteIP, record.RemoteIP},
+	}
+	for i, v := range values {
+		lower := strings.ToLower(v[1])
+		if len(lower) != len(v[1]) {
+			lower = v[1] // 大小写转换改变了字节长度（非ASCII），按原值匹配以保证高亮偏移正确
+		}
+		e.fields[i] = searchField{name: v[0], value: v[1], lower: lower}
+	}
+	return e
+}
+
+// 匹配程度得分：完全匹配 > 后缀 > 前缀 > 包含；同等程度下按字段顺序
+const (
+	searchScoreContains = 1
+	searchScorePrefix   = 2
+	searchScoreSuffix   = 3
+	searchScoreExact    = 4
+)
+
+// match 取匹配程度最高的字段
+func (e *searchEntry) match(parts []string) (DeviceSearchMatch, bool) {
+	best := DeviceSearchMatch{score: -1}
+	for i, f := range e.fields {
+		if f.lower == "" {
+			continue
+		}
+		start, end, ok := matchParts(f.lower, parts)
+		if !ok {
+			continue
+		}
+		kind := searchScoreContains
+		switch {
+		case start == 0 && end == len(f.lower):
+			kind = searchScoreExact
+		case end == len(f.lower):
+			kind = searchScoreSuffix
+		case start == 0:
+			kind = searchScorePrefix
+		}
+		score := kind*len(e.fields) + (len(e.fields) - i)
+		if score > best.score {
+			best = DeviceSearchMatch{
+				DeviceSearchRecord: e.record,
+				MatchedField:       f.name,
+				MatchedValue:       f.value,
+				Highlight:          f.value[:start] + "[" + f.value[start:end] + "]" + f.value[end:],
+				MatchStart:         start,
+				MatchEnd:           end,
+				score:              score,
+			}
+		}
+	}
+	return best, best.score >= 0
+}
+
+// matchParts 各片段按顺序出现在 value 中，返回首个片段起点到末个片段终点的区间
+func matchParts(value string, parts []string) (start, end int, ok bool) {
+	offset := 0
+	for i, p := range parts {
+		idx := strings.Index(value[offset:], p)
+		if idx < 0 {
+			return 0, 0, false
+		}
+		if i == 0 {
+			start = offset + idx
+		}
+		offset += idx + len(p)
+	}
+	// 单片段时优先取最靠后的出现位置，使 "6CF3" 这类尾号查询命中后缀
+	if len(parts) == 1 {
+		if last := strings.LastIndex(value, parts[0]); last+len(parts[0]) == len(value) {
+			start = last
+			offset = len(value)
+		}
+	}
+	return start, offset, true
+}
+
+// parseSearchQuery 规范化查询串并按通配符拆分为片段
+func parseSearchQuery(query string) []string {
+	q := strings.ToLower(strings.TrimSpace(query))
+	q = strings.TrimPrefix(q, "0x")
+	q = strings.ReplaceAll(q, "...", "*")
+	if strings.Contains(q, ".") {
+		segments := strings.Split(q, ".")
+		for i, s := range segments {
+			if s == "x" {
+				segments[i] = "*"
+			}
+		}
+		q = strings.Join(segments, ".")
+	}
+	var parts []string
+	for _, p := range strings.Split(q, "*") {
+		if p = strings.Trim(p, "."); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// ===============================
+// 网关接入
+// ===============================
+
+// indexDeviceForSearch 设备注册后写入搜索索引（资产编码按当前资产映射解析）
+func (g *DeviceGateway) indexDeviceForSearch(deviceID string, now time.Time) {
+	if g.search == nil || g.tcpManager == nil {
+		return
+	}
+	device, ok := g.tcpManager.GetDeviceByID(deviceID)
+	if !ok {
+		return
+	}
+	device.RLock()
+	record := DeviceSearchRecord{
+		DeviceID:   deviceID,
+		PhysicalID: fmt.Sprintf("%08X", device.PhysicalID),
+		ICCID:      device.ICCID,
+		Online:     true,
+		LastSeen:   now,
+	}
+	device.RUnlock()
+	if session, ok := g.tcpManager.GetSessionByDeviceID(deviceID); ok {
+		record.RemoteIP = remoteHost(session.RemoteAddr)
+	}
+	if info, ok := asset.Lookup(deviceID); ok {
+		record.AssetCode = info.AssetCode
+	}
+	g.search.Upsert(record)
+}
+
+// remoteHost 去掉地址中的端口
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// SearchDevices 模糊搜索设备（在线设备及近期离线设备）
+func (g *DeviceGateway) SearchDevices(query string, limit int) ([]DeviceSearchMatch, error) {
+	if g.search == nil {
+		return nil, errors.New("设备搜索索引未初始化")
+	}
+	return g.search.Search(query, limit, time.Now())
+}
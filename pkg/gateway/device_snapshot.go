@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// DeviceStateSnapshot 设备当前状态快照（供运维变更记录对比调用前后的状态）：
+// 在线状态、最近下发命令、端口状态、活跃订单与设备参数缓存；只读取内存状态，不访问设备
+func (g *DeviceGateway) DeviceStateSnapshot(deviceID string) map[string]interface{} {
+	snapshot := map[string]interface{}{"online": false}
+
+	if g.tcpManager != nil {
+		if device, ok := g.tcpManager.GetDeviceByID(deviceID); ok {
+			device.RLock()
+			snapshot["online"] = true
+			snapshot["status"] = device.Status
+			snapshot["deviceVersion"] = device.DeviceVersion
+			if !device.LastCommandAt.IsZero() {
+				snapshot["lastCommand"] = map[string]interface{}{
+					"command": device.LastCommandCode,
+					"at":      device.LastCommandAt,
+				}
+			}
+			device.RUnlock()
+		}
+	}
+
+	if g.stations != nil {
+		if ports := g.stations.DevicePorts(deviceID); ports != nil {
+			snapshot["ports"] = ports
+		}
+	}
+
+	if g.orderManager != nil {
+		orders := make([]map[string]interface{}, 0)
+		for _, order := range g.orderManager.ListActiveOrders() {
+			if order.DeviceID != deviceID {
+				continue
+			}
+			orders = append(orders, map[string]interface{}{
+				"orderNo": order.OrderNo,
+				"port":    order.Port,
+				"status":  order.Status.String(),
+				"mode":    order.Mode,
+				"value":   order.Value,
+			})
+		}
+		snapshot["activeOrders"] = orders
+	}
+
+	if params, ok := core.GetDeviceParamCache().Get(deviceID); ok {
+		snapshot["params"] = params.Values
+	}
+	return snapshot
+}
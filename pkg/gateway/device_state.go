@@ -63,6 +63,26 @@ func (g *DeviceGateway) GetAllOnlineDevices() []string {
 	return onlineDevices
 }
 
+// OnlineDevicesByICCID 按ICCID统计在线设备数（全网在线设备数告警的采样来源）
+func (g *DeviceGateway) OnlineDevicesByICCID() map[string]int {
+	online := make(map[string]int)
+	if g.tcpManager == nil {
+		return online
+	}
+	g.tcpManager.GetDeviceGroups().Range(func(key, value interface{}) bool {
+		deviceGroup := value.(*core.DeviceGroup)
+		deviceGroup.RLock()
+		for _, device := range deviceGroup.Devices {
+			if device.Status == constants.DeviceStatusOnline {
+				online[deviceGroup.ICCID]++
+			}
+		}
+		deviceGroup.RUnlock()
+		return true
+	})
+	return online
+}
+
 // CountOnlineDevices 统计在线设备数量
 func (g *DeviceGateway) CountOnlineDevices() int {
 	return len(g.GetAllOnlineDevices())
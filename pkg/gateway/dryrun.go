@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// CommandPreview 试运行构造的命令帧（未下发，不注册命令、不占用消息ID、不创建会话）
+type CommandPreview struct {
+	DeviceID   string `json:"deviceId"`
+	PhysicalID string `json:"physicalId"`
+	Command    string `json:"command"`   // 0x82
+	MessageID  uint16 `json:"messageId"` // 按当前序列预计分配的消息ID，实际下发时以下发时刻分配的为准
+	DataHex    string `json:"dataHex"`
+	PacketHex  string `json:"packetHex"` // 完整DNY帧
+	Packet     []byte `json:"-"`
+}
+
+// PreviewCommand 按发送路径的设备校验（在线、会话、固件能力）构造命令帧但不下发
+func (g *DeviceGateway) PreviewCommand(deviceID string, command byte, data []byte) (CommandPreview, error) {
+	if g.tcpManager == nil {
+		return CommandPreview{}, fmt.Errorf("TCP管理器未初始化")
+	}
+	stdDeviceID, err := (&utils.DeviceIDProcessor{}).SmartConvertDeviceID(deviceID)
+	if err != nil {
+		return CommandPreview{}, fmt.Errorf("设备ID解析失败: %v", err)
+	}
+	if _, exists := g.tcpManager.GetConnectionByDeviceID(stdDeviceID); !exists {
+		return CommandPreview{}, fmt.Errorf("设备 %s 不在线", stdDeviceID)
+	}
+	if _, exists := g.tcpManager.GetSessionByDeviceID(stdDeviceID); !exists {
+		return CommandPreview{}, fmt.Errorf("设备会话不存在")
+	}
+	physicalID, err := utils.ParseDeviceIDToPhysicalID(stdDeviceID)
+	if err != nil {
+		return CommandPreview{}, fmt.Errorf("设备ID格式错误: %v", err)
+	}
+	if _, exists := g.tcpManager.GetDeviceByID(stdDeviceID); !exists {
+		return CommandPreview{}, fmt.Errorf("设备 %s 不存在", stdDeviceID)
+	}
+	if err := g.CheckCommandSupported(stdDeviceID, command); err != nil {
+		return CommandPreview{}, err
+	}
+
+	messageID := msgid.GetGlobalSequence().Peek()
+	packet := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(physicalID, messageID, command, data)
+	if err := protocol.ValidateUnifiedDNYPacket(packet); err != nil {
+		return CommandPreview{}, fmt.Errorf("DNY包校验失败: %w", err)
+	}
+	return CommandPreview{
+		DeviceID:   stdDeviceID,
+		PhysicalID: utils.FormatPhysicalID(physicalID),
+		Command:    fmt.Sprintf("0x%02X", command),
+		MessageID:  messageID,
+		DataHex:    fmt.Sprintf("%X", data),
+		PacketHex:  fmt.Sprintf("%X", packet),
+		Packet:     packet,
+	}, nil
+}
+
+// PreviewChargingCommand 试运行0x82开始/停止充电：与下发相同的参数校验与促销咨询，返回生效的促销与命令帧
+func (g *DeviceGateway) PreviewChargingCommand(req ChargeRequest, action uint8) (*AppliedPromotion, CommandPreview, error) {
+	req, promo, commandData, _, err := g.buildChargingPayload(req, action)
+	if err != nil {
+		return nil, CommandPreview{}, err
+	}
+	preview, err := g.PreviewCommand(req.DeviceID, constants.CmdChargeControl, commandData)
+	return promo, preview, err
+}
+
+// PreviewOverloadUpdate 试运行0x82仅更新过载功率/最大充电时长
+func (g *DeviceGateway) PreviewOverloadUpdate(deviceID string, port uint8, orderNo string, overloadPowerW uint16, maxChargeDurationSeconds uint16) (CommandPreview, error) {
+	payload, _, _, _, err := g.buildOverloadPayload(deviceID, port, orderNo, overloadPowerW, maxChargeDurationSeconds)
+	if err != nil {
+		return CommandPreview{}, err
+	}
+	return g.PreviewCommand(deviceID, constants.CmdChargeControl, payload)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
@@ -14,8 +15,15 @@ import (
 // DynamicPowerController 智能降功率控制器
 type DynamicPowerController struct {
 	cfg     config.SmartChargingConfig
+	enabled atomic.Bool // 运行时开关（初值取自配置）
 	mu      sync.RWMutex
 	entries map[string]*dpcEntry // key: deviceID|port
+
+	// 站点功率预算（由功率时段调度器输入）；redistributeMu 串行化重新分配与下发
+	budgetMu       sync.Mutex
+	budgets        map[string]*stationBudget
+	applier        PowerLimitApplier
+	redistributeMu sync.Mutex
 }
 
 type dpcEntry struct {
@@ -45,7 +53,9 @@ func InitDynamicPowerController() {
 		globalDPC = &DynamicPowerController{
 			cfg:     config.GetConfig().SmartCharging,
 			entries: make(map[string]*dpcEntry),
+			budgets: make(map[string]*stationBudget),
 		}
+		globalDPC.enabled.Store(globalDPC.cfg.Enabled)
 		logger.Info("智能降功率控制器已初始化")
 	})
 }
@@ -58,6 +68,40 @@ func GetDynamicPowerController() *DynamicPowerController {
 	return globalDPC
 }
 
+// Enabled 是否启用智能降功率
+func (d *DynamicPowerController) Enabled() bool {
+	return d != nil && d.enabled.Load()
+}
+
+// SetEnabled 运行时启用或停用智能降功率（停用后不再调整，已下发的过载功率保持不变）
+func (d *DynamicPowerController) SetEnabled(enabled bool) {
+	d.enabled.Store(enabled)
+}
+
+// SeedOverload 以指定过载功率登记会话（降功率接入的会话），后续调整从该值开始下降，不会高于该值
+func (d *DynamicPowerController) SeedOverload(deviceID string, port1Based int, orderNo string, overloadW int, at time.Time) {
+	if d == nil || deviceID == "" || orderNo == "" || overloadW <= 0 {
+		return
+	}
+	d.mu.Lock()
+	d.entries[makeKey(deviceID, port1Based)] = &dpcEntry{deviceID: deviceID, port1Based: port1Based, orderNo: orderNo, firstChargingAt: at, lastOverloadW: overloadW}
+	d.mu.Unlock()
+}
+
+// Overload 会话当前的过载功率目标(瓦)，未登记或尚未调整时返回false
+func (d *DynamicPowerController) Overload(deviceID string, port1Based int, orderNo string) (int, bool) {
+	if d == nil {
+		return 0, false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	entry := d.entries[makeKey(deviceID, port1Based)]
+	if entry == nil || entry.orderNo != orderNo || entry.lastOverloadW == 0 {
+		return 0, false
+	}
+	return entry.lastOverloadW, true
+}
+
 func makeKey(deviceID string, port1Based int) string {
 	return fmt.Sprintf("%s|%d", deviceID, port1Based)
 }
@@ -65,7 +109,7 @@ func makeKey(deviceID string, port1Based int) string {
 // OnPowerHeartbeat 由 06/26 心跳回调
 // port1Based: 业务侧端口(从1开始)。realtimePowerW: 当前功率(瓦)。isCharging: 是否充电中。
 func (d *DynamicPowerController) OnPowerHeartbeat(deviceID string, port1Based int, orderNo string, realtimePowerW int, isCharging bool, observedAt time.Time) {
-	if d == nil || !d.cfg.Enabled {
+	if !d.Enabled() {
 		return
 	}
 	if port1Based <= 0 || deviceID == "" || orderNo == "" || !isCharging {
@@ -118,6 +162,10 @@ func (d *DynamicPowerController) OnPowerHeartbeat(deviceID string, port1Based in
 	}
 
 	target := int(math.Max(float64(lastOver)*(1.0-step), float64(minW)))
+	// 站点功率预算分配的上限优先
+	if capW, ok := d.budgetCap(deviceID, port1Based, orderNo); ok && target > capW {
+		target = capW
+	}
 
 	// 防抖：变化阈值
 	if abs(target-lastOver) < d.cfg.ChangeThresholdW {
@@ -125,11 +173,8 @@ func (d *DynamicPowerController) OnPowerHeartbeat(deviceID string, port1Based in
 	}
 
 	// 下发 0x82 更新过载功率（最大充电时长不修改=0）
-	dg := GetGlobalDeviceGateway()
-	if dg == nil {
-		return
-	}
-	if err := dg.UpdateChargingOverloadPower(deviceID, uint8(port1Based), orderNo, uint16(target), 0); err != nil {
+	applier := d.limitApplier()
+	if err := applier.ApplyPowerLimit(deviceID, port1Based, orderNo, target); err != nil {
 		logger.WithFields(logrus.Fields{
 			"deviceID": deviceID,
 			"port":     port1Based,
@@ -167,7 +212,7 @@ func (d *DynamicPowerController) OnPowerHeartbeat(deviceID string, port1Based in
 			margin := 10 // 瓦
 			if e.lastObservedW > tgt+margin {
 				d.mu.Unlock()
-				if err := dg.UpdateChargingOverloadPower(dev, uint8(p1), ord, uint16(tgt), 0); err == nil {
+				if err := applier.ApplyPowerLimit(dev, p1, ord, tgt); err == nil {
 					logger.WithFields(logrus.Fields{
 						"deviceID": dev,
 						"port":     p1,
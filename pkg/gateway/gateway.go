@@ -3,11 +3,15 @@ package gateway
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
 	"github.com/bujia-iot/iot-zinx/pkg/network"
 	"github.com/sirupsen/logrus"
 )
@@ -27,6 +31,66 @@ type DeviceGateway struct {
 	// 🔧 修复CVE-Critical-002: 使用完整的充电状态机管理器
 	stateMachineManager *StateMachineManager
 
+	// 设备侧排队跟踪（0x82应答待充端口位图）
+	chargeQueue *ChargeQueueTracker
+
+	// 设备并发充电会话上限（供电容量）
+	sessionLimits *SessionLimiter
+
+	// 开始充电前的促销策略钩子
+	promotionMu     sync.RWMutex
+	promotionPolicy PromotionPolicy
+
+	// 远程重启跟踪
+	reboots *RebootTracker
+
+	// 设备组广播（同一ICCID共享连接的设备批量下发）
+	groupBroadcasts *GroupBroadcastTracker
+
+	// 设备配置读取与黄金模板
+	configReader    *DeviceConfigReader
+	configTemplates *ConfigTemplateStore
+
+	// 启动后注册补齐（对已上报ICCID未注册的连接主动请求注册）
+	registrationBackfill *RegistrationBackfill
+
+	// 自适应心跳间隔
+	heartbeatTuner *HeartbeatTuner
+
+	// 站点聚合（按资产映射的站点汇总设备与端口状态）
+	stations *StationAggregator
+
+	// 延迟命令（设备离线时暂存，注册后下发）
+	deferred *DeferredQueue
+
+	// 设备模糊搜索索引（在线设备与近期离线设备）
+	search *DeviceSearchIndex
+
+	// 设备宏（多步运维命令）
+	macros *MacroEngine
+
+	// 计量积分（功率心跳积分电量，结算时对比上报电量）
+	metering *MeteringTracker
+
+	// 充电会话生命周期（按订单跟踪 requested→started→charging→settling→completed）
+	chargingSessions *ChargingSessionManager
+
+	// 站点功率时段预算（经智能降功率控制器分配到端口）
+	powerProfiles *PowerProfileScheduler
+
+	// 设备详情短TTL缓存
+	detailCache *DeviceDetailCache
+
+	// 网关启动时间（运行时长统计）
+	startedAt time.Time
+
+	// 只读副本模式：拒绝下发任何命令
+	readOnly atomic.Bool
+
+	// 设备注册回调（热备接管后恢复设备统计等）
+	registrationMu       sync.RWMutex
+	registrationHandlers []func(deviceID string)
+
 	// 🚫 弃用: 旧的订单上下文缓存，由OrderManager替换
 	// orderCtxMu sync.RWMutex
 	// orderCtx   map[string]OrderContext
@@ -48,7 +112,7 @@ func NewDeviceGateway() *DeviceGateway {
 		}
 	}
 
-	return &DeviceGateway{
+	g := &DeviceGateway{
 		tcpManager:       core.GetGlobalTCPManager(),
 		tcpWriter:        network.NewTCPWriter(retryConfig, logger.GetLogger()),
 		lastSendByDevice: make(map[string]time.Time),
@@ -56,28 +120,98 @@ func NewDeviceGateway() *DeviceGateway {
 		orderManager: NewOrderManager(),
 		// 🔧 修复CVE-Critical-002: 初始化状态机管理器
 		stateMachineManager: NewStateMachineManager(),
+		chargeQueue:         NewChargeQueueTracker(config.GetConfig().ChargeQueue),
+		reboots:             NewRebootTracker(config.GetConfig().Reboot),
+		groupBroadcasts:     NewGroupBroadcastTracker(config.GetConfig().GroupBroadcast),
+		startedAt:           time.Now(),
+		configTemplates:     NewConfigTemplateStore(config.GetConfig().DeviceConfig.TemplateFile),
+		stations:            NewStationAggregator(config.GetConfig().Stations),
+		search:              NewDeviceSearchIndex(),
+		metering:            NewMeteringTracker(),
+		chargingSessions:    NewChargingSessionManager(config.GetConfig().ChargingSessions),
+	}
+	g.sessionLimits = NewSessionLimiter(config.GetConfig().SessionLimits, g.orderManager.ActivePorts, GetDynamicPowerController().Enabled)
+	g.configReader = NewDeviceConfigReader(config.GetConfig().DeviceConfig, g.sendConfigQuery)
+	g.macros = NewMacroEngine(config.GetConfig().Macros, gatewayMacroCommander{g: g})
+	g.startChargeQueueWorker()
+	g.startChargingSessionWorker()
+	g.startRebootWorker()
+	g.registrationBackfill = NewRegistrationBackfill(config.GetConfig().RegistrationBackfill, g.tcpManager, g.sendRegistrationSolicit)
+	g.registrationBackfill.startWorker()
+	g.heartbeatTuner = NewHeartbeatTuner(config.GetConfig().HeartbeatTuning, g.sendHeartbeatParam)
+	g.startHeartbeatTuningWorker()
+	g.startStationRemapWorker()
+	g.powerProfiles = NewPowerProfileScheduler(config.GetConfig().PowerProfiles, GetDynamicPowerController())
+	g.startPowerProfileWorker()
+	g.detailCache = NewDeviceDetailCache(config.GetConfig().DetailCache)
+	g.detailCache.SubscribeInvalidation(events.GetGlobalBus())
+	g.deferred = NewDeferredQueue(config.GetConfig().DeferredCommands, g.IsDeviceOnline)
+	g.registerDeferredExecutors()
+	g.startDeferredWorker()
+
+	// 连接清理时立即失败其上待应答的命令，避免HTTP调用方等到单条命令超时；断连计数用于识别大规模断连与评估设备连接稳定性
+	if g.tcpManager != nil {
+		g.tcpManager.SetConnectionCleanupHandler(func(connID uint64, deviceIDs []string, reason string) {
+			now := time.Now()
+			network.GetCommandManager().FailConnectionCommands(connID, reason)
+			if reg := lowdata.GetGlobalRegistry(); reg != nil {
+				reg.Forget(connID, deviceIDs)
+			}
+			g.registrationBackfill.NoteDisconnect(now)
+			if reason == core.CleanupReasonSIMFailover {
+				return // 双卡切换：设备已在新卡连接上注册，不计入断连
+			}
+			for _, deviceID := range deviceIDs {
+				g.heartbeatTuner.NoteDisconnect(deviceID, now)
+				g.stations.OnDeviceOffline(deviceID, now)
+				availability.GetGlobalTracker().OnDeviceOffline(deviceID, now)
+				g.search.MarkOffline(deviceID, now)
+			}
+		})
+
+		// 发送结果回写连接会话：连续发送失败的连接由TCP管理器以 write_failed 关闭
+		tcpManager := g.tcpManager
+		network.SetSendResultObserver(func(connID uint64, err error, elapsed time.Duration) {
+			tcpManager.RecordSendResult(connID, err, elapsed)
+		})
+
+		// 低流量模式按设备所在连接的ICCID与资产租户分配
+		lowdata.SetDeviceLocator(g.lowDataLocator)
+
+		// TCPManager.SendCommandToDevice 经设备组出站队列下发时由网关构包与跟踪应答
+		g.tcpManager.SetCommandWriter(g.writeQueuedCommand)
 	}
+	return g
 }
 
 // ===============================
 // 全局网关实例管理
 // ===============================
 
-var globalDeviceGateway *DeviceGateway
+var (
+	globalDeviceGateway *DeviceGateway
+	globalGatewayMutex  sync.RWMutex
+)
 
-// GetGlobalDeviceGateway 获取全局设备网关实例
+// GetGlobalDeviceGateway 获取全局设备网关实例，未初始化时panic
 func GetGlobalDeviceGateway() *DeviceGateway {
+	globalGatewayMutex.RLock()
+	defer globalGatewayMutex.RUnlock()
 	if globalDeviceGateway == nil {
-		globalDeviceGateway = NewDeviceGateway()
-		logger.Info("全局设备网关已初始化")
+		panic("gateway: 设备网关尚未初始化，请先执行 bootstrap.New（测试使用 bootstrap.InitForTest）")
 	}
 	return globalDeviceGateway
 }
 
-// InitializeGlobalDeviceGateway 初始化全局设备网关
-func InitializeGlobalDeviceGateway() {
-	globalDeviceGateway = NewDeviceGateway()
-	logger.Info("全局设备网关初始化完成")
+// InitializeGlobalDeviceGateway 初始化全局设备网关（依赖TCP管理器与命令管理器；重复调用返回已有实例）
+func InitializeGlobalDeviceGateway() *DeviceGateway {
+	globalGatewayMutex.Lock()
+	defer globalGatewayMutex.Unlock()
+	if globalDeviceGateway == nil {
+		globalDeviceGateway = NewDeviceGateway()
+		logger.Info("全局设备网关初始化完成")
+	}
+	return globalDeviceGateway
 }
 
 // ===============================
@@ -109,13 +243,21 @@ func (g *DeviceGateway) FinalizeChargingSession(deviceID string, port int, order
 			// 将状态置为已完成（若仍处于pending/charging），以便记录EndTime
 			if order.Status == OrderStatusPending || order.Status == OrderStatusCharging {
 				_ = g.orderManager.UpdateOrderStatus(deviceID, port, OrderStatusCompleted, cleanupReason)
+			} else if order.Status == OrderStatusQueued {
+				// 排队中尚未开始充电即结束，视为取消
+				_ = g.orderManager.UpdateOrderStatus(deviceID, port, OrderStatusCancelled, cleanupReason)
 			}
 			// 立即清理该端口订单，释放占用
 			g.orderManager.CleanupOrder(deviceID, port, cleanupReason)
 		}
 	}
 
-	// 2) 重置/移除状态机
+	// 2) 移除排队跟踪
+	if g.chargeQueue != nil {
+		g.chargeQueue.Resolve(deviceID, port)
+	}
+
+	// 3) 重置/移除状态机
 	if g.stateMachineManager != nil {
 		if sm := g.stateMachineManager.GetStateMachine(deviceID, port); sm != nil {
 			// 将状态机切回空闲，原因标记为结算
@@ -0,0 +1,502 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	apperrors "github.com/bujia-iot/iot-zinx/pkg/errors"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultGroupBroadcastSendInterval = 100 * time.Millisecond
+	defaultGroupBroadcastAckTimeout   = 15 * time.Second
+	defaultGroupBroadcastHistorySize  = 100
+)
+
+// 组广播类型
+const (
+	GroupBroadcastTimeSync    = "time-sync"    // 0x22 下发服务器时间（设备不应答）
+	GroupBroadcastPowerParams = "power-params" // 0x85 设置最大充电时长与过载功率（设备应答）
+	GroupBroadcastRatePush    = "rate-push"    // 费率下发（AP3000 无设备侧费率表，不支持）
+)
+
+// 组广播状态
+const (
+	GroupBroadcastStatusRunning   = "running"
+	GroupBroadcastStatusCompleted = "completed"
+)
+
+// 组内单台设备的下发状态
+const (
+	BroadcastDevicePending  = "pending"  // 等待下发
+	BroadcastDeviceSent     = "sent"     // 已下发（无应答命令的最终状态；有应答命令等待应答中）
+	BroadcastDeviceAcked    = "acked"    // 设备已应答
+	BroadcastDeviceTimeout  = "timeout"  // 等待应答超时
+	BroadcastDeviceFailed   = "failed"   // 构包或发送失败
+	BroadcastDeviceSkipped  = "skipped"  // 广播期间设备断开或离开设备组
+	BroadcastDeviceRejected = "rejected" // 设备否定应答（固件不认识或不支持该命令）
+)
+
+var (
+	ErrGroupBroadcastUnsupported = errors.New("不支持的组广播类型")
+	ErrGroupBroadcastNotFound    = errors.New("组广播记录不存在")
+	ErrDeviceGroupEmpty          = errors.New("设备组下没有在线设备")
+)
+
+// unsupportedGroupBroadcasts 已知但协议无法实现的广播类型及原因
+var unsupportedGroupBroadcasts = map[string]string{
+	GroupBroadcastRatePush: "AP3000协议无设备侧费率表，计费参数随每次0x82开始充电命令下发",
+}
+
+// GroupBroadcastRequest 组广播请求
+type GroupBroadcastRequest struct {
+	ICCID         string
+	Type          string
+	CorrelationID string
+	MaxChargeTime int // power-params: 最大充电时长(秒)
+	OverloadPower int // power-params: 过载功率(W)
+}
+
+// GroupBroadcastDevice 组内单台设备的下发结果
+type GroupBroadcastDevice struct {
+	DeviceID    string     `json:"deviceId"`
+	PhysicalID  string     `json:"physicalId"`
+	Status      string     `json:"status"`
+	SentAt      *time.Time `json:"sentAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// GroupBroadcast 组广播记录：设备列表为开始时设备组的快照，广播期间新加入的设备不在其中
+type GroupBroadcast struct {
+	ID            string                 `json:"id"`
+	ICCID         string                 `json:"iccid"`
+	Type          string                 `json:"type"`
+	Command       string                 `json:"command"`
+	AckExpected   bool                   `json:"ackExpected"`
+	CorrelationID string                 `json:"correlationId,omitempty"`
+	Status        string                 `json:"status"`
+	Counts        map[string]int         `json:"counts"` // 各下发状态的设备数
+	Devices       []GroupBroadcastDevice `json:"devices"`
+	StartedAt     time.Time              `json:"startedAt"`
+	CompletedAt   *time.Time             `json:"completedAt,omitempty"`
+
+	done chan struct{}
+}
+
+// groupBroadcastTemplate 组广播命令模板：render 按设备渲染载荷，帧头物理ID在下发时逐台替换
+type groupBroadcastTemplate struct {
+	command     byte
+	ackExpected bool
+	validate    func(req GroupBroadcastRequest) error
+	render      func(req GroupBroadcastRequest, now time.Time) []byte
+}
+
+var groupBroadcastTemplates = map[string]groupBroadcastTemplate{
+	GroupBroadcastTimeSync: {
+		command: constants.CmdDeviceTime,
+		render: func(_ GroupBroadcastRequest, now time.Time) []byte {
+			payload := make([]byte, 4)
+			binary.LittleEndian.PutUint32(payload, uint32(now.Unix()))
+			return payload
+		},
+	},
+	GroupBroadcastPowerParams: {
+		command:     constants.CmdMaxTimeAndPower,
+		ackExpected: true,
+		validate: func(req GroupBroadcastRequest) error {
+			if req.MaxChargeTime < 0 || req.MaxChargeTime > 0xFFFF {
+				return fmt.Errorf("maxChargeTime 取值范围为0-65535秒")
+			}
+			if req.OverloadPower <= 0 || req.OverloadPower > 0xFFFF {
+				return fmt.Errorf("overloadPower 取值范围为1-65535W")
+			}
+			return nil
+		},
+		render: func(req GroupBroadcastRequest, _ time.Time) []byte {
+			payload := make([]byte, 4)
+			binary.LittleEndian.PutUint16(payload[0:2], uint16(req.MaxChargeTime))
+			binary.LittleEndian.PutUint16(payload[2:4], uint16(req.OverloadPower))
+			return payload
+		},
+	},
+}
+
+// GroupBroadcastTypes 支持的组广播类型
+func GroupBroadcastTypes() []string {
+	types := make([]string, 0, len(groupBroadcastTemplates))
+	for name := range groupBroadcastTemplates {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// GroupBroadcastTracker 组广播记录跟踪
+type GroupBroadcastTracker struct {
+	mutex        sync.RWMutex
+	records      map[string]*GroupBroadcast
+	order        []string // 创建顺序（旧→新），超出上限时淘汰最早的已结束记录
+	sendInterval time.Duration
+	ackTimeout   time.Duration
+	historySize  int
+}
+
+// NewGroupBroadcastTracker 创建组广播跟踪器
+func NewGroupBroadcastTracker(cfg config.GroupBroadcastConfig) *GroupBroadcastTracker {
+	t := &GroupBroadcastTracker{
+		records:      make(map[string]*GroupBroadcast),
+		sendInterval: time.Duration(cfg.SendIntervalMs) * time.Millisecond,
+		ackTimeout:   time.Duration(cfg.AckTimeoutSeconds) * time.Second,
+		historySize:  cfg.HistorySize,
+	}
+	if t.sendInterval <= 0 {
+		t.sendInterval = defaultGroupBroadcastSendInterval
+	}
+	if t.ackTimeout <= 0 {
+		t.ackTimeout = defaultGroupBroadcastAckTimeout
+	}
+	if t.historySize <= 0 {
+		t.historySize = defaultGroupBroadcastHistorySize
+	}
+	return t
+}
+
+// SetSendInterval 设置同一连接上相邻两帧的最小间隔
+func (t *GroupBroadcastTracker) SetSendInterval(interval time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if interval > 0 {
+		t.sendInterval = interval
+	}
+}
+
+// SetAckTimeout 设置等待设备应答的超时
+func (t *GroupBroadcastTracker) SetAckTimeout(timeout time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if timeout > 0 {
+		t.ackTimeout = timeout
+	}
+}
+
+// Get 获取设备组的广播记录
+func (t *GroupBroadcastTracker) Get(iccid, id string) (GroupBroadcast, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	b, ok := t.records[id]
+	if !ok || b.ICCID != iccid {
+		return GroupBroadcast{}, false
+	}
+	return b.snapshot(), true
+}
+
+// Wait 等待广播结束或超时，返回当前记录
+func (t *GroupBroadcastTracker) Wait(iccid, id string, timeout time.Duration) (GroupBroadcast, bool) {
+	t.mutex.RLock()
+	var done chan struct{}
+	if b, ok := t.records[id]; ok && b.ICCID == iccid {
+		done = b.done
+	}
+	t.mutex.RUnlock()
+
+	if done != nil && timeout > 0 {
+		timer := time.NewTimer(timeout)
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	return t.Get(iccid, id)
+}
+
+func (t *GroupBroadcastTracker) settings() (time.Duration, time.Duration) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.sendInterval, t.ackTimeout
+}
+
+func (t *GroupBroadcastTracker) add(b *GroupBroadcast) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	b.done = make(chan struct{})
+	t.records[b.ID] = b
+	t.order = append(t.order, b.ID)
+	for i := 0; len(t.records) > t.historySize && i < len(t.order); {
+		if old := t.records[t.order[i]]; old != nil && old.Status == GroupBroadcastStatusRunning {
+			i++
+			continue
+		}
+		delete(t.records, t.order[i])
+		t.order = append(t.order[:i], t.order[i+1:]...)
+	}
+}
+
+// setDevice 更新单台设备的下发状态（已结束的设备不再变更）
+func (t *GroupBroadcastTracker) setDevice(id string, index int, status, reason string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	b, ok := t.records[id]
+	if !ok {
+		return
+	}
+	d := &b.Devices[index]
+	if d.Status != BroadcastDevicePending && d.Status != BroadcastDeviceSent {
+		return
+	}
+	if d.Status == BroadcastDeviceSent && !b.AckExpected {
+		return
+	}
+	b.Counts[d.Status]--
+	b.Counts[status]++
+	d.Status = status
+	d.Error = reason
+	at := now
+	if status == BroadcastDeviceSent {
+		d.SentAt = &at
+	} else {
+		d.CompletedAt = &at
+	}
+}
+
+func (t *GroupBroadcastTracker) finish(id string, now time.Time) (GroupBroadcast, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	b, ok := t.records[id]
+	if !ok {
+		return GroupBroadcast{}, false
+	}
+	b.Status = GroupBroadcastStatusCompleted
+	completedAt := now
+	b.CompletedAt = &completedAt
+	close(b.done)
+	return b.snapshot(), true
+}
+
+func (b *GroupBroadcast) snapshot() GroupBroadcast {
+	cp := *b
+	cp.Devices = append([]GroupBroadcastDevice(nil), b.Devices...)
+	cp.Counts = make(map[string]int, len(b.Counts))
+	for status, n := range b.Counts {
+		if n > 0 {
+			cp.Counts[status] = n
+		}
+	}
+	return cp
+}
+
+// ===============================
+// DeviceGateway 组广播
+// ===============================
+
+// GetGroupBroadcasts 获取组广播跟踪器
+func (g *DeviceGateway) GetGroupBroadcasts() *GroupBroadcastTracker {
+	return g.groupBroadcasts
+}
+
+// BroadcastToGroup 向ICCID设备组内全部在线设备广播命令：以开始时的组成员为准，
+// 逐台渲染帧（替换各自物理ID）并按连接节奏连续下发，不逐台等待应答；应答在全部下发后统一等待
+func (g *DeviceGateway) BroadcastToGroup(req GroupBroadcastRequest) (GroupBroadcast, error) {
+	if reason, ok := unsupportedGroupBroadcasts[req.Type]; ok {
+		return GroupBroadcast{}, fmt.Errorf("%w: %s（%s）", ErrGroupBroadcastUnsupported, req.Type, reason)
+	}
+	tpl, ok := groupBroadcastTemplates[req.Type]
+	if !ok {
+		return GroupBroadcast{}, fmt.Errorf("%w: %s，可选 %s", ErrGroupBroadcastUnsupported, req.Type, strings.Join(GroupBroadcastTypes(), ", "))
+	}
+	if tpl.validate != nil {
+		if err := tpl.validate(req); err != nil {
+			return GroupBroadcast{}, err
+		}
+	}
+
+	deviceIDs := g.GetDevicesByICCID(req.ICCID)
+	sort.Strings(deviceIDs)
+	devices := make([]GroupBroadcastDevice, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		d := GroupBroadcastDevice{DeviceID: deviceID, Status: BroadcastDevicePending}
+		if physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID); err == nil {
+			d.PhysicalID = utils.FormatPhysicalID(physicalID)
+		}
+		devices = append(devices, d)
+	}
+	if len(devices) == 0 {
+		return GroupBroadcast{}, fmt.Errorf("%w: %s", ErrDeviceGroupEmpty, req.ICCID)
+	}
+
+	b := &GroupBroadcast{
+		ID:            "bcast_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12],
+		ICCID:         req.ICCID,
+		Type:          req.Type,
+		Command:       dny_protocol.CommandLabel(tpl.command),
+		AckExpected:   tpl.ackExpected,
+		CorrelationID: req.CorrelationID,
+		Status:        GroupBroadcastStatusRunning,
+		Counts:        map[string]int{BroadcastDevicePending: len(devices)},
+		Devices:       devices,
+		StartedAt:     time.Now(),
+	}
+	g.groupBroadcasts.add(b)
+	snapshot, _ := g.groupBroadcasts.Get(req.ICCID, b.ID)
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": req.CorrelationID,
+		"broadcastID":   b.ID,
+		"iccid":         req.ICCID,
+		"type":          req.Type,
+		"devices":       len(devices),
+	}).Info("设备组广播开始")
+
+	go g.runGroupBroadcast(snapshot, tpl, req)
+	return snapshot, nil
+}
+
+// runGroupBroadcast 逐台下发并等待应答
+func (g *DeviceGateway) runGroupBroadcast(b GroupBroadcast, tpl groupBroadcastTemplate, req GroupBroadcastRequest) {
+	tracker := g.groupBroadcasts
+	sendInterval, ackTimeout := tracker.settings()
+	lastSendByConn := make(map[uint64]time.Time)
+	handles := make(map[int]*network.CommandHandle)
+
+	for i, d := range b.Devices {
+		// 断开或已不在本组（如迁移到其他ICCID）的设备跳过
+		if !g.inDeviceGroup(b.ICCID, d.DeviceID) {
+			tracker.setDevice(b.ID, i, BroadcastDeviceSkipped, "设备已断开或离开设备组", time.Now())
+			continue
+		}
+		conn, ok := g.tcpManager.GetConnectionByDeviceID(d.DeviceID)
+		if !ok {
+			tracker.setDevice(b.ID, i, BroadcastDeviceSkipped, "设备连接已断开", time.Now())
+			continue
+		}
+		// 连接节奏：共享连接上相邻两帧保持最小间隔
+		connID := conn.GetConnID()
+		if last, ok := lastSendByConn[connID]; ok {
+			if wait := sendInterval - time.Since(last); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		lastSendByConn[connID] = time.Now()
+
+		payload := tpl.render(req, time.Now())
+		if tpl.ackExpected {
+			handle, err := g.SendCommandToDeviceWithOptions(context.Background(), d.DeviceID, tpl.command, payload, network.CommandOptions{CorrelationID: b.CorrelationID})
+			if err != nil {
+				tracker.setDevice(b.ID, i, g.broadcastSendFailure(b.ICCID, d.DeviceID), err.Error(), time.Now())
+				continue
+			}
+			handles[i] = handle
+		} else {
+			g.throttleSend(d.DeviceID)
+			if err := g.sendUnacknowledged(context.Background(), b.CorrelationID, d.DeviceID, tpl.command, payload); err != nil {
+				tracker.setDevice(b.ID, i, g.broadcastSendFailure(b.ICCID, d.DeviceID), err.Error(), time.Now())
+				continue
+			}
+		}
+		tracker.setDevice(b.ID, i, BroadcastDeviceSent, "", time.Now())
+	}
+
+	var wg sync.WaitGroup
+	for i, handle := range handles {
+		wg.Add(1)
+		go func(i int, handle *network.CommandHandle) {
+			defer wg.Done()
+			err := waitMacroHandle(handle, ackTimeout)
+			switch {
+			case err == nil:
+				tracker.setDevice(b.ID, i, BroadcastDeviceAcked, "", time.Now())
+			case apperrors.IsErrCode(err, apperrors.ErrDeviceDisconnected):
+				tracker.setDevice(b.ID, i, BroadcastDeviceSkipped, err.Error(), time.Now())
+			case apperrors.IsErrCode(err, apperrors.ErrDeviceRejected):
+				tracker.setDevice(b.ID, i, BroadcastDeviceRejected, err.Error(), time.Now())
+			case apperrors.IsErrCode(err, apperrors.ErrCommandTimeout):
+				tracker.setDevice(b.ID, i, BroadcastDeviceTimeout, err.Error(), time.Now())
+			default:
+				tracker.setDevice(b.ID, i, BroadcastDeviceFailed, err.Error(), time.Now())
+			}
+		}(i, handle)
+	}
+	wg.Wait()
+
+	if record, ok := tracker.finish(b.ID, time.Now()); ok {
+		logger.WithFields(logrus.Fields{
+			"correlationID": b.CorrelationID,
+			"broadcastID":   b.ID,
+			"iccid":         b.ICCID,
+			"type":          b.Type,
+			"counts":        record.Counts,
+			"duration":      record.CompletedAt.Sub(record.StartedAt).String(),
+		}).Info("设备组广播完成")
+	}
+}
+
+// broadcastSendFailure 下发失败时设备已断开记为跳过，否则记为失败
+func (g *DeviceGateway) broadcastSendFailure(iccid, deviceID string) string {
+	if !g.inDeviceGroup(iccid, deviceID) {
+		return BroadcastDeviceSkipped
+	}
+	return BroadcastDeviceFailed
+}
+
+// inDeviceGroup 设备当前在线且仍属于该ICCID设备组
+func (g *DeviceGateway) inDeviceGroup(iccid, deviceID string) bool {
+	if g.tcpManager == nil {
+		return false
+	}
+	current, ok := g.tcpManager.GetDeviceIndex().Load(deviceID)
+	if !ok || current.(string) != iccid {
+		return false
+	}
+	return g.IsDeviceOnline(deviceID)
+}
+
+// SendUnacknowledged 下发设备不应答的命令（如停机通知），不经命令管理器跟踪应答，也不经同设备发送节流；
+// 在设备组出站队列中的等待受 ctx 约束（停机通知须在宽限期内结束）
+func (g *DeviceGateway) SendUnacknowledged(ctx context.Context, correlationID, deviceID string, command byte, payload []byte) error {
+	return g.sendUnacknowledged(ctx, correlationID, deviceID, command, payload)
+}
+
+// sendUnacknowledged 下发设备不应答的命令：不经命令管理器注册（避免超时重发），直接构包经统一发送器下发；
+// 需要同设备发送节流的调用方自行调用 throttleSend
+func (g *DeviceGateway) sendUnacknowledged(ctx context.Context, correlationID, deviceID string, command byte, payload []byte) error {
+	if err := g.CheckCommandSupported(deviceID, command); err != nil {
+		return err
+	}
+	if _, ok := g.tcpManager.GetConnectionByDeviceID(deviceID); !ok {
+		return fmt.Errorf("设备 %s 不在线", deviceID)
+	}
+	physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID)
+	if err != nil {
+		return fmt.Errorf("设备ID格式错误: %v", err)
+	}
+	messageID := pkg.Protocol.GetNextMessageID()
+	packet := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(physicalID, messageID, command, payload)
+	// 经设备组出站队列写入，避免与同连接上的其他命令交错；不跟踪应答，写入即完成
+	return g.tcpManager.EnqueueCommand(ctx, deviceID, command, func(conn ziface.IConnection) (core.CommandWait, error) {
+		if err := pkg.Protocol.SendDNYPacket(conn, packet); err != nil {
+			return nil, fmt.Errorf("发送命令失败: %w", err)
+		}
+		g.tcpManager.RecordDeviceCommand(deviceID, command, len(payload))
+		logger.LogSendDataWithCorrelation(correlationID, deviceID, command, messageID, conn.GetConnID(), len(payload), "DNY命令下发")
+		return nil, nil
+	})
+}
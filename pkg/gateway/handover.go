@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"sort"
+	"time"
+)
+
+// HandoverDevice 交接给热备实例的在线设备统计（设备在热备上重新注册后据此延续）
+type HandoverDevice struct {
+	DeviceID       string    `json:"deviceId"`
+	ICCID          string    `json:"iccid"`
+	DeviceType     uint16    `json:"deviceType,omitempty"`
+	DeviceVersion  string    `json:"deviceVersion,omitempty"`
+	HeartbeatCount int64     `json:"heartbeatCount"`
+	RegisteredAt   time.Time `json:"registeredAt"`
+	LastHeartbeat  time.Time `json:"lastHeartbeat"`
+}
+
+// HandoverState 交接状态：在线设备、进行中的订单与待下发的延迟命令
+type HandoverState struct {
+	Devices  []HandoverDevice  `json:"devices"`
+	Orders   []OrderState      `json:"orders"`
+	Deferred []DeferredCommand `json:"deferred"`
+}
+
+// ExportHandoverState 导出本实例的交接状态
+func (g *DeviceGateway) ExportHandoverState() HandoverState {
+	state := HandoverState{Devices: []HandoverDevice{}, Orders: []OrderState{}, Deferred: []DeferredCommand{}}
+	if g.tcpManager != nil {
+		for _, deviceID := range g.GetAllOnlineDevices() {
+			device, ok := g.tcpManager.GetDeviceByID(deviceID)
+			if !ok {
+				continue
+			}
+			device.RLock()
+			state.Devices = append(state.Devices, HandoverDevice{
+				DeviceID:       device.DeviceID,
+				ICCID:          device.ICCID,
+				DeviceType:     device.DeviceType,
+				DeviceVersion:  device.DeviceVersion,
+				HeartbeatCount: device.HeartbeatCount,
+				RegisteredAt:   device.RegisteredAt,
+				LastHeartbeat:  device.LastHeartbeat,
+			})
+			device.RUnlock()
+		}
+		sort.Slice(state.Devices, func(i, j int) bool { return state.Devices[i].DeviceID < state.Devices[j].DeviceID })
+	}
+	for _, order := range g.orderManager.ListActiveOrders() {
+		state.Orders = append(state.Orders, *order)
+	}
+	sort.Slice(state.Orders, func(i, j int) bool {
+		if state.Orders[i].DeviceID != state.Orders[j].DeviceID {
+			return state.Orders[i].DeviceID < state.Orders[j].DeviceID
+		}
+		return state.Orders[i].Port < state.Orders[j].Port
+	})
+	if g.deferred != nil {
+		state.Deferred = g.deferred.Pending()
+	}
+	return state
+}
+
+// ImportHandoverState 接管时导入交接状态中的订单与延迟命令，返回导入的订单数与命令数；
+// 设备统计在设备重新注册时由 RestoreHandoverDevice 延续
+func (g *DeviceGateway) ImportHandoverState(state HandoverState) (orders int, deferred int) {
+	for _, order := range state.Orders {
+		if g.orderManager.RestoreOrder(order) {
+			orders++
+		}
+	}
+	if g.deferred != nil {
+		deferred = g.deferred.Import(state.Deferred)
+	}
+	return orders, deferred
+}
+
+// RestoreHandoverDevice 设备在本实例重新注册后延续交接前的统计：心跳计数累加，注册时间取交接前的首次注册时间
+func (g *DeviceGateway) RestoreHandoverDevice(prior HandoverDevice) bool {
+	if g.tcpManager == nil {
+		return false
+	}
+	device, ok := g.tcpManager.GetDeviceByID(prior.DeviceID)
+	if !ok {
+		return false
+	}
+	device.Lock()
+	defer device.Unlock()
+	device.HeartbeatCount += prior.HeartbeatCount
+	if !prior.RegisteredAt.IsZero() && prior.RegisteredAt.Before(device.RegisteredAt) {
+		device.RegisteredAt = prior.RegisteredAt
+	}
+	if device.LastHeartbeat.IsZero() {
+		device.LastHeartbeat = prior.LastHeartbeat
+	}
+	return true
+}
+
+// RegisterRegistrationHandler 注册设备注册回调（在 OnDeviceRegistered 中同步调用）
+func (g *DeviceGateway) RegisterRegistrationHandler(handler func(deviceID string)) {
+	if handler == nil {
+		return
+	}
+	g.registrationMu.Lock()
+	g.registrationHandlers = append(g.registrationHandlers, handler)
+	g.registrationMu.Unlock()
+}
+
+func (g *DeviceGateway) emitRegistration(deviceID string) {
+	g.registrationMu.RLock()
+	handlers := g.registrationHandlers
+	g.registrationMu.RUnlock()
+	for _, handler := range handlers {
+		handler(deviceID)
+	}
+}
@@ -0,0 +1,510 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTuningMinInterval      = 60 * time.Second
+	defaultTuningMaxInterval      = 600 * time.Second
+	defaultTuningChangeThreshold  = 60 * time.Second
+	defaultTuningCooldown         = time.Hour
+	defaultTuningEvaluateInterval = 5 * time.Minute
+	defaultTuningChurnWindow      = time.Hour
+	defaultTuningUnstableDisconns = 3
+	defaultTuningStableRTT        = 1500 * time.Millisecond
+	defaultTuningUnstableRTT      = 5 * time.Second
+
+	// 0x83 运行参数1.1：拔出功率(2)+拔出识别时间(2)+浮充百分比(1)+浮充识别时间(2)+浮充时间(2)+心跳间隔(2)
+	runParams11Length          = 11
+	runParams11HeartbeatOffset = 9
+)
+
+// 连接稳定性分级
+const (
+	HeartbeatStabilityStable   = "stable"   // 长时间无断连且往返时延低：放宽到上限
+	HeartbeatStabilityNormal   = "normal"   // 默认间隔
+	HeartbeatStabilityUnstable = "unstable" // 频繁断连或往返时延高：收紧到下限，加快故障发现
+)
+
+// 评估结果
+const (
+	HeartbeatTuningDisabled        = "disabled"         // 全局开关关闭
+	HeartbeatTuningWithinThreshold = "within_threshold" // 推荐值与已确认值相差不超过阈值
+	HeartbeatTuningCooldown        = "cooldown"         // 冷却期内不重复下发
+	HeartbeatTuningAwaitConfig     = "await_config"     // 当前间隔未知，已请求0x90查询
+	HeartbeatTuningAwaitAck        = "await_ack"        // 已下发，等待设备应答
+	HeartbeatTuningDryRun          = "dry_run"          // 演练模式：仅报告拟下发的变更
+	HeartbeatTuningPushed          = "pushed"           // 已下发0x83
+	HeartbeatTuningSendFailed      = "send_failed"      // 下发失败
+)
+
+// HeartbeatParamSender 向设备下发参数命令（0x83设置 / 0x90查询）
+type HeartbeatParamSender func(deviceID string, command byte, data []byte) error
+
+// HeartbeatConnectionMetrics 评估所需的连接指标（由网关从TCP管理器与命令管理器采集）
+type HeartbeatConnectionMetrics struct {
+	ConnectedAt time.Time
+	RTT         network.CommandRTTStats
+	HasRTT      bool
+	LowData     bool // 低流量模式：推荐允许的最大间隔
+}
+
+// HeartbeatTuningState 设备心跳间隔调整状态（间隔单位：秒，0表示未知）
+type HeartbeatTuningState struct {
+	DeviceID            string    `json:"device_id"`
+	Stability           string    `json:"stability"`
+	Disconnects         int       `json:"disconnects"`     // 统计窗口内断连次数
+	SmoothedRTTMillis   int64     `json:"smoothed_rtt_ms"` // 平滑往返时延，无样本时为0
+	RTTSamples          int64     `json:"rtt_samples"`     // 往返时延样本数
+	RecommendedInterval int       `json:"recommended_interval"`
+	ConfirmedInterval   int       `json:"confirmed_interval"` // 设备查询应答或0x83成功应答确认的间隔
+	PendingInterval     int       `json:"pending_interval"`   // 已下发、待设备应答的间隔
+	ConfirmedAt         time.Time `json:"confirmed_at,omitempty"`
+	LastPushAt          time.Time `json:"last_push_at,omitempty"`
+	LastAction          string    `json:"last_action"`
+	LastReason          string    `json:"last_reason,omitempty"`
+	LowData             bool      `json:"low_data,omitempty"` // 低流量模式：固定推荐最大间隔
+	EvaluatedAt         time.Time `json:"evaluated_at"`
+	Pushes              int64     `json:"pushes"`
+	Rejections          int64     `json:"rejections"` // 设备应答参数错误或应答超时
+}
+
+// HeartbeatTuningStatus 自适应心跳整体状态
+type HeartbeatTuningStatus struct {
+	Enabled            bool                   `json:"enabled"`
+	DryRun             bool                   `json:"dry_run"`
+	MinInterval        int                    `json:"min_interval"`
+	MaxInterval        int                    `json:"max_interval"`
+	ChangeThreshold    int                    `json:"change_threshold"`
+	CooldownSeconds    int                    `json:"cooldown_seconds"`
+	Pushes             int64                  `json:"pushes"`
+	WouldChange        int                    `json:"would_change"` // 演练模式下最近一次评估拟下发的设备数
+	Devices            []HeartbeatTuningState `json:"devices"`
+	LastEvaluationTime time.Time              `json:"last_evaluation_time,omitempty"`
+}
+
+// heartbeatTuningDevice 单设备跟踪数据
+type heartbeatTuningDevice struct {
+	state       HeartbeatTuningState
+	disconnects []time.Time
+	runParams   []byte // 最近一次0x90应答的运行参数1.1（下发0x83时其余参数沿用）
+	queriedAt   time.Time
+}
+
+// HeartbeatTuner 自适应心跳间隔控制器
+type HeartbeatTuner struct {
+	mutex   sync.Mutex
+	send    HeartbeatParamSender
+	enabled bool
+	dryRun  bool
+
+	minInterval      time.Duration
+	maxInterval      time.Duration
+	threshold        time.Duration
+	cooldown         time.Duration
+	evaluateInterval time.Duration
+	churnWindow      time.Duration
+	unstableDisconns int
+	stableRTT        time.Duration
+	unstableRTT      time.Duration
+
+	devices   map[string]*heartbeatTuningDevice
+	pushes    int64
+	lastEval  time.Time
+	wouldList map[string]bool
+}
+
+// NewHeartbeatTuner 创建自适应心跳间隔控制器
+func NewHeartbeatTuner(cfg config.HeartbeatTuningConfig, send HeartbeatParamSender) *HeartbeatTuner {
+	t := &HeartbeatTuner{
+		send:             send,
+		enabled:          cfg.Enabled,
+		dryRun:           cfg.DryRun,
+		minInterval:      time.Duration(cfg.MinIntervalSeconds) * time.Second,
+		maxInterval:      time.Duration(cfg.MaxIntervalSeconds) * time.Second,
+		threshold:        time.Duration(cfg.ChangeThresholdSeconds) * time.Second,
+		cooldown:         time.Duration(cfg.CooldownSeconds) * time.Second,
+		evaluateInterval: time.Duration(cfg.EvaluateIntervalSeconds) * time.Second,
+		churnWindow:      time.Duration(cfg.ChurnWindowSeconds) * time.Second,
+		unstableDisconns: cfg.UnstableDisconnects,
+		stableRTT:        time.Duration(cfg.StableRTTMillis) * time.Millisecond,
+		unstableRTT:      time.Duration(cfg.UnstableRTTMillis) * time.Millisecond,
+		devices:          make(map[string]*heartbeatTuningDevice),
+		wouldList:        make(map[string]bool),
+	}
+	if t.minInterval <= 0 {
+		t.minInterval = defaultTuningMinInterval
+	}
+	if t.maxInterval <= 0 {
+		t.maxInterval = defaultTuningMaxInterval
+	}
+	if t.maxInterval < t.minInterval {
+		t.maxInterval = t.minInterval
+	}
+	if t.threshold <= 0 {
+		t.threshold = defaultTuningChangeThreshold
+	}
+	if t.cooldown <= 0 {
+		t.cooldown = defaultTuningCooldown
+	}
+	if t.evaluateInterval <= 0 {
+		t.evaluateInterval = defaultTuningEvaluateInterval
+	}
+	if t.churnWindow <= 0 {
+		t.churnWindow = defaultTuningChurnWindow
+	}
+	if t.unstableDisconns <= 0 {
+		t.unstableDisconns = defaultTuningUnstableDisconns
+	}
+	if t.stableRTT <= 0 {
+		t.stableRTT = defaultTuningStableRTT
+	}
+	if t.unstableRTT <= 0 {
+		t.unstableRTT = defaultTuningUnstableRTT
+	}
+	return t
+}
+
+// SetEnabled 全局开关（关闭后不再评估与下发，已下发的间隔保持不变）
+func (t *HeartbeatTuner) SetEnabled(enabled bool) {
+	t.mutex.Lock()
+	t.enabled = enabled
+	t.mutex.Unlock()
+	logger.WithFields(logrus.Fields{"enabled": enabled}).Warn("💓 自适应心跳开关已变更")
+}
+
+// SetDryRun 切换演练模式
+func (t *HeartbeatTuner) SetDryRun(dryRun bool) {
+	t.mutex.Lock()
+	t.dryRun = dryRun
+	if !dryRun {
+		t.wouldList = make(map[string]bool)
+	}
+	t.mutex.Unlock()
+	logger.WithFields(logrus.Fields{"dryRun": dryRun}).Warn("💓 自适应心跳演练模式已变更")
+}
+
+// NoteDisconnect 记录设备断连（用于统计连接稳定性）
+func (t *HeartbeatTuner) NoteDisconnect(deviceID string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	d := t.deviceLocked(deviceID)
+	d.disconnects = append(d.disconnects, now)
+	t.pruneLocked(d, now)
+	// 断线后未应答的下发视为失败，重新注册后重新评估
+	d.state.PendingInterval = 0
+}
+
+// ObserveRunParams 接收0x90运行参数1.1查询应答，记录设备当前确认的心跳间隔
+func (t *HeartbeatTuner) ObserveRunParams(deviceID string, payload []byte, now time.Time) {
+	if len(payload) < runParams11Length {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	d := t.deviceLocked(deviceID)
+	d.runParams = append([]byte(nil), payload[:runParams11Length]...)
+	d.state.ConfirmedInterval = int(binary.LittleEndian.Uint16(payload[runParams11HeartbeatOffset:]))
+	d.state.ConfirmedAt = now
+}
+
+// OnRunParamsAck 接收0x83设置应答（0=成功，1=参数错误）；无待应答的下发时返回false
+func (t *HeartbeatTuner) OnRunParamsAck(deviceID string, status byte, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	d, ok := t.devices[deviceID]
+	if !ok || d.state.PendingInterval == 0 {
+		return false
+	}
+	interval := d.state.PendingInterval
+	d.state.PendingInterval = 0
+	if status != 0 {
+		d.state.Rejections++
+		d.state.LastReason = fmt.Sprintf("设备应答参数错误(%d)", status)
+		logger.WithFields(logrus.Fields{
+			"deviceID": deviceID,
+			"interval": interval,
+			"status":   status,
+		}).Warn("⚠️ 设备拒绝心跳间隔设置")
+		return true
+	}
+	d.state.ConfirmedInterval = interval
+	d.state.ConfirmedAt = now
+	if len(d.runParams) == runParams11Length {
+		binary.LittleEndian.PutUint16(d.runParams[runParams11HeartbeatOffset:], uint16(interval))
+	}
+	logger.WithFields(logrus.Fields{
+		"deviceID": deviceID,
+		"interval": interval,
+	}).Info("💓 设备已确认新的心跳间隔")
+	return true
+}
+
+// Evaluate 评估单个设备：分级、计算推荐间隔，必要时下发0x83；返回评估结果
+func (t *HeartbeatTuner) Evaluate(deviceID string, metrics HeartbeatConnectionMetrics, now time.Time) string {
+	t.mutex.Lock()
+	if !t.enabled {
+		t.mutex.Unlock()
+		return HeartbeatTuningDisabled
+	}
+	d := t.deviceLocked(deviceID)
+	t.pruneLocked(d, now)
+	st := &d.state
+	st.EvaluatedAt = now
+	st.Disconnects = len(d.disconnects)
+	st.SmoothedRTTMillis, st.RTTSamples = 0, 0
+	if metrics.HasRTT {
+		st.SmoothedRTTMillis = metrics.RTT.Smoothed.Milliseconds()
+		st.RTTSamples = metrics.RTT.Samples
+	}
+	st.Stability = t.classifyLocked(st.Disconnects, metrics, now)
+	st.RecommendedInterval = int(t.recommendLocked(st.Stability) / time.Second)
+	st.LowData = metrics.LowData
+	if metrics.LowData {
+		st.RecommendedInterval = int(t.maxInterval / time.Second)
+	}
+
+	action, reason := t.decideLocked(d, now)
+	var payload []byte
+	if action == HeartbeatTuningPushed {
+		payload = append([]byte(nil), d.runParams...)
+		binary.LittleEndian.PutUint16(payload[runParams11HeartbeatOffset:], uint16(st.RecommendedInterval))
+		st.PendingInterval = st.RecommendedInterval
+		st.LastPushAt = now
+	}
+	queryNeeded := action == HeartbeatTuningAwaitConfig && reason == ""
+	if queryNeeded {
+		d.queriedAt = now
+	}
+	if t.dryRun {
+		if action == HeartbeatTuningDryRun {
+			t.wouldList[deviceID] = true
+		} else {
+			delete(t.wouldList, deviceID)
+		}
+	}
+	recommended, confirmed, stability := st.RecommendedInterval, st.ConfirmedInterval, st.Stability
+	st.LastAction, st.LastReason = action, reason
+	t.mutex.Unlock()
+
+	switch {
+	case payload != nil:
+		if err := t.send(deviceID, constants.CmdParamSetting, payload); err != nil {
+			t.mutex.Lock()
+			d.state.PendingInterval = 0
+			d.state.LastAction, d.state.LastReason = HeartbeatTuningSendFailed, err.Error()
+			t.mutex.Unlock()
+			logger.WithFields(logrus.Fields{"deviceID": deviceID, "error": err.Error()}).Warn("⚠️ 下发心跳间隔失败")
+			return HeartbeatTuningSendFailed
+		}
+		t.mutex.Lock()
+		d.state.Pushes++
+		t.pushes++
+		t.mutex.Unlock()
+		logger.WithFields(logrus.Fields{
+			"deviceID":    deviceID,
+			"stability":   stability,
+			"confirmed":   confirmed,
+			"recommended": recommended,
+		}).Info("💓 下发自适应心跳间隔")
+	case queryNeeded:
+		if err := t.send(deviceID, constants.CmdQueryParam1, nil); err != nil {
+			logger.WithFields(logrus.Fields{"deviceID": deviceID, "error": err.Error()}).Debug("查询设备运行参数失败")
+		}
+	case action == HeartbeatTuningDryRun:
+		logger.WithFields(logrus.Fields{
+			"deviceID":    deviceID,
+			"stability":   stability,
+			"confirmed":   confirmed,
+			"recommended": recommended,
+		}).Info("💓 [演练] 拟调整设备心跳间隔")
+	}
+	return action
+}
+
+// decideLocked 根据推荐值、已确认值与冷却期决定处置（调用方持有锁）；
+// 返回 await_config 且原因为空时需下发0x90查询
+func (t *HeartbeatTuner) decideLocked(d *heartbeatTuningDevice, now time.Time) (string, string) {
+	st := &d.state
+	if st.PendingInterval != 0 {
+		if now.Sub(st.LastPushAt) < t.evaluateInterval {
+			return HeartbeatTuningAwaitAck, ""
+		}
+		st.PendingInterval = 0
+		st.Rejections++
+	}
+	if st.ConfirmedInterval == 0 || len(d.runParams) != runParams11Length {
+		if t.dryRun {
+			return HeartbeatTuningAwaitConfig, "演练模式不查询设备运行参数"
+		}
+		if !d.queriedAt.IsZero() && now.Sub(d.queriedAt) < t.evaluateInterval {
+			return HeartbeatTuningAwaitConfig, "等待0x90查询应答"
+		}
+		return HeartbeatTuningAwaitConfig, ""
+	}
+	diff := st.RecommendedInterval - st.ConfirmedInterval
+	if diff < 0 {
+		diff = -diff
+	}
+	if time.Duration(diff)*time.Second <= t.threshold {
+		return HeartbeatTuningWithinThreshold, ""
+	}
+	if !st.LastPushAt.IsZero() && now.Sub(st.LastPushAt) < t.cooldown {
+		return HeartbeatTuningCooldown, fmt.Sprintf("冷却期至 %s", st.LastPushAt.Add(t.cooldown).Format(constants.TimeFormatDefault))
+	}
+	if t.dryRun {
+		return HeartbeatTuningDryRun, fmt.Sprintf("拟调整 %ds → %ds", st.ConfirmedInterval, st.RecommendedInterval)
+	}
+	return HeartbeatTuningPushed, ""
+}
+
+// classifyLocked 连接稳定性分级：断连次数或往返时延任一超限即为不稳定；
+// 连接持续整个统计窗口、无断连且往返时延低才判为稳定
+func (t *HeartbeatTuner) classifyLocked(disconnects int, m HeartbeatConnectionMetrics, now time.Time) string {
+	if disconnects >= t.unstableDisconns || (m.HasRTT && m.RTT.Smoothed >= t.unstableRTT) {
+		return HeartbeatStabilityUnstable
+	}
+	if disconnects == 0 && !m.ConnectedAt.IsZero() && now.Sub(m.ConnectedAt) >= t.churnWindow &&
+		(!m.HasRTT || m.RTT.Smoothed <= t.stableRTT) {
+		return HeartbeatStabilityStable
+	}
+	return HeartbeatStabilityNormal
+}
+
+// recommendLocked 稳定性对应的推荐间隔（限定在上下限内）
+func (t *HeartbeatTuner) recommendLocked(stability string) time.Duration {
+	switch stability {
+	case HeartbeatStabilityStable:
+		return t.maxInterval
+	case HeartbeatStabilityUnstable:
+		return t.minInterval
+	}
+	interval := time.Duration(constants.HeartbeatIntervalDefault) * time.Second
+	if interval < t.minInterval {
+		interval = t.minInterval
+	}
+	if interval > t.maxInterval {
+		interval = t.maxInterval
+	}
+	return interval
+}
+
+func (t *HeartbeatTuner) deviceLocked(deviceID string) *heartbeatTuningDevice {
+	d, ok := t.devices[deviceID]
+	if !ok {
+		d = &heartbeatTuningDevice{state: HeartbeatTuningState{DeviceID: deviceID}}
+		t.devices[deviceID] = d
+	}
+	return d
+}
+
+func (t *HeartbeatTuner) pruneLocked(d *heartbeatTuningDevice, now time.Time) {
+	cutoff := now.Add(-t.churnWindow)
+	kept := d.disconnects[:0]
+	for _, at := range d.disconnects {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	d.disconnects = kept
+}
+
+// Get 设备的心跳间隔调整状态
+func (t *HeartbeatTuner) Get(deviceID string) (HeartbeatTuningState, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	d, ok := t.devices[deviceID]
+	if !ok {
+		return HeartbeatTuningState{}, false
+	}
+	return d.state, true
+}
+
+// Status 整体状态（设备按ID排序）
+func (t *HeartbeatTuner) Status() HeartbeatTuningStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	status := HeartbeatTuningStatus{
+		Enabled:            t.enabled,
+		DryRun:             t.dryRun,
+		MinInterval:        int(t.minInterval / time.Second),
+		MaxInterval:        int(t.maxInterval / time.Second),
+		ChangeThreshold:    int(t.threshold / time.Second),
+		CooldownSeconds:    int(t.cooldown / time.Second),
+		Pushes:             t.pushes,
+		WouldChange:        len(t.wouldList),
+		Devices:            make([]HeartbeatTuningState, 0, len(t.devices)),
+		LastEvaluationTime: t.lastEval,
+	}
+	for _, d := range t.devices {
+		status.Devices = append(status.Devices, d.state)
+	}
+	sort.Slice(status.Devices, func(i, j int) bool { return status.Devices[i].DeviceID < status.Devices[j].DeviceID })
+	return status
+}
+
+// evaluateHeartbeatTuning 评估全部在线设备（由评估协程周期调用）
+func (g *DeviceGateway) evaluateHeartbeatTuning(now time.Time) {
+	t := g.heartbeatTuner
+	t.mutex.Lock()
+	enabled := t.enabled
+	t.lastEval = now
+	t.mutex.Unlock()
+	if !enabled || g.tcpManager == nil {
+		return
+	}
+	cmdMgr := network.GetCommandManager()
+	for _, deviceID := range g.GetAllOnlineDevices() {
+		var metrics HeartbeatConnectionMetrics
+		if session, ok := g.tcpManager.GetSessionByDeviceID(deviceID); ok {
+			metrics.ConnectedAt = session.ConnectedAt
+		}
+		if cmdMgr != nil {
+			if physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID); err == nil {
+				metrics.RTT, metrics.HasRTT = cmdMgr.GetRTTStats(physicalID)
+			}
+		}
+		metrics.LowData = lowDataPushMaxHeartbeat(deviceID)
+		t.Evaluate(deviceID, metrics, now)
+	}
+}
+
+// startHeartbeatTuningWorker 周期评估自适应心跳间隔
+func (g *DeviceGateway) startHeartbeatTuningWorker() {
+	go func() {
+		ticker := time.NewTicker(g.heartbeatTuner.evaluateInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			g.evaluateHeartbeatTuning(now)
+		}
+	}()
+}
+
+// GetHeartbeatTuner 获取自适应心跳间隔控制器
+func (g *DeviceGateway) GetHeartbeatTuner() *HeartbeatTuner {
+	return g.heartbeatTuner
+}
+
+// OnRunParamsAck 设备0x83设置应答入口（由参数设置处理器调用）
+func (g *DeviceGateway) OnRunParamsAck(deviceID string, status byte) bool {
+	return g.heartbeatTuner.OnRunParamsAck(deviceID, status, time.Now())
+}
+
+// sendHeartbeatParam 经统一发送路径下发心跳间隔设置或运行参数查询
+func (g *DeviceGateway) sendHeartbeatParam(deviceID string, command byte, data []byte) error {
+	_, err := g.SendCommandToDeviceWithOptions(context.Background(), deviceID, command, data, network.CommandOptions{})
+	return err
+}
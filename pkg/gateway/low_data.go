@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
+)
+
+// lowDataLocator 设备所在连接的ICCID与资产映射的租户（供低流量模式按ICCID/租户分配）
+func (g *DeviceGateway) lowDataLocator(deviceID string) (string, string) {
+	var iccid, tenantID string
+	if g.tcpManager != nil {
+		if device, ok := g.tcpManager.GetDeviceByID(deviceID); ok {
+			iccid = device.ICCID
+		}
+	}
+	if info, ok := asset.Lookup(deviceID); ok {
+		tenantID = info.TenantID
+	}
+	return iccid, tenantID
+}
+
+// LowDataMode 设备的低流量模式；未启用低流量模式或设备未分配时返回false
+func (g *DeviceGateway) LowDataMode(deviceID string) (lowdata.Mode, bool) {
+	reg := lowdata.GetGlobalRegistry()
+	if reg == nil {
+		return lowdata.Mode{}, false
+	}
+	mode := reg.ModeForDevice(deviceID)
+	return mode, mode.Enabled || mode.Excluded
+}
+
+// SendProactivePoll 下发网关主动查询；低流量模式下非必要的查询不下发，返回 lowdata.ErrPollSuppressed
+func (g *DeviceGateway) SendProactivePoll(deviceID string, kind lowdata.PollKind, command byte, data []byte) error {
+	if reg := lowdata.GetGlobalRegistry(); reg != nil && g.tcpManager != nil {
+		var connID uint64
+		if session, ok := g.tcpManager.GetSessionByDeviceID(deviceID); ok {
+			connID = session.ConnID
+		}
+		if !reg.AllowPoll(connID, deviceID, kind, len(data), time.Now()) {
+			return lowdata.ErrPollSuppressed
+		}
+	}
+	return g.SendCommandToDevice(deviceID, command, data)
+}
+
+// lowDataPushMaxHeartbeat 设备处于低流量模式且要求推送最大心跳间隔
+func lowDataPushMaxHeartbeat(deviceID string) bool {
+	reg := lowdata.GetGlobalRegistry()
+	if reg == nil {
+		return false
+	}
+	mode := reg.ModeForDevice(deviceID)
+	return mode.Enabled && mode.Effective.PushMaxHeartbeat
+}
@@ -0,0 +1,817 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// 宏执行状态
+const (
+	MacroStatusRunning   = "running"
+	MacroStatusSucceeded = "succeeded"
+	MacroStatusFailed    = "failed"  // 某一步失败，已中止并回滚
+	MacroStatusTimeout   = "timeout" // 超过整体超时，已中止并回滚
+)
+
+// 宏步骤状态
+const (
+	MacroStepPending   = "pending"
+	MacroStepRunning   = "running"
+	MacroStepSucceeded = "succeeded"
+	MacroStepSkipped   = "skipped" // 无需执行（如端口无进行中订单）
+	MacroStepFailed    = "failed"
+	MacroStepAborted   = "aborted" // 前序步骤失败或宏超时，未执行
+)
+
+// 回滚结果
+const (
+	MacroRollbackSucceeded = "succeeded"
+	MacroRollbackFailed    = "failed"
+)
+
+// 内置步骤动作
+const (
+	MacroActionStopCharge         = "stop_charge"          // 端口有进行中订单时下发0x82停止充电
+	MacroActionAwaitStopConfirm   = "await_stop_confirm"   // 等待设备应答停止充电
+	MacroActionReadPowerParams    = "read_power_params"    // 读取运行参数2（0x92：最大充电时长/过载功率/过欠压）
+	MacroActionSetOverloadPower   = "set_overload_power"   // 0x85 将过载功率设为 value(W)，回滚时恢复读取值
+	MacroActionRestorePowerParams = "restore_power_params" // 0x85 恢复读取到的运行参数2
+	MacroActionQueryStatus        = "query_status"         // 0x81 查询设备状态，等待设备随后上报心跳
+)
+
+// MacroSafePortReset 内置宏：安全复位端口
+const MacroSafePortReset = "safe_port_reset"
+
+const (
+	defaultMacroTimeout     = 2 * time.Minute
+	defaultMacroStepTimeout = 15 * time.Second
+	defaultMacroHistorySize = 200
+
+	macroPortPowerCutW      = 1                      // 复位时切断端口供电使用的过载功率(W)，任何负载都会触发过载断电
+	macroStatusPollInterval = 100 * time.Millisecond // 状态查询后检查设备心跳的间隔
+)
+
+var (
+	// ErrMacroNotFound 宏不存在
+	ErrMacroNotFound = errors.New("宏不存在")
+	// ErrMacroBusy 设备已有进行中的宏
+	ErrMacroBusy = errors.New("设备已有进行中的宏")
+	// ErrMacroExecutionNotFound 宏执行记录不存在
+	ErrMacroExecutionNotFound = errors.New("宏执行记录不存在")
+	// ErrMacroStepSkipped 步骤动作返回该错误表示无需执行（回滚动作返回表示无需回滚）
+	ErrMacroStepSkipped = errors.New("无需执行")
+)
+
+// MacroStepDefinition 宏步骤定义
+type MacroStepDefinition struct {
+	Name    string        `json:"name"`
+	Action  string        `json:"action"`
+	Value   int           `json:"value,omitempty"`
+	Timeout time.Duration `json:"-"` // 单步超时，为0时使用全局单步超时
+}
+
+// MacroDefinition 宏定义：按序执行的步骤，任一步失败即中止
+type MacroDefinition struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Timeout     time.Duration         `json:"-"` // 整体超时，为0时使用全局宏超时
+	Steps       []MacroStepDefinition `json:"steps"`
+	NeedsPort   bool                  `json:"needsPort"` // 含端口级步骤，调用时须指定端口
+	Builtin     bool                  `json:"builtin"`
+}
+
+// MacroStepResult 步骤执行状态
+type MacroStepResult struct {
+	Name          string    `json:"name"`
+	Action        string    `json:"action"`
+	Status        string    `json:"status"`
+	Detail        string    `json:"detail,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	StartedAt     time.Time `json:"startedAt,omitempty"`
+	FinishedAt    time.Time `json:"finishedAt,omitempty"`
+	Rollback      string    `json:"rollback,omitempty"` // 回滚结果，未回滚为空
+	RollbackError string    `json:"rollbackError,omitempty"`
+}
+
+// MacroExecution 宏执行记录
+type MacroExecution struct {
+	ID            string            `json:"id"`
+	Macro         string            `json:"macro"`
+	DeviceID      string            `json:"deviceId"`
+	Port          int               `json:"port,omitempty"`
+	Originator    string            `json:"originator,omitempty"`
+	CorrelationID string            `json:"correlationId,omitempty"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	FailedStep    string            `json:"failedStep,omitempty"`
+	RolledBack    bool              `json:"rolledBack"`
+	Steps         []MacroStepResult `json:"steps"`
+	StartedAt     time.Time         `json:"startedAt"`
+	Deadline      time.Time         `json:"deadline"`
+	CompletedAt   time.Time         `json:"completedAt,omitempty"`
+}
+
+// MacroRequest 宏调用参数
+type MacroRequest struct {
+	DeviceID      string
+	Port          int // 1-based，端口级宏必填
+	Originator    string
+	CorrelationID string
+}
+
+// MacroPowerParams 运行参数2（0x85 设置 / 0x92 查询）
+type MacroPowerParams struct {
+	MaxChargeTime int  `json:"maxChargeTime"` // 秒
+	OverloadPower int  `json:"overloadPower"` // W
+	OverVoltage   int  `json:"overVoltage"`   // 0.1V
+	UnderVoltage  int  `json:"underVoltage"`  // 0.1V
+	HasVoltage    bool `json:"hasVoltage"`    // 旧固件无过欠压字段，下发时同样省略
+}
+
+// MacroCommander 宏步骤使用的设备操作（网关实现，测试可替换）
+type MacroCommander interface {
+	// ActiveOrders 设备上进行中的订单：端口(1-based) → 订单号
+	ActiveOrders(deviceID string) map[int]string
+	// StopCharging 下发0x82停止充电，返回可等待设备应答的命令句柄
+	StopCharging(correlationID, deviceID string, port int, orderNo string) (*network.CommandHandle, error)
+	// ReadPowerParams 读取运行参数2
+	ReadPowerParams(correlationID, deviceID string, timeout time.Duration) (MacroPowerParams, error)
+	// SetPowerParams 下发0x85设置运行参数2，返回可等待设备应答的命令句柄
+	SetPowerParams(correlationID, deviceID string, params MacroPowerParams) (*network.CommandHandle, error)
+	// QueryStatus 下发0x81查询设备状态，在超时内等待设备随后上报心跳或注册包
+	QueryStatus(correlationID, deviceID string, timeout time.Duration) error
+}
+
+// MacroAction 步骤动作：Run 返回步骤说明，返回 ErrMacroStepSkipped 表示无需执行；
+// Rollback 在宏中止时对已成功（或失败，可能已部分生效）的步骤逆序执行，可为nil。
+// 动作内的等待须以 run.StepTimeout(step) 为上限，以保证宏整体超时生效
+type MacroAction struct {
+	NeedsPort bool
+	Run       func(run *MacroRun, step MacroStepDefinition) (string, error)
+	Rollback  func(run *MacroRun, step MacroStepDefinition) error
+}
+
+// MacroRun 单次宏执行的运行上下文（步骤间共享状态）
+type MacroRun struct {
+	Request   MacroRequest
+	Commander MacroCommander
+
+	deadline    time.Time
+	stepTimeout time.Duration
+	rollingBack bool
+
+	stopHandle    *network.CommandHandle // 已下发的停止充电命令
+	powerParams   *MacroPowerParams      // 执行前读取的运行参数2
+	powerModified bool                   // 运行参数2已改动且尚未恢复
+}
+
+// StepTimeout 单步可用的等待时长：步骤超时与宏剩余时间取小（回滚阶段不受宏整体超时约束）
+func (r *MacroRun) StepTimeout(step MacroStepDefinition) time.Duration {
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = r.stepTimeout
+	}
+	if r.rollingBack {
+		return timeout
+	}
+	if remaining := time.Until(r.deadline); remaining < timeout {
+		timeout = remaining
+	}
+	if timeout <= 0 {
+		timeout = time.Millisecond
+	}
+	return timeout
+}
+
+// MacroEngine 设备宏引擎：宏为按序执行的多步运维命令，步骤以设备应答作为成功判据，
+// 任一步失败或超过整体超时即中止，逆序执行已定义的回滚动作；同一设备同时只执行一个宏
+type MacroEngine struct {
+	commander      MacroCommander
+	defaultTimeout time.Duration
+	stepTimeout    time.Duration
+	historySize    int
+
+	mu         sync.Mutex
+	actions    map[string]MacroAction
+	macros     map[string]MacroDefinition
+	executions map[string]*MacroExecution
+	done       map[string]chan struct{} // 执行ID → 结束通知
+	finished   []string                 // 已结束的执行ID（旧→新），超过 historySize 时淘汰最早的
+	running    map[string]string        // 设备ID → 进行中的执行ID
+}
+
+// NewMacroEngine 创建宏引擎，注册内置步骤动作、内置宏与配置中的自定义宏
+func NewMacroEngine(cfg config.MacrosConfig, commander MacroCommander) *MacroEngine {
+	e := &MacroEngine{
+		commander:      commander,
+		defaultTimeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
+		stepTimeout:    time.Duration(cfg.StepTimeoutSeconds) * time.Second,
+		historySize:    cfg.HistorySize,
+		actions:        make(map[string]MacroAction),
+		macros:         make(map[string]MacroDefinition),
+		executions:     make(map[string]*MacroExecution),
+		done:           make(map[string]chan struct{}),
+		running:        make(map[string]string),
+	}
+	if e.defaultTimeout <= 0 {
+		e.defaultTimeout = defaultMacroTimeout
+	}
+	if e.stepTimeout <= 0 {
+		e.stepTimeout = defaultMacroStepTimeout
+	}
+	if e.historySize <= 0 {
+		e.historySize = defaultMacroHistorySize
+	}
+
+	e.registerBuiltinActions()
+	if err := e.Register(safePortResetMacro()); err != nil {
+		logger.WithFields(logrus.Fields{"macro": MacroSafePortReset, "error": err.Error()}).Error("注册内置宏失败")
+	}
+	for _, def := range cfg.Definitions {
+		steps := make([]MacroStepDefinition, 0, len(def.Steps))
+		for _, s := range def.Steps {
+			steps = append(steps, MacroStepDefinition{Name: s.Name, Action: s.Action, Value: s.Value, Timeout: time.Duration(s.TimeoutSeconds) * time.Second})
+		}
+		if err := e.Register(MacroDefinition{Name: def.Name, Description: def.Description, Timeout: time.Duration(def.TimeoutSeconds) * time.Second, Steps: steps}); err != nil {
+			logger.WithFields(logrus.Fields{"macro": def.Name, "error": err.Error()}).Error("注册自定义宏失败")
+		}
+	}
+	return e
+}
+
+// RegisterAction 注册步骤动作（同名覆盖）
+func (e *MacroEngine) RegisterAction(name string, action MacroAction) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.actions[name] = action
+}
+
+// Register 注册宏（同名覆盖）；步骤名为空时使用动作名，步骤名须唯一
+func (e *MacroEngine) Register(def MacroDefinition) error {
+	if def.Name == "" {
+		return fmt.Errorf("宏名称不能为空")
+	}
+	if len(def.Steps) == 0 {
+		return fmt.Errorf("宏 %s 没有步骤", def.Name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	steps := make([]MacroStepDefinition, len(def.Steps))
+	seen := make(map[string]bool, len(def.Steps))
+	def.NeedsPort = false
+	for i, step := range def.Steps {
+		action, ok := e.actions[step.Action]
+		if !ok {
+			return fmt.Errorf("宏 %s 步骤 %d 动作未知: %s", def.Name, i+1, step.Action)
+		}
+		if step.Action == MacroActionSetOverloadPower && step.Value <= 0 {
+			return fmt.Errorf("宏 %s 步骤 %d 须指定过载功率 value(W)", def.Name, i+1)
+		}
+		if step.Name == "" {
+			step.Name = step.Action
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("宏 %s 步骤名重复: %s", def.Name, step.Name)
+		}
+		seen[step.Name] = true
+		def.NeedsPort = def.NeedsPort || action.NeedsPort
+		steps[i] = step
+	}
+	def.Steps = steps
+	e.macros[def.Name] = def
+	return nil
+}
+
+// Definitions 已注册的宏（按名称排序）
+func (e *MacroEngine) Definitions() []MacroDefinition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defs := make([]MacroDefinition, 0, len(e.macros))
+	for _, def := range e.macros {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Start 异步执行宏，返回执行记录（含执行ID）
+func (e *MacroEngine) Start(name string, req MacroRequest) (MacroExecution, error) {
+	if req.DeviceID == "" {
+		return MacroExecution{}, fmt.Errorf("设备ID不能为空")
+	}
+	e.mu.Lock()
+	def, ok := e.macros[name]
+	if !ok {
+		e.mu.Unlock()
+		return MacroExecution{}, ErrMacroNotFound
+	}
+	if def.NeedsPort && req.Port <= 0 {
+		e.mu.Unlock()
+		return MacroExecution{}, fmt.Errorf("宏 %s 须指定端口号(1-based)", name)
+	}
+	if id, busy := e.running[req.DeviceID]; busy {
+		e.mu.Unlock()
+		return MacroExecution{}, fmt.Errorf("%w: %s", ErrMacroBusy, id)
+	}
+
+	timeout := def.Timeout
+	if timeout <= 0 {
+		timeout = e.defaultTimeout
+	}
+	now := time.Now()
+	exec := &MacroExecution{
+		ID:            "macro_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12],
+		Macro:         def.Name,
+		DeviceID:      req.DeviceID,
+		Port:          req.Port,
+		Originator:    req.Originator,
+		CorrelationID: req.CorrelationID,
+		Status:        MacroStatusRunning,
+		Steps:         make([]MacroStepResult, len(def.Steps)),
+		StartedAt:     now,
+		Deadline:      now.Add(timeout),
+	}
+	for i, step := range def.Steps {
+		exec.Steps[i] = MacroStepResult{Name: step.Name, Action: step.Action, Status: MacroStepPending}
+	}
+	e.executions[exec.ID] = exec
+	e.done[exec.ID] = make(chan struct{})
+	e.running[req.DeviceID] = exec.ID
+	snapshot := exec.snapshot()
+	e.mu.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": req.CorrelationID,
+		"deviceID":      req.DeviceID,
+		"port":          req.Port,
+		"macro":         def.Name,
+		"executionID":   exec.ID,
+		"originator":    req.Originator,
+	}).Info("设备宏开始执行")
+
+	run := &MacroRun{Request: req, Commander: e.commander, deadline: exec.Deadline, stepTimeout: e.stepTimeout}
+	go e.execute(exec, def, run)
+	return snapshot, nil
+}
+
+// Get 查询执行记录
+func (e *MacroEngine) Get(deviceID, id string) (MacroExecution, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	exec, ok := e.executions[id]
+	if !ok || exec.DeviceID != deviceID {
+		return MacroExecution{}, false
+	}
+	return exec.snapshot(), true
+}
+
+// Wait 等待执行结束（超时返回当前状态）
+func (e *MacroEngine) Wait(deviceID, id string, timeout time.Duration) (MacroExecution, bool) {
+	e.mu.Lock()
+	done, ok := e.done[id]
+	e.mu.Unlock()
+	if ok {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+	}
+	return e.Get(deviceID, id)
+}
+
+// execute 按序执行步骤，失败或超时后逆序回滚
+func (e *MacroEngine) execute(exec *MacroExecution, def MacroDefinition, run *MacroRun) {
+	failed := -1
+	status, reason := MacroStatusSucceeded, ""
+	for i, step := range def.Steps {
+		if !time.Now().Before(run.deadline) {
+			status, reason = MacroStatusTimeout, fmt.Sprintf("宏执行超时(%s)", exec.Deadline.Sub(exec.StartedAt))
+			break
+		}
+		e.mu.Lock()
+		action := e.actions[step.Action]
+		exec.Steps[i].Status = MacroStepRunning
+		exec.Steps[i].StartedAt = time.Now()
+		e.mu.Unlock()
+
+		detail, err := action.Run(run, step)
+
+		e.mu.Lock()
+		result := &exec.Steps[i]
+		result.FinishedAt = time.Now()
+		result.Detail = detail
+		switch {
+		case err == nil:
+			result.Status = MacroStepSucceeded
+		case errors.Is(err, ErrMacroStepSkipped):
+			result.Status = MacroStepSkipped
+		default:
+			result.Status = MacroStepFailed
+			result.Error = err.Error()
+			failed = i
+		}
+		e.mu.Unlock()
+		e.logStep(exec, step, result.Status, detail, err)
+
+		if failed >= 0 {
+			status, reason = MacroStatusFailed, fmt.Sprintf("步骤 %s 失败: %v", step.Name, err)
+			if !time.Now().Before(run.deadline) {
+				status = MacroStatusTimeout
+			}
+			break
+		}
+	}
+
+	if status != MacroStatusSucceeded {
+		e.rollback(exec, def, run)
+	}
+	e.finish(exec, status, reason, failed, def)
+}
+
+// rollback 逆序执行已成功步骤与失败步骤（可能已部分生效）的回滚动作
+func (e *MacroEngine) rollback(exec *MacroExecution, def MacroDefinition, run *MacroRun) {
+	run.rollingBack = true
+	for i := len(def.Steps) - 1; i >= 0; i-- {
+		step := def.Steps[i]
+		e.mu.Lock()
+		action := e.actions[step.Action]
+		stepStatus := exec.Steps[i].Status
+		e.mu.Unlock()
+		if action.Rollback == nil || (stepStatus != MacroStepSucceeded && stepStatus != MacroStepFailed) {
+			continue
+		}
+
+		err := action.Rollback(run, step)
+		if errors.Is(err, ErrMacroStepSkipped) {
+			continue
+		}
+		e.mu.Lock()
+		exec.RolledBack = true
+		exec.Steps[i].Rollback = MacroRollbackSucceeded
+		if err != nil {
+			exec.Steps[i].Rollback = MacroRollbackFailed
+			exec.Steps[i].RollbackError = err.Error()
+		}
+		rollbackStatus := exec.Steps[i].Rollback
+		e.mu.Unlock()
+
+		fields := logrus.Fields{
+			"correlationID": exec.CorrelationID,
+			"deviceID":      exec.DeviceID,
+			"macro":         exec.Macro,
+			"executionID":   exec.ID,
+			"step":          step.Name,
+			"rollback":      rollbackStatus,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+			logger.WithFields(fields).Error("设备宏步骤回滚失败")
+		} else {
+			logger.WithFields(fields).Info("设备宏步骤已回滚")
+		}
+	}
+}
+
+// finish 结束执行：未执行的步骤标记为 aborted，释放设备并淘汰超出保留数的执行记录
+func (e *MacroEngine) finish(exec *MacroExecution, status, reason string, failed int, def MacroDefinition) {
+	e.mu.Lock()
+	for i := range exec.Steps {
+		if exec.Steps[i].Status == MacroStepPending {
+			exec.Steps[i].Status = MacroStepAborted
+		}
+	}
+	exec.Status = status
+	exec.Error = reason
+	if failed >= 0 {
+		exec.FailedStep = def.Steps[failed].Name
+	}
+	exec.CompletedAt = time.Now()
+	if e.running[exec.DeviceID] == exec.ID {
+		delete(e.running, exec.DeviceID)
+	}
+	if done, ok := e.done[exec.ID]; ok {
+		close(done)
+		delete(e.done, exec.ID)
+	}
+	e.finished = append(e.finished, exec.ID)
+	for len(e.finished) > e.historySize {
+		delete(e.executions, e.finished[0])
+		e.finished = e.finished[1:]
+	}
+	rolledBack := exec.RolledBack
+	e.mu.Unlock()
+
+	fields := logrus.Fields{
+		"correlationID": exec.CorrelationID,
+		"deviceID":      exec.DeviceID,
+		"macro":         exec.Macro,
+		"executionID":   exec.ID,
+		"status":        status,
+		"rolledBack":    rolledBack,
+		"elapsed":       exec.CompletedAt.Sub(exec.StartedAt).String(),
+	}
+	if status == MacroStatusSucceeded {
+		logger.WithFields(fields).Info("设备宏执行完成")
+		return
+	}
+	fields["error"] = reason
+	logger.WithFields(fields).Warn("设备宏执行中止")
+}
+
+func (e *MacroEngine) logStep(exec *MacroExecution, step MacroStepDefinition, status, detail string, err error) {
+	fields := logrus.Fields{
+		"correlationID": exec.CorrelationID,
+		"deviceID":      exec.DeviceID,
+		"macro":         exec.Macro,
+		"executionID":   exec.ID,
+		"step":          step.Name,
+		"status":        status,
+		"detail":        detail,
+	}
+	if status == MacroStepFailed {
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Warn("设备宏步骤失败")
+		return
+	}
+	logger.WithFields(fields).Debug("设备宏步骤完成")
+}
+
+func (x *MacroExecution) snapshot() MacroExecution {
+	cp := *x
+	cp.Steps = append([]MacroStepResult(nil), x.Steps...)
+	return cp
+}
+
+// ===============================
+// 内置步骤动作与宏
+// ===============================
+
+// safePortResetMacro 安全复位端口：停止充电(如有) → 等待确认 → 读取运行参数2 → 切断过载功率 → 恢复 → 状态查询。
+// 过载功率为整机参数，切断前要求设备其他端口没有进行中的订单；中途中止时自动恢复读取到的运行参数2
+func safePortResetMacro() MacroDefinition {
+	return MacroDefinition{
+		Name:        MacroSafePortReset,
+		Description: "停止端口充电(如有)并等待确认，切断后恢复过载功率使端口重新上电，最后查询设备状态",
+		Builtin:     true,
+		Steps: []MacroStepDefinition{
+			{Name: "stop_charge", Action: MacroActionStopCharge},
+			{Name: "await_stop_confirm", Action: MacroActionAwaitStopConfirm},
+			{Name: "read_power_params", Action: MacroActionReadPowerParams},
+			{Name: "cut_port_power", Action: MacroActionSetOverloadPower, Value: macroPortPowerCutW},
+			{Name: "restore_port_power", Action: MacroActionRestorePowerParams},
+			{Name: "query_status", Action: MacroActionQueryStatus},
+		},
+	}
+}
+
+// registerBuiltinActions 注册内置步骤动作
+func (e *MacroEngine) registerBuiltinActions() {
+	e.actions[MacroActionStopCharge] = MacroAction{NeedsPort: true, Run: macroStopCharge}
+	e.actions[MacroActionAwaitStopConfirm] = MacroAction{NeedsPort: true, Run: macroAwaitStopConfirm}
+	e.actions[MacroActionReadPowerParams] = MacroAction{Run: macroReadPowerParams}
+	e.actions[MacroActionSetOverloadPower] = MacroAction{Run: macroSetOverloadPower, Rollback: macroRollbackPowerParams}
+	e.actions[MacroActionRestorePowerParams] = MacroAction{Run: macroRestorePowerParams}
+	e.actions[MacroActionQueryStatus] = MacroAction{Run: macroQueryStatus}
+}
+
+func macroStopCharge(run *MacroRun, _ MacroStepDefinition) (string, error) {
+	req := run.Request
+	orderNo, active := run.Commander.ActiveOrders(req.DeviceID)[req.Port]
+	if !active {
+		return fmt.Sprintf("端口 %d 无进行中订单", req.Port), ErrMacroStepSkipped
+	}
+	handle, err := run.Commander.StopCharging(req.CorrelationID, req.DeviceID, req.Port, orderNo)
+	if err != nil {
+		return "", err
+	}
+	run.stopHandle = handle
+	return fmt.Sprintf("已下发停止充电，订单 %s", orderNo), nil
+}
+
+func macroAwaitStopConfirm(run *MacroRun, step MacroStepDefinition) (string, error) {
+	if run.stopHandle == nil {
+		return "未下发停止充电", ErrMacroStepSkipped
+	}
+	if err := run.stopHandle.Wait(run.StepTimeout(step)); err != nil {
+		return "", fmt.Errorf("等待停止充电应答失败: %w", err)
+	}
+	return "设备已确认停止充电", nil
+}
+
+func macroReadPowerParams(run *MacroRun, step MacroStepDefinition) (string, error) {
+	req := run.Request
+	params, err := run.Commander.ReadPowerParams(req.CorrelationID, req.DeviceID, run.StepTimeout(step))
+	if err != nil {
+		return "", fmt.Errorf("读取运行参数2失败: %w", err)
+	}
+	run.powerParams = &params
+	return fmt.Sprintf("过载功率 %dW，最大充电时长 %ds", params.OverloadPower, params.MaxChargeTime), nil
+}
+
+func macroSetOverloadPower(run *MacroRun, step MacroStepDefinition) (string, error) {
+	req := run.Request
+	if run.powerParams == nil {
+		return "", fmt.Errorf("须先执行 %s 读取当前运行参数", MacroActionReadPowerParams)
+	}
+	if ports := activePorts(run.Commander.ActiveOrders(req.DeviceID)); len(ports) > 0 {
+		return "", fmt.Errorf("过载功率为整机参数，端口 %v 仍在充电", ports)
+	}
+	params := *run.powerParams
+	params.OverloadPower = step.Value
+	handle, err := run.Commander.SetPowerParams(req.CorrelationID, req.DeviceID, params)
+	if err != nil {
+		return "", err
+	}
+	// 已下发即视为可能生效：应答超时同样需要回滚恢复
+	run.powerModified = true
+	if err := waitMacroHandle(handle, run.StepTimeout(step)); err != nil {
+		return "", fmt.Errorf("等待设置过载功率应答失败: %w", err)
+	}
+	return fmt.Sprintf("过载功率已设为 %dW", step.Value), nil
+}
+
+func macroRestorePowerParams(run *MacroRun, step MacroStepDefinition) (string, error) {
+	if run.powerParams == nil {
+		return "", fmt.Errorf("须先执行 %s 读取当前运行参数", MacroActionReadPowerParams)
+	}
+	if err := restoreMacroPowerParams(run, step); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("过载功率已恢复为 %dW", run.powerParams.OverloadPower), nil
+}
+
+// macroRollbackPowerParams 运行参数2已改动且尚未恢复时恢复读取值
+func macroRollbackPowerParams(run *MacroRun, step MacroStepDefinition) error {
+	if !run.powerModified || run.powerParams == nil {
+		return ErrMacroStepSkipped
+	}
+	return restoreMacroPowerParams(run, step)
+}
+
+func restoreMacroPowerParams(run *MacroRun, step MacroStepDefinition) error {
+	req := run.Request
+	handle, err := run.Commander.SetPowerParams(req.CorrelationID, req.DeviceID, *run.powerParams)
+	if err != nil {
+		return err
+	}
+	if err := waitMacroHandle(handle, run.StepTimeout(step)); err != nil {
+		return fmt.Errorf("等待恢复运行参数应答失败: %w", err)
+	}
+	run.powerModified = false
+	return nil
+}
+
+func macroQueryStatus(run *MacroRun, step MacroStepDefinition) (string, error) {
+	req := run.Request
+	if err := run.Commander.QueryStatus(req.CorrelationID, req.DeviceID, run.StepTimeout(step)); err != nil {
+		return "", err
+	}
+	return "设备已响应状态查询", nil
+}
+
+// waitMacroHandle 等待命令应答（命令管理器未启用时句柄为nil，视为已下发）
+func waitMacroHandle(handle *network.CommandHandle, timeout time.Duration) error {
+	if handle == nil {
+		return nil
+	}
+	return handle.Wait(timeout)
+}
+
+func activePorts(orders map[int]string) []int {
+	ports := make([]int, 0, len(orders))
+	for port := range orders {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// ===============================
+// 网关接入
+// ===============================
+
+// gatewayMacroCommander 以网关现有的充电控制、配置读取与统一发送路径实现宏步骤
+type gatewayMacroCommander struct {
+	g *DeviceGateway
+}
+
+func (c gatewayMacroCommander) ActiveOrders(deviceID string) map[int]string {
+	orders := make(map[int]string)
+	for _, order := range c.g.orderManager.ListActiveOrders() {
+		if order.DeviceID == deviceID {
+			orders[order.Port] = order.OrderNo
+		}
+	}
+	return orders
+}
+
+func (c gatewayMacroCommander) StopCharging(correlationID, deviceID string, port int, orderNo string) (*network.CommandHandle, error) {
+	_, handle, err := c.g.sendChargingCommand(correlationID, ChargeRequest{DeviceID: deviceID, Port: port, OrderNo: orderNo}, 0x00)
+	return handle, err
+}
+
+func (c gatewayMacroCommander) ReadPowerParams(correlationID, deviceID string, timeout time.Duration) (MacroPowerParams, error) {
+	doc, err := c.g.ReadDeviceConfig(correlationID, deviceID, timeout)
+	section, ok := doc.Sections[ConfigSectionRunParams2]
+	if !ok {
+		if err == nil {
+			err = ErrConfigReadIncomplete
+		}
+		return MacroPowerParams{}, err
+	}
+	intValue := func(name string) (int, bool) {
+		v, ok := section[name].(int)
+		return v, ok
+	}
+	var params MacroPowerParams
+	var hasTime, hasPower bool
+	params.MaxChargeTime, hasTime = intValue("max_charge_time")
+	params.OverloadPower, hasPower = intValue("overload_power")
+	if !hasTime || !hasPower {
+		return MacroPowerParams{}, fmt.Errorf("运行参数2缺少最大充电时长或过载功率")
+	}
+	over, hasOver := intValue("over_voltage")
+	under, hasUnder := intValue("under_voltage")
+	if hasOver && hasUnder {
+		params.OverVoltage, params.UnderVoltage, params.HasVoltage = over, under, true
+	}
+	return params, nil
+}
+
+func (c gatewayMacroCommander) SetPowerParams(correlationID, deviceID string, params MacroPowerParams) (*network.CommandHandle, error) {
+	payload := make([]byte, 4, 8)
+	binary.LittleEndian.PutUint16(payload[0:2], uint16(params.MaxChargeTime))
+	binary.LittleEndian.PutUint16(payload[2:4], uint16(params.OverloadPower))
+	if params.HasVoltage {
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(params.OverVoltage))
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(params.UnderVoltage))
+	}
+	return c.g.SendCommandToDeviceWithOptions(context.Background(), deviceID, constants.CmdMaxTimeAndPower, payload, network.CommandOptions{CorrelationID: correlationID})
+}
+
+// QueryStatus 0x81 设备无须应答（协议 §4.1），以设备随后上报的心跳/注册包作为成功判据；
+// 因此不经命令管理器注册，直接构包经统一发送器下发
+func (c gatewayMacroCommander) QueryStatus(correlationID, deviceID string, timeout time.Duration) error {
+	g := c.g
+	if g.tcpManager == nil {
+		return fmt.Errorf("TCP管理器未初始化")
+	}
+	g.throttleSend(deviceID)
+	conn, ok := g.tcpManager.GetConnectionByDeviceID(deviceID)
+	if !ok {
+		return fmt.Errorf("设备 %s 不在线", deviceID)
+	}
+	physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID)
+	if err != nil {
+		return fmt.Errorf("设备ID格式错误: %v", err)
+	}
+
+	sentAt := time.Now()
+	messageID := pkg.Protocol.GetNextMessageID()
+	packet := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(physicalID, messageID, constants.CmdNetworkStatus, nil)
+	if err := pkg.Protocol.SendDNYPacket(conn, packet); err != nil {
+		return fmt.Errorf("发送状态查询失败: %w", err)
+	}
+	g.tcpManager.RecordDeviceCommand(deviceID, constants.CmdNetworkStatus, 0)
+	logger.LogSendDataWithCorrelation(correlationID, deviceID, constants.CmdNetworkStatus, messageID, conn.GetConnID(), 0, "DNY命令下发")
+
+	deadline := sentAt.Add(timeout)
+	for {
+		if device, ok := g.tcpManager.GetDeviceByID(deviceID); ok {
+			device.RLock()
+			last := device.LastHeartbeat
+			device.RUnlock()
+			if last.After(sentAt) {
+				return nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("状态查询后 %s 内未收到设备心跳", timeout)
+		}
+		time.Sleep(macroStatusPollInterval)
+	}
+}
+
+// GetMacroEngine 获取设备宏引擎
+func (g *DeviceGateway) GetMacroEngine() *MacroEngine {
+	return g.macros
+}
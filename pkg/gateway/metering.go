@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	meteringMaxGap    = 10 * time.Minute // 相邻功率样本间隔超过该值时不积分（视为缺测）
+	meteringRetention = 24 * time.Hour   // 超过该时长未收到样本且未结算的积分记录被清理
+)
+
+// MeteringComparison 计量积分对比：功率心跳按时间积分得到的电量与设备结算上报电量
+type MeteringComparison struct {
+	IntegratedWh  float64   `json:"integrated_wh"`
+	ReportedWh    uint32    `json:"reported_wh"`
+	DeltaWh       float64   `json:"delta_wh"`      // 上报 - 积分
+	DeltaPercent  *float64  `json:"delta_percent"` // 相对积分电量的偏差百分比，积分电量为0时为 null
+	Samples       int       `json:"samples"`
+	Gaps          int       `json:"gaps"` // 因间隔过长未积分的区间数
+	FirstSampleAt time.Time `json:"first_sample_at"`
+	LastSampleAt  time.Time `json:"last_sample_at"`
+}
+
+// meteringAccumulator 单个端口的功率积分
+type meteringAccumulator struct {
+	orderNo   string
+	energyWh  float64
+	samples   int
+	gaps      int
+	firstAt   time.Time
+	lastAt    time.Time
+	lastPower float64
+}
+
+// MeteringTracker 按端口对功率心跳中的实时功率做梯形积分，结算时与设备上报电量对比
+type MeteringTracker struct {
+	mu        sync.Mutex
+	ports     map[string]*meteringAccumulator // key: deviceID:协议端口(0-based)
+	lastPrune time.Time
+}
+
+// NewMeteringTracker 创建计量积分跟踪器
+func NewMeteringTracker() *MeteringTracker {
+	return &MeteringTracker{ports: make(map[string]*meteringAccumulator)}
+}
+
+// OnPowerSample 记录一次功率样本（port 为协议端口，从0开始）；订单号变化时重新开始积分
+func (t *MeteringTracker) OnPowerSample(deviceID string, port int, orderNo string, powerW float64, at time.Time) {
+	key := fmt.Sprintf("%s:%d", deviceID, port)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	acc, ok := t.ports[key]
+	if !ok || (orderNo != "" && acc.orderNo != "" && !sameOrderNo(acc.orderNo, orderNo)) {
+		t.ports[key] = &meteringAccumulator{orderNo: orderNo, samples: 1, firstAt: at, lastAt: at, lastPower: powerW}
+		t.pruneLocked(at)
+		return
+	}
+	if acc.orderNo == "" {
+		acc.orderNo = orderNo
+	}
+	if gap := at.Sub(acc.lastAt); gap > 0 && gap <= meteringMaxGap {
+		acc.energyWh += (acc.lastPower + powerW) / 2 * gap.Hours()
+	} else if gap > meteringMaxGap {
+		acc.gaps++
+	}
+	acc.samples++
+	acc.lastAt = at
+	acc.lastPower = powerW
+}
+
+// Take 取出端口的积分结果与上报电量对比并清除记录；无样本或订单号不一致时返回 nil
+func (t *MeteringTracker) Take(deviceID string, port int, orderNo string, reportedWh uint32) *MeteringComparison {
+	key := fmt.Sprintf("%s:%d", deviceID, port)
+	t.mu.Lock()
+	acc, ok := t.ports[key]
+	if ok && (orderNo == "" || acc.orderNo == "" || sameOrderNo(acc.orderNo, orderNo)) {
+		delete(t.ports, key)
+	} else {
+		acc = nil
+	}
+	t.mu.Unlock()
+	if acc == nil {
+		return nil
+	}
+
+	integrated := math.Round(acc.energyWh*100) / 100
+	cmp := &MeteringComparison{
+		IntegratedWh:  integrated,
+		ReportedWh:    reportedWh,
+		DeltaWh:       math.Round((float64(reportedWh)-acc.energyWh)*100) / 100,
+		Samples:       acc.samples,
+		Gaps:          acc.gaps,
+		FirstSampleAt: acc.firstAt,
+		LastSampleAt:  acc.lastAt,
+	}
+	if acc.energyWh > 0 {
+		pct := math.Round((float64(reportedWh)-acc.energyWh)/acc.energyWh*10000) / 100
+		cmp.DeltaPercent = &pct
+	}
+	return cmp
+}
+
+// pruneLocked 清理长时间无样本的积分记录（未收到结算的会话），每小时最多执行一次
+func (t *MeteringTracker) pruneLocked(now time.Time) {
+	if now.Sub(t.lastPrune) < time.Hour {
+		return
+	}
+	t.lastPrune = now
+	for key, acc := range t.ports {
+		if now.Sub(acc.lastAt) > meteringRetention {
+			delete(t.ports, key)
+		}
+	}
+}
+
+// sameOrderNo 功率心跳中的订单号为16字节定长字段，结算中的订单号可能更长，按前缀比较
+func sameOrderNo(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
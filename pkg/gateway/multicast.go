@@ -3,6 +3,7 @@ package gateway
 import (
 	"fmt"
 
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
 	"github.com/sirupsen/logrus"
@@ -20,7 +21,7 @@ func (g *DeviceGateway) BroadcastToAllDevices(command byte, data []byte) int {
 	}
 
 	logger.WithFields(logrus.Fields{
-		"command":      fmt.Sprintf("0x%02X", command),
+		"command":      dny_protocol.CommandLabel(command),
 		"totalDevices": len(onlineDevices),
 		"successCount": successCount,
 	}).Info("广播命令完成")
@@ -70,7 +71,7 @@ func (g *DeviceGateway) SendCommandToGroup(iccid string, command byte, data []by
 
 	logger.WithFields(logrus.Fields{
 		"iccid":        iccid,
-		"command":      fmt.Sprintf("0x%02X", command),
+		"command":      dny_protocol.CommandLabel(command),
 		"totalDevices": len(devices),
 		"successCount": successCount,
 	}).Info("组播命令完成")
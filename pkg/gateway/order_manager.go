@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,6 +19,8 @@ const (
 	OrderStatusCompleted
 	OrderStatusCancelled
 	OrderStatusFailed
+	OrderStatusQueued              // 设备已受理但端口繁忙，排队等待开始充电
+	OrderStatusInterruptedByReboot // 远程重启设备前被强制停止
 )
 
 // String 返回订单状态的字符串表示
@@ -33,6 +36,10 @@ func (s OrderStatus) String() string {
 		return "cancelled"
 	case OrderStatusFailed:
 		return "failed"
+	case OrderStatusQueued:
+		return "queued"
+	case OrderStatusInterruptedByReboot:
+		return "interrupted_by_reboot"
 	default:
 		return fmt.Sprintf("unknown(%d)", int(s))
 	}
@@ -51,21 +58,37 @@ type OrderState struct {
 	EndTime     *time.Time  `json:"end_time,omitempty"`
 	LastUpdate  time.Time   `json:"last_update"`
 	ErrorReason string      `json:"error_reason,omitempty"`
+
+	Promotion *AppliedPromotion `json:"promotion,omitempty"` // 生效的促销（免费/优惠会话）
+	QueuedAt  *time.Time        `json:"queued_at,omitempty"` // 首次进入设备侧排队的时间
+
+	OverloadPowerW uint16 `json:"overload_power_w,omitempty"` // 降功率接入时下发的过载功率(瓦)
 }
 
+// OrderChangeHandler 订单创建或状态变更后的回调（参数为订单副本，在订单锁外调用）
+type OrderChangeHandler func(order OrderState)
+
 // OrderManager 订单管理器 - 修复CVE-Critical-001
 type OrderManager struct {
 	orders        map[string]*OrderState // key: deviceID:port
 	mutex         sync.RWMutex
 	cleanupTicker *time.Ticker
 	stopCleanup   chan struct{}
+
+	// 近1小时充电开始/结束计数（仪表盘汇总用）
+	recentStarts *utils.RollingCounter
+	recentStops  *utils.RollingCounter
+
+	changeHandlers []OrderChangeHandler
 }
 
 // NewOrderManager 创建新的订单管理器
 func NewOrderManager() *OrderManager {
 	om := &OrderManager{
-		orders:      make(map[string]*OrderState),
-		stopCleanup: make(chan struct{}),
+		orders:       make(map[string]*OrderState),
+		stopCleanup:  make(chan struct{}),
+		recentStarts: utils.NewRollingCounter(time.Hour),
+		recentStops:  utils.NewRollingCounter(time.Hour),
 	}
 
 	// 启动定期清理过期订单的goroutine
@@ -79,8 +102,40 @@ func (om *OrderManager) makeOrderKey(deviceID string, port int) string {
 	return fmt.Sprintf("%s:%d", deviceID, port)
 }
 
+// RegisterChangeHandler 注册订单变更回调
+func (om *OrderManager) RegisterChangeHandler(handler OrderChangeHandler) {
+	if handler == nil {
+		return
+	}
+	om.mutex.Lock()
+	om.changeHandlers = append(om.changeHandlers, handler)
+	om.mutex.Unlock()
+}
+
+// ChangeHandlerCount 已注册的订单变更回调数量
+func (om *OrderManager) ChangeHandlerCount() int {
+	om.mutex.RLock()
+	defer om.mutex.RUnlock()
+	return len(om.changeHandlers)
+}
+
+// emitChange 通知订单变更（调用方已释放订单锁；changed 为nil表示未变更）
+func (om *OrderManager) emitChange(changed *OrderState) {
+	if changed == nil {
+		return
+	}
+	om.mutex.RLock()
+	handlers := om.changeHandlers
+	om.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(*changed)
+	}
+}
+
 // CreateOrder 创建新订单 - 带并发保护和重复检查
 func (om *OrderManager) CreateOrder(deviceID string, port int, orderNo string, mode uint8, value uint16, balance uint32) error {
+	var changed *OrderState
+	defer func() { om.emitChange(changed) }()
 	om.mutex.Lock()
 	defer om.mutex.Unlock()
 
@@ -88,7 +143,7 @@ func (om *OrderManager) CreateOrder(deviceID string, port int, orderNo string, m
 
 	// 检查是否已有进行中的订单
 	if existing, exists := om.orders[key]; exists {
-		if existing.Status == OrderStatusCharging || existing.Status == OrderStatusPending {
+		if existing.Status == OrderStatusCharging || existing.Status == OrderStatusPending || existing.Status == OrderStatusQueued {
 			logger.WithFields(logrus.Fields{
 				"deviceID":       deviceID,
 				"port":           port,
@@ -114,6 +169,8 @@ func (om *OrderManager) CreateOrder(deviceID string, port int, orderNo string, m
 		StartTime:  now,
 		LastUpdate: now,
 	}
+	created := *om.orders[key]
+	changed = &created
 
 	logger.WithFields(logrus.Fields{
 		"deviceID": deviceID,
@@ -127,8 +184,30 @@ func (om *OrderManager) CreateOrder(deviceID string, port int, orderNo string, m
 	return nil
 }
 
+// RestoreOrder 恢复其他实例交接过来的进行中订单（端口已有进行中的订单时跳过），不计入充电开始统计
+func (om *OrderManager) RestoreOrder(order OrderState) bool {
+	var changed *OrderState
+	defer func() { om.emitChange(changed) }()
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	key := om.makeOrderKey(order.DeviceID, order.Port)
+	if existing, exists := om.orders[key]; exists {
+		if existing.Status == OrderStatusCharging || existing.Status == OrderStatusPending || existing.Status == OrderStatusQueued {
+			return false
+		}
+	}
+	restored := order
+	om.orders[key] = &restored
+	snapshot := restored
+	changed = &snapshot
+	return true
+}
+
 // UpdateOrderStatus 更新订单状态
 func (om *OrderManager) UpdateOrderStatus(deviceID string, port int, status OrderStatus, reason string) error {
+	var changed *OrderState
+	defer func() { om.emitChange(changed) }()
 	om.mutex.Lock()
 	defer om.mutex.Unlock()
 
@@ -145,8 +224,18 @@ func (om *OrderManager) UpdateOrderStatus(deviceID string, port int, status Orde
 		order.ErrorReason = reason
 	}
 
+	// 首次进入充电状态计为一次充电开始（排队结束恢复充电不重复计数）
+	if status == OrderStatusCharging && oldStatus != OrderStatusCharging && oldStatus != OrderStatusQueued {
+		om.recentStarts.Add(1)
+	}
+
+	if status == OrderStatusQueued && order.QueuedAt == nil {
+		queuedAt := order.LastUpdate
+		order.QueuedAt = &queuedAt
+	}
+
 	// 如果订单结束，设置结束时间
-	if status == OrderStatusCompleted || status == OrderStatusCancelled || status == OrderStatusFailed {
+	if status == OrderStatusCompleted || status == OrderStatusCancelled || status == OrderStatusFailed || status == OrderStatusInterruptedByReboot {
 		endTime := time.Now()
 		order.EndTime = &endTime
 	}
@@ -160,6 +249,44 @@ func (om *OrderManager) UpdateOrderStatus(deviceID string, port int, status Orde
 		"reason":    reason,
 	}).Info("📝 订单状态已更新")
 
+	updated := *order
+	changed = &updated
+	return nil
+}
+
+// SetOrderPromotion 记录订单生效的促销
+func (om *OrderManager) SetOrderPromotion(deviceID string, port int, promo *AppliedPromotion) error {
+	var changed *OrderState
+	defer func() { om.emitChange(changed) }()
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	key := om.makeOrderKey(deviceID, port)
+	order, exists := om.orders[key]
+	if !exists {
+		return fmt.Errorf("订单不存在: %s", key)
+	}
+	order.Promotion = promo
+	updated := *order
+	changed = &updated
+	return nil
+}
+
+// SetOrderOverloadPower 记录订单降功率接入时下发的过载功率
+func (om *OrderManager) SetOrderOverloadPower(deviceID string, port int, overloadPowerW uint16) error {
+	var changed *OrderState
+	defer func() { om.emitChange(changed) }()
+	om.mutex.Lock()
+	defer om.mutex.Unlock()
+
+	key := om.makeOrderKey(deviceID, port)
+	order, exists := om.orders[key]
+	if !exists {
+		return fmt.Errorf("订单不存在: %s", key)
+	}
+	order.OverloadPowerW = overloadPowerW
+	updated := *order
+	changed = &updated
 	return nil
 }
 
@@ -199,7 +326,7 @@ func (om *OrderManager) ValidateOrderForStop(deviceID string, port int, orderNo
 		return fmt.Errorf("端口 %s:%d 上没有进行中的订单", deviceID, port)
 	}
 
-	if order.Status != OrderStatusCharging && order.Status != OrderStatusPending {
+	if order.Status != OrderStatusCharging && order.Status != OrderStatusPending && order.Status != OrderStatusQueued {
 		return fmt.Errorf("端口 %s:%d 上的订单 %s 状态不允许停止 (当前状态: %s)",
 			deviceID, port, order.OrderNo, order.Status.String())
 	}
@@ -229,10 +356,19 @@ func (om *OrderManager) CleanupOrder(deviceID string, port int, reason string) {
 			"cleanupReason": reason,
 		}).Info("🧹 订单已清理")
 
+		// 曾进入充电的订单清理时计为一次充电结束
+		if order.Status == OrderStatusCharging || order.Status == OrderStatusCompleted || order.Status == OrderStatusInterruptedByReboot {
+			om.recentStops.Add(1)
+		}
 		delete(om.orders, key)
 	}
 }
 
+// GetRecentChargeActivity 获取近1小时充电开始/结束次数
+func (om *OrderManager) GetRecentChargeActivity(now time.Time) (starts, stops int64) {
+	return om.recentStarts.Sum(now), om.recentStops.Sum(now)
+}
+
 // ListActiveOrders 列出活跃订单
 func (om *OrderManager) ListActiveOrders() []*OrderState {
 	om.mutex.RLock()
@@ -240,7 +376,7 @@ func (om *OrderManager) ListActiveOrders() []*OrderState {
 
 	var activeOrders []*OrderState
 	for _, order := range om.orders {
-		if order.Status == OrderStatusCharging || order.Status == OrderStatusPending {
+		if order.Status == OrderStatusCharging || order.Status == OrderStatusPending || order.Status == OrderStatusQueued {
 			// 返回副本
 			orderCopy := *order
 			activeOrders = append(activeOrders, &orderCopy)
@@ -250,6 +386,20 @@ func (om *OrderManager) ListActiveOrders() []*OrderState {
 	return activeOrders
 }
 
+// ActivePorts 设备上有进行中订单（充电/待启动/排队）的端口
+func (om *OrderManager) ActivePorts(deviceID string) []int {
+	om.mutex.RLock()
+	defer om.mutex.RUnlock()
+
+	var ports []int
+	for _, order := range om.orders {
+		if order.DeviceID == deviceID && (order.Status == OrderStatusCharging || order.Status == OrderStatusPending || order.Status == OrderStatusQueued) {
+			ports = append(ports, order.Port)
+		}
+	}
+	return ports
+}
+
 // GetOrderStats 获取订单统计信息
 func (om *OrderManager) GetOrderStats() map[string]int {
 	om.mutex.RLock()
@@ -262,6 +412,9 @@ func (om *OrderManager) GetOrderStats() map[string]int {
 		"completed": 0,
 		"cancelled": 0,
 		"failed":    0,
+		"queued":    0,
+
+		"interrupted_by_reboot": 0,
 	}
 
 	for _, order := range om.orders {
@@ -276,6 +429,10 @@ func (om *OrderManager) GetOrderStats() map[string]int {
 			stats["cancelled"]++
 		case OrderStatusFailed:
 			stats["failed"]++
+		case OrderStatusQueued:
+			stats["queued"]++
+		case OrderStatusInterruptedByReboot:
+			stats["interrupted_by_reboot"]++
 		}
 	}
 
@@ -369,7 +526,7 @@ func (om *OrderManager) cleanupExpiredOrders() {
 		logger.WithFields(logrus.Fields{
 			"cleanedCount":    cleanupCount,
 			"remainingOrders": stats["total"],
-			"activeOrders":    stats["pending"] + stats["charging"],
+			"activeOrders":    stats["pending"] + stats["charging"] + stats["queued"],
 		}).Info("🧹 自动清理过期订单完成")
 	}
 }
@@ -383,6 +540,9 @@ func (om *OrderManager) getStatsUnsafe() map[string]int {
 		"completed": 0,
 		"cancelled": 0,
 		"failed":    0,
+		"queued":    0,
+
+		"interrupted_by_reboot": 0,
 	}
 
 	for _, order := range om.orders {
@@ -397,6 +557,10 @@ func (om *OrderManager) getStatsUnsafe() map[string]int {
 			stats["cancelled"]++
 		case OrderStatusFailed:
 			stats["failed"]++
+		case OrderStatusQueued:
+			stats["queued"]++
+		case OrderStatusInterruptedByReboot:
+			stats["interrupted_by_reboot"]++
 		}
 	}
 
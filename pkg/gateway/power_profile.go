@@ -0,0 +1,441 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrPowerProfileNotFound 站点未配置功率时段
+	ErrPowerProfileNotFound = errors.New("站点未配置功率时段")
+	// ErrPowerOverrideNotFound 站点没有生效的人工覆盖
+	ErrPowerOverrideNotFound = errors.New("站点没有生效的人工覆盖")
+)
+
+// 站点预算来源（优先级从高到低）
+const (
+	PowerBudgetSourceOverride = "override" // 人工覆盖（未过期）
+	PowerBudgetSourceWindow   = "window"   // 命中的时段
+	PowerBudgetSourceCapacity = "capacity" // 不在任何时段内，取站点供电容量
+)
+
+const defaultPowerProfileInterval = 30 * time.Second
+
+// PowerWindow 功率时段（本地时间）
+type PowerWindow struct {
+	Start   string `json:"start"`   // 开始时间 HH:MM（含）
+	End     string `json:"end"`     // 结束时间 HH:MM（不含）；早于开始时间表示跨零点，与开始相同表示全天
+	BudgetW int    `json:"budgetW"` // 时段内站点总功率预算(瓦)
+}
+
+// Contains 时刻是否落在时段内（调用前需已通过校验）
+func (w PowerWindow) Contains(t time.Time) bool {
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		return true
+	case start < end:
+		return m >= start && m < end
+	default:
+		return m >= start || m < end
+	}
+}
+
+// PowerProfile 站点功率时段定义
+type PowerProfile struct {
+	StationID string        `json:"stationId"`
+	Name      string        `json:"name,omitempty"`
+	CapacityW int           `json:"capacityW"` // 不在任何时段内时的预算（站点供电容量）
+	Windows   []PowerWindow `json:"windows"`   // 按顺序匹配，重叠时取第一个
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// PowerOverride 人工覆盖：到期前优先于时段定义
+type PowerOverride struct {
+	StationID string    `json:"stationId"`
+	BudgetW   int       `json:"budgetW"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// StationPowerStatus 站点当前生效的时段、预算与端口分配
+type StationPowerStatus struct {
+	StationID    string            `json:"stationId"`
+	Profile      PowerProfile      `json:"profile"`
+	ActiveWindow *PowerWindow      `json:"activeWindow,omitempty"`
+	Override     *PowerOverride    `json:"override,omitempty"`
+	Source       string            `json:"source"`   // override | window | capacity
+	TargetW      int               `json:"targetW"`  // 当前应生效的预算
+	CurrentW     int               `json:"currentW"` // 已输入智能降功率控制器的预算，爬坡中与目标不同
+	Ramping      bool              `json:"ramping"`
+	Ports        []BudgetPortLimit `json:"ports"`
+}
+
+// powerProfilesFile 持久化文件内容
+type powerProfilesFile struct {
+	Profiles  map[string]PowerProfile  `json:"profiles"`
+	Overrides map[string]PowerOverride `json:"overrides"`
+}
+
+// PowerProfileScheduler 站点功率时段调度：按间隔评估各站点的目标预算（人工覆盖 > 时段 > 供电容量），
+// 以每步不超过 rampStepW 的幅度向目标爬坡，并将预算输入智能降功率控制器在站点进行中的会话间分配。
+// 时段定义与人工覆盖持久化；爬坡进度只在内存中，重启后首次评估直接取目标值
+type PowerProfileScheduler struct {
+	mutex     sync.Mutex
+	profiles  map[string]PowerProfile
+	overrides map[string]PowerOverride
+	current   map[string]int // 已输入控制器的预算
+	path      string
+
+	rampStepW int
+	interval  time.Duration
+	dpc       *DynamicPowerController
+	tickMu    sync.Mutex // 串行化评估，避免接口触发与定时评估交错下发
+}
+
+// NewPowerProfileScheduler 创建调度器，path 为空时仅保存在内存
+func NewPowerProfileScheduler(cfg config.PowerProfilesConfig, dpc *DynamicPowerController) *PowerProfileScheduler {
+	s := &PowerProfileScheduler{
+		profiles:  make(map[string]PowerProfile),
+		overrides: make(map[string]PowerOverride),
+		current:   make(map[string]int),
+		path:      cfg.FilePath,
+		rampStepW: cfg.RampStepW,
+		interval:  time.Duration(cfg.RampIntervalSeconds) * time.Second,
+		dpc:       dpc,
+	}
+	if s.interval <= 0 {
+		s.interval = defaultPowerProfileInterval
+	}
+	if err := s.load(); err != nil {
+		logger.WithFields(logrus.Fields{"path": cfg.FilePath, "error": err.Error()}).Warn("加载站点功率时段文件失败，仅使用接口新建的时段")
+	}
+	return s
+}
+
+// SetRamp 调整爬坡步长与评估间隔（测试使用；间隔只影响之后启动的定时评估）
+func (s *PowerProfileScheduler) SetRamp(stepW int, interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rampStepW = stepW
+	if interval > 0 {
+		s.interval = interval
+	}
+}
+
+// RampBudget 从当前预算向目标移动一步：差值不超过 stepW 时直接到达目标，stepW<=0 表示不爬坡
+func RampBudget(currentW, targetW, stepW int) int {
+	if stepW <= 0 || abs(targetW-currentW) <= stepW {
+		return targetW
+	}
+	if targetW > currentW {
+		return currentW + stepW
+	}
+	return currentW - stepW
+}
+
+// ValidatePowerProfile 校验时段定义
+func ValidatePowerProfile(p PowerProfile) error {
+	if p.StationID == "" {
+		return fmt.Errorf("站点ID不能为空")
+	}
+	if p.CapacityW <= 0 {
+		return fmt.Errorf("capacityW 必须大于0")
+	}
+	for i, w := range p.Windows {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("第%d个时段开始时间无效: %s", i+1, w.Start)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("第%d个时段结束时间无效: %s", i+1, w.End)
+		}
+		if w.BudgetW <= 0 {
+			return fmt.Errorf("第%d个时段预算必须大于0", i+1)
+		}
+	}
+	return nil
+}
+
+// ValidatePowerOverride 校验人工覆盖
+func ValidatePowerOverride(o PowerOverride, now time.Time) error {
+	if o.StationID == "" {
+		return fmt.Errorf("站点ID不能为空")
+	}
+	if o.BudgetW <= 0 {
+		return fmt.Errorf("budgetW 必须大于0")
+	}
+	if !o.ExpiresAt.After(now) {
+		return fmt.Errorf("过期时间必须晚于当前时间")
+	}
+	return nil
+}
+
+// Profiles 全部站点的时段定义（按站点ID排序）
+func (s *PowerProfileScheduler) Profiles() []PowerProfile {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	list := make([]PowerProfile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StationID < list[j].StationID })
+	return list
+}
+
+// SetProfile 设置站点时段定义（整体替换）并立即评估该站点
+func (s *PowerProfileScheduler) SetProfile(p PowerProfile) (PowerProfile, error) {
+	if err := ValidatePowerProfile(p); err != nil {
+		return p, err
+	}
+	p.UpdatedAt = time.Now()
+
+	s.mutex.Lock()
+	previous, existed := s.profiles[p.StationID]
+	s.profiles[p.StationID] = p
+	if err := s.saveLocked(); err != nil {
+		if existed {
+			s.profiles[p.StationID] = previous
+		} else {
+			delete(s.profiles, p.StationID)
+		}
+		s.mutex.Unlock()
+		return p, err
+	}
+	s.mutex.Unlock()
+	s.evaluate(time.Now(), p.StationID)
+	return p, nil
+}
+
+// DeleteProfile 删除站点时段定义与人工覆盖，并移除控制器中的站点预算（已下发的端口上限保持到会话结束）
+func (s *PowerProfileScheduler) DeleteProfile(stationID string) error {
+	s.mutex.Lock()
+	profile, ok := s.profiles[stationID]
+	if !ok {
+		s.mutex.Unlock()
+		return ErrPowerProfileNotFound
+	}
+	override, hadOverride := s.overrides[stationID]
+	delete(s.profiles, stationID)
+	delete(s.overrides, stationID)
+	if err := s.saveLocked(); err != nil {
+		s.profiles[stationID] = profile
+		if hadOverride {
+			s.overrides[stationID] = override
+		}
+		s.mutex.Unlock()
+		return err
+	}
+	delete(s.current, stationID)
+	s.mutex.Unlock()
+	s.dpc.ClearStationBudget(stationID)
+	return nil
+}
+
+// SetOverride 设置人工覆盖（站点需已配置时段），到期前优先于时段定义，切换同样按步长爬坡
+func (s *PowerProfileScheduler) SetOverride(o PowerOverride) (PowerOverride, error) {
+	now := time.Now()
+	if err := ValidatePowerOverride(o, now); err != nil {
+		return o, err
+	}
+	o.CreatedAt = now
+
+	s.mutex.Lock()
+	if _, ok := s.profiles[o.StationID]; !ok {
+		s.mutex.Unlock()
+		return o, ErrPowerProfileNotFound
+	}
+	previous, existed := s.overrides[o.StationID]
+	s.overrides[o.StationID] = o
+	if err := s.saveLocked(); err != nil {
+		if existed {
+			s.overrides[o.StationID] = previous
+		} else {
+			delete(s.overrides, o.StationID)
+		}
+		s.mutex.Unlock()
+		return o, err
+	}
+	s.mutex.Unlock()
+	s.evaluate(now, o.StationID)
+	return o, nil
+}
+
+// ClearOverride 提前结束人工覆盖，恢复按时段定义
+func (s *PowerProfileScheduler) ClearOverride(stationID string) error {
+	s.mutex.Lock()
+	previous, ok := s.overrides[stationID]
+	if !ok {
+		s.mutex.Unlock()
+		return ErrPowerOverrideNotFound
+	}
+	delete(s.overrides, stationID)
+	if err := s.saveLocked(); err != nil {
+		s.overrides[stationID] = previous
+		s.mutex.Unlock()
+		return err
+	}
+	s.mutex.Unlock()
+	s.evaluate(time.Now(), stationID)
+	return nil
+}
+
+// Status 站点当前生效的时段、预算与端口分配；站点未配置时段时返回false
+func (s *PowerProfileScheduler) Status(stationID string, now time.Time) (StationPowerStatus, bool) {
+	s.mutex.Lock()
+	profile, ok := s.profiles[stationID]
+	if !ok {
+		s.mutex.Unlock()
+		return StationPowerStatus{}, false
+	}
+	status := StationPowerStatus{StationID: stationID, Profile: profile}
+	status.TargetW, status.Source, status.ActiveWindow, status.Override = s.targetLocked(profile, now)
+	current, evaluated := s.current[stationID]
+	s.mutex.Unlock()
+
+	if evaluated {
+		status.CurrentW = current
+		status.Ramping = current != status.TargetW
+	}
+	if _, ports, ok := s.dpc.StationBudget(stationID); ok {
+		status.Ports = ports
+	}
+	if status.Ports == nil {
+		status.Ports = []BudgetPortLimit{}
+	}
+	return status, true
+}
+
+// Tick 评估全部站点：清理已过期的人工覆盖，各站点预算向目标移动一步并输入控制器（每次都输入，使新开始的会话参与分配）
+func (s *PowerProfileScheduler) Tick(now time.Time) {
+	s.evaluate(now, "")
+}
+
+// evaluate 评估指定站点（为空时评估全部站点）；时段定义或人工覆盖变更后立即评估该站点，切换的第一步随即生效
+func (s *PowerProfileScheduler) evaluate(now time.Time, only string) {
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
+
+	s.mutex.Lock()
+	expired := false
+	for stationID, o := range s.overrides {
+		if !o.ExpiresAt.After(now) {
+			delete(s.overrides, stationID)
+			expired = true
+			logger.WithFields(logrus.Fields{"stationID": stationID, "budgetW": o.BudgetW, "reason": o.Reason}).Info("站点功率人工覆盖已到期，恢复按时段")
+		}
+	}
+	if expired {
+		if err := s.saveLocked(); err != nil {
+			logger.WithFields(logrus.Fields{"path": s.path, "error": err.Error()}).Warn("保存站点功率时段文件失败")
+		}
+	}
+	budgets := make(map[string]int, len(s.profiles))
+	for stationID, profile := range s.profiles {
+		if only != "" && stationID != only {
+			continue
+		}
+		target, source, _, _ := s.targetLocked(profile, now)
+		next := target
+		if current, ok := s.current[stationID]; ok {
+			next = RampBudget(current, target, s.rampStepW)
+		}
+		if previous, ok := s.current[stationID]; !ok || previous != next {
+			logger.WithFields(logrus.Fields{"stationID": stationID, "source": source, "targetW": target, "budgetW": next}).Info("站点功率预算切换")
+		}
+		s.current[stationID] = next
+		budgets[stationID] = next
+	}
+	s.mutex.Unlock()
+
+	for stationID, budgetW := range budgets {
+		s.dpc.SetStationBudget(stationID, budgetW)
+	}
+}
+
+// targetLocked 站点目标预算与来源，调用方持有锁
+func (s *PowerProfileScheduler) targetLocked(profile PowerProfile, now time.Time) (int, string, *PowerWindow, *PowerOverride) {
+	if o, ok := s.overrides[profile.StationID]; ok && o.ExpiresAt.After(now) {
+		return o.BudgetW, PowerBudgetSourceOverride, nil, &o
+	}
+	local := now.Local()
+	for _, w := range profile.Windows {
+		if w.Contains(local) {
+			return w.BudgetW, PowerBudgetSourceWindow, &w, nil
+		}
+	}
+	return profile.CapacityW, PowerBudgetSourceCapacity, nil, nil
+}
+
+func (s *PowerProfileScheduler) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取站点功率时段文件失败: %w", err)
+	}
+	var file powerProfilesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析站点功率时段文件失败: %w", err)
+	}
+	for stationID, p := range file.Profiles {
+		s.profiles[stationID] = p
+	}
+	for stationID, o := range file.Overrides {
+		s.overrides[stationID] = o
+	}
+	return nil
+}
+
+// saveLocked 写入时段文件（先写临时文件再重命名），调用方持有锁
+func (s *PowerProfileScheduler) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(powerProfilesFile{Profiles: s.profiles, Overrides: s.overrides}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建站点功率时段目录失败: %w", err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入站点功率时段文件失败: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// startPowerProfileWorker 按间隔评估站点功率时段（时段边界在下一次评估时生效）
+func (g *DeviceGateway) startPowerProfileWorker() {
+	go func() {
+		ticker := time.NewTicker(g.powerProfiles.interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			g.powerProfiles.Tick(now)
+		}
+	}()
+}
+
+// GetPowerProfiles 获取站点功率时段调度器
+func (g *DeviceGateway) GetPowerProfiles() *PowerProfileScheduler {
+	return g.powerProfiles
+}
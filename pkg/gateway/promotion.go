@@ -0,0 +1,309 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ChargeRequest 开始充电请求参数（促销策略的输入）
+type ChargeRequest struct {
+	DeviceID string `json:"device_id"`
+	ICCID    string `json:"iccid,omitempty"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Port     int    `json:"port"` // 业务端口(1-based)
+	OrderNo  string `json:"order_no"`
+	Mode     uint8  `json:"mode"`
+	Value    uint16 `json:"value"`
+	Balance  uint32 `json:"balance"`
+
+	OverloadPowerW uint16 `json:"overload_power_w,omitempty"` // 过载功率(瓦)，0表示不限制；降功率接入时由并发上限设置
+}
+
+// AppliedPromotion 会话上生效的促销
+type AppliedPromotion struct {
+	ID              string    `json:"id"`
+	Tag             string    `json:"tag"`
+	Free            bool      `json:"free"`
+	Mode            uint8     `json:"mode"`
+	Value           uint16    `json:"value"`
+	Balance         uint32    `json:"balance"`
+	OriginalMode    uint8     `json:"original_mode"`
+	OriginalValue   uint16    `json:"original_value"`
+	OriginalBalance uint32    `json:"original_balance"`
+	AppliedAt       time.Time `json:"applied_at"`
+}
+
+// PromotionPolicy 促销策略钩子：在下发0x82前调用，可覆盖计费模式/余额/时长并附带促销标签
+type PromotionPolicy interface {
+	Apply(req ChargeRequest, now time.Time) (*AppliedPromotion, bool)
+}
+
+// PromotionSettlementCheck 促销会话结算对账结果
+type PromotionSettlementCheck struct {
+	OrderNo     string            `json:"order_no"`
+	Promotion   *AppliedPromotion `json:"promotion"`
+	ReportedFee uint32            `json:"reported_fee"` // 设备上报总费用(分)
+	Discrepancy bool              `json:"discrepancy"`  // 免费会话设备仍计费
+	Reason      string            `json:"reason,omitempty"`
+}
+
+// ===============================
+// 基于配置文件的促销策略
+// ===============================
+
+const promotionTimeLayout = "2006-01-02 15:04:05"
+
+type promotionRule struct {
+	cfg        config.PromotionRuleConfig
+	start, end time.Time
+	dailyStart int // 分钟，-1表示全天
+	dailyEnd   int
+	weekdays   map[time.Weekday]bool
+	devices    map[string]bool
+	iccids     map[string]bool
+	tenants    map[string]bool
+}
+
+// ConfigPromotionPolicy 配置驱动的促销策略（时间窗口 + 设备/ICCID/租户范围）
+type ConfigPromotionPolicy struct {
+	rules []promotionRule
+}
+
+// NewConfigPromotionPolicy 根据配置创建促销策略
+func NewConfigPromotionPolicy(cfg config.PromotionConfig) (*ConfigPromotionPolicy, error) {
+	p := &ConfigPromotionPolicy{}
+	for _, rc := range cfg.Rules {
+		rule := promotionRule{cfg: rc, dailyStart: -1, dailyEnd: -1}
+		if rc.ID == "" {
+			return nil, fmt.Errorf("促销规则ID不能为空")
+		}
+		if rule.cfg.Tag == "" {
+			rule.cfg.Tag = rc.ID
+		}
+		var err error
+		if rule.start, err = parsePromotionTime(rc.Start); err != nil {
+			return nil, fmt.Errorf("促销规则 %s 开始时间无效: %w", rc.ID, err)
+		}
+		if rule.end, err = parsePromotionTime(rc.End); err != nil {
+			return nil, fmt.Errorf("促销规则 %s 结束时间无效: %w", rc.ID, err)
+		}
+		if rc.DailyStart != "" || rc.DailyEnd != "" {
+			if rule.dailyStart, err = parseClock(rc.DailyStart); err != nil {
+				return nil, fmt.Errorf("促销规则 %s 每日开始时间无效: %w", rc.ID, err)
+			}
+			if rule.dailyEnd, err = parseClock(rc.DailyEnd); err != nil {
+				return nil, fmt.Errorf("促销规则 %s 每日结束时间无效: %w", rc.ID, err)
+			}
+		}
+		if rc.RateMode != nil && (*rc.RateMode < 0 || *rc.RateMode > 1) {
+			return nil, fmt.Errorf("促销规则 %s 计费模式无效: %d", rc.ID, *rc.RateMode)
+		}
+		if rc.DurationSeconds < 0 || rc.DurationSeconds > 0xFFFF {
+			return nil, fmt.Errorf("促销规则 %s 充电时长超出范围: %d", rc.ID, rc.DurationSeconds)
+		}
+		if len(rc.Weekdays) > 0 {
+			rule.weekdays = make(map[time.Weekday]bool, len(rc.Weekdays))
+			for _, d := range rc.Weekdays {
+				rule.weekdays[time.Weekday(d%7)] = true
+			}
+		}
+		rule.devices = toUpperSet(rc.DeviceIDs)
+		rule.iccids = toUpperSet(rc.ICCIDs)
+		rule.tenants = toUpperSet(rc.Tenants)
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// Apply 按顺序匹配规则，首条命中生效
+func (p *ConfigPromotionPolicy) Apply(req ChargeRequest, now time.Time) (*AppliedPromotion, bool) {
+	for _, rule := range p.rules {
+		if !rule.matches(req, now) {
+			continue
+		}
+		promo := &AppliedPromotion{
+			ID:              rule.cfg.ID,
+			Tag:             rule.cfg.Tag,
+			Free:            rule.cfg.Free,
+			Mode:            req.Mode,
+			Value:           req.Value,
+			Balance:         req.Balance,
+			OriginalMode:    req.Mode,
+			OriginalValue:   req.Value,
+			OriginalBalance: req.Balance,
+			AppliedAt:       now,
+		}
+		if rule.cfg.RateMode != nil {
+			promo.Mode = uint8(*rule.cfg.RateMode)
+		}
+		if rule.cfg.DurationSeconds > 0 {
+			promo.Value = uint16(rule.cfg.DurationSeconds)
+		}
+		if rule.cfg.Balance > 0 {
+			promo.Balance = rule.cfg.Balance
+		}
+		return promo, true
+	}
+	return nil, false
+}
+
+func (r promotionRule) matches(req ChargeRequest, now time.Time) bool {
+	if !r.start.IsZero() && now.Before(r.start) {
+		return false
+	}
+	if !r.end.IsZero() && now.After(r.end) {
+		return false
+	}
+	if r.weekdays != nil && !r.weekdays[now.Weekday()] {
+		return false
+	}
+	if r.dailyStart >= 0 {
+		minute := now.Hour()*60 + now.Minute()
+		if r.dailyStart <= r.dailyEnd {
+			if minute < r.dailyStart || minute >= r.dailyEnd {
+				return false
+			}
+		} else if minute < r.dailyStart && minute >= r.dailyEnd { // 跨零点
+			return false
+		}
+	}
+	if r.devices != nil && !r.devices[strings.ToUpper(req.DeviceID)] {
+		return false
+	}
+	if r.iccids != nil && !r.iccids[strings.ToUpper(req.ICCID)] {
+		return false
+	}
+	if r.tenants != nil && !r.tenants[strings.ToUpper(req.TenantID)] {
+		return false
+	}
+	return true
+}
+
+func parsePromotionTime(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(promotionTimeLayout, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func toUpperSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToUpper(strings.TrimSpace(v))] = true
+	}
+	return set
+}
+
+// ===============================
+// DeviceGateway 促销钩子
+// ===============================
+
+// SetPromotionPolicy 设置促销策略（nil 表示禁用）
+func (g *DeviceGateway) SetPromotionPolicy(policy PromotionPolicy) {
+	g.promotionMu.Lock()
+	defer g.promotionMu.Unlock()
+	g.promotionPolicy = policy
+}
+
+// InitPromotionPolicy 按配置初始化全局网关的促销策略
+func InitPromotionPolicy() error {
+	cfg := config.GetConfig().Promotion
+	g := GetGlobalDeviceGateway()
+	if !cfg.Enabled {
+		g.SetPromotionPolicy(nil)
+		return nil
+	}
+	policy, err := NewConfigPromotionPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	g.SetPromotionPolicy(policy)
+	logger.WithFields(logrus.Fields{"rules": len(cfg.Rules)}).Info("充电促销策略已启用")
+	return nil
+}
+
+// applyPromotion 开始充电前调用促销策略，返回覆盖后的请求与生效的促销
+func (g *DeviceGateway) applyPromotion(req ChargeRequest) (ChargeRequest, *AppliedPromotion) {
+	g.promotionMu.RLock()
+	policy := g.promotionPolicy
+	g.promotionMu.RUnlock()
+	if policy == nil {
+		return req, nil
+	}
+
+	if req.ICCID == "" && g.tcpManager != nil {
+		if device, ok := g.tcpManager.GetDeviceByID(req.DeviceID); ok {
+			device.RLock()
+			req.ICCID = device.ICCID
+			device.RUnlock()
+		}
+	}
+
+	promo, ok := policy.Apply(req, time.Now())
+	if !ok || promo == nil {
+		return req, nil
+	}
+	req.Mode, req.Value, req.Balance = promo.Mode, promo.Value, promo.Balance
+
+	logger.WithFields(logrus.Fields{
+		"deviceID":        req.DeviceID,
+		"port":            req.Port,
+		"orderNo":         req.OrderNo,
+		"promotionID":     promo.ID,
+		"tag":             promo.Tag,
+		"free":            promo.Free,
+		"mode":            promo.Mode,
+		"value":           promo.Value,
+		"balance":         promo.Balance,
+		"originalMode":    promo.OriginalMode,
+		"originalValue":   promo.OriginalValue,
+		"originalBalance": promo.OriginalBalance,
+	}).Info("🎁 充电促销已生效")
+	return req, promo
+}
+
+// CheckPromotionSettlement 结算对账：免费促销会话设备上报费用非0视为差异
+// 订单不存在或未命中促销时返回nil
+func (g *DeviceGateway) CheckPromotionSettlement(orderNo string, reportedFee uint32) *PromotionSettlementCheck {
+	order := g.orderManager.GetOrderByOrderNo(orderNo)
+	if order == nil || order.Promotion == nil {
+		return nil
+	}
+	check := &PromotionSettlementCheck{
+		OrderNo:     orderNo,
+		Promotion:   order.Promotion,
+		ReportedFee: reportedFee,
+	}
+	if order.Promotion.Free && reportedFee > 0 {
+		check.Discrepancy = true
+		check.Reason = fmt.Sprintf("促销 %s 为免费会话，但设备上报费用 %d 分", order.Promotion.Tag, reportedFee)
+		logger.WithFields(logrus.Fields{
+			"deviceID":    order.DeviceID,
+			"port":        order.Port,
+			"orderNo":     orderNo,
+			"promotionID": order.Promotion.ID,
+			"tag":         order.Promotion.Tag,
+			"reportedFee": reportedFee,
+		}).Warn("⚠️ 促销会话结算对账差异")
+	}
+	return check
+}
@@ -0,0 +1,392 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRebootReconnectWindow = 2 * time.Minute
+	rebootHistoryLimit           = 20
+	rebootCheckInterval          = 5 * time.Second
+)
+
+// 重启状态
+const (
+	RebootStatusPending   = "pending"   // 已下发，等待设备重新注册
+	RebootStatusCompleted = "completed" // 设备已重新注册
+	RebootStatusFailed    = "failed"    // 超时未重新注册
+)
+
+// 重启事件类型
+const (
+	RebootEventIssued    = "issued"
+	RebootEventCompleted = "completed"
+	RebootEventFailed    = "failed"
+)
+
+// RebootRecord 远程重启记录
+type RebootRecord struct {
+	ID                string     `json:"id"`
+	DeviceID          string     `json:"device_id"`
+	CorrelationID     string     `json:"correlation_id,omitempty"`
+	Force             bool       `json:"force"`
+	Status            string     `json:"status"`
+	IssuedAt          time.Time  `json:"issued_at"`
+	Deadline          time.Time  `json:"deadline"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	InterruptedOrders []string   `json:"interrupted_orders,omitempty"` // 强制重启前停止的订单
+	Error             string     `json:"error,omitempty"`
+
+	done chan struct{}
+}
+
+// RebootEvent 重启事件
+type RebootEvent struct {
+	Type   string
+	Record RebootRecord
+}
+
+// RebootHandler 重启事件处理函数（通知等外部集成由调用方注册）
+type RebootHandler func(event RebootEvent)
+
+// ActiveSessionsError 设备存在进行中的充电会话，拒绝重启
+type ActiveSessionsError struct {
+	DeviceID string
+	Sessions []*OrderState
+}
+
+func (e *ActiveSessionsError) Error() string {
+	orders := make([]string, 0, len(e.Sessions))
+	for _, s := range e.Sessions {
+		orders = append(orders, fmt.Sprintf("%d:%s", s.Port, s.OrderNo))
+	}
+	return fmt.Sprintf("设备 %s 存在 %d 个进行中的充电会话(%s)，如需重启请使用 force=true",
+		e.DeviceID, len(e.Sessions), strings.Join(orders, ","))
+}
+
+// RebootTracker 远程重启跟踪
+type RebootTracker struct {
+	mutex    sync.RWMutex
+	pending  map[string]*RebootRecord  // deviceID → 进行中的重启
+	history  map[string][]RebootRecord // deviceID → 最近重启记录（新→旧）
+	handlers []RebootHandler
+	window   time.Duration
+}
+
+// NewRebootTracker 创建重启跟踪器
+func NewRebootTracker(cfg config.RebootConfig) *RebootTracker {
+	window := time.Duration(cfg.ReconnectWindowSeconds) * time.Second
+	if window <= 0 {
+		window = defaultRebootReconnectWindow
+	}
+	return &RebootTracker{
+		pending: make(map[string]*RebootRecord),
+		history: make(map[string][]RebootRecord),
+		window:  window,
+	}
+}
+
+// SetReconnectWindow 设置重新注册等待时长
+func (t *RebootTracker) SetReconnectWindow(window time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if window > 0 {
+		t.window = window
+	}
+}
+
+// RegisterHandler 注册重启事件处理函数
+func (t *RebootTracker) RegisterHandler(handler RebootHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.handlers = append(t.handlers, handler)
+}
+
+// HandlerCount 已注册的重启事件处理函数数量
+func (t *RebootTracker) HandlerCount() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.handlers)
+}
+
+// Get 获取重启记录
+func (t *RebootTracker) Get(deviceID, id string) (RebootRecord, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if r, ok := t.pending[deviceID]; ok && r.ID == id {
+		return r.snapshot(), true
+	}
+	for _, r := range t.history[deviceID] {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return RebootRecord{}, false
+}
+
+// History 设备最近的重启记录（新→旧）
+func (t *RebootTracker) History(deviceID string) []RebootRecord {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	list := make([]RebootRecord, 0, len(t.history[deviceID])+1)
+	if r, ok := t.pending[deviceID]; ok {
+		list = append(list, r.snapshot())
+	}
+	list = append(list, t.history[deviceID]...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].IssuedAt.After(list[j].IssuedAt) })
+	return list
+}
+
+// Wait 等待重启结束或超时，返回当前记录
+func (t *RebootTracker) Wait(deviceID, id string, timeout time.Duration) (RebootRecord, bool) {
+	t.mutex.RLock()
+	r, ok := t.pending[deviceID]
+	var done chan struct{}
+	if ok && r.ID == id {
+		done = r.done
+	}
+	t.mutex.RUnlock()
+
+	if done != nil && timeout > 0 {
+		timer := time.NewTimer(timeout)
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	return t.Get(deviceID, id)
+}
+
+func (t *RebootTracker) begin(record *RebootRecord) (*RebootRecord, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if existing, ok := t.pending[record.DeviceID]; ok {
+		return nil, fmt.Errorf("设备 %s 已有进行中的重启(%s)，请等待其完成", record.DeviceID, existing.ID)
+	}
+	record.Deadline = record.IssuedAt.Add(t.window)
+	record.done = make(chan struct{})
+	t.pending[record.DeviceID] = record
+	return record, nil
+}
+
+func (t *RebootTracker) setInterrupted(deviceID, id string, orders []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if r, ok := t.pending[deviceID]; ok && r.ID == id {
+		r.InterruptedOrders = orders
+	}
+}
+
+// abort 下发失败时撤销进行中的重启
+func (t *RebootTracker) abort(deviceID, id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if r, ok := t.pending[deviceID]; ok && r.ID == id {
+		delete(t.pending, deviceID)
+		close(r.done)
+	}
+}
+
+// finish 结束进行中的重启并归档
+func (t *RebootTracker) finish(deviceID, status, reason string, now time.Time) (RebootRecord, bool) {
+	t.mutex.Lock()
+	r, ok := t.pending[deviceID]
+	if !ok {
+		t.mutex.Unlock()
+		return RebootRecord{}, false
+	}
+	delete(t.pending, deviceID)
+	r.Status = status
+	r.Error = reason
+	completedAt := now
+	r.CompletedAt = &completedAt
+	close(r.done)
+
+	record := r.snapshot()
+	history := append([]RebootRecord{record}, t.history[deviceID]...)
+	if len(history) > rebootHistoryLimit {
+		history = history[:rebootHistoryLimit]
+	}
+	t.history[deviceID] = history
+	t.mutex.Unlock()
+	return record, true
+}
+
+// collectExpired 结束超时未重新注册的重启
+func (t *RebootTracker) collectExpired(now time.Time) []RebootRecord {
+	t.mutex.RLock()
+	var expired []string
+	for deviceID, r := range t.pending {
+		if now.After(r.Deadline) {
+			expired = append(expired, deviceID)
+		}
+	}
+	t.mutex.RUnlock()
+
+	records := make([]RebootRecord, 0, len(expired))
+	for _, deviceID := range expired {
+		if r, ok := t.finish(deviceID, RebootStatusFailed, "等待设备重新注册超时", now); ok {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func (t *RebootTracker) emit(event RebootEvent) {
+	t.mutex.RLock()
+	handlers := append([]RebootHandler(nil), t.handlers...)
+	t.mutex.RUnlock()
+	for _, h := range handlers {
+		h(event)
+	}
+}
+
+func (r *RebootRecord) snapshot() RebootRecord {
+	cp := *r
+	cp.InterruptedOrders = append([]string(nil), r.InterruptedOrders...)
+	return cp
+}
+
+// ===============================
+// DeviceGateway 远程重启
+// ===============================
+
+// GetRebootTracker 获取重启跟踪器
+func (g *DeviceGateway) GetRebootTracker() *RebootTracker {
+	return g.reboots
+}
+
+// RebootDevice 远程重启设备（0x31）
+// 存在进行中的充电会话时：force=false 返回 *ActiveSessionsError；force=true 先停止会话并标记为 interrupted_by_reboot
+func (g *DeviceGateway) RebootDevice(correlationID, deviceID string, force bool) (RebootRecord, error) {
+	if deviceID == "" {
+		return RebootRecord{}, fmt.Errorf("设备ID不能为空")
+	}
+	if !g.IsDeviceOnline(deviceID) {
+		return RebootRecord{}, fmt.Errorf("设备 %s 不在线", deviceID)
+	}
+
+	var sessions []*OrderState
+	for _, order := range g.orderManager.ListActiveOrders() {
+		if order.DeviceID == deviceID {
+			sessions = append(sessions, order)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Port < sessions[j].Port })
+	if len(sessions) > 0 && !force {
+		return RebootRecord{}, &ActiveSessionsError{DeviceID: deviceID, Sessions: sessions}
+	}
+
+	record, err := g.reboots.begin(&RebootRecord{
+		ID:            "reboot_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12],
+		DeviceID:      deviceID,
+		CorrelationID: correlationID,
+		Force:         force,
+		Status:        RebootStatusPending,
+		IssuedAt:      time.Now(),
+	})
+	if err != nil {
+		return RebootRecord{}, err
+	}
+
+	// 强制重启：先逐个停止进行中的会话
+	interrupted := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		if err := g.SendChargingCommandWithCorrelation(correlationID, deviceID, uint8(s.Port), 0x00, s.OrderNo, 0, 0, 0); err != nil {
+			logger.WithFields(logrus.Fields{
+				"deviceID": deviceID,
+				"port":     s.Port,
+				"orderNo":  s.OrderNo,
+				"error":    err.Error(),
+			}).Warn("重启前停止充电失败，继续重启")
+		}
+		_ = g.orderManager.UpdateOrderStatus(deviceID, s.Port, OrderStatusInterruptedByReboot, "设备远程重启")
+		g.FinalizeChargingSession(deviceID, s.Port, s.OrderNo, "interrupted by reboot")
+		interrupted = append(interrupted, s.OrderNo)
+	}
+	g.reboots.setInterrupted(deviceID, record.ID, interrupted)
+
+	if err := g.SendCommandToDeviceWithCorrelation(correlationID, deviceID, constants.CmdRebootMain, []byte{}); err != nil {
+		g.reboots.abort(deviceID, record.ID)
+		logger.WithFields(logrus.Fields{
+			"correlationID": correlationID,
+			"deviceID":      deviceID,
+			"error":         err.Error(),
+		}).Error("❌ 设备重启命令发送失败")
+		return RebootRecord{}, fmt.Errorf("发送重启命令失败: %v", err)
+	}
+
+	snapshot, _ := g.reboots.Get(deviceID, record.ID)
+	logger.WithFields(logrus.Fields{
+		"correlationID":     correlationID,
+		"deviceID":          deviceID,
+		"rebootID":          record.ID,
+		"force":             force,
+		"interruptedOrders": snapshot.InterruptedOrders,
+		"deadline":          snapshot.Deadline.Format(constants.TimeFormatDefault),
+	}).Info("🔁 设备重启命令已下发，等待设备重新注册")
+
+	g.reboots.emit(RebootEvent{Type: RebootEventIssued, Record: snapshot})
+	return snapshot, nil
+}
+
+// OnDeviceRegistered 设备注册（0x20）时调用：重新挂载虚拟子设备，重发断线前待重发的命令，下发延迟命令，
+// 记录注册补齐统计、站点在线状态与搜索索引，并结束进行中的重启
+func (g *DeviceGateway) OnDeviceRegistered(deviceID string) {
+	g.stations.OnDeviceOnline(deviceID, time.Now())
+	g.indexDeviceForSearch(deviceID, time.Now())
+	g.attachVirtualDevices(deviceID)
+	g.resendCommandsOnReconnect(deviceID)
+	go g.deferred.Drain(deviceID)
+	g.observeRegistration(deviceID)
+	g.emitRegistration(deviceID)
+	if g.reboots == nil {
+		return
+	}
+	record, ok := g.reboots.finish(deviceID, RebootStatusCompleted, "", time.Now())
+	if !ok {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"deviceID": deviceID,
+		"rebootID": record.ID,
+		"elapsed":  record.CompletedAt.Sub(record.IssuedAt).String(),
+	}).Info("✅ 设备重启完成，已重新注册")
+	g.reboots.emit(RebootEvent{Type: RebootEventCompleted, Record: record})
+}
+
+// CheckRebootTimeouts 检查超时未重新注册的重启
+func (g *DeviceGateway) CheckRebootTimeouts(now time.Time) []RebootRecord {
+	records := g.reboots.collectExpired(now)
+	for _, r := range records {
+		logger.WithFields(logrus.Fields{
+			"deviceID": r.DeviceID,
+			"rebootID": r.ID,
+			"deadline": r.Deadline.Format(constants.TimeFormatDefault),
+		}).Warn("⏰ 设备重启后未在规定时间内重新注册")
+		g.reboots.emit(RebootEvent{Type: RebootEventFailed, Record: r})
+	}
+	return records
+}
+
+// startRebootWorker 定期检查重启超时
+func (g *DeviceGateway) startRebootWorker() {
+	go func() {
+		ticker := time.NewTicker(rebootCheckInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			g.CheckRebootTimeouts(now)
+		}
+	}()
+}
@@ -0,0 +1,369 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBackfillDelay              = 30 * time.Second
+	defaultBackfillWindow             = 15 * time.Minute
+	defaultBackfillRatePerSecond      = 20
+	defaultBackfillMaxAttempts        = 3
+	defaultBackfillRetryInterval      = time.Minute
+	defaultMassDisconnectWindow       = 30 * time.Second
+	registrationBackfillSweepInterval = time.Second
+)
+
+// 补齐窗口激活原因
+const (
+	BackfillTriggerStartup        = "startup"
+	BackfillTriggerMassDisconnect = "mass_disconnect"
+)
+
+// SolicitUnknownPhysicalID 连接尚未上报任何DNY帧、物理ID未知时0x81请求使用的地址
+const SolicitUnknownPhysicalID uint32 = 0xFFFFFFFF
+
+// RegistrationSolicitSender 向未注册连接下发注册请求（0x81查询设备联网状态，设备随后上发0x20/0x01/0x21）
+type RegistrationSolicitSender func(conn ziface.IConnection) error
+
+// RegistrationBackfillStats 注册补齐统计
+type RegistrationBackfillStats struct {
+	Enabled                  bool      `json:"enabled"`
+	Active                   bool      `json:"active"`
+	ActiveUntil              time.Time `json:"active_until"`
+	LastTrigger              string    `json:"last_trigger"`
+	Activations              int64     `json:"activations"`               // 窗口激活次数（启动+大规模断连）
+	Pending                  int       `json:"pending"`                   // 已请求、尚未注册且未达上限的连接数
+	Solicitations            int64     `json:"solicitations"`             // 已下发的请求数
+	SendFailures             int64     `json:"send_failures"`             // 下发失败次数
+	Exhausted                int64     `json:"exhausted"`                 // 达到请求上限仍未注册的连接数
+	SolicitedRegistrations   int64     `json:"solicited_registrations"`   // 经主动请求后完成的注册
+	SpontaneousRegistrations int64     `json:"spontaneous_registrations"` // 窗口内设备自行完成的注册
+}
+
+// backfillEntry 单连接的请求状态
+type backfillEntry struct {
+	attempts   int
+	lastAt     time.Time
+	registered bool
+	exhausted  bool
+}
+
+// RegistrationBackfill 启动后注册补齐：窗口内对已上报ICCID但超时未注册的连接限速下发注册请求
+type RegistrationBackfill struct {
+	mutex       sync.Mutex
+	tcpManager  *core.TCPManager
+	send        RegistrationSolicitSender
+	enabled     bool
+	delay       time.Duration
+	window      time.Duration
+	rate        int
+	maxAttempts int
+	retry       time.Duration
+
+	massThreshold int
+	massWindow    time.Duration
+	disconnects   []time.Time
+
+	activatedAt time.Time
+	activeUntil time.Time
+	entries     map[uint64]*backfillEntry
+	stats       RegistrationBackfillStats
+}
+
+// NewRegistrationBackfill 创建注册补齐器，补齐窗口自创建时（进程启动）开始
+func NewRegistrationBackfill(cfg config.RegistrationBackfillConfig, tcpManager *core.TCPManager, send RegistrationSolicitSender) *RegistrationBackfill {
+	b := &RegistrationBackfill{
+		tcpManager:    tcpManager,
+		send:          send,
+		enabled:       cfg.Enabled,
+		delay:         time.Duration(cfg.DelaySeconds) * time.Second,
+		window:        time.Duration(cfg.WindowSeconds) * time.Second,
+		rate:          cfg.RatePerSecond,
+		maxAttempts:   cfg.MaxAttempts,
+		retry:         time.Duration(cfg.RetryIntervalSeconds) * time.Second,
+		massThreshold: cfg.MassDisconnectThreshold,
+		massWindow:    time.Duration(cfg.MassDisconnectWindowSeconds) * time.Second,
+		entries:       make(map[uint64]*backfillEntry),
+	}
+	if b.delay <= 0 {
+		b.delay = defaultBackfillDelay
+	}
+	if b.window <= 0 {
+		b.window = defaultBackfillWindow
+	}
+	if b.rate <= 0 {
+		b.rate = defaultBackfillRatePerSecond
+	}
+	if b.maxAttempts <= 0 {
+		b.maxAttempts = defaultBackfillMaxAttempts
+	}
+	if b.retry <= 0 {
+		b.retry = defaultBackfillRetryInterval
+	}
+	if b.massWindow <= 0 {
+		b.massWindow = defaultMassDisconnectWindow
+	}
+	b.stats.Enabled = b.enabled
+	if b.enabled {
+		b.activateLocked(time.Now(), BackfillTriggerStartup)
+	}
+	return b
+}
+
+// activateLocked 开启（或延长）补齐窗口，已达上限的连接在新窗口内重新获得请求机会
+func (b *RegistrationBackfill) activateLocked(now time.Time, trigger string) {
+	b.activatedAt = now
+	b.activeUntil = now.Add(b.window)
+	b.entries = make(map[uint64]*backfillEntry)
+	b.stats.Activations++
+	b.stats.LastTrigger = trigger
+}
+
+// Activate 手动激活补齐窗口
+func (b *RegistrationBackfill) Activate(now time.Time, trigger string) {
+	if !b.enabled {
+		return
+	}
+	b.mutex.Lock()
+	b.activateLocked(now, trigger)
+	b.mutex.Unlock()
+	logger.WithFields(logrus.Fields{
+		"trigger":     trigger,
+		"activeUntil": now.Add(b.window).Format(constants.TimeFormatDefault),
+	}).Info("📡 注册补齐窗口已激活")
+}
+
+// IsActive 补齐窗口是否处于激活状态
+func (b *RegistrationBackfill) IsActive(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.enabled && now.Before(b.activeUntil)
+}
+
+// NoteDisconnect 记录一次连接断开；统计窗口内断开数达到阈值时视为大规模断连并重新激活补齐窗口
+func (b *RegistrationBackfill) NoteDisconnect(now time.Time) {
+	if !b.enabled || b.massThreshold <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	cutoff := now.Add(-b.massWindow)
+	kept := b.disconnects[:0]
+	for _, t := range b.disconnects {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	b.disconnects = append(kept, now)
+	triggered := len(b.disconnects) >= b.massThreshold
+	if triggered {
+		b.disconnects = nil
+	}
+	b.mutex.Unlock()
+
+	if triggered {
+		logger.WithFields(logrus.Fields{
+			"threshold": b.massThreshold,
+			"window":    b.massWindow.String(),
+		}).Warn("⚠️ 检测到大规模断连，重新激活注册补齐窗口")
+		b.Activate(now, BackfillTriggerMassDisconnect)
+	}
+}
+
+// OnRegistered 连接完成注册：请求过的连接计为主动请求注册，其余窗口内的注册计为自发注册（同一连接只计一次）
+func (b *RegistrationBackfill) OnRegistered(connID uint64, now time.Time) {
+	if !b.enabled {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	entry, exists := b.entries[connID]
+	if exists && entry.registered {
+		return
+	}
+	switch {
+	case exists && entry.attempts > 0:
+		entry.registered = true
+		b.stats.SolicitedRegistrations++
+	case now.Before(b.activeUntil):
+		b.entries[connID] = &backfillEntry{registered: true}
+		b.stats.SpontaneousRegistrations++
+	}
+}
+
+// Sweep 扫描已上报ICCID但未注册的连接，最多下发 budget 个注册请求（最早接入的连接优先），返回下发数量
+func (b *RegistrationBackfill) Sweep(now time.Time, budget int) int {
+	if !b.enabled || b.tcpManager == nil || budget <= 0 {
+		return 0
+	}
+
+	type candidate struct {
+		conn        ziface.IConnection
+		connectedAt time.Time
+	}
+	var candidates []candidate
+
+	b.mutex.Lock()
+	if !now.Before(b.activeUntil) {
+		b.mutex.Unlock()
+		return 0
+	}
+	alive := make(map[uint64]struct{})
+	b.tcpManager.GetConnections().Range(func(key, value interface{}) bool {
+		session := value.(*core.ConnectionSession)
+		alive[session.ConnID] = struct{}{}
+		if session.GetState() != constants.StateICCIDReceived || session.Connection == nil {
+			return true
+		}
+		since := session.ConnectedAt
+		if since.Before(b.activatedAt) {
+			since = b.activatedAt
+		}
+		if now.Sub(since) < b.delay {
+			return true
+		}
+		entry := b.entries[session.ConnID]
+		if entry != nil {
+			if entry.registered || entry.exhausted || now.Sub(entry.lastAt) < b.retry {
+				return true
+			}
+			if entry.attempts >= b.maxAttempts {
+				entry.exhausted = true
+				b.stats.Exhausted++
+				logger.WithFields(logrus.Fields{
+					"connID":   session.ConnID,
+					"attempts": entry.attempts,
+				}).Warn("⚠️ 注册补齐：连接多次请求后仍未注册，停止请求")
+				return true
+			}
+		}
+		candidates = append(candidates, candidate{conn: session.Connection, connectedAt: session.ConnectedAt})
+		return true
+	})
+	// 已关闭的连接不再跟踪
+	for connID := range b.entries {
+		if _, ok := alive[connID]; !ok {
+			delete(b.entries, connID)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].connectedAt.Before(candidates[j].connectedAt) })
+	if len(candidates) > budget {
+		candidates = candidates[:budget]
+	}
+	for _, c := range candidates {
+		entry := b.entries[c.conn.GetConnID()]
+		if entry == nil {
+			entry = &backfillEntry{}
+			b.entries[c.conn.GetConnID()] = entry
+		}
+		entry.attempts++
+		entry.lastAt = now
+	}
+	b.mutex.Unlock()
+
+	// 在锁外下发，避免阻塞注册回调
+	sent, failed := 0, 0
+	for _, c := range candidates {
+		if err := b.send(c.conn); err != nil {
+			failed++
+			logger.WithFields(logrus.Fields{
+				"connID": c.conn.GetConnID(),
+				"error":  err.Error(),
+			}).Warn("注册补齐：下发注册请求失败")
+			continue
+		}
+		sent++
+	}
+
+	b.mutex.Lock()
+	b.stats.Solicitations += int64(sent)
+	b.stats.SendFailures += int64(failed)
+	b.mutex.Unlock()
+
+	if len(candidates) > 0 {
+		logger.WithFields(logrus.Fields{
+			"sent":   sent,
+			"failed": failed,
+			"budget": budget,
+		}).Info("📡 注册补齐：已向未注册连接下发注册请求")
+	}
+	return sent
+}
+
+// Stats 获取注册补齐统计
+func (b *RegistrationBackfill) Stats() RegistrationBackfillStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	stats := b.stats
+	stats.Active = b.enabled && time.Now().Before(b.activeUntil)
+	stats.ActiveUntil = b.activeUntil
+	for _, entry := range b.entries {
+		if entry.attempts > 0 && !entry.registered && !entry.exhausted {
+			stats.Pending++
+		}
+	}
+	return stats
+}
+
+// startWorker 按每秒限额执行补齐扫描
+func (b *RegistrationBackfill) startWorker() {
+	if !b.enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(registrationBackfillSweepInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			b.Sweep(now, b.rate)
+		}
+	}()
+}
+
+// GetRegistrationBackfill 获取注册补齐器
+func (g *DeviceGateway) GetRegistrationBackfill() *RegistrationBackfill {
+	return g.registrationBackfill
+}
+
+// observeRegistration 设备注册后按所在连接记录补齐统计
+func (g *DeviceGateway) observeRegistration(deviceID string) {
+	if g.registrationBackfill == nil || g.tcpManager == nil {
+		return
+	}
+	if session, ok := g.tcpManager.GetSessionByDeviceID(deviceID); ok {
+		g.registrationBackfill.OnRegistered(session.ConnID, time.Now())
+	}
+}
+
+// sendRegistrationSolicit 向未注册连接下发0x81：设备未注册前无法走设备级发送路径，直接构包经统一发送器下发
+func (g *DeviceGateway) sendRegistrationSolicit(conn ziface.IConnection) error {
+	physicalID, _, err := utils.GetPhysicalIDFromConnection(conn)
+	if err != nil {
+		physicalID = SolicitUnknownPhysicalID
+	}
+	messageID := pkg.Protocol.GetNextMessageID()
+	packet := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(physicalID, messageID, constants.CmdNetworkStatus, nil)
+	if err := pkg.Protocol.SendDNYPacket(conn, packet); err != nil {
+		return fmt.Errorf("发送注册请求失败: %w", err)
+	}
+	logger.WithFields(logrus.Fields{
+		"connID":     conn.GetConnID(),
+		"physicalID": utils.FormatPhysicalID(physicalID),
+		"msgID":      fmt.Sprintf("0x%04X", messageID),
+		"packetHex":  fmt.Sprintf("%X", packet),
+	}).Debug("注册补齐：已下发0x81注册请求")
+	return nil
+}
@@ -1,9 +1,13 @@
 package gateway
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
@@ -13,52 +17,144 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ErrReadOnlyReplica 只读副本实例不下发命令
+var ErrReadOnlyReplica = errors.New("只读副本实例不下发命令")
+
+// SetReadOnly 设置只读副本模式：开启后统一发送路径拒绝下发命令
+func (g *DeviceGateway) SetReadOnly(readOnly bool) {
+	g.readOnly.Store(readOnly)
+}
+
+// IsReadOnly 是否处于只读副本模式
+func (g *DeviceGateway) IsReadOnly() bool {
+	return g.readOnly.Load()
+}
+
 // SendCommandToDevice 发送命令到指定设备（统一发送路径）
 func (g *DeviceGateway) SendCommandToDevice(deviceID string, command byte, data []byte) error {
+	return g.SendCommandToDeviceWithCorrelation("", deviceID, command, data)
+}
+
+// SendCommandToDeviceWithCorrelation 发送命令到指定设备，并将链路追踪ID写入命令条目与通信日志
+func (g *DeviceGateway) SendCommandToDeviceWithCorrelation(correlationID string, deviceID string, command byte, data []byte) error {
+	_, err := g.SendCommandToDeviceWithOptions(context.Background(), deviceID, command, data, network.CommandOptions{CorrelationID: correlationID})
+	return err
+}
+
+// resendCommandsOnReconnect 设备重新注册后，经新连接重发断线前未应答且允许重发的命令
+func (g *DeviceGateway) resendCommandsOnReconnect(deviceID string) {
 	if g.tcpManager == nil {
-		return fmt.Errorf("TCP管理器未初始化")
+		return
 	}
+	physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID)
+	if err != nil {
+		return
+	}
+	cmdMgr := network.GetCommandManager()
+	if cmdMgr.ResendQueueLength(physicalID) == 0 {
+		return
+	}
+	conn, exists := g.tcpManager.GetConnectionByDeviceID(deviceID)
+	if !exists {
+		return
+	}
+	cmdMgr.ResendOnReconnect(physicalID, conn)
+}
 
-	// AP3000 发送节流：同设备命令间隔≥0.5秒
-	g.throttleMu.Lock()
-	if last, ok := g.lastSendByDevice[deviceID]; ok {
-		if wait := 500*time.Millisecond - time.Since(last); wait > 0 {
-			g.throttleMu.Unlock()
-			time.Sleep(wait)
-			g.throttleMu.Lock()
+// reportPreSendOutcome 未进入命令管理器即失败的命令上报结果（SLA统计）
+func reportPreSendOutcome(deviceID string, command byte, correlationID string, outcome network.CommandOutcome, reason string) {
+	network.ReportCommandOutcome(network.CommandResult{
+		DeviceID:      deviceID,
+		Command:       command,
+		CorrelationID: correlationID,
+		Outcome:       outcome,
+		Reason:        reason,
+	})
+}
+
+// SendCommandToDeviceWithOptions 按命令选项发送命令，返回可同步等待应答的命令句柄；ctx 限定在设备组出站队列中等待写入的时间
+// 设备断开时句柄立即以 DEVICE_DISCONNECTED 结束；ResendOnReconnect=true 时设备在窗口内重新注册会自动重发
+func (g *DeviceGateway) SendCommandToDeviceWithOptions(ctx context.Context, deviceID string, command byte, data []byte, opts network.CommandOptions) (*network.CommandHandle, error) {
+	handle, _, err := g.sendCommand(ctx, deviceID, command, data, opts, nil)
+	return handle, err
+}
+
+// SendCommandAndWaitResponse 发送命令并同步等待设备的应答帧（按物理ID+消息ID+命令码匹配），返回消息ID与应答；
+// 超时返回 ErrCommandTimeout 错误码的 *AppError，消息ID仍有效，调用方可据此事后关联；排队写入同样受 timeout 限制
+func (g *DeviceGateway) SendCommandAndWaitResponse(ctx context.Context, deviceID string, command byte, data []byte, opts network.CommandOptions, timeout time.Duration) (uint16, *network.CommandResponse, error) {
+	tracker := network.GetCommandResponseTracker()
+	var waiter *network.ResponseWaiter
+	queueCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		queueCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	handle, messageID, err := g.sendCommand(queueCtx, deviceID, command, data, opts, func(physicalID uint32, messageID uint16) error {
+		w, err := tracker.Expect(physicalID, messageID, command)
+		waiter = w
+		return err
+	})
+	if err != nil {
+		if waiter != nil {
+			waiter.Cancel()
 		}
+		return messageID, nil, err
 	}
-	g.lastSendByDevice[deviceID] = time.Now()
-	g.throttleMu.Unlock()
+	resp, err := waiter.Wait(handle, timeout)
+	return messageID, resp, err
+}
+
+// sendCommand 统一发送路径：构包并经设备组出站队列写入，返回命令句柄与消息ID；
+// beforeWrite 非nil时在写入设备前调用（如登记同步应答），返回错误则放弃写入
+func (g *DeviceGateway) sendCommand(ctx context.Context, deviceID string, command byte, data []byte, opts network.CommandOptions, beforeWrite func(physicalID uint32, messageID uint16) error) (*network.CommandHandle, uint16, error) {
+	correlationID := opts.CorrelationID
+	if g.readOnly.Load() {
+		return nil, 0, ErrReadOnlyReplica
+	}
+	if g.tcpManager == nil {
+		return nil, 0, fmt.Errorf("TCP管理器未初始化")
+	}
+
+	g.throttleSend(deviceID)
 
 	// 标准化设备ID
 	processor := &utils.DeviceIDProcessor{}
 	stdDeviceID, err := processor.SmartConvertDeviceID(deviceID)
 	if err != nil {
-		return fmt.Errorf("设备ID解析失败: %v", err)
+		return nil, 0, fmt.Errorf("设备ID解析失败: %v", err)
 	}
 
 	conn, exists := g.tcpManager.GetConnectionByDeviceID(stdDeviceID)
 	if !exists {
-		return fmt.Errorf("设备 %s 不在线", stdDeviceID)
+		reportPreSendOutcome(stdDeviceID, command, correlationID, network.OutcomeDeviceOffline, "设备不在线")
+		return nil, 0, fmt.Errorf("设备 %s 不在线", stdDeviceID)
 	}
 
 	// 验证设备会话存在
 	_, sessionExists := g.tcpManager.GetSessionByDeviceID(stdDeviceID)
 	if !sessionExists {
-		return fmt.Errorf("设备会话不存在")
+		reportPreSendOutcome(stdDeviceID, command, correlationID, network.OutcomeDeviceOffline, "设备会话不存在")
+		return nil, 0, fmt.Errorf("设备会话不存在")
 	}
 
 	// 设备ID→PhysicalID
 	expectedPhysicalID, err := utils.ParseDeviceIDToPhysicalID(stdDeviceID)
 	if err != nil {
-		return fmt.Errorf("设备ID格式错误: %v", err)
+		return nil, 0, fmt.Errorf("设备ID格式错误: %v", err)
 	}
 
 	// 从设备信息中获取并校验PhysicalID
 	device, deviceExists := g.tcpManager.GetDeviceByID(stdDeviceID)
 	if !deviceExists {
-		return fmt.Errorf("设备 %s 不存在", stdDeviceID)
+		reportPreSendOutcome(stdDeviceID, command, correlationID, network.OutcomeDeviceOffline, "设备不存在")
+		return nil, 0, fmt.Errorf("设备 %s 不存在", stdDeviceID)
+	}
+
+	// 固件能力兜底：不下发设备固件不支持的命令（API层已预校验，这里覆盖内部调用方）
+	if err := g.CheckCommandSupported(stdDeviceID, command); err != nil {
+		reportPreSendOutcome(stdDeviceID, command, correlationID, network.OutcomeDeviceRejected, err.Error())
+		return nil, 0, err
 	}
 
 	sessionPhysicalID := device.PhysicalID
@@ -88,40 +184,113 @@ func (g *DeviceGateway) SendCommandToDevice(deviceID string, command byte, data
 	// 发送前校验
 	if err := protocol.ValidateUnifiedDNYPacket(dnyPacket); err != nil {
 		logger.WithFields(logrus.Fields{
-			"deviceID":   stdDeviceID,
-			"physicalID": utils.FormatPhysicalID(physicalID),
-			"messageID":  fmt.Sprintf("0x%04X", messageID),
-			"command":    fmt.Sprintf("0x%02X", command),
-			"reason":     err.Error(),
+			"correlationID": correlationID,
+			"deviceID":      stdDeviceID,
+			"physicalID":    utils.FormatPhysicalID(physicalID),
+			"messageID":     fmt.Sprintf("0x%04X", messageID),
+			"command":       dny_protocol.CommandLabel(command),
+			"reason":        err.Error(),
 		}).Error("❌ DNY数据包校验失败，拒绝发送")
-		return fmt.Errorf("DNY包校验失败: %w", err)
+		reportPreSendOutcome(stdDeviceID, command, correlationID, network.OutcomeGatewayError, err.Error())
+		return nil, messageID, fmt.Errorf("DNY包校验失败: %w", err)
 	}
 
-	// 注册命令到 CommandManager（用于超时与重试管理）
+	// 经设备组出站队列写入：同一连接上的命令串行写入，需要应答的命令确认（或超时）后才写入下一条
+	var handle *network.CommandHandle
 	cmdMgr := network.GetCommandManager()
-	if cmdMgr != nil {
-		cmdMgr.RegisterCommand(conn, physicalID, messageID, uint8(command), data)
-	}
-
-	// 通过 UnifiedSender 发送（保持唯一发送路径）
-	if err := pkg.Protocol.SendDNYPacket(conn, dnyPacket); err != nil {
-		return fmt.Errorf("发送命令失败: %v", err)
+	err = g.tcpManager.EnqueueCommand(ctx, stdDeviceID, command, func(queued ziface.IConnection) (core.CommandWait, error) {
+		conn = queued
+		if beforeWrite != nil {
+			if err := beforeWrite(physicalID, messageID); err != nil {
+				return nil, err
+			}
+		}
+		// 注册命令到 CommandManager（用于超时与重试管理）
+		if cmdMgr != nil {
+			handle = cmdMgr.RegisterCommandWithOptions(conn, physicalID, messageID, uint8(command), data, opts)
+		}
+		// 通过 UnifiedSender 发送（保持唯一发送路径）
+		if err := pkg.Protocol.SendDNYPacket(conn, dnyPacket); err != nil {
+			if handle != nil {
+				cmdMgr.MarkSendFailed(handle, err)
+			}
+			return nil, err
+		}
+		if handle == nil {
+			return nil, nil
+		}
+		return handle.Wait, nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"correlationID": correlationID,
+			"deviceID":      stdDeviceID,
+			"msgID":         fmt.Sprintf("0x%04X", messageID),
+			"cmd":           fmt.Sprintf("0x%02X", command),
+			"error":         err.Error(),
+		}).Error("DNY命令发送失败")
+		return nil, messageID, fmt.Errorf("发送命令失败: %w", err)
 	}
 
 	// 记录命令元数据
 	g.tcpManager.RecordDeviceCommand(stdDeviceID, command, len(data))
 
+	// 通信日志：与业务日志共用同一链路追踪ID，便于单次grep还原完整链路
+	logger.LogSendDataWithCorrelation(correlationID, stdDeviceID, command, messageID, conn.GetConnID(), len(data), "DNY命令下发")
+
 	// 成功日志（结构化）：符合 AP3000 日志规范
 	logger.WithFields(logrus.Fields{
-		"deviceID":   stdDeviceID,
-		"physicalID": utils.FormatPhysicalID(physicalID),
-		"msgID":      fmt.Sprintf("0x%04X", messageID),
-		"cmd":        fmt.Sprintf("0x%02X", command),
-		"dataHex":    fmt.Sprintf("%X", data),
-		"packetHex":  fmt.Sprintf("%X", dnyPacket),
+		"correlationID": correlationID,
+		"deviceID":      stdDeviceID,
+		"physicalID":    utils.FormatPhysicalID(physicalID),
+		"msgID":         fmt.Sprintf("0x%04X", messageID),
+		"cmd":           fmt.Sprintf("0x%02X", command),
+		"dataHex":       fmt.Sprintf("%X", data),
+		"packetHex":     fmt.Sprintf("%X", dnyPacket),
 	}).Info("DNY命令发送成功")
 
-	return nil
+	return handle, messageID, nil
+}
+
+// writeQueuedCommand 设备组出站队列的默认命令写入器（TCPManager.SendCommandToDevice 使用）：构包、注册应答跟踪并经统一发送器写入
+func (g *DeviceGateway) writeQueuedCommand(conn ziface.IConnection, deviceID string, command byte, data []byte) (core.CommandWait, error) {
+	physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("设备ID格式错误: %v", err)
+	}
+	messageID := pkg.Protocol.GetNextMessageID()
+	packet := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(physicalID, messageID, command, data)
+	cmdMgr := network.GetCommandManager()
+	var handle *network.CommandHandle
+	if cmdMgr != nil {
+		handle = cmdMgr.RegisterCommandWithOptions(conn, physicalID, messageID, command, data, network.CommandOptions{})
+	}
+	if err := pkg.Protocol.SendDNYPacket(conn, packet); err != nil {
+		if handle != nil {
+			cmdMgr.MarkSendFailed(handle, err)
+		}
+		return nil, fmt.Errorf("发送命令失败: %w", err)
+	}
+	g.tcpManager.RecordDeviceCommand(deviceID, command, len(data))
+	logger.LogSendDataWithCorrelation("", deviceID, command, messageID, conn.GetConnID(), len(data), "DNY命令下发")
+	if handle == nil {
+		return nil, nil
+	}
+	return handle.Wait, nil
+}
+
+// throttleSend AP3000 发送节流：同设备命令间隔≥0.5秒
+func (g *DeviceGateway) throttleSend(deviceID string) {
+	g.throttleMu.Lock()
+	if last, ok := g.lastSendByDevice[deviceID]; ok {
+		if wait := 500*time.Millisecond - time.Since(last); wait > 0 {
+			g.throttleMu.Unlock()
+			time.Sleep(wait)
+			g.throttleMu.Lock()
+		}
+	}
+	g.lastSendByDevice[deviceID] = time.Now()
+	g.throttleMu.Unlock()
 }
 
 // fixDeviceGroupPhysicalID 修复设备组中Device的PhysicalID（私有，聚合到发送链路）
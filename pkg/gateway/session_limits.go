@@ -0,0 +1,295 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrSessionLimitNotFound 设备未单独配置并发上限
+var ErrSessionLimitNotFound = errors.New("设备未配置并发会话上限")
+
+// 并发上限来源
+const (
+	SessionLimitSourceDevice  = "device"  // 单设备配置
+	SessionLimitSourceDefault = "default" // 全局默认
+)
+
+// SessionLimit 单设备并发充电会话上限（同一设备同时充电、待启动或排队的端口数）
+type SessionLimit struct {
+	DeviceID      string `json:"deviceId"`
+	MaxConcurrent int    `json:"maxConcurrent"` // 同时进行的会话数上限，0表示不限制（覆盖全局默认）
+	// 达到上限后仍可降功率接入的会话数与其过载功率上限(瓦)；仅在智能降功率启用时生效
+	ReducedPowerSlots int       `json:"reducedPowerSlots,omitempty"`
+	ReducedPowerW     int       `json:"reducedPowerW,omitempty"`
+	Reason            string    `json:"reason,omitempty"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// SessionLimitStatus 设备当前生效的上限与占用端口（设备详情展示）
+type SessionLimitStatus struct {
+	SessionLimit
+	Source      string `json:"source"`      // device | default
+	ActivePorts []int  `json:"activePorts"` // 进行中（充电/待启动/排队）与正在下发开始充电的端口
+	Available   int    `json:"available"`   // 剩余满功率名额
+}
+
+// SessionLimitError 设备并发会话已达上限
+type SessionLimitError struct {
+	DeviceID      string
+	MaxConcurrent int
+	ActivePorts   []int
+}
+
+func (e *SessionLimitError) Error() string {
+	return fmt.Sprintf("设备 %s 并发充电会话已达上限 %d，进行中的端口: %v", e.DeviceID, e.MaxConcurrent, e.ActivePorts)
+}
+
+// SessionAdmission 开始充电前的并发名额；下发完成（订单已创建）或失败后调用 Release 归还预占
+type SessionAdmission struct {
+	Reduced        bool // 超出满功率名额，以降功率接入
+	OverloadPowerW int  // 降功率接入时下发的过载功率(瓦)
+	release        func()
+}
+
+// Release 归还预占的名额（重复调用无副作用）
+func (a *SessionAdmission) Release() {
+	if a != nil && a.release != nil {
+		a.release()
+		a.release = nil
+	}
+}
+
+// SessionLimiter 设备并发会话上限（内存，配置了文件路径时每次变更整体写入JSON文件）。
+// 校验与预占在同一把锁内完成，同时到达的两个开始充电请求不会同时占用最后一个名额
+type SessionLimiter struct {
+	mutex      sync.Mutex
+	defaultMax int
+	limits     map[string]SessionLimit
+	pending    map[string]map[int]bool // 已通过校验、订单尚未创建的端口
+	path       string
+
+	activePorts    func(deviceID string) []int // 订单管理器中进行中的端口
+	reducedAllowed func() bool                 // 是否允许降功率接入（智能降功率已启用）
+}
+
+// NewSessionLimiter 创建并发上限，path为空时仅保存在内存
+func NewSessionLimiter(cfg config.SessionLimitsConfig, activePorts func(deviceID string) []int, reducedAllowed func() bool) *SessionLimiter {
+	l := &SessionLimiter{
+		defaultMax:     cfg.DefaultMaxConcurrent,
+		limits:         make(map[string]SessionLimit),
+		pending:        make(map[string]map[int]bool),
+		path:           cfg.FilePath,
+		activePorts:    activePorts,
+		reducedAllowed: reducedAllowed,
+	}
+	if err := l.load(); err != nil {
+		logger.WithFields(logrus.Fields{"path": cfg.FilePath, "error": err.Error()}).Warn("加载并发会话上限文件失败，仅使用默认上限")
+	}
+	return l
+}
+
+// DefaultMax 全局默认上限（0表示不限制）
+func (l *SessionLimiter) DefaultMax() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.defaultMax
+}
+
+// List 已单独配置的设备上限（按设备ID排序）
+func (l *SessionLimiter) List() []SessionLimit {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	list := make([]SessionLimit, 0, len(l.limits))
+	for _, limit := range l.limits {
+		list = append(list, limit)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// ValidateSessionLimit 校验设备上限参数
+func ValidateSessionLimit(limit SessionLimit) error {
+	if limit.DeviceID == "" {
+		return fmt.Errorf("设备ID不能为空")
+	}
+	if limit.MaxConcurrent < 0 || limit.ReducedPowerSlots < 0 || limit.ReducedPowerW < 0 {
+		return fmt.Errorf("上限与降功率参数不能为负数")
+	}
+	if limit.ReducedPowerW > 0xFFFF {
+		return fmt.Errorf("降功率上限超出范围：%d", limit.ReducedPowerW)
+	}
+	if (limit.ReducedPowerSlots > 0) != (limit.ReducedPowerW > 0) {
+		return fmt.Errorf("reducedPowerSlots 与 reducedPowerW 需同时配置")
+	}
+	return nil
+}
+
+// Set 设置设备上限，立即对后续的开始充电生效（已进行的会话不受影响）
+func (l *SessionLimiter) Set(limit SessionLimit) (SessionLimit, error) {
+	if err := ValidateSessionLimit(limit); err != nil {
+		return limit, err
+	}
+	limit.UpdatedAt = time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	previous, existed := l.limits[limit.DeviceID]
+	l.limits[limit.DeviceID] = limit
+	if err := l.saveLocked(); err != nil {
+		if existed {
+			l.limits[limit.DeviceID] = previous
+		} else {
+			delete(l.limits, limit.DeviceID)
+		}
+		return limit, err
+	}
+	return limit, nil
+}
+
+// Delete 删除设备上限，恢复使用全局默认
+func (l *SessionLimiter) Delete(deviceID string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	previous, ok := l.limits[deviceID]
+	if !ok {
+		return ErrSessionLimitNotFound
+	}
+	delete(l.limits, deviceID)
+	if err := l.saveLocked(); err != nil {
+		l.limits[deviceID] = previous
+		return err
+	}
+	return nil
+}
+
+// Status 设备当前生效的上限与占用端口；未配置且默认不限制时返回false
+func (l *SessionLimiter) Status(deviceID string) (SessionLimitStatus, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	limit, source := l.effectiveLocked(deviceID)
+	if limit.MaxConcurrent <= 0 && source == SessionLimitSourceDefault {
+		return SessionLimitStatus{}, false
+	}
+	active := l.occupiedLocked(deviceID, 0)
+	status := SessionLimitStatus{SessionLimit: limit, Source: source, ActivePorts: active}
+	if limit.MaxConcurrent > len(active) {
+		status.Available = limit.MaxConcurrent - len(active)
+	}
+	return status, true
+}
+
+// Admit 开始充电前校验并预占名额：未达上限时满功率接入；达到上限但配置了降功率名额且智能降功率已启用时降功率接入；
+// 否则返回 *SessionLimitError（附进行中的端口）。同一端口重复下发不重复计数
+func (l *SessionLimiter) Admit(deviceID string, port int) (*SessionAdmission, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	limit, _ := l.effectiveLocked(deviceID)
+	if limit.MaxConcurrent <= 0 {
+		return &SessionAdmission{}, nil
+	}
+	active := l.occupiedLocked(deviceID, port)
+	admission := &SessionAdmission{}
+	switch {
+	case len(active) < limit.MaxConcurrent:
+	case len(active) < limit.MaxConcurrent+limit.ReducedPowerSlots && l.reducedAllowed != nil && l.reducedAllowed():
+		admission.Reduced = true
+		admission.OverloadPowerW = limit.ReducedPowerW
+	default:
+		return nil, &SessionLimitError{DeviceID: deviceID, MaxConcurrent: limit.MaxConcurrent, ActivePorts: active}
+	}
+
+	if l.pending[deviceID] == nil {
+		l.pending[deviceID] = make(map[int]bool)
+	}
+	l.pending[deviceID][port] = true
+	admission.release = func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		delete(l.pending[deviceID], port)
+		if len(l.pending[deviceID]) == 0 {
+			delete(l.pending, deviceID)
+		}
+	}
+	return admission, nil
+}
+
+// effectiveLocked 设备生效的上限，调用方持有锁
+func (l *SessionLimiter) effectiveLocked(deviceID string) (SessionLimit, string) {
+	if limit, ok := l.limits[deviceID]; ok {
+		return limit, SessionLimitSourceDevice
+	}
+	return SessionLimit{DeviceID: deviceID, MaxConcurrent: l.defaultMax}, SessionLimitSourceDefault
+}
+
+// occupiedLocked 占用名额的端口（进行中订单与预占端口，排除 exclude），调用方持有锁
+func (l *SessionLimiter) occupiedLocked(deviceID string, exclude int) []int {
+	seen := make(map[int]bool)
+	if l.activePorts != nil {
+		for _, port := range l.activePorts(deviceID) {
+			seen[port] = true
+		}
+	}
+	for port := range l.pending[deviceID] {
+		seen[port] = true
+	}
+	delete(seen, exclude)
+	ports := make([]int, 0, len(seen))
+	for port := range seen {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+func (l *SessionLimiter) load() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取并发会话上限文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.limits); err != nil {
+		return fmt.Errorf("解析并发会话上限文件失败: %w", err)
+	}
+	return nil
+}
+
+// saveLocked 写入上限文件（先写临时文件再重命名），调用方持有锁
+func (l *SessionLimiter) saveLocked() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.limits, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(l.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建并发会话上限目录失败: %w", err)
+		}
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入并发会话上限文件失败: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// GetSessionLimiter 获取设备并发会话上限
+func (g *DeviceGateway) GetSessionLimiter() *SessionLimiter {
+	return g.sessionLimits
+}
@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+)
+
+// 富化文档中可能缺失的上下文（列入 missing，对应字段为 null）
+const (
+	EnrichmentMissingSession  = "session"  // 台账中无该订单的会话记录（孤立结算）
+	EnrichmentMissingDevice   = "device"   // 设备不在线，ICCID/固件版本未知
+	EnrichmentMissingAsset    = "asset"    // 无资产映射，租户/资产编码/站点未知
+	EnrichmentMissingMetering = "metering" // 无该订单的功率心跳样本，无法做积分对比
+)
+
+// SettledCharge 解码后的结算字段（0x03）
+type SettledCharge struct {
+	OrderNo    string    `json:"orderNo"`
+	DeviceID   string    `json:"device_id"`
+	Port       int       `json:"port"` // 协议端口(从0开始)
+	CardNumber string    `json:"card_number"`
+	EnergyWh   uint32    `json:"energy_wh"`
+	ChargeFee  uint32    `json:"charge_fee"`  // 分
+	ServiceFee uint32    `json:"service_fee"` // 分
+	TotalFee   uint32    `json:"total_fee"`   // 分
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	StopReason uint8     `json:"stop_reason"`
+	ReceivedAt time.Time `json:"received_at"`
+	Replayed   bool      `json:"replayed"`
+}
+
+// EnrichedSession 结算对应的会话记录
+type EnrichedSession struct {
+	StartTime                time.Time  `json:"start_time"`
+	Mode                     uint8      `json:"mode"` // 0=按时间 1=按电量
+	RequestedValue           uint16     `json:"requested_value"`
+	RequestedDurationSeconds *int       `json:"requested_duration_seconds"` // 按电量模式为 null
+	PromotionTag             *string    `json:"promotion_tag"`              // 无促销为 null
+	QueuedAt                 *time.Time `json:"queued_at"`                  // 未经设备侧排队为 null
+	Status                   string     `json:"status"`                     // 结算时的最后已知状态
+}
+
+// EnrichedDeviceContext 设备上下文，无法获取的字段为 null
+type EnrichedDeviceContext struct {
+	DeviceID        string  `json:"device_id"`
+	ICCID           *string `json:"iccid"`
+	FirmwareVersion *string `json:"firmware_version"`
+	TenantID        *string `json:"tenant_id"`
+	AssetCode       *string `json:"asset_code"`
+	StationID       *string `json:"station_id"`
+}
+
+// EnrichedSettlement 富化结算文档：一次完成的充电对应一条自包含消息，计费系统无需再关联设备接口。
+// 缺失的部分以 null 表示并列入 missing，complete 为 true 表示会话、设备、资产与计量对比均已取得
+type EnrichedSettlement struct {
+	Settlement  SettledCharge         `json:"settlement"`
+	Session     *EnrichedSession      `json:"session"`
+	Device      EnrichedDeviceContext `json:"device"`
+	Metering    *MeteringComparison   `json:"metering"`
+	Complete    bool                  `json:"complete"`
+	Missing     []string              `json:"missing"`
+	GeneratedAt time.Time             `json:"generated_at"`
+}
+
+// ToMap 转为通知负载（保留 null 字段）
+func (e *EnrichedSettlement) ToMap() map[string]interface{} {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil
+	}
+	return data
+}
+
+// EnrichSettlement 组装富化结算文档：会话取自对账台账（重启后仍可用），设备上下文取自在线设备与资产映射，
+// 计量对比取出并清除该端口的功率积分，因此每笔结算只应调用一次
+func (g *DeviceGateway) EnrichSettlement(settled SettledCharge) *EnrichedSettlement {
+	doc := &EnrichedSettlement{
+		Settlement:  settled,
+		Device:      EnrichedDeviceContext{DeviceID: settled.DeviceID},
+		Missing:     []string{},
+		GeneratedAt: time.Now(),
+	}
+
+	if session, ok := reconcile.GetGlobalReconciler().Ledger().Session(settled.OrderNo); ok {
+		doc.Session = newEnrichedSession(session)
+	} else {
+		doc.Missing = append(doc.Missing, EnrichmentMissingSession)
+	}
+
+	deviceFound := false
+	if g.tcpManager != nil {
+		if device, ok := g.tcpManager.GetDeviceByID(settled.DeviceID); ok {
+			device.RLock()
+			iccid, version := device.ICCID, device.DeviceVersion
+			device.RUnlock()
+			doc.Device.ICCID = optionalString(iccid)
+			doc.Device.FirmwareVersion = optionalString(version)
+			deviceFound = true
+		}
+	}
+	if !deviceFound {
+		doc.Missing = append(doc.Missing, EnrichmentMissingDevice)
+	}
+
+	if info, ok := asset.Lookup(settled.DeviceID); ok && !info.IsEmpty() {
+		doc.Device.TenantID = optionalString(info.TenantID)
+		doc.Device.AssetCode = optionalString(info.AssetCode)
+		doc.Device.StationID = optionalString(info.StationID)
+	} else {
+		doc.Missing = append(doc.Missing, EnrichmentMissingAsset)
+	}
+
+	if g.metering != nil {
+		doc.Metering = g.metering.Take(settled.DeviceID, settled.Port, settled.OrderNo, settled.EnergyWh)
+	}
+	if doc.Metering == nil {
+		doc.Missing = append(doc.Missing, EnrichmentMissingMetering)
+	}
+
+	doc.Complete = len(doc.Missing) == 0
+	return doc
+}
+
+// GetMeteringTracker 获取计量积分跟踪器
+func (g *DeviceGateway) GetMeteringTracker() *MeteringTracker {
+	return g.metering
+}
+
+func newEnrichedSession(s reconcile.SessionRecord) *EnrichedSession {
+	session := &EnrichedSession{
+		StartTime:      s.StartTime,
+		Mode:           s.Mode,
+		RequestedValue: s.Value,
+		PromotionTag:   optionalString(s.PromotionTag),
+		QueuedAt:       s.QueuedAt,
+		Status:         s.Status,
+	}
+	if s.Mode == 0 {
+		seconds := int(s.Value)
+		session.RequestedDurationSeconds = &seconds
+	}
+	return session
+}
+
+// optionalString 空串转为 null
+func optionalString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
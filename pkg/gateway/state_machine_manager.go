@@ -121,6 +121,7 @@ func (smm *StateMachineManager) GetStateMachineStats() map[string]interface{} {
 			"completed":      0,
 			"fault":          0,
 			"emergency_stop": 0,
+			"queued":         0,
 		},
 		"by_device": make(map[string]int),
 	}
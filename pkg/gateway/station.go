@@ -0,0 +1,475 @@
+package gateway
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDegradedOfflineFraction = 0.5
+	defaultStationRemapInterval    = 5 * time.Minute
+	defaultPortStaleWindow         = 3 * time.Minute
+)
+
+// StationSummary 站点汇总
+type StationSummary struct {
+	StationID       string  `json:"stationId"`
+	DeviceCount     int     `json:"deviceCount"`
+	OnlineCount     int     `json:"onlineCount"`
+	OfflineCount    int     `json:"offlineCount"`
+	TotalPorts      int     `json:"totalPorts"`
+	PortsCharging   int     `json:"portsCharging"`
+	PortsIdle       int     `json:"portsIdle"`
+	PortsFaulted    int     `json:"portsFaulted"`
+	PowerW          float64 `json:"powerW"`          // 当前总功率(瓦)，仅统计在线设备充电中的端口
+	OfflineFraction float64 `json:"offlineFraction"` // 离线设备占比
+	Degraded        bool    `json:"degraded"`        // 离线占比超过阈值
+}
+
+// StationDevice 站点下的设备明细
+type StationDevice struct {
+	DeviceID      string    `json:"deviceId"`
+	Online        bool      `json:"online"`
+	TotalPorts    int       `json:"totalPorts"`
+	PortsCharging int       `json:"portsCharging"`
+	PortsIdle     int       `json:"portsIdle"`
+	PortsFaulted  int       `json:"portsFaulted"`
+	PowerW        float64   `json:"powerW"`
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+// PortState 端口最近上报的状态与功率
+type PortState struct {
+	Port      int       `json:"port"` // 业务端口(从1开始)
+	Status    uint8     `json:"status"`
+	PowerW    float64   `json:"powerW"`
+	VoltageV  float64   `json:"voltageV,omitempty"` // 仅旧格式功率心跳携带电压
+	EnergyWh  uint32    `json:"energyWh"`           // 进行中订单的累计电量
+	OrderNo   string    `json:"orderNo,omitempty"`  // 设备上报的订单编号
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PortSample 功率心跳(0x06)上报的单端口数据
+type PortSample struct {
+	Status   uint8
+	PowerW   float64
+	VoltageV float64
+	EnergyWh uint32
+	OrderNo  string
+}
+
+// StationDetail 站点详情（汇总 + 设备明细）
+type StationDetail struct {
+	StationSummary
+	Devices []StationDevice `json:"devices"`
+}
+
+// portClass 端口状态分类
+type portClass int
+
+const (
+	portClassIdle portClass = iota
+	portClassCharging
+	portClassFaulted
+)
+
+// classifyPortStatus 协议端口状态 → 分类：充电中/浮充为充电，空闲/插枪未充/已充满为空闲，其余为故障
+func classifyPortStatus(status uint8) portClass {
+	switch status {
+	case 0x01, 0x05:
+		return portClassCharging
+	case 0x00, 0x02, 0x03:
+		return portClassIdle
+	default:
+		return portClassFaulted
+	}
+}
+
+type stationPort struct {
+	status    uint8
+	powerW    float64
+	voltageV  float64
+	energyWh  uint32
+	orderNo   string
+	updatedAt time.Time
+}
+
+type stationDeviceState struct {
+	stationID string
+	online    bool
+	ports     map[int]stationPort // 业务端口(从1开始)
+	lastSeen  time.Time
+}
+
+type stationRollup struct {
+	devices, online              int
+	ports, charging, idle, fault int
+	powerW                       float64
+	members                      map[string]struct{}
+}
+
+// StationAggregator 站点聚合：按设备事件（注册/断开/端口状态/功率心跳）增量维护站点汇总，查询时不扫描全部设备。
+// 离线设备只计入设备数与端口数，其端口状态与功率视为未知不参与统计；未映射站点的设备不计入任何站点
+type StationAggregator struct {
+	degradedFraction float64
+	remapInterval    time.Duration
+	portStaleWindow  time.Duration
+	lookup           func(deviceID string) (asset.AssetInfo, bool)
+
+	mu       sync.RWMutex
+	devices  map[string]*stationDeviceState
+	stations map[string]*stationRollup
+}
+
+// NewStationAggregator 创建站点聚合器
+func NewStationAggregator(cfg config.StationsConfig) *StationAggregator {
+	a := &StationAggregator{
+		degradedFraction: cfg.DegradedOfflineFraction,
+		remapInterval:    time.Duration(cfg.RemapIntervalSeconds) * time.Second,
+		portStaleWindow:  time.Duration(cfg.PortStaleSeconds) * time.Second,
+		lookup:           asset.Lookup,
+		devices:          make(map[string]*stationDeviceState),
+		stations:         make(map[string]*stationRollup),
+	}
+	if a.degradedFraction <= 0 {
+		a.degradedFraction = defaultDegradedOfflineFraction
+	}
+	if a.remapInterval <= 0 {
+		a.remapInterval = defaultStationRemapInterval
+	}
+	if a.portStaleWindow <= 0 {
+		a.portStaleWindow = defaultPortStaleWindow
+	}
+	return a
+}
+
+// SetLookup 替换站点映射查询（测试使用）
+func (a *StationAggregator) SetLookup(lookup func(deviceID string) (asset.AssetInfo, bool)) {
+	a.mu.Lock()
+	a.lookup = lookup
+	a.mu.Unlock()
+	a.Remap()
+}
+
+// OnDeviceOnline 设备注册上线
+func (a *StationAggregator) OnDeviceOnline(deviceID string, now time.Time) {
+	a.update(deviceID, now, func(d *stationDeviceState) {
+		d.online = true
+	})
+}
+
+// OnDeviceOffline 设备连接断开
+func (a *StationAggregator) OnDeviceOffline(deviceID string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d, ok := a.devices[deviceID]
+	if !ok || !d.online {
+		return
+	}
+	a.contribute(deviceID, d, -1)
+	d.online = false
+	for port, p := range d.ports {
+		p.powerW = 0
+		d.ports[port] = p
+	}
+	a.contribute(deviceID, d, 1)
+}
+
+// OnPortStatuses 设备心跳上报全部端口状态（下标0对应1号端口）；未充电端口功率归零
+func (a *StationAggregator) OnPortStatuses(deviceID string, statuses []uint8, now time.Time) {
+	a.update(deviceID, now, func(d *stationDeviceState) {
+		d.online = true
+		for i, status := range statuses {
+			p := d.ports[i+1]
+			p.status = status
+			p.updatedAt = now
+			if classifyPortStatus(status) != portClassCharging {
+				p.powerW = 0
+			}
+			d.ports[i+1] = p
+		}
+	})
+}
+
+// OnPortPower 功率心跳上报单个端口状态与实时功率(瓦)，port 为业务端口(从1开始)
+func (a *StationAggregator) OnPortPower(deviceID string, port int, status uint8, powerW float64, now time.Time) {
+	a.OnPortSample(deviceID, port, PortSample{Status: status, PowerW: powerW}, now)
+}
+
+// OnPortSample 功率心跳上报单个端口的完整数据；未充电端口功率归零，订单编号变化时电量以本次上报为准
+func (a *StationAggregator) OnPortSample(deviceID string, port int, sample PortSample, now time.Time) {
+	if port <= 0 {
+		return
+	}
+	a.update(deviceID, now, func(d *stationDeviceState) {
+		d.online = true
+		p := stationPort{status: sample.Status, powerW: sample.PowerW, voltageV: sample.VoltageV, energyWh: sample.EnergyWh, orderNo: sample.OrderNo, updatedAt: now}
+		if classifyPortStatus(sample.Status) != portClassCharging {
+			p.powerW = 0
+		}
+		d.ports[port] = p
+	})
+}
+
+// OnChargeAccepted 设备受理开始充电(0x82)：端口置为充电中，进行中订单的电量从0开始，功率待首个功率心跳上报
+func (a *StationAggregator) OnChargeAccepted(deviceID string, port int, orderNo string, now time.Time) {
+	if port <= 0 {
+		return
+	}
+	a.update(deviceID, now, func(d *stationDeviceState) {
+		d.online = true
+		p := d.ports[port]
+		if p.orderNo != orderNo {
+			p.energyWh = 0
+		}
+		p.status, p.orderNo, p.updatedAt = 0x01, orderNo, now
+		d.ports[port] = p
+	})
+}
+
+// PortStaleWindow 端口超过该时长未上报即视为过期
+func (a *StationAggregator) PortStaleWindow() time.Duration {
+	return a.portStaleWindow
+}
+
+// RemoveDevice 删除设备最近状态并撤出所属站点汇总（设备停用时调用）
+func (a *StationAggregator) RemoveDevice(deviceID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d, ok := a.devices[deviceID]
+	if !ok {
+		return
+	}
+	a.contribute(deviceID, d, -1)
+	delete(a.devices, deviceID)
+}
+
+// update 撤下设备旧贡献 → 修改状态 → 计入新贡献；首次出现的设备按映射确定站点
+func (a *StationAggregator) update(deviceID string, now time.Time, mutate func(d *stationDeviceState)) {
+	if deviceID == "" || decommission.IsDecommissioned(deviceID) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d, ok := a.devices[deviceID]
+	if !ok {
+		d = &stationDeviceState{stationID: a.resolveLocked(deviceID), ports: make(map[int]stationPort)}
+		a.devices[deviceID] = d
+	} else {
+		a.contribute(deviceID, d, -1)
+	}
+	mutate(d)
+	d.lastSeen = now
+	a.contribute(deviceID, d, 1)
+}
+
+func (a *StationAggregator) resolveLocked(deviceID string) string {
+	if a.lookup == nil {
+		return ""
+	}
+	info, ok := a.lookup(deviceID)
+	if !ok {
+		return ""
+	}
+	return info.StationID
+}
+
+// contribute 将设备计入(sign=1)或撤出(sign=-1)所属站点汇总
+func (a *StationAggregator) contribute(deviceID string, d *stationDeviceState, sign int) {
+	if d.stationID == "" {
+		return
+	}
+	r, ok := a.stations[d.stationID]
+	if !ok {
+		if sign < 0 {
+			return
+		}
+		r = &stationRollup{members: make(map[string]struct{})}
+		a.stations[d.stationID] = r
+	}
+	if sign > 0 {
+		r.members[deviceID] = struct{}{}
+	} else {
+		delete(r.members, deviceID)
+	}
+	r.devices += sign
+	r.ports += sign * len(d.ports)
+	if d.online {
+		r.online += sign
+		for _, p := range d.ports {
+			switch classifyPortStatus(p.status) {
+			case portClassCharging:
+				r.charging += sign
+			case portClassIdle:
+				r.idle += sign
+			default:
+				r.fault += sign
+			}
+			r.powerW += float64(sign) * p.powerW
+		}
+	}
+	if r.devices <= 0 {
+		delete(a.stations, d.stationID)
+	}
+}
+
+// Remap 按当前资产映射重新归属全部已知设备（映射重新加载后调用），返回迁移的设备数
+func (a *StationAggregator) Remap() int {
+	a.mu.Lock()
+	moved := 0
+	for deviceID, d := range a.devices {
+		stationID := a.resolveLocked(deviceID)
+		if stationID == d.stationID {
+			continue
+		}
+		a.contribute(deviceID, d, -1)
+		d.stationID = stationID
+		a.contribute(deviceID, d, 1)
+		moved++
+	}
+	a.mu.Unlock()
+
+	if moved > 0 {
+		logger.WithFields(logrus.Fields{"moved": moved}).Info("资产映射变更，设备已重新归属站点")
+	}
+	return moved
+}
+
+// ListStations 全部站点汇总（按站点ID排序）
+func (a *StationAggregator) ListStations() []StationSummary {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	list := make([]StationSummary, 0, len(a.stations))
+	for stationID, r := range a.stations {
+		list = append(list, a.summaryLocked(stationID, r))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StationID < list[j].StationID })
+	return list
+}
+
+// GetStation 站点详情，站点不存在时返回false
+func (a *StationAggregator) GetStation(stationID string) (StationDetail, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	r, ok := a.stations[stationID]
+	if !ok {
+		return StationDetail{}, false
+	}
+	detail := StationDetail{StationSummary: a.summaryLocked(stationID, r), Devices: make([]StationDevice, 0, len(r.members))}
+	for deviceID := range r.members {
+		d := a.devices[deviceID]
+		dev := StationDevice{DeviceID: deviceID, Online: d.online, TotalPorts: len(d.ports), LastSeen: d.lastSeen}
+		if d.online {
+			for _, p := range d.ports {
+				switch classifyPortStatus(p.status) {
+				case portClassCharging:
+					dev.PortsCharging++
+				case portClassIdle:
+					dev.PortsIdle++
+				default:
+					dev.PortsFaulted++
+				}
+				dev.PowerW += p.powerW
+			}
+		}
+		dev.PowerW = roundPower(dev.PowerW)
+		detail.Devices = append(detail.Devices, dev)
+	}
+	sort.Slice(detail.Devices, func(i, j int) bool { return detail.Devices[i].DeviceID < detail.Devices[j].DeviceID })
+	return detail, true
+}
+
+// DevicePorts 设备各端口最近上报的状态（按端口号排序），未上报过端口状态时返回nil
+func (a *StationAggregator) DevicePorts(deviceID string) []PortState {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	d, ok := a.devices[deviceID]
+	if !ok || len(d.ports) == 0 {
+		return nil
+	}
+	ports := make([]PortState, 0, len(d.ports))
+	for port, p := range d.ports {
+		ports = append(ports, PortState{
+			Port: port, Status: p.status, PowerW: roundPower(p.powerW), VoltageV: p.voltageV,
+			EnergyWh: p.energyWh, OrderNo: p.orderNo, UpdatedAt: p.updatedAt,
+		})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// StationOf 设备所属站点，未知设备或未映射站点时返回空串
+func (a *StationAggregator) StationOf(deviceID string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if d, ok := a.devices[deviceID]; ok {
+		return d.stationID
+	}
+	return ""
+}
+
+// UnassignedDevices 未映射到站点的设备数
+func (a *StationAggregator) UnassignedDevices() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := 0
+	for _, d := range a.devices {
+		if d.stationID == "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *StationAggregator) summaryLocked(stationID string, r *stationRollup) StationSummary {
+	s := StationSummary{
+		StationID:     stationID,
+		DeviceCount:   r.devices,
+		OnlineCount:   r.online,
+		OfflineCount:  r.devices - r.online,
+		TotalPorts:    r.ports,
+		PortsCharging: r.charging,
+		PortsIdle:     r.idle,
+		PortsFaulted:  r.fault,
+		PowerW:        roundPower(r.powerW),
+	}
+	if r.devices > 0 {
+		s.OfflineFraction = math.Round(float64(s.OfflineCount)/float64(r.devices)*1000) / 1000
+		s.Degraded = float64(s.OfflineCount)/float64(r.devices) > a.degradedFraction
+	}
+	return s
+}
+
+// roundPower 保留一位小数（增量累加的浮点误差不外露）
+func roundPower(w float64) float64 {
+	w = math.Round(w*10) / 10
+	if w < 0 {
+		return 0
+	}
+	return w
+}
+
+// startStationRemapWorker 映射变更时立即重新归属，并定期重新归属（HTTP解析器的缓存刷新没有变更通知）
+func (g *DeviceGateway) startStationRemapWorker() {
+	asset.OnReload(func() { g.stations.Remap() })
+	go func() {
+		ticker := time.NewTicker(g.stations.remapInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			g.stations.Remap()
+		}
+	}()
+}
+
+// GetStationAggregator 获取站点聚合器
+func (g *DeviceGateway) GetStationAggregator() *StationAggregator {
+	return g.stations
+}
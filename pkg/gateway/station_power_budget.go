@@ -0,0 +1,271 @@
+package gateway
+
+import (
+	"math"
+	"sort"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPortLimitW 0x82 过载功率字段（uint16）可表示的最大值
+const maxPortLimitW = 0xFFFF
+
+// PowerLimitApplier 端口功率上限下发：智能降功率逐步下调与站点功率预算重新分配都经由此接口
+type PowerLimitApplier interface {
+	ApplyPowerLimit(deviceID string, port1Based int, orderNo string, limitW int) error
+}
+
+// gatewayPowerLimitApplier 默认实现：0x82 仅更新过载功率（最大充电时长不修改）
+type gatewayPowerLimitApplier struct{}
+
+func (gatewayPowerLimitApplier) ApplyPowerLimit(deviceID string, port1Based int, orderNo string, limitW int) error {
+	return GetGlobalDeviceGateway().UpdateChargingOverloadPower(deviceID, uint8(port1Based), orderNo, uint16(limitW), 0)
+}
+
+// BudgetPortLimit 站点功率预算分配到端口的上限
+type BudgetPortLimit struct {
+	DeviceID string `json:"deviceId"`
+	Port     int    `json:"port"` // 业务端口(从1开始)
+	OrderNo  string `json:"orderNo"`
+	CapW     int    `json:"capW,omitempty"` // 会话自身上限（降功率接入或智能降功率已下调的值），0表示无
+	LimitW   int    `json:"limitW"`         // 分配的过载功率上限(瓦)
+	Applied  bool   `json:"applied"`        // 已成功下发
+}
+
+// stationBudget 站点功率预算与最近一次分配（key: deviceID|port）
+type stationBudget struct {
+	budgetW int
+	ports   map[string]BudgetPortLimit
+}
+
+// SplitPowerBudget 将站点预算在会话间均分（注水分配）：自身上限低于均分值的会话取自身上限，余量由其余会话均分；
+// caps 中 0 表示无自身上限。单端口不低于 minW（0x82 过载功率为0表示不限制，不能下发0），
+// 会话数 × minW 超过预算时以 minW 为准，由并发会话上限控制站点内的会话数
+func SplitPowerBudget(budgetW int, caps []int, minW int) []int {
+	limits := make([]int, len(caps))
+	order := make([]int, len(caps))
+	for i := range order {
+		order[i] = i
+	}
+	capOf := func(i int) int {
+		if caps[i] <= 0 {
+			return math.MaxInt
+		}
+		return caps[i]
+	}
+	sort.SliceStable(order, func(a, b int) bool { return capOf(order[a]) < capOf(order[b]) })
+
+	remaining := max(budgetW, 0)
+	for k, i := range order {
+		share := remaining / (len(order) - k)
+		limit := min(capOf(i), max(share, minW), maxPortLimitW)
+		limits[i] = limit
+		remaining = max(remaining-limit, 0)
+	}
+	return limits
+}
+
+// SetPowerLimitApplier 替换端口功率上限下发实现（测试使用），nil 恢复默认
+func (d *DynamicPowerController) SetPowerLimitApplier(applier PowerLimitApplier) {
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	d.applier = applier
+}
+
+func (d *DynamicPowerController) limitApplier() PowerLimitApplier {
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	if d.applier == nil {
+		return gatewayPowerLimitApplier{}
+	}
+	return d.applier
+}
+
+// minPowerW 单端口最低功率（与智能降功率收尾阈值一致）
+func (d *DynamicPowerController) minPowerW() int {
+	if d.cfg.MinPowerW > 0 {
+		return d.cfg.MinPowerW
+	}
+	return 80
+}
+
+// SetStationBudget 设置站点功率预算并立即在站点进行中的会话间重新分配，返回各端口的分配结果。
+// 预算输入与智能降功率开关无关：开关只控制按心跳逐步下调
+func (d *DynamicPowerController) SetStationBudget(stationID string, budgetW int) []BudgetPortLimit {
+	if d == nil || stationID == "" {
+		return nil
+	}
+	d.budgetMu.Lock()
+	b, ok := d.budgets[stationID]
+	if !ok {
+		b = &stationBudget{ports: make(map[string]BudgetPortLimit)}
+		d.budgets[stationID] = b
+	}
+	b.budgetW = budgetW
+	d.budgetMu.Unlock()
+	return d.RedistributeStation(stationID)
+}
+
+// ClearStationBudget 移除站点功率预算；已下发的端口上限保持到会话结束
+func (d *DynamicPowerController) ClearStationBudget(stationID string) {
+	d.budgetMu.Lock()
+	delete(d.budgets, stationID)
+	d.budgetMu.Unlock()
+}
+
+// StationBudget 站点当前预算(瓦)与最近一次端口分配（按设备、端口排序），未设置预算时返回false
+func (d *DynamicPowerController) StationBudget(stationID string) (int, []BudgetPortLimit, bool) {
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	b, ok := d.budgets[stationID]
+	if !ok {
+		return 0, nil, false
+	}
+	ports := make([]BudgetPortLimit, 0, len(b.ports))
+	for _, p := range b.ports {
+		ports = append(ports, p)
+	}
+	sortBudgetPorts(ports)
+	return b.budgetW, ports, true
+}
+
+// AdmissionLimit 站点设置了预算时，新会话接入后按同样的分配规则应分得的上限(瓦)；capW 为会话自身上限（降功率接入），0表示无
+func (d *DynamicPowerController) AdmissionLimit(stationID, deviceID string, port, capW int) (int, bool) {
+	if d == nil || stationID == "" {
+		return 0, false
+	}
+	d.budgetMu.Lock()
+	b, ok := d.budgets[stationID]
+	budgetW := 0
+	if ok {
+		budgetW = b.budgetW
+	}
+	d.budgetMu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	var caps []int
+	for _, s := range d.stationSessions(stationID) {
+		if s.DeviceID != deviceID || s.Port != port {
+			caps = append(caps, s.CapW)
+		}
+	}
+	limits := SplitPowerBudget(budgetW, append(caps, capW), d.minPowerW())
+	return limits[len(limits)-1], true
+}
+
+// NoteBudgetAdmission 记录以预算分配上限开始充电的会话（开始充电帧已携带该上限，重新分配时不重复下发）并重新分配站点内其余会话
+func (d *DynamicPowerController) NoteBudgetAdmission(stationID, deviceID string, port int, orderNo string, limitW int) {
+	d.budgetMu.Lock()
+	b, ok := d.budgets[stationID]
+	if ok {
+		b.ports[makeKey(deviceID, port)] = BudgetPortLimit{DeviceID: deviceID, Port: port, OrderNo: orderNo, LimitW: limitW, Applied: true}
+	}
+	d.budgetMu.Unlock()
+	if ok {
+		d.RedistributeStation(stationID)
+	}
+}
+
+// RedistributeStation 按站点当前预算在进行中的会话间重新分配，只向上限变化或尚未下发成功的端口下发；
+// 会话开始时由开始充电流程调用，会话结束释放的余量在调度器下一次评估时重新分配
+func (d *DynamicPowerController) RedistributeStation(stationID string) []BudgetPortLimit {
+	d.redistributeMu.Lock()
+	defer d.redistributeMu.Unlock()
+
+	d.budgetMu.Lock()
+	b, ok := d.budgets[stationID]
+	if !ok {
+		d.budgetMu.Unlock()
+		return nil
+	}
+	budgetW, previous := b.budgetW, b.ports
+	d.budgetMu.Unlock()
+
+	sessions := d.stationSessions(stationID)
+	caps := make([]int, len(sessions))
+	for i, s := range sessions {
+		caps[i] = s.CapW
+	}
+	limits := SplitPowerBudget(budgetW, caps, d.minPowerW())
+	applier := d.limitApplier()
+	next := make(map[string]BudgetPortLimit, len(sessions))
+	for i := range sessions {
+		s := &sessions[i]
+		s.LimitW = limits[i]
+		key := makeKey(s.DeviceID, s.Port)
+		if p, ok := previous[key]; ok && p.Applied && p.OrderNo == s.OrderNo && p.LimitW == s.LimitW {
+			s.Applied = true
+		} else if err := applier.ApplyPowerLimit(s.DeviceID, s.Port, s.OrderNo, s.LimitW); err != nil {
+			logger.WithFields(logrus.Fields{
+				"stationID": stationID,
+				"deviceID":  s.DeviceID,
+				"port":      s.Port,
+				"orderNo":   s.OrderNo,
+				"limitW":    s.LimitW,
+				"error":     err.Error(),
+			}).Warn("站点功率预算：端口上限下发失败，下次评估重试")
+		} else {
+			s.Applied = true
+		}
+		next[key] = *s
+	}
+
+	d.budgetMu.Lock()
+	if d.budgets[stationID] == b {
+		b.ports = next
+	}
+	d.budgetMu.Unlock()
+	return sessions
+}
+
+// budgetCap 会话所在站点预算分配给它的上限，智能降功率下调时不超过该值
+func (d *DynamicPowerController) budgetCap(deviceID string, port1Based int, orderNo string) (int, bool) {
+	key := makeKey(deviceID, port1Based)
+	d.budgetMu.Lock()
+	defer d.budgetMu.Unlock()
+	for _, b := range d.budgets {
+		if p, ok := b.ports[key]; ok && p.OrderNo == orderNo {
+			return p.LimitW, true
+		}
+	}
+	return 0, false
+}
+
+// stationSessions 站点在线设备上进行中（充电/待启动/排队）的会话及其自身上限
+func (d *DynamicPowerController) stationSessions(stationID string) []BudgetPortLimit {
+	g := GetGlobalDeviceGateway()
+	detail, ok := g.stations.GetStation(stationID)
+	if !ok {
+		return nil
+	}
+	var sessions []BudgetPortLimit
+	for _, dev := range detail.Devices {
+		if !dev.Online {
+			continue
+		}
+		for _, port := range g.orderManager.ActivePorts(dev.DeviceID) {
+			order := g.orderManager.GetOrder(dev.DeviceID, port)
+			if order == nil {
+				continue
+			}
+			capW := int(order.OverloadPowerW)
+			if w, ok := d.Overload(dev.DeviceID, port, order.OrderNo); ok && (capW == 0 || w < capW) {
+				capW = w
+			}
+			sessions = append(sessions, BudgetPortLimit{DeviceID: dev.DeviceID, Port: port, OrderNo: order.OrderNo, CapW: capW})
+		}
+	}
+	sortBudgetPorts(sessions)
+	return sessions
+}
+
+func sortBudgetPorts(ports []BudgetPortLimit) {
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].DeviceID != ports[j].DeviceID {
+			return ports[i].DeviceID < ports[j].DeviceID
+		}
+		return ports[i].Port < ports[j].Port
+	})
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+)
+
+// GatewayVersion 网关版本号
+const GatewayVersion = "2.0.0"
+
+// 告警严重级别（汇总统计用）
+const (
+	AlarmSeverityCritical = "critical" // 严重：ICCID冲突（疑似SIM克隆）
+	AlarmSeverityHigh     = "high"     // 高：端口故障
+	AlarmSeverityWarning  = "warning"  // 警告：排队超时未开始充电
+)
+
+// DeviceSummary 设备汇总
+type DeviceSummary struct {
+	Total   int            `json:"total"`   // 已注册设备总数
+	Online  int            `json:"online"`  // 在线设备数
+	Offline int            `json:"offline"` // 离线设备数
+	ByType  map[string]int `json:"by_type"` // 按设备类型计数，键为十进制设备类型
+
+	Decommissioned int `json:"decommissioned"` // 已停用（归档）设备数，不计入以上各项
+}
+
+// ChargingSummary 充电汇总
+type ChargingSummary struct {
+	ActiveSessions int   `json:"active_sessions"`  // 充电中订单数
+	QueuedSessions int   `json:"queued_sessions"`  // 设备侧排队订单数
+	StartsLastHour int64 `json:"starts_last_hour"` // 近1小时充电开始次数
+	StopsLastHour  int64 `json:"stops_last_hour"`  // 近1小时充电结束次数
+}
+
+// FleetSummary 网关侧汇总（设备/连接/充电/告警/运行信息）
+type FleetSummary struct {
+	Devices     DeviceSummary   `json:"devices"`
+	Connections int             `json:"connections"`
+	Charging    ChargingSummary `json:"charging"`
+	Alarms      map[string]int  `json:"alarms"` // 当前活跃告警，按 critical/high/warning 计数
+	Uptime      string          `json:"uptime"`
+	UptimeSec   int64           `json:"uptime_seconds"`
+	Version     string          `json:"version"`
+	StartedAt   time.Time       `json:"started_at"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// GetStartedAt 获取网关启动时间
+func (g *DeviceGateway) GetStartedAt() time.Time {
+	return g.startedAt
+}
+
+// GetFleetSummary 计算网关汇总数据
+// 各分项均为一次遍历的快照读取，不调用逐设备详情接口，保证万级设备下的低延迟
+func (g *DeviceGateway) GetFleetSummary(now time.Time) FleetSummary {
+	summary := FleetSummary{
+		Devices: DeviceSummary{ByType: make(map[string]int)},
+		Alarms: map[string]int{
+			AlarmSeverityCritical: 0,
+			AlarmSeverityHigh:     0,
+			AlarmSeverityWarning:  0,
+		},
+		Version:     GatewayVersion,
+		StartedAt:   g.startedAt,
+		GeneratedAt: now,
+	}
+	uptime := now.Sub(g.startedAt).Truncate(time.Second)
+	summary.Uptime = uptime.String()
+	summary.UptimeSec = int64(uptime.Seconds())
+
+	decommissions := decommission.GetGlobalRegistry()
+	summary.Devices.Decommissioned, _ = decommissions.Counts()
+
+	if g.tcpManager != nil {
+		g.tcpManager.GetDeviceGroups().Range(func(_, value interface{}) bool {
+			deviceGroup := value.(*core.DeviceGroup)
+			deviceGroup.RLock()
+			for deviceID, device := range deviceGroup.Devices {
+				if decommissions.IsDecommissioned(deviceID) {
+					continue // 停用后断开前的短暂窗口
+				}
+				summary.Devices.Total++
+				if device.Status == constants.DeviceStatusOnline {
+					summary.Devices.Online++
+				}
+				summary.Devices.ByType[strconv.Itoa(int(device.DeviceType))]++
+			}
+			deviceGroup.RUnlock()
+			return true
+		})
+		summary.Devices.Offline = summary.Devices.Total - summary.Devices.Online
+
+		g.tcpManager.GetConnections().Range(func(_, _ interface{}) bool {
+			summary.Connections++
+			return true
+		})
+
+		summary.Alarms[AlarmSeverityCritical] = len(g.tcpManager.GetICCIDConflicts())
+	}
+
+	orderStats := g.orderManager.GetOrderStats()
+	summary.Charging.ActiveSessions = orderStats["charging"]
+	summary.Charging.QueuedSessions = orderStats["queued"]
+	summary.Charging.StartsLastHour, summary.Charging.StopsLastHour = g.orderManager.GetRecentChargeActivity(now)
+
+	for _, sm := range g.stateMachineManager.GetAllStateMachines() {
+		if sm.GetCurrentState() == StateFault {
+			summary.Alarms[AlarmSeverityHigh]++
+		}
+	}
+	for _, c := range g.chargeQueue.List() {
+		if c.TimedOut {
+			summary.Alarms[AlarmSeverityWarning]++
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,408 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// 时间线来源子系统
+const (
+	TimelineSourceTCPManager   = "tcp_manager"  // 当前连接与注册
+	TimelineSourceCommand      = "command"      // 命令管理器跟踪中的下发命令
+	TimelineSourceReboot       = "reboot"       // 远程重启记录
+	TimelineSourceCharging     = "charging"     // 充电状态机转换
+	TimelineSourceICCID        = "iccid"        // ICCID冲突记录
+	TimelineSourceNotification = "notification" // 通知事件记录（通知系统启用时注册）
+)
+
+const (
+	timelineSourceOK        = "ok"       // 来源查询成功
+	timelineSourceDisabled  = "disabled" // 可选来源未启用
+	timelineDefaultLimit    = 100
+	timelineMaxLimit        = 500
+	timelineCursorSeparator = "|"
+)
+
+// 时间线条目类型（types 查询参数取值）
+const (
+	TimelineTypeConnection   = "connection"   // 连接建立/断开
+	TimelineTypeRegistration = "registration" // 设备注册
+	TimelineTypeCommand      = "command"      // 命令下发及结果
+	TimelineTypeSettlement   = "settlement"   // 结算
+	TimelineTypeAlarm        = "alarm"        // 告警（设备/端口故障、ICCID冲突等）
+	TimelineTypeCharging     = "charging"     // 充电会话转换
+	TimelineTypeNotification = "notification" // 其他通知投递
+)
+
+// TimelineEntry 设备时间线条目
+type TimelineEntry struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Source    string                 `json:"source"`         // 来源子系统
+	Type      string                 `json:"type"`           // 条目类型
+	Summary   string                 `json:"summary"`        // 简要说明
+	RefID     string                 `json:"ref_id"`         // 来源子系统中的记录ID，用于下钻查询
+	Port      *int                   `json:"port,omitempty"` // 相关端口
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// sortKey 同一时间戳内的稳定排序键（游标分页使用）
+func (e TimelineEntry) sortKey() string {
+	return e.Source + timelineCursorSeparator + e.Type + timelineCursorSeparator + e.RefID + timelineCursorSeparator + e.Summary
+}
+
+// TimelineCollector 按时间范围读取某一来源中设备相关的条目（只读取来源已有的有界存储，不另行存储）
+type TimelineCollector func(deviceID string, from, to time.Time) ([]TimelineEntry, error)
+
+// TimelineQuery 时间线查询条件
+type TimelineQuery struct {
+	From   time.Time       // 起始时间（含），零值表示不限
+	To     time.Time       // 结束时间（含），零值表示不限
+	Types  map[string]bool // 条目类型过滤，为空表示全部
+	Cursor string          // 上一页返回的游标
+	Limit  int             // 每页条数
+}
+
+// TimelinePage 时间线分页结果
+type TimelinePage struct {
+	DeviceID   string            `json:"deviceId"`
+	Items      []TimelineEntry   `json:"items"`
+	NextCursor string            `json:"nextCursor,omitempty"` // 为空表示没有更多
+	Sources    map[string]string `json:"sources"`              // 各来源查询状态：ok / disabled / 错误信息
+}
+
+var (
+	timelineSourcesMu sync.RWMutex
+	timelineSources   = map[string]TimelineCollector{}
+)
+
+// RegisterTimelineSource 注册可选时间线来源（如通知事件记录），传nil表示注销
+func RegisterTimelineSource(name string, collector TimelineCollector) {
+	timelineSourcesMu.Lock()
+	defer timelineSourcesMu.Unlock()
+	if collector == nil {
+		delete(timelineSources, name)
+		return
+	}
+	timelineSources[name] = collector
+}
+
+// EncodeTimelineCursor 以条目时间戳与排序键生成游标
+func EncodeTimelineCursor(entry TimelineEntry) string {
+	raw := strconv.FormatInt(entry.Timestamp.UnixNano(), 10) + timelineCursorSeparator + entry.sortKey()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTimelineCursor(cursor string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", fmt.Errorf("游标格式错误")
+	}
+	parts := strings.SplitN(string(raw), timelineCursorSeparator, 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("游标格式错误")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("游标格式错误")
+	}
+	return nanos, parts[1], nil
+}
+
+// GetDeviceTimeline 按时间顺序合并各子系统中设备相关的事件
+// 每次查询时从各来源的有界存储即时合并；可选来源未启用或查询失败时跳过并在 Sources 中标注
+func (g *DeviceGateway) GetDeviceTimeline(deviceID string, query TimelineQuery) (*TimelinePage, error) {
+	var (
+		afterNanos int64
+		afterKey   string
+	)
+	if query.Cursor != "" {
+		nanos, key, err := decodeTimelineCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		afterNanos, afterKey = nanos, key
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = timelineDefaultLimit
+	}
+	if limit > timelineMaxLimit {
+		limit = timelineMaxLimit
+	}
+
+	collectors := map[string]TimelineCollector{
+		TimelineSourceTCPManager: g.collectConnectionTimeline,
+		TimelineSourceCommand:    g.collectCommandTimeline,
+		TimelineSourceReboot:     g.collectRebootTimeline,
+		TimelineSourceCharging:   g.collectChargingTimeline,
+		TimelineSourceICCID:      g.collectICCIDTimeline,
+	}
+	timelineSourcesMu.RLock()
+	for name, collector := range timelineSources {
+		collectors[name] = collector
+	}
+	timelineSourcesMu.RUnlock()
+
+	page := &TimelinePage{DeviceID: deviceID, Items: []TimelineEntry{}, Sources: map[string]string{}}
+	if _, ok := collectors[TimelineSourceNotification]; !ok {
+		page.Sources[TimelineSourceNotification] = timelineSourceDisabled
+	}
+
+	var merged []TimelineEntry
+	for name, collector := range collectors {
+		entries, err := collector(deviceID, query.From, query.To)
+		if err != nil {
+			page.Sources[name] = err.Error()
+			continue
+		}
+		page.Sources[name] = timelineSourceOK
+		for _, entry := range entries {
+			if !query.From.IsZero() && entry.Timestamp.Before(query.From) {
+				continue
+			}
+			if !query.To.IsZero() && entry.Timestamp.After(query.To) {
+				continue
+			}
+			if len(query.Types) > 0 && !query.Types[entry.Type] {
+				continue
+			}
+			if query.Cursor != "" {
+				nanos := entry.Timestamp.UnixNano()
+				if nanos < afterNanos || (nanos == afterNanos && entry.sortKey() <= afterKey) {
+					continue
+				}
+			}
+			merged = append(merged, entry)
+		}
+	}
+
+	sort.Slice(merged, func(a, b int) bool {
+		ta, tb := merged[a].Timestamp.UnixNano(), merged[b].Timestamp.UnixNano()
+		if ta != tb {
+			return ta < tb
+		}
+		return merged[a].sortKey() < merged[b].sortKey()
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+		page.NextCursor = EncodeTimelineCursor(merged[limit-1])
+	}
+	page.Items = append(page.Items, merged...)
+	return page, nil
+}
+
+// collectConnectionTimeline 当前连接建立、注册与上次断开
+func (g *DeviceGateway) collectConnectionTimeline(deviceID string, _, _ time.Time) ([]TimelineEntry, error) {
+	if g.tcpManager == nil {
+		return nil, fmt.Errorf("TCP管理器未初始化")
+	}
+	var entries []TimelineEntry
+	if session, ok := g.tcpManager.GetSessionByDeviceID(deviceID); ok {
+		refID := strconv.FormatUint(session.ConnID, 10)
+		if !session.ConnectedAt.IsZero() {
+			entries = append(entries, TimelineEntry{
+				Timestamp: session.ConnectedAt,
+				Source:    TimelineSourceTCPManager,
+				Type:      TimelineTypeConnection,
+				Summary:   fmt.Sprintf("连接建立 %s（连接 %d）", session.RemoteAddr, session.ConnID),
+				RefID:     refID,
+				Data:      map[string]interface{}{"remote_addr": session.RemoteAddr, "conn_id": session.ConnID},
+			})
+		}
+		if !session.LastDisconnect.IsZero() {
+			entries = append(entries, TimelineEntry{
+				Timestamp: session.LastDisconnect,
+				Source:    TimelineSourceTCPManager,
+				Type:      TimelineTypeConnection,
+				Summary:   fmt.Sprintf("连接断开（连接 %d）", session.ConnID),
+				RefID:     refID + ":disconnect",
+			})
+		}
+	}
+	if device, ok := g.tcpManager.GetDeviceByID(deviceID); ok {
+		device.RLock()
+		registeredAt, iccid, version := device.RegisteredAt, device.ICCID, device.DeviceVersion
+		device.RUnlock()
+		if !registeredAt.IsZero() {
+			entries = append(entries, TimelineEntry{
+				Timestamp: registeredAt,
+				Source:    TimelineSourceTCPManager,
+				Type:      TimelineTypeRegistration,
+				Summary:   fmt.Sprintf("设备注册 ICCID=%s 版本=%s", iccid, version),
+				RefID:     deviceID,
+				Data:      map[string]interface{}{"iccid": iccid, "device_version": version},
+			})
+		}
+	}
+	return entries, nil
+}
+
+// collectCommandTimeline 命令管理器仍在跟踪的下发命令及其结果
+func (g *DeviceGateway) collectCommandTimeline(deviceID string, _, _ time.Time) ([]TimelineEntry, error) {
+	cmdMgr := network.GetCommandManager()
+	if cmdMgr == nil {
+		return nil, fmt.Errorf("命令管理器未初始化")
+	}
+	physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID)
+	if err != nil {
+		return nil, nil
+	}
+	var entries []TimelineEntry
+	for _, cmd := range cmdMgr.GetPhysicalIDCommands(physicalID) {
+		summary := fmt.Sprintf("下发 0x%02X %s：%s（重试%d次）", cmd.Command, network.GetCommandDescription(cmd.Command), cmd.Status, cmd.RetryCount)
+		if cmd.LastError != "" {
+			summary += "，" + cmd.LastError
+		}
+		data := map[string]interface{}{
+			"command":     dny_protocol.CommandLabel(cmd.Command),
+			"message_id":  fmt.Sprintf("0x%04X", cmd.MessageID),
+			"status":      cmd.Status,
+			"retry_count": cmd.RetryCount,
+		}
+		if cmd.CorrelationID != "" {
+			data["correlation_id"] = cmd.CorrelationID
+		}
+		entries = append(entries, TimelineEntry{
+			Timestamp: cmd.CreateTime,
+			Source:    TimelineSourceCommand,
+			Type:      TimelineTypeCommand,
+			Summary:   summary,
+			RefID:     fmt.Sprintf("%d-%04X-%02X", cmd.ConnID, cmd.MessageID, cmd.Command),
+			Data:      data,
+		})
+	}
+	// 已结束的命令不再跟踪，设备否定应答单独保留最近记录
+	if stats, ok := cmdMgr.GetRejectionStats(physicalID); ok {
+		for _, r := range stats.Recent {
+			data := map[string]interface{}{
+				"command":       dny_protocol.CommandLabel(r.Command),
+				"message_id":    fmt.Sprintf("0x%04X", r.MessageID),
+				"status":        network.CmdStatusRejected,
+				"reply_command": fmt.Sprintf("0x%02X", r.ReplyCommand),
+				"error_code":    fmt.Sprintf("0x%02X", r.ErrorCode),
+				"format":        r.Format,
+			}
+			if r.CorrelationID != "" {
+				data["correlation_id"] = r.CorrelationID
+			}
+			entries = append(entries, TimelineEntry{
+				Timestamp: r.At,
+				Source:    TimelineSourceCommand,
+				Type:      TimelineTypeCommand,
+				Summary:   fmt.Sprintf("设备拒绝 0x%02X %s（错误码 0x%02X）", r.Command, network.GetCommandDescription(r.Command), r.ErrorCode),
+				RefID:     fmt.Sprintf("rejected-%04X-%02X-%d", r.MessageID, r.Command, r.At.UnixNano()),
+				Data:      data,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// collectRebootTimeline 远程重启下发与结果
+func (g *DeviceGateway) collectRebootTimeline(deviceID string, _, _ time.Time) ([]TimelineEntry, error) {
+	var entries []TimelineEntry
+	for _, record := range g.reboots.History(deviceID) {
+		entries = append(entries, TimelineEntry{
+			Timestamp: record.IssuedAt,
+			Source:    TimelineSourceReboot,
+			Type:      TimelineTypeCommand,
+			Summary:   fmt.Sprintf("下发远程重启（force=%t）", record.Force),
+			RefID:     record.ID,
+			Data:      map[string]interface{}{"correlation_id": record.CorrelationID, "status": record.Status},
+		})
+		switch record.Status {
+		case RebootStatusCompleted:
+			if record.CompletedAt != nil {
+				entries = append(entries, TimelineEntry{
+					Timestamp: *record.CompletedAt,
+					Source:    TimelineSourceReboot,
+					Type:      TimelineTypeCommand,
+					Summary:   fmt.Sprintf("远程重启完成，耗时%s", record.CompletedAt.Sub(record.IssuedAt).Round(time.Second)),
+					RefID:     record.ID + ":" + record.Status,
+				})
+			}
+		case RebootStatusFailed:
+			at := record.Deadline
+			if record.CompletedAt != nil {
+				at = *record.CompletedAt
+			}
+			entries = append(entries, TimelineEntry{
+				Timestamp: at,
+				Source:    TimelineSourceReboot,
+				Type:      TimelineTypeCommand,
+				Summary:   "远程重启失败：" + record.Error,
+				RefID:     record.ID + ":" + record.Status,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// collectChargingTimeline 各端口充电状态机的状态转换
+func (g *DeviceGateway) collectChargingTimeline(deviceID string, _, _ time.Time) ([]TimelineEntry, error) {
+	if g.stateMachineManager == nil {
+		return nil, fmt.Errorf("状态机管理器未初始化")
+	}
+	var entries []TimelineEntry
+	for _, sm := range g.stateMachineManager.GetDeviceStateMachines(deviceID) {
+		for _, change := range sm.GetStateHistory() {
+			port := change.Port
+			refID := change.OrderNo
+			if refID == "" {
+				refID = fmt.Sprintf("%s:%d", deviceID, change.Port)
+			}
+			summary := fmt.Sprintf("端口%d %s → %s（%s）", change.Port, change.FromState, change.ToState, change.Reason)
+			if change.ErrorDetail != "" {
+				summary += "：" + change.ErrorDetail
+			}
+			entries = append(entries, TimelineEntry{
+				Timestamp: change.Timestamp,
+				Source:    TimelineSourceCharging,
+				Type:      TimelineTypeCharging,
+				Summary:   summary,
+				RefID:     refID,
+				Port:      &port,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// collectICCIDTimeline 涉及该设备的ICCID冲突
+func (g *DeviceGateway) collectICCIDTimeline(deviceID string, _, _ time.Time) ([]TimelineEntry, error) {
+	var entries []TimelineEntry
+	for _, conflict := range g.GetICCIDConflicts() {
+		role := ""
+		for _, id := range conflict.Existing.DeviceIDs {
+			if id == deviceID {
+				role = "existing"
+			}
+		}
+		for _, id := range conflict.Incoming.DeviceIDs {
+			if id == deviceID {
+				role = "incoming"
+			}
+		}
+		if role == "" {
+			continue
+		}
+		entries = append(entries, TimelineEntry{
+			Timestamp: conflict.DetectedAt,
+			Source:    TimelineSourceICCID,
+			Type:      TimelineTypeAlarm,
+			Summary:   fmt.Sprintf("ICCID冲突 %s：%s ↔ %s（策略 %s）", conflict.ICCID, conflict.Existing.RemoteAddr, conflict.Incoming.RemoteAddr, conflict.Policy),
+			RefID:     conflict.ICCID,
+			Data:      map[string]interface{}{"role": role, "count": conflict.Count},
+		})
+	}
+	return entries, nil
+}
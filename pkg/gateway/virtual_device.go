@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+	"github.com/sirupsen/logrus"
+)
+
+// VirtualTarget 虚拟设备寻址解析结果
+type VirtualTarget struct {
+	VirtualID    string `json:"virtual_id"`
+	VirtualPort  int    `json:"virtual_port"`
+	ParentID     string `json:"parent_id"`
+	PhysicalPort int    `json:"physical_port"` // 物理业务端口(1-based)
+}
+
+// ResolveVirtualTarget 将虚拟设备ID+虚拟端口解析为物理设备ID+物理端口
+// 非虚拟ID返回 ok=false；虚拟ID但端口越界返回错误
+func (g *DeviceGateway) ResolveVirtualTarget(deviceID string, port int) (VirtualTarget, bool, error) {
+	v, ok := virtual.Resolve(deviceID)
+	if !ok {
+		return VirtualTarget{}, false, nil
+	}
+	physicalPort, err := v.PhysicalPort(port)
+	if err != nil {
+		return VirtualTarget{}, true, err
+	}
+	virtualPort, _ := v.VirtualPort(physicalPort)
+	return VirtualTarget{
+		VirtualID:    v.VirtualID,
+		VirtualPort:  virtualPort,
+		ParentID:     v.ParentID,
+		PhysicalPort: physicalPort,
+	}, true, nil
+}
+
+// SplitVirtualDevices 将物理设备拆分为虚拟子设备（持久化并挂载到设备组；设备离线时待注册后挂载）
+func (g *DeviceGateway) SplitVirtualDevices(parentID string, plan virtual.SplitPlan) ([]*core.VirtualDevice, error) {
+	registry := virtual.GetGlobalRegistry()
+	if registry == nil {
+		return nil, fmt.Errorf("虚拟子设备注册表未初始化")
+	}
+	virtuals, err := registry.Split(parentID, plan)
+	if err != nil {
+		return nil, err
+	}
+	attached := g.attachVirtualDevices(parentID)
+
+	ids := make([]string, 0, len(virtuals))
+	for _, v := range virtuals {
+		ids = append(ids, v.VirtualID)
+	}
+	logger.WithFields(logrus.Fields{
+		"deviceID": parentID,
+		"virtuals": ids,
+		"attached": attached,
+	}).Info("🧩 设备已拆分为虚拟子设备")
+	return virtuals, nil
+}
+
+// MergeVirtualDevices 删除拆分，虚拟子设备的数据归并回物理设备
+// 返回被删除的虚拟设备以及原属于这些虚拟设备、现归属物理设备的进行中会话
+func (g *DeviceGateway) MergeVirtualDevices(parentID string) ([]*core.VirtualDevice, []*OrderState, error) {
+	registry := virtual.GetGlobalRegistry()
+	if registry == nil {
+		return nil, nil, fmt.Errorf("虚拟子设备注册表未初始化")
+	}
+	virtuals, err := registry.Remove(parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if g.tcpManager != nil {
+		g.tcpManager.SetVirtualDevices(parentID, nil)
+	}
+
+	mapped := make(map[int]bool)
+	for _, v := range virtuals {
+		for _, p := range v.Ports {
+			mapped[p] = true
+		}
+	}
+	var sessions []*OrderState
+	for _, order := range g.orderManager.ListActiveOrders() {
+		if order.DeviceID == parentID && mapped[order.Port] {
+			sessions = append(sessions, order)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Port < sessions[j].Port })
+
+	logger.WithFields(logrus.Fields{
+		"deviceID":       parentID,
+		"removed":        len(virtuals),
+		"mergedSessions": len(sessions),
+	}).Info("🧩 虚拟子设备已归并回物理设备")
+	return virtuals, sessions, nil
+}
+
+// GetVirtualDevices 获取物理设备的虚拟子设备（以注册表为准）
+func (g *DeviceGateway) GetVirtualDevices(parentID string) []*core.VirtualDevice {
+	registry := virtual.GetGlobalRegistry()
+	if registry == nil {
+		return nil
+	}
+	return registry.Get(parentID)
+}
+
+// GetVirtualDeviceDetail 获取虚拟设备详情：继承物理设备的在线/连接信息，附带端口映射与进行中的会话
+func (g *DeviceGateway) GetVirtualDeviceDetail(virtualID string) (map[string]interface{}, error) {
+	v, ok := virtual.Resolve(virtualID)
+	if !ok {
+		return nil, fmt.Errorf("虚拟设备不存在")
+	}
+	detail, err := g.GetDeviceDetail(v.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	delete(detail, "virtualDevices")
+	return g.decorateVirtualDetail(detail, v), nil
+}
+
+// ExpandVirtualDetails 将物理设备详情展开为其虚拟子设备详情；未拆分时返回nil
+func (g *DeviceGateway) ExpandVirtualDetails(parentDetail map[string]interface{}, parentID string) []map[string]interface{} {
+	virtuals := g.GetVirtualDevices(parentID)
+	if len(virtuals) == 0 {
+		return nil
+	}
+	list := make([]map[string]interface{}, 0, len(virtuals))
+	for _, v := range virtuals {
+		detail := make(map[string]interface{}, len(parentDetail)+5)
+		for k, val := range parentDetail {
+			if k != "virtualDevices" {
+				detail[k] = val
+			}
+		}
+		list = append(list, g.decorateVirtualDetail(detail, v))
+	}
+	return list
+}
+
+func (g *DeviceGateway) decorateVirtualDetail(detail map[string]interface{}, v *core.VirtualDevice) map[string]interface{} {
+	ports := make([]map[string]interface{}, 0, len(v.Ports))
+	for i, p := range v.Ports {
+		port := map[string]interface{}{
+			"virtualPort":  i + 1,
+			"physicalPort": p,
+		}
+		if order := g.orderManager.GetOrder(v.ParentID, p); order != nil {
+			port["orderNo"] = order.OrderNo
+			port["orderStatus"] = order.Status.String()
+		}
+		ports = append(ports, port)
+	}
+	detail["deviceId"] = v.VirtualID
+	detail["parentDeviceId"] = v.ParentID
+	detail["isVirtual"] = true
+	detail["ports"] = ports
+	detail["virtualCreatedAt"] = v.CreatedAt.Unix()
+	return detail
+}
+
+// attachVirtualDevices 将注册表中的虚拟子设备挂载到设备组，返回是否挂载成功（设备在线）
+func (g *DeviceGateway) attachVirtualDevices(parentID string) bool {
+	if g.tcpManager == nil {
+		return false
+	}
+	virtuals := g.GetVirtualDevices(parentID)
+	if len(virtuals) == 0 {
+		return false
+	}
+	return g.tcpManager.SetVirtualDevices(parentID, virtuals)
+}
@@ -0,0 +1,814 @@
+// IoT-Zinx 网关 gRPC 接口（面向内部高频调用方）
+//
+// 各RPC与同名HTTP接口共用同一实现：请求字段名与HTTP请求参数一致（lowerCamelCase），
+// 结果以 Result 返回（与HTTP响应体 {code, message, data} 相同）；HTTP状态码非2xx时
+// 返回对应的gRPC错误码，Result 附在错误详情中。
+//
+// 生成代码：make proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: gateway.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Result 与HTTP响应体一致的调用结果
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	HttpStatus    int32                  `protobuf:"varint,1,opt,name=http_status,json=httpStatus,proto3" json:"http_status,omitempty"` // 对应HTTP接口的状态码
+	Code          int32                  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`                               // 业务码（0为成功）
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`                          // 结果消息
+	Data          *structpb.Value        `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`                                // 结果数据（与HTTP响应的data字段相同）
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_gateway_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Result) GetHttpStatus() int32 {
+	if x != nil {
+		return x.HttpStatus
+	}
+	return 0
+}
+
+func (x *Result) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Result) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Result) GetData() *structpb.Value {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type GetDeviceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Verbose       bool                   `protobuf:"varint,2,opt,name=verbose,proto3" json:"verbose,omitempty"` // 附带诊断信息
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDeviceRequest) Reset() {
+	*x = GetDeviceRequest{}
+	mi := &file_gateway_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDeviceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDeviceRequest) ProtoMessage() {}
+
+func (x *GetDeviceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDeviceRequest.ProtoReflect.Descriptor instead.
+func (*GetDeviceRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetDeviceRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *GetDeviceRequest) GetVerbose() bool {
+	if x != nil {
+		return x.Verbose
+	}
+	return false
+}
+
+type ListDevicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Virtual       string                 `protobuf:"bytes,1,opt,name=virtual,proto3" json:"virtual,omitempty"`                          // expand: 已拆分设备展开为虚拟子设备
+	StationId     string                 `protobuf:"bytes,2,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"`     // 按站点过滤
+	DeviceType    int32                  `protobuf:"varint,3,opt,name=device_type,json=deviceType,proto3" json:"device_type,omitempty"` // 按设备类型过滤，0表示不限
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesRequest) Reset() {
+	*x = ListDevicesRequest{}
+	mi := &file_gateway_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesRequest) ProtoMessage() {}
+
+func (x *ListDevicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesRequest.ProtoReflect.Descriptor instead.
+func (*ListDevicesRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListDevicesRequest) GetVirtual() string {
+	if x != nil {
+		return x.Virtual
+	}
+	return ""
+}
+
+func (x *ListDevicesRequest) GetStationId() string {
+	if x != nil {
+		return x.StationId
+	}
+	return ""
+}
+
+func (x *ListDevicesRequest) GetDeviceType() int32 {
+	if x != nil {
+		return x.DeviceType
+	}
+	return 0
+}
+
+type GetPortStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPortStatusRequest) Reset() {
+	*x = GetPortStatusRequest{}
+	mi := &file_gateway_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPortStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPortStatusRequest) ProtoMessage() {}
+
+func (x *GetPortStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPortStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetPortStatusRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetPortStatusRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+type StartChargingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Port          uint32                 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Mode          uint32                 `protobuf:"varint,3,opt,name=mode,proto3" json:"mode,omitempty"`   // 0=按时间 1=按电量
+	Value         uint32                 `protobuf:"varint,4,opt,name=value,proto3" json:"value,omitempty"` // 时间(秒)/电量(0.1度)
+	OrderNo       string                 `protobuf:"bytes,5,opt,name=order_no,json=orderNo,proto3" json:"order_no,omitempty"`
+	Balance       uint32                 `protobuf:"varint,6,opt,name=balance,proto3" json:"balance,omitempty"` // 余额(分)
+	TenantId      string                 `protobuf:"bytes,7,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartChargingRequest) Reset() {
+	*x = StartChargingRequest{}
+	mi := &file_gateway_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartChargingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartChargingRequest) ProtoMessage() {}
+
+func (x *StartChargingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartChargingRequest.ProtoReflect.Descriptor instead.
+func (*StartChargingRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StartChargingRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *StartChargingRequest) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *StartChargingRequest) GetMode() uint32 {
+	if x != nil {
+		return x.Mode
+	}
+	return 0
+}
+
+func (x *StartChargingRequest) GetValue() uint32 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *StartChargingRequest) GetOrderNo() string {
+	if x != nil {
+		return x.OrderNo
+	}
+	return ""
+}
+
+func (x *StartChargingRequest) GetBalance() uint32 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+func (x *StartChargingRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+type StopChargingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Port          uint32                 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"` // 1-8或255(设备智能选择端口)
+	OrderNo       string                 `protobuf:"bytes,3,opt,name=order_no,json=orderNo,proto3" json:"order_no,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopChargingRequest) Reset() {
+	*x = StopChargingRequest{}
+	mi := &file_gateway_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopChargingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopChargingRequest) ProtoMessage() {}
+
+func (x *StopChargingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopChargingRequest.ProtoReflect.Descriptor instead.
+func (*StopChargingRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StopChargingRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *StopChargingRequest) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *StopChargingRequest) GetOrderNo() string {
+	if x != nil {
+		return x.OrderNo
+	}
+	return ""
+}
+
+type UpdateChargingPowerRequest struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId                 string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Port                     uint32                 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	OrderNo                  string                 `protobuf:"bytes,3,opt,name=order_no,json=orderNo,proto3" json:"order_no,omitempty"`
+	OverloadPowerW           uint32                 `protobuf:"varint,4,opt,name=overload_power_w,json=overloadPowerW,proto3" json:"overload_power_w,omitempty"`
+	MaxChargeDurationSeconds uint32                 `protobuf:"varint,5,opt,name=max_charge_duration_seconds,json=maxChargeDurationSeconds,proto3" json:"max_charge_duration_seconds,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *UpdateChargingPowerRequest) Reset() {
+	*x = UpdateChargingPowerRequest{}
+	mi := &file_gateway_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateChargingPowerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateChargingPowerRequest) ProtoMessage() {}
+
+func (x *UpdateChargingPowerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateChargingPowerRequest.ProtoReflect.Descriptor instead.
+func (*UpdateChargingPowerRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UpdateChargingPowerRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *UpdateChargingPowerRequest) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *UpdateChargingPowerRequest) GetOrderNo() string {
+	if x != nil {
+		return x.OrderNo
+	}
+	return ""
+}
+
+func (x *UpdateChargingPowerRequest) GetOverloadPowerW() uint32 {
+	if x != nil {
+		return x.OverloadPowerW
+	}
+	return 0
+}
+
+func (x *UpdateChargingPowerRequest) GetMaxChargeDurationSeconds() uint32 {
+	if x != nil {
+		return x.MaxChargeDurationSeconds
+	}
+	return 0
+}
+
+type ListChargingSessionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"` // 为空表示全部设备
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListChargingSessionsRequest) Reset() {
+	*x = ListChargingSessionsRequest{}
+	mi := &file_gateway_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListChargingSessionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChargingSessionsRequest) ProtoMessage() {}
+
+func (x *ListChargingSessionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListChargingSessionsRequest.ProtoReflect.Descriptor instead.
+func (*ListChargingSessionsRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListChargingSessionsRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Topics        []string               `protobuf:"bytes,1,rep,name=topics,proto3" json:"topics,omitempty"`                     // device/port/charging/alarm/system，为空表示全部
+	DeviceId      string                 `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"` // 按设备过滤
+	After         uint64                 `protobuf:"varint,3,opt,name=after,proto3" json:"after,omitempty"`                      // 回放游标
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_gateway_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SubscribeRequest) GetTopics() []string {
+	if x != nil {
+		return x.Topics
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetAfter() uint64 {
+	if x != nil {
+		return x.After
+	}
+	return 0
+}
+
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Topic         string                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	DeviceId      string                 `protobuf:"bytes,4,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	TimeUnixMs    int64                  `protobuf:"varint,5,opt,name=time_unix_ms,json=timeUnixMs,proto3" json:"time_unix_ms,omitempty"`
+	Payload       *structpb.Value        `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_gateway_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_gateway_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_gateway_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Event) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Event) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Event) GetTimeUnixMs() int64 {
+	if x != nil {
+		return x.TimeUnixMs
+	}
+	return 0
+}
+
+func (x *Event) GetPayload() *structpb.Value {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+var File_gateway_proto protoreflect.FileDescriptor
+
+const file_gateway_proto_rawDesc = "" +
+	"\n" +
+	"\rgateway.proto\x12\x12iotzinx.gateway.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x83\x01\n" +
+	"\x06Result\x12\x1f\n" +
+	"\vhttp_status\x18\x01 \x01(\x05R\n" +
+	"httpStatus\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12*\n" +
+	"\x04data\x18\x04 \x01(\v2\x16.google.protobuf.ValueR\x04data\"I\n" +
+	"\x10GetDeviceRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x18\n" +
+	"\averbose\x18\x02 \x01(\bR\averbose\"n\n" +
+	"\x12ListDevicesRequest\x12\x18\n" +
+	"\avirtual\x18\x01 \x01(\tR\avirtual\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x02 \x01(\tR\tstationId\x12\x1f\n" +
+	"\vdevice_type\x18\x03 \x01(\x05R\n" +
+	"deviceType\"3\n" +
+	"\x14GetPortStatusRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\"\xc3\x01\n" +
+	"\x14StartChargingRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\rR\x04port\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\rR\x04mode\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\rR\x05value\x12\x19\n" +
+	"\border_no\x18\x05 \x01(\tR\aorderNo\x12\x18\n" +
+	"\abalance\x18\x06 \x01(\rR\abalance\x12\x1b\n" +
+	"\ttenant_id\x18\a \x01(\tR\btenantId\"a\n" +
+	"\x13StopChargingRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\rR\x04port\x12\x19\n" +
+	"\border_no\x18\x03 \x01(\tR\aorderNo\"\xd1\x01\n" +
+	"\x1aUpdateChargingPowerRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\rR\x04port\x12\x19\n" +
+	"\border_no\x18\x03 \x01(\tR\aorderNo\x12(\n" +
+	"\x10overload_power_w\x18\x04 \x01(\rR\x0eoverloadPowerW\x12=\n" +
+	"\x1bmax_charge_duration_seconds\x18\x05 \x01(\rR\x18maxChargeDurationSeconds\":\n" +
+	"\x1bListChargingSessionsRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\"]\n" +
+	"\x10SubscribeRequest\x12\x16\n" +
+	"\x06topics\x18\x01 \x03(\tR\x06topics\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\tR\bdeviceId\x12\x14\n" +
+	"\x05after\x18\x03 \x01(\x04R\x05after\"\xb4\x01\n" +
+	"\x05Event\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\tR\x05topic\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x1b\n" +
+	"\tdevice_id\x18\x04 \x01(\tR\bdeviceId\x12 \n" +
+	"\ftime_unix_ms\x18\x05 \x01(\x03R\n" +
+	"timeUnixMs\x120\n" +
+	"\apayload\x18\x06 \x01(\v2\x16.google.protobuf.ValueR\apayload2\x86\x02\n" +
+	"\vDeviceQuery\x12M\n" +
+	"\tGetDevice\x12$.iotzinx.gateway.v1.GetDeviceRequest\x1a\x1a.iotzinx.gateway.v1.Result\x12Q\n" +
+	"\vListDevices\x12&.iotzinx.gateway.v1.ListDevicesRequest\x1a\x1a.iotzinx.gateway.v1.Result\x12U\n" +
+	"\rGetPortStatus\x12(.iotzinx.gateway.v1.GetPortStatusRequest\x1a\x1a.iotzinx.gateway.v1.Result2\x83\x03\n" +
+	"\rChargeControl\x12U\n" +
+	"\rStartCharging\x12(.iotzinx.gateway.v1.StartChargingRequest\x1a\x1a.iotzinx.gateway.v1.Result\x12S\n" +
+	"\fStopCharging\x12'.iotzinx.gateway.v1.StopChargingRequest\x1a\x1a.iotzinx.gateway.v1.Result\x12a\n" +
+	"\x13UpdateChargingPower\x12..iotzinx.gateway.v1.UpdateChargingPowerRequest\x1a\x1a.iotzinx.gateway.v1.Result\x12c\n" +
+	"\x14ListChargingSessions\x12/.iotzinx.gateway.v1.ListChargingSessionsRequest\x1a\x1a.iotzinx.gateway.v1.Result2]\n" +
+	"\vEventStream\x12N\n" +
+	"\tSubscribe\x12$.iotzinx.gateway.v1.SubscribeRequest\x1a\x19.iotzinx.gateway.v1.Event0\x01B3Z1github.com/bujia-iot/iot-zinx/pkg/grpcapi;grpcapib\x06proto3"
+
+var (
+	file_gateway_proto_rawDescOnce sync.Once
+	file_gateway_proto_rawDescData []byte
+)
+
+func file_gateway_proto_rawDescGZIP() []byte {
+	file_gateway_proto_rawDescOnce.Do(func() {
+		file_gateway_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_gateway_proto_rawDesc), len(file_gateway_proto_rawDesc)))
+	})
+	return file_gateway_proto_rawDescData
+}
+
+var file_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_gateway_proto_goTypes = []any{
+	(*Result)(nil),                      // 0: iotzinx.gateway.v1.Result
+	(*GetDeviceRequest)(nil),            // 1: iotzinx.gateway.v1.GetDeviceRequest
+	(*ListDevicesRequest)(nil),          // 2: iotzinx.gateway.v1.ListDevicesRequest
+	(*GetPortStatusRequest)(nil),        // 3: iotzinx.gateway.v1.GetPortStatusRequest
+	(*StartChargingRequest)(nil),        // 4: iotzinx.gateway.v1.StartChargingRequest
+	(*StopChargingRequest)(nil),         // 5: iotzinx.gateway.v1.StopChargingRequest
+	(*UpdateChargingPowerRequest)(nil),  // 6: iotzinx.gateway.v1.UpdateChargingPowerRequest
+	(*ListChargingSessionsRequest)(nil), // 7: iotzinx.gateway.v1.ListChargingSessionsRequest
+	(*SubscribeRequest)(nil),            // 8: iotzinx.gateway.v1.SubscribeRequest
+	(*Event)(nil),                       // 9: iotzinx.gateway.v1.Event
+	(*structpb.Value)(nil),              // 10: google.protobuf.Value
+}
+var file_gateway_proto_depIdxs = []int32{
+	10, // 0: iotzinx.gateway.v1.Result.data:type_name -> google.protobuf.Value
+	10, // 1: iotzinx.gateway.v1.Event.payload:type_name -> google.protobuf.Value
+	1,  // 2: iotzinx.gateway.v1.DeviceQuery.GetDevice:input_type -> iotzinx.gateway.v1.GetDeviceRequest
+	2,  // 3: iotzinx.gateway.v1.DeviceQuery.ListDevices:input_type -> iotzinx.gateway.v1.ListDevicesRequest
+	3,  // 4: iotzinx.gateway.v1.DeviceQuery.GetPortStatus:input_type -> iotzinx.gateway.v1.GetPortStatusRequest
+	4,  // 5: iotzinx.gateway.v1.ChargeControl.StartCharging:input_type -> iotzinx.gateway.v1.StartChargingRequest
+	5,  // 6: iotzinx.gateway.v1.ChargeControl.StopCharging:input_type -> iotzinx.gateway.v1.StopChargingRequest
+	6,  // 7: iotzinx.gateway.v1.ChargeControl.UpdateChargingPower:input_type -> iotzinx.gateway.v1.UpdateChargingPowerRequest
+	7,  // 8: iotzinx.gateway.v1.ChargeControl.ListChargingSessions:input_type -> iotzinx.gateway.v1.ListChargingSessionsRequest
+	8,  // 9: iotzinx.gateway.v1.EventStream.Subscribe:input_type -> iotzinx.gateway.v1.SubscribeRequest
+	0,  // 10: iotzinx.gateway.v1.DeviceQuery.GetDevice:output_type -> iotzinx.gateway.v1.Result
+	0,  // 11: iotzinx.gateway.v1.DeviceQuery.ListDevices:output_type -> iotzinx.gateway.v1.Result
+	0,  // 12: iotzinx.gateway.v1.DeviceQuery.GetPortStatus:output_type -> iotzinx.gateway.v1.Result
+	0,  // 13: iotzinx.gateway.v1.ChargeControl.StartCharging:output_type -> iotzinx.gateway.v1.Result
+	0,  // 14: iotzinx.gateway.v1.ChargeControl.StopCharging:output_type -> iotzinx.gateway.v1.Result
+	0,  // 15: iotzinx.gateway.v1.ChargeControl.UpdateChargingPower:output_type -> iotzinx.gateway.v1.Result
+	0,  // 16: iotzinx.gateway.v1.ChargeControl.ListChargingSessions:output_type -> iotzinx.gateway.v1.Result
+	9,  // 17: iotzinx.gateway.v1.EventStream.Subscribe:output_type -> iotzinx.gateway.v1.Event
+	10, // [10:18] is the sub-list for method output_type
+	2,  // [2:10] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_gateway_proto_init() }
+func file_gateway_proto_init() {
+	if File_gateway_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gateway_proto_rawDesc), len(file_gateway_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   3,
+		},
+		GoTypes:           file_gateway_proto_goTypes,
+		DependencyIndexes: file_gateway_proto_depIdxs,
+		MessageInfos:      file_gateway_proto_msgTypes,
+	}.Build()
+	File_gateway_proto = out.File
+	file_gateway_proto_goTypes = nil
+	file_gateway_proto_depIdxs = nil
+}
@@ -0,0 +1,554 @@
+// IoT-Zinx 网关 gRPC 接口（面向内部高频调用方）
+//
+// 各RPC与同名HTTP接口共用同一实现：请求字段名与HTTP请求参数一致（lowerCamelCase），
+// 结果以 Result 返回（与HTTP响应体 {code, message, data} 相同）；HTTP状态码非2xx时
+// 返回对应的gRPC错误码，Result 附在错误详情中。
+//
+// 生成代码：make proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: gateway.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DeviceQuery_GetDevice_FullMethodName     = "/iotzinx.gateway.v1.DeviceQuery/GetDevice"
+	DeviceQuery_ListDevices_FullMethodName   = "/iotzinx.gateway.v1.DeviceQuery/ListDevices"
+	DeviceQuery_GetPortStatus_FullMethodName = "/iotzinx.gateway.v1.DeviceQuery/GetPortStatus"
+)
+
+// DeviceQueryClient is the client API for DeviceQuery service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DeviceQuery 设备查询
+type DeviceQueryClient interface {
+	// GetDevice 设备详情（GET /api/v1/device/{deviceId}/status）
+	GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Result, error)
+	// ListDevices 在线设备列表（GET /api/v1/devices）
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*Result, error)
+	// GetPortStatus 设备端口状态（GET /api/v1/device/{deviceId}/ports）
+	GetPortStatus(ctx context.Context, in *GetPortStatusRequest, opts ...grpc.CallOption) (*Result, error)
+}
+
+type deviceQueryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeviceQueryClient(cc grpc.ClientConnInterface) DeviceQueryClient {
+	return &deviceQueryClient{cc}
+}
+
+func (c *deviceQueryClient) GetDevice(ctx context.Context, in *GetDeviceRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, DeviceQuery_GetDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deviceQueryClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, DeviceQuery_ListDevices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deviceQueryClient) GetPortStatus(ctx context.Context, in *GetPortStatusRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, DeviceQuery_GetPortStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeviceQueryServer is the server API for DeviceQuery service.
+// All implementations must embed UnimplementedDeviceQueryServer
+// for forward compatibility.
+//
+// DeviceQuery 设备查询
+type DeviceQueryServer interface {
+	// GetDevice 设备详情（GET /api/v1/device/{deviceId}/status）
+	GetDevice(context.Context, *GetDeviceRequest) (*Result, error)
+	// ListDevices 在线设备列表（GET /api/v1/devices）
+	ListDevices(context.Context, *ListDevicesRequest) (*Result, error)
+	// GetPortStatus 设备端口状态（GET /api/v1/device/{deviceId}/ports）
+	GetPortStatus(context.Context, *GetPortStatusRequest) (*Result, error)
+	mustEmbedUnimplementedDeviceQueryServer()
+}
+
+// UnimplementedDeviceQueryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDeviceQueryServer struct{}
+
+func (UnimplementedDeviceQueryServer) GetDevice(context.Context, *GetDeviceRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevice not implemented")
+}
+func (UnimplementedDeviceQueryServer) ListDevices(context.Context, *ListDevicesRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedDeviceQueryServer) GetPortStatus(context.Context, *GetPortStatusRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPortStatus not implemented")
+}
+func (UnimplementedDeviceQueryServer) mustEmbedUnimplementedDeviceQueryServer() {}
+func (UnimplementedDeviceQueryServer) testEmbeddedByValue()                     {}
+
+// UnsafeDeviceQueryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeviceQueryServer will
+// result in compilation errors.
+type UnsafeDeviceQueryServer interface {
+	mustEmbedUnimplementedDeviceQueryServer()
+}
+
+func RegisterDeviceQueryServer(s grpc.ServiceRegistrar, srv DeviceQueryServer) {
+	// If the following call pancis, it indicates UnimplementedDeviceQueryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DeviceQuery_ServiceDesc, srv)
+}
+
+func _DeviceQuery_GetDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceQueryServer).GetDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeviceQuery_GetDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceQueryServer).GetDevice(ctx, req.(*GetDeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeviceQuery_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceQueryServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeviceQuery_ListDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceQueryServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeviceQuery_GetPortStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPortStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceQueryServer).GetPortStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeviceQuery_GetPortStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceQueryServer).GetPortStatus(ctx, req.(*GetPortStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DeviceQuery_ServiceDesc is the grpc.ServiceDesc for DeviceQuery service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DeviceQuery_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "iotzinx.gateway.v1.DeviceQuery",
+	HandlerType: (*DeviceQueryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDevice",
+			Handler:    _DeviceQuery_GetDevice_Handler,
+		},
+		{
+			MethodName: "ListDevices",
+			Handler:    _DeviceQuery_ListDevices_Handler,
+		},
+		{
+			MethodName: "GetPortStatus",
+			Handler:    _DeviceQuery_GetPortStatus_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "gateway.proto",
+}
+
+const (
+	ChargeControl_StartCharging_FullMethodName        = "/iotzinx.gateway.v1.ChargeControl/StartCharging"
+	ChargeControl_StopCharging_FullMethodName         = "/iotzinx.gateway.v1.ChargeControl/StopCharging"
+	ChargeControl_UpdateChargingPower_FullMethodName  = "/iotzinx.gateway.v1.ChargeControl/UpdateChargingPower"
+	ChargeControl_ListChargingSessions_FullMethodName = "/iotzinx.gateway.v1.ChargeControl/ListChargingSessions"
+)
+
+// ChargeControlClient is the client API for ChargeControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ChargeControl 充电控制（幂等与并发保护与HTTP接口相同）
+type ChargeControlClient interface {
+	// StartCharging 开始充电（POST /api/v1/charging/start）
+	StartCharging(ctx context.Context, in *StartChargingRequest, opts ...grpc.CallOption) (*Result, error)
+	// StopCharging 停止充电（POST /api/v1/charging/stop）
+	StopCharging(ctx context.Context, in *StopChargingRequest, opts ...grpc.CallOption) (*Result, error)
+	// UpdateChargingPower 调整充电参数（POST /api/v1/charging/update_power）
+	UpdateChargingPower(ctx context.Context, in *UpdateChargingPowerRequest, opts ...grpc.CallOption) (*Result, error)
+	// ListChargingSessions 进行中的充电会话（GET /api/v1/charging/sessions）
+	ListChargingSessions(ctx context.Context, in *ListChargingSessionsRequest, opts ...grpc.CallOption) (*Result, error)
+}
+
+type chargeControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChargeControlClient(cc grpc.ClientConnInterface) ChargeControlClient {
+	return &chargeControlClient{cc}
+}
+
+func (c *chargeControlClient) StartCharging(ctx context.Context, in *StartChargingRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, ChargeControl_StartCharging_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeControlClient) StopCharging(ctx context.Context, in *StopChargingRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, ChargeControl_StopCharging_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeControlClient) UpdateChargingPower(ctx context.Context, in *UpdateChargingPowerRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, ChargeControl_UpdateChargingPower_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeControlClient) ListChargingSessions(ctx context.Context, in *ListChargingSessionsRequest, opts ...grpc.CallOption) (*Result, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Result)
+	err := c.cc.Invoke(ctx, ChargeControl_ListChargingSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChargeControlServer is the server API for ChargeControl service.
+// All implementations must embed UnimplementedChargeControlServer
+// for forward compatibility.
+//
+// ChargeControl 充电控制（幂等与并发保护与HTTP接口相同）
+type ChargeControlServer interface {
+	// StartCharging 开始充电（POST /api/v1/charging/start）
+	StartCharging(context.Context, *StartChargingRequest) (*Result, error)
+	// StopCharging 停止充电（POST /api/v1/charging/stop）
+	StopCharging(context.Context, *StopChargingRequest) (*Result, error)
+	// UpdateChargingPower 调整充电参数（POST /api/v1/charging/update_power）
+	UpdateChargingPower(context.Context, *UpdateChargingPowerRequest) (*Result, error)
+	// ListChargingSessions 进行中的充电会话（GET /api/v1/charging/sessions）
+	ListChargingSessions(context.Context, *ListChargingSessionsRequest) (*Result, error)
+	mustEmbedUnimplementedChargeControlServer()
+}
+
+// UnimplementedChargeControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChargeControlServer struct{}
+
+func (UnimplementedChargeControlServer) StartCharging(context.Context, *StartChargingRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartCharging not implemented")
+}
+func (UnimplementedChargeControlServer) StopCharging(context.Context, *StopChargingRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopCharging not implemented")
+}
+func (UnimplementedChargeControlServer) UpdateChargingPower(context.Context, *UpdateChargingPowerRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateChargingPower not implemented")
+}
+func (UnimplementedChargeControlServer) ListChargingSessions(context.Context, *ListChargingSessionsRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChargingSessions not implemented")
+}
+func (UnimplementedChargeControlServer) mustEmbedUnimplementedChargeControlServer() {}
+func (UnimplementedChargeControlServer) testEmbeddedByValue()                       {}
+
+// UnsafeChargeControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChargeControlServer will
+// result in compilation errors.
+type UnsafeChargeControlServer interface {
+	mustEmbedUnimplementedChargeControlServer()
+}
+
+func RegisterChargeControlServer(s grpc.ServiceRegistrar, srv ChargeControlServer) {
+	// If the following call pancis, it indicates UnimplementedChargeControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ChargeControl_ServiceDesc, srv)
+}
+
+func _ChargeControl_StartCharging_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartChargingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeControlServer).StartCharging(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeControl_StartCharging_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeControlServer).StartCharging(ctx, req.(*StartChargingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeControl_StopCharging_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopChargingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeControlServer).StopCharging(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeControl_StopCharging_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeControlServer).StopCharging(ctx, req.(*StopChargingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeControl_UpdateChargingPower_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateChargingPowerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeControlServer).UpdateChargingPower(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeControl_UpdateChargingPower_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeControlServer).UpdateChargingPower(ctx, req.(*UpdateChargingPowerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeControl_ListChargingSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChargingSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeControlServer).ListChargingSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeControl_ListChargingSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeControlServer).ListChargingSessions(ctx, req.(*ListChargingSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChargeControl_ServiceDesc is the grpc.ServiceDesc for ChargeControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChargeControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "iotzinx.gateway.v1.ChargeControl",
+	HandlerType: (*ChargeControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartCharging",
+			Handler:    _ChargeControl_StartCharging_Handler,
+		},
+		{
+			MethodName: "StopCharging",
+			Handler:    _ChargeControl_StopCharging_Handler,
+		},
+		{
+			MethodName: "UpdateChargingPower",
+			Handler:    _ChargeControl_UpdateChargingPower_Handler,
+		},
+		{
+			MethodName: "ListChargingSessions",
+			Handler:    _ChargeControl_ListChargingSessions_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "gateway.proto",
+}
+
+const (
+	EventStream_Subscribe_FullMethodName = "/iotzinx.gateway.v1.EventStream/Subscribe"
+)
+
+// EventStreamClient is the client API for EventStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EventStream 事件总线订阅
+type EventStreamClient interface {
+	// Subscribe 订阅事件：after>0 时回放序号大于该值的事件（断线重连时传入最后收到的序号）
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type eventStreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventStreamClient(cc grpc.ClientConnInterface) EventStreamClient {
+	return &eventStreamClient{cc}
+}
+
+func (c *eventStreamClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EventStream_ServiceDesc.Streams[0], EventStream_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventStream_SubscribeClient = grpc.ServerStreamingClient[Event]
+
+// EventStreamServer is the server API for EventStream service.
+// All implementations must embed UnimplementedEventStreamServer
+// for forward compatibility.
+//
+// EventStream 事件总线订阅
+type EventStreamServer interface {
+	// Subscribe 订阅事件：after>0 时回放序号大于该值的事件（断线重连时传入最后收到的序号）
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedEventStreamServer()
+}
+
+// UnimplementedEventStreamServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEventStreamServer struct{}
+
+func (UnimplementedEventStreamServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedEventStreamServer) mustEmbedUnimplementedEventStreamServer() {}
+func (UnimplementedEventStreamServer) testEmbeddedByValue()                     {}
+
+// UnsafeEventStreamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EventStreamServer will
+// result in compilation errors.
+type UnsafeEventStreamServer interface {
+	mustEmbedUnimplementedEventStreamServer()
+}
+
+func RegisterEventStreamServer(s grpc.ServiceRegistrar, srv EventStreamServer) {
+	// If the following call pancis, it indicates UnimplementedEventStreamServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EventStream_ServiceDesc, srv)
+}
+
+func _EventStream_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventStreamServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EventStream_SubscribeServer = grpc.ServerStreamingServer[Event]
+
+// EventStream_ServiceDesc is the grpc.ServiceDesc for EventStream service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EventStream_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "iotzinx.gateway.v1.EventStream",
+	HandlerType: (*EventStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _EventStream_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gateway.proto",
+}
@@ -0,0 +1,429 @@
+package handlerguard
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsCollectorName /metrics 中处理器panic指标的注册名
+const MetricsCollectorName = "handler_guard"
+
+const (
+	defaultMaxRecords       = 200
+	defaultDeviceWindow     = 5 * time.Minute
+	defaultDeviceThreshold  = 3
+	defaultDeviceQuarantine = 10 * time.Minute
+)
+
+// Options 处理器panic恢复选项
+type Options struct {
+	QuarantineDir    string        // 隔离记录持久化目录，为空仅保存在内存
+	MaxRecords       int           // 保留的隔离记录数上限
+	ReproDir         string        // 复现包输出目录，为空不生成
+	DeviceWindow     time.Duration // 统计同一设备panic次数的窗口
+	DeviceThreshold  int           // 窗口内panic达到该次数时隔离设备
+	DeviceQuarantine time.Duration // 设备隔离时长
+}
+
+// DeviceQuarantine 被隔离的设备
+type DeviceQuarantine struct {
+	DeviceID      string    `json:"device_id"`
+	Since         time.Time `json:"since"`
+	Until         time.Time `json:"until"`
+	Panics        int       `json:"panics"`         // 触发隔离时窗口内的panic次数
+	DroppedFrames int64     `json:"dropped_frames"` // 隔离期间丢弃的帧数
+}
+
+// Stats 处理器panic统计
+type Stats struct {
+	TotalPanics         int64              `json:"total_panics"`
+	ByCommand           map[string]int64   `json:"by_command"` // 命令标识 → panic次数
+	DroppedFrames       int64              `json:"dropped_frames"`
+	QuarantinedDevices  []DeviceQuarantine `json:"quarantined_devices"` // 隔离中的设备
+	Records             int                `json:"records"`
+	PersistErrors       int64              `json:"persist_errors"`
+	QuarantineDir       string             `json:"quarantine_dir,omitempty"`
+	ReproDir            string             `json:"repro_dir,omitempty"`
+	DevicePanicWindow   int                `json:"device_panic_window_seconds"`
+	DevicePanicThresh   int                `json:"device_panic_threshold"`
+	DeviceQuarantineFor int                `json:"device_quarantine_seconds"`
+}
+
+// deviceState 设备窗口内的panic时间与隔离状态
+type deviceState struct {
+	panics     []time.Time
+	quarantine *DeviceQuarantine
+}
+
+// Guard 处理器panic恢复：捕获panic、隔离原始帧、按命令计数，并隔离反复触发panic的设备
+type Guard struct {
+	opts  Options
+	store *quarantineStore
+	now   func() time.Time
+
+	mu        sync.Mutex
+	byCommand map[uint32]int64
+	devices   map[string]*deviceState
+
+	totalPanics int64
+	dropped     int64
+}
+
+// New 创建处理器panic恢复器，持久化目录中已有的隔离记录会被加载
+func New(opts Options) (*Guard, error) {
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = defaultMaxRecords
+	}
+	if opts.DeviceWindow <= 0 {
+		opts.DeviceWindow = defaultDeviceWindow
+	}
+	if opts.DeviceThreshold <= 0 {
+		opts.DeviceThreshold = defaultDeviceThreshold
+	}
+	if opts.DeviceQuarantine <= 0 {
+		opts.DeviceQuarantine = defaultDeviceQuarantine
+	}
+	store, err := openQuarantineStore(opts.QuarantineDir, opts.MaxRecords)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{
+		opts:      opts,
+		store:     store,
+		now:       time.Now,
+		byCommand: make(map[uint32]int64),
+		devices:   make(map[string]*deviceState),
+	}, nil
+}
+
+// Options 当前生效的选项
+func (g *Guard) Options() Options {
+	return g.opts
+}
+
+// SetClock 替换时钟（测试使用）
+func (g *Guard) SetClock(now func() time.Time) {
+	g.now = now
+}
+
+// Wrap 包装处理器：每次调用在同一个 recover 内依次执行 PreHandle/Handle/PostHandle
+func Wrap(msgID uint32, router ziface.IRouter) ziface.IRouter {
+	return &guardedRouter{msgID: msgID, inner: router}
+}
+
+// guardedRouter 带panic恢复的处理器，调用时使用当前全局恢复器
+type guardedRouter struct {
+	msgID uint32
+	inner ziface.IRouter
+}
+
+func (r *guardedRouter) PreHandle(ziface.IRequest) {}
+
+func (r *guardedRouter) Handle(request ziface.IRequest) {
+	GetGlobalGuard().Invoke(r.msgID, request, r.inner)
+}
+
+func (r *guardedRouter) PostHandle(ziface.IRequest) {}
+
+// Unwrap 被包装的处理器
+func (r *guardedRouter) Unwrap() ziface.IRouter {
+	return r.inner
+}
+
+// Invoke 执行处理器；隔离中设备的帧直接丢弃，处理器panic时记录隔离并恢复，连接不受影响
+func (g *Guard) Invoke(msgID uint32, request ziface.IRequest, router ziface.IRouter) {
+	frame, decodeErr := decodeFrame(request)
+	deviceID := deviceKey(request, frame)
+	if g.dropIfQuarantined(deviceID) {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			g.recordPanic(msgID, request, router, frame, decodeErr, deviceID, p, debug.Stack())
+		}
+	}()
+	router.PreHandle(request)
+	router.Handle(request)
+	router.PostHandle(request)
+}
+
+// decodeFrame 按处理器的方式解码帧，供隔离记录保存解码状态（解码本身panic时返回错误）
+func decodeFrame(request ziface.IRequest) (frame *protocol.DecodedDNYFrame, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			frame, err = nil, fmt.Errorf("解码panic: %v", p)
+		}
+	}()
+	return (&protocol.SimpleHandlerBase{}).ExtractDecodedFrame(request)
+}
+
+// deviceKey 设备标识：标准帧取物理ID，ICCID/link心跳等无设备ID的帧按连接区分
+func deviceKey(request ziface.IRequest, frame *protocol.DecodedDNYFrame) string {
+	if frame != nil && frame.DeviceID != "" {
+		return frame.DeviceID
+	}
+	if conn := request.GetConnection(); conn != nil {
+		return fmt.Sprintf("conn-%d", conn.GetConnID())
+	}
+	return ""
+}
+
+// dropIfQuarantined 设备隔离中时丢弃帧并计数，隔离到期后解除
+func (g *Guard) dropIfQuarantined(deviceID string) bool {
+	if deviceID == "" {
+		return false
+	}
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st, ok := g.devices[deviceID]
+	if !ok || st.quarantine == nil {
+		return false
+	}
+	if !now.Before(st.quarantine.Until) {
+		logger.WithField("deviceID", deviceID).Info("设备处理器panic隔离到期，恢复处理")
+		st.quarantine = nil
+		st.panics = nil
+		return false
+	}
+	st.quarantine.DroppedFrames++
+	g.dropped++
+	return true
+}
+
+// recordPanic 记录panic：日志、命令计数、隔离记录与复现包、设备窗口计数
+func (g *Guard) recordPanic(msgID uint32, request ziface.IRequest, router ziface.IRouter, frame *protocol.DecodedDNYFrame,
+	decodeErr error, deviceID string, p interface{}, stack []byte) {
+	now := g.now()
+	rec := Record{
+		Time:     now,
+		MsgID:    msgID,
+		Command:  commandLabel(msgID),
+		Handler:  handlerType(router),
+		Panic:    fmt.Sprint(p),
+		Stack:    string(stack),
+		FrameHex: strings.ToUpper(fmt.Sprintf("%x", request.GetData())),
+		Decode:   newDecodeState(frame, decodeErr),
+	}
+	if frame != nil {
+		rec.DeviceID = frame.DeviceID
+		if frame.FrameType == protocol.FrameTypeStandard {
+			rec.MessageID = fmt.Sprintf("0x%04X", frame.MessageID)
+		}
+	}
+	if conn := request.GetConnection(); conn != nil {
+		rec.ConnID = conn.GetConnID()
+		if addr := conn.RemoteAddr(); addr != nil {
+			rec.RemoteAddr = addr.String()
+		}
+	}
+
+	g.mu.Lock()
+	g.totalPanics++
+	g.byCommand[msgID]++
+	quarantined := g.countDevicePanicLocked(deviceID, now)
+	g.mu.Unlock()
+	rec.DeviceQuarantined = quarantined
+
+	rec = g.store.add(rec)
+	if g.opts.ReproDir != "" {
+		path, err := writeReproBundle(g.opts.ReproDir, rec)
+		if err != nil {
+			logger.WithField("error", err.Error()).Warn("生成处理器panic复现包失败")
+		} else {
+			rec.ReproPath = path
+			g.store.update(rec)
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"connID":      rec.ConnID,
+		"deviceID":    rec.DeviceID,
+		"command":     rec.Command,
+		"messageID":   rec.MessageID,
+		"handler":     rec.Handler,
+		"panic":       rec.Panic,
+		"quarantine":  rec.ID,
+		"deviceBlock": quarantined,
+		"stack":       rec.Stack,
+	}).Error("❌ 处理器panic，原始帧已隔离")
+}
+
+// countDevicePanicLocked 统计设备窗口内panic次数，达到阈值时隔离设备（调用方持有锁）
+func (g *Guard) countDevicePanicLocked(deviceID string, now time.Time) bool {
+	if deviceID == "" {
+		return false
+	}
+	st, ok := g.devices[deviceID]
+	if !ok {
+		st = &deviceState{}
+		g.devices[deviceID] = st
+	}
+	cutoff := now.Add(-g.opts.DeviceWindow)
+	kept := st.panics[:0]
+	for _, at := range st.panics {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	st.panics = append(kept, now)
+	if st.quarantine != nil || len(st.panics) < g.opts.DeviceThreshold {
+		return false
+	}
+	st.quarantine = &DeviceQuarantine{
+		DeviceID: deviceID,
+		Since:    now,
+		Until:    now.Add(g.opts.DeviceQuarantine),
+		Panics:   len(st.panics),
+	}
+	logger.WithFields(logrus.Fields{
+		"deviceID": deviceID,
+		"panics":   len(st.panics),
+		"window":   g.opts.DeviceWindow.String(),
+		"until":    st.quarantine.Until.Format(time.RFC3339),
+	}).Warn("⚠️ 设备反复触发处理器panic，隔离期间丢弃其帧")
+	return true
+}
+
+// Records 最近的隔离记录（新→旧）
+func (g *Guard) Records(limit int) []Record {
+	return g.store.list(limit)
+}
+
+// Record 按ID查询隔离记录
+func (g *Guard) Record(id string) (Record, bool) {
+	return g.store.get(id)
+}
+
+// Stats 统计快照
+func (g *Guard) Stats() Stats {
+	now := g.now()
+	g.mu.Lock()
+	stats := Stats{
+		TotalPanics:         g.totalPanics,
+		ByCommand:           make(map[string]int64, len(g.byCommand)),
+		DroppedFrames:       g.dropped,
+		QuarantinedDevices:  []DeviceQuarantine{},
+		QuarantineDir:       g.opts.QuarantineDir,
+		ReproDir:            g.opts.ReproDir,
+		DevicePanicWindow:   int(g.opts.DeviceWindow / time.Second),
+		DevicePanicThresh:   g.opts.DeviceThreshold,
+		DeviceQuarantineFor: int(g.opts.DeviceQuarantine / time.Second),
+	}
+	for msgID, n := range g.byCommand {
+		stats.ByCommand[commandLabel(msgID)] = n
+	}
+	for _, st := range g.devices {
+		if st.quarantine != nil && now.Before(st.quarantine.Until) {
+			stats.QuarantinedDevices = append(stats.QuarantinedDevices, *st.quarantine)
+		}
+	}
+	g.mu.Unlock()
+	sort.Slice(stats.QuarantinedDevices, func(i, j int) bool {
+		return stats.QuarantinedDevices[i].Since.After(stats.QuarantinedDevices[j].Since)
+	})
+	stats.Records, stats.PersistErrors = g.store.stats()
+	return stats
+}
+
+// WritePrometheus 以 Prometheus 文本格式写出各命令panic计数与隔离设备数
+func (g *Guard) WritePrometheus(w io.Writer) {
+	g.mu.Lock()
+	msgIDs := make([]uint32, 0, len(g.byCommand))
+	for msgID := range g.byCommand {
+		msgIDs = append(msgIDs, msgID)
+	}
+	sort.Slice(msgIDs, func(i, j int) bool { return msgIDs[i] < msgIDs[j] })
+	fmt.Fprintf(w, "# HELP iot_handler_panics_total Handler panics recovered per command.\n# TYPE iot_handler_panics_total counter\n")
+	for _, msgID := range msgIDs {
+		fmt.Fprintf(w, "iot_handler_panics_total{command=\"0x%02X\"} %d\n", msgID, g.byCommand[msgID])
+	}
+	fmt.Fprintf(w, "# HELP iot_handler_quarantine_dropped_frames_total Frames dropped from quarantined devices.\n# TYPE iot_handler_quarantine_dropped_frames_total counter\n")
+	fmt.Fprintf(w, "iot_handler_quarantine_dropped_frames_total %d\n", g.dropped)
+	g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP iot_handler_quarantined_devices Devices quarantined after repeated handler panics.\n# TYPE iot_handler_quarantined_devices gauge\n")
+	fmt.Fprintf(w, "iot_handler_quarantined_devices %d\n", len(g.Stats().QuarantinedDevices))
+}
+
+// handlerType 处理器类型，逐层展开包装（如自定义处理器的计数包装）
+func handlerType(router ziface.IRouter) string {
+	for {
+		wrapper, ok := router.(interface{ Unwrap() ziface.IRouter })
+		if !ok {
+			return fmt.Sprintf("%T", router)
+		}
+		router = wrapper.Unwrap()
+	}
+}
+
+// commandLabel 命令标识：DNY命令码加名称，特殊消息ID按类型命名
+func commandLabel(msgID uint32) string {
+	switch msgID {
+	case constants.MsgIDICCID:
+		return "ICCID"
+	case constants.MsgIDLinkHeartbeat:
+		return "link心跳"
+	case constants.MsgIDUnknown, constants.MsgIDErrorFrame:
+		return fmt.Sprintf("0x%04X 未知数据", msgID)
+	}
+	if msgID > 0xFF {
+		return fmt.Sprintf("0x%04X", msgID)
+	}
+	return constants.CommandLabel(uint8(msgID))
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalGuard atomic.Pointer[Guard]
+
+// GetGlobalGuard 获取全局处理器panic恢复器（未初始化时按默认选项创建，仅保存在内存）
+func GetGlobalGuard() *Guard {
+	if g := globalGuard.Load(); g != nil {
+		return g
+	}
+	g, _ := New(Options{})
+	if !globalGuard.CompareAndSwap(nil, g) {
+		return globalGuard.Load()
+	}
+	return g
+}
+
+// InitGlobalGuard 按配置创建全局处理器panic恢复器；持久化目录不可用时退化为仅内存并返回错误
+func InitGlobalGuard() (*Guard, error) {
+	cfg := config.GetConfig().HandlerGuard
+	opts := Options{
+		QuarantineDir:    cfg.QuarantineDir,
+		MaxRecords:       cfg.MaxRecords,
+		ReproDir:         cfg.ReproDir,
+		DeviceWindow:     time.Duration(cfg.DeviceWindowSeconds) * time.Second,
+		DeviceThreshold:  cfg.DevicePanicThreshold,
+		DeviceQuarantine: time.Duration(cfg.DeviceQuarantineSeconds) * time.Second,
+	}
+	g, err := New(opts)
+	if err != nil {
+		opts.QuarantineDir = ""
+		g, _ = New(opts)
+	}
+	globalGuard.Store(g)
+	return g, err
+}
+
+// SetGlobalGuard 替换全局处理器panic恢复器（测试使用，传nil后按默认选项重新创建）
+func SetGlobalGuard(g *Guard) {
+	globalGuard.Store(g)
+}
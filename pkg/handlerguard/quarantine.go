@@ -0,0 +1,208 @@
+package handlerguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// Record 隔离记录：触发处理器panic的原始帧、解码状态与现场信息
+type Record struct {
+	ID                string      `json:"id"`
+	Time              time.Time   `json:"time"`
+	ConnID            uint64      `json:"conn_id"`
+	RemoteAddr        string      `json:"remote_addr,omitempty"`
+	DeviceID          string      `json:"device_id,omitempty"`
+	MsgID             uint32      `json:"msg_id"`
+	Command           string      `json:"command"`
+	MessageID         string      `json:"message_id,omitempty"`
+	Handler           string      `json:"handler"`
+	Panic             string      `json:"panic"`
+	Stack             string      `json:"stack"`
+	FrameHex          string      `json:"frame_hex"` // 交给处理器的完整原始帧
+	Decode            DecodeState `json:"decode"`
+	DeviceQuarantined bool        `json:"device_quarantined"` // 本次panic使设备进入隔离
+	ReproPath         string      `json:"repro_path,omitempty"`
+}
+
+// DecodeState 帧交给处理器时的解码状态
+type DecodeState struct {
+	FrameType     string `json:"frame_type"`
+	Decoded       bool   `json:"decoded"`
+	Error         string `json:"error,omitempty"`
+	DeviceID      string `json:"device_id,omitempty"`
+	PhysicalIDHex string `json:"physical_id_hex,omitempty"` // 原始4字节物理ID（小端）
+	MessageID     uint16 `json:"message_id"`
+	Command       uint8  `json:"command"`
+	PayloadLen    int    `json:"payload_len"`
+	PayloadHex    string `json:"payload_hex,omitempty"`
+	ChecksumValid bool   `json:"checksum_valid"`
+	ICCID         string `json:"iccid,omitempty"`
+}
+
+func newDecodeState(frame *protocol.DecodedDNYFrame, err error) DecodeState {
+	if frame == nil {
+		state := DecodeState{FrameType: protocol.FrameTypeParseError.String()}
+		if err != nil {
+			state.Error = err.Error()
+		}
+		return state
+	}
+	return DecodeState{
+		FrameType:     frame.FrameType.String(),
+		Decoded:       true,
+		Error:         frame.ErrorMessage,
+		DeviceID:      frame.DeviceID,
+		PhysicalIDHex: strings.ToUpper(fmt.Sprintf("%x", frame.RawPhysicalID)),
+		MessageID:     frame.MessageID,
+		Command:       frame.Command,
+		PayloadLen:    len(frame.Payload),
+		PayloadHex:    strings.ToUpper(fmt.Sprintf("%x", frame.Payload)),
+		ChecksumValid: frame.IsChecksumValid,
+		ICCID:         frame.ICCIDValue,
+	}
+}
+
+// quarantineStore 有界隔离记录：内存保留最近 capacity 条，配置目录时每条写为一个JSON文件并同步删除淘汰的记录
+type quarantineStore struct {
+	dir      string
+	capacity int
+
+	mu            sync.Mutex
+	records       []Record // 旧→新
+	seq           uint64
+	persistErrors int64
+}
+
+// openQuarantineStore 打开隔离记录目录并加载已有记录（按文件名即时间顺序，超出上限的最旧记录被删除）
+func openQuarantineStore(dir string, capacity int) (*quarantineStore, error) {
+	s := &quarantineStore{dir: dir, capacity: capacity}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建隔离目录失败: %w", err)
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("读取隔离记录失败: %w", err)
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil || rec.ID == "" {
+			logger.WithField("file", name).Warn("跳过无法解析的隔离记录")
+			continue
+		}
+		s.records = append(s.records, rec)
+	}
+	s.seq = uint64(len(s.records))
+	s.evictLocked()
+	return s, nil
+}
+
+// add 分配ID并保存记录
+func (s *quarantineStore) add(rec Record) Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	rec.ID = fmt.Sprintf("%s-%06d", rec.Time.Format("20060102-150405.000000"), s.seq%1000000)
+	s.records = append(s.records, rec)
+	s.persistLocked(rec)
+	s.evictLocked()
+	return rec
+}
+
+// update 更新已保存的记录（如补充复现包路径）
+func (s *quarantineStore) update(rec Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if s.records[i].ID == rec.ID {
+			s.records[i] = rec
+			s.persistLocked(rec)
+			return
+		}
+	}
+}
+
+func (s *quarantineStore) persistLocked(rec Record) {
+	if s.dir == "" {
+		return
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(s.dir, rec.ID+".json"), data)
+	}
+	if err != nil {
+		s.persistErrors++
+		logger.WithField("error", err.Error()).Warn("保存隔离记录失败，仅保存在内存中")
+	}
+}
+
+// evictLocked 淘汰超出上限的最旧记录
+func (s *quarantineStore) evictLocked() {
+	excess := len(s.records) - s.capacity
+	if excess <= 0 {
+		return
+	}
+	for _, rec := range s.records[:excess] {
+		if s.dir != "" {
+			_ = os.Remove(filepath.Join(s.dir, rec.ID+".json"))
+		}
+	}
+	s.records = append(s.records[:0], s.records[excess:]...)
+}
+
+// list 最近的记录（新→旧）
+func (s *quarantineStore) list(limit int) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.records)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	items := make([]Record, 0, limit)
+	for i := n - 1; i >= n-limit; i-- {
+		items = append(items, s.records[i])
+	}
+	return items
+}
+
+func (s *quarantineStore) get(id string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range s.records {
+		if rec.ID == id {
+			return rec, true
+		}
+	}
+	return Record{}, false
+}
+
+func (s *quarantineStore) stats() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records), s.persistErrors
+}
+
+// writeFileAtomic 先写临时文件再改名，避免进程崩溃留下半个文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
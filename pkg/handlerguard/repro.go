@@ -0,0 +1,80 @@
+package handlerguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// reproTestTemplate 复现测试骨架：带 repro 构建标签，不参与常规测试；复制到仓库内后以 go test -tags repro 运行
+var reproTestTemplate = template.Must(template.New("repro").Parse(`//go:build repro
+
+package repro
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// frameHex 隔离记录 {{.ID}} 的原始帧
+const frameHex = "{{.FrameHex}}"
+
+// TestRepro{{.Name}} 复现 {{.Time}} 设备 {{.DeviceID}} 命令 {{.Command}} 在 {{.Handler}} 中的panic
+// panic: {{.Panic}}
+func TestRepro{{.Name}}(t *testing.T) {
+	raw, err := hex.DecodeString(frameHex)
+	if err != nil {
+		t.Fatalf("帧十六进制无效: %v", err)
+	}
+	msgID, msg := protocol.NewDNYDecoder().(*protocol.DNY_Decoder).DecodeFrame(1, raw)
+	if msgID != 0x{{.MsgID}} {
+		t.Fatalf("解码消息ID 0x%04X，隔离时为 0x{{.MsgID}}", msgID)
+	}
+	t.Logf("解码结果: %+v", msg)
+
+	// TODO: 以 znet.NewRequest(conn, zpack.NewMsgPackage(msgID, raw)) 构造请求交给 {{.Handler}}，复现并修复panic
+}
+`))
+
+// writeReproBundle 生成复现包：<dir>/<id>/ 下的 frame.hex、record.json 与 repro_test.go，返回目录路径
+func writeReproBundle(dir string, rec Record) (string, error) {
+	bundle := filepath.Join(dir, rec.ID)
+	if err := os.MkdirAll(bundle, 0o755); err != nil {
+		return "", fmt.Errorf("创建复现包目录失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(bundle, "frame.hex"), []byte(rec.FrameHex+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	rec.ReproPath = bundle
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(bundle, "record.json"), data, 0o644); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = reproTestTemplate.Execute(&b, map[string]string{
+		"ID":       rec.ID,
+		"Name":     strings.NewReplacer("-", "_", ".", "_").Replace(rec.ID),
+		"Time":     rec.Time.Format("2006-01-02 15:04:05"),
+		"DeviceID": rec.DeviceID,
+		"Command":  rec.Command,
+		"Handler":  rec.Handler,
+		"Panic":    strings.ReplaceAll(rec.Panic, "\n", " "),
+		"FrameHex": rec.FrameHex,
+		"MsgID":    fmt.Sprintf("%04X", rec.MsgID),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(bundle, "repro_test.go"), []byte(b.String()), 0o644); err != nil {
+		return "", err
+	}
+	return bundle, nil
+}
@@ -0,0 +1,157 @@
+// Package idempotency 订单号幂等窗口：窗口内重复提交的同一订单号被拒绝。
+// 配置Redis时经 SETNX 在多实例间共享，Redis降级或未配置时改用进程内LRU（仅对本实例有效）。
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTTL      = 60 * time.Second
+	defaultCapacity = 10000
+	keyPrefix       = "iot:idempotency:"
+	storeTimeout    = time.Second
+)
+
+// Source 本次判定使用的存储
+const (
+	SourceRedis = "redis"
+	SourceLocal = "local"
+)
+
+type localEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// Guard 幂等窗口
+type Guard struct {
+	client   *redis.Client
+	ttl      time.Duration
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List // 最近使用在前
+	index map[string]*list.Element
+
+	warned atomic.Bool // 本次降级是否已记录告警
+	now    func() time.Time
+}
+
+// NewGuard 创建幂等窗口；client 为 nil 时只使用进程内LRU
+func NewGuard(client *redis.Client, ttl time.Duration, capacity int) *Guard {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+	return &Guard{client: client, ttl: ttl, capacity: capacity, order: list.New(), index: make(map[string]*list.Element), now: time.Now}
+}
+
+// TTL 幂等窗口时长
+func (g *Guard) TTL() time.Duration {
+	return g.ttl
+}
+
+// Claim 登记键：窗口内首次出现返回 true；同时返回本次判定使用的存储。
+// 本地LRU始终同步登记，Redis中断前登记的键在降级期间仍可在本实例识别
+func (g *Guard) Claim(key string) (bool, string) {
+	if g.client != nil && !infraredis.Degraded() {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		fresh, err := g.client.SetNX(ctx, keyPrefix+key, 1, g.ttl).Result()
+		cancel()
+		if err == nil {
+			g.warned.Store(false)
+			g.claimLocal(key, true)
+			return fresh, SourceRedis
+		}
+		g.warn(err.Error())
+	} else if g.client != nil {
+		g.warn("Redis降级运行中")
+	}
+	return g.claimLocal(key, false), SourceLocal
+}
+
+// Release 撤销登记（命令下发失败时调用，允许调用方立即重试）
+func (g *Guard) Release(key string) {
+	g.mu.Lock()
+	if e, ok := g.index[key]; ok {
+		g.order.Remove(e)
+		delete(g.index, key)
+	}
+	g.mu.Unlock()
+	if g.client != nil && !infraredis.Degraded() {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		_ = g.client.Del(ctx, keyPrefix+key).Err()
+		cancel()
+	}
+}
+
+// claimLocal 在本地LRU登记；force 为 true 时覆盖（Redis已判定），返回是否为窗口内首次
+func (g *Guard) claimLocal(key string, force bool) bool {
+	now := g.now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if e, ok := g.index[key]; ok {
+		entry := e.Value.(*localEntry)
+		if !force && now.Before(entry.expiresAt) {
+			return false
+		}
+		entry.expiresAt = now.Add(g.ttl)
+		g.order.MoveToFront(e)
+		return true
+	}
+	g.index[key] = g.order.PushFront(&localEntry{key: key, expiresAt: now.Add(g.ttl)})
+	for g.order.Len() > g.capacity {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.index, oldest.Value.(*localEntry).key)
+	}
+	return true
+}
+
+// warn 每次降级只记录一次告警
+func (g *Guard) warn(reason string) {
+	if g.warned.CompareAndSwap(false, true) {
+		logger.WithFields(logrus.Fields{"reason": reason}).Warn("⚠️ 订单号幂等窗口改用进程内LRU，仅对本实例有效（多实例部署时重复订单可能经其他实例下发）")
+	}
+}
+
+// ===============================
+// 全局幂等窗口
+// ===============================
+
+var globalGuard atomic.Pointer[Guard]
+
+// GetGlobalGuard 获取全局幂等窗口（未启用时为 nil）
+func GetGlobalGuard() *Guard {
+	return globalGuard.Load()
+}
+
+// SetGlobalGuard 设置全局幂等窗口（测试或自定义装配使用）
+func SetGlobalGuard(g *Guard) {
+	globalGuard.Store(g)
+}
+
+// InitGlobalGuard 按 httpApiServer.idempotency 配置初始化全局幂等窗口，未启用时置空
+func InitGlobalGuard() *Guard {
+	cfg := config.GetConfig().HTTPAPIServer.Idempotency
+	if !cfg.Enabled {
+		SetGlobalGuard(nil)
+		return nil
+	}
+	g := NewGuard(infraredis.GetClient(), time.Duration(cfg.TTLSeconds)*time.Second, cfg.LocalCapacity)
+	SetGlobalGuard(g)
+	return g
+}
@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+)
+
+const (
+	defaultKeyTTL      = 24 * time.Hour
+	defaultKeyCapacity = 10000
+)
+
+// KeyState Idempotency-Key 登记结果
+type KeyState int
+
+const (
+	KeyNew      KeyState = iota // 首次出现，调用方执行请求后调用 Complete 或 Abort
+	KeyInFlight                 // 同一键的首个请求仍在执行
+	KeyReplay                   // 已完成，返回首个请求的应答
+	KeyMismatch                 // 同一键的请求体与首个请求不一致
+)
+
+// Response 已完成请求的应答，重放时原样写回
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type keyEntry struct {
+	key         string
+	fingerprint string
+	resp        *Response // nil 表示进行中
+	expiresAt   time.Time
+}
+
+// Responses 调用方幂等键的应答重放表（进程内LRU）：同一键的重试在窗口内重放首个应答，不再次执行
+type Responses struct {
+	ttl      time.Duration
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List // 最近使用在前
+	index map[string]*list.Element
+	now   func() time.Time
+}
+
+// NewResponses 创建应答重放表
+func NewResponses(ttl time.Duration, capacity int) *Responses {
+	if ttl <= 0 {
+		ttl = defaultKeyTTL
+	}
+	if capacity <= 0 {
+		capacity = defaultKeyCapacity
+	}
+	return &Responses{ttl: ttl, capacity: capacity, order: list.New(), index: make(map[string]*list.Element), now: time.Now}
+}
+
+// TTL 重放窗口时长
+func (r *Responses) TTL() time.Duration {
+	return r.ttl
+}
+
+// Begin 登记键；fingerprint 为请求体摘要，同一键携带不同请求体视为误用
+func (r *Responses) Begin(key, fingerprint string) (*Response, KeyState) {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.index[key]; ok {
+		entry := e.Value.(*keyEntry)
+		if now.Before(entry.expiresAt) {
+			r.order.MoveToFront(e)
+			switch {
+			case entry.fingerprint != fingerprint:
+				return nil, KeyMismatch
+			case entry.resp == nil:
+				return nil, KeyInFlight
+			}
+			return entry.resp, KeyReplay
+		}
+		r.order.Remove(e)
+		delete(r.index, key)
+	}
+	r.index[key] = r.order.PushFront(&keyEntry{key: key, fingerprint: fingerprint, expiresAt: now.Add(r.ttl)})
+	for r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.index, oldest.Value.(*keyEntry).key)
+	}
+	return nil, KeyNew
+}
+
+// Complete 记录首个请求的应答，窗口自完成时起算
+func (r *Responses) Complete(key string, resp Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.index[key]; ok {
+		entry := e.Value.(*keyEntry)
+		entry.resp = &resp
+		entry.expiresAt = r.now().Add(r.ttl)
+	}
+}
+
+// Abort 撤销登记（请求未得到确定结果，允许同一键立即重试）
+func (r *Responses) Abort(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.index[key]; ok {
+		r.order.Remove(e)
+		delete(r.index, key)
+	}
+}
+
+// SetNowFunc 替换时钟（测试使用）
+func (r *Responses) SetNowFunc(now func() time.Time) {
+	r.mu.Lock()
+	r.now = now
+	r.mu.Unlock()
+}
+
+// ===============================
+// 全局应答重放表
+// ===============================
+
+var globalResponses atomic.Pointer[Responses]
+
+// GetGlobalResponses 获取全局应答重放表（未启用时为 nil）
+func GetGlobalResponses() *Responses {
+	return globalResponses.Load()
+}
+
+// SetGlobalResponses 设置全局应答重放表（测试或自定义装配使用）
+func SetGlobalResponses(r *Responses) {
+	globalResponses.Store(r)
+}
+
+// InitGlobalResponses 按 httpApiServer.idempotency 配置初始化全局应答重放表，未启用时置空
+func InitGlobalResponses() *Responses {
+	cfg := config.GetConfig().HTTPAPIServer.Idempotency
+	if !cfg.Enabled {
+		SetGlobalResponses(nil)
+		return nil
+	}
+	r := NewResponses(time.Duration(cfg.KeyTTLSeconds)*time.Second, cfg.KeyCapacity)
+	SetGlobalResponses(r)
+	return r
+}
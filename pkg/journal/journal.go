@@ -0,0 +1,628 @@
+// Package journal 关键业务帧预写日志
+//
+// 结算(0x03)等关键上行帧在发送协议应答前追加到本地日志并 fsync，下游交接（通知入队/会话更新）
+// 完成后写入处理标记；进程崩溃后启动时重放未处理条目，保证至少处理一次。
+// 日志按段轮转，已处理的段在保留期后删除；总大小超过上限时降级为"处理后应答"模式并告警。
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultJournalDir      = "./data/journal"
+	defaultSegmentMaxBytes = 4 << 20
+	defaultMaxTotalBytes   = 64 << 20
+	defaultRetention       = 24 * time.Hour
+	segmentPrefix          = "frames-"
+	segmentSuffix          = ".wal"
+	recoverRatio           = 0.8 // 降级后总大小回落到上限的该比例以下才恢复预写
+)
+
+// 日志记录类型
+const (
+	opAppend = "append"
+	opDone   = "done"
+)
+
+// 告警类型
+const (
+	AlertDegraded  = "degraded"  // 超过大小上限，降级为处理后应答
+	AlertRecovered = "recovered" // 空间释放，恢复预写
+)
+
+var (
+	// ErrJournalFull 日志总大小超过上限
+	ErrJournalFull = errors.New("关键帧日志已满")
+	// ErrJournalDegraded 日志处于降级模式，不再预写
+	ErrJournalDegraded = errors.New("关键帧日志处于降级模式")
+)
+
+// Entry 日志条目：原始帧与处理所需的元数据
+type Entry struct {
+	ID         string    `json:"id"`
+	Key        string    `json:"key"` // 幂等键（设备+命令+载荷摘要），设备重发同一帧时相同
+	Command    byte      `json:"command"`
+	DeviceID   string    `json:"device_id"`
+	PhysicalID uint32    `json:"physical_id"`
+	MessageID  uint16    `json:"message_id"`
+	Payload    []byte    `json:"payload"`
+	RawFrame   []byte    `json:"raw_frame,omitempty"`
+	ConnID     uint64    `json:"conn_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// record 日志中的一行
+type record struct {
+	Op    string    `json:"op"`
+	Entry *Entry    `json:"entry,omitempty"`
+	ID    string    `json:"id,omitempty"`
+	Key   string    `json:"key,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// segment 日志段
+type segment struct {
+	seq       int
+	path      string
+	size      int64
+	live      int // 段内尚未处理的条目数
+	lastWrite time.Time
+}
+
+// pendingEntry 未处理条目及其所在段
+type pendingEntry struct {
+	entry Entry
+	seq   int
+}
+
+// Alert 日志告警
+type Alert struct {
+	Type          string    `json:"type"`
+	Reason        string    `json:"reason"`
+	TotalBytes    int64     `json:"total_bytes"`
+	MaxTotalBytes int64     `json:"max_total_bytes"`
+	Pending       int       `json:"pending"`
+	At            time.Time `json:"at"`
+}
+
+// AlertHandler 告警回调（通知等外部集成由调用方注册）
+type AlertHandler func(alert Alert)
+
+// ReplayResult 启动重放结果
+type ReplayResult struct {
+	Total     int `json:"total"`
+	Replayed  int `json:"replayed"`
+	Duplicate int `json:"duplicate"` // 幂等键已处理，直接标记
+	Failed    int `json:"failed"`    // 重放失败，保留待下次启动
+}
+
+// Stats 日志统计
+type Stats struct {
+	Enabled       bool       `json:"enabled"`
+	Degraded      bool       `json:"degraded"`
+	DegradedSince *time.Time `json:"degraded_since,omitempty"`
+	Segments      int        `json:"segments"`
+	TotalBytes    int64      `json:"total_bytes"`
+	MaxTotalBytes int64      `json:"max_total_bytes"`
+	Pending       int        `json:"pending"`
+	Appended      int64      `json:"appended"`
+	Processed     int64      `json:"processed"`
+	Replayed      int64      `json:"replayed"`
+	Duplicates    int64      `json:"duplicates"`
+	Degradations  int64      `json:"degradations"`
+}
+
+// Journal 基于本地文件的关键帧预写日志
+type Journal struct {
+	mutex      sync.Mutex
+	dir        string
+	commands   map[byte]bool
+	segmentMax int64
+	maxTotal   int64
+	retention  time.Duration
+
+	segments      []*segment // 按序号升序，最后一个为当前写入段
+	active        *os.File
+	pending       map[string]pendingEntry
+	processedKeys map[string]time.Time // 幂等键 → 处理时间（保留期内）
+	totalBytes    int64
+
+	degraded      bool
+	degradedSince time.Time
+	stats         Stats
+	alertHandlers []AlertHandler
+}
+
+// Open 打开（或创建）日志目录，加载未处理条目与已处理幂等键
+func Open(cfg config.FrameJournalConfig) (*Journal, error) {
+	j := &Journal{
+		dir:           cfg.Dir,
+		commands:      make(map[byte]bool),
+		segmentMax:    cfg.SegmentMaxBytes,
+		maxTotal:      cfg.MaxTotalBytes,
+		retention:     time.Duration(cfg.RetentionHours) * time.Hour,
+		pending:       make(map[string]pendingEntry),
+		processedKeys: make(map[string]time.Time),
+	}
+	if j.dir == "" {
+		j.dir = defaultJournalDir
+	}
+	if j.segmentMax <= 0 {
+		j.segmentMax = defaultSegmentMaxBytes
+	}
+	if j.maxTotal <= 0 {
+		j.maxTotal = defaultMaxTotalBytes
+	}
+	if j.retention <= 0 {
+		j.retention = defaultRetention
+	}
+	for _, cmd := range cfg.Commands {
+		if cmd < 0 || cmd > 0xFF {
+			return nil, fmt.Errorf("关键帧命令 %d 超出范围", cmd)
+		}
+		j.commands[byte(cmd)] = true
+	}
+
+	if err := os.MkdirAll(j.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建关键帧日志目录失败: %w", err)
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.openActive(); err != nil {
+		return nil, err
+	}
+
+	j.mutex.Lock()
+	j.compactLocked(time.Now(), false)
+	if j.totalBytes >= j.maxTotal {
+		j.degradeLocked(time.Now(), "启动时日志总大小已超过上限")
+	}
+	pending := len(j.pending)
+	j.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"dir":      j.dir,
+		"segments": len(j.segments),
+		"pending":  pending,
+	}).Info("✅ 关键帧预写日志已打开")
+	return j, nil
+}
+
+// load 按段顺序读取日志，重建未处理条目
+func (j *Journal) load() error {
+	paths, err := filepath.Glob(filepath.Join(j.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return fmt.Errorf("扫描关键帧日志失败: %w", err)
+	}
+	for _, path := range paths {
+		var seq int
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+		if _, err := fmt.Sscanf(name, "%d", &seq); err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("读取关键帧日志段失败: %w", err)
+		}
+		j.segments = append(j.segments, &segment{seq: seq, path: path, size: info.Size(), lastWrite: info.ModTime()})
+		j.totalBytes += info.Size()
+	}
+	sort.Slice(j.segments, func(a, b int) bool { return j.segments[a].seq < j.segments[b].seq })
+
+	bySeq := make(map[int]*segment, len(j.segments))
+	for _, seg := range j.segments {
+		bySeq[seg.seq] = seg
+		if err := j.loadSegment(seg); err != nil {
+			return err
+		}
+	}
+	for _, p := range j.pending {
+		bySeq[p.seq].live++
+	}
+	return nil
+}
+
+func (j *Journal) loadSegment(seg *segment) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return fmt.Errorf("打开关键帧日志段失败: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// 崩溃时最后一行可能只写了一半：该条目未fsync，也未发送应答，设备会重发
+			logger.WithFields(logrus.Fields{"segment": seg.path, "line": line}).Warn("⚠️ 跳过损坏的关键帧日志记录")
+			continue
+		}
+		switch rec.Op {
+		case opAppend:
+			if rec.Entry != nil {
+				j.pending[rec.Entry.ID] = pendingEntry{entry: *rec.Entry, seq: seg.seq}
+			}
+		case opDone:
+			delete(j.pending, rec.ID)
+			if rec.Key != "" {
+				j.processedKeys[rec.Key] = rec.At
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// openActive 打开当前写入段（最后一段未满时续写，否则新建）
+func (j *Journal) openActive() error {
+	if n := len(j.segments); n > 0 && j.segments[n-1].size < j.segmentMax {
+		f, err := os.OpenFile(j.segments[n-1].path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("打开关键帧日志段失败: %w", err)
+		}
+		j.active = f
+		return nil
+	}
+	return j.rotateLocked(time.Now())
+}
+
+// rotateLocked 关闭当前段并新建下一段
+func (j *Journal) rotateLocked(now time.Time) error {
+	seq := 1
+	if n := len(j.segments); n > 0 {
+		seq = j.segments[n-1].seq + 1
+	}
+	path := filepath.Join(j.dir, fmt.Sprintf("%s%08d%s", segmentPrefix, seq, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("创建关键帧日志段失败: %w", err)
+	}
+	if j.active != nil {
+		_ = j.active.Close()
+	}
+	j.active = f
+	j.segments = append(j.segments, &segment{seq: seq, path: path, lastWrite: now})
+	return nil
+}
+
+// writeLocked 追加一行并 fsync
+func (j *Journal) writeLocked(rec record, now time.Time) (*segment, error) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("序列化关键帧日志记录失败: %w", err)
+	}
+	line = append(line, '\n')
+
+	seg := j.segments[len(j.segments)-1]
+	if seg.size > 0 && seg.size+int64(len(line)) > j.segmentMax {
+		if err := j.rotateLocked(now); err != nil {
+			return nil, err
+		}
+		seg = j.segments[len(j.segments)-1]
+	}
+	if _, err := j.active.Write(line); err != nil {
+		return nil, fmt.Errorf("写入关键帧日志失败: %w", err)
+	}
+	if err := j.active.Sync(); err != nil {
+		return nil, fmt.Errorf("关键帧日志fsync失败: %w", err)
+	}
+	seg.size += int64(len(line))
+	seg.lastWrite = now
+	j.totalBytes += int64(len(line))
+	return seg, nil
+}
+
+// IsCritical 命令是否需要预写
+func (j *Journal) IsCritical(command byte) bool {
+	return j != nil && j.commands[command]
+}
+
+// Append 预写一条关键帧（返回后方可发送应答）；超过大小上限时降级并返回 ErrJournalFull，
+// 降级期间返回 ErrJournalDegraded，调用方应改为处理完成后再应答
+func (j *Journal) Append(entry Entry) (Entry, error) {
+	now := time.Now()
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+	if entry.ReceivedAt.IsZero() {
+		entry.ReceivedAt = now
+	}
+
+	j.mutex.Lock()
+	if j.degraded {
+		j.compactLocked(now, true)
+		if float64(j.totalBytes) >= float64(j.maxTotal)*recoverRatio {
+			j.mutex.Unlock()
+			return entry, ErrJournalDegraded
+		}
+		j.recoverLocked(now)
+	}
+	if j.totalBytes >= j.maxTotal {
+		j.compactLocked(now, true)
+		if j.totalBytes >= j.maxTotal {
+			j.degradeLocked(now, "日志总大小超过上限")
+			j.mutex.Unlock()
+			return entry, ErrJournalFull
+		}
+	}
+	seg, err := j.writeLocked(record{Op: opAppend, Entry: &entry, At: now}, now)
+	if err != nil {
+		j.mutex.Unlock()
+		return entry, err
+	}
+	seg.live++
+	j.pending[entry.ID] = pendingEntry{entry: entry, seq: seg.seq}
+	j.stats.Appended++
+	j.mutex.Unlock()
+	return entry, nil
+}
+
+// MarkProcessed 标记条目下游交接完成，记录幂等键
+func (j *Journal) MarkProcessed(id string) error {
+	now := time.Now()
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	p, ok := j.pending[id]
+	if !ok {
+		return nil
+	}
+	if _, err := j.writeLocked(record{Op: opDone, ID: id, Key: p.entry.Key, At: now}, now); err != nil {
+		return err
+	}
+	delete(j.pending, id)
+	for _, seg := range j.segments {
+		if seg.seq == p.seq {
+			seg.live--
+			break
+		}
+	}
+	if p.entry.Key != "" {
+		j.processedKeys[p.entry.Key] = now
+	}
+	j.stats.Processed++
+	j.compactLocked(now, false)
+	return nil
+}
+
+// IsProcessed 幂等键在保留期内是否已处理（设备重发或重放重复时跳过下游交接）
+func (j *Journal) IsProcessed(key string) bool {
+	if j == nil || key == "" {
+		return false
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	_, ok := j.processedKeys[key]
+	return ok
+}
+
+// RecordDuplicate 记录一次被幂等保护拦截的重复帧
+func (j *Journal) RecordDuplicate() {
+	j.mutex.Lock()
+	j.stats.Duplicates++
+	j.mutex.Unlock()
+}
+
+// Pending 未处理条目（按接收时间升序）
+func (j *Journal) Pending() []Entry {
+	j.mutex.Lock()
+	entries := make([]Entry, 0, len(j.pending))
+	for _, p := range j.pending {
+		entries = append(entries, p.entry)
+	}
+	j.mutex.Unlock()
+	sort.Slice(entries, func(a, b int) bool { return entries[a].ReceivedAt.Before(entries[b].ReceivedAt) })
+	return entries
+}
+
+// Replay 逐条重放未处理条目：幂等键已处理的直接标记，处理成功后标记，失败的保留待下次启动
+func (j *Journal) Replay(handle func(entry Entry) error) ReplayResult {
+	var result ReplayResult
+	for _, entry := range j.Pending() {
+		result.Total++
+		if j.IsProcessed(entry.Key) {
+			result.Duplicate++
+			j.RecordDuplicate()
+			_ = j.MarkProcessed(entry.ID)
+			continue
+		}
+		if err := handle(entry); err != nil {
+			result.Failed++
+			logger.WithFields(logrus.Fields{
+				"entryID":  entry.ID,
+				"deviceID": entry.DeviceID,
+				"command":  dny_protocol.CommandLabel(entry.Command),
+				"error":    err.Error(),
+			}).Error("❌ 关键帧重放失败，保留待下次启动")
+			continue
+		}
+		if err := j.MarkProcessed(entry.ID); err != nil {
+			result.Failed++
+			continue
+		}
+		result.Replayed++
+	}
+	j.mutex.Lock()
+	j.stats.Replayed += int64(result.Replayed)
+	j.mutex.Unlock()
+	return result
+}
+
+// compactLocked 删除无未处理条目的旧段：保留期外的总是删除；force 时为释放空间忽略保留期（幂等键仍保留在内存中）
+func (j *Journal) compactLocked(now time.Time, force bool) {
+	if force {
+		if cur := j.segments[len(j.segments)-1]; cur.live == 0 && cur.size > 0 {
+			if err := j.rotateLocked(now); err != nil {
+				logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("关键帧日志轮转失败")
+			}
+		}
+	}
+	// 只删除最旧的连续段：完成记录总在其条目之后，删除前缀不会让更早段中的条目因丢失完成记录而复活
+	kept := j.segments[:0]
+	last := len(j.segments) - 1
+	for i, seg := range j.segments {
+		if len(kept) > 0 || i == last || seg.live > 0 || (!force && now.Sub(seg.lastWrite) < j.retention) {
+			kept = append(kept, seg)
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			logger.WithFields(logrus.Fields{"segment": seg.path, "error": err.Error()}).Warn("删除关键帧日志段失败")
+			kept = append(kept, seg)
+			continue
+		}
+		j.totalBytes -= seg.size
+	}
+	j.segments = kept
+
+	for key, at := range j.processedKeys {
+		if now.Sub(at) >= j.retention {
+			delete(j.processedKeys, key)
+		}
+	}
+}
+
+func (j *Journal) degradeLocked(now time.Time, reason string) {
+	if j.degraded {
+		return
+	}
+	j.degraded = true
+	j.degradedSince = now
+	j.stats.Degradations++
+	alert := Alert{Type: AlertDegraded, Reason: reason, TotalBytes: j.totalBytes, MaxTotalBytes: j.maxTotal, Pending: len(j.pending), At: now}
+	logger.WithFields(logrus.Fields{
+		"reason":        reason,
+		"totalBytes":    j.totalBytes,
+		"maxTotalBytes": j.maxTotal,
+		"pending":       len(j.pending),
+	}).Error("🚨 关键帧预写日志已降级：改为处理完成后再应答，崩溃时可能丢失正在处理的帧")
+	j.emitLocked(alert)
+}
+
+func (j *Journal) recoverLocked(now time.Time) {
+	j.degraded = false
+	alert := Alert{Type: AlertRecovered, Reason: "日志空间已释放", TotalBytes: j.totalBytes, MaxTotalBytes: j.maxTotal, Pending: len(j.pending), At: now}
+	logger.WithFields(logrus.Fields{
+		"totalBytes":     j.totalBytes,
+		"degradedMillis": now.Sub(j.degradedSince).Milliseconds(),
+	}).Info("✅ 关键帧预写日志已恢复")
+	j.emitLocked(alert)
+}
+
+// emitLocked 异步调用告警回调，避免回调阻塞帧处理
+func (j *Journal) emitLocked(alert Alert) {
+	for _, handler := range j.alertHandlers {
+		go handler(alert)
+	}
+}
+
+// RegisterAlertHandler 注册告警回调
+func (j *Journal) RegisterAlertHandler(handler AlertHandler) {
+	if handler == nil {
+		return
+	}
+	j.mutex.Lock()
+	j.alertHandlers = append(j.alertHandlers, handler)
+	j.mutex.Unlock()
+}
+
+// HandlerCount 已注册的告警回调数量（装配自检使用）
+func (j *Journal) HandlerCount() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.alertHandlers)
+}
+
+// IsDegraded 是否处于降级模式
+func (j *Journal) IsDegraded() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.degraded
+}
+
+// Stats 获取日志统计
+func (j *Journal) Stats() Stats {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	stats := j.stats
+	stats.Enabled = true
+	stats.Degraded = j.degraded
+	if j.degraded {
+		since := j.degradedSince
+		stats.DegradedSince = &since
+	}
+	stats.Segments = len(j.segments)
+	stats.TotalBytes = j.totalBytes
+	stats.MaxTotalBytes = j.maxTotal
+	stats.Pending = len(j.pending)
+	return stats
+}
+
+// Close 关闭当前写入段
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.active == nil {
+		return nil
+	}
+	err := j.active.Close()
+	j.active = nil
+	return err
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalJournal atomic.Pointer[Journal]
+
+// GetGlobalJournal 获取全局关键帧日志，未启用时返回nil（调用方按处理后应答执行）
+func GetGlobalJournal() *Journal {
+	return globalJournal.Load()
+}
+
+// InitGlobalJournal 按配置打开全局关键帧日志（未启用时不创建）
+func InitGlobalJournal() (*Journal, error) {
+	cfg := config.GetConfig().FrameJournal
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	j, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	globalJournal.Store(j)
+	return j, nil
+}
+
+// SetGlobalJournal 替换全局关键帧日志（测试使用，传nil表示停用）
+func SetGlobalJournal(j *Journal) {
+	globalJournal.Store(j)
+}
+
+// StopGlobalJournal 关闭全局关键帧日志
+func StopGlobalJournal() {
+	if j := globalJournal.Swap(nil); j != nil {
+		_ = j.Close()
+	}
+}
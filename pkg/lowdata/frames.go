@@ -0,0 +1,126 @@
+package lowdata
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// FrameOverheadBytes DNY帧除数据外的字节数："DNY"(3)+长度(2)+物理ID(4)+消息ID(2)+命令(1)+校验(2)
+const FrameOverheadBytes = 14
+
+// ResponseClass 服务器应答的低流量分类
+type ResponseClass string
+
+const (
+	ResponseRequired ResponseClass = "required"  // 协议要求应答（未应答设备会重发、离线或丢失数据），任何模式下都发送
+	ResponseOptional ResponseClass = "optional"  // 协议标注“无须应答”，低流量模式下抑制
+	ResponseTimeSync ResponseClass = "time_sync" // 对时：去重窗口内已应答过的设备不再应答
+)
+
+// 协议标注为无须应答的上行命令（AP3000协议文档）；0x41/0x43/0x44 无命令常量
+const (
+	cmdChargeStartNotify = 0x41 // 充电柜专有：充电开始通知
+	cmdChargeEndNotify   = 0x43 // 充电柜专有：充电结束通知
+	cmdChargeStatusPush  = 0x44 // 充电柜专有：充电状态推送
+)
+
+var optionalResponses = map[uint8]string{
+	constants.CmdUpgradeRequest: "设备主动请求升级",
+	constants.CmdPowerHeartbeat: "端口充电时功率心跳",
+	constants.CmdMainHeartbeat:  "主机状态心跳",
+	cmdChargeStartNotify:        "充电开始通知",
+	constants.CmdAlarm:          "报警推送",
+	cmdChargeEndNotify:          "充电结束通知",
+	cmdChargeStatusPush:         "充电状态推送",
+}
+
+var timeSyncResponses = map[uint8]string{
+	constants.CmdGetServerTime: "主机获取服务器时间",
+	constants.CmdDeviceTime:    "设备获取服务器时间",
+}
+
+// ClassifyResponse 应答命令的分类；未列出的命令（结算、心跳、注册等）一律为必须应答
+func ClassifyResponse(command uint8) ResponseClass {
+	if _, ok := optionalResponses[command]; ok {
+		return ResponseOptional
+	}
+	if _, ok := timeSyncResponses[command]; ok {
+		return ResponseTimeSync
+	}
+	return ResponseRequired
+}
+
+// PollKind 网关主动下发的查询
+type PollKind string
+
+const (
+	PollReadDeadlineProbe    PollKind = "read_deadline_probe"    // 读超时前的0x81联网状态探测（设备心跳即可维持在线）
+	PollHeartbeatConfigQuery PollKind = "heartbeat_config_query" // 自适应心跳的0x90运行参数查询（推送最大心跳间隔依赖）
+	PollRegistrationSolicit  PollKind = "registration_solicit"   // 注册补登的0x81查询（缺少注册信息时无法处理业务帧）
+)
+
+var essentialPolls = map[PollKind]bool{
+	PollReadDeadlineProbe:    false,
+	PollHeartbeatConfigQuery: true,
+	PollRegistrationSolicit:  true,
+}
+
+var pollLabels = map[PollKind]string{
+	PollReadDeadlineProbe:    "读超时前联网状态探测(0x81)",
+	PollHeartbeatConfigQuery: "自适应心跳运行参数查询(0x90)",
+	PollRegistrationSolicit:  "注册补登查询(0x81)",
+}
+
+// IsEssentialPoll 必要的主动查询在低流量模式下仍然下发
+func IsEssentialPoll(kind PollKind) bool {
+	return essentialPolls[kind]
+}
+
+// FrameLength 数据长度为 dataLen 的DNY帧字节数
+func FrameLength(dataLen int) int {
+	return FrameOverheadBytes + dataLen
+}
+
+// ClassificationEntry 分类表条目（只读接口展示）
+type ClassificationEntry struct {
+	Command   string        `json:"command,omitempty"`
+	Poll      PollKind      `json:"poll,omitempty"`
+	Label     string        `json:"label"`
+	Class     ResponseClass `json:"class,omitempty"`
+	Essential bool          `json:"essential,omitempty"`
+}
+
+// Classification 可抑制的应答与主动查询一览；未列出的应答均为必须应答
+func Classification() []ClassificationEntry {
+	var entries []ClassificationEntry
+	add := func(m map[uint8]string, class ResponseClass) {
+		cmds := make([]int, 0, len(m))
+		for c := range m {
+			cmds = append(cmds, int(c))
+		}
+		sort.Ints(cmds)
+		for _, c := range cmds {
+			entries = append(entries, ClassificationEntry{Command: fmt.Sprintf("0x%02X", c), Label: m[uint8(c)], Class: class})
+		}
+	}
+	add(optionalResponses, ResponseOptional)
+	add(timeSyncResponses, ResponseTimeSync)
+	for _, kind := range []PollKind{PollReadDeadlineProbe, PollHeartbeatConfigQuery, PollRegistrationSolicit} {
+		entries = append(entries, ClassificationEntry{Poll: kind, Label: pollLabels[kind], Essential: essentialPolls[kind]})
+	}
+	return entries
+}
+
+// responseKey 流量报告中被抑制帧的分类键，如 ack:0x06、time_sync:0x22、poll:read_deadline_probe
+func responseKey(class ResponseClass, command uint8) string {
+	if class == ResponseTimeSync {
+		return fmt.Sprintf("time_sync:0x%02X", command)
+	}
+	return fmt.Sprintf("ack:0x%02X", command)
+}
+
+func pollKey(kind PollKind) string {
+	return "poll:" + string(kind)
+}
@@ -0,0 +1,145 @@
+// Package lowdata 按流量计费SIM卡的低流量模式：按租户或ICCID启用后，抑制协议标注为无须应答的可选应答、
+// 对重复的对时请求去重、通过自适应心跳推送允许的最大心跳间隔、合并下行帧写入并抑制非必要的主动查询。
+// 每个连接按“反事实”方式估算节省的字节数（被抑制的帧若发送将产生的字节 + 合并写入省下的TCP/IP报文开销），
+// 供流量报告展示。模式分配文件可热加载，加载失败保留旧分配。
+package lowdata
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 模式来源
+const (
+	SourceICCID  = "iccid"
+	SourceTenant = "tenant"
+)
+
+// Settings 一组低流量行为开关；未填写的项继承上一级（ICCID → 租户 → defaults），最终未填写的项为开启
+type Settings struct {
+	SuppressOptionalAcks   *bool `yaml:"suppressOptionalAcks" json:"suppressOptionalAcks,omitempty"`     // 抑制协议标注为无须应答的应答
+	DedupTimeSync          *bool `yaml:"dedupTimeSync" json:"dedupTimeSync,omitempty"`                   // 去重窗口内的重复对时请求不再应答
+	PushMaxHeartbeat       *bool `yaml:"pushMaxHeartbeat" json:"pushMaxHeartbeat,omitempty"`             // 自适应心跳推送允许的最大间隔
+	CoalesceOutbound       *bool `yaml:"coalesceOutbound" json:"coalesceOutbound,omitempty"`             // 合并下行帧写入
+	SuppressProactivePolls *bool `yaml:"suppressProactivePolls" json:"suppressProactivePolls,omitempty"` // 抑制非必要的主动查询
+}
+
+// Effective 生效的低流量行为
+type Effective struct {
+	SuppressOptionalAcks   bool `json:"suppressOptionalAcks"`
+	DedupTimeSync          bool `json:"dedupTimeSync"`
+	PushMaxHeartbeat       bool `json:"pushMaxHeartbeat"`
+	CoalesceOutbound       bool `json:"coalesceOutbound"`
+	SuppressProactivePolls bool `json:"suppressProactivePolls"`
+}
+
+// Policy 模式分配文件内容：tenants 与 iccids 中列出的连接启用低流量模式，exclude 中的ICCID始终不启用
+type Policy struct {
+	Defaults Settings            `yaml:"defaults" json:"defaults"`
+	Tenants  map[string]Settings `yaml:"tenants" json:"tenants,omitempty"`
+	ICCIDs   map[string]Settings `yaml:"iccids" json:"iccids,omitempty"`
+	Exclude  []string            `yaml:"exclude" json:"exclude,omitempty"`
+}
+
+// Mode 连接的低流量模式
+type Mode struct {
+	Enabled   bool      `json:"enabled"`
+	Source    string    `json:"source,omitempty"` // iccid | tenant
+	ICCID     string    `json:"iccid,omitempty"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	Excluded  bool      `json:"excluded,omitempty"` // ICCID 在 exclude 中（租户启用也不生效）
+	Effective Effective `json:"effective"`
+}
+
+// ParsePolicy 解析并校验模式分配文件
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("解析低流量模式分配失败: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate 校验分配：租户与ICCID不能为空，同一ICCID不能既分配又排除
+func (p *Policy) Validate() error {
+	for tenant := range p.Tenants {
+		if tenant == "" {
+			return fmt.Errorf("租户名称不能为空")
+		}
+	}
+	for iccid := range p.ICCIDs {
+		if iccid == "" {
+			return fmt.Errorf("ICCID不能为空")
+		}
+	}
+	for _, iccid := range p.Exclude {
+		if iccid == "" {
+			return fmt.Errorf("exclude 包含空ICCID")
+		}
+		if _, ok := p.ICCIDs[iccid]; ok {
+			return fmt.Errorf("ICCID %s 同时出现在 iccids 与 exclude 中", iccid)
+		}
+	}
+	return nil
+}
+
+// Resolve 连接的低流量模式：exclude 优先，其次ICCID分配，再次租户分配；未分配时不启用
+func (p *Policy) Resolve(iccid, tenantID string) Mode {
+	mode := Mode{ICCID: iccid, TenantID: tenantID}
+	if iccid != "" {
+		for _, ex := range p.Exclude {
+			if ex == iccid {
+				mode.Excluded = true
+				return mode
+			}
+		}
+	}
+	chain := []Settings{p.Defaults}
+	if s, ok := p.Tenants[tenantID]; ok && tenantID != "" {
+		mode.Enabled, mode.Source = true, SourceTenant
+		chain = append(chain, s)
+	}
+	if s, ok := p.ICCIDs[iccid]; ok && iccid != "" {
+		mode.Enabled, mode.Source = true, SourceICCID
+		chain = append(chain, s)
+	}
+	if mode.Enabled {
+		mode.Effective = merge(chain)
+	}
+	return mode
+}
+
+// merge 由低到高依次覆盖，未填写的项为开启
+func merge(chain []Settings) Effective {
+	pick := func(get func(Settings) *bool) bool {
+		v := true
+		for _, s := range chain {
+			if b := get(s); b != nil {
+				v = *b
+			}
+		}
+		return v
+	}
+	return Effective{
+		SuppressOptionalAcks:   pick(func(s Settings) *bool { return s.SuppressOptionalAcks }),
+		DedupTimeSync:          pick(func(s Settings) *bool { return s.DedupTimeSync }),
+		PushMaxHeartbeat:       pick(func(s Settings) *bool { return s.PushMaxHeartbeat }),
+		CoalesceOutbound:       pick(func(s Settings) *bool { return s.CoalesceOutbound }),
+		SuppressProactivePolls: pick(func(s Settings) *bool { return s.SuppressProactivePolls }),
+	}
+}
+
+// TenantIDs 分配了低流量模式的租户（排序）
+func (p *Policy) TenantIDs() []string {
+	ids := make([]string, 0, len(p.Tenants))
+	for id := range p.Tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
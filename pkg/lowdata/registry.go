@@ -0,0 +1,484 @@
+package lowdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCoalesceWindow      = 50 * time.Millisecond
+	defaultCoalesceMaxBytes    = 1024
+	defaultTimeSyncDedup       = 60 * time.Second
+	defaultPacketOverheadBytes = 40 // IPv4+TCP 报头（不含选项），每次独立写入按一个报文估算
+)
+
+// ErrPollSuppressed 低流量模式下非必要的主动查询被抑制
+var ErrPollSuppressed = errors.New("低流量模式：非必要主动查询已抑制")
+
+// Locator 查询设备所在连接的ICCID与租户（由网关注入，避免依赖连接管理器）
+type Locator func(deviceID string) (iccid, tenantID string)
+
+var globalLocator atomic.Pointer[Locator]
+
+// SetDeviceLocator 设置设备定位函数（重复设置时覆盖）
+func SetDeviceLocator(l Locator) {
+	if l == nil {
+		globalLocator.Store(nil)
+		return
+	}
+	globalLocator.Store(&l)
+}
+
+// Options 低流量模式参数
+type Options struct {
+	CoalesceWindow      time.Duration // 合并窗口：窗口内发往同一连接的帧合并为一次写入
+	CoalesceMaxBytes    int           // 合并批次达到该字节数立即写出
+	TimeSyncDedup       time.Duration // 对时去重窗口
+	PacketOverheadBytes int           // 估算节省字节时每个TCP报文的报头开销
+}
+
+// ConnTraffic 低流量连接的下行流量与估算节省（字节数为估算的链路字节：帧长+每次写入的报文开销）
+type ConnTraffic struct {
+	ConnID              uint64           `json:"connId"`
+	ICCID               string           `json:"iccid,omitempty"`
+	TenantID            string           `json:"tenantId,omitempty"`
+	Source              string           `json:"source,omitempty"`
+	DeviceIDs           []string         `json:"deviceIds"`
+	Since               time.Time        `json:"since"`
+	SentFrames          int64            `json:"sentFrames"`
+	SentBytes           int64            `json:"sentBytes"`
+	SuppressedFrames    map[string]int64 `json:"suppressedFrames"` // 键如 ack:0x06、time_sync:0x22、poll:read_deadline_probe
+	SuppressedBytes     int64            `json:"suppressedBytes"`  // 被抑制的帧若发送将产生的字节
+	CoalescedWrites     int64            `json:"coalescedWrites"`  // 合并了多帧的写入次数
+	CoalescedFrames     int64            `json:"coalescedFrames"`
+	CoalesceSavedBytes  int64            `json:"coalesceSavedBytes"` // 合并写入省下的报文开销
+	EstimatedBytesSaved int64            `json:"estimatedBytesSaved"`
+	SavedPercent        float64          `json:"savedPercent"` // 节省字节占（实发+节省）的百分比
+}
+
+// TrafficTotals 累计流量（含已断开的连接）
+type TrafficTotals struct {
+	SentFrames          int64   `json:"sentFrames"`
+	SentBytes           int64   `json:"sentBytes"`
+	SuppressedFrames    int64   `json:"suppressedFrames"`
+	SuppressedBytes     int64   `json:"suppressedBytes"`
+	CoalesceSavedBytes  int64   `json:"coalesceSavedBytes"`
+	EstimatedBytesSaved int64   `json:"estimatedBytesSaved"`
+	SavedPercent        float64 `json:"savedPercent"`
+}
+
+// TrafficFilter 流量报告过滤条件（为空表示不过滤）
+type TrafficFilter struct {
+	TenantID string
+	ICCID    string
+}
+
+// TrafficReport 流量报告
+type TrafficReport struct {
+	GeneratedAt         time.Time     `json:"generatedAt"`
+	PacketOverheadBytes int           `json:"packetOverheadBytes"`
+	Connections         []ConnTraffic `json:"connections"`
+	Totals              TrafficTotals `json:"totals"` // 未过滤时为累计值，过滤时为所列连接之和
+}
+
+// Status 低流量模式状态（只读接口返回）
+type Status struct {
+	Enabled              bool                  `json:"enabled"`
+	PolicyFile           string                `json:"policyFile,omitempty"`
+	LoadedAt             time.Time             `json:"loadedAt"`
+	LastLoadError        string                `json:"lastLoadError,omitempty"` // 最近一次热加载失败原因（继续使用旧分配）
+	Policy               Policy                `json:"policy"`
+	Tenants              map[string]Effective  `json:"tenants,omitempty"` // 各租户生效行为
+	CoalesceWindowMs     int64                 `json:"coalesceWindowMs"`
+	CoalesceMaxBytes     int                   `json:"coalesceMaxBytes"`
+	TimeSyncDedupSeconds int64                 `json:"timeSyncDedupSeconds"`
+	PacketOverheadBytes  int                   `json:"packetOverheadBytes"`
+	Classification       []ClassificationEntry `json:"classification"`
+	Connections          int                   `json:"connections"` // 当前跟踪的低流量连接数
+	Totals               TrafficTotals         `json:"totals"`
+}
+
+// Registry 低流量模式分配与流量核算：分配文件可热加载，加载失败保留旧分配
+type Registry struct {
+	path   string
+	opts   Options
+	policy atomic.Pointer[Policy]
+
+	mu            sync.Mutex
+	modTime       time.Time
+	size          int64
+	loadedAt      time.Time
+	lastLoadError string
+	conns         map[uint64]*ConnTraffic
+	timeSync      map[string]time.Time // 设备最近一次对时应答时间
+	totals        TrafficTotals
+}
+
+// NewRegistry 创建低流量模式注册表：path 为空时分配为空，可通过 SetPolicy 设置
+func NewRegistry(path string, opts Options) (*Registry, error) {
+	if opts.CoalesceWindow <= 0 {
+		opts.CoalesceWindow = defaultCoalesceWindow
+	}
+	if opts.CoalesceMaxBytes <= 0 {
+		opts.CoalesceMaxBytes = defaultCoalesceMaxBytes
+	}
+	if opts.TimeSyncDedup <= 0 {
+		opts.TimeSyncDedup = defaultTimeSyncDedup
+	}
+	if opts.PacketOverheadBytes <= 0 {
+		opts.PacketOverheadBytes = defaultPacketOverheadBytes
+	}
+	r := &Registry{
+		path:     path,
+		opts:     opts,
+		conns:    make(map[uint64]*ConnTraffic),
+		timeSync: make(map[string]time.Time),
+	}
+	r.policy.Store(&Policy{})
+	if path != "" {
+		if err := r.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Options 生效的参数
+func (r *Registry) Options() Options {
+	return r.opts
+}
+
+// SetPolicy 直接替换分配
+func (r *Registry) SetPolicy(p *Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	r.policy.Store(p)
+	r.mu.Lock()
+	r.loadedAt = time.Now()
+	r.lastLoadError = ""
+	r.mu.Unlock()
+	return nil
+}
+
+// Reload 重新加载分配文件，校验失败时保留旧分配
+func (r *Registry) Reload() error {
+	if r.path == "" {
+		return fmt.Errorf("未配置低流量模式分配文件")
+	}
+	stat, err := os.Stat(r.path)
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(r.path); err == nil {
+			var p *Policy
+			if p, err = ParsePolicy(data); err == nil {
+				r.policy.Store(p)
+				r.mu.Lock()
+				r.modTime, r.size = stat.ModTime(), stat.Size()
+				r.loadedAt = time.Now()
+				r.lastLoadError = ""
+				r.mu.Unlock()
+				logger.WithFields(logrus.Fields{
+					"path":    r.path,
+					"tenants": len(p.Tenants),
+					"iccids":  len(p.ICCIDs),
+				}).Info("低流量模式分配已加载")
+				return nil
+			}
+		}
+	}
+	err = fmt.Errorf("加载低流量模式分配失败: %w", err)
+	r.mu.Lock()
+	r.lastLoadError = err.Error()
+	r.mu.Unlock()
+	return err
+}
+
+// Watch 定期检查分配文件变更并热加载，随ctx取消退出
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || r.path == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stat, err := os.Stat(r.path)
+				r.mu.Lock()
+				unchanged := err != nil || (stat.ModTime().Equal(r.modTime) && stat.Size() == r.size)
+				if err == nil {
+					r.modTime, r.size = stat.ModTime(), stat.Size()
+				}
+				r.mu.Unlock()
+				if unchanged {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					logger.WithFields(logrus.Fields{
+						"path":  r.path,
+						"error": err,
+					}).Warn("低流量模式分配热加载失败，继续使用旧分配")
+				}
+			}
+		}
+	}()
+}
+
+// Resolve 按ICCID与租户解析模式
+func (r *Registry) Resolve(iccid, tenantID string) Mode {
+	return r.policy.Load().Resolve(iccid, tenantID)
+}
+
+// ModeForDevice 设备所在连接的低流量模式（未注入定位函数时不启用）
+func (r *Registry) ModeForDevice(deviceID string) Mode {
+	l := globalLocator.Load()
+	if l == nil || deviceID == "" {
+		return Mode{}
+	}
+	iccid, tenantID := (*l)(deviceID)
+	return r.Resolve(iccid, tenantID)
+}
+
+// AllowResponse 判断是否发送应答：必须应答的命令始终发送；被抑制时按帧长计入节省
+func (r *Registry) AllowResponse(connID uint64, deviceID string, command uint8, dataLen int, now time.Time) bool {
+	class := ClassifyResponse(command)
+	if class == ResponseRequired {
+		return true
+	}
+	mode := r.ModeForDevice(deviceID)
+	if !mode.Enabled {
+		return true
+	}
+	switch class {
+	case ResponseOptional:
+		if !mode.Effective.SuppressOptionalAcks {
+			return true
+		}
+	case ResponseTimeSync:
+		if !mode.Effective.DedupTimeSync {
+			return true
+		}
+		r.mu.Lock()
+		last, ok := r.timeSync[deviceID]
+		duplicate := ok && now.Sub(last) < r.opts.TimeSyncDedup
+		if !duplicate {
+			r.timeSync[deviceID] = now
+		}
+		r.mu.Unlock()
+		if !duplicate {
+			return true
+		}
+	}
+	r.recordSuppressed(connID, deviceID, mode, responseKey(class, command), FrameLength(dataLen), now)
+	return false
+}
+
+// AllowPoll 判断是否下发主动查询：必要的查询始终下发
+func (r *Registry) AllowPoll(connID uint64, deviceID string, kind PollKind, dataLen int, now time.Time) bool {
+	if IsEssentialPoll(kind) {
+		return true
+	}
+	mode := r.ModeForDevice(deviceID)
+	if !mode.Enabled || !mode.Effective.SuppressProactivePolls {
+		return true
+	}
+	r.recordSuppressed(connID, deviceID, mode, pollKey(kind), FrameLength(dataLen), now)
+	return false
+}
+
+// RecordWrite 记录一次下行写入（frames>1 表示合并写入）；非低流量连接不记录
+func (r *Registry) RecordWrite(connID uint64, deviceID string, bytes, frames int, now time.Time) {
+	mode := r.ModeForDevice(deviceID)
+	if !mode.Enabled || frames <= 0 {
+		return
+	}
+	overhead := int64(r.opts.PacketOverheadBytes)
+	sent := int64(bytes) + overhead
+	var saved int64
+	if frames > 1 {
+		saved = int64(frames-1) * overhead
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.connLocked(connID, deviceID, mode, now)
+	c.SentFrames += int64(frames)
+	c.SentBytes += sent
+	r.totals.SentFrames += int64(frames)
+	r.totals.SentBytes += sent
+	if frames > 1 {
+		c.CoalescedWrites++
+		c.CoalescedFrames += int64(frames)
+		c.CoalesceSavedBytes += saved
+		r.totals.CoalesceSavedBytes += saved
+	}
+}
+
+func (r *Registry) recordSuppressed(connID uint64, deviceID string, mode Mode, key string, frameLen int, now time.Time) {
+	bytes := int64(frameLen + r.opts.PacketOverheadBytes)
+	r.mu.Lock()
+	c := r.connLocked(connID, deviceID, mode, now)
+	c.SuppressedFrames[key]++
+	c.SuppressedBytes += bytes
+	r.totals.SuppressedFrames++
+	r.totals.SuppressedBytes += bytes
+	r.mu.Unlock()
+	logger.WithFields(logrus.Fields{
+		"connID":   connID,
+		"deviceID": deviceID,
+		"frame":    key,
+	}).Debug("低流量模式：已抑制下行帧")
+}
+
+// connLocked 连接的流量记录（调用方持有锁）；ICCID与租户随最近一次记录的模式更新
+func (r *Registry) connLocked(connID uint64, deviceID string, mode Mode, now time.Time) *ConnTraffic {
+	c, ok := r.conns[connID]
+	if !ok {
+		c = &ConnTraffic{ConnID: connID, Since: now, SuppressedFrames: make(map[string]int64)}
+		r.conns[connID] = c
+	}
+	c.ICCID, c.TenantID, c.Source = mode.ICCID, mode.TenantID, mode.Source
+	found := false
+	for _, id := range c.DeviceIDs {
+		found = found || id == deviceID
+	}
+	if !found {
+		c.DeviceIDs = append(c.DeviceIDs, deviceID)
+		sort.Strings(c.DeviceIDs)
+	}
+	return c
+}
+
+// Forget 连接断开后移除其流量记录与设备对时记录（累计值保留）
+func (r *Registry) Forget(connID uint64, deviceIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, connID)
+	for _, id := range deviceIDs {
+		delete(r.timeSync, id)
+	}
+}
+
+// Traffic 低流量连接的流量报告（按连接ID排序）
+func (r *Registry) Traffic(filter TrafficFilter) TrafficReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := TrafficReport{
+		GeneratedAt:         time.Now(),
+		PacketOverheadBytes: r.opts.PacketOverheadBytes,
+		Connections:         make([]ConnTraffic, 0, len(r.conns)),
+	}
+	filtered := filter.TenantID != "" || filter.ICCID != ""
+	for _, c := range r.conns {
+		if (filter.TenantID != "" && c.TenantID != filter.TenantID) || (filter.ICCID != "" && c.ICCID != filter.ICCID) {
+			continue
+		}
+		cp := *c
+		cp.DeviceIDs = append([]string(nil), c.DeviceIDs...)
+		cp.SuppressedFrames = make(map[string]int64, len(c.SuppressedFrames))
+		var suppressed int64
+		for k, v := range c.SuppressedFrames {
+			cp.SuppressedFrames[k] = v
+			suppressed += v
+		}
+		cp.EstimatedBytesSaved = cp.SuppressedBytes + cp.CoalesceSavedBytes
+		cp.SavedPercent = savedPercent(cp.EstimatedBytesSaved, cp.SentBytes)
+		report.Connections = append(report.Connections, cp)
+		if filtered {
+			report.Totals.SentFrames += cp.SentFrames
+			report.Totals.SentBytes += cp.SentBytes
+			report.Totals.SuppressedFrames += suppressed
+			report.Totals.SuppressedBytes += cp.SuppressedBytes
+			report.Totals.CoalesceSavedBytes += cp.CoalesceSavedBytes
+		}
+	}
+	sort.Slice(report.Connections, func(i, j int) bool { return report.Connections[i].ConnID < report.Connections[j].ConnID })
+	if !filtered {
+		report.Totals = r.totals
+	}
+	report.Totals.EstimatedBytesSaved = report.Totals.SuppressedBytes + report.Totals.CoalesceSavedBytes
+	report.Totals.SavedPercent = savedPercent(report.Totals.EstimatedBytesSaved, report.Totals.SentBytes)
+	return report
+}
+
+func savedPercent(saved, sent int64) float64 {
+	if saved+sent == 0 {
+		return 0
+	}
+	return float64(saved) / float64(saved+sent) * 100
+}
+
+// Status 当前分配、各租户生效行为、分类表与累计流量
+func (r *Registry) Status() Status {
+	p := r.policy.Load()
+	status := Status{
+		Enabled:              true,
+		PolicyFile:           r.path,
+		Policy:               *p,
+		CoalesceWindowMs:     r.opts.CoalesceWindow.Milliseconds(),
+		CoalesceMaxBytes:     r.opts.CoalesceMaxBytes,
+		TimeSyncDedupSeconds: int64(r.opts.TimeSyncDedup / time.Second),
+		PacketOverheadBytes:  r.opts.PacketOverheadBytes,
+		Classification:       Classification(),
+	}
+	if len(p.Tenants) > 0 {
+		status.Tenants = make(map[string]Effective, len(p.Tenants))
+		for _, id := range p.TenantIDs() {
+			status.Tenants[id] = p.Resolve("", id).Effective
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status.LoadedAt, status.LastLoadError = r.loadedAt, r.lastLoadError
+	status.Connections = len(r.conns)
+	status.Totals = r.totals
+	status.Totals.EstimatedBytesSaved = status.Totals.SuppressedBytes + status.Totals.CoalesceSavedBytes
+	status.Totals.SavedPercent = savedPercent(status.Totals.EstimatedBytesSaved, status.Totals.SentBytes)
+	return status
+}
+
+var globalRegistry atomic.Pointer[Registry]
+
+// GetGlobalRegistry 获取全局低流量模式注册表（未启用时为nil）
+func GetGlobalRegistry() *Registry {
+	return globalRegistry.Load()
+}
+
+// SetGlobalRegistry 设置全局低流量模式注册表
+func SetGlobalRegistry(r *Registry) {
+	globalRegistry.Store(r)
+}
+
+// InitGlobalRegistry 按配置加载分配文件并启动热加载；未配置分配文件时不启用
+func InitGlobalRegistry(ctx context.Context) error {
+	cfg := config.GetConfig().LowData
+	if cfg.PolicyFile == "" {
+		return nil
+	}
+	r, err := NewRegistry(cfg.PolicyFile, Options{
+		CoalesceWindow:      time.Duration(cfg.CoalesceWindowMs) * time.Millisecond,
+		CoalesceMaxBytes:    cfg.CoalesceMaxBytes,
+		TimeSyncDedup:       time.Duration(cfg.TimeSyncDedupSeconds) * time.Second,
+		PacketOverheadBytes: cfg.PacketOverheadBytes,
+	})
+	if err != nil {
+		return err
+	}
+	r.Watch(ctx, time.Duration(cfg.ReloadIntervalSeconds)*time.Second)
+	SetGlobalRegistry(r)
+	logger.WithFields(logrus.Fields{"policyFile": cfg.PolicyFile}).Info("低流量模式已启用")
+	return nil
+}
@@ -0,0 +1,283 @@
+// Package msgid 下行消息ID分配：全局原子计数，定期异步持久化序列位置并在重启后跳跃恢复。
+// 部分固件会丢弃消息ID与最近收到的值重复的帧，网关重启后计数归零会导致对长连接设备的前几条命令被静默丢弃。
+// 命令构包处不区分设备，因此按全局序列持久化（全局序列不重复，对每台设备同样不重复）
+package msgid
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	idSpace                = 65535 // 计数按该模数映射为消息ID，0 映射为 1（消息ID取值 1..65534）
+	maxRestoreGap          = idSpace / 2
+	defaultRestoreGap      = 1000
+	defaultPersistInterval = 5 * time.Second
+	defaultFilePath        = "./data/message_id.json"
+	defaultRedisKey        = "iot:message_id"
+)
+
+// Options 序列选项
+type Options struct {
+	StoreType       string        // 仅用于诊断输出
+	RestoreGap      uint16        // 恢复时在持久化值之后跳过的ID数，须覆盖一个持久化间隔内的最大分配量
+	PersistInterval time.Duration // 定期持久化间隔
+}
+
+// Status 序列诊断信息
+type Status struct {
+	Current       uint16    `json:"current"`                 // 最近分配的消息ID
+	Issued        uint64    `json:"issued"`                  // 本次启动以来分配的消息ID数
+	Store         string    `json:"store"`                   // 持久化方式
+	LastSaved     uint16    `json:"lastSaved"`               // 最近一次持久化的消息ID
+	LastSavedAt   time.Time `json:"lastSavedAt"`             // 最近一次持久化时间，尚未持久化时为零值
+	LastSaveError string    `json:"lastSaveError,omitempty"` // 最近一次持久化失败原因（成功后清空）
+	RestoredFrom  *uint16   `json:"restoredFrom"`            // 启动时恢复的持久化值，无记录时为 null
+	RestoreGap    uint16    `json:"restoreGap"`
+	StartPosition uint16    `json:"startPosition"` // 恢复后的起始位置（首个分配值的前一个）
+}
+
+// Sequence 消息ID序列：分配只做一次原子加，持久化由后台定期执行
+type Sequence struct {
+	counter atomic.Uint64 // 原始计数，消息ID = idOf(counter)
+	start   uint64
+
+	store Store
+	opts  Options
+
+	mu            sync.Mutex // 保护持久化状态，不在分配路径上
+	savedCounter  uint64
+	lastSavedAt   time.Time
+	lastSaveError string
+	restoredFrom  *uint16
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSequence 创建序列并从持久化记录恢复：起始位置 = 持久化值 + RestoreGap（覆盖上次未持久化的分配）
+func NewSequence(store Store, opts Options) (*Sequence, error) {
+	if opts.RestoreGap == 0 {
+		opts.RestoreGap = defaultRestoreGap
+	}
+	if opts.RestoreGap > maxRestoreGap {
+		opts.RestoreGap = maxRestoreGap
+	}
+	if opts.PersistInterval <= 0 {
+		opts.PersistInterval = defaultPersistInterval
+	}
+	if opts.StoreType == "" {
+		opts.StoreType = StoreTypeMemory
+	}
+	s := &Sequence{store: store, opts: opts, stopCh: make(chan struct{})}
+	if store == nil {
+		return s, nil
+	}
+
+	record, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		last := record.LastMessageID
+		s.restoredFrom = &last
+		s.start = uint64(last) + uint64(opts.RestoreGap)
+		s.counter.Store(s.start)
+		s.savedCounter = s.start
+	}
+	return s, nil
+}
+
+// Next 分配下一个消息ID（1..65534循环）
+func (s *Sequence) Next() uint16 {
+	return idOf(s.counter.Add(1))
+}
+
+// Current 最近分配的消息ID（尚未分配时为恢复后的起始位置）
+func (s *Sequence) Current() uint16 {
+	return idOf(s.counter.Load())
+}
+
+// Peek 下一个将分配的消息ID（不占用序列），供试运行预览命令帧
+func (s *Sequence) Peek() uint16 {
+	return idOf(s.counter.Load() + 1)
+}
+
+// Save 持久化当前序列位置（与上次持久化相同时跳过）
+func (s *Sequence) Save() error {
+	if s.store == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.counter.Load()
+	if current == s.savedCounter && !s.lastSavedAt.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	if err := s.store.Save(Record{LastMessageID: idOf(current), SavedAt: now}); err != nil {
+		s.lastSaveError = err.Error()
+		return err
+	}
+	s.savedCounter = current
+	s.lastSavedAt = now
+	s.lastSaveError = ""
+	return nil
+}
+
+// Start 启动定期持久化（随上下文取消或 Stop 结束）
+func (s *Sequence) Start(ctx context.Context) {
+	if s.store == nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.opts.PersistInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				if err := s.Save(); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("消息ID序列持久化失败")
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定期持久化并写入最终位置（停机时调用）
+func (s *Sequence) Stop() error {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+	s.wg.Wait()
+	return s.Save()
+}
+
+// Status 诊断信息
+func (s *Sequence) Status() Status {
+	current := s.counter.Load()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{
+		Current:       idOf(current),
+		Issued:        current - s.start,
+		Store:         s.opts.StoreType,
+		LastSaved:     idOf(s.savedCounter),
+		LastSavedAt:   s.lastSavedAt,
+		LastSaveError: s.lastSaveError,
+		RestoredFrom:  s.restoredFrom,
+		RestoreGap:    s.opts.RestoreGap,
+		StartPosition: idOf(s.start),
+	}
+}
+
+func idOf(counter uint64) uint16 {
+	id := uint16(counter % idSpace)
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalSequence atomic.Pointer[Sequence]
+
+func init() {
+	s, _ := NewSequence(nil, Options{})
+	globalSequence.Store(s)
+}
+
+// GetGlobalSequence 获取全局消息ID序列（未按配置初始化时为仅内存的序列）
+func GetGlobalSequence() *Sequence {
+	return globalSequence.Load()
+}
+
+// Next 从全局序列分配下一个消息ID
+func Next() uint16 {
+	return globalSequence.Load().Next()
+}
+
+// InitGlobalSequence 按配置创建全局序列、恢复持久化位置并启动定期持久化（需在Redis初始化之后调用）
+func InitGlobalSequence(ctx context.Context) error {
+	cfg := config.GetConfig().MessageID
+
+	var store Store
+	storeType := cfg.Store
+	switch storeType {
+	case "", StoreTypeFile:
+		storeType = StoreTypeFile
+		path := cfg.FilePath
+		if path == "" {
+			path = defaultFilePath
+		}
+		store = NewFileStore(path)
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("消息ID序列配置为redis存储，但Redis未连接")
+		}
+		key := cfg.RedisKey
+		if key == "" {
+			key = defaultRedisKey
+		}
+		store = NewRedisStore(client, key)
+	case StoreTypeMemory:
+	default:
+		return fmt.Errorf("不支持的消息ID序列存储方式: %s", cfg.Store)
+	}
+
+	gap := cfg.RestoreGap
+	if gap < 0 {
+		gap = 0
+	}
+	if gap > maxRestoreGap {
+		gap = maxRestoreGap
+	}
+	s, err := NewSequence(store, Options{
+		StoreType:       storeType,
+		RestoreGap:      uint16(gap),
+		PersistInterval: time.Duration(cfg.PersistIntervalSeconds) * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	// 初始化之前已分配的ID（启动装配期间）不能在新序列中重复
+	if previous := GetGlobalSequence(); previous != nil && s.restoredFrom == nil {
+		s.start = previous.counter.Load()
+		s.counter.Store(s.start)
+	}
+	globalSequence.Store(s)
+	s.Start(ctx)
+
+	status := s.Status()
+	logger.WithFields(logrus.Fields{
+		"store":        storeType,
+		"restoredFrom": status.RestoredFrom,
+		"restoreGap":   status.RestoreGap,
+		"startAt":      status.StartPosition,
+	}).Info("消息ID序列已初始化")
+	return nil
+}
+
+// StopGlobalSequence 停止定期持久化并写入最终位置
+func StopGlobalSequence() {
+	if err := GetGlobalSequence().Stop(); err != nil {
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("停机时持久化消息ID序列失败")
+	}
+}
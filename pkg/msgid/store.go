@@ -0,0 +1,46 @@
+package msgid
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+)
+
+// 持久化方式
+const (
+	StoreTypeFile   = persistence.StoreTypeFile
+	StoreTypeRedis  = persistence.StoreTypeRedis
+	StoreTypeMemory = persistence.StoreTypeMemory
+)
+
+// RecordType 序列位置的持久化类型（加载时旧版本立即迁移并回写）
+const (
+	RecordType    = "msgid_sequence"
+	recordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(RecordType, recordVersion)
+}
+
+// Record 持久化的序列位置
+type Record struct {
+	LastMessageID uint16    `json:"lastMessageId"`
+	SavedAt       time.Time `json:"savedAt"`
+}
+
+// Store 消息ID序列位置持久化
+type Store = persistence.Store[Record]
+
+var storeCodec = persistence.Codec{RecordType: RecordType, Label: "消息ID序列"}
+
+// NewFileStore 创建文件持久化
+func NewFileStore(path string) *persistence.FileStore[Record] {
+	return persistence.NewFileStore[Record](path, storeCodec)
+}
+
+// NewRedisStore 创建Redis持久化（集群多实例应各自配置不同的键）
+func NewRedisStore(client *redis.Client, key string) *persistence.RedisStore[Record] {
+	return persistence.NewRedisStore[Record](client, key, storeCodec)
+}
@@ -5,24 +5,37 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// EventTypeCommandCompleted 命令收到设备应答（发布到事件总线设备主题，供设备详情缓存等失效使用）
+const EventTypeCommandCompleted = "command_completed"
+
+// CommandCompletedEvent 命令完成事件负载
+type CommandCompletedEvent struct {
+	Command       uint8  `json:"command"`
+	MessageID     uint16 `json:"messageId"`
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
 const (
-	// CommandTimeout 命令超时时间(15秒)
+	// CommandTimeout 命令超时时间(15秒)，默认重发策略每次发送后等待应答的时长
 	CommandTimeout = 15 * time.Second
 
-	// CommandRetryCount 命令重试次数上限(2次)
+	// CommandRetryCount 命令重试次数上限(2次)，默认重发策略的重发次数
 	CommandRetryCount = 2
 
 	// CommandMaxAge 命令最大生命周期(60秒)
-	// 无论重试次数，一个命令从创建到自动清除的最大时间
+	// 默认重发策略下一个命令从创建到自动清除的最大时间；自定义策略按重发计划计算，见 RetryPolicy
 	CommandMaxAge = 60 * time.Second
 
 	// CommandBatchSize 命令批处理大小
@@ -40,23 +53,33 @@ const (
 	CmdStatusConfirmed CommandStatus = "confirmed" // 已确认
 	CmdStatusFailed    CommandStatus = "failed"    // 失败
 	CmdStatusExpired   CommandStatus = "expired"   // 过期
+
+	CmdStatusDisconnected CommandStatus = "disconnected" // 设备连接断开，提前失败
+	CmdStatusRejected     CommandStatus = "rejected"     // 设备否定应答（不认识或不支持该命令），提前失败
 )
 
 // CommandEntry 命令条目
 type CommandEntry struct {
-	Connection   ziface.IConnection
-	ConnID       uint64 // 保存连接ID，用于快速判断连接是否变化
-	PhysicalID   uint32
-	MessageID    uint16
-	Command      uint8
-	Data         []byte
-	CreateTime   time.Time
-	RetryCount   int
-	LastSentTime time.Time
-	Confirmed    bool          // 是否已确认
-	Priority     int           // 命令优先级，值越小优先级越高
-	Status       CommandStatus // 命令状态
-	LastError    string        // 最后一次错误信息
+	Connection    ziface.IConnection
+	ConnID        uint64 // 保存连接ID，用于快速判断连接是否变化
+	PhysicalID    uint32
+	MessageID     uint16
+	Command       uint8
+	Data          []byte
+	CreateTime    time.Time
+	RetryCount    int
+	LastSentTime  time.Time
+	Confirmed     bool          // 是否已确认
+	Priority      int           // 命令优先级，值越小优先级越高
+	Status        CommandStatus // 命令状态
+	LastError     string        // 最后一次错误信息
+	CorrelationID string        // 链路追踪ID（来自HTTP请求X-Request-ID），贯穿下发、重试、确认日志
+
+	ResendOnReconnect bool              // 连接断开后设备在窗口期内重新注册时自动重发（仅一次）
+	Rejection         *CommandRejection // 设备否定应答（状态为 rejected 时）
+	failure           CommandOutcome    // 失败分类（状态为 failed 时）
+	sendFailed        bool              // 最近一次写入失败
+	done              chan struct{}     // 命令结束（确认/失败/过期/断开/拒绝）时关闭，唤醒等待者
 }
 
 // CommandManager 命令管理器
@@ -74,28 +97,55 @@ type CommandManager struct {
 	processingTicker     *time.Ticker
 	stopChan             chan struct{}
 	isRunning            bool
-	maxRetry             int
+	policy               RetryPolicy
+
+	// 重发与放弃统计（累计）
+	retransmissions int64
+	failed          int64
+	failureHandlers []CommandFailureHandler
+
+	// 断线待重发命令
+	resendQueue  map[uint32][]resendEntry // map[physicalID][]待重发命令
+	resendWindow time.Duration
+
+	// 命令往返时延统计
+	rtt map[uint32]*CommandRTTStats // map[physicalID]*往返时延
+
+	// 设备否定应答统计
+	rejections map[uint32]*rejectionStats // map[physicalID]*被拒绝命令
 }
 
 // 兼容性检查移除：不再依赖接口文件，直接对外暴露具体类型
 
-// 创建全局命令管理器实例
-var (
-	globalCommandManager *CommandManager
-	cmdMgrOnce           sync.Once
-)
+// 全局命令管理器实例
+var globalCommandManager atomic.Pointer[CommandManager]
+
+// NewCommandManager 创建命令管理器
+func NewCommandManager() *CommandManager {
+	return &CommandManager{
+		commands:         make(map[string]*CommandEntry),
+		physicalCommands: make(map[uint32][]string),
+		stopChan:         make(chan struct{}),
+		policy:           DefaultRetryPolicy(),
+		resendQueue:      make(map[uint32][]resendEntry),
+		resendWindow:     CommandResendWindow,
+		rtt:              make(map[uint32]*CommandRTTStats),
+		rejections:       make(map[uint32]*rejectionStats),
+	}
+}
+
+// InitCommandManager 初始化全局命令管理器（由 bootstrap 调用；重复调用返回已有实例）
+func InitCommandManager() *CommandManager {
+	globalCommandManager.CompareAndSwap(nil, NewCommandManager())
+	return globalCommandManager.Load()
+}
 
-// GetCommandManager 获取全局命令管理器实例
+// GetCommandManager 获取全局命令管理器实例，未初始化时panic
 func GetCommandManager() *CommandManager {
-	cmdMgrOnce.Do(func() {
-		globalCommandManager = &CommandManager{
-			commands:         make(map[string]*CommandEntry),
-			physicalCommands: make(map[uint32][]string),
-			stopChan:         make(chan struct{}),
-			maxRetry:         CommandRetryCount,
-		}
-	})
-	return globalCommandManager
+	if cm := globalCommandManager.Load(); cm != nil {
+		return cm
+	}
+	panic("network: 命令管理器尚未初始化，请先执行 bootstrap.New（测试使用 bootstrap.InitForTest）")
 }
 
 // Start 启动命令管理器
@@ -136,6 +186,20 @@ func (cm *CommandManager) Stop() {
 	logger.Info("命令管理器已停止")
 }
 
+// PendingCount 未确认且仍在等待应答/重试的命令数（停机时用于排空命令）
+func (cm *CommandManager) PendingCount() int {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	count := 0
+	for _, entry := range cm.commands {
+		if entry.Confirmed || entry.Status == CmdStatusFailed || entry.Status == CmdStatusExpired {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
 // GenerateCommandKey 生成命令唯一标识
 // 使用连接ID-物理ID-消息ID-命令 作为唯一键
 func (cm *CommandManager) GenerateCommandKey(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8) string {
@@ -144,10 +208,21 @@ func (cm *CommandManager) GenerateCommandKey(conn ziface.IConnection, physicalID
 
 // RegisterCommand 注册命令
 func (cm *CommandManager) RegisterCommand(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte) {
+	cm.RegisterCommandWithCorrelation(conn, physicalID, messageID, command, data, "")
+}
+
+// RegisterCommandWithCorrelation 注册命令并关联链路追踪ID
+func (cm *CommandManager) RegisterCommandWithCorrelation(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte, correlationID string) {
+	cm.RegisterCommandWithOptions(conn, physicalID, messageID, command, data, CommandOptions{CorrelationID: correlationID})
+}
+
+// RegisterCommandWithOptions 按选项注册命令，返回可用于同步等待结果的句柄（连接为空时返回nil）
+func (cm *CommandManager) RegisterCommandWithOptions(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte, opts CommandOptions) *CommandHandle {
 	if conn == nil {
 		logger.Error("无法注册命令，连接为空")
-		return
+		return nil
 	}
+	correlationID := opts.CorrelationID
 
 	connID := conn.GetConnID()
 
@@ -171,21 +246,25 @@ func (cm *CommandManager) RegisterCommand(conn ziface.IConnection, physicalID ui
 				existingCmd.Confirmed = false
 				existingCmd.Status = CmdStatusSent
 				existingCmd.LastError = ""
+				existingCmd.CorrelationID = correlationID
+				existingCmd.ResendOnReconnect = opts.ResendOnReconnect
+				existingCmd.sendFailed = false
 
 				logger.WithFields(logrus.Fields{
-					"connID":      connID,
-					"physicalID":  fmt.Sprintf("0x%08X", physicalID),
-					"messageID":   fmt.Sprintf("0x%04X (%d)", messageID, messageID),
-					"command":     fmt.Sprintf("0x%02X", command),
-					"commandDesc": GetCommandDescription(command),
-					"cmdKey":      cmdKey,
-					"dataLen":     len(data),
-					"dataHex":     hex.EncodeToString(data),
-					"priority":    existingCmd.Priority,
-					"status":      existingCmd.Status,
+					"correlationID": correlationID,
+					"connID":        connID,
+					"physicalID":    fmt.Sprintf("0x%08X", physicalID),
+					"messageID":     fmt.Sprintf("0x%04X (%d)", messageID, messageID),
+					"command":       dny_protocol.CommandLabel(command),
+					"commandDesc":   GetCommandDescription(command),
+					"cmdKey":        cmdKey,
+					"dataLen":       len(data),
+					"dataHex":       hex.EncodeToString(data),
+					"priority":      existingCmd.Priority,
+					"status":        existingCmd.Status,
 				}).Debug("更新已存在的命令")
 
-				return
+				return &CommandHandle{Key: key, entry: existingCmd, manager: cm}
 			}
 		}
 	}
@@ -195,19 +274,23 @@ func (cm *CommandManager) RegisterCommand(conn ziface.IConnection, physicalID ui
 
 	// 创建命令条目
 	entry := &CommandEntry{
-		Connection:   conn,
-		ConnID:       connID,
-		PhysicalID:   physicalID,
-		MessageID:    messageID,
-		Command:      command,
-		Data:         data,
-		CreateTime:   time.Now(),
-		RetryCount:   0,
-		LastSentTime: time.Now(),
-		Confirmed:    false,
-		Priority:     priority,
-		Status:       CmdStatusSent,
-		LastError:    "",
+		Connection:    conn,
+		ConnID:        connID,
+		PhysicalID:    physicalID,
+		MessageID:     messageID,
+		Command:       command,
+		Data:          data,
+		CreateTime:    time.Now(),
+		RetryCount:    0,
+		LastSentTime:  time.Now(),
+		Confirmed:     false,
+		Priority:      priority,
+		Status:        CmdStatusSent,
+		LastError:     "",
+		CorrelationID: correlationID,
+
+		ResendOnReconnect: opts.ResendOnReconnect,
+		done:              make(chan struct{}),
 	}
 
 	// 存储命令
@@ -228,19 +311,23 @@ func (cm *CommandManager) RegisterCommand(conn ziface.IConnection, physicalID ui
 	remoteAddr := conn.RemoteAddr().String()
 
 	logger.WithFields(logrus.Fields{
-		"connID":      connID,
-		"physicalID":  utils.FormatPhysicalID(physicalID),
-		"messageID":   fmt.Sprintf("0x%04X (%d)", messageID, messageID),
-		"command":     fmt.Sprintf("0x%02X", command),
-		"commandDesc": GetCommandDescription(command),
-		"cmdKey":      cmdKey,
-		"dataLen":     len(data),
-		"dataHex":     hex.EncodeToString(data),
-		"priority":    priority,
-		"status":      entry.Status,
-		"iccid":       iccid,
-		"remoteAddr":  remoteAddr,
+		"correlationID": correlationID,
+		"connID":        connID,
+		"physicalID":    utils.FormatPhysicalID(physicalID),
+		"messageID":     fmt.Sprintf("0x%04X (%d)", messageID, messageID),
+		"command":       dny_protocol.CommandLabel(command),
+		"commandDesc":   GetCommandDescription(command),
+		"cmdKey":        cmdKey,
+		"dataLen":       len(data),
+		"dataHex":       hex.EncodeToString(data),
+		"priority":      priority,
+		"status":        entry.Status,
+		"iccid":         iccid,
+		"remoteAddr":    remoteAddr,
+		"resend":        opts.ResendOnReconnect,
 	}).Info("注册新命令")
+
+	return &CommandHandle{Key: cmdKey, entry: entry, manager: cm}
 }
 
 // getCommandPriority 根据命令类型获取优先级
@@ -252,6 +339,12 @@ func getCommandPriority(command uint8) int {
 
 // ConfirmCommand 确认命令已完成
 func (cm *CommandManager) ConfirmCommand(physicalID uint32, messageID uint16, command uint8) bool {
+	confirmed, _ := cm.ConfirmCommandWithCorrelation(physicalID, messageID, command)
+	return confirmed
+}
+
+// ConfirmCommandWithCorrelation 确认命令已完成，并返回命令注册时关联的链路追踪ID
+func (cm *CommandManager) ConfirmCommandWithCorrelation(physicalID uint32, messageID uint16, command uint8) (bool, string) {
 	cm.lock.Lock()
 	defer cm.lock.Unlock()
 
@@ -261,13 +354,14 @@ func (cm *CommandManager) ConfirmCommand(physicalID uint32, messageID uint16, co
 		logger.WithFields(logrus.Fields{
 			"physicalID": fmt.Sprintf("0x%08X", physicalID),
 			"messageID":  fmt.Sprintf("0x%04X (%d)", messageID, messageID),
-			"command":    fmt.Sprintf("0x%02X", command),
+			"command":    dny_protocol.CommandLabel(command),
 		}).Debug("确认命令失败：未找到该物理ID的命令")
-		return false
+		return false, ""
 	}
 
 	confirmed := false
 	exactMatch := false
+	correlationID := ""
 
 	// 检查每个命令是否匹配
 	for _, cmdKey := range cmdKeys {
@@ -284,11 +378,14 @@ func (cm *CommandManager) ConfirmCommand(physicalID uint32, messageID uint16, co
 
 			confirmed = true
 			exactMatch = true
+			correlationID = cmd.CorrelationID
+			cm.observeRTT(cmd, time.Now())
 
 			logger.WithFields(logrus.Fields{
+				"correlationID":    cmd.CorrelationID,
 				"physicalID":       fmt.Sprintf("0x%08X", physicalID),
 				"messageID":        fmt.Sprintf("0x%04X (%d)", messageID, messageID),
-				"command":          fmt.Sprintf("0x%02X", command),
+				"command":          dny_protocol.CommandLabel(command),
 				"cmdKey":           cmdKey,
 				"matchType":        "完全匹配",
 				"originalMsgID":    fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
@@ -311,7 +408,14 @@ func (cm *CommandManager) ConfirmCommand(physicalID uint32, messageID uint16, co
 	// 清理已确认的命令
 	cm.cleanupConfirmedCommands()
 
-	return confirmed
+	if confirmed {
+		events.GetGlobalBus().Publish(events.TopicDevice, EventTypeCommandCompleted, utils.FormatPhysicalID(physicalID), CommandCompletedEvent{
+			Command:       command,
+			MessageID:     messageID,
+			CorrelationID: correlationID,
+		})
+	}
+	return confirmed, correlationID
 }
 
 // cleanupConfirmedCommands 清理已确认的命令
@@ -394,6 +498,10 @@ func (cm *CommandManager) deleteCommand(cmdKey string) {
 
 	// 从主映射表删除
 	delete(cm.commands, cmdKey)
+	if cmd.done != nil {
+		close(cmd.done)
+	}
+	reportEntryOutcome(cmd, cmd.outcome())
 
 	// 从物理ID映射表删除
 	physicalID := cmd.PhysicalID
@@ -419,7 +527,7 @@ func (cm *CommandManager) deleteCommand(cmdKey string) {
 
 // monitorCommands 监控命令超时并处理重发
 func (cm *CommandManager) monitorCommands() {
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(cm.RetryPolicy().checkInterval())
 	defer ticker.Stop()
 
 	for {
@@ -428,6 +536,7 @@ func (cm *CommandManager) monitorCommands() {
 			return
 		case <-ticker.C:
 			cm.checkTimeoutCommands()
+			cm.purgeExpiredResends(time.Now())
 		}
 	}
 }
@@ -441,6 +550,8 @@ func (cm *CommandManager) checkTimeoutCommands() {
 
 	// 批量收集超时和过期命令，减少锁持有时间
 	cm.lock.Lock()
+	policy := cm.policy
+	maxAge := policy.maxAge()
 	for key, cmd := range cm.commands {
 		// 检查命令是否已确认
 		if cmd.Confirmed {
@@ -448,7 +559,7 @@ func (cm *CommandManager) checkTimeoutCommands() {
 		}
 
 		// 检查命令是否超过最大生命周期
-		if now.Sub(cmd.CreateTime) > CommandMaxAge {
+		if now.Sub(cmd.CreateTime) > maxAge {
 			expiredCommandKeys = append(expiredCommandKeys, key)
 
 			// 更新命令状态为过期
@@ -460,21 +571,22 @@ func (cm *CommandManager) checkTimeoutCommands() {
 			expiredCommands = append(expiredCommands, &cmdCopy)
 
 			logger.WithFields(logrus.Fields{
-				"cmdKey":      key,
-				"physicalID":  fmt.Sprintf("0x%08X", cmd.PhysicalID),
-				"messageID":   fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
-				"command":     fmt.Sprintf("0x%02X", cmd.Command),
-				"commandDesc": GetCommandDescription(cmd.Command),
-				"createTime":  cmd.CreateTime.Format("15:04:05.000"),
-				"age":         now.Sub(cmd.CreateTime).Seconds(),
-				"status":      cmd.Status,
-				"lastError":   cmd.LastError,
+				"correlationID": cmd.CorrelationID,
+				"cmdKey":        key,
+				"physicalID":    fmt.Sprintf("0x%08X", cmd.PhysicalID),
+				"messageID":     fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
+				"command":       dny_protocol.CommandLabel(cmd.Command),
+				"commandDesc":   GetCommandDescription(cmd.Command),
+				"createTime":    cmd.CreateTime.Format("15:04:05.000"),
+				"age":           now.Sub(cmd.CreateTime).Seconds(),
+				"status":        cmd.Status,
+				"lastError":     cmd.LastError,
 			}).Info("命令超过最大生命周期，将被删除")
 			continue
 		}
 
-		// 检查命令是否超时
-		if now.Sub(cmd.LastSentTime) > CommandTimeout {
+		// 检查命令是否超时（等待时长按重发策略随重发次数计算）
+		if now.Sub(cmd.LastSentTime) > policy.wait(cmd.RetryCount) {
 			// 创建副本，避免后续处理时出现并发修改问题
 			cmdCopy := *cmd
 			timeoutCommands = append(timeoutCommands, &cmdCopy)
@@ -484,32 +596,38 @@ func (cm *CommandManager) checkTimeoutCommands() {
 
 	// 批量删除过期命令
 	if len(expiredCommandKeys) > 0 {
+		var failures []CommandFailure
 		cm.lock.Lock()
 		for _, key := range expiredCommandKeys {
+			if cmd, ok := cm.commands[key]; ok {
+				failures = append(failures, cm.giveUpLocked(cmd, now))
+			}
 			cm.deleteCommand(key)
 		}
 		cm.lock.Unlock()
+		cm.emitFailures(failures)
 
 		// 记录详细的过期命令信息
 		for _, cmd := range expiredCommands {
 			logger.WithFields(logrus.Fields{
-				"physicalID":  utils.FormatPhysicalID(cmd.PhysicalID),
-				"messageID":   fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
-				"command":     fmt.Sprintf("0x%02X", cmd.Command),
-				"commandDesc": GetCommandDescription(cmd.Command),
-				"connID":      cmd.ConnID,
-				"createTime":  cmd.CreateTime.Format("15:04:05.000"),
-				"age":         now.Sub(cmd.CreateTime).Seconds(),
-				"retryCount":  cmd.RetryCount,
-				"status":      cmd.Status,
-				"lastError":   cmd.LastError,
-				"dataHex":     hex.EncodeToString(cmd.Data),
+				"correlationID": cmd.CorrelationID,
+				"physicalID":    utils.FormatPhysicalID(cmd.PhysicalID),
+				"messageID":     fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
+				"command":       dny_protocol.CommandLabel(cmd.Command),
+				"commandDesc":   GetCommandDescription(cmd.Command),
+				"connID":        cmd.ConnID,
+				"createTime":    cmd.CreateTime.Format("15:04:05.000"),
+				"age":           now.Sub(cmd.CreateTime).Seconds(),
+				"retryCount":    cmd.RetryCount,
+				"status":        cmd.Status,
+				"lastError":     cmd.LastError,
+				"dataHex":       hex.EncodeToString(cmd.Data),
 			}).Debug("已删除过期命令详情")
 		}
 
 		logger.WithFields(logrus.Fields{
 			"count":      len(expiredCommandKeys),
-			"expireTime": CommandMaxAge.Seconds(),
+			"expireTime": maxAge.Seconds(),
 		}).Info("已批量清理过期命令")
 	}
 
@@ -544,13 +662,15 @@ func (cm *CommandManager) checkTimeoutCommands() {
 
 		logger.WithFields(logrus.Fields{
 			"count":       len(timeoutCommands),
-			"timeoutTime": CommandTimeout.Seconds(),
+			"timeoutTime": policy.Interval.Seconds(),
 		}).Info("已批量处理超时命令")
 	}
 }
 
 // processBatchTimeoutCommands 批量处理超时命令
 func (cm *CommandManager) processBatchTimeoutCommands(commands []*CommandEntry) {
+	var failures []CommandFailure
+	defer func() { cm.emitFailures(failures) }()
 	for _, cmd := range commands {
 		cmdKey := cm.GenerateCommandKey(cmd.Connection, cmd.PhysicalID, cmd.MessageID, cmd.Command)
 
@@ -564,38 +684,46 @@ func (cm *CommandManager) processBatchTimeoutCommands(commands []*CommandEntry)
 
 		// 日志记录超时情况
 		logger.WithFields(logrus.Fields{
-			"cmdKey":      cmdKey,
-			"physicalID":  utils.FormatPhysicalID(existingCmd.PhysicalID),
-			"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-			"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-			"commandDesc": GetCommandDescription(existingCmd.Command),
-			"retryCount":  existingCmd.RetryCount,
-			"timeSince":   time.Since(existingCmd.LastSentTime).Seconds(),
-			"createTime":  existingCmd.CreateTime.Format("15:04:05.000"),
-			"connID":      existingCmd.ConnID,
-			"dataHex":     hex.EncodeToString(existingCmd.Data),
-			"status":      existingCmd.Status,
+			"correlationID": existingCmd.CorrelationID,
+			"cmdKey":        cmdKey,
+			"physicalID":    utils.FormatPhysicalID(existingCmd.PhysicalID),
+			"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+			"command":       dny_protocol.CommandLabel(existingCmd.Command),
+			"commandDesc":   GetCommandDescription(existingCmd.Command),
+			"retryCount":    existingCmd.RetryCount,
+			"timeSince":     time.Since(existingCmd.LastSentTime).Seconds(),
+			"createTime":    existingCmd.CreateTime.Format("15:04:05.000"),
+			"connID":        existingCmd.ConnID,
+			"dataHex":       hex.EncodeToString(existingCmd.Data),
+			"status":        existingCmd.Status,
 		}).Info("发现超时命令")
 
 		// 如果重试次数已达上限，删除命令
-		if existingCmd.RetryCount >= cm.maxRetry {
+		maxRetry := cm.policy.MaxRetries
+		if existingCmd.RetryCount >= maxRetry {
 			// 更新状态为失败
 			existingCmd.Status = CmdStatusFailed
-			existingCmd.LastError = fmt.Sprintf("重试次数已达上限 (%d/%d)", existingCmd.RetryCount, cm.maxRetry)
+			existingCmd.LastError = fmt.Sprintf("重试次数已达上限 (%d/%d)", existingCmd.RetryCount, maxRetry)
+			existingCmd.failure = OutcomeDeviceTimeout
+			if existingCmd.sendFailed {
+				existingCmd.failure = OutcomeGatewayError
+			}
 
 			logger.WithFields(logrus.Fields{
-				"cmdKey":      cmdKey,
-				"physicalID":  fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
-				"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-				"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-				"commandDesc": GetCommandDescription(existingCmd.Command),
-				"retryCount":  existingCmd.RetryCount,
-				"maxRetry":    cm.maxRetry,
-				"age":         time.Since(existingCmd.CreateTime).Seconds(),
-				"status":      existingCmd.Status,
-				"lastError":   existingCmd.LastError,
+				"correlationID": existingCmd.CorrelationID,
+				"cmdKey":        cmdKey,
+				"physicalID":    fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
+				"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+				"command":       dny_protocol.CommandLabel(existingCmd.Command),
+				"commandDesc":   GetCommandDescription(existingCmd.Command),
+				"retryCount":    existingCmd.RetryCount,
+				"maxRetry":      maxRetry,
+				"age":           time.Since(existingCmd.CreateTime).Seconds(),
+				"status":        existingCmd.Status,
+				"lastError":     existingCmd.LastError,
 			}).Warn("命令重试次数已达上限，放弃重试")
-			delete(cm.commands, cmdKey)
+			failures = append(failures, cm.giveUpLocked(existingCmd, time.Now()))
+			cm.deleteCommand(cmdKey)
 			cm.lock.Unlock()
 			continue
 		}
@@ -606,18 +734,21 @@ func (cm *CommandManager) processBatchTimeoutCommands(commands []*CommandEntry)
 			// 更新状态为失败
 			existingCmd.Status = CmdStatusFailed
 			existingCmd.LastError = "连接已关闭"
+			existingCmd.failure = OutcomeDeviceOffline
 
 			logger.WithFields(logrus.Fields{
-				"cmdKey":      cmdKey,
-				"physicalID":  fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
-				"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-				"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-				"commandDesc": GetCommandDescription(existingCmd.Command),
-				"connID":      existingCmd.Connection.GetConnID(),
-				"reason":      existingCmd.LastError,
-				"status":      existingCmd.Status,
+				"correlationID": existingCmd.CorrelationID,
+				"cmdKey":        cmdKey,
+				"physicalID":    fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
+				"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+				"command":       dny_protocol.CommandLabel(existingCmd.Command),
+				"commandDesc":   GetCommandDescription(existingCmd.Command),
+				"connID":        existingCmd.Connection.GetConnID(),
+				"reason":        existingCmd.LastError,
+				"status":        existingCmd.Status,
 			}).Warn("命令重试失败：连接已关闭，放弃重试")
-			delete(cm.commands, cmdKey)
+			failures = append(failures, cm.giveUpLocked(existingCmd, time.Now()))
+			cm.deleteCommand(cmdKey)
 			cm.lock.Unlock()
 			continue
 		}
@@ -629,19 +760,22 @@ func (cm *CommandManager) processBatchTimeoutCommands(commands []*CommandEntry)
 			// 更新状态为失败
 			existingCmd.Status = CmdStatusFailed
 			existingCmd.LastError = "设备未注册"
+			existingCmd.failure = OutcomeDeviceOffline
 
 			logger.WithFields(logrus.Fields{
-				"cmdKey":      cmdKey,
-				"physicalID":  fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
-				"deviceId":    deviceId,
-				"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-				"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-				"commandDesc": GetCommandDescription(existingCmd.Command),
-				"connID":      existingCmd.Connection.GetConnID(),
-				"reason":      existingCmd.LastError,
-				"status":      existingCmd.Status,
+				"correlationID": existingCmd.CorrelationID,
+				"cmdKey":        cmdKey,
+				"physicalID":    fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
+				"deviceId":      deviceId,
+				"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+				"command":       dny_protocol.CommandLabel(existingCmd.Command),
+				"commandDesc":   GetCommandDescription(existingCmd.Command),
+				"connID":        existingCmd.Connection.GetConnID(),
+				"reason":        existingCmd.LastError,
+				"status":        existingCmd.Status,
 			}).Warn("命令重试失败：设备未注册，放弃重试")
-			delete(cm.commands, cmdKey)
+			failures = append(failures, cm.giveUpLocked(existingCmd, time.Now()))
+			cm.deleteCommand(cmdKey)
 			cm.lock.Unlock()
 			continue
 		}
@@ -651,22 +785,24 @@ func (cm *CommandManager) processBatchTimeoutCommands(commands []*CommandEntry)
 		existingCmd.Status = CmdStatusRetrying
 		lastSentTime := existingCmd.LastSentTime // 保存上次发送时间
 		existingCmd.LastSentTime = time.Now()
+		cm.retransmissions++
 
 		// 为了避免在发送过程中锁定，先解锁
 		cm.lock.Unlock()
 
 		// 记录重发日志
 		logger.WithFields(logrus.Fields{
-			"cmdKey":      cmdKey,
-			"physicalID":  utils.FormatPhysicalID(existingCmd.PhysicalID),
-			"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-			"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-			"commandDesc": GetCommandDescription(existingCmd.Command),
-			"retryCount":  existingCmd.RetryCount,
-			"timeSince":   time.Since(lastSentTime).Seconds(),
-			"connID":      existingCmd.ConnID,
-			"dataHex":     hex.EncodeToString(existingCmd.Data),
-			"status":      existingCmd.Status,
+			"correlationID": existingCmd.CorrelationID,
+			"cmdKey":        cmdKey,
+			"physicalID":    utils.FormatPhysicalID(existingCmd.PhysicalID),
+			"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+			"command":       dny_protocol.CommandLabel(existingCmd.Command),
+			"commandDesc":   GetCommandDescription(existingCmd.Command),
+			"retryCount":    existingCmd.RetryCount,
+			"timeSince":     time.Since(lastSentTime).Seconds(),
+			"connID":        existingCmd.ConnID,
+			"dataHex":       hex.EncodeToString(existingCmd.Data),
+			"status":        existingCmd.Status,
 		}).Info("重发超时命令")
 
 		// 重发命令 - 确保使用原始的messageID
@@ -690,28 +826,32 @@ func (cm *CommandManager) processBatchTimeoutCommands(commands []*CommandEntry)
 			if cmd, exists := cm.commands[cmdKey]; exists {
 				if err != nil {
 					cmd.LastError = err.Error()
+					cmd.sendFailed = true
 					logger.WithFields(logrus.Fields{
-						"cmdKey":      cmdKey,
-						"physicalID":  fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
-						"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-						"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-						"commandDesc": GetCommandDescription(existingCmd.Command),
-						"retryCount":  existingCmd.RetryCount,
-						"error":       err.Error(),
-						"sendTime":    sendTime,
-						"status":      cmd.Status,
+						"correlationID": existingCmd.CorrelationID,
+						"cmdKey":        cmdKey,
+						"physicalID":    fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
+						"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+						"command":       dny_protocol.CommandLabel(existingCmd.Command),
+						"commandDesc":   GetCommandDescription(existingCmd.Command),
+						"retryCount":    existingCmd.RetryCount,
+						"error":         err.Error(),
+						"sendTime":      sendTime,
+						"status":        cmd.Status,
 					}).Error("重发超时命令失败")
 				} else {
 					cmd.Status = CmdStatusSent
+					cmd.sendFailed = false
 					logger.WithFields(logrus.Fields{
-						"cmdKey":      cmdKey,
-						"physicalID":  fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
-						"messageID":   fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
-						"command":     fmt.Sprintf("0x%02X", existingCmd.Command),
-						"commandDesc": GetCommandDescription(existingCmd.Command),
-						"retryCount":  existingCmd.RetryCount,
-						"sendTime":    sendTime,
-						"status":      cmd.Status,
+						"correlationID": existingCmd.CorrelationID,
+						"cmdKey":        cmdKey,
+						"physicalID":    fmt.Sprintf("0x%08X", existingCmd.PhysicalID),
+						"messageID":     fmt.Sprintf("0x%04X (%d)", existingCmd.MessageID, existingCmd.MessageID),
+						"command":       dny_protocol.CommandLabel(existingCmd.Command),
+						"commandDesc":   GetCommandDescription(existingCmd.Command),
+						"retryCount":    existingCmd.RetryCount,
+						"sendTime":      sendTime,
+						"status":        cmd.Status,
 					}).Debug("重发超时命令成功")
 				}
 			}
@@ -797,6 +937,38 @@ func (cm *CommandManager) GetCommand(cmdKey string) *CommandEntry {
 	return nil
 }
 
+// GetPhysicalIDCommands 获取指定物理ID当前跟踪中的命令副本（含已确认待清理、失败、过期的命令）
+func (cm *CommandManager) GetPhysicalIDCommands(physicalID uint32) []CommandEntry {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	var entries []CommandEntry
+	for _, cmdKey := range cm.physicalCommands[physicalID] {
+		if entry, exists := cm.commands[cmdKey]; exists {
+			entryCopy := *entry
+			entryCopy.Connection = nil
+			entryCopy.done = nil
+			entries = append(entries, entryCopy)
+		}
+	}
+	return entries
+}
+
+// GetAllCommands 全部跟踪中命令的副本（不含连接引用）
+func (cm *CommandManager) GetAllCommands() []CommandEntry {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	entries := make([]CommandEntry, 0, len(cm.commands))
+	for _, entry := range cm.commands {
+		entryCopy := *entry
+		entryCopy.Connection = nil
+		entryCopy.done = nil
+		entries = append(entries, entryCopy)
+	}
+	return entries
+}
+
 // GetCommandDescription 获取命令描述 - 使用统一的命令注册表
 func GetCommandDescription(command uint8) string {
 	return constants.GetCommandDescription(command)
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// CommandOutcome 命令最终结果分类（SLA统计使用）
+type CommandOutcome string
+
+// 命令结果分类
+const (
+	OutcomeSuccess        CommandOutcome = "success"         // 设备确认
+	OutcomeDeviceTimeout  CommandOutcome = "device_timeout"  // 重试耗尽或超过最大生命周期仍未应答
+	OutcomeDeviceRejected CommandOutcome = "device_rejected" // 设备否定应答
+	OutcomeGatewayError   CommandOutcome = "gateway_error"   // 网关侧失败（写入失败、帧校验失败、只读等）
+	OutcomeDeviceOffline  CommandOutcome = "device_offline"  // 设备离线或连接断开
+)
+
+// CommandResult 命令结束时上报给观察者的结果
+type CommandResult struct {
+	DeviceID      string
+	PhysicalID    uint32
+	Command       uint8
+	CorrelationID string
+	Outcome       CommandOutcome
+	Reason        string
+	At            time.Time
+}
+
+// CommandOutcomeObserver 命令结果观察者，在命令结束时调用（可能持有命令管理器锁，实现需快速返回且不得回调命令管理器）
+type CommandOutcomeObserver func(result CommandResult)
+
+var commandOutcomeObserver atomic.Pointer[CommandOutcomeObserver]
+
+// SetCommandOutcomeObserver 设置命令结果观察者（由上层注入；重复设置时覆盖，nil 表示移除）
+func SetCommandOutcomeObserver(observer CommandOutcomeObserver) {
+	if observer == nil {
+		commandOutcomeObserver.Store(nil)
+		return
+	}
+	commandOutcomeObserver.Store(&observer)
+}
+
+// HasCommandOutcomeObserver 是否已设置命令结果观察者（装配自检使用）
+func HasCommandOutcomeObserver() bool {
+	return commandOutcomeObserver.Load() != nil
+}
+
+// ReportCommandOutcome 上报未进入命令管理器即失败的命令（如设备离线、帧校验失败）
+func ReportCommandOutcome(result CommandResult) {
+	observer := commandOutcomeObserver.Load()
+	if observer == nil {
+		return
+	}
+	if result.DeviceID == "" {
+		result.DeviceID = utils.FormatPhysicalID(result.PhysicalID)
+	}
+	if result.At.IsZero() {
+		result.At = time.Now()
+	}
+	(*observer)(result)
+}
+
+// outcome 已结束命令的结果分类；等待断线重发的命令尚未结束，返回空
+func (e *CommandEntry) outcome() CommandOutcome {
+	switch e.Status {
+	case CmdStatusConfirmed:
+		return OutcomeSuccess
+	case CmdStatusRejected:
+		return OutcomeDeviceRejected
+	case CmdStatusExpired:
+		if e.sendFailed {
+			return OutcomeGatewayError
+		}
+		return OutcomeDeviceTimeout
+	case CmdStatusDisconnected:
+		if e.ResendOnReconnect {
+			return ""
+		}
+		return OutcomeDeviceOffline
+	case CmdStatusFailed:
+		if e.failure != "" {
+			return e.failure
+		}
+		return OutcomeGatewayError
+	default:
+		// 未结束即被清理（设备重连/更换连接）
+		return OutcomeDeviceOffline
+	}
+}
+
+// reportEntryOutcome 上报命令结果
+func reportEntryOutcome(e *CommandEntry, outcome CommandOutcome) {
+	if outcome == "" {
+		return
+	}
+	ReportCommandOutcome(CommandResult{
+		PhysicalID:    e.PhysicalID,
+		Command:       e.Command,
+		CorrelationID: e.CorrelationID,
+		Outcome:       outcome,
+		Reason:        e.LastError,
+	})
+}
+
+// MarkSendFailed 记录命令写入失败（命令仍按原策略重试）；重试耗尽前最后一次写入仍失败时结果记为网关侧失败
+func (cm *CommandManager) MarkSendFailed(handle *CommandHandle, err error) {
+	if handle == nil || err == nil {
+		return
+	}
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	if cm.commands[handle.Key] != handle.entry {
+		return
+	}
+	handle.entry.LastError = err.Error()
+	handle.entry.sendFailed = true
+}
@@ -0,0 +1,200 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	apperrors "github.com/bujia-iot/iot-zinx/pkg/errors"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// CommandResendWindow 断线命令等待设备重新注册后重发的默认窗口
+const CommandResendWindow = 30 * time.Second
+
+// DeviceDisconnectedCode 设备断开导致命令提前失败时的错误标识
+const DeviceDisconnectedCode = "DEVICE_DISCONNECTED"
+
+// CommandOptions 命令注册选项
+type CommandOptions struct {
+	CorrelationID     string // 链路追踪ID
+	ResendOnReconnect bool   // 连接断开后，设备在重发窗口内重新注册时自动重发
+}
+
+// CommandHandle 已注册命令的句柄，用于同步等待应答
+type CommandHandle struct {
+	Key     string
+	entry   *CommandEntry
+	manager *CommandManager
+}
+
+// MessageID 命令的消息ID
+func (h *CommandHandle) MessageID() uint16 {
+	return h.entry.MessageID
+}
+
+// Wait 等待命令结束：确认返回nil；连接断开返回 ErrDeviceDisconnected 错误码的 *AppError；
+// 设备否定应答返回 ErrDeviceRejected 错误码的 *AppError（Cause 为 *RejectionError）；
+// 超时返回 ErrCommandTimeout；其余失败返回最后一次错误
+func (h *CommandHandle) Wait(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-h.entry.done:
+	case <-timer.C:
+		return apperrors.New(apperrors.ErrCommandTimeout, fmt.Sprintf("等待命令应答超时(%s)", timeout))
+	}
+	return h.result()
+}
+
+// result 已结束命令的结果（见 Wait）
+func (h *CommandHandle) result() error {
+	h.manager.lock.Lock()
+	status, lastError, rejection := h.entry.Status, h.entry.LastError, h.entry.Rejection
+	h.manager.lock.Unlock()
+
+	switch status {
+	case CmdStatusConfirmed:
+		return nil
+	case CmdStatusDisconnected:
+		return apperrors.New(apperrors.ErrDeviceDisconnected, lastError)
+	case CmdStatusRejected:
+		return apperrors.Wrap(apperrors.ErrDeviceRejected, DeviceRejectedCode, &RejectionError{PhysicalID: h.entry.PhysicalID, Rejection: *rejection})
+	default:
+		if lastError == "" {
+			lastError = "命令已被清理"
+		}
+		return fmt.Errorf("命令失败: %s", lastError)
+	}
+}
+
+// resendEntry 断线待重发命令
+type resendEntry struct {
+	entry          CommandEntry
+	disconnectedAt time.Time
+}
+
+// SetResendWindow 设置断线命令的重发窗口
+func (cm *CommandManager) SetResendWindow(window time.Duration) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	if window > 0 {
+		cm.resendWindow = window
+	}
+}
+
+// FailConnectionCommands 连接清理时立即失败该连接上所有待应答命令（唤醒等待者），
+// 设置了 ResendOnReconnect 的命令进入重发队列；返回失败的命令数
+func (cm *CommandManager) FailConnectionCommands(connID uint64, reason string) int {
+	now := time.Now()
+	var failed []CommandEntry
+
+	cm.lock.Lock()
+	for key, cmd := range cm.commands {
+		if cmd.ConnID != connID || cmd.Confirmed {
+			continue
+		}
+		cmd.Status = CmdStatusDisconnected
+		cmd.LastError = fmt.Sprintf("%s: 设备连接已断开(%s)", DeviceDisconnectedCode, reason)
+		if cmd.ResendOnReconnect {
+			cm.resendQueue[cmd.PhysicalID] = append(cm.resendQueue[cmd.PhysicalID], resendEntry{entry: *cmd, disconnectedAt: now})
+		}
+		failed = append(failed, *cmd)
+		cm.deleteCommand(key)
+	}
+	cm.lock.Unlock()
+
+	for _, cmd := range failed {
+		logger.WithFields(logrus.Fields{
+			"correlationID": cmd.CorrelationID,
+			"connID":        connID,
+			"physicalID":    utils.FormatPhysicalID(cmd.PhysicalID),
+			"messageID":     fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
+			"command":       dny_protocol.CommandLabel(cmd.Command),
+			"commandDesc":   GetCommandDescription(cmd.Command),
+			"age":           now.Sub(cmd.CreateTime).Seconds(),
+			"reason":        reason,
+			"resend":        cmd.ResendOnReconnect,
+		}).Warn("⚡ 设备连接断开，待应答命令已提前失败")
+	}
+	return len(failed)
+}
+
+// ResendOnReconnect 设备重新注册时重发其断线前未应答且允许重发的命令（沿用原messageID，仅重发一次）；返回重发数量
+func (cm *CommandManager) ResendOnReconnect(physicalID uint32, conn ziface.IConnection) int {
+	if conn == nil {
+		return 0
+	}
+	now := time.Now()
+
+	cm.lock.Lock()
+	queued := cm.resendQueue[physicalID]
+	delete(cm.resendQueue, physicalID)
+	window := cm.resendWindow
+	cm.lock.Unlock()
+
+	resent := 0
+	for _, q := range queued {
+		cmd := q.entry
+		fields := logrus.Fields{
+			"correlationID": cmd.CorrelationID,
+			"physicalID":    utils.FormatPhysicalID(physicalID),
+			"messageID":     fmt.Sprintf("0x%04X (%d)", cmd.MessageID, cmd.MessageID),
+			"command":       dny_protocol.CommandLabel(cmd.Command),
+			"commandDesc":   GetCommandDescription(cmd.Command),
+			"oldConnID":     cmd.ConnID,
+			"newConnID":     conn.GetConnID(),
+			"offline":       now.Sub(q.disconnectedAt).String(),
+		}
+		if now.Sub(q.disconnectedAt) > window {
+			logger.WithFields(fields).Info("设备重新注册超出重发窗口，放弃重发")
+			reportEntryOutcome(&cmd, OutcomeDeviceOffline)
+			continue
+		}
+
+		cm.RegisterCommandWithOptions(conn, physicalID, cmd.MessageID, cmd.Command, cmd.Data, CommandOptions{CorrelationID: cmd.CorrelationID})
+		if SendCommandFunc == nil {
+			logger.Error("未设置命令发送函数，无法重发命令")
+			continue
+		}
+		if err := SendCommandFunc(conn, physicalID, cmd.MessageID, cmd.Command, cmd.Data); err != nil {
+			fields["error"] = err.Error()
+			logger.WithFields(fields).Error("设备重新注册后重发命令失败")
+			continue
+		}
+		resent++
+		logger.WithFields(fields).Info("🔁 设备重新注册，已重发断线前未应答的命令")
+	}
+	return resent
+}
+
+// ResendQueueLength 指定设备待重发的命令数
+func (cm *CommandManager) ResendQueueLength(physicalID uint32) int {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return len(cm.resendQueue[physicalID])
+}
+
+// purgeExpiredResends 清理超出重发窗口的待重发命令
+func (cm *CommandManager) purgeExpiredResends(now time.Time) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	for physicalID, queued := range cm.resendQueue {
+		kept := queued[:0]
+		for _, q := range queued {
+			if now.Sub(q.disconnectedAt) <= cm.resendWindow {
+				kept = append(kept, q)
+				continue
+			}
+			reportEntryOutcome(&q.entry, OutcomeDeviceOffline)
+		}
+		if len(kept) == 0 {
+			delete(cm.resendQueue, physicalID)
+		} else {
+			cm.resendQueue[physicalID] = kept
+		}
+	}
+}
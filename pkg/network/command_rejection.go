@@ -0,0 +1,187 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceRejectedCode 设备否定应答导致命令提前失败时的错误标识
+const DeviceRejectedCode = "DEVICE_REJECTED"
+
+// EventTypeCommandRejected 命令被设备拒绝（发布到事件总线设备主题）
+const EventTypeCommandRejected = "command_rejected"
+
+// rejectionHistoryLimit 每台设备保留的最近否定应答条数
+const rejectionHistoryLimit = 20
+
+// CommandRejection 设备对命令的否定应答
+type CommandRejection struct {
+	MessageID     uint16    `json:"messageId"`
+	Command       uint8     `json:"command"`      // 被拒绝的命令
+	ReplyCommand  uint8     `json:"replyCommand"` // 否定应答帧的命令码（通用错误帧与原命令不同）
+	ErrorCode     uint8     `json:"errorCode"`    // 设备上报的错误码
+	Format        string    `json:"format"`       // 否定应答格式，见 protocol.NAKFormat*
+	CorrelationID string    `json:"correlationId,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+// RejectionError 设备拒绝命令（CommandHandle.Wait 返回的 *AppError 的 Cause）
+type RejectionError struct {
+	PhysicalID uint32
+	Rejection  CommandRejection
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("设备 %s 拒绝命令 0x%02X（错误码 0x%02X，%s）",
+		utils.FormatPhysicalID(e.PhysicalID), e.Rejection.Command, e.Rejection.ErrorCode, e.Rejection.Format)
+}
+
+// DeviceRejectionStats 设备被拒绝命令统计，供能力探测判断固件实际不支持的命令
+type DeviceRejectionStats struct {
+	Total     int64              `json:"total"`
+	ByCommand map[string]int64   `json:"byCommand"` // 命令码（0x8A）→ 被拒绝次数
+	Recent    []CommandRejection `json:"recent"`    // 最近的否定应答（新→旧）
+}
+
+type rejectionStats struct {
+	total     int64
+	byCommand map[uint8]int64
+	recent    []CommandRejection
+}
+
+// PendingCommand 设备上指定消息ID的待应答命令码
+func (cm *CommandManager) PendingCommand(physicalID uint32, messageID uint16) (uint8, bool) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	if _, cmd := cm.pendingByMessageID(physicalID, messageID); cmd != nil {
+		return cmd.Command, true
+	}
+	return 0, false
+}
+
+// RejectCommand 按消息ID将待应答命令以设备否定应答立即结束（不再等待超时与重试），唤醒等待者并记入设备的拒绝统计；
+// 未找到待应答命令时返回false
+func (cm *CommandManager) RejectCommand(physicalID uint32, rejection CommandRejection) bool {
+	if rejection.At.IsZero() {
+		rejection.At = time.Now()
+	}
+
+	cm.lock.Lock()
+	key, cmd := cm.pendingByMessageID(physicalID, rejection.MessageID)
+	if cmd == nil {
+		cm.lock.Unlock()
+		return false
+	}
+	rejection.Command = cmd.Command
+	rejection.CorrelationID = cmd.CorrelationID
+	cmd.Status = CmdStatusRejected
+	cmd.Rejection = &rejection
+	cmd.LastError = fmt.Sprintf("%s: 设备拒绝命令（错误码 0x%02X，%s）", DeviceRejectedCode, rejection.ErrorCode, rejection.Format)
+	cm.recordRejectionLocked(physicalID, rejection)
+	cm.deleteCommand(key)
+	cm.lock.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"correlationID": rejection.CorrelationID,
+		"physicalID":    utils.FormatPhysicalID(physicalID),
+		"messageID":     fmt.Sprintf("0x%04X (%d)", rejection.MessageID, rejection.MessageID),
+		"command":       dny_protocol.CommandLabel(rejection.Command),
+		"replyCommand":  fmt.Sprintf("0x%02X", rejection.ReplyCommand),
+		"errorCode":     fmt.Sprintf("0x%02X", rejection.ErrorCode),
+		"format":        rejection.Format,
+	}).Warn("设备否定应答，命令已提前失败")
+
+	events.GetGlobalBus().Publish(events.TopicDevice, EventTypeCommandRejected, utils.FormatPhysicalID(physicalID), rejection)
+	return true
+}
+
+// HandleNegativeAck 上行帧为待应答命令的否定应答时结束该命令，返回是否已处理
+func (cm *CommandManager) HandleNegativeAck(msg *dny_protocol.Message) bool {
+	if msg == nil {
+		return false
+	}
+	nak, ok := protocol.DecodeNegativeAck(msg, func(messageID uint16) (uint8, bool) {
+		return cm.PendingCommand(msg.PhysicalId, messageID)
+	})
+	if !ok {
+		return false
+	}
+	return cm.RejectCommand(msg.PhysicalId, CommandRejection{
+		MessageID:    nak.MessageID,
+		ReplyCommand: nak.ReplyCommand,
+		ErrorCode:    nak.ErrorCode,
+		Format:       nak.Format,
+	})
+}
+
+// GetRejectionStats 设备被拒绝命令统计；没有拒绝记录时返回false
+func (cm *CommandManager) GetRejectionStats(physicalID uint32) (DeviceRejectionStats, bool) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	stats, ok := cm.rejections[physicalID]
+	if !ok {
+		return DeviceRejectionStats{}, false
+	}
+	result := DeviceRejectionStats{
+		Total:     stats.total,
+		ByCommand: make(map[string]int64, len(stats.byCommand)),
+		Recent:    append([]CommandRejection(nil), stats.recent...),
+	}
+	for command, n := range stats.byCommand {
+		result.ByCommand[fmt.Sprintf("0x%02X", command)] = n
+	}
+	return result, true
+}
+
+// ResetRejectionStats 清除设备的拒绝统计（如固件升级后）
+func (cm *CommandManager) ResetRejectionStats(physicalID uint32) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	delete(cm.rejections, physicalID)
+}
+
+// pendingByMessageID 设备上消息ID匹配的未结束命令（调用方持有 cm.lock）；同一消息ID有多条时取最早下发的
+func (cm *CommandManager) pendingByMessageID(physicalID uint32, messageID uint16) (string, *CommandEntry) {
+	var (
+		matchedKey string
+		matched    *CommandEntry
+	)
+	for _, key := range cm.physicalCommands[physicalID] {
+		cmd, ok := cm.commands[key]
+		if !ok || cmd.Confirmed || cmd.MessageID != messageID {
+			continue
+		}
+		switch cmd.Status {
+		case CmdStatusFailed, CmdStatusExpired, CmdStatusDisconnected, CmdStatusRejected:
+			continue
+		}
+		if matched == nil || cmd.CreateTime.Before(matched.CreateTime) {
+			matchedKey, matched = key, cmd
+		}
+	}
+	return matchedKey, matched
+}
+
+func (cm *CommandManager) recordRejectionLocked(physicalID uint32, rejection CommandRejection) {
+	if cm.rejections == nil {
+		cm.rejections = make(map[uint32]*rejectionStats)
+	}
+	stats, ok := cm.rejections[physicalID]
+	if !ok {
+		stats = &rejectionStats{byCommand: make(map[uint8]int64)}
+		cm.rejections[physicalID] = stats
+	}
+	stats.total++
+	stats.byCommand[rejection.Command]++
+	stats.recent = append([]CommandRejection{rejection}, stats.recent...)
+	if len(stats.recent) > rejectionHistoryLimit {
+		stats.recent = stats.recent[:rejectionHistoryLimit]
+	}
+}
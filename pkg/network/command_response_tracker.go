@@ -0,0 +1,168 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	apperrors "github.com/bujia-iot/iot-zinx/pkg/errors"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// CommandResponse 设备对下发命令的应答帧
+type CommandResponse struct {
+	PhysicalID uint32
+	MessageID  uint16
+	Command    uint8
+	Payload    []byte // 应答数据部分
+	RawFrame   []byte // 完整应答帧
+	ReceivedAt time.Time
+}
+
+// responseKey 应答匹配键：物理ID + 消息ID + 命令码
+type responseKey struct {
+	physicalID uint32
+	messageID  uint16
+	command    uint8
+}
+
+// ResponseWaiter 等待单条命令应答帧
+type ResponseWaiter struct {
+	key     responseKey
+	ch      chan *CommandResponse
+	tracker *CommandResponseTracker
+}
+
+// CommandResponseTracker 同步命令的应答帧跟踪：发送前按 (物理ID, 消息ID, 命令码) 登记，
+// 解码器收到匹配的应答帧时投递给等待者，并发请求按消息ID各自匹配互不串扰
+type CommandResponseTracker struct {
+	mu      sync.Mutex
+	waiters map[responseKey]*ResponseWaiter
+}
+
+// NewCommandResponseTracker 创建应答帧跟踪器
+func NewCommandResponseTracker() *CommandResponseTracker {
+	return &CommandResponseTracker{waiters: make(map[responseKey]*ResponseWaiter)}
+}
+
+// Expect 登记待应答命令（须在写入设备前调用，避免应答先于登记到达）
+func (t *CommandResponseTracker) Expect(physicalID uint32, messageID uint16, command uint8) (*ResponseWaiter, error) {
+	key := responseKey{physicalID: physicalID, messageID: messageID, command: command}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.waiters[key]; exists {
+		return nil, fmt.Errorf("设备 %s 消息ID 0x%04X 命令 0x%02X 已在等待应答", utils.FormatPhysicalID(physicalID), messageID, command)
+	}
+	w := &ResponseWaiter{key: key, ch: make(chan *CommandResponse, 1), tracker: t}
+	t.waiters[key] = w
+	return w, nil
+}
+
+// Deliver 投递解码出的上行帧：匹配到等待者时交付应答、确认命令管理器中的对应命令并返回true
+func (t *CommandResponseTracker) Deliver(msg *dny_protocol.Message) bool {
+	if msg == nil {
+		return false
+	}
+	key := responseKey{physicalID: msg.PhysicalId, messageID: msg.MessageId, command: uint8(msg.CommandId)}
+	t.mu.Lock()
+	w, ok := t.waiters[key]
+	if ok {
+		delete(t.waiters, key)
+	}
+	t.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	w.ch <- &CommandResponse{
+		PhysicalID: msg.PhysicalId,
+		MessageID:  msg.MessageId,
+		Command:    uint8(msg.CommandId),
+		Payload:    append([]byte(nil), msg.Data...),
+		RawFrame:   append([]byte(nil), msg.RawData...),
+		ReceivedAt: time.Now(),
+	}
+	// 应答已送达：结束命令的超时重试，设备组出站队列随即写入下一条命令
+	if cm := globalCommandManager.Load(); cm != nil {
+		cm.ConfirmCommand(key.physicalID, key.messageID, key.command)
+	}
+	logger.WithFields(logrus.Fields{
+		"physicalID": utils.FormatPhysicalID(key.physicalID),
+		"messageID":  fmt.Sprintf("0x%04X", key.messageID),
+		"command":    dny_protocol.CommandLabel(key.command),
+	}).Debug("同步命令应答已投递")
+	return true
+}
+
+// Pending 等待应答的命令数
+func (t *CommandResponseTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.waiters)
+}
+
+// MessageID 等待的消息ID
+func (w *ResponseWaiter) MessageID() uint16 {
+	return w.key.messageID
+}
+
+// Cancel 撤销登记（已投递或已撤销时无操作）
+func (w *ResponseWaiter) Cancel() {
+	w.tracker.mu.Lock()
+	if w.tracker.waiters[w.key] == w {
+		delete(w.tracker.waiters, w.key)
+	}
+	w.tracker.mu.Unlock()
+}
+
+// Wait 等待应答帧，返回前撤销登记。handle 非nil时，命令被设备否定应答或连接断开立即返回 CommandHandle.Wait 的对应错误；
+// 超时返回 ErrCommandTimeout 错误码的 *AppError
+func (w *ResponseWaiter) Wait(handle *CommandHandle, timeout time.Duration) (*CommandResponse, error) {
+	defer w.Cancel()
+	var done <-chan struct{}
+	if handle != nil {
+		done = handle.entry.done
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case resp := <-w.ch:
+			return resp, nil
+		case <-done:
+			// 命令结束：应答可能已同时投递
+			select {
+			case resp := <-w.ch:
+				return resp, nil
+			default:
+			}
+			err := handle.result()
+			if apperrors.IsErrCode(err, apperrors.ErrDeviceRejected) || apperrors.IsErrCode(err, apperrors.ErrDeviceDisconnected) {
+				return nil, err
+			}
+			// 其他路径确认或重试耗尽：设备仍可能迟到应答，继续等待至超时
+			done = nil
+		case <-timer.C:
+			return nil, apperrors.New(apperrors.ErrCommandTimeout, fmt.Sprintf("等待设备应答超时(%s)，消息ID 0x%04X", timeout, w.key.messageID))
+		}
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalCommandResponseTracker atomic.Pointer[CommandResponseTracker]
+
+// GetCommandResponseTracker 获取全局应答帧跟踪器（首次使用时创建）
+func GetCommandResponseTracker() *CommandResponseTracker {
+	if t := globalCommandResponseTracker.Load(); t != nil {
+		return t
+	}
+	globalCommandResponseTracker.CompareAndSwap(nil, NewCommandResponseTracker())
+	return globalCommandResponseTracker.Load()
+}
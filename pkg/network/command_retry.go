@@ -0,0 +1,205 @@
+package network
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// 巡检间隔上下限：等待时长较短时按其1/4巡检，保证重发时刻的误差远小于等待时长
+const (
+	maxRetryCheckInterval = time.Second
+	minRetryCheckInterval = 10 * time.Millisecond
+)
+
+// RetryPolicy 命令重发策略：每次发送后等待 Interval 仍未确认时，在原连接上按原消息ID重发同一命令（设备据此去重），
+// 重发 MaxRetries 次后仍未确认则放弃并通知失败回调
+type RetryPolicy struct {
+	Interval    time.Duration // 每次发送后等待应答的时长
+	MaxRetries  int           // 重发次数上限（不含首次发送）
+	Exponential bool          // 指数退避：第n次重发后等待 Interval×2^n
+	MaxInterval time.Duration // 指数退避的单次等待上限，0 表示不限
+}
+
+// DefaultRetryPolicy 默认重发策略：等待15秒，重发2次
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Interval: CommandTimeout, MaxRetries: CommandRetryCount}
+}
+
+// normalized 补全未设置的字段
+func (p RetryPolicy) normalized() RetryPolicy {
+	if p.Interval <= 0 {
+		p.Interval = CommandTimeout
+	}
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	}
+	if p.MaxInterval > 0 && p.MaxInterval < p.Interval {
+		p.MaxInterval = p.Interval
+	}
+	return p
+}
+
+// wait 已重发 retryCount 次后等待应答的时长
+func (p RetryPolicy) wait(retryCount int) time.Duration {
+	if !p.Exponential {
+		return p.Interval
+	}
+	wait := p.Interval
+	for i := 0; i < retryCount; i++ {
+		wait *= 2
+		if p.MaxInterval > 0 && wait >= p.MaxInterval {
+			return p.MaxInterval
+		}
+	}
+	return wait
+}
+
+// maxAge 命令最大生命周期：完整重发计划再加一个等待时长的余量（默认策略为60秒，即 CommandMaxAge）
+func (p RetryPolicy) maxAge() time.Duration {
+	total := p.Interval
+	for i := 0; i <= p.MaxRetries; i++ {
+		total += p.wait(i)
+	}
+	return total
+}
+
+// checkInterval 超时巡检间隔
+func (p RetryPolicy) checkInterval() time.Duration {
+	interval := p.Interval / 4
+	if interval > maxRetryCheckInterval {
+		return maxRetryCheckInterval
+	}
+	if interval < minRetryCheckInterval {
+		return minRetryCheckInterval
+	}
+	return interval
+}
+
+// SetRetryPolicy 设置重发策略（在 Start 之前设置，巡检间隔按启动时的策略确定）
+func (cm *CommandManager) SetRetryPolicy(policy RetryPolicy) {
+	policy = policy.normalized()
+	cm.lock.Lock()
+	cm.policy = policy
+	cm.lock.Unlock()
+	logger.WithFields(logrus.Fields{
+		"interval":    policy.Interval.String(),
+		"maxRetries":  policy.MaxRetries,
+		"exponential": policy.Exponential,
+		"maxInterval": policy.MaxInterval.String(),
+		"maxAge":      policy.maxAge().String(),
+	}).Info("命令重发策略已设置")
+}
+
+// RetryPolicy 当前生效的重发策略
+func (cm *CommandManager) RetryPolicy() RetryPolicy {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return cm.policy
+}
+
+// CommandFailure 命令放弃重发时上报给失败回调的信息
+type CommandFailure struct {
+	DeviceID      string
+	PhysicalID    uint32
+	MessageID     uint16
+	Command       uint8
+	Data          []byte
+	CorrelationID string
+	Attempts      int            // 实际发送次数（首次发送+重发）
+	Outcome       CommandOutcome // 失败分类：device_timeout/gateway_error/device_offline
+	Reason        string
+	At            time.Time
+}
+
+// CommandFailureHandler 命令失败回调，在重发耗尽、超过最大生命周期或重发前连接已关闭/设备未注册而放弃时调用（不持有命令管理器锁）
+type CommandFailureHandler func(failure CommandFailure)
+
+// RegisterFailureHandler 注册命令失败回调
+func (cm *CommandManager) RegisterFailureHandler(handler CommandFailureHandler) {
+	if handler == nil {
+		return
+	}
+	cm.lock.Lock()
+	cm.failureHandlers = append(cm.failureHandlers, handler)
+	cm.lock.Unlock()
+}
+
+// FailureHandlerCount 已注册的命令失败回调数量
+func (cm *CommandManager) FailureHandlerCount() int {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return len(cm.failureHandlers)
+}
+
+// giveUpLocked 放弃命令：计入失败统计并生成失败回调信息（调用前需加锁，状态与失败原因已更新）
+func (cm *CommandManager) giveUpLocked(cmd *CommandEntry, now time.Time) CommandFailure {
+	cm.failed++
+	return CommandFailure{
+		DeviceID:      utils.FormatPhysicalID(cmd.PhysicalID),
+		PhysicalID:    cmd.PhysicalID,
+		MessageID:     cmd.MessageID,
+		Command:       cmd.Command,
+		Data:          append([]byte(nil), cmd.Data...),
+		CorrelationID: cmd.CorrelationID,
+		Attempts:      cmd.RetryCount + 1,
+		Outcome:       cmd.outcome(),
+		Reason:        cmd.LastError,
+		At:            now,
+	}
+}
+
+// emitFailures 依次通知失败回调（调用方已释放锁）
+func (cm *CommandManager) emitFailures(failures []CommandFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	cm.lock.Lock()
+	handlers := cm.failureHandlers
+	cm.lock.Unlock()
+	for _, failure := range failures {
+		for _, handler := range handlers {
+			handler(failure)
+		}
+	}
+}
+
+// CommandStats 命令管理器统计
+type CommandStats struct {
+	Pending         int   `json:"pending"`         // 已发送、尚未重发的待应答命令
+	Retrying        int   `json:"retrying"`        // 已重发仍在等待应答的命令
+	Failed          int64 `json:"failed"`          // 累计放弃重发的命令
+	Retransmissions int64 `json:"retransmissions"` // 累计重发次数
+
+	IntervalMs    int64 `json:"interval_ms"` // 重发策略：每次发送后等待应答的时长
+	MaxRetries    int   `json:"max_retries"`
+	Exponential   bool  `json:"exponential"`
+	MaxIntervalMs int64 `json:"max_interval_ms,omitempty"`
+}
+
+// Stats 统计快照
+func (cm *CommandManager) Stats() CommandStats {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	stats := CommandStats{
+		Failed:          cm.failed,
+		Retransmissions: cm.retransmissions,
+		IntervalMs:      cm.policy.Interval.Milliseconds(),
+		MaxRetries:      cm.policy.MaxRetries,
+		Exponential:     cm.policy.Exponential,
+		MaxIntervalMs:   cm.policy.MaxInterval.Milliseconds(),
+	}
+	for _, entry := range cm.commands {
+		if entry.Confirmed || entry.Status == CmdStatusFailed || entry.Status == CmdStatusExpired {
+			continue
+		}
+		if entry.RetryCount > 0 {
+			stats.Retrying++
+		} else {
+			stats.Pending++
+		}
+	}
+	return stats
+}
@@ -0,0 +1,61 @@
+package network
+
+import "time"
+
+// CommandRTTStats 设备命令往返时延统计（下发→应答确认）
+// 按 RFC 6298 平滑：SRTT = 7/8·SRTT + 1/8·样本，RTTVar = 3/4·RTTVar + 1/4·|SRTT−样本|
+type CommandRTTStats struct {
+	Samples   int64         `json:"samples"`
+	Last      time.Duration `json:"last"`
+	Smoothed  time.Duration `json:"smoothed"`
+	Variance  time.Duration `json:"variance"`
+	Max       time.Duration `json:"max"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// observeRTT 记录一次确认的往返时延（调用方持有 cm.lock）；重发过的命令无法区分应答对应哪次发送，不计入样本
+func (cm *CommandManager) observeRTT(cmd *CommandEntry, now time.Time) {
+	if cmd.RetryCount > 0 || cmd.LastSentTime.IsZero() || cm.rtt == nil {
+		return
+	}
+	sample := now.Sub(cmd.LastSentTime)
+	if sample < 0 {
+		return
+	}
+	stats, ok := cm.rtt[cmd.PhysicalID]
+	if !ok {
+		stats = &CommandRTTStats{Smoothed: sample, Variance: sample / 2}
+		cm.rtt[cmd.PhysicalID] = stats
+	} else {
+		diff := stats.Smoothed - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		stats.Variance = (3*stats.Variance + diff) / 4
+		stats.Smoothed = (7*stats.Smoothed + sample) / 8
+	}
+	stats.Samples++
+	stats.Last = sample
+	if sample > stats.Max {
+		stats.Max = sample
+	}
+	stats.UpdatedAt = now
+}
+
+// GetRTTStats 获取设备的命令往返时延统计；尚无确认样本时返回false
+func (cm *CommandManager) GetRTTStats(physicalID uint32) (CommandRTTStats, bool) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	stats, ok := cm.rtt[physicalID]
+	if !ok {
+		return CommandRTTStats{}, false
+	}
+	return *stats, true
+}
+
+// ResetRTTStats 清除设备的往返时延统计
+func (cm *CommandManager) ResetRTTStats(physicalID uint32) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	delete(cm.rtt, physicalID)
+}
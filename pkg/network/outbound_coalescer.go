@@ -0,0 +1,84 @@
+package network
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// outboundCoalescer 低流量连接的下行帧合并：窗口内发往同一连接的帧拼接为一次TCP写入，
+// 批次达到字节上限时立即写出；调用方阻塞到所在批次写出，并得到该次写入的结果
+type outboundCoalescer struct {
+	mu      sync.Mutex
+	batches map[uint64]*outboundBatch
+}
+
+type outboundBatch struct {
+	conn     ziface.IConnection
+	deviceID string
+	config   SendConfig
+	frames   [][]byte
+	size     int
+	timer    *time.Timer
+	done     chan struct{}
+	err      error
+}
+
+func newOutboundCoalescer() *outboundCoalescer {
+	return &outboundCoalescer{batches: make(map[uint64]*outboundBatch)}
+}
+
+// submit 加入连接的当前批次（没有时新建并启动合并窗口），等待批次写出
+func (c *outboundCoalescer) submit(s *UnifiedSender, reg *lowdata.Registry, conn ziface.IConnection, deviceID string, data []byte, config SendConfig) error {
+	opts := reg.Options()
+	connID := conn.GetConnID()
+	c.mu.Lock()
+	b, ok := c.batches[connID]
+	if !ok {
+		b = &outboundBatch{conn: conn, deviceID: deviceID, config: config, done: make(chan struct{})}
+		c.batches[connID] = b
+		b.timer = time.AfterFunc(opts.CoalesceWindow, func() { c.flush(s, reg, connID, b) })
+	}
+	b.frames = append(b.frames, data)
+	b.size += len(data)
+	full := b.size >= opts.CoalesceMaxBytes
+	c.mu.Unlock()
+
+	if full {
+		c.flush(s, reg, connID, b)
+	}
+	<-b.done
+	return b.err
+}
+
+// flush 写出批次；批次已被写出（窗口到期与达到上限并发）时直接返回
+func (c *outboundCoalescer) flush(s *UnifiedSender, reg *lowdata.Registry, connID uint64, b *outboundBatch) {
+	c.mu.Lock()
+	if c.batches[connID] != b {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.batches, connID)
+	c.mu.Unlock()
+	b.timer.Stop()
+
+	data := bytes.Join(b.frames, nil)
+	b.err = s.write(b.conn, data, b.config)
+	if b.err == nil {
+		reg.RecordWrite(connID, b.deviceID, len(data), len(b.frames), time.Now())
+	}
+	close(b.done)
+}
+
+// frameDeviceID DNY帧的设备ID（物理ID位于帧偏移5，小端）；非DNY帧返回空
+func frameDeviceID(sendType SendType, data []byte) string {
+	if sendType == SendTypeRaw || len(data) < lowdata.FrameOverheadBytes || string(data[:3]) != "DNY" {
+		return ""
+	}
+	physicalID := uint32(data[5]) | uint32(data[6])<<8 | uint32(data[7])<<16 | uint32(data[8])<<24
+	return utils.FormatPhysicalID(physicalID)
+}
@@ -0,0 +1,364 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 自适应读超时默认值
+const (
+	defaultPreRegistrationDeadline = 60 * time.Second
+	defaultDeadlineFactor          = 3.0
+	defaultMinDeadline             = 90 * time.Second
+	defaultMaxDeadline             = 900 * time.Second
+	defaultDeadlineEWMAAlpha       = 0.2
+	defaultProbeGrace              = 30 * time.Second
+	defaultDeadlineCheckInterval   = 5 * time.Second
+	deadlineBurstWindow            = time.Second      // 间隔小于该值的帧视为同一批上报，不计入帧间隔样本
+	socketDeadlineSlack            = 10 * time.Second // 套接字读超时晚于断开时间点，由巡检先断开并记录原因，套接字超时仅兜底
+)
+
+// 读超时阶段
+const (
+	DeadlineStagePreRegistration = "pre_registration" // 未注册：短而固定的读超时，超时直接断开
+	DeadlineStageNormal          = "normal"           // 已注册：按帧间隔EWMA推导的读超时
+	DeadlineStageWarning         = "warning"          // 已超过有效读超时，已告警并下发探测，等待宽限期
+)
+
+// ReadDeadlineOptions 自适应读超时参数
+type ReadDeadlineOptions struct {
+	PreRegistration time.Duration // 未注册连接距最近一帧的读超时
+	Factor          float64       // 有效读超时 = 帧间隔EWMA × Factor
+	Min             time.Duration // 有效读超时下限
+	Max             time.Duration // 有效读超时上限（尚无帧间隔样本时采用）
+	Alpha           float64       // EWMA平滑系数(0,1]，越大越跟随最近的间隔
+	ProbeGrace      time.Duration // 告警并探测后的宽限期，期间仍无任何帧则断开
+	CheckInterval   time.Duration // 巡检间隔
+}
+
+// ReadDeadlineStatus 连接读超时状态（设备详情 verbose 输出）
+type ReadDeadlineStatus struct {
+	Stage            string    `json:"stage"`
+	Registered       bool      `json:"registered"`
+	EWMASeconds      float64   `json:"ewmaSeconds"` // 帧间隔EWMA，0表示尚无样本
+	Samples          int       `json:"samples"`
+	EffectiveSeconds float64   `json:"effectiveSeconds"` // 当前有效读超时
+	LastFrameAt      time.Time `json:"lastFrameAt"`
+	WarnAt           time.Time `json:"warnAt,omitempty"` // 告警并探测的时间点（未注册连接无告警阶段）
+	CloseAt          time.Time `json:"closeAt"`          // 仍无任何帧时断开的时间点
+	Probes           int       `json:"probes"`           // 本连接累计探测次数
+}
+
+// connDeadline 单连接读超时状态
+type connDeadline struct {
+	conn       ziface.IConnection
+	deviceID   string // 探测目标（连接上首个注册的设备）
+	registered bool
+	lastFrame  time.Time
+	ewma       time.Duration
+	samples    int
+	warned     bool
+	probes     int
+}
+
+// ReadDeadlineTracker 按连接自适应读超时：已注册设备的读超时跟随观测到的帧间隔（待机设备长、充电设备短），
+// 超时先告警并下发探测，宽限期内仍无任何帧才断开；未注册连接使用短而固定的读超时
+type ReadDeadlineTracker struct {
+	opts  ReadDeadlineOptions
+	mu    sync.Mutex
+	conns map[uint64]*connDeadline
+	probe atomic.Value // func(deviceID string) error
+
+	warnings atomic.Int64
+	closes   atomic.Int64
+}
+
+// NewReadDeadlineTracker 创建自适应读超时跟踪器（未设置的参数取默认值）
+func NewReadDeadlineTracker(opts ReadDeadlineOptions) *ReadDeadlineTracker {
+	if opts.PreRegistration <= 0 {
+		opts.PreRegistration = defaultPreRegistrationDeadline
+	}
+	if opts.Factor <= 0 {
+		opts.Factor = defaultDeadlineFactor
+	}
+	if opts.Min <= 0 {
+		opts.Min = defaultMinDeadline
+	}
+	if opts.Max <= 0 {
+		opts.Max = defaultMaxDeadline
+	}
+	if opts.Max < opts.Min {
+		opts.Max = opts.Min
+	}
+	if opts.Alpha <= 0 || opts.Alpha > 1 {
+		opts.Alpha = defaultDeadlineEWMAAlpha
+	}
+	if opts.ProbeGrace <= 0 {
+		opts.ProbeGrace = defaultProbeGrace
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = defaultDeadlineCheckInterval
+	}
+	return &ReadDeadlineTracker{opts: opts, conns: make(map[uint64]*connDeadline)}
+}
+
+// Options 生效的参数
+func (t *ReadDeadlineTracker) Options() ReadDeadlineOptions {
+	return t.opts
+}
+
+// SetProbe 设置告警阶段的探测函数（向设备下发一条必有应答的查询，应答帧即重置读超时）
+func (t *ReadDeadlineTracker) SetProbe(probe func(deviceID string) error) {
+	t.probe.Store(probe)
+}
+
+// OnConnect 连接建立：进入未注册阶段
+func (t *ReadDeadlineTracker) OnConnect(conn ziface.IConnection, now time.Time) {
+	t.mu.Lock()
+	state := &connDeadline{conn: conn, lastFrame: now}
+	t.conns[conn.GetConnID()] = state
+	closeAt := t.closeAtLocked(state)
+	t.mu.Unlock()
+	applySocketDeadline(conn, closeAt)
+}
+
+// OnFrame 收到完整帧：更新帧间隔EWMA、解除告警并顺延读超时
+func (t *ReadDeadlineTracker) OnFrame(conn ziface.IConnection, now time.Time) {
+	t.mu.Lock()
+	state, ok := t.conns[conn.GetConnID()]
+	if !ok {
+		state = &connDeadline{conn: conn, lastFrame: now}
+		t.conns[conn.GetConnID()] = state
+	}
+	if gap := now.Sub(state.lastFrame); gap >= deadlineBurstWindow {
+		if state.samples == 0 {
+			state.ewma = gap
+		} else {
+			state.ewma = time.Duration(t.opts.Alpha*float64(gap) + (1-t.opts.Alpha)*float64(state.ewma))
+		}
+		state.samples++
+	}
+	if now.After(state.lastFrame) {
+		state.lastFrame = now
+	}
+	state.warned = false
+	closeAt := t.closeAtLocked(state)
+	t.mu.Unlock()
+	applySocketDeadline(conn, closeAt)
+}
+
+// MarkRegistered 连接上有设备完成注册：切换为按帧间隔自适应的读超时
+func (t *ReadDeadlineTracker) MarkRegistered(conn ziface.IConnection, deviceID string, now time.Time) {
+	t.mu.Lock()
+	state, ok := t.conns[conn.GetConnID()]
+	if !ok {
+		state = &connDeadline{conn: conn, lastFrame: now}
+		t.conns[conn.GetConnID()] = state
+	}
+	state.registered = true
+	if state.deviceID == "" {
+		state.deviceID = deviceID
+	}
+	closeAt := t.closeAtLocked(state)
+	t.mu.Unlock()
+	applySocketDeadline(conn, closeAt)
+}
+
+// Forget 连接关闭后移除状态
+func (t *ReadDeadlineTracker) Forget(connID uint64) {
+	t.mu.Lock()
+	delete(t.conns, connID)
+	t.mu.Unlock()
+}
+
+// Status 连接当前的读超时状态
+func (t *ReadDeadlineTracker) Status(connID uint64) (ReadDeadlineStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.conns[connID]
+	if !ok {
+		return ReadDeadlineStatus{}, false
+	}
+	status := ReadDeadlineStatus{
+		Stage:            t.stageLocked(state),
+		Registered:       state.registered,
+		EWMASeconds:      state.ewma.Seconds(),
+		Samples:          state.samples,
+		EffectiveSeconds: t.effectiveLocked(state).Seconds(),
+		LastFrameAt:      state.lastFrame,
+		CloseAt:          t.closeAtLocked(state),
+		Probes:           state.probes,
+	}
+	if state.registered {
+		status.WarnAt = state.lastFrame.Add(t.effectiveLocked(state))
+	}
+	return status, true
+}
+
+// Stats 跟踪器统计
+func (t *ReadDeadlineTracker) Stats() map[string]interface{} {
+	t.mu.Lock()
+	tracked := len(t.conns)
+	t.mu.Unlock()
+	return map[string]interface{}{
+		"trackedConnections": tracked,
+		"warnings":           t.warnings.Load(),
+		"closes":             t.closes.Load(),
+	}
+}
+
+// Sweep 巡检所有连接：已注册连接超过有效读超时先告警并探测，宽限期后仍无帧则断开；未注册连接超时直接断开
+func (t *ReadDeadlineTracker) Sweep(now time.Time) {
+	type action struct {
+		state  *connDeadline
+		close  bool
+		idle   time.Duration
+		limit  time.Duration
+		stage  string
+		device string
+	}
+	var actions []action
+
+	t.mu.Lock()
+	for connID, state := range t.conns {
+		idle := now.Sub(state.lastFrame)
+		effective := t.effectiveLocked(state)
+		if !now.Before(t.closeAtLocked(state)) {
+			actions = append(actions, action{state: state, close: true, idle: idle, limit: effective, stage: t.stageLocked(state), device: state.deviceID})
+			delete(t.conns, connID)
+			continue
+		}
+		if state.registered && !state.warned && idle >= effective {
+			state.warned = true
+			state.probes++
+			actions = append(actions, action{state: state, idle: idle, limit: effective, device: state.deviceID})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, a := range actions {
+		fields := logrus.Fields{
+			"connID":           a.state.conn.GetConnID(),
+			"deviceID":         a.device,
+			"idleSeconds":      int(a.idle.Seconds()),
+			"effectiveSeconds": int(a.limit.Seconds()),
+		}
+		if a.close {
+			t.closes.Add(1)
+			fields["stage"] = a.stage
+			logger.WithFields(fields).Warn("连接读超时，断开连接")
+			a.state.conn.Stop()
+			continue
+		}
+		t.warnings.Add(1)
+		fields["probeGraceSeconds"] = int(t.opts.ProbeGrace.Seconds())
+		logger.WithFields(fields).Warn("连接超过有效读超时未收到数据，下发探测")
+		if probe, ok := t.probe.Load().(func(string) error); ok && probe != nil && a.device != "" {
+			if err := probe(a.device); err != nil {
+				logger.WithFields(logrus.Fields{"deviceID": a.device, "error": err.Error()}).Debug("读超时探测下发失败")
+			}
+		}
+	}
+}
+
+// Start 按巡检间隔定期执行 Sweep，随ctx取消退出
+func (t *ReadDeadlineTracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(t.opts.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				t.Sweep(now)
+			}
+		}
+	}()
+}
+
+// effectiveLocked 有效读超时：未注册为固定值；已注册按 EWMA×Factor 限制在[Min,Max]，尚无样本时取Max
+func (t *ReadDeadlineTracker) effectiveLocked(state *connDeadline) time.Duration {
+	if !state.registered {
+		return t.opts.PreRegistration
+	}
+	if state.samples == 0 {
+		return t.opts.Max
+	}
+	d := time.Duration(float64(state.ewma) * t.opts.Factor)
+	if d < t.opts.Min {
+		return t.opts.Min
+	}
+	if d > t.opts.Max {
+		return t.opts.Max
+	}
+	return d
+}
+
+func (t *ReadDeadlineTracker) closeAtLocked(state *connDeadline) time.Time {
+	closeAt := state.lastFrame.Add(t.effectiveLocked(state))
+	if state.registered {
+		closeAt = closeAt.Add(t.opts.ProbeGrace)
+	}
+	return closeAt
+}
+
+func (t *ReadDeadlineTracker) stageLocked(state *connDeadline) string {
+	switch {
+	case !state.registered:
+		return DeadlineStagePreRegistration
+	case state.warned:
+		return DeadlineStageWarning
+	default:
+		return DeadlineStageNormal
+	}
+}
+
+// applySocketDeadline 套接字读超时兜底（巡检停滞时仍能断开死连接）
+func applySocketDeadline(conn ziface.IConnection, closeAt time.Time) {
+	socket := conn.GetConnection()
+	if socket == nil {
+		return
+	}
+	if err := socket.SetReadDeadline(closeAt.Add(socketDeadlineSlack)); err != nil {
+		logger.WithFields(logrus.Fields{"connID": conn.GetConnID(), "error": err.Error()}).Debug("设置读超时失败")
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalReadDeadlineTracker atomic.Pointer[ReadDeadlineTracker]
+
+func init() {
+	globalReadDeadlineTracker.Store(NewReadDeadlineTracker(ReadDeadlineOptions{}))
+}
+
+// GetReadDeadlineTracker 获取全局自适应读超时跟踪器（未按配置初始化时使用默认参数）
+func GetReadDeadlineTracker() *ReadDeadlineTracker {
+	return globalReadDeadlineTracker.Load()
+}
+
+// InitGlobalReadDeadlineTracker 按配置创建全局自适应读超时跟踪器
+func InitGlobalReadDeadlineTracker() *ReadDeadlineTracker {
+	cfg := config.GetConfig().ReadDeadline
+	t := NewReadDeadlineTracker(ReadDeadlineOptions{
+		PreRegistration: time.Duration(cfg.PreRegistrationSeconds) * time.Second,
+		Factor:          cfg.Factor,
+		Min:             time.Duration(cfg.MinSeconds) * time.Second,
+		Max:             time.Duration(cfg.MaxSeconds) * time.Second,
+		Alpha:           cfg.EWMAAlpha,
+		ProbeGrace:      time.Duration(cfg.ProbeGraceSeconds) * time.Second,
+		CheckInterval:   time.Duration(cfg.CheckIntervalSeconds) * time.Second,
+	})
+	globalReadDeadlineTracker.Store(t)
+	return t
+}
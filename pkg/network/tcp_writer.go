@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
 	"github.com/sirupsen/logrus"
 )
 
@@ -115,6 +116,7 @@ func (w *TCPWriter) WriteWithRetry(conn ziface.IConnection, msgID uint32, data [
 		_, err := tcpConn.Write(data)
 		if err == nil {
 			// 写入成功
+			core.RecordConnOutbound(conn.GetConnID(), data)
 
 			if attempt > 0 {
 				w.logger.WithFields(logrus.Fields{
@@ -5,11 +5,16 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
@@ -91,6 +96,7 @@ type UnifiedSender struct {
 	tcpWriter     *TCPWriter
 	commandQueue  *CommandQueue
 	bufferMonitor *WriteBufferMonitor
+	coalescer     *outboundCoalescer // 低流量连接的下行帧合并
 
 	// 管理器引用
 	connectionMgr interface{} // 统一连接管理器（避免循环导入）
@@ -123,6 +129,7 @@ func NewUnifiedSender() *UnifiedSender {
 		tcpWriter:     tcpWriter,
 		commandQueue:  commandQueue,
 		bufferMonitor: bufferMonitor,
+		coalescer:     newOutboundCoalescer(),
 		config:        config,
 		stats:         &SenderStats{},
 		stopChan:      make(chan struct{}),
@@ -259,7 +266,13 @@ func (s *UnifiedSender) SendDNYPacket(conn ziface.IConnection, packet []byte) er
 
 // SendDNYResponse 发送DNY协议响应（自动封装）
 // 用于：设备注册响应、充电控制响应等
+// 低流量模式下协议标注无须应答的应答与去重窗口内的重复对时应答不发送（返回nil）
 func (s *UnifiedSender) SendDNYResponse(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, responseData []byte) error {
+	if reg := lowdata.GetGlobalRegistry(); reg != nil && conn != nil &&
+		!reg.AllowResponse(conn.GetConnID(), utils.FormatPhysicalID(physicalID), command, len(responseData), time.Now()) {
+		return nil
+	}
+
 	// 🔧 重构：使用统一DNY构建器替代内部构建函数
 	packet := protocol.BuildUnifiedDNYPacket(physicalID, messageID, command, responseData)
 
@@ -276,6 +289,20 @@ func (s *UnifiedSender) SendDNYResponse(conn ziface.IConnection, physicalID uint
 	return s.sendWithConfig(conn, packet, config, sendInfo)
 }
 
+// SendResultObserver 发送结果观察者：connID 为目标连接，err 为最终结果（nil 表示成功），elapsed 为含重试的总耗时
+type SendResultObserver func(connID uint64, err error, elapsed time.Duration)
+
+var sendResultObserver atomic.Pointer[SendResultObserver]
+
+// SetSendResultObserver 设置发送结果观察者（由上层注入，避免network依赖连接管理器；重复设置时覆盖）
+func SetSendResultObserver(observer SendResultObserver) {
+	if observer == nil {
+		sendResultObserver.Store(nil)
+		return
+	}
+	sendResultObserver.Store(&observer)
+}
+
 // SendInfo 发送信息
 type SendInfo struct {
 	PhysicalID uint32
@@ -303,23 +330,48 @@ func (s *UnifiedSender) sendWithConfig(conn ziface.IConnection, data []byte, con
 	// 3. 记录发送开始
 	s.logSendStart(conn, config.Type, data, info)
 
-	// 4. 执行发送 - 🔧 使用增强的发送逻辑
+	// 流量日志记录方言转换与加密之前的标准帧，消息ID与设备应答的解码结果一致
+	logical := data
+
+	// 方言连接：标准下行帧转换为设备方言的格式（消息ID字节序）
+	if config.Type != SendTypeRaw {
+		data = dialect.GetGlobalTracker().Outbound(conn.GetConnID(), data)
+		// 加密连接：数据域以设备注册时声明的密钥加密（方言转换之后，加密覆盖最终的帧头）
+		if m := payloadcrypto.GetGlobalManager(); m != nil {
+			encrypted, encErr := m.EncryptFrame(conn.GetConnID(), data)
+			if encErr != nil {
+				return fmt.Errorf("加密下行数据域失败: %w", encErr)
+			}
+			data = encrypted
+		}
+	}
+
+	// 4. 执行发送 - 🔧 使用增强的发送逻辑；低流量连接的帧经合并窗口与同连接的其他帧一次写出
 	var err error
-	if config.MaxRetries > 0 {
-		// 使用高级重试机制（集成动态超时和健康管理）
-		err = s.sendWithAdvancedRetry(conn, data, config)
+	startTime := time.Now()
+	var mode lowdata.Mode
+	reg := lowdata.GetGlobalRegistry()
+	deviceID := frameDeviceID(config.Type, data)
+	if reg != nil && deviceID != "" {
+		mode = reg.ModeForDevice(deviceID)
+	}
+	if mode.Enabled && mode.Effective.CoalesceOutbound {
+		err = s.coalescer.submit(s, reg, conn, deviceID, data, config)
 	} else {
-		// 🔧 修复：直接发送原始DNY协议数据，避免Zinx二次封装
-		tcpConn := conn.GetTCPConnection()
-		if tcpConn == nil {
-			err = fmt.Errorf("获取TCP连接失败")
-		} else {
-			_, err = tcpConn.Write(data)
+		err = s.write(conn, data, config)
+		if err == nil && mode.Enabled {
+			reg.RecordWrite(conn.GetConnID(), deviceID, len(data), 1, time.Now())
 		}
 	}
 
 	// 5. 记录发送结果
 	s.logSendResult(conn, config.Type, data, info, err)
+	if err == nil {
+		commlog.RecordDownlink(data)
+	}
+	if logger.GetTrafficLogger() != nil {
+		logger.LogTraffic(outboundTraffic(conn.GetConnID(), config.Type, logical, err))
+	}
 
 	// 6. 更新统计信息
 	s.updateStats(func(stats *SenderStats) {
@@ -334,6 +386,37 @@ func (s *UnifiedSender) sendWithConfig(conn ziface.IConnection, data []byte, con
 		}
 	})
 
+	// 7. 通知连接层记录发送结果（持续失败时由连接层主动关闭连接）
+	if observer := sendResultObserver.Load(); observer != nil {
+		(*observer)(conn.GetConnID(), err, time.Since(startTime))
+	}
+
+	return err
+}
+
+// outboundTraffic 下行帧的流量日志记录（非DNY帧记为raw）
+func outboundTraffic(connID uint64, sendType SendType, data []byte, err error) logger.TrafficFrame {
+	frame := logger.TrafficFrame{Direction: logger.TrafficOutbound, ConnID: connID, Kind: logger.TrafficKindRaw, Data: data, Err: err}
+	if deviceID := frameDeviceID(sendType, data); deviceID != "" {
+		frame.Kind = logger.TrafficKindDNY
+		frame.DeviceID = deviceID
+		frame.MessageID = uint16(data[9]) | uint16(data[10])<<8
+		frame.Command = data[11]
+	}
+	return frame
+}
+
+// write 执行一次写入：配置了重试时使用高级重试机制（集成动态超时和健康管理），否则直接写TCP连接
+func (s *UnifiedSender) write(conn ziface.IConnection, data []byte, config SendConfig) error {
+	if config.MaxRetries > 0 {
+		return s.sendWithAdvancedRetry(conn, data, config)
+	}
+	// 🔧 修复：直接发送原始DNY协议数据，避免Zinx二次封装
+	tcpConn := conn.GetTCPConnection()
+	if tcpConn == nil {
+		return fmt.Errorf("获取TCP连接失败")
+	}
+	_, err := tcpConn.Write(data)
 	return err
 }
 
@@ -89,4 +89,5 @@ type ChargeResponse struct {
 	EndTime             string `json:"end_time"`
 	StopReason          uint8  `json:"stop_reason"`
 	SettlementTriggered bool   `json:"settlement_triggered"`
+	CorrelationID       string `json:"correlation_id,omitempty"`
 }
@@ -0,0 +1,99 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// BusSubscriberName 通知服务在事件总线上的转发订阅名称
+const BusSubscriberName = "notification"
+
+// TopicForEvent 通知事件类型 → 事件总线主题
+func TopicForEvent(eventType string) events.Topic {
+	switch eventType {
+	case EventTypeDeviceError, EventTypePortError, EventTypeICCIDConflict,
+		EventTypeChargingFailed, EventTypeChargeQueueTimeout, EventTypeDeviceRebootFailed,
+		EventTypeDeviceRegistrationRejected, EventTypeDeviceAnomaly, EventTypeCommandFailed:
+		return events.TopicAlarm
+	case EventTypePortStatusChange, EventTypePortOnline, EventTypePortOffline,
+		EventTypePortHeartbeat, EventTypeStatusChange:
+		return events.TopicPort
+	case EventTypeChargingStart, EventTypeChargingEnd, EventTypeSettlement, EventTypeSettlementEnriched,
+		EventTypePowerHeartbeat, EventTypeChargingPower, EventTypeChargeQueued:
+		return events.TopicCharging
+	case EventTypeFrameJournalDegraded, EventTypeReconciliationReport, EventTypeRedisDegraded, EventTypeRedisRecovered,
+		EventTypeFleetOnlineDrop, EventTypeFleetOnlineRecovered, EventTypeTenantSLABreached, EventTypeTenantSLARecovered:
+		return events.TopicSystem
+	default:
+		return events.TopicDevice
+	}
+}
+
+// IsNotificationEvent 总线事件是否由通知集成器发布（负载为 *NotificationEvent）
+func IsNotificationEvent(ev events.Event) bool {
+	_, ok := ev.Payload.(*NotificationEvent)
+	return ok
+}
+
+// publish 补全事件ID/时间/标签后发布到事件总线；总线发布不阻塞，投递失败由转发订阅记录
+func (n *NotificationIntegrator) publish(event *NotificationEvent) {
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	TagEvent(event)
+	n.bus.Publish(TopicForEvent(event.EventType), event.EventType, event.DeviceID, event)
+}
+
+// startForwarder 订阅事件总线并将通知事件投递给通知服务（订阅在服务启动后建立，之前的事件不投递）
+func (n *NotificationIntegrator) startForwarder(ctx context.Context) {
+	n.forwarder = n.bus.Subscribe(events.SubscribeOptions{
+		Name:   BusSubscriberName,
+		Buffer: n.service.config.QueueSize,
+		Filter: IsNotificationEvent,
+	})
+	n.forwardWG.Add(1)
+	go func() {
+		defer n.forwardWG.Done()
+		for {
+			ev, ok := n.forwarder.Next(ctx)
+			if !ok {
+				break
+			}
+			n.forward(ev)
+		}
+		// 停止时投递已入队的剩余事件
+		for ev, ok := n.forwarder.TryNext(); ok; ev, ok = n.forwarder.TryNext() {
+			n.forward(ev)
+		}
+	}()
+}
+
+// stopForwarder 取消转发订阅并等待剩余事件投递完成
+func (n *NotificationIntegrator) stopForwarder() {
+	if n.forwarder == nil {
+		return
+	}
+	n.forwarder.Close()
+	n.forwardWG.Wait()
+}
+
+func (n *NotificationIntegrator) forward(ev events.Event) {
+	// 总线上的事件与其他订阅者共享，投递副本避免通知服务的修改影响其他消费者
+	copied := *ev.Payload.(*NotificationEvent)
+	if err := n.service.SendNotification(&copied); err != nil {
+		logger.WithFields(logrus.Fields{
+			"event_type": copied.EventType,
+			"device_id":  copied.DeviceID,
+			"seq":        ev.Seq,
+			"error":      err.Error(),
+		}).Error("发送通知失败")
+	}
+}
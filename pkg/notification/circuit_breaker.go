@@ -0,0 +1,193 @@
+package notification
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// 端点熔断状态
+const (
+	CircuitClosed   = "closed"    // 正常投递
+	CircuitOpen     = "open"      // 熔断中：快速失败，事件转入重试/暂存
+	CircuitHalfOpen = "half_open" // 冷却结束：放行少量探测请求
+)
+
+// CircuitBreakerConfig 端点熔断配置（每个端点独立熔断）
+type CircuitBreakerConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	ConsecutiveFailures int           `yaml:"consecutive_failures"` // 连续失败次数达到该值时熔断
+	FailureRate         float64       `yaml:"failure_rate"`         // 窗口内失败率（百分比）达到该值时熔断
+	MinRequests         int           `yaml:"min_requests"`         // 按失败率熔断所需的窗口内最少请求数
+	Window              time.Duration `yaml:"window"`               // 失败率统计窗口（按分钟取整）
+	CoolDown            time.Duration `yaml:"cool_down"`            // 熔断后的冷却时间
+	HalfOpenProbes      int           `yaml:"half_open_probes"`     // 半开状态放行的探测请求数，全部成功后恢复
+}
+
+// circuitBreaker 单个端点的熔断器
+type circuitBreaker struct {
+	mu       sync.Mutex
+	endpoint string
+	cfg      CircuitBreakerConfig
+
+	state               string
+	openedAt            time.Time
+	consecutiveFailures int
+	probesInFlight      int
+	probeSuccesses      int
+
+	windowTotal    *utils.RollingCounter
+	windowFailures *utils.RollingCounter
+}
+
+// circuitSnapshot 熔断器状态快照（写入端点统计）
+type circuitSnapshot struct {
+	State               string
+	OpenedAt            time.Time
+	ConsecutiveFailures int
+}
+
+func newCircuitBreaker(endpoint string, cfg CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{
+		endpoint:       endpoint,
+		cfg:            cfg,
+		state:          CircuitClosed,
+		windowTotal:    utils.NewRollingCounter(cfg.Window),
+		windowFailures: utils.NewRollingCounter(cfg.Window),
+	}
+}
+
+// Allow 是否允许本次投递；熔断中返回false，冷却结束后转为半开并放行探测请求
+func (b *circuitBreaker) Allow() bool {
+	if !b.cfg.Enabled {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cfg.CoolDown {
+			return false
+		}
+		b.transitionLocked(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if b.probesInFlight >= b.cfg.HalfOpenProbes {
+			return false
+		}
+		b.probesInFlight++
+		return true
+	default:
+		return true
+	}
+}
+
+// Record 记录一次已放行投递的结果
+func (b *circuitBreaker) Record(success bool) {
+	if !b.cfg.Enabled {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case CircuitHalfOpen:
+		if b.probesInFlight > 0 {
+			b.probesInFlight--
+		}
+		if !success {
+			b.consecutiveFailures++
+			b.openedAt = now
+			b.transitionLocked(CircuitOpen)
+			return
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.cfg.HalfOpenProbes {
+			b.consecutiveFailures = 0
+			b.windowTotal = utils.NewRollingCounter(b.cfg.Window)
+			b.windowFailures = utils.NewRollingCounter(b.cfg.Window)
+			b.transitionLocked(CircuitClosed)
+		}
+	case CircuitClosed:
+		b.windowTotal.AddAt(now, 1)
+		if success {
+			b.consecutiveFailures = 0
+			return
+		}
+		b.consecutiveFailures++
+		b.windowFailures.AddAt(now, 1)
+		if b.shouldTripLocked(now) {
+			b.openedAt = now
+			b.transitionLocked(CircuitOpen)
+		}
+	}
+	// 熔断中完成的在途请求不影响状态
+}
+
+// Release 放行后未产生可归因于端点的结果（如载荷构造失败）时归还探测名额
+func (b *circuitBreaker) Release() {
+	if !b.cfg.Enabled {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen && b.probesInFlight > 0 {
+		b.probesInFlight--
+	}
+}
+
+func (b *circuitBreaker) shouldTripLocked(now time.Time) bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutiveFailures >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	if b.cfg.FailureRate <= 0 {
+		return false
+	}
+	total := b.windowTotal.Sum(now)
+	if total == 0 || total < int64(b.cfg.MinRequests) {
+		return false
+	}
+	return float64(b.windowFailures.Sum(now))/float64(total)*100 >= b.cfg.FailureRate
+}
+
+// transitionLocked 切换状态并记录日志（调用方持有锁）
+func (b *circuitBreaker) transitionLocked(to string) {
+	from := b.state
+	b.state = to
+	b.probesInFlight = 0
+	b.probeSuccesses = 0
+
+	fields := logrus.Fields{
+		"component":            "notification",
+		"action":               "circuit_state_change",
+		"endpoint":             b.endpoint,
+		"from":                 from,
+		"to":                   to,
+		"consecutive_failures": b.consecutiveFailures,
+	}
+	switch to {
+	case CircuitOpen:
+		fields["cool_down"] = b.cfg.CoolDown.String()
+		logger.WithFields(fields).Warn("📤 通知端点熔断，暂停投递")
+	case CircuitHalfOpen:
+		logger.WithFields(fields).Info("📤 通知端点熔断冷却结束，开始探测")
+	default:
+		logger.WithFields(fields).Info("📤 通知端点恢复，熔断关闭")
+	}
+}
+
+// Snapshot 当前状态快照
+func (b *circuitBreaker) Snapshot() circuitSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	snap := circuitSnapshot{State: b.state, ConsecutiveFailures: b.consecutiveFailures}
+	if b.state != CircuitClosed {
+		snap.OpenedAt = b.openedAt
+	}
+	return snap
+}
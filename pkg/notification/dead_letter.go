@@ -0,0 +1,240 @@
+package notification
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	redisv9 "github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDeadLetterRedisKey   = "notify:deadletter"
+	defaultDeadLetterMaxEntries = 10000
+	deadLetterFileName          = "notification_deadletter.jsonl"
+	// legacyDeadLetterKeyPrefix 旧版按端点延迟重投的死信ZSET（notify:dlq:<端点名>），启动时迁移到死信列表
+	legacyDeadLetterKeyPrefix = "notify:dlq:"
+)
+
+// DeadLetterConfig 死信落地：重试用尽且未进入暂存的关键事件持久化保存，供核对与人工补发（计费事件不可静默丢弃）
+type DeadLetterConfig struct {
+	File       string `yaml:"file"`        // 死信文件（每行一条JSON），Redis不可用或写入失败时使用；为空时不写文件
+	RedisKey   string `yaml:"redis_key"`   // Redis列表键，Redis可用时优先写入
+	MaxEntries int    `yaml:"max_entries"` // Redis列表保留的最新记录数，超出时丢弃最旧的
+}
+
+// DeadLetterEntry 死信记录
+type DeadLetterEntry struct {
+	Event          *NotificationEvent `json:"event"`
+	Endpoint       string             `json:"endpoint"`
+	URL            string             `json:"url"`
+	Attempts       int                `json:"attempts"` // 该端点累计失败次数
+	DeadLetteredAt time.Time          `json:"dead_lettered_at"`
+	Migrated       bool               `json:"migrated,omitempty"` // 由旧版死信ZSET迁移而来
+}
+
+// legacyDeadLetter 旧版死信ZSET的成员
+type legacyDeadLetter struct {
+	Event    *NotificationEvent   `json:"event"`
+	Endpoint NotificationEndpoint `json:"endpoint"`
+	Attempt  int                  `json:"attempt"`
+}
+
+// ResolveDeadLetterFile 死信文件路径：未配置时位于通知数据目录（暂存目录的上级目录）下
+func ResolveDeadLetterFile(file, spoolDir string) string {
+	if file != "" {
+		return file
+	}
+	if spoolDir == "" {
+		spoolDir = defaultSpoolDir
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(spoolDir)), deadLetterFileName)
+}
+
+// enqueueDeadLetter 将重试用尽的关键事件写入死信（Redis列表优先，文件回退）；非关键事件只记录日志
+func (s *NotificationService) enqueueDeadLetter(event *NotificationEvent, endpoint NotificationEndpoint, attempt int) {
+	fields := logrus.Fields{
+		"component":     "notification",
+		"action":        "dead_letter",
+		"event_id":      event.EventID,
+		"event_type":    event.EventType,
+		"endpoint":      endpoint.Name,
+		"attempt_count": attempt,
+	}
+	if !event.IsCritical && !IsCriticalEvent(event.EventType) {
+		logger.WithFields(fields).Warn("📤 非关键事件重试用尽，丢弃")
+		return
+	}
+	entry := DeadLetterEntry{Event: event, Endpoint: endpoint.Name, URL: endpoint.URL, Attempts: attempt, DeadLetteredAt: time.Now()}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Error("📤 死信序列化失败，事件丢失")
+		return
+	}
+
+	if client, ok := s.redisClient.(*redisv9.Client); ok && client != nil && !infraredis.Degraded() {
+		key := s.config.DeadLetter.RedisKey
+		_, err := client.TxPipelined(s.ctx, func(pipe redisv9.Pipeliner) error {
+			pipe.RPush(s.ctx, key, string(b))
+			pipe.LTrim(s.ctx, key, int64(-s.config.DeadLetter.MaxEntries), -1)
+			return nil
+		})
+		if err == nil {
+			s.recordDeadLetter(endpoint.Name)
+			fields["redis_key"] = s.config.DeadLetter.RedisKey
+			logger.WithFields(fields).Warn("📤 事件重试用尽，已写入死信")
+			return
+		}
+		// Redis写入失败时回退到文件
+		fields["redis_error"] = err.Error()
+	}
+
+	if s.config.DeadLetter.File == "" {
+		logger.WithFields(fields).Error("📤 Redis不可用且未配置死信文件，事件丢失")
+		return
+	}
+	if err := s.appendDeadLetterFile(b); err != nil {
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Error("📤 写入死信文件失败，事件丢失")
+		return
+	}
+	s.recordDeadLetter(endpoint.Name)
+	fields["file"] = s.config.DeadLetter.File
+	logger.WithFields(fields).Warn("📤 事件重试用尽，已写入死信")
+}
+
+// migrateLegacyDeadLetters 将旧版按端点的死信ZSET并入死信列表（启动时执行，无法解析的成员保留在原键中）
+func (s *NotificationService) migrateLegacyDeadLetters() {
+	client, ok := s.redisClient.(*redisv9.Client)
+	if !ok || client == nil || infraredis.Degraded() {
+		return
+	}
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(s.ctx, cursor, legacyDeadLetterKeyPrefix+"*", 100).Result()
+		if err != nil {
+			logger.WithFields(logrus.Fields{"component": "notification", "error": err.Error()}).Warn("📤 扫描旧版死信队列失败，下次启动重试")
+			return
+		}
+		for _, key := range keys {
+			s.migrateLegacyDeadLetterKey(client, key)
+		}
+		if next == 0 {
+			return
+		}
+		cursor = next
+	}
+}
+
+// migrateLegacyDeadLetterKey 迁移一个旧版死信ZSET：追加到死信列表与移除原成员在同一事务内完成
+func (s *NotificationService) migrateLegacyDeadLetterKey(client *redisv9.Client, key string) {
+	members, err := client.ZRange(s.ctx, key, 0, -1).Result()
+	if err != nil || len(members) == 0 {
+		return
+	}
+	now := time.Now()
+	entries := make([]interface{}, 0, len(members))
+	migrated := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		var legacy legacyDeadLetter
+		if err := json.Unmarshal([]byte(member), &legacy); err != nil || legacy.Event == nil {
+			continue
+		}
+		name := legacy.Endpoint.Name
+		if name == "" {
+			name = strings.TrimPrefix(key, legacyDeadLetterKeyPrefix)
+		}
+		b, err := json.Marshal(DeadLetterEntry{
+			Event:          legacy.Event,
+			Endpoint:       name,
+			URL:            legacy.Endpoint.URL,
+			Attempts:       legacy.Attempt,
+			DeadLetteredAt: now,
+			Migrated:       true,
+		})
+		if err != nil {
+			continue
+		}
+		entries = append(entries, string(b))
+		migrated = append(migrated, member)
+	}
+	fields := logrus.Fields{"component": "notification", "key": key, "migrated": len(migrated), "skipped": len(members) - len(migrated)}
+	if len(migrated) == 0 {
+		logger.WithFields(fields).Warn("📤 旧版死信队列的成员均无法解析，保留原键")
+		return
+	}
+	listKey := s.config.DeadLetter.RedisKey
+	if _, err := client.TxPipelined(s.ctx, func(pipe redisv9.Pipeliner) error {
+		pipe.RPush(s.ctx, listKey, entries...)
+		pipe.LTrim(s.ctx, listKey, int64(-s.config.DeadLetter.MaxEntries), -1)
+		pipe.ZRem(s.ctx, key, migrated...)
+		return nil
+	}); err != nil {
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Warn("📤 迁移旧版死信队列失败，下次启动重试")
+		return
+	}
+	logger.WithFields(fields).Info("📤 旧版死信队列已并入死信列表")
+}
+
+// appendDeadLetterFile 追加一行死信记录
+func (s *NotificationService) appendDeadLetterFile(line []byte) error {
+	s.deadLetterMu.Lock()
+	defer s.deadLetterMu.Unlock()
+	path := s.config.DeadLetter.File
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recordDeadLetter 记一次死信（全局与端点）
+func (s *NotificationService) recordDeadLetter(endpointName string) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.stats.TotalDeadLettered++
+	if es, exists := s.stats.EndpointStats[endpointName]; exists {
+		es.DeadLettered++
+	}
+	s.stats.LastUpdateTime = time.Now()
+}
+
+// ReadDeadLetterFile 读取死信文件中的全部记录
+func ReadDeadLetterFile(path string) ([]DeadLetterEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []DeadLetterEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry DeadLetterEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, fmt.Errorf("死信文件第%d行解析失败: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
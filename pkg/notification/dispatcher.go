@@ -0,0 +1,116 @@
+package notification
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEndpointConcurrency = 2
+	defaultEndpointQueueSize   = 1000
+)
+
+// endpointDispatcher 端点投递器：每个端点独立的队列、工作协程池与熔断器，
+// 慢端点只会占满自己的队列，不影响其他端点的投递
+type endpointDispatcher struct {
+	endpoint NotificationEndpoint
+	queue    chan *NotificationEvent
+	breaker  *circuitBreaker
+}
+
+// newEndpointDispatchers 为配置中的每个端点创建投递器
+func newEndpointDispatchers(config *NotificationConfig) map[string]*endpointDispatcher {
+	dispatchers := make(map[string]*endpointDispatcher, len(config.Endpoints))
+	for _, endpoint := range config.Endpoints {
+		dispatchers[endpoint.Name] = &endpointDispatcher{
+			endpoint: endpoint,
+			queue:    make(chan *NotificationEvent, endpoint.QueueSize),
+			breaker:  newCircuitBreaker(endpoint.Name, config.CircuitBreaker),
+		}
+	}
+	return dispatchers
+}
+
+// startEndpointWorkers 启动各端点的投递协程
+func (s *NotificationService) startEndpointWorkers() {
+	for _, d := range s.dispatchers {
+		for i := 0; i < d.endpoint.Concurrency; i++ {
+			s.wg.Add(1)
+			go s.endpointWorker(d)
+		}
+	}
+}
+
+// endpointWorker 端点投递协程
+func (s *NotificationService) endpointWorker(d *endpointDispatcher) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case event := <-d.queue:
+			s.sendToEndpoint(event, d.endpoint)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatch 将事件放入端点队列；端点队列已满时按一次失败转入重试
+func (s *NotificationService) dispatch(event *NotificationEvent, endpoint NotificationEndpoint) {
+	d, ok := s.dispatchers[endpoint.Name]
+	if !ok {
+		// 不在当前配置中的端点（如重启前持久化的重试任务），直接投递
+		s.sendToEndpoint(event, endpoint)
+		return
+	}
+
+	select {
+	case d.queue <- event:
+		return
+	default:
+	}
+
+	s.statsMu.Lock()
+	if es, exists := s.stats.EndpointStats[endpoint.Name]; exists {
+		es.QueueDropped++
+	}
+	s.stats.LastUpdateTime = time.Now()
+	s.statsMu.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"component":  "notification",
+		"action":     "endpoint_queue_full",
+		"event_id":   event.EventID,
+		"event_type": event.EventType,
+		"endpoint":   endpoint.Name,
+	}).Warn("📤 端点投递队列已满，事件转入重试")
+	s.failAttempt(event, endpoint)
+}
+
+// breakerFor 端点熔断器（端点不在当前配置中时返回nil）
+func (s *NotificationService) breakerFor(endpoint string) *circuitBreaker {
+	if d, ok := s.dispatchers[endpoint]; ok {
+		return d.breaker
+	}
+	return nil
+}
+
+// fillEndpointRuntimeStats 将熔断状态与队列长度写入端点统计快照
+func (s *NotificationService) fillEndpointRuntimeStats(stats map[string]*EndpointStats) {
+	for name, d := range s.dispatchers {
+		es, ok := stats[name]
+		if !ok {
+			continue
+		}
+		snap := d.breaker.Snapshot()
+		es.CircuitState = snap.State
+		es.ConsecutiveFailures = snap.ConsecutiveFailures
+		if !snap.OpenedAt.IsZero() {
+			openedAt := snap.OpenedAt
+			es.CircuitOpenedAt = &openedAt
+		}
+		es.QueueLength = len(d.queue)
+	}
+}
@@ -0,0 +1,403 @@
+package notification
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// 出站限流的优先级类别
+const (
+	PriorityCritical      = "critical"      // 告警、结算等关键事件：优先于其他类别，不排队降级
+	PriorityNormal        = "normal"        // 其他业务事件
+	PriorityInformational = "informational" // 心跳衍生、上下线抖动等信息类事件
+)
+
+// EventTypeNotificationDigest 限流摘要事件：排队已满的低优先级事件按端点汇总为一条
+const EventTypeNotificationDigest = "notification_digest"
+
+const (
+	defaultFanOutRatePerSecond  = 50
+	defaultFanOutQueueDepth     = 1000
+	defaultFanOutDigestInterval = 10 * time.Second
+	fanOutTickInterval          = 10 * time.Millisecond
+	digestDeviceSampleSize      = 50
+)
+
+// fanOutClasses 出队顺序（优先级从高到低）
+var fanOutClasses = []string{PriorityCritical, PriorityNormal, PriorityInformational}
+
+// FanOutConfig 全局出站限流：令牌桶限制每秒分发到端点的事件数，突发事件（如整站恢复供电批量上线）平滑投递
+type FanOutConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	RatePerSecond  float64       `yaml:"rate_per_second"` // 令牌补充速率（事件/秒），每个事件分发到全部匹配端点消耗一个令牌
+	Burst          int           `yaml:"burst"`           // 令牌桶容量（允许的突发事件数）
+	QueueDepth     int           `yaml:"queue_depth"`     // 每个类别的排队上限，超出后低优先级事件降级为摘要
+	DigestInterval time.Duration `yaml:"digest_interval"` // 摘要事件的汇总周期
+}
+
+// FanOutStats 出站限流统计
+type FanOutStats struct {
+	RatePerSecond float64                        `json:"rate_per_second"`
+	Burst         int                            `json:"burst"`
+	QueueDepth    int                            `json:"queue_depth"`
+	Tokens        float64                        `json:"tokens"`      // 当前可用令牌
+	Constrained   bool                           `json:"constrained"` // 令牌不足或有事件排队
+	DigestsSent   int64                          `json:"digests_sent"`
+	Classes       map[string]*FanOutClassStats   `json:"classes"`
+	PendingDigest map[string]*FanOutDigestStatus `json:"pending_digest,omitempty"` // 按端点待发送的摘要
+}
+
+// FanOutClassStats 单个优先级类别的限流统计
+type FanOutClassStats struct {
+	Admitted    int64 `json:"admitted"`     // 直接取得令牌分发
+	Queued      int64 `json:"queued"`       // 进入排队（累计）
+	Dequeued    int64 `json:"dequeued"`     // 排队后取得令牌分发
+	QueueLength int   `json:"queue_length"` // 当前排队数
+	Digested    int64 `json:"digested"`     // 排队已满降级为摘要
+	Dropped     int64 `json:"dropped"`      // 服务停止时仍在排队而丢弃
+	Bypassed    int64 `json:"bypassed"`     // 关键事件排队已满时绕过限流直接分发
+}
+
+// FanOutDigestStatus 端点待发送摘要的汇总进度
+type FanOutDigestStatus struct {
+	Events  int       `json:"events"`
+	FirstAt time.Time `json:"first_at"`
+}
+
+// EventPriority 事件的出站限流类别：信息类事件（心跳衍生、上下线）优先判定，其次为关键事件与告警
+func EventPriority(event *NotificationEvent) string {
+	switch event.EventType {
+	case EventTypeDeviceOnline, EventTypeDeviceOffline, EventTypeDeviceHeartbeat, EventTypeDeviceRegister,
+		EventTypePowerHeartbeat, EventTypeChargingPower,
+		EventTypePortStatusChange, EventTypePortOnline, EventTypePortOffline, EventTypePortHeartbeat, EventTypeStatusChange:
+		return PriorityInformational
+	case EventTypeDeviceError, EventTypePortError:
+		return PriorityCritical
+	}
+	if event.IsCritical || IsCriticalEvent(event.EventType) {
+		return PriorityCritical
+	}
+	return PriorityNormal
+}
+
+// fanOutItem 排队等待令牌的事件及其路由结果
+type fanOutItem struct {
+	event     *NotificationEvent
+	endpoints []NotificationEndpoint
+}
+
+// fanOutDigest 单个端点的摘要累积
+type fanOutDigest struct {
+	endpoint   NotificationEndpoint
+	firstAt    time.Time
+	lastAt     time.Time
+	total      int
+	byClass    map[string]int
+	byType     map[string]int
+	devices    map[string]struct{}
+	tenants    map[string]struct{}
+	deviceList []string
+}
+
+// fanOutLimiter 全局出站令牌桶与按优先级的排队
+type fanOutLimiter struct {
+	cfg FanOutConfig
+
+	mu          sync.Mutex
+	tokens      float64
+	refilledAt  time.Time
+	queues      map[string][]fanOutItem
+	stats       map[string]*FanOutClassStats
+	digests     map[string]*fanOutDigest
+	digestsSent int64
+}
+
+func newFanOutLimiter(cfg FanOutConfig) *fanOutLimiter {
+	l := &fanOutLimiter{
+		cfg:        cfg,
+		tokens:     float64(cfg.Burst),
+		refilledAt: time.Now(),
+		queues:     make(map[string][]fanOutItem, len(fanOutClasses)),
+		stats:      make(map[string]*FanOutClassStats, len(fanOutClasses)),
+		digests:    make(map[string]*fanOutDigest),
+	}
+	for _, class := range fanOutClasses {
+		l.stats[class] = &FanOutClassStats{}
+	}
+	return l
+}
+
+// refillLocked 按经过时间补充令牌
+func (l *fanOutLimiter) refillLocked(now time.Time) {
+	if elapsed := now.Sub(l.refilledAt).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * l.cfg.RatePerSecond
+		if max := float64(l.cfg.Burst); l.tokens > max {
+			l.tokens = max
+		}
+	}
+	l.refilledAt = now
+}
+
+// takeLocked 取一个令牌
+func (l *fanOutLimiter) takeLocked() bool {
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// aheadLocked 同级及更高优先级是否有事件排队（排队中的事件先于新事件分发）
+func (l *fanOutLimiter) aheadLocked(class string) bool {
+	for _, c := range fanOutClasses {
+		if len(l.queues[c]) > 0 {
+			return true
+		}
+		if c == class {
+			return false
+		}
+	}
+	return false
+}
+
+// admit 新事件取令牌：可立即分发返回true；否则排队，低优先级排队已满时计入端点摘要
+func (l *fanOutLimiter) admit(event *NotificationEvent, endpoints []NotificationEndpoint, now time.Time) bool {
+	class := EventPriority(event)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.stats[class]
+	l.refillLocked(now)
+	if !l.aheadLocked(class) && l.takeLocked() {
+		stats.Admitted++
+		return true
+	}
+	if len(l.queues[class]) < l.cfg.QueueDepth {
+		l.queues[class] = append(l.queues[class], fanOutItem{event: event, endpoints: endpoints})
+		stats.Queued++
+		return false
+	}
+	if class == PriorityCritical {
+		// 关键事件不降级：排队已满时绕过限流
+		stats.Bypassed++
+		return true
+	}
+	stats.Digested++
+	for _, endpoint := range endpoints {
+		l.addDigestLocked(event, class, endpoint, now)
+	}
+	return false
+}
+
+// addDigestLocked 将事件计入端点的摘要
+func (l *fanOutLimiter) addDigestLocked(event *NotificationEvent, class string, endpoint NotificationEndpoint, now time.Time) {
+	d, ok := l.digests[endpoint.Name]
+	if !ok {
+		d = &fanOutDigest{
+			endpoint: endpoint,
+			firstAt:  now,
+			byClass:  make(map[string]int),
+			byType:   make(map[string]int),
+			devices:  make(map[string]struct{}),
+			tenants:  make(map[string]struct{}),
+		}
+		l.digests[endpoint.Name] = d
+	}
+	d.lastAt = now
+	d.total++
+	d.byClass[class]++
+	d.byType[event.EventType]++
+	if event.DeviceID != "" {
+		if _, seen := d.devices[event.DeviceID]; !seen {
+			d.devices[event.DeviceID] = struct{}{}
+			if len(d.deviceList) < digestDeviceSampleSize {
+				d.deviceList = append(d.deviceList, event.DeviceID)
+			}
+		}
+	}
+	if event.TenantID != "" {
+		d.tenants[event.TenantID] = struct{}{}
+	}
+}
+
+// fanOutDigestDelivery 到期的端点摘要
+type fanOutDigestDelivery struct {
+	event    *NotificationEvent
+	endpoint NotificationEndpoint
+}
+
+// release 按优先级从高到低出队可分发的事件；关键事件之后发送到期的摘要（摘要同样消耗令牌）
+func (l *fanOutLimiter) release(now time.Time) ([]fanOutItem, []fanOutDigestDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refillLocked(now)
+
+	var items []fanOutItem
+	var digests []fanOutDigestDelivery
+	items = l.dequeueLocked(PriorityCritical, items)
+	if len(l.queues[PriorityCritical]) == 0 {
+		for _, name := range l.dueDigestsLocked(now) {
+			if !l.takeLocked() {
+				break
+			}
+			d := l.digests[name]
+			delete(l.digests, name)
+			l.digestsSent++
+			digests = append(digests, fanOutDigestDelivery{event: d.toEvent(now), endpoint: d.endpoint})
+		}
+	}
+	for _, class := range fanOutClasses[1:] {
+		items = l.dequeueLocked(class, items)
+	}
+	return items, digests
+}
+
+// dequeueLocked 在令牌允许范围内出队一个类别的事件
+func (l *fanOutLimiter) dequeueLocked(class string, items []fanOutItem) []fanOutItem {
+	queue := l.queues[class]
+	n := 0
+	for n < len(queue) && l.takeLocked() {
+		n++
+	}
+	if n == 0 {
+		return items
+	}
+	items = append(items, queue[:n]...)
+	l.queues[class] = queue[n:]
+	l.stats[class].Dequeued += int64(n)
+	return items
+}
+
+// dueDigestsLocked 汇总周期已到的端点（按名称排序，保证出队顺序稳定）
+func (l *fanOutLimiter) dueDigestsLocked(now time.Time) []string {
+	var names []string
+	for name, d := range l.digests {
+		if now.Sub(d.firstAt) >= l.cfg.DigestInterval {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// toEvent 生成摘要事件
+func (d *fanOutDigest) toEvent(now time.Time) *NotificationEvent {
+	tenants := make([]string, 0, len(d.tenants))
+	for tenant := range d.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return &NotificationEvent{
+		EventID:   uuid.New().String(),
+		EventType: EventTypeNotificationDigest,
+		Timestamp: now,
+		Data: map[string]interface{}{
+			"endpoint":       d.endpoint.Name,
+			"total":          d.total,
+			"by_class":       d.byClass,
+			"by_event_type":  d.byType,
+			"device_count":   len(d.devices),
+			"devices_sample": d.deviceList,
+			"tenants":        tenants,
+			"first_at":       d.firstAt,
+			"last_at":        d.lastAt,
+			"reason":         "出站限流排队已满，低优先级事件降级为摘要",
+		},
+	}
+}
+
+// drop 服务停止时丢弃仍在排队的事件
+func (l *fanOutLimiter) drop() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := 0
+	for class, queue := range l.queues {
+		l.stats[class].Dropped += int64(len(queue))
+		total += len(queue)
+		l.queues[class] = nil
+	}
+	return total
+}
+
+// Snapshot 限流状态与统计快照
+func (l *fanOutLimiter) Snapshot(now time.Time) FanOutStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refillLocked(now)
+
+	snapshot := FanOutStats{
+		RatePerSecond: l.cfg.RatePerSecond,
+		Burst:         l.cfg.Burst,
+		QueueDepth:    l.cfg.QueueDepth,
+		Tokens:        l.tokens,
+		Constrained:   l.tokens < 1,
+		DigestsSent:   l.digestsSent,
+		Classes:       make(map[string]*FanOutClassStats, len(l.stats)),
+	}
+	for class, cs := range l.stats {
+		copied := *cs
+		copied.QueueLength = len(l.queues[class])
+		if copied.QueueLength > 0 {
+			snapshot.Constrained = true
+		}
+		snapshot.Classes[class] = &copied
+	}
+	if len(l.digests) > 0 {
+		snapshot.PendingDigest = make(map[string]*FanOutDigestStatus, len(l.digests))
+		for name, d := range l.digests {
+			snapshot.PendingDigest[name] = &FanOutDigestStatus{Events: d.total, FirstAt: d.firstAt}
+		}
+	}
+	return snapshot
+}
+
+// fanOut 路由后的事件经全局出站限流分发到各端点（未启用限流时直接分发）
+func (s *NotificationService) fanOut(event *NotificationEvent, endpoints []NotificationEndpoint) {
+	if s.fanOutLimiter == nil || s.fanOutLimiter.admit(event, endpoints, time.Now()) {
+		s.dispatchToEndpoints(event, endpoints)
+	}
+}
+
+// dispatchToEndpoints 分发到各端点的投递队列（每个端点持有独立副本，重试计数互不干扰）
+func (s *NotificationService) dispatchToEndpoints(event *NotificationEvent, endpoints []NotificationEndpoint) {
+	for _, endpoint := range endpoints {
+		s.dispatch(event.cloneForEndpoint(), endpoint)
+	}
+}
+
+// fanOutWorker 按令牌补充节奏分发排队的事件与到期摘要
+func (s *NotificationService) fanOutWorker() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(fanOutTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			items, digests := s.fanOutLimiter.release(now)
+			for _, item := range items {
+				s.dispatchToEndpoints(item.event, item.endpoints)
+			}
+			for _, d := range digests {
+				logger.WithFields(logrus.Fields{
+					"component": "notification",
+					"action":    "fan_out_digest",
+					"endpoint":  d.endpoint.Name,
+					"total":     d.event.Data["total"],
+				}).Warn("📤 出站限流：低优先级事件已汇总为摘要")
+				s.dispatch(d.event, d.endpoint)
+			}
+		case <-s.ctx.Done():
+			if dropped := s.fanOutLimiter.drop(); dropped > 0 {
+				logger.WithField("dropped", dropped).Warn("通知服务停止，丢弃出站限流排队中的事件")
+			}
+			return
+		}
+	}
+}
@@ -3,18 +3,27 @@ package notification
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
 	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
 )
 
 // NotificationIntegrator 通知集成器
 type NotificationIntegrator struct {
 	service *NotificationService
 	enabled bool
+
+	// 事件经总线发布，由转发订阅投递给通知服务（SSE等内部消费者共用同一事件流）
+	bus       *events.Bus
+	forwarder *events.Subscription
+	forwardWG sync.WaitGroup
 }
 
 // NewNotificationIntegrator 创建通知集成器
@@ -33,6 +42,36 @@ func NewNotificationIntegrator() *NotificationIntegrator {
 			MaxInterval:     parseDuration(gatewayConfig.Notification.Retry.MaxInterval, 30*time.Second),
 			Multiplier:      gatewayConfig.Notification.Retry.Multiplier,
 		},
+		Spool: SpoolConfig{
+			Enabled:         gatewayConfig.Notification.Spool.Enabled,
+			Dir:             gatewayConfig.Notification.Spool.Dir,
+			MaxBytes:        gatewayConfig.Notification.Spool.MaxBytes,
+			SegmentMaxBytes: gatewayConfig.Notification.Spool.SegmentMaxBytes,
+			MaxAge:          parseDuration(gatewayConfig.Notification.Spool.MaxAge, defaultSpoolMaxAge),
+			ReplayInterval:  parseDuration(gatewayConfig.Notification.Spool.ReplayInterval, defaultSpoolReplayInterval),
+			WarnBytes:       gatewayConfig.Notification.Spool.WarnBytes,
+		},
+		FanOut: FanOutConfig{
+			Enabled:        gatewayConfig.Notification.FanOut.Enabled,
+			RatePerSecond:  gatewayConfig.Notification.FanOut.RatePerSecond,
+			Burst:          gatewayConfig.Notification.FanOut.Burst,
+			QueueDepth:     gatewayConfig.Notification.FanOut.QueueDepth,
+			DigestInterval: parseDuration(gatewayConfig.Notification.FanOut.DigestInterval, defaultFanOutDigestInterval),
+		},
+		DeadLetter: DeadLetterConfig{
+			File:       ResolveDeadLetterFile(gatewayConfig.Notification.DeadLetter.File, gatewayConfig.Notification.Spool.Dir),
+			RedisKey:   gatewayConfig.Notification.DeadLetter.RedisKey,
+			MaxEntries: gatewayConfig.Notification.DeadLetter.MaxEntries,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Enabled:             gatewayConfig.Notification.CircuitBreaker.Enabled,
+			ConsecutiveFailures: gatewayConfig.Notification.CircuitBreaker.ConsecutiveFailures,
+			FailureRate:         gatewayConfig.Notification.CircuitBreaker.FailureRate,
+			MinRequests:         gatewayConfig.Notification.CircuitBreaker.MinRequests,
+			Window:              parseDuration(gatewayConfig.Notification.CircuitBreaker.Window, time.Minute),
+			CoolDown:            parseDuration(gatewayConfig.Notification.CircuitBreaker.CoolDown, 30*time.Second),
+			HalfOpenProbes:      gatewayConfig.Notification.CircuitBreaker.HalfOpenProbes,
+		},
 	}
 
 	// 采样与节流配置
@@ -54,6 +93,15 @@ func NewNotificationIntegrator() *NotificationIntegrator {
 			Timeout:    parseDuration(ep.Timeout, 10*time.Second),
 			EventTypes: ep.EventTypes,
 			Enabled:    ep.Enabled,
+
+			Tenants:     ep.Tenants,
+			DeviceTypes: ep.DeviceTypes,
+
+			RateLimitPerSecond: ep.RateLimitPerSecond,
+			Secret:             ep.Secret,
+
+			Concurrency: ep.Concurrency,
+			QueueSize:   ep.QueueSize,
 		}
 		notificationConfig.Endpoints = append(notificationConfig.Endpoints, endpoint)
 	}
@@ -68,6 +116,7 @@ func NewNotificationIntegrator() *NotificationIntegrator {
 	return &NotificationIntegrator{
 		service: service,
 		enabled: notificationConfig.Enabled,
+		bus:     events.GetGlobalBus(),
 	}
 }
 
@@ -78,7 +127,11 @@ func (n *NotificationIntegrator) Start(ctx context.Context) error {
 		return nil
 	}
 
-	return n.service.Start(ctx)
+	if err := n.service.Start(ctx); err != nil {
+		return err
+	}
+	n.startForwarder(ctx)
+	return nil
 }
 
 // Stop 停止通知集成器
@@ -87,6 +140,7 @@ func (n *NotificationIntegrator) Stop(ctx context.Context) error {
 		return nil
 	}
 
+	n.stopForwarder()
 	return n.service.Stop(ctx)
 }
 
@@ -103,6 +157,15 @@ func (n *NotificationIntegrator) GetStats() (NotificationStats, bool) {
 	return n.service.GetStats(), true
 }
 
+// GetRecentDeliveryStats 获取近1小时投递统计（若未启用返回false）
+func (n *NotificationIntegrator) GetRecentDeliveryStats(now time.Time) (sent, success int64, rate float64, ok bool) {
+	if n == nil || !n.enabled || n.service == nil {
+		return 0, 0, 0, false
+	}
+	sent, success, rate = n.service.GetRecentDeliveryStats(now)
+	return sent, success, rate, true
+}
+
 // GetQueueLength 获取事件队列长度（未启用返回0）
 func (n *NotificationIntegrator) GetQueueLength() int {
 	if n == nil || !n.enabled || n.service == nil {
@@ -119,6 +182,22 @@ func (n *NotificationIntegrator) GetRetryQueueLength() int {
 	return n.service.GetRetryQueueLength()
 }
 
+// SpoolWarning 通知暂存超过告警阈值时返回告警描述（未启用时返回空）
+func (n *NotificationIntegrator) SpoolWarning() string {
+	if n == nil || !n.enabled || n.service == nil {
+		return ""
+	}
+	return n.service.SpoolWarning()
+}
+
+// SpoolReplaySource 通知暂存的停机积压重放（未启用通知或暂存时返回nil）
+func (n *NotificationIntegrator) SpoolReplaySource() replay.Source {
+	if n == nil || !n.enabled || n.service == nil {
+		return nil
+	}
+	return n.service.SpoolReplaySource()
+}
+
 // NotifyDeviceOnline 通知设备上线
 func (n *NotificationIntegrator) NotifyDeviceOnline(conn ziface.IConnection, deviceID string, data map[string]interface{}) {
 	if !n.enabled {
@@ -133,9 +212,7 @@ func (n *NotificationIntegrator) NotifyDeviceOnline(conn ziface.IConnection, dev
 	data["remote_addr"] = conn.RemoteAddr().String()
 	data["connect_time"] = time.Now().Unix()
 
-	if err := n.service.SendDeviceOnlineNotification(deviceID, data); err != nil {
-		logger.Error("发送设备上线通知失败: " + err.Error())
-	}
+	n.publish(newDeviceOnlineEvent(deviceID, data))
 }
 
 // NotifyDeviceOffline 通知设备离线
@@ -151,9 +228,7 @@ func (n *NotificationIntegrator) NotifyDeviceOffline(conn ziface.IConnection, de
 		"reason":          reason,
 	}
 
-	if err := n.service.SendDeviceOfflineNotification(deviceID, data); err != nil {
-		logger.Error("发送设备离线通知失败: " + err.Error())
-	}
+	n.publish(newDeviceOfflineEvent(deviceID, data))
 }
 
 // NotifyChargingStart 通知充电开始
@@ -168,19 +243,18 @@ func (n *NotificationIntegrator) NotifyChargingStart(decodedFrame *protocol.Deco
 	portNumber := sessionData.Port
 
 	data := ChargeResponse{
-		Port:       sessionData.Port,
-		Status:     sessionData.Status,
-		StatusDesc: sessionData.StatusDesc,
-		OrderNo:    sessionData.OrderNo,
-		RemoteAddr: conn.RemoteAddr().String(),
-		MessageID:  fmt.Sprintf("0x%04X", decodedFrame.MessageID),
-		Command:    fmt.Sprintf("0x%02X", decodedFrame.Command),
-		FailedTime: time.Now().Unix(),
-	}
-
-	if err := n.service.SendChargingStartNotification(deviceID, portNumber, data); err != nil {
-		logger.Error("发送充电开始通知失败: " + err.Error())
-	}
+		Port:          sessionData.Port,
+		Status:        sessionData.Status,
+		StatusDesc:    sessionData.StatusDesc,
+		OrderNo:       sessionData.OrderNo,
+		RemoteAddr:    conn.RemoteAddr().String(),
+		MessageID:     fmt.Sprintf("0x%04X", decodedFrame.MessageID),
+		Command:       fmt.Sprintf("0x%02X", decodedFrame.Command),
+		FailedTime:    time.Now().Unix(),
+		CorrelationID: sessionData.CorrelationID,
+	}
+
+	n.publish(newChargingStartEvent(deviceID, portNumber, data))
 }
 
 // NotifyChargingEnd 通知充电结束
@@ -199,15 +273,16 @@ func (n *NotificationIntegrator) NotifyChargingEnd(decodedFrame *protocol.Decode
 		Status:     endData.Status,
 		StatusDesc: endData.StatusDesc,
 		OrderNo:    endData.OrderNo,
-		RemoteAddr: conn.RemoteAddr().String(),
+		RemoteAddr: endData.RemoteAddr,
 		MessageID:  fmt.Sprintf("0x%04X", decodedFrame.MessageID),
 		Command:    fmt.Sprintf("0x%02X", decodedFrame.Command),
 		FailedTime: time.Now().Unix(),
 	}
-
-	if err := n.service.SendChargingEndNotification(deviceID, portNumber, data); err != nil {
-		logger.Error("发送充电结束通知失败: " + err.Error())
+	if conn != nil {
+		data.RemoteAddr = conn.RemoteAddr().String()
 	}
+
+	n.publish(newChargingEndEvent(deviceID, portNumber, data))
 }
 
 // NotifySettlement 通知结算
@@ -228,11 +303,14 @@ func (n *NotificationIntegrator) NotifySettlement(decodedFrame *protocol.Decoded
 	portNumber = portNumber + 1
 
 	data := map[string]interface{}{
-		"conn_id":     conn.GetConnID(),
-		"remote_addr": conn.RemoteAddr().String(),
-		"message_id":  fmt.Sprintf("0x%04X", decodedFrame.MessageID),
-		"command":     fmt.Sprintf("0x%02X", decodedFrame.Command),
-		"timestamp":   time.Now().Unix(),
+		"message_id": fmt.Sprintf("0x%04X", decodedFrame.MessageID),
+		"command":    dny_protocol.CommandLabel(decodedFrame.Command),
+		"timestamp":  time.Now().Unix(),
+	}
+	// 预写日志重放时原连接已不存在，连接信息由结算数据携带
+	if conn != nil {
+		data["conn_id"] = conn.GetConnID()
+		data["remote_addr"] = conn.RemoteAddr().String()
 	}
 
 	// 合并结算数据
@@ -240,9 +318,7 @@ func (n *NotificationIntegrator) NotifySettlement(decodedFrame *protocol.Decoded
 		data[k] = v
 	}
 
-	if err := n.service.SendSettlementNotification(deviceID, portNumber, data); err != nil {
-		logger.Error("发送结算通知失败: " + err.Error())
-	}
+	n.publish(newSettlementEvent(deviceID, portNumber, data))
 }
 
 // NotifyDeviceError 通知设备错误
@@ -269,35 +345,344 @@ func (n *NotificationIntegrator) NotifyDeviceError(deviceID string, errorType st
 		Timestamp: time.Now(),
 	}
 
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送设备错误通知失败: " + err.Error())
+	n.publish(event)
+}
+
+// NotifyICCIDConflict 通知ICCID冲突（高危事件）
+func (n *NotificationIntegrator) NotifyICCIDConflict(deviceID string, conflictData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"severity":  SeverityHigh,
+		"timestamp": time.Now().Unix(),
+	}
+	for k, v := range conflictData {
+		data[k] = v
+	}
+
+	event := &NotificationEvent{
+		EventType: EventTypeICCIDConflict,
+		DeviceID:  deviceID,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+
+	n.publish(event)
+}
+
+// NotifySIMFailover 通知双卡设备SIM卡切换
+func (n *NotificationIntegrator) NotifySIMFailover(deviceID string, failoverData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+	}
+	for k, v := range failoverData {
+		data[k] = v
+	}
+
+	event := &NotificationEvent{
+		EventType: EventTypeSIMFailover,
+		DeviceID:  deviceID,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+
+	n.publish(event)
+}
+
+// NotifyDeviceAnomaly 通知设备心跳数据异常事件开启
+func (n *NotificationIntegrator) NotifyDeviceAnomaly(deviceID string, portNumber int, anomalyData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+	}
+	for k, v := range anomalyData {
+		data[k] = v
+	}
+
+	event := &NotificationEvent{
+		EventType:  EventTypeDeviceAnomaly,
+		DeviceID:   deviceID,
+		PortNumber: portNumber,
+		Data:       data,
+		Timestamp:  time.Now(),
 	}
+
+	n.publish(event)
+}
+
+// NotifyFrameJournalDegraded 通知关键帧预写日志降级（高危事件）
+func (n *NotificationIntegrator) NotifyFrameJournalDegraded(alertData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"severity":  SeverityHigh,
+		"timestamp": time.Now().Unix(),
+	}
+	for k, v := range alertData {
+		data[k] = v
+	}
+
+	event := &NotificationEvent{
+		EventType: EventTypeFrameJournalDegraded,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+
+	n.publish(event)
+}
+
+// NotifyRedisDegraded 通知Redis进入降级运行（高危事件）
+func (n *NotificationIntegrator) NotifyRedisDegraded(data map[string]interface{}) {
+	n.notifySystemEvent(EventTypeRedisDegraded, SeverityHigh, data)
+}
+
+// NotifyRedisRecovered 通知Redis恢复
+func (n *NotificationIntegrator) NotifyRedisRecovered(data map[string]interface{}) {
+	n.notifySystemEvent(EventTypeRedisRecovered, "", data)
+}
+
+// NotifyFleetOnlineDrop 通知全网在线设备数告警（高危事件）
+func (n *NotificationIntegrator) NotifyFleetOnlineDrop(data map[string]interface{}) {
+	n.notifySystemEvent(EventTypeFleetOnlineDrop, SeverityHigh, data)
+}
+
+// NotifyFleetOnlineRecovered 通知全网在线设备数告警恢复
+func (n *NotificationIntegrator) NotifyFleetOnlineRecovered(data map[string]interface{}) {
+	n.notifySystemEvent(EventTypeFleetOnlineRecovered, "", data)
+}
+
+// NotifyTenantSLABreached 通知租户命令成功率SLA告警（高危事件，按租户路由）
+func (n *NotificationIntegrator) NotifyTenantSLABreached(tenantID string, data map[string]interface{}) {
+	n.notifyTenantSystemEvent(EventTypeTenantSLABreached, SeverityHigh, tenantID, data)
+}
+
+// NotifyTenantSLARecovered 通知租户命令成功率SLA告警恢复
+func (n *NotificationIntegrator) NotifyTenantSLARecovered(tenantID string, data map[string]interface{}) {
+	n.notifyTenantSystemEvent(EventTypeTenantSLARecovered, "", tenantID, data)
+}
+
+func (n *NotificationIntegrator) notifySystemEvent(eventType, severity string, eventData map[string]interface{}) {
+	n.notifyTenantSystemEvent(eventType, severity, "", eventData)
+}
+
+func (n *NotificationIntegrator) notifyTenantSystemEvent(eventType, severity, tenantID string, eventData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+	}
+	if severity != "" {
+		data["severity"] = severity
+	}
+	for k, v := range eventData {
+		data[k] = v
+	}
+
+	n.publish(&NotificationEvent{
+		EventType: eventType,
+		TenantID:  tenantID,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
+// NotifyEnrichedSettlement 通知富化结算（独立事件类型，端点可只订阅此类型）
+func (n *NotificationIntegrator) NotifyEnrichedSettlement(deviceID string, portNumber int, document map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	n.publish(&NotificationEvent{
+		EventType:  EventTypeSettlementEnriched,
+		DeviceID:   deviceID,
+		PortNumber: portNumber + 1,
+		Data:       document,
+		Timestamp:  time.Now(),
+	})
+}
+
+// NotifyReconciliationReport 通知日终对账报告（摘要，明细经对账报告接口获取）
+func (n *NotificationIntegrator) NotifyReconciliationReport(reportData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	event := &NotificationEvent{
+		EventType: EventTypeReconciliationReport,
+		Data:      reportData,
+		Timestamp: time.Now(),
+	}
+
+	n.publish(event)
+}
+
+// NotifyDeviceReboot 通知设备远程重启进展（已下发/完成/失败）
+func (n *NotificationIntegrator) NotifyDeviceReboot(eventType string, deviceID string, rebootData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+	}
+	for k, v := range rebootData {
+		data[k] = v
+	}
+	correlationID, _ := data["correlation_id"].(string)
+
+	event := &NotificationEvent{
+		EventType:     eventType,
+		DeviceID:      deviceID,
+		Data:          data,
+		Timestamp:     time.Now(),
+		CorrelationID: correlationID,
+	}
+
+	n.publish(event)
+}
+
+// NotifyCommandFailed 通知下发命令重发耗尽仍未得到设备应答
+func (n *NotificationIntegrator) NotifyCommandFailed(deviceID string, portNumber int, failureData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+	}
+	for k, v := range failureData {
+		data[k] = v
+	}
+	correlationID, _ := data["correlation_id"].(string)
+
+	n.publish(&NotificationEvent{
+		EventType:     EventTypeCommandFailed,
+		DeviceID:      deviceID,
+		PortNumber:    portNumber,
+		Data:          data,
+		Timestamp:     time.Now(),
+		CorrelationID: correlationID,
+	})
+}
+
+// NotifyDeviceDecommission 通知设备停用/重新启用/停用后注册被拒绝；注册被拒绝为高危事件
+func (n *NotificationIntegrator) NotifyDeviceDecommission(eventType string, deviceID string, decommissionData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+	}
+	if eventType == EventTypeDeviceRegistrationRejected {
+		data["severity"] = SeverityHigh
+	}
+	for k, v := range decommissionData {
+		data[k] = v
+	}
+	correlationID, _ := data["correlation_id"].(string)
+
+	event := &NotificationEvent{
+		EventType:     eventType,
+		DeviceID:      deviceID,
+		Data:          data,
+		Timestamp:     time.Now(),
+		CorrelationID: correlationID,
+	}
+
+	n.publish(event)
+}
+
+// NotifyChargeQueued 通知充电请求设备侧排队
+// portNumber 为业务端口(从1开始)
+func (n *NotificationIntegrator) NotifyChargeQueued(deviceID string, portNumber int, queueData map[string]interface{}) {
+	n.notifyChargeQueue(EventTypeChargeQueued, deviceID, portNumber, queueData)
+}
+
+// NotifyChargeQueueStarted 通知排队结束、端口开始充电（复用charging_start事件）
+func (n *NotificationIntegrator) NotifyChargeQueueStarted(deviceID string, portNumber int, queueData map[string]interface{}) {
+	n.notifyChargeQueue(EventTypeChargingStart, deviceID, portNumber, queueData)
+}
+
+// NotifyChargeQueueTimeout 通知排队超时
+func (n *NotificationIntegrator) NotifyChargeQueueTimeout(deviceID string, portNumber int, queueData map[string]interface{}) {
+	n.notifyChargeQueue(EventTypeChargeQueueTimeout, deviceID, portNumber, queueData)
+}
+
+func (n *NotificationIntegrator) notifyChargeQueue(eventType, deviceID string, portNumber int, queueData map[string]interface{}) {
+	if !n.enabled {
+		return
+	}
+
+	data := map[string]interface{}{
+		"port_number": portNumber,
+		"timestamp":   time.Now().Unix(),
+	}
+	for k, v := range queueData {
+		data[k] = v
+	}
+	correlationID, _ := data["correlation_id"].(string)
+
+	event := &NotificationEvent{
+		EventType:     eventType,
+		DeviceID:      deviceID,
+		PortNumber:    portNumber,
+		Data:          data,
+		Timestamp:     time.Now(),
+		CorrelationID: correlationID,
+	}
+
+	n.publish(event)
 }
 
 // 全局通知集成器实例
-var globalNotificationIntegrator *NotificationIntegrator
+var (
+	globalNotificationIntegrator *NotificationIntegrator
+	globalIntegratorMutex        sync.RWMutex
+)
 
-// GetGlobalNotificationIntegrator 获取全局通知集成器
+// GetGlobalNotificationIntegrator 获取全局通知集成器，未初始化时panic
 func GetGlobalNotificationIntegrator() *NotificationIntegrator {
+	globalIntegratorMutex.RLock()
+	defer globalIntegratorMutex.RUnlock()
 	if globalNotificationIntegrator == nil {
-		globalNotificationIntegrator = NewNotificationIntegrator()
+		panic("notification: 通知集成器尚未初始化，请先执行 bootstrap.New（测试使用 bootstrap.InitForTest）")
 	}
 	return globalNotificationIntegrator
 }
 
 // InitGlobalNotificationIntegrator 初始化全局通知集成器
 func InitGlobalNotificationIntegrator(ctx context.Context) error {
-	globalNotificationIntegrator = NewNotificationIntegrator()
-	if globalNotificationIntegrator.IsEnabled() {
-		return globalNotificationIntegrator.Start(ctx)
+	integrator := NewNotificationIntegrator()
+	globalIntegratorMutex.Lock()
+	globalNotificationIntegrator = integrator
+	globalIntegratorMutex.Unlock()
+	if integrator.IsEnabled() {
+		return integrator.Start(ctx)
 	}
 	return nil
 }
 
 // StopGlobalNotificationIntegrator 停止全局通知集成器
 func StopGlobalNotificationIntegrator(ctx context.Context) error {
-	if globalNotificationIntegrator != nil && globalNotificationIntegrator.IsEnabled() {
-		return globalNotificationIntegrator.Stop(ctx)
+	globalIntegratorMutex.RLock()
+	integrator := globalNotificationIntegrator
+	globalIntegratorMutex.RUnlock()
+	if integrator != nil && integrator.IsEnabled() {
+		return integrator.Stop(ctx)
 	}
 	return nil
 }
@@ -325,9 +710,7 @@ func (n *NotificationIntegrator) NotifyPortStatusChange(deviceID string, portNum
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送端口状态变化通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyPortError 发送端口故障通知
@@ -348,9 +731,7 @@ func (n *NotificationIntegrator) NotifyPortError(deviceID string, portNumber int
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送端口故障通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyPortOnline 发送端口上线通知
@@ -368,9 +749,7 @@ func (n *NotificationIntegrator) NotifyPortOnline(deviceID string, portNumber in
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送端口上线通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyPortOffline 发送端口离线通知
@@ -390,9 +769,7 @@ func (n *NotificationIntegrator) NotifyPortOffline(deviceID string, portNumber i
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送端口离线通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyDeviceHeartbeat 发送设备心跳通知
@@ -410,9 +787,7 @@ func (n *NotificationIntegrator) NotifyDeviceHeartbeat(decodedFrame *protocol.De
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送设备心跳通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyPortHeartbeat 发送端口心跳通知
@@ -431,9 +806,7 @@ func (n *NotificationIntegrator) NotifyPortHeartbeat(deviceID string, portNumber
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送端口心跳通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyPowerHeartbeat 发送功率心跳通知
@@ -452,9 +825,7 @@ func (n *NotificationIntegrator) NotifyPowerHeartbeat(deviceID string, portNumbe
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送功率心跳通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyChargingPower 发送充电功率实时数据（事件类型：charging_power）
@@ -471,9 +842,7 @@ func (n *NotificationIntegrator) NotifyChargingPower(deviceID string, portNumber
 		Timestamp:  time.Now(),
 	}
 
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送充电功率实时数据失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyDeviceRegister 发送设备注册通知
@@ -491,9 +860,7 @@ func (n *NotificationIntegrator) NotifyDeviceRegister(deviceID string, registerD
 	}
 
 	// 发送通知
-	if err := n.service.SendNotification(event); err != nil {
-		logger.Error("发送设备注册通知失败: " + err.Error())
-	}
+	n.publish(event)
 }
 
 // NotifyChargingFailed 发送充电失败通知
@@ -507,19 +874,18 @@ func (n *NotificationIntegrator) NotifyChargingFailed(decodedFrame *protocol.Dec
 	// 从充电失败数据中提取端口号
 
 	data := ChargeResponse{
-		Port:       chargingFailedData.Port,
-		Status:     chargingFailedData.Status,
-		StatusDesc: chargingFailedData.StatusDesc,
-		OrderNo:    chargingFailedData.OrderNo,
-		RemoteAddr: conn.RemoteAddr().String(),
-		MessageID:  fmt.Sprintf("0x%04X", decodedFrame.MessageID),
-		Command:    fmt.Sprintf("0x%02X", decodedFrame.Command),
-		FailedTime: time.Now().Unix(),
-	}
-
-	if err := n.service.SendChargingFailedNotification(deviceID, chargingFailedData.Port, data); err != nil {
-		logger.Error("发送充电失败通知失败: " + err.Error())
-	}
+		Port:          chargingFailedData.Port,
+		Status:        chargingFailedData.Status,
+		StatusDesc:    chargingFailedData.StatusDesc,
+		OrderNo:       chargingFailedData.OrderNo,
+		RemoteAddr:    conn.RemoteAddr().String(),
+		MessageID:     fmt.Sprintf("0x%04X", decodedFrame.MessageID),
+		Command:       fmt.Sprintf("0x%02X", decodedFrame.Command),
+		FailedTime:    time.Now().Unix(),
+		CorrelationID: chargingFailedData.CorrelationID,
+	}
+
+	n.publish(newChargingFailedEvent(deviceID, chargingFailedData.Port, data))
 }
 
 // 辅助函数
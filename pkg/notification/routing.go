@@ -0,0 +1,111 @@
+package notification
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// SelectorAll 选择器通配符
+const SelectorAll = "*"
+
+// UntaggedTenant 未标注租户的事件在租户统计中的归类
+const UntaggedTenant = "untagged"
+
+// RouteDecision 单个端点的路由判定
+type RouteDecision struct {
+	Endpoint string `json:"endpoint"`
+	Type     string `json:"type"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason,omitempty"` // 未匹配原因
+}
+
+// TagEvent 补全事件的路由标签：租户取自资产映射，设备类型取自TCP管理器中的设备信息；已设置的标签保持不变
+func TagEvent(event *NotificationEvent) {
+	if event == nil || event.DeviceID == "" {
+		return
+	}
+	if event.TenantID == "" {
+		if info, ok := asset.Lookup(event.DeviceID); ok {
+			event.TenantID = info.TenantID
+		}
+	}
+	if event.DeviceType == "" {
+		if device, ok := core.GetGlobalTCPManager().GetDeviceByID(event.DeviceID); ok && device.DeviceType != 0 {
+			event.DeviceType = strconv.Itoa(int(device.DeviceType))
+		}
+	}
+}
+
+// matchEndpoint 判断端点是否接收事件：事件类型须显式订阅（或"*"）；租户/设备类型选择器为空表示不限，
+// 非空时事件须带有匹配的标签（未标注租户的事件不会投递给限定租户的端点）
+func matchEndpoint(endpoint NotificationEndpoint, event *NotificationEvent) (bool, string) {
+	if !endpoint.Enabled {
+		return false, "端点未启用"
+	}
+	if !selectorMatches(endpoint.EventTypes, event.EventType, false) {
+		return false, fmt.Sprintf("未订阅事件类型 %s", event.EventType)
+	}
+	if !selectorMatches(endpoint.Tenants, event.TenantID, true) {
+		if event.TenantID == "" {
+			return false, "事件未标注租户"
+		}
+		return false, fmt.Sprintf("租户 %s 不在选择器内", event.TenantID)
+	}
+	if !selectorMatches(endpoint.DeviceTypes, event.DeviceType, true) {
+		if event.DeviceType == "" {
+			return false, "事件未标注设备类型"
+		}
+		return false, fmt.Sprintf("设备类型 %s 不在选择器内", event.DeviceType)
+	}
+	return true, ""
+}
+
+// selectorMatches emptyMatchesAll=false 时空选择器不匹配任何值；非空选择器不匹配空值（"*" 除外）
+func selectorMatches(selector []string, value string, emptyMatchesAll bool) bool {
+	if len(selector) == 0 {
+		return emptyMatchesAll
+	}
+	for _, s := range selector {
+		if s == SelectorAll {
+			return true
+		}
+		if value != "" && strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteEvent 返回应接收该事件的端点
+func (c *NotificationConfig) RouteEvent(event *NotificationEvent) []NotificationEndpoint {
+	var endpoints []NotificationEndpoint
+	for _, endpoint := range c.Endpoints {
+		if ok, _ := matchEndpoint(endpoint, event); ok {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+// ExplainRoute 返回每个端点对该事件的路由判定（路由规则调试）
+func (c *NotificationConfig) ExplainRoute(event *NotificationEvent) []RouteDecision {
+	decisions := make([]RouteDecision, 0, len(c.Endpoints))
+	for _, endpoint := range c.Endpoints {
+		ok, reason := matchEndpoint(endpoint, event)
+		decisions = append(decisions, RouteDecision{Endpoint: endpoint.Name, Type: endpoint.Type, Matched: ok, Reason: reason})
+	}
+	return decisions
+}
+
+// DryRunRoute 模拟路由：补全样例事件的标签后返回各端点判定，不实际投递
+func (n *NotificationIntegrator) DryRunRoute(event NotificationEvent) (NotificationEvent, []RouteDecision, error) {
+	if n == nil || n.service == nil {
+		return event, nil, fmt.Errorf("通知服务未初始化")
+	}
+	TagEvent(&event)
+	return event, n.service.config.ExplainRoute(&event), nil
+}
@@ -12,6 +12,9 @@ import (
 
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
 	"github.com/google/uuid"
 	redisv9 "github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -22,11 +25,10 @@ type NotificationService struct {
 	config     *NotificationConfig
 	httpClient *http.Client
 
-	// 队列和工作协程
-	eventQueue chan *NotificationEvent
-	retryQueue chan retryPayload
-	// 死信队列（内存回退）
-	dlqQueue chan dlqPayload
+	// 队列和工作协程（eventQueue 由路由协程消费，按端点分发到各端点独立的投递队列）
+	eventQueue  chan *NotificationEvent
+	dispatchers map[string]*endpointDispatcher
+	retryQueue  chan retryPayload
 
 	// 生命周期
 	running bool
@@ -41,12 +43,26 @@ type NotificationService struct {
 	stats   *NotificationStats
 	statsMu sync.RWMutex
 
+	// 近1小时投递结果（仪表盘成功率统计）
+	recentSent    *utils.RollingCounter
+	recentSuccess *utils.RollingCounter
+
 	// 采样配置
 	sampling map[string]int
 
 	// 节流：key(event_type|device_id|port) → 下一次允许发送时间
 	throttleMu sync.Mutex
 	nextAllow  map[string]time.Time
+
+	// 投递失败事件的磁盘暂存（未启用时为nil）与已投递成功的 事件ID|端点（暂存重放与实时投递去重）
+	spool     *Spool
+	delivered *utils.LRUSet
+
+	// 全局出站限流（未启用时为nil）
+	fanOutLimiter *fanOutLimiter
+
+	// 死信文件追加写互斥
+	deadLetterMu sync.Mutex
 }
 
 // retryPayload 表示一次端点级重试任务
@@ -55,13 +71,6 @@ type retryPayload struct {
 	Endpoint NotificationEndpoint `json:"endpoint"`
 }
 
-// dlqPayload 表示死信队列任务
-type dlqPayload struct {
-	Event    *NotificationEvent   `json:"event"`
-	Endpoint NotificationEndpoint `json:"endpoint"`
-	Attempt  int                  `json:"attempt"`
-}
-
 // NewNotificationService 创建通知服务
 func NewNotificationService(config *NotificationConfig) (*NotificationService, error) {
 	if config == nil {
@@ -80,6 +89,7 @@ func NewNotificationService(config *NotificationConfig) (*NotificationService, e
 	// 初始化统计信息
 	stats := &NotificationStats{
 		EndpointStats:  make(map[string]*EndpointStats),
+		TenantStats:    make(map[string]*TenantDeliveryStats),
 		LastUpdateTime: time.Now(),
 	}
 
@@ -94,17 +104,40 @@ func NewNotificationService(config *NotificationConfig) (*NotificationService, e
 		config:      config,
 		httpClient:  httpClient,
 		eventQueue:  make(chan *NotificationEvent, config.QueueSize),
+		dispatchers: newEndpointDispatchers(config),
 		retryQueue:  make(chan retryPayload, config.QueueSize),
-		dlqQueue:    make(chan dlqPayload, config.QueueSize),
 		redisClient: infraredis.GetClient(), // 复用现有Redis连接
 		stats:       stats,
 		sampling:    config.Sampling,
 		nextAllow:   make(map[string]time.Time),
+
+		recentSent:    utils.NewRollingCounter(time.Hour),
+		recentSuccess: utils.NewRollingCounter(time.Hour),
+		delivered:     utils.NewLRUSet(deliveredCacheSize),
+	}
+
+	if config.FanOut.Enabled {
+		service.fanOutLimiter = newFanOutLimiter(config.FanOut)
+	}
+
+	if config.Spool.Enabled {
+		spool, err := OpenSpool(config.Spool.Dir, config.Spool.MaxBytes, config.Spool.SegmentMaxBytes)
+		if err != nil {
+			// 暂存不可用不影响实时投递，重试用尽的事件按原逻辑处理
+			logger.WithFields(logrus.Fields{"dir": config.Spool.Dir, "error": err.Error()}).Error("打开通知暂存目录失败")
+		} else {
+			service.spool = spool
+		}
 	}
 
 	return service, nil
 }
 
+// SetRedisClient 替换Redis连接（测试使用，须在 Start 之前调用）
+func (s *NotificationService) SetRedisClient(client *redisv9.Client) {
+	s.redisClient = client
+}
+
 // Start 启动通知服务
 func (s *NotificationService) Start(ctx context.Context) error {
 	if !s.config.Enabled {
@@ -123,14 +156,24 @@ func (s *NotificationService) Start(ctx context.Context) error {
 		s.wg.Add(1)
 		go s.worker(i)
 	}
+	s.startEndpointWorkers()
+	if s.fanOutLimiter != nil {
+		s.wg.Add(1)
+		go s.fanOutWorker()
+	}
+
+	// 旧版死信队列并入死信列表
+	s.migrateLegacyDeadLetters()
 
 	// 启动重试协程
 	s.wg.Add(1)
 	go s.retryWorker()
 
-	// 启动死信处理协程
-	s.wg.Add(1)
-	go s.dlqWorker()
+	// 启动暂存重放协程（启动时立即重放一轮）
+	if s.spool != nil {
+		s.wg.Add(1)
+		go s.spoolWorker()
+	}
 
 	s.running = true
 
@@ -154,7 +197,6 @@ func (s *NotificationService) Stop(ctx context.Context) error {
 	// 停止接收新事件
 	close(s.eventQueue)
 	close(s.retryQueue)
-	close(s.dlqQueue)
 
 	// 等待工作协程完成
 	s.cancel()
@@ -178,6 +220,8 @@ func (s *NotificationService) SendNotification(event *NotificationEvent) error {
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
 	}
+	// 源头补全租户/设备类型标签，供端点路由使用
+	TagEvent(event)
 
 	// 发送到事件队列
 	select {
@@ -190,29 +234,42 @@ func (s *NotificationService) SendNotification(event *NotificationEvent) error {
 
 // SendDeviceOnlineNotification 发送设备上线通知
 func (s *NotificationService) SendDeviceOnlineNotification(deviceID string, data map[string]interface{}) error {
-	event := &NotificationEvent{
+	return s.SendNotification(newDeviceOnlineEvent(deviceID, data))
+}
+
+// newDeviceOnlineEvent 构造设备上线事件
+func newDeviceOnlineEvent(deviceID string, data map[string]interface{}) *NotificationEvent {
+	return &NotificationEvent{
 		EventType: EventTypeDeviceOnline,
 		DeviceID:  deviceID,
 		Data:      data,
 		Timestamp: time.Now(),
 	}
-	return s.SendNotification(event)
 }
 
 // SendDeviceOfflineNotification 发送设备离线通知
 func (s *NotificationService) SendDeviceOfflineNotification(deviceID string, data map[string]interface{}) error {
-	event := &NotificationEvent{
+	return s.SendNotification(newDeviceOfflineEvent(deviceID, data))
+}
+
+// newDeviceOfflineEvent 构造设备离线事件
+func newDeviceOfflineEvent(deviceID string, data map[string]interface{}) *NotificationEvent {
+	return &NotificationEvent{
 		EventType: EventTypeDeviceOffline,
 		DeviceID:  deviceID,
 		Data:      data,
 		Timestamp: time.Now(),
 	}
-	return s.SendNotification(event)
 }
 
 // SendChargingStartNotification 发送充电开始通知
 func (s *NotificationService) SendChargingStartNotification(deviceID string, portNumber uint8, data ChargeResponse) error {
-	event := &NotificationEvent{
+	return s.SendNotification(newChargingStartEvent(deviceID, portNumber, data))
+}
+
+// newChargingStartEvent 构造充电开始事件
+func newChargingStartEvent(deviceID string, portNumber uint8, data ChargeResponse) *NotificationEvent {
+	return &NotificationEvent{
 		EventType:  EventTypeChargingStart,
 		DeviceID:   deviceID,
 		PortNumber: int(portNumber) + 1,
@@ -225,14 +282,19 @@ func (s *NotificationService) SendChargingStartNotification(deviceID string, por
 			"message_id":  data.MessageID,
 			"command":     data.Command,
 		},
-		Timestamp: time.Now(),
+		Timestamp:     time.Now(),
+		CorrelationID: data.CorrelationID,
 	}
-	return s.SendNotification(event)
 }
 
 // SendChargingEndNotification 发送充电结束通知
 func (s *NotificationService) SendChargingEndNotification(deviceID string, portNumber uint8, data ChargeResponse) error {
-	event := &NotificationEvent{
+	return s.SendNotification(newChargingEndEvent(deviceID, portNumber, data))
+}
+
+// newChargingEndEvent 构造充电结束事件
+func newChargingEndEvent(deviceID string, portNumber uint8, data ChargeResponse) *NotificationEvent {
+	return &NotificationEvent{
 		EventType:  EventTypeChargingEnd,
 		DeviceID:   deviceID,
 		PortNumber: int(portNumber) + 1,
@@ -253,12 +315,16 @@ func (s *NotificationService) SendChargingEndNotification(deviceID string, portN
 		},
 		Timestamp: time.Now(),
 	}
-	return s.SendNotification(event)
 }
 
 // SendChargingFailedNotification 发送充电失败通知
 func (s *NotificationService) SendChargingFailedNotification(deviceID string, portNumber uint8, data ChargeResponse) error {
-	event := &NotificationEvent{
+	return s.SendNotification(newChargingFailedEvent(deviceID, portNumber, data))
+}
+
+// newChargingFailedEvent 构造充电失败事件
+func newChargingFailedEvent(deviceID string, portNumber uint8, data ChargeResponse) *NotificationEvent {
+	return &NotificationEvent{
 		EventType:  EventTypeChargingFailed,
 		DeviceID:   deviceID,
 		PortNumber: int(portNumber) + 1,
@@ -272,21 +338,25 @@ func (s *NotificationService) SendChargingFailedNotification(deviceID string, po
 			"command":     data.Command,
 			"failed_time": data.FailedTime,
 		},
-		Timestamp: time.Now(),
+		Timestamp:     time.Now(),
+		CorrelationID: data.CorrelationID,
 	}
-	return s.SendNotification(event)
 }
 
 // SendSettlementNotification 发送结算通知
 func (s *NotificationService) SendSettlementNotification(deviceID string, portNumber int, data map[string]interface{}) error {
-	event := &NotificationEvent{
+	return s.SendNotification(newSettlementEvent(deviceID, portNumber, data))
+}
+
+// newSettlementEvent 构造结算事件
+func newSettlementEvent(deviceID string, portNumber int, data map[string]interface{}) *NotificationEvent {
+	return &NotificationEvent{
 		EventType:  EventTypeSettlement,
 		DeviceID:   deviceID,
 		PortNumber: portNumber,
 		Data:       data,
 		Timestamp:  time.Now(),
 	}
-	return s.SendNotification(event)
 }
 
 // worker 工作协程
@@ -322,36 +392,10 @@ func (s *NotificationService) retryWorker() {
 				return
 			}
 			// 直接针对端点发送
-			s.sendToEndpoint(payload.Event, payload.Endpoint)
+			s.dispatch(payload.Event, payload.Endpoint)
 		case <-ticker.C:
 			// 从Redis加载重试事件
 			s.loadRetryEvents()
-			// 从Redis加载死信事件（用于重试DLQ，延迟更长）
-			s.loadDeadLetters()
-		case <-s.ctx.Done():
-			return
-		}
-	}
-}
-
-// dlqWorker 处理死信队列
-func (s *NotificationService) dlqWorker() {
-	defer s.wg.Done()
-
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case payload, ok := <-s.dlqQueue:
-			if !ok {
-				return
-			}
-			// 对死信事件采用更保守的退避（在 header 里保留 Idempotency-Key）
-			s.sendToEndpoint(payload.Event, payload.Endpoint)
-		case <-ticker.C:
-			// 定期从Redis加载DLQ任务
-			s.loadDeadLetters()
 		case <-s.ctx.Done():
 			return
 		}
@@ -362,10 +406,19 @@ func (s *NotificationService) dlqWorker() {
 func (s *NotificationService) processEvent(event *NotificationEvent) {
 	// 记录事件到内存记录器并广播给订阅者（用于SSE/调试）
 	GetGlobalRecorder().Record(event)
-	// 获取订阅该事件的端点
-	endpoints := s.config.GetEndpointsByEvent(event.EventType)
+	// 按事件类型/租户/设备类型选择器路由到端点
+	endpoints := s.config.RouteEvent(event)
 	if len(endpoints) == 0 {
-		logger.WithField("event_type", event.EventType).Debug("没有端点订阅该事件类型")
+		s.statsMu.Lock()
+		s.stats.Unrouted++
+		s.stats.LastUpdateTime = time.Now()
+		s.statsMu.Unlock()
+		logger.WithFields(logrus.Fields{
+			"event_type":  event.EventType,
+			"device_id":   event.DeviceID,
+			"tenant_id":   event.TenantID,
+			"device_type": event.DeviceType,
+		}).Debug("没有端点匹配该事件")
 		return
 	}
 
@@ -404,98 +457,67 @@ func (s *NotificationService) processEvent(event *NotificationEvent) {
 		}
 	}
 
-	// 向每个端点发送通知
-	for _, endpoint := range endpoints {
-		s.sendToEndpoint(event, endpoint)
-	}
+	// 经全局出站限流分发到各端点的投递队列
+	s.fanOut(event, endpoints)
 }
 
-// enqueueDeadLetter 将事件放入死信队列（Redis优先，内存回退）
-func (s *NotificationService) enqueueDeadLetter(event *NotificationEvent, endpoint NotificationEndpoint, attempt int) {
-	// 标记关键事件
-	event.IsCritical = true
-
-	// 记录日志
-	logger.WithFields(logrus.Fields{
-		"component":     "notification",
-		"action":        "enqueue_dead_letter",
-		"event_id":      event.EventID,
-		"event_type":    event.EventType,
-		"endpoint":      endpoint.Name,
-		"attempt_count": attempt,
-	}).Warn("📤 关键事件进入死信队列")
-
-	// 使用Redis ZSET 进行持久化（延迟固定较长，比如5分钟后再尝试）
-	if client, ok := s.redisClient.(*redisv9.Client); ok && client != nil {
-		key := "notify:dlq:" + endpoint.Name
-		readyAt := time.Now().Add(5 * time.Minute).Unix()
-		payload := dlqPayload{Event: event, Endpoint: endpoint, Attempt: attempt}
-		if b, err := json.Marshal(payload); err == nil {
-			_ = client.ZAdd(s.ctx, key, redisv9.Z{Score: float64(readyAt), Member: string(b)}).Err()
-		}
+// sendToEndpoint 向端点发送通知，失败时安排重试
+func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint NotificationEndpoint) {
+	// 同一事件已投递成功（如暂存重放先于实时重试成功）时不再重复投递
+	if s.delivered.Contains(deliveredKey(event, endpoint.Name)) {
+		s.statsMu.Lock()
+		s.stats.SuppressedDuplicates++
+		s.stats.LastUpdateTime = time.Now()
+		s.statsMu.Unlock()
 		return
 	}
 
-	// 回退到内存队列
-	select {
-	case s.dlqQueue <- dlqPayload{Event: event, Endpoint: endpoint, Attempt: attempt}:
-	default:
+	// 端点熔断中：不发起请求，按一次失败转入重试/暂存
+	breaker := s.breakerFor(endpoint.Name)
+	if breaker != nil && !breaker.Allow() {
+		s.statsMu.Lock()
+		if es, exists := s.stats.EndpointStats[endpoint.Name]; exists {
+			es.ShortCircuited++
+		}
+		s.stats.LastUpdateTime = time.Now()
+		s.statsMu.Unlock()
 		logger.WithFields(logrus.Fields{
 			"component":  "notification",
-			"action":     "dlq_full",
+			"action":     "short_circuit",
 			"event_id":   event.EventID,
 			"event_type": event.EventType,
 			"endpoint":   endpoint.Name,
-		}).Error("📤 死信队列已满，事件可能丢失（请检查容量/Redis）")
-	}
-}
-
-// loadDeadLetters 从Redis加载到期的死信事件
-func (s *NotificationService) loadDeadLetters() {
-	client, ok := s.redisClient.(*redisv9.Client)
-	if !ok || client == nil {
+		}).Debug("📤 通知端点熔断中，跳过本次投递")
+		s.failAttempt(event, endpoint)
 		return
 	}
 
-	now := time.Now().Unix()
-	for _, endpoint := range s.config.Endpoints {
-		key := "notify:dlq:" + endpoint.Name
-		res := client.ZRangeByScoreWithScores(s.ctx, key, &redisv9.ZRangeBy{
-			Min:    "-inf",
-			Max:    fmt.Sprintf("%d", now),
-			Offset: 0,
-			Count:  100,
-		})
-		members, err := res.Result()
-		if err != nil || len(members) == 0 {
-			continue
-		}
-		for _, z := range members {
-			str, ok := z.Member.(string)
-			if !ok {
-				continue
-			}
-			var payload dlqPayload
-			if err := json.Unmarshal([]byte(str), &payload); err != nil {
-				continue
-			}
-			// 移除已到期的成员
-			_, _ = client.ZRem(s.ctx, key, str).Result()
-			// 再次尝试发送（仍用 sendToEndpoint，内部有重试与指数退避）
-			s.sendToEndpoint(payload.Event, payload.Endpoint)
+	delivered, retryable := s.deliver(event, endpoint, event.EndpointAttempts[endpoint.Name])
+	if breaker != nil {
+		if delivered || retryable {
+			breaker.Record(delivered)
+		} else {
+			breaker.Release()
 		}
 	}
+	if delivered || !retryable {
+		return
+	}
+	s.failAttempt(event, endpoint)
 }
 
-// sendToEndpoint 向端点发送通知
-func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint NotificationEndpoint) {
-	startTime := time.Now()
-
-	// 初始化端点级计数
+// failAttempt 记一次端点级失败并安排重试
+func (s *NotificationService) failAttempt(event *NotificationEvent, endpoint NotificationEndpoint) {
 	if event.EndpointAttempts == nil {
 		event.EndpointAttempts = make(map[string]int)
 	}
-	attemptForEndpoint := event.EndpointAttempts[endpoint.Name]
+	event.EndpointAttempts[endpoint.Name]++
+	s.scheduleRetry(event, endpoint)
+}
+
+// deliver 向端点发送一次通知，返回是否成功及失败是否可重试（载荷/请求构造失败不可重试）
+func (s *NotificationService) deliver(event *NotificationEvent, endpoint NotificationEndpoint, attemptForEndpoint int) (delivered, retryable bool) {
+	startTime := time.Now()
 
 	// 构建请求载荷
 	payload := map[string]interface{}{
@@ -506,6 +528,24 @@ func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint
 		"timestamp":   event.Timestamp.Unix(),
 		"data":        event.Data,
 	}
+	if event.CorrelationID != "" {
+		payload["correlation_id"] = event.CorrelationID
+	}
+	if event.TenantID != "" {
+		payload["tenant_id"] = event.TenantID
+	}
+	if event.DeviceType != "" {
+		payload["device_type"] = event.DeviceType
+	}
+	if info, ok := asset.Lookup(event.DeviceID); ok {
+		payload["asset_code"] = info.AssetCode
+		payload["station_id"] = info.StationID
+		payload["asset_label"] = info.Label
+	}
+	if v, virtualPort, ok := virtual.LookupPort(event.DeviceID, event.PortNumber); ok {
+		payload["virtual_device_id"] = v.VirtualID
+		payload["virtual_port"] = virtualPort
+	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
@@ -517,7 +557,7 @@ func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint
 			"endpoint":   endpoint.Name,
 			"error":      err.Error(),
 		}).Error("📤 通知推送失败 - 序列化载荷失败")
-		return
+		return false, false
 	}
 
 	// 以端点超时创建请求级上下文
@@ -536,29 +576,35 @@ func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint
 			"url":        endpoint.URL,
 			"error":      err.Error(),
 		}).Error("📤 通知推送失败 - 创建HTTP请求失败")
-		return
+		return false, false
 	}
 
 	// 设置请求头
 	req.Header.Set("Content-Type", "application/json")
 	// 幂等键：使用事件ID
 	req.Header.Set("Idempotency-Key", event.EventID)
+	if event.CorrelationID != "" {
+		req.Header.Set("X-Request-ID", event.CorrelationID)
+	}
 	for key, value := range endpoint.Headers {
 		req.Header.Set(key, value)
 	}
+	// 签名头在自定义头之后设置，不可被覆盖；每次（含重试）按当前时间重新签名
+	signRequest(req.Header, endpoint.Secret, jsonData, time.Now())
 
 	// 记录请求详情
 	logger.WithFields(logrus.Fields{
-		"component":     "notification",
-		"action":        "send_request",
-		"event_id":      event.EventID,
-		"event_type":    event.EventType,
-		"endpoint":      endpoint.Name,
-		"url":           endpoint.URL,
-		"method":        "POST",
-		"payload_size":  len(jsonData),
-		"timeout":       endpoint.Timeout.String(),
-		"attempt_count": attemptForEndpoint + 1,
+		"component":      "notification",
+		"action":         "send_request",
+		"event_id":       event.EventID,
+		"correlation_id": event.CorrelationID,
+		"event_type":     event.EventType,
+		"endpoint":       endpoint.Name,
+		"url":            endpoint.URL,
+		"method":         "POST",
+		"payload_size":   len(jsonData),
+		"timeout":        endpoint.Timeout.String(),
+		"attempt_count":  attemptForEndpoint + 1,
 	}).Info("📤 发送通知推送")
 
 	// 发送请求（复用共享客户端）
@@ -567,22 +613,18 @@ func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint
 
 	if err != nil {
 		logger.WithFields(logrus.Fields{
-			"component":     "notification",
-			"action":        "send_failed",
-			"event_id":      event.EventID,
-			"event_type":    event.EventType,
-			"endpoint":      endpoint.Name,
-			"url":           endpoint.URL,
-			"response_time": responseTime.String(),
-			"attempt_count": attemptForEndpoint + 1,
-			"error":         err.Error(),
+			"component":      "notification",
+			"action":         "send_failed",
+			"event_id":       event.EventID,
+			"correlation_id": event.CorrelationID,
+			"event_type":     event.EventType,
+			"endpoint":       endpoint.Name,
+			"url":            endpoint.URL,
+			"response_time":  responseTime.String(),
+			"attempt_count":  attemptForEndpoint + 1,
+			"error":          err.Error(),
 		}).Error("📤 通知推送失败 - 网络错误")
-
-		// 端点级重试计数
-		event.EndpointAttempts[endpoint.Name] = attemptForEndpoint + 1
-		// 加入重试队列
-		s.scheduleRetry(event, endpoint)
-		return
+		return false, true
 	}
 	defer resp.Body.Close()
 
@@ -597,44 +639,43 @@ func (s *NotificationService) sendToEndpoint(event *NotificationEvent, endpoint
 	// 检查响应状态
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		logger.WithFields(logrus.Fields{
-			"component":     "notification",
-			"action":        "send_success",
-			"event_id":      event.EventID,
-			"event_type":    event.EventType,
-			"endpoint":      endpoint.Name,
-			"url":           endpoint.URL,
-			"status_code":   resp.StatusCode,
-			"response_time": responseTime.String(),
-			"response_size": len(respBody),
-			"attempt_count": attemptForEndpoint + 1,
-			"final_attempt": true,
+			"component":      "notification",
+			"action":         "send_success",
+			"event_id":       event.EventID,
+			"correlation_id": event.CorrelationID,
+			"event_type":     event.EventType,
+			"endpoint":       endpoint.Name,
+			"url":            endpoint.URL,
+			"status_code":    resp.StatusCode,
+			"response_time":  responseTime.String(),
+			"response_size":  len(respBody),
+			"attempt_count":  attemptForEndpoint + 1,
+			"final_attempt":  true,
 		}).Info("📤 通知推送成功")
 
 		// 更新成功统计
-		s.updateStats(endpoint.Name, true, responseTime)
-		return
+		s.updateStats(endpoint.Name, event.TenantID, true, responseTime)
+		s.delivered.Add(deliveredKey(event, endpoint.Name))
+		return true, false
 	}
 
 	logger.WithFields(logrus.Fields{
-		"component":     "notification",
-		"action":        "send_failed",
-		"event_id":      event.EventID,
-		"event_type":    event.EventType,
-		"endpoint":      endpoint.Name,
-		"url":           endpoint.URL,
-		"status_code":   resp.StatusCode,
-		"response_time": responseTime.String(),
-		"response_body": string(respBody),
-		"attempt_count": attemptForEndpoint + 1,
+		"component":      "notification",
+		"action":         "send_failed",
+		"event_id":       event.EventID,
+		"correlation_id": event.CorrelationID,
+		"event_type":     event.EventType,
+		"endpoint":       endpoint.Name,
+		"url":            endpoint.URL,
+		"status_code":    resp.StatusCode,
+		"response_time":  responseTime.String(),
+		"response_body":  string(respBody),
+		"attempt_count":  attemptForEndpoint + 1,
 	}).Error("📤 通知推送失败 - HTTP错误状态")
 
 	// 更新失败统计
-	s.updateStats(endpoint.Name, false, responseTime)
-
-	// 端点级重试计数
-	event.EndpointAttempts[endpoint.Name] = attemptForEndpoint + 1
-	// 加入重试队列
-	s.scheduleRetry(event, endpoint)
+	s.updateStats(endpoint.Name, event.TenantID, false, responseTime)
+	return false, true
 }
 
 // scheduleRetry 安排重试
@@ -657,10 +698,12 @@ func (s *NotificationService) scheduleRetry(event *NotificationEvent, endpoint N
 			"max_attempts":  s.config.Retry.MaxAttempts,
 		}).Error("📤 通知推送失败 - 重试次数已用尽")
 
-		// 关键事件进入死信队列（持久化）
-		if event.IsCritical || IsCriticalEvent(event.EventType) {
-			s.enqueueDeadLetter(event, endpoint, attemptForEndpoint)
+		// 启用暂存时所有事件写入磁盘暂存，等待端点恢复后按序重新投递；否则写入死信
+		if s.spool != nil {
+			s.spoolEvent(event, endpoint)
+			return
 		}
+		s.enqueueDeadLetter(event, endpoint, attemptForEndpoint)
 		return
 	}
 
@@ -679,7 +722,7 @@ func (s *NotificationService) scheduleRetry(event *NotificationEvent, endpoint N
 	}).Warn("📤 通知推送安排重试")
 
 	// 优先使用Redis持久化重试
-	if client, ok := s.redisClient.(*redisv9.Client); ok && client != nil {
+	if client, ok := s.redisClient.(*redisv9.Client); ok && client != nil && !infraredis.Degraded() {
 		// 使用ZSET，score为到期时间戳
 		key := "notify:retry:" + endpoint.Name
 		readyAt := time.Now().Add(delay).Unix()
@@ -687,11 +730,7 @@ func (s *NotificationService) scheduleRetry(event *NotificationEvent, endpoint N
 		b, err := json.Marshal(payload)
 		if err == nil {
 			if err := client.ZAdd(s.ctx, key, redisv9.Z{Score: float64(readyAt), Member: string(b)}).Err(); err == nil {
-				// 记录一次重试统计
-				s.statsMu.Lock()
-				s.stats.TotalRetried++
-				s.stats.LastUpdateTime = time.Now()
-				s.statsMu.Unlock()
+				s.recordRetry(endpoint.Name)
 				return
 			}
 		}
@@ -704,10 +743,7 @@ func (s *NotificationService) scheduleRetry(event *NotificationEvent, endpoint N
 			select {
 			case s.retryQueue <- retryPayload{Event: event, Endpoint: endpoint}:
 				// 重试队列加入成功 → 统计一次重试
-				s.statsMu.Lock()
-				s.stats.TotalRetried++
-				s.stats.LastUpdateTime = time.Now()
-				s.statsMu.Unlock()
+				s.recordRetry(endpoint.Name)
 			default:
 				logger.WithFields(logrus.Fields{
 					"component":  "notification",
@@ -715,7 +751,8 @@ func (s *NotificationService) scheduleRetry(event *NotificationEvent, endpoint N
 					"event_id":   event.EventID,
 					"event_type": event.EventType,
 					"endpoint":   endpoint.Name,
-				}).Error("📤 通知推送失败 - 重试队列已满，丢弃事件")
+				}).Error("📤 通知推送失败 - 重试队列已满，转入死信")
+				s.enqueueDeadLetter(event, endpoint, event.EndpointAttempts[endpoint.Name])
 			}
 		case <-s.ctx.Done():
 			return
@@ -723,6 +760,17 @@ func (s *NotificationService) scheduleRetry(event *NotificationEvent, endpoint N
 	}()
 }
 
+// recordRetry 记一次已安排的重试（全局与端点）
+func (s *NotificationService) recordRetry(endpointName string) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.stats.TotalRetried++
+	if es, exists := s.stats.EndpointStats[endpointName]; exists {
+		es.TotalRetried++
+	}
+	s.stats.LastUpdateTime = time.Now()
+}
+
 // calculateRetryDelay 计算重试延迟
 func (s *NotificationService) calculateRetryDelay(attemptCount int) time.Duration {
 	delay := s.config.Retry.InitialInterval
@@ -737,7 +785,7 @@ func (s *NotificationService) calculateRetryDelay(attemptCount int) time.Duratio
 }
 
 // updateStats 更新统计信息
-func (s *NotificationService) updateStats(endpointName string, success bool, responseTime time.Duration) {
+func (s *NotificationService) updateStats(endpointName, tenantID string, success bool, responseTime time.Duration) {
 	s.statsMu.Lock()
 	defer s.statsMu.Unlock()
 
@@ -746,8 +794,10 @@ func (s *NotificationService) updateStats(endpointName string, success bool, res
 
 	// 更新全局统计
 	s.stats.TotalSent++
+	s.recentSent.AddAt(now, 1)
 	if success {
 		s.stats.TotalSuccess++
+		s.recentSuccess.AddAt(now, 1)
 	} else {
 		s.stats.TotalFailed++
 	}
@@ -781,6 +831,22 @@ func (s *NotificationService) updateStats(endpointName string, success bool, res
 		}
 	}
 
+	// 更新租户统计
+	if tenantID == "" {
+		tenantID = UntaggedTenant
+	}
+	tenantStats, exists := s.stats.TenantStats[tenantID]
+	if !exists {
+		tenantStats = &TenantDeliveryStats{TenantID: tenantID}
+		s.stats.TenantStats[tenantID] = tenantStats
+	}
+	if success {
+		tenantStats.Delivered++
+	} else {
+		tenantStats.Failed++
+	}
+	tenantStats.SuccessRate = float64(tenantStats.Delivered) / float64(tenantStats.Delivered+tenantStats.Failed) * 100
+
 	// 更新全局平均响应时间
 	if s.stats.AvgResponseTime == 0 {
 		s.stats.AvgResponseTime = responseTime
@@ -793,7 +859,7 @@ func (s *NotificationService) updateStats(endpointName string, success bool, res
 func (s *NotificationService) loadRetryEvents() {
 	// 从Redis加载到期重试事件
 	client, ok := s.redisClient.(*redisv9.Client)
-	if !ok || client == nil {
+	if !ok || client == nil || infraredis.Degraded() {
 		return
 	}
 
@@ -822,13 +888,8 @@ func (s *NotificationService) loadRetryEvents() {
 			}
 			// 精确删除当前成员
 			_, _ = client.ZRem(s.ctx, key, str).Result()
-			// 直接针对端点发送
-			s.sendToEndpoint(payload.Event, payload.Endpoint)
-			// 计为一次重试实际执行
-			s.statsMu.Lock()
-			s.stats.TotalRetried++
-			s.stats.LastUpdateTime = time.Now()
-			s.statsMu.Unlock()
+			// 直接针对端点发送（重试次数已在安排时计入）
+			s.dispatch(payload.Event, payload.Endpoint)
 		}
 	}
 }
@@ -837,7 +898,35 @@ func (s *NotificationService) loadRetryEvents() {
 func (s *NotificationService) GetStats() NotificationStats {
 	s.statsMu.RLock()
 	defer s.statsMu.RUnlock()
-	return *s.stats
+	stats := *s.stats
+	stats.EndpointStats = make(map[string]*EndpointStats, len(s.stats.EndpointStats))
+	for name, es := range s.stats.EndpointStats {
+		copied := *es
+		stats.EndpointStats[name] = &copied
+	}
+	stats.TenantStats = make(map[string]*TenantDeliveryStats, len(s.stats.TenantStats))
+	for tenant, ts := range s.stats.TenantStats {
+		copied := *ts
+		stats.TenantStats[tenant] = &copied
+	}
+	s.fillEndpointRuntimeStats(stats.EndpointStats)
+	if usage, ok := s.SpoolUsage(); ok {
+		stats.Spool = &usage
+	}
+	if s.fanOutLimiter != nil {
+		fanOut := s.fanOutLimiter.Snapshot(time.Now())
+		stats.FanOut = &fanOut
+	}
+	return stats
+}
+
+// GetRecentDeliveryStats 获取近1小时投递次数、成功次数与成功率（百分比，无投递时为100）
+func (s *NotificationService) GetRecentDeliveryStats(now time.Time) (sent, success int64, rate float64) {
+	sent, success = s.recentSent.Sum(now), s.recentSuccess.Sum(now)
+	if sent == 0 {
+		return 0, 0, 100
+	}
+	return sent, success, float64(success) / float64(sent) * 100
 }
 
 // GetQueueLength 获取队列长度
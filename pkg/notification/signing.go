@@ -0,0 +1,48 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// webhook 签名请求头（端点配置了 secret 时携带）
+const (
+	HeaderSignature = "X-IoT-Signature"
+	HeaderTimestamp = "X-IoT-Timestamp"
+)
+
+// SignPayload webhook 签名：HMAC-SHA256(secret, "<timestamp>.<body>") 的十六进制摘要；
+// 时间戳参与签名，接收方按时间窗口拒绝过期请求以防重放
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature 接收方校验签名：时间戳与 now 相差超过 tolerance 视为重放，摘要按常量时间比较
+func VerifySignature(secret string, timestamp int64, body []byte, signature string, now time.Time, tolerance time.Duration) bool {
+	skew := now.Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tolerance {
+		return false
+	}
+	expected := SignPayload(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// signRequest 为端点请求附加签名头；未配置 secret 的端点不签名
+func signRequest(header interface{ Set(key, value string) }, secret string, body []byte, now time.Time) {
+	if secret == "" {
+		return
+	}
+	timestamp := now.Unix()
+	header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(HeaderSignature, SignPayload(secret, timestamp, body))
+}
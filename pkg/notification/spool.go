@@ -0,0 +1,588 @@
+package notification
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	spoolFilePrefix = "spool-"
+	spoolFileSuffix = ".jsonl"
+
+	defaultSpoolDir            = "./data/notification_spool"
+	defaultSpoolMaxBytes       = 64 << 20
+	defaultSpoolSegmentBytes   = 4 << 20
+	minSpoolSegmentBytes       = 4 << 10
+	defaultSpoolMaxAge         = 24 * time.Hour
+	defaultSpoolReplayInterval = time.Minute
+)
+
+// SpoolConfig 投递失败事件的磁盘暂存配置：常规重试用尽后写入暂存目录，启动时及定时按序重新投递
+type SpoolConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Dir             string        `yaml:"dir"`               // 暂存目录
+	MaxBytes        int64         `yaml:"max_bytes"`         // 暂存总大小上限，超过时丢弃最旧的日志段
+	SegmentMaxBytes int64         `yaml:"segment_max_bytes"` // 单个日志段上限，超过后轮转
+	MaxAge          time.Duration `yaml:"max_age"`           // 事件超过该时长仍未投递成功则放弃
+	ReplayInterval  time.Duration `yaml:"replay_interval"`   // 定时重新投递间隔
+	WarnBytes       int64         `yaml:"warn_bytes"`        // 暂存大小超过该值时就绪检查告警（不影响就绪）
+}
+
+// SpoolEntry 暂存的单端点投递
+type SpoolEntry struct {
+	Event     *NotificationEvent `json:"event"`
+	Endpoint  string             `json:"endpoint"`
+	SpooledAt time.Time          `json:"spooled_at"`
+}
+
+// SpoolStats 暂存用量与重新投递统计
+type SpoolStats struct {
+	Bytes            int64 `json:"bytes"`              // 当前占用字节数
+	Events           int   `json:"events"`             // 当前暂存事件数
+	Segments         int   `json:"segments"`           // 日志段数
+	OldestAgeSeconds int64 `json:"oldest_age_seconds"` // 最旧暂存事件的等待时长(秒)
+	MaxBytes         int64 `json:"max_bytes"`
+	WarnBytes        int64 `json:"warn_bytes"`
+
+	Spooled     int64 `json:"spooled"`     // 累计写入
+	Redelivered int64 `json:"redelivered"` // 累计重新投递成功
+	Duplicates  int64 `json:"duplicates"`  // 已经实时投递成功而跳过的暂存事件
+	Expired     int64 `json:"expired"`     // 超过最大时长放弃
+	Orphaned    int64 `json:"orphaned"`    // 端点已删除或停用而放弃
+	Dropped     int64 `json:"dropped"`     // 达到容量上限时随最旧日志段丢弃
+}
+
+// SpoolReplayResult 一轮重新投递的结果
+type SpoolReplayResult struct {
+	Delivered  int `json:"delivered"`
+	Duplicates int `json:"duplicates"`
+	Expired    int `json:"expired"`
+	Orphaned   int `json:"orphaned"`
+	Remaining  int `json:"remaining"`
+}
+
+type spoolSegment struct {
+	seq    uint64
+	path   string
+	bytes  int64
+	count  int
+	oldest time.Time
+}
+
+// Spool 投递失败事件的磁盘暂存（按序追加的JSONL日志段，容量超限时丢弃最旧段）
+type Spool struct {
+	dir             string
+	maxBytes        int64
+	segmentMaxBytes int64
+
+	mu       sync.Mutex
+	segments []*spoolSegment // 按写入顺序
+	active   *spoolSegment   // 当前追加的日志段，重新投递开始时封存
+	nextSeq  uint64
+	stats    SpoolStats
+
+	replayMu sync.Mutex
+	now      func() time.Time
+}
+
+// OpenSpool 打开（或创建）暂存目录并加载已有日志段
+func OpenSpool(dir string, maxBytes, segmentMaxBytes int64) (*Spool, error) {
+	if dir == "" {
+		dir = defaultSpoolDir
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	if segmentMaxBytes <= 0 {
+		segmentMaxBytes = defaultSpoolSegmentBytes
+	}
+	// 至少保留两个日志段，容量超限时才有可丢弃的旧段
+	if segmentMaxBytes > maxBytes/2 {
+		segmentMaxBytes = maxBytes / 2
+	}
+	if segmentMaxBytes < minSpoolSegmentBytes {
+		segmentMaxBytes = minSpoolSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建通知暂存目录失败: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, segmentMaxBytes: segmentMaxBytes, nextSeq: 1, now: time.Now}
+	files, err := filepath.Glob(filepath.Join(dir, spoolFilePrefix+"*"+spoolFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), spoolFilePrefix), spoolFileSuffix)
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		entries, size, err := readSpoolSegment(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			_ = os.Remove(path)
+			continue
+		}
+		s.segments = append(s.segments, &spoolSegment{seq: seq, path: path, bytes: size, count: len(entries), oldest: entries[0].SpooledAt})
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return s, nil
+}
+
+// Append 追加一条暂存，超过容量上限时丢弃最旧的日志段
+func (s *Spool) Append(entry SpoolEntry) error {
+	if entry.SpooledAt.IsZero() {
+		entry.SpooledAt = s.now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil || (s.active.count > 0 && s.active.bytes+int64(len(line)) > s.segmentMaxBytes) {
+		s.active = &spoolSegment{seq: s.nextSeq, path: s.segmentPath(s.nextSeq)}
+		s.nextSeq++
+		s.segments = append(s.segments, s.active)
+	}
+	f, err := os.OpenFile(s.active.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("写入通知暂存失败: %w", err)
+	}
+	_, err = f.Write(line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入通知暂存失败: %w", err)
+	}
+	if s.active.count == 0 {
+		s.active.oldest = entry.SpooledAt
+	}
+	s.active.bytes += int64(len(line))
+	s.active.count++
+	s.stats.Spooled++
+
+	for s.totalBytesLocked() > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		_ = os.Remove(oldest.path)
+		s.stats.Dropped += int64(oldest.count)
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// Stats 当前用量快照
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.MaxBytes = s.maxBytes
+	stats.Segments = len(s.segments)
+	var oldest time.Time
+	for _, seg := range s.segments {
+		stats.Bytes += seg.bytes
+		stats.Events += seg.count
+		if seg.count > 0 && (oldest.IsZero() || seg.oldest.Before(oldest)) {
+			oldest = seg.oldest
+		}
+	}
+	if !oldest.IsZero() {
+		stats.OldestAgeSeconds = int64(s.now().Sub(oldest).Seconds())
+	}
+	return stats
+}
+
+// Entries 全部暂存条目（按写入顺序）
+func (s *Spool) Entries() ([]SpoolEntry, error) {
+	s.mu.Lock()
+	segments := append([]*spoolSegment(nil), s.segments...)
+	s.mu.Unlock()
+
+	var all []SpoolEntry
+	for _, seg := range segments {
+		entries, _, err := readSpoolSegment(seg.path)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// spoolDecision 重新投递时对单条暂存的处理结果
+type spoolDecision int
+
+const (
+	spoolKeep      spoolDecision = iota // 投递失败或端点已阻塞，保留待下一轮
+	spoolDelivered                      // 投递成功
+	spoolDuplicate                      // 已实时投递成功
+	spoolExpired                        // 超过最大时长
+	spoolOrphaned                       // 端点不存在
+)
+
+// replay 按写入顺序处理已封存的日志段：handle 返回保留的条目写回原日志段，全部处理完的日志段删除
+func (s *Spool) replay(handle func(entry SpoolEntry) spoolDecision) (SpoolReplayResult, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	// 封存当前追加段：本轮处理期间的新暂存写入新日志段
+	s.mu.Lock()
+	s.active = nil
+	batch := append([]*spoolSegment(nil), s.segments...)
+	s.mu.Unlock()
+
+	var result SpoolReplayResult
+	for _, seg := range batch {
+		entries, _, err := readSpoolSegment(seg.path)
+		if err != nil {
+			return result, err
+		}
+		var kept []SpoolEntry
+		for _, entry := range entries {
+			switch handle(entry) {
+			case spoolDelivered:
+				result.Delivered++
+			case spoolDuplicate:
+				result.Duplicates++
+			case spoolExpired:
+				result.Expired++
+			case spoolOrphaned:
+				result.Orphaned++
+			default:
+				kept = append(kept, entry)
+			}
+		}
+		result.Remaining += len(kept)
+		if err := s.rewriteSegment(seg, kept); err != nil {
+			return result, err
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.Redelivered += int64(result.Delivered)
+	s.stats.Duplicates += int64(result.Duplicates)
+	s.stats.Expired += int64(result.Expired)
+	s.stats.Orphaned += int64(result.Orphaned)
+	s.mu.Unlock()
+	return result, nil
+}
+
+// rewriteSegment 以保留的条目替换日志段（先写临时文件再重命名），无保留条目时删除
+func (s *Spool) rewriteSegment(seg *spoolSegment, kept []SpoolEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i, current := range s.segments {
+		if current == seg {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil // 处理期间已因容量上限被丢弃
+	}
+	if len(kept) == 0 {
+		_ = os.Remove(seg.path)
+		s.segments = append(s.segments[:index], s.segments[index+1:]...)
+		return nil
+	}
+	if len(kept) == seg.count {
+		return nil
+	}
+
+	var buf []byte
+	for _, entry := range kept {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	tmp := seg.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return fmt.Errorf("重写通知暂存失败: %w", err)
+	}
+	if err := os.Rename(tmp, seg.path); err != nil {
+		return fmt.Errorf("重写通知暂存失败: %w", err)
+	}
+	seg.bytes = int64(len(buf))
+	seg.count = len(kept)
+	seg.oldest = kept[0].SpooledAt
+	return nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%016d%s", spoolFilePrefix, seq, spoolFileSuffix))
+}
+
+func (s *Spool) totalBytesLocked() int64 {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.bytes
+	}
+	return total
+}
+
+// readSpoolSegment 读取日志段，跳过无法解析的行（崩溃时写了一半的末行）
+func readSpoolSegment(path string) ([]SpoolEntry, int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取通知暂存失败: %w", err)
+	}
+	defer f.Close()
+
+	var entries []SpoolEntry
+	var size int64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		size += int64(len(line)) + 1
+		var entry SpoolEntry
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Event == nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("读取通知暂存失败: %w", err)
+	}
+	return entries, size, nil
+}
+
+// ===============================
+// 通知服务：暂存写入与重新投递
+// ===============================
+
+// deliveredCacheSize 记录已投递成功的 事件ID|端点 数量上限
+const deliveredCacheSize = 20000
+
+func deliveredKey(event *NotificationEvent, endpoint string) string {
+	return event.EventID + "|" + endpoint
+}
+
+// spoolEvent 重试用尽的事件写入暂存
+func (s *NotificationService) spoolEvent(event *NotificationEvent, endpoint NotificationEndpoint) {
+	err := s.spool.Append(SpoolEntry{Event: event, Endpoint: endpoint.Name})
+	fields := logrus.Fields{
+		"component":  "notification",
+		"action":     "spool",
+		"event_id":   event.EventID,
+		"event_type": event.EventType,
+		"endpoint":   endpoint.Name,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Error("📤 写入通知暂存失败，转入死信")
+		s.enqueueDeadLetter(event, endpoint, event.EndpointAttempts[endpoint.Name])
+		return
+	}
+	logger.WithFields(fields).Warn("📤 事件已写入暂存，等待端点恢复后重新投递")
+}
+
+// spoolWorker 启动时及定时重新投递暂存事件
+func (s *NotificationService) spoolWorker() {
+	defer s.wg.Done()
+
+	interval := s.config.Spool.ReplayInterval
+	if interval <= 0 {
+		interval = defaultSpoolReplayInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// 停机积压暂缓重放期间不自动重新投递，批准后由积压重放按速率投递
+		if !replay.GetGlobalCoordinator().Held(replay.CategoryNotificationSpool) {
+			if _, err := s.ReplaySpool(); err != nil {
+				logger.WithFields(logrus.Fields{"component": "notification", "error": err.Error()}).Error("📤 通知暂存重新投递失败")
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// ReplaySpool 按暂存顺序重新投递一轮：端点投递失败后本轮不再投递该端点的后续事件（保持顺序），
+// 按端点速率上限控制投递节奏；超过最大时长、端点已不存在或已实时投递成功的事件直接移除
+func (s *NotificationService) ReplaySpool() (SpoolReplayResult, error) {
+	return s.replaySpool(nil)
+}
+
+// replaySpool 重新投递一轮；ctl 非nil时每次投递前按积压重放节奏等待并记录结果
+func (s *NotificationService) replaySpool(ctl *replay.Control) (SpoolReplayResult, error) {
+	if s.spool == nil || s.ctx == nil {
+		return SpoolReplayResult{}, nil
+	}
+	maxAge := s.config.Spool.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultSpoolMaxAge
+	}
+	endpoints := make(map[string]NotificationEndpoint, len(s.config.Endpoints))
+	for _, ep := range s.config.Endpoints {
+		if ep.Enabled {
+			endpoints[ep.Name] = ep
+		}
+	}
+	blocked := make(map[string]bool)
+	nextAt := make(map[string]time.Time)
+
+	result, err := s.spool.replay(func(entry SpoolEntry) spoolDecision {
+		born := entry.Event.Timestamp
+		if born.IsZero() {
+			born = entry.SpooledAt
+		}
+		if time.Since(born) > maxAge {
+			ctl.Record(replay.OutcomeSkipped)
+			return spoolExpired
+		}
+		endpoint, ok := endpoints[entry.Endpoint]
+		if !ok {
+			ctl.Record(replay.OutcomeSkipped)
+			return spoolOrphaned
+		}
+		key := deliveredKey(entry.Event, entry.Endpoint)
+		if s.delivered.Contains(key) {
+			ctl.Record(replay.OutcomeSkipped)
+			return spoolDuplicate
+		}
+		if blocked[entry.Endpoint] || s.ctx.Err() != nil || !ctl.Wait() {
+			ctl.Record(replay.OutcomeFailed)
+			return spoolKeep
+		}
+		if endpoint.RateLimitPerSecond > 0 {
+			if wait := time.Until(nextAt[entry.Endpoint]); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-s.ctx.Done():
+					return spoolKeep
+				}
+			}
+			nextAt[entry.Endpoint] = time.Now().Add(time.Second / time.Duration(endpoint.RateLimitPerSecond))
+		}
+		// 端点熔断中时本轮跳过该端点，等待冷却后的探测请求确认恢复
+		breaker := s.breakerFor(entry.Endpoint)
+		if breaker != nil && !breaker.Allow() {
+			blocked[entry.Endpoint] = true
+			ctl.Record(replay.OutcomeFailed)
+			return spoolKeep
+		}
+		delivered, retryable := s.deliver(entry.Event, endpoint, entry.Event.EndpointAttempts[entry.Endpoint])
+		if breaker != nil {
+			if delivered || retryable {
+				breaker.Record(delivered)
+			} else {
+				breaker.Release()
+			}
+		}
+		if delivered {
+			ctl.Record(replay.OutcomeReplayed)
+			return spoolDelivered
+		}
+		blocked[entry.Endpoint] = true
+		ctl.Record(replay.OutcomeFailed)
+		return spoolKeep
+	})
+
+	if result.Delivered > 0 || result.Expired > 0 || result.Orphaned > 0 {
+		logger.WithFields(logrus.Fields{
+			"component":  "notification",
+			"action":     "spool_replay",
+			"delivered":  result.Delivered,
+			"duplicates": result.Duplicates,
+			"expired":    result.Expired,
+			"orphaned":   result.Orphaned,
+			"remaining":  result.Remaining,
+		}).Info("📤 通知暂存重新投递完成")
+	}
+	return result, err
+}
+
+// SpoolReplaySource 停机积压重放：批准后按暂存顺序、积压重放速率重新投递一轮（未启用暂存时返回nil），
+// 仍失败的事件保留，由定时重新投递继续处理
+func (s *NotificationService) SpoolReplaySource() replay.Source {
+	if s.spool == nil {
+		return nil
+	}
+	return spoolReplaySource{s: s}
+}
+
+type spoolReplaySource struct {
+	s *NotificationService
+}
+
+func (r spoolReplaySource) Items() []replay.Item {
+	entries, err := r.s.spool.Entries()
+	if err != nil {
+		logger.WithFields(logrus.Fields{"component": "notification", "error": err.Error()}).Warn("读取通知暂存失败")
+	}
+	items := make([]replay.Item, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, replay.Item{ID: deliveredKey(entry.Event, entry.Endpoint), At: entry.SpooledAt, Outbound: 1})
+	}
+	return items
+}
+
+func (r spoolReplaySource) Run(ctl *replay.Control) error {
+	_, err := r.s.replaySpool(ctl)
+	if err == nil && ctl.Stopped() {
+		err = replay.ErrStopped
+	}
+	return err
+}
+
+// SpoolUsage 暂存用量（未启用暂存时返回false）
+func (s *NotificationService) SpoolUsage() (SpoolStats, bool) {
+	if s.spool == nil {
+		return SpoolStats{}, false
+	}
+	stats := s.spool.Stats()
+	stats.WarnBytes = s.spoolWarnBytes()
+	return stats, true
+}
+
+// SpoolWarning 暂存超过告警阈值时返回告警描述，否则返回空
+func (s *NotificationService) SpoolWarning() string {
+	usage, ok := s.SpoolUsage()
+	if !ok || usage.Bytes <= usage.WarnBytes {
+		return ""
+	}
+	return fmt.Sprintf("通知暂存 %d 字节（%d 条，最旧 %d 秒）超过告警阈值 %d 字节", usage.Bytes, usage.Events, usage.OldestAgeSeconds, usage.WarnBytes)
+}
+
+// spoolWarnBytes 告警阈值，未配置时为容量上限的80%
+func (s *NotificationService) spoolWarnBytes() int64 {
+	if s.config.Spool.WarnBytes > 0 {
+		return s.config.Spool.WarnBytes
+	}
+	return s.spool.maxBytes * 8 / 10
+}
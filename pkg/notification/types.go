@@ -15,7 +15,22 @@ type NotificationEvent struct {
 	Data             map[string]interface{} `json:"data"`                        // 事件数据
 	AttemptCount     int                    `json:"attempt_count"`               // 重试次数
 	EndpointAttempts map[string]int         `json:"endpoint_attempts,omitempty"` // 每端点重试次数
-	IsCritical       bool                   `json:"is_critical,omitempty"`       // 是否为关键事件（进入DLQ持久化）
+	IsCritical       bool                   `json:"is_critical,omitempty"`       // 是否为关键事件（出站限流优先分发）
+	CorrelationID    string                 `json:"correlation_id,omitempty"`    // 链路追踪ID（对应触发该事件的HTTP请求）
+
+	// 路由标签（入队时按资产映射与设备信息补全）
+	TenantID   string `json:"tenant_id,omitempty"`   // 租户（运营商）
+	DeviceType string `json:"device_type,omitempty"` // 设备类型码（十进制）
+}
+
+// cloneForEndpoint 为单个端点复制事件（端点重试计数独立，事件数据只读共享）
+func (e *NotificationEvent) cloneForEndpoint() *NotificationEvent {
+	clone := *e
+	clone.EndpointAttempts = make(map[string]int, len(e.EndpointAttempts))
+	for name, attempts := range e.EndpointAttempts {
+		clone.EndpointAttempts[name] = attempts
+	}
+	return &clone
 }
 
 // NotificationConfig 通知配置
@@ -27,6 +42,12 @@ type NotificationConfig struct {
 	Retry     RetryConfig              `yaml:"retry"`      // 重试配置
 	Sampling  map[string]int           `yaml:"sampling"`   // 事件采样率: 1=全量, N=每N条取1条
 	Throttle  map[string]time.Duration `yaml:"throttle"`   // 端点节流: 事件类型→时间间隔
+	Spool     SpoolConfig              `yaml:"spool"`      // 重试用尽事件的磁盘暂存
+	FanOut    FanOutConfig             `yaml:"fan_out"`    // 全局出站限流
+
+	DeadLetter DeadLetterConfig `yaml:"dead_letter"` // 重试用尽的关键事件的死信落地（未启用暂存时）
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"` // 端点熔断
 }
 
 // NotificationEndpoint 通知端点
@@ -36,8 +57,18 @@ type NotificationEndpoint struct {
 	URL        string            `yaml:"url"`         // 端点URL
 	Headers    map[string]string `yaml:"headers"`     // 请求头
 	Timeout    time.Duration     `yaml:"timeout"`     // 超时时间
-	EventTypes []string          `yaml:"event_types"` // 订阅的事件类型
+	EventTypes []string          `yaml:"event_types"` // 订阅的事件类型（"*" 表示全部）
 	Enabled    bool              `yaml:"enabled"`     // 是否启用
+
+	Tenants     []string `yaml:"tenants"`      // 租户选择器，为空不限
+	DeviceTypes []string `yaml:"device_types"` // 设备类型选择器，为空不限
+
+	RateLimitPerSecond int `yaml:"rate_limit_per_second"` // 暂存重放的投递速率上限，0不限
+
+	Secret string `yaml:"secret" json:"-"` // webhook 签名密钥，非空时请求携带 X-IoT-Signature/X-IoT-Timestamp
+
+	Concurrency int `yaml:"concurrency"` // 端点投递并发数（独立工作协程池）
+	QueueSize   int `yaml:"queue_size"`  // 端点投递队列大小
 }
 
 // RetryConfig 重试配置
@@ -59,9 +90,26 @@ type NotificationStats struct {
 	LastUpdateTime  time.Time                 `json:"last_update_time"`  // 最后更新时间
 	EndpointStats   map[string]*EndpointStats `json:"endpoint_stats"`    // 端点统计
 
+	TotalDeadLettered int64 `json:"total_dead_lettered"` // 重试用尽写入死信的事件数
+
 	// 丢弃统计
 	DroppedBySampling int64 `json:"dropped_by_sampling"` // 采样丢弃总数
 	DroppedByThrottle int64 `json:"dropped_by_throttle"` // 节流丢弃总数
+
+	Unrouted    int64                           `json:"unrouted"`     // 未匹配任何端点的事件数
+	TenantStats map[string]*TenantDeliveryStats `json:"tenant_stats"` // 按租户的投递统计（SLA报表）
+
+	SuppressedDuplicates int64        `json:"suppressed_duplicates"` // 已投递成功而跳过的重复投递
+	Spool                *SpoolStats  `json:"spool,omitempty"`       // 磁盘暂存用量（未启用时为空）
+	FanOut               *FanOutStats `json:"fan_out,omitempty"`     // 全局出站限流（未启用时为空）
+}
+
+// TenantDeliveryStats 租户投递统计（按端点投递次数计）
+type TenantDeliveryStats struct {
+	TenantID    string  `json:"tenant_id"`
+	Delivered   int64   `json:"delivered"`    // 投递成功次数
+	Failed      int64   `json:"failed"`       // 投递失败次数
+	SuccessRate float64 `json:"success_rate"` // 成功率
 }
 
 // EndpointStats 端点统计
@@ -71,10 +119,19 @@ type EndpointStats struct {
 	TotalSuccess    int64         `json:"total_success"`     // 总成功数
 	TotalFailed     int64         `json:"total_failed"`      // 总失败数
 	TotalRetried    int64         `json:"total_retried"`     // 总重试数
+	DeadLettered    int64         `json:"dead_lettered"`     // 重试用尽写入死信数
 	SuccessRate     float64       `json:"success_rate"`      // 成功率
 	AvgResponseTime time.Duration `json:"avg_response_time"` // 平均响应时间
 	LastSuccess     time.Time     `json:"last_success"`      // 最后成功时间
 	LastFailure     time.Time     `json:"last_failure"`      // 最后失败时间
+
+	// 熔断与投递队列
+	CircuitState        string     `json:"circuit_state"`               // closed/open/half_open
+	CircuitOpenedAt     *time.Time `json:"circuit_opened_at,omitempty"` // 本次熔断开始时间
+	ConsecutiveFailures int        `json:"consecutive_failures"`        // 连续失败次数
+	ShortCircuited      int64      `json:"short_circuited"`             // 熔断期间快速失败的投递数
+	QueueDropped        int64      `json:"queue_dropped"`               // 端点队列满转入重试的事件数
+	QueueLength         int        `json:"queue_length"`                // 端点队列当前长度
 }
 
 // 事件类型常量
@@ -85,14 +142,32 @@ const (
 	EventTypeDeviceError     = "device_error"     // 设备错误
 	EventTypeDeviceHeartbeat = "device_heartbeat" // 设备心跳
 	EventTypeDeviceRegister  = "device_register"  // 设备注册
+	EventTypeICCIDConflict   = "iccid_conflict"   // ICCID冲突（高危：疑似SIM克隆）
+	EventTypeSIMFailover     = "sim_failover"     // 双卡设备SIM卡切换
+
+	EventTypeDeviceRebootIssued    = "device_reboot_issued"    // 远程重启已下发
+	EventTypeDeviceRebootCompleted = "device_reboot_completed" // 远程重启完成（设备已重新注册）
+	EventTypeDeviceRebootFailed    = "device_reboot_failed"    // 远程重启失败（超时未重新注册）
+
+	EventTypeDeviceDecommissioned       = "device_decommissioned"        // 设备已停用（归档并加入注册黑名单）
+	EventTypeDeviceRecommissioned       = "device_recommissioned"        // 设备已重新启用（解除注册黑名单）
+	EventTypeDeviceRegistrationRejected = "device_registration_rejected" // 已停用设备尝试注册被拒绝（高危）
+
+	EventTypeDeviceAnomaly = "device_anomaly" // 心跳数据异常（温度/电压/信号/功率持续偏离基线或单调变化，疑似硬件故障前兆）
+
+	EventTypeCommandFailed = "command_failed" // 下发命令重发耗尽仍未得到设备应答（开始充电命令的订单已置为失败）
 
 	// 充电事件
-	EventTypeChargingStart  = "charging_start"  // 充电开始
-	EventTypeChargingEnd    = "charging_end"    // 充电结束
-	EventTypeChargingFailed = "charging_failed" // 充电失败
-	EventTypeSettlement     = "settlement"      // 结算
-	EventTypePowerHeartbeat = "power_heartbeat" // 功率心跳
-	EventTypeChargingPower  = "charging_power"  // 充电功率实时数据
+	EventTypeChargingStart      = "charging_start"      // 充电开始
+	EventTypeChargingEnd        = "charging_end"        // 充电结束
+	EventTypeChargingFailed     = "charging_failed"     // 充电失败
+	EventTypeSettlement         = "settlement"          // 结算
+	EventTypeSettlementEnriched = "settlement_enriched" // 富化结算（结算+会话+设备上下文+计量对比）
+	EventTypePowerHeartbeat     = "power_heartbeat"     // 功率心跳
+	EventTypeChargingPower      = "charging_power"      // 充电功率实时数据
+
+	EventTypeChargeQueued       = "charge_queued"        // 充电请求设备侧排队（端口繁忙）
+	EventTypeChargeQueueTimeout = "charge_queue_timeout" // 排队超时仍未开始充电
 
 	// 端口状态事件
 	EventTypePortStatusChange = "port_status_change" // 端口状态变化
@@ -101,6 +176,16 @@ const (
 	EventTypePortOffline      = "port_offline"       // 端口离线
 	EventTypePortHeartbeat    = "port_heartbeat"     // 端口心跳状态
 
+	// 系统事件
+	EventTypeFrameJournalDegraded = "frame_journal_degraded" // 关键帧预写日志降级为处理后应答（高危：崩溃时可能丢失结算）
+	EventTypeReconciliationReport = "reconciliation_report"  // 日终对账报告（会话与结算按订单号匹配）
+	EventTypeRedisDegraded        = "redis_degraded"         // Redis运行中不可达，各功能进入降级运行（幂等仅本实例有效、持久化暂存本地、集群归属按单实例）
+	EventTypeRedisRecovered       = "redis_recovered"        // Redis恢复，暂存写入已回放
+	EventTypeFleetOnlineDrop      = "fleet_online_drop"      // 全网在线设备数告警（低于下限或窗口内快速下降，附离线ICCID与故障范围）
+	EventTypeFleetOnlineRecovered = "fleet_online_recovered" // 全网在线设备数告警恢复
+	EventTypeTenantSLABreached    = "tenant_sla_breached"    // 租户24h命令成功率低于SLA告警阈值（附占比最高的失败分类）
+	EventTypeTenantSLARecovered   = "tenant_sla_recovered"   // 租户命令成功率SLA告警恢复
+
 	// 状态事件 (废弃，使用更具体的端口状态事件)
 	EventTypeStatusChange = "status_change" // 状态变化
 )
@@ -112,13 +197,28 @@ func IsCriticalEvent(eventType string) bool {
 		EventTypeChargingEnd,
 		EventTypeChargingFailed,
 		EventTypeSettlement,
-		EventTypeDeviceOffline:
+		EventTypeSettlementEnriched,
+		EventTypeDeviceOffline,
+		EventTypeICCIDConflict,
+		EventTypeChargeQueueTimeout,
+		EventTypeDeviceRebootFailed,
+		EventTypeCommandFailed,
+		EventTypeDeviceRegistrationRejected,
+		EventTypeFrameJournalDegraded,
+		EventTypeRedisDegraded,
+		EventTypeFleetOnlineDrop,
+		EventTypeTenantSLABreached:
 		return true
 	default:
 		return false
 	}
 }
 
+// 事件严重级别
+const (
+	SeverityHigh = "high" // 高危，需要人工介入
+)
+
 // 端点类型常量
 const (
 	EndpointTypeBilling   = "billing"   // 计费系统
@@ -272,6 +372,56 @@ func (c *NotificationConfig) Validate() error {
 	if c.Retry.Multiplier <= 0 {
 		c.Retry.Multiplier = 2.0
 	}
+	if c.DeadLetter.RedisKey == "" {
+		c.DeadLetter.RedisKey = defaultDeadLetterRedisKey
+	}
+	if c.DeadLetter.MaxEntries <= 0 {
+		c.DeadLetter.MaxEntries = defaultDeadLetterMaxEntries
+	}
+	for i := range c.Endpoints {
+		if c.Endpoints[i].Concurrency <= 0 {
+			c.Endpoints[i].Concurrency = defaultEndpointConcurrency
+		}
+		if c.Endpoints[i].QueueSize <= 0 {
+			c.Endpoints[i].QueueSize = defaultEndpointQueueSize
+		}
+	}
+	if fo := &c.FanOut; fo.Enabled {
+		if fo.RatePerSecond <= 0 {
+			fo.RatePerSecond = defaultFanOutRatePerSecond
+		}
+		if fo.Burst <= 0 {
+			fo.Burst = int(fo.RatePerSecond)
+			if fo.Burst < 1 {
+				fo.Burst = 1
+			}
+		}
+		if fo.QueueDepth <= 0 {
+			fo.QueueDepth = defaultFanOutQueueDepth
+		}
+		if fo.DigestInterval <= 0 {
+			fo.DigestInterval = defaultFanOutDigestInterval
+		}
+	}
+	cb := &c.CircuitBreaker
+	if cb.ConsecutiveFailures <= 0 {
+		cb.ConsecutiveFailures = 5
+	}
+	if cb.FailureRate <= 0 {
+		cb.FailureRate = 50
+	}
+	if cb.MinRequests <= 0 {
+		cb.MinRequests = 20
+	}
+	if cb.Window <= 0 {
+		cb.Window = time.Minute
+	}
+	if cb.CoolDown <= 0 {
+		cb.CoolDown = 30 * time.Second
+	}
+	if cb.HalfOpenProbes <= 0 {
+		cb.HalfOpenProbes = 1
+	}
 
 	return nil
 }
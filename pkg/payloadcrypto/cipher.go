@@ -0,0 +1,103 @@
+// Package payloadcrypto DNY数据域加密：新固件在注册帧(0x20)末尾声明密钥ID，密钥经带外方式预置，
+// 此后该连接上行与下行帧的数据域以 AES-128-GCM 加密（帧头的物理ID、消息ID与命令作为附加认证数据）。
+// 未声明密钥ID的连接不受影响；密钥轮换后在宽限期内同时接受新旧密钥。
+//
+// 加密数据域格式：随机数(12) + 密文 + 认证标签(16)；注册帧及其应答与空数据域不加密。
+// 注册帧声明：标准注册载荷（6或8字节）后追加 0xEC + 密钥ID(2字节，小端序)
+package payloadcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 加密参数
+const (
+	KeySize   = 16 // AES-128
+	NonceSize = 12
+	TagSize   = 16
+	Overhead  = NonceSize + TagSize // 加密后数据域增加的字节数
+
+	// RegisterTrailerMarker 注册载荷中密钥ID声明的特征字节
+	RegisterTrailerMarker = 0xEC
+	registerTrailerLen    = 3
+)
+
+var (
+	// ErrInvalidKey 密钥长度不是16字节
+	ErrInvalidKey = errors.New("密钥长度无效，应为16字节")
+	// ErrCiphertextTooShort 数据域短于随机数与认证标签
+	ErrCiphertextTooShort = errors.New("加密数据域长度不足")
+	// ErrAuthFailed 认证标签校验失败（密钥不符或数据被篡改）
+	ErrAuthFailed = errors.New("数据域认证失败")
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal 以随机数加密数据域，返回 随机数+密文+认证标签
+func Seal(key, aad, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return SealWithNonce(key, nonce, aad, plaintext)
+}
+
+// SealWithNonce 以指定随机数加密（已知向量测试与模拟器使用；同一密钥下随机数不得重复）
+func SealWithNonce(key, nonce, aad, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != NonceSize {
+		return nil, fmt.Errorf("随机数长度无效: %d", len(nonce))
+	}
+	out := make([]byte, 0, NonceSize+len(plaintext)+TagSize)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, aad), nil
+}
+
+// Open 解密 随机数+密文+认证标签 格式的数据域并校验认证标签
+func Open(key, aad, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < Overhead {
+		return nil, ErrCiphertextTooShort
+	}
+	plaintext, err := aead.Open(nil, sealed[:NonceSize], sealed[NonceSize:], aad)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plaintext, nil
+}
+
+// ParseRegisterKeyID 解析注册载荷末尾的密钥ID声明，返回去掉声明后的标准注册载荷；未声明时返回false
+func ParseRegisterKeyID(payload []byte) (keyID uint16, stripped []byte, ok bool) {
+	n := len(payload) - registerTrailerLen
+	if n != 6 && n != 8 || payload[n] != RegisterTrailerMarker {
+		return 0, payload, false
+	}
+	return binary.LittleEndian.Uint16(payload[n+1:]), payload[:n], true
+}
+
+// AppendRegisterKeyID 在标准注册载荷后追加密钥ID声明（模拟器与测试使用）
+func AppendRegisterKeyID(payload []byte, keyID uint16) []byte {
+	out := make([]byte, 0, len(payload)+registerTrailerLen)
+	out = append(out, payload...)
+	return append(out, RegisterTrailerMarker, byte(keyID), byte(keyID>>8))
+}
@@ -0,0 +1,238 @@
+package payloadcrypto
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 密钥存储方式
+const (
+	StoreTypeFile  = "file"
+	StoreTypeRedis = "redis"
+)
+
+// ErrUnknownKey 密钥存储中没有该密钥ID
+var ErrUnknownKey = errors.New("未知的密钥ID")
+
+// KeySet 密钥ID对应的密钥：轮换后 Previous 为上一代密钥，在 RotatedAt 之后的宽限期内仍被接受
+type KeySet struct {
+	ID        uint16
+	Current   []byte
+	Previous  []byte
+	RotatedAt time.Time
+}
+
+// PreviousValid 上一代密钥在 now 时是否仍在宽限期内
+func (k KeySet) PreviousValid(now time.Time, grace time.Duration) bool {
+	return len(k.Previous) == KeySize && !k.RotatedAt.IsZero() && now.Before(k.RotatedAt.Add(grace))
+}
+
+// KeyStore 密钥ID到密钥的映射（密钥材料带外预置）
+type KeyStore interface {
+	Lookup(keyID uint16) (KeySet, error)
+}
+
+// keyEntry 密钥文件与Redis中的密钥记录（密钥为32位十六进制字符串）
+type keyEntry struct {
+	ID          uint16    `json:"id"`
+	Key         string    `json:"key"`
+	PreviousKey string    `json:"previousKey,omitempty"`
+	RotatedAt   time.Time `json:"rotatedAt,omitempty"`
+}
+
+func (e keyEntry) keySet() (KeySet, error) {
+	set := KeySet{ID: e.ID, RotatedAt: e.RotatedAt}
+	var err error
+	if set.Current, err = decodeKey(e.Key); err != nil {
+		return KeySet{}, fmt.Errorf("密钥 %d: %w", e.ID, err)
+	}
+	if e.PreviousKey != "" {
+		if set.Previous, err = decodeKey(e.PreviousKey); err != nil {
+			return KeySet{}, fmt.Errorf("密钥 %d 的上一代密钥: %w", e.ID, err)
+		}
+	}
+	return set, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// FileKeyStore JSON密钥文件：{"keys":[{"id":1,"key":"<hex>","previousKey":"<hex>","rotatedAt":"RFC3339"}]}；
+// 文件修改后（按修改时间判断，至多每 reloadInterval 检查一次）自动重新加载，加载失败时保留原有密钥
+type FileKeyStore struct {
+	path           string
+	reloadInterval time.Duration
+
+	mu      sync.RWMutex
+	keys    map[uint16]KeySet
+	modTime time.Time
+	checked time.Time
+}
+
+// NewFileKeyStore 加载密钥文件
+func NewFileKeyStore(path string, reloadInterval time.Duration) (*FileKeyStore, error) {
+	s := &FileKeyStore{path: path, reloadInterval: reloadInterval}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload 重新加载密钥文件
+func (s *FileKeyStore) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+	var file struct {
+		Keys []keyEntry `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+	keys := make(map[uint16]KeySet, len(file.Keys))
+	for _, e := range file.Keys {
+		set, err := e.keySet()
+		if err != nil {
+			return err
+		}
+		if _, dup := keys[e.ID]; dup {
+			return fmt.Errorf("密钥ID %d 重复", e.ID)
+		}
+		keys[e.ID] = set
+	}
+	s.mu.Lock()
+	s.keys, s.modTime, s.checked = keys, info.ModTime(), time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// Lookup 查找密钥
+func (s *FileKeyStore) Lookup(keyID uint16) (KeySet, error) {
+	s.maybeReload()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set, ok := s.keys[keyID]
+	if !ok {
+		return KeySet{}, fmt.Errorf("%w: %d", ErrUnknownKey, keyID)
+	}
+	return set, nil
+}
+
+func (s *FileKeyStore) maybeReload() {
+	if s.reloadInterval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	if time.Since(s.checked) < s.reloadInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.checked = time.Now()
+	modTime := s.modTime
+	s.mu.Unlock()
+	if info, err := os.Stat(s.path); err == nil && !info.ModTime().Equal(modTime) {
+		_ = s.Reload()
+	}
+}
+
+// RedisKeyStore Redis密钥存储：每个密钥ID一个哈希（字段 key、previousKey、rotatedAt），
+// 查询结果在本地缓存 cacheTTL，避免每帧访问Redis；Redis不可达时沿用已过期的缓存
+type RedisKeyStore struct {
+	client   *redis.Client
+	prefix   string
+	cacheTTL time.Duration
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	cache map[uint16]cachedKeySet
+}
+
+type cachedKeySet struct {
+	set KeySet
+	err error
+	at  time.Time
+}
+
+// NewRedisKeyStore 创建Redis密钥存储
+func NewRedisKeyStore(client *redis.Client, prefix string, cacheTTL time.Duration) *RedisKeyStore {
+	return &RedisKeyStore{client: client, prefix: prefix, cacheTTL: cacheTTL, timeout: 2 * time.Second, cache: make(map[uint16]cachedKeySet)}
+}
+
+// Lookup 查找密钥
+func (s *RedisKeyStore) Lookup(keyID uint16) (KeySet, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[keyID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.at) < s.cacheTTL {
+		return cached.set, cached.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	fields, err := s.client.HGetAll(ctx, s.prefix+strconv.Itoa(int(keyID))).Result()
+	if err != nil {
+		if ok && cached.err == nil {
+			return cached.set, nil
+		}
+		return KeySet{}, fmt.Errorf("读取密钥失败: %w", err)
+	}
+	entry := keyEntry{ID: keyID, Key: fields["key"], PreviousKey: fields["previousKey"]}
+	if v := fields["rotatedAt"]; v != "" {
+		if entry.RotatedAt, err = time.Parse(time.RFC3339, v); err != nil {
+			return KeySet{}, fmt.Errorf("密钥 %d 的 rotatedAt 格式错误: %w", keyID, err)
+		}
+	}
+	var set KeySet
+	if entry.Key == "" {
+		err = fmt.Errorf("%w: %d", ErrUnknownKey, keyID)
+	} else {
+		set, err = entry.keySet()
+	}
+	s.mu.Lock()
+	s.cache[keyID] = cachedKeySet{set: set, err: err, at: time.Now()}
+	s.mu.Unlock()
+	return set, err
+}
+
+// StoreKey 写入密钥ID的当前密钥；已有不同的当前密钥时转为上一代密钥并记录轮换时间
+func (s *RedisKeyStore) StoreKey(ctx context.Context, keyID uint16, key []byte, now time.Time) error {
+	if len(key) != KeySize {
+		return ErrInvalidKey
+	}
+	hashKey := s.prefix + strconv.Itoa(int(keyID))
+	current, err := s.client.HGet(ctx, hashKey, "key").Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	values := map[string]interface{}{"key": hex.EncodeToString(key)}
+	if current != "" && current != values["key"] {
+		values["previousKey"] = current
+		values["rotatedAt"] = now.UTC().Format(time.RFC3339)
+	}
+	if err := s.client.HSet(ctx, hashKey, values).Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.cache, keyID)
+	s.mu.Unlock()
+	return nil
+}
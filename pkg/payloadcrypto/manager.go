@@ -0,0 +1,401 @@
+package payloadcrypto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/sirupsen/logrus"
+)
+
+// 默认参数
+const (
+	defaultKeyFile        = "./configs/payload_keys.json"
+	defaultRedisKeyPrefix = "iot:payload_key:"
+	defaultGraceHours     = 72
+	defaultCacheSeconds   = 60
+	fileReloadInterval    = 5 * time.Second
+)
+
+// 帧内偏移：包头(3)+长度(2)+物理ID(4)+消息ID(2)+命令(1)
+const (
+	aadOffset     = len(constants.ProtocolHeader) + constants.LengthFieldSize
+	payloadOffset = constants.MinPacketSize - constants.ChecksumSize
+)
+
+// 连接使用的密钥代次
+const (
+	GenerationCurrent  = "current"
+	GenerationPrevious = "previous" // 轮换宽限期内设备仍使用上一代密钥
+)
+
+// 解密/加密失败原因（计数器标签）
+const (
+	FailureUnknownKey = "unknown_key" // 密钥存储中没有声明的密钥ID
+	FailureKeyStore   = "key_store"   // 密钥存储不可用
+	FailureTooShort   = "too_short"   // 数据域短于随机数与认证标签
+	FailureAuth       = "auth_failed" // 认证失败：密钥不符或数据被篡改
+	FailureEncrypt    = "encrypt"     // 下行加密失败
+)
+
+var failureReasons = []string{FailureUnknownKey, FailureKeyStore, FailureTooShort, FailureAuth, FailureEncrypt}
+
+// Link 加密连接（注册帧声明了密钥ID）
+type Link struct {
+	ConnID     uint64    `json:"connId"`
+	KeyID      uint16    `json:"keyId"`
+	DeviceID   string    `json:"deviceId,omitempty"`   // 注册完成后记录
+	Generation string    `json:"generation,omitempty"` // 最近一次成功解密使用的密钥代次
+	BoundAt    time.Time `json:"boundAt"`
+	Decrypted  uint64    `json:"decrypted"` // 解密的上行帧数
+	Encrypted  uint64    `json:"encrypted"` // 加密的下行帧数
+	Failures   uint64    `json:"failures"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+// Stats 加密统计
+type Stats struct {
+	Links         int               `json:"links"`
+	Decrypted     uint64            `json:"decrypted"`
+	Encrypted     uint64            `json:"encrypted"`
+	PreviousKey   uint64            `json:"previousKey"` // 以上一代密钥解密的帧数（轮换宽限期内）
+	Failures      map[string]uint64 `json:"failures"`
+	RotationGrace string            `json:"rotationGrace"`
+	StoreType     string            `json:"storeType"`
+}
+
+// Options 加密参数
+type Options struct {
+	Store         KeyStore
+	StoreType     string
+	RotationGrace time.Duration // 轮换后上一代密钥仍被接受的时长
+}
+
+// Manager 各连接的数据域加解密；未声明密钥ID的连接原样通过
+type Manager struct {
+	store     KeyStore
+	storeType string
+	grace     time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	links map[uint64]*Link
+
+	decrypted, encrypted, previous atomic.Uint64
+	failures                       map[string]*atomic.Uint64
+}
+
+// NewManager 创建加密管理器
+func NewManager(opts Options) *Manager {
+	if opts.RotationGrace <= 0 {
+		opts.RotationGrace = defaultGraceHours * time.Hour
+	}
+	m := &Manager{
+		store:     opts.Store,
+		storeType: opts.StoreType,
+		grace:     opts.RotationGrace,
+		now:       time.Now,
+		links:     make(map[uint64]*Link),
+		failures:  make(map[string]*atomic.Uint64, len(failureReasons)),
+	}
+	for _, reason := range failureReasons {
+		m.failures[reason] = &atomic.Uint64{}
+	}
+	return m
+}
+
+// SetNowFunc 替换时间源（测试使用）
+func (m *Manager) SetNowFunc(now func() time.Time) {
+	m.now = now
+}
+
+// BindRegister 注册帧声明了密钥ID时绑定连接，返回去掉声明后的标准注册帧；未声明时原样返回false。
+// 同一连接重复注册时按最新声明重新绑定
+func (m *Manager) BindRegister(connID uint64, frame []byte) ([]byte, bool) {
+	if !isFrame(frame) {
+		return frame, false
+	}
+	payload := frame[payloadOffset : len(frame)-constants.ChecksumSize]
+	keyID, stripped, ok := ParseRegisterKeyID(payload)
+	if !ok {
+		return frame, false
+	}
+	// 第二厂商注册载荷同为9字节，按其特征识别时不视为密钥声明
+	if name, detected := dialect.DetectRegister(payload); detected && name == dialect.VendorB {
+		return frame, false
+	}
+	m.mu.Lock()
+	m.links[connID] = &Link{ConnID: connID, KeyID: keyID, BoundAt: m.now()}
+	m.mu.Unlock()
+
+	fields := logrus.Fields{"connID": connID, "keyID": keyID}
+	if _, err := m.store.Lookup(keyID); err != nil {
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Warn("数据域加密：注册帧声明的密钥不可用，该连接的加密帧将无法解密")
+	} else {
+		logger.WithFields(fields).Info("数据域加密：连接已按注册帧声明启用加密")
+	}
+	return rebuild(frame, stripped), true
+}
+
+// DecryptFrame 解密加密连接的上行帧数据域，返回数据域为明文的标准帧；非加密连接、注册帧与空数据域原样返回false。
+// 先以当前密钥解密，失败时在轮换宽限期内再以上一代密钥尝试
+func (m *Manager) DecryptFrame(connID uint64, frame []byte) ([]byte, bool, error) {
+	link := m.link(connID)
+	if link == nil || !isFrame(frame) || frame[payloadOffset-1] == constants.CmdDeviceRegister {
+		return frame, false, nil
+	}
+	sealed := frame[payloadOffset : len(frame)-constants.ChecksumSize]
+	if len(sealed) == 0 {
+		return frame, false, nil
+	}
+	set, err := m.lookup(connID, link.KeyID)
+	if err != nil {
+		return nil, false, err
+	}
+	aad := frame[aadOffset:payloadOffset]
+	generation := GenerationCurrent
+	plaintext, err := Open(set.Current, aad, sealed)
+	if errors.Is(err, ErrAuthFailed) && set.PreviousValid(m.now(), m.grace) {
+		if prev, prevErr := Open(set.Previous, aad, sealed); prevErr == nil {
+			plaintext, err, generation = prev, nil, GenerationPrevious
+		}
+	}
+	if err != nil {
+		reason := FailureAuth
+		if errors.Is(err, ErrCiphertextTooShort) {
+			reason = FailureTooShort
+		}
+		return nil, false, m.fail(connID, reason, err)
+	}
+
+	m.decrypted.Add(1)
+	if generation == GenerationPrevious {
+		m.previous.Add(1)
+	}
+	m.mu.Lock()
+	if l, ok := m.links[connID]; ok {
+		l.Decrypted++
+		l.Generation = generation
+	}
+	m.mu.Unlock()
+	return rebuild(frame, plaintext), true, nil
+}
+
+// EncryptFrame 加密加密连接的下行帧数据域；使用设备最近上行所用的密钥代次（宽限期结束后改用当前密钥）。
+// 非加密连接、注册应答与空数据域原样返回
+func (m *Manager) EncryptFrame(connID uint64, frame []byte) ([]byte, error) {
+	link := m.link(connID)
+	if link == nil || !isFrame(frame) || frame[payloadOffset-1] == constants.CmdDeviceRegister {
+		return frame, nil
+	}
+	plaintext := frame[payloadOffset : len(frame)-constants.ChecksumSize]
+	if len(plaintext) == 0 {
+		return frame, nil
+	}
+	set, err := m.lookup(connID, link.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	key := set.Current
+	if link.Generation == GenerationPrevious && set.PreviousValid(m.now(), m.grace) {
+		key = set.Previous
+	}
+	sealed, err := Seal(key, frame[aadOffset:payloadOffset], plaintext)
+	if err != nil {
+		return nil, m.fail(connID, FailureEncrypt, err)
+	}
+	m.encrypted.Add(1)
+	m.mu.Lock()
+	if l, ok := m.links[connID]; ok {
+		l.Encrypted++
+	}
+	m.mu.Unlock()
+	return rebuild(frame, sealed), nil
+}
+
+func (m *Manager) lookup(connID uint64, keyID uint16) (KeySet, error) {
+	set, err := m.store.Lookup(keyID)
+	if err == nil {
+		return set, nil
+	}
+	reason := FailureKeyStore
+	if errors.Is(err, ErrUnknownKey) {
+		reason = FailureUnknownKey
+	}
+	return KeySet{}, m.fail(connID, reason, err)
+}
+
+func (m *Manager) fail(connID uint64, reason string, err error) error {
+	m.failures[reason].Add(1)
+	m.mu.Lock()
+	if l, ok := m.links[connID]; ok {
+		l.Failures++
+		l.LastError = err.Error()
+	}
+	m.mu.Unlock()
+	return fmt.Errorf("%s: %w", reason, err)
+}
+
+func (m *Manager) link(connID uint64) *Link {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[connID]
+	if !ok {
+		return nil
+	}
+	copied := *l
+	return &copied
+}
+
+// MarkRegistered 设备注册完成：记录加密连接的设备ID，返回连接是否加密
+func (m *Manager) MarkRegistered(connID uint64, deviceID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[connID]
+	if ok {
+		l.DeviceID = deviceID
+	}
+	return ok
+}
+
+// Get 连接的加密状态，非加密连接返回false
+func (m *Manager) Get(connID uint64) (Link, bool) {
+	if l := m.link(connID); l != nil {
+		return *l, true
+	}
+	return Link{}, false
+}
+
+// Release 连接关闭时清除绑定
+func (m *Manager) Release(connID uint64) {
+	m.mu.Lock()
+	delete(m.links, connID)
+	m.mu.Unlock()
+}
+
+// Links 全部加密连接（按连接ID排序）
+func (m *Manager) Links() []Link {
+	m.mu.Lock()
+	out := make([]Link, 0, len(m.links))
+	for _, l := range m.links {
+		out = append(out, *l)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ConnID < out[j].ConnID })
+	return out
+}
+
+// Stats 统计信息
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	links := len(m.links)
+	m.mu.Unlock()
+	stats := Stats{
+		Links:         links,
+		Decrypted:     m.decrypted.Load(),
+		Encrypted:     m.encrypted.Load(),
+		PreviousKey:   m.previous.Load(),
+		Failures:      make(map[string]uint64, len(m.failures)),
+		RotationGrace: m.grace.String(),
+		StoreType:     m.storeType,
+	}
+	for reason, counter := range m.failures {
+		stats.Failures[reason] = counter.Load()
+	}
+	return stats
+}
+
+func isFrame(frame []byte) bool {
+	return len(frame) >= constants.MinPacketSize && string(frame[:len(constants.ProtocolHeader)]) == constants.ProtocolHeader
+}
+
+// rebuild 以新的数据域重建帧：保留帧头（物理ID、消息ID与命令按原字节序），重算长度与校验和
+func rebuild(frame, data []byte) []byte {
+	out := make([]byte, 0, payloadOffset+len(data)+constants.ChecksumSize)
+	out = append(out, frame[:payloadOffset]...)
+	length := dny_protocol.LengthFieldValue(len(data))
+	out[aadOffset-2], out[aadOffset-1] = byte(length), byte(length>>8)
+	out = append(out, data...)
+	checksum := dny_protocol.Checksum(out)
+	return append(out, byte(checksum), byte(checksum>>8))
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalManager atomic.Pointer[Manager]
+
+// GetGlobalManager 获取全局加密管理器（未启用时为nil）
+func GetGlobalManager() *Manager {
+	return globalManager.Load()
+}
+
+// SetGlobalManager 替换全局加密管理器（传nil关闭数据域加密）
+func SetGlobalManager(m *Manager) {
+	globalManager.Store(m)
+}
+
+// InitGlobalManager 按配置创建全局加密管理器（redis 存储需在Redis初始化之后调用）
+func InitGlobalManager() error {
+	cfg := config.GetConfig().PayloadCrypto
+	if !cfg.Enabled {
+		SetGlobalManager(nil)
+		return nil
+	}
+	var store KeyStore
+	storeType := cfg.Store
+	switch storeType {
+	case "", StoreTypeFile:
+		storeType = StoreTypeFile
+		path := cfg.KeyFile
+		if path == "" {
+			path = defaultKeyFile
+		}
+		fileStore, err := NewFileKeyStore(path, fileReloadInterval)
+		if err != nil {
+			SetGlobalManager(nil)
+			return err
+		}
+		store = fileStore
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			SetGlobalManager(nil)
+			return fmt.Errorf("数据域加密配置为redis密钥存储，但Redis未连接")
+		}
+		prefix := cfg.RedisKeyPrefix
+		if prefix == "" {
+			prefix = defaultRedisKeyPrefix
+		}
+		cacheSeconds := cfg.CacheSeconds
+		if cacheSeconds <= 0 {
+			cacheSeconds = defaultCacheSeconds
+		}
+		store = NewRedisKeyStore(client, prefix, time.Duration(cacheSeconds)*time.Second)
+	default:
+		SetGlobalManager(nil)
+		return fmt.Errorf("不支持的密钥存储方式: %s", cfg.Store)
+	}
+	graceHours := cfg.RotationGraceHours
+	if graceHours <= 0 {
+		graceHours = defaultGraceHours
+	}
+	SetGlobalManager(NewManager(Options{
+		Store:         store,
+		StoreType:     storeType,
+		RotationGrace: time.Duration(graceHours) * time.Hour,
+	}))
+	logger.WithFields(logrus.Fields{"store": storeType, "rotationGraceHours": graceHours}).Info("数据域加密已启用")
+	return nil
+}
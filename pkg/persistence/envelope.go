@@ -0,0 +1,347 @@
+// Package persistence 持久化数据版本信封与迁移：每类持久化记录携带格式版本，读取时按迁移注册表逐级升级到当前版本，
+// 版本高于当前程序支持的记录默认拒绝启动（可配置为归档后跳过），避免新旧版本交替部署时误读或覆盖数据
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 未知（高于当前支持）版本的处理策略
+const (
+	PolicyRefuse  = "refuse"  // 拒绝启动
+	PolicyArchive = "archive" // 原样归档后跳过该记录
+)
+
+const (
+	defaultArchiveDir = "./data/persistence_archive"
+	legacyVersion     = 1 // 引入信封之前的裸格式视为版本1
+)
+
+var (
+	// ErrFutureVersion 记录版本高于当前程序支持的版本（refuse 策略）
+	ErrFutureVersion = errors.New("持久化记录版本高于当前程序支持的版本")
+	// ErrRecordArchived 未知版本的记录已归档，调用方应跳过该记录（archive 策略）
+	ErrRecordArchived = errors.New("持久化记录版本未知，已归档跳过")
+)
+
+// Envelope 持久化信封
+type Envelope struct {
+	Type    string          `json:"type"`
+	Version int             `json:"schemaVersion"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Migration 将某一版本的数据升级到下一版本
+type Migration func(data json.RawMessage) (json.RawMessage, error)
+
+type migrationKey struct {
+	recordType string
+	from       int
+}
+
+// TypeReport 单类记录的读取与迁移计数
+type TypeReport struct {
+	CurrentVersion int           `json:"currentVersion"`
+	Read           int64         `json:"read"`
+	Migrated       int64         `json:"migrated"` // 由旧版本（含无信封的裸格式）升级
+	Archived       int64         `json:"archived"`
+	Refused        int64         `json:"refused"`
+	FromVersions   map[int]int64 `json:"fromVersions,omitempty"` // 迁移前版本 → 条数
+}
+
+// Report 迁移报告
+type Report struct {
+	Policy  string                `json:"policy"`
+	Types   map[string]TypeReport `json:"types"`
+	Refused []string              `json:"refused,omitempty"` // 因版本未知而拒绝的记录说明
+}
+
+// Migrated 报告中升级的记录总数
+func (r Report) Migrated() int64 {
+	var n int64
+	for _, t := range r.Types {
+		n += t.Migrated
+	}
+	return n
+}
+
+// Summary 按类型汇总的单行说明
+func (r Report) Summary() string {
+	names := make([]string, 0, len(r.Types))
+	for name := range r.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		t := r.Types[name]
+		parts = append(parts, fmt.Sprintf("%s(v%d) 读取%d 迁移%d 归档%d 拒绝%d", name, t.CurrentVersion, t.Read, t.Migrated, t.Archived, t.Refused))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Registry 记录类型与迁移注册表
+type Registry struct {
+	mu         sync.RWMutex
+	current    map[string]int
+	migrations map[migrationKey]Migration
+	policy     string
+	archiveDir string
+	stats      map[string]*TypeReport
+	refused    []string
+}
+
+// NewRegistry 创建注册表（默认 refuse 策略）
+func NewRegistry() *Registry {
+	return &Registry{
+		current:    make(map[string]int),
+		migrations: make(map[migrationKey]Migration),
+		policy:     PolicyRefuse,
+		archiveDir: defaultArchiveDir,
+		stats:      make(map[string]*TypeReport),
+	}
+}
+
+// RegisterType 登记记录类型及其当前版本
+func (r *Registry) RegisterType(recordType string, current int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current[recordType] = current
+}
+
+// RegisterMigration 登记 from → from+1 的迁移
+func (r *Registry) RegisterMigration(recordType string, from int, fn Migration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.migrations[migrationKey{recordType, from}] = fn
+}
+
+// Configure 设置未知版本的处理策略与归档目录
+func (r *Registry) Configure(cfg config.PersistenceConfig) error {
+	policy := cfg.UnknownVersionPolicy
+	switch policy {
+	case "":
+		policy = PolicyRefuse
+	case PolicyRefuse, PolicyArchive:
+	default:
+		return fmt.Errorf("不支持的未知版本处理策略: %s（可选 %s | %s）", policy, PolicyRefuse, PolicyArchive)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+	r.archiveDir = cfg.ArchiveDir
+	if r.archiveDir == "" {
+		r.archiveDir = defaultArchiveDir
+	}
+	return nil
+}
+
+// Encode 以当前版本的信封序列化
+func (r *Registry) Encode(recordType string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{Type: recordType, Version: r.currentVersion(recordType), Data: data})
+}
+
+// Decode 解析信封（无信封的裸格式视为版本1），逐级迁移到当前版本后反序列化到 v，返回是否经过迁移。
+// 版本高于当前支持时按策略返回 ErrFutureVersion 或归档后返回 ErrRecordArchived
+func (r *Registry) Decode(recordType string, raw []byte, v interface{}) (bool, error) {
+	current := r.currentVersion(recordType)
+	version, data, enveloped := legacyVersion, json.RawMessage(raw), false
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		var env Envelope
+		if err := json.Unmarshal(trimmed, &env); err == nil && env.Type == recordType && env.Version > 0 && len(env.Data) > 0 {
+			version, data, enveloped = env.Version, env.Data, true
+		}
+	}
+
+	if version > current {
+		return false, r.unknownVersion(recordType, version, current, raw)
+	}
+	from := version
+	for ; version < current; version++ {
+		r.mu.RLock()
+		migrate, ok := r.migrations[migrationKey{recordType, version}]
+		r.mu.RUnlock()
+		if !ok {
+			return false, fmt.Errorf("%s 缺少 v%d→v%d 的迁移", recordType, version, version+1)
+		}
+		next, err := migrate(data)
+		if err != nil {
+			return false, fmt.Errorf("%s v%d→v%d 迁移失败: %w", recordType, version, version+1, err)
+		}
+		data = next
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+
+	migrated := from != current || !enveloped
+	r.mu.Lock()
+	stats := r.statsLocked(recordType)
+	stats.Read++
+	if migrated {
+		stats.Migrated++
+		if stats.FromVersions == nil {
+			stats.FromVersions = make(map[int]int64)
+		}
+		stats.FromVersions[from]++
+	}
+	r.mu.Unlock()
+	return migrated, nil
+}
+
+// Report 迁移报告快照
+func (r *Registry) Report() Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	report := Report{Policy: r.policy, Types: make(map[string]TypeReport, len(r.stats)), Refused: append([]string(nil), r.refused...)}
+	for name, s := range r.stats {
+		cp := *s
+		if s.FromVersions != nil {
+			cp.FromVersions = make(map[int]int64, len(s.FromVersions))
+			for v, n := range s.FromVersions {
+				cp.FromVersions[v] = n
+			}
+		}
+		report.Types[name] = cp
+	}
+	return report
+}
+
+// ResetReport 清空计数（测试或重新加载前调用）
+func (r *Registry) ResetReport() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = make(map[string]*TypeReport)
+	r.refused = nil
+}
+
+func (r *Registry) currentVersion(recordType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if v, ok := r.current[recordType]; ok {
+		return v
+	}
+	return legacyVersion
+}
+
+func (r *Registry) statsLocked(recordType string) *TypeReport {
+	s, ok := r.stats[recordType]
+	if !ok {
+		s = &TypeReport{CurrentVersion: r.current[recordType]}
+		if s.CurrentVersion == 0 {
+			s.CurrentVersion = legacyVersion
+		}
+		r.stats[recordType] = s
+	}
+	return s
+}
+
+// unknownVersion 按策略处理高于当前支持版本的记录
+func (r *Registry) unknownVersion(recordType string, version, current int, raw []byte) error {
+	r.mu.Lock()
+	policy, dir := r.policy, r.archiveDir
+	stats := r.statsLocked(recordType)
+	stats.Read++
+	if policy != PolicyArchive {
+		stats.Refused++
+		r.refused = append(r.refused, fmt.Sprintf("%s v%d（当前支持v%d）", recordType, version, current))
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s v%d，当前程序支持v%d；请升级程序或配置 persistence.unknownVersionPolicy=archive 归档后跳过",
+			ErrFutureVersion, recordType, version, current)
+	}
+	stats.Archived++
+	r.mu.Unlock()
+
+	if err := archive(dir, recordType, version, raw); err != nil {
+		return fmt.Errorf("归档未知版本记录失败: %w", err)
+	}
+	logger.WithFields(logrus.Fields{
+		"type":    recordType,
+		"version": version,
+		"current": current,
+		"dir":     dir,
+	}).Warn("⚠️ 持久化记录版本未知，已归档跳过")
+	return fmt.Errorf("%w: %s v%d", ErrRecordArchived, recordType, version)
+}
+
+// archive 将原始记录追加到 <dir>/<type>.jsonl
+func archive(dir, recordType string, version int, raw []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	line, err := json.Marshal(struct {
+		ArchivedAt time.Time       `json:"archivedAt"`
+		Type       string          `json:"type"`
+		Version    int             `json:"schemaVersion"`
+		Raw        json.RawMessage `json:"raw"`
+	}{time.Now(), recordType, version, archivedRaw(raw)})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, recordType+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// archivedRaw 原始记录不是合法JSON时按字符串保存
+func archivedRaw(raw []byte) json.RawMessage {
+	if json.Valid(raw) {
+		return bytes.TrimSpace(raw)
+	}
+	quoted, _ := json.Marshal(string(raw))
+	return quoted
+}
+
+// ===============================
+// 全局注册表
+// ===============================
+
+var defaultRegistry = NewRegistry()
+
+// Default 全局注册表（各持久化包在 init 中登记记录类型与迁移）
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// RegisterType 在全局注册表登记记录类型
+func RegisterType(recordType string, current int) {
+	defaultRegistry.RegisterType(recordType, current)
+}
+
+// RegisterMigration 在全局注册表登记迁移
+func RegisterMigration(recordType string, from int, fn Migration) {
+	defaultRegistry.RegisterMigration(recordType, from, fn)
+}
+
+// Encode 以全局注册表的当前版本序列化
+func Encode(recordType string, v interface{}) ([]byte, error) {
+	return defaultRegistry.Encode(recordType, v)
+}
+
+// Decode 以全局注册表解析并迁移
+func Decode(recordType string, raw []byte, v interface{}) (bool, error) {
+	return defaultRegistry.Decode(recordType, raw, v)
+}
@@ -0,0 +1,154 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+// 单键持久化的存储方式
+const (
+	StoreTypeFile   = "file"
+	StoreTypeRedis  = "redis"
+	StoreTypeMemory = "memory"
+)
+
+const defaultRedisStoreTimeout = 3 * time.Second
+
+// Store 单键JSON持久化：整条记录存储在一个文件或一个Redis键下
+type Store[T any] interface {
+	Load() (*T, error) // 无记录时返回 nil, nil
+	Save(v T) error
+}
+
+// Codec 单键持久化的编码方式
+type Codec struct {
+	RecordType string // 版本信封的记录类型，为空时按裸JSON读写
+	Label      string // 错误信息中的数据名称（如“虚拟设备映射”）
+	Indent     bool   // 文件缩进输出，便于人工查看
+}
+
+func (c Codec) encode(v interface{}) ([]byte, error) {
+	if c.RecordType != "" {
+		return Encode(c.RecordType, v)
+	}
+	return json.Marshal(v)
+}
+
+// decode 解析记录：旧版本（含无信封的裸格式）立即以当前版本回写；版本未知且已归档时视为无记录
+func decode[T any](c Codec, data []byte, save func(T) error, source string) (*T, error) {
+	var v T
+	if c.RecordType == "" {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("解析%s失败: %w", source, err)
+		}
+		return &v, nil
+	}
+	migrated, err := Decode(c.RecordType, data, &v)
+	if errors.Is(err, ErrRecordArchived) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析%s失败: %w", source, err)
+	}
+	if migrated {
+		if err := save(v); err != nil {
+			return nil, fmt.Errorf("回写迁移后的%s失败: %w", source, err)
+		}
+	}
+	return &v, nil
+}
+
+// FileStore JSON文件持久化（先写临时文件再重命名，避免写一半的文件）
+type FileStore[T any] struct {
+	path  string
+	codec Codec
+}
+
+// NewFileStore 创建文件持久化
+func NewFileStore[T any](path string, codec Codec) *FileStore[T] {
+	return &FileStore[T]{path: path, codec: codec}
+}
+
+// Load 读取记录，文件不存在视为无记录
+func (s *FileStore[T]) Load() (*T, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取%s文件失败: %w", s.codec.Label, err)
+	}
+	return decode(s.codec, data, s.Save, s.codec.Label+"文件")
+}
+
+// Save 写入记录
+func (s *FileStore[T]) Save(v T) error {
+	data, err := s.codec.encode(v)
+	if err != nil {
+		return err
+	}
+	if s.codec.Indent {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建%s目录失败: %w", s.codec.Label, err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入%s文件失败: %w", s.codec.Label, err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// RedisStore Redis持久化（JSON存储在单个键下，Redis降级时写入本地暂存）
+type RedisStore[T any] struct {
+	client  *redis.Client
+	key     string
+	codec   Codec
+	timeout time.Duration
+}
+
+// NewRedisStore 创建Redis持久化
+func NewRedisStore[T any](client *redis.Client, key string, codec Codec) *RedisStore[T] {
+	return &RedisStore[T]{client: client, key: key, codec: codec, timeout: defaultRedisStoreTimeout}
+}
+
+// Load 读取记录，键不存在视为无记录
+func (s *RedisStore[T]) Load() (*T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	data, err := s.client.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取Redis%s失败: %w", s.codec.Label, err)
+	}
+	return decode(s.codec, data, s.Save, "Redis"+s.codec.Label)
+}
+
+// Save 写入记录
+func (s *RedisStore[T]) Save(v T) error {
+	data, err := s.codec.encode(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return infraredis.SetOrSpool(ctx, s.client, s.key, data)
+}
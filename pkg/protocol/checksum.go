@@ -0,0 +1,321 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// 上行DNY帧校验和模式
+const (
+	ChecksumModeStrict  = "strict"  // 严格：丢弃校验和错误的帧并应答NAK（仅当物理ID为本连接已绑定的设备且命令已知时应答）
+	ChecksumModeLenient = "lenient" // 宽松（仅记录，默认）：照常处理，累计连接校验和失败计数并记录日志
+	ChecksumModeOff     = "off"     // 关闭：不校验
+)
+
+// ChecksumMetricsCollectorName /metrics 中校验和指标的收集器名称
+const ChecksumMetricsCollectorName = "dny_checksum"
+
+// checksumClasses 可按分类配置模式的命令分类
+var checksumClasses = []string{
+	constants.CategoryHeartbeat,
+	constants.CategoryRegistration,
+	constants.CategoryCharging,
+	constants.CategoryConfiguration,
+	constants.CategoryUpgrade,
+	constants.CategoryQuery,
+	constants.CategoryControl,
+	constants.CategoryTime,
+	constants.CategoryUnknown,
+}
+
+// ChecksumError 帧携带的校验和与计算值不一致
+type ChecksumError struct {
+	Carried    uint16 // 帧中携带的校验和
+	Calculated uint16 // 从包头"DNY"累加到校验和前的计算值
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %04X, got %04X", e.Carried, e.Calculated)
+}
+
+// VerifyFrameChecksum 校验单个完整DNY帧的校验和，不匹配时返回 *ChecksumError
+func VerifyFrameChecksum(frame []byte) error {
+	if len(frame) < constants.MinPacketSize || string(frame[:PacketHeaderLength]) != constants.ProtocolHeader {
+		return fmt.Errorf("不是完整的DNY帧: %d 字节", len(frame))
+	}
+	declared := int(binary.LittleEndian.Uint16(frame[PacketHeaderLength:]))
+	if total := PacketHeaderLength + DataLengthBytes + declared; len(frame) != total {
+		return fmt.Errorf("帧长度与声明不一致: 声明总长 %d，实际 %d", total, len(frame))
+	}
+	checksumStart := len(frame) - ChecksumLength
+	carried := binary.LittleEndian.Uint16(frame[checksumStart:])
+	if calculated := dny_protocol.Checksum(frame[:checksumStart]); calculated != carried {
+		return &ChecksumError{Carried: carried, Calculated: calculated}
+	}
+	return nil
+}
+
+// ChecksumPolicy 按命令分类的校验和模式
+type ChecksumPolicy struct {
+	Mode    string            `json:"mode"`              // 默认模式，空为 lenient
+	Classes map[string]string `json:"classes,omitempty"` // 命令分类（见 constants.GetCommandCategory）→ 模式
+}
+
+// Validate 校验模式与命令分类取值
+func (p ChecksumPolicy) Validate() error {
+	if err := validChecksumMode(p.Mode); err != nil {
+		return err
+	}
+	for class, mode := range p.Classes {
+		if !containsString(checksumClasses, class) {
+			return fmt.Errorf("未知的命令分类 %q，可选: %s", class, strings.Join(checksumClasses, ", "))
+		}
+		if err := validChecksumMode(mode); err != nil {
+			return fmt.Errorf("命令分类 %s: %w", class, err)
+		}
+	}
+	return nil
+}
+
+// ModeFor 命令适用的校验和模式：分类覆盖优先，其次默认模式
+func (p ChecksumPolicy) ModeFor(command uint8) string {
+	if mode := p.Classes[constants.GetCommandCategory(command)]; mode != "" {
+		return mode
+	}
+	if p.Mode != "" {
+		return p.Mode
+	}
+	return ChecksumModeLenient
+}
+
+// ChecksumDecision 单个帧按策略的校验和处置结论（解码器与 dny-parser 共用）
+type ChecksumDecision struct {
+	Class  string         `json:"class"`
+	Mode   string         `json:"mode"`
+	Err    *ChecksumError `json:"-"`      // 校验和错误，off 模式不校验恒为nil
+	Accept bool           `json:"accept"` // 是否照常处理
+}
+
+// Decide 按命令分类的模式校验帧：strict 下校验和错误不接受，lenient 与 off 均接受。
+// frame 须为长度与声明一致的完整DNY帧（其他格式错误不属于校验和处置范围）
+func (p ChecksumPolicy) Decide(frame []byte) ChecksumDecision {
+	var command uint8
+	if len(frame) > dnyPayloadOffset-1 {
+		command = frame[dnyPayloadOffset-1]
+	}
+	decision := ChecksumDecision{Class: constants.GetCommandCategory(command), Mode: p.ModeFor(command), Accept: true}
+	if decision.Mode == ChecksumModeOff {
+		return decision
+	}
+	if checksumErr, ok := VerifyFrameChecksum(frame).(*ChecksumError); ok {
+		decision.Err = checksumErr
+		decision.Accept = decision.Mode != ChecksumModeStrict
+	}
+	return decision
+}
+
+// checksumNAKRejection 严格模式下校验和错误帧的包头是否可信，可信时返回空串，否则返回不应答NAK的原因：
+// 命令须为已知命令，物理ID须对应本连接上已注册的设备（被破坏的字节不会恰好落在这两项的合法取值上）
+func checksumNAKRejection(connID uint64, msg *dny_protocol.Message) string {
+	if !dny_protocol.IsKnownCommand(uint8(msg.CommandId)) {
+		return "unknown_command"
+	}
+	tm := core.GetGlobalTCPManager()
+	if tm == nil {
+		return "device_not_bound"
+	}
+	conn, ok := tm.GetConnectionByDeviceID(utils.FormatPhysicalID(msg.PhysicalId))
+	if !ok || conn.GetConnID() != connID {
+		return "device_not_bound"
+	}
+	return ""
+}
+
+// ChecksumStats 校验和错误计数
+type ChecksumStats struct {
+	Policy   ChecksumPolicy   `json:"policy"`
+	Failures int64            `json:"failures"` // 校验和错误的帧数（off 模式不校验，不计入）
+	Rejected int64            `json:"rejected"` // strict 模式丢弃的帧数
+	Accepted int64            `json:"accepted"` // lenient 模式照常处理的帧数
+	ByClass  map[string]int64 `json:"by_class"` // 按命令分类的错误帧数
+}
+
+// ChecksumVerifier 上行帧校验和处置（各监听器的解码器共用）
+type ChecksumVerifier struct {
+	policy ChecksumPolicy
+
+	failures atomic.Int64
+	rejected atomic.Int64
+	accepted atomic.Int64
+
+	mu      sync.Mutex
+	byClass map[string]int64
+}
+
+// NewChecksumVerifier 创建校验和处置器
+func NewChecksumVerifier(policy ChecksumPolicy) (*ChecksumVerifier, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if policy.Mode == "" {
+		policy.Mode = ChecksumModeLenient
+	}
+	classes := make(map[string]string, len(policy.Classes))
+	for class, mode := range policy.Classes {
+		classes[class] = mode
+	}
+	policy.Classes = classes
+	return &ChecksumVerifier{policy: policy, byClass: make(map[string]int64)}, nil
+}
+
+// Policy 当前策略副本
+func (v *ChecksumVerifier) Policy() ChecksumPolicy {
+	p := v.policy
+	p.Classes = make(map[string]string, len(v.policy.Classes))
+	for class, mode := range v.policy.Classes {
+		p.Classes[class] = mode
+	}
+	return p
+}
+
+// Check 处置解析出的帧：校验和错误时计入统计与连接的 checksum_failures 并记录日志，返回处置结论
+func (v *ChecksumVerifier) Check(connID uint64, frame []byte, msg *dny_protocol.Message) ChecksumDecision {
+	decision := v.policy.Decide(frame)
+	if decision.Err == nil {
+		return decision
+	}
+	v.failures.Add(1)
+	v.mu.Lock()
+	v.byClass[decision.Class]++
+	v.mu.Unlock()
+	core.RecordConnChecksumFailure(connID)
+
+	fields := logrus.Fields{
+		"connID":     connID,
+		"physicalID": fmt.Sprintf("0x%08X", msg.PhysicalId),
+		"messageID":  fmt.Sprintf("0x%04X", msg.MessageId),
+		"command":    dny_protocol.CommandLabel(uint8(msg.CommandId)),
+		"class":      decision.Class,
+		"mode":       decision.Mode,
+		"carried":    fmt.Sprintf("0x%04X", decision.Err.Carried),
+		"calculated": fmt.Sprintf("0x%04X", decision.Err.Calculated),
+	}
+	if decision.Accept {
+		v.accepted.Add(1)
+		logger.WithFields(fields).Warn("解码器：校验和错误，宽松模式照常处理")
+	} else {
+		v.rejected.Add(1)
+		logger.WithFields(fields).Warn("解码器：校验和错误，严格模式丢弃")
+	}
+	return decision
+}
+
+// Stats 校验和错误计数快照
+func (v *ChecksumVerifier) Stats() ChecksumStats {
+	stats := ChecksumStats{
+		Policy:   v.Policy(),
+		Failures: v.failures.Load(),
+		Rejected: v.rejected.Load(),
+		Accepted: v.accepted.Load(),
+		ByClass:  make(map[string]int64),
+	}
+	v.mu.Lock()
+	for class, n := range v.byClass {
+		stats.ByClass[class] = n
+	}
+	v.mu.Unlock()
+	return stats
+}
+
+// WritePrometheus 以Prometheus文本格式输出校验和指标
+func (v *ChecksumVerifier) WritePrometheus(w io.Writer) {
+	stats := v.Stats()
+	classes := make([]string, 0, len(stats.ByClass))
+	for class := range stats.ByClass {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	fmt.Fprintf(w, "# HELP iot_dny_checksum_failures_total Inbound DNY frames with a bad checksum per command class.\n# TYPE iot_dny_checksum_failures_total counter\n")
+	for _, class := range classes {
+		fmt.Fprintf(w, "iot_dny_checksum_failures_total{class=%q,mode=%q} %d\n", class, stats.Policy.modeForClass(class), stats.ByClass[class])
+	}
+	fmt.Fprintf(w, "# HELP iot_dny_checksum_rejected_total Frames with a bad checksum dropped in strict mode.\n# TYPE iot_dny_checksum_rejected_total counter\n")
+	fmt.Fprintf(w, "iot_dny_checksum_rejected_total %d\n", stats.Rejected)
+	fmt.Fprintf(w, "# HELP iot_dny_checksum_accepted_total Frames with a bad checksum processed in lenient mode.\n# TYPE iot_dny_checksum_accepted_total counter\n")
+	fmt.Fprintf(w, "iot_dny_checksum_accepted_total %d\n", stats.Accepted)
+}
+
+// modeForClass 命令分类适用的模式
+func (p ChecksumPolicy) modeForClass(class string) string {
+	if mode := p.Classes[class]; mode != "" {
+		return mode
+	}
+	if p.Mode != "" {
+		return p.Mode
+	}
+	return ChecksumModeLenient
+}
+
+func validChecksumMode(mode string) error {
+	switch mode {
+	case "", ChecksumModeStrict, ChecksumModeLenient, ChecksumModeOff:
+		return nil
+	}
+	return fmt.Errorf("未知的校验和模式 %q，应为 %s、%s 或 %s", mode, ChecksumModeStrict, ChecksumModeLenient, ChecksumModeOff)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalChecksumVerifier atomic.Pointer[ChecksumVerifier]
+
+// GetGlobalChecksumVerifier 获取全局校验和处置器（未初始化时按默认 lenient 策略创建）
+func GetGlobalChecksumVerifier() *ChecksumVerifier {
+	if v := globalChecksumVerifier.Load(); v != nil {
+		return v
+	}
+	v, _ := InitGlobalChecksumVerifier(ChecksumPolicy{})
+	return v
+}
+
+// InitGlobalChecksumVerifier 创建全局校验和处置器（已存在时直接返回）
+func InitGlobalChecksumVerifier(policy ChecksumPolicy) (*ChecksumVerifier, error) {
+	if v := globalChecksumVerifier.Load(); v != nil {
+		return v, nil
+	}
+	v, err := NewChecksumVerifier(policy)
+	if err != nil {
+		return nil, err
+	}
+	if !globalChecksumVerifier.CompareAndSwap(nil, v) {
+		return globalChecksumVerifier.Load(), nil
+	}
+	return v, nil
+}
+
+// SetGlobalChecksumVerifier 替换全局校验和处置器（测试使用，传nil恢复默认策略）
+func SetGlobalChecksumVerifier(v *ChecksumVerifier) {
+	globalChecksumVerifier.Store(v)
+}
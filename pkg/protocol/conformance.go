@@ -0,0 +1,284 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// 违规处置方式
+const (
+	ConformanceActionNAK  = "nak"  // 应答失败状态
+	ConformanceActionDrop = "drop" // 静默丢弃
+)
+
+const (
+	defaultConformanceMaxViolations = 1000
+	defaultConformanceMsgIDWindow   = 5 * time.Minute
+	maxConformanceOffendingBytes    = 64 // 违规记录中保留的问题字节上限
+)
+
+// ConformanceViolation 协议一致性违规记录
+type ConformanceViolation struct {
+	Time           time.Time `json:"time"`
+	ConnID         uint64    `json:"conn_id"`
+	DeviceID       string    `json:"device_id,omitempty"`
+	Command        string    `json:"command,omitempty"`
+	MessageID      string    `json:"message_id,omitempty"`
+	RuleID         string    `json:"rule_id"`
+	Rule           string    `json:"rule"`   // 规则说明
+	Detail         string    `json:"detail"` // 具体违规内容
+	OffendingBytes string    `json:"offending_bytes"`
+	Action         string    `json:"action"`
+
+	// 应答NAK所需的帧标识（不输出）
+	physicalID uint32
+	messageID  uint16
+	command    uint8
+}
+
+// NAK 是否应答失败状态，返回应答所需的物理ID、消息ID与命令
+func (v *ConformanceViolation) NAK() (physicalID uint32, messageID uint16, command uint8, ok bool) {
+	return v.physicalID, v.messageID, v.command, v.Action == ConformanceActionNAK
+}
+
+// ConformanceOptions 一致性检查器选项
+type ConformanceOptions struct {
+	Rules           []ConformanceRule // 为空时使用 DefaultConformanceRules
+	MessageIDWindow time.Duration
+	MaxViolations   int
+}
+
+// msgIDState 设备最近一次消息ID
+type msgIDState struct {
+	messageID uint16
+	at        time.Time
+}
+
+// ConformanceChecker 严格模式下的协议一致性检查器（各监听器的解码器共用）
+type ConformanceChecker struct {
+	rules    []ConformanceRule
+	window   time.Duration
+	capacity int
+
+	lastMsgID sync.Map // physicalID → msgIDState（超过检查窗口的基线视为失效）
+
+	mu         sync.Mutex
+	violations []ConformanceViolation // 环形缓冲
+	next       int
+	total      int64
+}
+
+// NewConformanceChecker 创建一致性检查器
+func NewConformanceChecker(opts ConformanceOptions) *ConformanceChecker {
+	c := &ConformanceChecker{
+		rules:    opts.Rules,
+		window:   opts.MessageIDWindow,
+		capacity: opts.MaxViolations,
+	}
+	if len(c.rules) == 0 {
+		c.rules = DefaultConformanceRules
+	}
+	if c.window <= 0 {
+		c.window = defaultConformanceMsgIDWindow
+	}
+	if c.capacity <= 0 {
+		c.capacity = defaultConformanceMaxViolations
+	}
+	return c
+}
+
+// Rules 当前生效的规则集
+func (c *ConformanceChecker) Rules() []ConformanceRule {
+	return append([]ConformanceRule(nil), c.rules...)
+}
+
+// Check 按规则集检查一条解码后的消息，返回首个违规（已记录）；ICCID、link心跳等非DNY帧不检查
+func (c *ConformanceChecker) Check(connID uint64, msg *dny_protocol.Message, now time.Time) *ConformanceViolation {
+	if msg == nil || (msg.MessageType != "standard" && msg.MessageType != "error") {
+		return nil
+	}
+	for _, rule := range c.rules {
+		detail, offending, ok := c.evaluate(rule, msg, now)
+		if ok {
+			continue
+		}
+		v := ConformanceViolation{
+			Time:           now,
+			ConnID:         connID,
+			RuleID:         rule.ID,
+			Rule:           rule.Description,
+			Detail:         detail,
+			OffendingBytes: strings.ToUpper(hex.EncodeToString(offending)),
+			Action:         ConformanceActionDrop,
+		}
+		if msg.MessageType == "standard" {
+			cmd := uint8(msg.CommandId)
+			v.DeviceID = utils.FormatPhysicalID(msg.PhysicalId)
+			v.Command = fmt.Sprintf("0x%02X", cmd)
+			v.MessageID = fmt.Sprintf("0x%04X", msg.MessageId)
+			v.physicalID, v.messageID, v.command = msg.PhysicalId, msg.MessageId, cmd
+			if conformanceNAKCommands[cmd] {
+				v.Action = ConformanceActionNAK
+			}
+		}
+		c.record(v)
+		return &v
+	}
+	// 全部通过后才推进消息ID基线，违规帧不影响后续判断
+	if msg.MessageType == "standard" {
+		c.lastMsgID.Store(msg.PhysicalId, msgIDState{messageID: msg.MessageId, at: now})
+	}
+	return nil
+}
+
+// evaluate 执行单条规则，返回违规说明与问题字节
+func (c *ConformanceChecker) evaluate(rule ConformanceRule, msg *dny_protocol.Message, now time.Time) (string, []byte, bool) {
+	if msg.MessageType == "error" {
+		if rule.Kind == ConformanceKindFrameDecodable {
+			return msg.ErrorMessage, clipOffendingBytes(msg.RawData, 0, len(msg.RawData)), false
+		}
+		return "", nil, true
+	}
+	if len(rule.Commands) > 0 && !containsCommand(rule.Commands, uint8(msg.CommandId)) {
+		return "", nil, true
+	}
+	raw := msg.RawData
+	physicalIDPos := PacketHeaderLength + DataLengthBytes
+	msgIDPos := physicalIDPos + PhysicalIDLength
+
+	switch rule.Kind {
+	case ConformanceKindPhysicalIDNonZero:
+		if msg.PhysicalId == 0 {
+			return "物理ID为0", clipOffendingBytes(raw, physicalIDPos, PhysicalIDLength), false
+		}
+	case ConformanceKindMessageIDNonZero:
+		if msg.MessageId == 0 {
+			return "消息ID为0x0000", clipOffendingBytes(raw, msgIDPos, MessageIDLength), false
+		}
+	case ConformanceKindMessageIDMonotonic:
+		if v, ok := c.lastMsgID.Load(msg.PhysicalId); ok {
+			last := v.(msgIDState)
+			if now.Sub(last.at) <= c.window {
+				// 按uint16回绕比较：差值为0或落在后半区视为未递增
+				if diff := msg.MessageId - last.messageID; diff == 0 || diff >= 0x8000 {
+					return fmt.Sprintf("消息ID 0x%04X 未大于上一帧 0x%04X", msg.MessageId, last.messageID), clipOffendingBytes(raw, msgIDPos, MessageIDLength), false
+				}
+			}
+		}
+	case ConformanceKindPayloadLength:
+		for _, n := range rule.Lengths {
+			if len(msg.Data) == n {
+				return "", nil, true
+			}
+		}
+		return fmt.Sprintf("数据域长度 %d，规范要求 %v", len(msg.Data), rule.Lengths), clipOffendingBytes(msg.Data, 0, len(msg.Data)), false
+	case ConformanceKindPayloadCount:
+		if len(msg.Data) <= rule.CountOffset {
+			return fmt.Sprintf("数据域长度 %d，缺少偏移 %d 处的数量字段", len(msg.Data), rule.CountOffset), clipOffendingBytes(msg.Data, 0, len(msg.Data)), false
+		}
+		count := int(msg.Data[rule.CountOffset])
+		if want := rule.Base + count*rule.PerItem; len(msg.Data) != want {
+			return fmt.Sprintf("数据域长度 %d，按数量字段 %d 应为 %d", len(msg.Data), count, want), clipOffendingBytes(msg.Data, 0, len(msg.Data)), false
+		}
+	}
+	return "", nil, true
+}
+
+func (c *ConformanceChecker) record(v ConformanceViolation) {
+	c.mu.Lock()
+	if len(c.violations) < c.capacity {
+		c.violations = append(c.violations, v)
+	} else {
+		c.violations[c.next] = v
+	}
+	c.next = (c.next + 1) % c.capacity
+	c.total++
+	c.mu.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"connID":    v.ConnID,
+		"deviceID":  v.DeviceID,
+		"command":   v.Command,
+		"messageID": v.MessageID,
+		"rule":      v.RuleID,
+		"detail":    v.Detail,
+		"action":    v.Action,
+	}).Warn("⚠️ 协议一致性违规（严格模式）")
+}
+
+// Violations 最近的违规记录（新→旧）与累计违规数
+func (c *ConformanceChecker) Violations(limit int) ([]ConformanceViolation, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.violations)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	items := make([]ConformanceViolation, 0, limit)
+	for i := 0; i < limit; i++ {
+		idx := (c.next - 1 - i + 2*n) % n
+		items = append(items, c.violations[idx])
+	}
+	return items, c.total
+}
+
+func containsCommand(commands []uint8, cmd uint8) bool {
+	for _, c := range commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// clipOffendingBytes 截取问题字节（越界时按实际长度，最多 maxConformanceOffendingBytes 字节）
+func clipOffendingBytes(data []byte, offset, length int) []byte {
+	if offset >= len(data) {
+		return nil
+	}
+	end := offset + length
+	if end > len(data) {
+		end = len(data)
+	}
+	if end-offset > maxConformanceOffendingBytes {
+		end = offset + maxConformanceOffendingBytes
+	}
+	return data[offset:end]
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalConformanceChecker atomic.Pointer[ConformanceChecker]
+
+// GetGlobalConformanceChecker 获取全局一致性检查器，所有监听器均为宽松模式时返回nil
+func GetGlobalConformanceChecker() *ConformanceChecker {
+	return globalConformanceChecker.Load()
+}
+
+// InitGlobalConformanceChecker 创建全局一致性检查器（已存在时直接返回）
+func InitGlobalConformanceChecker(opts ConformanceOptions) *ConformanceChecker {
+	if c := globalConformanceChecker.Load(); c != nil {
+		return c
+	}
+	c := NewConformanceChecker(opts)
+	if !globalConformanceChecker.CompareAndSwap(nil, c) {
+		return globalConformanceChecker.Load()
+	}
+	return c
+}
+
+// SetGlobalConformanceChecker 替换全局一致性检查器（测试使用，传nil表示停用）
+func SetGlobalConformanceChecker(c *ConformanceChecker) {
+	globalConformanceChecker.Store(c)
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import "github.com/bujia-iot/iot-zinx/pkg/constants"
+
+// 一致性规则类型（由 ConformanceChecker 按类型执行规则数据）
+const (
+	ConformanceKindFrameDecodable     = "frame_decodable"      // 帧可完整解析（包头、长度、校验和）
+	ConformanceKindPhysicalIDNonZero  = "physical_id_nonzero"  // 物理ID不为0
+	ConformanceKindMessageIDNonZero   = "message_id_nonzero"   // 消息ID不为0x0000
+	ConformanceKindMessageIDMonotonic = "message_id_monotonic" // 同一设备窗口内消息ID单调递增（允许回绕）
+	ConformanceKindPayloadLength      = "payload_length"       // 数据域长度为规范规定的取值之一
+	ConformanceKindPayloadCount       = "payload_length_count" // 数据域长度 = Base + 数量字段 × PerItem
+)
+
+// ConformanceRule 协议一致性规则（声明式数据：新增规则只需追加条目并补充测试向量）
+type ConformanceRule struct {
+	ID          string  `json:"id"`
+	Kind        string  `json:"kind"`
+	Commands    []uint8 `json:"commands,omitempty"`     // 适用的上行命令，为空表示全部DNY帧
+	Lengths     []int   `json:"lengths,omitempty"`      // payload_length：允许的数据域长度
+	CountOffset int     `json:"count_offset,omitempty"` // payload_length_count：数量字段在数据域中的偏移（1字节）
+	Base        int     `json:"base,omitempty"`         // payload_length_count：固定部分长度
+	PerItem     int     `json:"per_item,omitempty"`     // payload_length_count：每项长度
+	Description string  `json:"description"`
+}
+
+// DefaultConformanceRules AP3000 规范的一致性规则集（上行帧）
+var DefaultConformanceRules = []ConformanceRule{
+	{ID: "frame.decodable", Kind: ConformanceKindFrameDecodable, Description: "帧必须可完整解析：包头DNY、长度字段与实际一致、校验和正确"},
+	{ID: "header.physical_id_nonzero", Kind: ConformanceKindPhysicalIDNonZero, Description: "物理ID不得为0"},
+	{ID: "header.message_id_nonzero", Kind: ConformanceKindMessageIDNonZero, Description: "消息ID不得为0x0000"},
+	{ID: "header.message_id_monotonic", Kind: ConformanceKindMessageIDMonotonic, Description: "同一设备在检查窗口内消息ID必须单调递增（0xFFFF后回绕）"},
+	{ID: "payload.0x02_swipe_card", Kind: ConformanceKindPayloadCount, Commands: []uint8{constants.CmdSwipeCard}, CountOffset: 12, Base: 13, PerItem: 1, Description: "刷卡(0x02)：卡片ID(4)+卡类型(1)+端口(1)+余额(2)+时间戳(4)+卡号2字节数(1)+卡号2(N)"},
+	{ID: "payload.0x03_settlement", Kind: ConformanceKindPayloadLength, Commands: []uint8{constants.CmdSettlement}, Lengths: []int{37}, Description: "结算(0x03)：数据域固定37字节"},
+	{ID: "payload.0x20_register", Kind: ConformanceKindPayloadLength, Commands: []uint8{constants.CmdDeviceRegister}, Lengths: []int{6, 8}, Description: "设备注册(0x20)：6字节，带电源板版本号时8字节"},
+	{ID: "payload.0x21_heartbeat", Kind: ConformanceKindPayloadCount, Commands: []uint8{constants.CmdDeviceHeart}, CountOffset: 2, Base: 5, PerItem: 1, Description: "设备心跳(0x21)：电压(2)+端口数(1)+端口状态(N)+信号(1)+温度(1)"},
+}
+
+// conformanceNAKCommands 规范定义了状态应答的上行命令：严格模式下违规时应答失败状态（NAK），其余命令直接丢弃
+var conformanceNAKCommands = map[uint8]bool{
+	constants.CmdSettlement:     true,
+	constants.CmdDeviceRegister: true,
+}
@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/sirupsen/logrus"
+)
+
+// SetListenerDialect 固定该监听器所有连接的协议方言（须在服务器启动前设置，空表示按注册帧特征识别）
+func (d *DNY_Decoder) SetListenerDialect(name dialect.Name) {
+	d.dialect = name
+}
+
+// applyDialect 方言连接的上行标准帧转换为AP3000格式（消息ID字节序、载荷字段顺序与枚举），之后的一致性检查与处理器只看到标准格式；
+// 注册完成前的注册帧按特征识别方言（监听器固定或手动指定时不覆盖）
+func (d *DNY_Decoder) applyDialect(connID uint64, msg *dny_protocol.Message) {
+	tracker := dialect.GetGlobalTracker()
+	binding, bound := tracker.Get(connID)
+	if !bound && d.dialect != "" {
+		_ = tracker.Bind(connID, d.dialect, dialect.SourceListener)
+		binding, bound = tracker.Get(connID)
+	}
+	if uint8(msg.CommandId) == constants.CmdDeviceRegister && !binding.Locked() {
+		if name, ok := dialect.DetectRegister(msg.Data); ok && (!bound || name != binding.Dialect) {
+			if err := tracker.Bind(connID, name, dialect.SourceDetected); err == nil && tracker.Dialect(connID) == name {
+				logger.WithFields(logrus.Fields{
+					"connID":   connID,
+					"dialect":  name,
+					"previous": binding.Dialect,
+				}).Info("解码器：按注册帧特征识别协议方言")
+			}
+		}
+	}
+
+	name := tracker.Dialect(connID)
+	if name == dialect.AP3000 {
+		return
+	}
+	command := uint8(msg.CommandId)
+	messageID, payload, err := dialect.ToCanonical(name, command, msg.MessageId, msg.Data)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"connID":  connID,
+			"dialect": name,
+			"command": dny_protocol.CommandLabel(command),
+			"error":   err.Error(),
+		}).Warn("解码器：方言帧转换失败")
+		msg.MessageType = "error"
+		msg.ErrorMessage = err.Error()
+		return
+	}
+	raw := dny_protocol.BuildFrame(msg.PhysicalId, messageID, command, payload)
+	msg.RawData = raw
+	msg.Data = raw[dnyPayloadOffset : len(raw)-ChecksumLength]
+	msg.DataLen = uint32(len(msg.Data))
+	msg.MessageId = messageID
+	msg.Checksum = dny_protocol.Checksum(raw[:len(raw)-ChecksumLength])
+}
@@ -1,12 +1,22 @@
 package protocol
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
 	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
 	"github.com/bujia-iot/iot-zinx/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -34,16 +44,95 @@ const (
 // DNY_Decoder - DNY协议解码器实现（符合Zinx框架规范）
 // -----------------------------------------------------------------------------
 
+// frameRemainderTTL 半包缓存有效期，超时未收到后续数据则丢弃
+const frameRemainderTTL = 30 * time.Second
+
+// dnyPayloadOffset 标准DNY帧中数据域的起始偏移：包头(3)+长度(2)+物理ID(4)+消息ID(2)+命令(1)
+const dnyPayloadOffset = PacketHeaderLength + DataLengthBytes + PhysicalIDLength + MessageIDLength + CommandLength
+
 // DNY_Decoder DNY协议解码器
 // 严格按照Zinx框架的IDecoder接口规范实现
 // 支持ICCID、link心跳、DNY标准协议的混合解析
-type DNY_Decoder struct{}
+//
+// 内存约定：Zinx在同一连接上复用读缓冲，而处理器在工作池中异步执行，
+// 因此交给处理器的帧数据（RawData/Data）在解码器内一次性复制到按帧长分配的独立切片，处理器可长期持有；
+// 跨读取的半包与拼接缓冲均借用 utils.PooledBuffer，仅在解码器内部使用，不会传递给处理器
+type DNY_Decoder struct {
+	remainders  sync.Map            // connID → *frameRemainder
+	conformance *ConformanceChecker // 严格模式一致性检查器（宽松模式为nil）
+	garbage     *GarbageTracker     // 杂散数据跟踪器（nil 时使用全局实例）
+	checksum    *ChecksumVerifier   // 校验和处置器（nil 时使用全局实例）
+	synced      sync.Map            // connID → struct{}：已识别到首个报文，不再做前导扫描
+	onFrame     FrameObserver       // 每解出一个完整帧时回调（自适应读超时）
+	onNAK       NegativeAckHandler  // 否定应答处理（结束对应的待应答命令）
+	onResponse  ResponseObserver    // 标准帧路由前回调（同步命令应答匹配）
+	dialect     dialect.Name        // 监听器固定的协议方言（空表示按注册帧特征识别）
+}
+
+// FrameObserver 完整帧观察回调
+type FrameObserver func(conn ziface.IConnection, at time.Time)
+
+// NegativeAckHandler 否定应答处理：返回true表示该帧已作为否定应答处理，不再路由到处理器
+type NegativeAckHandler func(conn ziface.IConnection, msg *dny_protocol.Message) bool
+
+// ResponseObserver 标准帧观察回调：在路由到处理器之前调用，不影响后续处理
+type ResponseObserver func(conn ziface.IConnection, msg *dny_protocol.Message)
+
+// frameRemainder 连接上未完整的半包数据
+type frameRemainder struct {
+	buf *utils.PooledBuffer
+	at  time.Time
+}
 
 // NewDNYDecoder 创建DNY协议解码器
 func NewDNYDecoder() ziface.IDecoder {
 	return &DNY_Decoder{}
 }
 
+// SetConformance 启用严格模式一致性检查（须在服务器启动前设置，传nil恢复宽松模式）
+func (d *DNY_Decoder) SetConformance(checker *ConformanceChecker) {
+	d.conformance = checker
+}
+
+// SetGarbageTracker 设置杂散数据跟踪器（须在服务器启动前设置）
+func (d *DNY_Decoder) SetGarbageTracker(tracker *GarbageTracker) {
+	d.garbage = tracker
+}
+
+// SetFrameObserver 设置完整帧观察回调（须在服务器启动前设置）
+func (d *DNY_Decoder) SetFrameObserver(observer FrameObserver) {
+	d.onFrame = observer
+}
+
+// SetNegativeAckHandler 设置否定应答处理（须在服务器启动前设置）
+func (d *DNY_Decoder) SetNegativeAckHandler(handler NegativeAckHandler) {
+	d.onNAK = handler
+}
+
+// SetResponseObserver 设置标准帧观察回调（须在服务器启动前设置）
+func (d *DNY_Decoder) SetResponseObserver(observer ResponseObserver) {
+	d.onResponse = observer
+}
+
+// SetChecksumVerifier 设置校验和处置器（须在服务器启动前设置，未设置时使用全局处置器）
+func (d *DNY_Decoder) SetChecksumVerifier(verifier *ChecksumVerifier) {
+	d.checksum = verifier
+}
+
+func (d *DNY_Decoder) checksumVerifier() *ChecksumVerifier {
+	if d.checksum != nil {
+		return d.checksum
+	}
+	return GetGlobalChecksumVerifier()
+}
+
+func (d *DNY_Decoder) garbageTracker() *GarbageTracker {
+	if d.garbage != nil {
+		return d.garbage
+	}
+	return GetGlobalGarbageTracker()
+}
+
 // GetLengthField 返回长度字段配置
 // 根据AP3000协议文档，我们需要自定义解析逻辑来处理多种协议格式
 func (d *DNY_Decoder) GetLengthField() *ziface.LengthField {
@@ -54,7 +143,17 @@ func (d *DNY_Decoder) GetLengthField() *ziface.LengthField {
 // Intercept 拦截器方法，实现多协议解析
 // 🔧 升级：使用多包分割器处理TCP流数据包拼接问题
 // 根据AP3000协议文档，处理ICCID、link心跳、DNY标准协议
+// 一次读取含多个报文（如 link 心跳后紧跟DNY帧）时，首个报文之后的完整报文在本次分发后按到达顺序逐个重新进入责任链
 func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
+	resp := d.intercept(chain)
+	if !isBufferedDispatch(chain) {
+		d.dispatchBuffered(d.getConnection(chain))
+	}
+	return resp
+}
+
+// intercept 解码一次读取（或半包缓存中的下一个完整报文）并传递给后续处理器
+func (d *DNY_Decoder) intercept(chain ziface.IChain) ziface.IcResp {
 	// 获取原始消息
 	iMessage := chain.GetIMessage()
 	if iMessage == nil {
@@ -63,7 +162,8 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 	}
 
 	rawData := iMessage.GetData()
-	if len(rawData) == 0 {
+	buffered := isBufferedDispatch(chain)
+	if len(rawData) == 0 && !buffered {
 		logger.Debug("解码器：接收到空数据，等待更多数据")
 		return chain.ProceedWithIMessage(nil, nil)
 	}
@@ -71,80 +171,275 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 	// 获取连接信息
 	conn := d.getConnection(chain)
 	connID := d.getConnID(conn)
+	var trace core.ConnTrace
+	if conn != nil && !buffered {
+		// 缓存中的报文字节已在到达时记录
+		trace = core.RecordConnInbound(connID, rawData)
+	}
+
+	_, wasSynced := d.synced.Load(connID)
+	msgID, firstMsg := d.decodeFrame(conn, connID, rawData)
+	if trace != nil {
+		trace.Note(describeDecoded(firstMsg), time.Now())
+	}
+	if !wasSynced && conn != nil {
+		tracker := d.garbageTracker()
+		tracker.NoteRemoteAddr(connID, conn.RemoteAddrString())
+		if firstMsg == nil && tracker.Exceeded(connID) {
+			d.closeForGarbage(conn)
+		}
+	}
+	if firstMsg == nil {
+		return chain.ProceedWithIMessage(nil, nil)
+	}
+	if d.onFrame != nil && conn != nil {
+		d.onFrame(conn, time.Now())
+	}
+
+	// 否定应答：直接结束对应的待应答命令（通用错误帧没有处理器，严格模式下也不应被当作违规帧）
+	if d.onNAK != nil && conn != nil && firstMsg.MessageType == "standard" && d.onNAK(conn, firstMsg) {
+		return chain.ProceedWithIMessage(nil, nil)
+	}
+
+	// 严格模式：违反协议规范的帧应答NAK或丢弃，不进入处理器
+	if d.conformance != nil {
+		if violation := d.conformance.Check(connID, firstMsg, time.Now()); violation != nil {
+			if trace != nil {
+				trace.Note(fmt.Sprintf("conformance violation: rule=%s action=%s %s", violation.RuleID, violation.Action, violation.Detail), time.Now())
+			}
+			if physicalID, messageID, command, nak := violation.NAK(); nak && conn != nil {
+				if err := SendDNYResponse(conn, physicalID, messageID, command, []byte{constants.StatusError}); err != nil {
+					logger.WithFields(logrus.Fields{"connID": connID, "error": err.Error()}).Warn("解码器：发送一致性NAK失败")
+				}
+			}
+			return chain.ProceedWithIMessage(nil, nil)
+		}
+	}
+
+	if d.onResponse != nil && firstMsg.MessageType == "standard" {
+		d.onResponse(conn, firstMsg)
+	}
+
+	// 使用解码后的独立帧数据进行路由分发
+	iMessage.SetMsgID(msgID)
+	iMessage.SetData(firstMsg.RawData)
+	iMessage.SetDataLen(uint32(len(firstMsg.RawData)))
+
+	// 🔧 关键修复：确保统一DNY消息对象正确传递给后续处理器
+	// 将解析的DNY消息对象保存到IMessage的扩展属性中，供后续处理器使用
+	if req, ok := chain.Request().(interface {
+		SetProperty(key string, value interface{})
+	}); ok {
+		req.SetProperty("dny_message", firstMsg)
+	}
+
+	// 记录成功传递DNY消息对象
+	logger.WithFields(logrus.Fields{
+		"connID":      connID,
+		"messageType": firstMsg.MessageType,
+		"msgID":       msgID,
+	}).Debug("解码器：成功传递统一DNY消息对象")
+
+	return chain.ProceedWithIMessage(iMessage, firstMsg)
+}
+
+// describeDecoded 抽样跟踪中的解码结果注释
+func describeDecoded(msg *dny_protocol.Message) string {
+	if msg == nil {
+		return "decode: no complete frame (partial buffered or preamble skipped)"
+	}
+	switch msg.MessageType {
+	case "standard":
+		return fmt.Sprintf("decode: standard cmd=0x%02X msgId=0x%04X physicalId=%08X dataLen=%d", msg.CommandId, msg.MessageId, msg.PhysicalId, len(msg.Data))
+	case "iccid":
+		return "decode: iccid " + msg.ICCIDValue
+	case "error":
+		return "decode error: " + msg.ErrorMessage
+	default:
+		return "decode: " + msg.MessageType
+	}
+}
+
+// DecodeFrame 解码一次读取的数据，返回路由消息ID与第一条完整消息
+// 返回的消息数据为独立分配的切片，不引用 rawData；数据不完整时返回 nil，半包缓存到下次读取
+func (d *DNY_Decoder) DecodeFrame(connID uint64, rawData []byte) (uint32, *dny_protocol.Message) {
+	return d.decodeFrame(nil, connID, rawData)
+}
+
+// decodeFrame 同 DecodeFrame，conn 不为nil时对严格模式下校验和错误的帧应答NAK（包头可信时）；解出的报文记录到流量日志
+func (d *DNY_Decoder) decodeFrame(conn ziface.IConnection, connID uint64, rawData []byte) (uint32, *dny_protocol.Message) {
+	msgID, msg := d.decodeNext(conn, connID, rawData)
+	if msg != nil && logger.GetTrafficLogger() != nil {
+		logger.LogTraffic(inboundTraffic(connID, msg))
+	}
+	return msgID, msg
+}
 
-	// 详细日志记录
+// inboundTraffic 上行报文的流量日志记录
+func inboundTraffic(connID uint64, msg *dny_protocol.Message) logger.TrafficFrame {
+	frame := logger.TrafficFrame{Direction: logger.TrafficInbound, ConnID: connID, Data: msg.RawData}
+	switch msg.MessageType {
+	case "standard":
+		frame.Kind = logger.TrafficKindDNY
+		frame.DeviceID = utils.FormatPhysicalID(msg.PhysicalId)
+		frame.Command = uint8(msg.CommandId)
+		frame.MessageID = msg.MessageId
+	case "iccid":
+		frame.Kind = logger.TrafficKindICCID
+	case "heartbeat_link":
+		frame.Kind = logger.TrafficKindLink
+	default:
+		frame.Kind = logger.TrafficKindError
+		frame.Err = errors.New(msg.ErrorMessage)
+	}
+	return frame
+}
+
+// decodeNext 解码拼接半包后的第一个完整报文
+func (d *DNY_Decoder) decodeNext(conn ziface.IConnection, connID uint64, rawData []byte) (uint32, *dny_protocol.Message) {
+	// 详细日志记录（十六进制仅在Debug级别实际输出时编码）
 	logger.WithFields(logrus.Fields{
 		"connID":     connID,
 		"dataLen":    len(rawData),
-		"dataHex":    fmt.Sprintf("%.200x", rawData), // 显示前200字节
-		"dataString": d.safeStringConvert(rawData),
+		"dataHex":    utils.LazyHexN(rawData, 200), // 显示前200字节
+		"dataString": printableBytes(rawData),
 	}).Debug("解码器：接收到原始数据")
 
-	// 先快速检测非DNY直传报文：ICCID 与 link 心跳（AP3000 规定）
-	if iccid := d.tryParseICCIDDirect(rawData, connID); iccid != nil {
-		// 记录到通信日志
-		logger.LogReceiveData(connID, len(iccid), "ICCID", string(iccid), 0)
+	// 拼接上次读取遗留的半包
+	input := rawData
+	var assembled *utils.PooledBuffer
+	if pending := d.takeRemainder(connID); pending != nil {
+		assembled = utils.GetBuffer(pending.Len() + len(rawData))
+		buf := assembled.Bytes()
+		copy(buf, pending.Bytes())
+		copy(buf[pending.Len():], rawData)
 		logger.WithFields(logrus.Fields{
-			"connID": connID,
-			"iccid":  string(iccid),
-		}).Info("解码器：成功解析ICCID消息")
+			"connID":       connID,
+			"pendingLen":   pending.Len(),
+			"dataLen":      len(rawData),
+			"assembledLen": len(buf),
+		}).Debug("解码器：拼接上次剩余的半包数据")
+		pending.Release()
+		input = buf
+	}
+	defer assembled.Release()
+	if len(input) == 0 {
+		return 0, nil
+	}
 
-		iMessage.SetMsgID(constants.MsgIDICCID)
-		iMessage.SetData(iccid)
-		iMessage.SetDataLen(uint32(len(iccid)))
-		return chain.ProceedWithIMessage(iMessage, &dny_protocol.Message{
-			MessageType: "iccid",
-			RawData:     iccid,
-			ICCIDValue:  string(iccid),
-		})
+	// 首个报文之前：跳过前导杂散数据（如路由器PPP重拨时的AT指令回显），超过预算则放弃该连接
+	tracker := d.garbageTracker()
+	if _, synced := d.synced.Load(connID); !synced {
+		if tracker.Exceeded(connID) {
+			return 0, nil
+		}
+		start, complete := findFirstToken(input)
+		if start > 0 {
+			exceeded := tracker.NoteSkipped(connID, input[:start], true)
+			logger.WithFields(logrus.Fields{
+				"connID":     connID,
+				"skipped":    start,
+				"skippedHex": utils.LazyHexN(input[:start], 64),
+				"skippedStr": printableBytes(input[:start]),
+				"budget":     tracker.Budget(),
+			}).Info("解码器：跳过首个报文之前的杂散数据")
+			if exceeded {
+				logger.WithFields(logrus.Fields{
+					"connID": connID,
+					"budget": tracker.Budget(),
+				}).Warn("解码器：前导杂散数据超过预算，放弃该连接")
+				return 0, nil
+			}
+			input = input[start:]
+		}
+		if !complete {
+			// 可能是被拆包的报文开头，缓存等待后续数据
+			d.keepRemainder(connID, input)
+			return 0, nil
+		}
+		d.synced.Store(connID, struct{}{})
+		tracker.MarkSynced(connID)
 	}
 
-	if link := d.tryParseLinkHeartbeatDirect(rawData, connID); link != nil {
-		logger.LogReceiveData(connID, len(link), "LINK_HEARTBEAT", "", 0)
-		logger.WithFields(logrus.Fields{
-			"connID":  connID,
-			"content": string(link),
-		}).Info("解码器：成功解析link心跳包")
+	// 先快速检测非DNY直传报文：ICCID 与 link 心跳（AP3000 规定）
+	if assembled == nil {
+		if iccid := d.tryParseICCIDDirect(input, connID); iccid != nil {
+			iccid = cloneBytes(iccid)
+			// 记录到通信日志
+			logger.LogReceiveData(connID, len(iccid), "ICCID", string(iccid), 0)
+			logger.WithFields(logrus.Fields{
+				"connID": connID,
+				"iccid":  string(iccid),
+			}).Debug("解码器：成功解析ICCID消息")
+
+			return constants.MsgIDICCID, &dny_protocol.Message{
+				MessageType: "iccid",
+				RawData:     iccid,
+				ICCIDValue:  string(iccid),
+			}
+		}
 
-		iMessage.SetMsgID(constants.MsgIDLinkHeartbeat)
-		iMessage.SetData(link)
-		iMessage.SetDataLen(uint32(len(link)))
-		return chain.ProceedWithIMessage(iMessage, &dny_protocol.Message{
-			MessageType: "heartbeat_link",
-			RawData:     link,
-		})
+		if link := d.tryParseLinkHeartbeatDirect(input, connID); link != nil {
+			link = cloneBytes(link)
+			logger.LogReceiveData(connID, len(link), "LINK_HEARTBEAT", "", 0)
+			logger.WithFields(logrus.Fields{
+				"connID":  connID,
+				"content": string(link),
+			}).Debug("解码器：成功解析link心跳包")
+
+			return constants.MsgIDLinkHeartbeat, &dny_protocol.Message{
+				MessageType: "heartbeat_link",
+				RawData:     link,
+			}
+		}
 	}
 
 	// 🔧 新实现：使用多包分割器处理TCP流数据
-	messages, remaining, err := ParseMultiplePackets(rawData)
+	onInvalid := func(packet []byte, msg *dny_protocol.Message, parseErr error) bool {
+		var checksumErr *ChecksumError
+		if errors.As(parseErr, &checksumErr) {
+			// 校验和错误按命令分类的模式处置：lenient/off 照常处理，strict 丢弃并NAK（设备据此重发，如结算）。
+			// 包头字段取自校验失败的帧，只有物理ID是本连接已绑定的设备且命令已知时才应答，否则只丢弃
+			if d.checksumVerifier().Check(connID, packet, msg).Accept {
+				msg.MessageType = "standard"
+				msg.ErrorMessage = ""
+				return true
+			}
+			if conn != nil {
+				if reason := checksumNAKRejection(connID, msg); reason != "" {
+					logger.WithFields(logrus.Fields{
+						"connID":     connID,
+						"physicalID": fmt.Sprintf("0x%08X", msg.PhysicalId),
+						"command":    fmt.Sprintf("0x%02X", msg.CommandId),
+						"reason":     reason,
+					}).Warn("解码器：校验和错误帧的包头不可信，丢弃且不应答NAK")
+				} else if err := SendDNYResponse(conn, msg.PhysicalId, msg.MessageId, uint8(msg.CommandId), []byte{constants.StatusError}); err != nil {
+					logger.WithFields(logrus.Fields{"connID": connID, "error": err.Error()}).Warn("解码器：发送校验和NAK失败")
+				}
+			}
+		}
+		if checker := d.conformance; checker != nil {
+			// 一致性严格模式：记录被丢弃的不可解析帧（宽松模式下同样丢弃，只是不记录）
+			checker.Check(connID, &dny_protocol.Message{MessageType: "error", ErrorMessage: parseErr.Error(), RawData: packet}, time.Now())
+		}
+		return false
+	}
+	onSkip := func(skipped []byte) { tracker.NoteSkipped(connID, skipped, false) }
+	messages, remaining, err := parseMultiplePackets(input, onInvalid, onSkip)
 	if err != nil {
 		logger.WithFields(logrus.Fields{
 			"connID":  connID,
 			"error":   err.Error(),
-			"dataLen": len(rawData),
-			"dataHex": fmt.Sprintf("%.100x", rawData),
+			"dataLen": len(input),
+			"dataHex": utils.LazyHexN(input, 100),
 		}).Warn("解码器：多包解析失败，创建错误类型的DNY消息")
 
 		// 🔧 改进：即使解析失败，也创建一个错误类型的DNY消息对象
-		errorMsg := &dny_protocol.Message{
+		return constants.MsgIDUnknown, &dny_protocol.Message{
 			MessageType:  "error",
 			ErrorMessage: fmt.Sprintf("协议解析失败: %v", err),
-			RawData:      rawData,
+			RawData:      cloneBytes(input),
 		}
-
-		// 设置消息路由信息
-		iMessage.SetMsgID(constants.MsgIDUnknown)
-		iMessage.SetData(rawData)
-		iMessage.SetDataLen(uint32(len(rawData)))
-
-		// 保存DNY消息对象到扩展属性
-		if req, ok := chain.Request().(interface {
-			SetProperty(key string, value interface{})
-		}); ok {
-			req.SetProperty("dny_message", errorMsg)
-		}
-
-		return chain.ProceedWithIMessage(iMessage, errorMsg)
 	}
 
 	// 记录分割结果
@@ -154,23 +449,36 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 		"remainingLen": len(remaining),
 	}).Debug("解码器：成功分割数据包")
 
+	// 缓存剩余的半包，等待下次数据到达；首个报文之后已完整的报文一并放回缓存，由 Intercept 按到达顺序逐个分发
+	if len(messages) > 1 {
+		remaining = joinPending(messages[1:], remaining)
+	}
+	d.keepRemainder(connID, remaining)
+
 	// 如果没有解析出任何消息
 	if len(messages) == 0 {
 		if len(remaining) > 0 {
 			logger.WithFields(logrus.Fields{
 				"connID":       connID,
 				"remainingLen": len(remaining),
-				"remainingHex": fmt.Sprintf("%.100x", remaining),
+				"remainingHex": utils.LazyHexN(remaining, 100),
 			}).Debug("解码器：数据包不完整，等待更多数据")
 		}
-		return chain.ProceedWithIMessage(nil, nil)
+		return 0, nil
 	}
 
 	// 处理第一个消息（Zinx框架一次只能处理一个消息）
 	// TODO: 后续可优化为批量处理机制
-	firstMsg := messages[0]
+	firstMsg := detachMessage(messages[0])
+	if firstMsg.MessageType == "standard" {
+		d.applyPayloadCrypto(connID, firstMsg)
+	}
+	if firstMsg.MessageType == "standard" {
+		d.applyDialect(connID, firstMsg)
+	}
 
 	// 根据消息类型设置路由信息
+	var msgID uint32
 	switch firstMsg.MessageType {
 	case "iccid":
 		// 记录到通信日志
@@ -179,11 +487,9 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 		logger.WithFields(logrus.Fields{
 			"connID": connID,
 			"iccid":  firstMsg.ICCIDValue,
-		}).Info("解码器：成功解析ICCID消息")
+		}).Debug("解码器：成功解析ICCID消息")
 
-		iMessage.SetMsgID(constants.MsgIDICCID)
-		iMessage.SetData(firstMsg.RawData)
-		iMessage.SetDataLen(uint32(len(firstMsg.RawData)))
+		msgID = constants.MsgIDICCID
 
 	case "heartbeat_link":
 		// 记录到通信日志
@@ -192,30 +498,27 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 		logger.WithFields(logrus.Fields{
 			"connID":  connID,
 			"content": string(firstMsg.RawData),
-		}).Info("解码器：成功解析link心跳包")
+		}).Debug("解码器：成功解析link心跳包")
 
-		iMessage.SetMsgID(constants.MsgIDLinkHeartbeat)
-		iMessage.SetData(firstMsg.RawData)
-		iMessage.SetDataLen(uint32(len(firstMsg.RawData)))
+		msgID = constants.MsgIDLinkHeartbeat
 
 	case "standard":
 		// 记录到通信日志
 		deviceID := utils.FormatPhysicalID(firstMsg.PhysicalId)
 
 		logger.LogReceiveData(connID, len(firstMsg.RawData), "DNY_STANDARD", deviceID, uint8(firstMsg.CommandId))
+		commlog.RecordUplink(deviceID, firstMsg.RawData)
 
 		logger.WithFields(logrus.Fields{
 			"connID":     connID,
 			"frameLen":   len(firstMsg.RawData),
 			"physicalID": fmt.Sprintf("0x%08X", firstMsg.PhysicalId),
-			"commandID":  fmt.Sprintf("0x%02X", firstMsg.CommandId),
+			"commandID":  dny_protocol.CommandLabel(uint8(firstMsg.CommandId)),
 			"messageID":  fmt.Sprintf("0x%04X", firstMsg.MessageId),
-		}).Info("解码器：成功解析DNY标准协议帧")
+		}).Debug("解码器：成功解析DNY标准协议帧")
 
 		// 使用CommandId进行路由分发
-		iMessage.SetMsgID(uint32(firstMsg.CommandId))
-		iMessage.SetData(firstMsg.RawData)
-		iMessage.SetDataLen(uint32(len(firstMsg.RawData)))
+		msgID = firstMsg.CommandId
 
 	case "error":
 		logger.WithFields(logrus.Fields{
@@ -224,9 +527,7 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 		}).Warn("解码器：协议帧解析失败")
 
 		// 错误消息使用未知类型处理
-		iMessage.SetMsgID(constants.MsgIDUnknown)
-		iMessage.SetData(firstMsg.RawData)
-		iMessage.SetDataLen(uint32(len(firstMsg.RawData)))
+		msgID = constants.MsgIDUnknown
 
 	default:
 		logger.WithFields(logrus.Fields{
@@ -234,60 +535,208 @@ func (d *DNY_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 			"messageType": firstMsg.MessageType,
 		}).Warn("解码器：未知消息类型")
 
-		iMessage.SetMsgID(constants.MsgIDUnknown)
-		iMessage.SetData(firstMsg.RawData)
-		iMessage.SetDataLen(uint32(len(firstMsg.RawData)))
+		msgID = constants.MsgIDUnknown
 	}
 
-	// 如果有多个消息，记录警告（当前框架限制）
 	if len(messages) > 1 {
 		logger.WithFields(logrus.Fields{
-			"connID":           connID,
-			"totalMessages":    len(messages),
-			"processedMessage": 1,
-			"skippedMessages":  len(messages) - 1,
-		}).Warn("解码器：检测到多个协议包，当前只处理第一个（框架限制）")
+			"connID":         connID,
+			"totalMessages":  len(messages),
+			"bufferedFrames": len(messages) - 1,
+		}).Debug("解码器：一次读取含多个报文，其余报文已缓存待逐个分发")
+	}
 
-		// TODO: 未来优化 - 可以考虑将剩余消息缓存到连接上下文中
+	return msgID, firstMsg
+}
+
+// bufferedDispatchKey 请求属性：该请求由解码器重新注入，用于分发半包缓存中的下一个完整报文
+const bufferedDispatchKey = "dny_buffered_dispatch"
+
+// maxBufferedDispatch 单次读取后最多重新注入的缓存报文数（防止异常数据导致长时间占用读协程）
+const maxBufferedDispatch = 64
+
+// isBufferedDispatch 请求是否为解码器重新注入的缓存报文分发
+func isBufferedDispatch(chain ziface.IChain) bool {
+	req, ok := chain.Request().(ziface.IRequest)
+	if !ok || req == nil {
+		return false
+	}
+	v, ok := req.Get(bufferedDispatchKey)
+	return ok && v == true
+}
+
+// dispatchBuffered 半包缓存中存在完整报文时，逐个以新请求重新进入连接的责任链（与读协程同步执行，保持到达顺序）
+func (d *DNY_Decoder) dispatchBuffered(conn ziface.IConnection) {
+	if conn == nil {
+		return
+	}
+	connID := d.getConnID(conn)
+	for i := 0; i < maxBufferedDispatch && d.PendingFrameReady(connID); i++ {
+		handler := conn.GetMsgHandler()
+		if handler == nil {
+			return
+		}
+		req := znet.NewRequest(conn, zpack.NewMessage(0, nil))
+		req.Set(bufferedDispatchKey, true)
+		handler.Execute(req)
 	}
+}
 
-	// 如果有剩余数据，记录信息
-	if len(remaining) > 0 {
+// PendingFrameReady 连接的半包缓存中是否已有完整报文（ICCID、link 心跳或声明长度已到齐的DNY帧）
+func (d *DNY_Decoder) PendingFrameReady(connID uint64) bool {
+	v, ok := d.remainders.Load(connID)
+	if !ok {
+		return false
+	}
+	data := v.(*frameRemainder).buf.Bytes()
+	start, complete := findFirstToken(data)
+	if !complete {
+		return false
+	}
+	rest := data[start:]
+	if string(rest[:min(len(rest), PacketHeaderLength)]) != constants.ProtocolHeader {
+		return true
+	}
+	if len(rest) < PacketHeaderLength+DataLengthBytes {
+		return false
+	}
+	declared := int(binary.LittleEndian.Uint16(rest[PacketHeaderLength:]))
+	return len(rest) >= PacketHeaderLength+DataLengthBytes+declared
+}
+
+// joinPending 首个报文之后的完整报文与末尾半包按到达顺序拼接
+func joinPending(messages []*dny_protocol.Message, remaining []byte) []byte {
+	size := len(remaining)
+	for _, msg := range messages {
+		size += len(msg.RawData)
+	}
+	joined := make([]byte, 0, size)
+	for _, msg := range messages {
+		joined = append(joined, msg.RawData...)
+	}
+	return append(joined, remaining...)
+}
+
+// ReleaseConnection 连接关闭时释放该连接缓存的半包
+func (d *DNY_Decoder) ReleaseConnection(connID uint64) {
+	if v, ok := d.remainders.LoadAndDelete(connID); ok {
+		v.(*frameRemainder).buf.Release()
+	}
+	d.synced.Delete(connID)
+	d.garbageTracker().Release(connID)
+	dialect.GetGlobalTracker().Release(connID)
+	if m := payloadcrypto.GetGlobalManager(); m != nil {
+		m.Release(connID)
+	}
+}
+
+// closeForGarbage 前导杂散数据超过预算：按 garbage_preamble 原因清理并关闭连接
+func (d *DNY_Decoder) closeForGarbage(conn ziface.IConnection) {
+	connID := conn.GetConnID()
+	remoteAddr := conn.RemoteAddrString()
+	logger.WithFields(logrus.Fields{
+		"connID":     connID,
+		"remoteAddr": remoteAddr,
+		"reason":     CloseReasonGarbagePreamble,
+	}).Warn("解码器：前导杂散数据超过预算，关闭连接")
+	if tm := core.GetGlobalTCPManager(); tm == nil || !tm.DisconnectConnection(connID, CloseReasonGarbagePreamble) {
+		conn.Stop()
+	}
+}
+
+// takeRemainder 取出连接缓存的半包（过期则丢弃）
+func (d *DNY_Decoder) takeRemainder(connID uint64) *utils.PooledBuffer {
+	v, ok := d.remainders.LoadAndDelete(connID)
+	if !ok {
+		return nil
+	}
+	r := v.(*frameRemainder)
+	if time.Since(r.at) > frameRemainderTTL {
+		logger.WithFields(logrus.Fields{
+			"connID":     connID,
+			"pendingLen": r.buf.Len(),
+		}).Debug("解码器：丢弃过期的半包数据")
+		r.buf.Release()
+		return nil
+	}
+	return r.buf
+}
+
+// keepRemainder 将剩余半包复制到池化缓冲中缓存
+func (d *DNY_Decoder) keepRemainder(connID uint64, remaining []byte) {
+	if len(remaining) == 0 {
+		return
+	}
+	if len(remaining) > MAX_BUFFER_SIZE {
 		logger.WithFields(logrus.Fields{
 			"connID":       connID,
 			"remainingLen": len(remaining),
-			"remainingHex": fmt.Sprintf("%.50x", remaining),
-		}).Debug("解码器：存在剩余未完整数据")
+			"maxLen":       MAX_BUFFER_SIZE,
+		}).Warn("解码器：半包数据超过缓冲上限，已丢弃")
+		return
+	}
+	buf := utils.GetBuffer(len(remaining))
+	copy(buf.Bytes(), remaining)
+	d.remainders.Store(connID, &frameRemainder{buf: buf, at: time.Now()})
 
-		// TODO: 将剩余数据缓存到连接上下文中，等待下次数据到达
+	logger.WithFields(logrus.Fields{
+		"connID":       connID,
+		"remainingLen": len(remaining),
+		"remainingHex": utils.LazyHexN(remaining, 50),
+	}).Debug("解码器：存在剩余未完整数据，已缓存等待后续数据")
+}
+
+// detachMessage 将消息数据复制到按帧长分配的独立切片，使其不再引用读缓冲
+func detachMessage(msg *dny_protocol.Message) *dny_protocol.Message {
+	if len(msg.RawData) == 0 {
+		return msg
+	}
+	owned := cloneBytes(msg.RawData)
+	if msg.MessageType == "standard" && len(msg.Data) > 0 && dnyPayloadOffset+len(msg.Data) <= len(owned) {
+		msg.Data = owned[dnyPayloadOffset : dnyPayloadOffset+len(msg.Data)]
+	} else if len(msg.Data) > 0 {
+		msg.Data = cloneBytes(msg.Data)
 	}
+	msg.RawData = owned
+	return msg
+}
 
-	// 🔧 关键修复：确保统一DNY消息对象正确传递给后续处理器
-	// 将解析的DNY消息对象设置到消息的扩展属性中，供后续处理器使用
-	if firstMsg != nil {
-		// 将DNY消息对象保存到IMessage的扩展属性中
-		// 这样后续的命令处理器就能正确获取到统一的DNY消息对象
-		if req, ok := chain.Request().(interface {
-			SetProperty(key string, value interface{})
-		}); ok {
-			req.SetProperty("dny_message", firstMsg)
-		}
+func cloneBytes(data []byte) []byte {
+	owned := make([]byte, len(data))
+	copy(owned, data)
+	return owned
+}
 
-		// 记录成功传递DNY消息对象
-		logger.WithFields(logrus.Fields{
-			"connID":      connID,
-			"messageType": firstMsg.MessageType,
-			"msgID":       iMessage.GetMsgID(),
-		}).Debug("解码器：成功传递统一DNY消息对象")
-	} else {
-		// 如果没有解析出消息，记录警告
-		logger.WithFields(logrus.Fields{
-			"connID": connID,
-			"msgID":  iMessage.GetMsgID(),
-		}).Warn("解码器：未能解析出统一DNY消息对象")
+// printableBytes 日志用的可打印字符串（延迟转换），不可打印字符替换为点号
+type printableBytes []byte
+
+func (p printableBytes) String() string {
+	data := []byte(p)
+	if len(data) == 0 {
+		return ""
 	}
 
-	return chain.ProceedWithIMessage(iMessage, firstMsg)
+	// 限制显示长度，避免日志过长
+	maxLen := 100
+	if len(data) > maxLen {
+		data = data[:maxLen]
+	}
+
+	// 将不可打印字符替换为点号
+	result := make([]byte, len(data))
+	for i, b := range data {
+		if b >= 32 && b <= 126 { // 可打印ASCII字符
+			result[i] = b
+		} else {
+			result[i] = '.'
+		}
+	}
+
+	return string(result)
+}
+
+func (p printableBytes) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
 }
 
 // -----------------------------------------------------------------------------
@@ -379,31 +828,6 @@ func (d *DNY_Decoder) getConnID(conn ziface.IConnection) uint64 {
 	return 0
 }
 
-// safeStringConvert 安全地将字节数组转换为可打印字符串
-func (d *DNY_Decoder) safeStringConvert(data []byte) string {
-	if len(data) == 0 {
-		return ""
-	}
-
-	// 限制显示长度，避免日志过长
-	maxLen := 100
-	if len(data) > maxLen {
-		data = data[:maxLen]
-	}
-
-	// 将不可打印字符替换为点号
-	result := make([]byte, len(data))
-	for i, b := range data {
-		if b >= 32 && b <= 126 { // 可打印ASCII字符
-			result[i] = b
-		} else {
-			result[i] = '.'
-		}
-	}
-
-	return string(result)
-}
-
 // （移除）validateDNYChecksum：统一使用 protocol.CalculatePacketChecksumInternal
 
 // TestICCIDParsing 测试ICCID解析功能
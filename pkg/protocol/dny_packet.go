@@ -86,75 +86,19 @@ func (dp *DNYPacket) packDNYMessage(msg ziface.IMessage) ([]byte, error) {
 		return nil, errors.New(errMsg)
 	}
 
-	// 创建缓冲区
-	dataBuff := bytes.NewBuffer([]byte{})
-
-	// 写入包头"DNY" (3字节)
-	if _, err := dataBuff.WriteString(constants.ProtocolHeader); err != nil {
-		return nil, err
-	}
-
-	// 计算数据部分长度（物理ID + 消息ID + 命令 + 数据 + 校验）
-	dataPartLen := 4 + 2 + 1 + dnyMsg.GetDataLen() + 2
-
-	// 写入数据长度 (2字节，小端序)
-	if err := binary.Write(dataBuff, binary.LittleEndian, uint16(dataPartLen)); err != nil {
-		return nil, err
-	}
-
-	// 写入物理ID (4字节，小端序)
-	if err := binary.Write(dataBuff, binary.LittleEndian, dnyMsg.GetPhysicalId()); err != nil {
-		return nil, err
-	}
-
-	// 写入消息ID (2字节，小端序) - 🔧 修复：使用消息真实的 MessageId
-	if err := binary.Write(dataBuff, binary.LittleEndian, dnyMsg.MessageId); err != nil {
-		return nil, err
-	}
-
-	// 写入命令码 (1字节)
-	if err := dataBuff.WriteByte(byte(dnyMsg.GetMsgID())); err != nil {
-		return nil, err
-	}
-
-	// 写入消息体数据
-	if dnyMsg.GetDataLen() > 0 {
-		if err := binary.Write(dataBuff, binary.LittleEndian, dnyMsg.GetData()); err != nil {
-			return nil, err
-		}
-	}
-
-	// 获取完整的数据包（不包含校验和）
-	packetData := dataBuff.Bytes()
-
-	// 计算校验和（从包头到数据的累加和）
-	checksum, err := CalculatePacketChecksumInternal(packetData)
-	if err != nil {
-		// 在实际应用中，这里应该有更健壮的错误处理
-		// 例如，返回一个错误或记录严重日志
-		// 为了保持函数签名不变，我们暂时打印错误并返回一个空的校验和
-		logger.WithFields(logrus.Fields{
-			"component": "DNYPacket",
-			"stage":     "Pack",
-			"error":     err.Error(),
-		}).Warn("CalculatePacketChecksumInternal 失败，使用0兜底")
-		checksum = 0
-	}
-
-	// 写入校验码 (2字节，小端模式)
-	if err := binary.Write(dataBuff, binary.LittleEndian, checksum); err != nil {
-		return nil, err
+	// 长度字段按实际数据字节数计算（不依赖可能未同步的 DataLen）
+	data := dnyMsg.GetData()
+	if len(data) > dny_protocol.MaxDataLen {
+		return nil, fmt.Errorf("数据长度%d超出DNY长度字段上限%d", len(data), dny_protocol.MaxDataLen)
 	}
-
-	// 获取完整的数据包（包含校验和）
-	packetData = dataBuff.Bytes()
+	packetData := dny_protocol.BuildFrame(dnyMsg.GetPhysicalId(), dnyMsg.MessageId, byte(dnyMsg.GetMsgID()), data)
 
 	// 记录十六进制日志
 	if dp.logHexDump {
 		logger.WithFields(logrus.Fields{
-			"command":    fmt.Sprintf("0x%02X", dnyMsg.GetMsgID()),
+			"command":    dny_protocol.CommandLabel(uint8(dnyMsg.GetMsgID())),
 			"physicalID": utils.FormatPhysicalID(dnyMsg.GetPhysicalId()),
-			"dataLen":    dnyMsg.GetDataLen(),
+			"dataLen":    len(data),
 			"dataHex":    hex.EncodeToString(packetData),
 		}).Debug("封包完成")
 	}
@@ -168,7 +112,7 @@ func (dp *DNYPacket) Unpack(binaryData []byte) (ziface.IMessage, error) {
 	// 记录接收到的原始数据
 	logger.WithFields(logrus.Fields{
 		"dataLen": len(binaryData),
-		"dataHex": hex.EncodeToString(binaryData[:minInt(len(binaryData), 100)]), // 仅记录前100个字节，避免日志过大
+		"dataHex": utils.LazyHexN(binaryData, 100), // 仅记录前100个字节，避免日志过大
 		"time":    time.Now().Format(constants.TimeFormatDefault),
 	}).Debug("收到数据包")
 
@@ -182,7 +126,7 @@ func (dp *DNYPacket) Unpack(binaryData []byte) (ziface.IMessage, error) {
 	if dp.logHexDump {
 		logger.WithFields(logrus.Fields{
 			"dataLen": len(binaryData),
-			"dataHex": hex.EncodeToString(binaryData),
+			"dataHex": utils.LazyHex(binaryData),
 		}).Debug("DNYPacket.Unpack 接收原始数据")
 	}
 
@@ -247,7 +191,7 @@ func (dp *DNYPacket) handleDNYProtocolBasic(data []byte) (ziface.IMessage, error
 		logger.WithFields(logrus.Fields{
 			"dataLen": len(data),
 			"minLen":  constants.MinPacketSize,
-			"dataHex": hex.EncodeToString(data),
+			"dataHex": utils.LazyHex(data),
 		}).Debug("数据不足以解析DNY协议包，等待更多数据")
 		return nil, ErrNotEnoughData
 	}
@@ -271,7 +215,7 @@ func (dp *DNYPacket) handleDNYProtocolBasic(data []byte) (ziface.IMessage, error
 		logger.WithFields(logrus.Fields{
 			"dataLen":  len(data),
 			"totalLen": totalLen,
-			"dataHex":  hex.EncodeToString(data),
+			"dataHex":  utils.LazyHex(data),
 		}).Debug("数据不足以解析完整DNY消息，等待更多数据")
 		return nil, ErrNotEnoughData
 	}
@@ -290,19 +234,11 @@ func (dp *DNYPacket) handleDNYProtocolBasic(data []byte) (ziface.IMessage, error
 	if dp.logHexDump {
 		logger.WithFields(logrus.Fields{
 			"totalLen": totalLen,
-			"dataHex":  hex.EncodeToString(data[:totalLen]),
+			"dataHex":  utils.LazyHex(data[:totalLen]),
 		}).Debug("DNY协议数据包详情")
 	}
 
 	return msg, nil
 }
 
-// 辅助函数，返回两个数的较小值
-func minInt(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // 🔧 已删除重复的isAllDigits函数，请使用special_handler.go中的IsAllDigits函数
@@ -1,7 +1,6 @@
 package protocol
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/hex" // 确保导入 encoding/hex
 	"errors"
@@ -12,6 +11,7 @@ import (
 	// 使用正确的模块路径
 	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
 
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger" // 新增：导入logger包
 	"github.com/sirupsen/logrus"                                   // 新增：导入logrus包
@@ -40,7 +40,7 @@ func ParseDNYProtocolData(data []byte) (*dny_protocol.Message, error) {
 	// DEBUG: Log input to ParseDNYProtocolData
 	logger.WithFields(logrus.Fields{
 		"inputDataLen": len(data),
-		"inputDataHex": hex.EncodeToString(data), // 修改：记录完整的十六进制数据
+		"inputDataHex": utils.LazyHex(data), // 修改：记录完整的十六进制数据（延迟编码）
 	}).Debug("ParseDNYProtocolData: 收到待解析数据") // 修改：日志级别调整为 Debug
 
 	dataLen := len(data)
@@ -116,9 +116,11 @@ func ParseDNYProtocolData(data []byte) (*dny_protocol.Message, error) {
 	}
 
 	msg.Checksum = actualChecksum
+	var checksumErr *ChecksumError
 	if actualChecksum != expectedChecksum {
+		checksumErr = &ChecksumError{Carried: expectedChecksum, Calculated: actualChecksum}
 		msg.MessageType = "error"
-		msg.ErrorMessage = fmt.Sprintf("checksum mismatch: expected %04X, got %04X", expectedChecksum, actualChecksum)
+		msg.ErrorMessage = checksumErr.Error()
 		// 即使校验和错误，也继续解析其他字段，但标记为错误类型
 	}
 
@@ -154,9 +156,9 @@ func ParseDNYProtocolData(data []byte) (*dny_protocol.Message, error) {
 		msg.MessageType = "standard"
 	}
 
-	// 如果msg.MessageType是"error"但之前没有返回error, 表示校验和错误但解析继续
-	if msg.MessageType == "error" && err == nil {
-		return msg, errors.New(msg.ErrorMessage)
+	// 校验和错误但其余字段完整：返回 *ChecksumError，由调用方按校验和模式决定是否照常处理
+	if checksumErr != nil {
+		return msg, checksumErr
 	}
 
 	return msg, nil
@@ -166,11 +168,14 @@ func ParseDNYProtocolData(data []byte) (*dny_protocol.Message, error) {
 // 🔧 修复：根据协议文档和用户验证，校验和计算从包头"DNY"开始到校验和前的所有字节
 // 计算范围：包头(DNY) + 长度字段 + 物理ID + 消息ID + 命令 + 数据（不包括校验和本身）
 func CalculatePacketChecksumInternal(dataFrame []byte) (uint16, error) {
-	// DEBUG: Log input to CalculatePacketChecksumInternal
-	logger.WithFields(logrus.Fields{
-		"dataFrameLen": len(dataFrame),
-		"dataFrameHex": fmt.Sprintf("%.100x", dataFrame), // 最多显示前100字节
-	}).Trace("CalculatePacketChecksumInternal: 收到待计算校验和的数据帧")
+	// 每帧调用，Trace未开启时跳过字段构造
+	traceEnabled := logger.GetLogger().IsLevelEnabled(logrus.TraceLevel)
+	if traceEnabled {
+		logger.WithFields(logrus.Fields{
+			"dataFrameLen": len(dataFrame),
+			"dataFrameHex": utils.LazyHexN(dataFrame, 100), // 最多显示前100字节
+		}).Trace("CalculatePacketChecksumInternal: 收到待计算校验和的数据帧")
+	}
 
 	if len(dataFrame) == 0 {
 		return 0, errors.New("data frame for checksum calculation is empty")
@@ -178,61 +183,17 @@ func CalculatePacketChecksumInternal(dataFrame []byte) (uint16, error) {
 
 	// 🔧 关键修复：按字节无符号累加和校验，从包头到数据的内容
 	// 根据用户验证的原始报文：444E590D00CD28A20479082263EE5C68 -> 校验和应为4B05
-	var sum uint16
-	for _, b := range dataFrame {
-		sum += uint16(b)
-	}
-
-	logger.WithFields(logrus.Fields{
-		"dataFrameLen":    len(dataFrame),
-		"calculatedSum":   fmt.Sprintf("0x%04X", sum),
-		"sumLittleEndian": fmt.Sprintf("%02X %02X", byte(sum), byte(sum>>8)),
-	}).Trace("CalculatePacketChecksumInternal: 校验和计算完成")
-
-	return sum, nil
-}
-
-// BuildDNYResponsePacketUnified 使用统一的 dny_protocol.Message 构建DNY响应数据包
-func BuildDNYResponsePacketUnified(msg *dny_protocol.Message) ([]byte, error) {
-	// 根据协议，“长度”字段的值应为 PhysicalID(4) + MessageID(2) + 命令(1) + 数据(n) + 校验(2) 的总和
-	contentLen := uint16(PhysicalIDLength + MessageIDLength + CommandLength + len(msg.Data) + ChecksumLength)
-
-	packet := new(bytes.Buffer)
-
-	// 1. 写入包头和长度
-	packet.WriteString(constants.ProtocolHeader)
-	if err := binary.Write(packet, binary.LittleEndian, contentLen); err != nil {
-		// 忽略错误，因为写入bytes.Buffer通常不会失败
-		_ = err
-	}
-
-	// 2. 写入核心内容
-	if err := binary.Write(packet, binary.LittleEndian, msg.PhysicalId); err != nil {
-		// 忽略错误，因为写入bytes.Buffer通常不会失败
-		_ = err
-	}
-	if err := binary.Write(packet, binary.LittleEndian, msg.MessageId); err != nil {
-		// 忽略错误，因为写入bytes.Buffer通常不会失败
-		_ = err
-	}
-	packet.WriteByte(byte(msg.CommandId))
-	packet.Write(msg.Data)
-
-	// 3. 基于当前包的内容计算校验和
-	// 计算范围：包头(DNY) + 长度 + 物理ID + 消息ID + 命令 + 数据
-	dataForChecksum := packet.Bytes()
-	checksum, err := CalculatePacketChecksumInternal(dataForChecksum)
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate checksum for unified packet: %w", err)
-	}
+	sum := dny_protocol.Checksum(dataFrame)
 
-	// 4. 写入校验和
-	if err := binary.Write(packet, binary.LittleEndian, checksum); err != nil {
-		// 忽略错误，因为写入bytes.Buffer通常不会失败
-		_ = err
+	if traceEnabled {
+		logger.WithFields(logrus.Fields{
+			"dataFrameLen":    len(dataFrame),
+			"calculatedSum":   fmt.Sprintf("0x%04X", sum),
+			"sumLittleEndian": fmt.Sprintf("%02X %02X", byte(sum), byte(sum>>8)),
+		}).Trace("CalculatePacketChecksumInternal: 校验和计算完成")
 	}
 
-	return packet.Bytes(), nil
+	return sum, nil
 }
 
 // ParseDevicePhysicalID 解析设备物理ID字符串 (复用之前的逻辑)
@@ -433,6 +394,11 @@ func ValidateDNYFrame(frameData []byte) (bool, error) {
 // 支持处理ICCID、DNY协议包、link心跳包的混合数据流
 // 返回：完整数据包列表、剩余未完成数据、错误信息
 func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
+	return splitPacketsFromBuffer(buffer, nil)
+}
+
+// splitPacketsFromBuffer 同 SplitPacketsFromBuffer，onSkip 不为nil时按连续段回调被跳过的无法识别字节
+func splitPacketsFromBuffer(buffer []byte, onSkip func(skipped []byte)) ([][]byte, []byte, error) {
 	if len(buffer) == 0 {
 		return nil, nil, nil
 	}
@@ -441,9 +407,28 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 	offset := 0
 	bufferLen := len(buffer)
 
+	// 连续跳过的无法识别字节按段记录（每段一条日志）
+	skipStart := -1
+	flushSkipped := func(end int) {
+		if skipStart < 0 {
+			return
+		}
+		skipped := buffer[skipStart:end]
+		logger.WithFields(logrus.Fields{
+			"offset":     skipStart,
+			"skipped":    len(skipped),
+			"skippedHex": utils.LazyHexN(skipped, 40),
+			"position":   fmt.Sprintf("%d/%d", skipStart, bufferLen),
+		}).Warn("SplitPacketsFromBuffer: 跳过无法识别的字节")
+		if onSkip != nil {
+			onSkip(skipped)
+		}
+		skipStart = -1
+	}
+
 	logger.WithFields(logrus.Fields{
 		"bufferLen": bufferLen,
-		"bufferHex": fmt.Sprintf("%.200x", buffer), // 显示前200字节用于调试
+		"bufferHex": utils.LazyHexN(buffer, 200), // 显示前200字节用于调试
 	}).Debug("SplitPacketsFromBuffer: 开始分割数据包")
 
 	for offset < bufferLen {
@@ -457,6 +442,7 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 		if remaining >= constants.IotSimCardLength {
 			candidate := buffer[offset : offset+constants.IotSimCardLength]
 			if isValidICCIDStrict(candidate) {
+				flushSkipped(offset)
 				packets = append(packets, candidate)
 				offset += constants.IotSimCardLength
 				logger.WithFields(logrus.Fields{
@@ -472,6 +458,7 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 		if remaining >= LinkPacketLength {
 			candidate := buffer[offset : offset+LinkPacketLength]
 			if string(candidate) == HeaderLink {
+				flushSkipped(offset)
 				packets = append(packets, candidate)
 				offset += LinkPacketLength
 				logger.WithFields(logrus.Fields{
@@ -486,6 +473,7 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 		if remaining >= PacketHeaderLength {
 			// 检查DNY包头
 			if string(buffer[offset:offset+PacketHeaderLength]) == constants.ProtocolHeader {
+				flushSkipped(offset)
 				// 检查是否有足够数据读取长度字段
 				if remaining < PacketHeaderLength+DataLengthBytes {
 					// 数据不完整，返回剩余数据
@@ -523,7 +511,7 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 					"packetType":     "dny",
 					"packetLen":      totalPacketLength,
 					"declaredLength": declaredLength,
-					"physicalIdHex":  fmt.Sprintf("%x", packet[5:9]), // PhysicalID位置
+					"physicalIdHex":  utils.LazyHex(packet[5:9]), // PhysicalID位置
 				}).Debug("SplitPacketsFromBuffer: 提取DNY协议包")
 				continue
 			}
@@ -531,20 +519,19 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 
 		// 🔧 增强：智能处理无法识别的数据
 		// 检查是否为压缩数据或其他特殊格式
+		skipAt := offset
 		if detectAndHandleSpecialData(buffer, offset, &packets, &offset) {
+			flushSkipped(skipAt)
 			continue
 		}
 
-		// 最后手段：跳过一个字节继续扫描，但增加更详细的诊断信息
-		logger.WithFields(logrus.Fields{
-			"offset":       offset,
-			"unrecognized": fmt.Sprintf("%02x", buffer[offset]),
-			"contextHex":   fmt.Sprintf("%.40x", buffer[offset:min(offset+20, bufferLen)]), // 增加上下文长度
-			"remainingLen": remaining,
-			"position":     fmt.Sprintf("%d/%d", offset, bufferLen),
-		}).Warn("SplitPacketsFromBuffer: 跳过无法识别的字节")
+		// 最后手段：跳过一个字节继续扫描（连续跳过的字节在遇到下一个可识别报文时合并记录）
+		if skipStart < 0 {
+			skipStart = offset
+		}
 		offset++
 	}
+	flushSkipped(offset)
 
 	// 返回剩余未处理的数据
 	var remainingData []byte
@@ -552,7 +539,7 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 		remainingData = buffer[offset:]
 		logger.WithFields(logrus.Fields{
 			"remainingLen": len(remainingData),
-			"remainingHex": fmt.Sprintf("%.100x", remainingData),
+			"remainingHex": utils.LazyHexN(remainingData, 100),
 		}).Debug("SplitPacketsFromBuffer: 返回剩余未完成数据")
 	}
 
@@ -568,7 +555,13 @@ func SplitPacketsFromBuffer(buffer []byte) ([][]byte, []byte, error) {
 // ParseMultiplePackets 解析从缓冲区分割出的多个数据包
 // 这是对外的主要接口，内部调用SplitPacketsFromBuffer和ParseDNYProtocolData
 func ParseMultiplePackets(buffer []byte) ([]*dny_protocol.Message, []byte, error) {
-	packets, remainingData, err := SplitPacketsFromBuffer(buffer)
+	return parseMultiplePackets(buffer, nil, nil)
+}
+
+// parseMultiplePackets 同 ParseMultiplePackets，onInvalid 不为nil时回调解析失败（如校验和错误）的数据包，
+// onInvalid 返回true时保留该消息（如校验和宽松模式下照常处理校验和错误的帧），onSkip 不为nil时回调被跳过的无法识别字节
+func parseMultiplePackets(buffer []byte, onInvalid func(packet []byte, msg *dny_protocol.Message, err error) bool, onSkip func(skipped []byte)) ([]*dny_protocol.Message, []byte, error) {
+	packets, remainingData, err := splitPacketsFromBuffer(buffer, onSkip)
 	if err != nil {
 		return nil, remainingData, fmt.Errorf("packet splitting failed: %w", err)
 	}
@@ -580,9 +573,12 @@ func ParseMultiplePackets(buffer []byte) ([]*dny_protocol.Message, []byte, error
 			logger.WithFields(logrus.Fields{
 				"packetIndex": i,
 				"packetLen":   len(packet),
-				"packetHex":   fmt.Sprintf("%.100x", packet),
+				"packetHex":   utils.LazyHexN(packet, 100),
 				"error":       parseErr.Error(),
 			}).Warn("ParseMultiplePackets: 单个数据包解析失败")
+			if onInvalid != nil && onInvalid(packet, msg, parseErr) {
+				messages = append(messages, msg)
+			}
 			// 继续处理其他包，不因单个包失败而中断整体处理
 			continue
 		}
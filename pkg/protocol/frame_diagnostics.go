@@ -0,0 +1,282 @@
+package protocol
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// MaxDiagnoseFrameBytes 帧诊断允许的最大输入字节数
+const MaxDiagnoseFrameBytes = 4096
+
+// ErrFrameTooLarge 诊断输入超过 MaxDiagnoseFrameBytes
+var ErrFrameTooLarge = errors.New("输入超过最大长度")
+
+// 帧方向
+const (
+	FrameDirectionUplink   = "uplink"   // 设备→服务器
+	FrameDirectionDownlink = "downlink" // 服务器→设备
+)
+
+// 校验和算法
+const (
+	ChecksumAlgorithmFromHeader  = "sum16_from_header"      // 协议规定：从包头"DNY"累加到校验和前
+	ChecksumAlgorithmFromContent = "sum16_from_physical_id" // 旧实现：从物理ID累加到校验和前
+)
+
+// FrameIssue 帧校验问题（定位到字节偏移）
+type FrameIssue struct {
+	Offset  int    `json:"offset"`
+	Length  int    `json:"length"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ChecksumCheck 单个校验算法的比对结果
+type ChecksumCheck struct {
+	Algorithm string `json:"algorithm"`
+	Expected  string `json:"expected"` // 按算法计算出的校验和
+	Actual    string `json:"actual"`   // 帧中携带的校验和
+	Valid     bool   `json:"valid"`
+}
+
+// FrameDiagnostics 帧诊断结果（纯解析，不访问任何设备状态）
+type FrameDiagnostics struct {
+	Valid          bool            `json:"valid"`
+	FrameType      string          `json:"frame_type"` // dny | iccid | link | unknown
+	Direction      string          `json:"direction,omitempty"`
+	TotalBytes     int             `json:"total_bytes"`
+	HeaderValid    bool            `json:"header_valid"`
+	Header         string          `json:"header,omitempty"`
+	DeclaredLength int             `json:"declared_length"` // 长度字段值（物理ID至校验和）
+	ActualLength   int             `json:"actual_length"`   // 长度字段之后的实际字节数
+	PhysicalID     string          `json:"physical_id,omitempty"`
+	MessageID      string          `json:"message_id,omitempty"`
+	Command        string          `json:"command,omitempty"`
+	CommandName    string          `json:"command_name,omitempty"`
+	PayloadHex     string          `json:"payload_hex,omitempty"`
+	PayloadType    string          `json:"payload_type,omitempty"`
+	Payload        interface{}     `json:"payload,omitempty"`
+	PayloadError   string          `json:"payload_error,omitempty"`
+	ICCID          string          `json:"iccid,omitempty"`
+	Checksums      []ChecksumCheck `json:"checksums,omitempty"`
+	Errors         []FrameIssue    `json:"errors"`
+}
+
+// payloadDecoder 负载解码器工厂（每次返回新实例）
+type payloadDecoder func() encoding.BinaryUnmarshaler
+
+// 已有解码器的命令（按方向区分，同一命令上下行格式不同）
+var uplinkPayloadDecoders = map[uint8]payloadDecoder{
+	constants.CmdSwipeCard:      func() encoding.BinaryUnmarshaler { return &dny_protocol.SwipeCardRequestData{} },
+	constants.CmdSettlement:     func() encoding.BinaryUnmarshaler { return &dny_protocol.SettlementData{} },
+	constants.CmdPowerHeartbeat: func() encoding.BinaryUnmarshaler { return &dny_protocol.PowerHeartbeatData{} },
+	constants.CmdMainHeartbeat:  func() encoding.BinaryUnmarshaler { return &dny_protocol.MainHeartbeatData{} },
+	constants.CmdDeviceRegister: func() encoding.BinaryUnmarshaler { return &dny_protocol.DeviceRegisterData{} },
+	constants.CmdDeviceHeart:    func() encoding.BinaryUnmarshaler { return &dny_protocol.DeviceHeartbeatData{} },
+	constants.CmdNetworkStatus:  func() encoding.BinaryUnmarshaler { return &dny_protocol.NetworkStatusData{} },
+	constants.CmdQueryParam1:    func() encoding.BinaryUnmarshaler { return &dny_protocol.RunParams11{} },
+	constants.CmdQueryParam2:    func() encoding.BinaryUnmarshaler { return &dny_protocol.RunParams12{} },
+}
+
+var downlinkPayloadDecoders = map[uint8]payloadDecoder{
+	constants.CmdParamSetting:  func() encoding.BinaryUnmarshaler { return &dny_protocol.ParameterSettingData{} },
+	constants.CmdParamSetting2: func() encoding.BinaryUnmarshaler { return &dny_protocol.ParameterSettingData{} },
+}
+
+// DecodeHexInput 清理并解码十六进制输入（忽略空白、冒号、0x前缀等分隔符）
+func DecodeHexInput(hexStr string) ([]byte, error) {
+	hexStr = strings.ReplaceAll(strings.ReplaceAll(hexStr, "0x", ""), "0X", "")
+	clean := make([]byte, 0, len(hexStr))
+	for i := 0; i < len(hexStr); i++ {
+		ch := hexStr[i]
+		switch {
+		case (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F'):
+			clean = append(clean, ch)
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ':' || ch == '-' || ch == ',':
+		default:
+			return nil, fmt.Errorf("非法十六进制字符 %q (位置 %d)", ch, i)
+		}
+	}
+	if len(clean)%2 != 0 {
+		return nil, fmt.Errorf("十六进制长度为奇数: %d", len(clean))
+	}
+	if len(clean)/2 > MaxDiagnoseFrameBytes {
+		return nil, fmt.Errorf("%w %d 字节", ErrFrameTooLarge, MaxDiagnoseFrameBytes)
+	}
+	return hex.DecodeString(string(clean))
+}
+
+// DiagnoseHexFrame 诊断十六进制帧（HTTP接口与 dny-parser 命令行共用）
+func DiagnoseHexFrame(hexStr, direction string) (*FrameDiagnostics, error) {
+	data, err := DecodeHexInput(hexStr)
+	if err != nil {
+		return nil, err
+	}
+	return DiagnoseFrame(data, direction), nil
+}
+
+// DiagnoseFrame 逐字段诊断单个帧，收集所有问题而非遇错即停
+// direction 为空时按上行解码负载，上行无解码器再尝试下行
+func DiagnoseFrame(data []byte, direction string) *FrameDiagnostics {
+	d := &FrameDiagnostics{TotalBytes: len(data), Direction: direction, Errors: []FrameIssue{}}
+	issue := func(offset, length int, field, format string, args ...interface{}) {
+		d.Errors = append(d.Errors, FrameIssue{Offset: offset, Length: length, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if direction != "" && direction != FrameDirectionUplink && direction != FrameDirectionDownlink {
+		issue(0, 0, "direction", "未知方向 %q，应为 %s 或 %s", direction, FrameDirectionUplink, FrameDirectionDownlink)
+	}
+	if len(data) == 0 {
+		d.FrameType = "unknown"
+		issue(0, 0, "frame", "数据为空")
+		return d
+	}
+
+	// 特殊帧：ICCID 与 link 心跳
+	if len(data) == constants.IotSimCardLength && isValidICCIDStrict(data) {
+		d.FrameType = "iccid"
+		d.ICCID = string(data)
+		d.Valid = len(d.Errors) == 0
+		return d
+	}
+	if len(data) == LinkPacketLength && string(data) == HeaderLink {
+		d.FrameType = "link"
+		d.Valid = len(d.Errors) == 0
+		return d
+	}
+
+	d.FrameType = "dny"
+	headerLen := PacketHeaderLength
+	if len(data) < headerLen {
+		headerLen = len(data)
+	}
+	d.Header = printableBytes(data[:headerLen]).String()
+	d.HeaderValid = headerLen == PacketHeaderLength && string(data[:PacketHeaderLength]) == constants.ProtocolHeader
+	if !d.HeaderValid {
+		d.FrameType = "unknown"
+		issue(0, PacketHeaderLength, "header", "包头应为 %q，实际 %s", constants.ProtocolHeader, utils.LazyHex(data[:headerLen]))
+	}
+
+	lengthEnd := DataLengthPos + DataLengthBytes
+	if len(data) < lengthEnd {
+		issue(len(data), lengthEnd-len(data), "length", "帧过短，缺少长度字段")
+		return d
+	}
+	d.DeclaredLength = int(binary.LittleEndian.Uint16(data[DataLengthPos:lengthEnd]))
+	d.ActualLength = len(data) - lengthEnd
+	minContent := PhysicalIDLength + MessageIDLength + CommandLength + ChecksumLength
+	if d.DeclaredLength < minContent {
+		issue(DataLengthPos, DataLengthBytes, "length", "长度字段 %d 小于最小值 %d", d.DeclaredLength, minContent)
+	}
+	if d.DeclaredLength != d.ActualLength {
+		issue(DataLengthPos, DataLengthBytes, "length", "长度字段声明 %d 字节，实际 %d 字节", d.DeclaredLength, d.ActualLength)
+	}
+
+	// 帧尾：按声明长度截取（不足时按实际长度），保证超长帧也能定位到声明的校验和
+	frameEnd := lengthEnd + d.DeclaredLength
+	if frameEnd > len(data) || d.DeclaredLength < minContent {
+		frameEnd = len(data)
+	}
+	contentStart := lengthEnd
+	headerFieldsEnd := contentStart + PhysicalIDLength + MessageIDLength + CommandLength
+
+	if len(data) >= contentStart+PhysicalIDLength {
+		d.PhysicalID = utils.FormatPhysicalID(binary.LittleEndian.Uint32(data[contentStart : contentStart+PhysicalIDLength]))
+	} else {
+		issue(contentStart, PhysicalIDLength, "physical_id", "缺少物理ID")
+	}
+	msgIDPos := contentStart + PhysicalIDLength
+	if len(data) >= msgIDPos+MessageIDLength {
+		d.MessageID = fmt.Sprintf("0x%04X", binary.LittleEndian.Uint16(data[msgIDPos:msgIDPos+MessageIDLength]))
+	} else {
+		issue(msgIDPos, MessageIDLength, "message_id", "缺少消息ID")
+	}
+	cmdPos := msgIDPos + MessageIDLength
+	if len(data) > cmdPos {
+		cmd := data[cmdPos]
+		d.Command = fmt.Sprintf("0x%02X", cmd)
+		if info, ok := constants.GetCommandInfo(cmd); ok {
+			d.CommandName = info.Name
+		} else {
+			issue(cmdPos, CommandLength, "command", "命令表中不存在命令 0x%02X", cmd)
+		}
+	} else {
+		issue(cmdPos, CommandLength, "command", "缺少命令字节")
+	}
+
+	checksumStart := frameEnd - ChecksumLength
+	if checksumStart < headerFieldsEnd {
+		issue(frameEnd, 0, "checksum", "帧过短，缺少校验和")
+		d.Valid = false
+		return d
+	}
+
+	payload := data[headerFieldsEnd:checksumStart]
+	d.PayloadHex = strings.ToUpper(hex.EncodeToString(payload))
+
+	received := binary.LittleEndian.Uint16(data[checksumStart:frameEnd])
+	fromHeader := sum16(data[:checksumStart])
+	fromContent := sum16(data[contentStart:checksumStart])
+	d.Checksums = []ChecksumCheck{
+		{Algorithm: ChecksumAlgorithmFromHeader, Expected: fmt.Sprintf("0x%04X", fromHeader), Actual: fmt.Sprintf("0x%04X", received), Valid: fromHeader == received},
+		{Algorithm: ChecksumAlgorithmFromContent, Expected: fmt.Sprintf("0x%04X", fromContent), Actual: fmt.Sprintf("0x%04X", received), Valid: fromContent == received},
+	}
+	switch {
+	case fromHeader == received:
+	case fromContent == received:
+		issue(checksumStart, ChecksumLength, "checksum", "校验和仅匹配旧算法 %s，协议应为 %s (0x%04X)", ChecksumAlgorithmFromContent, ChecksumAlgorithmFromHeader, fromHeader)
+	default:
+		issue(checksumStart, ChecksumLength, "checksum", "校验和不匹配: 帧中 0x%04X，计算值 0x%04X", received, fromHeader)
+	}
+	if frameEnd < len(data) {
+		issue(frameEnd, len(data)-frameEnd, "trailing", "帧尾存在 %d 字节多余数据", len(data)-frameEnd)
+	}
+
+	if len(data) > cmdPos {
+		d.decodePayload(data[cmdPos], payload, headerFieldsEnd, issue)
+	}
+
+	d.Valid = len(d.Errors) == 0
+	return d
+}
+
+func (d *FrameDiagnostics) decodePayload(cmd uint8, payload []byte, offset int, issue func(offset, length int, field, format string, args ...interface{})) {
+	var factory payloadDecoder
+	switch d.Direction {
+	case FrameDirectionUplink:
+		factory = uplinkPayloadDecoders[cmd]
+	case FrameDirectionDownlink:
+		factory = downlinkPayloadDecoders[cmd]
+	default:
+		if factory = uplinkPayloadDecoders[cmd]; factory == nil {
+			factory = downlinkPayloadDecoders[cmd]
+		}
+	}
+	if factory == nil {
+		return
+	}
+	decoded := factory()
+	d.PayloadType = strings.TrimPrefix(fmt.Sprintf("%T", decoded), "*")
+	if err := decoded.UnmarshalBinary(payload); err != nil {
+		d.PayloadError = err.Error()
+		issue(offset, len(payload), "payload", "负载解码失败: %v", err)
+		return
+	}
+	d.Payload = decoded
+}
+
+func sum16(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	return sum
+}
@@ -0,0 +1,297 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// CloseReasonGarbagePreamble 首个可识别报文之前的杂散数据超过预算时的连接关闭原因
+const CloseReasonGarbagePreamble = "garbage_preamble"
+
+const (
+	defaultPreambleBudget   = 256
+	defaultGarbageHistory   = 200
+	maxGarbageSampleBytes   = 64
+	defaultGarbageMinEvents = 2
+)
+
+// GarbageOptions 杂散数据跟踪选项
+type GarbageOptions struct {
+	BudgetBytes int // 首个可识别报文之前允许丢弃的字节数，超过后关闭连接
+	HistorySize int // 保留的已关闭连接记录数（仅保留出现过杂散数据的连接）
+}
+
+// GarbageConnStats 连接上的杂散数据统计
+type GarbageConnStats struct {
+	ConnID        uint64    `json:"conn_id"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	PreambleBytes int       `json:"preamble_bytes"` // 首个可识别报文之前丢弃的字节数
+	StreamBytes   int       `json:"stream_bytes"`   // 同步后报文之间丢弃的字节数
+	Events        int       `json:"events"`         // 出现杂散数据的次数（连续的一段计一次）
+	Synced        bool      `json:"synced"`         // 是否已识别到首个报文
+	Exceeded      bool      `json:"exceeded"`       // 前导杂散数据超过预算，连接已关闭
+	Active        bool      `json:"active"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+	SampleHex     string    `json:"sample_hex,omitempty"`  // 首段杂散数据（截断）
+	SampleText    string    `json:"sample_text,omitempty"` // 首段杂散数据的可打印形式
+}
+
+// GarbageReport 杂散数据诊断
+type GarbageReport struct {
+	BudgetBytes         int                `json:"budget_bytes"`
+	TotalPreambleBytes  int64              `json:"total_preamble_bytes"`
+	TotalStreamBytes    int64              `json:"total_stream_bytes"`
+	ExceededConnections int64              `json:"exceeded_connections"`
+	Connections         []GarbageConnStats `json:"connections"` // 达到最少次数或超过预算的连接（新→旧）
+}
+
+// GarbageTracker 跟踪各连接首个报文之前的前导杂散数据（如路由器PPP重拨时的AT指令回显）与报文间的杂散字节
+type GarbageTracker struct {
+	budget int
+
+	mu      sync.Mutex
+	conns   map[uint64]*GarbageConnStats
+	history []GarbageConnStats // 环形缓冲：已关闭且出现过杂散数据的连接
+	next    int
+	size    int
+
+	totalPreamble int64
+	totalStream   int64
+	exceeded      int64
+}
+
+// NewGarbageTracker 创建杂散数据跟踪器
+func NewGarbageTracker(opts GarbageOptions) *GarbageTracker {
+	if opts.BudgetBytes <= 0 {
+		opts.BudgetBytes = defaultPreambleBudget
+	}
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = defaultGarbageHistory
+	}
+	return &GarbageTracker{
+		budget:  opts.BudgetBytes,
+		conns:   make(map[uint64]*GarbageConnStats),
+		history: make([]GarbageConnStats, opts.HistorySize),
+	}
+}
+
+// Budget 前导杂散数据预算(字节)
+func (t *GarbageTracker) Budget() int {
+	return t.budget
+}
+
+func (t *GarbageTracker) entry(connID uint64) *GarbageConnStats {
+	st, ok := t.conns[connID]
+	if !ok {
+		st = &GarbageConnStats{ConnID: connID, Active: true}
+		t.conns[connID] = st
+	}
+	return st
+}
+
+// MarkSynced 记录连接已识别到首个报文（仅出现过杂散数据的连接保留统计）
+func (t *GarbageTracker) MarkSynced(connID uint64) {
+	t.mu.Lock()
+	if st, ok := t.conns[connID]; ok {
+		st.Synced = true
+	}
+	t.mu.Unlock()
+}
+
+// NoteRemoteAddr 记录连接远端地址（诊断展示）
+func (t *GarbageTracker) NoteRemoteAddr(connID uint64, addr string) {
+	t.mu.Lock()
+	if st, ok := t.conns[connID]; ok && st.RemoteAddr == "" {
+		st.RemoteAddr = addr
+	}
+	t.mu.Unlock()
+}
+
+// NoteSkipped 记录一段被丢弃的杂散数据，返回前导杂散数据是否超过预算（仅首次超过时返回true）
+func (t *GarbageTracker) NoteSkipped(connID uint64, skipped []byte, preamble bool) bool {
+	if len(skipped) == 0 {
+		return false
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.entry(connID)
+	if st.Events == 0 {
+		st.FirstSeenAt = now
+		sample := skipped
+		if len(sample) > maxGarbageSampleBytes {
+			sample = sample[:maxGarbageSampleBytes]
+		}
+		st.SampleHex = hex.EncodeToString(sample)
+		st.SampleText = printableBytes(sample).String()
+	}
+	st.Events++
+	st.LastSeenAt = now
+	if !preamble {
+		st.StreamBytes += len(skipped)
+		atomic.AddInt64(&t.totalStream, int64(len(skipped)))
+		return false
+	}
+	st.PreambleBytes += len(skipped)
+	atomic.AddInt64(&t.totalPreamble, int64(len(skipped)))
+	if st.PreambleBytes > t.budget && !st.Exceeded {
+		st.Exceeded = true
+		atomic.AddInt64(&t.exceeded, 1)
+		return true
+	}
+	return false
+}
+
+// Exceeded 连接前导杂散数据是否已超过预算
+func (t *GarbageTracker) Exceeded(connID uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.conns[connID]
+	return ok && st.Exceeded
+}
+
+// Release 连接关闭：出现过杂散数据的连接转入历史记录
+func (t *GarbageTracker) Release(connID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.conns[connID]
+	if !ok {
+		return
+	}
+	delete(t.conns, connID)
+	if st.Events == 0 {
+		return
+	}
+	st.Active = false
+	t.history[t.next] = *st
+	t.next = (t.next + 1) % len(t.history)
+	if t.size < len(t.history) {
+		t.size++
+	}
+}
+
+// Get 查询连接统计（活动连接优先，其次历史记录）
+func (t *GarbageTracker) Get(connID uint64) (GarbageConnStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st, ok := t.conns[connID]; ok {
+		return *st, true
+	}
+	for i := 0; i < t.size; i++ {
+		if h := t.history[(t.next-1-i+len(t.history))%len(t.history)]; h.ConnID == connID {
+			return h, true
+		}
+	}
+	return GarbageConnStats{}, false
+}
+
+// Report 诊断：杂散数据出现次数不少于 minEvents 或超过预算的连接（含已关闭的历史连接）
+func (t *GarbageTracker) Report(minEvents int) GarbageReport {
+	if minEvents <= 0 {
+		minEvents = defaultGarbageMinEvents
+	}
+	report := GarbageReport{
+		BudgetBytes:         t.budget,
+		TotalPreambleBytes:  atomic.LoadInt64(&t.totalPreamble),
+		TotalStreamBytes:    atomic.LoadInt64(&t.totalStream),
+		ExceededConnections: atomic.LoadInt64(&t.exceeded),
+		Connections:         []GarbageConnStats{},
+	}
+	keep := func(st GarbageConnStats) bool { return st.Events >= minEvents || st.Exceeded }
+
+	t.mu.Lock()
+	for _, st := range t.conns {
+		if keep(*st) {
+			report.Connections = append(report.Connections, *st)
+		}
+	}
+	for i := 0; i < t.size; i++ {
+		if h := t.history[(t.next-1-i+len(t.history))%len(t.history)]; keep(h) {
+			report.Connections = append(report.Connections, h)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(report.Connections, func(i, j int) bool {
+		return report.Connections[i].LastSeenAt.After(report.Connections[j].LastSeenAt)
+	})
+	return report
+}
+
+// findFirstToken 查找首个可识别报文（ICCID、link心跳、DNY包头）的起始位置
+// complete=false 表示 start 之后的数据可能是被拆包的报文开头（或为空），需等待后续数据
+func findFirstToken(data []byte) (start int, complete bool) {
+	for i := 0; i < len(data); i++ {
+		rest := data[i:]
+		if len(rest) >= constants.IotSimCardLength && isValidICCIDStrict(rest[:constants.IotSimCardLength]) {
+			return i, true
+		}
+		if len(rest) >= LinkPacketLength && string(rest[:LinkPacketLength]) == HeaderLink {
+			return i, true
+		}
+		if len(rest) >= PacketHeaderLength && string(rest[:PacketHeaderLength]) == constants.ProtocolHeader {
+			return i, true
+		}
+		if isPartialToken(rest) {
+			return i, false
+		}
+	}
+	return len(data), false
+}
+
+// isPartialToken 数据（到末尾）是否可能是可识别报文被拆包后的开头
+func isPartialToken(rest []byte) bool {
+	if len(rest) < LinkPacketLength && string(rest) == HeaderLink[:len(rest)] {
+		return true
+	}
+	if len(rest) < PacketHeaderLength && string(rest) == constants.ProtocolHeader[:len(rest)] {
+		return true
+	}
+	if len(rest) >= constants.IotSimCardLength {
+		return false
+	}
+	prefix := constants.ICCIDValidPrefix
+	if len(rest) < len(prefix) {
+		prefix = prefix[:len(rest)]
+	}
+	if string(rest[:len(prefix)]) != prefix {
+		return false
+	}
+	for _, b := range rest {
+		if !((b >= '0' && b <= '9') || (b >= 'A' && b <= 'F') || (b >= 'a' && b <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalGarbageTracker atomic.Pointer[GarbageTracker]
+
+// GetGlobalGarbageTracker 获取全局杂散数据跟踪器（未初始化时按默认选项创建）
+func GetGlobalGarbageTracker() *GarbageTracker {
+	if t := globalGarbageTracker.Load(); t != nil {
+		return t
+	}
+	return InitGlobalGarbageTracker(GarbageOptions{})
+}
+
+// InitGlobalGarbageTracker 创建全局杂散数据跟踪器（已存在时直接返回）
+func InitGlobalGarbageTracker(opts GarbageOptions) *GarbageTracker {
+	if t := globalGarbageTracker.Load(); t != nil {
+		return t
+	}
+	t := NewGarbageTracker(opts)
+	if !globalGarbageTracker.CompareAndSwap(nil, t) {
+		return globalGarbageTracker.Load()
+	}
+	return t
+}
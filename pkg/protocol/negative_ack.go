@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+)
+
+// 否定应答格式（设备不认识或不支持下发的命令时的应答约定，因固件而异）
+const (
+	NAKFormatErrorFrame      = "error_frame"       // 通用错误帧：命令0xFF，数据[原命令, 错误码]
+	NAKFormatErrorFrameShort = "error_frame_short" // 通用错误帧：命令0xFF，数据仅[错误码]，按消息ID匹配待应答命令
+	NAKFormatEchoStatus      = "echo_status"       // 原命令码应答，数据仅1字节失败状态（0xFE 未知命令 / 0xFF 错误）
+)
+
+// NegativeAck 设备否定应答
+type NegativeAck struct {
+	Format       string
+	MessageID    uint16
+	Command      uint8 // 被拒绝的命令
+	ReplyCommand uint8 // 应答帧的命令码
+	ErrorCode    uint8
+}
+
+// PendingLookup 按消息ID查询设备上待应答的命令码
+type PendingLookup func(messageID uint16) (uint8, bool)
+
+// DecodeNegativeAck 识别标准DNY帧是否为对待应答命令的否定应答：先按消息ID找到待应答命令，
+// 通用错误帧的命令码与原命令不同，带原命令字段时须与待应答命令一致；原命令码应答只接受单字节失败状态，
+// 以免与携带业务状态的正常应答混淆。没有匹配的待应答命令时不视为否定应答
+func DecodeNegativeAck(msg *dny_protocol.Message, pending PendingLookup) (NegativeAck, bool) {
+	if msg == nil || msg.MessageType != "standard" || pending == nil {
+		return NegativeAck{}, false
+	}
+	command, ok := pending(msg.MessageId)
+	if !ok {
+		return NegativeAck{}, false
+	}
+	nak := NegativeAck{MessageID: msg.MessageId, Command: command, ReplyCommand: uint8(msg.CommandId)}
+	data := msg.Data
+	switch {
+	case nak.ReplyCommand == constants.CmdErrorReply && len(data) >= 2:
+		if data[0] != command {
+			return NegativeAck{}, false
+		}
+		nak.Format, nak.ErrorCode = NAKFormatErrorFrame, data[1]
+	case nak.ReplyCommand == constants.CmdErrorReply && len(data) == 1:
+		nak.Format, nak.ErrorCode = NAKFormatErrorFrameShort, data[0]
+	case nak.ReplyCommand == command && len(data) == 1 && (data[0] == constants.StatusUnknownCommand || data[0] == constants.StatusError):
+		nak.Format, nak.ErrorCode = NAKFormatEchoStatus, data[0]
+	default:
+		return NegativeAck{}, false
+	}
+	return nak, true
+}
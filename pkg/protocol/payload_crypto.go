@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"encoding/binary"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
+	"github.com/sirupsen/logrus"
+)
+
+// applyPayloadCrypto 加密连接的上行帧解密为明文数据域，之后的方言转换、一致性检查与处理器只看到明文；
+// 注册帧末尾的密钥ID声明在此绑定连接并去掉，注册帧按标准长度继续处理。解密失败的帧标记为错误帧，不进入处理器
+func (d *DNY_Decoder) applyPayloadCrypto(connID uint64, msg *dny_protocol.Message) {
+	m := payloadcrypto.GetGlobalManager()
+	if m == nil {
+		return
+	}
+	var (
+		frame   []byte
+		changed bool
+		err     error
+	)
+	if uint8(msg.CommandId) == constants.CmdDeviceRegister {
+		frame, changed = m.BindRegister(connID, msg.RawData)
+	} else {
+		frame, changed, err = m.DecryptFrame(connID, msg.RawData)
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"connID":  connID,
+			"command": dny_protocol.CommandLabel(uint8(msg.CommandId)),
+			"error":   err.Error(),
+		}).Warn("解码器：数据域解密失败，丢弃该帧")
+		msg.MessageType = "error"
+		msg.ErrorMessage = err.Error()
+		return
+	}
+	if !changed {
+		return
+	}
+	msg.RawData = frame
+	msg.Data = frame[dnyPayloadOffset : len(frame)-ChecksumLength]
+	msg.DataLen = uint32(len(msg.Data))
+	msg.Checksum = binary.LittleEndian.Uint16(frame[len(frame)-ChecksumLength:])
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/bujia-iot/iot-zinx/pkg/constants"
 	"github.com/bujia-iot/iot-zinx/pkg/core"
@@ -163,7 +164,7 @@ func (h *SimpleHandlerBase) LogFrameProcessing(handlerName string, decodedFrame
 		"handler":   handlerName,
 		"connID":    conn.GetConnID(),
 		"deviceID":  decodedFrame.DeviceID,
-		"command":   fmt.Sprintf("0x%02X", decodedFrame.Command),
+		"command":   dny_protocol.CommandLabel(decodedFrame.Command),
 		"messageID": fmt.Sprintf("0x%04X", decodedFrame.MessageID),
 	}).Debug("处理DNY帧")
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 	"github.com/sirupsen/logrus"
 )
@@ -38,56 +39,16 @@ func NewUnifiedDNYBuilder() *UnifiedDNYBuilder {
 	}
 }
 
-// BuildDNYPacket 构建DNY协议数据包 - 统一实现
+// BuildDNYPacket 构建DNY协议数据包（委托 dny_protocol.BuildFrame）
 // 严格按照协议文档规范：
 // 包结构：Header(3) + Length(2) + PhysicalID(4) + MessageID(2) + Command(1) + Data(N) + Checksum(2)
 // 长度字段：包含校验和 = PhysicalID(4) + MessageID(2) + Command(1) + Data(N) + Checksum(2)
 // 校验和：从包头"DNY"开始到校验和前的所有字节
 func (b *UnifiedDNYBuilder) BuildDNYPacket(physicalID uint32, messageID uint16, command uint8, data []byte) []byte {
-	// 1. 计算长度字段值（根据协议文档，包含校验和）
-	contentLen := b.PhysicalIDLen + b.MessageIDLen + b.CommandLen + len(data) + b.ChecksumLen
-
-	// 2. 计算总包长度
-	totalLen := b.HeaderLength + b.LengthField + contentLen
-
-	// 3. 创建数据包缓冲区
-	packet := make([]byte, 0, totalLen)
-
-	// 4. 写入包头 "DNY"
-	packet = append(packet, 'D', 'N', 'Y')
-
-	// 5. 写入长度字段（小端序）
-	packet = append(packet, byte(contentLen), byte(contentLen>>8))
-
-	// 6. 写入物理ID（小端序）
-	packet = append(packet,
-		byte(physicalID),
-		byte(physicalID>>8),
-		byte(physicalID>>16),
-		byte(physicalID>>24))
-
-	// 7. 写入消息ID（小端序）
-	packet = append(packet, byte(messageID), byte(messageID>>8))
-
-	// 8. 写入命令
-	packet = append(packet, command)
-
-	// 9. 写入数据
-	if len(data) > 0 {
-		packet = append(packet, data...)
-	}
-
-	// 10. 计算校验和（从包头"DNY"开始到当前位置的所有字节）
-	checksum := b.calculateChecksum(packet)
-
-	// 11. 写入校验和（小端序）
-	packet = append(packet, byte(checksum), byte(checksum>>8))
-
-	// 12. 调试日志
+	packet := dny_protocol.BuildFrame(physicalID, messageID, command, data)
 	if b.enableDebugLog {
-		b.logPacketDetails(physicalID, messageID, command, data, packet, checksum)
+		b.logPacketDetails(physicalID, messageID, command, data, packet, binary.LittleEndian.Uint16(packet[len(packet)-b.ChecksumLen:]))
 	}
-
 	return packet
 }
 
@@ -143,7 +104,7 @@ func (b *UnifiedDNYBuilder) logPacketDetails(physicalID uint32, messageID uint16
 	logger.WithFields(logrus.Fields{
 		"physicalID": fmt.Sprintf("0x%08X", physicalID),
 		"messageID":  fmt.Sprintf("0x%04X", messageID),
-		"command":    fmt.Sprintf("0x%02X", command),
+		"command":    dny_protocol.CommandLabel(command),
 		"dataLen":    len(data),
 		"packetLen":  len(packet),
 		"checksum":   fmt.Sprintf("0x%04X", checksum),
@@ -215,11 +176,25 @@ func SendDNYResponse(conn ziface.IConnection, physicalID uint32, messageID uint1
 	// 为了避免循环导入，这里需要通过接口调用
 	// 实际的实现会在init时注册
 	if globalSendDNYResponseFunc != nil {
-		return globalSendDNYResponseFunc(conn, physicalID, messageID, command, data)
+		err := globalSendDNYResponseFunc(conn, physicalID, messageID, command, data)
+		if err == nil && globalDNYResponseObserver != nil && conn != nil {
+			globalDNYResponseObserver(conn.GetConnID(), physicalID, messageID, command, data)
+		}
+		return err
 	}
 	return fmt.Errorf("统一发送器未初始化")
 }
 
+// DNYResponseObserver 应答发送成功后的回调（重复帧抑制据此记录应答，供设备重发时原样重放）
+type DNYResponseObserver func(connID uint64, physicalID uint32, messageID uint16, command uint8, data []byte)
+
+var globalDNYResponseObserver DNYResponseObserver
+
+// RegisterDNYResponseObserver 注册应答观察者（由使用方在 init 中调用）
+func RegisterDNYResponseObserver(observer DNYResponseObserver) {
+	globalDNYResponseObserver = observer
+}
+
 // 全局发送函数变量（避免循环导入）
 var globalSendDNYResponseFunc func(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte) error
 
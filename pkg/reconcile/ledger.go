@@ -0,0 +1,361 @@
+package reconcile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/sirupsen/logrus"
+)
+
+// DateLayout 对账日期格式（本地时区自然日）
+const DateLayout = "2006-01-02"
+
+const (
+	sessionFilePrefix    = "sessions-"
+	settlementFilePrefix = "settlements-"
+	ledgerFileSuffix     = ".jsonl"
+)
+
+// 台账记录的持久化类型与当前版本（台账文件较大，旧版本行在读取时迁移，不回写）
+const (
+	SessionRecordType    = "reconcile_session"
+	SettlementRecordType = "reconcile_settlement"
+
+	sessionRecordVersion    = 2 // v2: 增加租户
+	settlementRecordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(SessionRecordType, sessionRecordVersion)
+	persistence.RegisterType(SettlementRecordType, settlementRecordVersion)
+	persistence.RegisterMigration(SessionRecordType, 1, migrateSessionV1)
+}
+
+// migrateSessionV1 v1→v2：按资产映射补齐会话的租户（未映射的设备为空）
+func migrateSessionV1(data json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["tenant"]; !ok {
+		deviceID, _ := fields["device_id"].(string)
+		if info, found := asset.Lookup(deviceID); found && info.TenantID != "" {
+			fields["tenant"] = info.TenantID
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// SessionRecord 充电会话记录（订单创建即视为会话开始，状态随订单更新覆盖为最后已知状态）
+type SessionRecord struct {
+	OrderNo   string    `json:"order_no"`
+	DeviceID  string    `json:"device_id"`
+	Tenant    string    `json:"tenant,omitempty"` // 设备所属租户（资产映射）
+	Port      int       `json:"port"`
+	Mode      uint8     `json:"mode"`
+	Value     uint16    `json:"value,omitempty"` // 请求的充电时长(秒，按时间)或电量(0.1度，按电量)
+	StartTime time.Time `json:"start_time"`
+	Status    string    `json:"status"`           // 最后已知状态
+	Reason    string    `json:"reason,omitempty"` // 最后一次状态变更原因
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PromotionTag string     `json:"promotion_tag,omitempty"` // 生效的促销标签
+	QueuedAt     *time.Time `json:"queued_at,omitempty"`     // 设备侧排队开始时间（未排队为空）
+}
+
+// SettlementRecord 设备上报的结算记录（0x03）
+type SettlementRecord struct {
+	OrderNo    string    `json:"order_no"`
+	DeviceID   string    `json:"device_id"`
+	Port       int       `json:"port"`
+	EnergyWh   uint32    `json:"energy_wh"`
+	ChargeFee  uint32    `json:"charge_fee"`  // 分
+	ServiceFee uint32    `json:"service_fee"` // 分
+	TotalFee   uint32    `json:"total_fee"`   // 分
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	StopReason uint8     `json:"stop_reason"`
+	ReceivedAt time.Time `json:"received_at"`
+	Replayed   bool      `json:"replayed,omitempty"` // 从关键帧预写日志重放
+}
+
+// Ledger 会话/结算台账：内存索引 + 按自然日追加的JSONL文件（dir为空时仅保存在内存）
+// 会话按开始日期分文件、结算按接收日期分文件，重启后加载；同一订单的会话记录以最后一行为准
+type Ledger struct {
+	mutex       sync.RWMutex
+	dir         string
+	sessions    map[string]*SessionRecord    // key: orderNo
+	settlements map[string]*SettlementRecord // key: orderNo
+}
+
+// NewLedger 创建台账并加载目录中已有的记录
+func NewLedger(dir string) (*Ledger, error) {
+	l := &Ledger{
+		dir:         dir,
+		sessions:    make(map[string]*SessionRecord),
+		settlements: make(map[string]*SettlementRecord),
+	}
+	if dir == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建对账台账目录失败: %w", err)
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// RecordSession 记录会话开始或状态变更（开始时间以首次记录为准）
+func (l *Ledger) RecordSession(rec SessionRecord) {
+	if rec.OrderNo == "" {
+		return
+	}
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = time.Now()
+	}
+	l.mutex.Lock()
+	if existing, ok := l.sessions[rec.OrderNo]; ok && !existing.StartTime.IsZero() {
+		rec.StartTime = existing.StartTime
+	}
+	if rec.StartTime.IsZero() {
+		rec.StartTime = rec.UpdatedAt
+	}
+	stored := rec
+	l.sessions[rec.OrderNo] = &stored
+	l.mutex.Unlock()
+
+	l.append(sessionFilePrefix, SessionRecordType, rec.StartTime, rec)
+}
+
+// RecordSettlement 记录结算；同一订单重复上报只保留首次，返回是否为新记录
+func (l *Ledger) RecordSettlement(rec SettlementRecord) bool {
+	if rec.OrderNo == "" {
+		return false
+	}
+	if rec.ReceivedAt.IsZero() {
+		rec.ReceivedAt = time.Now()
+	}
+	l.mutex.Lock()
+	if _, exists := l.settlements[rec.OrderNo]; exists {
+		l.mutex.Unlock()
+		return false
+	}
+	stored := rec
+	l.settlements[rec.OrderNo] = &stored
+	l.mutex.Unlock()
+
+	l.append(settlementFilePrefix, SettlementRecordType, rec.ReceivedAt, rec)
+	return true
+}
+
+// Session 按订单号查询会话
+func (l *Ledger) Session(orderNo string) (SessionRecord, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if s, ok := l.sessions[orderNo]; ok {
+		return *s, true
+	}
+	return SessionRecord{}, false
+}
+
+// Settlement 按订单号查询结算
+func (l *Ledger) Settlement(orderNo string) (SettlementRecord, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if s, ok := l.settlements[orderNo]; ok {
+		return *s, true
+	}
+	return SettlementRecord{}, false
+}
+
+// SessionsStartedBetween 开始时间位于 [from, to) 的会话（按开始时间排序）
+func (l *Ledger) SessionsStartedBetween(from, to time.Time) []SessionRecord {
+	l.mutex.RLock()
+	list := make([]SessionRecord, 0)
+	for _, s := range l.sessions {
+		if !s.StartTime.Before(from) && s.StartTime.Before(to) {
+			list = append(list, *s)
+		}
+	}
+	l.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].StartTime.Before(list[j].StartTime) })
+	return list
+}
+
+// SettlementsReceivedBetween 接收时间位于 [from, to) 的结算（按接收时间排序）
+func (l *Ledger) SettlementsReceivedBetween(from, to time.Time) []SettlementRecord {
+	l.mutex.RLock()
+	list := make([]SettlementRecord, 0)
+	for _, s := range l.settlements {
+		if !s.ReceivedAt.Before(from) && s.ReceivedAt.Before(to) {
+			list = append(list, *s)
+		}
+	}
+	l.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ReceivedAt.Before(list[j].ReceivedAt) })
+	return list
+}
+
+// Prune 删除早于 before 所在自然日的记录与台账文件
+func (l *Ledger) Prune(before time.Time) int {
+	cutoff := dayStart(before)
+	removed := 0
+	l.mutex.Lock()
+	for orderNo, s := range l.sessions {
+		if s.StartTime.Before(cutoff) {
+			delete(l.sessions, orderNo)
+			removed++
+		}
+	}
+	for orderNo, s := range l.settlements {
+		if s.ReceivedAt.Before(cutoff) {
+			delete(l.settlements, orderNo)
+			removed++
+		}
+	}
+	l.mutex.Unlock()
+
+	if l.dir == "" {
+		return removed
+	}
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return removed
+	}
+	for _, entry := range entries {
+		day, ok := ledgerFileDay(entry.Name())
+		if ok && day.Before(cutoff) {
+			_ = os.Remove(filepath.Join(l.dir, entry.Name()))
+		}
+	}
+	return removed
+}
+
+// append 追加一行到对应自然日的台账文件；写入失败仅记录日志，内存记录仍可用于当次进程内对账
+func (l *Ledger) append(prefix, recordType string, day time.Time, rec interface{}) {
+	if l.dir == "" {
+		return
+	}
+	line, err := persistence.Encode(recordType, rec)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(l.dir, prefix+day.Format(DateLayout)+ledgerFileSuffix)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"path":  path,
+			"error": err.Error(),
+		}).Warn("⚠️ 写入对账台账失败")
+	}
+}
+
+// load 加载台账文件：旧版本的行在读取时迁移；版本未知的行按持久化策略拒绝加载或归档跳过
+func (l *Ledger) load() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("读取对账台账目录失败: %w", err)
+	}
+	var fatal error
+	decode := func(recordType string, data []byte, v interface{}) bool {
+		_, err := persistence.Decode(recordType, data, v)
+		if errors.Is(err, persistence.ErrFutureVersion) && fatal == nil {
+			fatal = err
+		}
+		return err == nil
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := ledgerFileDay(name); !ok {
+			continue
+		}
+		path := filepath.Join(l.dir, name)
+		if strings.HasPrefix(name, sessionFilePrefix) {
+			err = readLines(path, func(data []byte) {
+				var rec SessionRecord
+				if decode(SessionRecordType, data, &rec) && rec.OrderNo != "" {
+					l.sessions[rec.OrderNo] = &rec
+				}
+			})
+		} else {
+			err = readLines(path, func(data []byte) {
+				var rec SettlementRecord
+				if decode(SettlementRecordType, data, &rec) && rec.OrderNo != "" {
+					if _, exists := l.settlements[rec.OrderNo]; !exists {
+						l.settlements[rec.OrderNo] = &rec
+					}
+				}
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("加载对账台账 %s 失败: %w", name, err)
+		}
+		if fatal != nil {
+			return fmt.Errorf("加载对账台账 %s 失败: %w", name, fatal)
+		}
+	}
+	return nil
+}
+
+// readLines 逐行读取JSONL文件（末尾写一半的行解析失败时忽略）
+func readLines(path string, fn func([]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// ledgerFileDay 解析台账文件名中的日期
+func ledgerFileDay(name string) (time.Time, bool) {
+	if !strings.HasSuffix(name, ledgerFileSuffix) {
+		return time.Time{}, false
+	}
+	var rest string
+	switch {
+	case strings.HasPrefix(name, sessionFilePrefix):
+		rest = strings.TrimPrefix(name, sessionFilePrefix)
+	case strings.HasPrefix(name, settlementFilePrefix):
+		rest = strings.TrimPrefix(name, settlementFilePrefix)
+	default:
+		return time.Time{}, false
+	}
+	day, err := time.ParseInLocation(DateLayout, strings.TrimSuffix(rest, ledgerFileSuffix), time.Local)
+	return day, err == nil
+}
+
+// dayStart 本地时区自然日零点
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
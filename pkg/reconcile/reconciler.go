@@ -0,0 +1,615 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultGrace         = time.Hour
+	defaultRetentionDays = 30
+	defaultRunAt         = "01:30"
+	scheduleTick         = time.Minute
+	reportsSubdir        = "reports"
+)
+
+// 报告触发方式
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+)
+
+// ErrRunInProgress 同一日期的对账正在执行
+var ErrRunInProgress = errors.New("该日期正在对账中")
+
+// explainedStatuses 会话最后状态为取消/失败时设备不会上报结算，不计入缺失（与 gateway.OrderStatus 字符串一致）
+var explainedStatuses = map[string]bool{
+	"cancelled": true,
+	"failed":    true,
+}
+
+// Totals 电量与费用合计
+type Totals struct {
+	EnergyWh   uint64 `json:"energy_wh"`
+	ChargeFee  uint64 `json:"charge_fee"`  // 分
+	ServiceFee uint64 `json:"service_fee"` // 分
+	TotalFee   uint64 `json:"total_fee"`   // 分
+}
+
+func (t *Totals) add(s SettlementRecord) {
+	t.EnergyWh += uint64(s.EnergyWh)
+	t.ChargeFee += uint64(s.ChargeFee)
+	t.ServiceFee += uint64(s.ServiceFee)
+	t.TotalFee += uint64(s.TotalFee)
+}
+
+// MatchedSession 已匹配结算的会话
+type MatchedSession struct {
+	Session    SessionRecord    `json:"session"`
+	Settlement SettlementRecord `json:"settlement"`
+	Late       bool             `json:"late"` // 结算在次日零点后（宽限期内）到达
+}
+
+// Report 日对账报告：当日开始的会话 vs 收到的结算，按订单号匹配
+type Report struct {
+	Date         string    `json:"date"`
+	GeneratedAt  time.Time `json:"generated_at"`
+	Trigger      string    `json:"trigger"`
+	GraceMinutes int       `json:"grace_minutes"`
+	Provisional  bool      `json:"provisional"` // 宽限期尚未结束，之后到达的结算未计入
+
+	SessionCount    int `json:"session_count"`
+	SettlementCount int `json:"settlement_count"` // 计入本报告的结算（已匹配 + 无会话）
+	MatchedCount    int `json:"matched_count"`
+	LateCount       int `json:"late_count"`
+	ExplainedCount  int `json:"explained_count"`
+	MissingCount    int `json:"missing_count"`
+	OrphanCount     int `json:"orphan_count"`
+
+	MatchedTotals Totals `json:"matched_totals"`
+	OrphanTotals  Totals `json:"orphan_totals"`
+
+	Matched            []MatchedSession   `json:"matched"`
+	MissingSettlements []SessionRecord    `json:"missing_settlements"` // 无结算且无取消/失败原因的会话
+	ExplainedSessions  []SessionRecord    `json:"explained_sessions"`  // 已取消/失败（原因见 reason）的无结算会话
+	OrphanSettlements  []SettlementRecord `json:"orphan_settlements"`  // 找不到对应会话的结算
+}
+
+// Summary 报告摘要（列表接口与通知使用，不含明细）
+func (r *Report) Summary() map[string]interface{} {
+	return map[string]interface{}{
+		"date":             r.Date,
+		"generated_at":     r.GeneratedAt.Unix(),
+		"trigger":          r.Trigger,
+		"provisional":      r.Provisional,
+		"session_count":    r.SessionCount,
+		"settlement_count": r.SettlementCount,
+		"matched_count":    r.MatchedCount,
+		"late_count":       r.LateCount,
+		"explained_count":  r.ExplainedCount,
+		"missing_count":    r.MissingCount,
+		"orphan_count":     r.OrphanCount,
+		"matched_totals":   r.MatchedTotals,
+		"orphan_totals":    r.OrphanTotals,
+	}
+}
+
+// ReportHandler 定时对账完成回调
+type ReportHandler func(report *Report)
+
+// Options 对账选项
+type Options struct {
+	Dir           string        // 台账与报告目录，为空时仅保存在内存
+	Grace         time.Duration // 次日零点后继续等待结算的宽限期
+	RetentionDays int           // 报告保留天数
+	RunAt         string        // 每日定时对账时间（HH:MM，本地时区），对账前一自然日
+}
+
+// SettlementSource 外部结算来源（结算日志存储）：对账优先使用，台账中仅有的结算（如存储启用前收到的）仍参与匹配
+type SettlementSource interface {
+	Settlement(orderNo string) (SettlementRecord, bool)
+	SettlementsReceivedBetween(from, to time.Time) []SettlementRecord
+}
+
+// Reconciler 日终对账：维护会话/结算台账，定时或按需生成对账报告
+type Reconciler struct {
+	mutex     sync.RWMutex
+	ledger    *Ledger
+	opts      Options
+	runHour   int
+	runMinute int
+	reports   map[string]*Report // key: 日期
+	running   map[string]bool
+	handlers  []ReportHandler
+	lastRun   string // 最近一次定时对账的日期
+	cancel    context.CancelFunc
+	source    SettlementSource
+}
+
+// NewReconciler 创建对账器（加载已有台账与报告）
+func NewReconciler(opts Options) (*Reconciler, error) {
+	if opts.Grace <= 0 {
+		opts.Grace = defaultGrace
+	}
+	if opts.RetentionDays <= 0 {
+		opts.RetentionDays = defaultRetentionDays
+	}
+	if opts.RunAt == "" {
+		opts.RunAt = defaultRunAt
+	}
+	runAt, err := time.Parse("15:04", opts.RunAt)
+	if err != nil {
+		return nil, fmt.Errorf("对账时间格式错误(应为HH:MM): %s", opts.RunAt)
+	}
+	ledger, err := NewLedger(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reconciler{
+		ledger:    ledger,
+		opts:      opts,
+		runHour:   runAt.Hour(),
+		runMinute: runAt.Minute(),
+		reports:   make(map[string]*Report),
+		running:   make(map[string]bool),
+	}
+	if err := r.loadReports(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Ledger 会话/结算台账
+func (r *Reconciler) Ledger() *Ledger {
+	return r.ledger
+}
+
+// SetSettlementSource 设置外部结算来源（nil表示仅使用台账）
+func (r *Reconciler) SetSettlementSource(source SettlementSource) {
+	r.mutex.Lock()
+	r.source = source
+	r.mutex.Unlock()
+}
+
+func (r *Reconciler) settlementSource() SettlementSource {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.source
+}
+
+// settlement 按订单号查询结算：外部来源优先，未找到时查台账
+func (r *Reconciler) settlement(orderNo string) (SettlementRecord, bool) {
+	if source := r.settlementSource(); source != nil {
+		if s, ok := source.Settlement(orderNo); ok {
+			return s, true
+		}
+	}
+	return r.ledger.Settlement(orderNo)
+}
+
+// settlementsReceivedBetween 合并外部来源与台账的结算（同一订单号以外部来源为准，按接收时间排序）
+func (r *Reconciler) settlementsReceivedBetween(from, to time.Time) []SettlementRecord {
+	source := r.settlementSource()
+	if source == nil {
+		return r.ledger.SettlementsReceivedBetween(from, to)
+	}
+	list := source.SettlementsReceivedBetween(from, to)
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		seen[s.OrderNo] = true
+	}
+	for _, s := range r.ledger.SettlementsReceivedBetween(from, to) {
+		if !seen[s.OrderNo] {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ReceivedAt.Before(list[j].ReceivedAt) })
+	return list
+}
+
+// RegisterHandler 注册定时对账完成回调
+func (r *Reconciler) RegisterHandler(handler ReportHandler) {
+	if handler == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.handlers = append(r.handlers, handler)
+	r.mutex.Unlock()
+}
+
+// HandlerCount 已注册的回调数量
+func (r *Reconciler) HandlerCount() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.handlers)
+}
+
+// ParseDate 解析对账日期（本地时区）
+func ParseDate(date string) (time.Time, error) {
+	day, err := time.ParseInLocation(DateLayout, date, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("日期格式错误(应为YYYY-MM-DD): %s", date)
+	}
+	return day, nil
+}
+
+// Run 对账指定自然日并保存报告（同一日期重复执行时覆盖旧报告）
+func (r *Reconciler) Run(day time.Time, trigger string) (*Report, error) {
+	day = dayStart(day)
+	date := day.Format(DateLayout)
+	now := time.Now()
+	if day.After(now) {
+		return nil, fmt.Errorf("不能对账未来日期: %s", date)
+	}
+
+	r.mutex.Lock()
+	if r.running[date] {
+		r.mutex.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrRunInProgress, date)
+	}
+	r.running[date] = true
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.running, date)
+		r.mutex.Unlock()
+	}()
+
+	report := r.evaluate(day, now)
+	report.Trigger = trigger
+
+	r.mutex.Lock()
+	r.reports[date] = report
+	r.mutex.Unlock()
+	if err := r.saveReport(report); err != nil {
+		logger.WithFields(logrus.Fields{
+			"date":  date,
+			"error": err.Error(),
+		}).Warn("⚠️ 保存对账报告失败，报告仅保留在内存中")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"date":        date,
+		"trigger":     trigger,
+		"sessions":    report.SessionCount,
+		"matched":     report.MatchedCount,
+		"late":        report.LateCount,
+		"missing":     report.MissingCount,
+		"orphan":      report.OrphanCount,
+		"provisional": report.Provisional,
+	}).Info("📒 日终对账完成")
+	return report, nil
+}
+
+// evaluate 匹配规则：
+//   - 会话：当日开始的全部会话
+//   - 已匹配：结算在次日零点+宽限期之前到达（零点后到达的计为 late）
+//   - 无结算：取消/失败的会话单列为有原因，其余计为缺失
+//   - 无会话结算：当日收到、且台账中找不到对应会话（含前一日开始的会话）的结算
+func (r *Reconciler) evaluate(day, now time.Time) *Report {
+	dayEnd := day.AddDate(0, 0, 1)
+	windowEnd := dayEnd.Add(r.opts.Grace)
+	report := &Report{
+		Date:               day.Format(DateLayout),
+		GeneratedAt:        now,
+		GraceMinutes:       int(r.opts.Grace / time.Minute),
+		Provisional:        now.Before(windowEnd),
+		Matched:            []MatchedSession{},
+		MissingSettlements: []SessionRecord{},
+		ExplainedSessions:  []SessionRecord{},
+		OrphanSettlements:  []SettlementRecord{},
+	}
+
+	sessions := r.ledger.SessionsStartedBetween(day, dayEnd)
+	report.SessionCount = len(sessions)
+	for _, s := range sessions {
+		settlement, ok := r.settlement(s.OrderNo)
+		if ok && settlement.ReceivedAt.Before(windowEnd) {
+			late := !settlement.ReceivedAt.Before(dayEnd)
+			report.Matched = append(report.Matched, MatchedSession{Session: s, Settlement: settlement, Late: late})
+			report.MatchedTotals.add(settlement)
+			if late {
+				report.LateCount++
+			}
+			continue
+		}
+		if explainedStatuses[s.Status] {
+			report.ExplainedSessions = append(report.ExplainedSessions, s)
+		} else {
+			report.MissingSettlements = append(report.MissingSettlements, s)
+		}
+	}
+
+	for _, s := range r.settlementsReceivedBetween(day, dayEnd) {
+		if _, known := r.ledger.Session(s.OrderNo); known {
+			continue
+		}
+		report.OrphanSettlements = append(report.OrphanSettlements, s)
+		report.OrphanTotals.add(s)
+	}
+
+	report.MatchedCount = len(report.Matched)
+	report.ExplainedCount = len(report.ExplainedSessions)
+	report.MissingCount = len(report.MissingSettlements)
+	report.OrphanCount = len(report.OrphanSettlements)
+	report.SettlementCount = report.MatchedCount + report.OrphanCount
+	return report
+}
+
+// GetReport 获取指定日期的报告
+func (r *Reconciler) GetReport(date string) (*Report, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	report, ok := r.reports[date]
+	return report, ok
+}
+
+// ListReports 列出保留的报告（按日期倒序）
+func (r *Reconciler) ListReports() []*Report {
+	r.mutex.RLock()
+	list := make([]*Report, 0, len(r.reports))
+	for _, report := range r.reports {
+		list = append(list, report)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Date > list[j].Date })
+	return list
+}
+
+// Start 启动定时对账：每天到达 RunAt 后对账前一自然日（已有定时报告时跳过）
+func (r *Reconciler) Start(ctx context.Context) {
+	r.mutex.Lock()
+	if r.cancel != nil {
+		r.mutex.Unlock()
+		return
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.mutex.Unlock()
+
+	if r.opts.Grace > time.Duration(r.runHour)*time.Hour+time.Duration(r.runMinute)*time.Minute {
+		logger.WithFields(logrus.Fields{
+			"runAt":        r.opts.RunAt,
+			"graceMinutes": int(r.opts.Grace / time.Minute),
+		}).Warn("⚠️ 定时对账时间早于结算宽限期结束，报告将标记为临时结果")
+	}
+
+	go func() {
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				r.tick(now)
+			}
+		}
+	}()
+}
+
+// Stop 停止定时对账
+func (r *Reconciler) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+func (r *Reconciler) tick(now time.Time) {
+	today := dayStart(now)
+	if now.Before(today.Add(time.Duration(r.runHour)*time.Hour + time.Duration(r.runMinute)*time.Minute)) {
+		return
+	}
+	target := today.AddDate(0, 0, -1)
+	date := target.Format(DateLayout)
+
+	r.mutex.Lock()
+	if r.lastRun == date {
+		r.mutex.Unlock()
+		return
+	}
+	r.lastRun = date
+	existing, ok := r.reports[date]
+	r.mutex.Unlock()
+	if ok && existing.Trigger == TriggerScheduled {
+		return
+	}
+
+	report, err := r.Run(target, TriggerScheduled)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"date":  date,
+			"error": err.Error(),
+		}).Warn("定时对账失败")
+		return
+	}
+	r.prune(now)
+
+	r.mutex.RLock()
+	handlers := append([]ReportHandler(nil), r.handlers...)
+	r.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(report)
+	}
+}
+
+// prune 清理超过保留天数的报告；台账多保留一天，保证最早一份报告仍可重新对账（需要次日的结算）
+func (r *Reconciler) prune(now time.Time) {
+	cutoff := dayStart(now).AddDate(0, 0, -r.opts.RetentionDays)
+	cutoffDate := cutoff.Format(DateLayout)
+
+	r.mutex.Lock()
+	var removed []string
+	for date := range r.reports {
+		if date < cutoffDate {
+			delete(r.reports, date)
+			removed = append(removed, date)
+		}
+	}
+	r.mutex.Unlock()
+
+	if r.opts.Dir != "" {
+		for _, date := range removed {
+			_ = os.Remove(r.reportPath(date))
+		}
+	}
+	r.ledger.Prune(cutoff.AddDate(0, 0, -1))
+}
+
+func (r *Reconciler) reportPath(date string) string {
+	return filepath.Join(r.opts.Dir, reportsSubdir, date+".json")
+}
+
+// saveReport 写入报告（先写临时文件再重命名）
+func (r *Reconciler) saveReport(report *Report) error {
+	if r.opts.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(r.opts.Dir, reportsSubdir), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := r.reportPath(report.Date)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (r *Reconciler) loadReports() error {
+	if r.opts.Dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(r.opts.Dir, reportsSubdir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取对账报告目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(r.opts.Dir, reportsSubdir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("读取对账报告 %s 失败: %w", entry.Name(), err)
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return fmt.Errorf("解析对账报告 %s 失败: %w", entry.Name(), err)
+		}
+		r.reports[report.Date] = &report
+	}
+	return nil
+}
+
+// WriteCSV 以CSV格式导出报告明细（每个会话/结算一行）
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"category", "order_no", "device_id", "port", "start_time", "last_status", "reason",
+		"settlement_received_at", "energy_wh", "charge_fee", "service_fee", "total_fee"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	sessionRow := func(category string, s SessionRecord) []string {
+		return []string{category, s.OrderNo, s.DeviceID, strconv.Itoa(s.Port), formatTime(s.StartTime), s.Status, s.Reason}
+	}
+	settlementCols := func(s SettlementRecord) []string {
+		return []string{formatTime(s.ReceivedAt), strconv.FormatUint(uint64(s.EnergyWh), 10),
+			strconv.FormatUint(uint64(s.ChargeFee), 10), strconv.FormatUint(uint64(s.ServiceFee), 10),
+			strconv.FormatUint(uint64(s.TotalFee), 10)}
+	}
+
+	var rows [][]string
+	for _, m := range r.Matched {
+		category := "matched"
+		if m.Late {
+			category = "matched_late"
+		}
+		rows = append(rows, append(sessionRow(category, m.Session), settlementCols(m.Settlement)...))
+	}
+	for _, s := range r.MissingSettlements {
+		rows = append(rows, append(sessionRow("missing_settlement", s), "", "", "", "", ""))
+	}
+	for _, s := range r.ExplainedSessions {
+		rows = append(rows, append(sessionRow("explained", s), "", "", "", "", ""))
+	}
+	for _, s := range r.OrphanSettlements {
+		row := []string{"orphan_settlement", s.OrderNo, s.DeviceID, strconv.Itoa(s.Port), formatTime(s.StartTime), "", ""}
+		rows = append(rows, append(row, settlementCols(s)...))
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalReconciler *Reconciler
+
+// GetGlobalReconciler 获取全局对账器（未初始化时创建仅内存的实例）
+func GetGlobalReconciler() *Reconciler {
+	if globalReconciler == nil {
+		globalReconciler, _ = NewReconciler(Options{})
+	}
+	return globalReconciler
+}
+
+// InitGlobalReconciler 按配置初始化全局对账器并启动定时对账
+func InitGlobalReconciler(ctx context.Context) error {
+	cfg := config.GetConfig().Reconciliation
+	r, err := NewReconciler(Options{
+		Dir:           cfg.Dir,
+		Grace:         time.Duration(cfg.GraceMinutes) * time.Minute,
+		RetentionDays: cfg.RetentionDays,
+		RunAt:         cfg.RunAt,
+	})
+	if err != nil {
+		return err
+	}
+	globalReconciler = r
+	r.prune(time.Now())
+	if cfg.Enabled {
+		r.Start(ctx)
+	}
+	return nil
+}
+
+// StopGlobalReconciler 停止全局对账器的定时任务
+func StopGlobalReconciler() {
+	if globalReconciler != nil {
+		globalReconciler.Stop()
+	}
+}
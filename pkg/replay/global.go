@@ -0,0 +1,47 @@
+package replay
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+)
+
+var globalCoordinator atomic.Pointer[Coordinator]
+
+// GetGlobalCoordinator 获取全局积压重放协调器（未启用时为nil，nil 的 Held 恒为false）
+func GetGlobalCoordinator() *Coordinator {
+	return globalCoordinator.Load()
+}
+
+// SetGlobalCoordinator 替换全局积压重放协调器（测试使用）
+func SetGlobalCoordinator(c *Coordinator) {
+	globalCoordinator.Store(c)
+}
+
+// InitGlobalCoordinator 按配置创建全局积压重放协调器（须在各子系统开始常规重放之前调用），未启用时返回nil
+func InitGlobalCoordinator() (*Coordinator, error) {
+	cfg := config.GetConfig().PostOutageReplay
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	c, err := New(Options{
+		StateFile:     cfg.StateFile,
+		Threshold:     time.Duration(cfg.DowntimeThresholdSeconds) * time.Second,
+		MarkInterval:  time.Duration(cfg.MarkIntervalSeconds) * time.Second,
+		AutoApprove:   cfg.AutoApprove,
+		RatePerSecond: cfg.RatePerSecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	globalCoordinator.Store(c)
+	return c, nil
+}
+
+// StopGlobalCoordinator 停止全局积压重放协调器并写入最后的存活时间标记
+func StopGlobalCoordinator() {
+	if c := globalCoordinator.Swap(nil); c != nil {
+		c.Stop()
+	}
+}
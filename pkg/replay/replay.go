@@ -0,0 +1,607 @@
+// Package replay 长时间停机后的积压重放审批
+//
+// 运行期间定期写入存活时间标记；启动时与上次标记比较，停机时长超过阈值时各子系统积压的待重放工作
+// （延迟命令、通知暂存、关键帧日志）保持"待审批"状态，不经各自的常规流程自动重放。运维查看重放计划
+// （各类别条数、积压时长范围、预计下行量）并批准后，按配置速率逐条重放；各类别独立上报进度并可单独暂停。
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 重放类别
+const (
+	CategoryDeferredCommands  = "deferred_commands"  // 等待设备上线的延迟命令
+	CategoryNotificationSpool = "notification_spool" // 重试用尽后暂存的通知
+	CategoryFrameJournal      = "frame_journal"      // 关键帧预写日志中未处理的结算等上行帧
+)
+
+const (
+	defaultStateFile    = "./data/replay/last_alive.json"
+	defaultThreshold    = time.Hour
+	defaultMarkInterval = 30 * time.Second
+)
+
+// State 类别的重放状态
+type State string
+
+const (
+	StateReleased        State = "released"         // 停机时长未超过阈值，由子系统常规流程重放
+	StatePendingApproval State = "pending_approval" // 等待批准
+	StateRunning         State = "running"          // 重放中
+	StatePaused          State = "paused"           // 已暂停
+	StateCompleted       State = "completed"        // 已完成，后续由子系统常规流程处理
+)
+
+// Outcome 单条重放结果
+type Outcome int
+
+const (
+	OutcomeReplayed Outcome = iota // 已发送
+	OutcomeSkipped                 // 无需发送（重复、过期、目标已不存在）
+	OutcomeFailed                  // 失败，保留给子系统常规流程重试
+)
+
+var (
+	// ErrNotHeld 本次启动未暂缓重放，无需批准
+	ErrNotHeld = errors.New("本次启动停机时长未超过阈值，积压工作未暂缓")
+	// ErrUnknownCategory 未注册的重放类别
+	ErrUnknownCategory = errors.New("未知的重放类别")
+	// ErrInvalidState 类别当前状态不允许该操作
+	ErrInvalidState = errors.New("重放类别当前状态不允许该操作")
+	// ErrStopped 协调器已停止，重放中断
+	ErrStopped = errors.New("重放协调器已停止")
+)
+
+// Item 待重放的一条工作
+type Item struct {
+	ID       string    `json:"id"`
+	At       time.Time `json:"at"`       // 产生（入队/暂存/接收）时间
+	Outbound int       `json:"outbound"` // 预计下行（设备帧或HTTP请求）数
+}
+
+// Source 子系统的待重放工作
+type Source interface {
+	// Items 当前待重放的条目（用于重放计划，按重放顺序）
+	Items() []Item
+	// Run 执行重放：每次发送前调用 ctl.Wait()，返回false时立即停止；每条处理后调用 ctl.Record()
+	Run(ctl *Control) error
+}
+
+// Progress 类别的重放进度
+type Progress struct {
+	Total      int        `json:"total"`    // 开始重放时的待重放条数
+	Replayed   int        `json:"replayed"` // 已发送
+	Skipped    int        `json:"skipped"`  // 无需发送
+	Failed     int        `json:"failed"`   // 失败（保留给子系统常规流程重试）
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// CategoryPlan 类别的重放计划与进度
+type CategoryPlan struct {
+	Category          string     `json:"category"`
+	Description       string     `json:"description"`
+	State             State      `json:"state"`
+	Count             int        `json:"count"`              // 当前待重放条数
+	OldestAt          *time.Time `json:"oldestAt,omitempty"` // 最早一条的产生时间
+	NewestAt          *time.Time `json:"newestAt,omitempty"` // 最晚一条的产生时间
+	MaxAgeSeconds     int64      `json:"maxAgeSeconds"`      // 积压时长范围（秒）
+	MinAgeSeconds     int64      `json:"minAgeSeconds"`
+	EstimatedOutbound int        `json:"estimatedOutbound"` // 预计下行量
+	RatePerSecond     float64    `json:"ratePerSecond"`     // 重放速率（条/秒），0表示不限速
+	EstimatedSeconds  float64    `json:"estimatedSeconds"`  // 按重放速率估算的耗时（不限速时为0）
+	Progress          Progress   `json:"progress"`
+	Paused            bool       `json:"paused,omitempty"`
+	ApprovedAt        *time.Time `json:"approvedAt,omitempty"`
+	ApprovedBy        string     `json:"approvedBy,omitempty"`
+}
+
+// Plan 停机积压重放计划
+type Plan struct {
+	Held             bool           `json:"held"`                  // 本次启动是否因停机过久暂缓重放
+	LastAliveAt      *time.Time     `json:"lastAliveAt,omitempty"` // 上次运行的最后存活时间
+	StartedAt        time.Time      `json:"startedAt"`             // 本次启动时间
+	DowntimeSeconds  int64          `json:"downtimeSeconds"`       // 停机时长
+	ThresholdSeconds int64          `json:"thresholdSeconds"`      // 暂缓阈值
+	AutoApprove      bool           `json:"autoApprove"`           // 无人值守站点自动批准
+	RatePerSecond    float64        `json:"ratePerSecond"`         // 默认重放速率
+	Categories       []CategoryPlan `json:"categories"`
+}
+
+// ApproveRequest 批准重放
+type ApproveRequest struct {
+	Categories    []string // 为空时批准全部待审批类别
+	RatePerSecond float64  // 本次批准类别的重放速率（条/秒），<=0 时使用默认速率
+	ApprovedBy    string
+}
+
+// Options 协调器参数
+type Options struct {
+	StateFile     string        // 存活时间标记文件
+	Threshold     time.Duration // 停机超过该时长时暂缓重放
+	MarkInterval  time.Duration // 存活时间标记写入间隔
+	AutoApprove   bool          // 启动完成后自动批准全部类别（仍按速率重放）
+	RatePerSecond float64       // 默认重放速率（条/秒），0表示不限速
+	Now           func() time.Time
+}
+
+type category struct {
+	name        string
+	description string
+	source      Source
+	state       State
+	rate        float64
+	progress    Progress
+	approvedAt  *time.Time
+	approvedBy  string
+	nextAt      time.Time
+	resume      chan struct{} // 暂停时创建，恢复时关闭
+}
+
+// Coordinator 停机积压重放协调器
+type Coordinator struct {
+	opts        Options
+	startedAt   time.Time
+	lastAliveAt *time.Time
+	held        bool
+
+	mu         sync.Mutex
+	categories map[string]*category
+	order      []string
+	started    bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New 读取上次的存活时间标记并判断是否暂缓重放（首次启动无标记时不暂缓）；
+// 上次启动暂缓的类别未全部重放完成时本次同样暂缓
+func New(opts Options) (*Coordinator, error) {
+	if opts.StateFile == "" {
+		opts.StateFile = defaultStateFile
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = defaultThreshold
+	}
+	if opts.MarkInterval <= 0 {
+		opts.MarkInterval = defaultMarkInterval
+	}
+	if opts.RatePerSecond < 0 {
+		opts.RatePerSecond = 0
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	c := &Coordinator{opts: opts, startedAt: opts.Now(), categories: make(map[string]*category)}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	last, err := readMarker(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		c.lastAliveAt = &last.LastAliveAt
+		// 上次启动暂缓的积压尚未重放完就再次停机时继续暂缓（避免短时间内反复重启绕过审批）
+		c.held = c.startedAt.Sub(last.LastAliveAt) > opts.Threshold || last.Held
+	}
+	if err := c.mark(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Register 注册子系统的待重放工作（须在 Start 之前）
+func (c *Coordinator) Register(name, description string, source Source) {
+	if c == nil || source == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cat, ok := c.categories[name]
+	if !ok {
+		cat = &category{name: name, state: StateReleased}
+		if c.held {
+			cat.state = StatePendingApproval
+		}
+		c.categories[name] = cat
+		c.order = append(c.order, name)
+	}
+	cat.description, cat.source = description, source
+}
+
+// Held 类别的积压工作是否仍须暂缓（待审批、重放中或已暂停）；子系统常规重放流程在返回true时跳过。
+// 未注册的类别在暂缓期间同样返回true
+func (c *Coordinator) Held(name string) bool {
+	if c == nil || !c.held {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cat, ok := c.categories[name]
+	return !ok || cat.state != StateCompleted
+}
+
+// Downtime 停机时长（首次启动为0）
+func (c *Coordinator) Downtime() time.Duration {
+	if c == nil || c.lastAliveAt == nil {
+		return 0
+	}
+	return c.startedAt.Sub(*c.lastAliveAt)
+}
+
+// Start 启动存活时间标记；配置了自动批准时批准全部类别
+func (c *Coordinator) Start() {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return
+	}
+	c.started = true
+	c.mu.Unlock()
+
+	fields := logrus.Fields{
+		"downtime":  c.Downtime().Truncate(time.Second).String(),
+		"threshold": c.opts.Threshold.String(),
+	}
+	if c.held {
+		logger.WithFields(fields).Warn("⏸️ 停机时长超过阈值，积压的延迟命令、通知暂存与关键帧日志暂缓重放，等待批准（GET /api/v1/admin/replay-plan）")
+		if c.opts.AutoApprove {
+			if _, err := c.Approve(ApproveRequest{ApprovedBy: "auto"}); err != nil {
+				logger.WithFields(logrus.Fields{"error": err.Error()}).Error("自动批准积压重放失败")
+			}
+		}
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.opts.MarkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.mark(); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("写入存活时间标记失败")
+				}
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop 中断进行中的重放并写入最后的存活时间标记
+func (c *Coordinator) Stop() {
+	c.cancel()
+	c.wg.Wait()
+	if err := c.mark(); err != nil {
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("写入存活时间标记失败")
+	}
+}
+
+// Plan 当前的重放计划与各类别进度
+func (c *Coordinator) Plan() Plan {
+	plan := Plan{
+		Held:             c.held,
+		LastAliveAt:      c.lastAliveAt,
+		StartedAt:        c.startedAt,
+		DowntimeSeconds:  int64(c.Downtime().Seconds()),
+		ThresholdSeconds: int64(c.opts.Threshold.Seconds()),
+		AutoApprove:      c.opts.AutoApprove,
+		RatePerSecond:    c.opts.RatePerSecond,
+		Categories:       make([]CategoryPlan, 0, len(c.order)),
+	}
+	c.mu.Lock()
+	cats := make([]*category, 0, len(c.order))
+	for _, name := range c.order {
+		cats = append(cats, c.categories[name])
+	}
+	c.mu.Unlock()
+
+	now := c.opts.Now()
+	for _, cat := range cats {
+		items := cat.source.Items()
+		c.mu.Lock()
+		cp := CategoryPlan{
+			Category:      cat.name,
+			Description:   cat.description,
+			State:         cat.state,
+			Count:         len(items),
+			RatePerSecond: c.rateLocked(cat),
+			Progress:      cat.progress,
+			Paused:        cat.state == StatePaused,
+			ApprovedAt:    cat.approvedAt,
+			ApprovedBy:    cat.approvedBy,
+		}
+		c.mu.Unlock()
+		for i := range items {
+			cp.EstimatedOutbound += items[i].Outbound
+			at := items[i].At
+			if cp.OldestAt == nil || at.Before(*cp.OldestAt) {
+				cp.OldestAt = &at
+			}
+			if cp.NewestAt == nil || at.After(*cp.NewestAt) {
+				cp.NewestAt = &at
+			}
+		}
+		if cp.OldestAt != nil {
+			cp.MaxAgeSeconds = int64(now.Sub(*cp.OldestAt).Seconds())
+			cp.MinAgeSeconds = int64(now.Sub(*cp.NewestAt).Seconds())
+		}
+		if cp.RatePerSecond > 0 {
+			cp.EstimatedSeconds = float64(cp.Count) / cp.RatePerSecond
+		}
+		plan.Categories = append(plan.Categories, cp)
+	}
+	return plan
+}
+
+// Approve 批准待审批类别按速率重放，返回本次开始重放的类别
+func (c *Coordinator) Approve(req ApproveRequest) ([]string, error) {
+	if !c.held {
+		return nil, ErrNotHeld
+	}
+	if req.RatePerSecond < 0 {
+		return nil, fmt.Errorf("重放速率不能为负数: %v", req.RatePerSecond)
+	}
+	c.mu.Lock()
+	names := req.Categories
+	if len(names) == 0 {
+		names = c.order
+	}
+	for _, name := range names {
+		if _, ok := c.categories[name]; !ok {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCategory, name)
+		}
+	}
+	now := c.opts.Now()
+	var started []*category
+	for _, name := range names {
+		cat := c.categories[name]
+		if cat.state != StatePendingApproval {
+			continue
+		}
+		cat.state = StateRunning
+		cat.rate = req.RatePerSecond
+		cat.approvedAt = &now
+		cat.approvedBy = req.ApprovedBy
+		started = append(started, cat)
+	}
+	c.mu.Unlock()
+
+	approved := make([]string, 0, len(started))
+	for _, cat := range started {
+		approved = append(approved, cat.name)
+		c.wg.Add(1)
+		go c.run(cat)
+	}
+	if len(approved) > 0 {
+		logger.WithFields(logrus.Fields{
+			"categories": approved,
+			"rate":       req.RatePerSecond,
+			"approvedBy": req.ApprovedBy,
+		}).Info("▶️ 积压重放已批准")
+	}
+	return approved, nil
+}
+
+// Pause 暂停重放中的类别
+func (c *Coordinator) Pause(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cat, ok := c.categories[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCategory, name)
+	}
+	switch cat.state {
+	case StatePaused:
+		return nil
+	case StateRunning:
+		cat.state = StatePaused
+		cat.resume = make(chan struct{})
+		return nil
+	}
+	return fmt.Errorf("%w: %s 当前为 %s", ErrInvalidState, name, cat.state)
+}
+
+// Resume 恢复已暂停的类别
+func (c *Coordinator) Resume(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cat, ok := c.categories[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCategory, name)
+	}
+	switch cat.state {
+	case StateRunning:
+		return nil
+	case StatePaused:
+		cat.state = StateRunning
+		close(cat.resume)
+		cat.resume = nil
+		return nil
+	}
+	return fmt.Errorf("%w: %s 当前为 %s", ErrInvalidState, name, cat.state)
+}
+
+func (c *Coordinator) run(cat *category) {
+	defer c.wg.Done()
+	total := len(cat.source.Items())
+	c.mu.Lock()
+	startedAt := c.opts.Now()
+	cat.progress = Progress{Total: total, StartedAt: &startedAt}
+	c.mu.Unlock()
+
+	err := cat.source.Run(&Control{coordinator: c, category: cat})
+
+	c.mu.Lock()
+	finishedAt := c.opts.Now()
+	cat.progress.FinishedAt = &finishedAt
+	if err != nil {
+		cat.progress.Error = err.Error()
+	}
+	// 被停止中断时保持原状态（下次启动时停机时长重新计算）
+	if c.ctx.Err() == nil {
+		cat.state = StateCompleted
+	}
+	progress := cat.progress
+	c.mu.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"category": cat.name,
+		"total":    progress.Total,
+		"replayed": progress.Replayed,
+		"skipped":  progress.Skipped,
+		"failed":   progress.Failed,
+		"error":    progress.Error,
+	}).Info("✅ 类别积压重放结束，恢复常规流程")
+}
+
+// rateLocked 类别生效的重放速率
+func (c *Coordinator) rateLocked(cat *category) float64 {
+	if cat.rate > 0 {
+		return cat.rate
+	}
+	return c.opts.RatePerSecond
+}
+
+// Control 重放执行中的节奏与进度控制（nil 时不限速、不记录，便于子系统复用同一重放路径）
+type Control struct {
+	coordinator *Coordinator
+	category    *category
+}
+
+// Wait 等待下一条的发送时机：暂停期间阻塞，按重放速率限速；协调器停止时返回false
+func (ctl *Control) Wait() bool {
+	if ctl == nil {
+		return true
+	}
+	c, cat := ctl.coordinator, ctl.category
+	for {
+		c.mu.Lock()
+		resume := cat.resume
+		rate := c.rateLocked(cat)
+		wait := cat.nextAt.Sub(c.opts.Now())
+		if resume == nil && (rate <= 0 || wait <= 0) {
+			if rate > 0 {
+				cat.nextAt = c.opts.Now().Add(time.Duration(float64(time.Second) / rate))
+			}
+			c.mu.Unlock()
+			return true
+		}
+		c.mu.Unlock()
+
+		if resume != nil {
+			select {
+			case <-resume:
+			case <-c.ctx.Done():
+				return false
+			}
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// Stopped 协调器是否已停止
+func (ctl *Control) Stopped() bool {
+	return ctl != nil && ctl.coordinator.ctx.Err() != nil
+}
+
+// Record 记录一条的重放结果
+func (ctl *Control) Record(outcome Outcome) {
+	if ctl == nil {
+		return
+	}
+	c, cat := ctl.coordinator, ctl.category
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch outcome {
+	case OutcomeReplayed:
+		cat.progress.Replayed++
+	case OutcomeSkipped:
+		cat.progress.Skipped++
+	default:
+		cat.progress.Failed++
+	}
+}
+
+// ===============================
+// 存活时间标记
+// ===============================
+
+type marker struct {
+	LastAliveAt time.Time `json:"lastAliveAt"`
+	Held        bool      `json:"held,omitempty"` // 仍有暂缓中的类别
+}
+
+func (c *Coordinator) mark() error {
+	data, err := json.Marshal(marker{LastAliveAt: c.opts.Now(), Held: c.stillHeld()})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.opts.StateFile), 0o755); err != nil {
+		return fmt.Errorf("创建存活时间标记目录失败: %w", err)
+	}
+	tmp := c.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("写入存活时间标记失败: %w", err)
+	}
+	return os.Rename(tmp, c.opts.StateFile)
+}
+
+// stillHeld 是否仍有未完成重放的暂缓类别
+func (c *Coordinator) stillHeld() bool {
+	if !c.held {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.categories) == 0 {
+		return true
+	}
+	for _, cat := range c.categories {
+		if cat.state != StateCompleted {
+			return true
+		}
+	}
+	return false
+}
+
+// readMarker 读取上次的存活时间标记，文件不存在时返回nil
+func readMarker(path string) (*marker, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取存活时间标记失败: %w", err)
+	}
+	var m marker
+	if err := json.Unmarshal(data, &m); err != nil || m.LastAliveAt.IsZero() {
+		// 标记损坏时按首次启动处理，不阻塞启动
+		logger.WithFields(logrus.Fields{"path": path}).Warn("存活时间标记无法解析，视为首次启动")
+		return nil, nil
+	}
+	return &m, nil
+}
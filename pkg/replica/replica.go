@@ -0,0 +1,318 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPublishInterval = 5 * time.Second
+	defaultRefreshInterval = 2 * time.Second
+	defaultMaxStaleness    = 30 * time.Second
+	defaultRedisKey        = "iot:replica:state"
+	defaultHistoryKey      = "iot:port_availability"
+	storeTimeout           = 3 * time.Second
+)
+
+var (
+	// ErrNoState 共享存储中没有任何主实例发布的快照
+	ErrNoState = errors.New("尚无主实例发布的状态快照")
+	// ErrNoHistory 未配置或尚无主实例持久化的端口状态历史
+	ErrNoHistory = errors.New("无可读取的端口状态历史（需主实例 portAvailability.store=redis）")
+)
+
+// ===============================
+// 主实例：发布快照
+// ===============================
+
+// Publisher 主实例定期发布状态快照
+type Publisher struct {
+	store      Store
+	source     Source
+	instanceID string
+	interval   time.Duration
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	now      func() time.Time
+}
+
+// NewPublisher 创建快照发布器
+func NewPublisher(store Store, source Source, instanceID string, interval time.Duration) *Publisher {
+	if interval <= 0 {
+		interval = defaultPublishInterval
+	}
+	return &Publisher{store: store, source: source, instanceID: instanceID, interval: interval, stopCh: make(chan struct{}), now: time.Now}
+}
+
+// Interval 发布间隔
+func (p *Publisher) Interval() time.Duration {
+	return p.interval
+}
+
+// Publish 采集并写入一次快照
+func (p *Publisher) Publish() error {
+	data, err := Encode(Capture(p.source, p.instanceID, p.now()))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	return p.store.Put(ctx, p.instanceID, data)
+}
+
+// Start 启动周期发布（随上下文取消或 Stop 停止）
+func (p *Publisher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			// Redis降级期间暂停发布（副本按快照时效标记stale），恢复后的下一周期继续
+			if !infraredis.Degraded() {
+				if err := p.Publish(); err != nil {
+					logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("发布只读副本状态快照失败")
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止发布并删除本实例快照：停机后本实例已无在线设备，副本不应继续展示
+func (p *Publisher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		_ = p.store.Remove(ctx, p.instanceID)
+	})
+}
+
+// ===============================
+// 副本：读取快照
+// ===============================
+
+// Options 副本读取配置
+type Options struct {
+	Store           Store
+	History         availability.Store // 主实例持久化的端口状态历史，nil时不提供历史查询
+	PublishInterval time.Duration      // 主实例发布间隔（用于计算时效上限）
+	RefreshInterval time.Duration      // 快照缓存时间
+	MaxStaleness    time.Duration      // 快照早于该时长时标记 stale
+	PrimaryURL      string             // 主实例API地址
+}
+
+// Reader 副本快照读取（带短时缓存，报表查询不逐次访问Redis）
+type Reader struct {
+	opts Options
+
+	mu        sync.Mutex
+	view      *View
+	history   *availability.Tracker
+	historyAt time.Time // 历史的持久化时间
+	loadedAt  time.Time // 历史的读取时间
+
+	now func() time.Time
+}
+
+// NewReader 创建副本快照读取
+func NewReader(opts Options) *Reader {
+	if opts.PublishInterval <= 0 {
+		opts.PublishInterval = defaultPublishInterval
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = defaultRefreshInterval
+	}
+	if opts.MaxStaleness <= 0 {
+		opts.MaxStaleness = defaultMaxStaleness
+	}
+	return &Reader{opts: opts, now: time.Now}
+}
+
+// PrimaryURL 主实例API地址
+func (r *Reader) PrimaryURL() string {
+	return r.opts.PrimaryURL
+}
+
+// StalenessBound 主实例正常发布时副本数据的最大滞后：发布间隔 + 副本缓存时间
+func (r *Reader) StalenessBound() time.Duration {
+	return r.opts.PublishInterval + r.opts.RefreshInterval
+}
+
+// IsStale 发布（持久化）时间早于允许的最大时长：主实例停止发布或Redis写入失败
+func (r *Reader) IsStale(stateAt, now time.Time) bool {
+	return now.Sub(stateAt) > r.opts.MaxStaleness
+}
+
+// View 当前副本视图：缓存未过期时直接返回，否则重新读取全部实例的快照；
+// 读取失败时沿用上一次视图（仍按其发布时间标注时效），从未读到时返回错误
+func (r *Reader) View() (*View, error) {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.view != nil && now.Sub(r.view.FetchedAt) < r.opts.RefreshInterval {
+		return r.view, nil
+	}
+	// Redis降级期间直接沿用上一次视图，不逐请求等待读取超时
+	if r.view != nil && infraredis.Degraded() {
+		return r.view, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	all, err := r.opts.Store.All(ctx)
+	if err != nil {
+		if r.view != nil {
+			logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("读取只读副本状态快照失败，沿用上次快照")
+			return r.view, nil
+		}
+		return nil, fmt.Errorf("读取状态快照失败: %w", err)
+	}
+	states := make([]State, 0, len(all))
+	for instanceID, data := range all {
+		state, err := Decode(data)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"instanceId": instanceID, "error": err.Error()}).Warn("跳过无法解析的状态快照")
+			continue
+		}
+		states = append(states, state)
+	}
+	if len(states) == 0 {
+		r.view = nil
+		return nil, ErrNoState
+	}
+	r.view = newView(states, now)
+	return r.view, nil
+}
+
+// History 主实例持久化的端口状态历史及其持久化时间（缓存规则同 View）
+func (r *Reader) History() (*availability.Tracker, time.Time, error) {
+	if r.opts.History == nil {
+		return nil, time.Time{}, ErrNoHistory
+	}
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.history != nil && now.Sub(r.loadedAt) < r.opts.RefreshInterval {
+		return r.history, r.historyAt, nil
+	}
+	snapshot, err := r.opts.History.Load()
+	if err != nil || snapshot == nil {
+		if r.history != nil {
+			return r.history, r.historyAt, nil
+		}
+		if err == nil {
+			err = ErrNoHistory
+		}
+		return nil, time.Time{}, err
+	}
+	tracker, err := availability.NewTracker(staticHistory{snapshot}, availability.Options{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	r.history, r.historyAt, r.loadedAt = tracker, snapshot.SavedAt, now
+	return tracker, snapshot.SavedAt, nil
+}
+
+// staticHistory 以已读取的历史快照构造只读跟踪器（副本从不回写主实例的历史）
+type staticHistory struct {
+	snapshot *availability.Snapshot
+}
+
+func (s staticHistory) Load() (*availability.Snapshot, error) { return s.snapshot, nil }
+
+func (s staticHistory) Save(availability.Snapshot) error { return nil }
+
+// ===============================
+// 全局实例
+// ===============================
+
+var (
+	globalPublisher *Publisher
+	globalReader    *Reader
+)
+
+// GetGlobalReader 获取全局副本读取（非只读副本模式时为nil）
+func GetGlobalReader() *Reader {
+	return globalReader
+}
+
+// SetGlobalReader 设置全局副本读取（非nil即进入只读副本模式）
+func SetGlobalReader(r *Reader) {
+	globalReader = r
+}
+
+// ReadOnly 是否以只读副本模式运行
+func ReadOnly() bool {
+	return globalReader != nil
+}
+
+// InitGlobal 按配置初始化（需在Redis初始化之后调用）：只读副本模式创建快照读取，Redis未连接时返回错误；
+// 主实例开启发布时启动周期发布，Redis未连接时返回错误（不影响主实例运行）
+func InitGlobal(ctx context.Context, source Source, readOnly bool) error {
+	cfg := config.GetConfig().Replica
+	key := cfg.RedisKey
+	if key == "" {
+		key = defaultRedisKey
+	}
+	publishInterval := time.Duration(cfg.PublishIntervalSeconds) * time.Second
+	client := infraredis.GetClient()
+
+	if readOnly {
+		if client == nil {
+			return fmt.Errorf("只读副本模式需要连接Redis读取主实例发布的状态快照")
+		}
+		opts := Options{
+			Store:           NewRedisStore(client, key),
+			PublishInterval: publishInterval,
+			RefreshInterval: time.Duration(cfg.RefreshIntervalSeconds) * time.Second,
+			MaxStaleness:    time.Duration(cfg.MaxStalenessSeconds) * time.Second,
+			PrimaryURL:      cfg.PrimaryURL,
+		}
+		if history := config.GetConfig().PortAvailability; history.Store == availability.StoreTypeRedis {
+			historyKey := history.RedisKey
+			if historyKey == "" {
+				historyKey = defaultHistoryKey
+			}
+			opts.History = availability.NewRedisStore(client, historyKey)
+		}
+		SetGlobalReader(NewReader(opts))
+		logger.WithFields(logrus.Fields{"key": key, "primary": cfg.PrimaryURL, "history": opts.History != nil}).Info("以只读副本模式运行，数据来自主实例发布的状态快照")
+		return nil
+	}
+
+	if !cfg.Publish {
+		return nil
+	}
+	if client == nil {
+		return fmt.Errorf("只读副本状态发布需要连接Redis")
+	}
+	instanceID := cluster.GetGlobalOwnership().Self().InstanceID
+	globalPublisher = NewPublisher(NewRedisStore(client, key), source, instanceID, publishInterval)
+	globalPublisher.Start(ctx)
+	logger.WithFields(logrus.Fields{"key": key, "instanceId": instanceID, "interval": globalPublisher.Interval().String()}).Info("只读副本状态快照发布已启动")
+	return nil
+}
+
+// StopGlobal 停止快照发布
+func StopGlobal() {
+	if globalPublisher != nil {
+		globalPublisher.Stop()
+	}
+}
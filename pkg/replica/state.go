@@ -0,0 +1,165 @@
+// Package replica 只读副本：主实例定期将设备状态快照（在线设备详情、端口状态、统计计数）写入共享存储，
+// 只读副本实例不接入设备、不下发命令，仅从快照应答报表类查询。主副两种模式共用本包的快照格式与编解码。
+package replica
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+)
+
+const (
+	// StateRecordType 状态快照的持久化记录类型
+	StateRecordType = "replica_state"
+	// DataSourceReplica 副本响应中的数据来源标识
+	DataSourceReplica = "replica"
+)
+
+func init() {
+	persistence.RegisterType(StateRecordType, 1)
+}
+
+// DeviceSnapshot 单台在线设备的快照
+type DeviceSnapshot struct {
+	DeviceID   string                     `json:"deviceId"`
+	StationID  string                     `json:"stationId,omitempty"`  // 供副本按站点过滤（详情经JSON往返后类型信息丢失）
+	DeviceType uint16                     `json:"deviceType,omitempty"` // 供副本按设备类型过滤
+	Detail     map[string]interface{}     `json:"detail"`
+	Ports      []gateway.DevicePortStatus `json:"ports"`
+}
+
+// State 一个主实例发布的状态快照
+type State struct {
+	InstanceID  string                 `json:"instanceId"`
+	PublishedAt time.Time              `json:"publishedAt"`
+	Devices     []DeviceSnapshot       `json:"devices"`
+	Stats       map[string]interface{} `json:"stats"`
+}
+
+// Source 快照数据来源（由设备网关实现）
+type Source interface {
+	GetAllOnlineDevices() []string
+	GetDeviceDetail(deviceID string) (map[string]interface{}, error)
+	GetDevicePortStatus(deviceID string) []gateway.DevicePortStatus
+	GetDeviceStatistics() map[string]interface{}
+}
+
+// Capture 读取主实例内存状态生成快照（按设备ID排序）
+func Capture(source Source, instanceID string, now time.Time) State {
+	online := source.GetAllOnlineDevices()
+	sort.Strings(online)
+	state := State{
+		InstanceID:  instanceID,
+		PublishedAt: now,
+		Devices:     make([]DeviceSnapshot, 0, len(online)),
+		Stats:       source.GetDeviceStatistics(),
+	}
+	for _, deviceID := range online {
+		detail, err := source.GetDeviceDetail(deviceID)
+		if err != nil {
+			continue // 采集期间断开
+		}
+		d := DeviceSnapshot{DeviceID: deviceID, Detail: detail, Ports: source.GetDevicePortStatus(deviceID)}
+		d.StationID, _ = detail["stationId"].(string)
+		d.DeviceType, _ = detail["deviceType"].(uint16)
+		state.Devices = append(state.Devices, d)
+	}
+	return state
+}
+
+// Encode 以持久化信封序列化快照
+func Encode(state State) ([]byte, error) {
+	return persistence.Encode(StateRecordType, state)
+}
+
+// Decode 解析快照（版本高于副本程序支持时按持久化策略返回错误，副本跳过该实例的快照）
+func Decode(data []byte) (State, error) {
+	var state State
+	_, err := persistence.Decode(StateRecordType, data, &state)
+	return state, err
+}
+
+// View 副本视图：合并各主实例最近发布的快照
+type View struct {
+	States    []State   // 按实例ID排序
+	StateAt   time.Time // 最旧一份快照的发布时间，整体时效以最旧者为准
+	FetchedAt time.Time // 副本读取快照的时间
+
+	devices map[string]*DeviceSnapshot
+	owners  map[string]string // 设备 → 发布其快照的主实例
+	ordered []DeviceSnapshot
+}
+
+// newView 合并快照：设备同时出现在多个实例（迁移中）时以较新的快照为准
+func newView(states []State, fetchedAt time.Time) *View {
+	sort.Slice(states, func(i, j int) bool { return states[i].InstanceID < states[j].InstanceID })
+	v := &View{States: states, FetchedAt: fetchedAt, devices: make(map[string]*DeviceSnapshot), owners: make(map[string]string)}
+	published := make(map[string]time.Time)
+	for i, s := range states {
+		if i == 0 || s.PublishedAt.Before(v.StateAt) {
+			v.StateAt = s.PublishedAt
+		}
+		for j := range s.Devices {
+			d := &states[i].Devices[j]
+			if at, ok := published[d.DeviceID]; ok && !s.PublishedAt.After(at) {
+				continue
+			}
+			v.devices[d.DeviceID] = d
+			v.owners[d.DeviceID] = s.InstanceID
+			published[d.DeviceID] = s.PublishedAt
+		}
+	}
+	v.ordered = make([]DeviceSnapshot, 0, len(v.devices))
+	for _, d := range v.devices {
+		v.ordered = append(v.ordered, *d)
+	}
+	sort.Slice(v.ordered, func(i, j int) bool { return v.ordered[i].DeviceID < v.ordered[j].DeviceID })
+	return v
+}
+
+// Device 查询设备快照（详情为副本共享数据，调用方修改前须复制）
+func (v *View) Device(deviceID string) (DeviceSnapshot, bool) {
+	d, ok := v.devices[deviceID]
+	if !ok {
+		return DeviceSnapshot{}, false
+	}
+	return *d, true
+}
+
+// Owner 发布设备快照的主实例ID
+func (v *View) Owner(deviceID string) string {
+	return v.owners[deviceID]
+}
+
+// Devices 全部在线设备快照（按设备ID排序）
+func (v *View) Devices() []DeviceSnapshot {
+	return v.ordered
+}
+
+// Stats 统计计数：单个主实例时原样返回其统计，多个主实例时按实例分列并汇总在线设备数
+func (v *View) Stats() map[string]interface{} {
+	stats := make(map[string]interface{})
+	if len(v.States) == 1 {
+		for k, val := range v.States[0].Stats {
+			stats[k] = val
+		}
+		return stats
+	}
+	instances := make(map[string]interface{}, len(v.States))
+	for _, s := range v.States {
+		instances[s.InstanceID] = s.Stats
+	}
+	stats["instances"] = instances
+	stats["onlineDeviceCount"] = len(v.ordered)
+	return stats
+}
+
+// Staleness 快照距读取时刻的时长
+func (v *View) Staleness(now time.Time) time.Duration {
+	if d := now.Sub(v.StateAt); d > 0 {
+		return d
+	}
+	return 0
+}
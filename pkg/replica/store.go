@@ -0,0 +1,90 @@
+package replica
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store 状态快照存储（主实例写、副本读；每个主实例一份快照）
+type Store interface {
+	// Put 写入（覆盖）实例的快照
+	Put(ctx context.Context, instanceID string, data []byte) error
+	// Remove 删除实例的快照（主实例正常停机时调用，其设备已全部离线）
+	Remove(ctx context.Context, instanceID string) error
+	// All 读取全部实例的快照
+	All(ctx context.Context) (map[string][]byte, error)
+}
+
+// RedisStore Redis快照存储（单个哈希键，字段为实例ID，值为信封格式的快照）
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore 创建Redis快照存储
+func NewRedisStore(client *redis.Client, key string) *RedisStore {
+	return &RedisStore{client: client, key: key}
+}
+
+// Put 写入实例快照
+func (s *RedisStore) Put(ctx context.Context, instanceID string, data []byte) error {
+	return s.client.HSet(ctx, s.key, instanceID, data).Err()
+}
+
+// Remove 删除实例快照
+func (s *RedisStore) Remove(ctx context.Context, instanceID string) error {
+	return s.client.HDel(ctx, s.key, instanceID).Err()
+}
+
+// All 读取全部实例快照
+func (s *RedisStore) All(ctx context.Context) (map[string][]byte, error) {
+	values, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string][]byte, len(values))
+	for instanceID, data := range values {
+		all[instanceID] = []byte(data)
+	}
+	return all, nil
+}
+
+// MemoryStore 进程内快照存储（测试中主实例与副本共享同一实例，模拟共用一个Redis）
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+// NewMemoryStore 创建进程内快照存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string][]byte)}
+}
+
+// Put 写入实例快照
+func (s *MemoryStore) Put(_ context.Context, instanceID string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[instanceID] = append([]byte(nil), data...)
+	return nil
+}
+
+// Remove 删除实例快照
+func (s *MemoryStore) Remove(_ context.Context, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, instanceID)
+	return nil
+}
+
+// All 读取全部实例快照
+func (s *MemoryStore) All(_ context.Context) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make(map[string][]byte, len(s.entries))
+	for instanceID, data := range s.entries {
+		all[instanceID] = data
+	}
+	return all, nil
+}
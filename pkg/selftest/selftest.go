@@ -0,0 +1,411 @@
+// Package selftest 协议编解码自检：启动时（及经运维接口按需）对标准帧做编码/解码往返、
+// 双算法校验和核对、充电控制报文黄金向量比对与字节流解码器回放，发现回归时阻止启动
+package selftest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// 触发方式
+const (
+	TriggerStartup = "startup"
+	TriggerManual  = "manual"
+)
+
+// 检查分组
+const (
+	GroupFrame         = "frame"          // 每个已注册命令的帧编码/解码往返
+	GroupChecksum      = "checksum"       // 协议算法与旧算法的校验和核对
+	GroupTyped         = "typed"          // 负载结构体编码/解码
+	GroupChargeControl = "charge_control" // 充电控制报文黄金向量
+	GroupStream        = "stream"         // ICCID/link/DNY 字节流解码
+)
+
+const (
+	selfTestPhysicalID = 0x04A228CD
+	selfTestMessageID  = 0x5A01
+	selfTestConnID     = ^uint64(0) // 解码器回放使用的保留连接ID，不与真实连接冲突
+	selfTestICCID      = "89860400000000001673"
+)
+
+// Check 单项检查结果
+type Check struct {
+	Group  string `json:"group"`
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report 一次自检的结果
+type Report struct {
+	Trigger    string    `json:"trigger"`
+	Version    string    `json:"version"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Total      int       `json:"total"`
+	Passed     int       `json:"passed"`
+	Failed     int       `json:"failed"`
+	OK         bool      `json:"ok"`
+	Checks     []Check   `json:"checks"`
+}
+
+// Failures 未通过的检查
+func (r *Report) Failures() []Check {
+	failures := make([]Check, 0, r.Failed)
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failures = append(failures, c)
+		}
+	}
+	return failures
+}
+
+// Summary 失败项的单行描述（用于启动失败的错误信息）
+func (r *Report) Summary() string {
+	parts := make([]string, 0, r.Failed)
+	for _, c := range r.Failures() {
+		parts = append(parts, fmt.Sprintf("%s/%s: %s", c.Group, c.Name, c.Error))
+	}
+	return fmt.Sprintf("协议自检 %d/%d 项通过; %s", r.Passed, r.Total, strings.Join(parts, "; "))
+}
+
+var (
+	lastMu     sync.RWMutex
+	lastReport *Report
+)
+
+// Run 执行全部自检并保存为最近一次结果
+func Run(trigger string) *Report {
+	report := &Report{Trigger: trigger, Version: gateway.GatewayVersion, StartedAt: time.Now(), Checks: []Check{}}
+	record := func(group, name string, err error) {
+		check := Check{Group: group, Name: name, Passed: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	typed := typedCases()
+	for _, entry := range dny_protocol.Commands() {
+		payload := []byte{0x01, entry.Code}
+		if tc, ok := typed[entry.Code]; ok {
+			payload = tc.payload
+		}
+		packet := protocol.BuildUnifiedDNYPacket(selfTestPhysicalID, selfTestMessageID, entry.Code, payload)
+		record(GroupFrame, entry.Hex, checkFrame(packet, entry.Code, payload))
+		record(GroupChecksum, entry.Hex, checkChecksums(packet))
+	}
+	for _, code := range sortedCodes(typed) {
+		tc := typed[code]
+		record(GroupTyped, tc.name, tc.check(tc.payload))
+	}
+	for _, vector := range chargeControlVectors {
+		record(GroupChargeControl, vector.name, vector.check())
+	}
+	record(GroupStream, "iccid_link_dny", checkStream())
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	report.Total = len(report.Checks)
+	for _, c := range report.Checks {
+		if c.Passed {
+			report.Passed++
+		}
+	}
+	report.Failed = report.Total - report.Passed
+	report.OK = report.Failed == 0
+
+	lastMu.Lock()
+	lastReport = report
+	lastMu.Unlock()
+	return report
+}
+
+// Last 最近一次自检结果（尚未执行时返回 false）
+func Last() (*Report, bool) {
+	lastMu.RLock()
+	defer lastMu.RUnlock()
+	return lastReport, lastReport != nil
+}
+
+// checkFrame 帧解析后物理ID、消息ID、命令与负载须与编码输入一致
+func checkFrame(packet []byte, cmd uint8, payload []byte) error {
+	if err := protocol.ValidateUnifiedDNYPacket(packet); err != nil {
+		return err
+	}
+	msg, err := protocol.ParseDNYProtocolData(packet)
+	if err != nil {
+		return err
+	}
+	switch {
+	case msg.MessageType != "standard":
+		return fmt.Errorf("消息类型 %s，应为 standard", msg.MessageType)
+	case msg.PhysicalId != selfTestPhysicalID:
+		return fmt.Errorf("物理ID 0x%08X，应为 0x%08X", msg.PhysicalId, selfTestPhysicalID)
+	case msg.MessageId != selfTestMessageID:
+		return fmt.Errorf("消息ID 0x%04X，应为 0x%04X", msg.MessageId, selfTestMessageID)
+	case msg.CommandId != uint32(cmd):
+		return fmt.Errorf("命令 0x%02X，应为 0x%02X", msg.CommandId, cmd)
+	case !bytes.Equal(msg.Data, payload):
+		return fmt.Errorf("负载 %X，应为 %X", msg.Data, payload)
+	}
+	return nil
+}
+
+// checkChecksums 协议算法（从包头累加）与旧算法（从物理ID累加）分别核对：
+// 构建的帧只匹配协议算法；改写为旧算法校验和的帧只匹配旧算法，且须被解析器拒绝
+func checkChecksums(packet []byte) error {
+	checksumStart := len(packet) - protocol.ChecksumLength
+	fromHeader := sum16(packet[:checksumStart])
+	fromContent := sum16(packet[protocol.PacketHeaderLength+protocol.DataLengthBytes : checksumStart])
+	if carried := binary.LittleEndian.Uint16(packet[checksumStart:]); carried != fromHeader {
+		return fmt.Errorf("帧校验和 0x%04X，协议算法应为 0x%04X", carried, fromHeader)
+	}
+	if calc, err := protocol.CalculatePacketChecksumInternal(packet[:checksumStart]); err != nil || calc != fromHeader {
+		return fmt.Errorf("CalculatePacketChecksumInternal=0x%04X(%v)，应为 0x%04X", calc, err, fromHeader)
+	}
+	if err := expectChecksums(packet, true, false); err != nil {
+		return err
+	}
+
+	legacy := append([]byte(nil), packet...)
+	binary.LittleEndian.PutUint16(legacy[checksumStart:], fromContent)
+	if err := expectChecksums(legacy, false, true); err != nil {
+		return fmt.Errorf("旧算法帧: %w", err)
+	}
+	if _, err := protocol.ParseDNYProtocolData(legacy); err == nil {
+		return fmt.Errorf("旧算法校验和的帧应被解析器拒绝")
+	}
+	return nil
+}
+
+func expectChecksums(packet []byte, fromHeader, fromContent bool) error {
+	want := map[string]bool{protocol.ChecksumAlgorithmFromHeader: fromHeader, protocol.ChecksumAlgorithmFromContent: fromContent}
+	checks := protocol.DiagnoseFrame(packet, "").Checksums
+	if len(checks) != len(want) {
+		return fmt.Errorf("帧诊断返回 %d 个校验和结果，应为 %d", len(checks), len(want))
+	}
+	for _, c := range checks {
+		if c.Valid != want[c.Algorithm] {
+			return fmt.Errorf("算法 %s 匹配=%v，应为 %v (计算 %s，帧中 %s)", c.Algorithm, c.Valid, want[c.Algorithm], c.Expected, c.Actual)
+		}
+	}
+	return nil
+}
+
+// checkStream 按真实接入顺序回放 ICCID、link 心跳与被拆成两次读取的 DNY 帧
+func checkStream() error {
+	decoder, ok := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	if !ok {
+		return fmt.Errorf("解码器类型错误")
+	}
+	defer decoder.ReleaseConnection(selfTestConnID)
+
+	frame := protocol.BuildUnifiedDNYPacket(selfTestPhysicalID, selfTestMessageID, constants.CmdDeviceLocate, []byte{0x0A})
+	steps := []struct {
+		name  string
+		input []byte
+		msgID uint32 // 0 表示应等待后续数据
+	}{
+		{"iccid", []byte(selfTestICCID), constants.MsgIDICCID},
+		{"link", []byte(protocol.HeaderLink), constants.MsgIDLinkHeartbeat},
+		{"dny_first_half", frame[:9], 0},
+		{"dny_second_half", frame[9:], uint32(constants.CmdDeviceLocate)},
+	}
+	for _, step := range steps {
+		msgID, msg := decoder.DecodeFrame(selfTestConnID, step.input)
+		if step.msgID == 0 {
+			if msg != nil {
+				return fmt.Errorf("%s: 半包不应产生消息 (msgID=0x%X)", step.name, msgID)
+			}
+			continue
+		}
+		if msg == nil || msgID != step.msgID {
+			return fmt.Errorf("%s: 路由ID 0x%X，应为 0x%X", step.name, msgID, step.msgID)
+		}
+		switch step.msgID {
+		case constants.MsgIDICCID:
+			if msg.ICCIDValue != selfTestICCID {
+				return fmt.Errorf("%s: ICCID %q，应为 %q", step.name, msg.ICCIDValue, selfTestICCID)
+			}
+		case uint32(constants.CmdDeviceLocate):
+			if msg.PhysicalId != selfTestPhysicalID || msg.MessageId != selfTestMessageID || !bytes.Equal(msg.Data, []byte{0x0A}) {
+				return fmt.Errorf("%s: 帧字段错误 物理ID=0x%08X 消息ID=0x%04X 负载=%X", step.name, msg.PhysicalId, msg.MessageId, msg.Data)
+			}
+		}
+	}
+	return nil
+}
+
+// chargeControlVector 充电控制报文黄金向量
+type chargeControlVector struct {
+	name          string
+	physicalID    uint32
+	messageID     uint16
+	rateMode      byte
+	balance       uint32
+	port          byte
+	command       byte
+	value         uint16
+	orderNo       string
+	maxDuration   uint16
+	maxPower      uint16
+	qrCodeLight   byte
+	expectedFrame string
+}
+
+var chargeControlVectors = []chargeControlVector{
+	{
+		// 协议文档示例：按时间充电60秒
+		name: "start_by_time", physicalID: 0x04A228CD, messageID: 0x0002, balance: 1010, port: 0, command: 0x01, value: 60,
+		orderNo:       "ORDER_2025061909",
+		expectedFrame: "444E592E00CD28A20402008200F203000000013C004F524445525F323032353036313930390000000000000000020000004908",
+	},
+	{
+		name: "stop", physicalID: 0x04B16730, messageID: 0x1673, rateMode: 0x01, port: 1, command: 0x00,
+		orderNo: "ORD1673STOP", maxDuration: 7200, maxPower: 3500, qrCodeLight: 1,
+		expectedFrame: "444E592E003067B1047316820100000000010000004F52443136373353544F500000000000201CAC0D01000000020000006607",
+	},
+}
+
+func (v chargeControlVector) check() error {
+	packet := dny_protocol.BuildChargeControlPacket(v.physicalID, v.messageID, v.rateMode, v.balance, v.port, v.command,
+		v.value, v.orderNo, v.maxDuration, v.maxPower, v.qrCodeLight)
+	if got := strings.ToUpper(hex.EncodeToString(packet)); got != v.expectedFrame {
+		return fmt.Errorf("报文 %s，应为 %s", got, v.expectedFrame)
+	}
+	return nil
+}
+
+// typedCase 负载结构体检查：payload 为标准负载（上行为设备实际上报格式，双向格式一致的由结构体编码生成）
+type typedCase struct {
+	name    string
+	payload []byte
+	check   func(payload []byte) error
+}
+
+// typedCases 有负载结构体的命令（按命令码索引）
+func typedCases() map[uint8]typedCase {
+	cases := map[uint8]typedCase{}
+	roundTrip := func(code uint8, name string, value, decoded binaryCodec, normalize func(binaryCodec)) {
+		payload, err := value.MarshalBinary()
+		cases[code] = typedCase{name: name, payload: payload, check: func(payload []byte) error {
+			if err != nil {
+				return fmt.Errorf("编码失败: %w", err)
+			}
+			if err := decoded.UnmarshalBinary(payload); err != nil {
+				return fmt.Errorf("解码失败: %w", err)
+			}
+			if normalize != nil {
+				normalize(decoded)
+			}
+			if !reflect.DeepEqual(value, decoded) {
+				return fmt.Errorf("往返不一致: 编码 %+v，解码 %+v", value, decoded)
+			}
+			return nil
+		}}
+	}
+	decodeOnly := func(code uint8, name string, payload []byte, decoded binaryCodec, verify func() error) {
+		cases[code] = typedCase{name: name, payload: payload, check: func(payload []byte) error {
+			if err := decoded.UnmarshalBinary(payload); err != nil {
+				return fmt.Errorf("解码失败: %w", err)
+			}
+			return verify()
+		}}
+	}
+
+	roundTrip(constants.CmdHeartbeat, "link_heartbeat", &dny_protocol.LinkHeartbeatData{}, &dny_protocol.LinkHeartbeatData{},
+		func(v binaryCodec) { v.(*dny_protocol.LinkHeartbeatData).Timestamp = time.Time{} })
+	roundTrip(constants.CmdPowerHeartbeat, "power_heartbeat",
+		&dny_protocol.PowerHeartbeatData{GunNumber: 1, Voltage: 220, Current: 455, Power: 1000, ElectricEnergy: 1250, Temperature: 365, Status: 1},
+		&dny_protocol.PowerHeartbeatData{}, func(v binaryCodec) { v.(*dny_protocol.PowerHeartbeatData).Timestamp = time.Time{} })
+	roundTrip(constants.CmdMainHeartbeat, "main_heartbeat",
+		&dny_protocol.MainHeartbeatData{DeviceStatus: 1, GunCount: 2, GunStatuses: []uint8{0, 1}, Temperature: -55, SignalStrength: 24},
+		&dny_protocol.MainHeartbeatData{}, func(v binaryCodec) { v.(*dny_protocol.MainHeartbeatData).Timestamp = time.Time{} })
+	roundTrip(constants.CmdDeviceHeart, "device_heartbeat",
+		&dny_protocol.DeviceHeartbeatData{Voltage: 22000, PortCount: 2, PortStatuses: []uint8{0, 1}, SignalStrength: 20, Temperature: 65},
+		&dny_protocol.DeviceHeartbeatData{}, func(v binaryCodec) { v.(*dny_protocol.DeviceHeartbeatData).Timestamp = time.Time{} })
+	roundTrip(constants.CmdChargeControl, "charge_control",
+		&dny_protocol.ChargeControlData{Command: 1, GunNumber: 1, CardNumber: "12345678", OrderID: "ORD1673A", MaxPower: 2000, MaxEnergy: 1000, MaxTime: 3600},
+		&dny_protocol.ChargeControlData{}, nil)
+	roundTrip(constants.CmdParamSetting, "param_setting",
+		&dny_protocol.ParameterSettingData{ParameterType: 1, ParameterID: 0x0102, Value: []byte{0x3C, 0x00}},
+		&dny_protocol.ParameterSettingData{}, nil)
+	roundTrip(constants.CmdParamSetting2, "param_setting2",
+		&dny_protocol.ParameterSettingData{ParameterType: 2, ParameterID: 0x0201, Value: []byte{0xE8, 0x03}},
+		&dny_protocol.ParameterSettingData{}, nil)
+
+	// 设备注册：固件版本231、2个端口、虚拟ID 0、单机、工作模式0、电源板版本1
+	register := &dny_protocol.DeviceRegisterData{}
+	decodeOnly(constants.CmdDeviceRegister, "device_register", []byte{0xE7, 0x00, 0x02, 0x00, 0x04, 0x00, 0x01, 0x00}, register, func() error {
+		if version := string(bytes.TrimRight(register.DeviceVersion[:], "\x00")); version != "V2.31" || register.DeviceType != 0x04 {
+			return fmt.Errorf("解码结果错误: 版本=%s 类型=%d", version, register.DeviceType)
+		}
+		return nil
+	})
+
+	// 刷卡：卡号0x12345678、IC卡、端口0、余额0、时间戳、无卡号2
+	swipe := &dny_protocol.SwipeCardRequestData{}
+	swipeAt := uint32(1760486400)
+	swipePayload := []byte{0x78, 0x56, 0x34, 0x12, 0x02, 0x00, 0x00, 0x00}
+	swipePayload = binary.LittleEndian.AppendUint32(swipePayload, swipeAt)
+	swipePayload = append(swipePayload, 0x00)
+	decodeOnly(constants.CmdSwipeCard, "swipe_card", swipePayload, swipe, func() error {
+		if swipe.CardNumber != utils.FormatCardNumber(0x12345678) || swipe.CardType != 0x02 || swipe.GunNumber != 0 || swipe.SwipeTime.Unix() != int64(swipeAt) {
+			return fmt.Errorf("解码结果错误: %+v", swipe)
+		}
+		return nil
+	})
+
+	// 结算：充电3600秒、最大功率1000W、耗电量125、端口1、在线启动、卡号、服务器控制停止、订单号、第二最大功率、时间戳、占位时长
+	settlement := &dny_protocol.SettlementData{}
+	settledAt := uint32(1760490000)
+	settlementPayload := []byte{0x10, 0x0E, 0xE8, 0x03, 0x7D, 0x00, 0x01, 0x00, 0x78, 0x56, 0x34, 0x12, dny_protocol.StopReasonServerStop}
+	settlementPayload = append(settlementPayload, []byte("ORD1673SETTLE000")...)
+	settlementPayload = append(settlementPayload, 0xE8, 0x03)
+	settlementPayload = binary.LittleEndian.AppendUint32(settlementPayload, settledAt)
+	settlementPayload = append(settlementPayload, 0x00, 0x00)
+	decodeOnly(constants.CmdSettlement, "settlement", settlementPayload, settlement, func() error {
+		if settlement.OrderID != "ORD1673SETTLE000" || settlement.ElectricEnergy != 125 || settlement.GunNumber != 1 ||
+			settlement.StopReason != dny_protocol.StopReasonServerStop || settlement.EndTime.Unix() != int64(settledAt) {
+			return fmt.Errorf("解码结果错误: %+v", settlement)
+		}
+		return nil
+	})
+	return cases
+}
+
+type binaryCodec interface {
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary([]byte) error
+}
+
+func sortedCodes(cases map[uint8]typedCase) []uint8 {
+	codes := make([]uint8, 0, len(cases))
+	for code := range cases {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func sum16(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	return sum
+}
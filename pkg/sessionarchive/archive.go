@@ -0,0 +1,585 @@
+// Package sessionarchive 连接会话归档：已关闭的连接会话（来源地址、ICCID、设备、起止时间、收发字节数、断开原因）
+// 按天写入只追加的 JSON Lines 文件，按保留天数与总大小上限自动清理，供安全取证按IP/ICCID/设备与时间范围查询
+package sessionarchive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/sirupsen/logrus"
+)
+
+// 默认参数
+const (
+	defaultDir           = "./data/session_archive"
+	defaultRetentionDays = 90
+	defaultMaxTotalMB    = 1024
+	defaultQueueSize     = 4096
+	defaultPageLimit     = 100
+	purgeInterval        = time.Hour
+	batchSize            = 256
+	filePrefix           = "sessions-"
+	fileSuffix           = ".jsonl"
+	dayLayout            = "2006-01-02"
+)
+
+// Record 已关闭的连接会话（写入后不可修改）
+type Record struct {
+	ConnID          uint64    `json:"connId"`
+	RemoteAddr      string    `json:"remoteAddr"`
+	RemoteIP        string    `json:"remoteIp"`
+	ICCID           string    `json:"iccid,omitempty"`
+	DeviceIDs       []string  `json:"deviceIds,omitempty"`
+	ConnectedAt     time.Time `json:"connectedAt"`
+	DisconnectedAt  time.Time `json:"disconnectedAt"`
+	DurationSeconds int64     `json:"durationSeconds"`
+	BytesIn         int64     `json:"bytesIn"`
+	BytesOut        int64     `json:"bytesOut"`
+	Reason          string    `json:"reason"`
+}
+
+// FromClosedSession 由连接清理时的会话摘要生成归档记录
+func FromClosedSession(s core.ClosedSession) Record {
+	ip := s.RemoteAddr
+	if host, _, err := net.SplitHostPort(s.RemoteAddr); err == nil {
+		ip = host
+	}
+	return Record{
+		ConnID:          s.ConnID,
+		RemoteAddr:      s.RemoteAddr,
+		RemoteIP:        ip,
+		ICCID:           s.ICCID,
+		DeviceIDs:       s.DeviceIDs,
+		ConnectedAt:     s.ConnectedAt,
+		DisconnectedAt:  s.DisconnectedAt,
+		DurationSeconds: int64(s.DisconnectedAt.Sub(s.ConnectedAt) / time.Second),
+		BytesIn:         s.BytesIn,
+		BytesOut:        s.BytesOut,
+		Reason:          s.Reason,
+	}
+}
+
+// Query 查询条件（空值表示不限）；时间范围按会话与 [From, To] 有交集匹配
+type Query struct {
+	IP       string
+	ICCID    string
+	DeviceID string
+	From     time.Time
+	To       time.Time
+	Offset   int
+	Limit    int // 0 表示不分页
+}
+
+func (q Query) match(rec *Record) bool {
+	if q.IP != "" && rec.RemoteIP != q.IP {
+		return false
+	}
+	if q.ICCID != "" && rec.ICCID != q.ICCID {
+		return false
+	}
+	if !q.From.IsZero() && rec.DisconnectedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && rec.ConnectedAt.After(q.To) {
+		return false
+	}
+	if q.DeviceID != "" {
+		for _, id := range rec.DeviceIDs {
+			if strings.EqualFold(id, q.DeviceID) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// prefilter 解码前按原始行粗筛，大量归档时避免逐条反序列化
+func (q Query) prefilter(line []byte) bool {
+	if q.IP != "" && !bytes.Contains(line, []byte(q.IP)) {
+		return false
+	}
+	if q.ICCID != "" && !bytes.Contains(line, []byte(q.ICCID)) {
+		return false
+	}
+	if q.DeviceID != "" && !bytes.Contains(bytes.ToUpper(line), []byte(strings.ToUpper(q.DeviceID))) {
+		return false
+	}
+	return true
+}
+
+// Page 分页查询结果（按断开时间倒序）
+type Page struct {
+	Records []Record `json:"records"`
+	Total   int      `json:"total"`
+	Offset  int      `json:"offset"`
+	Limit   int      `json:"limit"`
+}
+
+// Options 归档参数
+type Options struct {
+	Dir           string
+	RetentionDays int   // 保留天数
+	MaxTotalBytes int64 // 归档文件总大小上限，超过时删除最早的日文件
+	QueueSize     int   // 待写入队列长度，满时丢弃（不阻塞连接清理）
+}
+
+// Stats 归档统计
+type Stats struct {
+	Dir           string `json:"dir"`
+	RetentionDays int    `json:"retentionDays"`
+	MaxTotalBytes int64  `json:"maxTotalBytes"`
+	Files         int    `json:"files"`
+	TotalBytes    int64  `json:"totalBytes"`
+	Archived      int64  `json:"archived"`
+	Dropped       int64  `json:"dropped"` // 队列满丢弃的会话数
+	Purged        int64  `json:"purged"`  // 已清理的日文件数
+	Pending       int    `json:"pending"`
+	LastError     string `json:"lastError,omitempty"`
+}
+
+// Archive 会话归档：Submit 只入队，后台协程批量追加写入当天文件；过往日文件只读，仅按保留策略整体删除
+type Archive struct {
+	opts Options
+	now  func() time.Time
+
+	queue   chan Record
+	flushCh chan chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	started atomic.Bool
+
+	archived, dropped, purged atomic.Int64
+	lastErr                   atomic.Value // string
+
+	mu      sync.Mutex // 保护文件写入与清理
+	current string     // 正在追加的日文件
+}
+
+// New 创建归档（未设置的参数取默认值）
+func New(opts Options) (*Archive, error) {
+	if opts.Dir == "" {
+		opts.Dir = defaultDir
+	}
+	if opts.RetentionDays <= 0 {
+		opts.RetentionDays = defaultRetentionDays
+	}
+	if opts.MaxTotalBytes <= 0 {
+		opts.MaxTotalBytes = defaultMaxTotalMB << 20
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建会话归档目录失败: %w", err)
+	}
+	return &Archive{
+		opts:    opts,
+		now:     time.Now,
+		queue:   make(chan Record, opts.QueueSize),
+		flushCh: make(chan chan struct{}),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}, nil
+}
+
+// SetNowFunc 替换时间源（测试使用）
+func (a *Archive) SetNowFunc(now func() time.Time) {
+	a.now = now
+}
+
+// Submit 提交已关闭的会话（非阻塞，队列满时丢弃并计数）
+func (a *Archive) Submit(rec Record) {
+	select {
+	case a.queue <- rec:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Start 启动后台写入与定时清理（启动时先清理一次过期文件）
+func (a *Archive) Start(ctx context.Context) {
+	if !a.started.CompareAndSwap(false, true) {
+		return
+	}
+	a.Purge()
+	go a.run(ctx)
+}
+
+// Stop 写完队列后停止
+func (a *Archive) Stop() {
+	if !a.started.Load() {
+		return
+	}
+	select {
+	case <-a.stopCh:
+	default:
+		close(a.stopCh)
+	}
+	<-a.doneCh
+}
+
+// Flush 等待已提交的会话全部写入（未启动时直接写入）
+func (a *Archive) Flush() {
+	if !a.started.Load() {
+		a.drain()
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case a.flushCh <- done:
+		<-done
+	case <-a.doneCh:
+	}
+}
+
+func (a *Archive) run(ctx context.Context) {
+	defer close(a.doneCh)
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case rec := <-a.queue:
+			batch := append(make([]Record, 0, batchSize), rec)
+			for drained := false; !drained && len(batch) < batchSize; {
+				select {
+				case more := <-a.queue:
+					batch = append(batch, more)
+				default:
+					drained = true
+				}
+			}
+			a.write(batch)
+		case done := <-a.flushCh:
+			a.drain()
+			close(done)
+		case <-ticker.C:
+			a.Purge()
+		case <-ctx.Done():
+			a.drain()
+			return
+		case <-a.stopCh:
+			a.drain()
+			return
+		}
+	}
+}
+
+// drain 写入队列中的全部会话
+func (a *Archive) drain() {
+	batch := make([]Record, 0, batchSize)
+	for {
+		select {
+		case rec := <-a.queue:
+			batch = append(batch, rec)
+			if len(batch) == batchSize {
+				a.write(batch)
+				batch = batch[:0]
+			}
+		default:
+			a.write(batch)
+			return
+		}
+	}
+}
+
+// write 追加写入当天文件；日期切换时将前一天的文件置为只读
+func (a *Archive) write(batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	for i := range batch {
+		data, err := json.Marshal(&batch[i])
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	path := a.filePath(a.now())
+	if a.current != "" && a.current != path {
+		_ = os.Chmod(a.current, 0o444)
+	}
+	a.current = path
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err == nil {
+		_, err = f.Write(buf.Bytes())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		a.lastErr.Store(err.Error())
+		logger.WithFields(logrus.Fields{"sessions": len(batch), "error": err.Error()}).Warn("会话归档写入失败")
+		return
+	}
+	a.archived.Add(int64(len(batch)))
+	if a.totalBytesLocked() > a.opts.MaxTotalBytes {
+		a.purgeLocked(a.now())
+	}
+}
+
+func (a *Archive) filePath(t time.Time) string {
+	return filepath.Join(a.opts.Dir, filePrefix+t.Format(dayLayout)+fileSuffix)
+}
+
+// archiveFile 日文件
+type archiveFile struct {
+	path string
+	day  time.Time
+	size int64
+}
+
+// filesLocked 归档日文件（按日期先后）
+func (a *Archive) filesLocked() []archiveFile {
+	entries, err := os.ReadDir(a.opts.Dir)
+	if err != nil {
+		return nil
+	}
+	var files []archiveFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		day, err := time.ParseInLocation(dayLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, archiveFile{path: filepath.Join(a.opts.Dir, name), day: day, size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].day.Before(files[j].day) })
+	return files
+}
+
+func (a *Archive) totalBytesLocked() int64 {
+	var total int64
+	for _, f := range a.filesLocked() {
+		total += f.size
+	}
+	return total
+}
+
+// Purge 删除超过保留天数的日文件；总大小仍超过上限时从最早的日文件开始删除（当天文件保留）
+func (a *Archive) Purge() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.purgeLocked(a.now())
+}
+
+func (a *Archive) purgeLocked(now time.Time) {
+	today := a.filePath(now)
+	y, m, d := now.Date()
+	cutoff := time.Date(y, m, d, 0, 0, 0, 0, time.Local).AddDate(0, 0, -a.opts.RetentionDays)
+	files := a.filesLocked()
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for _, f := range files {
+		expired := f.day.Before(cutoff)
+		oversize := total > a.opts.MaxTotalBytes && f.path != today
+		if !expired && !oversize {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			a.lastErr.Store(err.Error())
+			continue
+		}
+		total -= f.size
+		a.purged.Add(1)
+		logger.WithFields(logrus.Fields{"file": filepath.Base(f.path), "expired": expired}).Info("已清理会话归档文件")
+	}
+	// 过往日文件只读，记录写入后不可修改
+	for _, f := range a.filesLocked() {
+		if f.path != today && f.path != a.current {
+			_ = os.Chmod(f.path, 0o444)
+		}
+	}
+}
+
+// Search 按条件查询（按断开时间倒序）；只读取断开日期不早于 From 的日文件
+func (a *Archive) Search(q Query) (Page, error) {
+	a.mu.Lock()
+	files := a.filesLocked()
+	a.mu.Unlock()
+
+	var fromDay time.Time
+	if !q.From.IsZero() {
+		y, m, d := q.From.In(time.Local).Date()
+		fromDay = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	}
+	var matched []Record
+	for i := len(files) - 1; i >= 0; i-- {
+		if !fromDay.IsZero() && files[i].day.Before(fromDay) {
+			break
+		}
+		recs, err := scanFile(files[i].path, q)
+		if err != nil {
+			return Page{}, err
+		}
+		matched = append(matched, recs...)
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].DisconnectedAt.After(matched[j].DisconnectedAt) })
+
+	page := Page{Total: len(matched), Offset: q.Offset, Limit: q.Limit}
+	if q.Offset > len(matched) {
+		q.Offset = len(matched)
+	}
+	matched = matched[q.Offset:]
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	page.Records = append(make([]Record, 0, len(matched)), matched...)
+	return page, nil
+}
+
+func scanFile(path string, q Query) ([]Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取会话归档失败: %w", err)
+	}
+	defer f.Close()
+	var out []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !q.prefilter(line) {
+			continue
+		}
+		var rec Record
+		if json.Unmarshal(line, &rec) != nil || !q.match(&rec) {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, scanner.Err()
+}
+
+// Stats 统计信息
+func (a *Archive) Stats() Stats {
+	a.mu.Lock()
+	files := a.filesLocked()
+	a.mu.Unlock()
+	stats := Stats{
+		Dir:           a.opts.Dir,
+		RetentionDays: a.opts.RetentionDays,
+		MaxTotalBytes: a.opts.MaxTotalBytes,
+		Files:         len(files),
+		Archived:      a.archived.Load(),
+		Dropped:       a.dropped.Load(),
+		Purged:        a.purged.Load(),
+		Pending:       len(a.queue),
+	}
+	for _, f := range files {
+		stats.TotalBytes += f.size
+	}
+	if err, ok := a.lastErr.Load().(string); ok {
+		stats.LastError = err
+	}
+	return stats
+}
+
+// WriteCSV 导出CSV（设备ID以分号分隔）
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	header := []string{"connId", "remoteAddr", "remoteIp", "iccid", "deviceIds", "connectedAt", "disconnectedAt",
+		"durationSeconds", "bytesIn", "bytesOut", "reason"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		row := []string{
+			strconv.FormatUint(rec.ConnID, 10),
+			rec.RemoteAddr,
+			rec.RemoteIP,
+			rec.ICCID,
+			strings.Join(rec.DeviceIDs, ";"),
+			rec.ConnectedAt.Format(time.RFC3339),
+			rec.DisconnectedAt.Format(time.RFC3339),
+			strconv.FormatInt(rec.DurationSeconds, 10),
+			strconv.FormatInt(rec.BytesIn, 10),
+			strconv.FormatInt(rec.BytesOut, 10),
+			rec.Reason,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalArchive atomic.Pointer[Archive]
+
+// GetGlobalArchive 获取全局会话归档（未启用时为nil）
+func GetGlobalArchive() *Archive {
+	return globalArchive.Load()
+}
+
+// SetGlobalArchive 替换全局会话归档（传nil关闭归档）
+func SetGlobalArchive(a *Archive) {
+	globalArchive.Store(a)
+}
+
+// InitGlobalArchive 按配置创建全局会话归档并启动后台写入
+func InitGlobalArchive(ctx context.Context) error {
+	cfg := config.GetConfig().SessionArchive
+	if !cfg.Enabled {
+		SetGlobalArchive(nil)
+		return nil
+	}
+	a, err := New(Options{
+		Dir:           cfg.Dir,
+		RetentionDays: cfg.RetentionDays,
+		MaxTotalBytes: int64(cfg.MaxTotalMB) << 20,
+		QueueSize:     cfg.QueueSize,
+	})
+	if err != nil {
+		SetGlobalArchive(nil)
+		return err
+	}
+	a.Start(ctx)
+	SetGlobalArchive(a)
+	return nil
+}
+
+// StopGlobalArchive 写完队列后停止全局会话归档
+func StopGlobalArchive() {
+	if a := globalArchive.Load(); a != nil {
+		a.Stop()
+	}
+}
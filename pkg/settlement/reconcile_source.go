@@ -0,0 +1,60 @@
+package settlement
+
+import (
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/sirupsen/logrus"
+)
+
+// reconcileSource 以结算日志存储作为对账的结算来源
+type reconcileSource struct {
+	store *Store
+}
+
+// ReconcileSource 将存储适配为对账结算来源：同一订单号存在多条记录时以首条为准（与台账一致）
+func ReconcileSource(store *Store) reconcile.SettlementSource {
+	return &reconcileSource{store: store}
+}
+
+func (s *reconcileSource) Settlement(orderNo string) (reconcile.SettlementRecord, bool) {
+	records, err := s.store.Lookup(orderNo)
+	if err != nil {
+		return reconcile.SettlementRecord{}, false
+	}
+	return toReconcileRecord(records[0]), true
+}
+
+func (s *reconcileSource) SettlementsReceivedBetween(from, to time.Time) []reconcile.SettlementRecord {
+	records, _, err := s.store.Scan(Query{From: from, To: to})
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err.Error()}).Warn("扫描结算日志存储失败，对账仅使用台账")
+	}
+	list := make([]reconcile.SettlementRecord, 0, len(records))
+	seen := make(map[string]bool, len(records))
+	for _, rec := range records {
+		if seen[rec.OrderNo] {
+			continue
+		}
+		seen[rec.OrderNo] = true
+		list = append(list, toReconcileRecord(rec))
+	}
+	return list
+}
+
+func toReconcileRecord(rec Record) reconcile.SettlementRecord {
+	return reconcile.SettlementRecord{
+		OrderNo:    rec.OrderNo,
+		DeviceID:   rec.DeviceID,
+		Port:       rec.Port,
+		EnergyWh:   rec.EnergyWh,
+		ChargeFee:  rec.ChargeFee,
+		ServiceFee: rec.ServiceFee,
+		TotalFee:   rec.TotalFee,
+		StartTime:  rec.StartTime,
+		EndTime:    rec.EndTime,
+		StopReason: rec.StopReason,
+		ReceivedAt: rec.ReceivedAt,
+	}
+}
@@ -0,0 +1,55 @@
+package settlement
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// RejectMetricsCollectorName /metrics 中结算载荷拒绝计数的采集器名称
+const RejectMetricsCollectorName = "settlement_rejects"
+
+// 结算载荷拒绝原因
+const (
+	RejectTooShort = "too_short" // 载荷长度不足
+	RejectOrderNo  = "order_no"  // 订单编号含非ASCII可见字符
+	RejectOther    = "other"     // 其他解析错误
+)
+
+var (
+	rejectsMu sync.Mutex
+	rejects   = make(map[string]int64)
+)
+
+// RecordRejected 记一次被拒绝的结算载荷（与存储是否启用无关）
+func RecordRejected(reason string) {
+	rejectsMu.Lock()
+	rejects[reason]++
+	rejectsMu.Unlock()
+}
+
+// RejectedCounts 各原因的拒绝计数
+func RejectedCounts() map[string]int64 {
+	rejectsMu.Lock()
+	defer rejectsMu.Unlock()
+	counts := make(map[string]int64, len(rejects))
+	for reason, n := range rejects {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// WriteRejectsPrometheus 以Prometheus文本格式输出结算载荷拒绝计数
+func WriteRejectsPrometheus(w io.Writer) {
+	counts := RejectedCounts()
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(w, "# HELP iot_settlement_rejected_total Settlement (0x03) payloads rejected as malformed per reason.\n# TYPE iot_settlement_rejected_total counter\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "iot_settlement_rejected_total{reason=%q} %d\n", reason, counts[reason])
+	}
+}
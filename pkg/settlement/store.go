@@ -0,0 +1,767 @@
+// Package settlement 结算日志存储
+//
+// 每条解码后的结算(0x03)连同原始帧追加写入本地段文件，fsync（按批合并，等待时长有上限）完成后才发送协议应答。
+// 记录格式为 长度(4字节) + CRC32(4字节) + JSON；启动时逐段扫描重建内存索引（按订单号、按设备+自然日），
+// 崩溃留下的半条记录按长度与CRC识别并截断到最后一条完整记录。段按大小轮转，超过保留天数的段整段删除。
+// 同一订单号且载荷相同的结算（设备重发）在写入时去重；订单号相同但载荷不同的结算全部保留。
+package settlement
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/sirupsen/logrus"
+)
+
+// DateLayout 索引自然日格式（本地时区）
+const DateLayout = "2006-01-02"
+
+// RecordType 结算记录的持久化类型（每条记录一个信封，段文件只追加，旧版本记录在读取时迁移，不回写）
+const (
+	RecordType    = "settlement_record"
+	recordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(RecordType, recordVersion)
+}
+
+const (
+	defaultDir             = "./data/settlements"
+	defaultSegmentMaxBytes = 16 << 20
+	defaultRetentionDays   = 400
+	defaultSyncMaxLatency  = 5 * time.Millisecond
+	defaultSyncMaxBatch    = 64
+	compactInterval        = time.Hour
+	headerSize             = 8
+	maxRecordBytes         = 1 << 20
+	segmentPrefix          = "settlements-"
+	segmentSuffix          = ".seg"
+)
+
+var (
+	// ErrStoreClosed 存储已关闭
+	ErrStoreClosed = errors.New("结算存储已关闭")
+	// ErrNotFound 订单号没有结算记录
+	ErrNotFound = errors.New("结算记录不存在")
+)
+
+// Record 结算记录：解码字段 + 原始载荷与帧
+type Record struct {
+	Seq        uint64    `json:"seq"`
+	OrderNo    string    `json:"order_no"`
+	DeviceID   string    `json:"device_id"`
+	Port       int       `json:"port"` // 结算帧中的端口号
+	CardNumber string    `json:"card_number,omitempty"`
+	EnergyWh   uint32    `json:"energy_wh"`
+	ChargeFee  uint32    `json:"charge_fee"`  // 分
+	ServiceFee uint32    `json:"service_fee"` // 分
+	TotalFee   uint32    `json:"total_fee"`   // 分
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	StopReason uint8     `json:"stop_reason"`
+	MessageID  uint16    `json:"message_id"`
+	Payload    []byte    `json:"payload"`             // 结算帧数据域
+	RawFrame   []byte    `json:"raw_frame,omitempty"` // 完整原始帧
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Query 区间扫描条件
+type Query struct {
+	DeviceID string    // 为空时扫描全部设备
+	From     time.Time // 接收时间下界（含），零值不限
+	To       time.Time // 接收时间上界（不含），零值不限
+	AfterSeq uint64    // 翻页游标：只返回序号大于该值的记录
+	Limit    int       // 最多返回条数，<=0 不限
+}
+
+// Stats 存储统计
+type Stats struct {
+	Enabled       bool   `json:"enabled"`
+	Dir           string `json:"dir"`
+	Segments      int    `json:"segments"`
+	TotalBytes    int64  `json:"total_bytes"`
+	Records       int    `json:"records"`
+	Orders        int    `json:"orders"`
+	Appended      int64  `json:"appended"`
+	Duplicates    int64  `json:"duplicates"` // 写入时去重的设备重发
+	Syncs         int64  `json:"syncs"`      // fsync 次数（按批合并）
+	Truncated     int64  `json:"truncated"`  // 启动时截断的损坏尾部字节数
+	SyncError     string `json:"sync_error,omitempty"`
+	LastSeq       uint64 `json:"last_seq"`
+	RetentionDays int    `json:"retention_days"`
+}
+
+// location 记录在段文件中的位置与索引字段
+type location struct {
+	seq        uint64
+	segment    *segment
+	offset     int64
+	length     int
+	orderNo    string
+	deviceID   string
+	receivedAt time.Time
+	digest     [sha256.Size]byte
+}
+
+// segment 段文件
+type segment struct {
+	id        int
+	path      string
+	size      int64
+	lastWrite time.Time
+}
+
+// AppendHandler 新结算fsync完成后的回调（设备重发的重复结算不回调）
+type AppendHandler func(rec Record)
+
+// Store 结算日志存储
+type Store struct {
+	mutex          sync.Mutex
+	dir            string
+	segmentMax     int64
+	retention      time.Duration
+	retentionDays  int
+	syncMaxLatency time.Duration
+	syncMaxBatch   int
+
+	segments    []*segment // 按编号升序，最后一个为当前写入段
+	active      *os.File
+	retired     []*os.File // 已轮转、待最后一次fsync后关闭
+	entries     []*location
+	byOrder     map[string][]*location
+	byDeviceDay map[string][]*location // key: deviceID|日期
+	totalBytes  int64
+	nextSeq     uint64
+	syncedSeq   uint64
+	syncErr     error
+	lastCompact time.Time
+	closed      bool
+	stats       Stats
+
+	appendHandlers []AppendHandler
+
+	syncCh       chan chan error
+	stop         chan struct{}
+	done         chan struct{}
+	finalSyncErr error
+}
+
+// Open 打开（或创建）存储目录：逐段扫描重建索引，截断损坏的尾部记录，删除超过保留期的段
+func Open(cfg config.SettlementStoreConfig) (*Store, error) {
+	s := &Store{
+		dir:            cfg.Dir,
+		segmentMax:     cfg.SegmentMaxBytes,
+		retentionDays:  cfg.RetentionDays,
+		syncMaxLatency: time.Duration(cfg.SyncMaxLatencyMs) * time.Millisecond,
+		syncMaxBatch:   cfg.SyncMaxBatch,
+		byOrder:        make(map[string][]*location),
+		byDeviceDay:    make(map[string][]*location),
+		nextSeq:        1,
+		syncCh:         make(chan chan error),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	if s.dir == "" {
+		s.dir = defaultDir
+	}
+	if s.segmentMax <= 0 {
+		s.segmentMax = defaultSegmentMaxBytes
+	}
+	if s.retentionDays <= 0 {
+		s.retentionDays = defaultRetentionDays
+	}
+	s.retention = time.Duration(s.retentionDays) * 24 * time.Hour
+	if cfg.SyncMaxLatencyMs == 0 {
+		s.syncMaxLatency = defaultSyncMaxLatency
+	}
+	if s.syncMaxBatch <= 0 {
+		s.syncMaxBatch = defaultSyncMaxBatch
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建结算存储目录失败: %w", err)
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.compactLocked(time.Now())
+	err := s.openActiveLocked()
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.syncedSeq = s.nextSeq - 1
+	go s.syncLoop()
+
+	logger.WithFields(logrus.Fields{
+		"dir":       s.dir,
+		"segments":  len(s.segments),
+		"records":   len(s.entries),
+		"truncated": s.stats.Truncated,
+	}).Info("✅ 结算日志存储已打开")
+	return s, nil
+}
+
+// load 按段顺序扫描，重建索引
+func (s *Store) load() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return fmt.Errorf("扫描结算存储失败: %w", err)
+	}
+	for _, path := range paths {
+		var id int
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+		if _, err := fmt.Sscanf(name, "%d", &id); err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("读取结算存储段失败: %w", err)
+		}
+		s.segments = append(s.segments, &segment{id: id, path: path, size: info.Size(), lastWrite: info.ModTime()})
+	}
+	sort.Slice(s.segments, func(a, b int) bool { return s.segments[a].id < s.segments[b].id })
+	for _, seg := range s.segments {
+		if err := s.loadSegment(seg); err != nil {
+			return err
+		}
+		s.totalBytes += seg.size
+	}
+	return nil
+}
+
+// loadSegment 扫描段内记录；遇到不完整或校验失败的记录时截断到最后一条完整记录
+// （崩溃时最后一条记录可能只写了一半：该记录未fsync，也未发送应答，设备会重发）
+func (s *Store) loadSegment(seg *segment) error {
+	data, err := os.ReadFile(seg.path)
+	if err != nil {
+		return fmt.Errorf("读取结算存储段失败: %w", err)
+	}
+	offset := 0
+	reason := ""
+	for offset < len(data) {
+		if len(data)-offset < headerSize {
+			reason = "记录头不完整"
+			break
+		}
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		checksum := binary.LittleEndian.Uint32(data[offset+4:])
+		if length <= 0 || length > maxRecordBytes || offset+headerSize+length > len(data) {
+			reason = "记录体不完整"
+			break
+		}
+		body := data[offset+headerSize : offset+headerSize+length]
+		if crc32.ChecksumIEEE(body) != checksum {
+			reason = "CRC校验失败"
+			break
+		}
+		var rec Record
+		_, err := persistence.Decode(RecordType, body, &rec)
+		if errors.Is(err, persistence.ErrFutureVersion) {
+			return fmt.Errorf("加载结算存储段失败: %w", err)
+		}
+		if errors.Is(err, persistence.ErrRecordArchived) {
+			offset += headerSize + length // 版本未知的记录已归档，保留在段内但不建索引
+			continue
+		}
+		if err != nil {
+			reason = "记录解析失败"
+			break
+		}
+		s.indexLocked(&rec, seg, int64(offset), length)
+		offset += headerSize + length
+	}
+	if offset == len(data) {
+		return nil
+	}
+
+	dropped := len(data) - offset
+	if err := os.Truncate(seg.path, int64(offset)); err != nil {
+		return fmt.Errorf("截断损坏的结算存储段失败: %w", err)
+	}
+	seg.size = int64(offset)
+	s.stats.Truncated += int64(dropped)
+	logger.WithFields(logrus.Fields{
+		"segment": seg.path,
+		"offset":  offset,
+		"dropped": dropped,
+		"reason":  reason,
+	}).Warn("⚠️ 结算存储段尾部记录损坏，已截断到最后一条完整记录")
+	return nil
+}
+
+// indexLocked 将记录加入索引，调用方持有锁
+func (s *Store) indexLocked(rec *Record, seg *segment, offset int64, length int) {
+	loc := &location{
+		seq:        rec.Seq,
+		segment:    seg,
+		offset:     offset,
+		length:     length,
+		orderNo:    rec.OrderNo,
+		deviceID:   rec.DeviceID,
+		receivedAt: rec.ReceivedAt,
+		digest:     sha256.Sum256(rec.Payload),
+	}
+	s.entries = append(s.entries, loc)
+	s.byOrder[rec.OrderNo] = append(s.byOrder[rec.OrderNo], loc)
+	key := deviceDayKey(rec.DeviceID, rec.ReceivedAt)
+	s.byDeviceDay[key] = append(s.byDeviceDay[key], loc)
+	if rec.Seq >= s.nextSeq {
+		s.nextSeq = rec.Seq + 1
+	}
+}
+
+func deviceDayKey(deviceID string, at time.Time) string {
+	return deviceID + "|" + at.Local().Format(DateLayout)
+}
+
+// openActiveLocked 打开当前写入段（最后一段未满时续写，否则新建）
+func (s *Store) openActiveLocked() error {
+	if n := len(s.segments); n > 0 && s.segments[n-1].size < s.segmentMax {
+		f, err := os.OpenFile(s.segments[n-1].path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("打开结算存储段失败: %w", err)
+		}
+		s.active = f
+		return nil
+	}
+	return s.rotateLocked(time.Now())
+}
+
+// rotateLocked 新建下一段；旧段交由同步协程在最后一次fsync后关闭
+func (s *Store) rotateLocked(now time.Time) error {
+	id := 1
+	if n := len(s.segments); n > 0 {
+		id = s.segments[n-1].id + 1
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%s%08d%s", segmentPrefix, id, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("创建结算存储段失败: %w", err)
+	}
+	// 新段的目录项须落盘，否则崩溃后整段丢失
+	if dir, err := os.Open(s.dir); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	if s.active != nil {
+		s.retired = append(s.retired, s.active)
+	}
+	s.active = f
+	s.segments = append(s.segments, &segment{id: id, path: path, lastWrite: now})
+	return nil
+}
+
+// Append 追加一条结算并等待fsync完成（返回后方可发送协议应答）。
+// 同一订单号且载荷相同的结算视为设备重发：不再写入，返回已有记录与 duplicate=true
+func (s *Store) Append(rec Record) (Record, bool, error) {
+	if rec.OrderNo == "" {
+		return rec, false, fmt.Errorf("订单号不能为空")
+	}
+	now := time.Now()
+	if rec.ReceivedAt.IsZero() {
+		rec.ReceivedAt = now
+	}
+	digest := sha256.Sum256(rec.Payload)
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return rec, false, ErrStoreClosed
+	}
+	if s.syncErr != nil {
+		err := s.syncErr
+		s.mutex.Unlock()
+		return rec, false, err
+	}
+	for _, loc := range s.byOrder[rec.OrderNo] {
+		if loc.digest == digest {
+			s.stats.Duplicates++
+			s.mutex.Unlock()
+			existing, err := s.read(loc)
+			if err != nil {
+				return rec, true, err
+			}
+			// 原记录可能仍在等待本批fsync
+			return existing, true, s.waitSynced(loc.seq)
+		}
+	}
+
+	rec.Seq = s.nextSeq
+	body, err := persistence.Encode(RecordType, rec)
+	if err != nil {
+		s.mutex.Unlock()
+		return rec, false, fmt.Errorf("序列化结算记录失败: %w", err)
+	}
+	buf := make([]byte, headerSize+len(body))
+	binary.LittleEndian.PutUint32(buf, uint32(len(body)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(body))
+	copy(buf[headerSize:], body)
+
+	seg := s.segments[len(s.segments)-1]
+	if seg.size > 0 && seg.size+int64(len(buf)) > s.segmentMax {
+		if err := s.rotateLocked(now); err != nil {
+			s.mutex.Unlock()
+			return rec, false, err
+		}
+		seg = s.segments[len(s.segments)-1]
+		s.compactLocked(now)
+	} else if now.Sub(s.lastCompact) >= compactInterval {
+		s.compactLocked(now)
+	}
+	if _, err := s.active.Write(buf); err != nil {
+		// 半条记录会让后续记录无法读取：回退到写入前的位置，回退失败时停止写入
+		if terr := s.active.Truncate(seg.size); terr != nil {
+			s.syncErr = fmt.Errorf("结算存储写入失败且无法回退: %w", terr)
+		}
+		s.mutex.Unlock()
+		return rec, false, fmt.Errorf("写入结算存储失败: %w", err)
+	}
+	s.indexLocked(&rec, seg, seg.size, len(body))
+	seg.size += int64(len(buf))
+	seg.lastWrite = now
+	s.totalBytes += int64(len(buf))
+	s.stats.Appended++
+	handlers := s.appendHandlers
+	s.mutex.Unlock()
+
+	if err := s.waitSynced(rec.Seq); err != nil {
+		return rec, false, err
+	}
+	for _, handler := range handlers {
+		handler(rec)
+	}
+	return rec, false, nil
+}
+
+// RegisterAppendHandler 注册新结算落盘后的回调（在存储锁外、应答设备之前同步调用，回调不应阻塞）
+func (s *Store) RegisterAppendHandler(handler AppendHandler) {
+	if handler == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.appendHandlers = append(s.appendHandlers, handler)
+	s.mutex.Unlock()
+}
+
+// AppendHandlerCount 已注册的新结算回调数量
+func (s *Store) AppendHandlerCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.appendHandlers)
+}
+
+// waitSynced 等待序号不大于 seq 的记录fsync完成
+func (s *Store) waitSynced(seq uint64) error {
+	s.mutex.Lock()
+	synced, syncErr := s.syncedSeq, s.syncErr
+	s.mutex.Unlock()
+	if syncErr != nil {
+		return syncErr
+	}
+	if seq <= synced {
+		return nil
+	}
+	reply := make(chan error, 1)
+	select {
+	case s.syncCh <- reply:
+		return <-reply
+	case <-s.done:
+		// 同步协程已退出：关闭前的最后一次fsync已覆盖此前写入的记录
+		return s.finalSyncErr
+	}
+}
+
+// syncLoop 合并fsync：收到第一个请求后最多再等待 syncMaxLatency 或凑满 syncMaxBatch 个请求，一次fsync后统一应答
+func (s *Store) syncLoop() {
+	defer close(s.done)
+	for {
+		var first chan error
+		select {
+		case first = <-s.syncCh:
+		case <-s.stop:
+			s.finalSyncErr = s.syncOnce()
+			for {
+				select {
+				case reply := <-s.syncCh:
+					reply <- s.finalSyncErr
+				default:
+					return
+				}
+			}
+		}
+		batch := []chan error{first}
+		if s.syncMaxLatency > 0 {
+			timer := time.NewTimer(s.syncMaxLatency)
+		collect:
+			for len(batch) < s.syncMaxBatch {
+				select {
+				case reply := <-s.syncCh:
+					batch = append(batch, reply)
+				case <-timer.C:
+					break collect
+				}
+			}
+			timer.Stop()
+		}
+		err := s.syncOnce()
+		for _, reply := range batch {
+			reply <- err
+		}
+	}
+}
+
+// syncOnce fsync 已轮转的段与当前段；失败后存储停止写入（无法确认哪些记录已落盘）
+func (s *Store) syncOnce() error {
+	s.mutex.Lock()
+	retired, active, upTo := s.retired, s.active, s.nextSeq-1
+	s.retired = nil
+	s.mutex.Unlock()
+
+	var syncErr error
+	for _, f := range retired {
+		if err := f.Sync(); err != nil && syncErr == nil {
+			syncErr = err
+		}
+		_ = f.Close()
+	}
+	if active != nil {
+		if err := active.Sync(); err != nil && syncErr == nil {
+			syncErr = err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats.Syncs++
+	if syncErr != nil {
+		s.syncErr = fmt.Errorf("结算存储fsync失败: %w", syncErr)
+		logger.WithFields(logrus.Fields{"dir": s.dir, "error": syncErr.Error()}).Error("🚨 结算存储fsync失败，停止写入（结算改为应答失败，由设备重发）")
+		return s.syncErr
+	}
+	if upTo > s.syncedSeq {
+		s.syncedSeq = upTo
+	}
+	return nil
+}
+
+// compactLocked 删除最后写入时间超过保留期的段（当前写入段除外）并移除其索引
+func (s *Store) compactLocked(now time.Time) {
+	s.lastCompact = now
+	removed := make(map[*segment]bool)
+	kept := s.segments[:0]
+	last := len(s.segments) - 1
+	for i, seg := range s.segments {
+		if i == last || now.Sub(seg.lastWrite) < s.retention {
+			kept = append(kept, seg)
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			logger.WithFields(logrus.Fields{"segment": seg.path, "error": err.Error()}).Warn("删除过期结算存储段失败")
+			kept = append(kept, seg)
+			continue
+		}
+		removed[seg] = true
+		s.totalBytes -= seg.size
+	}
+	s.segments = kept
+	if len(removed) == 0 {
+		return
+	}
+
+	entries := s.entries[:0]
+	for _, loc := range s.entries {
+		if !removed[loc.segment] {
+			entries = append(entries, loc)
+		}
+	}
+	s.entries = entries
+	s.byOrder = make(map[string][]*location)
+	s.byDeviceDay = make(map[string][]*location)
+	for _, loc := range s.entries {
+		s.byOrder[loc.orderNo] = append(s.byOrder[loc.orderNo], loc)
+		key := deviceDayKey(loc.deviceID, loc.receivedAt)
+		s.byDeviceDay[key] = append(s.byDeviceDay[key], loc)
+	}
+	logger.WithFields(logrus.Fields{"segments": len(removed), "retentionDays": s.retentionDays}).Info("已删除超过保留期的结算存储段")
+}
+
+// read 按位置读取记录
+func (s *Store) read(loc *location) (Record, error) {
+	var rec Record
+	f, err := os.Open(loc.segment.path)
+	if err != nil {
+		return rec, fmt.Errorf("打开结算存储段失败: %w", err)
+	}
+	defer f.Close()
+	body := make([]byte, loc.length)
+	if _, err := f.ReadAt(body, loc.offset+headerSize); err != nil {
+		return rec, fmt.Errorf("读取结算记录失败: %w", err)
+	}
+	if _, err := persistence.Decode(RecordType, body, &rec); err != nil {
+		return rec, fmt.Errorf("解析结算记录失败: %w", err)
+	}
+	return rec, nil
+}
+
+// Lookup 按订单号查询全部结算记录（按写入顺序；通常只有一条，设备上报过不同载荷时有多条）
+func (s *Store) Lookup(orderNo string) ([]Record, error) {
+	s.mutex.Lock()
+	locs := append([]*location(nil), s.byOrder[orderNo]...)
+	s.mutex.Unlock()
+	if len(locs) == 0 {
+		return nil, ErrNotFound
+	}
+	records := make([]Record, 0, len(locs))
+	for _, loc := range locs {
+		rec, err := s.read(loc)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Scan 按接收时间区间扫描（指定设备时经设备+自然日索引），按序号升序返回；more 表示达到条数上限后仍有记录
+func (s *Store) Scan(q Query) (records []Record, more bool, err error) {
+	s.mutex.Lock()
+	var candidates []*location
+	if q.DeviceID != "" && !q.From.IsZero() && !q.To.IsZero() {
+		for day := q.From.Local(); day.Before(q.To); day = day.AddDate(0, 0, 1) {
+			candidates = append(candidates, s.byDeviceDay[deviceDayKey(q.DeviceID, day)]...)
+		}
+		if last := q.To.Local().Add(-time.Nanosecond); last.Format(DateLayout) != q.From.Local().Format(DateLayout) {
+			// 区间末日不足24小时时上面的循环可能未覆盖
+			candidates = append(candidates, s.byDeviceDay[deviceDayKey(q.DeviceID, last)]...)
+		}
+	} else {
+		candidates = append(candidates, s.entries...)
+	}
+	s.mutex.Unlock()
+
+	sort.Slice(candidates, func(a, b int) bool { return candidates[a].seq < candidates[b].seq })
+	var lastSeq uint64
+	for _, loc := range candidates {
+		if loc.seq <= q.AfterSeq || loc.seq == lastSeq {
+			continue
+		}
+		if (q.DeviceID != "" && loc.deviceID != q.DeviceID) ||
+			(!q.From.IsZero() && loc.receivedAt.Before(q.From)) ||
+			(!q.To.IsZero() && !loc.receivedAt.Before(q.To)) {
+			continue
+		}
+		if q.Limit > 0 && len(records) >= q.Limit {
+			return records, true, nil
+		}
+		rec, err := s.read(loc)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // 扫描期间段已按保留期删除
+			}
+			return records, false, err
+		}
+		records = append(records, rec)
+		lastSeq = loc.seq
+	}
+	return records, false, nil
+}
+
+// Stats 存储统计
+func (s *Store) Stats() Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := s.stats
+	stats.Enabled = true
+	stats.Dir = s.dir
+	stats.Segments = len(s.segments)
+	stats.TotalBytes = s.totalBytes
+	stats.Records = len(s.entries)
+	stats.Orders = len(s.byOrder)
+	stats.LastSeq = s.nextSeq - 1
+	stats.RetentionDays = s.retentionDays
+	if s.syncErr != nil {
+		stats.SyncError = s.syncErr.Error()
+	}
+	return stats
+}
+
+// Close 停止接收写入，完成最后一次fsync后关闭段文件
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mutex.Unlock()
+
+	close(s.stop)
+	<-s.done
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var err error
+	if s.active != nil {
+		err = s.active.Close()
+		s.active = nil
+	}
+	if s.finalSyncErr != nil {
+		return s.finalSyncErr
+	}
+	return err
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalStore atomic.Pointer[Store]
+
+// GetGlobalStore 获取全局结算存储，未启用时返回nil
+func GetGlobalStore() *Store {
+	return globalStore.Load()
+}
+
+// InitGlobalStore 按配置打开全局结算存储（未启用时不创建）
+func InitGlobalStore() (*Store, error) {
+	cfg := config.GetConfig().SettlementStore
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	s, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	globalStore.Store(s)
+	return s, nil
+}
+
+// SetGlobalStore 替换全局结算存储（测试使用，传nil表示停用）
+func SetGlobalStore(s *Store) {
+	globalStore.Store(s)
+}
+
+// StopGlobalStore 关闭全局结算存储
+func StopGlobalStore() {
+	if s := globalStore.Swap(nil); s != nil {
+		if err := s.Close(); err != nil {
+			logger.WithFields(logrus.Fields{"error": err.Error()}).Error("关闭结算存储失败")
+		}
+	}
+}
@@ -0,0 +1,411 @@
+// Package shaping 预发环境响应塑形：按路由与调用方API Key注入延迟、错误响应与不完整分页，
+// 供合作方在不自行模拟网关的情况下验证客户端对慢响应与错误响应的处理。
+// 规则经运维接口下发并带有效期，到期自动失效；生产环境拒绝启用。
+package shaping
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTTL        = 10 * time.Minute
+	defaultMaxTTL     = 24 * time.Hour
+	defaultMaxLatency = 30 * time.Second
+	defaultKeyHeader  = "X-API-Key-Name"
+	maxRules          = 100
+)
+
+// 注入的错误
+const (
+	ErrorTooManyRequests = "429"             // 429 请求过于频繁（附 Retry-After）
+	ErrorUnavailable     = "503"             // 503 服务不可用
+	ErrorCommandTimeout  = "COMMAND_TIMEOUT" // 504 命令超时（problem+json）
+)
+
+var (
+	// ErrEnvironmentNotAllowed 部署环境不在允许列表内（含未配置与生产环境），拒绝启用响应塑形
+	ErrEnvironmentNotAllowed = errors.New("仅 development/staging/test 环境允许启用响应塑形")
+	// ErrUnknownPreset 预设规则不存在
+	ErrUnknownPreset = errors.New("预设规则不存在")
+)
+
+// RuleSpec 塑形规则定义
+type RuleSpec struct {
+	Name            string   `json:"name,omitempty"`
+	Route           string   `json:"route"`                     // 路由模板或请求路径，以*结尾为前缀匹配，"*" 匹配全部
+	Methods         []string `json:"methods,omitempty"`         // 为空匹配全部方法
+	APIKey          string   `json:"apiKey,omitempty"`          // 调用方API Key名称，为空匹配全部调用方
+	LatencyMs       int      `json:"latencyMs,omitempty"`       // 固定延迟
+	LatencyJitterMs int      `json:"latencyJitterMs,omitempty"` // 额外随机延迟 [0, jitter]
+	ErrorRate       float64  `json:"errorRate,omitempty"`       // 注入错误响应的概率 [0,1]
+	Errors          []string `json:"errors,omitempty"`          // 429 | 503 | COMMAND_TIMEOUT，多个时随机选取
+	PartialPageRate float64  `json:"partialPageRate,omitempty"` // 列表响应只返回部分条目的概率 [0,1]
+}
+
+// Rule 生效中的塑形规则
+type Rule struct {
+	RuleSpec
+	ID        string    `json:"id"`
+	Preset    string    `json:"preset,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Affected  uint64    `json:"affected"` // 已塑形的响应数
+}
+
+// Decision 单个请求的塑形结果
+type Decision struct {
+	RuleID      string
+	Latency     time.Duration
+	Error       string
+	PartialPage bool
+}
+
+// Marker 响应标记头的值，合作方据此区分注入的故障与真实故障
+func (d Decision) Marker() string {
+	parts := []string{"rule=" + d.RuleID}
+	if d.Latency > 0 {
+		parts = append(parts, "latency="+d.Latency.String())
+	}
+	if d.Error != "" {
+		parts = append(parts, "error="+d.Error)
+	}
+	if d.PartialPage {
+		parts = append(parts, "partial-page")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Options 塑形选项
+type Options struct {
+	Environment string
+	KeyHeader   string // 调用方API Key名称请求头
+	DefaultTTL  time.Duration
+	MaxTTL      time.Duration
+	MaxLatency  time.Duration
+	Presets     map[string]RuleSpec
+}
+
+// Shaper 响应塑形规则集
+type Shaper struct {
+	opts Options
+
+	mu    sync.Mutex
+	rules []*Rule
+	seq   uint64
+	rand  *rand.Rand
+}
+
+// NewShaper 创建规则集；部署环境不在允许列表内时返回 ErrEnvironmentNotAllowed
+func NewShaper(opts Options) (*Shaper, error) {
+	if !EnvironmentAllowed(opts.Environment) {
+		return nil, ErrEnvironmentNotAllowed
+	}
+	if opts.KeyHeader == "" {
+		opts.KeyHeader = defaultKeyHeader
+	}
+	if opts.DefaultTTL <= 0 {
+		opts.DefaultTTL = defaultTTL
+	}
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = defaultMaxTTL
+	}
+	if opts.MaxLatency <= 0 {
+		opts.MaxLatency = defaultMaxLatency
+	}
+	return &Shaper{opts: opts, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+}
+
+// EnvironmentAllowed 部署环境是否允许启用响应塑形：只认显式的非生产环境名，未配置或无法识别的环境一律视为不允许
+func EnvironmentAllowed(environment string) bool {
+	switch strings.ToLower(strings.TrimSpace(environment)) {
+	case "development", "staging", "test":
+		return true
+	}
+	return false
+}
+
+// Options 塑形选项
+func (s *Shaper) Options() Options {
+	return s.opts
+}
+
+// Add 添加规则并在 ttl 后自动失效（ttl<=0 使用默认有效期，超过上限时截断）；preset 非空时以配置的预设规则为基础，
+// spec 中的 route/apiKey 覆盖预设
+func (s *Shaper) Add(preset string, spec RuleSpec, ttl time.Duration, now time.Time) (Rule, error) {
+	if preset != "" {
+		base, ok := s.opts.Presets[preset]
+		if !ok {
+			return Rule{}, fmt.Errorf("%w: %s", ErrUnknownPreset, preset)
+		}
+		if spec.Route != "" {
+			base.Route = spec.Route
+		}
+		if spec.APIKey != "" {
+			base.APIKey = spec.APIKey
+		}
+		if len(spec.Methods) > 0 {
+			base.Methods = spec.Methods
+		}
+		if base.Name == "" {
+			base.Name = preset
+		}
+		spec = base
+	}
+	if err := s.validate(&spec); err != nil {
+		return Rule{}, err
+	}
+	if ttl <= 0 {
+		ttl = s.opts.DefaultTTL
+	}
+	if ttl > s.opts.MaxTTL {
+		ttl = s.opts.MaxTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	if len(s.rules) >= maxRules {
+		return Rule{}, fmt.Errorf("生效中的规则已达上限 %d", maxRules)
+	}
+	s.seq++
+	rule := &Rule{
+		RuleSpec:  spec,
+		ID:        fmt.Sprintf("shape-%d", s.seq),
+		Preset:    preset,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	s.rules = append(s.rules, rule)
+	logger.WithFields(logrus.Fields{
+		"ruleId":    rule.ID,
+		"route":     spec.Route,
+		"apiKey":    spec.APIKey,
+		"latencyMs": spec.LatencyMs,
+		"errorRate": spec.ErrorRate,
+		"errors":    spec.Errors,
+		"expiresAt": rule.ExpiresAt,
+	}).Warn("⚠️ 响应塑形规则已生效")
+	return *rule, nil
+}
+
+func (s *Shaper) validate(spec *RuleSpec) error {
+	spec.Route = strings.TrimSpace(spec.Route)
+	if spec.Route == "" {
+		return errors.New("route 不能为空")
+	}
+	if spec.Route != "*" && !strings.HasPrefix(spec.Route, "/") {
+		return fmt.Errorf("route 须以 / 开头或为 *: %s", spec.Route)
+	}
+	methods := make([]string, 0, len(spec.Methods))
+	for _, m := range spec.Methods {
+		methods = append(methods, strings.ToUpper(strings.TrimSpace(m)))
+	}
+	spec.Methods = methods
+	if spec.LatencyMs < 0 || spec.LatencyJitterMs < 0 {
+		return errors.New("延迟不能为负")
+	}
+	if time.Duration(spec.LatencyMs+spec.LatencyJitterMs)*time.Millisecond > s.opts.MaxLatency {
+		return fmt.Errorf("延迟上限为 %s", s.opts.MaxLatency)
+	}
+	if spec.ErrorRate < 0 || spec.ErrorRate > 1 || spec.PartialPageRate < 0 || spec.PartialPageRate > 1 {
+		return errors.New("概率须在 [0,1] 内")
+	}
+	if spec.ErrorRate > 0 && len(spec.Errors) == 0 {
+		return errors.New("errorRate>0 时须指定 errors")
+	}
+	for _, e := range spec.Errors {
+		switch e {
+		case ErrorTooManyRequests, ErrorUnavailable, ErrorCommandTimeout:
+		default:
+			return fmt.Errorf("不支持的注入错误: %s（可选 429、503、COMMAND_TIMEOUT）", e)
+		}
+	}
+	if spec.LatencyMs == 0 && spec.LatencyJitterMs == 0 && spec.ErrorRate == 0 && spec.PartialPageRate == 0 {
+		return errors.New("规则未配置任何塑形（延迟、错误或不完整分页）")
+	}
+	return nil
+}
+
+// Remove 删除规则
+func (s *Shaper) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.rules {
+		if r.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear 删除全部规则，返回删除数
+func (s *Shaper) Clear() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.rules)
+	s.rules = nil
+	return n
+}
+
+// Rules 生效中的规则（按创建顺序）
+func (s *Shaper) Rules(now time.Time) []Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	list := make([]Rule, 0, len(s.rules))
+	for _, r := range s.rules {
+		list = append(list, *r)
+	}
+	return list
+}
+
+// Shape 按最先创建的匹配规则决定本次请求的塑形；route 为路由模板，path 为请求路径。
+// 规则匹配但按概率未注入任何故障时返回 false
+func (s *Shaper) Shape(method, route, path, apiKey string, now time.Time) (Decision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	for _, r := range s.rules {
+		if !r.matches(method, route, path, apiKey) {
+			continue
+		}
+		d := Decision{RuleID: r.ID}
+		latency := r.LatencyMs
+		if r.LatencyJitterMs > 0 {
+			latency += s.rand.Intn(r.LatencyJitterMs + 1)
+		}
+		d.Latency = time.Duration(latency) * time.Millisecond
+		if r.ErrorRate > 0 && s.rand.Float64() < r.ErrorRate {
+			d.Error = r.Errors[s.rand.Intn(len(r.Errors))]
+		}
+		if d.Error == "" && r.PartialPageRate > 0 && s.rand.Float64() < r.PartialPageRate {
+			d.PartialPage = true
+		}
+		if d.Latency == 0 && d.Error == "" && !d.PartialPage {
+			return Decision{}, false
+		}
+		r.Affected++
+		return d, true
+	}
+	return Decision{}, false
+}
+
+func (s *Shaper) pruneLocked(now time.Time) {
+	kept := s.rules[:0]
+	for _, r := range s.rules {
+		if now.Before(r.ExpiresAt) {
+			kept = append(kept, r)
+			continue
+		}
+		logger.WithFields(logrus.Fields{"ruleId": r.ID, "affected": r.Affected}).Info("响应塑形规则已到期")
+	}
+	for i := len(kept); i < len(s.rules); i++ {
+		s.rules[i] = nil
+	}
+	s.rules = kept
+}
+
+func (r *Rule) matches(method, route, path, apiKey string) bool {
+	if r.APIKey != "" && r.APIKey != apiKey {
+		return false
+	}
+	if len(r.Methods) > 0 {
+		found := false
+		for _, m := range r.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Route == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(r.Route, "*"); ok {
+		return strings.HasPrefix(route, prefix) || strings.HasPrefix(path, prefix)
+	}
+	return r.Route == route || r.Route == path
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalShaper atomic.Pointer[Shaper]
+
+// GetGlobalShaper 获取全局规则集（未启用或生产环境时为nil）
+func GetGlobalShaper() *Shaper {
+	return globalShaper.Load()
+}
+
+// SetGlobalShaper 替换全局规则集（传nil关闭响应塑形）
+func SetGlobalShaper(s *Shaper) {
+	globalShaper.Store(s)
+}
+
+// InitGlobalShaper 按配置创建全局规则集；environment 不在允许列表内时拒绝启用并返回 ErrEnvironmentNotAllowed
+func InitGlobalShaper() error {
+	cfg := config.GetConfig()
+	rs := cfg.ResponseShaping
+	if !rs.Enabled {
+		SetGlobalShaper(nil)
+		return nil
+	}
+	presets := make(map[string]RuleSpec, len(rs.Presets))
+	names := make([]string, 0, len(rs.Presets))
+	for _, p := range rs.Presets {
+		if p.Name == "" {
+			continue
+		}
+		presets[p.Name] = RuleSpec{
+			Name:            p.Name,
+			Route:           p.Route,
+			Methods:         p.Methods,
+			APIKey:          p.APIKey,
+			LatencyMs:       p.LatencyMs,
+			LatencyJitterMs: p.LatencyJitterMs,
+			ErrorRate:       p.ErrorRate,
+			Errors:          p.Errors,
+			PartialPageRate: p.PartialPageRate,
+		}
+		names = append(names, p.Name)
+	}
+	keyHeader := rs.KeyHeader
+	if keyHeader == "" {
+		keyHeader = cfg.ChangeLog.KeyHeader
+	}
+	s, err := NewShaper(Options{
+		Environment: cfg.Environment,
+		KeyHeader:   keyHeader,
+		DefaultTTL:  time.Duration(rs.DefaultTTLSeconds) * time.Second,
+		MaxTTL:      time.Duration(rs.MaxTTLSeconds) * time.Second,
+		MaxLatency:  time.Duration(rs.MaxLatencyMs) * time.Millisecond,
+		Presets:     presets,
+	})
+	if err != nil {
+		SetGlobalShaper(nil)
+		return err
+	}
+	SetGlobalShaper(s)
+	sort.Strings(names)
+	logger.WithFields(logrus.Fields{
+		"environment": cfg.Environment,
+		"presets":     names,
+	}).Warn("⚠️ 响应塑形已启用（仅限预发环境），规则经 /api/v1/admin/response-shaping 下发")
+	return nil
+}
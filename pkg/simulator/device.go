@@ -0,0 +1,151 @@
+// Package simulator 充电设备模拟器：按指定协议方言生成设备上行帧（ICCID、注册、心跳、充电控制应答、功率心跳、结算）并解析网关下发帧，
+// 用于方言一致性测试与新厂商设备接入联调
+package simulator
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+)
+
+// Downlink 解析后的网关下发帧（消息ID已按方言字节序读出）
+type Downlink struct {
+	PhysicalID uint32
+	MessageID  uint16
+	Command    uint8
+	Payload    []byte
+}
+
+// Device 模拟设备：上行消息ID从1开始按帧递增
+type Device struct {
+	PhysicalID uint32
+	ICCID      string
+	Dialect    dialect.Name
+
+	mu        sync.Mutex
+	messageID uint16
+}
+
+// NewDevice 创建模拟设备
+func NewDevice(physicalID uint32, iccid string, name dialect.Name) *Device {
+	return &Device{PhysicalID: physicalID, ICCID: iccid, Dialect: name}
+}
+
+// ICCIDFrame 连接建立后首先发送的ICCID报文
+func (d *Device) ICCIDFrame() []byte {
+	return []byte(d.ICCID)
+}
+
+// Frame 按设备方言构建上行帧：v 为类型化结构时经方言编解码器编码，为 []byte 时作为载荷原样使用
+func (d *Device) Frame(command uint8, v interface{}) ([]byte, error) {
+	d.mu.Lock()
+	d.messageID++
+	if d.messageID == 0 {
+		d.messageID = 1
+	}
+	messageID := d.messageID
+	d.mu.Unlock()
+	return dialect.BuildFrame(d.Dialect, d.PhysicalID, messageID, command, v)
+}
+
+// SeedMessageID 设置下一帧上行帧的消息ID（模拟长时间运行后的序列位置，如跨越低字节进位）
+func (d *Device) SeedMessageID(next uint16) {
+	d.mu.Lock()
+	d.messageID = next - 1
+	d.mu.Unlock()
+}
+
+// LastMessageID 最近一帧上行帧的消息ID
+func (d *Device) LastMessageID() uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.messageID
+}
+
+// Register 设备注册(0x20)
+func (d *Device) Register(r dialect.Register) ([]byte, error) {
+	return d.Frame(constants.CmdDeviceRegister, r)
+}
+
+// Heartbeat 设备心跳(0x21)
+func (d *Device) Heartbeat(h dialect.Heartbeat) ([]byte, error) {
+	return d.Frame(constants.CmdDeviceHeart, h)
+}
+
+// ChargeControlResponse 充电控制应答(0x82)：messageID 须与网关下发的充电控制命令一致
+func (d *Device) ChargeControlResponse(messageID uint16, r dialect.ChargeControlResponse) ([]byte, error) {
+	return dialect.BuildFrame(d.Dialect, d.PhysicalID, messageID, constants.CmdChargeControl, r)
+}
+
+// Settlement 结算(0x03)；StopReason 填标准停止原因，方言编解码器负责换算为厂商枚举
+func (d *Device) Settlement(s dialect.Settlement) ([]byte, error) {
+	return d.Frame(constants.CmdSettlement, s)
+}
+
+// PowerHeartbeat 端口充电时功率心跳(0x06)字段（标准格式，各方言载荷一致）
+type PowerHeartbeat struct {
+	Port     uint8  // 协议端口(从0开始)
+	Status   uint8  // 端口状态：1充电中 5浮充
+	Duration uint16 // 充电时长(秒)
+	Energy   uint16 // 累计电量
+	Power    uint16 // 实时功率(0.1W)
+	OrderNo  string
+}
+
+// PowerHeartbeat 端口充电时功率心跳(0x06)
+func (d *Device) PowerHeartbeat(p PowerHeartbeat) ([]byte, error) {
+	if len(p.OrderNo) > 16 {
+		return nil, fmt.Errorf("订单编号超过16字节: %q", p.OrderNo)
+	}
+	// 端口号(1) + 端口状态(2) + 充电时长(2) + 累计电量(2) + 启动状态(1) + 实时/最大/最小功率(各2) + 订单编号(16)，与网关解析偏移一致
+	payload := make([]byte, 30)
+	payload[0] = p.Port
+	payload[1] = p.Status
+	binary.LittleEndian.PutUint16(payload[3:5], p.Duration)
+	binary.LittleEndian.PutUint16(payload[5:7], p.Energy)
+	payload[7] = 1
+	for i := 8; i < 14; i += 2 {
+		binary.LittleEndian.PutUint16(payload[i:i+2], p.Power)
+	}
+	copy(payload[14:30], p.OrderNo)
+	return d.Frame(constants.CmdPowerHeartbeat, payload)
+}
+
+// ParameterReport 运行参数上报(0x90/0x91)：params 为 *dny_protocol.RunParams11 或 *dny_protocol.RunParams12；
+// truncate>0 时去掉载荷末尾的字节数（模拟部分固件截断上报）
+func (d *Device) ParameterReport(command uint8, params encoding.BinaryMarshaler, truncate int) ([]byte, error) {
+	payload, err := params.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if truncate < 0 || truncate >= len(payload) {
+		return nil, fmt.Errorf("截断字节数 %d 超出载荷长度 %d", truncate, len(payload))
+	}
+	return d.Frame(command, payload[:len(payload)-truncate])
+}
+
+// ParseDownlink 解析网关下发给本设备的一帧
+func (d *Device) ParseDownlink(frame []byte) (Downlink, error) {
+	if len(frame) < constants.MinPacketSize || string(frame[:len(constants.ProtocolHeader)]) != constants.ProtocolHeader {
+		return Downlink{}, fmt.Errorf("不是DNY帧: % X", frame)
+	}
+	total := constants.MinHeaderSize + int(binary.LittleEndian.Uint16(frame[3:5]))
+	if total != len(frame) {
+		return Downlink{}, fmt.Errorf("帧长度不符: 声明%d 实际%d", total, len(frame))
+	}
+	body := frame[:len(frame)-constants.ChecksumSize]
+	if got := binary.LittleEndian.Uint16(frame[len(body):]); got != dny_protocol.Checksum(body) {
+		return Downlink{}, fmt.Errorf("校验和错误: %04X", got)
+	}
+	return Downlink{
+		PhysicalID: binary.LittleEndian.Uint32(frame[5:9]),
+		MessageID:  dialect.WireMessageID(d.Dialect, binary.LittleEndian.Uint16(frame[9:11])),
+		Command:    frame[11],
+		Payload:    append([]byte(nil), frame[12:len(body)]...),
+	}, nil
+}
@@ -0,0 +1,230 @@
+package sla
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 告警状态
+const (
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Rule 告警规则：租户24h窗口SLA成功率低于 MinSuccessPercent 时告警
+type Rule struct {
+	Name              string   `json:"name"`
+	MinSuccessPercent float64  `json:"minSuccessPercent"`
+	MinCommands       uint64   `json:"minCommands,omitempty"` // 24h窗口计入SLA的命令数下限（避免低命令量租户频繁告警）
+	Tenants           []string `json:"tenants,omitempty"`     // 适用的租户，为空表示全部
+}
+
+// Alert 租户SLA告警
+type Alert struct {
+	ID                   string           `json:"id"`
+	Rule                 string           `json:"rule"`
+	TenantID             string           `json:"tenantId"`
+	State                string           `json:"state"`
+	StartedAt            time.Time        `json:"startedAt"`
+	ResolvedAt           *time.Time       `json:"resolvedAt,omitempty"`
+	ThresholdPercent     float64          `json:"thresholdPercent"`
+	SuccessRate          float64          `json:"successRate"` // 开启（或成功率继续下降）时的24h成功率，恢复后为恢复时的成功率
+	LowestRate           float64          `json:"lowestRate"`  // 告警期间的最低成功率
+	Counted              uint64           `json:"counted"`
+	AttributableFailures uint64           `json:"attributableFailures"`
+	DominantFailure      Class            `json:"dominantFailure"` // 占比最高的可归责失败分类
+	DominantCount        uint64           `json:"dominantCount"`
+	Failures             map[Class]uint64 `json:"failures"` // 24h窗口各失败分类的命令数（含不计入SLA的分类）
+}
+
+// Handler 告警开启/恢复回调
+type Handler func(Alert)
+
+// ruleState 规则在各租户进行中的告警
+type ruleState struct {
+	rule   Rule
+	active map[string]*Alert // tenantID → 告警
+}
+
+func (rs *ruleState) applies(tenantID string) bool {
+	if len(rs.rule.Tenants) == 0 {
+		return true
+	}
+	for _, tenant := range rs.rule.Tenants {
+		if tenant == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRule(rule *Rule) error {
+	if rule.MinSuccessPercent <= 0 || rule.MinSuccessPercent > 100 {
+		return fmt.Errorf("minSuccessPercent 须在 (0,100] 范围内")
+	}
+	if rule.Name == "" {
+		rule.Name = fmt.Sprintf("success_below_%g", rule.MinSuccessPercent)
+	}
+	return nil
+}
+
+// RegisterHandler 注册告警开启/恢复回调
+func (t *Tracker) RegisterHandler(handler Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers = append(t.handlers, handler)
+}
+
+// HandlerCount 已注册的回调数量
+func (t *Tracker) HandlerCount() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.handlers)
+}
+
+// Evaluate 按当前时间判定全部租户的告警规则
+func (t *Tracker) Evaluate() {
+	if t == nil {
+		return
+	}
+	now := t.now()
+	t.mu.Lock()
+	var fired []Alert
+	for tenantID, ts := range t.tenants {
+		fired = append(fired, t.evaluateTenantLocked(tenantID, ts, now)...)
+	}
+	handlers := append([]Handler(nil), t.handlers...)
+	t.mu.Unlock()
+
+	t.dispatch(fired, handlers)
+}
+
+func (t *Tracker) hasActiveLocked(tenantID string) bool {
+	for _, rs := range t.rules {
+		if rs.active[tenantID] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateTenantLocked 判定租户的各条规则，返回开启或恢复的告警副本
+func (t *Tracker) evaluateTenantLocked(tenantID string, ts *tenantStats, now time.Time) []Alert {
+	if len(t.rules) == 0 {
+		return nil
+	}
+	counts := ts.windows[alertWindow].sum(now)
+	stats := t.statsLocked(counts)
+
+	var fired []Alert
+	for _, rs := range t.rules {
+		if !rs.applies(tenantID) {
+			continue
+		}
+		breached := stats.Counted > 0 && stats.Counted >= rs.rule.MinCommands && stats.SuccessRate < rs.rule.MinSuccessPercent
+		alert := rs.active[tenantID]
+		if alert == nil {
+			if !breached {
+				continue
+			}
+			t.seq++
+			alert = &Alert{
+				ID:               fmt.Sprintf("sla_%d_%d", now.UnixMilli(), t.seq),
+				Rule:             rs.rule.Name,
+				TenantID:         tenantID,
+				State:            StateFiring,
+				StartedAt:        now,
+				ThresholdPercent: rs.rule.MinSuccessPercent,
+				LowestRate:       stats.SuccessRate,
+			}
+			describe(alert, stats, counts)
+			rs.active[tenantID] = alert
+			t.recordLocked(alert)
+			fired = append(fired, *alert)
+			continue
+		}
+		if stats.SuccessRate < alert.LowestRate {
+			alert.LowestRate = stats.SuccessRate
+			// 成功率继续下降时按当前窗口更新失败分布
+			describe(alert, stats, counts)
+		}
+		if breached {
+			continue
+		}
+		resolvedAt := now
+		alert.State, alert.ResolvedAt, alert.SuccessRate = StateResolved, &resolvedAt, stats.SuccessRate
+		delete(rs.active, tenantID)
+		fired = append(fired, *alert)
+	}
+	return fired
+}
+
+// describe 记录窗口成功率与失败分布
+func describe(alert *Alert, stats WindowStats, counts [numClasses]uint64) {
+	alert.SuccessRate = stats.SuccessRate
+	alert.Counted = stats.Counted
+	alert.AttributableFailures = stats.AttributableFailures
+	alert.DominantFailure = stats.DominantFailure
+	alert.DominantCount = stats.Breakdown[stats.DominantFailure].Count
+	alert.Failures = make(map[Class]uint64, numClasses-1)
+	for i, c := range classes {
+		if c != ClassSuccess {
+			alert.Failures[c] = counts[i]
+		}
+	}
+}
+
+func (t *Tracker) recordLocked(alert *Alert) {
+	t.history[t.next] = alert
+	t.next = (t.next + 1) % len(t.history)
+	if t.count < len(t.history) {
+		t.count++
+	}
+}
+
+// dispatch 记录日志并回调（调用方不得持有锁）
+func (t *Tracker) dispatch(fired []Alert, handlers []Handler) {
+	for _, alert := range fired {
+		logger.WithFields(logrus.Fields{
+			"rule":            alert.Rule,
+			"tenantId":        alert.TenantID,
+			"state":           alert.State,
+			"successRate":     alert.SuccessRate,
+			"threshold":       alert.ThresholdPercent,
+			"dominantFailure": alert.DominantFailure,
+		}).Warn("📉 租户命令成功率SLA告警")
+		for _, h := range handlers {
+			h(alert)
+		}
+	}
+}
+
+// Active 进行中的告警
+func (t *Tracker) Active() []Alert {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := make([]Alert, 0)
+	for _, rs := range t.rules {
+		for _, alert := range rs.active {
+			active = append(active, *alert)
+		}
+	}
+	return active
+}
+
+// History 最近的告警（新→旧，含进行中）
+func (t *Tracker) History() []Alert {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	history := make([]Alert, 0, t.count)
+	for i := 1; i <= t.count; i++ {
+		history = append(history, *t.history[(t.next-i+len(t.history))%len(t.history)])
+	}
+	return history
+}
@@ -0,0 +1,480 @@
+// Package sla 按租户统计命令成功率：命令结束时按结果分类（成功、设备超时、设备否定应答、网关侧失败、设备离线）
+// 计入固定宽度的时间桶，1h/24h/30d 三个滑动窗口分别由分钟桶、小时桶、天桶（按UTC对齐）组成环形缓冲，
+// 内存占用与命令量无关。成功率只扣减网关可归责的失败（默认网关侧失败与设备超时），
+// 设备离线与否定应答单独列出、不计入SLA。告警规则按24h窗口成功率判定，见 alerts.go。
+package sla
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// Class 命令结果分类
+type Class string
+
+// 命令结果分类（与 network.CommandOutcome 取值一致）
+const (
+	ClassSuccess        Class = "success"
+	ClassDeviceTimeout  Class = "device_timeout"
+	ClassDeviceRejected Class = "device_rejected"
+	ClassGatewayError   Class = "gateway_error"
+	ClassDeviceOffline  Class = "device_offline"
+)
+
+// classes 统计顺序
+var classes = [...]Class{ClassSuccess, ClassDeviceTimeout, ClassDeviceRejected, ClassGatewayError, ClassDeviceOffline}
+
+const numClasses = len(classes)
+
+// UnassignedTenant 资产映射中未标注租户的设备计入的租户
+const UnassignedTenant = "_unassigned"
+
+// 滑动窗口名称
+const (
+	Window1h  = "1h"
+	Window24h = "24h"
+	Window30d = "30d"
+)
+
+const (
+	defaultMaxTenants       = 5000
+	defaultEvaluateInterval = time.Minute
+	defaultHistorySize      = 200
+)
+
+// DefaultAttributableClasses 默认计入SLA的失败分类
+var DefaultAttributableClasses = []Class{ClassGatewayError, ClassDeviceTimeout}
+
+// windowSpecs 窗口定义：桶宽 × 桶数
+var windowSpecs = [...]struct {
+	name    string
+	width   time.Duration
+	buckets int
+}{
+	{Window1h, time.Minute, 60},
+	{Window24h, time.Hour, 24},
+	{Window30d, 24 * time.Hour, 30},
+}
+
+// alertWindow 告警规则判定的窗口（24h）
+const alertWindow = 1
+
+// classIndex 分类在统计数组中的下标，未知分类返回-1
+func classIndex(c Class) int {
+	for i, cl := range classes {
+		if cl == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseClass 解析结果分类
+func ParseClass(s string) (Class, bool) {
+	c := Class(s)
+	return c, classIndex(c) >= 0
+}
+
+// bucket 固定宽度的时间桶，index 为桶起点（Unix纳秒/桶宽）
+type bucket struct {
+	index  int64
+	counts [numClasses]uint64
+}
+
+// window 环形缓冲的滑动窗口：当前桶与之前 len(buckets)-1 个桶
+type window struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+func (w *window) add(at time.Time, ci int) {
+	idx := at.UnixNano() / int64(w.width)
+	b := &w.buckets[idx%int64(len(w.buckets))]
+	if b.index > idx {
+		// 时钟回拨或迟到的记录，槽位已被更新的桶占用
+		return
+	}
+	if b.index != idx {
+		*b = bucket{index: idx}
+	}
+	b.counts[ci]++
+}
+
+func (w *window) sum(now time.Time) [numClasses]uint64 {
+	var out [numClasses]uint64
+	cur := now.UnixNano() / int64(w.width)
+	oldest := cur - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.index < oldest || b.index > cur {
+			continue
+		}
+		for i, n := range b.counts {
+			out[i] += n
+		}
+	}
+	return out
+}
+
+// tenantStats 租户各窗口的时间桶
+type tenantStats struct {
+	windows [len(windowSpecs)]*window
+	lastAt  time.Time
+}
+
+func newTenantStats() *tenantStats {
+	ts := &tenantStats{}
+	for i, spec := range windowSpecs {
+		ts.windows[i] = &window{width: spec.width, buckets: make([]bucket, spec.buckets)}
+	}
+	return ts
+}
+
+// ClassStats 窗口内单个分类的统计
+type ClassStats struct {
+	Count        uint64  `json:"count"`
+	Percent      float64 `json:"percent"`      // 占窗口内全部命令的百分比
+	Attributable bool    `json:"attributable"` // 是否计入SLA
+}
+
+// WindowStats 单个滑动窗口的成功率
+type WindowStats struct {
+	Window               string               `json:"window"`
+	WindowSeconds        int64                `json:"windowSeconds"`
+	BucketSeconds        int64                `json:"bucketSeconds"`
+	Total                uint64               `json:"total"`                // 窗口内结束的全部命令
+	Success              uint64               `json:"success"`              // 设备确认的命令
+	Counted              uint64               `json:"counted"`              // 计入SLA的命令（成功 + 可归责失败）
+	AttributableFailures uint64               `json:"attributableFailures"` // 可归责失败
+	SuccessRate          float64              `json:"successRate"`          // SLA成功率百分比，无计入命令时为100
+	RawSuccessRate       float64              `json:"rawSuccessRate"`       // 全部命令中的成功百分比，无命令时为100
+	DominantFailure      Class                `json:"dominantFailure,omitempty"`
+	Breakdown            map[Class]ClassStats `json:"breakdown"`
+}
+
+// TenantSLA 租户SLA快照
+type TenantSLA struct {
+	TenantID            string        `json:"tenantId"`
+	GeneratedAt         time.Time     `json:"generatedAt"`
+	LastCommandAt       time.Time     `json:"lastCommandAt"`
+	AttributableClasses []Class       `json:"attributableClasses"`
+	Windows             []WindowStats `json:"windows"`
+	ActiveAlerts        []Alert       `json:"activeAlerts"`
+	RecentAlerts        []Alert       `json:"recentAlerts"` // 该租户最近的告警（新→旧，含已恢复）
+}
+
+// Options 统计选项
+type Options struct {
+	AttributableClasses []Class // 计入SLA的失败分类，为空时使用 DefaultAttributableClasses
+	MaxTenants          int     // 统计的租户数上限，超出后新租户不再统计
+	EvaluateInterval    time.Duration
+	HistorySize         int // 保留的告警记录数
+	Rules               []Rule
+}
+
+// Tracker 按租户统计命令成功率
+type Tracker struct {
+	opts         Options
+	attributable [numClasses]bool
+	nowFunc      atomic.Pointer[func() time.Time]
+
+	mu       sync.Mutex
+	tenants  map[string]*tenantStats
+	dropped  uint64
+	rules    []*ruleState
+	history  []*Alert
+	next     int
+	count    int
+	seq      uint64
+	handlers []Handler
+	cancel   context.CancelFunc
+}
+
+// NewTracker 创建统计；非正数选项使用默认值，无效分类与规则忽略
+func NewTracker(opts Options) *Tracker {
+	if opts.MaxTenants <= 0 {
+		opts.MaxTenants = defaultMaxTenants
+	}
+	if opts.EvaluateInterval <= 0 {
+		opts.EvaluateInterval = defaultEvaluateInterval
+	}
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = defaultHistorySize
+	}
+	t := &Tracker{tenants: make(map[string]*tenantStats), history: make([]*Alert, opts.HistorySize)}
+
+	attributable := opts.AttributableClasses
+	if len(attributable) == 0 {
+		attributable = DefaultAttributableClasses
+	}
+	opts.AttributableClasses = nil
+	for _, c := range attributable {
+		ci := classIndex(c)
+		if ci < 0 || c == ClassSuccess {
+			logger.WithField("class", c).Warn("忽略无效的SLA归责分类")
+			continue
+		}
+		if !t.attributable[ci] {
+			t.attributable[ci] = true
+			opts.AttributableClasses = append(opts.AttributableClasses, c)
+		}
+	}
+
+	rules := opts.Rules
+	opts.Rules = nil
+	for _, rule := range rules {
+		if err := validateRule(&rule); err != nil {
+			logger.WithFields(logrus.Fields{"rule": rule.Name, "error": err.Error()}).Warn("忽略无效的SLA告警规则")
+			continue
+		}
+		opts.Rules = append(opts.Rules, rule)
+		t.rules = append(t.rules, &ruleState{rule: rule, active: make(map[string]*Alert)})
+	}
+	t.opts = opts
+	return t
+}
+
+// Options 统计选项（已补全默认值，仅含有效分类与规则）
+func (t *Tracker) Options() Options {
+	return t.opts
+}
+
+// SetNowFunc 替换时钟（测试使用）
+func (t *Tracker) SetNowFunc(now func() time.Time) {
+	if now == nil {
+		t.nowFunc.Store(nil)
+		return
+	}
+	t.nowFunc.Store(&now)
+}
+
+func (t *Tracker) now() time.Time {
+	if fn := t.nowFunc.Load(); fn != nil {
+		return (*fn)()
+	}
+	return time.Now()
+}
+
+// Record 记录一条已结束的命令（租户为空时计入 UnassignedTenant），并判定该租户的告警规则
+func (t *Tracker) Record(tenantID string, class Class) {
+	if t == nil {
+		return
+	}
+	ci := classIndex(class)
+	if ci < 0 {
+		return
+	}
+	if tenantID == "" {
+		tenantID = UnassignedTenant
+	}
+	now := t.now()
+
+	t.mu.Lock()
+	ts, ok := t.tenants[tenantID]
+	if !ok {
+		if len(t.tenants) >= t.opts.MaxTenants {
+			t.dropped++
+			dropped := t.dropped
+			t.mu.Unlock()
+			if dropped == 1 || dropped%1000 == 0 {
+				logger.WithFields(logrus.Fields{"tenantId": tenantID, "maxTenants": t.opts.MaxTenants, "dropped": dropped}).Warn("SLA统计租户数已达上限，新租户的命令不再统计")
+			}
+			return
+		}
+		ts = newTenantStats()
+		t.tenants[tenantID] = ts
+	}
+	for _, w := range ts.windows {
+		w.add(now, ci)
+	}
+	ts.lastAt = now
+	var fired []Alert
+	if class != ClassSuccess || t.hasActiveLocked(tenantID) {
+		fired = t.evaluateTenantLocked(tenantID, ts, now)
+	}
+	handlers := append([]Handler(nil), t.handlers...)
+	t.mu.Unlock()
+
+	t.dispatch(fired, handlers)
+}
+
+// Tenants 有统计数据的租户（按名称排序）
+func (t *Tracker) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenants := make([]string, 0, len(t.tenants))
+	for tenant := range t.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Snapshot 租户各窗口的成功率；租户没有统计数据时返回 false
+func (t *Tracker) Snapshot(tenantID string) (TenantSLA, bool) {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts, ok := t.tenants[tenantID]
+	if !ok {
+		return TenantSLA{}, false
+	}
+	snapshot := TenantSLA{
+		TenantID:            tenantID,
+		GeneratedAt:         now,
+		LastCommandAt:       ts.lastAt,
+		AttributableClasses: append([]Class(nil), t.opts.AttributableClasses...),
+		Windows:             make([]WindowStats, 0, len(windowSpecs)),
+		ActiveAlerts:        make([]Alert, 0),
+		RecentAlerts:        make([]Alert, 0),
+	}
+	for i, spec := range windowSpecs {
+		stats := t.statsLocked(ts.windows[i].sum(now))
+		stats.Window = spec.name
+		stats.WindowSeconds = int64(spec.width/time.Second) * int64(spec.buckets)
+		stats.BucketSeconds = int64(spec.width / time.Second)
+		snapshot.Windows = append(snapshot.Windows, stats)
+	}
+	for _, rs := range t.rules {
+		if alert := rs.active[tenantID]; alert != nil {
+			snapshot.ActiveAlerts = append(snapshot.ActiveAlerts, *alert)
+		}
+	}
+	for i := 1; i <= t.count; i++ {
+		if alert := t.history[(t.next-i+len(t.history))%len(t.history)]; alert.TenantID == tenantID {
+			snapshot.RecentAlerts = append(snapshot.RecentAlerts, *alert)
+		}
+	}
+	return snapshot, true
+}
+
+// statsLocked 按分类计数计算成功率与失败分布
+func (t *Tracker) statsLocked(counts [numClasses]uint64) WindowStats {
+	stats := WindowStats{Breakdown: make(map[Class]ClassStats, numClasses), SuccessRate: 100, RawSuccessRate: 100}
+	for _, n := range counts {
+		stats.Total += n
+	}
+	stats.Success = counts[0]
+	var dominant uint64
+	for i, c := range classes {
+		cs := ClassStats{Count: counts[i], Attributable: t.attributable[i]}
+		if stats.Total > 0 {
+			cs.Percent = percent(counts[i], stats.Total)
+		}
+		stats.Breakdown[c] = cs
+		if cs.Attributable {
+			stats.AttributableFailures += counts[i]
+			if counts[i] > dominant {
+				dominant, stats.DominantFailure = counts[i], c
+			}
+		}
+	}
+	stats.Counted = stats.Success + stats.AttributableFailures
+	if stats.Counted > 0 {
+		stats.SuccessRate = percent(stats.Success, stats.Counted)
+	}
+	if stats.Total > 0 {
+		stats.RawSuccessRate = percent(stats.Success, stats.Total)
+	}
+	return stats
+}
+
+// percent 百分比，保留三位小数
+func percent(n, total uint64) float64 {
+	return float64(int64(float64(n)*100000/float64(total)+0.5)) / 1000
+}
+
+// Start 按判定间隔定时判定全部租户的告警规则（窗口滑动后成功率回升的告警在此恢复）
+func (t *Tracker) Start(ctx context.Context) {
+	t.mu.Lock()
+	if t.cancel != nil || len(t.rules) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(t.opts.EvaluateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.Evaluate()
+			}
+		}
+	}()
+}
+
+// Stop 停止定时判定
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalTracker atomic.Pointer[Tracker]
+
+// GetGlobalTracker 获取全局统计（未启用时为nil）
+func GetGlobalTracker() *Tracker {
+	return globalTracker.Load()
+}
+
+// SetGlobalTracker 设置全局统计
+func SetGlobalTracker(t *Tracker) {
+	globalTracker.Store(t)
+}
+
+// InitGlobalTracker 按配置创建全局统计并开始定时判定告警；未启用时不创建
+func InitGlobalTracker(ctx context.Context) *Tracker {
+	cfg := config.GetConfig().SLA
+	if !cfg.Enabled {
+		globalTracker.Store(nil)
+		return nil
+	}
+	attributable := make([]Class, 0, len(cfg.AttributableClasses))
+	for _, c := range cfg.AttributableClasses {
+		attributable = append(attributable, Class(c))
+	}
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		rules = append(rules, Rule{
+			Name:              r.Name,
+			MinSuccessPercent: r.MinSuccessPercent,
+			MinCommands:       r.MinCommands,
+			Tenants:           r.Tenants,
+		})
+	}
+	t := NewTracker(Options{
+		AttributableClasses: attributable,
+		MaxTenants:          cfg.MaxTenants,
+		EvaluateInterval:    time.Duration(cfg.EvaluateIntervalSeconds) * time.Second,
+		HistorySize:         cfg.HistorySize,
+		Rules:               rules,
+	})
+	globalTracker.Store(t)
+	t.Start(ctx)
+	return t
+}
+
+// StopGlobalTracker 停止全局统计的定时判定
+func StopGlobalTracker() {
+	if t := globalTracker.Load(); t != nil {
+		t.Stop()
+	}
+}
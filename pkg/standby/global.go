@@ -0,0 +1,105 @@
+package standby
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MetricsCollectorName /metrics 附加指标名
+	MetricsCollectorName = "standby"
+
+	defaultRedisKey = "iot:standby:registry"
+)
+
+// WritePrometheus 以 Prometheus 文本格式写出接管耗时与重新注册速率
+func (c *Controller) WritePrometheus(w io.Writer) {
+	s := c.Status()
+	active := 0
+	if s.Role == RolePrimary || s.Active {
+		active = 1
+	}
+	fmt.Fprintf(w, "# HELP iot_standby_active Instance accepts devices (primary, or standby after takeover).\n# TYPE iot_standby_active gauge\n")
+	fmt.Fprintf(w, "iot_standby_active{role=%q} %d\n", s.Role, active)
+	if s.Handover != nil && s.Handover.FinishedAt != nil {
+		fmt.Fprintf(w, "# HELP iot_handover_duration_seconds Duration of the last finished takeover.\n# TYPE iot_handover_duration_seconds gauge\n")
+		fmt.Fprintf(w, "iot_handover_duration_seconds{phase=%q,rehearsal=\"%t\"} %.3f\n", s.Handover.Phase, s.Handover.Rehearsal, float64(s.Handover.DurationMs)/1000)
+		fmt.Fprintf(w, "# HELP iot_handover_phase_duration_seconds Per-phase duration of the last finished takeover.\n# TYPE iot_handover_phase_duration_seconds gauge\n")
+		for _, p := range s.Handover.Phases {
+			fmt.Fprintf(w, "iot_handover_phase_duration_seconds{phase=%q} %.3f\n", p.Phase, float64(p.DurationMs)/1000)
+		}
+	}
+	c.mu.Lock()
+	fmt.Fprintf(w, "# HELP iot_handover_total Takeovers by result.\n# TYPE iot_handover_total counter\n")
+	for _, phase := range []Phase{PhaseCompleted, PhaseAborted, PhaseFailed} {
+		fmt.Fprintf(w, "iot_handover_total{result=%q} %d\n", phase, c.counts[phase])
+	}
+	c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP iot_standby_reregistered_devices_per_minute Handed-over devices re-registered in the last minute.\n# TYPE iot_standby_reregistered_devices_per_minute gauge\n")
+	fmt.Fprintf(w, "iot_standby_reregistered_devices_per_minute %d\n", s.ReRegisteredPerMin)
+	fmt.Fprintf(w, "# HELP iot_standby_reregistered_devices_total Handed-over devices re-registered after activation.\n# TYPE iot_standby_reregistered_devices_total counter\n")
+	fmt.Fprintf(w, "iot_standby_reregistered_devices_total %d\n", s.ReRegistered)
+}
+
+var globalController atomic.Pointer[Controller]
+
+// GetGlobalController 获取全局热备控制器（未启用时为nil）
+func GetGlobalController() *Controller {
+	return globalController.Load()
+}
+
+// SetGlobalController 替换全局热备控制器（测试使用）
+func SetGlobalController(c *Controller) {
+	globalController.Store(c)
+}
+
+// InitGlobal 按配置创建并启动热备控制器（需在Redis初始化之后调用），未配置角色时返回nil
+func InitGlobal(ctx context.Context, hooks Hooks) (*Controller, error) {
+	cfg := config.GetConfig().Standby
+	if cfg.Role == "" {
+		return nil, nil
+	}
+	client := infraredis.GetClient()
+	if client == nil {
+		return nil, fmt.Errorf("热备复制需要连接Redis")
+	}
+	key := cfg.RedisKey
+	if key == "" {
+		key = defaultRedisKey
+	}
+	c, err := New(Options{
+		Store:              replica.NewRedisStore(client, key),
+		InstanceID:         cluster.GetGlobalOwnership().Self().InstanceID,
+		Role:               cfg.Role,
+		PublishInterval:    time.Duration(cfg.PublishIntervalSeconds) * time.Second,
+		PollInterval:       time.Duration(cfg.PollIntervalSeconds) * time.Second,
+		SyncTimeout:        time.Duration(cfg.SyncTimeoutSeconds) * time.Second,
+		ActivateTimeout:    time.Duration(cfg.ActivateTimeoutSeconds) * time.Second,
+		CloseBatchSize:     cfg.CloseBatchSize,
+		CloseBatchInterval: time.Duration(cfg.CloseBatchIntervalMs) * time.Millisecond,
+	}, hooks)
+	if err != nil {
+		return nil, err
+	}
+	c.Start(ctx)
+	globalController.Store(c)
+	logger.WithFields(logrus.Fields{"role": cfg.Role, "key": key, "instanceId": c.opts.InstanceID}).Info("热备复制已启动")
+	return c, nil
+}
+
+// StopGlobal 停止热备复制
+func StopGlobal() {
+	if c := globalController.Load(); c != nil {
+		c.Stop()
+	}
+}
@@ -0,0 +1,721 @@
+// Package standby 热备实例与计划内接管：主实例持续经共享存储复制交接状态（在线设备统计、进行中订单、延迟命令），
+// 热备实例不接入设备、仅应用复制数据；计划维护时由主实例发起接管，按阶段停止接入、激活热备并分批关闭设备连接，
+// 设备重连到热备并重新注册后延续交接前的统计。演练模式执行除关闭连接以外的全部阶段。
+package standby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RecordType 热备复制记录的持久化记录类型
+	RecordType = "standby_record"
+
+	RolePrimary = "primary" // 主实例：发布交接状态并发起接管
+	RoleStandby = "standby" // 热备实例：应用交接状态，接管时切换为接入设备
+
+	defaultPublishInterval    = 2 * time.Second
+	defaultPollInterval       = time.Second
+	defaultSyncTimeout        = 30 * time.Second
+	defaultActivateTimeout    = 30 * time.Second
+	defaultCloseBatchSize     = 50
+	defaultCloseBatchInterval = time.Second
+	storeTimeout              = 3 * time.Second
+	reRegistrationWindow      = time.Minute
+)
+
+func init() {
+	persistence.RegisterType(RecordType, 1)
+}
+
+// Phase 接管阶段
+type Phase string
+
+const (
+	PhaseSyncing    Phase = "syncing"     // 发布最新交接状态，等待热备应用
+	PhaseStopAccept Phase = "stop_accept" // 主实例停止接受新连接
+	PhaseActivating Phase = "activating"  // 通知热备激活，等待其确认
+	PhaseClosing    Phase = "closing"     // 分批关闭设备连接（演练只统计不关闭）
+	PhaseCompleted  Phase = "completed"
+	PhaseAborted    Phase = "aborted" // 管理员中止：主实例恢复接入，热备退回待命
+	PhaseFailed     Phase = "failed"  // 热备未在时限内同步或确认
+)
+
+// Terminal 是否为结束阶段
+func (p Phase) Terminal() bool {
+	return p == PhaseCompleted || p == PhaseAborted || p == PhaseFailed
+}
+
+var (
+	// ErrNotPrimary 本实例不是主实例，不能发起接管
+	ErrNotPrimary = errors.New("本实例不是热备主实例")
+	// ErrHandoverRunning 已有进行中的接管
+	ErrHandoverRunning = errors.New("已有进行中的接管")
+	// ErrNoHandover 没有可中止的接管
+	ErrNoHandover = errors.New("没有进行中的接管")
+)
+
+// Signal 主实例随交接状态发布的接管信号
+type Signal struct {
+	ID        string    `json:"id"`
+	Phase     Phase     `json:"phase"`
+	Rehearsal bool      `json:"rehearsal"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Record 共享存储中每个实例一条的复制记录：主实例写交接状态与接管信号，热备写应用进度与激活确认
+type Record struct {
+	InstanceID  string    `json:"instanceId"`
+	Role        string    `json:"role"`
+	Seq         uint64    `json:"seq,omitempty"`
+	PublishedAt time.Time `json:"publishedAt"`
+
+	// 主实例
+	Registry *gateway.HandoverState `json:"registry,omitempty"`
+	Handover *Signal                `json:"handover,omitempty"`
+
+	// 热备实例
+	AppliedSeq uint64 `json:"appliedSeq,omitempty"`
+	Active     bool   `json:"active,omitempty"`
+	HandoverID string `json:"handoverId,omitempty"` // 已确认的接管
+	Ready      bool   `json:"ready,omitempty"`      // 已完成激活（演练时仅确认可激活）
+}
+
+// Hooks 与网关、TCP服务器的衔接（测试中替换为桩）
+type Hooks struct {
+	Export          func() gateway.HandoverState
+	Import          func(state gateway.HandoverState) (orders int, deferred int)
+	Restore         func(prior gateway.HandoverDevice) bool
+	StopAccepting   func()
+	ResumeAccepting func()
+	Connections     func() []uint64
+	CloseConnection func(connID uint64) bool
+}
+
+// Options 热备配置
+type Options struct {
+	Store              replica.Store
+	InstanceID         string
+	Role               string
+	PublishInterval    time.Duration // 主实例发布间隔
+	PollInterval       time.Duration // 读取对端记录的间隔
+	SyncTimeout        time.Duration // 等待热备应用最新交接状态的时限
+	ActivateTimeout    time.Duration // 等待热备激活确认的时限
+	CloseBatchSize     int           // 每批关闭的连接数
+	CloseBatchInterval time.Duration // 批次间隔
+}
+
+// PhaseTiming 单个阶段的耗时
+type PhaseTiming struct {
+	Phase      Phase     `json:"phase"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Handover 一次接管的进度
+type Handover struct {
+	ID          string        `json:"id"`
+	Rehearsal   bool          `json:"rehearsal"`
+	Phase       Phase         `json:"phase"`
+	Error       string        `json:"error,omitempty"`
+	Standby     string        `json:"standby,omitempty"`
+	StartedAt   time.Time     `json:"startedAt"`
+	FinishedAt  *time.Time    `json:"finishedAt,omitempty"`
+	DurationMs  int64         `json:"durationMs"`
+	Phases      []PhaseTiming `json:"phases"`
+	Devices     int           `json:"devices"`     // 交接的在线设备数
+	Orders      int           `json:"orders"`      // 交接的进行中订单数
+	Deferred    int           `json:"deferred"`    // 交接的延迟命令数
+	Connections int           `json:"connections"` // 关闭阶段开始时的连接数
+	Closed      int           `json:"closed"`      // 已关闭的连接数（演练为0）
+	Batches     int           `json:"batches"`
+}
+
+// Status 热备状态
+type Status struct {
+	InstanceID string `json:"instanceId"`
+	Role       string `json:"role"`
+	// 主实例
+	Seq      uint64    `json:"seq,omitempty"`
+	Handover *Handover `json:"handover,omitempty"` // 当前或最近一次接管
+	Peer     *Record   `json:"peer,omitempty"`     // 对端最近的记录（不含交接状态）
+	// 热备实例
+	AppliedSeq         uint64     `json:"appliedSeq,omitempty"`
+	AppliedAt          *time.Time `json:"appliedAt,omitempty"`
+	Active             bool       `json:"active"`
+	ActivatedAt        *time.Time `json:"activatedAt,omitempty"`
+	ReplicatedDevices  int        `json:"replicatedDevices"`
+	PendingReRegister  int        `json:"pendingReRegister"`  // 已激活但尚未重新注册的交接设备
+	ReRegistered       int64      `json:"reRegistered"`       // 激活后重新注册的交接设备累计数
+	ReRegisteredPerMin int        `json:"reRegisteredPerMin"` // 最近一分钟重新注册的交接设备数
+}
+
+// Controller 热备控制器（主实例与热备实例共用，按角色执行）
+type Controller struct {
+	opts  Options
+	hooks Hooks
+
+	mu sync.Mutex
+	// 主实例
+	seq      uint64
+	signal   *Signal
+	handover *Handover
+	cancel   context.CancelFunc
+	peer     *Record
+	counts   map[Phase]int64 // 各结束阶段的接管次数
+	// 热备实例
+	registry       *gateway.HandoverState
+	appliedSeq     uint64
+	appliedAt      time.Time
+	active         bool
+	activatedAt    time.Time
+	handoverID     string
+	ready          bool
+	prior          map[string]gateway.HandoverDevice
+	reRegistered   int64
+	reRegisterTime []time.Time
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	now      func() time.Time
+}
+
+// New 创建热备控制器
+func New(opts Options, hooks Hooks) (*Controller, error) {
+	if opts.Store == nil {
+		return nil, errors.New("热备需要共享存储")
+	}
+	if opts.Role != RolePrimary && opts.Role != RoleStandby {
+		return nil, fmt.Errorf("未知的热备角色: %q", opts.Role)
+	}
+	if opts.PublishInterval <= 0 {
+		opts.PublishInterval = defaultPublishInterval
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.SyncTimeout <= 0 {
+		opts.SyncTimeout = defaultSyncTimeout
+	}
+	if opts.ActivateTimeout <= 0 {
+		opts.ActivateTimeout = defaultActivateTimeout
+	}
+	if opts.CloseBatchSize <= 0 {
+		opts.CloseBatchSize = defaultCloseBatchSize
+	}
+	if opts.CloseBatchInterval <= 0 {
+		opts.CloseBatchInterval = defaultCloseBatchInterval
+	}
+	return &Controller{
+		opts:   opts,
+		hooks:  hooks,
+		counts: make(map[Phase]int64),
+		stopCh: make(chan struct{}),
+		now:    time.Now,
+	}, nil
+}
+
+// Role 本实例角色
+func (c *Controller) Role() string {
+	return c.opts.Role
+}
+
+// Start 启动周期复制：主实例发布交接状态，热备实例应用主实例的记录
+func (c *Controller) Start(ctx context.Context) {
+	interval := c.opts.PollInterval
+	if c.opts.Role == RolePrimary {
+		interval = c.opts.PublishInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			var err error
+			if c.opts.Role == RolePrimary {
+				_, err = c.Publish()
+			} else {
+				err = c.Poll()
+			}
+			if err != nil {
+				logger.WithFields(logrus.Fields{"role": c.opts.Role, "error": err.Error()}).Warn("热备复制失败")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止复制并中止进行中的接管
+func (c *Controller) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+		c.mu.Lock()
+		cancel := c.cancel
+		c.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+	})
+}
+
+// ===============================
+// 主实例：发布与接管
+// ===============================
+
+// Publish 发布最新交接状态与当前接管信号，返回序号
+func (c *Controller) Publish() (uint64, error) {
+	if c.opts.Role != RolePrimary {
+		return 0, ErrNotPrimary
+	}
+	state := c.hooks.Export()
+	c.mu.Lock()
+	c.seq++
+	rec := Record{InstanceID: c.opts.InstanceID, Role: RolePrimary, Seq: c.seq, PublishedAt: c.now(), Registry: &state}
+	if c.signal != nil {
+		signal := *c.signal
+		rec.Handover = &signal
+	}
+	c.mu.Unlock()
+	return rec.Seq, c.put(rec)
+}
+
+// BeginTakeover 发起接管（rehearsal 为演练：不关闭连接，完成后主实例恢复接入、热备退回待命）
+func (c *Controller) BeginTakeover(rehearsal bool) (Handover, error) {
+	if c.opts.Role != RolePrimary {
+		return Handover{}, ErrNotPrimary
+	}
+	c.mu.Lock()
+	if c.handover != nil && !c.handover.Phase.Terminal() {
+		h := c.copyHandoverLocked()
+		c.mu.Unlock()
+		return h, ErrHandoverRunning
+	}
+	now := c.now()
+	c.handover = &Handover{
+		ID:        fmt.Sprintf("%s-%d", c.opts.InstanceID, now.UnixNano()),
+		Rehearsal: rehearsal,
+		StartedAt: now,
+		Phases:    []PhaseTiming{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	h := c.copyHandoverLocked()
+	c.mu.Unlock()
+
+	logger.WithFields(logrus.Fields{"handoverId": h.ID, "rehearsal": rehearsal}).Info("🔀 开始热备接管")
+	go c.run(ctx, h.ID, rehearsal)
+	return h, nil
+}
+
+// Abort 中止进行中的接管：主实例恢复接入，热备收到中止信号后退回待命
+func (c *Controller) Abort() (Handover, error) {
+	c.mu.Lock()
+	if c.handover == nil || c.handover.Phase.Terminal() {
+		c.mu.Unlock()
+		return Handover{}, ErrNoHandover
+	}
+	cancel := c.cancel
+	c.mu.Unlock()
+	cancel()
+	// 等待接管流程退出并发布中止信号
+	for {
+		c.mu.Lock()
+		done := c.handover.Phase.Terminal()
+		h := c.copyHandoverLocked()
+		c.mu.Unlock()
+		if done {
+			return h, nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// run 依次执行接管阶段
+func (c *Controller) run(ctx context.Context, id string, rehearsal bool) {
+	stoppedAccepting := false
+	fail := func(phase Phase, err error) {
+		if stoppedAccepting {
+			c.hooks.ResumeAccepting()
+		}
+		if errors.Is(err, context.Canceled) {
+			c.finish(id, rehearsal, PhaseAborted, "管理员中止")
+			return
+		}
+		c.finish(id, rehearsal, PhaseFailed, fmt.Sprintf("%s: %v", phase, err))
+	}
+
+	// 1. 同步：发布最新状态，等待热备应用
+	c.enterPhase(id, rehearsal, PhaseSyncing)
+	seq, err := c.Publish()
+	if err != nil {
+		fail(PhaseSyncing, err)
+		return
+	}
+	standbyRec, err := c.waitStandby(ctx, c.opts.SyncTimeout, func(r Record) bool { return r.AppliedSeq >= seq })
+	if err != nil {
+		fail(PhaseSyncing, err)
+		return
+	}
+	c.mu.Lock()
+	c.handover.Standby = standbyRec.InstanceID
+	c.mu.Unlock()
+
+	// 2. 停止接入：此后不再有新设备上线，交接状态只减不增
+	c.enterPhase(id, rehearsal, PhaseStopAccept)
+	c.hooks.StopAccepting()
+	stoppedAccepting = true
+
+	// 3. 激活：发布最终交接状态与激活信号，等待热备确认
+	c.enterPhase(id, rehearsal, PhaseActivating)
+	state := c.hooks.Export()
+	c.mu.Lock()
+	c.handover.Devices, c.handover.Orders, c.handover.Deferred = len(state.Devices), len(state.Orders), len(state.Deferred)
+	c.mu.Unlock()
+	if _, err := c.Publish(); err != nil {
+		fail(PhaseActivating, err)
+		return
+	}
+	if _, err := c.waitStandby(ctx, c.opts.ActivateTimeout, func(r Record) bool { return r.HandoverID == id && r.Ready }); err != nil {
+		fail(PhaseActivating, err)
+		return
+	}
+
+	// 4. 分批关闭连接：设备重连到已激活的热备
+	c.enterPhase(id, rehearsal, PhaseClosing)
+	conns := c.hooks.Connections()
+	sort.Slice(conns, func(i, j int) bool { return conns[i] < conns[j] })
+	c.mu.Lock()
+	c.handover.Connections = len(conns)
+	c.mu.Unlock()
+	for start := 0; start < len(conns); start += c.opts.CloseBatchSize {
+		if start > 0 {
+			select {
+			case <-ctx.Done():
+				fail(PhaseClosing, ctx.Err())
+				return
+			case <-time.After(c.opts.CloseBatchInterval):
+			}
+		}
+		end := start + c.opts.CloseBatchSize
+		if end > len(conns) {
+			end = len(conns)
+		}
+		closed := 0
+		if !rehearsal {
+			for _, connID := range conns[start:end] {
+				if c.hooks.CloseConnection(connID) {
+					closed++
+				}
+			}
+		}
+		c.mu.Lock()
+		c.handover.Batches++
+		c.handover.Closed += closed
+		c.mu.Unlock()
+	}
+
+	// 5. 完成：演练恢复接入；正式接管后主实例保持停止接入，等待维护
+	if rehearsal {
+		c.hooks.ResumeAccepting()
+	}
+	c.finish(id, rehearsal, PhaseCompleted, "")
+}
+
+// enterPhase 进入阶段：结束上一阶段计时并发布信号
+func (c *Controller) enterPhase(id string, rehearsal bool, phase Phase) {
+	c.mu.Lock()
+	now := c.now()
+	c.closePhaseLocked(now)
+	c.handover.Phase = phase
+	c.handover.Phases = append(c.handover.Phases, PhaseTiming{Phase: phase, StartedAt: now})
+	c.signal = &Signal{ID: id, Phase: phase, Rehearsal: rehearsal, StartedAt: c.handover.StartedAt}
+	c.mu.Unlock()
+	logger.WithFields(logrus.Fields{"handoverId": id, "phase": phase, "rehearsal": rehearsal}).Info("热备接管进入阶段")
+}
+
+func (c *Controller) closePhaseLocked(now time.Time) {
+	if n := len(c.handover.Phases); n > 0 {
+		last := &c.handover.Phases[n-1]
+		last.DurationMs = now.Sub(last.StartedAt).Milliseconds()
+	}
+}
+
+// finish 结束接管并发布最终信号
+func (c *Controller) finish(id string, rehearsal bool, phase Phase, reason string) {
+	c.mu.Lock()
+	now := c.now()
+	c.closePhaseLocked(now)
+	c.handover.Phase = phase
+	c.handover.Error = reason
+	c.handover.FinishedAt = &now
+	c.handover.DurationMs = now.Sub(c.handover.StartedAt).Milliseconds()
+	c.signal = &Signal{ID: id, Phase: phase, Rehearsal: rehearsal, StartedAt: c.handover.StartedAt}
+	c.counts[phase]++
+	h := c.copyHandoverLocked()
+	c.mu.Unlock()
+
+	if _, err := c.Publish(); err != nil {
+		logger.WithFields(logrus.Fields{"handoverId": id, "error": err.Error()}).Warn("发布接管结束信号失败")
+	}
+	fields := logrus.Fields{"handoverId": id, "phase": phase, "rehearsal": rehearsal, "durationMs": h.DurationMs, "closed": h.Closed, "batches": h.Batches}
+	if phase == PhaseCompleted {
+		logger.WithFields(fields).Info("✅ 热备接管完成")
+	} else {
+		fields["reason"] = reason
+		logger.WithFields(fields).Warn("⚠️ 热备接管未完成")
+	}
+}
+
+// waitStandby 轮询热备记录直到满足条件、超时或中止
+func (c *Controller) waitStandby(ctx context.Context, timeout time.Duration, cond func(Record) bool) (Record, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(c.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		records, err := c.records()
+		if err == nil {
+			for _, r := range records {
+				if r.Role != RoleStandby {
+					continue
+				}
+				c.setPeer(r)
+				if cond(r) {
+					return r, nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		case <-deadline.C:
+			return Record{}, fmt.Errorf("等待热备超时(%s)", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) copyHandoverLocked() Handover {
+	h := *c.handover
+	h.Phases = append([]PhaseTiming(nil), c.handover.Phases...)
+	return h
+}
+
+// ===============================
+// 热备实例：应用与激活
+// ===============================
+
+// Poll 读取主实例记录：未激活时应用最新交接状态，处理接管信号，并写入本实例的进度
+func (c *Controller) Poll() error {
+	if c.opts.Role != RoleStandby {
+		return nil
+	}
+	records, err := c.records()
+	if err != nil {
+		return err
+	}
+	var primary *Record
+	for i := range records {
+		if records[i].Role == RolePrimary && (primary == nil || records[i].PublishedAt.After(primary.PublishedAt)) {
+			primary = &records[i]
+		}
+	}
+	if primary != nil {
+		c.apply(*primary)
+	}
+
+	c.mu.Lock()
+	rec := Record{
+		InstanceID:  c.opts.InstanceID,
+		Role:        RoleStandby,
+		PublishedAt: c.now(),
+		AppliedSeq:  c.appliedSeq,
+		Active:      c.active,
+		HandoverID:  c.handoverID,
+		Ready:       c.ready,
+	}
+	c.mu.Unlock()
+	return c.put(rec)
+}
+
+func (c *Controller) apply(primary Record) {
+	c.mu.Lock()
+	c.setPeerLocked(primary)
+	if !c.active && primary.Registry != nil && primary.Seq > c.appliedSeq {
+		c.registry = primary.Registry
+		c.appliedSeq = primary.Seq
+		c.appliedAt = c.now()
+	}
+	signal := primary.Handover
+	if signal == nil {
+		c.mu.Unlock()
+		return
+	}
+	switch {
+	case signal.Phase == PhaseActivating && c.handoverID != signal.ID:
+		if signal.Rehearsal {
+			c.handoverID, c.ready = signal.ID, true
+			c.mu.Unlock()
+			logger.WithField("handoverId", signal.ID).Info("热备接管演练：确认可激活")
+			return
+		}
+		if c.registry == nil {
+			break
+		}
+		c.handoverID, c.ready = signal.ID, true
+		registry := *c.registry
+		c.active = true
+		c.activatedAt = c.now()
+		c.prior = make(map[string]gateway.HandoverDevice, len(registry.Devices))
+		for _, d := range registry.Devices {
+			c.prior[d.DeviceID] = d
+		}
+		c.mu.Unlock()
+
+		orders, deferred := c.hooks.Import(registry)
+		c.hooks.ResumeAccepting()
+		logger.WithFields(logrus.Fields{
+			"handoverId": signal.ID,
+			"devices":    len(registry.Devices),
+			"orders":     orders,
+			"deferred":   deferred,
+		}).Info("🔀 热备已激活，开始接入设备")
+		return
+	case (signal.Phase == PhaseAborted || signal.Phase == PhaseFailed) && c.handoverID == signal.ID && c.ready:
+		c.ready = false
+		wasActive := c.active
+		c.active = false
+		c.prior = nil
+		c.mu.Unlock()
+		if wasActive {
+			c.hooks.StopAccepting()
+		}
+		logger.WithFields(logrus.Fields{"handoverId": signal.ID, "phase": signal.Phase}).Warn("热备接管未完成，热备退回待命")
+		return
+	case signal.Phase == PhaseCompleted && signal.Rehearsal && c.handoverID == signal.ID:
+		c.ready = false
+	}
+	c.mu.Unlock()
+}
+
+// OnDeviceRegistered 激活后交接设备重新注册：延续交接前的统计并计入每分钟重新注册数
+func (c *Controller) OnDeviceRegistered(deviceID string) {
+	c.mu.Lock()
+	prior, ok := c.prior[deviceID]
+	if !c.active || !ok {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.prior, deviceID)
+	now := c.now()
+	c.reRegistered++
+	c.reRegisterTime = append(c.pruneReRegistrationsLocked(now), now)
+	c.mu.Unlock()
+	c.hooks.Restore(prior)
+}
+
+func (c *Controller) pruneReRegistrationsLocked(now time.Time) []time.Time {
+	cutoff := now.Add(-reRegistrationWindow)
+	i := 0
+	for i < len(c.reRegisterTime) && !c.reRegisterTime[i].After(cutoff) {
+		i++
+	}
+	c.reRegisterTime = c.reRegisterTime[i:]
+	return c.reRegisterTime
+}
+
+// ===============================
+// 状态与存储
+// ===============================
+
+// Status 当前状态
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Status{InstanceID: c.opts.InstanceID, Role: c.opts.Role, Seq: c.seq, AppliedSeq: c.appliedSeq, Active: c.active}
+	if c.handover != nil {
+		h := c.copyHandoverLocked()
+		s.Handover = &h
+	}
+	if c.peer != nil {
+		peer := *c.peer
+		s.Peer = &peer
+	}
+	if !c.appliedAt.IsZero() {
+		t := c.appliedAt
+		s.AppliedAt = &t
+	}
+	if !c.activatedAt.IsZero() {
+		t := c.activatedAt
+		s.ActivatedAt = &t
+	}
+	if c.registry != nil {
+		s.ReplicatedDevices = len(c.registry.Devices)
+	}
+	s.PendingReRegister = len(c.prior)
+	s.ReRegistered = c.reRegistered
+	s.ReRegisteredPerMin = len(c.pruneReRegistrationsLocked(c.now()))
+	return s
+}
+
+func (c *Controller) setPeer(r Record) {
+	c.mu.Lock()
+	c.setPeerLocked(r)
+	c.mu.Unlock()
+}
+
+// setPeerLocked 记录对端（不保留交接状态本身）
+func (c *Controller) setPeerLocked(r Record) {
+	r.Registry = nil
+	c.peer = &r
+}
+
+func (c *Controller) put(rec Record) error {
+	data, err := persistence.Encode(RecordType, rec)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	return c.opts.Store.Put(ctx, c.opts.InstanceID, data)
+}
+
+// records 读取其他实例的记录
+func (c *Controller) records() ([]Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	all, err := c.opts.Store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(all))
+	for instanceID, data := range all {
+		if instanceID == c.opts.InstanceID {
+			continue
+		}
+		var rec Record
+		if _, err := persistence.Decode(RecordType, data, &rec); err != nil {
+			logger.WithFields(logrus.Fields{"instanceId": instanceID, "error": err.Error()}).Warn("跳过无法解析的热备记录")
+			continue
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].InstanceID < records[j].InstanceID })
+	return records, nil
+}
@@ -0,0 +1,327 @@
+package statedump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+)
+
+// maxArchiveEntryBytes 读取归档时单个分段的大小上限（防止损坏或伪造的归档耗尽内存）
+const maxArchiveEntryBytes = 1 << 30
+
+// 离线时间线条目来源
+const (
+	TimelineSourceSession = "session"
+	TimelineSourceCommand = "command"
+	TimelineSourceEvent   = "event_bus"
+
+	timelineTypeConnection = "connection"
+	timelineTypeCommand    = "command"
+)
+
+// Archive 已加载的转储归档
+type Archive struct {
+	Path     string
+	Manifest Manifest
+	files    map[string][]byte
+}
+
+// Open 加载转储归档
+func Open(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("不是有效的转储归档: %w", err)
+	}
+	defer gz.Close()
+
+	a := &Archive{Path: path, files: make(map[string][]byte)}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取转储归档失败: %w", err)
+		}
+		if hdr.Size > maxArchiveEntryBytes {
+			return nil, fmt.Errorf("归档分段 %s 过大: %d 字节", hdr.Name, hdr.Size)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("读取归档分段 %s 失败: %w", hdr.Name, err)
+		}
+		a.files[hdr.Name] = data
+	}
+	raw, ok := a.files[manifestFile]
+	if !ok {
+		return nil, fmt.Errorf("归档缺少 %s（转储未完成？）", manifestFile)
+	}
+	if err := json.Unmarshal(raw, &a.Manifest); err != nil {
+		return nil, fmt.Errorf("解析归档清单失败: %w", err)
+	}
+	if a.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("归档格式版本 %d 高于本工具支持的 %d", a.Manifest.FormatVersion, FormatVersion)
+	}
+	return a, nil
+}
+
+// File 分段原始内容（如 goroutine.txt、heap.pprof）
+func (a *Archive) File(section string) ([]byte, bool) {
+	for _, s := range a.Manifest.Sections {
+		if s.Name == section {
+			data, ok := a.files[s.File]
+			return data, ok
+		}
+	}
+	return nil, false
+}
+
+func (a *Archive) decode(section string, v interface{}) error {
+	data, ok := a.File(section)
+	if !ok {
+		return fmt.Errorf("归档中没有 %s 分段", section)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Devices 在线设备（按设备ID排序）
+func (a *Archive) Devices() ([]DeviceRecord, error) {
+	var devices []DeviceRecord
+	return devices, a.decode(SectionDevices, &devices)
+}
+
+// Sessions 连接会话
+func (a *Archive) Sessions() ([]SessionRecord, error) {
+	var sessions []SessionRecord
+	return sessions, a.decode(SectionSessions, &sessions)
+}
+
+// Commands 跟踪中的下发命令
+func (a *Archive) Commands() ([]CommandRecord, error) {
+	var commands []CommandRecord
+	return commands, a.decode(SectionCommands, &commands)
+}
+
+// Events 最近的总线事件（旧→新）
+func (a *Archive) Events() ([]events.Event, error) {
+	var evs []events.Event
+	return evs, a.decode(SectionEvents, &evs)
+}
+
+// Stats 统计
+func (a *Archive) Stats() (map[string]interface{}, error) {
+	var stats map[string]interface{}
+	return stats, a.decode(SectionStats, &stats)
+}
+
+// Config 脱敏后的配置
+func (a *Archive) Config() (map[string]interface{}, error) {
+	var cfg map[string]interface{}
+	return cfg, a.decode(SectionConfig, &cfg)
+}
+
+// Timeline 按时间合并归档中与设备相关的连接会话、待应答命令与总线事件（旧→新）；缺失的分段跳过
+func (a *Archive) Timeline(deviceID string) []TimelineEntry {
+	var entries []TimelineEntry
+	if sessions, err := a.Sessions(); err == nil {
+		for _, s := range sessions {
+			if s.DeviceID != deviceID {
+				continue
+			}
+			data := map[string]interface{}{"conn_id": s.ConnID, "remote_addr": s.RemoteAddr, "state": s.State}
+			entries = append(entries,
+				TimelineEntry{Timestamp: s.ConnectedAt, Source: TimelineSourceSession, Type: timelineTypeConnection,
+					Summary: fmt.Sprintf("连接建立 %s（连接%d）", s.RemoteAddr, s.ConnID), RefID: s.SessionID, Data: data},
+				TimelineEntry{Timestamp: s.LastActivity, Source: TimelineSourceSession, Type: timelineTypeConnection,
+					Summary: fmt.Sprintf("最后活动（状态 %s）", s.State), RefID: s.SessionID + "-last"},
+			)
+		}
+	}
+	if commands, err := a.Commands(); err == nil {
+		for _, c := range commands {
+			if c.DeviceID != deviceID {
+				continue
+			}
+			entries = append(entries, TimelineEntry{
+				Timestamp: c.CreateTime,
+				Source:    TimelineSourceCommand,
+				Type:      timelineTypeCommand,
+				Summary:   fmt.Sprintf("下发 %s：%s（重试%d次）", c.CommandLabel, c.Status, c.RetryCount),
+				RefID:     fmt.Sprintf("%d-%04X-%02X", c.ConnID, c.MessageID, c.Command),
+				Data:      map[string]interface{}{"message_id": fmt.Sprintf("0x%04X", c.MessageID), "last_error": c.LastError},
+			})
+		}
+	}
+	if evs, err := a.Events(); err == nil {
+		for _, ev := range evs {
+			if ev.DeviceID != deviceID {
+				continue
+			}
+			data, _ := ev.Payload.(map[string]interface{})
+			entries = append(entries, TimelineEntry{
+				Timestamp: ev.Time,
+				Source:    TimelineSourceEvent,
+				Type:      string(ev.Topic),
+				Summary:   ev.Type,
+				RefID:     strconv.FormatUint(ev.Seq, 10),
+				Data:      data,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Timestamp.Before(entries[j].Timestamp) })
+	return entries
+}
+
+// ValueDiff 同一键在两份转储中的取值
+type ValueDiff struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DeviceDiff 两份转储中都在线的设备的变化
+type DeviceDiff struct {
+	DeviceID string      `json:"deviceId"`
+	Fields   []ValueDiff `json:"fields,omitempty"` // 详情顶层标量字段
+	Ports    []ValueDiff `json:"ports,omitempty"`  // 端口状态（键为端口号）
+}
+
+// DiffReport 两份转储的差异
+type DiffReport struct {
+	From           string       `json:"from"`
+	To             string       `json:"to"`
+	DevicesAdded   []string     `json:"devicesAdded"`
+	DevicesRemoved []string     `json:"devicesRemoved"`
+	DevicesChanged []DeviceDiff `json:"devicesChanged"`
+	Commands       ValueDiff    `json:"commands"`        // 跟踪中的命令数
+	PendingChanged []ValueDiff  `json:"pendingByDevice"` // 各设备跟踪中的命令数变化
+	Stats          []ValueDiff  `json:"stats"`
+	Config         []ValueDiff  `json:"config"`
+}
+
+// Diff 比较两份转储（from 较早）
+func Diff(from, to *Archive) DiffReport {
+	report := DiffReport{From: from.Path, To: to.Path}
+
+	fromDevices, _ := from.Devices()
+	toDevices, _ := to.Devices()
+	before := make(map[string]DeviceRecord, len(fromDevices))
+	for _, d := range fromDevices {
+		before[d.DeviceID] = d
+	}
+	seen := make(map[string]bool, len(toDevices))
+	for _, d := range toDevices {
+		seen[d.DeviceID] = true
+		prev, ok := before[d.DeviceID]
+		if !ok {
+			report.DevicesAdded = append(report.DevicesAdded, d.DeviceID)
+			continue
+		}
+		if dd := diffDevice(prev, d); len(dd.Fields) > 0 || len(dd.Ports) > 0 {
+			report.DevicesChanged = append(report.DevicesChanged, dd)
+		}
+	}
+	for _, d := range fromDevices {
+		if !seen[d.DeviceID] {
+			report.DevicesRemoved = append(report.DevicesRemoved, d.DeviceID)
+		}
+	}
+
+	fromCommands, _ := from.Commands()
+	toCommands, _ := to.Commands()
+	report.Commands = ValueDiff{Key: "commands", From: len(fromCommands), To: len(toCommands)}
+	report.PendingChanged = diffFlat(countByDevice(fromCommands), countByDevice(toCommands))
+
+	fromStats, _ := from.Stats()
+	toStats, _ := to.Stats()
+	report.Stats = diffFlat(flatten("", fromStats), flatten("", toStats))
+	fromConfig, _ := from.Config()
+	toConfig, _ := to.Config()
+	report.Config = diffFlat(flatten("", fromConfig), flatten("", toConfig))
+	return report
+}
+
+func diffDevice(from, to DeviceRecord) DeviceDiff {
+	dd := DeviceDiff{DeviceID: to.DeviceID}
+	scalars := func(m map[string]interface{}) map[string]interface{} {
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+			default:
+				out[k] = v
+			}
+		}
+		return out
+	}
+	dd.Fields = diffFlat(scalars(from.Detail), scalars(to.Detail))
+	ports := func(list []PortRecord) map[string]interface{} {
+		out := make(map[string]interface{}, len(list))
+		for _, p := range list {
+			out[strconv.Itoa(p.Port)] = p
+		}
+		return out
+	}
+	dd.Ports = diffFlat(ports(from.Ports), ports(to.Ports))
+	return dd
+}
+
+func countByDevice(commands []CommandRecord) map[string]interface{} {
+	counts := make(map[string]interface{})
+	for _, c := range commands {
+		n, _ := counts[c.DeviceID].(int)
+		counts[c.DeviceID] = n + 1
+	}
+	return counts
+}
+
+// flatten 嵌套map展开为 a.b.c 形式的键（数组按整体比较）
+func flatten(prefix string, m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if child, ok := v.(map[string]interface{}); ok {
+			for ck, cv := range flatten(key, child) {
+				out[ck] = cv
+			}
+			continue
+		}
+		out[key] = v
+	}
+	return out
+}
+
+// diffFlat 比较两个扁平map，返回取值不同或只在一侧存在的键（按键排序）
+func diffFlat(from, to map[string]interface{}) []ValueDiff {
+	var diffs []ValueDiff
+	for k, fv := range from {
+		tv, ok := to[k]
+		if !ok || !reflect.DeepEqual(fv, tv) {
+			diffs = append(diffs, ValueDiff{Key: k, From: fv, To: tv})
+		}
+	}
+	for k, tv := range to {
+		if _, ok := from[k]; !ok {
+			diffs = append(diffs, ValueDiff{Key: k, To: tv})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return diffs
+}
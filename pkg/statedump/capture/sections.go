@@ -0,0 +1,164 @@
+// Package capture 状态转储的分段采集：从设备网关、TCP管理器、命令管理器与事件总线的快照接口复制数据。
+// 与归档格式（pkg/statedump）分开，离线分析工具只依赖后者
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump"
+	"github.com/bujia-iot/iot-zinx/pkg/tracesample"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+const defaultEventLimit = 5000
+
+// Sections 读取全局组件的分段：eventLimit 为转储的最近事件数上限
+func Sections(eventLimit int) []statedump.Section {
+	if eventLimit <= 0 {
+		eventLimit = defaultEventLimit
+	}
+	return []statedump.Section{
+		{Name: statedump.SectionDevices, File: "devices.json", Capture: captureDevices},
+		{Name: statedump.SectionSessions, File: "sessions.json", Capture: captureSessions},
+		{Name: statedump.SectionCommands, File: "commands.json", Capture: captureCommands},
+		{Name: statedump.SectionEvents, File: "events.json", Capture: func() (interface{}, error) {
+			return events.GetGlobalBus().Recent(eventLimit), nil
+		}},
+		{Name: statedump.SectionStats, File: "stats.json", Capture: captureStats},
+		{Name: statedump.SectionConfig, File: "config.json", Capture: func() (interface{}, error) {
+			return statedump.RedactedConfig(config.GetConfig())
+		}},
+		{Name: statedump.SectionGoroutine, File: "goroutine.txt", Capture: func() (interface{}, error) {
+			return lookupProfile("goroutine", 1)
+		}},
+		{Name: statedump.SectionHeap, File: "heap.pprof", Capture: func() (interface{}, error) {
+			return lookupProfile("heap", 0)
+		}},
+	}
+}
+
+// captureDevices 在线设备详情（经详情缓存）与端口状态；逐设备读取，不持有全局锁
+func captureDevices() (interface{}, error) {
+	g := gateway.GetGlobalDeviceGateway()
+	if g == nil {
+		return nil, fmt.Errorf("设备网关未初始化")
+	}
+	online := g.GetAllOnlineDevices()
+	sort.Strings(online)
+	devices := make([]statedump.DeviceRecord, 0, len(online))
+	for _, deviceID := range online {
+		detail, err := g.GetDeviceDetail(deviceID)
+		if err != nil {
+			continue // 采集期间断开
+		}
+		status := g.GetDevicePortStatus(deviceID)
+		ports := make([]statedump.PortRecord, 0, len(status))
+		for _, p := range status {
+			ports = append(ports, statedump.PortRecord(p))
+		}
+		devices = append(devices, statedump.DeviceRecord{DeviceID: deviceID, Detail: detail, Ports: ports})
+	}
+	return devices, nil
+}
+
+func captureSessions() (interface{}, error) {
+	sessions := core.GetGlobalTCPManager().GetAllSessions()
+	records := make([]statedump.SessionRecord, 0, len(sessions))
+	for deviceID, s := range sessions {
+		health := s.GetSendHealth()
+		records = append(records, statedump.SessionRecord{
+			DeviceID:                deviceID,
+			SessionID:               s.SessionID,
+			ConnID:                  s.ConnID,
+			RemoteAddr:              s.RemoteAddr,
+			State:                   string(s.GetState()),
+			ConnectedAt:             s.ConnectedAt,
+			LastActivity:            s.GetLastActivity(),
+			SendFailures:            health.SendFailures,
+			ConsecutiveSendFailures: health.ConsecutiveSendFailures,
+			LastSendError:           health.LastSendError,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].DeviceID < records[j].DeviceID })
+	return records, nil
+}
+
+func captureCommands() (interface{}, error) {
+	cm := network.GetCommandManager()
+	if cm == nil {
+		return nil, fmt.Errorf("命令管理器未初始化")
+	}
+	entries := cm.GetAllCommands()
+	records := make([]statedump.CommandRecord, 0, len(entries))
+	for _, e := range entries {
+		records = append(records, statedump.CommandRecord{
+			DeviceID:      utils.FormatPhysicalID(e.PhysicalID),
+			ConnID:        e.ConnID,
+			MessageID:     e.MessageID,
+			Command:       e.Command,
+			CommandLabel:  dny_protocol.CommandLabel(e.Command),
+			Status:        string(e.Status),
+			Confirmed:     e.Confirmed,
+			RetryCount:    e.RetryCount,
+			CreateTime:    e.CreateTime,
+			LastSentTime:  e.LastSentTime,
+			LastError:     e.LastError,
+			CorrelationID: e.CorrelationID,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreateTime.Before(records[j].CreateTime) })
+	return records, nil
+}
+
+// captureStats 与 GET /api/v1/stats 相同来源的统计，另附TCP管理器、事件总线、协议会话抽样与运行时指标
+func captureStats() (interface{}, error) {
+	g := gateway.GetGlobalDeviceGateway()
+	if g == nil {
+		return nil, fmt.Errorf("设备网关未初始化")
+	}
+	stats := g.GetDeviceStatistics()
+	stats["handler_panics"] = handlerguard.GetGlobalGuard().Stats()
+	stats["device_detail_cache"] = g.GetDetailCache().Stats()
+	stats["tcp_manager"] = core.GetGlobalTCPManager().GetStats()
+	stats["event_bus"] = events.GetGlobalBus().Stats()
+	if sampler := tracesample.GetGlobalSampler(); sampler != nil {
+		stats["trace_sampling"] = sampler.Status()
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats["runtime"] = map[string]interface{}{
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     mem.HeapAlloc,
+		"heap_inuse":     mem.HeapInuse,
+		"heap_objects":   mem.HeapObjects,
+		"sys":            mem.Sys,
+		"num_gc":         mem.NumGC,
+		"gc_pause_total": time.Duration(mem.PauseTotalNs).String(),
+	}
+	return stats, nil
+}
+
+func lookupProfile(name string, debug int) ([]byte, error) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		return nil, fmt.Errorf("剖析 %s 不可用", name)
+	}
+	var buf bytes.Buffer
+	if err := p.WriteTo(&buf, debug); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
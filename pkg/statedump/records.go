@@ -0,0 +1,131 @@
+package statedump
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// 分段名称
+const (
+	SectionDevices   = "devices"
+	SectionSessions  = "sessions"
+	SectionCommands  = "commands"
+	SectionEvents    = "events"
+	SectionStats     = "stats"
+	SectionConfig    = "config"
+	SectionGoroutine = "goroutine"
+	SectionHeap      = "heap"
+)
+
+const redactedValue = "***"
+
+// redactKeys 配置中需脱敏的字段名片段（不区分大小写）
+var redactKeys = []string{"password", "secret", "token", "credential"}
+
+// 归档中的记录类型与网关内部结构解耦，离线分析工具无需引入网关运行时
+
+// DeviceRecord 在线设备：详情与端口状态
+type DeviceRecord struct {
+	DeviceID string                 `json:"deviceId"`
+	Detail   map[string]interface{} `json:"detail"`
+	Ports    []PortRecord           `json:"ports"`
+}
+
+// PortRecord 端口状态（同 gateway.DevicePortStatus）
+type PortRecord struct {
+	Port        int        `json:"port"`
+	Status      uint8      `json:"status"`
+	State       string     `json:"state,omitempty"`
+	PowerW      float64    `json:"powerW"`
+	VoltageV    float64    `json:"voltageV,omitempty"`
+	EnergyWh    uint32     `json:"energyWh"`
+	LastUpdate  *time.Time `json:"lastUpdate,omitempty"`
+	Stale       bool       `json:"stale"`
+	Reported    bool       `json:"reported"`
+	OrderNo     string     `json:"orderNo,omitempty"`
+	OrderStatus string     `json:"orderStatus,omitempty"`
+}
+
+// SessionRecord 设备所在的连接会话
+type SessionRecord struct {
+	DeviceID                string    `json:"deviceId"`
+	SessionID               string    `json:"sessionId"`
+	ConnID                  uint64    `json:"connId"`
+	RemoteAddr              string    `json:"remoteAddr"`
+	State                   string    `json:"state"`
+	ConnectedAt             time.Time `json:"connectedAt"`
+	LastActivity            time.Time `json:"lastActivity"`
+	SendFailures            int64     `json:"sendFailures"`
+	ConsecutiveSendFailures int64     `json:"consecutiveSendFailures"`
+	LastSendError           string    `json:"lastSendError,omitempty"`
+}
+
+// CommandRecord 跟踪中的下发命令
+type CommandRecord struct {
+	DeviceID      string    `json:"deviceId"`
+	ConnID        uint64    `json:"connId"`
+	MessageID     uint16    `json:"messageId"`
+	Command       uint8     `json:"command"`
+	CommandLabel  string    `json:"commandLabel"`
+	Status        string    `json:"status"`
+	Confirmed     bool      `json:"confirmed"`
+	RetryCount    int       `json:"retryCount"`
+	CreateTime    time.Time `json:"createTime"`
+	LastSentTime  time.Time `json:"lastSentTime"`
+	LastError     string    `json:"lastError,omitempty"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+}
+
+// TimelineEntry 离线设备时间线条目（字段同 gateway.TimelineEntry）
+type TimelineEntry struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Source    string                 `json:"source"`
+	Type      string                 `json:"type"`
+	Summary   string                 `json:"summary"`
+	RefID     string                 `json:"ref_id"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// RedactedConfig 配置的JSON副本，字段名含 password/secret/token/credential 的非空值替换为 ***
+func RedactedConfig(cfg interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	redactMap(m)
+	return m, nil
+}
+
+func redactMap(m map[string]interface{}) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			redactMap(val)
+		case []interface{}:
+			for _, item := range val {
+				if child, ok := item.(map[string]interface{}); ok {
+					redactMap(child)
+				}
+			}
+		case string:
+			if val != "" && isSensitiveKey(k) {
+				m[k] = redactedValue
+			}
+		}
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range redactKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,370 @@
+// Package statedump 事故现场状态转储：在重启进程之前把网关内存状态（设备注册表、连接会话、待应答命令、端口状态、
+// 最近总线事件、统计、脱敏配置）与 goroutine/heap 剖析打包为一个 .tar.gz 归档，供 cmd/statedump-inspect 离线分析。
+//
+// 转储分两个阶段：先逐分段从各组件的快照接口复制数据（分段采集见 capture 子包，每个组件只在复制时短暂持有自己的锁），
+// 再在不持有任何网关锁的情况下序列化并压缩写盘。清单 manifest.json 记录每个分段两个阶段的耗时。
+package statedump
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// FormatVersion 归档格式版本
+const FormatVersion = 1
+
+const (
+	manifestFile    = "manifest.json"
+	archivePrefix   = "statedump-"
+	archiveSuffix   = ".tar.gz"
+	defaultDir      = "./data/statedump"
+	defaultMaxBytes = 64 << 20
+	defaultMaxDumps = 10
+)
+
+// ErrDumpRunning 已有转储正在执行
+var ErrDumpRunning = errors.New("已有状态转储正在执行")
+
+// Section 归档中的一个分段：Capture 返回数据副本（[]byte 原样写入，其余按JSON序列化）
+type Section struct {
+	Name    string
+	File    string
+	Capture func() (interface{}, error)
+}
+
+// SectionReport 分段的采集结果与耗时
+type SectionReport struct {
+	Name      string  `json:"name"`
+	File      string  `json:"file"`
+	CaptureMs float64 `json:"captureMs"` // 从组件复制数据的耗时（该组件的锁只在此阶段持有）
+	WriteMs   float64 `json:"writeMs"`   // 序列化与压缩写盘的耗时（不持有网关锁）
+	Bytes     int64   `json:"bytes"`     // 未压缩字节数
+	Skipped   bool    `json:"skipped,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Manifest 归档清单
+type Manifest struct {
+	FormatVersion int             `json:"formatVersion"`
+	Hostname      string          `json:"hostname"`
+	PID           int             `json:"pid"`
+	GoVersion     string          `json:"goVersion"`
+	Reason        string          `json:"reason"` // api / signal
+	CreatedAt     time.Time       `json:"createdAt"`
+	CaptureMs     float64         `json:"captureMs"` // 采集阶段总耗时
+	TotalMs       float64         `json:"totalMs"`
+	Truncated     bool            `json:"truncated,omitempty"` // 超出大小上限，部分分段被跳过
+	Sections      []SectionReport `json:"sections"`
+}
+
+// Result 一次转储的结果
+type Result struct {
+	Path     string   `json:"path"`
+	Bytes    int64    `json:"bytes"` // 归档（压缩后）大小
+	Manifest Manifest `json:"manifest"`
+	Removed  []string `json:"removed,omitempty"` // 按保留策略清理的旧归档
+}
+
+// Options 转储选项
+type Options struct {
+	Dir      string        // 归档输出目录
+	MaxBytes int64         // 单个归档大小上限，超出后跳过剩余分段
+	MaxDumps int           // 保留的归档数上限
+	MaxAge   time.Duration // 归档保留时长，0表示不按时间清理
+}
+
+// Dumper 状态转储器；同一时刻只执行一次转储
+type Dumper struct {
+	opts     Options
+	sections []Section
+	running  atomic.Bool
+	now      func() time.Time
+}
+
+// New 创建状态转储器
+func New(opts Options, sections []Section) *Dumper {
+	if opts.Dir == "" {
+		opts.Dir = defaultDir
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.MaxDumps <= 0 {
+		opts.MaxDumps = defaultMaxDumps
+	}
+	return &Dumper{opts: opts, sections: sections, now: time.Now}
+}
+
+// Options 当前生效的选项
+func (d *Dumper) Options() Options {
+	return d.opts
+}
+
+// Dump 采集各分段并写入新归档，随后按保留策略清理旧归档
+func (d *Dumper) Dump(reason string) (*Result, error) {
+	if !d.running.CompareAndSwap(false, true) {
+		return nil, ErrDumpRunning
+	}
+	defer d.running.Store(false)
+
+	start := d.now()
+	hostname, _ := os.Hostname()
+	manifest := Manifest{
+		FormatVersion: FormatVersion,
+		Hostname:      hostname,
+		PID:           os.Getpid(),
+		GoVersion:     runtime.Version(),
+		Reason:        reason,
+		CreatedAt:     start,
+		Sections:      make([]SectionReport, len(d.sections)),
+	}
+
+	// 阶段一：逐分段复制
+	captured := make([]interface{}, len(d.sections))
+	for i, sec := range d.sections {
+		t := time.Now()
+		data, err := capture(sec)
+		manifest.Sections[i] = SectionReport{Name: sec.Name, File: sec.File, CaptureMs: elapsedMs(t)}
+		if err != nil {
+			manifest.Sections[i].Error = err.Error()
+			continue
+		}
+		captured[i] = data
+	}
+	manifest.CaptureMs = elapsedMs(start)
+
+	// 阶段二：序列化与压缩写盘
+	if err := os.MkdirAll(d.opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建转储目录失败: %w", err)
+	}
+	name := archivePrefix + start.Format("20060102-150405.000") + archiveSuffix
+	path := filepath.Join(d.opts.Dir, name)
+	size, err := d.writeArchive(path+".tmp", &manifest, captured, start)
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return nil, fmt.Errorf("保存转储归档失败: %w", err)
+	}
+
+	result := &Result{Path: path, Bytes: size, Manifest: manifest, Removed: d.cleanup(name)}
+	logger.WithFields(logrus.Fields{
+		"path":      path,
+		"bytes":     size,
+		"reason":    reason,
+		"captureMs": manifest.CaptureMs,
+		"totalMs":   manifest.TotalMs,
+		"truncated": manifest.Truncated,
+		"removed":   len(result.Removed),
+	}).Info("状态转储完成")
+	return result, nil
+}
+
+// capture 采集单个分段，分段panic不影响其余分段
+func capture(sec Section) (data interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("采集panic: %v", r)
+		}
+	}()
+	return sec.Capture()
+}
+
+func (d *Dumper) writeArchive(path string, manifest *Manifest, captured []interface{}, start time.Time) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("创建转储归档失败: %w", err)
+	}
+	defer f.Close()
+	counter := &countingWriter{w: f}
+	gz := gzip.NewWriter(counter)
+	tw := tar.NewWriter(gz)
+
+	for i, data := range captured {
+		report := &manifest.Sections[i]
+		if data == nil {
+			continue
+		}
+		if counter.n >= d.opts.MaxBytes {
+			report.Skipped = true
+			report.Error = fmt.Sprintf("归档已达大小上限 %d 字节", d.opts.MaxBytes)
+			manifest.Truncated = true
+			continue
+		}
+		t := time.Now()
+		raw, ok := data.([]byte)
+		if !ok {
+			if raw, err = json.Marshal(data); err != nil {
+				report.Error = "序列化失败: " + err.Error()
+				continue
+			}
+		}
+		if err := writeEntry(tw, report.File, raw, start); err != nil {
+			return 0, err
+		}
+		// 每个分段后刷新压缩流，按已写出的压缩字节判断大小上限
+		if err := tw.Flush(); err != nil {
+			return 0, err
+		}
+		if err := gz.Flush(); err != nil {
+			return 0, err
+		}
+		report.Bytes = int64(len(raw))
+		report.WriteMs = elapsedMs(t)
+	}
+
+	manifest.TotalMs = elapsedMs(start)
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := writeEntry(tw, manifestFile, raw, start); err != nil {
+		return 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return fmt.Errorf("写入归档分段 %s 失败: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("写入归档分段 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// cleanup 删除超出数量上限或保留时长的旧归档（不含刚写入的 current），返回删除的文件名
+func (d *Dumper) cleanup(current string) []string {
+	dumps, err := List(d.opts.Dir)
+	if err != nil {
+		return nil
+	}
+	var removed []string
+	now := d.now()
+	kept := 0
+	for _, dump := range dumps { // 新→旧
+		expired := d.opts.MaxAge > 0 && now.Sub(dump.ModTime) > d.opts.MaxAge
+		if dump.Name == current || (!expired && kept < d.opts.MaxDumps-1) {
+			if dump.Name != current {
+				kept++
+			}
+			continue
+		}
+		if err := os.Remove(filepath.Join(d.opts.Dir, dump.Name)); err == nil {
+			removed = append(removed, dump.Name)
+		}
+	}
+	return removed
+}
+
+// DumpFile 目录中的转储归档
+type DumpFile struct {
+	Name    string    `json:"name"`
+	Bytes   int64     `json:"bytes"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// List 目录中的转储归档（新→旧）
+func List(dir string) ([]DumpFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dumps []DumpFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), archivePrefix) || !strings.HasSuffix(e.Name(), archiveSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		dumps = append(dumps, DumpFile{Name: e.Name(), Bytes: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(dumps, func(i, j int) bool {
+		if !dumps[i].ModTime.Equal(dumps[j].ModTime) {
+			return dumps[i].ModTime.After(dumps[j].ModTime)
+		}
+		return dumps[i].Name > dumps[j].Name
+	})
+	return dumps, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func elapsedMs(since time.Time) float64 {
+	return float64(time.Since(since).Microseconds()) / 1000
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalDumper atomic.Pointer[Dumper]
+
+// GetGlobalDumper 获取全局状态转储器（未初始化时返回nil）
+func GetGlobalDumper() *Dumper {
+	return globalDumper.Load()
+}
+
+// InitGlobalDumper 按配置创建全局状态转储器（已存在时直接返回）
+func InitGlobalDumper(sections []Section) *Dumper {
+	if d := globalDumper.Load(); d != nil {
+		return d
+	}
+	cfg := config.GetConfig().StateDump
+	d := New(Options{
+		Dir:      cfg.Dir,
+		MaxBytes: cfg.MaxBytes,
+		MaxDumps: cfg.MaxDumps,
+		MaxAge:   time.Duration(cfg.MaxAgeHours) * time.Hour,
+	}, sections)
+	if !globalDumper.CompareAndSwap(nil, d) {
+		return globalDumper.Load()
+	}
+	return d
+}
+
+// SetGlobalDumper 替换全局状态转储器（测试使用）
+func SetGlobalDumper(d *Dumper) {
+	globalDumper.Store(d)
+}
@@ -0,0 +1,505 @@
+// Package tracesample 协议会话抽样跟踪：新连接接入时按比例抽样（关注名单中的设备ID/ICCID在身份确定后强制抽样），
+// 被抽样连接从接入到断开的全部收发字节连同解码结果注释写入跟踪文件，文件格式与通信日志导出的二进制抓包格式相同
+// （注释为方向3的记录），现有分析工具可直接读取。跟踪文件按大小轮转，目录总大小严格受限：写入前预留空间，
+// 超出时从最早的已结束文件开始删除，仍不足时丢弃该条记录并计数。未抽样的连接在收发路径上只多一次判空。
+package tracesample
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/sirupsen/logrus"
+)
+
+// 默认参数
+const (
+	defaultDir           = "./data/traces"
+	defaultMaxFileBytes  = 8 << 20
+	defaultMaxTotalBytes = 512 << 20
+	defaultMaxActive     = 200
+	defaultFlushInterval = time.Second
+	filePrefix           = "trace-"
+	fileSuffix           = ".dnyc"
+	fileTimeLayout       = "20060102T150405"
+)
+
+// 抽样原因
+const (
+	ReasonRate  = "rate"
+	ReasonWatch = "watch"
+)
+
+// ErrInvalidRate 抽样比例不在 [0,1] 内
+var ErrInvalidRate = errors.New("抽样比例须在0到1之间")
+
+// Options 抽样选项
+type Options struct {
+	Dir            string
+	Rate           float64 // 新连接的抽样比例 [0,1]
+	WatchDeviceIDs []string
+	WatchICCIDs    []string
+	MaxFileBytes   int64 // 单个跟踪文件大小上限，超过后轮转到下一分段
+	MaxTotalBytes  int64 // 跟踪目录总大小上限
+	MaxActive      int   // 同时抽样的连接数上限（关注名单不受限）
+	FlushInterval  time.Duration
+}
+
+// watchList 关注名单
+type watchList struct {
+	devices map[string]struct{}
+	iccids  map[string]struct{}
+}
+
+func newWatchList(deviceIDs, iccids []string) *watchList {
+	w := &watchList{devices: make(map[string]struct{}), iccids: make(map[string]struct{})}
+	for _, id := range deviceIDs {
+		if id = strings.ToUpper(strings.TrimSpace(id)); id != "" {
+			w.devices[id] = struct{}{}
+		}
+	}
+	for _, iccid := range iccids {
+		if iccid = strings.TrimSpace(iccid); iccid != "" {
+			w.iccids[iccid] = struct{}{}
+		}
+	}
+	return w
+}
+
+func (w *watchList) match(iccid, deviceID string) (string, bool) {
+	if _, ok := w.devices[strings.ToUpper(deviceID)]; ok && deviceID != "" {
+		return "deviceId=" + deviceID, true
+	}
+	if _, ok := w.iccids[iccid]; ok && iccid != "" {
+		return "iccid=" + iccid, true
+	}
+	return "", false
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// traceFile 已结束写入的跟踪文件（按结束顺序，最早的在前）
+type traceFile struct {
+	path string
+	size int64
+}
+
+// Sampler 协议会话抽样
+type Sampler struct {
+	opts  Options
+	rate  atomic.Uint64 // math.Float64bits
+	watch atomic.Pointer[watchList]
+
+	mu         sync.Mutex
+	active     map[uint64]*Trace
+	files      []traceFile
+	totalBytes int64
+	seq        uint64
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	sampled        atomic.Uint64
+	forced         atomic.Uint64
+	skippedLimit   atomic.Uint64
+	droppedRecords atomic.Uint64
+	deletedFiles   atomic.Uint64
+	writeErrors    atomic.Uint64
+}
+
+// New 创建抽样：统计目录中已有的跟踪文件（计入总大小上限，最早的先删除）
+func New(opts Options) (*Sampler, error) {
+	if opts.Dir == "" {
+		opts.Dir = defaultDir
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = defaultMaxFileBytes
+	}
+	if opts.MaxTotalBytes <= 0 {
+		opts.MaxTotalBytes = defaultMaxTotalBytes
+	}
+	if opts.MaxFileBytes > opts.MaxTotalBytes {
+		opts.MaxFileBytes = opts.MaxTotalBytes
+	}
+	if opts.MaxActive <= 0 {
+		opts.MaxActive = defaultMaxActive
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建跟踪目录失败: %w", err)
+	}
+	s := &Sampler{opts: opts, active: make(map[uint64]*Trace)}
+	if err := s.SetRate(opts.Rate); err != nil {
+		return nil, err
+	}
+	s.SetWatchList(opts.WatchDeviceIDs, opts.WatchICCIDs)
+	if err := s.scanExisting(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// scanExisting 统计目录中已有的跟踪文件，按修改时间排序后超出上限的部分立即删除
+func (s *Sampler) scanExisting() error {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("读取跟踪目录失败: %w", err)
+	}
+	type existing struct {
+		traceFile
+		mod time.Time
+	}
+	var found []existing
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), filePrefix) || !strings.HasSuffix(e.Name(), fileSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, existing{traceFile{filepath.Join(s.opts.Dir, e.Name()), info.Size()}, info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].mod.Equal(found[j].mod) {
+			return found[i].mod.Before(found[j].mod)
+		}
+		return found[i].path < found[j].path
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range found {
+		s.files = append(s.files, f.traceFile)
+		s.totalBytes += f.size
+	}
+	s.evictLocked(0)
+	return nil
+}
+
+// SetRate 设置新连接的抽样比例（热更新，已抽样的连接不受影响）
+func (s *Sampler) SetRate(rate float64) error {
+	if math.IsNaN(rate) || rate < 0 || rate > 1 {
+		return ErrInvalidRate
+	}
+	s.rate.Store(math.Float64bits(rate))
+	return nil
+}
+
+// Rate 当前抽样比例
+func (s *Sampler) Rate() float64 {
+	return math.Float64frombits(s.rate.Load())
+}
+
+// SetWatchList 替换关注名单（热更新，对之后确定身份的连接生效）
+func (s *Sampler) SetWatchList(deviceIDs, iccids []string) {
+	s.watch.Store(newWatchList(deviceIDs, iccids))
+}
+
+// Accept 新连接接入时按比例抽样
+func (s *Sampler) Accept(connID uint64, remoteAddr string) core.ConnTrace {
+	rate := s.Rate()
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	s.mu.Lock()
+	full := len(s.active) >= s.opts.MaxActive
+	s.mu.Unlock()
+	if full {
+		s.skippedLimit.Add(1)
+		return nil
+	}
+	t := s.open(connID, remoteAddr, ReasonRate, fmt.Sprintf("sampled at accept (rate=%g)", rate))
+	if t == nil {
+		return nil
+	}
+	s.sampled.Add(1)
+	return t
+}
+
+// Identify 连接ICCID或设备ID确定后，关注名单中的连接强制抽样（此前收发的字节不在跟踪中）
+func (s *Sampler) Identify(connID uint64, remoteAddr, iccid, deviceID string) core.ConnTrace {
+	match, ok := s.watch.Load().match(iccid, deviceID)
+	if !ok {
+		return nil
+	}
+	t := s.open(connID, remoteAddr, ReasonWatch, "forced by watch list ("+match+"), earlier bytes not captured")
+	if t == nil {
+		return nil
+	}
+	s.forced.Add(1)
+	return t
+}
+
+// open 创建连接的跟踪并写入起始注释；无法创建文件时返回nil
+func (s *Sampler) open(connID uint64, remoteAddr, reason, note string) *Trace {
+	now := time.Now()
+	t := &Trace{s: s, connID: connID, remoteAddr: remoteAddr, reason: reason, startedAt: now}
+	s.mu.Lock()
+	if existing := s.active[connID]; existing != nil {
+		s.mu.Unlock()
+		return existing
+	}
+	s.active[connID] = t
+	s.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.rotateLocked(now); err != nil {
+		s.writeErrors.Add(1)
+		logger.WithFields(logrus.Fields{"connID": connID, "error": err.Error()}).Warn("创建协议会话跟踪文件失败，该连接不抽样")
+		s.mu.Lock()
+		delete(s.active, connID)
+		s.mu.Unlock()
+		return nil
+	}
+	t.appendLocked(now, commlog.DirectionAnnotation, []byte(fmt.Sprintf("trace start: connId=%d remote=%s %s", connID, remoteAddr, note)))
+	return t
+}
+
+// reserve 为即将写入的字节预留目录空间，不足时删除最早的已结束文件；仍不足时返回false
+func (s *Sampler) reserve(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.totalBytes+n > s.opts.MaxTotalBytes {
+		s.evictLocked(n)
+	}
+	if s.totalBytes+n > s.opts.MaxTotalBytes {
+		return false
+	}
+	s.totalBytes += n
+	return true
+}
+
+// release 归还未使用的预留空间
+func (s *Sampler) release(n int64) {
+	s.mu.Lock()
+	s.totalBytes -= n
+	s.mu.Unlock()
+}
+
+// evictLocked 从最早的已结束文件开始删除，直到能再写入 n 字节
+func (s *Sampler) evictLocked(n int64) {
+	for len(s.files) > 0 && s.totalBytes+n > s.opts.MaxTotalBytes {
+		f := s.files[0]
+		s.files = s.files[1:]
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.WithFields(logrus.Fields{"file": f.path, "error": err.Error()}).Warn("删除跟踪文件失败")
+			continue
+		}
+		s.totalBytes -= f.size
+		s.deletedFiles.Add(1)
+	}
+}
+
+// retire 跟踪文件结束写入，加入可删除列表
+func (s *Sampler) retire(path string, size int64) {
+	s.mu.Lock()
+	s.files = append(s.files, traceFile{path: path, size: size})
+	s.mu.Unlock()
+}
+
+func (s *Sampler) nextFileName(connID uint64, part int, now time.Time) string {
+	s.mu.Lock()
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+	return filepath.Join(s.opts.Dir, fmt.Sprintf("%s%s-%06d-conn%d-p%d%s", filePrefix, now.Format(fileTimeLayout), seq%1000000, connID, part, fileSuffix))
+}
+
+// flushActive 刷写全部进行中的跟踪
+func (s *Sampler) flushActive() {
+	s.mu.Lock()
+	traces := make([]*Trace, 0, len(s.active))
+	for _, t := range s.active {
+		traces = append(traces, t)
+	}
+	s.mu.Unlock()
+	for _, t := range traces {
+		t.flush()
+	}
+}
+
+// ActiveTrace 进行中的跟踪
+type ActiveTrace struct {
+	ConnID     uint64    `json:"connId"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Reason     string    `json:"reason"` // rate | watch
+	StartedAt  time.Time `json:"startedAt"`
+	Records    uint64    `json:"records"`
+	Bytes      int64     `json:"bytes"` // 已写入全部分段的字节数
+	File       string    `json:"file"`  // 当前分段文件
+}
+
+// Status 抽样状态
+type Status struct {
+	Enabled           bool          `json:"enabled"`
+	Dir               string        `json:"dir"`
+	Rate              float64       `json:"rate"`
+	WatchDeviceIDs    []string      `json:"watchDeviceIds"`
+	WatchICCIDs       []string      `json:"watchIccids"`
+	ActiveConnections int           `json:"activeConnections"`
+	MaxActive         int           `json:"maxActive"`
+	Active            []ActiveTrace `json:"active"`
+	Files             int           `json:"files"`          // 目录中的跟踪文件（含进行中）
+	DiskUsageBytes    int64         `json:"diskUsageBytes"` // 目录中跟踪文件的总大小（含已预留、尚未刷写的字节）
+	MaxTotalBytes     int64         `json:"maxTotalBytes"`
+	MaxFileBytes      int64         `json:"maxFileBytes"`
+	Sampled           uint64        `json:"sampled"`          // 接入时按比例抽样的连接
+	Forced            uint64        `json:"forced"`           // 关注名单强制抽样的连接
+	SkippedActiveMax  uint64        `json:"skippedActiveMax"` // 同时抽样数已满而未抽样的连接
+	DroppedRecords    uint64        `json:"droppedRecords"`   // 目录空间不足而丢弃的记录
+	DeletedFiles      uint64        `json:"deletedFiles"`     // 为腾出空间删除的最早文件
+	WriteErrors       uint64        `json:"writeErrors"`
+}
+
+// Status 抽样状态
+func (s *Sampler) Status() Status {
+	watch := s.watch.Load()
+	st := Status{
+		Enabled:          true,
+		Dir:              s.opts.Dir,
+		Rate:             s.Rate(),
+		WatchDeviceIDs:   sortedKeys(watch.devices),
+		WatchICCIDs:      sortedKeys(watch.iccids),
+		MaxActive:        s.opts.MaxActive,
+		Active:           make([]ActiveTrace, 0),
+		MaxTotalBytes:    s.opts.MaxTotalBytes,
+		MaxFileBytes:     s.opts.MaxFileBytes,
+		Sampled:          s.sampled.Load(),
+		Forced:           s.forced.Load(),
+		SkippedActiveMax: s.skippedLimit.Load(),
+		DroppedRecords:   s.droppedRecords.Load(),
+		DeletedFiles:     s.deletedFiles.Load(),
+		WriteErrors:      s.writeErrors.Load(),
+	}
+	s.mu.Lock()
+	traces := make([]*Trace, 0, len(s.active))
+	for _, t := range s.active {
+		traces = append(traces, t)
+	}
+	st.ActiveConnections = len(s.active)
+	st.Files = len(s.files) + len(s.active)
+	st.DiskUsageBytes = s.totalBytes
+	s.mu.Unlock()
+	for _, t := range traces {
+		st.Active = append(st.Active, t.info())
+	}
+	sort.Slice(st.Active, func(i, j int) bool { return st.Active[i].ConnID < st.Active[j].ConnID })
+	return st
+}
+
+// Start 定期刷写进行中的跟踪
+func (s *Sampler) Start(ctx context.Context) {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	done := s.done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.opts.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.flushActive()
+			}
+		}
+	}()
+}
+
+// Stop 停止定期刷写并结束全部进行中的跟踪
+func (s *Sampler) Stop() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	traces := make([]*Trace, 0, len(s.active))
+	for _, t := range s.active {
+		traces = append(traces, t)
+	}
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	for _, t := range traces {
+		t.Close("shutdown")
+	}
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+var globalSampler atomic.Pointer[Sampler]
+
+// GetGlobalSampler 获取全局抽样（未启用时为nil）
+func GetGlobalSampler() *Sampler {
+	return globalSampler.Load()
+}
+
+// SetGlobalSampler 设置全局抽样
+func SetGlobalSampler(s *Sampler) {
+	globalSampler.Store(s)
+}
+
+// InitGlobalSampler 按配置创建全局抽样并开始定期刷写；未启用时不创建
+func InitGlobalSampler(ctx context.Context) error {
+	cfg := config.GetConfig().TraceSampling
+	if !cfg.Enabled {
+		SetGlobalSampler(nil)
+		return nil
+	}
+	s, err := New(Options{
+		Dir:            cfg.Dir,
+		Rate:           cfg.Rate,
+		WatchDeviceIDs: cfg.WatchDeviceIDs,
+		WatchICCIDs:    cfg.WatchICCIDs,
+		MaxFileBytes:   int64(cfg.MaxFileMB) << 20,
+		MaxTotalBytes:  int64(cfg.MaxTotalMB) << 20,
+		MaxActive:      cfg.MaxActive,
+		FlushInterval:  time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+	})
+	if err != nil {
+		SetGlobalSampler(nil)
+		return err
+	}
+	s.Start(ctx)
+	SetGlobalSampler(s)
+	return nil
+}
+
+// StopGlobalSampler 结束全部进行中的跟踪
+func StopGlobalSampler() {
+	if s := globalSampler.Load(); s != nil {
+		s.Stop()
+	}
+}
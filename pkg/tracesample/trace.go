@@ -0,0 +1,159 @@
+package tracesample
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+)
+
+// Trace 单个抽样连接的跟踪，按大小轮转为多个分段文件，每个分段都是完整的抓包文件
+type Trace struct {
+	s          *Sampler
+	connID     uint64
+	remoteAddr string
+	reason     string
+	startedAt  time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	w        *bufio.Writer
+	path     string
+	fileSize int64 // 当前分段已预留（写入缓冲或文件）的字节数
+	part     int
+	bytes    int64
+	records  uint64
+	buf      []byte
+	closed   bool
+}
+
+// Frame 记录连接上收到或发出的原始字节
+func (t *Trace) Frame(uplink bool, data []byte, at time.Time) {
+	dir := commlog.DirectionDownlink
+	if uplink {
+		dir = commlog.DirectionUplink
+	}
+	t.mu.Lock()
+	t.appendLocked(at, dir, data)
+	t.mu.Unlock()
+}
+
+// Note 记录解码结果等注释
+func (t *Trace) Note(text string, at time.Time) {
+	t.mu.Lock()
+	t.appendLocked(at, commlog.DirectionAnnotation, []byte(text))
+	t.mu.Unlock()
+}
+
+// Close 写入结束注释并关闭当前分段（重复调用无副作用）
+func (t *Trace) Close(reason string) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	t.appendLocked(now, commlog.DirectionAnnotation, []byte(fmt.Sprintf(
+		"trace end: reason=%s duration=%s records=%d", reason, now.Sub(t.startedAt).Round(time.Millisecond), t.records)))
+	t.closeFileLocked()
+	t.closed = true
+	t.mu.Unlock()
+
+	t.s.mu.Lock()
+	if t.s.active[t.connID] == t {
+		delete(t.s.active, t.connID)
+	}
+	t.s.mu.Unlock()
+}
+
+// appendLocked 追加一条记录：超过单文件上限时轮转，目录空间不足时丢弃并计数
+func (t *Trace) appendLocked(at time.Time, dir commlog.Direction, data []byte) {
+	if t.closed || t.file == nil {
+		return
+	}
+	if len(data) > commlog.MaxCaptureFrameBytes {
+		data = data[:commlog.MaxCaptureFrameBytes]
+	}
+	n := int64(commlog.CaptureRecordHeaderSize + len(data))
+	if t.fileSize+n > t.s.opts.MaxFileBytes && t.fileSize > commlog.CaptureHeaderSize {
+		if err := t.rotateLocked(at); err != nil {
+			t.s.writeErrors.Add(1)
+			return
+		}
+	}
+	if !t.s.reserve(n) {
+		t.s.droppedRecords.Add(1)
+		return
+	}
+	t.buf = commlog.AppendCaptureRecord(t.buf[:0], at, dir, data)
+	if _, err := t.w.Write(t.buf); err != nil {
+		t.s.writeErrors.Add(1)
+	}
+	t.fileSize += n
+	t.bytes += n
+	t.records++
+}
+
+// rotateLocked 结束当前分段并创建下一个分段
+func (t *Trace) rotateLocked(now time.Time) error {
+	t.closeFileLocked()
+	t.part++
+	path := t.s.nextFileName(t.connID, t.part, now)
+	if !t.s.reserve(commlog.CaptureHeaderSize) {
+		t.s.droppedRecords.Add(1)
+		return fmt.Errorf("跟踪目录空间不足")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.s.release(commlog.CaptureHeaderSize)
+		return err
+	}
+	t.file, t.path = f, path
+	t.w = bufio.NewWriterSize(f, 32*1024)
+	t.w.Write(commlog.AppendCaptureHeader(nil))
+	t.fileSize = commlog.CaptureHeaderSize
+	t.bytes += commlog.CaptureHeaderSize
+	return nil
+}
+
+// closeFileLocked 刷写并关闭当前分段，加入可删除列表
+func (t *Trace) closeFileLocked() {
+	if t.file == nil {
+		return
+	}
+	if err := t.w.Flush(); err != nil {
+		t.s.writeErrors.Add(1)
+	}
+	if err := t.file.Close(); err != nil {
+		t.s.writeErrors.Add(1)
+	}
+	t.s.retire(t.path, t.fileSize)
+	t.file, t.w = nil, nil
+}
+
+func (t *Trace) flush() {
+	t.mu.Lock()
+	if t.w != nil {
+		if err := t.w.Flush(); err != nil {
+			t.s.writeErrors.Add(1)
+		}
+	}
+	t.mu.Unlock()
+}
+
+func (t *Trace) info() ActiveTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return ActiveTrace{
+		ConnID:     t.connID,
+		RemoteAddr: t.remoteAddr,
+		Reason:     t.reason,
+		StartedAt:  t.startedAt,
+		Records:    t.records,
+		Bytes:      t.bytes,
+		File:       t.path,
+	}
+}
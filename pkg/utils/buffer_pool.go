@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 分级缓冲池容量，超过最大级别的请求直接分配且不回收
+var bufferPoolClasses = [...]int{256, 1024, 4096, 16384, 65536}
+
+var bufferPools [len(bufferPoolClasses)]sync.Pool
+
+func init() {
+	for i := range bufferPools {
+		size := bufferPoolClasses[i]
+		class := i
+		bufferPools[i].New = func() interface{} {
+			return &PooledBuffer{buf: make([]byte, size), class: class}
+		}
+	}
+}
+
+// PooledBuffer 池化字节缓冲（借用语义）
+// Release 之后不得再访问 Bytes() 返回的切片；使用 -tags bufpooldebug 构建时释放的缓冲会被填充毒值，
+// 重复释放或释放后访问会直接 panic，便于定位 use-after-release
+type PooledBuffer struct {
+	buf      []byte
+	n        int
+	class    int // -1 表示未池化
+	released atomic.Bool
+}
+
+// GetBuffer 从池中借用长度为 n 的缓冲（内容未清零）
+func GetBuffer(n int) *PooledBuffer {
+	for i, size := range bufferPoolClasses {
+		if n <= size {
+			b := bufferPools[i].Get().(*PooledBuffer)
+			b.n = n
+			b.released.Store(false)
+			return b
+		}
+	}
+	return &PooledBuffer{buf: make([]byte, n), n: n, class: -1}
+}
+
+// Bytes 返回借用的数据切片
+func (b *PooledBuffer) Bytes() []byte {
+	if bufferPoolDebug && b.released.Load() {
+		panic("utils.PooledBuffer: 释放后访问缓冲")
+	}
+	return b.buf[:b.n]
+}
+
+// Len 返回数据长度
+func (b *PooledBuffer) Len() int {
+	return b.n
+}
+
+// Release 归还缓冲，调用后不得再访问其数据
+func (b *PooledBuffer) Release() {
+	if b == nil {
+		return
+	}
+	if b.released.Swap(true) {
+		if bufferPoolDebug {
+			panic("utils.PooledBuffer: 重复释放缓冲")
+		}
+		return
+	}
+	if bufferPoolDebug {
+		poisonBuffer(b.buf)
+	}
+	if b.class >= 0 {
+		bufferPools[b.class].Put(b)
+	}
+}
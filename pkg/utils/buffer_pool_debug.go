@@ -0,0 +1,15 @@
+//go:build bufpooldebug
+
+package utils
+
+// bufpooldebug 构建：释放的缓冲填充毒值并检测重复释放/释放后访问
+const bufferPoolDebug = true
+
+// BufferPoisonByte 释放后缓冲的填充值
+const BufferPoisonByte = 0xDB
+
+func poisonBuffer(b []byte) {
+	for i := range b {
+		b[i] = BufferPoisonByte
+	}
+}
@@ -22,7 +22,7 @@ func NewImprovedZinxLoggerAdapter(improvedLogger *logger.ImprovedLogger) *Improv
 
 // InfoF 实现zinx的InfoF日志方法
 func (z *ImprovedZinxLoggerAdapter) InfoF(format string, v ...interface{}) {
-	z.improvedLogger.GetLogger().Infof(format, v...)
+	z.improvedLogger.GetLogger().WithField("source", "zinx").Infof(format, v...)
 }
 
 // DebugF 实现zinx的DebugF日志方法
@@ -38,7 +38,7 @@ func (z *ImprovedZinxLoggerAdapter) ErrorF(format string, v ...interface{}) {
 
 // InfoFX 实现zinx的InfoFX日志方法
 func (z *ImprovedZinxLoggerAdapter) InfoFX(ctx context.Context, format string, v ...interface{}) {
-	z.improvedLogger.GetLogger().WithContext(ctx).Infof(format, v...)
+	z.improvedLogger.GetLogger().WithContext(ctx).WithField("source", "zinx").Infof(format, v...)
 }
 
 // DebugFX 实现zinx的DebugFX日志方法
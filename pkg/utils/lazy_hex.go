@@ -0,0 +1,32 @@
+package utils
+
+import "encoding/hex"
+
+// HexBytes 延迟十六进制编码：作为日志字段时仅在日志实际输出时才编码
+// TextFormatter 通过 String()、JSONFormatter 通过 MarshalText() 取值
+type HexBytes []byte
+
+// LazyHex 包装字节切片为延迟编码的十六进制字段
+func LazyHex(data []byte) HexBytes {
+	return HexBytes(data)
+}
+
+// LazyHexN 同 LazyHex，最多编码前 n 个字节（等价于 fmt 的 %.nx）
+func LazyHexN(data []byte, n int) HexBytes {
+	if n >= 0 && len(data) > n {
+		data = data[:n]
+	}
+	return HexBytes(data)
+}
+
+// String 实现 fmt.Stringer
+func (h HexBytes) String() string {
+	return hex.EncodeToString(h)
+}
+
+// MarshalText 实现 encoding.TextMarshaler
+func (h HexBytes) MarshalText() ([]byte, error) {
+	buf := make([]byte, hex.EncodedLen(len(h)))
+	hex.Encode(buf, h)
+	return buf, nil
+}
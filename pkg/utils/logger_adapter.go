@@ -7,7 +7,7 @@ import (
 	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
 )
 
-// ZinxLoggerAdapter 适配我们的日志系统到Zinx框架
+// ZinxLoggerAdapter 适配我们的日志系统到Zinx框架，日志统一带 source=zinx 标记（ECS格式下输出为 event.module）
 type ZinxLoggerAdapter struct{}
 
 // NewZinxLoggerAdapter 创建一个新的Zinx日志适配器
@@ -17,32 +17,32 @@ func NewZinxLoggerAdapter() *ZinxLoggerAdapter {
 
 // InfoF 实现zinx的InfoF日志方法
 func (z *ZinxLoggerAdapter) InfoF(format string, v ...interface{}) {
-	logger.Infof(format, v...)
+	logger.WithField("source", "zinx").Infof(format, v...)
 }
 
 // DebugF 实现zinx的DebugF日志方法
 func (z *ZinxLoggerAdapter) DebugF(format string, v ...interface{}) {
-	logger.Debugf(format, v...)
+	logger.WithField("source", "zinx").Debugf(format, v...)
 }
 
 // ErrorF 实现zinx的ErrorF日志方法
 func (z *ZinxLoggerAdapter) ErrorF(format string, v ...interface{}) {
-	logger.Errorf(format, v...)
+	logger.WithField("source", "zinx").Errorf(format, v...)
 }
 
 // InfoFX 实现zinx的InfoFX日志方法
 func (z *ZinxLoggerAdapter) InfoFX(_ context.Context, format string, v ...interface{}) {
-	logger.Infof(format, v...)
+	logger.WithField("source", "zinx").Infof(format, v...)
 }
 
 // DebugFX 实现zinx的DebugFX日志方法
 func (z *ZinxLoggerAdapter) DebugFX(_ context.Context, format string, v ...interface{}) {
-	logger.Debugf(format, v...)
+	logger.WithField("source", "zinx").Debugf(format, v...)
 }
 
 // ErrorFX 实现zinx的ErrorFX日志方法
 func (z *ZinxLoggerAdapter) ErrorFX(_ context.Context, format string, v ...interface{}) {
-	logger.Errorf(format, v...)
+	logger.WithField("source", "zinx").Errorf(format, v...)
 }
 
 // SetupZinxLogger 设置Zinx框架使用我们的日志系统
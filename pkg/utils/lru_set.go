@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUSet 有界LRU集合（超出容量时淘汰最久未访问的键），并发安全
+type LRUSet struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+// NewLRUSet 创建有界LRU集合，capacity<=0 时按1处理
+func NewLRUSet(capacity int) *LRUSet {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRUSet{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// Add 加入键；键已存在时返回false并刷新为最近访问
+func (s *LRUSet) Add(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.order.MoveToFront(e)
+		return false
+	}
+	s.items[key] = s.order.PushFront(key)
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(string))
+	}
+	return true
+}
+
+// Contains 判断键是否存在（不刷新访问顺序）
+func (s *LRUSet) Contains(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.items[key]
+	return ok
+}
+
+// Len 当前键数量
+func (s *LRUSet) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.order.Len()
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RollingCounter 滑动窗口计数器（按分钟分桶，读写均为O(桶数)，适合仪表盘类低成本统计）
+type RollingCounter struct {
+	mutex   sync.Mutex
+	width   time.Duration
+	buckets []rollingBucket
+}
+
+type rollingBucket struct {
+	slot  int64 // 桶对应的时间槽（Unix时间/桶宽）
+	count int64
+}
+
+// NewRollingCounter 创建滑动窗口计数器，window 向上取整到分钟
+func NewRollingCounter(window time.Duration) *RollingCounter {
+	n := int((window + time.Minute - 1) / time.Minute)
+	if n <= 0 {
+		n = 1
+	}
+	return &RollingCounter{
+		width:   time.Minute,
+		buckets: make([]rollingBucket, n),
+	}
+}
+
+// Add 在当前时间累加计数
+func (c *RollingCounter) Add(n int64) {
+	c.AddAt(time.Now(), n)
+}
+
+// AddAt 在指定时间累加计数
+func (c *RollingCounter) AddAt(t time.Time, n int64) {
+	slot := t.UnixNano() / int64(c.width)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	b := &c.buckets[int(slot%int64(len(c.buckets)))]
+	if b.slot != slot {
+		b.slot = slot
+		b.count = 0
+	}
+	b.count += n
+}
+
+// Sum 统计截至 now 的窗口内计数总和
+func (c *RollingCounter) Sum(now time.Time) int64 {
+	current := now.UnixNano() / int64(c.width)
+	oldest := current - int64(len(c.buckets)) + 1
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var total int64
+	for _, b := range c.buckets {
+		if b.slot >= oldest && b.slot <= current {
+			total += b.count
+		}
+	}
+	return total
+}
@@ -0,0 +1,334 @@
+package virtual
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// IDSeparator 虚拟设备ID分隔符：<物理设备ID>-<后缀>
+	IDSeparator = "-"
+	// MaxPort 协议支持的最大端口数
+	MaxPort = 32
+
+	defaultFilePath = "./data/virtual_devices.json"
+	defaultRedisKey = "iot:virtual_devices"
+)
+
+// PortMapping 显式映射：一个虚拟设备包含的物理端口
+type PortMapping struct {
+	Suffix string `json:"suffix,omitempty"` // 虚拟ID后缀，为空按序号生成 P01/P02...
+	Ports  []int  `json:"ports"`            // 物理业务端口(1-based)
+}
+
+// SplitPlan 拆分方案：按每虚拟设备端口数均分，或显式映射（二选一）
+type SplitPlan struct {
+	PortsPerVirtual int           `json:"ports_per_virtual,omitempty"`
+	TotalPorts      int           `json:"total_ports,omitempty"`
+	Mapping         []PortMapping `json:"mapping,omitempty"`
+}
+
+// Registry 虚拟子设备注册表（映射的唯一数据源，持久化后在设备重连时重新挂载到设备组）
+type Registry struct {
+	mutex    sync.RWMutex
+	byParent map[string][]*core.VirtualDevice
+	byID     map[string]*core.VirtualDevice
+	store    Store
+}
+
+// NewRegistry 创建注册表并从持久化加载映射（store 为 nil 时仅内存保存）
+func NewRegistry(store Store) (*Registry, error) {
+	r := &Registry{
+		byParent: make(map[string][]*core.VirtualDevice),
+		byID:     make(map[string]*core.VirtualDevice),
+		store:    store,
+	}
+	if store == nil {
+		return r, nil
+	}
+	virtuals, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if virtuals == nil {
+		return r, nil
+	}
+	for _, v := range *virtuals {
+		if v == nil || v.VirtualID == "" || v.ParentID == "" {
+			continue
+		}
+		r.byParent[v.ParentID] = append(r.byParent[v.ParentID], v)
+		r.byID[strings.ToUpper(v.VirtualID)] = v
+	}
+	return r, nil
+}
+
+// BuildVirtuals 按拆分方案生成虚拟设备（不修改注册表）
+func BuildVirtuals(parentID string, plan SplitPlan, now time.Time) ([]*core.VirtualDevice, error) {
+	mapping := plan.Mapping
+	if len(mapping) == 0 {
+		if plan.PortsPerVirtual <= 0 || plan.TotalPorts <= 0 {
+			return nil, fmt.Errorf("需指定 portsPerVirtual+totalPorts 或显式 mapping")
+		}
+		if plan.TotalPorts > MaxPort {
+			return nil, fmt.Errorf("总端口数 %d 超出范围(1-%d)", plan.TotalPorts, MaxPort)
+		}
+		for start := 1; start <= plan.TotalPorts; start += plan.PortsPerVirtual {
+			var ports []int
+			for p := start; p < start+plan.PortsPerVirtual && p <= plan.TotalPorts; p++ {
+				ports = append(ports, p)
+			}
+			mapping = append(mapping, PortMapping{Ports: ports})
+		}
+	} else if plan.PortsPerVirtual > 0 {
+		return nil, fmt.Errorf("portsPerVirtual 与 mapping 不能同时指定")
+	}
+
+	seenPorts := make(map[int]string)
+	seenIDs := make(map[string]bool)
+	virtuals := make([]*core.VirtualDevice, 0, len(mapping))
+	for i, m := range mapping {
+		suffix := strings.ToUpper(strings.TrimSpace(m.Suffix))
+		if suffix == "" {
+			suffix = fmt.Sprintf("P%02d", i+1)
+		}
+		if strings.Contains(suffix, IDSeparator) {
+			return nil, fmt.Errorf("虚拟ID后缀不能包含 %q: %s", IDSeparator, suffix)
+		}
+		id := parentID + IDSeparator + suffix
+		if seenIDs[id] {
+			return nil, fmt.Errorf("虚拟设备ID重复: %s", id)
+		}
+		seenIDs[id] = true
+		if len(m.Ports) == 0 {
+			return nil, fmt.Errorf("虚拟设备 %s 未指定端口", id)
+		}
+		for _, p := range m.Ports {
+			if p < 1 || p > MaxPort {
+				return nil, fmt.Errorf("虚拟设备 %s 端口 %d 超出范围(1-%d)", id, p, MaxPort)
+			}
+			if owner, dup := seenPorts[p]; dup {
+				return nil, fmt.Errorf("端口 %d 同时映射到 %s 和 %s", p, owner, id)
+			}
+			seenPorts[p] = id
+		}
+		virtuals = append(virtuals, &core.VirtualDevice{
+			VirtualID: id,
+			ParentID:  parentID,
+			Ports:     append([]int(nil), m.Ports...),
+			CreatedAt: now,
+		})
+	}
+	return virtuals, nil
+}
+
+// Split 拆分物理设备为虚拟子设备并持久化；已拆分的设备需先删除拆分
+func (r *Registry) Split(parentID string, plan SplitPlan) ([]*core.VirtualDevice, error) {
+	virtuals, err := BuildVirtuals(parentID, plan, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.byParent[parentID]; exists {
+		return nil, &AlreadySplitError{ParentID: parentID}
+	}
+	for _, v := range virtuals {
+		if _, exists := r.byID[strings.ToUpper(v.VirtualID)]; exists {
+			return nil, fmt.Errorf("虚拟设备ID已存在: %s", v.VirtualID)
+		}
+	}
+
+	r.byParent[parentID] = virtuals
+	for _, v := range virtuals {
+		r.byID[strings.ToUpper(v.VirtualID)] = v
+	}
+	if err := r.saveLocked(); err != nil {
+		delete(r.byParent, parentID)
+		for _, v := range virtuals {
+			delete(r.byID, strings.ToUpper(v.VirtualID))
+		}
+		return nil, err
+	}
+	return virtuals, nil
+}
+
+// Remove 删除物理设备的拆分并持久化，返回被删除的虚拟设备
+func (r *Registry) Remove(parentID string) ([]*core.VirtualDevice, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	virtuals, exists := r.byParent[parentID]
+	if !exists {
+		return nil, fmt.Errorf("设备 %s 未拆分虚拟子设备", parentID)
+	}
+	delete(r.byParent, parentID)
+	for _, v := range virtuals {
+		delete(r.byID, strings.ToUpper(v.VirtualID))
+	}
+	if err := r.saveLocked(); err != nil {
+		r.byParent[parentID] = virtuals
+		for _, v := range virtuals {
+			r.byID[strings.ToUpper(v.VirtualID)] = v
+		}
+		return nil, err
+	}
+	return virtuals, nil
+}
+
+// Get 获取物理设备的虚拟子设备
+func (r *Registry) Get(parentID string) []*core.VirtualDevice {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]*core.VirtualDevice(nil), r.byParent[parentID]...)
+}
+
+// Resolve 按虚拟ID查找虚拟设备（不区分大小写）
+func (r *Registry) Resolve(virtualID string) (*core.VirtualDevice, bool) {
+	if !strings.Contains(virtualID, IDSeparator) {
+		return nil, false
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	v, ok := r.byID[strings.ToUpper(strings.TrimSpace(virtualID))]
+	return v, ok
+}
+
+// LookupPort 按物理设备+物理端口查找所属虚拟设备及虚拟端口
+func (r *Registry) LookupPort(parentID string, port int) (*core.VirtualDevice, int, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, v := range r.byParent[parentID] {
+		if vp, ok := v.VirtualPort(port); ok {
+			return v, vp, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Parents 已拆分的物理设备ID列表
+func (r *Registry) Parents() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	parents := make([]string, 0, len(r.byParent))
+	for p := range r.byParent {
+		parents = append(parents, p)
+	}
+	sort.Strings(parents)
+	return parents
+}
+
+func (r *Registry) saveLocked() error {
+	if r.store == nil {
+		return nil
+	}
+	all := make([]*core.VirtualDevice, 0, len(r.byID))
+	for _, list := range r.byParent {
+		all = append(all, list...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].VirtualID < all[j].VirtualID })
+	if err := r.store.Save(all); err != nil {
+		return fmt.Errorf("持久化虚拟设备映射失败: %w", err)
+	}
+	return nil
+}
+
+// AlreadySplitError 设备已拆分
+type AlreadySplitError struct {
+	ParentID string
+}
+
+func (e *AlreadySplitError) Error() string {
+	return fmt.Sprintf("设备 %s 已拆分虚拟子设备，请先删除现有拆分", e.ParentID)
+}
+
+// ===============================
+// 全局实例
+// ===============================
+
+type registryHolder struct {
+	registry *Registry
+}
+
+var globalRegistry atomic.Value // registryHolder
+
+// GetGlobalRegistry 获取全局虚拟设备注册表，未初始化时返回nil
+func GetGlobalRegistry() *Registry {
+	if h, ok := globalRegistry.Load().(registryHolder); ok {
+		return h.registry
+	}
+	return nil
+}
+
+// SetGlobalRegistry 设置全局虚拟设备注册表
+func SetGlobalRegistry(r *Registry) {
+	globalRegistry.Store(registryHolder{registry: r})
+}
+
+// Resolve 通过全局注册表解析虚拟ID
+func Resolve(virtualID string) (*core.VirtualDevice, bool) {
+	r := GetGlobalRegistry()
+	if r == nil {
+		return nil, false
+	}
+	return r.Resolve(virtualID)
+}
+
+// LookupPort 通过全局注册表查找物理端口所属的虚拟设备
+func LookupPort(parentID string, port int) (*core.VirtualDevice, int, bool) {
+	r := GetGlobalRegistry()
+	if r == nil || parentID == "" {
+		return nil, 0, false
+	}
+	return r.LookupPort(parentID, port)
+}
+
+// InitGlobalRegistry 按配置初始化全局虚拟设备注册表（需在Redis初始化之后调用）
+func InitGlobalRegistry() error {
+	cfg := config.GetConfig().VirtualDevice
+
+	var store Store
+	switch cfg.Store {
+	case "", StoreTypeFile:
+		path := cfg.FilePath
+		if path == "" {
+			path = defaultFilePath
+		}
+		store = NewFileStore(path)
+	case StoreTypeRedis:
+		client := infraredis.GetClient()
+		if client == nil {
+			return fmt.Errorf("虚拟设备映射配置为redis存储，但Redis未连接")
+		}
+		key := cfg.RedisKey
+		if key == "" {
+			key = defaultRedisKey
+		}
+		store = NewRedisStore(client, key)
+	case StoreTypeMemory:
+	default:
+		return fmt.Errorf("不支持的虚拟设备映射存储方式: %s", cfg.Store)
+	}
+
+	r, err := NewRegistry(store)
+	if err != nil {
+		SetGlobalRegistry(nil)
+		return err
+	}
+	SetGlobalRegistry(r)
+	logger.WithFields(logrus.Fields{
+		"store":   cfg.Store,
+		"parents": len(r.Parents()),
+	}).Info("虚拟子设备注册表已初始化")
+	return nil
+}
@@ -0,0 +1,39 @@
+package virtual
+
+import (
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store 虚拟子设备映射持久化
+type Store = persistence.Store[[]*core.VirtualDevice]
+
+// 持久化方式
+const (
+	StoreTypeFile   = persistence.StoreTypeFile
+	StoreTypeRedis  = persistence.StoreTypeRedis
+	StoreTypeMemory = persistence.StoreTypeMemory
+)
+
+// RecordType 虚拟子设备映射的持久化类型（加载时旧版本立即迁移并回写）
+const (
+	RecordType    = "virtual_devices"
+	recordVersion = 1
+)
+
+func init() {
+	persistence.RegisterType(RecordType, recordVersion)
+}
+
+var storeCodec = persistence.Codec{RecordType: RecordType, Label: "虚拟设备映射", Indent: true}
+
+// NewFileStore 创建文件持久化
+func NewFileStore(path string) *persistence.FileStore[[]*core.VirtualDevice] {
+	return persistence.NewFileStore[[]*core.VirtualDevice](path, storeCodec)
+}
+
+// NewRedisStore 创建Redis持久化（整体JSON存储在单个键下）
+func NewRedisStore(client *redis.Client, key string) *persistence.RedisStore[[]*core.VirtualDevice] {
+	return persistence.NewRedisStore[[]*core.VirtualDevice](client, key, storeCodec)
+}
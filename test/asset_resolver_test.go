@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+)
+
+// TestAssetResolver 设备资产映射解析器测试
+func TestAssetResolver(t *testing.T) {
+	t.Run("CSV映射文件与重新加载", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "assets.csv")
+		content := "device_id,asset_code,station_id,label\n04a26cf3,ST-0142-P3,ST-0142,3号桩\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := asset.NewFileResolver(path)
+		if err != nil {
+			t.Fatalf("加载CSV失败: %v", err)
+		}
+		info, ok := r.Resolve("04A26CF3")
+		if !ok || info.AssetCode != "ST-0142-P3" || info.StationID != "ST-0142" {
+			t.Fatalf("CSV解析结果错误: %+v %v", info, ok)
+		}
+		if _, ok := r.Resolve("04A228CD"); ok {
+			t.Fatal("未登记设备不应解析成功")
+		}
+
+		if err := os.WriteFile(path, []byte("device_id,asset_code\n04A228CD,ST-0001-P1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reload(); err != nil {
+			t.Fatalf("重新加载失败: %v", err)
+		}
+		if _, ok := r.Resolve("04A26CF3"); ok {
+			t.Fatal("重新加载后旧映射应失效")
+		}
+		if info, ok := r.Resolve("04A228CD"); !ok || info.AssetCode != "ST-0001-P1" {
+			t.Fatalf("重新加载结果错误: %+v", info)
+		}
+	})
+
+	t.Run("YAML映射文件", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "assets.yaml")
+		content := "- device_id: 04A26CF3\n  asset_code: ST-0142-P3\n  station_id: ST-0142\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := asset.NewFileResolver(path)
+		if err != nil {
+			t.Fatalf("加载YAML失败: %v", err)
+		}
+		if info, ok := r.Resolve("04A26CF3"); !ok || info.AssetCode != "ST-0142-P3" {
+			t.Fatalf("YAML解析结果错误: %+v", info)
+		}
+	})
+
+	waitResolve := func(r asset.Resolver, deviceID string) (asset.AssetInfo, bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if info, ok := r.Resolve(deviceID); ok {
+				return info, true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return asset.AssetInfo{}, false
+	}
+
+	t.Run("HTTP查询缓存与负缓存", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if req.URL.Path != "/assets/04A26CF3" {
+				http.NotFound(w, req)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"asset_code":"ST-0142-P3","station_id":"ST-0142","label":"3号桩"}}`))
+		}))
+		defer srv.Close()
+
+		r, err := asset.NewHTTPResolver(asset.HTTPResolverOptions{URL: srv.URL + "/assets/{deviceId}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := r.Resolve("04A26CF3"); ok {
+			t.Fatal("首次查询应异步进行，不阻塞调用方")
+		}
+		if info, ok := waitResolve(r, "04A26CF3"); !ok || info.AssetCode != "ST-0142-P3" {
+			t.Fatalf("HTTP解析结果错误: %+v", info)
+		}
+
+		r.Resolve("04A228CD")
+		time.Sleep(100 * time.Millisecond)
+		before := atomic.LoadInt32(&calls)
+		for i := 0; i < 10; i++ {
+			r.Resolve("04A26CF3")
+			r.Resolve("04A228CD")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if after := atomic.LoadInt32(&calls); after != before {
+			t.Fatalf("缓存期内不应重复查询: %d → %d", before, after)
+		}
+	})
+
+	t.Run("HTTP熔断", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		r, err := asset.NewHTTPResolver(asset.HTTPResolverOptions{
+			URL:              srv.URL + "/assets/{deviceId}",
+			FailureThreshold: 2,
+			OpenDuration:     time.Minute,
+			MaxConcurrent:    1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for !r.IsOpen() && time.Now().Before(deadline) {
+			r.Resolve("04A26CF3")
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !r.IsOpen() {
+			t.Fatal("连续失败后应熔断")
+		}
+		before := atomic.LoadInt32(&calls)
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			r.Resolve("04A26CF3")
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Fatalf("熔断期间查询应立即返回，耗时 %s", elapsed)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if after := atomic.LoadInt32(&calls); after != before {
+			t.Fatalf("熔断期间不应请求资产服务: %d → %d", before, after)
+		}
+	})
+}
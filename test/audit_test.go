@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/audit"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/gin-gonic/gin"
+)
+
+// auditSnapshot 构造单字段族的参数快照，verifiedAgo 为距今的确认时长
+func auditSnapshot(deviceID string, values map[string]interface{}, verifiedAgo time.Duration) core.DeviceParamSnapshot {
+	verified := time.Now().Add(-verifiedAgo)
+	verifiedAt := make(map[string]time.Time, len(values))
+	for k := range values {
+		verifiedAt[k] = verified
+	}
+	return core.DeviceParamSnapshot{DeviceID: deviceID, Values: values, VerifiedAt: verifiedAt, LastVerified: verified}
+}
+
+// TestAuditRules 审计规则逐运算符判定合规/不合规，缺少字段或数据过期判定为 unknown，非法规则拒绝创建
+func TestAuditRules(t *testing.T) {
+	quietLogger(t)
+	values := map[string]interface{}{
+		"firmware_version": "V2.10.3",
+		"model":            "AP3000-10",
+		"heartbeat":        30,
+		"params":           map[string]interface{}{"max_power": 7000.0},
+	}
+
+	cases := []struct {
+		name   string
+		rule   audit.Rule
+		ago    time.Duration // 快照确认距今时长
+		stale  time.Duration // 审计过期阈值，0 用引擎默认(24h)
+		status string
+	}{
+		{"eq数值等价", audit.Rule{Field: "heartbeat", Operator: audit.OperatorEq, Expected: "30.0"}, time.Minute, 0, audit.StatusCompliant},
+		{"eq不等", audit.Rule{Field: "heartbeat", Operator: audit.OperatorEq, Expected: "60"}, time.Minute, 0, audit.StatusNonCompliant},
+		{"ne", audit.Rule{Field: "model", Operator: audit.OperatorNe, Expected: "AP3000-2"}, time.Minute, 0, audit.StatusCompliant},
+		{"gt", audit.Rule{Field: "heartbeat", Operator: audit.OperatorGt, Expected: "30"}, time.Minute, 0, audit.StatusNonCompliant},
+		{"gte", audit.Rule{Field: "heartbeat", Operator: audit.OperatorGte, Expected: "30"}, time.Minute, 0, audit.StatusCompliant},
+		{"lt", audit.Rule{Field: "heartbeat", Operator: audit.OperatorLt, Expected: "30"}, time.Minute, 0, audit.StatusNonCompliant},
+		{"lte嵌套字段", audit.Rule{Field: "params.max_power", Operator: audit.OperatorLte, Expected: "7000"}, time.Minute, 0, audit.StatusCompliant},
+		{"version_gte逐段比较", audit.Rule{Field: "firmware_version", Operator: audit.OperatorVersionGte, Expected: "2.9"}, time.Minute, 0, audit.StatusCompliant},
+		{"version_lte", audit.Rule{Field: "firmware_version", Operator: audit.OperatorVersionLte, Expected: "V2.10.2"}, time.Minute, 0, audit.StatusNonCompliant},
+		{"contains", audit.Rule{Field: "model", Operator: audit.OperatorContains, Expected: "AP3000"}, time.Minute, 0, audit.StatusCompliant},
+		{"缺少字段", audit.Rule{Field: "params.min_power", Operator: audit.OperatorGte, Expected: "1"}, time.Minute, 0, audit.StatusUnknown},
+		{"超过默认阈值未确认", audit.Rule{Field: "heartbeat", Operator: audit.OperatorEq, Expected: "30"}, 25 * time.Hour, 0, audit.StatusUnknown},
+		{"超过审计阈值未确认", audit.Rule{Field: "heartbeat", Operator: audit.OperatorEq, Expected: "30"}, 2 * time.Hour, time.Hour, audit.StatusUnknown},
+		{"过期优先于不合规", audit.Rule{Field: "heartbeat", Operator: audit.OperatorEq, Expected: "60"}, 2 * time.Hour, time.Hour, audit.StatusUnknown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			snap := auditSnapshot("04A16321", values, tc.ago)
+			engine := audit.NewEngine(func() []core.DeviceParamSnapshot { return []core.DeviceParamSnapshot{snap} }, 0)
+			a, err := engine.CreateAudit(&audit.Audit{Rules: []audit.Rule{tc.rule}, StaleThreshold: tc.stale})
+			if err != nil {
+				t.Fatalf("创建审计失败: %v", err)
+			}
+			report, err := engine.Run(a.ID)
+			if err != nil {
+				t.Fatalf("执行审计失败: %v", err)
+			}
+			if report.TotalDevices != 1 {
+				t.Fatalf("应审计1台设备: %+v", report)
+			}
+			if tc.status == audit.StatusCompliant {
+				if report.Compliant != 1 || len(report.Devices) != 0 {
+					t.Fatalf("应判定合规且不列入报告: %+v", report)
+				}
+				return
+			}
+			if len(report.Devices) != 1 || report.Devices[0].Status != tc.status {
+				t.Fatalf("应判定 %s: %+v", tc.status, report.Devices)
+			}
+			if tc.status == audit.StatusUnknown && report.Devices[0].Reason == "" {
+				t.Fatal("unknown 结论应给出原因")
+			}
+			if tc.status == audit.StatusNonCompliant && (len(report.Devices[0].FailedRules) != 1 || report.Devices[0].FailedRules[0] != tc.rule.String()) {
+				t.Fatalf("应列出未通过的规则: %+v", report.Devices[0].FailedRules)
+			}
+		})
+	}
+
+	t.Run("按字段确认时间判定过期", func(t *testing.T) {
+		// 整机快照过期但规则字段刚确认：以字段确认时间为准
+		snap := auditSnapshot("04A16322", map[string]interface{}{"heartbeat": 30}, time.Minute)
+		snap.LastVerified = time.Now().Add(-48 * time.Hour)
+		engine := audit.NewEngine(func() []core.DeviceParamSnapshot { return []core.DeviceParamSnapshot{snap} }, time.Hour)
+		a, _ := engine.CreateAudit(&audit.Audit{Rules: []audit.Rule{{Field: "heartbeat", Operator: audit.OperatorEq, Expected: "30"}}})
+		if report, err := engine.Run(a.ID); err != nil || report.Compliant != 1 {
+			t.Fatalf("字段近期已确认应判定合规: %+v %v", report, err)
+		}
+	})
+
+	invalid := []struct {
+		name  string
+		rules []audit.Rule
+	}{
+		{"规则为空", nil},
+		{"字段为空", []audit.Rule{{Operator: audit.OperatorEq, Expected: "1"}}},
+		{"数值运算符期望值非数值", []audit.Rule{{Field: "heartbeat", Operator: audit.OperatorGt, Expected: "abc"}}},
+		{"不支持的运算符", []audit.Rule{{Field: "heartbeat", Operator: "between", Expected: "1"}}},
+	}
+	for _, tc := range invalid {
+		t.Run("拒绝"+tc.name, func(t *testing.T) {
+			if _, err := audit.NewEngine(nil, 0).CreateAudit(&audit.Audit{Rules: tc.rules}); err == nil {
+				t.Fatal("非法审计定义应拒绝创建")
+			}
+		})
+	}
+}
+
+// TestAuditHandlers 审计接口：创建并立即执行、报告JSON与CSV导出格式、未执行/不存在的审计返回404
+func TestAuditHandlers(t *testing.T) {
+	quietLogger(t)
+	gin.SetMode(gin.TestMode)
+	snapshots := []core.DeviceParamSnapshot{
+		auditSnapshot("04A16331", map[string]interface{}{"firmware_version": "V2.1", "heartbeat": 30}, time.Minute),
+		auditSnapshot("04A16332", map[string]interface{}{"firmware_version": "V1.8", "heartbeat": 30}, time.Minute),
+		auditSnapshot("04A16333", map[string]interface{}{"firmware_version": "V2.3", "heartbeat": 60}, time.Minute),
+		auditSnapshot("04A16334", map[string]interface{}{"firmware_version": "V2.4", "heartbeat": 30}, 48*time.Hour),
+		auditSnapshot("04A16335", map[string]interface{}{"heartbeat": 30}, time.Minute),
+	}
+	engine := audit.NewEngine(func() []core.DeviceParamSnapshot { return snapshots }, time.Hour)
+	previous := audit.SetGlobalEngine(engine)
+	t.Cleanup(func() { audit.SetGlobalEngine(previous) })
+
+	h := apihttp.NewAuditHandlers()
+	r := gin.New()
+	r.GET("/api/v1/audits", h.HandleListAudits)
+	r.POST("/api/v1/audits", h.HandleCreateAudit)
+	r.POST("/api/v1/audits/:id/run", h.HandleRunAudit)
+	r.GET("/api/v1/audits/:id/report", h.HandleAuditReport)
+
+	const rules = `"rules":[{"field":"firmware_version","operator":"version_gte","expected":"2.0"},{"field":"heartbeat","operator":"eq","expected":"30"}]`
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/audits", `{"id":"fw_check",`+rules+`}`); w.Code != http.StatusOK {
+		t.Fatalf("创建审计失败: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/audits/fw_check/report", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("未执行的审计应返回404: %d", w.Code)
+	}
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/audits/missing/report", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("不存在的审计应返回404: %d", w.Code)
+	}
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/audits/missing/run", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("执行不存在的审计应返回404: %d", w.Code)
+	}
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/audits", `{"id":"fw_check",`+rules+`}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("重复的审计ID应返回400: %d", w.Code)
+	}
+
+	w, resp := callAPI(r, http.MethodPost, "/api/v1/audits", `{"id":"fw_now","runNow":true,`+rules+`}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("创建并执行审计失败: %d %s", w.Code, w.Body.String())
+	}
+	report, _ := resp.Data["report"].(map[string]interface{})
+	if report == nil || report["total_devices"].(float64) != 5 || report["compliant"].(float64) != 1 ||
+		report["non_compliant"].(float64) != 2 || report["unknown"].(float64) != 2 {
+		t.Fatalf("立即执行的报告计数错误: %+v", report)
+	}
+	if _, resp := callAPI(r, http.MethodGet, "/api/v1/audits", ""); resp.Data["total"].(float64) != 2 {
+		t.Fatalf("应列出2个审计: %+v", resp.Data)
+	}
+
+	// CSV：表头为设备/结论 + 规则字段（去重、按规则顺序）+ 确认时间/未通过规则/原因；不合规在前，同结论按设备ID排序
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/audits/fw_now/report?format=csv", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") ||
+		!strings.Contains(w.Header().Get("Content-Disposition"), "filename=audit_fw_now_") {
+		t.Fatalf("CSV导出响应头错误: %d %v", w.Code, w.Header())
+	}
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV格式错误: %v\n%s", err, w.Body.String())
+	}
+	wantHeader := []string{"device_id", "status", "firmware_version", "heartbeat", "last_verified", "failed_rules", "reason"}
+	if len(records) != 5 || strings.Join(records[0], ",") != strings.Join(wantHeader, ",") {
+		t.Fatalf("CSV表头或行数错误: %q", records)
+	}
+	want := [][3]string{ // device_id, status, failed_rules
+		{"04A16332", "non_compliant", "firmware_version version_gte 2.0"},
+		{"04A16333", "non_compliant", "heartbeat eq 30"},
+		{"04A16334", "unknown", ""},
+		{"04A16335", "unknown", ""},
+	}
+	for i, row := range records[1:] {
+		if row[0] != want[i][0] || row[1] != want[i][1] || row[5] != want[i][2] {
+			t.Fatalf("CSV第%d行错误: %q", i+1, row)
+		}
+		if _, err := time.Parse(time.RFC3339, row[4]); err != nil {
+			t.Fatalf("last_verified 应为RFC3339: %q", row[4])
+		}
+	}
+	if records[1][2] != "V1.8" || records[1][3] != "30" {
+		t.Fatalf("CSV应输出规则字段的当前值: %q", records[1])
+	}
+	if records[3][6] == "" || records[4][2] != "" || !strings.Contains(records[4][6], "firmware_version") {
+		t.Fatalf("unknown 行应给出原因，缺少的字段留空: %q %q", records[3], records[4])
+	}
+}
+
+// TestAuditGlobalEngine 全局审计引擎并发懒创建只生成一个实例
+func TestAuditGlobalEngine(t *testing.T) {
+	previous := audit.SetGlobalEngine(nil)
+	t.Cleanup(func() { audit.SetGlobalEngine(previous) })
+
+	const workers = 16
+	engines := make([]*audit.Engine, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			engines[i] = audit.GetGlobalEngine()
+		}(i)
+	}
+	wg.Wait()
+	for _, e := range engines {
+		if e == nil || e != engines[0] {
+			t.Fatal("并发获取全局审计引擎应返回同一实例")
+		}
+	}
+}
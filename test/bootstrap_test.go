@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/internal/bootstrap"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// TestMain 所有测试共用的启动装配（全局实例未初始化时访问会panic）
+func TestMain(m *testing.M) {
+	bootstrap.InitForTest()
+	os.Exit(m.Run())
+}
+
+// TestBootstrapOrdering 启动顺序与跨组件回调注册测试
+func TestBootstrapOrdering(t *testing.T) {
+	t.Run("全局访问器指向启动实例", func(t *testing.T) {
+		app := bootstrap.InitForTest()
+		if core.GetGlobalTCPManager() != app.TCPManager || network.GetCommandManager() != app.CommandManager || gateway.GetGlobalDeviceGateway() != app.Gateway {
+			t.Fatal("全局访问器应返回启动时构造的实例")
+		}
+		if notification.GetGlobalNotificationIntegrator() != app.Notification {
+			t.Fatal("通知集成器应为启动时构造的实例")
+		}
+		steps := app.Steps()
+		index := make(map[string]int, len(steps))
+		for i, s := range steps {
+			index[s] = i
+		}
+		order := []string{"config", "self_test", "tcp_manager", "command_manager", "gateway", "notification", "verify"}
+		for i := 1; i < len(order); i++ {
+			prev, ok1 := index[order[i-1]]
+			next, ok2 := index[order[i]]
+			if !ok1 || !ok2 || prev >= next {
+				t.Fatalf("%s 应先于 %s 执行，实际步骤: %v", order[i-1], order[i], steps)
+			}
+		}
+	})
+
+	t.Run("通知启用时所有回调均已注册", func(t *testing.T) {
+		cfg := config.GetConfig()
+		saved := cfg.Notification
+		cfg.Notification.Enabled = true
+		cfg.Notification.QueueSize = 10
+		cfg.Notification.Workers = 1
+		ctx, cancel := context.WithCancel(context.Background())
+		defer func() {
+			_ = notification.StopGlobalNotificationIntegrator(context.Background())
+			cancel()
+			cfg.Notification = saved
+			_ = notification.InitGlobalNotificationIntegrator(context.Background())
+		}()
+
+		app, err := bootstrap.New(ctx, bootstrap.Options{CoreOnly: true})
+		if err != nil {
+			t.Fatalf("启动失败: %v", err)
+		}
+		expected := app.ExpectedCallbacks()
+		if len(expected) != 9 {
+			t.Fatalf("通知启用时应校验9个回调，实际 %v", expected)
+		}
+		registered := app.RegisteredCallbacks()
+		for _, name := range expected {
+			if !registered[name] {
+				t.Fatalf("回调未注册: %s", name)
+			}
+		}
+		if err := app.VerifyWiring(); err != nil {
+			t.Fatalf("装配自检失败: %v", err)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+//go:build bufpooldebug
+
+package main
+
+import (
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// TestBufferPoolPoison 调试构建下释放后的缓冲被填充毒值，重复释放/释放后访问直接panic
+// 运行：go test -tags bufpooldebug ./test -run TestBufferPoolPoison
+func TestBufferPoolPoison(t *testing.T) {
+	expectPanic := func(t *testing.T, name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%s 应触发panic", name)
+			}
+		}()
+		fn()
+	}
+
+	b := utils.GetBuffer(32)
+	retained := b.Bytes()
+	for i := range retained {
+		retained[i] = 0x01
+	}
+	b.Release()
+	for i, v := range retained {
+		if v != utils.BufferPoisonByte {
+			t.Fatalf("释放后缓冲第%d字节应为毒值，实际 0x%02X", i, v)
+		}
+	}
+
+	expectPanic(t, "释放后访问", func() { _ = b.Bytes() })
+	expectPanic(t, "重复释放", func() { b.Release() })
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/capability"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+const capabilityTestMatrix = `
+minimal: ["0x81", "0x82", "0x96"]
+rules:
+  - name: legacy
+    maxVersion: "V1.99"
+    commands: []
+  - name: standard
+    minVersion: "V2.00"
+    maxVersion: "V2.99"
+    commands: ["0x8A", "0x90", "0x91", "0x92", "0x93"]
+  - name: type05-early
+    deviceTypes: [5]
+    minVersion: "V3.00"
+    maxVersion: "V3.09"
+    commands: ["0x8A"]
+`
+
+// TestCapabilityMatrix 版本边界、回退策略、矩阵校验与热加载
+func TestCapabilityMatrix(t *testing.T) {
+	m, err := capability.ParseMatrix([]byte(capabilityTestMatrix))
+	if err != nil {
+		t.Fatalf("解析矩阵失败: %v", err)
+	}
+
+	t.Run("版本边界", func(t *testing.T) {
+		cases := []struct {
+			deviceType uint16
+			version    string
+			rule       string
+			modify     bool
+		}{
+			{0x04, "V1.99", "legacy", false},
+			{0x04, "V2.00", "standard", true},
+			{0x04, "2.00", "standard", true}, // 无前缀等价
+			{0x04, "V2.99", "standard", true},
+			{0x05, "V3.00", "type05-early", true},
+			{0x05, "V3.09", "type05-early", true},
+		}
+		for _, tc := range cases {
+			set := m.Resolve(tc.deviceType, tc.version, capability.PolicyMinimal)
+			if set.Source != capability.SourceMatrix || set.Rule != tc.rule || set.Supports(constants.CmdModifyCharge) != tc.modify {
+				t.Fatalf("%d/%s 推导错误: %+v", tc.deviceType, tc.version, set)
+			}
+			if !set.Supports(constants.CmdChargeControl) || !set.Supports(constants.CmdHeartbeat) {
+				t.Fatalf("%s 基础命令与不受约束的命令应支持", tc.version)
+			}
+		}
+		// 类型不符或超出范围：不命中任何规则
+		for _, probe := range []struct {
+			deviceType uint16
+			version    string
+		}{{0x04, "V3.00"}, {0x05, "V3.10"}} {
+			if set := m.Resolve(probe.deviceType, probe.version, capability.PolicyMinimal); set.Source != capability.SourceFallback {
+				t.Fatalf("%d/%s 不应命中规则: %+v", probe.deviceType, probe.version, set)
+			}
+		}
+	})
+
+	t.Run("未知版本回退策略", func(t *testing.T) {
+		for _, version := range []string{"", "unknown", "V9.00"} {
+			minimal := m.Resolve(0x04, version, capability.PolicyMinimal)
+			if minimal.Source != capability.SourceFallback || minimal.Policy != capability.PolicyMinimal ||
+				minimal.Supports(constants.CmdModifyCharge) || minimal.Supports(constants.CmdQueryParam1) || !minimal.Supports(constants.CmdChargeControl) {
+				t.Fatalf("%q minimal策略应仅允许基础命令: %+v", version, minimal)
+			}
+			full := m.Resolve(0x04, version, capability.PolicyFull)
+			if full.Policy != capability.PolicyFull || !full.Supports(constants.CmdModifyCharge) || !full.Supports(constants.CmdQueryParam4) || len(full.Unsupported) != 0 {
+				t.Fatalf("%q full策略应允许全部命令: %+v", version, full)
+			}
+		}
+		if _, err := capability.NewRegistry("", "optimistic", ""); err == nil {
+			t.Fatal("无效策略应拒绝")
+		}
+	})
+
+	t.Run("矩阵校验", func(t *testing.T) {
+		invalid := map[string]string{
+			"未知命令":  `{minimal: ["0xEE"]}`,
+			"命令格式":  `{minimal: ["0x1FF"]}`,
+			"范围颠倒":  `{rules: [{name: a, minVersion: "V2.10", maxVersion: "V2.01"}]}`,
+			"版本无数字": `{rules: [{name: a, minVersion: "beta"}]}`,
+			"规则重名":  `{rules: [{name: a}, {name: a}]}`,
+			"缺少规则名": `{rules: [{minVersion: "V1.00"}]}`,
+		}
+		for name, data := range invalid {
+			if _, err := capability.ParseMatrix([]byte(data)); err == nil {
+				t.Fatalf("%s 应校验失败", name)
+			}
+		}
+	})
+
+	t.Run("热加载失败保留旧矩阵", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "capabilities.yaml")
+		if err := os.WriteFile(path, []byte(capabilityTestMatrix), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := capability.NewRegistry(path, capability.PolicyMinimal, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(`{minimal: ["0xEE"]}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reload(); err == nil || r.Status().LastLoadError == "" {
+			t.Fatal("无效矩阵应加载失败并记录原因")
+		}
+		if set := r.Resolve("04B16750", 0x04, "V2.00"); set == nil || set.Rule != "standard" {
+			t.Fatalf("加载失败后应继续使用旧矩阵: %+v", set)
+		}
+		if err := os.WriteFile(path, []byte(`{minimal: ["0x82"], rules: [{name: all, minVersion: "V1.00", commands: ["0x8A"]}]}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if set := r.Resolve("04B16750", 0x04, "V1.50"); set.Rule != "all" || !set.Supports(constants.CmdModifyCharge) || r.Status().LastLoadError != "" {
+			t.Fatalf("新矩阵未生效: %+v", set)
+		}
+	})
+}
+
+// TestFirmwareCapabilityEnforcement 注册时推导能力集，API直接拒绝不支持的命令，单设备例外即时生效并持久化
+func TestFirmwareCapabilityEnforcement(t *testing.T) {
+	const deviceID = "04B16751"
+	dir := t.TempDir()
+	matrixPath := filepath.Join(dir, "capabilities.yaml")
+	if err := os.WriteFile(matrixPath, []byte(capabilityTestMatrix), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	overridesPath := filepath.Join(dir, "overrides.json")
+	registry, err := capability.NewRegistry(matrixPath, capability.PolicyFull, overridesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capability.SetGlobalRegistry(registry)
+	defer capability.SetGlobalRegistry(nil)
+
+	g := gateway.NewDeviceGateway()
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &disconnectTestConn{id: 1675001}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	defer tcpManager.UnregisterConnection(conn.id)
+	if err := tcpManager.RegisterDeviceWithDetails(conn, deviceID, deviceID, "89860400000016750001", 0x04, "V1.50"); err != nil {
+		t.Fatal(err)
+	}
+
+	detail, err := g.GetDeviceDetail(deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set, ok := detail["capabilities"].(*capability.Set); !ok || set.Rule != "legacy" || set.Supports(constants.CmdQueryParam1) {
+		t.Fatalf("设备详情应包含注册时推导的能力集: %+v", detail["capabilities"])
+	}
+
+	// 发送路径兜底：内部调用方同样不下发
+	var unsupported *capability.UnsupportedError
+	if err := g.SendCommandToDevice(deviceID, constants.CmdModifyCharge, nil); !errors.As(err, &unsupported) || unsupported.Version != "V1.50" {
+		t.Fatalf("应返回固件不支持错误: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	deviceHandlers := apihttp.NewDeviceHandlers()
+	admin := apihttp.NewAdminHandlers()
+	r.GET("/api/v1/device/:deviceId/config", deviceHandlers.HandleDeviceConfig)
+	r.PUT("/api/v1/admin/capabilities/overrides/:deviceId", admin.HandleSetCapabilityOverride)
+	r.DELETE("/api/v1/admin/capabilities/overrides/:deviceId", admin.HandleDeleteCapabilityOverride)
+	do := func(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+
+	w, data := do(http.MethodGet, "/api/v1/device/"+deviceID+"/config", nil)
+	if w.Code != http.StatusUnprocessableEntity || data["errorCode"] != capability.ErrorCodeUnsupportedByFirmware ||
+		data["command"] != "0x90" || data["firmwareVersion"] != "V1.50" {
+		t.Fatalf("老固件读取配置应直接返回 UNSUPPORTED_BY_FIRMWARE: %d %s", w.Code, w.Body.String())
+	}
+
+	// 单设备例外：现场已升级但版本上报有误
+	w, _ = do(http.MethodPut, "/api/v1/admin/capabilities/overrides/"+deviceID, map[string]interface{}{
+		"allow": []string{"90", "0x91", "0x92", "0x93"}, "deny": []string{"0x96"}, "reason": "field upgrade",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("设置例外失败: %d %s", w.Code, w.Body.String())
+	}
+	set := g.GetDeviceCapabilities(deviceID)
+	if set == nil || set.Source != capability.SourceOverride || !set.Supports(constants.CmdQueryParam1) || set.Supports(constants.CmdDeviceLocate) {
+		t.Fatalf("例外应立即作用于在线设备: %+v", set)
+	}
+	reopened, err := capability.NewRegistry(matrixPath, capability.PolicyFull, overridesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overrides := reopened.Status().Overrides; len(overrides) != 1 || overrides[0].Allow[0] != "0x90" {
+		t.Fatalf("例外应持久化: %+v", overrides)
+	}
+	if w, _ = do(http.MethodPut, "/api/v1/admin/capabilities/overrides/"+deviceID, map[string]interface{}{"allow": []string{"0xEE"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("未知命令的例外应拒绝: %d", w.Code)
+	}
+
+	if w, _ = do(http.MethodDelete, "/api/v1/admin/capabilities/overrides/"+deviceID, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除例外失败: %d %s", w.Code, w.Body.String())
+	}
+	if set := g.GetDeviceCapabilities(deviceID); set.Source != capability.SourceMatrix || set.Supports(constants.CmdQueryParam1) {
+		t.Fatalf("删除例外后应恢复矩阵结果: %+v", set)
+	}
+	if w, _ = do(http.MethodDelete, "/api/v1/admin/capabilities/overrides/"+deviceID, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("重复删除应返回404: %d", w.Code)
+	}
+
+	// 重新注册上报新版本后重新推导
+	if err := tcpManager.RegisterDeviceWithDetails(conn, deviceID, deviceID, "89860400000016750001", 0x04, "V2.00"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CheckCommandSupported(deviceID, gateway.ConfigQueryCommands()...); err != nil {
+		t.Fatalf("升级后应支持参数查询: %v", err)
+	}
+}
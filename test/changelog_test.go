@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/gin-gonic/gin"
+)
+
+// TestChangeLogRecords 脱敏、截断、有界保留、查询过滤与文件持久化
+func TestChangeLogRecords(t *testing.T) {
+	t.Run("脱敏与截断", func(t *testing.T) {
+		l := changelog.NewLog(changelog.Options{RedactFields: []string{"secret", "Token"}, MaxBodyBytes: 128})
+		body, truncated := l.PrepareBody([]byte(`{"deviceId":"04A26CF3","auth":{"token":"abc"},"items":[{"SECRET":"x"}]}`))
+		if truncated || strings.Contains(body, "abc") || strings.Contains(body, `"x"`) || !strings.Contains(body, "04A26CF3") {
+			t.Fatalf("脱敏结果错误: %s", body)
+		}
+		body, truncated = l.PrepareBody([]byte(`{"note":"` + strings.Repeat("充", 40) + `"}`))
+		if !truncated || !strings.HasSuffix(body, "...(truncated)") || len(body) > 128+len("...(truncated)") || !utf8.ValidString(body) {
+			t.Fatalf("超长请求体应截断并标注（不切断UTF-8字符）: %s", body)
+		}
+	})
+
+	t.Run("有界保留与查询", func(t *testing.T) {
+		l := changelog.NewLog(changelog.Options{Capacity: 3})
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, rec := range []changelog.Record{
+			{KeyName: "a", Endpoint: "/api/v1/charging/start", Devices: []string{"04A26CF3"}, Status: 200},
+			{KeyName: "b", Endpoint: "/api/v1/charging/stop", Devices: []string{"04A26CF3"}, Status: 200},
+			{KeyName: "a", Endpoint: "/api/v1/device/:deviceId/reboot", Devices: []string{"04A26CF4"}, Status: 500},
+			{KeyName: "a", Endpoint: "/api/v1/charging/stop", Devices: []string{"04A26CF4"}, Status: 200},
+		} {
+			rec.Timestamp = base.Add(time.Duration(i) * time.Minute)
+			l.Append(rec)
+		}
+		all := l.Query(changelog.Filter{})
+		if len(all) != 3 || all[0].ID != 4 || all[2].ID != 2 {
+			t.Fatalf("应只保留最近3条并按时间倒序: %+v", all)
+		}
+		if got := l.Query(changelog.Filter{DeviceID: "04A26CF4", KeyName: "a", Endpoint: "reboot"}); len(got) != 1 || got[0].Outcome != changelog.OutcomeFailure {
+			t.Fatalf("组合过滤错误: %+v", got)
+		}
+		if got := l.Query(changelog.Filter{From: base.Add(2 * time.Minute), To: base.Add(3 * time.Minute)}); len(got) != 2 {
+			t.Fatalf("时间范围过滤错误: %+v", got)
+		}
+	})
+
+	t.Run("文件持久化", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "changelog.jsonl")
+		ctx, cancel := context.WithCancel(context.Background())
+		l := changelog.NewLog(changelog.Options{Capacity: 2, Store: changelog.NewFileStore(path, 2), StoreType: changelog.StoreTypeFile})
+		l.Start(ctx)
+		for i := 0; i < 5; i++ {
+			l.Append(changelog.Record{KeyName: "ops", Endpoint: "/api/v1/charging/stop", Status: 200})
+		}
+		cancel()
+		restored := changelog.NewLog(changelog.Options{Capacity: 2, Store: changelog.NewFileStore(path, 2)})
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if err := restored.Restore(); err != nil {
+				t.Fatal(err)
+			}
+			if got := restored.Query(changelog.Filter{}); len(got) == 2 && got[0].ID == 5 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("重启后应恢复最近2条: %+v", restored.Query(changelog.Filter{}))
+			}
+			restored = changelog.NewLog(changelog.Options{Capacity: 2, Store: changelog.NewFileStore(path, 2)})
+			time.Sleep(10 * time.Millisecond)
+		}
+		if rec := restored.Append(changelog.Record{}); rec.ID != 6 {
+			t.Fatalf("恢复后ID应继续递增: %d", rec.ID)
+		}
+	})
+}
+
+// TestChangeLogMiddleware 变更类调用记录前后快照与结果，快照异常不影响调用，支持CSV导出
+func TestChangeLogMiddleware(t *testing.T) {
+	l := changelog.NewLog(changelog.Options{
+		RedactFields:     []string{"password"},
+		MaxSnapshotBytes: 256,
+		SnapshotTimeout:  50 * time.Millisecond,
+		ExcludeEndpoints: []string{"/api/v1/tools/parse-frame"},
+	})
+	changelog.SetGlobalLog(l)
+	defer changelog.SetGlobalLog(nil)
+
+	var mu sync.Mutex
+	portStatus := map[string]int{"04A26CF3": 0}
+	snapshotMode := "normal"
+	l.SetSnapshotter(func(deviceID string) interface{} {
+		mu.Lock()
+		mode, status := snapshotMode, portStatus[deviceID]
+		mu.Unlock()
+		switch mode {
+		case "slow":
+			time.Sleep(time.Second)
+		case "panic":
+			panic("snapshot broken")
+		case "large":
+			return map[string]string{"blob": strings.Repeat("x", 1024)}
+		}
+		return map[string]int{"port1": status}
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apihttp.CorrelationIDMiddleware(), apihttp.ChangeLogMiddleware())
+	r.POST("/api/v1/charging/start", func(c *gin.Context) {
+		var req struct {
+			DeviceID string `json:"deviceId"`
+		}
+		_ = c.ShouldBindJSON(&req)
+		mu.Lock()
+		portStatus[req.DeviceID] = 1
+		mu.Unlock()
+		c.JSON(http.StatusOK, apihttp.APIResponse{Code: 0, Message: "充电已启动"})
+	})
+	r.POST("/api/v1/device/:deviceId/reboot", func(c *gin.Context) {
+		c.JSON(http.StatusUnprocessableEntity, apihttp.APIResponse{Code: 422, Message: "设备固件不支持该功能", Data: gin.H{"errorCode": "UNSUPPORTED_BY_FIRMWARE"}})
+	})
+	r.POST("/api/v1/tools/parse-frame", func(c *gin.Context) { c.JSON(http.StatusOK, apihttp.APIResponse{}) })
+	r.GET("/api/v1/devices", func(c *gin.Context) { c.JSON(http.StatusOK, apihttp.APIResponse{}) })
+	r.GET("/api/v1/admin/changelog", apihttp.NewAdminHandlers().HandleChangeLog)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key-Name", "ops-console")
+		req.Header.Set("X-Tenant-ID", "tenant-a")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/v1/charging/start", `{"deviceId":"04A26CF3","port":1,"password":"p@ss"}`); w.Code != http.StatusOK {
+		t.Fatalf("调用失败: %d", w.Code)
+	}
+	do(http.MethodGet, "/api/v1/devices", "")
+	do(http.MethodPost, "/api/v1/tools/parse-frame", `{}`)
+	records := l.Query(changelog.Filter{})
+	if len(records) != 1 {
+		t.Fatalf("只应记录变更类且未排除的调用: %+v", records)
+	}
+	rec := records[0]
+	if rec.KeyName != "ops-console" || rec.Tenant != "tenant-a" || rec.Endpoint != "/api/v1/charging/start" ||
+		len(rec.Devices) != 1 || rec.Devices[0] != "04A26CF3" || rec.Outcome != changelog.OutcomeSuccess ||
+		rec.Message != "充电已启动" || rec.CorrelationID == "" || strings.Contains(rec.RequestBody, "p@ss") {
+		t.Fatalf("记录内容错误: %+v", rec)
+	}
+	if string(rec.Before["04A26CF3"]) != `{"port1":0}` || string(rec.After["04A26CF3"]) != `{"port1":1}` {
+		t.Fatalf("应记录调用前后快照: before=%s after=%s", rec.Before["04A26CF3"], rec.After["04A26CF3"])
+	}
+
+	// 快照超时/异常/超长：调用照常完成，记录标注原因
+	for _, mode := range []string{"slow", "panic", "large"} {
+		mu.Lock()
+		snapshotMode = mode
+		mu.Unlock()
+		start := time.Now()
+		w := do(http.MethodPost, "/api/v1/device/a26cf3/reboot", "")
+		if w.Code != http.StatusUnprocessableEntity || time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("%s: 快照不应阻塞或改变调用结果: %d %s", mode, w.Code, time.Since(start))
+		}
+		rec := l.Query(changelog.Filter{Limit: 1})[0]
+		if rec.Devices[0] != "04A26CF3" || rec.Outcome != changelog.OutcomeFailure || !strings.Contains(rec.Message, "UNSUPPORTED_BY_FIRMWARE") {
+			t.Fatalf("%s: 记录错误: %+v", mode, rec)
+		}
+		switch mode {
+		case "slow", "panic":
+			if rec.SnapshotError == "" || rec.Before != nil {
+				t.Fatalf("%s: 应记录快照失败原因: %+v", mode, rec)
+			}
+		case "large":
+			if !rec.SnapshotTruncated || !strings.HasSuffix(strings.Trim(string(rec.After["04A26CF3"]), `"`), "(truncated)") {
+				t.Fatalf("超长快照应截断并标注: %+v", rec)
+			}
+		}
+	}
+
+	w := do(http.MethodGet, "/api/v1/admin/changelog?deviceId=04A26CF3&key=ops-console&endpoint=charging", "")
+	var resp struct {
+		Data struct {
+			Records []changelog.Record `json:"records"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Data.Records) != 1 {
+		t.Fatalf("查询结果错误: %s", w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/api/v1/admin/changelog?format=csv", "")
+	rows, err := csv.NewReader(bytes.NewReader(w.Body.Bytes())).ReadAll()
+	if err != nil || len(rows) != 5 || rows[0][0] != "id" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("CSV导出错误: %v %d", err, len(rows))
+	}
+}
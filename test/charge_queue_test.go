@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// TestChargeQueue 设备侧排队（待充端口位图）状态流转测试
+func TestChargeQueue(t *testing.T) {
+	const (
+		deviceID = "04A26CF3"
+		port     = 1
+		orderNo  = "ORDER_QUEUE_001"
+	)
+
+	newGateway := func(t *testing.T, autoCancel bool) (*gateway.DeviceGateway, chan gateway.ChargeQueueEvent) {
+		g := gateway.NewDeviceGateway()
+		g.GetChargeQueue().SetConfig(config.ChargeQueueConfig{Enabled: true, TimeoutSeconds: 60, AutoCancel: autoCancel})
+		events := make(chan gateway.ChargeQueueEvent, 4)
+		g.GetChargeQueue().RegisterHandler(func(e gateway.ChargeQueueEvent) { events <- e })
+
+		om := g.GetOrderManager()
+		if err := om.CreateOrder(deviceID, port, orderNo, 0, 3600, 1000); err != nil {
+			t.Fatalf("创建订单失败: %v", err)
+		}
+		_ = om.UpdateOrderStatus(deviceID, port, gateway.OrderStatusCharging, "充电命令发送成功")
+		return g, events
+	}
+
+	expectEvent := func(t *testing.T, events chan gateway.ChargeQueueEvent, eventType string) gateway.ChargeQueueEvent {
+		select {
+		case e := <-events:
+			if e.Type != eventType {
+				t.Fatalf("事件类型错误: 期望 %s, 实际 %s", eventType, e.Type)
+			}
+			return e
+		default:
+			t.Fatalf("未收到 %s 事件", eventType)
+		}
+		return gateway.ChargeQueueEvent{}
+	}
+
+	t.Run("待充端口位图判定", func(t *testing.T) {
+		if gateway.IsPortQueued(0, 0) {
+			t.Fatal("位图为0不应视为排队")
+		}
+		if !gateway.IsPortQueued(0, 0x0001) {
+			t.Fatal("bit0对应协议端口0，应视为排队")
+		}
+		if gateway.IsPortQueued(1, 0x0001) {
+			t.Fatal("其他端口排队不应影响本端口")
+		}
+		if !gateway.IsPortQueued(0xFF, 0x0002) {
+			t.Fatal("智能选择端口时位图非0应视为排队")
+		}
+	})
+
+	t.Run("排队→开始充电", func(t *testing.T) {
+		g, events := newGateway(t, false)
+
+		charge := g.MarkChargeQueued(deviceID, port, orderNo, 0x0003, "req-queue-1")
+		if len(charge.WaitingPorts) != 2 || charge.WaitingPorts[0] != 1 || charge.WaitingPorts[1] != 2 {
+			t.Fatalf("待充端口展开错误: %v", charge.WaitingPorts)
+		}
+		e := expectEvent(t, events, gateway.ChargeQueueEventQueued)
+		if e.Charge.CorrelationID != "req-queue-1" {
+			t.Fatalf("排队事件应携带链路追踪ID，实际 %q", e.Charge.CorrelationID)
+		}
+		if order := g.GetOrderManager().GetOrder(deviceID, port); order == nil || order.Status != gateway.OrderStatusQueued {
+			t.Fatalf("订单应为queued状态: %+v", order)
+		}
+		sm := g.GetStateMachineManager().GetStateMachine(deviceID, port)
+		if sm == nil || !sm.IsQueued() {
+			t.Fatal("状态机应处于queued状态")
+		}
+
+		if g.OnPortStatusReport(deviceID, port, 0) {
+			t.Fatal("端口空闲上报不应结束排队")
+		}
+		if !g.OnPortStatusReport(deviceID, port, 1) {
+			t.Fatal("端口充电中上报应结束排队")
+		}
+		expectEvent(t, events, gateway.ChargeQueueEventStarted)
+
+		if order := g.GetOrderManager().GetOrder(deviceID, port); order == nil || order.Status != gateway.OrderStatusCharging {
+			t.Fatalf("订单应转为charging状态: %+v", order)
+		}
+		if sm.GetCurrentState() != gateway.StateCharging {
+			t.Fatalf("状态机应转为charging，实际 %s", sm.GetCurrentState())
+		}
+		if _, ok := g.GetChargeQueue().Get(deviceID, port); ok {
+			t.Fatal("开始充电后应移除排队记录")
+		}
+		if g.OnPortStatusReport(deviceID, port, 1) {
+			t.Fatal("重复上报不应再次触发转换")
+		}
+	})
+
+	t.Run("排队→超时自动取消", func(t *testing.T) {
+		g, events := newGateway(t, true)
+
+		charge := g.MarkChargeQueued(deviceID, port, orderNo, 0x0001, "req-queue-2")
+		expectEvent(t, events, gateway.ChargeQueueEventQueued)
+
+		if fired := g.CheckChargeQueueTimeouts(charge.QueuedAt.Add(30 * time.Second)); len(fired) != 0 {
+			t.Fatalf("未到超时时间不应触发: %d", len(fired))
+		}
+		fired := g.CheckChargeQueueTimeouts(charge.QueuedAt.Add(2 * time.Minute))
+		if len(fired) != 1 || !fired[0].AutoCancelled {
+			t.Fatalf("超时应触发一次自动取消: %+v", fired)
+		}
+		e := expectEvent(t, events, gateway.ChargeQueueEventTimeout)
+		if e.Waited < time.Minute {
+			t.Fatalf("等待时长错误: %s", e.Waited)
+		}
+
+		if order := g.GetOrderManager().GetOrder(deviceID, port); order != nil {
+			t.Fatalf("自动取消后订单应被清理: %+v", order)
+		}
+		if sm := g.GetStateMachineManager().GetStateMachine(deviceID, port); sm != nil {
+			t.Fatal("自动取消后状态机应被移除")
+		}
+		if g.OnPortStatusReport(deviceID, port, 1) {
+			t.Fatal("取消后的排队不应再转换为充电")
+		}
+	})
+
+	t.Run("排队→超时仅告警", func(t *testing.T) {
+		g, events := newGateway(t, false)
+
+		charge := g.MarkChargeQueued(deviceID, port, orderNo, 0x0001, "")
+		expectEvent(t, events, gateway.ChargeQueueEventQueued)
+
+		if fired := g.CheckChargeQueueTimeouts(charge.QueuedAt.Add(2 * time.Minute)); len(fired) != 1 || fired[0].AutoCancelled {
+			t.Fatalf("超时应仅告警不取消: %+v", fired)
+		}
+		expectEvent(t, events, gateway.ChargeQueueEventTimeout)
+		if fired := g.CheckChargeQueueTimeouts(charge.QueuedAt.Add(3 * time.Minute)); len(fired) != 0 {
+			t.Fatal("同一排队请求不应重复告警")
+		}
+
+		queued, ok := g.GetChargeQueue().Get(deviceID, port)
+		if !ok || !queued.TimedOut {
+			t.Fatal("未自动取消时应保留排队记录并标记超时")
+		}
+		if !g.OnPortStatusReport(deviceID, port, 1) {
+			t.Fatal("超时告警后设备开始充电仍应转换状态")
+		}
+		expectEvent(t, events, gateway.ChargeQueueEventStarted)
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/chargestats"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/gin-gonic/gin"
+)
+
+// chargeStatsAt 以假时钟创建统计（统计起点为 start）
+func chargeStatsAt(t *testing.T, loc *time.Location, start time.Time) (*chargestats.Aggregator, *slaClock) {
+	t.Helper()
+	clock := &slaClock{now: start}
+	agg := chargestats.New(chargestats.Options{Location: loc})
+	agg.SetNowFunc(clock.Now)
+	return agg, clock
+}
+
+// chargeSession 一次完整的充电：开始、完成与结算
+func chargeSession(agg *chargestats.Aggregator, tenant, orderNo, deviceID string, start, end time.Time, energyWh uint32) {
+	agg.RecordOrder(chargestats.OrderEvent{OrderNo: orderNo, DeviceID: deviceID, TenantID: tenant, Status: chargestats.StatusCharging, StartTime: start})
+	agg.RecordOrder(chargestats.OrderEvent{OrderNo: orderNo, DeviceID: deviceID, TenantID: tenant, Status: chargestats.StatusCompleted, StartTime: start, EndTime: end})
+	agg.RecordSettlement(chargestats.SettlementEvent{OrderNo: orderNo, DeviceID: deviceID, TenantID: tenant, EnergyWh: energyWh, StartTime: start, EndTime: end, ReceivedAt: end})
+}
+
+// TestChargeStatsDaylightSaving 时间桶按本地整点与自然日对齐：夏令时回拨时重复的本地小时是两个桶，切换日的天桶为25/23小时
+func TestChargeStatsDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg, clock := chargeStatsAt(t, loc, time.Date(2024, 3, 1, 0, 0, 0, 0, loc))
+	clock.Advance(250 * 24 * time.Hour) // 2024-11-06
+
+	// 2024-11-03 01:30 出现两次（EDT 与 EST）
+	firstPass := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)
+	secondPass := time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC)
+	chargeSession(agg, "tenant-a", "DST001", "04A20001", firstPass, firstPass.Add(20*time.Minute), 1000)
+	chargeSession(agg, "tenant-a", "DST002", "04A20002", secondPass, secondPass.Add(20*time.Minute), 3000)
+
+	hours, err := agg.Query(chargestats.Query{
+		Bucket: chargestats.BucketHour,
+		From:   time.Date(2024, 11, 3, 0, 0, 0, 0, loc),
+		To:     time.Date(2024, 11, 3, 4, 0, 0, 0, loc),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLabels := []string{"2024-11-03T00:00:00-04:00", "2024-11-03T01:00:00-04:00", "2024-11-03T01:00:00-05:00", "2024-11-03T02:00:00-05:00", "2024-11-03T03:00:00-05:00"}
+	if len(hours.Labels) != len(wantLabels) {
+		t.Fatalf("回拨日 00:00-04:00 应有5个小时桶: %v", hours.Labels)
+	}
+	for i, label := range wantLabels {
+		if hours.Labels[i] != label || hours.BucketSeconds[i] != 3600 || hours.Partial[i] {
+			t.Fatalf("第%d个小时桶错误: %s %d %v", i, hours.Labels[i], hours.BucketSeconds[i], hours.Partial[i])
+		}
+	}
+	if hours.Started[1] != 1 || hours.Started[2] != 1 || hours.EnergyWh[1] != 1000 || hours.EnergyWh[2] != 3000 {
+		t.Fatalf("重复的本地小时应分别计数: started=%v energy=%v", hours.Started, hours.EnergyWh)
+	}
+
+	days, err := agg.Query(chargestats.Query{
+		Bucket: chargestats.BucketDay,
+		From:   time.Date(2024, 11, 2, 12, 0, 0, 0, loc),
+		To:     time.Date(2024, 11, 5, 0, 0, 0, 0, loc),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days.Timestamps) != 3 || days.BucketSeconds[0] != 86400 || days.BucketSeconds[1] != 90000 || days.BucketSeconds[2] != 86400 {
+		t.Fatalf("回拨日应为25小时的天桶: %v %v", days.Labels, days.BucketSeconds)
+	}
+	if days.Labels[1] != "2024-11-03T00:00:00-04:00" || days.Completed[1] != 2 || days.EnergyWh[1] != 4000 ||
+		days.AvgEnergyWh[1] != 2000 || days.AvgDurationSeconds[1] != 1200 || days.UniqueDevices[1] != 2 {
+		t.Fatalf("回拨日天桶统计错误: %+v", days)
+	}
+
+	// 2024-03-10 02:00 跳到 03:00：天桶23小时，00:00-04:00 只有3个小时桶
+	spring, err := agg.Query(chargestats.Query{
+		Bucket: chargestats.BucketHour,
+		From:   time.Date(2024, 3, 10, 0, 0, 0, 0, loc),
+		To:     time.Date(2024, 3, 10, 4, 0, 0, 0, loc),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spring.Labels) != 3 || spring.Labels[2] != "2024-03-10T03:00:00-04:00" {
+		t.Fatalf("拨快日 00:00-04:00 应有3个小时桶: %v", spring.Labels)
+	}
+	springDay, err := agg.Query(chargestats.Query{
+		Bucket: chargestats.BucketDay,
+		From:   time.Date(2024, 3, 10, 0, 0, 0, 0, loc),
+		To:     time.Date(2024, 3, 11, 0, 0, 0, 0, loc),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(springDay.BucketSeconds) != 1 || springDay.BucketSeconds[0] != 82800 {
+		t.Fatalf("拨快日应为23小时的天桶: %v", springDay.BucketSeconds)
+	}
+}
+
+// TestChargeStatsEmptyBucketsAndPartial 没有数据的桶返回0而非省略；当前桶与早于统计起点的桶标记 partial；重复通知与重复结算只计一次
+func TestChargeStatsEmptyBucketsAndPartial(t *testing.T) {
+	day := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	agg, clock := chargeStatsAt(t, time.UTC, day.Add(5*time.Hour))
+	clock.Advance(5*time.Hour + 30*time.Minute) // 10:30
+
+	chargeSession(agg, "tenant-a", "EB001", "04A20011", day.Add(7*time.Hour+10*time.Minute), day.Add(7*time.Hour+40*time.Minute), 2000)
+	chargeSession(agg, "tenant-a", "EB001", "04A20011", day.Add(7*time.Hour+10*time.Minute), day.Add(7*time.Hour+40*time.Minute), 9999) // 重复通知与不同载荷的结算
+	chargeSession(agg, "tenant-b", "EB002", "04A20012", day.Add(9*time.Hour+50*time.Minute), day.Add(10*time.Hour+5*time.Minute), 500)
+	agg.RecordOrder(chargestats.OrderEvent{OrderNo: "EB003", DeviceID: "04A20011", TenantID: "tenant-a", Status: chargestats.StatusFailed, UpdatedAt: day.Add(10 * time.Hour)})
+	agg.RecordOrder(chargestats.OrderEvent{OrderNo: "EB004", DeviceID: "04A20013", Status: chargestats.StatusCancelled, UpdatedAt: day.Add(10 * time.Hour)})
+	agg.RecordOrder(chargestats.OrderEvent{OrderNo: "EB005", DeviceID: "04A20013", Status: "pending"})
+
+	all, err := agg.Query(chargestats.Query{Bucket: chargestats.BucketHour, From: day.Add(4 * time.Hour), To: day.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Timestamps) != 7 || all.Timestamps[0] != day.Add(4*time.Hour).Unix() || all.To != day.Add(11*time.Hour) {
+		t.Fatalf("结束时间晚于当前时间时应截止到当前桶: %v to=%v", all.Labels, all.To)
+	}
+	for _, series := range [][]uint64{all.Started, all.Completed, all.Failed, all.Cancelled, all.Interrupted, all.Settled, all.EnergyWh} {
+		if len(series) != len(all.Timestamps) {
+			t.Fatalf("序列长度应与时间桶对齐: %d != %d", len(series), len(all.Timestamps))
+		}
+	}
+	wantStarted := []uint64{0, 0, 0, 1, 0, 1, 0}
+	wantEnergy := []uint64{0, 0, 0, 2000, 0, 0, 500}
+	wantPartial := []bool{true, false, false, false, false, false, true}
+	for i := range all.Timestamps {
+		if all.Started[i] != wantStarted[i] || all.EnergyWh[i] != wantEnergy[i] || all.Partial[i] != wantPartial[i] {
+			t.Fatalf("第%d个桶错误: started=%v energy=%v partial=%v", i, all.Started, all.EnergyWh, all.Partial)
+		}
+	}
+	if all.AvgEnergyWh[4] != 0 || all.UniqueDevices[4] != 0 || all.UniqueDevices[6] != 3 {
+		t.Fatalf("空桶均值应为0，当前桶设备去重: avg=%v devices=%v", all.AvgEnergyWh, all.UniqueDevices)
+	}
+	totals := all.Totals
+	if totals.Started != 2 || totals.Completed != 2 || totals.Failed != 1 || totals.Cancelled != 1 || totals.Settled != 2 ||
+		totals.EnergyWh != 2500 || totals.AvgEnergyWh != 1250 || totals.AvgDurationSeconds != 1350 || totals.UniqueDevices != 3 {
+		t.Fatalf("合计错误: %+v", totals)
+	}
+
+	tenantA, err := agg.Query(chargestats.Query{Tenant: "tenant-a", Bucket: chargestats.BucketDay, From: day, To: day.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenantA.Timestamps) != 1 || !tenantA.Partial[0] || tenantA.Totals.Started != 1 || tenantA.Totals.Failed != 1 || tenantA.Totals.EnergyWh != 2000 || tenantA.Totals.UniqueDevices != 1 {
+		t.Fatalf("租户统计错误: %+v", tenantA.Totals)
+	}
+	unassigned, _ := agg.Query(chargestats.Query{Tenant: chargestats.UnassignedTenant, Bucket: chargestats.BucketDay, From: day})
+	if unassigned.Totals.Cancelled != 1 {
+		t.Fatalf("未标注租户的设备应计入 %s: %+v", chargestats.UnassignedTenant, unassigned.Totals)
+	}
+	unknown, err := agg.Query(chargestats.Query{Tenant: "tenant-none", Bucket: chargestats.BucketHour, From: day.Add(8 * time.Hour)})
+	if err != nil || len(unknown.Timestamps) != 3 || unknown.Totals.Started != 0 || unknown.Started[0] != 0 {
+		t.Fatalf("没有数据的租户应返回全0序列: %+v %v", unknown, err)
+	}
+
+	if _, err := agg.Query(chargestats.Query{Bucket: "week", From: day}); err != chargestats.ErrInvalidBucket {
+		t.Fatalf("无效时间桶应报错: %v", err)
+	}
+	if _, err := agg.Query(chargestats.Query{Bucket: chargestats.BucketHour, From: day.Add(12 * time.Hour)}); err != chargestats.ErrInvalidRange {
+		t.Fatalf("起点晚于当前时间应报错: %v", err)
+	}
+	if _, err := agg.Query(chargestats.Query{Bucket: chargestats.BucketHour, From: day.AddDate(-1, 0, 0)}); err == nil {
+		t.Fatal("时间桶超过上限应报错")
+	}
+}
+
+// TestChargeStatsSnapshot 汇总保存到快照后重启恢复，订单去重标记一并恢复
+func TestChargeStatsSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "charge_stats.json")
+	day := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	clock := &slaClock{now: day}
+	agg := chargestats.New(chargestats.Options{Location: time.UTC, SnapshotFile: file})
+	agg.SetNowFunc(clock.Now)
+	clock.Advance(12 * time.Hour)
+	chargeSession(agg, "tenant-a", "SN001", "04A20021", day.Add(8*time.Hour), day.Add(9*time.Hour), 1500)
+	if err := agg.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := chargestats.New(chargestats.Options{Location: time.UTC, SnapshotFile: file})
+	restored.SetNowFunc(clock.Now)
+	restored.RecordSettlement(chargestats.SettlementEvent{OrderNo: "SN001", DeviceID: "04A20021", TenantID: "tenant-a", EnergyWh: 1500, EndTime: day.Add(9 * time.Hour)})
+	series, err := restored.Query(chargestats.Query{Tenant: "tenant-a", Bucket: chargestats.BucketHour, From: day})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series.Totals.Started != 1 || series.Totals.Completed != 1 || series.Totals.EnergyWh != 1500 || !series.CoverageStart.Equal(day) || series.Partial[0] {
+		t.Fatalf("快照恢复错误: %+v coverage=%v", series.Totals, series.CoverageStart)
+	}
+
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	other := chargestats.New(chargestats.Options{Location: shanghai, SnapshotFile: file})
+	if st := other.Stats(); len(st.Tenants) != 0 {
+		t.Fatalf("时区不一致的快照不应恢复: %+v", st)
+	}
+}
+
+// TestChargeStatsSettlementStore 结算日志存储的新结算回调计入电量；设备重发的相同结算不回调
+func TestChargeStatsSettlementStore(t *testing.T) {
+	store, err := settlement.Open(config.SettlementStoreConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	agg := chargestats.New(chargestats.Options{Location: time.UTC})
+	store.RegisterAppendHandler(func(rec settlement.Record) {
+		agg.RecordSettlement(chargestats.SettlementEvent{OrderNo: rec.OrderNo, DeviceID: rec.DeviceID, EnergyWh: rec.EnergyWh, StartTime: rec.StartTime, EndTime: rec.EndTime, ReceivedAt: rec.ReceivedAt})
+	})
+	if store.AppendHandlerCount() != 1 {
+		t.Fatal("回调未注册")
+	}
+	end := time.Now().Truncate(time.Second)
+	rec := settlement.Record{OrderNo: "ST001", DeviceID: "04A20031", EnergyWh: 800, StartTime: end.Add(-30 * time.Minute), EndTime: end, Payload: []byte{0x01}}
+	for i := 0; i < 2; i++ {
+		if _, _, err := store.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	series, err := agg.Query(chargestats.Query{Tenant: chargestats.UnassignedTenant, Bucket: chargestats.BucketDay, From: end.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series.Totals.Settled != 1 || series.Totals.EnergyWh != 800 || series.Totals.AvgDurationSeconds != 1800 {
+		t.Fatalf("结算计入错误: %+v", series.Totals)
+	}
+}
+
+// TestChargingStatsEndpoint GET /api/v1/stats/charging：未启用时503；参数错误400；租户范围请求头限定查询租户
+func TestChargingStatsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	chargestats.SetGlobalAggregator(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/stats/charging", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用时应返回503: %d", w.Code)
+	}
+
+	agg := chargestats.New(chargestats.Options{Location: time.UTC})
+	chargestats.SetGlobalAggregator(agg)
+	defer chargestats.SetGlobalAggregator(nil)
+	now := time.Now()
+	chargeSession(agg, "tenant-a", "EP001", "04A20041", now.Add(-10*time.Minute), now.Add(-time.Minute), 1200)
+	chargeSession(agg, "tenant-b", "EP002", "04A20042", now.Add(-10*time.Minute), now.Add(-time.Minute), 700)
+
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/stats/charging?bucket=week", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效时间桶应返回400: %d", w.Code)
+	}
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/stats/charging", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("查询失败: %d %s", w.Code, w.Body.String())
+	}
+	var series chargestats.Series
+	raw, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(raw, &series); err != nil {
+		t.Fatal(err)
+	}
+	if series.Bucket != chargestats.BucketHour || len(series.Timestamps) < 24 || !series.Partial[len(series.Partial)-1] || series.Totals.EnergyWh != 1900 {
+		t.Fatalf("默认最近24小时的小时桶: %d buckets, totals=%+v", len(series.Timestamps), series.Totals)
+	}
+
+	scoped := func(path, tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := scoped("/api/v1/stats/charging?tenant=tenant-b", "tenant-a"); w.Code != http.StatusForbidden {
+		t.Fatalf("查询其他租户应返回403: %d", w.Code)
+	}
+	w = scoped("/api/v1/stats/charging?bucket=day", "tenant-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("查询失败: %d %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data chargestats.Series `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.Tenant != "tenant-a" || body.Data.Totals.EnergyWh != 1200 {
+		t.Fatalf("租户范围请求头应限定为本租户: tenant=%s totals=%+v", body.Data.Tenant, body.Data.Totals)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+	"github.com/gin-gonic/gin"
+)
+
+// frameCaptureConn 记录写入帧的连接桩
+type frameCaptureConn struct {
+	disconnectTestConn
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+func (c *frameCaptureConn) GetConnection() net.Conn    { return nil }
+func (c *frameCaptureConn) GetTCPConnection() net.Conn { return &frameCaptureNetConn{owner: c} }
+func (c *frameCaptureConn) Stop()                      {}
+
+func (c *frameCaptureConn) take() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	frames := c.frames
+	c.frames = nil
+	return frames
+}
+
+type frameCaptureNetConn struct {
+	net.Conn
+	owner *frameCaptureConn
+}
+
+func (c *frameCaptureNetConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *frameCaptureNetConn) Write(b []byte) (int, error) {
+	c.owner.mu.Lock()
+	c.owner.frames = append(c.owner.frames, append([]byte(nil), b...))
+	c.owner.mu.Unlock()
+	return len(b), nil
+}
+
+// TestChargingDryRun 试运行走完整校验但不下发、不创建会话、不占用消息ID，返回的帧与真实请求下发的帧一致
+func TestChargingDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shortConfirmTimeout(t)
+	const deviceID = "04B16860"
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &frameCaptureConn{disconnectTestConn: disconnectTestConn{id: 1686001}}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, deviceID, deviceID, "89860400000016860001"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcpManager.UnregisterConnection(conn.id) })
+	g := gateway.GetGlobalDeviceGateway()
+
+	h := apihttp.NewChargingHandlers()
+	r := gin.New()
+	r.POST("/api/v1/charging/start", h.HandleStartCharging)
+	r.POST("/api/v1/charging/stop", h.HandleStopCharging)
+	r.POST("/api/v1/charging/update_power", h.HandleUpdateChargingPower)
+	do := func(path, body string) (int, http.Header, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, w.Header(), resp.Data
+	}
+	// dryRun 发起试运行并断言未下发任何帧，返回试运行构造的帧
+	dryRun := func(path, body string, wantChecks ...string) []byte {
+		t.Helper()
+		before := msgid.GetGlobalSequence().Current()
+		code, header, data := do(path, body)
+		if code != http.StatusOK || data["dryRun"] != true || header.Get("X-Dry-Run") != "true" {
+			t.Fatalf("试运行失败: %d %+v", code, data)
+		}
+		if frames := conn.take(); len(frames) != 0 {
+			t.Fatalf("试运行不应下发帧: %d", len(frames))
+		}
+		if msgid.GetGlobalSequence().Current() != before {
+			t.Fatal("试运行不应占用消息ID")
+		}
+		var names []string
+		for _, c := range data["checks"].([]interface{}) {
+			check := c.(map[string]interface{})
+			if check["passed"] != true {
+				t.Fatalf("检查应通过: %+v", check)
+			}
+			names = append(names, check["name"].(string))
+		}
+		if strings.Join(names, ",") != strings.Join(wantChecks, ",") {
+			t.Fatalf("检查项错误: %v", names)
+		}
+		packet, err := hex.DecodeString(data["packet"].(map[string]interface{})["packetHex"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+	// sent 真实请求下发的唯一一帧
+	sent := func(path, body string) []byte {
+		t.Helper()
+		if code, _, data := do(path, body); code != http.StatusOK || data["dryRun"] != nil {
+			t.Fatalf("真实请求失败: %d %+v", code, data)
+		}
+		frames := conn.take()
+		if len(frames) != 1 {
+			t.Fatalf("真实请求应下发一帧: %d", len(frames))
+		}
+		return frames[0]
+	}
+	statsBefore := apihttp.GetChargingDryRunStats()
+
+	startBody := `{"deviceId":"` + deviceID + `","port":2,"mode":0,"value":3600,"orderNo":"ORDER_DRY_1","balance":500`
+	preview := dryRun("/api/v1/charging/start", startBody+`,"dryRun":true}`,
+		"params", "charging_policy", "device_online", "firmware_support", "order_conflict", "charge_queue", "command_build")
+	if order := g.GetOrderManager().GetOrder(deviceID, 2); order != nil {
+		t.Fatalf("试运行不应创建会话: %+v", order)
+	}
+	// 试运行不占用订单：同一订单的真实请求正常下发，帧与试运行一致
+	if frame := sent("/api/v1/charging/start", startBody+`}`); !bytes.Equal(frame, preview) {
+		t.Fatalf("真实下发帧应与试运行一致:\n%X\n%X", frame, preview)
+	}
+
+	powerBody := `{"deviceId":"` + deviceID + `","port":2,"orderNo":"ORDER_DRY_1","overloadPowerW":1200}`
+	preview = dryRun("/api/v1/charging/update_power?dryRun=true", powerBody,
+		"params", "charging_policy", "device_online", "firmware_support", "order_match", "command_build")
+	time.Sleep(500 * time.Millisecond) // 同设备发送节流
+	if frame := sent("/api/v1/charging/update_power", powerBody); !bytes.Equal(frame, preview) {
+		t.Fatalf("调整功率下发帧应与试运行一致:\n%X\n%X", frame, preview)
+	}
+
+	stopBody := `{"deviceId":"` + deviceID + `","port":2,"orderNo":"ORDER_DRY_1"`
+	preview = dryRun("/api/v1/charging/stop", stopBody+`,"dryRun":true}`,
+		"params", "device_online", "order_match", "firmware_support", "command_build")
+	time.Sleep(500 * time.Millisecond)
+	if frame := sent("/api/v1/charging/stop", stopBody+`}`); !bytes.Equal(frame, preview) {
+		t.Fatalf("停止充电下发帧应与试运行一致:\n%X\n%X", frame, preview)
+	}
+
+	// 校验失败的试运行返回与真实请求相同的错误并单独计数
+	code, header, _ := do("/api/v1/charging/start", `{"deviceId":"04B16861","port":1,"mode":0,"value":60,"orderNo":"ORDER_DRY_2","balance":100,"dryRun":true}`)
+	if code != http.StatusServiceUnavailable || header.Get("X-Dry-Run") != "true" {
+		t.Fatalf("离线设备试运行应返回503: %d", code)
+	}
+	stats := apihttp.GetChargingDryRunStats()
+	if stats.Total-statsBefore.Total != 4 || stats.Passed-statsBefore.Passed != 3 || stats.Rejected-statsBefore.Rejected != 1 ||
+		stats.ByAction["start"]-statsBefore.ByAction["start"] != 2 || stats.ByAction["stop"]-statsBefore.ByAction["stop"] != 1 {
+		t.Fatalf("试运行计数错误: %+v -> %+v", statsBefore, stats)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/chargepolicy"
+	"github.com/gin-gonic/gin"
+)
+
+const testChargingPolicy = `
+warnBandPercent: 20
+defaults:
+  chargeDuration: 36000
+  maxPower: 7000
+  balance: 100000
+  rateModes: [0, 1]
+tenants:
+  residential:
+    chargeDuration: 28800
+    maxPower: 3500
+    rateModes: [0]
+`
+
+// TestChargingPolicy 边界值、告警带、租户覆盖全局、热加载失败保留旧策略与计数
+func TestChargingPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "charging_policy.yaml")
+	if err := os.WriteFile(path, []byte(testChargingPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := chargepolicy.NewChecker(path)
+	if err != nil {
+		t.Fatalf("加载策略失败: %v", err)
+	}
+
+	t.Run("边界值", func(t *testing.T) {
+		if r := c.Check("", chargepolicy.Params{ChargeDuration: 36000}); !r.OK() || len(r.Warnings) != 1 {
+			t.Fatalf("等于上限应放行并告警: %+v", r)
+		}
+		if r := c.Check("", chargepolicy.Params{ChargeDuration: 36001}); r.OK() || r.Violations[0].Limit != chargepolicy.LimitChargeDuration || r.Violations[0].Max != 36000 {
+			t.Fatalf("超过上限应拒绝: %+v", r)
+		}
+		// 告警阈值 = 36000 × 80% = 28800
+		if r := c.Check("", chargepolicy.Params{ChargeDuration: 28800}); !r.OK() || len(r.Warnings) != 0 {
+			t.Fatalf("等于告警阈值不应告警: %+v", r)
+		}
+		if r := c.Check("", chargepolicy.Params{ChargeDuration: 28801}); len(r.Warnings) != 1 || r.Warnings[0].WarnAt != 28800 {
+			t.Fatalf("超过告警阈值应告警: %+v", r)
+		}
+		if r := c.Check("", chargepolicy.Params{MaxChargeDuration: 99999}); !r.OK() || len(r.Warnings) != 0 {
+			t.Fatalf("未配置的项不限: %+v", r)
+		}
+	})
+
+	t.Run("租户覆盖全局", func(t *testing.T) {
+		mode := uint8(1)
+		r := c.Check("residential", chargepolicy.Params{ChargeDuration: 30000, MaxPower: 3600, Balance: 100000, RateMode: &mode})
+		if r.OK() || len(r.Violations) != 3 || r.TenantID != "residential" {
+			t.Fatalf("租户限制应生效: %+v", r)
+		}
+		for _, v := range r.Violations {
+			if v.Scope != chargepolicy.ScopeTenant {
+				t.Fatalf("违反的应为租户限制: %+v", v)
+			}
+		}
+		if len(r.Warnings) != 1 || r.Warnings[0].Limit != chargepolicy.LimitBalance || r.Warnings[0].Scope != chargepolicy.ScopeGlobal {
+			t.Fatalf("租户未覆盖的项应继承全局: %+v", r.Warnings)
+		}
+		if r := c.Check("other", chargepolicy.Params{ChargeDuration: 30000, MaxPower: 3600, RateMode: &mode}); !r.OK() || r.TenantID != "" {
+			t.Fatalf("未配置的租户应回退全局: %+v", r)
+		}
+	})
+
+	t.Run("热加载失败保留旧策略", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("warnBandPercent: 120\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Reload(); err == nil {
+			t.Fatal("无效策略应加载失败")
+		}
+		if st := c.Status(); st.LastLoadError == "" || st.Global.Limits[chargepolicy.LimitMaxPower].Max != 7000 {
+			t.Fatalf("应保留旧策略并记录错误: %+v", st)
+		}
+		if err := os.WriteFile(path, []byte("defaults:\n  maxPower: 5000\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Reload(); err != nil {
+			t.Fatalf("热加载失败: %v", err)
+		}
+		if r := c.Check("residential", chargepolicy.Params{MaxPower: 5001}); r.OK() || r.Violations[0].Scope != chargepolicy.ScopeGlobal {
+			t.Fatalf("新策略应生效: %+v", r)
+		}
+	})
+
+	st := c.Status()
+	if st.Stats.Rejected == 0 || st.Stats.Warned == 0 || st.Stats.ByLimit[chargepolicy.LimitChargeDuration].Rejected != 2 {
+		t.Fatalf("计数错误: %+v", st.Stats)
+	}
+}
+
+// TestChargingPolicyAPI 超限请求以 VALIDATION_FAILED 拒绝，策略只读接口返回生效限制
+func TestChargingPolicyAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p, err := chargepolicy.ParsePolicy([]byte(testChargingPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := chargepolicy.NewChecker("")
+	if err := c.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	chargepolicy.SetGlobalChecker(c)
+	defer chargepolicy.SetGlobalChecker(nil)
+
+	h := apihttp.NewChargingHandlers()
+	r := gin.New()
+	r.POST("/api/v1/charging/start", h.HandleStartCharging)
+	r.POST("/api/v1/charging/update_power", h.HandleUpdateChargingPower)
+	r.GET("/api/v1/policies/charging", h.HandleChargingPolicy)
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	// 策略内的请求通过校验后因设备离线失败
+	code, data := do(http.MethodPost, "/api/v1/charging/start", `{"deviceId":"04A26CF3","port":1,"mode":0,"value":9999,"orderNo":"ORDER_P1","balance":100,"tenantId":"residential"}`)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("策略内请求不应被拒绝: %d %+v", code, data)
+	}
+	code, data = do(http.MethodPost, "/api/v1/charging/start", `{"deviceId":"04A26CF3","port":1,"mode":0,"value":30000,"orderNo":"ORDER_P2","balance":100,"tenantId":"residential"}`)
+	if code != http.StatusUnprocessableEntity || data["errorCode"] != chargepolicy.ErrorCodeValidationFailed {
+		t.Fatalf("超限应返回422 VALIDATION_FAILED: %d %+v", code, data)
+	}
+	violation := data["violations"].([]interface{})[0].(map[string]interface{})
+	if violation["limit"] != "chargeDuration" || violation["max"].(float64) != 28800 || violation["scope"] != "tenant" {
+		t.Fatalf("错误详情应包含违反的限制: %+v", violation)
+	}
+	code, data = do(http.MethodPost, "/api/v1/charging/update_power", `{"deviceId":"04A26CF3","port":1,"orderNo":"ORDER_P1","overloadPowerW":7001}`)
+	if code != http.StatusUnprocessableEntity || data["errorCode"] != chargepolicy.ErrorCodeValidationFailed {
+		t.Fatalf("功率超限应拒绝: %d %+v", code, data)
+	}
+
+	code, data = do(http.MethodGet, "/api/v1/policies/charging?tenantId=residential", "")
+	if code != http.StatusOK {
+		t.Fatalf("查询策略失败: %d", code)
+	}
+	limits := data["effective"].(map[string]interface{})["limits"].(map[string]interface{})
+	if limits["maxPower"].(map[string]interface{})["max"].(float64) != 3500 || limits["balance"].(map[string]interface{})["scope"] != "global" {
+		t.Fatalf("租户生效限制错误: %+v", limits)
+	}
+}
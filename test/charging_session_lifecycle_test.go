@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+	"github.com/gin-gonic/gin"
+)
+
+// TestChargingSessionLifecycle 模拟设备走完 开始充电 → 0x82受理 → 0x06功率心跳 → 0x03结算，会话以completed结束并记录电量与时长；
+// 未知订单的结算记入异常，等待应答超时的会话置为failed
+func TestChargingSessionLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quietLogger(t)
+	const (
+		deviceID = "04A27163"
+		iccid    = "89860000000000176301"
+		orderNo  = "ORD-1763-A"
+	)
+	conn := registerSharedGroup(t, 1763001, iccid, []string{deviceID})
+	device := simulator.NewDevice(0x04A27163, iccid, dialect.AP3000)
+	g := gateway.GetGlobalDeviceGateway()
+	sessions := g.GetChargingSessions()
+	// feed 将模拟设备的上行帧交给对应处理器（命令取自帧头）
+	feed := func(handler ziface.IRouter) func(frame []byte, err error) {
+		return func(frame []byte, err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, command, _ := frameHeader(frame)
+			req := znet.NewRequest(conn, zpack.NewMsgPackage(uint32(command), frame))
+			req.BindRouter(handler)
+			req.Call()
+		}
+	}
+	expectState := func(want gateway.SessionState) gateway.ChargingSession {
+		t.Helper()
+		s, ok := sessions.Get(orderNo)
+		if !ok || s.State != want {
+			t.Fatalf("会话状态应为%s: %+v", want, s)
+		}
+		return s
+	}
+
+	if _, err := g.StartChargingWithRequest("", gateway.ChargeRequest{DeviceID: deviceID, Port: 1, OrderNo: orderNo, Mode: 0, Value: 3600, Balance: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	expectState(gateway.SessionRequested)
+	down, err := device.ParseDownlink(waitFrames(t, conn, 1, nil)[0])
+	if err != nil || down.Command != constants.CmdChargeControl {
+		t.Fatalf("应下发充电控制命令: %+v %v", down, err)
+	}
+
+	feed(&handlers.ChargeControlHandler{})(device.ChargeControlResponse(down.MessageID, dialect.ChargeControlResponse{Port: 0, OrderNo: orderNo}))
+	if s := expectState(gateway.SessionStarted); s.StartedAt == nil {
+		t.Fatalf("受理后应记录开始时间: %+v", s)
+	}
+
+	for i, power := range []uint16{18000, 21000, 20000} {
+		feed(handlers.NewPowerHeartbeatHandler())(device.PowerHeartbeat(simulator.PowerHeartbeat{
+			Port: 0, Status: 1, Duration: uint16(600 * (i + 1)), Energy: uint16(40 * (i + 1)), Power: power, OrderNo: orderNo,
+		}))
+	}
+	if s := expectState(gateway.SessionCharging); s.Heartbeats != 3 || s.PeakPowerW != 2100 || s.LastPowerW != 2000 || s.EnergyWh != 120 {
+		t.Fatalf("功率心跳统计错误: %+v", s)
+	}
+
+	feed(&handlers.SettlementHandler{})(device.Settlement(dialect.Settlement{
+		Duration: 1830, MaxPower: 2100, Energy: 125, Port: 0, StopReason: 1, OrderNo: orderNo, Timestamp: uint32(time.Now().Unix()),
+	}))
+	s := expectState(gateway.SessionCompleted)
+	if s.EnergyWh != 125 || s.DurationSeconds != 1830 || s.SettledAt == nil || s.EndedAt == nil {
+		t.Fatalf("结算应记录电量与时长: %+v", s)
+	}
+	var path []gateway.SessionState
+	for _, tr := range s.History {
+		path = append(path, tr.To)
+	}
+	want := []gateway.SessionState{gateway.SessionRequested, gateway.SessionStarted, gateway.SessionCharging, gateway.SessionSettling, gateway.SessionCompleted}
+	if len(path) != len(want) {
+		t.Fatalf("状态历史错误: %v", path)
+	}
+	for i := range want {
+		if path[i] != want[i] {
+			t.Fatalf("状态历史错误: %v", path)
+		}
+	}
+
+	// 未知订单的结算不创建会话，记入异常
+	feed(&handlers.SettlementHandler{})(device.Settlement(dialect.Settlement{
+		Duration: 60, Energy: 5, Port: 1, StopReason: 1, OrderNo: "ORD-1763-X", Timestamp: uint32(time.Now().Unix()),
+	}))
+	if _, ok := sessions.Get("ORD-1763-X"); ok {
+		t.Fatal("未知订单的结算不应创建会话")
+	}
+	flagged := false
+	for _, a := range sessions.Anomalies() {
+		if a.OrderNo == "ORD-1763-X" && a.Event == gateway.SessionEventSettlement {
+			flagged = true
+		}
+	}
+	if !flagged {
+		t.Fatalf("未知订单的结算应记入异常: %+v", sessions.Anomalies())
+	}
+
+	t.Run("API", func(t *testing.T) {
+		h := apihttp.NewChargingHandlers()
+		r := gin.New()
+		r.GET("/api/v1/charging/sessions", h.HandleChargingSessions)
+		r.GET("/api/v1/charging/sessions/:orderNo", h.HandleChargingSession)
+
+		w, resp := callAPI(r, http.MethodGet, "/api/v1/charging/sessions/"+orderNo, "")
+		if w.Code != http.StatusOK || resp.Data["state"] != "completed" || resp.Data["energyWh"].(float64) != 125 || resp.Data["durationSeconds"].(float64) != 1830 {
+			t.Fatalf("会话详情错误: %s", w.Body.String())
+		}
+		if w, _ := callAPI(r, http.MethodGet, "/api/v1/charging/sessions/ORD-1763-X", ""); w.Code != http.StatusNotFound {
+			t.Fatalf("未知订单应返回404: %d", w.Code)
+		}
+		w, resp = callAPI(r, http.MethodGet, "/api/v1/charging/sessions?state=completed&deviceId="+deviceID, "")
+		if w.Code != http.StatusOK || resp.Data["total"].(float64) != 1 || len(resp.Data["anomalies"].([]interface{})) == 0 {
+			t.Fatalf("按状态列出会话错误: %s", w.Body.String())
+		}
+		if w, _ := callAPI(r, http.MethodGet, "/api/v1/charging/sessions?state=bogus", ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("无效状态应返回400: %d", w.Code)
+		}
+	})
+
+	t.Run("等待应答超时", func(t *testing.T) {
+		m := gateway.NewChargingSessionManager(config.ChargingSessionsConfig{RequestedTimeoutSeconds: 60})
+		now := time.Now()
+		m.OnRequested(deviceID, 2, "ORD-1763-B", now.Add(-2*time.Minute))
+		m.OnRequested(deviceID, 1, "ORD-1763-C", now.Add(-30*time.Second))
+		if expired := m.ExpireRequested(now); len(expired) != 1 || expired[0] != "ORD-1763-B" {
+			t.Fatalf("只应超时超过60秒未应答的会话: %v", expired)
+		}
+		if s, _ := m.Get("ORD-1763-B"); s.State != gateway.SessionFailed || s.FailureReason == "" {
+			t.Fatalf("超时会话应置为failed: %+v", s)
+		}
+		// 已失败的会话收到应答与结算均不改变状态
+		m.OnChargeResponse(deviceID, 2, "ORD-1763-B", true, "", now)
+		if _, err := m.OnSettlement(deviceID, 2, "ORD-1763-B", gateway.SettlementReport{EnergyWh: 10}, now); err == nil {
+			t.Fatal("已失败的会话不应接受结算")
+		}
+		if s, _ := m.Get("ORD-1763-B"); s.State != gateway.SessionFailed {
+			t.Fatalf("非法转换不应改变会话: %+v", s)
+		}
+		if len(m.Anomalies()) != 1 {
+			t.Fatalf("非法结算应记入异常: %+v", m.Anomalies())
+		}
+		// 受理后结算电量为0：转为refunding
+		m.OnChargeResponse(deviceID, 1, "", true, "", now)
+		if s, err := m.OnSettlement(deviceID, 1, "ORD-1763-C", gateway.SettlementReport{}, now); err != nil || s.State != gateway.SessionRefunding {
+			t.Fatalf("零电量结算应转为refunding: %+v %v", s, err)
+		}
+	})
+}
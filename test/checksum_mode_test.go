@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// interceptConn 经解码器责任链收发的连接桩：记录写入的帧，GetMsgHandler 返回解码器与末端记录处理器组成的责任链
+type interceptConn struct {
+	frameCaptureConn
+	handler *interceptHandler
+}
+
+func newInterceptConn(id uint64, decoder *protocol.DNY_Decoder) *interceptConn {
+	return &interceptConn{
+		frameCaptureConn: frameCaptureConn{disconnectTestConn: disconnectTestConn{id: id}},
+		handler:          &interceptHandler{decoder: decoder},
+	}
+}
+
+func (c *interceptConn) RemoteAddrString() string         { return c.RemoteAddr().String() }
+func (c *interceptConn) GetMsgHandler() ziface.IMsgHandle { return c.handler }
+
+// read 模拟读协程收到一次数据：以新请求进入责任链
+func (c *interceptConn) read(data []byte) {
+	c.handler.Execute(znet.NewRequest(c, zpack.NewMessage(uint32(len(data)), data)))
+}
+
+// interceptHandler 解码器在前、记录处理器在末端的责任链
+type interceptHandler struct {
+	ziface.IMsgHandle
+	decoder *protocol.DNY_Decoder
+
+	mu       sync.Mutex
+	executed int                     // 进入责任链的请求数（含解码器重新注入的缓存报文）
+	handled  []*dny_protocol.Message // 解码器传给处理器的报文
+}
+
+func (h *interceptHandler) Execute(req ziface.IRequest) {
+	h.mu.Lock()
+	h.executed++
+	h.mu.Unlock()
+	zinterceptor.NewChain([]ziface.IInterceptor{h.decoder, h}, 0, req).Proceed(req)
+}
+
+func (h *interceptHandler) Intercept(chain ziface.IChain) ziface.IcResp {
+	if req, ok := chain.Request().(ziface.IRequest); ok {
+		if msg, ok := req.GetResponse().(*dny_protocol.Message); ok {
+			h.mu.Lock()
+			h.handled = append(h.handled, msg)
+			h.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// take 取出已处理的报文与进入责任链的请求数
+func (h *interceptHandler) take() ([]*dny_protocol.Message, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	handled, executed := h.handled, h.executed
+	h.handled, h.executed = nil, 0
+	return handled, executed
+}
+
+// TestChecksumModes 上行帧校验和：默认 lenient 照常处理并累计连接的 checksum_failures，strict 丢弃并应答NAK
+// （仅当物理ID为本连接已绑定的设备且命令已知时应答，否则包头不可信只丢弃），off 不校验；模式可按命令分类覆盖
+func TestChecksumModes(t *testing.T) {
+	quietLogger(t)
+	builder := protocol.NewUnifiedDNYBuilder()
+	const pid = 0x04A27157
+	settlement := builder.BuildDNYPacket(pid, 0x1757, constants.CmdSettlement, make([]byte, 37))
+	heartbeat := builder.BuildDNYPacket(pid, 0x1758, constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x02, 0x00, 0x00, 0x1F, 0x20})
+	corrupt := func(frame []byte) []byte {
+		bad := append([]byte(nil), frame...)
+		bad[len(bad)-1] ^= 0x01 // 校验和位翻转
+		return bad
+	}
+
+	var checksumErr *protocol.ChecksumError
+	if err := protocol.VerifyFrameChecksum(settlement); err != nil {
+		t.Fatalf("正确的帧校验失败: %v", err)
+	}
+	if err := protocol.VerifyFrameChecksum(corrupt(settlement)); !errors.As(err, &checksumErr) || checksumErr.Carried == checksumErr.Calculated {
+		t.Fatalf("位翻转的帧应返回校验和错误，实际 %v", err)
+	}
+
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &disconnectTestConn{id: 1757001}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(conn.id)
+	if err := tcpManager.RegisterDevice(conn, "04A27157", "04A27157", "89860000000000175701"); err != nil {
+		t.Fatalf("注册设备失败: %v", err)
+	}
+	session, _ := tcpManager.GetSessionByConnID(conn.id)
+	checksumFailures := func() int64 { return atomic.LoadInt64(&session.ChecksumFailures) }
+
+	newDecoder := func(t *testing.T, policy protocol.ChecksumPolicy) (*protocol.DNY_Decoder, *protocol.ChecksumVerifier) {
+		t.Helper()
+		verifier, err := protocol.NewChecksumVerifier(policy)
+		if err != nil {
+			t.Fatalf("创建校验和处置器失败: %v", err)
+		}
+		decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+		decoder.SetChecksumVerifier(verifier)
+		t.Cleanup(func() { decoder.ReleaseConnection(conn.id) })
+		return decoder, verifier
+	}
+
+	t.Run("strict丢弃校验和错误的帧", func(t *testing.T) {
+		decoder, verifier := newDecoder(t, protocol.ChecksumPolicy{Mode: protocol.ChecksumModeStrict})
+		before := checksumFailures()
+		if _, msg := decoder.DecodeFrame(conn.id, corrupt(settlement)); msg != nil {
+			t.Fatalf("strict 模式不应接受校验和错误的帧: %+v", msg)
+		}
+		if _, msg := decoder.DecodeFrame(conn.id, settlement); msg == nil || msg.MessageType != "standard" {
+			t.Fatalf("校验和正确的帧应照常解出: %+v", msg)
+		}
+		stats := verifier.Stats()
+		if stats.Failures != 1 || stats.Rejected != 1 || stats.Accepted != 0 || stats.ByClass[constants.CategoryCharging] != 1 {
+			t.Fatalf("strict 计数错误: %+v", stats)
+		}
+		if checksumFailures() != before+1 {
+			t.Fatalf("连接 checksum_failures 应加1: %d → %d", before, checksumFailures())
+		}
+	})
+
+	t.Run("strict经责任链丢弃并对已绑定设备应答NAK", func(t *testing.T) {
+		decoder, verifier := newDecoder(t, protocol.ChecksumPolicy{Mode: protocol.ChecksumModeStrict})
+		chainConn := newInterceptConn(1757002, decoder)
+		t.Cleanup(func() { decoder.ReleaseConnection(chainConn.id) })
+		if _, err := tcpManager.RegisterConnection(chainConn); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+		defer tcpManager.UnregisterConnection(chainConn.id)
+		const boundPID = 0x04A27158
+		if err := tcpManager.RegisterDevice(chainConn, "04A27158", "04A27158", "89860000000000175702"); err != nil {
+			t.Fatalf("注册设备失败: %v", err)
+		}
+
+		chainConn.read(corrupt(builder.BuildDNYPacket(boundPID, 0x1759, constants.CmdSettlement, make([]byte, 37))))
+		if handled, _ := chainConn.handler.take(); len(handled) != 0 {
+			t.Fatalf("strict 模式不应把校验和错误的帧交给处理器: %+v", handled)
+		}
+		frames := chainConn.take()
+		if len(frames) != 1 {
+			t.Fatalf("已绑定设备的校验和错误帧应应答一次NAK，实际 %d 帧", len(frames))
+		}
+		nak, err := protocol.ParseDNYProtocolData(frames[0])
+		if err != nil || nak.PhysicalId != boundPID || nak.MessageId != 0x1759 || nak.CommandId != uint32(constants.CmdSettlement) ||
+			!bytes.Equal(nak.Data, []byte{constants.StatusError}) {
+			t.Fatalf("NAK 应按原物理ID、消息ID与命令应答错误状态: %+v, %v", nak, err)
+		}
+
+		// 物理ID不是本连接绑定的设备（04A27157 绑定在另一连接上）或命令未知时，包头不可信，只丢弃
+		chainConn.read(corrupt(settlement))
+		chainConn.read(corrupt(builder.BuildDNYPacket(boundPID, 0x175A, 0xEE, []byte{0x01})))
+		if frames := chainConn.take(); len(frames) != 0 {
+			t.Fatalf("包头不可信的校验和错误帧不应应答NAK: %x", frames)
+		}
+		if handled, _ := chainConn.handler.take(); len(handled) != 0 {
+			t.Fatalf("strict 模式不应把校验和错误的帧交给处理器: %+v", handled)
+		}
+		if stats := verifier.Stats(); stats.Rejected != 3 {
+			t.Fatalf("strict 计数错误: %+v", stats)
+		}
+	})
+
+	t.Run("lenient照常处理并计数", func(t *testing.T) {
+		decoder, verifier := newDecoder(t, protocol.ChecksumPolicy{Mode: protocol.ChecksumModeLenient})
+		before := checksumFailures()
+		_, msg := decoder.DecodeFrame(conn.id, corrupt(settlement))
+		if msg == nil || msg.MessageType != "standard" || msg.CommandId != uint32(constants.CmdSettlement) || msg.MessageId != 0x1757 || msg.ErrorMessage != "" {
+			t.Fatalf("lenient 模式应照常解出校验和错误的帧: %+v", msg)
+		}
+		stats := verifier.Stats()
+		if stats.Failures != 1 || stats.Accepted != 1 || stats.Rejected != 0 {
+			t.Fatalf("lenient 计数错误: %+v", stats)
+		}
+		if checksumFailures() != before+1 {
+			t.Fatalf("连接 checksum_failures 应加1: %d → %d", before, checksumFailures())
+		}
+		detail, err := tcpManager.GetDeviceDetail("04A27157")
+		if err != nil || detail["checksumFailures"] != checksumFailures() {
+			t.Fatalf("设备详情应包含连接的 checksumFailures=%d: %v %v", checksumFailures(), detail["checksumFailures"], err)
+		}
+
+		var metrics bytes.Buffer
+		verifier.WritePrometheus(&metrics)
+		if !strings.Contains(metrics.String(), `iot_dny_checksum_failures_total{class="charging",mode="lenient"} 1`) ||
+			!strings.Contains(metrics.String(), "iot_dny_checksum_accepted_total 1") {
+			t.Fatalf("指标输出错误:\n%s", metrics.String())
+		}
+	})
+
+	t.Run("按命令分类覆盖", func(t *testing.T) {
+		decoder, verifier := newDecoder(t, protocol.ChecksumPolicy{
+			Mode:    protocol.ChecksumModeStrict,
+			Classes: map[string]string{constants.CategoryHeartbeat: protocol.ChecksumModeOff},
+		})
+		before := checksumFailures()
+		if _, msg := decoder.DecodeFrame(conn.id, corrupt(heartbeat)); msg == nil || msg.CommandId != uint32(constants.CmdDeviceHeart) {
+			t.Fatalf("心跳类关闭校验，应照常解出: %+v", msg)
+		}
+		if _, msg := decoder.DecodeFrame(conn.id, corrupt(settlement)); msg != nil {
+			t.Fatalf("充电类沿用 strict，应丢弃: %+v", msg)
+		}
+		if stats := verifier.Stats(); stats.Failures != 1 || stats.Rejected != 1 || stats.ByClass[constants.CategoryHeartbeat] != 0 {
+			t.Fatalf("off 模式不应计数: %+v", stats)
+		}
+		if checksumFailures() != before+1 {
+			t.Fatalf("off 模式不应计入连接 checksum_failures: %d → %d", before, checksumFailures())
+		}
+	})
+
+	t.Run("配置校验", func(t *testing.T) {
+		for _, policy := range []protocol.ChecksumPolicy{
+			{Mode: "log-everything"},
+			{Classes: map[string]string{"billing": protocol.ChecksumModeOff}},
+			{Classes: map[string]string{constants.CategoryCharging: "loose"}},
+		} {
+			if _, err := protocol.NewChecksumVerifier(policy); err == nil {
+				t.Fatalf("非法配置应报错: %+v", policy)
+			}
+		}
+		v, err := protocol.NewChecksumVerifier(protocol.ChecksumPolicy{})
+		if err != nil || v.Policy().Mode != protocol.ChecksumModeLenient {
+			t.Fatalf("默认应为 lenient: %+v %v", v, err)
+		}
+		if mode := (protocol.ChecksumPolicy{}).ModeFor(constants.CmdSettlement); mode != protocol.ChecksumModeLenient {
+			t.Fatalf("未配置模式时应按 lenient 处置，实际 %s", mode)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/docs"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/client"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+// sdkRecorder 记录经过的请求，并按需在路由处理前后注入故障
+type sdkRecorder struct {
+	next http.Handler
+
+	mu       sync.Mutex
+	requests []sdkRequest
+	inject   func(n int, w http.ResponseWriter, r *http.Request) bool // 返回 true 表示已代为应答
+}
+
+type sdkRequest struct {
+	path, key, apiKey, tenant string
+}
+
+func (s *sdkRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, sdkRequest{path: r.URL.Path, key: r.Header.Get(client.HeaderIdempotencyKey), apiKey: r.Header.Get(client.HeaderAPIKeyName), tenant: r.Header.Get(client.HeaderTenantID)})
+	n, inject := len(s.requests), s.inject
+	s.mu.Unlock()
+	if inject != nil && inject(n, w, r) {
+		return
+	}
+	s.next.ServeHTTP(w, r)
+}
+
+// reset 清空记录并设置本阶段的故障注入
+func (s *sdkRecorder) reset(inject func(n int, w http.ResponseWriter, r *http.Request) bool) {
+	s.mu.Lock()
+	s.requests, s.inject = nil, inject
+	s.mu.Unlock()
+}
+
+func (s *sdkRecorder) taken() []sdkRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sdkRequest(nil), s.requests...)
+}
+
+// TestClientSDK 类型化客户端经进程内路由访问网关：查询接口解码为类型化结构；GET 按 Retry-After 重试；
+// 充电命令自动携带幂等键，应答丢失后重试得到重放应答且只下发一帧；错误响应与 problem+json 映射为可用 errors.Is 判断的错误
+func TestClientSDK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shortConfirmTimeout(t)
+	const deviceID = "04B17071"
+	conn := registerSharedGroup(t, 1707001, "89860400000017070001", []string{deviceID})
+	gateway.GetGlobalDeviceGateway().OnDeviceRegistered(deviceID)
+	idempotency.SetGlobalGuard(idempotency.NewGuard(nil, time.Minute, 100))
+	defer idempotency.SetGlobalGuard(nil)
+	idempotency.SetGlobalResponses(idempotency.NewResponses(time.Minute, 100))
+	defer idempotency.SetGlobalResponses(nil)
+
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	rec := &sdkRecorder{next: r}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	c, err := client.New(srv.URL, "billing-svc", "tenant_a", client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, MaxRetryAfter: 5 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("版本", func(t *testing.T) {
+		var spec struct {
+			Info struct {
+				Version string `json:"version"`
+			} `json:"info"`
+		}
+		if err := json.Unmarshal(docs.OpenAPISpec, &spec); err != nil || client.APIVersion != spec.Info.Version {
+			t.Fatalf("客户端版本 %s 应与API版本 %s 一致: %v", client.APIVersion, spec.Info.Version, err)
+		}
+		if _, err := client.New("gateway:7055", "k", ""); err == nil {
+			t.Fatal("缺少协议的地址应报错")
+		}
+	})
+
+	t.Run("查询", func(t *testing.T) {
+		rec.reset(nil)
+		list, err := c.ListDevices(ctx, client.ListDevicesOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, d := range list.Devices {
+			found = found || d.DeviceID == deviceID
+		}
+		if !found || list.Total < 1 {
+			t.Fatalf("设备列表应包含 %s: %+v", deviceID, list)
+		}
+		d, err := c.GetDevice(ctx, deviceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.DeviceID != deviceID || d.ICCID != "89860400000017070001" || !d.IsOnline || len(d.Raw) == 0 {
+			t.Fatalf("设备详情错误: %+v", d)
+		}
+		ports, err := c.GetPorts(ctx, deviceID)
+		if err != nil || ports.StandardID != deviceID || !ports.IsOnline {
+			t.Fatalf("端口状态错误: %+v %v", ports, err)
+		}
+		matches, err := c.Search(ctx, "17070001", 5)
+		if err != nil || len(matches) != 1 || matches[0].DeviceID != deviceID || matches[0].MatchedField == "" {
+			t.Fatalf("搜索结果错误: %+v %v", matches, err)
+		}
+		for _, req := range rec.taken() {
+			if req.apiKey != "billing-svc" || req.tenant != "tenant_a" || req.key != "" {
+				t.Fatalf("请求头错误: %+v", req)
+			}
+		}
+	})
+
+	t.Run("GET按Retry-After重试", func(t *testing.T) {
+		rec.reset(func(n int, w http.ResponseWriter, r *http.Request) bool {
+			if n == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return true
+			}
+			return false
+		})
+		start := time.Now()
+		if _, err := c.GetDevice(ctx, deviceID); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Fatalf("应按 Retry-After 等待1秒后重试，实际 %v", elapsed)
+		}
+		if n := len(rec.taken()); n != 2 {
+			t.Fatalf("应尝试2次，实际 %d", n)
+		}
+	})
+
+	t.Run("Retry-After超出上限不重试", func(t *testing.T) {
+		rec.reset(func(n int, w http.ResponseWriter, r *http.Request) bool {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return true
+		})
+		_, err := c.ListDevices(ctx, client.ListDevicesOptions{})
+		var apiErr *client.APIError
+		if !errors.Is(err, client.ErrTooManyRequests) || !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Minute {
+			t.Fatalf("应返回限流错误并携带 Retry-After: %v", err)
+		}
+		if n := len(rec.taken()); n != 1 {
+			t.Fatalf("不应重试，实际尝试 %d 次", n)
+		}
+	})
+
+	t.Run("等待重试时取消", func(t *testing.T) {
+		rec.reset(func(n int, w http.ResponseWriter, r *http.Request) bool {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		})
+		cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := c.GetPorts(cctx, deviceID); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("应返回上下文错误: %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("取消后应立即返回")
+		}
+	})
+
+	t.Run("开始充电应答丢失后重放", func(t *testing.T) {
+		conn.take()
+		rec.reset(func(n int, w http.ResponseWriter, r *http.Request) bool {
+			if n != 1 {
+				return false
+			}
+			// 请求已执行，但应答在途中丢失
+			rr := httptest.NewRecorder()
+			rec.next.ServeHTTP(rr, r)
+			w.WriteHeader(http.StatusBadGateway)
+			return true
+		})
+		res, err := c.StartCharging(ctx, client.StartChargingRequest{DeviceID: deviceID, Port: 1, Value: 3600, OrderNo: "ORD1707A", Balance: 500})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Replayed || res.Action != "start" || res.OrderNo != "ORD1707A" || res.IdempotencyKey == "" {
+			t.Fatalf("重试应得到首个请求的重放应答: %+v", res)
+		}
+		reqs := rec.taken()
+		if len(reqs) != 2 || reqs[0].key == "" || reqs[0].key != reqs[1].key {
+			t.Fatalf("重试应复用同一幂等键: %+v", reqs)
+		}
+		if frames := conn.take(); len(frames) != 1 {
+			t.Fatalf("命令应只下发一次，实际 %d 帧", len(frames))
+		}
+	})
+
+	t.Run("重复订单不重试", func(t *testing.T) {
+		rec.reset(nil)
+		_, err := c.StartCharging(ctx, client.StartChargingRequest{DeviceID: deviceID, Port: 1, Value: 3600, OrderNo: "ORD1707A"})
+		var apiErr *client.APIError
+		if !errors.Is(err, client.ErrDuplicateOrder) || !errors.Is(err, client.ErrConflict) || !errors.As(err, &apiErr) || apiErr.Code != client.CodeDuplicateOrder {
+			t.Fatalf("新幂等键提交同一订单应返回重复订单错误: %v", err)
+		}
+		if n := len(rec.taken()); n != 1 {
+			t.Fatalf("确定性错误不应重试，实际尝试 %d 次", n)
+		}
+	})
+
+	t.Run("幂等键用于不同请求", func(t *testing.T) {
+		rec.reset(nil)
+		kctx := client.WithIdempotencyKey(ctx, "order-ORD1707B")
+		if _, err := c.ModifyCharging(kctx, client.ModifyChargingRequest{DeviceID: deviceID, Port: 1, OrderNo: "ORD1707A", OverloadPowerW: 1200}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.ModifyCharging(kctx, client.ModifyChargingRequest{DeviceID: deviceID, Port: 1, OrderNo: "ORD1707A", OverloadPowerW: 1200})
+		if err != nil || !res.Replayed || res.IdempotencyKey != "order-ORD1707B" {
+			t.Fatalf("指定幂等键的重复调用应重放: %+v %v", res, err)
+		}
+		if _, err := c.ModifyCharging(kctx, client.ModifyChargingRequest{DeviceID: deviceID, Port: 1, OrderNo: "ORD1707A", OverloadPowerW: 800}); !errors.Is(err, client.ErrIdempotencyKeyReuse) || !errors.Is(err, client.ErrUnprocessable) {
+			t.Fatalf("同一幂等键携带不同请求体应报错: %v", err)
+		}
+	})
+
+	t.Run("停止充电与problem+json", func(t *testing.T) {
+		rec.reset(func(n int, w http.ResponseWriter, r *http.Request) bool {
+			if n > 2 {
+				return false
+			}
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.Header().Set("X-Request-ID", "req-1707")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = w.Write([]byte(`{"type":"about:blank","title":"COMMAND_TIMEOUT","status":504,"detail":"设备未在超时时间内应答"}`))
+			return true
+		})
+		res, err := c.StopCharging(ctx, client.StopChargingRequest{DeviceID: deviceID, Port: 1, OrderNo: "ORD1707A"})
+		if err != nil || res.Action != "stop" || res.Replayed {
+			t.Fatalf("504后重试应停止成功: %+v %v", res, err)
+		}
+		if n := len(rec.taken()); n != 3 {
+			t.Fatalf("应尝试3次，实际 %d", n)
+		}
+
+		rec.reset(func(n int, w http.ResponseWriter, r *http.Request) bool {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = w.Write([]byte(`{"type":"about:blank","title":"COMMAND_TIMEOUT","status":504,"detail":"设备未在超时时间内应答","requestId":"req-1707"}`))
+			return true
+		})
+		_, err = c.StopCharging(ctx, client.StopChargingRequest{DeviceID: deviceID, Port: 1})
+		var apiErr *client.APIError
+		if !errors.Is(err, client.ErrCommandTimeout) || !errors.As(err, &apiErr) || apiErr.Code != client.CodeCommandTimeout || apiErr.RequestID != "req-1707" || apiErr.Detail == "" {
+			t.Fatalf("problem+json 应映射为命令超时错误: %#v", err)
+		}
+	})
+
+	t.Run("设备不在线", func(t *testing.T) {
+		rec.reset(nil)
+		_, err := c.GetDevice(ctx, "04B17079")
+		var apiErr *client.APIError
+		if !errors.Is(err, client.ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Message == "" {
+			t.Fatalf("离线设备应返回 ErrNotFound: %v", err)
+		}
+		if n := len(rec.taken()); n != 1 {
+			t.Fatalf("404 不应重试，实际尝试 %d 次", n)
+		}
+	})
+}
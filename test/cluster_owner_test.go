@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeLocalDevices 模拟实例本地持有连接的设备
+type fakeLocalDevices map[string]bool
+
+func (f fakeLocalDevices) IsDeviceOnline(deviceID string) bool { return f[deviceID] }
+
+func (f fakeLocalDevices) GetAllOnlineDevices() []string {
+	ids := make([]string, 0, len(f))
+	for id := range f {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// TestClusterOwnership 多实例设备归属：登记/远端查询/断开释放/单实例退化/HTTP 421 重定向提示
+func TestClusterOwnership(t *testing.T) {
+	const deviceID = "04A26CF3"
+	store := cluster.NewMemoryStore()
+	localA := fakeLocalDevices{deviceID: true}
+	a := cluster.NewOwnership(cluster.Options{
+		Enabled: true, InstanceID: "gw-a", APIBaseURL: "http://10.0.0.11:7055",
+		LookupCacheTTL: 10 * time.Millisecond, Store: store, Local: localA,
+	})
+	b := cluster.NewOwnership(cluster.Options{
+		Enabled: true, InstanceID: "gw-b", APIBaseURL: "http://10.0.0.12:7055",
+		LookupCacheTTL: 10 * time.Millisecond, Store: store, Local: fakeLocalDevices{},
+	})
+
+	t.Run("未启用集群模式时恒为本实例", func(t *testing.T) {
+		single := cluster.NewOwnership(cluster.Options{Enabled: true, InstanceID: "gw-single"})
+		if single.Enabled() {
+			t.Fatal("缺少归属存储时应退化为单实例")
+		}
+		owner, ok := single.Lookup("UNKNOWN")
+		if !ok || !owner.Self || owner.InstanceID != "gw-single" {
+			t.Fatalf("应返回本实例: %+v %v", owner, ok)
+		}
+		if _, remote := single.LookupRemote(deviceID); remote {
+			t.Fatal("单实例模式不应存在远端归属")
+		}
+		var nilOwnership *cluster.Ownership
+		if owner, ok := nilOwnership.Lookup(deviceID); !ok || !owner.Self {
+			t.Fatalf("未初始化时应按单实例处理: %+v", owner)
+		}
+	})
+
+	t.Run("持有连接的实例登记后其他实例可查", func(t *testing.T) {
+		a.Sync()
+		owner, ok := a.Lookup(deviceID)
+		if !ok || !owner.Self {
+			t.Fatalf("本地在线设备应归属本实例: %+v", owner)
+		}
+		remote, ok := b.LookupRemote(deviceID)
+		if !ok || remote.InstanceID != "gw-a" || remote.APIBaseURL != "http://10.0.0.11:7055" || remote.Self {
+			t.Fatalf("实例B应查到归属实例A: %+v %v", remote, ok)
+		}
+	})
+
+	t.Run("HTTP响应返回421及重定向提示", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		previous := cluster.GetGlobalOwnership()
+		cluster.SetGlobalOwnership(b)
+		defer cluster.SetGlobalOwnership(previous)
+
+		r := gin.New()
+		r.Use(apihttp.InstanceMiddleware())
+		h := apihttp.NewDeviceHandlers()
+		r.GET("/api/v1/device/:deviceId/status", h.HandleDeviceStatus)
+		r.GET("/api/v1/device/:deviceId/owner", h.HandleDeviceOwner)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/device/"+deviceID+"/status", nil))
+		if w.Code != http.StatusMisdirectedRequest {
+			t.Fatalf("设备归属其他实例应返回421: %d %s", w.Code, w.Body.String())
+		}
+		if w.Header().Get(apihttp.HeaderGatewayInstance) != "gw-b" || w.Header().Get(apihttp.HeaderGatewayOwner) != "gw-a" {
+			t.Fatalf("响应头应标注处理实例与归属实例: %v", w.Header())
+		}
+		var resp struct {
+			Data struct {
+				ErrorCode string        `json:"errorCode"`
+				Owner     cluster.Owner `json:"owner"`
+				Redirect  string        `json:"redirect"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		if resp.Data.ErrorCode != apihttp.ErrorCodeDeviceNotFound || resp.Data.Redirect != "http://10.0.0.11:7055/api/v1/device/"+deviceID+"/status" {
+			t.Fatalf("重定向提示错误: %+v", resp.Data)
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/device/"+deviceID+"/owner", nil))
+		var ownerResp struct {
+			Data apihttp.DeviceOwnerResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &ownerResp)
+		if w.Code != http.StatusOK || ownerResp.Data.Owner.InstanceID != "gw-a" || !ownerResp.Data.ClusterEnabled {
+			t.Fatalf("归属查询接口应返回实例A: %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("设备断开后释放归属", func(t *testing.T) {
+		delete(localA, deviceID)
+		a.Sync()
+		time.Sleep(20 * time.Millisecond) // 等待查询缓存过期
+		if owner, ok := b.Lookup(deviceID); ok {
+			t.Fatalf("设备断开后不应再有归属: %+v", owner)
+		}
+	})
+
+	t.Run("仅释放本实例持有的归属键", func(t *testing.T) {
+		_ = store.Claim(context.Background(), deviceID, cluster.Owner{InstanceID: "gw-b"}, time.Minute)
+		_ = store.Release(context.Background(), deviceID, "gw-a")
+		if owner, ok, _ := store.Get(context.Background(), deviceID); !ok || owner.InstanceID != "gw-b" {
+			t.Fatalf("设备已迁移到实例B，实例A释放不应删除: %+v %v", owner, ok)
+		}
+	})
+}
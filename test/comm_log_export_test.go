@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+	"github.com/gin-gonic/gin"
+)
+
+// TestCommLogExport 环形缓冲淘汰、二进制/JSONL导出与重新导入逐字节一致
+func TestCommLogExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	uplink, _ := hex.DecodeString("444E590A00F36CA2040100960A9B03")
+	downlink, _ := hex.DecodeString("444E590F00F36CA20412348200010200D003")
+	if id := commlog.DNYPhysicalID(downlink); id != "04A26CF3" {
+		t.Fatalf("物理ID解析错误: %s", id)
+	}
+
+	l := commlog.NewLog(3, 10)
+	base := time.Date(2026, 10, 15, 10, 30, 0, 123456789, time.Local)
+	for i := 0; i < 4; i++ {
+		frame, dir := uplink, commlog.DirectionUplink
+		if i%2 == 1 {
+			frame, dir = downlink, commlog.DirectionDownlink
+		}
+		l.Append("04A26CF3", dir, frame, base.Add(time.Duration(i)*time.Second))
+	}
+	records := l.Records("04A26CF3")
+	if len(records) != 3 || !records[0].Time.Equal(base.Add(time.Second)) || records[0].Direction != commlog.DirectionDownlink {
+		t.Fatalf("环形缓冲应只保留最近3帧（旧→新）: %+v", records)
+	}
+
+	commlog.SetGlobalLog(l)
+	defer commlog.SetGlobalLog(commlog.NewLog(0, 0))
+	r := gin.New()
+	r.GET("/api/v1/device/:deviceId/comm-log/export", apihttp.NewCommLogHandlers().HandleExportCommLog)
+	export := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := export("/api/v1/device/04A26CF3/comm-log/export?format=bin")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("二进制导出失败: %d", w.Code)
+	}
+	exported := w.Body.Bytes()
+	if string(exported[:4]) != commlog.CaptureMagic || exported[4] != 0 || exported[5] != 1 {
+		t.Fatalf("文件头错误: % X", exported[:6])
+	}
+	imported, err := commlog.ReadCapture(bytes.NewReader(exported))
+	if err != nil || len(imported) != len(records) {
+		t.Fatalf("重新导入失败: %v (%d 条)", err, len(imported))
+	}
+	for i := range records {
+		if !imported[i].Time.Equal(records[i].Time) || imported[i].Direction != records[i].Direction || !bytes.Equal(imported[i].Frame, records[i].Frame) {
+			t.Fatalf("第%d条记录不一致: %+v", i+1, imported[i])
+		}
+	}
+	var again bytes.Buffer
+	if err := commlog.WriteCapture(&again, imported); err != nil || !bytes.Equal(again.Bytes(), exported) {
+		t.Fatal("导入后再导出应逐字节一致")
+	}
+
+	w = export("/api/v1/device/04A26CF3/comm-log/export?format=jsonl")
+	fromJSONL, err := commlog.ReadJSONL(w.Body)
+	if w.Code != http.StatusOK || err != nil {
+		t.Fatalf("JSONL导出失败: %d %v", w.Code, err)
+	}
+	again.Reset()
+	if err := commlog.WriteCapture(&again, fromJSONL); err != nil || !bytes.Equal(again.Bytes(), exported) {
+		t.Fatal("JSONL导入后转二进制应与二进制导出一致")
+	}
+
+	if _, err := commlog.ReadCapture(bytes.NewReader(exported[:len(exported)-1])); err == nil {
+		t.Fatal("截断的抓包应报错")
+	}
+	if w := export("/api/v1/device/04A26CF4/comm-log/export"); w.Code != http.StatusNotFound {
+		t.Fatalf("无记录设备应返回404: %d", w.Code)
+	}
+	if w := export("/api/v1/device/04A26CF3/comm-log/export?format=pcap"); w.Code != http.StatusBadRequest {
+		t.Fatalf("未知格式应返回400: %d", w.Code)
+	}
+}
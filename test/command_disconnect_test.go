@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	apperrors "github.com/bujia-iot/iot-zinx/pkg/errors"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+)
+
+// disconnectTestConn 仅实现命令管理与连接注册用到的方法
+type disconnectTestConn struct {
+	ziface.IConnection
+	id uint64
+}
+
+func (c *disconnectTestConn) GetConnID() uint64 { return c.id }
+func (c *disconnectTestConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000 + int(c.id%1000)}
+}
+func (c *disconnectTestConn) GetProperty(string) (interface{}, error) {
+	return nil, errors.New("not found")
+}
+
+// TestCommandDisconnectSweep 连接断开时待应答命令提前失败与重连重发测试
+func TestCommandDisconnectSweep(t *testing.T) {
+	const physicalID = uint32(0x04A26CF3)
+	cmdMgr := network.GetCommandManager()
+
+	t.Run("连接清理立即唤醒等待者", func(t *testing.T) {
+		_ = gateway.NewDeviceGateway() // 注入连接清理回调
+		tcpManager := core.GetGlobalTCPManager()
+		conn := &disconnectTestConn{id: 1644001}
+		if _, err := tcpManager.RegisterConnection(conn); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+
+		handle := cmdMgr.RegisterCommandWithOptions(conn, physicalID, 0x1001, 0x82, []byte{0x01}, network.CommandOptions{CorrelationID: "req-disconnect-1"})
+		result := make(chan error, 1)
+		go func() { result <- handle.Wait(network.CommandTimeout) }()
+
+		time.Sleep(20 * time.Millisecond)
+		start := time.Now()
+		_ = tcpManager.UnregisterConnection(conn.id)
+
+		select {
+		case err := <-result:
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Fatalf("等待者唤醒过慢: %s", elapsed)
+			}
+			if !apperrors.IsErrCode(err, apperrors.ErrDeviceDisconnected) {
+				t.Fatalf("应返回设备断开错误，实际: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("连接清理后等待者未被唤醒")
+		}
+		if cmdMgr.ResendQueueLength(physicalID) != 0 {
+			t.Fatal("未设置重发的命令不应进入重发队列")
+		}
+	})
+
+	t.Run("确认与超时", func(t *testing.T) {
+		conn := &disconnectTestConn{id: 1644002}
+		handle := cmdMgr.RegisterCommandWithOptions(conn, physicalID, 0x1002, 0x96, []byte{0x0A}, network.CommandOptions{})
+		cmdMgr.ConfirmCommand(physicalID, 0x1002, 0x96)
+		if err := handle.Wait(time.Second); err != nil {
+			t.Fatalf("已确认命令应返回nil: %v", err)
+		}
+
+		handle = cmdMgr.RegisterCommandWithOptions(conn, physicalID, 0x1003, 0x96, []byte{0x0A}, network.CommandOptions{})
+		if err := handle.Wait(20 * time.Millisecond); !apperrors.IsErrCode(err, apperrors.ErrCommandTimeout) {
+			t.Fatalf("应返回等待超时: %v", err)
+		}
+		cmdMgr.ClearConnectionCommands(conn.id)
+	})
+
+	t.Run("重新注册后重发", func(t *testing.T) {
+		type sent struct {
+			connID    uint64
+			messageID uint16
+			command   uint8
+		}
+		sends := make(chan sent, 4)
+		previous := network.SendCommandFunc
+		network.SetSendCommandFunc(func(conn ziface.IConnection, _ uint32, messageID uint16, command uint8, _ []byte) error {
+			sends <- sent{conn.GetConnID(), messageID, command}
+			return nil
+		})
+		defer network.SetSendCommandFunc(previous)
+
+		oldConn := &disconnectTestConn{id: 1644003}
+		handle := cmdMgr.RegisterCommandWithOptions(oldConn, physicalID, 0x1004, 0x82, []byte{0x01}, network.CommandOptions{ResendOnReconnect: true})
+		cmdMgr.RegisterCommandWithOptions(oldConn, physicalID, 0x1005, 0x96, []byte{0x0A}, network.CommandOptions{})
+
+		if failed := cmdMgr.FailConnectionCommands(oldConn.id, "test"); failed != 2 {
+			t.Fatalf("应失败2条命令，实际 %d", failed)
+		}
+		if err := handle.Wait(time.Second); !apperrors.IsErrCode(err, apperrors.ErrDeviceDisconnected) {
+			t.Fatalf("断开后应立即返回设备断开错误: %v", err)
+		}
+		if n := cmdMgr.ResendQueueLength(physicalID); n != 1 {
+			t.Fatalf("仅允许重发的命令应进入队列，实际 %d", n)
+		}
+
+		newConn := &disconnectTestConn{id: 1644004}
+		if resent := cmdMgr.ResendOnReconnect(physicalID, newConn); resent != 1 {
+			t.Fatalf("应重发1条命令，实际 %d", resent)
+		}
+		select {
+		case s := <-sends:
+			if s.connID != newConn.id || s.messageID != 0x1004 || s.command != 0x82 {
+				t.Fatalf("重发参数错误: %+v", s)
+			}
+		default:
+			t.Fatal("未调用发送函数")
+		}
+		if cmdMgr.ResendQueueLength(physicalID) != 0 || cmdMgr.ResendOnReconnect(physicalID, newConn) != 0 {
+			t.Fatal("命令只应重发一次")
+		}
+		cmdMgr.ClearConnectionCommands(newConn.id)
+	})
+
+	t.Run("超出重发窗口不重发", func(t *testing.T) {
+		cmdMgr.SetResendWindow(10 * time.Millisecond)
+		defer cmdMgr.SetResendWindow(network.CommandResendWindow)
+
+		conn := &disconnectTestConn{id: 1644005}
+		cmdMgr.RegisterCommandWithOptions(conn, physicalID, 0x1006, 0x82, []byte{0x01}, network.CommandOptions{ResendOnReconnect: true})
+		cmdMgr.FailConnectionCommands(conn.id, "test")
+		time.Sleep(30 * time.Millisecond)
+		if resent := cmdMgr.ResendOnReconnect(physicalID, &disconnectTestConn{id: 1644006}); resent != 0 {
+			t.Fatalf("超出窗口的命令不应重发，实际 %d", resent)
+		}
+	})
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// queueTestWire 模拟共享连接：逐字节写入并让出调度，未串行的并发写入必然交错
+type queueTestWire struct {
+	mu       sync.Mutex
+	data     []byte
+	inflight atomic.Int32
+	overlap  atomic.Bool
+	events   []string // 按时间顺序的 write/ack 事件
+}
+
+func (w *queueTestWire) write(packet []byte, msgID uint16) {
+	if w.inflight.Add(1) > 1 {
+		w.overlap.Store(true)
+	}
+	defer w.inflight.Add(-1)
+	w.event(fmt.Sprintf("write-%d", msgID))
+	for _, b := range packet {
+		w.mu.Lock()
+		w.data = append(w.data, b)
+		w.mu.Unlock()
+		runtime.Gosched()
+	}
+}
+
+func (w *queueTestWire) event(e string) {
+	w.mu.Lock()
+	w.events = append(w.events, e)
+	w.mu.Unlock()
+}
+
+// shortConfirmTimeout 模拟设备不应答下发的命令时缩短全局设备组队列的应答等待，避免同设备的后续命令逐条等待超时（测试结束后恢复）
+func shortConfirmTimeout(t *testing.T) {
+	manager := core.GetGlobalTCPManager()
+	saved := manager.GetCommandQueueConfig()
+	short := saved
+	short.ConfirmTimeout = 20 * time.Millisecond
+	manager.SetCommandQueueConfig(&short)
+	t.Cleanup(func() { manager.SetCommandQueueConfig(&saved) })
+}
+
+// TestDeviceGroupCommandQueue 同一设备组并发下发的充电控制命令经出站队列串行写入：帧不交错，应答后才写入下一条；队列深度见设备详情
+func TestDeviceGroupCommandQueue(t *testing.T) {
+	quietLogger(t)
+	const iccid = "89860000000000175501"
+	const deviceA, deviceB = "04A27551", "04A27552"
+	const requests = 20
+
+	manager := core.NewTCPManager(nil)
+	manager.SetCommandQueueConfig(&core.CommandQueueConfig{MaxDepth: requests, ConfirmTimeout: time.Second})
+	conn := &disconnectTestConn{id: 1755001}
+	if _, err := manager.RegisterConnection(conn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	for _, deviceID := range []string{deviceA, deviceB} {
+		if err := manager.RegisterDevice(conn, deviceID, deviceID, iccid); err != nil {
+			t.Fatalf("注册设备失败: %v", err)
+		}
+	}
+
+	wire := &queueTestWire{}
+	gate := make(chan struct{}) // 首条命令的应答在队列排满后才放行
+	var msgSeq atomic.Uint32
+	var first atomic.Bool
+	sent := sync.Map{} // msgID → payload
+	manager.SetCommandWriter(func(c ziface.IConnection, deviceID string, cmd byte, data []byte) (core.CommandWait, error) {
+		if c.GetConnID() != conn.id {
+			return nil, errors.New("写入了错误的连接")
+		}
+		physicalID, err := utils.ParseDeviceIDToPhysicalID(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		msgID := uint16(msgSeq.Add(1))
+		sent.Store(msgID, append([]byte(nil), data...))
+		wire.write(protocol.NewUnifiedDNYBuilder().BuildDNYPacket(physicalID, msgID, cmd, data), msgID)
+		return func(time.Duration) error {
+			if first.CompareAndSwap(false, true) {
+				<-gate
+			}
+			time.Sleep(time.Millisecond) // 设备处理并应答
+			wire.event(fmt.Sprintf("ack-%d", msgID))
+			return nil
+		}, nil
+	})
+
+	// 排满的队列中每条命令最多等待1秒应答，期限需覆盖整条队列
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(requests+5)*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		deviceID := deviceA
+		if i%2 == 1 {
+			deviceID = deviceB
+		}
+		payload := make([]byte, 37)
+		payload[0] = 0x01          // 费率模式
+		payload[5] = byte(i%8 + 1) // 端口
+		payload[6] = 0x01          // 开始充电
+		copy(payload[9:], fmt.Sprintf("ORDER%011d", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- manager.SendCommandToDevice(ctx, deviceID, constants.CmdChargeControl, payload)
+		}()
+	}
+
+	// 首条命令等待应答时其余命令排队：深度为队列上限，超出时拒绝
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.CommandQueueDepth(deviceA) < requests && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if depth := manager.CommandQueueDepth(deviceB); depth != requests {
+		t.Fatalf("同组设备应共享队列，深度应为 %d，实际 %d", requests, depth)
+	}
+	detail, err := manager.GetDeviceDetail(deviceA)
+	if err != nil || detail["commandQueueDepth"] != requests {
+		t.Fatalf("设备详情应包含队列深度: %v %v", detail["commandQueueDepth"], err)
+	}
+	if err := manager.SendCommandToDevice(ctx, deviceA, constants.CmdChargeControl, []byte{0x01}); !errors.Is(err, core.ErrCommandQueueFull) {
+		t.Fatalf("队列已满时应拒绝下发，实际 %v", err)
+	}
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("下发失败: %v", err)
+		}
+	}
+
+	// 帧未交错：线路上依次解析出全部命令且校验和、载荷一致
+	if wire.overlap.Load() {
+		t.Fatal("同一连接上出现并发写入")
+	}
+	parsed := 0
+	for offset := 0; offset < len(wire.data); {
+		rest := wire.data[offset:]
+		if len(rest) < 5 || string(rest[:3]) != "DNY" {
+			t.Fatalf("第 %d 帧包头损坏", parsed+1)
+		}
+		size := 5 + int(binary.LittleEndian.Uint16(rest[3:5]))
+		if size > len(rest) {
+			t.Fatalf("第 %d 帧长度越界", parsed+1)
+		}
+		frame, consumed, err := protocol.ParseDNYDataWithConsumed(rest[:size])
+		if err != nil || !frame.ChecksumValid || frame.Command != constants.CmdChargeControl {
+			t.Fatalf("第 %d 帧损坏: %v", parsed+1, err)
+		}
+		payload, ok := sent.Load(frame.MessageID)
+		if !ok || string(payload.([]byte)) != string(frame.Data) {
+			t.Fatalf("消息 %d 载荷不一致", frame.MessageID)
+		}
+		offset += consumed
+		parsed++
+	}
+	if parsed != requests {
+		t.Fatalf("应解析出 %d 帧，实际 %d", requests, parsed)
+	}
+
+	// 严格串行：每条命令应答后才写入下一条（调用方在写入后即返回，等待最后一条应答）
+	deadline = time.Now().Add(2 * time.Second)
+	for manager.CommandQueueDepth(deviceA) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if depth := manager.CommandQueueDepth(deviceA); depth != 0 {
+		t.Fatalf("队列应已清空，实际 %d", depth)
+	}
+	if len(wire.events) != 2*requests {
+		t.Fatalf("事件数错误: %v", wire.events)
+	}
+	for i := 0; i < len(wire.events); i += 2 {
+		var w, a int
+		if _, err := fmt.Sscanf(wire.events[i], "write-%d", &w); err != nil {
+			t.Fatalf("第 %d 个事件应为写入: %v", i, wire.events)
+		}
+		if _, err := fmt.Sscanf(wire.events[i+1], "ack-%d", &a); err != nil || a != w {
+			t.Fatalf("命令 %d 应答前写入了下一条: %v", w, wire.events)
+		}
+	}
+}
+
+// TestCommandQueueDeadline 设备组队列的期限：排在前面的命令按最长应答等待计算超出调用方期限时立即拒绝；
+// 排队期间调用方取消则撤回命令，该命令不再写入连接
+func TestCommandQueueDeadline(t *testing.T) {
+	quietLogger(t)
+	const deviceID = "04A27553"
+	manager := core.NewTCPManager(nil)
+	manager.SetCommandQueueConfig(&core.CommandQueueConfig{ConfirmTimeout: time.Second})
+	conn := &disconnectTestConn{id: 1755002}
+	if _, err := manager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.RegisterDevice(conn, deviceID, deviceID, "89860000000000175502"); err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{}) // 首条命令的应答在放行前不返回
+	var written atomic.Int32
+	manager.SetCommandWriter(func(ziface.IConnection, string, byte, []byte) (core.CommandWait, error) {
+		if written.Add(1) == 1 {
+			return func(time.Duration) error { <-gate; return nil }, nil
+		}
+		return nil, nil
+	})
+	if err := manager.SendCommandToDevice(context.Background(), deviceID, constants.CmdChargeControl, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 前面有一条等待应答的命令（最长1秒），200ms 的期限无法满足
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := manager.SendCommandToDevice(ctx, deviceID, constants.CmdChargeControl, []byte{0x02}); !errors.Is(err, core.ErrCommandQueueBusy) {
+		t.Fatalf("期限内无法写入时应立即拒绝，实际 %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 100*time.Millisecond {
+		t.Fatalf("应立即拒绝而非等待期限，耗时 %v", elapsed)
+	}
+
+	// 期限足够时排队，调用方取消后撤回
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if err := manager.SendCommandToDevice(ctx, deviceID, constants.CmdChargeControl, []byte{0x03}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("排队期间取消应返回取消错误，实际 %v", err)
+	}
+	if depth := manager.CommandQueueDepth(deviceID); depth != 1 {
+		t.Fatalf("撤回的命令应移出队列，深度应为1，实际 %d", depth)
+	}
+	close(gate)
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.CommandQueueDepth(deviceID) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := written.Load(); n != 1 {
+		t.Fatalf("被拒绝与撤回的命令不应写入连接，实际写入 %d 条", n)
+	}
+}
+
+// TestCommandQueueLimits 深度上限未设置时按 MaxWait/ConfirmTimeout 推导：未设置期限的调用方在该深度得到队列已满，
+// 此前不会因期限提前拒绝；显式设置的上限照常生效
+func TestCommandQueueLimits(t *testing.T) {
+	quietLogger(t)
+	if cfg := core.DefaultCommandQueueConfig(); cfg.MaxDepth != int(cfg.MaxWait/cfg.ConfirmTimeout) {
+		t.Fatalf("默认深度上限应为 MaxWait/ConfirmTimeout: %+v", cfg)
+	}
+
+	const deviceID = "04A27554"
+	manager := core.NewTCPManager(nil)
+	manager.SetCommandQueueConfig(&core.CommandQueueConfig{ConfirmTimeout: time.Second, MaxWait: 3 * time.Second})
+	if cfg := manager.GetCommandQueueConfig(); cfg.MaxDepth != 3 {
+		t.Fatalf("未设置深度上限时应取 3s/1s=3，实际 %d", cfg.MaxDepth)
+	}
+	conn := &disconnectTestConn{id: 1755003}
+	if _, err := manager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.RegisterDevice(conn, deviceID, deviceID, "89860000000000175503"); err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{}) // 放行前所有命令的应答都不返回
+	manager.SetCommandWriter(func(ziface.IConnection, string, byte, []byte) (core.CommandWait, error) {
+		return func(time.Duration) error { <-gate; return nil }, nil
+	})
+	defer close(gate)
+
+	// 首条写入后等待应答，其后两条排队（深度2时剩余期限约3s > 2×1s，不因期限拒绝）
+	if err := manager.SendCommandToDevice(context.Background(), deviceID, constants.CmdChargeControl, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		go func() {
+			_ = manager.SendCommandToDevice(context.Background(), deviceID, constants.CmdChargeControl, []byte{0x02})
+		}()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.CommandQueueDepth(deviceID) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if depth := manager.CommandQueueDepth(deviceID); depth != 3 {
+		t.Fatalf("推导的深度上限内应照常排队，深度应为3，实际 %d", depth)
+	}
+	if err := manager.SendCommandToDevice(context.Background(), deviceID, constants.CmdChargeControl, []byte{0x03}); !errors.Is(err, core.ErrCommandQueueFull) {
+		t.Fatalf("达到推导的深度上限应返回队列已满，实际 %v", err)
+	}
+
+	// 显式上限小于推导值时先触及
+	manager.SetCommandQueueConfig(&core.CommandQueueConfig{MaxDepth: 2, ConfirmTimeout: time.Second, MaxWait: 3 * time.Second})
+	if cfg := manager.GetCommandQueueConfig(); cfg.MaxDepth != 2 {
+		t.Fatalf("显式设置的深度上限应保留，实际 %d", cfg.MaxDepth)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	apperrors "github.com/bujia-iot/iot-zinx/pkg/errors"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// decodeNAKFrame 按线上解码路径解析样例帧
+func decodeNAKFrame(t *testing.T, physicalID uint32, messageID uint16, command uint8, data []byte) *dny_protocol.Message {
+	t.Helper()
+	return decodeConformanceFrame(t, 1702, protocol.BuildUnifiedDNYPacket(physicalID, messageID, command, data))
+}
+
+// TestDecodeNegativeAck 否定应答样例帧：通用错误帧（带/不带原命令）、原命令码单字节失败状态，以及不应误判的应答
+func TestDecodeNegativeAck(t *testing.T) {
+	const pid = 0x04A27201
+	pending := func(messageID uint16) (uint8, bool) {
+		if messageID == 0x0102 {
+			return 0x8A, true
+		}
+		return 0, false
+	}
+	cases := []struct {
+		name      string
+		messageID uint16
+		command   uint8
+		data      []byte
+		format    string
+		errorCode uint8
+	}{
+		{"通用错误帧", 0x0102, 0xFF, []byte{0x8A, 0x01}, protocol.NAKFormatErrorFrame, 0x01},
+		{"通用错误帧仅错误码", 0x0102, 0xFF, []byte{0x03}, protocol.NAKFormatErrorFrameShort, 0x03},
+		{"原命令码应答未知命令", 0x0102, 0x8A, []byte{0xFE}, protocol.NAKFormatEchoStatus, 0xFE},
+		{"原命令码应答错误", 0x0102, 0x8A, []byte{0xFF}, protocol.NAKFormatEchoStatus, 0xFF},
+		{"错误帧原命令不匹配", 0x0102, 0xFF, []byte{0x82, 0x01}, "", 0},
+		{"正常应答", 0x0102, 0x8A, []byte{0x00}, "", 0},
+		{"携带业务数据的应答", 0x0102, 0x8A, []byte{0xFF, 0x00}, "", 0},
+		{"没有待应答命令", 0x0103, 0xFF, []byte{0x8A, 0x01}, "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := decodeNAKFrame(t, pid, tc.messageID, tc.command, tc.data)
+			nak, ok := protocol.DecodeNegativeAck(msg, pending)
+			if ok != (tc.format != "") {
+				t.Fatalf("识别结果错误: ok=%v %+v", ok, nak)
+			}
+			if !ok {
+				return
+			}
+			if nak.Format != tc.format || nak.ErrorCode != tc.errorCode || nak.Command != 0x8A || nak.ReplyCommand != tc.command || nak.MessageID != tc.messageID {
+				t.Fatalf("解析结果错误: %+v", nak)
+			}
+		})
+	}
+}
+
+// TestCommandRejection 否定应答立即结束待应答命令：等待者收到 DEVICE_REJECTED，记入统计、事件与时间线
+func TestCommandRejection(t *testing.T) {
+	const pid = 0x04A27202
+	cm := network.GetCommandManager()
+	cm.ResetRejectionStats(pid)
+	sub := events.GetGlobalBus().Subscribe(events.SubscribeOptions{
+		Name:   "command-rejection-test",
+		Filter: func(ev events.Event) bool { return ev.Type == network.EventTypeCommandRejected },
+	})
+	defer sub.Close()
+
+	handle := cm.RegisterCommandWithOptions(&disconnectTestConn{id: 72002}, pid, 0x0201, 0x8A, []byte{0x01}, network.CommandOptions{CorrelationID: "corr-1702"})
+	if cm.HandleNegativeAck(decodeNAKFrame(t, pid, 0x0202, 0xFF, []byte{0x8A, 0x01})) {
+		t.Fatal("消息ID不匹配的错误帧不应结束命令")
+	}
+	if !cm.HandleNegativeAck(decodeNAKFrame(t, pid, 0x0201, 0xFF, []byte{0x8A, 0x05})) {
+		t.Fatal("否定应答应结束待应答命令")
+	}
+
+	start := time.Now()
+	err := handle.Wait(5 * time.Second)
+	if time.Since(start) > time.Second {
+		t.Fatal("否定应答后等待者应立即返回")
+	}
+	if !apperrors.IsErrCode(err, apperrors.ErrDeviceRejected) {
+		t.Fatalf("应返回设备拒绝错误: %v", err)
+	}
+	var rejected *network.RejectionError
+	if !errors.As(err, &rejected) || rejected.Rejection.ErrorCode != 0x05 || rejected.Rejection.Command != 0x8A ||
+		rejected.Rejection.Format != protocol.NAKFormatErrorFrame || rejected.Rejection.CorrelationID != "corr-1702" {
+		t.Fatalf("错误应携带设备错误码: %+v", rejected)
+	}
+	if _, ok := cm.PendingCommand(pid, 0x0201); ok {
+		t.Fatal("被拒绝的命令不应再等待应答")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ev, ok := sub.Next(ctx)
+	if !ok || ev.DeviceID != "04A27202" || ev.Topic != events.TopicDevice {
+		t.Fatalf("应发布命令被拒绝事件: %+v", ev)
+	}
+
+	// 原命令码单字节失败状态
+	cm.RegisterCommand(&disconnectTestConn{id: 72002}, pid, 0x0203, 0x96, []byte{0x01})
+	if !cm.HandleNegativeAck(decodeNAKFrame(t, pid, 0x0203, 0x96, []byte{0xFE})) {
+		t.Fatal("原命令码未知命令应答应结束命令")
+	}
+	stats, ok := cm.GetRejectionStats(pid)
+	if !ok || stats.Total != 2 || stats.ByCommand["0x8A"] != 1 || stats.ByCommand["0x96"] != 1 || len(stats.Recent) != 2 || stats.Recent[0].Command != 0x96 {
+		t.Fatalf("拒绝统计错误: %+v", stats)
+	}
+
+	page, err := gateway.GetGlobalDeviceGateway().GetDeviceTimeline("04A27202", gateway.TimelineQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejectedEntries := 0
+	for _, item := range page.Items {
+		if item.Type == gateway.TimelineTypeCommand && item.Data["status"] == network.CmdStatusRejected {
+			rejectedEntries++
+		}
+	}
+	if rejectedEntries != 2 {
+		t.Fatalf("时间线应包含2条被拒绝命令: %+v", page.Items)
+	}
+}
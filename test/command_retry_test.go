@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+)
+
+// TestCommandRetransmission 命令重发：设备吞掉前两次发送、第三次发送后应答时命令确认且不触发失败回调；
+// 完全不应答的设备在按策略发送 1+maxRetries 次后触发失败回调，开始充电的订单与会话置为失败。每次重发都是原消息ID的同一帧
+func TestCommandRetransmission(t *testing.T) {
+	quietLogger(t)
+	const (
+		responsiveID   = "04A27167"
+		unresponsiveID = "04A27168"
+		orderNo        = "ORD-1767-A"
+	)
+	g := gateway.GetGlobalDeviceGateway()
+	cm := network.NewCommandManager()
+	cm.SetRetryPolicy(network.RetryPolicy{Interval: 80 * time.Millisecond, MaxRetries: 3})
+	var (
+		mu       sync.Mutex
+		failures []network.CommandFailure
+		sends    = map[uint32]int{}
+	)
+	cm.RegisterFailureHandler(g.OnCommandFailed)
+	cm.RegisterFailureHandler(func(failure network.CommandFailure) {
+		mu.Lock()
+		failures = append(failures, failure)
+		mu.Unlock()
+	})
+	takeFailures := func() []network.CommandFailure {
+		mu.Lock()
+		defer mu.Unlock()
+		out := failures
+		failures = nil
+		return out
+	}
+
+	// 模拟设备：命令照常写入连接，0x04A27167 在收到第三次发送后应答
+	previous := network.SendCommandFunc
+	network.SetSendCommandFunc(func(conn ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte) error {
+		err := previous(conn, physicalID, messageID, command, data)
+		mu.Lock()
+		sends[physicalID]++
+		n := sends[physicalID]
+		mu.Unlock()
+		if physicalID == 0x04A27167 && n == 3 {
+			go cm.ConfirmCommand(physicalID, messageID, command)
+		}
+		return err
+	})
+	t.Cleanup(func() { network.SetSendCommandFunc(previous) })
+	cm.Start()
+	t.Cleanup(cm.Stop)
+
+	conn := registerSharedGroup(t, 1767001, "89860000000000176701", []string{responsiveID})
+	data := []byte{0x01, 0x02, 0x03}
+	if err := network.SendCommandFunc(conn, 0x04A27167, 0x0767, 0x96, data); err != nil {
+		t.Fatal(err)
+	}
+	handle := cm.RegisterCommandWithOptions(conn, 0x04A27167, 0x0767, 0x96, data, network.CommandOptions{CorrelationID: "req-1767"})
+	if err := handle.Wait(3 * time.Second); err != nil {
+		t.Fatalf("第三次发送后设备应答，命令应确认: %v", err)
+	}
+	frames := waitFrames(t, conn, 3, nil)
+	for _, frame := range frames[1:] {
+		if !bytes.Equal(frame, frames[0]) {
+			t.Fatalf("重发应为原消息ID的同一帧: % X / % X", frame, frames[0])
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := takeFailures(); len(got) != 0 {
+		t.Fatalf("已确认的命令不应触发失败回调: %+v", got)
+	}
+	if stats := cm.Stats(); stats.Retransmissions != 2 || stats.Failed != 0 || stats.Pending != 0 || stats.Retrying != 0 {
+		t.Fatalf("重发统计错误: %+v", stats)
+	}
+	if extra := conn.take(); len(extra) != 0 {
+		t.Fatalf("确认后不应继续重发: %d", len(extra))
+	}
+
+	// 完全不应答：开始充电命令按策略发送4次后放弃
+	conn = registerSharedGroup(t, 1767002, "89860000000000176702", []string{unresponsiveID})
+	t.Cleanup(func() { network.GetCommandManager().ClearPhysicalIDCommands(0x04A27168) })
+	if _, err := g.StartChargingWithRequest("req-1767-b", gateway.ChargeRequest{DeviceID: unresponsiveID, Port: 2, OrderNo: orderNo, Mode: 0, Value: 3600, Balance: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	original := waitFrames(t, conn, 1, nil)[0]
+	_, messageID, command, payload := frameHeader(original)
+	cm.RegisterCommandWithOptions(conn, 0x04A27168, messageID, command, payload, network.CommandOptions{CorrelationID: "req-1767-b"})
+	retries := waitFrames(t, conn, 1, nil)
+	if stats := cm.Stats(); stats.Retrying != 1 {
+		t.Fatalf("重发后命令应计为重发中: %+v", stats)
+	}
+	retries = waitFrames(t, conn, 3, retries)
+	for _, frame := range retries {
+		if !bytes.Equal(frame, original) {
+			t.Fatalf("重发应为原消息ID的同一帧: % X / % X", frame, original)
+		}
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	var got []network.CommandFailure
+	for len(got) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		got = takeFailures()
+	}
+	if len(got) != 1 {
+		t.Fatalf("不应答的设备应触发一次失败回调: %+v", got)
+	}
+	if f := got[0]; f.DeviceID != unresponsiveID || f.MessageID != messageID || f.Attempts != 4 || f.Outcome != network.OutcomeDeviceTimeout || f.CorrelationID != "req-1767-b" {
+		t.Fatalf("失败回调内容错误: %+v", f)
+	}
+	if stats := cm.Stats(); stats.Failed != 1 || stats.Retransmissions != 5 || stats.Retrying != 0 {
+		t.Fatalf("放弃统计错误: %+v", stats)
+	}
+	if order := g.GetOrderManager().GetOrder(unresponsiveID, 2); order == nil || order.Status != gateway.OrderStatusFailed {
+		t.Fatalf("未应答的开始充电订单应置为失败: %+v", order)
+	}
+	if session, ok := g.GetChargingSessions().Get(orderNo); !ok || session.State != gateway.SessionFailed {
+		t.Fatalf("充电会话应置为失败: %+v", session)
+	}
+	if extra := conn.take(); len(extra) != 0 {
+		t.Fatalf("放弃后不应继续重发: %d", len(extra))
+	}
+}
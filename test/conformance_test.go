@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// decodeConformanceFrame 经解码器解析原始字节，得到与线上一致的消息
+func decodeConformanceFrame(t *testing.T, connID uint64, raw []byte) *dny_protocol.Message {
+	t.Helper()
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	defer decoder.ReleaseConnection(connID)
+	_, msg := decoder.DecodeFrame(connID, raw)
+	if msg == nil {
+		t.Fatalf("解码器未返回消息: % X", raw)
+	}
+	return msg
+}
+
+// TestConformanceVectors 严格模式一致性测试向量：每条规则至少一个违规与一个合规样例
+func TestConformanceVectors(t *testing.T) {
+	builder := protocol.NewUnifiedDNYBuilder()
+	const pid = 0x04A2715A
+
+	type frame struct {
+		raw    []byte
+		rule   string // 期望违反的规则ID，为空表示合规
+		action string
+	}
+	cases := []struct {
+		name   string
+		frames []frame
+	}{
+		{"注册6字节合规", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdDeviceRegister, make([]byte, 6))}}},
+		{"注册8字节合规", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdDeviceRegister, make([]byte, 8))}}},
+		{"注册长度错误应NAK", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdDeviceRegister, make([]byte, 7)), rule: "payload.0x20_register", action: protocol.ConformanceActionNAK}}},
+		{"结算35字节应NAK", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdSettlement, make([]byte, 35)), rule: "payload.0x03_settlement", action: protocol.ConformanceActionNAK}}},
+		{"结算37字节合规", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdSettlement, make([]byte, 37))}}},
+		{"物理ID为0", []frame{{raw: builder.BuildDNYPacket(0, 1, constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x02, 0x00, 0x00, 0x1F, 0x20}), rule: "header.physical_id_nonzero", action: protocol.ConformanceActionDrop}}},
+		{"消息ID为0", []frame{{raw: builder.BuildDNYPacket(pid, 0, constants.CmdDeviceRegister, make([]byte, 6)), rule: "header.message_id_nonzero", action: protocol.ConformanceActionNAK}}},
+		{"心跳端口数与长度一致", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x02, 0x00, 0x00, 0x1F, 0x20})}}},
+		{"心跳端口数与长度不符应丢弃", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x04, 0x00, 0x00, 0x1F, 0x20}), rule: "payload.0x21_heartbeat", action: protocol.ConformanceActionDrop}}},
+		{"刷卡卡号长度不符", []frame{{raw: builder.BuildDNYPacket(pid, 1, constants.CmdSwipeCard, append(make([]byte, 12), 0x03, 0x01)), rule: "payload.0x02_swipe_card", action: protocol.ConformanceActionDrop}}},
+		{"消息ID回退", []frame{
+			{raw: builder.BuildDNYPacket(pid, 5, constants.CmdDeviceRegister, make([]byte, 6))},
+			{raw: builder.BuildDNYPacket(pid, 5, constants.CmdDeviceRegister, make([]byte, 6)), rule: "header.message_id_monotonic", action: protocol.ConformanceActionNAK},
+			{raw: builder.BuildDNYPacket(pid, 4, constants.CmdDeviceRegister, make([]byte, 6)), rule: "header.message_id_monotonic", action: protocol.ConformanceActionNAK},
+			{raw: builder.BuildDNYPacket(pid, 6, constants.CmdDeviceRegister, make([]byte, 6))},
+		}},
+		{"消息ID回绕合规", []frame{
+			{raw: builder.BuildDNYPacket(pid, 0xFFFF, constants.CmdDeviceRegister, make([]byte, 6))},
+			{raw: builder.BuildDNYPacket(pid, 0x0001, constants.CmdDeviceRegister, make([]byte, 6))},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := protocol.NewConformanceChecker(protocol.ConformanceOptions{})
+			now := time.Now()
+			for i, f := range tc.frames {
+				msg := decodeConformanceFrame(t, 1, f.raw)
+				v := checker.Check(1, msg, now.Add(time.Duration(i)*time.Second))
+				if f.rule == "" {
+					if v != nil {
+						t.Fatalf("第%d帧应合规，实际违反 %s: %s", i, v.RuleID, v.Detail)
+					}
+					continue
+				}
+				if v == nil || v.RuleID != f.rule || v.Action != f.action {
+					t.Fatalf("第%d帧应违反 %s(%s)，实际: %+v", i, f.rule, f.action, v)
+				}
+				if v.OffendingBytes == "" {
+					t.Fatalf("违规记录缺少问题字节: %+v", v)
+				}
+			}
+		})
+	}
+}
+
+// TestConformanceUndecodableFrame 校验和 strict 模式丢弃的帧由一致性检查记录为 frame.decodable 违规（两种一致性模式均丢弃）
+func TestConformanceUndecodableFrame(t *testing.T) {
+	raw := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(0x04A2715A, 1, constants.CmdDeviceRegister, make([]byte, 6))
+	raw[len(raw)-1] ^= 0xFF
+
+	verifier, err := protocol.NewChecksumVerifier(protocol.ChecksumPolicy{Mode: protocol.ChecksumModeStrict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := protocol.NewConformanceChecker(protocol.ConformanceOptions{})
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	decoder.SetChecksumVerifier(verifier)
+	decoder.SetConformance(checker)
+	defer decoder.ReleaseConnection(7)
+	if _, msg := decoder.DecodeFrame(7, raw); msg != nil {
+		t.Fatalf("校验和错误的帧应被丢弃: %+v", msg)
+	}
+	items, total := checker.Violations(0)
+	if total != 1 || items[0].RuleID != "frame.decodable" || items[0].Action != protocol.ConformanceActionDrop || items[0].ConnID != 7 {
+		t.Fatalf("应记录 frame.decodable 违规: %d %+v", total, items)
+	}
+}
+
+// TestConformanceMessageIDWindow 超过检查窗口后消息ID基线失效（设备重启后从1开始）
+func TestConformanceMessageIDWindow(t *testing.T) {
+	builder := protocol.NewUnifiedDNYBuilder()
+	checker := protocol.NewConformanceChecker(protocol.ConformanceOptions{MessageIDWindow: time.Minute})
+	now := time.Now()
+	if v := checker.Check(1, decodeConformanceFrame(t, 1, builder.BuildDNYPacket(0x04A2715A, 100, constants.CmdDeviceRegister, make([]byte, 6))), now); v != nil {
+		t.Fatalf("首帧应合规: %+v", v)
+	}
+	if v := checker.Check(1, decodeConformanceFrame(t, 1, builder.BuildDNYPacket(0x04A2715A, 1, constants.CmdDeviceRegister, make([]byte, 6))), now.Add(2*time.Minute)); v != nil {
+		t.Fatalf("窗口外消息ID重置应合规: %+v", v)
+	}
+}
+
+// TestConformanceViolationLog 违规记录有界，按新→旧返回；非DNY帧不检查；模式按监听器覆盖
+func TestConformanceViolationLog(t *testing.T) {
+	builder := protocol.NewUnifiedDNYBuilder()
+	checker := protocol.NewConformanceChecker(protocol.ConformanceOptions{MaxViolations: 3})
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		msg := decodeConformanceFrame(t, uint64(i+1), builder.BuildDNYPacket(0x04A2715A, uint16(i+1), constants.CmdSettlement, make([]byte, 10)))
+		checker.Check(uint64(i+1), msg, now)
+	}
+	items, total := checker.Violations(0)
+	if total != 5 || len(items) != 3 {
+		t.Fatalf("违规记录应有界: total=%d len=%d", total, len(items))
+	}
+	if items[0].ConnID != 5 || items[2].ConnID != 3 {
+		t.Fatalf("违规记录应按新→旧排列: %d %d", items[0].ConnID, items[2].ConnID)
+	}
+	if items, _ := checker.Violations(1); len(items) != 1 || items[0].ConnID != 5 {
+		t.Fatal("limit 应返回最新的记录")
+	}
+	if pid, mid, cmd, nak := items[0].NAK(); !nak || pid != 0x04A2715A || mid != 5 || cmd != constants.CmdSettlement {
+		t.Fatalf("NAK 帧标识错误: %X %d %X %v", pid, mid, cmd, nak)
+	}
+
+	iccid := decodeConformanceFrame(t, 9, []byte("89860404192080617692"))
+	if iccid.MessageType != "iccid" || checker.Check(9, iccid, now) != nil {
+		t.Fatal("ICCID 直传报文不应参与一致性检查")
+	}
+
+	cfg := config.ConformanceConfig{}
+	if cfg.EffectiveMode("") != config.ConformanceModePermissive {
+		t.Fatal("默认应为宽松模式")
+	}
+	cfg.Mode = config.ConformanceModeStrict
+	if cfg.EffectiveMode("") != config.ConformanceModeStrict || cfg.EffectiveMode(config.ConformanceModePermissive) != config.ConformanceModePermissive {
+		t.Fatal("监听器配置应覆盖全局模式")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// commLogCapture 记录通信日志中的条目
+type commLogCapture struct {
+	mu      sync.Mutex
+	entries []logrus.Entry
+}
+
+func (h *commLogCapture) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *commLogCapture) Fire(e *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, logrus.Entry{Message: e.Message, Data: e.Data})
+	return nil
+}
+
+// find 查找消息包含 message 且链路追踪ID为 correlationID 的条目
+func (h *commLogCapture) find(message, correlationID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.entries {
+		if strings.Contains(e.Message, message) && e.Data["correlationID"] == correlationID {
+			return true
+		}
+	}
+	return false
+}
+
+// TestCorrelationIDMiddleware 接收调用方的 X-Request-ID（去首尾空白），缺失或超过64字符时生成新ID；写入上下文与响应头
+func TestCorrelationIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apihttp.CorrelationIDMiddleware())
+	r.GET("/echo", func(c *gin.Context) { c.String(http.StatusOK, apihttp.GetCorrelationID(c)) })
+
+	cases := []struct {
+		name      string
+		header    string
+		want      string // 为空表示应生成新ID
+		generated bool
+	}{
+		{"接受调用方ID", "req-1633-a", "req-1633-a", false},
+		{"去除首尾空白", "  req-1633-b  ", "req-1633-b", false},
+		{"恰好64字符保留", strings.Repeat("a", 64), strings.Repeat("a", 64), false},
+		{"超过64字符替换", strings.Repeat("b", 65), "", true},
+		{"缺失时生成", "", "", true},
+		{"空白时生成", "   ", "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/echo", nil)
+			if tc.header != "" {
+				req.Header.Set(apihttp.HeaderRequestID, tc.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			got := w.Body.String()
+			if w.Header().Get(apihttp.HeaderRequestID) != got {
+				t.Fatalf("响应头与上下文中的ID应一致: %q / %q", w.Header().Get(apihttp.HeaderRequestID), got)
+			}
+			if !tc.generated {
+				if got != tc.want {
+					t.Fatalf("应沿用调用方ID %q，实际 %q", tc.want, got)
+				}
+				return
+			}
+			if _, err := uuid.Parse(got); err != nil {
+				t.Fatalf("应生成UUID格式的新ID，实际 %q", got)
+			}
+		})
+	}
+}
+
+// TestCorrelationIDPropagation 各命令下发接口携带的 X-Request-ID 写入命令条目与下发日志，
+// 设备应答日志与充电开始通知沿用下发时的ID
+func TestCorrelationIDPropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quietLogger(t)
+	const (
+		deviceID = "04A16331"
+		iccid    = "89860000000000163301"
+		orderNo  = "ORD-1633-A"
+	)
+
+	// 启用通知集成器（无端点），充电应答处理器据此发布充电开始通知
+	cfg := config.GetConfig()
+	saved := cfg.Notification
+	cfg.Notification.Enabled = true
+	cfg.Notification.QueueSize = 10
+	cfg.Notification.Workers = 1
+	if err := notification.InitGlobalNotificationIntegrator(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = notification.StopGlobalNotificationIntegrator(context.Background())
+		cfg.Notification = saved
+		_ = notification.InitGlobalNotificationIntegrator(context.Background())
+	})
+	sub := events.GetGlobalBus().Subscribe(events.SubscribeOptions{Filter: func(ev events.Event) bool {
+		return ev.DeviceID == deviceID && ev.Type == notification.EventTypeChargingStart
+	}})
+	t.Cleanup(sub.Close)
+
+	commLog := &commLogCapture{}
+	commLogger := logger.GetCommunicationLogger()
+	hooks := logrus.LevelHooks{}
+	for level, hs := range commLogger.Hooks {
+		hooks[level] = append([]logrus.Hook(nil), hs...)
+	}
+	commLogger.AddHook(commLog)
+	t.Cleanup(func() { commLogger.ReplaceHooks(hooks) })
+
+	conn := registerSharedGroup(t, 1633001, iccid, []string{deviceID})
+	device := simulator.NewDevice(0x04A16331, iccid, dialect.AP3000)
+	t.Cleanup(func() { network.GetCommandManager().ClearPhysicalIDCommands(device.PhysicalID) })
+
+	chargingHandlers := apihttp.NewChargingHandlers()
+	deviceHandlers := apihttp.NewDeviceHandlers()
+	r := gin.New()
+	r.Use(apihttp.CorrelationIDMiddleware())
+	r.POST("/api/v1/charging/start", chargingHandlers.HandleStartCharging)
+	r.POST("/api/v1/charging/update_power", chargingHandlers.HandleUpdateChargingPower)
+	r.POST("/api/v1/charging/stop", chargingHandlers.HandleStopCharging)
+	r.POST("/api/v1/device/locate", deviceHandlers.HandleDeviceLocate)
+
+	// dispatch 以指定 X-Request-ID 调用接口，返回下发的命令帧，并校验命令条目携带该ID
+	dispatch := func(t *testing.T, path, body, correlationID string, command byte) simulator.Downlink {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(apihttp.HeaderRequestID, correlationID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get(apihttp.HeaderRequestID) != correlationID {
+			t.Fatalf("%s 调用失败: %d %s", path, w.Code, w.Body.String())
+		}
+		down, err := device.ParseDownlink(waitFrames(t, conn, 1, nil)[0])
+		if err != nil || down.Command != command {
+			t.Fatalf("%s 应下发 0x%02X: %+v %v", path, command, down, err)
+		}
+		found := false
+		for _, cmd := range network.GetCommandManager().GetPhysicalIDCommands(device.PhysicalID) {
+			if cmd.MessageID == down.MessageID && cmd.Command == command {
+				found = cmd.CorrelationID == correlationID
+			}
+		}
+		if !found {
+			t.Fatalf("%s 的命令条目应携带链路追踪ID %q", path, correlationID)
+		}
+		if !commLog.find("[SEND] 数据发送", correlationID) {
+			t.Fatalf("%s 的下发日志应携带链路追踪ID %q", path, correlationID)
+		}
+		return down
+	}
+	ack := func(t *testing.T, down simulator.Downlink) {
+		t.Helper()
+		frame, err := device.ChargeControlResponse(down.MessageID, dialect.ChargeControlResponse{Port: 0, OrderNo: orderNo})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := znet.NewRequest(conn, zpack.NewMsgPackage(uint32(constants.CmdChargeControl), frame))
+		req.BindRouter(&handlers.ChargeControlHandler{})
+		req.Call()
+	}
+
+	t.Run("开始充电：命令条目、应答日志与充电开始通知", func(t *testing.T) {
+		const correlationID = "req-1633-start"
+		down := dispatch(t, "/api/v1/charging/start",
+			`{"deviceId":"`+deviceID+`","port":1,"mode":0,"value":3600,"orderNo":"`+orderNo+`","balance":1000}`, correlationID, constants.CmdChargeControl)
+		ack(t, down)
+		if !commLog.find("[RECV] 命令应答", correlationID) {
+			t.Fatalf("设备应答日志应携带下发时的链路追踪ID %q", correlationID)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		ev, ok := sub.Next(ctx)
+		if !ok {
+			t.Fatal("应发布充电开始通知")
+		}
+		if n, _ := ev.Payload.(*notification.NotificationEvent); n == nil || n.CorrelationID != correlationID {
+			t.Fatalf("充电开始通知应携带链路追踪ID %q: %+v", correlationID, ev.Payload)
+		}
+	})
+
+	t.Run("调整过载功率", func(t *testing.T) {
+		ack(t, dispatch(t, "/api/v1/charging/update_power",
+			`{"deviceId":"`+deviceID+`","port":1,"orderNo":"`+orderNo+`","overloadPowerW":2200}`, "req-1633-power", constants.CmdChargeControl))
+	})
+
+	t.Run("设备定位", func(t *testing.T) {
+		down := dispatch(t, "/api/v1/device/locate", `{"deviceId":"`+deviceID+`","locateTime":5}`, "req-1633-locate", constants.CmdDeviceLocate)
+		// 设备应答定位命令，放行设备组出站队列
+		if confirmed, correlationID := network.GetCommandManager().ConfirmCommandWithCorrelation(device.PhysicalID, down.MessageID, constants.CmdDeviceLocate); !confirmed || correlationID != "req-1633-locate" {
+			t.Fatalf("定位命令确认应取回链路追踪ID: %v %q", confirmed, correlationID)
+		}
+	})
+
+	t.Run("停止充电", func(t *testing.T) {
+		dispatch(t, "/api/v1/charging/stop", `{"deviceId":"`+deviceID+`","port":1,"orderNo":"`+orderNo+`"}`, "req-1633-stop", constants.CmdChargeControl)
+	})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/extension"
+	"github.com/bujia-iot/iot-zinx/pkg/extension/example"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// routeCapture 记录装配结果的路由表
+type routeCapture map[uint32]ziface.IRouter
+
+func (m routeCapture) AddRouter(msgID uint32, router ziface.IRouter) { m[msgID] = router }
+
+// innerRouter 逐层展开包装后的处理器
+func innerRouter(router ziface.IRouter) ziface.IRouter {
+	for {
+		wrapper, ok := router.(interface{ Unwrap() ziface.IRouter })
+		if !ok {
+			return router
+		}
+		router = wrapper.Unwrap()
+	}
+}
+
+// customRecordingRouter 记录收到的帧
+type customRecordingRouter struct {
+	protocol.SimpleHandlerBase
+	frames  atomic.Int32
+	lastCmd atomic.Int32
+}
+
+func (h *customRecordingRouter) Handle(request ziface.IRequest) {
+	frame, err := h.ExtractDecodedFrame(request)
+	if err != nil {
+		return
+	}
+	h.frames.Add(1)
+	h.lastCmd.Store(int32(frame.Command))
+}
+
+// customPanicRouter 每帧都panic
+type customPanicRouter struct{ znet.BaseRouter }
+
+func (h *customPanicRouter) Handle(ziface.IRequest) { panic("custom router failure") }
+
+// TestCustomRouterRegistration 自定义处理器收到其命令的帧；冲突命令默认不覆盖内置处理器，显式允许后覆盖；
+// 处理器panic由 handlerguard 恢复并计数，工厂panic/返回nil或配置禁用的处理器不加载，均不影响内置路由与其他处理器
+func TestCustomRouterRegistration(t *testing.T) {
+	if infos := extension.GetGlobalRegistry().Handlers(); len(infos) != 1 || infos[0].Command != "0x42" || !strings.Contains(infos[0].Label, "报警") {
+		t.Fatalf("导入示例扩展包时应注册 0x42: %+v", infos)
+	}
+	extension.SetGlobalRegistry(extension.NewRegistry())
+	defer extension.SetGlobalRegistry(nil)
+	guard, err := handlerguard.New(handlerguard.Options{DeviceThreshold: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlerguard.SetGlobalGuard(guard)
+	defer handlerguard.SetGlobalGuard(nil)
+	saved := config.GetConfig().Extensions
+	config.GetConfig().Extensions = config.ExtensionsConfig{Disabled: []string{"0x4D"}, OverrideBuiltin: []string{"0x96"}}
+	defer func() { config.GetConfig().Extensions = saved }()
+
+	recorder, locator := &customRecordingRouter{}, &customRecordingRouter{}
+	var gotDeps extension.HandlerDeps
+	register := map[byte]func(extension.HandlerDeps) ziface.IRouter{
+		0x4A:                      func(deps extension.HandlerDeps) ziface.IRouter { gotDeps = deps; return recorder },
+		0x4B:                      func(extension.HandlerDeps) ziface.IRouter { return &customPanicRouter{} },
+		0x4C:                      func(extension.HandlerDeps) ziface.IRouter { panic("factory failure") },
+		0x4D:                      func(extension.HandlerDeps) ziface.IRouter { return &customRecordingRouter{} },
+		0x4E:                      func(extension.HandlerDeps) ziface.IRouter { return nil },
+		constants.CmdHeartbeat:    func(extension.HandlerDeps) ziface.IRouter { return &customRecordingRouter{} },
+		constants.CmdDeviceLocate: func(extension.HandlerDeps) ziface.IRouter { return locator },
+	}
+	for cmd, factory := range register {
+		if err := extension.RegisterCustomRouter(cmd, factory); err != nil {
+			t.Fatalf("注册 0x%02X 失败: %v", cmd, err)
+		}
+	}
+	if err := extension.RegisterCustomRouter(0x4A, register[0x4A]); !errors.Is(err, extension.ErrDuplicate) {
+		t.Fatalf("重复注册应被拒绝: %v", err)
+	}
+
+	routes := routeCapture{}
+	handlers.RegisterRouters(routes)
+	if err := extension.RegisterCustomRouter(0x4F, register[0x4A]); !errors.Is(err, extension.ErrSealed) {
+		t.Fatalf("装配后注册应被拒绝: %v", err)
+	}
+	if gotDeps == nil || gotDeps.Sender() == nil || gotDeps.Sessions() == nil || gotDeps.Events() == nil ||
+		gotDeps.Logger().Data["command"] != "0x4A" {
+		t.Fatalf("工厂应收到该命令的依赖: %+v", gotDeps)
+	}
+
+	if _, ok := innerRouter(routes[constants.CmdHeartbeat]).(*handlers.HeartbeatHandler); !ok {
+		t.Fatalf("未允许覆盖时内置处理器应保持: %T", innerRouter(routes[constants.CmdHeartbeat]))
+	}
+	if innerRouter(routes[constants.CmdDeviceLocate]) != locator {
+		t.Fatalf("显式允许后应覆盖内置处理器: %T", innerRouter(routes[constants.CmdDeviceLocate]))
+	}
+	for _, cmd := range []uint32{0x4C, 0x4D, 0x4E} {
+		if _, ok := routes[cmd]; ok {
+			t.Fatalf("0x%02X 不应加载", cmd)
+		}
+	}
+	if _, ok := routes[constants.CmdChargeControl]; !ok || len(routes) != 22 {
+		t.Fatalf("内置路由应完整保留并加入 0x4A/0x4B: %d", len(routes))
+	}
+
+	conn := &panicTestConn{disconnectTestConn: disconnectTestConn{id: 1709}}
+	dispatch := func(cmd uint8, messageID uint16) {
+		frame := protocol.BuildUnifiedDNYPacket(0x04A26CF3, messageID, cmd, []byte{0x01})
+		req := znet.NewRequest(conn, zpack.NewMsgPackage(uint32(cmd), frame))
+		req.BindRouter(routes[uint32(cmd)])
+		req.Call()
+	}
+	dispatch(0x4A, 0x0201)
+	dispatch(0x4B, 0x0202)
+	dispatch(0x4A, 0x0203)
+	dispatch(constants.CmdDeviceLocate, 0x0204)
+	if recorder.frames.Load() != 2 || recorder.lastCmd.Load() != 0x4A || locator.frames.Load() != 1 {
+		t.Fatalf("自定义处理器应收到其命令的帧: recorder=%d locator=%d", recorder.frames.Load(), locator.frames.Load())
+	}
+	if conn.stopped.Load() != 0 {
+		t.Fatal("自定义处理器panic不应关闭连接")
+	}
+	stats := guard.Stats()
+	if stats.TotalPanics != 1 || stats.ByCommand[constants.CommandLabel(0x4B)] != 1 {
+		t.Fatalf("自定义处理器panic应按命令计数: %+v", stats)
+	}
+	if rec := guard.Records(1)[0]; rec.Handler != "*main.customPanicRouter" {
+		t.Fatalf("隔离记录应标注自定义处理器类型: %s", rec.Handler)
+	}
+
+	infos := map[string]extension.HandlerInfo{}
+	for _, info := range extension.GetGlobalRegistry().Handlers() {
+		infos[info.Command] = info
+	}
+	want := map[string]string{
+		"0x01": extension.StatusConflict, "0x4A": extension.StatusActive, "0x4B": extension.StatusActive, "0x4C": extension.StatusFailed,
+		"0x4D": extension.StatusDisabled, "0x4E": extension.StatusFailed, "0x96": extension.StatusOverride,
+	}
+	for cmd, status := range want {
+		if infos[cmd].Status != status {
+			t.Fatalf("%s 状态应为 %s: %+v", cmd, status, infos[cmd])
+		}
+	}
+	if infos["0x4A"].Frames != 2 || infos["0x4B"].Frames != 1 || infos["0x4B"].Failures != 1 || infos["0x4C"].Detail == "" {
+		t.Fatalf("处理器计数错误: %+v", infos)
+	}
+
+	var metrics bytes.Buffer
+	extension.GetGlobalRegistry().WritePrometheus(&metrics)
+	if !strings.Contains(metrics.String(), `iot_custom_router_frames_total{command="0x4A",handler="*main.customRecordingRouter"} 2`) ||
+		!strings.Contains(metrics.String(), `iot_custom_router_failures_total{command="0x4B",handler="*main.customPanicRouter"} 1`) ||
+		strings.Contains(metrics.String(), `command="0x4D"`) {
+		t.Fatalf("指标错误:\n%s", metrics.String())
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/custom-routers", nil))
+	var resp struct {
+		Data []extension.HandlerInfo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || len(resp.Data) != 7 || resp.Data[0].Command != "0x01" {
+		t.Fatalf("诊断接口错误: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// fakeExtensionDeps 记录调用的 HandlerDeps 实现
+type fakeExtensionDeps struct {
+	replies   [][]byte
+	touched   []string
+	published []events.Event
+}
+
+func (d *fakeExtensionDeps) Sender() extension.Sender            { return d }
+func (d *fakeExtensionDeps) Sessions() extension.SessionAccessor { return d }
+func (d *fakeExtensionDeps) Logger() *logrus.Entry               { return logrus.NewEntry(logrus.New()) }
+func (d *fakeExtensionDeps) Events() extension.EventPublisher    { return d }
+
+func (d *fakeExtensionDeps) Reply(_ ziface.IConnection, physicalID uint32, messageID uint16, command uint8, data []byte) error {
+	d.replies = append(d.replies, protocol.BuildUnifiedDNYPacket(physicalID, messageID, command, data))
+	return nil
+}
+func (d *fakeExtensionDeps) SendCommand(string, byte, []byte) error { return nil }
+func (d *fakeExtensionDeps) SessionByConn(ziface.IConnection) (*core.ConnectionSession, bool) {
+	return nil, false
+}
+func (d *fakeExtensionDeps) SessionByDeviceID(string) (*core.ConnectionSession, bool) {
+	return nil, false
+}
+func (d *fakeExtensionDeps) TouchHeartbeat(deviceID string) error {
+	d.touched = append(d.touched, deviceID)
+	return nil
+}
+func (d *fakeExtensionDeps) Publish(topic events.Topic, eventType, deviceID string, payload interface{}) events.Event {
+	ev := events.Event{Topic: topic, Type: eventType, DeviceID: deviceID, Payload: payload}
+	d.published = append(d.published, ev)
+	return ev
+}
+
+// TestExampleAlarmExtension 示例扩展：包初始化时注册 0x42，处理报警推送时刷新心跳、发布报警事件并按原消息ID应答
+func TestExampleAlarmExtension(t *testing.T) {
+	deps := &fakeExtensionDeps{}
+	h := example.NewAlarmRouter(deps)
+	conn := &disconnectTestConn{id: 1710}
+	frame := protocol.BuildUnifiedDNYPacket(0x04A26CF3, 0x0301, constants.CmdAlarm, []byte{0x03, 0x01})
+	req := znet.NewRequest(conn, zpack.NewMsgPackage(constants.CmdAlarm, frame))
+	req.BindRouter(h)
+	req.Call()
+
+	if len(deps.touched) != 1 || deps.touched[0] != "04A26CF3" {
+		t.Fatalf("应刷新设备心跳: %v", deps.touched)
+	}
+	if len(deps.published) != 1 || deps.published[0].Topic != events.TopicAlarm || deps.published[0].Type != example.EventTypeAlarm ||
+		deps.published[0].Payload.(map[string]interface{})["alarmType"] != byte(0x03) {
+		t.Fatalf("应发布报警事件: %+v", deps.published)
+	}
+	want := protocol.BuildUnifiedDNYPacket(0x04A26CF3, 0x0301, constants.CmdAlarm, []byte{0x00})
+	if len(deps.replies) != 1 || !bytes.Equal(deps.replies[0], want) {
+		t.Fatalf("应按原消息ID应答: %X", deps.replies)
+	}
+}
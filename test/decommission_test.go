@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/audit"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/decommission"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// decommissionTestConn 记录是否被关闭的连接桩
+type decommissionTestConn struct {
+	disconnectTestConn
+	stopped atomic.Bool
+}
+
+func (c *decommissionTestConn) Stop() { c.stopped.Store(true) }
+
+// TestDeviceDecommission 停用：归档快照与累计电量并持久化、断开并清除最近状态、拒绝注册并限频告警、重新启用解除黑名单
+func TestDeviceDecommission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := decommission.NewFileStore(filepath.Join(t.TempDir(), "decommissioned.json"))
+	registry, err := decommission.NewRegistry(store, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := decommission.GetGlobalRegistry()
+	decommission.SetGlobalRegistry(registry)
+	t.Cleanup(func() { decommission.SetGlobalRegistry(previous) })
+
+	var mu sync.Mutex
+	var events []string
+	registry.RegisterHandler(func(event decommission.Event) {
+		mu.Lock()
+		events = append(events, event.Type)
+		mu.Unlock()
+	})
+
+	const deviceID = "04B16840"
+	g := gateway.GetGlobalDeviceGateway()
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &decommissionTestConn{disconnectTestConn: disconnectTestConn{id: 1684001}}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, deviceID, deviceID, "89860400000016840001"); err != nil {
+		t.Fatal(err)
+	}
+	g.OnDeviceRegistered(deviceID)
+	core.GetDeviceParamCache().Update(deviceID, "firmware", "V2.1")
+	energy.GetGlobalCounters().OnSettlement(deviceID, 1, "ORDER_DECOM_1", 1500, time.Now())
+
+	h := apihttp.NewDeviceHandlers()
+	r := gin.New()
+	r.POST("/api/v1/device/:deviceId/decommission", h.HandleDeviceDecommission)
+	r.POST("/api/v1/device/:deviceId/recommission", h.HandleDeviceRecommission)
+	r.GET("/api/v1/devices/archived", h.HandleArchivedDevices)
+	r.GET("/api/v1/devices/archived/:deviceId", h.HandleArchivedDevice)
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	if code, _ := do(http.MethodPost, "/api/v1/device/"+deviceID+"/decommission", `{"reason":"报废"}`); code != http.StatusBadRequest {
+		t.Fatalf("缺少操作人应返回400: %d", code)
+	}
+	code, data := do(http.MethodPost, "/api/v1/device/"+deviceID+"/decommission", `{"reason":"报废","operator":"ops-1"}`)
+	if code != http.StatusOK || data["status"] != decommission.StatusDecommissioned || data["wasOnline"] != true {
+		t.Fatalf("停用失败: %d %+v", code, data)
+	}
+	snapshot := data["snapshot"].(map[string]interface{})
+	counters := data["energy"].([]interface{})
+	if snapshot["online"] != true || snapshot["params"].(map[string]interface{})["firmware"] != "V2.1" ||
+		len(counters) != 1 || counters[0].(map[string]interface{})["totalWh"].(float64) != 1500 {
+		t.Fatalf("归档应包含最后状态快照与累计电量: %+v %+v", snapshot, counters)
+	}
+
+	// 断开连接并清除实时与最近状态
+	if !conn.stopped.Load() || g.IsDeviceOnline(deviceID) {
+		t.Fatal("停用后应断开在线设备")
+	}
+	if _, ok := core.GetDeviceParamCache().Get(deviceID); ok {
+		t.Fatal("停用后应清除设备参数缓存")
+	}
+	if matches, _ := g.SearchDevices(deviceID, 0); len(matches) != 0 {
+		t.Fatalf("停用设备不应出现在搜索结果中: %+v", matches)
+	}
+	if summary := g.GetFleetSummary(time.Now()); summary.Devices.Decommissioned != 1 {
+		t.Fatalf("汇总应单独计数停用设备: %+v", summary.Devices)
+	}
+	core.GetDeviceParamCache().Update(deviceID, "firmware", "V2.1") // 停用后迟到的参数写入
+	t.Cleanup(func() { core.GetDeviceParamCache().Remove(deviceID) })
+	for _, s := range audit.DefaultSnapshotSource() {
+		if s.DeviceID == deviceID {
+			t.Fatal("停用设备不应参与合规审计")
+		}
+	}
+
+	if code, data := do(http.MethodPost, "/api/v1/device/"+deviceID+"/decommission", `{"reason":"报废","operator":"ops-1"}`); code != http.StatusConflict || data["errorCode"] != decommission.ErrorCodeDecommissioned {
+		t.Fatalf("重复停用应返回409: %d %+v", code, data)
+	}
+
+	// 黑名单持久化：重新加载后仍拒绝注册，告警按最小间隔发送
+	reloaded, err := decommission.NewRegistry(store, time.Hour)
+	if err != nil || !reloaded.IsDecommissioned(deviceID) {
+		t.Fatalf("停用归档应已持久化: %v", err)
+	}
+	now := time.Now()
+	registry.RejectRegistration(deviceID, "10.0.0.9:9000", now)
+	rec, blocked := registry.RejectRegistration(deviceID, "10.0.0.9:9001", now.Add(time.Minute))
+	if !blocked || rec.RejectedRegistrations != 2 || rec.LastRejectedAddr != "10.0.0.9:9001" {
+		t.Fatalf("停用设备注册应被拒绝并计数: %v %+v", blocked, rec)
+	}
+	if _, blocked := registry.RejectRegistration("04B16841", "10.0.0.9:9002", now); blocked {
+		t.Fatal("未停用设备不应被拒绝")
+	}
+
+	code, data = do(http.MethodGet, "/api/v1/devices/archived?status=decommissioned", "")
+	if code != http.StatusOK || data["total"].(float64) != 1 || data["decommissioned"].(float64) != 1 {
+		t.Fatalf("归档列表错误: %d %+v", code, data)
+	}
+	if code, _ := do(http.MethodGet, "/api/v1/devices/archived/04B16841", ""); code != http.StatusNotFound {
+		t.Fatalf("无归档设备应返回404: %d", code)
+	}
+
+	code, data = do(http.MethodPost, "/api/v1/device/"+deviceID+"/recommission", `{"reason":"维修完成","operator":"ops-2"}`)
+	if code != http.StatusOK || data["status"] != decommission.StatusRecommissioned || registry.IsDecommissioned(deviceID) {
+		t.Fatalf("重新启用失败: %d %+v", code, data)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/device/"+deviceID+"/recommission", `{"reason":"维修完成","operator":"ops-2"}`); code != http.StatusNotFound {
+		t.Fatalf("未停用设备重新启用应返回404: %d", code)
+	}
+	code, data = do(http.MethodGet, "/api/v1/devices/archived/"+deviceID, "")
+	if code != http.StatusOK || data["recommission"].(map[string]interface{})["operator"] != "ops-2" || data["reason"] != "报废" {
+		t.Fatalf("重新启用后归档应保留: %d %+v", code, data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{decommission.EventDecommissioned, decommission.EventRegistrationRejected, decommission.EventRecommissioned}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("事件错误: %v", events)
+	}
+}
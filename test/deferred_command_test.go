@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// TestDeferredCommandQueue 延迟命令：入队上限、取消、过期、回调、上线时下发中再次注册、持久化恢复
+func TestDeferredCommandQueue(t *testing.T) {
+	online := map[string]bool{}
+	var onlineMu sync.Mutex
+	isOnline := func(deviceID string) bool {
+		onlineMu.Lock()
+		defer onlineMu.Unlock()
+		return online[deviceID]
+	}
+
+	t.Run("入队上限与取消", func(t *testing.T) {
+		q := gateway.NewDeferredQueue(config.DeferredCommandsConfig{MaxPerDevice: 2}, isOnline)
+		q.RegisterExecutor("noop", func(cmd gateway.DeferredCommand) (interface{}, error) { return nil, nil })
+
+		if _, err := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF3", Kind: "unknown"}); !errors.Is(err, gateway.ErrDeferredUnsupported) {
+			t.Fatalf("未注册的命令类型应拒绝: %v", err)
+		}
+		first, _ := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF3", Kind: "noop", Originator: "ops"})
+		_, _ = q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF3", Kind: "noop"})
+		if _, err := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF3", Kind: "noop"}); !errors.Is(err, gateway.ErrDeferredQueueFull) {
+			t.Fatalf("超过单设备上限应拒绝: %v", err)
+		}
+
+		cancelled, err := q.Cancel("04A26CF3", first.ID)
+		if err != nil || cancelled.Status != gateway.DeferredStatusCancelled || cancelled.Originator != "ops" {
+			t.Fatalf("取消失败: %+v %v", cancelled, err)
+		}
+		if _, err := q.Cancel("04A26CF3", first.ID); !errors.Is(err, gateway.ErrDeferredNotFound) {
+			t.Fatalf("重复取消应返回不存在: %v", err)
+		}
+		pending, history := q.List("04A26CF3")
+		if len(pending) != 1 || len(history) != 1 || history[0].ID != first.ID {
+			t.Fatalf("取消后列表错误: %d %d", len(pending), len(history))
+		}
+	})
+
+	t.Run("过期与结果回调", func(t *testing.T) {
+		received := make(chan gateway.DeferredCommand, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var cmd gateway.DeferredCommand
+			_ = json.NewDecoder(r.Body).Decode(&cmd)
+			received <- cmd
+		}))
+		defer srv.Close()
+
+		executed := false
+		q := gateway.NewDeferredQueue(config.DeferredCommandsConfig{}, isOnline)
+		q.RegisterExecutor("noop", func(cmd gateway.DeferredCommand) (interface{}, error) {
+			executed = true
+			return nil, nil
+		})
+		cmd, err := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF4", Kind: "noop", CallbackURL: srv.URL, TTL: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(30 * time.Millisecond)
+
+		// 设备在有效期后才上线：命令以 expired 结束而不是下发
+		q.Drain("04A26CF4")
+		if executed {
+			t.Fatal("过期命令不应下发")
+		}
+		_, history := q.List("04A26CF4")
+		if len(history) != 1 || history[0].Status != gateway.DeferredStatusExpired {
+			t.Fatalf("过期状态错误: %+v", history)
+		}
+		select {
+		case got := <-received:
+			if got.ID != cmd.ID || got.Status != gateway.DeferredStatusExpired {
+				t.Fatalf("回调内容错误: %+v", got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("未收到结果回调")
+		}
+
+		if _, err := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF4", Kind: "noop", CallbackURL: "ftp://x"}); err == nil {
+			t.Fatal("非 http(s) 回调地址应拒绝")
+		}
+	})
+
+	t.Run("下发中设备再次注册不会并发下发", func(t *testing.T) {
+		q := gateway.NewDeferredQueue(config.DeferredCommandsConfig{}, isOnline)
+		release := make(chan struct{})
+		started := make(chan struct{}, 4)
+		var running, maxRunning int32
+		var mu sync.Mutex
+		var order []string
+		q.RegisterExecutor("blocking", func(cmd gateway.DeferredCommand) (interface{}, error) {
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, n)
+			}
+			defer atomic.AddInt32(&running, -1)
+			mu.Lock()
+			order = append(order, cmd.ID)
+			mu.Unlock()
+			started <- struct{}{}
+			<-release
+			return "ok", nil
+		})
+
+		first, _ := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF5", Kind: "blocking"})
+		done := make(chan bool)
+		go func() { done <- q.Drain("04A26CF5") }()
+		<-started
+
+		// 第一条命令下发期间设备再次注册，并有新命令入队
+		second, _ := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF5", Kind: "blocking"})
+		if _, err := q.Cancel("04A26CF5", first.ID); !errors.Is(err, gateway.ErrDeferredInProgress) {
+			t.Fatalf("下发中的命令不应可取消: %v", err)
+		}
+		if q.Drain("04A26CF5") {
+			t.Fatal("已有下发进行中时再次注册应立即返回false")
+		}
+
+		release <- struct{}{}
+		<-started
+		release <- struct{}{}
+		if !<-done {
+			t.Fatal("首次下发应完成")
+		}
+
+		if atomic.LoadInt32(&maxRunning) != 1 {
+			t.Fatalf("同一设备的命令不应并发下发: %d", maxRunning)
+		}
+		if len(order) != 2 || order[0] != first.ID || order[1] != second.ID {
+			t.Fatalf("应按入队顺序各下发一次: %v", order)
+		}
+		pending, history := q.List("04A26CF5")
+		if len(pending) != 0 || len(history) != 2 || history[0].Status != gateway.DeferredStatusDelivered || history[0].Result != "ok" {
+			t.Fatalf("下发结果错误: %+v", history)
+		}
+	})
+
+	t.Run("下发时设备离线则保留命令", func(t *testing.T) {
+		q := gateway.NewDeferredQueue(config.DeferredCommandsConfig{}, isOnline)
+		q.RegisterExecutor("send", func(cmd gateway.DeferredCommand) (interface{}, error) {
+			if !isOnline(cmd.DeviceID) {
+				return nil, errors.New("设备不在线")
+			}
+			return nil, nil
+		})
+		_, _ = q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF6", Kind: "send"})
+		q.Drain("04A26CF6")
+		if pending, _ := q.List("04A26CF6"); len(pending) != 1 || pending[0].Status != gateway.DeferredStatusPending || pending[0].Attempts != 1 {
+			t.Fatalf("设备离线时命令应保留: %+v", pending)
+		}
+
+		onlineMu.Lock()
+		online["04A26CF6"] = true
+		onlineMu.Unlock()
+		q.Drain("04A26CF6")
+		if pending, history := q.List("04A26CF6"); len(pending) != 0 || history[0].Status != gateway.DeferredStatusDelivered || history[0].Attempts != 2 {
+			t.Fatalf("设备上线后应下发: %+v", history)
+		}
+	})
+
+	t.Run("持久化恢复", func(t *testing.T) {
+		cfg := config.DeferredCommandsConfig{File: filepath.Join(t.TempDir(), "deferred.json")}
+		q := gateway.NewDeferredQueue(cfg, isOnline)
+		q.RegisterExecutor("noop", func(cmd gateway.DeferredCommand) (interface{}, error) { return nil, nil })
+		a, _ := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF7", Kind: "noop", Params: gateway.DeferredRebootParams{Force: true}})
+		b, _ := q.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF7", Kind: "noop"})
+
+		reloaded := gateway.NewDeferredQueue(cfg, isOnline)
+		pending, _ := reloaded.List("04A26CF7")
+		var params gateway.DeferredRebootParams
+		if len(pending) == 2 {
+			_ = json.Unmarshal(pending[0].Params, &params)
+		}
+		if len(pending) != 2 || pending[0].ID != a.ID || pending[1].ID != b.ID || !params.Force {
+			t.Fatalf("重启后待下发命令未恢复: %+v", pending)
+		}
+	})
+}
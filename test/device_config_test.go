@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// 0x90~0x93 查询应答样例（小端）
+var configSectionSamples = map[byte][]byte{
+	constants.CmdQueryParam1: {0x0A, 0x00, 0x1E, 0x00, 0x5A, 0x3C, 0x00, 0x78, 0x00, 0xB4, 0x00},
+	constants.CmdQueryParam2: {0x64, 0x00, 0x0A, 0x00, 0x3C, 0x00, 0x05, 0x14, 0x00, 0x1E, 0x00, 0x0A, 0x00, 0x03, 0x00, 0x0F, 0x00, 0x2D, 0x00, 0x50, 0x5A, 0x01, 0x00},
+	constants.CmdQueryParam3: {0xE0, 0x01, 0xD0, 0x07, 0x8C, 0x0A, 0xE8, 0x03},
+	constants.CmdQueryParam4: {0x00, 0x15, 0x91, 0x85, 0x19, 0x18, 0x80, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+}
+
+// TestDeviceConfig 设备配置读取组装与模板核对测试
+func TestDeviceConfig(t *testing.T) {
+	t.Run("分段解码", func(t *testing.T) {
+		name, values, err := gateway.DecodeConfigSection(constants.CmdQueryParam3, configSectionSamples[constants.CmdQueryParam3])
+		if err != nil || name != gateway.ConfigSectionRunParams2 {
+			t.Fatalf("解码失败: %s %v", name, err)
+		}
+		if values["max_charge_time"] != 480 || values["overload_power"] != 2000 || values["over_voltage"] != 2700 || values["under_voltage"] != 1000 {
+			t.Fatalf("字段值错误: %v", values)
+		}
+
+		// 旧固件无过压/欠压字段
+		_, values, _ = gateway.DecodeConfigSection(constants.CmdQueryParam3, []byte{0xE0, 0x01, 0xD0, 0x07})
+		if _, ok := values["over_voltage"]; ok || len(values) != 2 {
+			t.Fatalf("缺少的尾部字段不应输出: %v", values)
+		}
+
+		_, values, _ = gateway.DecodeConfigSection(constants.CmdQueryParam4, configSectionSamples[constants.CmdQueryParam4])
+		if values["card_password"] != "159185191880" || values["new_card_password"] != "FFFFFFFFFFFF" {
+			t.Fatalf("卡密码应为16进制字符串: %v", values)
+		}
+	})
+
+	t.Run("乱序到达与缺失分段补发", func(t *testing.T) {
+		var (
+			reader *gateway.DeviceConfigReader
+			mu     sync.Mutex
+			sends  = make(map[byte]int)
+		)
+		reader = gateway.NewDeviceConfigReader(config.DeviceConfigReadConfig{}, func(_, deviceID string, command byte) error {
+			mu.Lock()
+			sends[command]++
+			attempt := sends[command]
+			mu.Unlock()
+			// 0x91 首轮丢失，补发后才应答；其余分段倒序到达
+			if command == constants.CmdQueryParam2 && attempt == 1 {
+				return nil
+			}
+			delay := time.Duration(0x94-command) * 5 * time.Millisecond
+			go func() {
+				time.Sleep(delay)
+				reader.OnSection(deviceID, command, configSectionSamples[command])
+			}()
+			return nil
+		})
+		reader.SetRetryPolicy(100*time.Millisecond, 3)
+
+		doc, err := reader.Read("corr-1", "04A26CF3", time.Second)
+		if err != nil || !doc.Complete {
+			t.Fatalf("补发后应读取完整: %v %+v", err, doc)
+		}
+		if doc.Attempts != 2 {
+			t.Fatalf("应补发一轮: attempts=%d", doc.Attempts)
+		}
+		mu.Lock()
+		if sends[constants.CmdQueryParam2] != 2 || sends[constants.CmdQueryParam1] != 1 {
+			t.Fatalf("只应补发缺失分段: %v", sends)
+		}
+		mu.Unlock()
+		if doc.Sections[gateway.ConfigSectionRunParams11]["heartbeat_interval"] != 180 {
+			t.Fatalf("字段值错误: %v", doc.Sections[gateway.ConfigSectionRunParams11])
+		}
+		if cached, ok := reader.Cached("04A26CF3"); !ok || !cached.ReadAt.Equal(doc.ReadAt) {
+			t.Fatal("完整读取结果应被缓存")
+		}
+	})
+
+	t.Run("轮数用尽仍缺失", func(t *testing.T) {
+		var reader *gateway.DeviceConfigReader
+		reader = gateway.NewDeviceConfigReader(config.DeviceConfigReadConfig{}, func(_, deviceID string, command byte) error {
+			if command != constants.CmdQueryParam4 {
+				go reader.OnSection(deviceID, command, configSectionSamples[command])
+			}
+			return nil
+		})
+		reader.SetRetryPolicy(30*time.Millisecond, 2)
+
+		doc, err := reader.Read("", "04A26CF4", time.Second)
+		if !errors.Is(err, gateway.ErrConfigReadIncomplete) {
+			t.Fatalf("应返回不完整错误: %v", err)
+		}
+		if len(doc.Missing) != 1 || doc.Missing[0] != gateway.ConfigSectionCardParams || doc.Attempts != 2 {
+			t.Fatalf("缺失分段错误: %+v", doc)
+		}
+		if _, ok := reader.Cached("04A26CF4"); ok {
+			t.Fatal("不完整的读取不应缓存")
+		}
+		if reader.OnSection("04A26CF4", constants.CmdQueryParam4, configSectionSamples[constants.CmdQueryParam4]) {
+			t.Fatal("读取结束后的应答不应被接收")
+		}
+	})
+
+	t.Run("模板版本与字段核对", func(t *testing.T) {
+		store := gateway.NewConfigTemplateStore(filepath.Join(t.TempDir(), "templates.json"))
+		if _, err := store.Create("bad", "", map[string]map[string]interface{}{"run_params_2": {"unknown": 1}}); err == nil {
+			t.Fatal("未知字段应被拒绝")
+		}
+		v1, err := store.Create("station", "", map[string]map[string]interface{}{
+			gateway.ConfigSectionRunParams2: {"max_charge_time": 480.0, "overload_power": 2200.0, "over_voltage": 2700.0},
+			gateway.ConfigSectionCardParams: {"card_password": "159185191880"},
+		})
+		if err != nil || v1.Version != 1 {
+			t.Fatalf("创建模板失败: %v", err)
+		}
+		if _, err := store.Create("station", "", v1.Sections); !errors.Is(err, gateway.ErrConfigTemplateExists) {
+			t.Fatalf("重复创建应失败: %v", err)
+		}
+		v2, _ := store.Update("station", "", map[string]map[string]interface{}{gateway.ConfigSectionRunParams2: {"overload_power": 2000.0}})
+		if v2.Version != 2 || len(store.Versions("station")) != 2 {
+			t.Fatalf("更新应生成新版本: %+v", v2)
+		}
+
+		doc := gateway.DeviceConfigDocument{DeviceID: "04A26CF3", Sections: map[string]map[string]interface{}{}}
+		_, doc.Sections[gateway.ConfigSectionRunParams2], _ = gateway.DecodeConfigSection(constants.CmdQueryParam3, []byte{0xE0, 0x01, 0xD0, 0x07})
+		_, doc.Sections[gateway.ConfigSectionCardParams], _ = gateway.DecodeConfigSection(constants.CmdQueryParam4, configSectionSamples[constants.CmdQueryParam4])
+
+		tpl, _ := store.Get("station", 1)
+		result := gateway.DiffConfig(doc, tpl)
+		if result.Match || result.Mismatched != 1 || result.Missing != 1 || len(result.Diffs) != 4 {
+			t.Fatalf("核对结果错误: %+v", result)
+		}
+		statuses := map[string]string{}
+		for _, d := range result.Diffs {
+			statuses[d.Field] = d.Status
+		}
+		if statuses["max_charge_time"] != gateway.ConfigDiffMatch || statuses["overload_power"] != gateway.ConfigDiffMismatch ||
+			statuses["over_voltage"] != gateway.ConfigDiffMissing || statuses["card_password"] != gateway.ConfigDiffMatch {
+			t.Fatalf("字段状态错误: %v", statuses)
+		}
+
+		latest, _ := store.Get("station", 0)
+		if r := gateway.DiffConfig(doc, latest); !r.Match || r.TemplateVersion != 2 {
+			t.Fatalf("最新版本应一致: %+v", r)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/gin-gonic/gin"
+)
+
+// countingDetailLoader 计数的详情组装函数，release 关闭前阻塞（用于构造并发请求）
+type countingDetailLoader struct {
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (l *countingDetailLoader) load(deviceID string) (map[string]interface{}, error) {
+	n := l.calls.Add(1)
+	if l.release != nil {
+		<-l.release
+	}
+	return map[string]interface{}{"deviceId": deviceID, "build": n}, nil
+}
+
+// TestDeviceDetailCache 设备详情缓存：命中、singleflight合并、事件失效、LRU上限与错误不缓存
+func TestDeviceDetailCache(t *testing.T) {
+	t.Run("TTL内命中且返回副本", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: 60000})
+		loader := &countingDetailLoader{}
+		first, _ := cache.Get("04A26CF3", loader.load)
+		first["owner"] = "self"
+		second, _ := cache.Get("04A26CF3", loader.load)
+		if loader.calls.Load() != 1 {
+			t.Fatalf("TTL内应只组装一次，实际%d次", loader.calls.Load())
+		}
+		if _, ok := second["owner"]; ok {
+			t.Fatal("调用方修改返回值不应影响缓存")
+		}
+		stats := cache.Stats()
+		if stats.Hits != 1 || stats.Misses != 1 || stats.TTLMs != 60000 {
+			t.Fatalf("统计错误: %+v", stats)
+		}
+	})
+
+	t.Run("过期后重新组装", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: 20})
+		loader := &countingDetailLoader{}
+		_, _ = cache.Get("04A26CF3", loader.load)
+		time.Sleep(40 * time.Millisecond)
+		detail, _ := cache.Get("04A26CF3", loader.load)
+		if detail["build"] != int64(2) {
+			t.Fatalf("过期后应重新组装: %v", detail["build"])
+		}
+	})
+
+	t.Run("并发请求共享一次组装", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: 60000})
+		loader := &countingDetailLoader{release: make(chan struct{})}
+		const clients = 50
+		var wg sync.WaitGroup
+		results := make(chan map[string]interface{}, clients)
+		for i := 0; i < clients; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				detail, err := cache.Get("04A26CF3", loader.load)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results <- detail
+			}()
+		}
+		deadline := time.Now().Add(3 * time.Second)
+		for cache.Stats().Coalesced < clients-1 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		close(loader.release)
+		wg.Wait()
+		close(results)
+		if loader.calls.Load() != 1 {
+			t.Fatalf("并发请求应只组装一次，实际%d次", loader.calls.Load())
+		}
+		for detail := range results {
+			if detail["build"] != int64(1) {
+				t.Fatalf("等待者应共享同一结果: %v", detail)
+			}
+		}
+		if stats := cache.Stats(); stats.Coalesced != clients-1 || stats.Misses != 1 {
+			t.Fatalf("统计错误: %+v", stats)
+		}
+	})
+
+	t.Run("组装失败不缓存", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{})
+		calls := 0
+		failing := func(string) (map[string]interface{}, error) {
+			calls++
+			return nil, errors.New("设备不存在")
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := cache.Get("04A26CF3", failing); err == nil {
+				t.Fatal("应返回组装错误")
+			}
+		}
+		if calls != 2 || cache.Stats().Size != 0 {
+			t.Fatalf("错误结果不应缓存: calls=%d size=%d", calls, cache.Stats().Size)
+		}
+	})
+
+	t.Run("按设备LRU淘汰", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: 60000, MaxDevices: 3})
+		loader := &countingDetailLoader{}
+		for _, id := range []string{"00000001", "00000002", "00000003"} {
+			_, _ = cache.Get(id, loader.load)
+		}
+		_, _ = cache.Get("00000001", loader.load) // 最近访问，不被淘汰
+		_, _ = cache.Get("00000004", loader.load) // 淘汰最久未访问的 00000002
+		stats := cache.Stats()
+		if stats.Size != 3 || stats.Evictions != 1 {
+			t.Fatalf("应保持3个设备并淘汰1个: %+v", stats)
+		}
+		before := loader.calls.Load()
+		_, _ = cache.Get("00000001", loader.load)
+		if loader.calls.Load() != before {
+			t.Fatal("最近访问的设备不应被淘汰")
+		}
+		_, _ = cache.Get("00000002", loader.load)
+		if loader.calls.Load() != before+1 {
+			t.Fatal("最久未访问的设备应已被淘汰")
+		}
+	})
+
+	t.Run("负数TTL禁用缓存", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: -1})
+		loader := &countingDetailLoader{}
+		_, _ = cache.Get("04A26CF3", loader.load)
+		_, _ = cache.Get("04A26CF3", loader.load)
+		if loader.calls.Load() != 2 || cache.Stats().Enabled {
+			t.Fatal("禁用时每次都应组装")
+		}
+	})
+
+	t.Run("设备事件到达时失效", func(t *testing.T) {
+		bus := events.NewBus(events.Options{})
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: 60000})
+		cache.SubscribeInvalidation(bus)
+		defer cache.Close()
+		loader := &countingDetailLoader{}
+		_, _ = cache.Get("04A26CF3", loader.load)
+		_, _ = cache.Get("04A26CF4", loader.load)
+
+		bus.Publish(events.TopicSystem, "redis_degraded", "", nil) // 无设备ID的事件不影响缓存
+		bus.Publish(events.TopicDevice, network.EventTypeCommandCompleted, "04A26CF3", network.CommandCompletedEvent{Command: 0x82})
+		deadline := time.Now().Add(3 * time.Second)
+		for cache.Stats().Invalidations == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		_, _ = cache.Get("04A26CF3", loader.load)
+		_, _ = cache.Get("04A26CF4", loader.load)
+		if loader.calls.Load() != 3 {
+			t.Fatalf("只有事件对应的设备应重新组装，实际组装%d次", loader.calls.Load())
+		}
+	})
+
+	t.Run("组装期间失效的结果不写入缓存", func(t *testing.T) {
+		cache := gateway.NewDeviceDetailCache(config.DetailCacheConfig{TTLMs: 60000})
+		loader := &countingDetailLoader{release: make(chan struct{})}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = cache.Get("04A26CF3", loader.load)
+		}()
+		for loader.calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cache.Invalidate("04A26CF3")
+		close(loader.release)
+		<-done
+		if cache.Stats().Size != 0 {
+			t.Fatal("失效前开始的组装结果不应缓存")
+		}
+	})
+
+	t.Run("命令应答发布command_completed事件", func(t *testing.T) {
+		sub := events.GetGlobalBus().Subscribe(events.SubscribeOptions{
+			Name:   "detail-cache-test",
+			Filter: func(ev events.Event) bool { return ev.Type == network.EventTypeCommandCompleted },
+		})
+		defer sub.Close()
+		cm := network.GetCommandManager()
+		cm.RegisterCommand(&disconnectTestConn{id: 71001}, 0x04A27101, 0x0701, 0x96, []byte{0x05})
+		if confirmed, _ := cm.ConfirmCommandWithCorrelation(0x04A27101, 0x0701, 0x96); !confirmed {
+			t.Fatal("命令应被确认")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		ev, ok := sub.Next(ctx)
+		if !ok || ev.DeviceID != "04A27101" || ev.Topic != events.TopicDevice {
+			t.Fatalf("应发布设备命令完成事件: %+v", ev)
+		}
+		if payload, _ := ev.Payload.(network.CommandCompletedEvent); payload.Command != 0x96 || payload.MessageID != 0x0701 {
+			t.Fatalf("事件负载错误: %+v", ev.Payload)
+		}
+	})
+}
+
+// TestDeviceDetailCacheAPI 设备详情接口经缓存，noCache=true 绕过，/stats 输出缓存统计
+func TestDeviceDetailCacheAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	registerSharedGroup(t, 71002, "89860000000000071002", []string{"04A27102"})
+
+	cache := gateway.GetGlobalDeviceGateway().GetDetailCache()
+	cache.Invalidate("04A27102")
+	before := cache.Stats()
+	for i := 0; i < 3; i++ {
+		if w, _ := callAPI(r, http.MethodGet, "/api/v1/device/04A27102/status", ""); w.Code != http.StatusOK {
+			t.Fatalf("设备详情应返回200: %d %s", w.Code, w.Body.String())
+		}
+	}
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/device/04A27102/status?noCache=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("noCache 请求应返回200: %d", w.Code)
+	}
+	after := cache.Stats()
+	if after.Misses-before.Misses != 1 || after.Hits-before.Hits != 2 || after.Bypassed-before.Bypassed != 1 {
+		t.Fatalf("应组装1次、命中2次、绕过1次: before=%+v after=%+v", before, after)
+	}
+
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/stats", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("统计接口应返回200: %d", w.Code)
+	}
+	stats, ok := resp.Data["device_detail_cache"].(map[string]interface{})
+	if !ok || stats["enabled"] != true || stats["hits"] == nil || stats["coalesced"] == nil {
+		t.Fatalf("统计应包含设备详情缓存: %v", resp.Data["device_detail_cache"])
+	}
+}
+
+// benchmarkDetailLoad 模拟100个并发客户端轮询50个设备详情
+func benchmarkDetailLoad(b *testing.B, get func(string) (map[string]interface{}, error)) {
+	quietLogger(b)
+	deviceIDs := make([]string, 50)
+	for i := range deviceIDs {
+		deviceIDs[i] = fmt.Sprintf("04A2%04X", 0x7200+i)
+	}
+	registerSharedGroup(b, 71100, "89860000000000071100", deviceIDs)
+
+	var next atomic.Uint64
+	b.SetParallelism(100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			deviceID := deviceIDs[next.Add(1)%uint64(len(deviceIDs))]
+			if _, err := get(deviceID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkDeviceDetailUncached 每次请求都组装设备详情
+func BenchmarkDeviceDetailUncached(b *testing.B) {
+	benchmarkDetailLoad(b, gateway.GetGlobalDeviceGateway().GetDeviceDetailUncached)
+}
+
+// BenchmarkDeviceDetailCached 经短TTL缓存与singleflight
+func BenchmarkDeviceDetailCached(b *testing.B) {
+	benchmarkDetailLoad(b, gateway.GetGlobalDeviceGateway().GetDeviceDetail)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/gin-gonic/gin"
+)
+
+// TestDeviceGroupEndpoints 按ICCID查询设备组成员与状态，列表按设备数倒序；未知ICCID返回404
+func TestDeviceGroupEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quietLogger(t)
+
+	// 使用独立的TCP管理器，列表只包含本测试注册的设备组
+	tcpManager := core.NewTCPManager(nil)
+	handlers := apihttp.NewDeviceGroupHandlersWithManager(tcpManager)
+	r := gin.New()
+	r.GET("/api/v1/groups", handlers.HandleDeviceGroups)
+	r.GET("/api/v1/group/:iccid", handlers.HandleDeviceGroup)
+
+	const iccidA, iccidB = "89860000000000175101", "89860000000000175102"
+	connA := &disconnectTestConn{id: 1751001}
+	connB := &disconnectTestConn{id: 1751002}
+	for _, conn := range []*disconnectTestConn{connA, connB} {
+		if _, err := tcpManager.RegisterConnection(conn); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+	}
+	for _, deviceID := range []string{"04A2B102", "04A2B101"} {
+		if err := tcpManager.RegisterDevice(connA, deviceID, deviceID, iccidA); err != nil {
+			t.Fatalf("注册设备失败: %v", err)
+		}
+	}
+	if err := tcpManager.RegisterDevice(connB, "04A2B103", "04A2B103", iccidB); err != nil {
+		t.Fatalf("注册设备失败: %v", err)
+	}
+	if err := tcpManager.UpdateHeartbeat("04A2B101"); err != nil {
+		t.Fatalf("更新心跳失败: %v", err)
+	}
+
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/group/"+iccidA, "")
+	if w.Code != http.StatusOK || resp.Code != 0 {
+		t.Fatalf("查询设备组失败: %d %s", w.Code, w.Body.String())
+	}
+	var detail struct {
+		Data apihttp.DeviceGroupView `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	group := detail.Data
+	if group.ICCID != iccidA || group.ConnID != connA.id || group.RemoteAddr == "" || group.DeviceCount != 2 ||
+		group.PrimaryDevice == "" || group.CreatedAt.IsZero() {
+		t.Fatalf("设备组信息错误: %+v", group)
+	}
+	if group.Devices[0].DeviceID != "04A2B101" || group.Devices[1].DeviceID != "04A2B102" {
+		t.Fatalf("成员设备应按设备ID排序: %+v", group.Devices)
+	}
+	member := group.Devices[0]
+	if member.PhysicalID != "04A2B101" || member.Status == "" || member.LastHeartbeat.IsZero() || member.HeartbeatCount == 0 {
+		t.Fatalf("成员设备状态或心跳错误: %+v", member)
+	}
+
+	if w, resp := callAPI(r, http.MethodGet, "/api/v1/group/89860000000000175199", ""); w.Code != http.StatusNotFound || resp.Code != 404 {
+		t.Fatalf("未知ICCID应返回404，实际 %d", w.Code)
+	}
+
+	w, _ = callAPI(r, http.MethodGet, "/api/v1/groups", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("查询设备组列表失败: %d %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Data apihttp.DeviceGroupList `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if list.Data.Total != 2 || len(list.Data.Groups) != 2 ||
+		list.Data.Groups[0].ICCID != iccidA || list.Data.Groups[1].ICCID != iccidB {
+		t.Fatalf("列表应包含两个设备组且多设备组在前: %+v", list.Data)
+	}
+	if a := list.Data.Groups[0]; a.DeviceCount != 2 || a.ConnID != connA.id || a.RemoteAddr == "" || a.PrimaryDevice == "" {
+		t.Fatalf("列表项错误: %+v", a)
+	}
+	if b := list.Data.Groups[1]; b.DeviceCount != 1 || b.ConnID != connB.id {
+		t.Fatalf("列表项错误: %+v", b)
+	}
+
+	w, _ = callAPI(r, http.MethodGet, "/api/v1/groups?minDevices=2", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if list.Data.Total != 1 || len(list.Data.Groups) != 1 || list.Data.Groups[0].ICCID != iccidA {
+		t.Fatalf("minDevices=2 不应返回设备数不足的组: %+v", list.Data)
+	}
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/groups?minDevices=-1", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("minDevices为负应返回400，实际 %d", w.Code)
+	}
+}
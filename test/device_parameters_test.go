@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+	"github.com/gin-gonic/gin"
+)
+
+// TestDeviceParameterReport 设备上报的0x90/0x91运行参数解析后记录到设备属性并经API返回；截断上报解析现有字段并标记 partial
+func TestDeviceParameterReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quietLogger(t)
+	const deviceID = "04A27159"
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &disconnectTestConn{id: 1759001}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, deviceID, deviceID, "89860000000000175901"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcpManager.UnregisterConnection(conn.id) })
+
+	device := simulator.NewDevice(0x04A27159, "89860000000000175901", dialect.AP3000)
+	handler := handlers.NewQueryParamHandler()
+	report := func(command uint8, params interface{ MarshalBinary() ([]byte, error) }, truncate int) {
+		t.Helper()
+		frame, err := device.ParameterReport(command, params, truncate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := znet.NewRequest(conn, zpack.NewMsgPackage(uint32(command), frame))
+		req.BindRouter(handler)
+		req.Call()
+	}
+
+	r := gin.New()
+	r.GET("/api/v1/device/:deviceId/parameters", apihttp.NewDeviceHandlers().HandleDeviceParameters)
+	get := func() (int, apihttp.DeviceParametersResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/device/"+deviceID+"/parameters", nil))
+		var resp struct {
+			Data apihttp.DeviceParametersResponse `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	if code, _ := get(); code != http.StatusNotFound {
+		t.Fatalf("尚未上报时应返回404，实际 %d", code)
+	}
+
+	before := time.Now()
+	report(constants.CmdQueryParam1, &dny_protocol.RunParams11{
+		UnplugPower: 3, UnplugDetectTime: 10, FloatChargePercent: 20, FloatDetectTime: 1800, FloatChargeTime: 3600, HeartbeatInterval: 180,
+	}, 0)
+	code, resp := get()
+	p11 := resp.Parameters.RunParams11
+	if code != http.StatusOK || resp.DeviceID != deviceID || p11 == nil || p11.Partial || p11.FloatChargePercent != 20 ||
+		p11.FloatChargeTime != 3600 || p11.HeartbeatInterval != 180 || resp.Parameters.Partial {
+		t.Fatalf("0x90 运行参数解码错误: %d %+v %+v", code, resp, p11)
+	}
+	if resp.Parameters.LastParametersAt.Before(before) || resp.AgeSeconds != 0 {
+		t.Fatalf("应记录上报时间: %+v", resp.Parameters.LastParametersAt)
+	}
+
+	// 旧固件缺少末尾4字节（温度、光耦、二维码灯）
+	report(constants.CmdQueryParam2, &dny_protocol.RunParams12{
+		DynamicOverloadPower: 800, DynamicOverloadDetectTime: 30, DynamicOverloadStartTime: 1800, UnplugInterferencePower: 10,
+		UnplugInterferenceTime: 300, FloatSecondDetectPoint: 10800, FloatSecondDetectTime: 300, MinPower: 300,
+		MinPowerCheckPoint: 1800, SecondMaxPowerPoint: 300, AmbientAlarmTemp: 80, PortAlarmTemp: 80, QRCodeLight: 1,
+	}, 4)
+	code, resp = get()
+	p12 := resp.Parameters.RunParams12
+	if code != http.StatusOK || p12 == nil || !p12.Partial || !resp.Parameters.Partial || p12.SecondMaxPowerPoint != 300 ||
+		p12.MinPower != 300 || p12.AmbientAlarmTemp != 0 || len(p12.Missing) != 4 || p12.Missing[0] != "ambient_alarm_temp" {
+		t.Fatalf("截断的0x91应解析现有字段并标记 partial: %+v", p12)
+	}
+	if resp.Parameters.RunParams11 == nil || resp.Parameters.RunParams11.HeartbeatInterval != 180 {
+		t.Fatal("0x91 上报不应覆盖 0x90 分段")
+	}
+
+	detail, ok := tcpManager.GetDeviceByID(deviceID)
+	if !ok {
+		t.Fatal("设备应在线")
+	}
+	detail.RLock()
+	_, stored := detail.Properties[core.DevicePropertyParameters].(*dny_protocol.DeviceParameters)
+	detail.RUnlock()
+	if !stored {
+		t.Fatal("运行参数应记录在设备属性中")
+	}
+
+	var short dny_protocol.RunParams11
+	if err := short.UnmarshalBinary([]byte{0x03}); err == nil {
+		t.Fatal("不足一个字段的数据应报错")
+	}
+}
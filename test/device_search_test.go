@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// TestDeviceSearch 设备模糊搜索：尾号、ICCID通配、IP段、资产编码、排序与离线设备
+func TestDeviceSearch(t *testing.T) {
+	now := time.Now()
+	x := gateway.NewDeviceSearchIndex()
+	x.Upsert(gateway.DeviceSearchRecord{DeviceID: "04A26CF3", PhysicalID: "04A26CF3", ICCID: "89860429162390488297", AssetCode: "ST-0142-P3", RemoteIP: "112.23.45.67", Online: true, LastSeen: now})
+	x.Upsert(gateway.DeviceSearchRecord{DeviceID: "04A26CF4", PhysicalID: "04A26CF4", ICCID: "89860429162390480001", AssetCode: "ST-0142-P4", RemoteIP: "112.23.9.1", Online: true, LastSeen: now})
+	x.Upsert(gateway.DeviceSearchRecord{DeviceID: "046CF300", PhysicalID: "046CF300", ICCID: "89860000000000000003", RemoteIP: "10.1.1.1", Online: true, LastSeen: now})
+
+	search := func(q string) []gateway.DeviceSearchMatch {
+		t.Helper()
+		matches, err := x.Search(q, 0, now)
+		if err != nil {
+			t.Fatalf("查询 %q 失败: %v", q, err)
+		}
+		return matches
+	}
+
+	// 尾号：后缀匹配排在包含匹配之前，并标出匹配字段
+	got := search("6cf3")
+	if len(got) != 2 || got[0].DeviceID != "04A26CF3" || got[1].DeviceID != "046CF300" {
+		t.Fatalf("尾号查询结果错误: %+v", got)
+	}
+	if got[0].MatchedField != gateway.SearchFieldDeviceID || got[0].Highlight != "04A2[6CF3]" {
+		t.Fatalf("匹配字段标注错误: %+v", got[0])
+	}
+
+	if got = search("8986...8297"); len(got) != 1 || got[0].DeviceID != "04A26CF3" || got[0].MatchedField != gateway.SearchFieldICCID {
+		t.Fatalf("ICCID通配查询错误: %+v", got)
+	}
+	if got = search("112.23.x.x"); len(got) != 2 || got[0].MatchedField != gateway.SearchFieldRemoteIP {
+		t.Fatalf("IP段查询错误: %+v", got)
+	}
+	if got = search("st-0142-p4"); len(got) != 1 || got[0].DeviceID != "04A26CF4" || got[0].MatchedField != gateway.SearchFieldAssetCode {
+		t.Fatalf("资产编码查询错误: %+v", got)
+	}
+	if matches, _ := x.Search("04A2", 1, now); len(matches) != 1 {
+		t.Fatalf("应按 limit 截断: %d", len(matches))
+	}
+	for _, q := range []string{"6CF", "1.2.x", "..."} {
+		if _, err := x.Search(q, 0, now); !errors.Is(err, gateway.ErrSearchQueryTooShort) {
+			t.Fatalf("查询 %q 应因过短被拒绝: %v", q, err)
+		}
+	}
+
+	// 离线设备保留快照，在线设备排在同等匹配的离线设备之前
+	x.MarkOffline("04A26CF4", now)
+	if got = search("04A26CF"); len(got) != 2 || !got[0].Online || got[1].DeviceID != "04A26CF4" || got[1].Online {
+		t.Fatalf("离线设备应可搜索并排在在线设备之后: %+v", got)
+	}
+	if matches, _ := x.Search("04A26CF4", 0, now.Add(8*24*time.Hour)); len(matches) != 0 {
+		t.Fatalf("超过保留期的离线快照不应返回: %+v", matches)
+	}
+}
+
+// TestDeviceSearchGatewayIndexing 设备注册写入索引，连接断开后转为离线快照
+func TestDeviceSearchGatewayIndexing(t *testing.T) {
+	g := gateway.NewDeviceGateway()
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &disconnectTestConn{id: 1668001}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, "04B16680", "04B16680", "89860400000016680001"); err != nil {
+		t.Fatal(err)
+	}
+	g.OnDeviceRegistered("04B16680")
+
+	matches, err := g.SearchDevices("16680001", 0)
+	if err != nil || len(matches) != 1 || !matches[0].Online || matches[0].RemoteIP != "10.0.0.1" || matches[0].PhysicalID != "04B16680" {
+		t.Fatalf("注册后应可按ICCID搜索到在线设备: %+v %v", matches, err)
+	}
+
+	_ = tcpManager.UnregisterConnection(conn.id)
+	matches, _ = g.SearchDevices("10.0.0.1", 0)
+	found := false
+	for _, m := range matches {
+		if m.DeviceID == "04B16680" {
+			found = !m.Online
+		}
+	}
+	if !found {
+		t.Fatalf("断开后应以离线状态保留: %+v", matches)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/devicesession"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const deviceSessionPrefix = "iot:device_session:"
+
+// listedDevices 查询设备列表，按设备ID索引
+func listedDevices(t *testing.T, r *gin.Engine) (map[string]map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	w, _ := callAPI(r, http.MethodGet, "/api/v1/devices", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("查询设备列表失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Devices    []map[string]interface{} `json:"devices"`
+			Total      int                      `json:"total"`
+			Online     int                      `json:"online"`
+			Recovering int                      `json:"recovering"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	byID := make(map[string]map[string]interface{}, len(resp.Data.Devices))
+	for _, d := range resp.Data.Devices {
+		id, _ := d["deviceId"].(string)
+		byID[id] = d
+	}
+	counts := map[string]interface{}{"total": resp.Data.Total, "online": resp.Data.Online, "recovering": resp.Data.Recovering}
+	return byID, counts
+}
+
+// TestDeviceSessionRecovery 设备会话持久化：注册与心跳写入Redis（不依赖只读副本状态快照），重启后载入为恢复中（含停机前刚注册的设备），
+// 设备重新接入后恢复在线；Redis不可用时不影响接入
+func TestDeviceSessionRecovery(t *testing.T) {
+	quietLogger(t)
+	gin.SetMode(gin.TestMode)
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("启动miniredis失败: %v", err)
+	}
+	defer mr.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr(), MaxRetries: -1, DialTimeout: 200 * time.Millisecond, ReadTimeout: 200 * time.Millisecond})
+	defer client.Close()
+	store := devicesession.NewRedisStore(client, deviceSessionPrefix)
+
+	const iccid = "89860000000000175301"
+	const deviceA, deviceB, deviceC = "04A27531", "04A27532", "04A27533"
+
+	// 重启前：独立的TCP管理器注册两台设备并上报心跳
+	before := core.NewTCPManager(nil)
+	reg := devicesession.NewRegistry(devicesession.Options{Store: store, TTL: time.Hour, HeartbeatWriteInterval: time.Hour})
+	reg.Start(context.Background())
+	before.SetDeviceActivityObserver(reg.Observe)
+	conn := &disconnectTestConn{id: 1753001}
+	if _, err := before.RegisterConnection(conn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	for _, deviceID := range []string{deviceA, deviceB} {
+		if err := before.RegisterDeviceWithDetails(conn, deviceID, deviceID, iccid, 0x21, "V1.0"); err != nil {
+			t.Fatalf("注册设备失败: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := before.UpdateHeartbeat(deviceA); err != nil {
+			t.Fatalf("更新心跳失败: %v", err)
+		}
+	}
+	// 设备C在停机前一刻才注册（尚无心跳，也未发布过任何状态快照）：注册即写入，同样应在重启后恢复
+	if config.GetConfig().Replica.Publish {
+		t.Fatal("本测试要求未开启 replica.publish")
+	}
+	if err := before.RegisterDevice(conn, deviceC, deviceC, iccid); err != nil {
+		t.Fatalf("注册设备失败: %v", err)
+	}
+	reg.Stop()
+	if stats := reg.Stats(); stats.Written == 0 || stats.Throttled != 3 || stats.Failed != 0 {
+		t.Fatalf("心跳应在写入间隔内节流: %+v", stats)
+	}
+	key := deviceSessionPrefix + deviceA
+	if got := mr.HGet(key, "iccid"); got != iccid {
+		t.Fatalf("Redis会话ICCID错误: %q", got)
+	}
+	if got := mr.HGet(key, "deviceType"); got != "33" {
+		t.Fatalf("Redis会话设备类型错误: %q", got)
+	}
+	if mr.HGet(key, "physicalId") == "" || mr.HGet(key, "lastHeartbeat") == "" {
+		t.Fatal("Redis会话字段缺失")
+	}
+	if ttl := mr.TTL(key); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("Redis会话应设置过期时间，实际 %s", ttl)
+	}
+
+	// 重启：新进程的设备会话持久化从Redis载入，全局TCP管理器中尚无这些设备
+	tcpManager := core.GetGlobalTCPManager()
+	restarted := devicesession.NewRegistry(devicesession.Options{
+		Store: store,
+		TTL:   time.Hour,
+		Online: func(deviceID string) bool {
+			_, ok := tcpManager.GetDeviceByID(deviceID)
+			return ok
+		},
+	})
+	if loaded, err := restarted.Recover(context.Background()); err != nil || loaded != 3 {
+		t.Fatalf("应载入3台恢复中设备，实际 %d %v", loaded, err)
+	}
+	restarted.Start(context.Background())
+	defer restarted.Stop()
+	devicesession.SetGlobalRegistry(restarted)
+	defer devicesession.SetGlobalRegistry(nil)
+	tcpManager.SetDeviceActivityObserver(restarted.Observe)
+	defer tcpManager.SetDeviceActivityObserver(nil)
+
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	devices, counts := listedDevices(t, r)
+	for _, deviceID := range []string{deviceA, deviceB} {
+		d, ok := devices[deviceID]
+		if !ok {
+			t.Fatalf("设备列表应包含恢复中设备 %s", deviceID)
+		}
+		if d["isOnline"] != false || d["recovering"] != true || d["iccid"] != iccid || d["deviceType"] != float64(0x21) || d["lastHeartbeat"] == "" {
+			t.Fatalf("恢复中设备信息错误: %v", d)
+		}
+	}
+	if d, ok := devices[deviceC]; !ok || d["recovering"] != true || d["isOnline"] != false {
+		t.Fatalf("停机前刚注册的设备应在恢复中列表: %v", d)
+	}
+	if counts["recovering"] != 3 {
+		t.Fatalf("恢复中设备数错误: %v", counts)
+	}
+
+	// 设备A重新接入：移出恢复中状态并以在线展示，设备B仍为恢复中
+	reconn := &disconnectTestConn{id: 1753002}
+	if _, err := tcpManager.RegisterConnection(reconn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(reconn.id)
+	if err := tcpManager.RegisterDevice(reconn, deviceA, deviceA, iccid); err != nil {
+		t.Fatalf("设备重新注册失败: %v", err)
+	}
+	devices, counts = listedDevices(t, r)
+	if d := devices[deviceA]; d["isOnline"] != true || d["recovering"] != nil {
+		t.Fatalf("重新接入的设备应为在线: %v", d)
+	}
+	if d := devices[deviceB]; d["recovering"] != true {
+		t.Fatalf("未接入的设备应仍为恢复中: %v", d)
+	}
+	if counts["recovering"] != 2 || restarted.Stats().Recovering != 2 {
+		t.Fatalf("恢复中设备数错误: %v %+v", counts, restarted.Stats())
+	}
+
+	// Redis不可用：载入返回错误、写入只计失败，设备注册不受影响
+	mr.Close()
+	down := devicesession.NewRegistry(devicesession.Options{Store: store, TTL: time.Hour})
+	if _, err := down.Recover(context.Background()); err == nil {
+		t.Fatal("Redis不可用时载入应返回错误")
+	}
+	down.Start(context.Background())
+	isolated := core.NewTCPManager(nil)
+	isolated.SetDeviceActivityObserver(down.Observe)
+	downConn := &disconnectTestConn{id: 1753003}
+	if _, err := isolated.RegisterConnection(downConn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	if err := isolated.RegisterDevice(downConn, deviceB, deviceB, iccid); err != nil {
+		t.Fatalf("Redis不可用时设备注册应成功: %v", err)
+	}
+	down.Stop()
+	if stats := down.Stats(); stats.Failed == 0 || stats.Written != 0 {
+		t.Fatalf("Redis不可用时写入应计为失败: %+v", stats)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// TestDeviceTimeline 设备时间线：多来源合并排序、类型过滤、游标分页与来源降级
+func TestDeviceTimeline(t *testing.T) {
+	const deviceID = "04A2715A"
+	g := gateway.GetGlobalDeviceGateway()
+
+	sm := g.GetStateMachineManager().GetOrCreateStateMachine(deviceID, 1)
+	defer g.GetStateMachineManager().RemoveStateMachine(deviceID, 1)
+	sm.SetOrderNo("ORDER_TIMELINE_1")
+	if err := sm.TransitionTo(gateway.StatePlugged, gateway.ReasonDeviceResponse, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.TransitionTo(gateway.StateCharging, gateway.ReasonDeviceResponse, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	gateway.RegisterTimelineSource("test_settlements", func(id string, from, to time.Time) ([]gateway.TimelineEntry, error) {
+		var entries []gateway.TimelineEntry
+		for i := 0; i < 5; i++ {
+			entries = append(entries, gateway.TimelineEntry{
+				Timestamp: base.Add(time.Duration(i) * time.Minute),
+				Source:    "test_settlements",
+				Type:      gateway.TimelineTypeSettlement,
+				Summary:   fmt.Sprintf("结算 %d", i),
+				RefID:     fmt.Sprintf("%s-settle-%d", id, i),
+			})
+		}
+		return entries, nil
+	})
+	gateway.RegisterTimelineSource("test_broken", func(string, time.Time, time.Time) ([]gateway.TimelineEntry, error) {
+		return nil, fmt.Errorf("存储未启用")
+	})
+	defer gateway.RegisterTimelineSource("test_settlements", nil)
+	defer gateway.RegisterTimelineSource("test_broken", nil)
+
+	page, err := g.GetDeviceTimeline(deviceID, gateway.TimelineQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 7 || page.NextCursor != "" {
+		t.Fatalf("应合并5条结算与2条充电转换: %d", len(page.Items))
+	}
+	for i := 1; i < len(page.Items); i++ {
+		if page.Items[i].Timestamp.Before(page.Items[i-1].Timestamp) {
+			t.Fatal("时间线应按时间升序")
+		}
+	}
+	last := page.Items[len(page.Items)-1]
+	if last.Source != gateway.TimelineSourceCharging || last.RefID != "ORDER_TIMELINE_1" || last.Port == nil {
+		t.Fatalf("充电转换条目错误: %+v", last)
+	}
+	if page.Sources["test_broken"] == "ok" || page.Sources["test_settlements"] != "ok" || page.Sources[gateway.TimelineSourceReboot] != "ok" {
+		t.Fatalf("来源状态错误: %v", page.Sources)
+	}
+
+	// 类型过滤 + 时间范围
+	page, _ = g.GetDeviceTimeline(deviceID, gateway.TimelineQuery{Types: map[string]bool{gateway.TimelineTypeSettlement: true}, From: base.Add(time.Minute), To: base.Add(3 * time.Minute)})
+	if len(page.Items) != 3 {
+		t.Fatalf("过滤后应剩3条结算: %d", len(page.Items))
+	}
+
+	// 游标分页：逐页读取不重复不遗漏
+	var seen []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := g.GetDeviceTimeline(deviceID, gateway.TimelineQuery{Cursor: cursor, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page.Items {
+			seen = append(seen, item.RefID+item.Summary)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != 7 {
+		t.Fatalf("分页读取条数错误: %d %v", len(seen), seen)
+	}
+	unique := map[string]bool{}
+	for _, s := range seen {
+		unique[s] = true
+	}
+	if len(unique) != 7 {
+		t.Fatalf("分页结果重复: %v", seen)
+	}
+
+	if _, err := g.GetDeviceTimeline(deviceID, gateway.TimelineQuery{Cursor: "%%%"}); err == nil {
+		t.Fatal("非法游标应返回错误")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+	"github.com/gin-gonic/gin"
+)
+
+// dialectCapture 厂商样例抓包：wire 为设备实际发送的帧，canonical 为转换后的AP3000标准帧
+type dialectCapture struct {
+	Name      string `json:"name"`
+	Command   string `json:"command"`
+	MessageID string `json:"messageId"`
+	Wire      string `json:"wire"`
+	Canonical string `json:"canonical"`
+}
+
+func (c dialectCapture) bytes(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("%s: %v", c.Name, err)
+	}
+	return b
+}
+
+// useDialectTracker 测试期间使用独立的连接方言跟踪器
+func useDialectTracker(t *testing.T) *dialect.Tracker {
+	tracker := dialect.NewTracker()
+	dialect.SetGlobalTracker(tracker)
+	t.Cleanup(func() { dialect.SetGlobalTracker(nil) })
+	return tracker
+}
+
+// TestDialectGoldenCaptures 第二厂商样例抓包：注册帧识别方言，各命令转换为标准帧，编解码器往返与抓包逐字节一致
+func TestDialectGoldenCaptures(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "dialect", "vendor_b_captures.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var captures []dialectCapture
+	if err := json.Unmarshal(raw, &captures); err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 4 || captures[0].Name != "register" {
+		t.Fatalf("样例应以注册帧开头并覆盖4个命令: %d", len(captures))
+	}
+
+	tracker := useDialectTracker(t)
+	const connID = 75001
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	defer decoder.ReleaseConnection(connID)
+	for _, c := range captures {
+		t.Run(c.Name, func(t *testing.T) {
+			wire, canonical := c.bytes(t, c.Wire), c.bytes(t, c.Canonical)
+			_, msg := decoder.DecodeFrame(connID, wire)
+			if msg == nil || msg.MessageType != "standard" {
+				t.Fatalf("解码失败: %+v", msg)
+			}
+			if !bytes.Equal(msg.RawData, canonical) {
+				t.Fatalf("标准帧不一致:\n got % X\nwant % X", msg.RawData, canonical)
+			}
+			if got := fmt.Sprintf("0x%04X", msg.MessageId); got != c.MessageID {
+				t.Fatalf("消息ID应按大端序读出 %s，实际 %s", c.MessageID, got)
+			}
+
+			command := uint8(msg.CommandId)
+			payload := wire[12 : len(wire)-2]
+			v, err := dialect.Decode(dialect.VendorB, command, payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := dialect.Encode(dialect.VendorB, command, v)
+			if err != nil || !bytes.Equal(encoded, payload) {
+				t.Fatalf("厂商编解码往返不一致: % X (%v)", encoded, err)
+			}
+			standard, err := dialect.Decode(dialect.AP3000, command, msg.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%+v", standard) != fmt.Sprintf("%+v", v) {
+				t.Fatalf("两种方言应解码为相同的类型化结构:\n%+v\n%+v", standard, v)
+			}
+		})
+	}
+	if b, ok := tracker.Get(connID); !ok || b.Dialect != dialect.VendorB || b.Source != dialect.SourceDetected {
+		t.Fatalf("注册帧应识别为第二厂商方言: %+v", b)
+	}
+
+	// 结算处理器使用的共用结构得到标准停止原因
+	var settlement dny_protocol.SettlementData
+	last := captures[3]
+	if err := settlement.UnmarshalBinary(last.bytes(t, last.Canonical)[12 : len(last.bytes(t, last.Canonical))-2]); err != nil {
+		t.Fatal(err)
+	}
+	if settlement.StopReason != dny_protocol.StopReasonUnplugged || settlement.OrderID != "ORD-VB-0001" {
+		t.Fatalf("厂商停止原因应换算为标准枚举: %+v", settlement)
+	}
+	if _, ok := dialect.VendorBStopReason(0x7E); ok {
+		t.Fatal("未定义的厂商停止原因不应有对应的标准取值")
+	}
+}
+
+// TestDialectSwitching 方言只能在注册完成前切换：特征识别不覆盖监听器与手动指定，注册后锁定
+func TestDialectSwitching(t *testing.T) {
+	tracker := useDialectTracker(t)
+
+	if err := tracker.Bind(1, dialect.VendorB, dialect.SourceManual); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Bind(1, dialect.AP3000, dialect.SourceDetected); err != nil || tracker.Dialect(1) != dialect.VendorB {
+		t.Fatalf("特征识别不应覆盖手动指定: %v %s", err, tracker.Dialect(1))
+	}
+	if err := tracker.Bind(1, dialect.AP3000, dialect.SourceManual); err != nil || tracker.Dialect(1) != dialect.AP3000 {
+		t.Fatalf("注册完成前可切换: %v", err)
+	}
+	if name := tracker.MarkRegistered(1, "04B10001"); name != dialect.AP3000 {
+		t.Fatalf("注册时应锁定当前方言: %s", name)
+	}
+	if err := tracker.Bind(1, dialect.VendorB, dialect.SourceManual); !errors.Is(err, dialect.ErrLocked) {
+		t.Fatalf("注册完成后应拒绝切换: %v", err)
+	}
+	if err := tracker.Bind(2, "vendor_x", dialect.SourceManual); !errors.Is(err, dialect.ErrUnknownDialect) {
+		t.Fatalf("应拒绝未知方言: %v", err)
+	}
+	if name := tracker.MarkRegistered(3, "04B10003"); name != dialect.AP3000 {
+		t.Fatalf("未绑定的连接按标准协议注册: %s", name)
+	}
+
+	t.Run("监听器固定方言", func(t *testing.T) {
+		const connID = 75011
+		decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+		decoder.SetListenerDialect(dialect.VendorB)
+		defer decoder.ReleaseConnection(connID)
+		standard := simulator.NewDevice(0x04B10011, "", dialect.AP3000)
+		frame, err := standard.Register(dialect.Register{FirmwareVersion: 80, PortCount: 2, DeviceType: 0x04})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, msg := decoder.DecodeFrame(connID, frame)
+		if b, _ := tracker.Get(connID); b.Dialect != dialect.VendorB || b.Source != dialect.SourceListener {
+			t.Fatalf("监听器固定的方言不应被注册帧特征覆盖: %+v", b)
+		}
+		if msg.MessageType != "error" {
+			t.Fatalf("标准注册帧按厂商方言解码应失败: %+v", msg)
+		}
+		decoder.ReleaseConnection(connID)
+		if _, ok := tracker.Get(connID); ok {
+			t.Fatal("连接关闭后应清除方言绑定")
+		}
+	})
+
+	t.Run("API", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		router.RegisterUnifiedAPIHandlers(r)
+		const connID = 75012
+		registerSharedGroup(t, connID, "89860000000000075012", []string{"04B10012"})
+		path := "/api/v1/admin/dialects/connections/" + strconv.Itoa(connID)
+
+		if w, _ := callAPI(r, http.MethodPut, path, `{"dialect":"vendor_x"}`); w.Code != http.StatusBadRequest {
+			t.Fatalf("未知方言应返回400: %d", w.Code)
+		}
+		if w, _ := callAPI(r, http.MethodPut, "/api/v1/admin/dialects/connections/99999999", `{"dialect":"vendor_b"}`); w.Code != http.StatusNotFound {
+			t.Fatalf("连接不存在应返回404: %d", w.Code)
+		}
+		w, resp := callAPI(r, http.MethodPut, path, `{"dialect":"vendor_b"}`)
+		if w.Code != http.StatusOK || resp.Data["dialect"] != "vendor_b" || resp.Data["source"] != "manual" {
+			t.Fatalf("注册完成前应可指定方言: %d %s", w.Code, w.Body.String())
+		}
+		w, resp = callAPI(r, http.MethodGet, "/api/v1/device/04B10012/status?verbose=true", "")
+		if binding, _ := resp.Data["dialectBinding"].(map[string]interface{}); w.Code != http.StatusOK || binding["dialect"] != "vendor_b" {
+			t.Fatalf("设备详情诊断信息应包含方言绑定: %d %s", w.Code, w.Body.String())
+		}
+
+		tracker.MarkRegistered(connID, "04B10012")
+		if w, _ := callAPI(r, http.MethodPut, path, `{"dialect":"ap3000"}`); w.Code != http.StatusConflict {
+			t.Fatalf("注册完成后应返回409: %d", w.Code)
+		}
+		w, resp = callAPI(r, http.MethodGet, "/api/v1/admin/dialects", "")
+		dialects, _ := resp.Data["dialects"].([]interface{})
+		connections, _ := resp.Data["connections"].([]interface{})
+		if w.Code != http.StatusOK || len(dialects) != 2 || len(connections) == 0 {
+			t.Fatalf("应返回已注册方言与连接绑定: %s", w.Body.String())
+		}
+	})
+}
+
+// TestDialectConformanceSimulator 两种方言的模拟设备经解码器（严格模式一致性检查）完成注册、心跳、充电控制应答与结算，
+// 上行帧转换后均合规；网关下发帧按各自方言的消息ID字节序编码
+func TestDialectConformanceSimulator(t *testing.T) {
+	useDialectTracker(t)
+	for i, name := range []dialect.Name{dialect.AP3000, dialect.VendorB} {
+		t.Run(string(name), func(t *testing.T) {
+			connID := uint64(75021 + i)
+			physicalID := uint32(0x04B10021 + i)
+			deviceID := fmt.Sprintf("%08X", physicalID)
+			conn := registerSharedGroup(t, connID, fmt.Sprintf("898600000000000750%02d", 21+i), []string{deviceID})
+			decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+			defer decoder.ReleaseConnection(connID)
+			checker := protocol.NewConformanceChecker(protocol.ConformanceOptions{})
+
+			device := simulator.NewDevice(physicalID, "", name)
+			device.SeedMessageID(0x00FE) // 跨越低字节进位：大端序消息ID按小端序读取会表现为回退
+			now := time.Now()
+			feed := func(frame []byte, err error) *dny_protocol.Message {
+				t.Helper()
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, msg := decoder.DecodeFrame(connID, frame)
+				if msg == nil || msg.MessageType != "standard" {
+					t.Fatalf("解码失败: %+v", msg)
+				}
+				now = now.Add(time.Second)
+				if v := checker.Check(connID, msg, now); v != nil {
+					t.Fatalf("%s 违反一致性规则 %s: %s", dny_protocol.CommandLabel(uint8(msg.CommandId)), v.RuleID, v.Detail)
+				}
+				return msg
+			}
+
+			reg := feed(device.Register(dialect.Register{FirmwareVersion: 80, PortCount: 2, DeviceType: 0x04, PowerBoardVersion: 3, HasPowerBoard: true}))
+			if got := dialect.GetGlobalTracker().Dialect(connID); got != name {
+				t.Fatalf("注册帧应识别为 %s，实际 %s", name, got)
+			}
+			if reg.MessageId != 0x00FE {
+				t.Fatalf("注册帧消息ID应为0x00FE: 0x%04X", reg.MessageId)
+			}
+			for j := 0; j < 3; j++ {
+				hb := feed(device.Heartbeat(dialect.Heartbeat{Voltage: 22000, PortStatuses: []uint8{0, 1}, SignalStrength: 20, Temperature: 65, HasEnvironment: true}))
+				if hb.MessageId != device.LastMessageID() {
+					t.Fatalf("心跳消息ID应为0x%04X: 0x%04X", device.LastMessageID(), hb.MessageId)
+				}
+			}
+			feed(device.Settlement(dialect.Settlement{Duration: 600, Energy: 25, Port: 1, StopReason: dny_protocol.StopReasonFull, OrderNo: "ORD-SIM-1", Timestamp: 1760000000}))
+
+			// 网关下发充电控制命令，设备按收到的消息ID应答
+			if err := protocol.SendDNYResponse(conn, physicalID, 0x3A01, constants.CmdChargeControl, []byte{0x01}); err != nil {
+				t.Fatal(err)
+			}
+			got := waitFrames(t, conn, 1, nil)
+			down, err := device.ParseDownlink(got[0])
+			if err != nil || down.MessageID != 0x3A01 || down.Command != constants.CmdChargeControl {
+				t.Fatalf("设备应按方言读出下发消息ID: %+v %v (% X)", down, err, got[0])
+			}
+			resp := feed(device.ChargeControlResponse(down.MessageID, dialect.ChargeControlResponse{Port: 1, OrderNo: "ORD-SIM-1"}))
+			if resp.MessageId != 0x3A01 || len(resp.Data) != 20 || resp.Data[17] != 1 {
+				t.Fatalf("充电控制应答应转换为标准格式: 0x%04X % X", resp.MessageId, resp.Data)
+			}
+			if _, total := checker.Violations(0); total != 0 {
+				t.Fatalf("不应有违规记录: %d", total)
+			}
+		})
+	}
+}
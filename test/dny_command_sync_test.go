@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+	"github.com/gin-gonic/gin"
+)
+
+// syncDeviceConn 模拟设备连接：收到下发的0x81后以"消息ID低字节"为状态应答，经解码器投递给应答跟踪器（同 tcp_server 的装配）；
+// 第一条命令延迟应答，使应答到达顺序与下发顺序相反
+type syncDeviceConn struct {
+	disconnectTestConn
+	device *simulator.Device
+
+	mu         sync.Mutex
+	firstDelay time.Duration
+	silent     bool // 不应答
+	written    int
+}
+
+func (c *syncDeviceConn) set(fn func(c *syncDeviceConn)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(c)
+}
+
+func (c *syncDeviceConn) GetConnection() net.Conn    { return nil }
+func (c *syncDeviceConn) GetTCPConnection() net.Conn { return &syncDeviceNetConn{owner: c} }
+func (c *syncDeviceConn) Stop()                      {}
+
+type syncDeviceNetConn struct {
+	net.Conn
+	owner *syncDeviceConn
+}
+
+func (c *syncDeviceNetConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *syncDeviceNetConn) Write(b []byte) (int, error) {
+	owner := c.owner
+	downlink, err := owner.device.ParseDownlink(b)
+	if err != nil {
+		return len(b), nil
+	}
+	owner.mu.Lock()
+	if owner.silent {
+		owner.mu.Unlock()
+		return len(b), nil
+	}
+	owner.written++
+	delay := time.Duration(0)
+	if owner.written == 1 {
+		delay = owner.firstDelay
+	}
+	owner.mu.Unlock()
+
+	go func() {
+		time.Sleep(delay)
+		frame, err := dialect.BuildFrame(owner.device.Dialect, owner.device.PhysicalID, downlink.MessageID, downlink.Command, []byte{byte(downlink.MessageID)})
+		if err != nil {
+			return
+		}
+		msg, err := protocol.ParseDNYProtocolData(frame)
+		if err != nil {
+			return
+		}
+		network.GetCommandResponseTracker().Deliver(msg)
+	}()
+	return len(b), nil
+}
+
+// TestDNYCommandSync 原始命令接口：sync=true 时按消息ID等待设备应答并返回解码结果，并发请求各自拿到自己的应答，超时返回504与消息ID
+func TestDNYCommandSync(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shortConfirmTimeout(t)
+	quietLogger(t)
+	const deviceID = "04A27158"
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &syncDeviceConn{
+		disconnectTestConn: disconnectTestConn{id: 1758001},
+		device:             simulator.NewDevice(0x04A27158, "89860000000000175801", dialect.AP3000),
+	}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, deviceID, deviceID, "89860000000000175801"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcpManager.UnregisterConnection(conn.id) })
+
+	r := gin.New()
+	r.POST("/api/v1/command/dny", apihttp.NewDeviceHandlers().HandleSendDNYCommand)
+	type result struct {
+		code int
+		data struct {
+			MessageID   uint16 `json:"messageId"`
+			Sync        bool   `json:"sync"`
+			ReplyData   string `json:"replyData"`
+			ReplyLength int    `json:"replyLength"`
+			Decoded     struct {
+				MessageID string `json:"message_id"`
+				Command   string `json:"command"`
+				Payload   struct {
+					Status uint8
+				} `json:"payload"`
+			} `json:"decoded"`
+		}
+	}
+	post := func(path, body string) result {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		res := result{code: w.Code}
+		_ = json.Unmarshal(resp.Data, &res.data)
+		return res
+	}
+	body := fmt.Sprintf(`{"deviceId":"%s","command":%d}`, deviceID, constants.CmdNetworkStatus)
+
+	t.Run("一次往返返回解码后的状态", func(t *testing.T) {
+		res := post("/api/v1/command/dny?sync=true", body)
+		if res.code != http.StatusOK || !res.data.Sync || res.data.MessageID == 0 {
+			t.Fatalf("同步请求失败: %d %+v", res.code, res.data)
+		}
+		status := byte(res.data.MessageID)
+		if res.data.ReplyData != fmt.Sprintf("%02x", status) || res.data.ReplyLength != 1 || res.data.Decoded.Payload.Status != status {
+			t.Fatalf("应答数据或解码状态错误: %+v", res.data)
+		}
+		if res.data.Decoded.MessageID != fmt.Sprintf("0x%04X", res.data.MessageID) {
+			t.Fatalf("解码结果的消息ID应与下发一致: %+v", res.data.Decoded)
+		}
+	})
+
+	t.Run("并发请求不串扰", func(t *testing.T) {
+		conn.set(func(c *syncDeviceConn) { c.written, c.firstDelay = 0, 200*time.Millisecond })
+		defer conn.set(func(c *syncDeviceConn) { c.firstDelay = 0 })
+
+		var wg sync.WaitGroup
+		results := make([]result, 2)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = post("/api/v1/command/dny", strings.TrimSuffix(body, "}")+`,"sync":true}`)
+			}(i)
+		}
+		wg.Wait()
+		if results[0].data.MessageID == results[1].data.MessageID {
+			t.Fatalf("两个请求应使用不同的消息ID: %+v", results)
+		}
+		for _, res := range results {
+			if res.code != http.StatusOK || res.data.Decoded.Payload.Status != byte(res.data.MessageID) {
+				t.Fatalf("请求拿到了其他请求的应答: %d %+v", res.code, res.data)
+			}
+		}
+		if pending := network.GetCommandResponseTracker().Pending(); pending != 0 {
+			t.Fatalf("应答投递后不应有等待者: %d", pending)
+		}
+	})
+
+	t.Run("超时返回504与消息ID", func(t *testing.T) {
+		conn.set(func(c *syncDeviceConn) { c.silent = true })
+		defer conn.set(func(c *syncDeviceConn) { c.silent = false })
+		res := post("/api/v1/command/dny?sync=true&timeoutSec=1", body)
+		if res.code != http.StatusGatewayTimeout || res.data.MessageID == 0 {
+			t.Fatalf("应返回504并附消息ID: %d %+v", res.code, res.data)
+		}
+		if pending := network.GetCommandResponseTracker().Pending(); pending != 0 {
+			t.Fatalf("超时后应撤销登记: %d", pending)
+		}
+	})
+
+	t.Run("参数校验", func(t *testing.T) {
+		if res := post("/api/v1/command/dny?sync=true&timeoutSec=61", body); res.code != http.StatusBadRequest {
+			t.Fatalf("超过60秒应返回400: %d", res.code)
+		}
+		if res := post("/api/v1/command/dny", `{"deviceId":"04A27158","command":129,"data":"0G"}`); res.code != http.StatusBadRequest {
+			t.Fatalf("非法十六进制应返回400: %d", res.code)
+		}
+		res := post("/api/v1/command/dny", body)
+		if res.code != http.StatusOK || res.data.Sync || res.data.MessageID == 0 {
+			t.Fatalf("异步发送应立即返回消息ID: %d %+v", res.code, res.data)
+		}
+	})
+}
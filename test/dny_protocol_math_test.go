@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// dnyFrameInput 随机帧输入：数据长度取 0..最大帧长允许的数据长度
+type dnyFrameInput struct {
+	PhysicalID uint32
+	MessageID  uint16
+	Command    uint8
+	Data       []byte
+}
+
+// maxFrameDataLen 单帧不超过 constants.MaxPacketSize 时的最大数据长度
+const maxFrameDataLen = constants.MaxPacketSize - constants.MinPacketSize
+
+func (dnyFrameInput) Generate(r *rand.Rand, _ int) reflect.Value {
+	in := dnyFrameInput{
+		PhysicalID: r.Uint32(),
+		MessageID:  uint16(r.Intn(1 << 16)),
+		Command:    uint8(r.Intn(1 << 8)),
+		Data:       make([]byte, r.Intn(maxFrameDataLen+1)),
+	}
+	// 部分样本数据全为0xFF，使校验和越过16位回绕
+	if r.Intn(4) == 0 {
+		for i := range in.Data {
+			in.Data[i] = 0xFF
+		}
+	} else {
+		r.Read(in.Data)
+	}
+	return reflect.ValueOf(in)
+}
+
+func dnyQuickConfig() *quick.Config {
+	return &quick.Config{MaxCount: 300, Rand: rand.New(rand.NewSource(1699))}
+}
+
+// TestDNYFrameMathProperties 随机数据长度下：帧长 = 固定开销 + 数据长度；长度字段 = 长度字段之后直到帧尾（含校验）的字节数；
+// 校验 = 包头到数据末尾的累加和低16位（小端）；编码→解码往返字段一致
+func TestDNYFrameMathProperties(t *testing.T) {
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	property := func(in dnyFrameInput) bool {
+		frame := dny_protocol.BuildFrame(in.PhysicalID, in.MessageID, in.Command, in.Data)
+		n := len(in.Data)
+		if len(frame) != constants.MinPacketSize+n {
+			t.Logf("帧长%d，数据长度%d", len(frame), n)
+			return false
+		}
+		if declared := binary.LittleEndian.Uint16(frame[constants.LengthFieldPos:]); int(declared) != len(frame)-constants.MinHeaderSize ||
+			declared != dny_protocol.LengthFieldValue(n) {
+			t.Logf("长度字段%d，长度字段之后字节数%d", declared, len(frame)-constants.MinHeaderSize)
+			return false
+		}
+		var sum uint32
+		for _, b := range frame[:len(frame)-constants.ChecksumSize] {
+			sum += uint32(b)
+		}
+		if got := binary.LittleEndian.Uint16(frame[len(frame)-constants.ChecksumSize:]); got != uint16(sum) {
+			t.Logf("校验0x%04X，累加和0x%04X", got, uint16(sum))
+			return false
+		}
+
+		msg, err := protocol.ParseDNYProtocolData(frame)
+		if err != nil || msg.MessageType != "standard" || msg.PhysicalId != in.PhysicalID || msg.MessageId != in.MessageID ||
+			msg.CommandId != uint32(in.Command) || !bytes.Equal(msg.Data, in.Data) || msg.Checksum != uint16(sum) {
+			t.Logf("ParseDNYProtocolData往返不一致: %v %+v", err, msg)
+			return false
+		}
+		parsed, err := protocol.ParseDNYData(frame)
+		if err != nil || !parsed.ChecksumValid || parsed.Length != dny_protocol.LengthFieldValue(n) || !bytes.Equal(parsed.Data, in.Data) {
+			t.Logf("ParseDNYData往返不一致: %v %+v", err, parsed)
+			return false
+		}
+		msgID, decoded := decoder.DecodeFrame(1699, frame)
+		decoder.ReleaseConnection(1699)
+		if decoded == nil || msgID != uint32(in.Command) || decoded.PhysicalId != in.PhysicalID || !bytes.Equal(decoded.Data, in.Data) {
+			t.Logf("流式解码往返不一致: msgID=%d %+v", msgID, decoded)
+			return false
+		}
+		if err := protocol.ValidateUnifiedDNYPacket(frame); err != nil {
+			t.Logf("统一构建器校验失败: %v", err)
+			return false
+		}
+		if ok, err := protocol.ValidateDNYFrame(frame); !ok {
+			t.Logf("ValidateDNYFrame失败: %v", err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, dnyQuickConfig()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDNYBuildersByteIdentical 全部构建入口对相同输入产出逐字节相同的帧；各校验和入口结果一致
+func TestDNYBuildersByteIdentical(t *testing.T) {
+	builder := protocol.NewUnifiedDNYBuilder()
+	pack := protocol.NewDNYPacket(false)
+	property := func(in dnyFrameInput) bool {
+		want := dny_protocol.BuildFrame(in.PhysicalID, in.MessageID, in.Command, in.Data)
+		packed, err := pack.Pack(dny_protocol.NewMessage(uint32(in.Command), in.PhysicalID, in.Data, in.MessageID))
+		if err != nil {
+			t.Logf("Pack失败: %v", err)
+			return false
+		}
+		// DataLen 未同步（直接构造的消息）时封包仍按实际数据计算长度字段
+		literal, err := pack.Pack(&dny_protocol.Message{Id: uint32(in.Command), PhysicalId: in.PhysicalID, MessageId: in.MessageID, Data: in.Data})
+		if err != nil {
+			t.Logf("Pack失败: %v", err)
+			return false
+		}
+		for name, got := range map[string][]byte{
+			"UnifiedDNYBuilder.BuildDNYPacket": builder.BuildDNYPacket(in.PhysicalID, in.MessageID, in.Command, in.Data),
+			"BuildUnifiedDNYPacket":            protocol.BuildUnifiedDNYPacket(in.PhysicalID, in.MessageID, in.Command, in.Data),
+			"DNYPacket.Pack":                   packed,
+			"DNYPacket.Pack(DataLen未设置)":       literal,
+		} {
+			if !bytes.Equal(got, want) {
+				t.Logf("%s 与 dny_protocol.BuildFrame 不一致:\n%X\n%X", name, got, want)
+				return false
+			}
+		}
+		body := want[:len(want)-constants.ChecksumSize]
+		internal, err := protocol.CalculatePacketChecksumInternal(body)
+		return err == nil && internal == dny_protocol.Checksum(body) && builder.CalculateChecksum(body) == internal
+	}
+	if err := quick.Check(property, dnyQuickConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 充电控制包与通用构建入口一致
+	frame := dny_protocol.BuildChargeControlPacket(0x04A228CD, 0x0002, 0, 1000, 1, 1, 60, "ORDER_1699", 0, 0, 0)
+	msg, err := protocol.ParseDNYProtocolData(frame)
+	if err != nil || !bytes.Equal(frame, dny_protocol.BuildFrame(msg.PhysicalId, msg.MessageId, uint8(msg.CommandId), msg.Data)) {
+		t.Fatalf("充电控制包与 BuildFrame 不一致: %v %X", err, frame)
+	}
+}
+
+// TestDNYLengthChecksumEdges 长度字段与校验和的边界：空数据、校验回绕、长度字段±1、校验字节序写反
+func TestDNYLengthChecksumEdges(t *testing.T) {
+	empty := dny_protocol.BuildFrame(0x04A26CF3, 1, constants.CmdDeviceHeart, nil)
+	if len(empty) != constants.MinPacketSize || binary.LittleEndian.Uint16(empty[3:5]) != 9 {
+		t.Fatalf("空数据帧长度错误: %X", empty)
+	}
+	if msg, err := protocol.ParseDNYProtocolData(empty); err != nil || len(msg.Data) != 0 {
+		t.Fatalf("空数据帧应可解析: %v", err)
+	}
+
+	// 300字节0xFF：累加和超过0xFFFF，按低16位截断
+	wrap := dny_protocol.BuildFrame(0xFFFFFFFF, 0xFFFF, 0xFF, bytes.Repeat([]byte{0xFF}, 300))
+	var sum uint32
+	for _, b := range wrap[:len(wrap)-2] {
+		sum += uint32(b)
+	}
+	if sum <= 0xFFFF || binary.LittleEndian.Uint16(wrap[len(wrap)-2:]) != uint16(sum) {
+		t.Fatalf("校验和应回绕到低16位: sum=0x%X frame=%X", sum, wrap[len(wrap)-2:])
+	}
+
+	frame := dny_protocol.BuildFrame(0x04A26CF3, 0x0101, constants.CmdChargeControl, []byte{0x00, 0x01})
+	for _, delta := range []int{-1, 1} {
+		bad := append([]byte(nil), frame...)
+		binary.LittleEndian.PutUint16(bad[3:5], uint16(int(binary.LittleEndian.Uint16(bad[3:5]))+delta))
+		if _, err := protocol.ParseDNYProtocolData(bad); err == nil || !strings.Contains(err.Error(), "length mismatch") {
+			t.Fatalf("长度字段%+d应被拒绝: %v", delta, err)
+		}
+		if protocol.ValidateUnifiedDNYPacket(bad) == nil {
+			t.Fatalf("统一构建器校验应拒绝长度字段%+d", delta)
+		}
+	}
+
+	swapped := append([]byte(nil), frame...)
+	swapped[len(swapped)-2], swapped[len(swapped)-1] = swapped[len(swapped)-1], swapped[len(swapped)-2]
+	if msg, err := protocol.ParseDNYProtocolData(swapped); err == nil || msg.MessageType != "error" {
+		t.Fatalf("校验字节序写反应报校验错误: %v", err)
+	}
+}
+
+// dnyCapturedFrames 仓库中记录的真实设备/协议文档报文（来源见注释）
+var dnyCapturedFrames = []struct {
+	name, hex string
+	command   uint8
+}{
+	{"设备定位应答（test/device_locate_test.go）", "444E590A00F36CA2040100960A9B03", 0x96},
+	{"充电控制简化应答（handlers/charge_control_handler_test.go 用户原始报文）", "444E590B00F36CA20408008201018703", 0x82},
+	{"充电控制下发（test/charging_test.go）", "444E592E00CD28A20402008200F203000000013C004F524445525F323032353036313930390000000000000000020000004908", 0x82},
+	{"充电控制黄金向量（pkg/selftest）", "444E592E003067B1047316820100000000010000004F52443136373353544F500000000000201CAC0D01000000020000006607", 0x82},
+	{"时间同步应答（README.md）", "444e590900cd28a2043b0222ee02", 0x22},
+	{"心跳应答（docs/协议/protocol_parsing_standard.md）", "444e590900f36ca2040200120d03", 0x12},
+	// dny_protocol_parser.go 注释中用户验证的报文（原注释只记录了校验前的部分与校验值 4B05）
+	{"用户验证报文（pkg/protocol/dny_protocol_parser.go）", "444E590D00CD28A20479082263EE5C684B05", 0x22},
+}
+
+// TestDNYCapturedFrameRegression 真实报文：长度与校验正确，解码后以统一构建入口重建逐字节一致
+func TestDNYCapturedFrameRegression(t *testing.T) {
+	for _, c := range dnyCapturedFrames {
+		raw, err := hex.DecodeString(c.hex)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		msg, err := protocol.ParseDNYProtocolData(raw)
+		if err != nil || msg.MessageType != "standard" || uint8(msg.CommandId) != c.command {
+			t.Fatalf("%s: 解析失败 %v %+v", c.name, err, msg)
+		}
+		if rebuilt := dny_protocol.BuildFrame(msg.PhysicalId, msg.MessageId, uint8(msg.CommandId), msg.Data); !bytes.Equal(rebuilt, raw) {
+			t.Fatalf("%s: 重建不一致\n%X\n%X", c.name, rebuilt, raw)
+		}
+	}
+
+	// 校验字节序写反的报文（test/frame_diagnostics_test.go）应被识别为校验错误
+	raw, _ := hex.DecodeString("444E591D003B37AB04020082001234567812345678123456781234567801000006FE")
+	if msg, err := protocol.ParseDNYProtocolData(raw); err == nil || msg.MessageType != "error" {
+		t.Fatalf("校验字节序写反的报文应报校验错误: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/sirupsen/logrus"
+)
+
+// TestECSLogFormat 注册、充电控制与错误路径的代表性日志按ECS字段名序列化
+func TestECSLogFormat(t *testing.T) {
+	if !logger.IsECSFormat("ECS-JSON") || logger.IsECSFormat("json") {
+		t.Fatal("ecs-json 格式识别错误")
+	}
+
+	ts := time.Date(2026, 10, 15, 8, 30, 0, 123000000, time.UTC)
+	base := map[string]interface{}{
+		"@timestamp":   "2026-10-15T08:30:00.123Z",
+		"ecs.version":  logger.ECSVersion,
+		"service.name": "iot-zinx-test",
+	}
+	cases := []struct {
+		name    string
+		level   logrus.Level
+		message string
+		fields  logrus.Fields
+		want    map[string]interface{}
+	}{
+		{
+			name:    "设备注册",
+			level:   logrus.InfoLevel,
+			message: "设备注册智能决策",
+			fields: logrus.Fields{
+				"connID":   uint64(12),
+				"deviceId": "04A26CF3",
+				"action":   "register",
+				"reason":   "首次注册",
+			},
+			want: map[string]interface{}{
+				"log.level":    "info",
+				"message":      "设备注册智能决策",
+				"event.action": "register",
+				"device.id":    "04A26CF3",
+				"labels":       map[string]interface{}{"connID": "12", "reason": "首次注册"},
+			},
+		},
+		{
+			name:    "充电控制",
+			level:   logrus.InfoLevel,
+			message: "📥 收到充电控制响应",
+			fields: logrus.Fields{
+				"connID":     uint64(12),
+				"remoteAddr": "10.0.0.8:51234",
+				"command":    dny_protocol.CommandLabel(constants.CmdChargeControl),
+				"messageID":  uint16(0x0A01),
+				"dataLen":    20,
+			},
+			want: map[string]interface{}{
+				"log.level":      "info",
+				"message":        "📥 收到充电控制响应",
+				"event.code":     "0x82 服务器开始、停止充电操作",
+				"source.address": "10.0.0.8:51234",
+				"source.ip":      "10.0.0.8",
+				"source.port":    float64(51234),
+				"network.bytes":  float64(20),
+				"labels":         map[string]interface{}{"connID": "12", "messageID": "2561"},
+			},
+		},
+		{
+			name:    "错误路径",
+			level:   logrus.ErrorLevel,
+			message: "解析DNY数据失败",
+			fields: logrus.Fields{
+				"connID":   uint64(12),
+				"deviceID": "04A26CF3",
+				"error":    errors.New("数据长度不足"),
+				"source":   "zinx",
+			},
+			want: map[string]interface{}{
+				"log.level":     "error",
+				"message":       "解析DNY数据失败",
+				"error.message": "数据长度不足",
+				"device.id":     "04A26CF3",
+				"event.module":  "zinx",
+				"labels":        map[string]interface{}{"connID": "12"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := logrus.New()
+			l.SetOutput(&buf)
+			l.SetFormatter(logger.NewECSFormatter("iot-zinx-test"))
+			l.WithTime(ts).WithFields(tc.fields).Log(tc.level, tc.message)
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("输出不是合法JSON: %v %s", err, buf.String())
+			}
+			want := map[string]interface{}{}
+			for k, v := range base {
+				want[k] = v
+			}
+			for k, v := range tc.want {
+				want[k] = v
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("ECS文档不符合预期:\n got: %s\nwant: %v", buf.String(), want)
+			}
+		})
+	}
+
+	// 多个字段映射到同一ECS字段时，结果稳定且不丢字段
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(logger.NewECSFormatter(""))
+	l.WithFields(logrus.Fields{"deviceID": "A", "deviceId": "B"}).Info("x")
+	var got map[string]interface{}
+	_ = json.Unmarshal(buf.Bytes(), &got)
+	labels, _ := got["labels"].(map[string]interface{})
+	if got["device.id"] != "A" || labels["deviceId"] != "B" || got["service.name"] != logger.DefaultECSServiceName {
+		t.Fatalf("字段冲突处理错误: %s", buf.String())
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+	"github.com/gin-gonic/gin"
+)
+
+// TestPortEnergyCounters 结算与积分去重、积分补记与迟到结算修正、月度结转与持久化
+func TestPortEnergyCounters(t *testing.T) {
+	const deviceID = "04A26CF3"
+	base := time.Date(2026, 1, 15, 10, 0, 0, 0, time.Local)
+
+	t.Run("结算为准丢弃积分", func(t *testing.T) {
+		c, _ := energy.NewCounters(nil, energy.Options{})
+		for i := 0; i <= 6; i++ {
+			c.OnPowerSample(deviceID, 1, "ORDER_A", 1000, base.Add(time.Duration(i)*10*time.Minute))
+		}
+		p, _ := c.Port(deviceID, 1, base)
+		if p.InProgressOrderNo != "ORDER_A" || math.Abs(p.InProgressWh-1000) > 0.01 || p.TotalWh != 0 {
+			t.Fatalf("进行中会话应只积分不计入: %+v", p)
+		}
+		if !c.OnSettlement(deviceID, 1, "ORDER_A", 950, base.Add(time.Hour)) {
+			t.Fatal("结算应计入")
+		}
+		if c.OnSettlement(deviceID, 1, "ORDER_A", 950, base.Add(time.Hour)) {
+			t.Fatal("重复结算应忽略")
+		}
+		c.OnPowerSample(deviceID, 1, "ORDER_A", 1000, base.Add(70*time.Minute))
+		c.Sweep(base.Add(24 * time.Hour))
+		p, _ = c.Port(deviceID, 1, base)
+		if p.TotalWh != 950 || p.MonthWh != 950 || p.Sessions != 1 || p.SettledSessions != 1 || p.InProgressWh != 0 {
+			t.Fatalf("同一订单只应按结算计入一次: %+v", p)
+		}
+	})
+
+	t.Run("积分补记与迟到结算修正", func(t *testing.T) {
+		c, _ := energy.NewCounters(nil, energy.Options{SettlementGrace: 30 * time.Minute})
+		for i := 0; i <= 3; i++ {
+			c.OnPowerSample(deviceID, 2, "ORDER_B", 2000, base.Add(time.Duration(i)*10*time.Minute))
+		}
+		if n := c.Sweep(base.Add(45 * time.Minute)); n != 0 {
+			t.Fatalf("宽限期内不应补记: %d", n)
+		}
+		if n := c.Sweep(base.Add(61 * time.Minute)); n != 1 {
+			t.Fatalf("宽限期后应补记1个会话: %d", n)
+		}
+		p, _ := c.Port(deviceID, 2, base)
+		if math.Abs(p.TotalWh-1000) > 0.01 || p.IntegratedSessions != 1 {
+			t.Fatalf("积分补记错误: %+v", p)
+		}
+		c.OnSettlement(deviceID, 2, "ORDER_B", 1100, base.Add(2*time.Hour))
+		p, _ = c.Port(deviceID, 2, base)
+		if math.Abs(p.TotalWh-1100) > 0.01 || math.Abs(p.MonthWh-1100) > 0.01 || p.Sessions != 1 || p.SettledSessions != 1 || p.IntegratedSessions != 0 {
+			t.Fatalf("迟到结算应替换积分值: %+v", p)
+		}
+
+		// 新订单开始时上一订单按积分补记
+		c.OnPowerSample(deviceID, 3, "ORDER_C", 600, base)
+		c.OnPowerSample(deviceID, 3, "ORDER_C", 600, base.Add(10*time.Minute))
+		c.OnPowerSample(deviceID, 3, "ORDER_D", 600, base.Add(20*time.Minute))
+		p, _ = c.Port(deviceID, 3, base)
+		if math.Abs(p.TotalWh-100) > 0.01 || p.InProgressOrderNo != "ORDER_D" {
+			t.Fatalf("换单时应补记上一订单: %+v", p)
+		}
+	})
+
+	t.Run("月度结转保留12个月", func(t *testing.T) {
+		c, _ := energy.NewCounters(nil, energy.Options{})
+		for i := 0; i < 14; i++ {
+			at := base.AddDate(0, i, 0)
+			c.OnSettlement(deviceID, 1, "", 100, at)
+			c.Sweep(at)
+		}
+		now := base.AddDate(0, 13, 0)
+		p, _ := c.Port(deviceID, 1, now)
+		if p.TotalWh != 1400 || p.Month != now.Format("2006-01") || p.MonthWh != 100 || len(p.History) != 12 {
+			t.Fatalf("结转结果错误: total=%v month=%s monthWh=%v history=%d", p.TotalWh, p.Month, p.MonthWh, len(p.History))
+		}
+		if p.History[0].Month != now.AddDate(0, -1, 0).Format("2006-01") || p.History[11].Month != now.AddDate(0, -12, 0).Format("2006-01") {
+			t.Fatalf("历史应为最近12个月（新→旧）: %+v", p.History)
+		}
+
+		// 结转后到达的上月结算记入对应历史月份
+		c.OnSettlement(deviceID, 1, "ORDER_LATE", 50, now.AddDate(0, -1, 0))
+		p, _ = c.Port(deviceID, 1, now)
+		if p.MonthWh != 100 || p.History[0].EnergyWh != 150 || p.TotalWh != 1450 {
+			t.Fatalf("上月结算应记入历史: monthWh=%v history0=%+v", p.MonthWh, p.History[0])
+		}
+	})
+
+	t.Run("持久化恢复", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "port_energy.json")
+		c, _ := energy.NewCounters(energy.NewFileStore(path), energy.Options{})
+		c.OnSettlement(deviceID, 1, "ORDER_P1", 500, base)
+		c.OnPowerSample(deviceID, 2, "ORDER_P2", 1200, base)
+		if err := c.Stop(); err != nil {
+			t.Fatalf("持久化失败: %v", err)
+		}
+		reloaded, err := energy.NewCounters(energy.NewFileStore(path), energy.Options{})
+		if err != nil {
+			t.Fatalf("恢复失败: %v", err)
+		}
+		if reloaded.OnSettlement(deviceID, 1, "ORDER_P1", 500, base) {
+			t.Fatal("重启后重复结算仍应忽略")
+		}
+		reloaded.OnPowerSample(deviceID, 2, "ORDER_P2", 1200, base.Add(10*time.Minute))
+		p, _ := reloaded.Port(deviceID, 2, base)
+		if p.InProgressOrderNo != "ORDER_P2" || math.Abs(p.InProgressWh-200) > 0.01 {
+			t.Fatalf("进行中的积分会话应恢复: %+v", p)
+		}
+		if p, _ := reloaded.Port(deviceID, 1, base); p.TotalWh != 500 {
+			t.Fatalf("累计电量应恢复: %+v", p)
+		}
+	})
+}
+
+// TestPortEnergyAPI 单端口查询与按累计电量排序的阈值报告
+func TestPortEnergyAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := energy.NewCounters(nil, energy.Options{ThresholdKWh: 1})
+	energy.SetGlobalCounters(c)
+	defer func() {
+		empty, _ := energy.NewCounters(nil, energy.Options{})
+		energy.SetGlobalCounters(empty)
+	}()
+	now := time.Now()
+	c.OnSettlement("04A26CF3", 1, "ORDER_1", 1500, now)
+	c.OnSettlement("04A26CF3", 2, "ORDER_2", 300, now)
+	c.OnSettlement("04A26CF4", 1, "ORDER_3", 800, now)
+
+	h := apihttp.NewEnergyHandlers()
+	r := gin.New()
+	r.GET("/api/v1/device/:deviceId/ports/:port/energy", h.HandlePortEnergy)
+	r.GET("/api/v1/energy/ports", h.HandleEnergyReport)
+
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	code, data := get("/api/v1/device/04A26CF3/ports/1/energy")
+	if code != http.StatusOK {
+		t.Fatalf("查询端口电量失败: %d", code)
+	}
+	if e := data["energy"].(map[string]interface{}); e["totalKWh"].(float64) != 1.5 || e["overThreshold"] != true {
+		t.Fatalf("端口电量错误: %+v", e)
+	}
+	if code, _ := get("/api/v1/device/04A26CF3/ports/4/energy"); code != http.StatusNotFound {
+		t.Fatalf("无记录端口应返回404: %d", code)
+	}
+	if code, _ := get("/api/v1/device/04A26CF3/ports/0/energy"); code != http.StatusBadRequest {
+		t.Fatalf("端口0应返回400: %d", code)
+	}
+
+	_, data = get("/api/v1/energy/ports")
+	ports := data["ports"].([]interface{})
+	if len(ports) != 3 || data["overThreshold"].(float64) != 1 {
+		t.Fatalf("报告错误: %+v", data)
+	}
+	if first := ports[0].(map[string]interface{}); first["deviceId"] != "04A26CF3" || first["port"].(float64) != 1 {
+		t.Fatalf("报告应按累计电量从高到低排序: %+v", ports)
+	}
+	_, data = get("/api/v1/energy/ports?thresholdKWh=0.5&overOnly=true")
+	if len(data["ports"].([]interface{})) != 2 || data["thresholdKWh"].(float64) != 0.5 {
+		t.Fatalf("按请求阈值过滤错误: %+v", data)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// TestEventBusReplayCursor 按主题与游标回放、回放条数上限、保留窗口外的游标标记回放缺口
+func TestEventBusReplayCursor(t *testing.T) {
+	bus := events.NewBus(events.Options{TopicCapacity: 4})
+	for i := 0; i < 3; i++ {
+		bus.Publish(events.TopicDevice, "device_online", "04A2715A", i)
+		bus.Publish(events.TopicPort, "port_status_change", "04A2715A", i)
+	}
+
+	// 仅设备主题，游标之后的事件（序号 1,3,5 中 >1 的部分）
+	sub := bus.Subscribe(events.SubscribeOptions{Topics: []events.Topic{events.TopicDevice}, Replay: true, After: 1})
+	defer sub.Close()
+	var seqs []uint64
+	for ev, ok := sub.TryNext(); ok; ev, ok = sub.TryNext() {
+		seqs = append(seqs, ev.Seq)
+	}
+	if len(seqs) != 2 || seqs[0] != 3 || seqs[1] != 5 || sub.ReplayGap() {
+		t.Fatalf("回放结果错误: %v gap=%v", seqs, sub.ReplayGap())
+	}
+
+	// 实时事件紧随回放
+	bus.Publish(events.TopicDevice, "device_offline", "04A2715A", nil)
+	bus.Publish(events.TopicPort, "port_status_change", "04A2715A", nil)
+	if ev, ok := sub.TryNext(); !ok || ev.Seq != 7 || ev.Type != "device_offline" {
+		t.Fatalf("实时事件错误: %+v", ev)
+	}
+	if _, ok := sub.TryNext(); ok {
+		t.Fatal("未订阅的主题不应投递")
+	}
+
+	// 全部主题的最近3条
+	recent := bus.Subscribe(events.SubscribeOptions{Replay: true, ReplayLimit: 3})
+	defer recent.Close()
+	if ev, _ := recent.TryNext(); ev.Seq != 6 || recent.Stats().Replayed != 3 {
+		t.Fatalf("回放上限应保留最新事件: %+v %+v", ev, recent.Stats())
+	}
+
+	// 设备主题已覆盖序号1的事件（容量4），游标为0时部分事件无法回放
+	for i := 0; i < 2; i++ {
+		bus.Publish(events.TopicDevice, "device_online", "04A2715A", nil)
+	}
+	stale := bus.Subscribe(events.SubscribeOptions{Topics: []events.Topic{events.TopicDevice}, Replay: true})
+	defer stale.Close()
+	if !stale.ReplayGap() || stale.Stats().Replayed != 4 {
+		t.Fatalf("游标早于保留窗口应标记缺口: %+v", stale.Stats())
+	}
+	if st := bus.Stats(); st.Topics[events.TopicDevice].Published != 6 || st.Topics[events.TopicDevice].Retained != 4 || len(st.Subscribers) != 3 {
+		t.Fatalf("总线统计错误: %+v", st)
+	}
+}
+
+// TestEventBusDropOldest 订阅者处理不过来时丢弃最旧事件并计数，发布方不阻塞
+func TestEventBusDropOldest(t *testing.T) {
+	bus := events.NewBus(events.Options{})
+	slow := bus.Subscribe(events.SubscribeOptions{Name: "slow", Buffer: 3})
+	for i := 1; i <= 5; i++ {
+		bus.Publish(events.TopicCharging, "charging_power", "04A2715A", i)
+	}
+	st := slow.Stats()
+	if st.Dropped != 2 || st.Pending != 3 || st.Delivered != 5 || st.PendingAge < 0 {
+		t.Fatalf("丢弃统计错误: %+v", st)
+	}
+	for want := uint64(3); want <= 5; want++ {
+		if ev, ok := slow.TryNext(); !ok || ev.Seq != want {
+			t.Fatalf("应保留最新事件 %d: %+v", want, ev)
+		}
+	}
+	if st := slow.Stats(); st.Pending != 0 || st.Consumed != 3 || st.LastSeq != 5 {
+		t.Fatalf("消费统计错误: %+v", st)
+	}
+
+	// 关闭后 Next 立即返回，不再入队
+	slow.Close()
+	if _, ok := slow.Next(context.Background()); ok {
+		t.Fatal("关闭后不应返回事件")
+	}
+	bus.Publish(events.TopicCharging, "charging_power", "04A2715A", 6)
+	if len(bus.Stats().Subscribers) != 0 {
+		t.Fatal("关闭的订阅者应移除")
+	}
+}
+
+// TestEventBusAttachWhilePublishing 并发发布时携带游标接入：每个订阅者看到的序号从游标起连续、无重复无遗漏
+func TestEventBusAttachWhilePublishing(t *testing.T) {
+	const (
+		publishers  = 4
+		perProducer = 500
+		subscribers = 16
+	)
+	total := publishers * perProducer
+	bus := events.NewBus(events.Options{TopicCapacity: total, SubscriberBuffer: total})
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perProducer; i++ {
+				bus.Publish(events.TopicDevice, "device_heartbeat", "04A2715A", i)
+			}
+		}()
+	}
+
+	type attached struct {
+		after uint64
+		sub   *events.Subscription
+	}
+	subs := make([]attached, subscribers)
+	var attachWG sync.WaitGroup
+	for i := 0; i < subscribers; i++ {
+		attachWG.Add(1)
+		go func(i int) {
+			defer attachWG.Done()
+			<-start
+			time.Sleep(time.Duration(i) * 100 * time.Microsecond)
+			after := bus.Head() // 模拟断线前最后收到的序号，之后发布的事件须经回放补齐
+			subs[i] = attached{after: after, sub: bus.Subscribe(events.SubscribeOptions{Replay: true, After: after})}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	attachWG.Wait()
+
+	head := bus.Head()
+	if head != uint64(total) {
+		t.Fatalf("发布总数错误: %d", head)
+	}
+	for i, a := range subs {
+		expect := a.after + 1
+		for ev, ok := a.sub.TryNext(); ok; ev, ok = a.sub.TryNext() {
+			if ev.Seq != expect {
+				t.Fatalf("订阅者%d 序号不连续: 期望 %d 实际 %d（游标 %d）", i, expect, ev.Seq, a.after)
+			}
+			expect++
+		}
+		if expect != head+1 {
+			t.Fatalf("订阅者%d 未收到全部事件: 截止 %d，最新 %d", i, expect-1, head)
+		}
+		if st := a.sub.Stats(); st.Dropped != 0 {
+			t.Fatalf("订阅者%d 不应丢弃: %+v", i, st)
+		}
+		a.sub.Close()
+	}
+}
+
+// TestNotificationEventTopics 通知事件按类型归入总线主题
+func TestNotificationEventTopics(t *testing.T) {
+	cases := map[string]events.Topic{
+		notification.EventTypeDeviceOnline:         events.TopicDevice,
+		notification.EventTypeSIMFailover:          events.TopicDevice,
+		notification.EventTypePortStatusChange:     events.TopicPort,
+		notification.EventTypeSettlement:           events.TopicCharging,
+		notification.EventTypeICCIDConflict:        events.TopicAlarm,
+		notification.EventTypeChargingFailed:       events.TopicAlarm,
+		notification.EventTypeFrameJournalDegraded: events.TopicSystem,
+	}
+	for eventType, want := range cases {
+		if got := notification.TopicForEvent(eventType); got != want {
+			t.Errorf("%s 应归入 %s，实际 %s", eventType, want, got)
+		}
+	}
+	if !notification.IsNotificationEvent(events.Event{Payload: &notification.NotificationEvent{}}) || notification.IsNotificationEvent(events.Event{Payload: 1}) {
+		t.Fatal("通知事件负载判断错误")
+	}
+}
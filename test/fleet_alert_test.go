@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/fleetalert"
+	"github.com/gin-gonic/gin"
+)
+
+// fleetSnapshot 合成网络：prefixes 个ICCID前缀（15位）× iccidsPerPrefix 个ICCID × devicesPerICCID 台设备
+func fleetSnapshot(prefixes, iccidsPerPrefix, devicesPerICCID int) map[string]int {
+	online := make(map[string]int)
+	for p := 0; p < prefixes; p++ {
+		for i := 0; i < iccidsPerPrefix; i++ {
+			online[fmt.Sprintf("898604%09d%05d", p, i)] = devicesPerICCID
+		}
+	}
+	return online
+}
+
+func fleetRules() []fleetalert.Rule {
+	return []fleetalert.Rule{
+		{Name: "drop_10pct_5m", Type: fleetalert.RuleRateOfChange, Window: 5 * time.Minute, DropPercent: 10, MinDrop: 20},
+		{Name: "drop_30pct_15m", Type: fleetalert.RuleRateOfChange, Window: 15 * time.Minute, DropPercent: 30, MinDrop: 20},
+		{Name: "below_500", Type: fleetalert.RuleThreshold, MinOnline: 500},
+	}
+}
+
+// TestFleetAlertGradualVersusCliff 合成时间序列：缓慢下降不告警；单站点断崖下降按比例告警并判定为站点故障，窗口过后恢复；
+// 多前缀断崖下降触发两条规则并判定为网关整体故障；小规模网络下降设备数不足时不告警，绝对值下限规则仍生效
+func TestFleetAlertGradualVersusCliff(t *testing.T) {
+	start := time.Date(2026, 10, 15, 8, 0, 0, 0, time.Local)
+	step := 30 * time.Second
+
+	t.Run("缓慢下降", func(t *testing.T) {
+		m := fleetalert.NewMonitor(fleetalert.Options{Rules: fleetRules()}, nil)
+		online := fleetSnapshot(20, 5, 10) // 1000台
+		keys := make([]string, 0, len(online))
+		for iccid := range online {
+			keys = append(keys, iccid)
+		}
+		// 60分钟内从1000降到700：每个采样间隔离线2~3台
+		removed := 0
+		for i := 0; i <= 120; i++ {
+			for target := i * 300 / 120; removed < target; removed++ {
+				online[keys[removed%len(keys)]]--
+			}
+			m.Observe(start.Add(time.Duration(i)*step), online)
+		}
+		if history := m.History(); len(history) != 0 {
+			t.Fatalf("缓慢下降不应告警: %+v", history)
+		}
+	})
+
+	t.Run("单站点断崖", func(t *testing.T) {
+		m := fleetalert.NewMonitor(fleetalert.Options{Rules: fleetRules()}, nil)
+		var notified []fleetalert.Alert
+		m.RegisterHandler(func(a fleetalert.Alert) { notified = append(notified, a) })
+
+		online := fleetSnapshot(10, 10, 10) // 1000台，前缀0为故障站点（10个ICCID、100台）
+		at := start
+		for i := 0; i < 10; i++ {
+			m.Observe(at, online)
+			at = at.Add(step)
+		}
+		for i := 0; i < 10; i++ {
+			online[fmt.Sprintf("898604%09d%05d", 0, i)] = 0
+		}
+		m.Observe(at, online)
+
+		active := m.Active()
+		if len(active) != 1 || active[0].Rule != "drop_10pct_5m" || active[0].State != fleetalert.StateFiring {
+			t.Fatalf("下降10%%应只触发5分钟规则: %+v", active)
+		}
+		alert := active[0]
+		if alert.Reference != 1000 || alert.Online != 900 || alert.Drop != 100 || alert.DropPercent != 10 ||
+			alert.DisconnectedDevices != 100 || alert.DisconnectedICCIDs != 10 || len(alert.ICCIDs) != 10 {
+			t.Fatalf("告警应附绝对数量、比例与离线ICCID: %+v", alert)
+		}
+		if alert.Scope != fleetalert.ScopeSite || len(alert.Prefixes) != 1 || alert.Prefixes[0].Devices != 100 || alert.Prefixes[0].ICCIDs != 10 {
+			t.Fatalf("离线集中在单一前缀应判定为站点故障: %+v", alert)
+		}
+
+		// 保持900台，断崖移出5分钟窗口后恢复
+		for i := 0; i < 11; i++ {
+			at = at.Add(step)
+			m.Observe(at, online)
+		}
+		if len(m.Active()) != 0 {
+			t.Fatalf("断崖移出窗口后应恢复: %+v", m.Active())
+		}
+		history := m.History()
+		if len(history) != 1 || history[0].State != fleetalert.StateResolved || history[0].ResolvedAt == nil || history[0].Lowest != 900 {
+			t.Fatalf("告警记录应为已恢复: %+v", history)
+		}
+		if len(notified) != 2 || notified[0].State != fleetalert.StateFiring || notified[1].State != fleetalert.StateResolved || notified[0].ID != notified[1].ID {
+			t.Fatalf("开启与恢复各回调一次: %+v", notified)
+		}
+	})
+
+	t.Run("网关整体断崖", func(t *testing.T) {
+		m := fleetalert.NewMonitor(fleetalert.Options{Rules: fleetRules(), MaxListedICCIDs: 5}, nil)
+		online := fleetSnapshot(10, 10, 10)
+		m.Observe(start, online)
+		// 两个采样间隔内每个前缀各有约45%的设备离线
+		at := start
+		for round := 0; round < 2; round++ {
+			at = at.Add(step)
+			for p := 0; p < 10; p++ {
+				for i := round * 2; i < round*2+2; i++ {
+					online[fmt.Sprintf("898604%09d%05d", p, i)] = 0
+				}
+				if round == 1 {
+					online[fmt.Sprintf("898604%09d%05d", p, 4)] = 5
+				}
+			}
+			m.Observe(at, online)
+		}
+		active := m.Active()
+		if len(active) != 2 || active[0].DropPercent != 20 || active[0].PeakPercent != 45 {
+			t.Fatalf("下降45%%应触发两条比例规则: %+v", active)
+		}
+		for _, alert := range active {
+			if alert.Scope != fleetalert.ScopeGateway || alert.DisconnectedICCIDs != 50 || len(alert.ICCIDs) != 5 || len(alert.Prefixes) != 10 {
+				t.Fatalf("离线分散在多个前缀应判定为网关故障，离线情况随下降扩大更新，ICCID列表按上限截断: %+v", alert)
+			}
+		}
+		if active[1].Reference != 1000 || active[1].Online != 550 || active[1].DisconnectedDevices != 450 {
+			t.Fatalf("15分钟规则应以窗口内最高值计算: %+v", active[1])
+		}
+	})
+
+	t.Run("小规模网络", func(t *testing.T) {
+		rules := append(fleetRules()[:2], fleetalert.Rule{Name: "below_18", Type: fleetalert.RuleThreshold, MinOnline: 18})
+		m := fleetalert.NewMonitor(fleetalert.Options{Rules: rules}, nil)
+		online := fleetSnapshot(1, 20, 1) // 20台
+		m.Observe(start, online)
+		for i := 0; i < 3; i++ {
+			delete(online, fmt.Sprintf("898604%09d%05d", 0, i))
+		}
+		m.Observe(start.Add(step), online)
+		active := m.Active()
+		if len(active) != 1 || active[0].Rule != "below_18" || active[0].Type != fleetalert.RuleThreshold || active[0].Online != 17 {
+			t.Fatalf("下降15%%但不足 minDrop 时比例规则不应告警，下限规则应告警: %+v", active)
+		}
+	})
+
+	t.Run("无效规则忽略", func(t *testing.T) {
+		m := fleetalert.NewMonitor(fleetalert.Options{Rules: []fleetalert.Rule{
+			{Name: "bad_percent", Type: fleetalert.RuleRateOfChange, Window: time.Minute, DropPercent: 150},
+			{Name: "bad_type", Type: "ratio"},
+			{WindowSecs: 600, DropPercent: 20},
+		}}, nil)
+		rules := m.Options().Rules
+		if len(rules) != 1 || rules[0].Type != fleetalert.RuleRateOfChange || rules[0].Window != 10*time.Minute || rules[0].Name == "" {
+			t.Fatalf("无效规则应忽略，缺省类型为 rate_of_change: %+v", rules)
+		}
+	})
+}
+
+// TestFleetAlertAPI 在线设备数告警查询接口
+func TestFleetAlertAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	defer fleetalert.SetGlobalMonitor(fleetalert.GetGlobalMonitor())
+
+	fleetalert.SetGlobalMonitor(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/fleet-alerts", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用时应返回503: %d", w.Code)
+	}
+
+	m := fleetalert.NewMonitor(fleetalert.Options{Rules: fleetRules()}, nil)
+	fleetalert.SetGlobalMonitor(m)
+	at := time.Now()
+	online := fleetSnapshot(2, 10, 30) // 600台
+	m.Observe(at, online)
+	for i := 0; i < 10; i++ {
+		online[fmt.Sprintf("898604%09d%05d", 1, i)] = 0
+	}
+	m.Observe(at.Add(30*time.Second), online)
+
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/fleet-alerts", "")
+	active, _ := resp.Data["active"].([]interface{})
+	if w.Code != http.StatusOK || len(active) != 3 || len(resp.Data["samples"].([]interface{})) != 2 || len(resp.Data["rules"].([]interface{})) != 3 {
+		t.Fatalf("告警查询错误: %d %v", w.Code, resp.Data)
+	}
+	first := active[0].(map[string]interface{})
+	if first["scope"] != fleetalert.ScopeSite || first["drop"] != float64(300) {
+		t.Fatalf("告警字段错误: %v", first)
+	}
+}
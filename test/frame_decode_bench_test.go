@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// newBenchFrame 构造一帧0x21心跳（20字节数据域）
+func newBenchFrame() []byte {
+	return protocol.BuildUnifiedDNYPacket(0x04A26CF3, 1, 0x21, []byte{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A,
+		0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10, 0x11, 0x12, 0x13, 0x14,
+	})
+}
+
+// quietLogger 基准测试使用生产日志级别且丢弃输出
+func quietLogger(tb testing.TB) {
+	for _, l := range []*logrus.Logger{logger.GetLogger(), logger.GetCommunicationLogger()} {
+		if l == nil {
+			continue
+		}
+		l := l
+		out, level := l.Out, l.GetLevel()
+		l.SetOutput(io.Discard)
+		l.SetLevel(logrus.InfoLevel)
+		tb.Cleanup(func() {
+			l.SetOutput(out)
+			l.SetLevel(level)
+		})
+	}
+}
+
+// TestFrameDecodeBuffers 接收路径缓冲池化与帧数据所有权测试
+func TestFrameDecodeBuffers(t *testing.T) {
+	quietLogger(t)
+
+	t.Run("缓冲池借用与归还", func(t *testing.T) {
+		b := utils.GetBuffer(100)
+		if b.Len() != 100 || len(b.Bytes()) != 100 {
+			t.Fatalf("缓冲长度错误: %d", b.Len())
+		}
+		b.Release()
+
+		large := utils.GetBuffer(1 << 20)
+		if len(large.Bytes()) != 1<<20 {
+			t.Fatal("超大缓冲长度错误")
+		}
+		large.Release()
+	})
+
+	t.Run("延迟十六进制编码", func(t *testing.T) {
+		h := utils.LazyHexN([]byte{0xDE, 0xAD, 0xBE, 0xEF}, 2)
+		if h.String() != "dead" {
+			t.Fatalf("编码结果错误: %s", h.String())
+		}
+		out, err := json.Marshal(map[string]interface{}{"hex": h})
+		if err != nil || string(out) != `{"hex":"dead"}` {
+			t.Fatalf("JSON编码错误: %s %v", out, err)
+		}
+	})
+
+	t.Run("帧数据不引用读缓冲", func(t *testing.T) {
+		decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+		frame := newBenchFrame()
+		raw := append([]byte(nil), frame...)
+
+		msgID, msg := decoder.DecodeFrame(1, raw)
+		if msg == nil || msgID != 0x21 || msg.MessageType != "standard" {
+			t.Fatalf("解码失败: %d %+v", msgID, msg)
+		}
+		for i := range raw {
+			raw[i] = 0xFF // 模拟Zinx复用读缓冲
+		}
+		if string(msg.RawData) != string(frame) {
+			t.Fatal("RawData 不应随读缓冲变化")
+		}
+		if len(msg.Data) != 20 || msg.Data[0] != 0x01 || msg.Data[19] != 0x14 {
+			t.Fatalf("Data 不应随读缓冲变化: %x", msg.Data)
+		}
+	})
+
+	t.Run("跨读取半包拼接", func(t *testing.T) {
+		decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+		frame := newBenchFrame()
+
+		if _, msg := decoder.DecodeFrame(2, append([]byte(nil), frame[:10]...)); msg != nil {
+			t.Fatalf("半包不应解码出消息: %+v", msg)
+		}
+		msgID, msg := decoder.DecodeFrame(2, append([]byte(nil), frame[10:]...))
+		if msg == nil || msgID != 0x21 || msg.PhysicalId != 0x04A26CF3 {
+			t.Fatalf("拼接后应解码出完整帧: %d %+v", msgID, msg)
+		}
+
+		// 连接关闭后半包被释放，不影响后续读取
+		_, _ = decoder.DecodeFrame(3, append([]byte(nil), frame[:10]...))
+		decoder.ReleaseConnection(3)
+		if msgID, msg := decoder.DecodeFrame(3, []byte("link")); msg == nil || msgID != constants.MsgIDLinkHeartbeat {
+			t.Fatalf("释放半包后应按新数据解码: %d %+v", msgID, msg)
+		}
+	})
+}
+
+// gcPauseP99 统计区间内GC停顿的p99（基于 runtime/metrics 直方图差值）
+func gcPauseP99(before, after *metrics.Float64Histogram) time.Duration {
+	var total uint64
+	counts := make([]uint64, len(after.Counts))
+	for i := range after.Counts {
+		counts[i] = after.Counts[i] - before.Counts[i]
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	threshold := total - total/100
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= threshold {
+			return time.Duration(after.Buckets[i+1] * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+func readGCPauses() *metrics.Float64Histogram {
+	sample := []metrics.Sample{{Name: "/sched/pauses/total/gc:seconds"}}
+	metrics.Read(sample)
+	return sample[0].Value.Float64Histogram()
+}
+
+// runDecodeBenchmark 逐帧解码并上报 allocs/frame 与 GC 停顿 p99
+// interval>0 时按固定速率发帧（模拟稳定负载）
+func runDecodeBenchmark(b *testing.B, interval time.Duration) {
+	quietLogger(b)
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	frame := newBenchFrame()
+	readBuf := make([]byte, 4096) // 模拟Zinx复用的读缓冲
+
+	runtime.GC()
+	before := readGCPauses()
+	b.ReportAllocs()
+	b.ResetTimer()
+	next := time.Now()
+	for i := 0; i < b.N; i++ {
+		if interval > 0 {
+			next = next.Add(interval)
+			for time.Now().Before(next) {
+				runtime.Gosched()
+			}
+		}
+		n := copy(readBuf, frame)
+		if _, msg := decoder.DecodeFrame(1, readBuf[:n]); msg == nil {
+			b.Fatal("解码失败")
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(gcPauseP99(before, readGCPauses()).Nanoseconds()), "gc-p99-ns")
+}
+
+// BenchmarkDecodeFrame 接收路径单帧解码开销
+func BenchmarkDecodeFrame(b *testing.B) {
+	runDecodeBenchmark(b, 0)
+}
+
+// BenchmarkDecodeFrameLoad5k 5k帧/秒稳定负载下的解码开销与GC停顿
+func BenchmarkDecodeFrameLoad5k(b *testing.B) {
+	runDecodeBenchmark(b, time.Second/5000)
+}
+
+// BenchmarkParseMultiplePackets 多包分割解析开销
+func BenchmarkParseMultiplePackets(b *testing.B) {
+	quietLogger(b)
+	frame := newBenchFrame()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := protocol.ParseMultiplePackets(frame); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
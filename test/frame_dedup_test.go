@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/framededup"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+)
+
+// TestFrameDedupReplay 配置抑制结算时同一结算帧重发5次：处理器只执行一次（结算只写入一次、未触发存储去重），设备收到5个应答；
+// 连接详情计入4次重复，窗口过后同一帧重新交给处理器；失败应答不缓存，等待重发的帧照常交给处理器
+func TestFrameDedupReplay(t *testing.T) {
+	quietLogger(t)
+	store, err := settlement.Open(config.SettlementStoreConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settlement.SetGlobalStore(store)
+	d := framededup.New(framededup.Options{Window: 30 * time.Second, Commands: []byte{constants.CmdSettlement}})
+	now := time.Now()
+	d.SetClock(func() time.Time { return now })
+	framededup.SetGlobalDeduper(d)
+	t.Cleanup(func() {
+		framededup.SetGlobalDeduper(nil)
+		settlement.SetGlobalStore(nil)
+		_ = store.Close()
+	})
+
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &frameCaptureConn{disconnectTestConn: disconnectTestConn{id: 1766001}}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, "04A26CF3", "04A26CF3", "89860000000000176601"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcpManager.UnregisterConnection(conn.id) })
+	router := framededup.Wrap(uint32(constants.CmdSettlement), &handlers.SettlementHandler{})
+	raw, _ := hex.DecodeString(settlementFrame)
+	replay := func(times int) {
+		for i := 0; i < times; i++ {
+			req := znet.NewRequest(conn, zpack.NewMsgPackage(uint32(constants.CmdSettlement), raw))
+			req.BindRouter(router)
+			req.Call()
+		}
+	}
+
+	replay(5)
+	acks := waitFrames(t, conn, 5, nil)
+	if len(acks) != 5 {
+		t.Fatalf("每次重发都应收到应答: %d", len(acks))
+	}
+	for _, ack := range acks {
+		_, msgID, command, data := frameHeader(ack)
+		if command != constants.CmdSettlement || msgID != 0x0003 || len(data) != 1 || data[0] != constants.StatusSuccess {
+			t.Fatalf("重放的应答应与首次一致: % X", ack)
+		}
+	}
+	if stats := store.Stats(); stats.Records != 1 || stats.Duplicates != 0 {
+		t.Fatalf("结算处理器应只执行一次: %+v", stats)
+	}
+	stats := d.Stats()
+	if stats.Duplicates != 4 || stats.AcksReplayed != 4 || stats.ByCommand["0x03"] != 4 {
+		t.Fatalf("重复帧统计错误: %+v", stats)
+	}
+	detail, err := tcpManager.GetDeviceDetail("04A26CF3")
+	if err != nil || detail["duplicateFrames"] != int64(4) {
+		t.Fatalf("连接详情应计入重复帧: %v %v", detail["duplicateFrames"], err)
+	}
+
+	// 窗口过后同一帧（消息ID回绕）重新交给处理器
+	now = now.Add(31 * time.Second)
+	replay(1)
+	waitFrames(t, conn, 1, nil)
+	if stats := store.Stats(); stats.Duplicates != 1 {
+		t.Fatalf("窗口外的同一帧应重新处理: %+v", stats)
+	}
+
+	// 失败应答（处理器等待设备重发）不缓存：重发帧重新交给处理器
+	key := framededup.Key{PhysicalID: 0x04A26CF3, MessageID: 0x0777, Command: constants.CmdSettlement}
+	if duplicate, _ := d.Check(conn.id, key); duplicate {
+		t.Fatal("首次到达的帧不应视为重复")
+	}
+	d.RecordAck(conn.id, key, []byte{constants.StatusError})
+	if duplicate, ack := d.Check(conn.id, key); duplicate || ack != nil {
+		t.Fatal("应答失败的帧重发时应重新交给处理器")
+	}
+	d.RecordAck(conn.id, key, []byte{constants.StatusSuccess})
+	if duplicate, ack := d.Check(conn.id, key); !duplicate || len(ack) != 1 || ack[0] != constants.StatusSuccess {
+		t.Fatalf("成功应答的帧重发时应重放应答: %v % X", duplicate, ack)
+	}
+
+	// 未参与抑制的命令与关闭抑制时原样交给处理器
+	defaults := framededup.New(framededup.Options{})
+	if defaults.Applies(constants.CmdSettlement) || !defaults.Applies(constants.CmdDeviceRegister) || d.Applies(constants.CmdPowerHeartbeat) {
+		t.Fatal("默认只抑制注册，结算由结算日志存储去重")
+	}
+	framededup.SetGlobalDeduper(nil)
+	replay(1)
+	waitFrames(t, conn, 1, nil)
+	if stats := store.Stats(); stats.Duplicates != 2 {
+		t.Fatalf("关闭抑制后每帧都应交给处理器: %+v", stats)
+	}
+}
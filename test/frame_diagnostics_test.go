@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+// TestFrameDiagnostics 帧诊断（HTTP接口与 dny-parser 共用）测试
+func TestFrameDiagnostics(t *testing.T) {
+	const (
+		locateFrame = "444E590A00F36CA2040100960A9B03"                                                                         // 设备定位（device_locate_test）
+		chargeFrame = "444E592E00CD28A20402008200F203000000013C004F524445525F323032353036313930390000000000000000020000004908" // 充电控制（charging_test）
+		// 校验和字节序写反的充电控制帧
+		swappedChecksumFrame = "444E591D003B37AB04020082001234567812345678123456781234567801000006FE"
+	)
+
+	hasIssue := func(d *protocol.FrameDiagnostics, field string, offset int) bool {
+		for _, issue := range d.Errors {
+			if issue.Field == field && issue.Offset == offset {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("有效帧", func(t *testing.T) {
+		d, err := protocol.DiagnoseHexFrame(locateFrame, "")
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		if !d.Valid || !d.HeaderValid || d.PhysicalID != "04A26CF3" || d.MessageID != "0x0001" || d.Command != "0x96" || d.CommandName == "" {
+			t.Fatalf("定位帧诊断结果错误: %+v", d)
+		}
+		if d.DeclaredLength != 10 || d.ActualLength != 10 || len(d.Checksums) != 2 || !d.Checksums[0].Valid {
+			t.Fatalf("长度或校验和结果错误: %+v", d)
+		}
+
+		d, _ = protocol.DiagnoseHexFrame("44 4E 59 "+chargeFrame[6:], protocol.FrameDirectionDownlink)
+		if !d.Valid || d.PhysicalID != "04A228CD" || d.Command != "0x82" {
+			t.Fatalf("带分隔符的充电帧诊断错误: %+v", d)
+		}
+	})
+
+	t.Run("校验和错误", func(t *testing.T) {
+		d, _ := protocol.DiagnoseHexFrame(swappedChecksumFrame, protocol.FrameDirectionDownlink)
+		if d.Valid || !hasIssue(d, "checksum", d.TotalBytes-2) {
+			t.Fatalf("应在偏移 %d 报告校验和错误: %+v", d.TotalBytes-2, d.Errors)
+		}
+
+		// 仅匹配旧算法（从物理ID累加）的帧
+		d, _ = protocol.DiagnoseHexFrame(locateFrame[:len(locateFrame)-4]+"A602", "")
+		if d.Valid || d.Checksums[0].Valid || !d.Checksums[1].Valid || !hasIssue(d, "checksum", 13) {
+			t.Fatalf("应识别为旧校验算法: %+v", d)
+		}
+	})
+
+	t.Run("截断与包头错误", func(t *testing.T) {
+		d, _ := protocol.DiagnoseHexFrame(chargeFrame[:len(chargeFrame)-10], "")
+		if d.Valid || d.DeclaredLength != 46 || d.ActualLength != 41 || !hasIssue(d, "length", 3) {
+			t.Fatalf("截断帧应报告长度不符: %+v", d)
+		}
+
+		d, _ = protocol.DiagnoseHexFrame("444E58"+locateFrame[6:], "")
+		if d.Valid || d.HeaderValid || !hasIssue(d, "header", 0) {
+			t.Fatalf("应报告包头错误: %+v", d.Errors)
+		}
+	})
+
+	t.Run("输入校验", func(t *testing.T) {
+		if _, err := protocol.DiagnoseHexFrame("444E5", ""); err == nil {
+			t.Fatal("奇数长度应返回错误")
+		}
+		if _, err := protocol.DiagnoseHexFrame("444E59ZZ", ""); err == nil {
+			t.Fatal("非法字符应返回错误")
+		}
+		if _, err := protocol.DiagnoseHexFrame(strings.Repeat("00", protocol.MaxDiagnoseFrameBytes+1), ""); err == nil {
+			t.Fatal("超长输入应返回错误")
+		}
+	})
+
+	t.Run("HTTP接口", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.POST("/api/v1/tools/parse-frame", apihttp.NewToolHandlers().HandleParseFrame)
+		post := func(body string) (int, map[string]interface{}) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tools/parse-frame", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			var resp apihttp.APIResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			data, _ := resp.Data.(map[string]interface{})
+			return w.Code, data
+		}
+
+		code, data := post(`{"hex":"` + swappedChecksumFrame + `","direction":"downlink"}`)
+		if code != http.StatusOK || data["valid"] != false || data["command"] != "0x82" {
+			t.Fatalf("解析接口返回错误: %d %v", code, data)
+		}
+		if code, _ := post(`{"hex":"XYZ"}`); code != http.StatusBadRequest {
+			t.Fatalf("非法输入应返回400，实际 %d", code)
+		}
+		if code, _ := post(`{"hex":"` + strings.Repeat("00", protocol.MaxDiagnoseFrameBytes*2) + `"}`); code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("超长输入应返回413，实际 %d", code)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
+)
+
+func journalEntry(deviceID, key string) journal.Entry {
+	payload := make([]byte, 35)
+	payload[0] = 0x3C // 充电时长60秒
+	return journal.Entry{
+		Key:        key,
+		Command:    constants.CmdSettlement,
+		DeviceID:   deviceID,
+		PhysicalID: 0x04A26CF3,
+		MessageID:  0x0102,
+		Payload:    payload,
+		ConnID:     1650,
+		RemoteAddr: "10.0.0.1:40000",
+	}
+}
+
+// TestFrameJournal 关键帧预写日志：崩溃重放、幂等保护、轮转压缩与降级告警
+func TestFrameJournal(t *testing.T) {
+	t.Run("崩溃后重放", func(t *testing.T) {
+		cfg := config.FrameJournalConfig{Enabled: true, Dir: t.TempDir(), Commands: []int{constants.CmdSettlement}}
+		j, err := journal.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !j.IsCritical(constants.CmdSettlement) || j.IsCritical(constants.CmdHeartbeat) {
+			t.Fatal("关键帧命令判定错误")
+		}
+		// 已应答但下游交接前崩溃：两条同一幂等键（设备重发）均未标记
+		if _, err := j.Append(journalEntry("04A26CF3", "k1")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := j.Append(journalEntry("04A26CF3", "k1")); err != nil {
+			t.Fatal(err)
+		}
+		_ = j.Close()
+
+		j, err = journal.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(j.Pending()); n != 2 {
+			t.Fatalf("重启后应有2条未处理条目: %d", n)
+		}
+		handled := 0
+		result := j.Replay(func(entry journal.Entry) error {
+			handled++
+			return nil
+		})
+		if handled != 1 || result.Replayed != 1 || result.Duplicate != 1 || result.Failed != 0 {
+			t.Fatalf("重放结果错误: handled=%d %+v", handled, result)
+		}
+		_ = j.Close()
+
+		j, err = journal.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		if n := len(j.Pending()); n != 0 {
+			t.Fatalf("重放后不应再有未处理条目: %d", n)
+		}
+		if !j.IsProcessed("k1") {
+			t.Fatal("重启后应保留已处理幂等键")
+		}
+	})
+
+	t.Run("经结算处理器重放", func(t *testing.T) {
+		cfg := config.FrameJournalConfig{Enabled: true, Dir: t.TempDir(), Commands: []int{constants.CmdSettlement}}
+		j, err := journal.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		if _, err := j.Append(journalEntry("04A26CF3", "settle-1")); err != nil {
+			t.Fatal(err)
+		}
+		bad := journalEntry("04A26CF3", "settle-2")
+		bad.Payload = bad.Payload[:10]
+		if _, err := j.Append(bad); err != nil {
+			t.Fatal(err)
+		}
+		result := handlers.ReplayFrameJournal(j)
+		if result.Replayed != 1 || result.Failed != 1 {
+			t.Fatalf("结算重放结果错误: %+v", result)
+		}
+		if !j.IsProcessed("settle-1") || j.IsProcessed("settle-2") {
+			t.Fatal("解析失败的条目应保留待下次启动")
+		}
+	})
+
+	t.Run("轮转与压缩", func(t *testing.T) {
+		cfg := config.FrameJournalConfig{Enabled: true, Dir: t.TempDir(), Commands: []int{constants.CmdSettlement}, SegmentMaxBytes: 1024}
+		j, err := journal.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		first, _ := j.Append(journalEntry("04A26CF3", "keep"))
+		for i := 0; i < 10; i++ {
+			entry, err := j.Append(journalEntry("04A26CF3", ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = j.MarkProcessed(entry.ID)
+		}
+		if s := j.Stats(); s.Segments < 3 || s.Pending != 1 {
+			t.Fatalf("应轮转出多个段且仅剩1条未处理: %+v", s)
+		}
+		_ = j.MarkProcessed(first.ID)
+		if s := j.Stats(); s.Pending != 0 || s.Processed != 11 {
+			t.Fatalf("标记统计错误: %+v", s)
+		}
+	})
+
+	t.Run("超过上限降级告警", func(t *testing.T) {
+		cfg := config.FrameJournalConfig{Enabled: true, Dir: t.TempDir(), Commands: []int{constants.CmdSettlement}, SegmentMaxBytes: 1024, MaxTotalBytes: 4096}
+		j, err := journal.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		alerts := make(chan journal.Alert, 4)
+		j.RegisterAlertHandler(func(alert journal.Alert) { alerts <- alert })
+
+		var ids []string
+		for i := 0; i < 100; i++ {
+			entry, err := j.Append(journalEntry("04A26CF3", ""))
+			if errors.Is(err, journal.ErrJournalFull) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, entry.ID)
+		}
+		if !j.IsDegraded() {
+			t.Fatal("未处理条目超过上限后应降级")
+		}
+		if _, err := j.Append(journalEntry("04A26CF3", "")); !errors.Is(err, journal.ErrJournalDegraded) {
+			t.Fatalf("降级期间应返回 ErrJournalDegraded: %v", err)
+		}
+		select {
+		case alert := <-alerts:
+			if alert.Type != journal.AlertDegraded || alert.Pending != len(ids) {
+				t.Fatalf("降级告警错误: %+v", alert)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("降级后应触发告警")
+		}
+
+		// 下游交接完成释放空间后恢复预写
+		for _, id := range ids {
+			_ = j.MarkProcessed(id)
+		}
+		if _, err := j.Append(journalEntry("04A26CF3", "")); err != nil {
+			t.Fatalf("空间释放后应恢复预写: %v", err)
+		}
+		select {
+		case alert := <-alerts:
+			if alert.Type != journal.AlertRecovered {
+				t.Fatalf("恢复告警错误: %+v", alert)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("恢复后应触发告警")
+		}
+		if s := j.Stats(); s.Degraded || s.Degradations != 1 {
+			t.Fatalf("降级统计错误: %+v", s)
+		}
+	})
+}
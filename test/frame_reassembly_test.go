@@ -0,0 +1,179 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// TestDNYFrameReassembly TCP流拆包/粘包：逐字节到达的帧在最后一个字节时完整解出；
+// 一次读取含多个报文时逐个按到达顺序分发；同步后报文之间的杂散数据跳过并计数；
+// 经解码器责任链时粘包中的后续报文以重新注入的请求逐个交给处理器，单次读取最多重新注入64个
+func TestDNYFrameReassembly(t *testing.T) {
+	quietLogger(t)
+	builder := protocol.NewUnifiedDNYBuilder()
+	const pid = 0x04A27156
+	settlement := builder.BuildDNYPacket(pid, 0x1756, constants.CmdSettlement, make([]byte, 37))
+	heartbeat := builder.BuildDNYPacket(pid, 0x1757, constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x02, 0x00, 0x00, 0x1F, 0x20})
+
+	newDecoder := func(t *testing.T, connID uint64) (*protocol.DNY_Decoder, *protocol.GarbageTracker) {
+		t.Helper()
+		decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+		tracker := protocol.NewGarbageTracker(protocol.GarbageOptions{})
+		decoder.SetGarbageTracker(tracker)
+		t.Cleanup(func() { decoder.ReleaseConnection(connID) })
+		return decoder, tracker
+	}
+	expectStandard := func(t *testing.T, msg *dny_protocol.Message, messageID uint16, command byte) {
+		t.Helper()
+		if msg == nil || msg.MessageType != "standard" || msg.MessageId != messageID || msg.CommandId != uint32(command) {
+			t.Fatalf("应解出命令 0x%02X 消息ID 0x%04X，实际 %+v", command, messageID, msg)
+		}
+	}
+
+	t.Run("逐字节到达", func(t *testing.T) {
+		const connID = 1756001
+		decoder, _ := newDecoder(t, connID)
+		for i, b := range settlement {
+			_, msg := decoder.DecodeFrame(connID, []byte{b})
+			if i < len(settlement)-1 {
+				if msg != nil {
+					t.Fatalf("第 %d 字节不应解出报文: %+v", i, msg)
+				}
+				continue
+			}
+			expectStandard(t, msg, 0x1756, constants.CmdSettlement)
+			if len(msg.RawData) != len(settlement) {
+				t.Fatalf("重组后的帧长度错误: %d != %d", len(msg.RawData), len(settlement))
+			}
+		}
+		if decoder.PendingFrameReady(connID) {
+			t.Fatal("帧取出后缓存中不应还有完整报文")
+		}
+	})
+
+	t.Run("link心跳与DNY帧同一次读取", func(t *testing.T) {
+		const connID = 1756002
+		decoder, _ := newDecoder(t, connID)
+		wire := append([]byte("link"), settlement...)
+		_, msg := decoder.DecodeFrame(connID, wire)
+		if msg == nil || msg.MessageType != "heartbeat_link" {
+			t.Fatalf("首个报文应为link心跳，实际 %+v", msg)
+		}
+		if !decoder.PendingFrameReady(connID) {
+			t.Fatal("link之后的DNY帧应缓存待分发")
+		}
+		_, msg = decoder.DecodeFrame(connID, nil)
+		expectStandard(t, msg, 0x1756, constants.CmdSettlement)
+		if decoder.PendingFrameReady(connID) {
+			t.Fatal("DNY帧分发后不应还有待分发报文")
+		}
+	})
+
+	t.Run("多帧与尾部半包", func(t *testing.T) {
+		const connID = 1756003
+		decoder, _ := newDecoder(t, connID)
+		half := len(settlement) / 2
+		wire := append(append(append([]byte("link"), settlement...), heartbeat...), settlement[:half]...)
+		_, msg := decoder.DecodeFrame(connID, wire)
+		if msg == nil || msg.MessageType != "heartbeat_link" {
+			t.Fatalf("首个报文应为link心跳，实际 %+v", msg)
+		}
+		_, msg = decoder.DecodeFrame(connID, nil)
+		expectStandard(t, msg, 0x1756, constants.CmdSettlement)
+		_, msg = decoder.DecodeFrame(connID, nil)
+		expectStandard(t, msg, 0x1757, constants.CmdDeviceHeart)
+		if decoder.PendingFrameReady(connID) {
+			t.Fatal("尾部半包不应视为完整报文")
+		}
+		_, msg = decoder.DecodeFrame(connID, settlement[half:])
+		expectStandard(t, msg, 0x1756, constants.CmdSettlement)
+	})
+
+	t.Run("报文之间的杂散数据", func(t *testing.T) {
+		const connID = 1756004
+		decoder, tracker := newDecoder(t, connID)
+		_, msg := decoder.DecodeFrame(connID, heartbeat)
+		expectStandard(t, msg, 0x1757, constants.CmdDeviceHeart)
+		garbage := []byte("+++ATH\r\n")
+		_, msg = decoder.DecodeFrame(connID, append(append([]byte{}, garbage...), settlement...))
+		expectStandard(t, msg, 0x1756, constants.CmdSettlement)
+		stats, ok := tracker.Get(connID)
+		if !ok || stats.StreamBytes != len(garbage) || stats.PreambleBytes != 0 {
+			t.Fatalf("报文之间的杂散数据应计入 stream_bytes: %+v", stats)
+		}
+	})
+
+	expectHandled := func(t *testing.T, handled []*dny_protocol.Message, messageIDs ...uint16) {
+		t.Helper()
+		if len(handled) != len(messageIDs) {
+			t.Fatalf("处理器应收到 %d 个报文，实际 %d 个", len(messageIDs), len(handled))
+		}
+		for i, msg := range handled {
+			if msg.MessageType != "standard" || msg.MessageId != messageIDs[i] {
+				t.Fatalf("第 %d 个报文应为消息ID 0x%04X，实际 %+v", i, messageIDs[i], msg)
+			}
+		}
+	}
+
+	t.Run("责任链分发粘包与拆包", func(t *testing.T) {
+		decoder, _ := newDecoder(t, 1756005)
+		conn := newInterceptConn(1756005, decoder)
+		half := len(settlement) / 2
+
+		// 一次读取：link心跳 + 结算帧 + 心跳帧 + 结算帧前半
+		conn.read(append(append(append([]byte("link"), settlement...), heartbeat...), settlement[:half]...))
+		handled, executed := conn.handler.take()
+		if executed != 3 || len(handled) != 3 || handled[0].MessageType != "heartbeat_link" {
+			t.Fatalf("首个报文随读取分发，其后两个完整帧各重新注入一次: executed=%d handled=%+v", executed, handled)
+		}
+		expectHandled(t, handled[1:], 0x1756, 0x1757)
+		if decoder.PendingFrameReady(conn.id) {
+			t.Fatal("尾部半包不应分发")
+		}
+
+		// 下一次读取补齐后半：不需要重新注入
+		conn.read(settlement[half:])
+		handled, executed = conn.handler.take()
+		if executed != 1 {
+			t.Fatalf("补齐半包的读取不应重新注入请求: executed=%d", executed)
+		}
+		expectHandled(t, handled, 0x1756)
+	})
+
+	t.Run("单次读取的重新注入上限", func(t *testing.T) {
+		decoder, _ := newDecoder(t, 1756006)
+		conn := newInterceptConn(1756006, decoder)
+		const frames = 70
+		var wire []byte
+		messageIDs := make([]uint16, frames)
+		for i := range messageIDs {
+			messageIDs[i] = uint16(0x2000 + i)
+			wire = append(wire, builder.BuildDNYPacket(pid, messageIDs[i], constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x02, 0x00, 0x00, 0x1F, 0x20})...)
+		}
+		tail := builder.BuildDNYPacket(pid, 0x2100, constants.CmdDeviceHeart, []byte{0xDC, 0x00, 0x02, 0x00, 0x00, 0x1F, 0x20})
+
+		conn.read(wire)
+		handled, executed := conn.handler.take()
+		if executed != 1+64 {
+			t.Fatalf("单次读取最多重新注入64个缓存报文: executed=%d", executed)
+		}
+		expectHandled(t, handled, messageIDs[:65]...)
+		if !decoder.PendingFrameReady(conn.id) {
+			t.Fatal("超出上限的报文应留在缓存中")
+		}
+
+		// 下一次读取先分发缓存中剩余的报文，再分发新到达的帧，保持到达顺序
+		conn.read(tail)
+		handled, executed = conn.handler.take()
+		if executed != 6 {
+			t.Fatalf("剩余5个缓存报文与新帧应依次分发: executed=%d", executed)
+		}
+		expectHandled(t, handled, append(append([]uint16{}, messageIDs[65:]...), 0x2100)...)
+		if decoder.PendingFrameReady(conn.id) {
+			t.Fatal("全部分发后缓存中不应还有完整报文")
+		}
+	})
+}
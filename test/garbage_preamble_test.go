@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+const garbageTestICCID = "89860404192080617692"
+
+// 现场抓包的路由器PPP重拨前导杂散数据
+var capturedPreambles = [][]byte{
+	[]byte("\r\nNO CARRIER\r\n"),
+	[]byte("AT+CGATT?\r\n+CGATT: 1\r\n\r\nOK\r\n"),
+	[]byte("ATE0\r\nOK\r\nAT+CSQ\r\n+CSQ: 23,99\r\n\r\nOK\r\n"),
+	[]byte("\x00\x00\xff\xfe\r\n+PPPD: CONNECT\r\n"),
+	[]byte("~\xff}#\xc0!}!}!} }4}\"}&} } } } }%}&\r\n"),
+}
+
+func newGarbageDecoder(budget int) (*protocol.DNY_Decoder, *protocol.GarbageTracker) {
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	tracker := protocol.NewGarbageTracker(protocol.GarbageOptions{BudgetBytes: budget})
+	decoder.SetGarbageTracker(tracker)
+	return decoder, tracker
+}
+
+// TestGarbagePreambleCaptured 现场前导杂散数据后紧跟ICCID：跳过并计数，ICCID不丢失；拆包时等待后续数据
+func TestGarbagePreambleCaptured(t *testing.T) {
+	decoder, tracker := newGarbageDecoder(256)
+	for i, noise := range capturedPreambles {
+		connID := uint64(1657000 + i)
+		raw := append(append([]byte{}, noise...), garbageTestICCID...)
+		msgID, msg := decoder.DecodeFrame(connID, raw)
+		if msg == nil || msgID != constants.MsgIDICCID || msg.ICCIDValue != garbageTestICCID {
+			t.Fatalf("前导 %q 后应解析出ICCID: %+v", noise, msg)
+		}
+		if st, _ := tracker.Get(connID); st.PreambleBytes != len(noise) || st.Events != 1 || !st.Synced {
+			t.Fatalf("前导 %q 计数错误: %+v", noise, st)
+		}
+		decoder.ReleaseConnection(connID)
+	}
+
+	// 杂散数据与被拆开的ICCID分两次到达
+	const connID = 1657100
+	if _, msg := decoder.DecodeFrame(connID, append(append([]byte{}, capturedPreambles[1]...), garbageTestICCID[:9]...)); msg != nil {
+		t.Fatalf("ICCID不完整时不应返回消息: %+v", msg)
+	}
+	if _, msg := decoder.DecodeFrame(connID, []byte(garbageTestICCID[9:])); msg == nil || msg.ICCIDValue != garbageTestICCID {
+		t.Fatalf("拼接后应解析出ICCID: %+v", msg)
+	}
+
+	// 同步后报文间的杂散字节计为独立的一段，连接出现在诊断中
+	frame := protocol.NewUnifiedDNYBuilder().BuildDNYPacket(0x04A2715A, 1, constants.CmdDeviceHeart, make([]byte, 4))
+	if _, msg := decoder.DecodeFrame(connID, append([]byte("\r\nOK\r\n"), frame...)); msg == nil || msg.MessageType != "standard" {
+		t.Fatalf("杂散字节后应解析出DNY帧: %+v", msg)
+	}
+	st, _ := tracker.Get(connID)
+	if st.StreamBytes != 6 || st.Events != 2 {
+		t.Fatalf("报文间杂散字节计数错误: %+v", st)
+	}
+	decoder.ReleaseConnection(connID)
+	report := tracker.Report(2)
+	if len(report.Connections) != 1 || report.Connections[0].ConnID != connID || report.Connections[0].Active {
+		t.Fatalf("多次出现杂散数据的连接应出现在诊断中: %+v", report.Connections)
+	}
+}
+
+// TestGarbagePreambleBudget 前导杂散数据超过预算后放弃连接，后续有效数据不再解析
+func TestGarbagePreambleBudget(t *testing.T) {
+	decoder, tracker := newGarbageDecoder(32)
+	const connID = 1657200
+	if _, msg := decoder.DecodeFrame(connID, bytes.Repeat([]byte("AT\r\n"), 5)); msg != nil || tracker.Exceeded(connID) {
+		t.Fatal("预算内的杂散数据不应放弃连接")
+	}
+	if _, msg := decoder.DecodeFrame(connID, bytes.Repeat([]byte("AT\r\n"), 5)); msg != nil || !tracker.Exceeded(connID) {
+		t.Fatal("累计超过预算应标记放弃")
+	}
+	if _, msg := decoder.DecodeFrame(connID, []byte(garbageTestICCID)); msg != nil {
+		t.Fatal("放弃后的连接不应再解析数据")
+	}
+	if report := tracker.Report(0); report.ExceededConnections != 1 || report.TotalPreambleBytes != 40 || len(report.Connections) != 1 {
+		t.Fatalf("诊断统计错误: %+v", report)
+	}
+}
+
+// TestGarbagePreambleFuzz 随机前导杂散数据（以CRLF结尾，与AT回显一致）后跟有效报文，按随机位置拆包
+func TestGarbagePreambleFuzz(t *testing.T) {
+	rng := rand.New(rand.NewSource(1657))
+	builder := protocol.NewUnifiedDNYBuilder()
+	decoder, tracker := newGarbageDecoder(512)
+
+	for i := 0; i < 500; i++ {
+		noise := make([]byte, 1+rng.Intn(200))
+		rng.Read(noise)
+		noise = append(noise, '\r', '\n')
+		if bytes.Contains(noise, []byte("DNY")) || bytes.Contains(noise, []byte("link")) {
+			continue
+		}
+
+		var valid []byte
+		wantType := "iccid"
+		switch i % 3 {
+		case 0:
+			valid = []byte(garbageTestICCID)
+		case 1:
+			valid, wantType = []byte("link"), "heartbeat_link"
+		default:
+			valid, wantType = builder.BuildDNYPacket(uint32(0x04A20000+i), uint16(i), constants.CmdDeviceHeart, make([]byte, 4)), "standard"
+		}
+		raw := append(noise, valid...)
+
+		connID := uint64(1657300 + i)
+		split := 1 + rng.Intn(len(raw)-1)
+		_, msg := decoder.DecodeFrame(connID, raw[:split])
+		if msg == nil {
+			_, msg = decoder.DecodeFrame(connID, raw[split:])
+		}
+		if msg == nil || msg.MessageType != wantType {
+			t.Fatalf("第%d组（拆包位置%d）未解析出%s: % X", i, split, wantType, raw)
+		}
+		if st, _ := tracker.Get(connID); st.PreambleBytes != len(noise) {
+			t.Fatalf("第%d组前导计数错误: 期望 %d 实际 %d", i, len(noise), st.PreambleBytes)
+		}
+		decoder.ReleaseConnection(connID)
+	}
+}
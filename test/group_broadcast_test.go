@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/gin-gonic/gin"
+)
+
+// registerSharedGroup 在同一连接上注册共享ICCID的多台从机
+func registerSharedGroup(t testing.TB, connID uint64, iccid string, deviceIDs []string) *frameCaptureConn {
+	t.Helper()
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &frameCaptureConn{disconnectTestConn: disconnectTestConn{id: connID}}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	for _, deviceID := range deviceIDs {
+		if err := tcpManager.RegisterDevice(conn, deviceID, deviceID, iccid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { _ = tcpManager.UnregisterConnection(connID) })
+	return conn
+}
+
+// waitFrames 等待连接上累计写入n帧
+func waitFrames(t *testing.T, conn *frameCaptureConn, n int, got [][]byte) [][]byte {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(got) < n && time.Now().Before(deadline) {
+		got = append(got, conn.take()...)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(got) < n {
+		t.Fatalf("应下发%d帧，实际%d帧", n, len(got))
+	}
+	return got
+}
+
+// frameHeader 解析DNY帧头：物理ID、消息ID、命令、载荷
+func frameHeader(frame []byte) (uint32, uint16, byte, []byte) {
+	return binary.LittleEndian.Uint32(frame[5:9]), binary.LittleEndian.Uint16(frame[9:11]), frame[11], frame[12 : len(frame)-2]
+}
+
+// TestGroupBroadcastAcks 5台共享连接的从机：逐台替换物理ID连续下发，统一跟踪应答；广播中加入的设备不在其内，广播中断开的设备记为skipped
+func TestGroupBroadcastAcks(t *testing.T) {
+	const iccid = "89860400000016890001"
+	deviceIDs := []string{"04B16891", "04B16892", "04B16893", "04B16894", "04B16895"}
+	conn := registerSharedGroup(t, 1689001, iccid, deviceIDs)
+	g := gateway.GetGlobalDeviceGateway()
+	g.GetGroupBroadcasts().SetSendInterval(100 * time.Millisecond)
+
+	start := time.Now()
+	b, err := g.BroadcastToGroup(gateway.GroupBroadcastRequest{ICCID: iccid, Type: gateway.GroupBroadcastPowerParams, MaxChargeTime: 36000, OverloadPower: 2200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Devices) != 5 || b.Counts[gateway.BroadcastDevicePending] != 5 || !b.AckExpected {
+		t.Fatalf("广播应覆盖开始时的5台设备: %+v", b)
+	}
+	// 广播进行中加入设备组的设备不在本次广播内
+	if err := core.GetGlobalTCPManager().RegisterDevice(conn, "04B16896", "04B16896", iccid); err != nil {
+		t.Fatal(err)
+	}
+
+	// 前3台应答；第4帧下发后连接断开，未应答与未下发的设备均记为skipped
+	var frames [][]byte
+	for i := 0; i < 4; i++ {
+		frames = waitFrames(t, conn, i+1, frames)
+		physicalID, msgID, cmd, payload := frameHeader(frames[i])
+		if want := fmt.Sprintf("%08X", physicalID); want != deviceIDs[i] || cmd != constants.CmdMaxTimeAndPower {
+			t.Fatalf("第%d帧物理ID或命令错误: %s 0x%02X", i+1, want, cmd)
+		}
+		if binary.LittleEndian.Uint16(payload[0:2]) != 36000 || binary.LittleEndian.Uint16(payload[2:4]) != 2200 {
+			t.Fatalf("载荷错误: %X", payload)
+		}
+		if i < 3 {
+			network.GetCommandManager().ConfirmCommand(physicalID, msgID, cmd)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("共享连接上的帧应按节奏下发: %s", elapsed)
+	}
+	_ = core.GetGlobalTCPManager().UnregisterConnection(conn.id)
+
+	result, ok := g.GetGroupBroadcasts().Wait(iccid, b.ID, 3*time.Second)
+	if !ok || result.Status != gateway.GroupBroadcastStatusCompleted {
+		t.Fatalf("广播应结束: %+v", result)
+	}
+	want := []string{gateway.BroadcastDeviceAcked, gateway.BroadcastDeviceAcked, gateway.BroadcastDeviceAcked, gateway.BroadcastDeviceSkipped, gateway.BroadcastDeviceSkipped}
+	for i, d := range result.Devices {
+		if d.DeviceID != deviceIDs[i] || d.Status != want[i] {
+			t.Fatalf("设备%d状态错误: %+v", i+1, d)
+		}
+	}
+	if len(result.Devices) != 5 || result.Counts[gateway.BroadcastDeviceAcked] != 3 || result.Counts[gateway.BroadcastDeviceSkipped] != 2 {
+		t.Fatalf("汇总错误: %+v", result.Counts)
+	}
+	if result.Devices[3].SentAt == nil || result.Devices[4].SentAt != nil {
+		t.Fatalf("第4台已下发、第5台未下发: %+v", result.Devices)
+	}
+	if frames := append(frames, conn.take()...); len(frames) != 4 {
+		t.Fatalf("断开后不应继续下发: %d", len(frames))
+	}
+}
+
+// TestGroupBroadcastAPI 经API触发time-sync广播并查询汇总；rate-push与无设备的组被拒绝
+func TestGroupBroadcastAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const iccid = "89860400000016890002"
+	deviceIDs := []string{"04B16881", "04B16882", "04B16883", "04B16884", "04B16885"}
+	conn := registerSharedGroup(t, 1689002, iccid, deviceIDs)
+	gateway.GetGlobalDeviceGateway().GetGroupBroadcasts().SetSendInterval(20 * time.Millisecond)
+
+	h := apihttp.NewDeviceHandlers()
+	r := gin.New()
+	r.POST("/api/v1/device-groups/:iccid/broadcasts", h.HandleGroupBroadcast)
+	r.GET("/api/v1/device-groups/:iccid/broadcasts/:id", h.HandleGroupBroadcastStatus)
+	do := func(method, path, body string) (int, gateway.GroupBroadcast) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp struct {
+			Data gateway.GroupBroadcast `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	before := time.Now().Unix()
+	code, b := do(http.MethodPost, "/api/v1/device-groups/"+iccid+"/broadcasts", `{"type":"time-sync","wait":5}`)
+	if code != http.StatusAccepted || b.Status != gateway.GroupBroadcastStatusCompleted || b.Counts[gateway.BroadcastDeviceSent] != 5 {
+		t.Fatalf("time-sync广播失败: %d %+v", code, b)
+	}
+	frames := conn.take()
+	if len(frames) != 5 {
+		t.Fatalf("应逐台下发5帧: %d", len(frames))
+	}
+	for i, frame := range frames {
+		physicalID, _, cmd, payload := frameHeader(frame)
+		ts := int64(binary.LittleEndian.Uint32(payload))
+		if fmt.Sprintf("%08X", physicalID) != deviceIDs[i] || cmd != constants.CmdDeviceTime || ts < before || ts > time.Now().Unix() {
+			t.Fatalf("第%d帧错误: %X", i+1, frame)
+		}
+	}
+
+	if code, got := do(http.MethodGet, "/api/v1/device-groups/"+iccid+"/broadcasts/"+b.ID, ""); code != http.StatusOK || got.ID != b.ID || len(got.Devices) != 5 {
+		t.Fatalf("查询广播失败: %d %+v", code, got)
+	}
+	if code, _ := do(http.MethodGet, "/api/v1/device-groups/89860400000016899999/broadcasts/"+b.ID, ""); code != http.StatusNotFound {
+		t.Fatalf("其他设备组不应查到该广播: %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/device-groups/"+iccid+"/broadcasts", `{"type":"rate-push"}`); code != http.StatusBadRequest {
+		t.Fatalf("rate-push 应返回400: %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/device-groups/"+iccid+"/broadcasts", `{"type":"power-params","overloadPower":0}`); code != http.StatusBadRequest {
+		t.Fatalf("参数非法应返回400: %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/device-groups/89860400000016899999/broadcasts", `{"type":"time-sync"}`); code != http.StatusNotFound {
+		t.Fatalf("无设备的组应返回404: %d", code)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// TestDeviceGroupCompaction 设备组膨胀后收缩：按实际大小重建映射且不丢失存活条目，小组与已重建的组不重复处理
+func TestDeviceGroupCompaction(t *testing.T) {
+	tm := core.NewTCPManager(nil)
+	tm.SetGroupCompactionConfig(&core.GroupCompactionConfig{Enabled: true, MinPeak: 32, ShrinkRatio: 0.25})
+	register := func(connID uint64, iccid string, count int) []string {
+		conn := &indexCheckConn{id: connID}
+		if _, err := tm.RegisterConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			id := fmt.Sprintf("04%02X%04X", connID, i)
+			if err := tm.RegisterDevice(conn, id, id, iccid); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	const bigICCID, smallICCID = "89860000000000001683", "89860000000000001684"
+	ids := register(1, bigICCID, 180)
+	register(2, smallICCID, 8)
+
+	value, _ := tm.GetDeviceGroups().Load(bigICCID)
+	group := value.(*core.DeviceGroup)
+	before := reflect.ValueOf(group.Devices).Pointer()
+
+	// 清理幽灵设备，只保留10台
+	live, departed := ids[:10], ids[10:]
+	group.Lock()
+	for _, id := range departed {
+		delete(group.Devices, id)
+		tm.GetDeviceIndex().Delete(id)
+	}
+	group.Unlock()
+	smallValue, _ := tm.GetDeviceGroups().Load(smallICCID)
+	smallBefore := reflect.ValueOf(smallValue.(*core.DeviceGroup).Devices).Pointer()
+
+	result := tm.CompactDeviceGroups()
+	if result.GroupsScanned != 2 || result.GroupsCompacted != 1 || result.MapsRebuilt != 1 || result.EntriesAtPeak != 180 || result.LiveEntries != 10 {
+		t.Fatalf("压缩结果错误: %+v", result)
+	}
+	group.RLock()
+	after, count := reflect.ValueOf(group.Devices).Pointer(), len(group.Devices)
+	group.RUnlock()
+	if after == before || count != len(live) {
+		t.Fatalf("应重建为新映射且保留全部存活条目: rebuilt=%v count=%d", after != before, count)
+	}
+	for _, id := range live {
+		if d, ok := tm.GetDeviceByID(id); !ok || d.DeviceID != id {
+			t.Fatalf("存活设备 %s 在重建后丢失", id)
+		}
+	}
+	if reflect.ValueOf(smallValue.(*core.DeviceGroup).Devices).Pointer() != smallBefore {
+		t.Fatal("峰值未达 minPeak 的小组不应重建")
+	}
+
+	// 峰值已重置为当前条目数，再次执行不重复重建；重建后新增设备正常写入
+	if again := tm.CompactDeviceGroups(); again.GroupsCompacted != 0 || again.HeapBefore != 0 {
+		t.Fatalf("无候选时不应重建或采样: %+v", again)
+	}
+	conn := &indexCheckConn{id: 1}
+	if err := tm.RegisterDevice(conn, "04FF0001", "04FF0001", bigICCID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tm.GetDeviceByID("04FF0001"); !ok {
+		t.Fatal("重建后的映射应可继续写入")
+	}
+
+	stats := tm.GetGroupCompactionStats()
+	if stats.Runs != 2 || stats.GroupsCompacted != 1 || stats.EntriesAtPeak != 180 || len(stats.TopLevel) != 3 {
+		t.Fatalf("统计错误: %+v", stats)
+	}
+	for _, m := range stats.TopLevel {
+		if m.Name == "device_index" && (m.Live != 19 || m.Stores != 189) {
+			t.Fatalf("设备索引计数错误: %+v", m)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apigrpc "github.com/bujia-iot/iot-zinx/internal/adapter/grpc"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/grpcapi"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// TestGRPCMatchesHTTP gRPC接口与HTTP接口共用实现：同一请求的状态、业务码、消息与数据一致；鉴权、指标与变更记录同样生效
+func TestGRPCMatchesHTTP(t *testing.T) {
+	const sharedKey = "grpc-test-key"
+	l := changelog.NewLog(changelog.Options{})
+	changelog.SetGlobalLog(l)
+	defer changelog.SetGlobalLog(nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(apihttp.CorrelationIDMiddleware(), apihttp.ChangeLogMiddleware())
+	router.RegisterUnifiedAPIHandlers(r)
+
+	srv := apigrpc.NewServer(r, apigrpc.Options{SharedKey: sharedKey})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	conn, err := grpc.NewClient("passthrough:///"+ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	devices := grpcapi.NewDeviceQueryClient(conn)
+	charging := grpcapi.NewChargeControlClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	authed := func() context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+sharedKey, "x-api-key-name", "order-service")
+	}
+
+	callHTTP := func(method, path, body string) *grpcapi.Result {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Code    int32           `json:"code"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: 响应解析失败: %s", method, path, w.Body.String())
+		}
+		result := &grpcapi.Result{HttpStatus: int32(w.Code), Code: resp.Code, Message: resp.Message}
+		if len(resp.Data) > 0 && string(resp.Data) != "null" {
+			result.Data = &structpb.Value{}
+			if err := protojson.Unmarshal(resp.Data, result.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return result
+	}
+	fromGRPC := func(result *grpcapi.Result, err error) (*grpcapi.Result, codes.Code) {
+		t.Helper()
+		if err == nil {
+			return result, codes.OK
+		}
+		st := status.Convert(err)
+		for _, d := range st.Details() {
+			if res, ok := d.(*grpcapi.Result); ok {
+				return res, st.Code()
+			}
+		}
+		t.Fatalf("错误应附带Result详情: %v", err)
+		return nil, st.Code()
+	}
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		call       func() (*grpcapi.Result, error)
+		wantStatus int32
+		wantCode   codes.Code
+	}{
+		{"设备详情-离线", http.MethodGet, "/api/v1/device/04A26CF3/status", "",
+			func() (*grpcapi.Result, error) {
+				return devices.GetDevice(authed(), &grpcapi.GetDeviceRequest{DeviceId: "04A26CF3"})
+			}, 404, codes.NotFound},
+		{"设备详情-ID格式错误", http.MethodGet, "/api/v1/device/xyz/status", "",
+			func() (*grpcapi.Result, error) {
+				return devices.GetDevice(authed(), &grpcapi.GetDeviceRequest{DeviceId: "xyz"})
+			}, 400, codes.InvalidArgument},
+		{"设备列表", http.MethodGet, "/api/v1/devices?stationId=S1", "",
+			func() (*grpcapi.Result, error) {
+				return devices.ListDevices(authed(), &grpcapi.ListDevicesRequest{StationId: "S1"})
+			}, 200, codes.OK},
+		{"端口状态-离线", http.MethodGet, "/api/v1/device/04A26CF3/ports", "",
+			func() (*grpcapi.Result, error) {
+				return devices.GetPortStatus(authed(), &grpcapi.GetPortStatusRequest{DeviceId: "04A26CF3"})
+			}, 404, codes.NotFound},
+		{"开始充电-缺少订单号", http.MethodPost, "/api/v1/charging/start", `{"deviceId":"04A26CF3","port":1,"value":60}`,
+			func() (*grpcapi.Result, error) {
+				return charging.StartCharging(authed(), &grpcapi.StartChargingRequest{DeviceId: "04A26CF3", Port: 1, Value: 60})
+			}, 400, codes.InvalidArgument},
+		{"开始充电-设备离线", http.MethodPost, "/api/v1/charging/start", `{"deviceId":"04A26CF3","port":1,"value":60,"orderNo":"ORDER_GRPC_001"}`,
+			func() (*grpcapi.Result, error) {
+				return charging.StartCharging(authed(), &grpcapi.StartChargingRequest{DeviceId: "04A26CF3", Port: 1, Value: 60, OrderNo: "ORDER_GRPC_001"})
+			}, 503, codes.Unavailable},
+		{"停止充电-设备离线", http.MethodPost, "/api/v1/charging/stop", `{"deviceId":"04A26CF3","port":1,"orderNo":"ORDER_GRPC_001"}`,
+			func() (*grpcapi.Result, error) {
+				return charging.StopCharging(authed(), &grpcapi.StopChargingRequest{DeviceId: "04A26CF3", Port: 1, OrderNo: "ORDER_GRPC_001"})
+			}, 503, codes.Unavailable},
+		{"调整功率-无进行中订单", http.MethodPost, "/api/v1/charging/update_power", `{"deviceId":"04A26CF3","port":1,"orderNo":"ORDER_GRPC_001","overloadPowerW":120}`,
+			func() (*grpcapi.Result, error) {
+				return charging.UpdateChargingPower(authed(), &grpcapi.UpdateChargingPowerRequest{DeviceId: "04A26CF3", Port: 1, OrderNo: "ORDER_GRPC_001", OverloadPowerW: 120})
+			}, 404, codes.NotFound},
+		{"充电会话", http.MethodGet, "/api/v1/charging/sessions?deviceId=04A26CF3", "",
+			func() (*grpcapi.Result, error) {
+				return charging.ListChargingSessions(authed(), &grpcapi.ListChargingSessionsRequest{DeviceId: "04A26CF3"})
+			}, 200, codes.OK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			want := callHTTP(tc.method, tc.path, tc.body)
+			got, code := fromGRPC(tc.call())
+			if want.HttpStatus != tc.wantStatus || code != tc.wantCode {
+				t.Fatalf("HTTP状态=%d gRPC码=%s，期望 %d/%s", want.HttpStatus, code, tc.wantStatus, tc.wantCode)
+			}
+			wantJSON, _ := protojson.Marshal(want)
+			gotJSON, _ := protojson.Marshal(got)
+			if string(wantJSON) != string(gotJSON) {
+				t.Fatalf("两种接口结果不一致:\nHTTP: %s\ngRPC: %s", wantJSON, gotJSON)
+			}
+		})
+	}
+
+	t.Run("鉴权", func(t *testing.T) {
+		if _, err := devices.ListDevices(ctx, &grpcapi.ListDevicesRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("缺少凭证应拒绝: %v", err)
+		}
+		bad := metadata.AppendToOutgoingContext(ctx, "x-api-key", "wrong")
+		if _, err := devices.ListDevices(bad, &grpcapi.ListDevicesRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("错误凭证应拒绝: %v", err)
+		}
+		good := metadata.AppendToOutgoingContext(ctx, "x-api-key", sharedKey)
+		var header metadata.MD
+		if _, err := devices.ListDevices(good, &grpcapi.ListDevicesRequest{}, grpc.Header(&header)); err != nil {
+			t.Fatalf("x-api-key 凭证应通过: %v", err)
+		}
+		if len(header.Get(apihttp.HeaderRequestID)) == 0 {
+			t.Fatal("响应metadata应携带请求ID")
+		}
+	})
+
+	t.Run("变更记录与指标", func(t *testing.T) {
+		var grpcRecord *changelog.Record
+		for _, rec := range l.Query(changelog.Filter{Endpoint: "/api/v1/charging/stop"}) {
+			if rec.KeyName == "order-service" {
+				rec := rec
+				grpcRecord = &rec
+				break
+			}
+		}
+		if grpcRecord == nil || len(grpcRecord.Devices) != 1 || grpcRecord.Devices[0] != "04A26CF3" || grpcRecord.Status != 503 {
+			t.Fatalf("gRPC调用应同样记录变更（调用方取自metadata）: %+v", grpcRecord)
+		}
+
+		m := srv.Metrics()
+		if m.Handled(grpcapi.DeviceQuery_GetDevice_FullMethodName, codes.NotFound) != 1 ||
+			m.Handled(grpcapi.DeviceQuery_ListDevices_FullMethodName, codes.Unauthenticated) != 2 {
+			t.Fatal("调用计数错误")
+		}
+		apihttp.RegisterMetricsCollector(apigrpc.MetricsCollectorName, m.WritePrometheus)
+		defer apihttp.RegisterMetricsCollector(apigrpc.MetricsCollectorName, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := w.Body.String()
+		for _, want := range []string{
+			`iot_grpc_server_handled_total{service="iotzinx.gateway.v1.ChargeControl",method="StartCharging",code="InvalidArgument"} 1`,
+			`iot_grpc_server_handling_seconds_count{service="iotzinx.gateway.v1.DeviceQuery",method="ListDevices"} 4`,
+			"iot_grpc_server_active_streams 0",
+		} {
+			if !strings.Contains(body, want) {
+				t.Fatalf("/metrics 缺少 %s:\n%s", want, body)
+			}
+		}
+	})
+}
+
+// TestGRPCEventStream 事件订阅：按主题与设备过滤、游标回放后接续实时事件、停机时结束订阅流
+func TestGRPCEventStream(t *testing.T) {
+	bus := events.NewBus(events.Options{})
+	events.SetGlobalBus(bus)
+	defer events.SetGlobalBus(nil)
+
+	srv := apigrpc.NewServer(http.NotFoundHandler(), apigrpc.Options{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	conn, err := grpc.NewClient("passthrough:///"+ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := grpcapi.NewEventStreamClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if stream, err := client.Subscribe(ctx, &grpcapi.SubscribeRequest{Topics: []string{"nope"}}); err == nil {
+		if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("未知主题应拒绝: %v", err)
+		}
+	}
+
+	bus.Publish(events.TopicSystem, "gateway_started", "", nil)
+	first := bus.Publish(events.TopicPort, "port_status_change", "04A26CF3", map[string]int{"port": 1})
+	bus.Publish(events.TopicPort, "port_status_change", "04A26CF4", map[string]int{"port": 1})
+	bus.Publish(events.TopicDevice, "device_online", "04A26CF3", nil)
+	second := bus.Publish(events.TopicPort, "port_status_change", "04A26CF3", map[string]int{"port": 2})
+
+	stream, err := client.Subscribe(ctx, &grpcapi.SubscribeRequest{Topics: []string{"port"}, DeviceId: "a26cf3", After: first.Seq - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := func() *grpcapi.Event {
+		t.Helper()
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+	if ev := recv(); ev.Seq != first.Seq || ev.DeviceId != "04A26CF3" || ev.Payload.GetStructValue().GetFields()["port"].GetNumberValue() != 1 {
+		t.Fatalf("回放事件错误: %v", ev)
+	}
+	if ev := recv(); ev.Seq != second.Seq {
+		t.Fatalf("应过滤其他设备与主题: %v", ev)
+	}
+	live := bus.Publish(events.TopicPort, "port_status_change", "04A26CF3", map[string]int{"port": 3})
+	if ev := recv(); ev.Seq != live.Seq || ev.Topic != "port" || ev.TimeUnixMs == 0 {
+		t.Fatalf("实时事件错误: %v", ev)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second)
+	defer shutdownCancel()
+	start := time.Now()
+	if err := srv.Shutdown(shutdownCtx); err != nil || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("停机不应被订阅流阻塞: %v %s", err, time.Since(start))
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("停机后订阅流应以Unavailable结束: %v", err)
+	}
+}
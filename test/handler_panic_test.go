@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/handlerguard"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+type panicTestConn struct {
+	disconnectTestConn
+	stopped atomic.Int32
+}
+
+func (c *panicTestConn) Stop() { c.stopped.Add(1) }
+
+// panicTestRouter 数据域首字节为0xEE时越界访问（模拟畸形帧触发的处理器panic）
+type panicTestRouter struct {
+	protocol.SimpleHandlerBase
+	handled atomic.Int32
+}
+
+func (h *panicTestRouter) Handle(request ziface.IRequest) {
+	frame, err := h.ExtractDecodedFrame(request)
+	if err != nil {
+		return
+	}
+	if frame.Payload[0] == 0xEE {
+		_ = frame.Payload[int(frame.Payload[1])+len(frame.Payload)]
+	}
+	h.handled.Add(1)
+}
+
+// TestHandlerPanicQuarantine 处理器panic被恢复且连接保持；隔离记录含原始帧、解码状态与堆栈并持久化；
+// 生成复现包；同一设备窗口内反复panic后隔离该设备，其他设备不受影响，隔离到期后恢复
+func TestHandlerPanicQuarantine(t *testing.T) {
+	dir, reproDir := t.TempDir(), t.TempDir()
+	now := time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local)
+	guard, err := handlerguard.New(handlerguard.Options{
+		QuarantineDir:    dir,
+		MaxRecords:       2,
+		ReproDir:         reproDir,
+		DeviceWindow:     time.Minute,
+		DeviceThreshold:  3,
+		DeviceQuarantine: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.SetClock(func() time.Time { return now })
+	handlerguard.SetGlobalGuard(guard)
+	defer handlerguard.SetGlobalGuard(nil)
+
+	h := &panicTestRouter{}
+	wrapped := handlerguard.Wrap(constants.CmdDeviceHeart, h)
+	conn := &panicTestConn{disconnectTestConn: disconnectTestConn{id: 1697}}
+	send := func(physicalID uint32, messageID uint16, payload []byte) []byte {
+		frame := protocol.BuildUnifiedDNYPacket(physicalID, messageID, constants.CmdDeviceHeart, payload)
+		req := znet.NewRequest(conn, zpack.NewMsgPackage(constants.CmdDeviceHeart, frame))
+		req.BindRouter(wrapped)
+		req.Call()
+		return frame
+	}
+	bad := []byte{0xEE, 0x05, 0x01}
+
+	frame := send(0x04A26CF3, 0x0101, bad)
+	send(0x04A26CF3, 0x0102, []byte{0x01})
+	if conn.stopped.Load() != 0 || h.handled.Load() != 1 {
+		t.Fatalf("panic后连接应保持且后续帧正常处理: stopped=%d handled=%d", conn.stopped.Load(), h.handled.Load())
+	}
+
+	records := guard.Records(0)
+	if len(records) != 1 {
+		t.Fatalf("应产生一条隔离记录: %+v", records)
+	}
+	rec, _ := guard.Record(records[0].ID)
+	if rec.ConnID != 1697 || rec.RemoteAddr == "" || rec.DeviceID != "04A26CF3" || rec.MsgID != constants.CmdDeviceHeart ||
+		rec.Command != constants.CommandLabel(constants.CmdDeviceHeart) || rec.MessageID != "0x0101" ||
+		!strings.Contains(rec.Handler, "panicTestRouter") || !strings.Contains(rec.Panic, "index out of range") ||
+		!strings.Contains(rec.Stack, "panicTestRouter") || rec.FrameHex != strings.ToUpper(hex.EncodeToString(frame)) {
+		t.Fatalf("隔离记录不完整: %+v", rec)
+	}
+	if !rec.Decode.Decoded || rec.Decode.FrameType != "Standard" || rec.Decode.Command != constants.CmdDeviceHeart ||
+		rec.Decode.MessageID != 0x0101 || rec.Decode.PayloadHex != "EE0501" || rec.Decode.PhysicalIDHex != "F36CA204" {
+		t.Fatalf("解码状态不完整: %+v", rec.Decode)
+	}
+	if _, err := os.Stat(filepath.Join(dir, rec.ID+".json")); err != nil {
+		t.Fatalf("隔离记录应持久化: %v", err)
+	}
+	if rec.ReproPath != filepath.Join(reproDir, rec.ID) {
+		t.Fatalf("复现包路径错误: %s", rec.ReproPath)
+	}
+	skeleton, err := os.ReadFile(filepath.Join(rec.ReproPath, "repro_test.go"))
+	if err != nil || !strings.Contains(string(skeleton), rec.FrameHex) || !strings.Contains(string(skeleton), "//go:build repro") {
+		t.Fatalf("复现测试骨架错误: %v\n%s", err, skeleton)
+	}
+	if hexFile, _ := os.ReadFile(filepath.Join(rec.ReproPath, "frame.hex")); strings.TrimSpace(string(hexFile)) != rec.FrameHex {
+		t.Fatalf("复现包帧十六进制错误: %s", hexFile)
+	}
+
+	// 窗口内第3次panic隔离设备：其帧丢弃，其他设备照常处理
+	now = now.Add(20 * time.Second)
+	send(0x04A26CF3, 0x0103, bad)
+	now = now.Add(20 * time.Second)
+	send(0x04A26CF3, 0x0104, bad)
+	send(0x04A26CF3, 0x0105, []byte{0x01})
+	send(0x04A2715A, 0x0001, []byte{0x01})
+	stats := guard.Stats()
+	if h.handled.Load() != 2 || stats.DroppedFrames != 1 || len(stats.QuarantinedDevices) != 1 || stats.QuarantinedDevices[0].DeviceID != "04A26CF3" {
+		t.Fatalf("反复panic的设备应被隔离: handled=%d %+v", h.handled.Load(), stats)
+	}
+	if stats.TotalPanics != 3 || stats.ByCommand[constants.CommandLabel(constants.CmdDeviceHeart)] != 3 || stats.Records != 2 {
+		t.Fatalf("按命令计数、记录数按上限保留: %+v", stats)
+	}
+	if latest := guard.Records(1)[0]; !latest.DeviceQuarantined {
+		t.Fatalf("触发隔离的记录应标注: %+v", latest)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 2 {
+		t.Fatalf("超出上限的隔离文件应删除: %v", files)
+	}
+
+	now = now.Add(10 * time.Minute)
+	send(0x04A26CF3, 0x0106, []byte{0x01})
+	if h.handled.Load() != 3 || len(guard.Stats().QuarantinedDevices) != 0 {
+		t.Fatalf("隔离到期后应恢复处理: handled=%d", h.handled.Load())
+	}
+
+	// 重启后加载已有隔离记录
+	reopened, err := handlerguard.New(handlerguard.Options{QuarantineDir: dir, MaxRecords: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := reopened.Records(0); len(loaded) != 2 || loaded[0].ID != guard.Records(1)[0].ID || loaded[0].Stack == "" {
+		t.Fatalf("重启后应加载隔离记录: %+v", loaded)
+	}
+
+	// 查询接口：列表不含堆栈，指定ID返回完整记录
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/handler-panics?limit=1", "")
+	items, _ := resp.Data["items"].([]interface{})
+	if w.Code != http.StatusOK || len(items) != 1 || items[0].(map[string]interface{})["stack"] != "" {
+		t.Fatalf("隔离记录列表错误: %d %v", w.Code, resp.Data)
+	}
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/handler-panics?id="+rec.ID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("已淘汰的记录应返回404: %d", w.Code)
+	}
+	latestID := guard.Records(1)[0].ID
+	if w, resp = callAPI(r, http.MethodGet, "/api/v1/admin/handler-panics?id="+latestID, ""); w.Code != http.StatusOK || resp.Data["stack"] == "" {
+		t.Fatalf("指定ID应返回含堆栈的记录: %d %v", w.Code, resp.Data)
+	}
+}
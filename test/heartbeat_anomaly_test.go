@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/anomaly"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/gin-gonic/gin"
+)
+
+// anomalyNoise 基线阶段的小幅确定性波动
+var anomalyNoise = []float64{0.3, -0.2, 0.1, -0.3, 0.2, 0, -0.1, 0.3, -0.2, 0.1}
+
+// TestHeartbeatAnomalyDetection 温度持续攀升开启趋势事件、功率剧烈波动开启偏离事件并在恢复后关闭；
+// 事件开启时回调一次（接入 device_anomaly 通知），全部设备按严重度排序；单设备内存有上限；关闭检测后接口返回503
+func TestHeartbeatAnomalyDetection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		heating    = "04A69201"
+		oscillated = "04A69202"
+	)
+	original := anomaly.GetGlobalDetector()
+	defer anomaly.SetGlobalDetector(original)
+	detector := anomaly.NewDetector(anomaly.Options{})
+	anomaly.SetGlobalDetector(detector)
+	var opened []anomaly.Episode
+	detector.RegisterHandler(func(ep anomaly.Episode) { opened = append(opened, ep) })
+
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	at := time.Now().Add(-2 * time.Hour)
+	observe := func(deviceID, metric string, port int, value float64) {
+		at = at.Add(time.Minute)
+		detector.Observe(deviceID, metric, port, value, at)
+	}
+
+	t.Run("温度持续攀升开启趋势事件", func(t *testing.T) {
+		for i := 0; i < 40; i++ {
+			observe(heating, anomaly.MetricTemperature, 0, 30+anomalyNoise[i%10])
+		}
+		if len(opened) != 0 {
+			t.Fatalf("稳定基线不应开启事件: %+v", opened)
+		}
+		for i := 1; i <= 15; i++ {
+			observe(heating, anomaly.MetricTemperature, 0, 30+0.3*float64(i))
+		}
+		if len(opened) != 1 {
+			t.Fatalf("应开启且仅开启一次事件: %+v", opened)
+		}
+		ep := opened[0]
+		if ep.DeviceID != heating || ep.Metric != anomaly.MetricTemperature || ep.Kind != anomaly.KindTrend || ep.Direction != anomaly.DirectionRising {
+			t.Fatalf("事件字段错误: %+v", ep)
+		}
+		report, _ := detector.Device(heating)
+		if len(report.Open) != 1 || report.Open[0].PeakValue != 34.5 || report.Severity <= ep.PeakDeviation {
+			t.Fatalf("攀升期间峰值与严重度应持续更新: %+v", report.Open)
+		}
+	})
+
+	t.Run("功率剧烈波动开启偏离事件并在恢复后关闭", func(t *testing.T) {
+		for i := 0; i < 40; i++ {
+			observe(oscillated, anomaly.MetricPower, 2, 1000+5*anomalyNoise[i%10])
+		}
+		for i := 0; i < 6; i++ {
+			observe(oscillated, anomaly.MetricPower, 2, map[bool]float64{true: 1600, false: 400}[i%2 == 0])
+		}
+		if len(opened) != 2 || opened[1].Kind != anomaly.KindDeviation || opened[1].Port != 2 {
+			t.Fatalf("功率波动应开启偏离事件: %+v", opened)
+		}
+		fleet := detector.Fleet(true)
+		if len(fleet) != 2 || fleet[0].DeviceID != oscillated || fleet[0].Severity < fleet[1].Severity {
+			t.Fatalf("全部设备应按严重度排序: %+v", fleet)
+		}
+
+		for i := 0; i < 3; i++ {
+			observe(oscillated, anomaly.MetricPower, 2, 1000+5*anomalyNoise[i])
+		}
+		report, _ := detector.Device(oscillated)
+		if len(report.Open) != 0 || len(report.Episodes) != 1 || !report.Episodes[0].Resolved || report.Episodes[0].ResolvedAt == nil {
+			t.Fatalf("连续正常样本后事件应关闭: %+v", report)
+		}
+		if len(opened) != 2 {
+			t.Fatalf("关闭事件不应再次回调: %d", len(opened))
+		}
+	})
+
+	t.Run("查询接口", func(t *testing.T) {
+		w, resp := callAPI(r, http.MethodGet, "/api/v1/device/"+heating+"/anomalies", "")
+		open, _ := resp.Data["open"].([]interface{})
+		if w.Code != http.StatusOK || len(open) != 1 || open[0].(map[string]interface{})["metric"] != anomaly.MetricTemperature {
+			t.Fatalf("设备异常查询错误: %d %v", w.Code, resp.Data)
+		}
+		if baselines, _ := resp.Data["baselines"].([]interface{}); len(baselines) != 1 {
+			t.Fatalf("应返回指标基线: %v", resp.Data["baselines"])
+		}
+		if w, _ := callAPI(r, http.MethodGet, "/api/v1/device/04A69299/anomalies", ""); w.Code != http.StatusNotFound {
+			t.Fatalf("无样本设备应返回404: %d", w.Code)
+		}
+
+		w, resp = callAPI(r, http.MethodGet, "/api/v1/anomalies", "")
+		devices, _ := resp.Data["devices"].([]interface{})
+		if w.Code != http.StatusOK || len(devices) != 1 || devices[0].(map[string]interface{})["deviceId"] != heating {
+			t.Fatalf("默认只返回有进行中事件的设备: %d %v", w.Code, resp.Data)
+		}
+		_, resp = callAPI(r, http.MethodGet, "/api/v1/anomalies?state=all", "")
+		devices, _ = resp.Data["devices"].([]interface{})
+		if len(devices) != 2 || devices[0].(map[string]interface{})["deviceId"] != heating || resp.Data["trackedDevices"] != float64(2) {
+			t.Fatalf("state=all 应包含已恢复设备且排在进行中之后: %v", resp.Data)
+		}
+		if w, _ := callAPI(r, http.MethodGet, "/api/v1/anomalies?state=bad", ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("非法state应返回400: %d", w.Code)
+		}
+	})
+
+	t.Run("单设备内存有上限", func(t *testing.T) {
+		bounded := anomaly.NewDetector(anomaly.Options{EpisodesPerDevice: 2, MaxDevices: 2, WarmupSamples: 5, SustainSamples: 1, ResolveSamples: 1})
+		now := time.Now()
+		for port := 1; port <= 40; port++ {
+			bounded.Observe("04A69210", anomaly.MetricPower, port, 1000, now)
+		}
+		for i := 0; i < 5; i++ {
+			now = now.Add(time.Second)
+			bounded.Observe("04A69210", anomaly.MetricTemperature, 0, 30, now)
+		}
+		for i := 0; i < 4; i++ { // 四次 开启→关闭
+			now = now.Add(time.Second)
+			bounded.Observe("04A69210", anomaly.MetricTemperature, 0, 60, now)
+			now = now.Add(time.Second)
+			bounded.Observe("04A69210", anomaly.MetricTemperature, 0, 30, now)
+		}
+		report, _ := bounded.Device("04A69210")
+		if len(report.Episodes) != 2 || len(report.Baselines) != 33 { // 32个端口功率 + 温度
+			t.Fatalf("事件数与序列数应有上限: episodes=%d baselines=%d", len(report.Episodes), len(report.Baselines))
+		}
+		for i := 1; i <= 2; i++ {
+			now = now.Add(time.Second)
+			bounded.Observe(fmt.Sprintf("04A6921%d", i), anomaly.MetricVoltage, 0, 220, now)
+		}
+		if _, ok := bounded.Device("04A69210"); ok || bounded.Devices() != 2 {
+			t.Fatalf("超出设备上限应淘汰最久无样本的设备: %d", bounded.Devices())
+		}
+	})
+
+	t.Run("通知事件归入告警主题", func(t *testing.T) {
+		if got := notification.TopicForEvent(notification.EventTypeDeviceAnomaly); got != events.TopicAlarm {
+			t.Fatalf("device_anomaly 应归入告警主题: %s", got)
+		}
+	})
+
+	t.Run("关闭检测", func(t *testing.T) {
+		anomaly.SetGlobalDetector(nil)
+		anomaly.Observe(heating, anomaly.MetricTemperature, 0, 99) // 未启用时忽略
+		for _, path := range []string{"/api/v1/device/" + heating + "/anomalies", "/api/v1/anomalies"} {
+			if w, _ := callAPI(r, http.MethodGet, path, ""); w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("%s 关闭检测后应返回503: %d", path, w.Code)
+			}
+		}
+	})
+}
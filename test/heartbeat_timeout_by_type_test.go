@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// TestHeartbeatTimeoutByType 心跳超时按设备类型覆盖：慢心跳的直流桩与快心跳的交流插座各按自己的超时清理，未配置的类型回落到全局超时
+func TestHeartbeatTimeoutByType(t *testing.T) {
+	quietLogger(t)
+	const (
+		dcType     = uint16(0x21)
+		acType     = uint16(0x04)
+		dcDeviceID = "04A27160"
+		acDeviceID = "04A27161"
+	)
+	tcpManager := core.NewTCPManager(nil) // 全局超时60秒
+	tcpManager.SetHeartbeatTimeoutForType(dcType, 11*time.Minute)
+	tcpManager.SetHeartbeatTimeoutForType(acType, 90*time.Second)
+
+	now := time.Now()
+	register := func(connID uint64, deviceID, iccid string, deviceType uint16, heartbeatAge time.Duration) {
+		t.Helper()
+		conn := &disconnectTestConn{id: connID}
+		if _, err := tcpManager.RegisterConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+		if err := tcpManager.RegisterDeviceWithDetails(conn, deviceID, deviceID, iccid, deviceType, "V1.0"); err != nil {
+			t.Fatal(err)
+		}
+		device, _ := tcpManager.GetDeviceByID(deviceID)
+		device.Lock()
+		device.LastHeartbeat = now.Add(-heartbeatAge)
+		device.Unlock()
+	}
+	// 两台设备都已5分钟未心跳：直流桩仍在11分钟内，交流插座已超过90秒
+	register(1760001, dcDeviceID, "89860000000000176001", dcType, 5*time.Minute)
+	register(1760002, acDeviceID, "89860000000000176002", acType, 5*time.Minute)
+
+	detail, err := tcpManager.GetDeviceDetail(dcDeviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail["heartbeatTimeoutSeconds"] != int64(660) || detail["heartbeatTimeoutSource"] != "deviceType" {
+		t.Fatalf("设备详情应展示按类型的有效超时: %v %v", detail["heartbeatTimeoutSeconds"], detail["heartbeatTimeoutSource"])
+	}
+
+	expired := tcpManager.SweepHeartbeatTimeouts(now)
+	if len(expired) != 1 || expired[0] != acDeviceID {
+		t.Fatalf("只应清理超过自身类型超时的交流插座: %v", expired)
+	}
+	if _, ok := tcpManager.GetDeviceByID(acDeviceID); ok {
+		t.Fatal("交流插座应已下线")
+	}
+	if _, ok := tcpManager.GetDeviceByID(dcDeviceID); !ok {
+		t.Fatal("直流桩不应被清理")
+	}
+
+	// 运行时移除覆盖后回落到全局60秒，下一轮检查即生效
+	tcpManager.SetHeartbeatTimeoutForType(dcType, 0)
+	if timeout, byType := tcpManager.HeartbeatTimeoutFor(dcType); timeout != 60*time.Second || byType {
+		t.Fatalf("移除覆盖后应回落到全局超时: %v %v", timeout, byType)
+	}
+	detail, err = tcpManager.GetDeviceDetail(dcDeviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail["heartbeatTimeoutSeconds"] != int64(60) || detail["heartbeatTimeoutSource"] != "global" {
+		t.Fatalf("设备详情应展示全局超时: %v %v", detail["heartbeatTimeoutSeconds"], detail["heartbeatTimeoutSource"])
+	}
+	if expired := tcpManager.SweepHeartbeatTimeouts(now); len(expired) != 1 || expired[0] != dcDeviceID {
+		t.Fatalf("回落到全局超时后直流桩应被清理: %v", expired)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+)
+
+type sentParam struct {
+	command byte
+	data    []byte
+}
+
+// runParams11 构造0x90运行参数1.1应答（心跳间隔位于偏移9）
+func runParams11(heartbeat uint16) []byte {
+	payload := []byte{0x03, 0x00, 0x0A, 0x00, 0x14, 0x08, 0x07, 0x10, 0x0E, 0x00, 0x00}
+	binary.LittleEndian.PutUint16(payload[9:], heartbeat)
+	return payload
+}
+
+// TestHeartbeatTuning 自适应心跳：分级、查询当前间隔、下发与确认、冷却期、演练模式与全局开关
+func TestHeartbeatTuning(t *testing.T) {
+	const deviceID = "04A2715A"
+	var sent []sentParam
+	cfg := config.HeartbeatTuningConfig{
+		Enabled:                 true,
+		MinIntervalSeconds:      60,
+		MaxIntervalSeconds:      600,
+		ChangeThresholdSeconds:  60,
+		CooldownSeconds:         600,
+		EvaluateIntervalSeconds: 60,
+		ChurnWindowSeconds:      3600,
+		UnstableDisconnects:     3,
+	}
+	tuner := gateway.NewHeartbeatTuner(cfg, func(id string, command byte, data []byte) error {
+		sent = append(sent, sentParam{command: command, data: append([]byte(nil), data...)})
+		return nil
+	})
+
+	now := time.Now()
+	stable := gateway.HeartbeatConnectionMetrics{
+		ConnectedAt: now.Add(-2 * time.Hour),
+		HasRTT:      true,
+		RTT:         network.CommandRTTStats{Samples: 10, Smoothed: 300 * time.Millisecond},
+	}
+
+	// 当前间隔未知：下发0x90查询，评估周期内不重复查询
+	if action := tuner.Evaluate(deviceID, stable, now); action != gateway.HeartbeatTuningAwaitConfig {
+		t.Fatalf("未知间隔应等待查询: %s", action)
+	}
+	tuner.Evaluate(deviceID, stable, now.Add(time.Second))
+	if len(sent) != 1 || sent[0].command != constants.CmdQueryParam1 {
+		t.Fatalf("应仅下发一次0x90查询: %+v", sent)
+	}
+
+	// 稳定连接放宽到上限，其余运行参数沿用设备当前值
+	tuner.ObserveRunParams(deviceID, runParams11(180), now)
+	if action := tuner.Evaluate(deviceID, stable, now.Add(2*time.Second)); action != gateway.HeartbeatTuningPushed {
+		t.Fatalf("稳定连接应下发: %s", action)
+	}
+	push := sent[len(sent)-1]
+	if push.command != constants.CmdParamSetting || binary.LittleEndian.Uint16(push.data[9:]) != 600 || string(push.data[:9]) != string(runParams11(180)[:9]) {
+		t.Fatalf("0x83数据错误: % X", push.data)
+	}
+	if action := tuner.Evaluate(deviceID, stable, now.Add(3*time.Second)); action != gateway.HeartbeatTuningAwaitAck {
+		t.Fatalf("应等待设备应答: %s", action)
+	}
+	if !tuner.OnRunParamsAck(deviceID, 0, now.Add(4*time.Second)) {
+		t.Fatal("应匹配待应答的下发")
+	}
+	state, _ := tuner.Get(deviceID)
+	if state.ConfirmedInterval != 600 || state.RecommendedInterval != 600 || state.Stability != gateway.HeartbeatStabilityStable {
+		t.Fatalf("确认后状态错误: %+v", state)
+	}
+	if action := tuner.Evaluate(deviceID, stable, now.Add(5*time.Second)); action != gateway.HeartbeatTuningWithinThreshold {
+		t.Fatalf("已确认间隔与推荐一致: %s", action)
+	}
+
+	// 频繁断连判为不稳定，冷却期内不下发，冷却期后收紧到下限
+	for i := 0; i < 3; i++ {
+		tuner.NoteDisconnect(deviceID, now.Add(time.Duration(10+i)*time.Second))
+	}
+	flaky := gateway.HeartbeatConnectionMetrics{ConnectedAt: now.Add(20 * time.Second)}
+	if action := tuner.Evaluate(deviceID, flaky, now.Add(30*time.Second)); action != gateway.HeartbeatTuningCooldown {
+		t.Fatalf("冷却期内不应下发: %s", action)
+	}
+	if action := tuner.Evaluate(deviceID, flaky, now.Add(11*time.Minute)); action != gateway.HeartbeatTuningPushed {
+		t.Fatalf("冷却期后应下发: %s", action)
+	}
+	if got := binary.LittleEndian.Uint16(sent[len(sent)-1].data[9:]); got != 60 {
+		t.Fatalf("不稳定连接应收紧到下限: %d", got)
+	}
+	tuner.OnRunParamsAck(deviceID, 1, now.Add(11*time.Minute+time.Second))
+	if state, _ := tuner.Get(deviceID); state.ConfirmedInterval != 600 || state.Rejections != 1 {
+		t.Fatalf("设备拒绝时保持原确认值: %+v", state)
+	}
+
+	// 全局开关
+	tuner.SetEnabled(false)
+	before := len(sent)
+	if action := tuner.Evaluate(deviceID, flaky, now.Add(time.Hour)); action != gateway.HeartbeatTuningDisabled || len(sent) != before {
+		t.Fatalf("关闭后不应评估: %s", action)
+	}
+
+	// 演练模式：只报告，不下发任何命令
+	cfg.DryRun = true
+	var dryRunSent int
+	dry := gateway.NewHeartbeatTuner(cfg, func(string, byte, []byte) error { dryRunSent++; return nil })
+	if action := dry.Evaluate(deviceID, stable, now); action != gateway.HeartbeatTuningAwaitConfig {
+		t.Fatalf("演练模式未知间隔: %s", action)
+	}
+	dry.ObserveRunParams(deviceID, runParams11(180), now)
+	if action := dry.Evaluate(deviceID, stable, now.Add(time.Second)); action != gateway.HeartbeatTuningDryRun {
+		t.Fatalf("演练模式应仅报告: %s", action)
+	}
+	if status := dry.Status(); dryRunSent != 0 || status.WouldChange != 1 || !status.DryRun || len(status.Devices) != 1 {
+		t.Fatalf("演练模式状态错误: sent=%d %+v", dryRunSent, status)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/gin-gonic/gin"
+)
+
+// TestHookReceiver 入站webhook验签/防重放/限流/命令映射测试
+func TestHookReceiver(t *testing.T) {
+	const (
+		source = "order-platform"
+		secret = "test-secret"
+	)
+	gin.SetMode(gin.TestMode)
+
+	newEngine := func(rateLimit int) *gin.Engine {
+		h := apihttp.NewHookHandlersWithConfig(config.WebhookReceiverConfig{
+			Enabled:        true,
+			WindowSeconds:  60,
+			NonceCacheSize: 16,
+			Sources: []config.WebhookSourceConfig{{
+				Name:               source,
+				Secret:             secret,
+				AllowedCommands:    []string{"charge_stop", "locate"},
+				RateLimitPerMinute: rateLimit,
+			}},
+		}, apihttp.NewChargingHandlers(), apihttp.NewDeviceHandlers())
+		r := gin.New()
+		r.Use(apihttp.CorrelationIDMiddleware())
+		r.POST("/api/v1/hooks/commands", h.HandleHookCommand)
+		return r
+	}
+
+	send := func(r *gin.Engine, ts time.Time, nonce, body, signature string) (*httptest.ResponseRecorder, apihttp.ProblemDetails) {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		if signature == "" {
+			signature = "sha256=" + apihttp.SignHookRequest(secret, timestamp, nonce, []byte(body))
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/hooks/commands", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(apihttp.HeaderHookSource, source)
+		req.Header.Set(apihttp.HeaderHookTimestamp, timestamp)
+		req.Header.Set(apihttp.HeaderHookNonce, nonce)
+		req.Header.Set(apihttp.HeaderHookSignature, signature)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var p apihttp.ProblemDetails
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/problem+json") {
+			_ = json.Unmarshal(w.Body.Bytes(), &p)
+		}
+		return w, p
+	}
+
+	stopBody := `{"type":"charge_stop","params":{"deviceId":"04A26CF3","port":1,"orderNo":"ORDER_HOOK_001"}}`
+
+	t.Run("验签通过后映射到停止充电命令", func(t *testing.T) {
+		r := newEngine(0)
+		w, p := send(r, time.Now(), "nonce-1", stopBody, "")
+		// 设备不在线：命令已映射到 /charging/stop 处理器，其错误以 problem+json 返回
+		if w.Code != http.StatusServiceUnavailable || p.Status != http.StatusServiceUnavailable {
+			t.Fatalf("应返回停止充电处理器的503: %d %s", w.Code, w.Body.String())
+		}
+		if p.RequestID == "" || p.RequestID != w.Header().Get(apihttp.HeaderRequestID) {
+			t.Fatalf("问题详情应携带内部请求ID: %+v", p)
+		}
+
+		if w, _ := send(r, time.Now(), "nonce-1", stopBody, ""); w.Code != http.StatusConflict {
+			t.Fatalf("重复nonce应拒绝为重放: %d", w.Code)
+		}
+	})
+
+	t.Run("时间戳与签名校验", func(t *testing.T) {
+		r := newEngine(0)
+		if w, p := send(r, time.Now().Add(-2*time.Minute), "nonce-old", stopBody, ""); w.Code != http.StatusUnauthorized || p.Title == "" {
+			t.Fatalf("超出窗口的时间戳应拒绝: %d %s", w.Code, w.Body.String())
+		}
+		if w, _ := send(r, time.Now(), "nonce-sig", stopBody, "deadbeef"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("签名错误应拒绝: %d", w.Code)
+		}
+		// 签名错误的请求不应占用nonce
+		if w, _ := send(r, time.Now(), "nonce-sig", stopBody, ""); w.Code == http.StatusConflict {
+			t.Fatal("验签失败的nonce不应记录")
+		}
+	})
+
+	t.Run("命令类型授权", func(t *testing.T) {
+		r := newEngine(0)
+		body := `{"type":"charge_start","params":{"deviceId":"04A26CF3","port":1,"orderNo":"O1","value":60}}`
+		if w, _ := send(r, time.Now(), "nonce-start", body, ""); w.Code != http.StatusForbidden {
+			t.Fatalf("未授权的命令类型应返回403: %d", w.Code)
+		}
+		if w, _ := send(r, time.Now(), "nonce-unknown", `{"type":"format","params":{}}`, ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("不支持的命令类型应返回400: %d", w.Code)
+		}
+	})
+
+	t.Run("按来源限流", func(t *testing.T) {
+		r := newEngine(2)
+		for i := 0; i < 2; i++ {
+			if w, _ := send(r, time.Now(), fmt.Sprintf("nonce-rate-%d", i), stopBody, ""); w.Code == http.StatusTooManyRequests {
+				t.Fatalf("第%d次请求不应被限流", i+1)
+			}
+		}
+		if w, _ := send(r, time.Now(), "nonce-rate-x", stopBody, ""); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("超出每分钟上限应返回429: %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// TestICCIDConflictDetection ICCID冲突检测测试
+func TestICCIDConflictDetection(t *testing.T) {
+	now := time.Now()
+	iccid := "89860404D91623904882979"
+
+	existing := core.ICCIDConnectionInfo{
+		ConnID:       1,
+		RemoteAddr:   "10.20.30.40:50001",
+		DeviceIDs:    []string{"04A228CD"},
+		ConnectedAt:  now.Add(-10 * time.Minute),
+		LastActivity: now.Add(-30 * time.Second),
+	}
+
+	newDetector := func(ipMatch string) *core.ICCIDConflictDetector {
+		return core.NewICCIDConflictDetector(&core.ICCIDConflictConfig{
+			Enabled: true,
+			Policy:  core.ICCIDConflictPolicyRejectNew,
+			Window:  5 * time.Minute,
+			IPMatch: ipMatch,
+		})
+	}
+
+	t.Run("运营商NAT同网段地址漂移不视为冲突", func(t *testing.T) {
+		d := newDetector(core.ICCIDIPMatchSubnet24)
+		incoming := core.ICCIDConnectionInfo{ConnID: 2, RemoteAddr: "10.20.30.177:41234", DeviceIDs: []string{"04A228CD"}}
+		if c := d.Detect(iccid, existing, incoming, now); c != nil {
+			t.Fatalf("同/24网段重连被误判为冲突: %+v", c)
+		}
+	})
+
+	t.Run("同IP不同端口重连不视为冲突", func(t *testing.T) {
+		d := newDetector(core.ICCIDIPMatchExact)
+		incoming := core.ICCIDConnectionInfo{ConnID: 2, RemoteAddr: "10.20.30.40:60000"}
+		if c := d.Detect(iccid, existing, incoming, now); c != nil {
+			t.Fatalf("同IP重连被误判为冲突: %+v", c)
+		}
+	})
+
+	t.Run("旧连接超出检测窗口不视为冲突", func(t *testing.T) {
+		d := newDetector(core.ICCIDIPMatchSubnet24)
+		stale := existing
+		stale.LastActivity = now.Add(-10 * time.Minute)
+		incoming := core.ICCIDConnectionInfo{ConnID: 2, RemoteAddr: "172.16.5.9:40000"}
+		if c := d.Detect(iccid, stale, incoming, now); c != nil {
+			t.Fatalf("窗口外的旧连接被误判为冲突: %+v", c)
+		}
+	})
+
+	t.Run("同一连接不视为冲突", func(t *testing.T) {
+		d := newDetector(core.ICCIDIPMatchExact)
+		incoming := core.ICCIDConnectionInfo{ConnID: 1, RemoteAddr: "172.16.5.9:40000"}
+		if c := d.Detect(iccid, existing, incoming, now); c != nil {
+			t.Fatalf("同一连接被误判为冲突: %+v", c)
+		}
+	})
+
+	t.Run("exact规则下同网段不同IP视为冲突", func(t *testing.T) {
+		d := newDetector(core.ICCIDIPMatchExact)
+		incoming := core.ICCIDConnectionInfo{ConnID: 2, RemoteAddr: "10.20.30.177:41234"}
+		if c := d.Detect(iccid, existing, incoming, now); c == nil {
+			t.Fatal("exact规则下不同IP应视为冲突")
+		}
+	})
+
+	t.Run("不同网段并发在线视为冲突并记录", func(t *testing.T) {
+		d := newDetector(core.ICCIDIPMatchSubnet24)
+		notified := make(chan core.ICCIDConflict, 2)
+		d.RegisterHandler(func(c core.ICCIDConflict) { notified <- c })
+
+		incoming := core.ICCIDConnectionInfo{ConnID: 2, RemoteAddr: "172.16.5.9:40000", DeviceIDs: []string{"04A26CF3"}}
+		c := d.Detect(iccid, existing, incoming, now)
+		if c == nil {
+			t.Fatal("不同网段并发在线应视为冲突")
+		}
+		if c.Policy != core.ICCIDConflictPolicyRejectNew {
+			t.Fatalf("策略错误: %s", c.Policy)
+		}
+		if c.Existing.RemoteAddr != existing.RemoteAddr || c.Incoming.RemoteAddr != incoming.RemoteAddr {
+			t.Fatalf("冲突记录地址错误: %+v", c)
+		}
+
+		d.Record(c)
+		d.Record(d.Detect(iccid, existing, incoming, now.Add(time.Second)))
+
+		conflicts := d.GetConflicts()
+		if len(conflicts) != 1 {
+			t.Fatalf("重复冲突应合并为1条，实际 %d 条", len(conflicts))
+		}
+		if conflicts[0].Count != 2 {
+			t.Fatalf("重复检测次数应为2，实际 %d", conflicts[0].Count)
+		}
+
+		select {
+		case got := <-notified:
+			if got.ICCID != iccid {
+				t.Fatalf("告警ICCID错误: %s", got.ICCID)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("未触发冲突告警回调")
+		}
+		select {
+		case <-notified:
+			t.Fatal("重复冲突不应再次告警")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+// iccidConflictTestConn 指定来源地址的连接桩
+type iccidConflictTestConn struct {
+	disconnectTestConn
+	addr net.Addr
+}
+
+func (c *iccidConflictTestConn) RemoteAddr() net.Addr { return c.addr }
+
+// TestICCIDConflictPolicies 默认 log-only 只记录冲突，新连接照常注册且不关闭原连接；allow-takeover 关闭原连接；reject-new 拒绝注册
+func TestICCIDConflictPolicies(t *testing.T) {
+	quietLogger(t)
+	const iccid = "89860000000000163101"
+	if policy := core.NewICCIDConflictDetector(nil).GetConfig().Policy; policy != core.ICCIDConflictPolicyLogOnly {
+		t.Fatalf("默认策略应为 log-only，实际 %s", policy)
+	}
+
+	// setup 原连接注册 04A16311，来自不同网段的新连接以同一ICCID注册 04A16312
+	setup := func(t *testing.T, policy string) (*core.TCPManager, error) {
+		t.Helper()
+		manager := core.NewTCPManager(nil)
+		if policy != "" {
+			manager.SetICCIDConflictConfig(&core.ICCIDConflictConfig{Enabled: true, Policy: policy})
+		}
+		original := &iccidConflictTestConn{disconnectTestConn: disconnectTestConn{id: 1631001}, addr: &net.TCPAddr{IP: net.IPv4(10, 20, 30, 40), Port: 50001}}
+		incoming := &iccidConflictTestConn{disconnectTestConn: disconnectTestConn{id: 1631002}, addr: &net.TCPAddr{IP: net.IPv4(172, 16, 5, 9), Port: 40000}}
+		for _, conn := range []*iccidConflictTestConn{original, incoming} {
+			if _, err := manager.RegisterConnection(conn); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := manager.RegisterDevice(original, "04A16311", "04A16311", iccid); err != nil {
+			t.Fatal(err)
+		}
+		return manager, manager.RegisterDevice(incoming, "04A16312", "04A16312", iccid)
+	}
+	originalOpen := func(manager *core.TCPManager) bool {
+		_, ok := manager.GetSessionByConnID(1631001)
+		conn, online := manager.GetConnectionByDeviceID("04A16311")
+		return ok && online && conn.GetConnID() == 1631001
+	}
+
+	t.Run("默认策略保留原连接", func(t *testing.T) {
+		manager, err := setup(t, "")
+		if err != nil {
+			t.Fatalf("log-only 下新连接应照常注册: %v", err)
+		}
+		if !originalOpen(manager) {
+			t.Fatal("log-only 不应关闭原连接或使原设备下线")
+		}
+		if _, online := manager.GetConnectionByDeviceID("04A16312"); !online {
+			t.Fatal("新连接的设备应在线")
+		}
+		if conflicts := manager.GetICCIDConflicts(); len(conflicts) != 1 || conflicts[0].Policy != core.ICCIDConflictPolicyLogOnly {
+			t.Fatalf("应记录1条 log-only 冲突: %+v", conflicts)
+		}
+	})
+
+	t.Run("allow-takeover关闭原连接", func(t *testing.T) {
+		manager, err := setup(t, core.ICCIDConflictPolicyAllowTakeover)
+		if err != nil {
+			t.Fatalf("allow-takeover 下新连接应注册成功: %v", err)
+		}
+		if originalOpen(manager) {
+			t.Fatal("allow-takeover 应清理原连接")
+		}
+	})
+
+	t.Run("reject-new拒绝新连接", func(t *testing.T) {
+		manager, err := setup(t, core.ICCIDConflictPolicyRejectNew)
+		if err == nil {
+			t.Fatal("reject-new 应拒绝新连接注册")
+		}
+		if !originalOpen(manager) {
+			t.Fatal("reject-new 不应影响原连接")
+		}
+	})
+}
+
+// TestIsSameAddressRange 来源地址相似度规则测试
+func TestIsSameAddressRange(t *testing.T) {
+	cases := []struct {
+		a, b, mode string
+		want       bool
+	}{
+		{"10.0.0.1:1000", "10.0.0.1:2000", core.ICCIDIPMatchExact, true},
+		{"10.0.0.1:1000", "10.0.0.2:2000", core.ICCIDIPMatchExact, false},
+		{"10.0.0.1:1000", "10.0.0.254:2000", core.ICCIDIPMatchSubnet24, true},
+		{"10.0.0.1:1000", "10.0.1.1:2000", core.ICCIDIPMatchSubnet24, false},
+		{"[2001:db8::1]:1000", "[2001:db8::2]:2000", core.ICCIDIPMatchSubnet24, false},
+		{"", "10.0.0.1:2000", core.ICCIDIPMatchExact, true},
+	}
+	for _, tc := range cases {
+		if got := core.IsSameAddressRange(tc.a, tc.b, tc.mode); got != tc.want {
+			t.Errorf("IsSameAddressRange(%q, %q, %s) = %v, want %v", tc.a, tc.b, tc.mode, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// indexCheckConn 索引检查测试用连接
+type indexCheckConn struct {
+	ziface.IConnection
+	id uint64
+}
+
+func (c *indexCheckConn) GetConnID() uint64 { return c.id }
+func (c *indexCheckConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 2, 0, byte(c.id)), Port: 40000}
+}
+func (c *indexCheckConn) GetProperty(string) (interface{}, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+// TestIndexHealthCheck 索引健康检查：修复明细、无法修复项、定时结果保存、超时与互斥
+func TestIndexHealthCheck(t *testing.T) {
+	tm := core.NewTCPManager(nil)
+	register := func(connID uint64, iccid string, deviceIDs ...string) {
+		conn := &indexCheckConn{id: connID}
+		if _, err := tm.RegisterConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range deviceIDs {
+			if err := tm.RegisterDevice(conn, id, id, iccid); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	register(1, "89860000000000000001", "04A10001", "04A10002", "04A10003")
+	register(2, "89860000000000000002", "04A20001")
+
+	// 索引指向错误ICCID（可修复）；连接会话丢失（无法修复）
+	tm.GetDeviceIndex().Store("04A10002", "89860000000000009999")
+	tm.GetConnections().Delete(uint64(2))
+
+	if _, ok := tm.LastIndexHealthCheck(); ok {
+		t.Fatal("尚未执行定时检查")
+	}
+	result, err := tm.RunIndexHealthCheck(context.Background(), core.IndexCheckTriggerManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DevicesChecked != 4 || result.Healthy != 2 || len(result.Repaired) != 1 || len(result.Unrepairable) != 1 {
+		t.Fatalf("检查结果错误: %+v", result)
+	}
+	repair := result.Repaired[0]
+	if repair.DeviceID != "04A10002" || repair.BeforeICCID != "89860000000000009999" || repair.AfterICCID != "89860000000000000001" {
+		t.Fatalf("修复明细错误: %+v", repair)
+	}
+	bad := result.Unrepairable[0]
+	if bad.DeviceID != "04A20001" || !strings.Contains(bad.ValidationError, "连接会话不存在") {
+		t.Fatalf("无法修复项错误: %+v", bad)
+	}
+	if _, ok := tm.LastIndexHealthCheck(); ok {
+		t.Fatal("手动检查不应覆盖最近一次定时结果")
+	}
+
+	// 定时检查结果被保存
+	tm.PeriodicIndexHealthCheck()
+	last, ok := tm.LastIndexHealthCheck()
+	if !ok || last.Trigger != core.IndexCheckTriggerScheduled || last.Healthy != 3 || len(last.Unrepairable) != 1 {
+		t.Fatalf("最近一次定时结果错误: %+v", last)
+	}
+
+	// 超时：返回部分结果
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	partial, err := tm.RunIndexHealthCheck(ctx, core.IndexCheckTriggerManual)
+	if err != nil || !partial.Incomplete || partial.DevicesChecked != 0 {
+		t.Fatalf("超时结果错误: %+v %v", partial, err)
+	}
+
+	// 并发触发：要么执行，要么返回正在执行，不会同时执行
+	before := tm.GetStats().IndexChecks
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ran := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tm.RunIndexHealthCheck(context.Background(), core.IndexCheckTriggerManual)
+			if err != nil && !errors.Is(err, core.ErrIndexCheckRunning) {
+				t.Errorf("并发检查错误: %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				ran++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	stats := tm.GetStats()
+	if ran == 0 || stats.IndexChecks-before != int64(ran) {
+		t.Fatalf("检查次数不一致: ran=%d checks=%d", ran, stats.IndexChecks-before)
+	}
+	if stats.IndexRepaired != 1 || stats.IndexUnrepairable < 2 {
+		t.Fatalf("分类累计计数错误: %+v", stats)
+	}
+}
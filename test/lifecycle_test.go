@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
+	"github.com/bujia-iot/iot-zinx/internal/ports"
+)
+
+// TestLifecycle 就绪状态与分阶段停机顺序测试
+func TestLifecycle(t *testing.T) {
+	t.Run("就绪判定", func(t *testing.T) {
+		r := lifecycle.NewReadiness()
+		r.Expect(lifecycle.ComponentHTTP, lifecycle.ComponentTCP)
+		r.MarkStarted(lifecycle.ComponentHTTP)
+		if ready, _ := r.Status(); ready {
+			t.Fatal("TCP未启动时不应就绪")
+		}
+		r.MarkStarted(lifecycle.ComponentTCP)
+		if ready, components := r.Status(); !ready || !components[lifecycle.ComponentTCP] {
+			t.Fatalf("全部组件启动后应就绪: %v", components)
+		}
+		r.BeginDrain()
+		if ready, _ := r.Status(); ready || !r.IsDraining() {
+			t.Fatal("进入摘流后应返回未就绪")
+		}
+	})
+
+	t.Run("阶段按序执行且错误不中断", func(t *testing.T) {
+		var order []string
+		phase := func(name string, err error) lifecycle.Phase {
+			return lifecycle.Phase{Name: name, Run: func(context.Context) error {
+				order = append(order, name)
+				return err
+			}}
+		}
+		timeout := lifecycle.Phase{Name: "slow", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) error {
+			order = append(order, "slow")
+			return lifecycle.Wait(ctx, time.Minute)
+		}}
+
+		summary := lifecycle.RunPhases("test", []lifecycle.Phase{phase("a", nil), phase("b", errors.New("失败")), timeout, phase("c", nil)})
+		if len(order) != 4 || order[0] != "a" || order[3] != "c" {
+			t.Fatalf("阶段执行顺序错误: %v", order)
+		}
+		if len(summary.Phases) != 4 || summary.Phases[1].Error == "" || summary.Phases[3].Error != "" {
+			t.Fatalf("阶段结果错误: %+v", summary.Phases)
+		}
+		if summary.Phases[2].Error == "" || summary.Phases[2].DurationMs >= 1000 {
+			t.Fatalf("阶段超时应及时结束并记录错误: %+v", summary.Phases[2])
+		}
+	})
+
+	t.Run("停机阶段顺序", func(t *testing.T) {
+		phases := ports.ShutdownPhases(config.ShutdownConfig{CommandDrainTimeoutSeconds: 1}, nil, nil)
+		expected := []string{
+			ports.ShutdownPhaseMarkUnready,
+			ports.ShutdownPhaseLBDrain,
+			ports.ShutdownPhaseStopTCPAccept,
+			ports.ShutdownPhaseDrainConnections,
+			ports.ShutdownPhaseStopHTTP,
+			ports.ShutdownPhaseCloseTCP,
+		}
+		if len(phases) != len(expected) {
+			t.Fatalf("阶段数量错误: %d", len(phases))
+		}
+		for i, p := range phases {
+			if p.Name != expected[i] {
+				t.Fatalf("第%d阶段应为 %s，实际 %s", i+1, expected[i], p.Name)
+			}
+		}
+	})
+}
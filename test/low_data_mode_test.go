@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/lowdata"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+// splitDNYFrames 按长度字段拆分（可能合并写入的）下行数据为单帧
+func splitDNYFrames(writes [][]byte) [][]byte {
+	var frames [][]byte
+	for _, w := range writes {
+		for len(w) >= 5 {
+			n := 5 + int(binary.LittleEndian.Uint16(w[3:5]))
+			if n > len(w) {
+				break
+			}
+			frames = append(frames, w[:n])
+			w = w[n:]
+		}
+	}
+	return frames
+}
+
+func frameCommands(frames [][]byte) []byte {
+	cmds := make([]byte, 0, len(frames))
+	for _, f := range frames {
+		_, _, cmd, _ := frameHeader(f)
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+func boolPtr(v bool) *bool { return &v }
+
+// TestLowDataClassification 只有协议标注“无须应答”的命令与对时可被抑制；结算、心跳、注册等应答始终为必须应答
+func TestLowDataClassification(t *testing.T) {
+	optional := map[int]bool{0x05: true, 0x06: true, 0x11: true, 0x41: true, 0x42: true, 0x43: true, 0x44: true}
+	timeSync := map[int]bool{0x12: true, 0x22: true}
+	for cmd := 0; cmd <= 0xFF; cmd++ {
+		want := lowdata.ResponseRequired
+		if optional[cmd] {
+			want = lowdata.ResponseOptional
+		} else if timeSync[cmd] {
+			want = lowdata.ResponseTimeSync
+		}
+		if got := lowdata.ClassifyResponse(uint8(cmd)); got != want {
+			t.Fatalf("0x%02X 分类应为 %s，实际 %s", cmd, want, got)
+		}
+	}
+	for _, cmd := range []uint8{constants.CmdSettlement, constants.CmdTimeBillingSettlement, constants.CmdHeartbeat,
+		constants.CmdDeviceHeart, constants.CmdDeviceRegister, constants.CmdDeviceVersion} {
+		if lowdata.ClassifyResponse(cmd) != lowdata.ResponseRequired {
+			t.Fatalf("0x%02X 应答不得被抑制", cmd)
+		}
+	}
+	if lowdata.IsEssentialPoll(lowdata.PollReadDeadlineProbe) || !lowdata.IsEssentialPoll(lowdata.PollHeartbeatConfigQuery) ||
+		!lowdata.IsEssentialPoll(lowdata.PollRegistrationSolicit) {
+		t.Fatal("只有读超时探测为非必要查询")
+	}
+}
+
+// TestLowDataPolicyResolve 排除优先，其次ICCID，再次租户；未填写的开关逐级继承，最终为开启
+func TestLowDataPolicyResolve(t *testing.T) {
+	p, err := lowdata.ParsePolicy([]byte(`
+defaults:
+  coalesceOutbound: false
+tenants:
+  metered:
+    suppressProactivePolls: false
+iccids:
+  "8986A":
+    coalesceOutbound: true
+exclude: ["8986X"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant := p.Resolve("8986B", "metered")
+	if !tenant.Enabled || tenant.Source != lowdata.SourceTenant || tenant.Effective.CoalesceOutbound ||
+		tenant.Effective.SuppressProactivePolls || !tenant.Effective.SuppressOptionalAcks {
+		t.Fatalf("租户分配错误: %+v", tenant)
+	}
+	iccid := p.Resolve("8986A", "metered")
+	if iccid.Source != lowdata.SourceICCID || !iccid.Effective.CoalesceOutbound || iccid.Effective.SuppressProactivePolls {
+		t.Fatalf("ICCID分配应覆盖租户并继承其余项: %+v", iccid)
+	}
+	if m := p.Resolve("8986X", "metered"); m.Enabled || !m.Excluded {
+		t.Fatalf("排除的ICCID不应启用: %+v", m)
+	}
+	if m := p.Resolve("8986C", "other"); m.Enabled {
+		t.Fatalf("未分配的连接不应启用: %+v", m)
+	}
+	if _, err := lowdata.ParsePolicy([]byte("iccids:\n  \"8986X\": {}\nexclude: [\"8986X\"]\n")); err == nil {
+		t.Fatal("同一ICCID既分配又排除应校验失败")
+	}
+}
+
+// TestLowDataMode 低流量连接：可选应答与重复对时被抑制、必须应答始终发送、下行帧合并、探测被抑制，并计入流量报告
+func TestLowDataMode(t *testing.T) {
+	const (
+		lowICCID     = "89860000000000074001"
+		controlICCID = "89860000000000074002"
+	)
+	low := registerSharedGroup(t, 74001, lowICCID, []string{"04A27401", "04A27402"})
+	control := registerSharedGroup(t, 74002, controlICCID, []string{"04A27403"})
+
+	reg, err := lowdata.NewRegistry("", lowdata.Options{CoalesceWindow: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetPolicy(&lowdata.Policy{ICCIDs: map[string]lowdata.Settings{lowICCID: {}}}); err != nil {
+		t.Fatal(err)
+	}
+	lowdata.SetGlobalRegistry(reg)
+	defer lowdata.SetGlobalRegistry(nil)
+
+	optional := []uint8{0x05, constants.CmdPowerHeartbeat, constants.CmdMainHeartbeat, 0x41, constants.CmdAlarm, 0x43, 0x44}
+	required := []uint8{constants.CmdSettlement, constants.CmdTimeBillingSettlement, constants.CmdHeartbeat,
+		constants.CmdDeviceHeart, constants.CmdDeviceRegister, constants.CmdDeviceVersion}
+	respond := func(conn *frameCaptureConn, physicalID uint32, cmds []uint8) {
+		for i, cmd := range cmds {
+			if err := protocol.SendDNYResponse(conn, physicalID, uint16(0x7400+i), cmd, []byte{0x00}); err != nil {
+				t.Fatalf("0x%02X 应答发送失败: %v", cmd, err)
+			}
+		}
+	}
+
+	t.Run("只抑制可选应答", func(t *testing.T) {
+		respond(low, 0x04A27401, append(append([]uint8{}, optional...), required...))
+		if got := frameCommands(splitDNYFrames(low.take())); string(got) != string(required) {
+			t.Fatalf("低流量连接应只发送必须应答: % X", got)
+		}
+		respond(control, 0x04A27403, append(append([]uint8{}, optional...), required...))
+		if got := frameCommands(splitDNYFrames(control.take())); len(got) != len(optional)+len(required) {
+			t.Fatalf("未分配的连接应发送全部应答: % X", got)
+		}
+	})
+
+	t.Run("对时按设备去重", func(t *testing.T) {
+		respond(low, 0x04A27401, []uint8{constants.CmdDeviceTime, constants.CmdDeviceTime})
+		respond(low, 0x04A27402, []uint8{constants.CmdGetServerTime})
+		if got := frameCommands(splitDNYFrames(low.take())); string(got) != string([]uint8{constants.CmdDeviceTime, constants.CmdGetServerTime}) {
+			t.Fatalf("去重窗口内同一设备的重复对时不应答: % X", got)
+		}
+		respond(control, 0x04A27403, []uint8{constants.CmdDeviceTime, constants.CmdDeviceTime})
+		if got := splitDNYFrames(control.take()); len(got) != 2 {
+			t.Fatalf("未分配的连接每次对时都应答: %d", len(got))
+		}
+	})
+
+	t.Run("合并下行帧", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_ = protocol.SendDNYResponse(low, 0x04A27401, uint16(0x7410+i), constants.CmdSettlement, []byte{0x00})
+			}(i)
+		}
+		wg.Wait()
+		writes := low.take()
+		if len(writes) != 1 || len(splitDNYFrames(writes)) != 3 {
+			t.Fatalf("合并窗口内的3帧应一次写出: %d次写入", len(writes))
+		}
+	})
+
+	t.Run("抑制非必要主动查询", func(t *testing.T) {
+		g := gateway.GetGlobalDeviceGateway()
+		if err := g.SendProactivePoll("04A27401", lowdata.PollReadDeadlineProbe, constants.CmdNetworkStatus, nil); !errors.Is(err, lowdata.ErrPollSuppressed) {
+			t.Fatalf("低流量设备的读超时探测应被抑制: %v", err)
+		}
+		if !reg.AllowPoll(74001, "04A27401", lowdata.PollRegistrationSolicit, 0, time.Now()) ||
+			!reg.AllowPoll(74001, "04A27401", lowdata.PollHeartbeatConfigQuery, 0, time.Now()) {
+			t.Fatal("必要的主动查询不得被抑制")
+		}
+		if err := g.SendProactivePoll("04A27403", lowdata.PollReadDeadlineProbe, constants.CmdNetworkStatus, nil); err != nil {
+			t.Fatalf("未分配设备的探测应下发: %v", err)
+		}
+		if got := frameCommands(splitDNYFrames(waitFrames(t, control, 1, nil))); got[0] != constants.CmdNetworkStatus {
+			t.Fatalf("应下发0x81探测: % X", got)
+		}
+	})
+
+	t.Run("流量报告", func(t *testing.T) {
+		report := reg.Traffic(lowdata.TrafficFilter{ICCID: lowICCID})
+		if len(report.Connections) != 1 {
+			t.Fatalf("只应报告低流量连接: %+v", report.Connections)
+		}
+		c := report.Connections[0]
+		for _, cmd := range []string{"ack:0x05", "ack:0x06", "ack:0x11", "ack:0x41", "ack:0x42", "ack:0x43", "ack:0x44"} {
+			if c.SuppressedFrames[cmd] != 1 {
+				t.Fatalf("%s 应计入1次抑制: %v", cmd, c.SuppressedFrames)
+			}
+		}
+		if c.SuppressedFrames["time_sync:0x22"] != 1 || c.SuppressedFrames["poll:read_deadline_probe"] != 1 || len(c.SuppressedFrames) != 9 {
+			t.Fatalf("抑制分类错误: %v", c.SuppressedFrames)
+		}
+		// 每帧15字节（14+1字节数据）+40字节报头；探测帧无数据
+		wantSuppressed := int64(8*(15+40) + 14 + 40)
+		if c.SuppressedBytes != wantSuppressed || c.CoalescedWrites != 1 || c.CoalesceSavedBytes != 2*40 ||
+			c.EstimatedBytesSaved != wantSuppressed+80 || c.SentFrames != int64(len(required))+2+3 {
+			t.Fatalf("流量核算错误: %+v", c)
+		}
+		if c.ICCID != lowICCID || c.Source != lowdata.SourceICCID || len(c.DeviceIDs) != 2 {
+			t.Fatalf("连接归属错误: %+v", c)
+		}
+
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		router.RegisterUnifiedAPIHandlers(r)
+		w, resp := callAPI(r, http.MethodGet, "/api/v1/traffic/report?iccid="+lowICCID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("流量报告应返回200: %d", w.Code)
+		}
+		conns, _ := resp.Data["connections"].([]interface{})
+		if len(conns) != 1 || conns[0].(map[string]interface{})["estimatedBytesSaved"].(float64) != float64(wantSuppressed+80) {
+			t.Fatalf("流量报告应包含估算节省字节: %v", resp.Data)
+		}
+	})
+
+	t.Run("设备详情显示模式", func(t *testing.T) {
+		g := gateway.GetGlobalDeviceGateway()
+		detail, err := g.GetDeviceDetailUncached("04A27402")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode, ok := detail["lowDataMode"].(lowdata.Mode); !ok || !mode.Enabled || mode.Source != lowdata.SourceICCID {
+			t.Fatalf("设备详情应显示低流量模式: %v", detail["lowDataMode"])
+		}
+		if detail, _ := g.GetDeviceDetailUncached("04A27403"); detail["lowDataMode"] != nil {
+			t.Fatal("未分配的设备不输出低流量模式")
+		}
+	})
+
+	t.Run("按租户分配", func(t *testing.T) {
+		asset.SetGlobalResolver(stubTenantResolver{"04A27403": {AssetCode: "ST-74", TenantID: "metered"}})
+		defer asset.SetGlobalResolver(nil)
+		if err := reg.SetPolicy(&lowdata.Policy{Tenants: map[string]lowdata.Settings{"metered": {CoalesceOutbound: boolPtr(false)}}}); err != nil {
+			t.Fatal(err)
+		}
+		respond(control, 0x04A27403, []uint8{constants.CmdPowerHeartbeat, constants.CmdSettlement})
+		if got := frameCommands(splitDNYFrames(control.take())); string(got) != string([]uint8{constants.CmdSettlement}) {
+			t.Fatalf("租户分配的连接应抑制可选应答: % X", got)
+		}
+		if report := reg.Traffic(lowdata.TrafficFilter{TenantID: "metered"}); len(report.Connections) != 1 || report.Connections[0].CoalescedWrites != 0 {
+			t.Fatalf("关闭合并后不应合并写入: %+v", report.Connections)
+		}
+	})
+}
+
+// TestLowDataMaxHeartbeat 低流量设备的自适应心跳推荐最大间隔
+func TestLowDataMaxHeartbeat(t *testing.T) {
+	tuner := gateway.NewHeartbeatTuner(config.HeartbeatTuningConfig{Enabled: true, DryRun: true, MaxIntervalSeconds: 900}, nil)
+	now := time.Now()
+	tuner.Evaluate("04A27405", gateway.HeartbeatConnectionMetrics{ConnectedAt: now}, now)
+	tuner.Evaluate("04A27406", gateway.HeartbeatConnectionMetrics{ConnectedAt: now, LowData: true}, now)
+	normal, _ := tuner.Get("04A27405")
+	lowData, _ := tuner.Get("04A27406")
+	if normal.RecommendedInterval == 900 || lowData.RecommendedInterval != 900 || !lowData.LowData {
+		t.Fatalf("低流量设备应推荐最大间隔: normal=%d lowData=%+v", normal.RecommendedInterval, lowData)
+	}
+}
+
+// TestLowDataHotReload 分配文件热加载：变更后立即生效，校验失败保留旧分配；重新加载接口返回422
+func TestLowDataHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "low_data.yaml")
+	if err := os.WriteFile(path, []byte("iccids:\n  \"8986R\": {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := lowdata.NewRegistry(path, lowdata.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg.Watch(ctx, 20*time.Millisecond)
+	if !reg.Resolve("8986R", "").Enabled {
+		t.Fatal("初始分配应生效")
+	}
+
+	if err := os.WriteFile(path, []byte("iccids: {}\nexclude: [\"8986R\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for reg.Resolve("8986R", "").Enabled && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m := reg.Resolve("8986R", ""); m.Enabled || !m.Excluded {
+		t.Fatalf("热加载后应排除: %+v", m)
+	}
+
+	if err := os.WriteFile(path, []byte("iccids:\n  \"8986R\": {}\nexclude: [\"8986R\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lowdata.SetGlobalRegistry(reg)
+	defer lowdata.SetGlobalRegistry(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/low-data/reload", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("校验失败应返回422: %d", w.Code)
+	}
+	if m := reg.Resolve("8986R", ""); !m.Excluded || reg.Status().LastLoadError == "" {
+		t.Fatalf("校验失败应保留旧分配并记录错误: %+v", m)
+	}
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/low-data", "")
+	if classification, _ := resp.Data["classification"].([]interface{}); w.Code != http.StatusOK || len(classification) != 12 {
+		t.Fatalf("应返回分类表: %d %v", w.Code, resp.Data)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+)
+
+// macroTestCommander 以命令管理器登记命令并按需模拟设备应答
+type macroTestCommander struct {
+	conn       *disconnectTestConn
+	physicalID uint32
+
+	mu        sync.Mutex
+	orders    map[int]string
+	params    gateway.MacroPowerParams
+	calls     []string
+	msgID     uint16
+	noAck     map[string]bool // 不应答的调用（按调用描述）
+	readDelay time.Duration
+	queryErr  error
+}
+
+func newMacroTestCommander(connID uint64, physicalID uint32) *macroTestCommander {
+	return &macroTestCommander{
+		conn:       &disconnectTestConn{id: connID},
+		physicalID: physicalID,
+		orders:     make(map[int]string),
+		params:     gateway.MacroPowerParams{MaxChargeTime: 36000, OverloadPower: 2000, OverVoltage: 2700, UnderVoltage: 1000, HasVoltage: true},
+		noAck:      make(map[string]bool),
+	}
+}
+
+func (f *macroTestCommander) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *macroTestCommander) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// register 登记命令，未标记为不应答时模拟设备稍后应答
+func (f *macroTestCommander) register(call string, command uint8, correlationID string) *network.CommandHandle {
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.msgID++
+	msgID := f.msgID
+	ack := !f.noAck[call]
+	f.mu.Unlock()
+
+	cmdMgr := network.GetCommandManager()
+	handle := cmdMgr.RegisterCommandWithOptions(f.conn, f.physicalID, msgID, command, []byte{0x00}, network.CommandOptions{CorrelationID: correlationID})
+	if ack {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cmdMgr.ConfirmCommand(f.physicalID, msgID, command)
+		}()
+	}
+	return handle
+}
+
+func (f *macroTestCommander) ActiveOrders(string) map[int]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	orders := make(map[int]string, len(f.orders))
+	for port, orderNo := range f.orders {
+		orders[port] = orderNo
+	}
+	return orders
+}
+
+func (f *macroTestCommander) StopCharging(correlationID, _ string, port int, orderNo string) (*network.CommandHandle, error) {
+	handle := f.register(fmt.Sprintf("stop:%d:%s", port, orderNo), 0x82, correlationID)
+	f.mu.Lock()
+	delete(f.orders, port)
+	f.mu.Unlock()
+	return handle, nil
+}
+
+func (f *macroTestCommander) ReadPowerParams(_, _ string, timeout time.Duration) (gateway.MacroPowerParams, error) {
+	f.record("read")
+	if f.readDelay > 0 {
+		if f.readDelay > timeout {
+			time.Sleep(timeout)
+			return gateway.MacroPowerParams{}, gateway.ErrConfigReadIncomplete
+		}
+		time.Sleep(f.readDelay)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.params, nil
+}
+
+func (f *macroTestCommander) SetPowerParams(correlationID, _ string, params gateway.MacroPowerParams) (*network.CommandHandle, error) {
+	return f.register(fmt.Sprintf("set:%d", params.OverloadPower), 0x85, correlationID), nil
+}
+
+func (f *macroTestCommander) QueryStatus(_, _ string, _ time.Duration) error {
+	f.record("query")
+	return f.queryErr
+}
+
+func stepStatuses(exec gateway.MacroExecution) map[string]string {
+	statuses := make(map[string]string, len(exec.Steps))
+	for _, s := range exec.Steps {
+		statuses[s.Name] = s.Status
+	}
+	return statuses
+}
+
+func equalCalls(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestSafePortResetMacro 内置宏 safe_port_reset：按序执行、跳过无需执行的步骤、失败中止与回滚、整体超时与设备互斥
+func TestSafePortResetMacro(t *testing.T) {
+	const deviceID = "04A26CF3"
+	cfg := config.MacrosConfig{StepTimeoutSeconds: 1}
+
+	run := func(t *testing.T, engine *gateway.MacroEngine, port int) gateway.MacroExecution {
+		t.Helper()
+		exec, err := engine.Start(gateway.MacroSafePortReset, gateway.MacroRequest{DeviceID: deviceID, Port: port, CorrelationID: "req-macro"})
+		if err != nil {
+			t.Fatalf("启动宏失败: %v", err)
+		}
+		if exec.ID == "" || exec.Status != gateway.MacroStatusRunning {
+			t.Fatalf("应返回进行中的执行记录: %+v", exec)
+		}
+		final, ok := engine.Wait(deviceID, exec.ID, 5*time.Second)
+		if !ok || final.Status == gateway.MacroStatusRunning {
+			t.Fatalf("宏未在时限内结束: %+v", final)
+		}
+		return final
+	}
+
+	t.Run("端口充电中：停止并确认后切断、恢复过载功率并查询状态", func(t *testing.T) {
+		f := newMacroTestCommander(1669001, 0x04A26CF3)
+		f.orders[2] = "ORDER_MACRO_001"
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		engine := gateway.NewMacroEngine(cfg, f)
+
+		exec := run(t, engine, 2)
+		if exec.Status != gateway.MacroStatusSucceeded || exec.RolledBack {
+			t.Fatalf("宏应成功且无回滚: %+v", exec)
+		}
+		for name, status := range stepStatuses(exec) {
+			if status != gateway.MacroStepSucceeded {
+				t.Fatalf("步骤 %s 应成功: %s", name, status)
+			}
+		}
+		want := []string{"stop:2:ORDER_MACRO_001", "read", "set:1", "set:2000", "query"}
+		if got := f.Calls(); !equalCalls(got, want) {
+			t.Fatalf("命令顺序错误: %v", got)
+		}
+	})
+
+	t.Run("端口空闲：跳过停止充电与等待确认", func(t *testing.T) {
+		f := newMacroTestCommander(1669002, 0x04A26CF3)
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		exec := run(t, gateway.NewMacroEngine(cfg, f), 1)
+		statuses := stepStatuses(exec)
+		if exec.Status != gateway.MacroStatusSucceeded || statuses["stop_charge"] != gateway.MacroStepSkipped || statuses["await_stop_confirm"] != gateway.MacroStepSkipped {
+			t.Fatalf("空闲端口应跳过停止步骤: %+v", exec)
+		}
+		if got := f.Calls(); !equalCalls(got, []string{"read", "set:1", "set:2000", "query"}) {
+			t.Fatalf("命令顺序错误: %v", got)
+		}
+	})
+
+	t.Run("切断过载功率未应答：中止并自动恢复运行参数", func(t *testing.T) {
+		f := newMacroTestCommander(1669003, 0x04A26CF3)
+		f.noAck["set:1"] = true
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		exec := run(t, gateway.NewMacroEngine(cfg, f), 1)
+
+		statuses := stepStatuses(exec)
+		if exec.Status != gateway.MacroStatusFailed || exec.FailedStep != "cut_port_power" || !exec.RolledBack {
+			t.Fatalf("应在切断步骤失败并回滚: %+v", exec)
+		}
+		if statuses["restore_port_power"] != gateway.MacroStepAborted || statuses["query_status"] != gateway.MacroStepAborted {
+			t.Fatalf("后续步骤应中止: %+v", statuses)
+		}
+		for _, s := range exec.Steps {
+			if s.Name == "cut_port_power" && s.Rollback != gateway.MacroRollbackSucceeded {
+				t.Fatalf("切断步骤应已回滚: %+v", s)
+			}
+		}
+		if got := f.Calls(); !equalCalls(got, []string{"read", "set:1", "set:2000"}) {
+			t.Fatalf("回滚应恢复读取到的过载功率: %v", got)
+		}
+	})
+
+	t.Run("恢复后状态查询失败：运行参数已恢复，无需回滚", func(t *testing.T) {
+		f := newMacroTestCommander(1669004, 0x04A26CF3)
+		f.queryErr = errors.New("未收到设备心跳")
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		exec := run(t, gateway.NewMacroEngine(cfg, f), 1)
+		if exec.Status != gateway.MacroStatusFailed || exec.FailedStep != "query_status" || exec.RolledBack {
+			t.Fatalf("查询失败时参数已恢复，不应再回滚: %+v", exec)
+		}
+		if got := f.Calls(); !equalCalls(got, []string{"read", "set:1", "set:2000", "query"}) {
+			t.Fatalf("命令顺序错误: %v", got)
+		}
+	})
+
+	t.Run("其他端口充电中：不改动整机过载功率", func(t *testing.T) {
+		f := newMacroTestCommander(1669005, 0x04A26CF3)
+		f.orders[3] = "ORDER_MACRO_OTHER"
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		exec := run(t, gateway.NewMacroEngine(cfg, f), 1)
+		if exec.Status != gateway.MacroStatusFailed || exec.FailedStep != "cut_port_power" || exec.RolledBack {
+			t.Fatalf("其他端口充电时应拒绝切断: %+v", exec)
+		}
+		if got := f.Calls(); !equalCalls(got, []string{"read"}) {
+			t.Fatalf("不应下发任何设置命令: %v", got)
+		}
+	})
+
+	t.Run("整体超时与设备互斥", func(t *testing.T) {
+		f := newMacroTestCommander(1669006, 0x04A26CF3)
+		f.readDelay = 5 * time.Second
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		engine := gateway.NewMacroEngine(config.MacrosConfig{TimeoutSeconds: 1, StepTimeoutSeconds: 10}, f)
+
+		exec, err := engine.Start(gateway.MacroSafePortReset, gateway.MacroRequest{DeviceID: deviceID, Port: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.Start(gateway.MacroSafePortReset, gateway.MacroRequest{DeviceID: deviceID, Port: 1}); !errors.Is(err, gateway.ErrMacroBusy) {
+			t.Fatalf("同一设备进行中时应拒绝: %v", err)
+		}
+		deadline := time.Now().Add(time.Second)
+		live, _ := engine.Get(deviceID, exec.ID)
+		for time.Now().Before(deadline) && stepStatuses(live)["read_power_params"] != gateway.MacroStepRunning {
+			time.Sleep(5 * time.Millisecond)
+			live, _ = engine.Get(deviceID, exec.ID)
+		}
+		if statuses := stepStatuses(live); statuses["read_power_params"] != gateway.MacroStepRunning || statuses["stop_charge"] != gateway.MacroStepSkipped {
+			t.Fatalf("应可查询到正在执行的步骤: %+v", live.Steps)
+		}
+
+		start := time.Now()
+		final, _ := engine.Wait(deviceID, exec.ID, 5*time.Second)
+		if final.Status != gateway.MacroStatusTimeout || time.Since(start) > 2*time.Second {
+			t.Fatalf("应在整体超时后中止: %+v (%s)", final, time.Since(start))
+		}
+		if stepStatuses(final)["cut_port_power"] != gateway.MacroStepAborted {
+			t.Fatalf("超时后的步骤应中止: %+v", final.Steps)
+		}
+		if _, err := engine.Start(gateway.MacroSafePortReset, gateway.MacroRequest{DeviceID: deviceID, Port: 1}); err != nil {
+			t.Fatalf("结束后应允许再次执行: %v", err)
+		}
+	})
+
+	t.Run("参数校验与自定义宏", func(t *testing.T) {
+		f := newMacroTestCommander(1669007, 0x04A26CF3)
+		defer network.GetCommandManager().ClearConnectionCommands(f.conn.id)
+		engine := gateway.NewMacroEngine(config.MacrosConfig{
+			StepTimeoutSeconds: 1,
+			Definitions: []config.MacroDefinitionConfig{
+				{Name: "power_cycle", Steps: []config.MacroStepConfig{{Action: "read_power_params"}, {Action: "set_overload_power", Value: 100}, {Action: "restore_power_params"}}},
+				{Name: "broken", Steps: []config.MacroStepConfig{{Action: "format_disk"}}},
+			},
+		}, f)
+
+		if _, err := engine.Start(gateway.MacroSafePortReset, gateway.MacroRequest{DeviceID: deviceID}); err == nil {
+			t.Fatal("端口级宏未指定端口应拒绝")
+		}
+		if _, err := engine.Start("broken", gateway.MacroRequest{DeviceID: deviceID}); !errors.Is(err, gateway.ErrMacroNotFound) {
+			t.Fatalf("含未知动作的宏不应注册: %v", err)
+		}
+		if _, ok := engine.Get(deviceID, "macro_unknown"); ok {
+			t.Fatal("未知执行ID不应返回")
+		}
+
+		exec, err := engine.Start("power_cycle", gateway.MacroRequest{DeviceID: deviceID})
+		if err != nil {
+			t.Fatalf("设备级自定义宏无需端口: %v", err)
+		}
+		if final, _ := engine.Wait(deviceID, exec.ID, 5*time.Second); final.Status != gateway.MacroStatusSucceeded {
+			t.Fatalf("自定义宏应成功: %+v", final)
+		}
+		if got := f.Calls(); !equalCalls(got, []string{"read", "set:100", "set:2000"}) {
+			t.Fatalf("命令顺序错误: %v", got)
+		}
+	})
+
+	t.Run("网关内置宏", func(t *testing.T) {
+		defs := gateway.NewDeviceGateway().GetMacroEngine().Definitions()
+		if len(defs) == 0 || defs[0].Name != gateway.MacroSafePortReset || !defs[0].NeedsPort || !defs[0].Builtin || len(defs[0].Steps) != 6 {
+			t.Fatalf("网关应注册内置宏 safe_port_reset: %+v", defs)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+)
+
+// TestMessageIDSequenceRestart 模拟重启：重启后的首个消息ID不得与重启前最近分配的ID重复
+func TestMessageIDSequenceRestart(t *testing.T) {
+	const gap = 200
+	store := msgid.NewFileStore(filepath.Join(t.TempDir(), "message_id.json"))
+
+	// issue 分配 n 个ID并返回（按分配顺序）
+	issue := func(s *msgid.Sequence, n int) []uint16 {
+		ids := make([]uint16, n)
+		for i := range ids {
+			ids[i] = s.Next()
+		}
+		return ids
+	}
+	// assertNoReuse 首个ID不在重启前最近分配的ID中
+	assertNoReuse := func(first uint16, recent []uint16) {
+		t.Helper()
+		for _, id := range recent {
+			if id == first {
+				t.Fatalf("重启后首个消息ID %d 与重启前最近分配的ID重复", first)
+			}
+		}
+	}
+
+	t.Run("异常退出", func(t *testing.T) {
+		before, err := msgid.NewSequence(store, msgid.Options{RestoreGap: gap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := before.Status(); status.RestoredFrom != nil {
+			t.Fatalf("无持久化记录时不应恢复: %+v", status)
+		}
+		issued := issue(before, 500)
+		if err := before.Save(); err != nil { // 定期持久化
+			t.Fatal(err)
+		}
+		issued = append(issued, issue(before, gap-1)...) // 未来得及持久化即崩溃
+
+		after, err := msgid.NewSequence(store, msgid.Options{RestoreGap: gap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := after.Status()
+		if status.RestoredFrom == nil || *status.RestoredFrom != 500 || status.StartPosition != 500+gap {
+			t.Fatalf("应从持久化值跳跃恢复: %+v", status)
+		}
+		assertNoReuse(after.Next(), issued)
+	})
+
+	t.Run("正常停机", func(t *testing.T) {
+		before, err := msgid.NewSequence(store, msgid.Options{RestoreGap: gap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		issued := issue(before, 300)
+		if err := before.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		after, err := msgid.NewSequence(store, msgid.Options{RestoreGap: gap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first := after.Next(); first != issued[len(issued)-1]+gap+1 {
+			t.Fatalf("停机后恢复的首个ID %d，应为 %d", first, issued[len(issued)-1]+gap+1)
+		}
+	})
+
+	t.Run("跨越回绕", func(t *testing.T) {
+		if err := store.Save(msgid.Record{LastMessageID: 65500}); err != nil {
+			t.Fatal(err)
+		}
+		after, err := msgid.NewSequence(store, msgid.Options{RestoreGap: gap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := issue(after, 3)
+		if ids[0] != 65500+gap+1-65535 || ids[0] == 0 || ids[1] != ids[0]+1 {
+			t.Fatalf("回绕后的ID错误: %v", ids)
+		}
+	})
+
+	t.Run("诊断信息", func(t *testing.T) {
+		stats := gateway.GetGlobalDeviceGateway().GetDeviceStatistics()
+		if _, ok := stats["messageIdSequence"].(msgid.Status); !ok {
+			t.Fatalf("网关统计应包含消息ID序列位置: %v", stats["messageIdSequence"])
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// TestNotificationEndpointIsolation 单个端点挂起时，其他端点的投递延迟不受影响；挂起端点熔断后快速失败，恢复后经探测关闭熔断
+func TestNotificationEndpointIsolation(t *testing.T) {
+	var hung atomic.Bool
+	hung.Store(true)
+	var slowHits atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowHits.Add(1)
+		if hung.Load() {
+			select { // 一直挂起，直到客户端超时或测试结束
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	healthyA, healthyB := newRoutingSink(http.StatusOK), newRoutingSink(http.StatusOK)
+	defer healthyA.server.Close()
+	defer healthyB.server.Close()
+
+	cfg := &notification.NotificationConfig{
+		Enabled: true,
+		Workers: 1,
+		Endpoints: []notification.NotificationEndpoint{
+			{Name: "slow", URL: slow.URL, Timeout: 300 * time.Millisecond, EventTypes: []string{"*"}, Enabled: true, Concurrency: 1},
+			{Name: "healthy_a", URL: healthyA.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true},
+			{Name: "healthy_b", URL: healthyB.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true},
+		},
+		Retry: notification.RetryConfig{MaxAttempts: 1, InitialInterval: time.Hour},
+		CircuitBreaker: notification.CircuitBreakerConfig{
+			Enabled:             true,
+			ConsecutiveFailures: 2,
+			CoolDown:            400 * time.Millisecond,
+			HalfOpenProbes:      1,
+		},
+	}
+	svc, err := notification.NewNotificationService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = svc.Stop(context.Background()) }()
+
+	const total = 20
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		if err := svc.SendNotification(&notification.NotificationEvent{EventType: notification.EventTypePortStatusChange, DeviceID: "04A26CF3"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && (len(healthyA.events()) < total || len(healthyB.events()) < total) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 挂起端点单次超时为300ms；若与健康端点共用投递协程，20条事件需要数秒
+	if elapsed := time.Since(start); len(healthyA.events()) != total || len(healthyB.events()) != total || elapsed > time.Second {
+		t.Fatalf("健康端点投递被挂起端点拖慢: a=%d b=%d elapsed=%s", len(healthyA.events()), len(healthyB.events()), elapsed)
+	}
+
+	// 连续2次超时后熔断，其余事件快速失败，不再请求挂起端点
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && svc.GetStats().EndpointStats["slow"].ShortCircuited < total-2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := svc.GetStats().EndpointStats["slow"]
+	if stats.CircuitState != notification.CircuitOpen || stats.CircuitOpenedAt == nil || stats.ConsecutiveFailures != 2 {
+		t.Fatalf("挂起端点应处于熔断状态: %+v", stats)
+	}
+	if stats.ShortCircuited != total-2 || slowHits.Load() != 2 {
+		t.Fatalf("熔断期间应快速失败: short=%d hits=%d", stats.ShortCircuited, slowHits.Load())
+	}
+	if healthy := svc.GetStats().EndpointStats["healthy_a"]; healthy.CircuitState != notification.CircuitClosed {
+		t.Fatalf("健康端点不应熔断: %+v", healthy)
+	}
+
+	// 端点恢复：冷却后探测请求成功，熔断关闭
+	hung.Store(false)
+	time.Sleep(450 * time.Millisecond)
+	_ = svc.SendNotification(&notification.NotificationEvent{EventType: notification.EventTypePortStatusChange, DeviceID: "04A26CF3"})
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && svc.GetStats().EndpointStats["slow"].TotalSuccess < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats = svc.GetStats().EndpointStats["slow"]
+	if stats.CircuitState != notification.CircuitClosed || stats.CircuitOpenedAt != nil || stats.ConsecutiveFailures != 0 || stats.TotalSuccess != 1 {
+		t.Fatalf("端点恢复后熔断应关闭: %+v", stats)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// flakyEndpoint 前 failures 次请求返回503，之后成功并记录投递的事件ID
+type flakyEndpoint struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	failures  int
+	requests  int
+	delivered []string
+}
+
+func newFlakyEndpoint(failures int) *flakyEndpoint {
+	e := &flakyEndpoint{failures: failures}
+	e.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			EventID string `json:"event_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.requests++
+		if e.failures < 0 || e.requests <= e.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		e.delivered = append(e.delivered, payload.EventID)
+		w.WriteHeader(http.StatusOK)
+	}))
+	return e
+}
+
+func (e *flakyEndpoint) snapshot() (requests int, delivered []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.requests, append([]string(nil), e.delivered...)
+}
+
+// TestNotificationDeadLetter 端点失败后按指数退避重试：恢复后只投递一次并计入端点重试数；重试用尽的关键事件写入死信，
+// 非关键事件不写入；Redis死信列表按上限截断，旧版按端点的死信ZSET在启动时并入列表
+func TestNotificationDeadLetter(t *testing.T) {
+	quietLogger(t)
+	start := func(t *testing.T, endpoint *flakyEndpoint, maxAttempts int, deadLetter notification.DeadLetterConfig, redis *goredis.Client) *notification.NotificationService {
+		t.Helper()
+		svc, err := notification.NewNotificationService(&notification.NotificationConfig{
+			Enabled: true,
+			Workers: 1,
+			Endpoints: []notification.NotificationEndpoint{
+				{Name: "billing", URL: endpoint.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true},
+			},
+			Retry:      notification.RetryConfig{MaxAttempts: maxAttempts, InitialInterval: time.Millisecond, MaxInterval: 10 * time.Millisecond, Multiplier: 2},
+			DeadLetter: deadLetter,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if redis != nil {
+			svc.SetRedisClient(redis)
+		}
+		if err := svc.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = svc.Stop(context.Background()) })
+		return svc
+	}
+	waitFor := func(cond func() bool) {
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) && !cond() {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("失败两次后成功只投递一次", func(t *testing.T) {
+		endpoint := newFlakyEndpoint(2)
+		defer endpoint.server.Close()
+		deadLetterFile := filepath.Join(t.TempDir(), "deadletter.jsonl")
+		svc := start(t, endpoint, 3, notification.DeadLetterConfig{File: deadLetterFile}, nil)
+
+		if err := svc.SendNotification(&notification.NotificationEvent{EventID: "settle-1", EventType: notification.EventTypeSettlement, DeviceID: "04A27161"}); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(func() bool { return svc.GetStats().EndpointStats["billing"].TotalSuccess == 1 })
+		time.Sleep(50 * time.Millisecond) // 确认没有多余的重试
+
+		requests, delivered := endpoint.snapshot()
+		if requests != 3 || len(delivered) != 1 || delivered[0] != "settle-1" {
+			t.Fatalf("事件应在第3次请求时投递且仅投递一次: requests=%d delivered=%v", requests, delivered)
+		}
+		stats := svc.GetStats()
+		es := stats.EndpointStats["billing"]
+		if es.TotalRetried != 2 || es.TotalFailed != 2 || es.DeadLettered != 0 || stats.TotalRetried != 2 || stats.TotalDeadLettered != 0 {
+			t.Fatalf("重试计数错误: endpoint=%+v total_retried=%d", es, stats.TotalRetried)
+		}
+	})
+
+	t.Run("端点持续不可用时写入死信", func(t *testing.T) {
+		endpoint := newFlakyEndpoint(-1)
+		defer endpoint.server.Close()
+		deadLetterFile := filepath.Join(t.TempDir(), "dlq", "deadletter.jsonl")
+		svc := start(t, endpoint, 2, notification.DeadLetterConfig{File: deadLetterFile}, nil)
+
+		if err := svc.SendNotification(&notification.NotificationEvent{EventID: "settle-2", EventType: notification.EventTypeSettlement, DeviceID: "04A27161", Data: map[string]interface{}{"orderNo": "ORD-1761"}}); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(func() bool { return svc.GetStats().TotalDeadLettered == 1 })
+
+		stats := svc.GetStats()
+		es := stats.EndpointStats["billing"]
+		if es.DeadLettered != 1 || es.TotalRetried != 1 || es.TotalFailed != 2 {
+			t.Fatalf("死信计数错误: %+v", es)
+		}
+		entries, err := notification.ReadDeadLetterFile(deadLetterFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("应有一条死信记录: %+v", entries)
+		}
+		entry := entries[0]
+		if entry.Event == nil || entry.Event.EventID != "settle-2" || entry.Event.Data["orderNo"] != "ORD-1761" ||
+			entry.Endpoint != "billing" || entry.URL != endpoint.server.URL || entry.Attempts != 2 || entry.DeadLetteredAt.IsZero() {
+			t.Fatalf("死信记录内容错误: %+v", entry)
+		}
+	})
+	t.Run("非关键事件不写入死信", func(t *testing.T) {
+		endpoint := newFlakyEndpoint(-1)
+		defer endpoint.server.Close()
+		deadLetterFile := filepath.Join(t.TempDir(), "deadletter.jsonl")
+		svc := start(t, endpoint, 1, notification.DeadLetterConfig{File: deadLetterFile}, nil)
+
+		if err := svc.SendNotification(&notification.NotificationEvent{EventID: "hb-1", EventType: notification.EventTypeDeviceHeartbeat, DeviceID: "04A27161"}); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(func() bool { return svc.GetStats().EndpointStats["billing"].TotalFailed == 1 })
+		time.Sleep(50 * time.Millisecond)
+
+		if stats := svc.GetStats(); stats.TotalDeadLettered != 0 {
+			t.Fatalf("非关键事件不应计入死信: %d", stats.TotalDeadLettered)
+		}
+		if entries, _ := notification.ReadDeadLetterFile(deadLetterFile); len(entries) != 0 {
+			t.Fatalf("非关键事件不应写入死信文件: %+v", entries)
+		}
+	})
+
+	t.Run("Redis死信列表截断并迁移旧版死信队列", func(t *testing.T) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("启动miniredis失败: %v", err)
+		}
+		defer mr.Close()
+		client := goredis.NewClient(&goredis.Options{Addr: mr.Addr(), MaxRetries: -1, DialTimeout: 200 * time.Millisecond, ReadTimeout: 200 * time.Millisecond})
+		defer client.Close()
+
+		legacy, _ := json.Marshal(map[string]interface{}{
+			"event":    notification.NotificationEvent{EventID: "legacy-1", EventType: notification.EventTypeSettlement, DeviceID: "04A27161"},
+			"endpoint": notification.NotificationEndpoint{Name: "billing", URL: "http://legacy.example/notify"},
+			"attempt":  5,
+		})
+		if _, err := mr.ZAdd("notify:dlq:billing", 1, string(legacy)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mr.ZAdd("notify:dlq:billing", 2, "not-json"); err != nil {
+			t.Fatal(err)
+		}
+
+		endpoint := newFlakyEndpoint(-1)
+		defer endpoint.server.Close()
+		svc := start(t, endpoint, 1, notification.DeadLetterConfig{RedisKey: "notify:deadletter", MaxEntries: 2}, client)
+
+		ctx := context.Background()
+		raw, err := client.LRange(ctx, "notify:deadletter", 0, -1).Result()
+		if err != nil || len(raw) != 1 {
+			t.Fatalf("旧版死信应在启动时并入列表: %v %v", raw, err)
+		}
+		var migrated notification.DeadLetterEntry
+		if err := json.Unmarshal([]byte(raw[0]), &migrated); err != nil {
+			t.Fatal(err)
+		}
+		if !migrated.Migrated || migrated.Event == nil || migrated.Event.EventID != "legacy-1" || migrated.Endpoint != "billing" ||
+			migrated.URL != "http://legacy.example/notify" || migrated.Attempts != 5 {
+			t.Fatalf("迁移的死信记录内容错误: %+v", migrated)
+		}
+		if members, _ := mr.ZMembers("notify:dlq:billing"); len(members) != 1 || members[0] != "not-json" {
+			t.Fatalf("已迁移的成员应移除，无法解析的成员应保留: %v", members)
+		}
+
+		for _, id := range []string{"settle-3", "settle-4"} {
+			if err := svc.SendNotification(&notification.NotificationEvent{EventID: id, EventType: notification.EventTypeSettlement, DeviceID: "04A27161"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitFor(func() bool { return svc.GetStats().TotalDeadLettered == 2 })
+
+		raw, err = client.LRange(ctx, "notify:deadletter", 0, -1).Result()
+		if err != nil || len(raw) != 2 {
+			t.Fatalf("死信列表应截断到2条: %v %v", raw, err)
+		}
+		for _, line := range raw {
+			var entry notification.DeadLetterEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Migrated || (entry.Event.EventID != "settle-3" && entry.Event.EventID != "settle-4") {
+				t.Fatalf("截断应丢弃最旧的记录: %+v", entry)
+			}
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// fanOutSink 记录到达时间的通知接收端
+type fanOutSink struct {
+	mu       sync.Mutex
+	received []fanOutDelivery
+	server   *httptest.Server
+}
+
+type fanOutDelivery struct {
+	at    time.Time
+	event notification.NotificationEvent
+}
+
+func newFanOutSink() *fanOutSink {
+	s := &fanOutSink{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notification.NotificationEvent
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		s.mu.Lock()
+		s.received = append(s.received, fanOutDelivery{at: time.Now(), event: event})
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func (s *fanOutSink) deliveries() []fanOutDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fanOutDelivery(nil), s.received...)
+}
+
+func (s *fanOutSink) waitFor(t *testing.T, n int, timeout time.Duration) []fanOutDelivery {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) && len(s.deliveries()) < n {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return s.deliveries()
+}
+
+func startFanOutService(t *testing.T, sink *fanOutSink, fanOut notification.FanOutConfig) *notification.NotificationService {
+	t.Helper()
+	fanOut.Enabled = true
+	svc, err := notification.NewNotificationService(&notification.NotificationConfig{
+		Enabled:   true,
+		Workers:   1,
+		Endpoints: []notification.NotificationEndpoint{{Name: "ops", URL: sink.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true, Concurrency: 4}},
+		Retry:     notification.RetryConfig{MaxAttempts: 1, InitialInterval: time.Hour},
+		FanOut:    fanOut,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = svc.Stop(context.Background()) })
+	return svc
+}
+
+// TestNotificationFanOutMassOnline 500台设备同时上线：按令牌桶速率平滑投递，不超过任一秒的速率+突发上限；突发期间的结算事件优先投递
+func TestNotificationFanOutMassOnline(t *testing.T) {
+	sink := newFanOutSink()
+	defer sink.server.Close()
+	const (
+		devices = 500
+		rate    = 200
+		burst   = 20
+	)
+	svc := startFanOutService(t, sink, notification.FanOutConfig{RatePerSecond: rate, Burst: burst, QueueDepth: devices})
+
+	start := time.Now()
+	for i := 0; i < devices; i++ {
+		if err := svc.SendNotification(&notification.NotificationEvent{EventType: notification.EventTypeDeviceOnline, DeviceID: fmt.Sprintf("04B1%04d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(300 * time.Millisecond) // 上线事件排队中
+	settledAt := time.Now()
+	_ = svc.SendNotification(&notification.NotificationEvent{EventType: notification.EventTypeSettlement, DeviceID: "04B10001", PortNumber: 1})
+
+	got := sink.waitFor(t, devices+1, 5*time.Second)
+	if len(got) != devices+1 {
+		t.Fatalf("应全部投递: %d", len(got))
+	}
+	if elapsed := got[len(got)-1].at.Sub(start); elapsed < time.Duration(devices-burst)*time.Second/rate-200*time.Millisecond {
+		t.Fatalf("投递未按速率限制: %s", elapsed)
+	}
+	// 任意1秒窗口内的投递数不超过速率+突发容量（接收端时间戳含HTTP投递抖动，留少量余量）
+	const jitter = 10
+	for i := range got {
+		n := 0
+		for j := i; j < len(got) && got[j].at.Sub(got[i].at) < time.Second; j++ {
+			n++
+		}
+		if n > rate+burst+jitter {
+			t.Fatalf("1秒内投递 %d 条，超过上限 %d", n, rate+burst)
+		}
+	}
+	// 结算事件抢占排队中的上线事件
+	for i, d := range got {
+		if d.event.EventType != notification.EventTypeSettlement {
+			continue
+		}
+		if d.at.Sub(settledAt) > 200*time.Millisecond || i > devices/2 {
+			t.Fatalf("结算事件应优先投递: 第%d条, 延迟%s", i, d.at.Sub(settledAt))
+		}
+	}
+
+	fanOut := svc.GetStats().FanOut
+	info, critical := fanOut.Classes[notification.PriorityInformational], fanOut.Classes[notification.PriorityCritical]
+	if info.Admitted+info.Dequeued != devices || info.Queued == 0 || info.Digested != 0 || info.QueueLength != 0 {
+		t.Fatalf("信息类事件统计错误: %+v", info)
+	}
+	if critical.Admitted+critical.Dequeued != 1 || fanOut.RatePerSecond != rate || fanOut.Burst != burst {
+		t.Fatalf("限流统计错误: %+v %+v", fanOut, critical)
+	}
+}
+
+// TestNotificationFanOutDigest 低优先级事件排队已满后降级为按端点汇总的摘要事件
+func TestNotificationFanOutDigest(t *testing.T) {
+	sink := newFanOutSink()
+	defer sink.server.Close()
+	svc := startFanOutService(t, sink, notification.FanOutConfig{RatePerSecond: 10, Burst: 1, QueueDepth: 5, DigestInterval: 200 * time.Millisecond})
+
+	const total = 40
+	for i := 0; i < total; i++ {
+		_ = svc.SendNotification(&notification.NotificationEvent{EventType: notification.EventTypePortHeartbeat, DeviceID: fmt.Sprintf("04B2%04d", i), PortNumber: 1})
+	}
+	got := sink.waitFor(t, 1+5+1, 3*time.Second)
+	var digest *notification.NotificationEvent
+	for i := range got {
+		if got[i].event.EventType == notification.EventTypeNotificationDigest {
+			digest = &got[i].event
+		}
+	}
+	if len(got) != 7 || digest == nil {
+		t.Fatalf("应投递1条直通、5条排队与1条摘要: %d", len(got))
+	}
+	if digest.Data["total"] != float64(total-6) || digest.Data["device_count"] != float64(total-6) || digest.Data["endpoint"] != "ops" {
+		t.Fatalf("摘要内容错误: %+v", digest.Data)
+	}
+
+	fanOut := svc.GetStats().FanOut
+	info := fanOut.Classes[notification.PriorityInformational]
+	if info.Admitted != 1 || info.Queued != 5 || info.Dequeued != 5 || info.Digested != total-6 || fanOut.DigestsSent != 1 || fanOut.PendingDigest != nil {
+		t.Fatalf("摘要统计错误: %+v %+v", fanOut, info)
+	}
+}
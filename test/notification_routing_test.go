@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+type stubTenantResolver map[string]asset.AssetInfo
+
+func (r stubTenantResolver) Resolve(deviceID string) (asset.AssetInfo, bool) {
+	info, ok := r[deviceID]
+	return info, ok
+}
+
+// routingSink 记录端点收到的事件ID
+type routingSink struct {
+	mu       sync.Mutex
+	received []string
+	server   *httptest.Server
+}
+
+func newRoutingSink(status int) *routingSink {
+	s := &routingSink{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			EventID string `json:"event_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		s.received = append(s.received, body.EventID)
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *routingSink) events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// TestNotificationRouting 按租户/设备类型/事件类型路由通知
+func TestNotificationRouting(t *testing.T) {
+	asset.SetGlobalResolver(stubTenantResolver{"04A26CF3": {AssetCode: "ST-1", TenantID: "operator-a"}})
+	defer asset.SetGlobalResolver(nil)
+
+	opsSink, aSink, bSink := newRoutingSink(http.StatusOK), newRoutingSink(http.StatusOK), newRoutingSink(http.StatusInternalServerError)
+	defer opsSink.server.Close()
+	defer aSink.server.Close()
+	defer bSink.server.Close()
+
+	cfg := &notification.NotificationConfig{
+		Enabled: true,
+		Endpoints: []notification.NotificationEndpoint{
+			{Name: "ops", URL: opsSink.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true},
+			{Name: "operator_a", URL: aSink.server.URL, Timeout: time.Second, EventTypes: []string{notification.EventTypeChargingStart}, Tenants: []string{"operator-a"}, Enabled: true},
+			{Name: "operator_b", URL: bSink.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Tenants: []string{"operator-b"}, DeviceTypes: []string{"4"}, Enabled: true},
+		},
+		Retry: notification.RetryConfig{MaxAttempts: 1, InitialInterval: time.Hour},
+	}
+
+	t.Run("路由判定", func(t *testing.T) {
+		matched := func(event notification.NotificationEvent) map[string]bool {
+			result := map[string]bool{}
+			for _, d := range cfg.ExplainRoute(&event) {
+				if d.Matched {
+					result[d.Endpoint] = true
+				} else if d.Reason == "" {
+					t.Fatalf("未匹配的端点应给出原因: %+v", d)
+				}
+			}
+			return result
+		}
+		if m := matched(notification.NotificationEvent{EventType: notification.EventTypeChargingStart, TenantID: "operator-a"}); !m["ops"] || !m["operator_a"] || m["operator_b"] {
+			t.Fatalf("租户A事件路由错误: %v", m)
+		}
+		if m := matched(notification.NotificationEvent{EventType: notification.EventTypeChargingStart}); !m["ops"] || m["operator_a"] || m["operator_b"] {
+			t.Fatalf("未标注租户的事件只应投递给不限租户的端点: %v", m)
+		}
+		if m := matched(notification.NotificationEvent{EventType: notification.EventTypeSettlement, TenantID: "operator-b", DeviceType: "5"}); m["operator_b"] {
+			t.Fatalf("设备类型不匹配时不应投递: %v", m)
+		}
+		if len(cfg.RouteEvent(&notification.NotificationEvent{EventType: notification.EventTypeChargingStart, TenantID: "operator-b", DeviceType: "4"})) != 2 {
+			t.Fatal("租户B、设备类型4的事件应投递给 ops 与 operator_b")
+		}
+	})
+
+	t.Run("投递与租户统计", func(t *testing.T) {
+		svc, err := notification.NewNotificationService(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = svc.Stop(context.Background()) }()
+
+		// 租户由资产映射在源头补全
+		_ = svc.SendNotification(&notification.NotificationEvent{EventID: "a-1", EventType: notification.EventTypeChargingStart, DeviceID: "04A26CF3"})
+		_ = svc.SendNotification(&notification.NotificationEvent{EventID: "b-1", EventType: notification.EventTypePortStatusChange, DeviceID: "04A26CF4", TenantID: "operator-b", DeviceType: "4"})
+
+		// 无端点匹配（ops 关闭后只剩租户端点）
+		unroutedCfg := &notification.NotificationConfig{Enabled: true, Endpoints: cfg.Endpoints[1:]}
+		unroutedSvc, _ := notification.NewNotificationService(unroutedCfg)
+		_ = unroutedSvc.Start(context.Background())
+		_ = unroutedSvc.SendNotification(&notification.NotificationEvent{EventType: notification.EventTypeChargingStart, DeviceID: "04FFFFFF"})
+
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) && (svc.GetStats().TotalSent < 4 || unroutedSvc.GetStats().Unrouted < 1) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		_ = unroutedSvc.Stop(context.Background())
+
+		if got := aSink.events(); len(got) != 1 || got[0] != "a-1" {
+			t.Fatalf("运营商A端点只应收到A的事件: %v", got)
+		}
+		if got := bSink.events(); len(got) != 1 || got[0] != "b-1" {
+			t.Fatalf("运营商B端点只应收到B的事件: %v", got)
+		}
+		if unroutedSvc.GetStats().Unrouted != 1 {
+			t.Fatal("无端点匹配的事件应计为未路由")
+		}
+
+		stats := svc.GetStats()
+		a, b := stats.TenantStats["operator-a"], stats.TenantStats["operator-b"]
+		if a == nil || a.Delivered != 2 || a.Failed != 0 {
+			t.Fatalf("租户A统计错误: %+v", a)
+		}
+		if b == nil || b.Delivered != 1 || b.Failed != 1 {
+			t.Fatalf("租户B统计错误: %+v", b)
+		}
+		if stats.EndpointStats["operator_b"].TotalFailed != 1 || stats.EndpointStats["ops"].TotalSuccess != 2 {
+			t.Fatalf("端点统计错误: %+v %+v", stats.EndpointStats["operator_b"], stats.EndpointStats["ops"])
+		}
+	})
+}
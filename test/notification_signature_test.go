@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// signedRequest 接收端记录的请求
+type signedRequest struct {
+	eventType string
+	body      []byte
+	header    http.Header
+}
+
+// signatureSink 记录收到的请求（含请求头与原始请求体）
+type signatureSink struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []signedRequest
+}
+
+func newSignatureSink() *signatureSink {
+	s := &signatureSink{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload struct {
+			EventType string `json:"event_type"`
+		}
+		_ = json.Unmarshal(body, &payload)
+		s.mu.Lock()
+		s.requests = append(s.requests, signedRequest{eventType: payload.EventType, body: body, header: r.Header.Clone()})
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func (s *signatureSink) received() []signedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]signedRequest(nil), s.requests...)
+}
+
+// TestNotificationSignature 端点 webhook 签名与事件类型过滤：签名与参考值一致，未订阅的事件不投递也不计入统计，未配置密钥的端点不带签名头
+func TestNotificationSignature(t *testing.T) {
+	quietLogger(t)
+	const secret = "partner-secret"
+
+	t.Run("签名与参考值一致", func(t *testing.T) {
+		body := []byte(`{"event_id":"evt-1","event_type":"settlement"}`)
+		// 参考值：HMAC-SHA256("partner-secret", "1760500000.<body>")
+		const reference = "391ba3af10b111af0c1c79ccd4ac7c2d6a01270c2fd382203542834160a615ca"
+		if got := notification.SignPayload(secret, 1760500000, body); got != reference {
+			t.Fatalf("签名与参考值不一致: %s", got)
+		}
+		signedAt := time.Unix(1760500000, 0)
+		if !notification.VerifySignature(secret, 1760500000, body, reference, signedAt.Add(time.Minute), 5*time.Minute) {
+			t.Fatal("时间窗口内的正确签名应校验通过")
+		}
+		if notification.VerifySignature(secret, 1760500000, append(body, ' '), reference, signedAt, 5*time.Minute) {
+			t.Fatal("请求体被篡改应校验失败")
+		}
+		if notification.VerifySignature(secret, 1760500000, body, reference, signedAt.Add(10*time.Minute), 5*time.Minute) {
+			t.Fatal("超出时间窗口应视为重放")
+		}
+	})
+
+	t.Run("过滤与签名投递", func(t *testing.T) {
+		partner := newSignatureSink()
+		defer partner.server.Close()
+		plain := newSignatureSink()
+		defer plain.server.Close()
+
+		svc, err := notification.NewNotificationService(&notification.NotificationConfig{
+			Enabled: true,
+			Workers: 1,
+			Endpoints: []notification.NotificationEndpoint{
+				{Name: "partner", URL: partner.server.URL, Timeout: time.Second, EventTypes: []string{notification.EventTypeSettlement}, Enabled: true, Secret: secret},
+				{Name: "plain", URL: plain.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true},
+			},
+			Retry: notification.RetryConfig{MaxAttempts: 1, InitialInterval: time.Hour},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = svc.Stop(context.Background()) }()
+
+		for _, eventType := range []string{notification.EventTypeDeviceHeartbeat, notification.EventTypeSettlement} {
+			if err := svc.SendNotification(&notification.NotificationEvent{EventType: eventType, DeviceID: "04A27162"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) && (len(partner.received()) < 1 || len(plain.received()) < 2) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond) // 确认心跳不会迟到
+
+		got := partner.received()
+		if len(got) != 1 || got[0].eventType != notification.EventTypeSettlement {
+			t.Fatalf("签名端点只应收到结算事件: %+v", got)
+		}
+		timestamp, err := strconv.ParseInt(got[0].header.Get(notification.HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Fatalf("缺少签名时间戳: %v", got[0].header)
+		}
+		if sig := got[0].header.Get(notification.HeaderSignature); sig != notification.SignPayload(secret, timestamp, got[0].body) {
+			t.Fatalf("签名与请求体不一致: %s", sig)
+		}
+		if stats := svc.GetStats().EndpointStats["partner"]; stats.TotalSent != 1 || stats.TotalSuccess != 1 {
+			t.Fatalf("被过滤的事件不应计入端点发送数: %+v", stats)
+		}
+
+		plainGot := plain.received()
+		if len(plainGot) != 2 {
+			t.Fatalf("未配置过滤的端点应收到全部事件: %+v", plainGot)
+		}
+		for _, req := range plainGot {
+			if req.header.Get(notification.HeaderSignature) != "" || req.header.Get(notification.HeaderTimestamp) != "" {
+				t.Fatalf("未配置密钥的端点不应携带签名头: %v", req.header)
+			}
+		}
+	})
+}
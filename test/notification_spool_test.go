@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+)
+
+// TestNotificationSpool 重试用尽事件的磁盘暂存：容量上限轮转、重启后加载、实时与暂存重复投递去重
+func TestNotificationSpool(t *testing.T) {
+	t.Run("达到容量上限时丢弃最旧日志段", func(t *testing.T) {
+		dir := t.TempDir()
+		spool, err := notification.OpenSpool(dir, 16<<10, 4<<10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			err := spool.Append(notification.SpoolEntry{
+				Event:    &notification.NotificationEvent{EventID: fmt.Sprintf("evt-%03d", i), EventType: notification.EventTypePowerHeartbeat, DeviceID: "04A26CF3", Timestamp: time.Now()},
+				Endpoint: "billing",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		stats := spool.Stats()
+		if stats.Bytes > 16<<10 || stats.Segments < 2 {
+			t.Fatalf("暂存应轮转并受容量上限约束: %+v", stats)
+		}
+		if stats.Dropped == 0 || stats.Dropped+int64(stats.Events) != 200 {
+			t.Fatalf("丢弃计数错误: %+v", stats)
+		}
+
+		// 重启后从磁盘加载
+		reopened, err := notification.OpenSpool(dir, 16<<10, 4<<10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reopened.Stats(); got.Events != stats.Events || got.Bytes != stats.Bytes {
+			t.Fatalf("重新打开后暂存不一致: %+v vs %+v", got, stats)
+		}
+	})
+
+	t.Run("实时与暂存均投递成功时只投递一次", func(t *testing.T) {
+		sink := newRoutingSink(http.StatusOK)
+		defer sink.server.Close()
+		var failing atomic.Bool
+		failing.Store(true)
+		upstream := sink.server.Config.Handler
+		sink.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			upstream.ServeHTTP(w, r)
+		})
+
+		cfg := &notification.NotificationConfig{
+			Enabled: true,
+			Endpoints: []notification.NotificationEndpoint{
+				{Name: "billing", URL: sink.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true, RateLimitPerSecond: 100},
+			},
+			Retry: notification.RetryConfig{MaxAttempts: 1, InitialInterval: time.Millisecond},
+			Spool: notification.SpoolConfig{Enabled: true, Dir: t.TempDir(), ReplayInterval: time.Hour},
+		}
+		svc, err := notification.NewNotificationService(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = svc.Stop(context.Background()) }()
+
+		for _, id := range []string{"spool-1", "spool-2"} {
+			_ = svc.SendNotification(&notification.NotificationEvent{EventID: id, EventType: notification.EventTypeSettlement, DeviceID: "04A26CF3"})
+		}
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			if usage, _ := svc.SpoolUsage(); usage.Events == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if usage, ok := svc.SpoolUsage(); !ok || usage.Events != 2 {
+			t.Fatalf("重试用尽的事件应写入暂存: %+v", usage)
+		}
+
+		// 端点恢复后 spool-1 先经实时链路重发成功，暂存重放时应跳过
+		failing.Store(false)
+		_ = svc.SendNotification(&notification.NotificationEvent{EventID: "spool-1", EventType: notification.EventTypeSettlement, DeviceID: "04A26CF3"})
+		deadline = time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) && len(sink.events()) < 1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		result, err := svc.ReplaySpool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Delivered != 1 || result.Duplicates != 1 || result.Remaining != 0 {
+			t.Fatalf("重放结果错误: %+v", result)
+		}
+
+		// spool-2 已由暂存投递，实时链路再次发送时应被抑制
+		_ = svc.SendNotification(&notification.NotificationEvent{EventID: "spool-2", EventType: notification.EventTypeSettlement, DeviceID: "04A26CF3"})
+		deadline = time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) && svc.GetStats().SuppressedDuplicates < 1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if got := sink.events(); len(got) != 2 || got[0] != "spool-1" || got[1] != "spool-2" {
+			t.Fatalf("每个事件应只投递一次: %v", got)
+		}
+		stats := svc.GetStats()
+		if stats.SuppressedDuplicates != 1 || stats.Spool == nil || stats.Spool.Events != 0 || stats.Spool.Redelivered != 1 || stats.Spool.Duplicates != 1 {
+			t.Fatalf("统计错误: %+v %+v", stats, stats.Spool)
+		}
+		if svc.SpoolWarning() != "" {
+			t.Fatal("暂存清空后不应告警")
+		}
+	})
+}
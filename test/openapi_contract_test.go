@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/gin-gonic/gin"
+)
+
+type openAPIParam struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type openAPIOperation struct {
+	Tags       []string                   `json:"tags"`
+	Produces   []string                   `json:"produces"`
+	Parameters []openAPIParam             `json:"parameters"`
+	Responses  map[string]json.RawMessage `json:"responses"`
+	Security   []map[string][]string      `json:"security"`
+}
+
+type openAPIDoc struct {
+	Swagger             string                                 `json:"swagger"`
+	Paths               map[string]map[string]openAPIOperation `json:"paths"`
+	Definitions         map[string]json.RawMessage             `json:"definitions"`
+	SecurityDefinitions map[string]struct {
+		Type string `json:"type"`
+		In   string `json:"in"`
+		Name string `json:"name"`
+	} `json:"securityDefinitions"`
+	Security []map[string][]string `json:"security"`
+}
+
+var ginPathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// TestOpenAPIContract 遍历Gin路由表与 /api/v1/openapi.json 对照：每个API路由都有规范条目，每个规范条目都有对应路由
+func TestOpenAPIContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("规范接口失败: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var doc openAPIDoc
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || doc.Swagger != "2.0" {
+		t.Fatalf("规范格式错误: %v %q", err, doc.Swagger)
+	}
+
+	// API路由及独立的探测/指标路由（Swagger UI、静态页不在规范内）
+	routes := map[string]bool{}
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/v1/") && route.Path != "/readyz" && route.Path != "/metrics" {
+			continue
+		}
+		routes[strings.ToLower(route.Method)+" "+ginPathParam.ReplaceAllString(route.Path, "{$1}")] = true
+	}
+	documented := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented[method+" "+path] = true
+		}
+	}
+	var missing, stale []string
+	for key := range routes {
+		if !documented[key] {
+			missing = append(missing, key)
+		}
+	}
+	for key := range documented {
+		if !routes[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	if len(missing) > 0 || len(stale) > 0 {
+		t.Fatalf("路由与规范不一致（补充处理器注解后执行 make swagger）\n缺少规范: %v\n无对应路由: %v", missing, stale)
+	}
+
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			if len(op.Tags) == 0 || len(op.Responses) == 0 {
+				t.Errorf("%s %s 缺少标签或响应定义", method, path)
+			}
+		}
+	}
+
+	// 鉴权方式
+	if s := doc.SecurityDefinitions["ApiKeyName"]; s.Type != "apiKey" || s.In != "header" || s.Name != "X-API-Key-Name" {
+		t.Fatalf("缺少调用方鉴权定义: %+v", doc.SecurityDefinitions)
+	}
+	if len(doc.Security) != 1 || doc.Security[0]["ApiKeyName"] == nil {
+		t.Fatalf("全局鉴权应为 ApiKeyName: %+v", doc.Security)
+	}
+	hook := doc.Paths["/api/v1/hooks/commands"]["post"]
+	if len(hook.Security) != 1 || hook.Security[0]["HookSignature"] == nil {
+		t.Fatalf("入站webhook应使用签名鉴权: %+v", hook.Security)
+	}
+
+	// problem+json 错误结构
+	if _, ok := doc.Definitions["http.ProblemDetails"]; !ok {
+		t.Fatal("缺少 problem+json 错误结构定义")
+	}
+	if !strings.Contains(strings.Join(hook.Produces, ","), "application/problem+json") || !strings.Contains(string(hook.Responses["401"]), "http.ProblemDetails") {
+		t.Fatalf("入站webhook错误应以 problem+json 描述: %+v", hook)
+	}
+
+	// 分页参数
+	hasParams := func(path, method string, names ...string) {
+		t.Helper()
+		params := map[string]bool{}
+		for _, p := range doc.Paths[path][method].Parameters {
+			if p.In == "query" {
+				params[p.Name] = true
+			}
+		}
+		for _, name := range names {
+			if !params[name] {
+				t.Errorf("%s %s 缺少分页参数 %s", method, path, name)
+			}
+		}
+	}
+	hasParams("/api/v1/device/{deviceId}/timeline", "get", "cursor", "limit")
+	hasParams("/api/v1/notifications/recent", "get", "limit")
+	hasParams("/api/v1/admin/changelog", "get", "limit")
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/payloadcrypto"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestPayloadCryptoKnownVectors AES-128-GCM 已知向量（GCM规范测试用例2、4）加解密往返，篡改密文/标签/附加数据均被拒绝
+func TestPayloadCryptoKnownVectors(t *testing.T) {
+	vectors := []struct {
+		name, key, nonce, aad, plaintext, ciphertext, tag string
+	}{
+		{
+			name:       "case2",
+			key:        "00000000000000000000000000000000",
+			nonce:      "000000000000000000000000",
+			plaintext:  "00000000000000000000000000000000",
+			ciphertext: "0388dace60b6a392f328c2b971b2fe78",
+			tag:        "ab6e47d42cec13bdf53a67b21257bddf",
+		},
+		{
+			name:       "case4",
+			key:        "feffe9928665731c6d6a8f9467308308",
+			nonce:      "cafebabefacedbaddecaf888",
+			aad:        "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+			plaintext:  "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+			ciphertext: "42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091",
+			tag:        "5bc94fbc3221a5db94fae95ae7121a47",
+		},
+	}
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			key, nonce, aad := mustHex(t, v.key), mustHex(t, v.nonce), mustHex(t, v.aad)
+			plaintext := mustHex(t, v.plaintext)
+			want := append(append(append([]byte{}, nonce...), mustHex(t, v.ciphertext)...), mustHex(t, v.tag)...)
+
+			sealed, err := payloadcrypto.SealWithNonce(key, nonce, aad, plaintext)
+			if err != nil || !bytes.Equal(sealed, want) {
+				t.Fatalf("加密结果与已知向量不一致:\n got %x\nwant %x (%v)", sealed, want, err)
+			}
+			opened, err := payloadcrypto.Open(key, aad, sealed)
+			if err != nil || !bytes.Equal(opened, plaintext) {
+				t.Fatalf("解密往返失败: %x %v", opened, err)
+			}
+
+			for name, tamper := range map[string]func() ([]byte, []byte){
+				"密文":   func() ([]byte, []byte) { s := bytes.Clone(sealed); s[payloadcrypto.NonceSize] ^= 0x01; return s, aad },
+				"认证标签": func() ([]byte, []byte) { s := bytes.Clone(sealed); s[len(s)-1] ^= 0x80; return s, aad },
+				"随机数":  func() ([]byte, []byte) { s := bytes.Clone(sealed); s[0] ^= 0x01; return s, aad },
+				"附加数据": func() ([]byte, []byte) { return sealed, append(bytes.Clone(aad), 0x00) },
+			} {
+				s, a := tamper()
+				if _, err := payloadcrypto.Open(key, a, s); !errors.Is(err, payloadcrypto.ErrAuthFailed) {
+					t.Fatalf("篡改%s应认证失败，实际: %v", name, err)
+				}
+			}
+		})
+	}
+
+	key := make([]byte, payloadcrypto.KeySize)
+	if _, err := payloadcrypto.Open(key, nil, make([]byte, payloadcrypto.Overhead-1)); !errors.Is(err, payloadcrypto.ErrCiphertextTooShort) {
+		t.Fatalf("过短的数据域应被拒绝: %v", err)
+	}
+	if _, err := payloadcrypto.Seal(key[:8], nil, []byte{1}); !errors.Is(err, payloadcrypto.ErrInvalidKey) {
+		t.Fatalf("非16字节密钥应被拒绝: %v", err)
+	}
+}
+
+// payloadKeyFile 写入密钥文件
+func payloadKeyFile(t *testing.T, path string, entries ...map[string]interface{}) {
+	t.Helper()
+	raw, _ := json.Marshal(map[string]interface{}{"keys": entries})
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// usePayloadCrypto 测试期间启用全局数据域加密
+func usePayloadCrypto(t *testing.T, store payloadcrypto.KeyStore, grace time.Duration) *payloadcrypto.Manager {
+	m := payloadcrypto.NewManager(payloadcrypto.Options{Store: store, StoreType: payloadcrypto.StoreTypeFile, RotationGrace: grace})
+	payloadcrypto.SetGlobalManager(m)
+	t.Cleanup(func() { payloadcrypto.SetGlobalManager(nil) })
+	return m
+}
+
+// deviceSealedFrame 设备侧加密的上行帧（附加认证数据为帧头的物理ID、消息ID与命令）
+func deviceSealedFrame(t *testing.T, key []byte, physicalID uint32, messageID uint16, command uint8, plaintext []byte) []byte {
+	t.Helper()
+	header := dny_protocol.BuildFrame(physicalID, messageID, command, nil)
+	sealed, err := payloadcrypto.Seal(key, header[5:12], plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dny_protocol.BuildFrame(physicalID, messageID, command, sealed)
+}
+
+// deviceOpenFrame 设备侧解密下行帧
+func deviceOpenFrame(key, frame []byte) ([]byte, error) {
+	return payloadcrypto.Open(key, frame[5:12], frame[12:len(frame)-2])
+}
+
+var (
+	cryptoRegisterPayload  = []byte{0xE7, 0x00, 0x02, 0x00, 0x04, 0x00, 0x01, 0x00}
+	cryptoHeartbeatPayload = []byte{0x08, 0x09, 0x02, 0x00, 0x00, 0x1F, 0x25}
+)
+
+// TestPayloadCryptoDecoder 注册帧声明密钥ID后上行帧解密为明文、下行帧加密；未声明的连接不受影响；篡改的帧被丢弃并计数
+func TestPayloadCryptoDecoder(t *testing.T) {
+	key := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	path := filepath.Join(t.TempDir(), "keys.json")
+	payloadKeyFile(t, path, map[string]interface{}{"id": 7, "key": hex.EncodeToString(key)})
+	store, err := payloadcrypto.NewFileKeyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := usePayloadCrypto(t, store, time.Hour)
+
+	const physicalID = uint32(0x04A2C501)
+	const encConn, plainConn = uint64(171101), uint64(171102)
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	defer decoder.ReleaseConnection(encConn)
+	defer decoder.ReleaseConnection(plainConn)
+
+	// 注册帧：去掉密钥声明后按标准注册载荷处理
+	register := dny_protocol.BuildFrame(physicalID, 1, constants.CmdDeviceRegister, payloadcrypto.AppendRegisterKeyID(cryptoRegisterPayload, 7))
+	_, msg := decoder.DecodeFrame(encConn, register)
+	if msg == nil || msg.MessageType != "standard" || !bytes.Equal(msg.Data, cryptoRegisterPayload) {
+		t.Fatalf("注册帧应去掉密钥声明: %+v", msg)
+	}
+	if link, ok := m.Get(encConn); !ok || link.KeyID != 7 {
+		t.Fatalf("连接应绑定密钥7: %+v %v", link, ok)
+	}
+
+	// 加密的心跳帧解密为明文标准帧
+	wire := deviceSealedFrame(t, key, physicalID, 2, constants.CmdDeviceHeart, cryptoHeartbeatPayload)
+	_, msg = decoder.DecodeFrame(encConn, wire)
+	want := dny_protocol.BuildFrame(physicalID, 2, constants.CmdDeviceHeart, cryptoHeartbeatPayload)
+	if msg == nil || msg.MessageType != "standard" || !bytes.Equal(msg.RawData, want) || !bytes.Equal(msg.Data, cryptoHeartbeatPayload) {
+		t.Fatalf("解密后的标准帧不一致: %+v", msg)
+	}
+
+	// 篡改密文：标记为错误帧，认证失败计数
+	tampered := deviceSealedFrame(t, key, physicalID, 3, constants.CmdDeviceHeart, cryptoHeartbeatPayload)
+	tampered[15] ^= 0xFF
+	checksum := dny_protocol.Checksum(tampered[:len(tampered)-2])
+	tampered[len(tampered)-2], tampered[len(tampered)-1] = byte(checksum), byte(checksum>>8)
+	if _, msg = decoder.DecodeFrame(encConn, tampered); msg == nil || msg.MessageType != "error" {
+		t.Fatalf("篡改的帧应标记为错误帧: %+v", msg)
+	}
+	// 以其他命令重放密文（附加认证数据不符）
+	replayed := dny_protocol.BuildFrame(physicalID, 2, constants.CmdSettlement, wire[12:len(wire)-2])
+	if _, msg = decoder.DecodeFrame(encConn, replayed); msg == nil || msg.MessageType != "error" {
+		t.Fatalf("改换命令的密文应认证失败: %+v", msg)
+	}
+	if stats := m.Stats(); stats.Failures[payloadcrypto.FailureAuth] != 2 || stats.Decrypted != 1 {
+		t.Fatalf("统计错误: %+v", stats)
+	}
+
+	// 下行：数据域加密，设备以同一密钥解密；注册应答不加密
+	command := dny_protocol.BuildFrame(physicalID, 0x1001, constants.CmdChargeControl, []byte{0x01, 0x02, 0x03})
+	out, err := m.EncryptFrame(encConn, command)
+	if err != nil || len(out) != len(command)+payloadcrypto.Overhead {
+		t.Fatalf("下行加密失败: %v", err)
+	}
+	if plain, err := deviceOpenFrame(key, out); err != nil || !bytes.Equal(plain, []byte{0x01, 0x02, 0x03}) {
+		t.Fatalf("设备解密下行帧失败: %x %v", plain, err)
+	}
+	reply := dny_protocol.BuildFrame(physicalID, 1, constants.CmdDeviceRegister, []byte{0x00})
+	if out, _ := m.EncryptFrame(encConn, reply); !bytes.Equal(out, reply) {
+		t.Fatal("注册应答不应加密")
+	}
+
+	// 混合设备：未声明密钥ID的连接上下行原样通过
+	plainRegister := dny_protocol.BuildFrame(physicalID+1, 1, constants.CmdDeviceRegister, cryptoRegisterPayload)
+	if _, msg = decoder.DecodeFrame(plainConn, plainRegister); msg == nil || !bytes.Equal(msg.RawData, plainRegister) {
+		t.Fatalf("未加密注册帧应原样通过: %+v", msg)
+	}
+	plainHeartbeat := dny_protocol.BuildFrame(physicalID+1, 2, constants.CmdDeviceHeart, cryptoHeartbeatPayload)
+	if _, msg = decoder.DecodeFrame(plainConn, plainHeartbeat); msg == nil || msg.MessageType != "standard" || !bytes.Equal(msg.RawData, plainHeartbeat) {
+		t.Fatalf("未加密心跳帧应原样通过: %+v", msg)
+	}
+	if out, _ := m.EncryptFrame(plainConn, command); !bytes.Equal(out, command) {
+		t.Fatal("未加密连接的下行帧不应加密")
+	}
+	if _, ok := m.Get(plainConn); ok {
+		t.Fatal("未声明密钥ID的连接不应绑定")
+	}
+
+	// 连接关闭后解除绑定
+	decoder.ReleaseConnection(encConn)
+	if _, ok := m.Get(encConn); ok {
+		t.Fatal("连接关闭后应解除绑定")
+	}
+}
+
+// TestPayloadCryptoKeyRotation 轮换后宽限期内接受上一代密钥（下行沿用设备所用的代次），宽限期结束后拒绝；未知密钥ID单独计数
+func TestPayloadCryptoKeyRotation(t *testing.T) {
+	oldKey := mustHex(t, "101112131415161718191a1b1c1d1e1f")
+	newKey := mustHex(t, "202122232425262728292a2b2c2d2e2f")
+	rotatedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	payloadKeyFile(t, path, map[string]interface{}{
+		"id": 9, "key": hex.EncodeToString(newKey), "previousKey": hex.EncodeToString(oldKey), "rotatedAt": rotatedAt,
+	})
+	store, err := payloadcrypto.NewFileKeyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := usePayloadCrypto(t, store, 72*time.Hour)
+	now := rotatedAt.Add(time.Hour)
+	m.SetNowFunc(func() time.Time { return now })
+
+	const physicalID = uint32(0x04A2C502)
+	const connID = uint64(171103)
+	register := dny_protocol.BuildFrame(physicalID, 1, constants.CmdDeviceRegister, payloadcrypto.AppendRegisterKeyID(cryptoRegisterPayload, 9))
+	if _, ok := m.BindRegister(connID, register); !ok {
+		t.Fatal("应绑定密钥9")
+	}
+	defer m.Release(connID)
+
+	// 设备尚未更新密钥：以上一代密钥解密，下行也以上一代密钥加密
+	if _, changed, err := m.DecryptFrame(connID, deviceSealedFrame(t, oldKey, physicalID, 2, constants.CmdDeviceHeart, cryptoHeartbeatPayload)); err != nil || !changed {
+		t.Fatalf("宽限期内应接受上一代密钥: %v", err)
+	}
+	if link, _ := m.Get(connID); link.Generation != payloadcrypto.GenerationPrevious {
+		t.Fatalf("连接应记录使用上一代密钥: %+v", link)
+	}
+	command := dny_protocol.BuildFrame(physicalID, 0x1002, constants.CmdChargeControl, []byte{0x09})
+	out, _ := m.EncryptFrame(connID, command)
+	if _, err := deviceOpenFrame(oldKey, out); err != nil {
+		t.Fatalf("下行应以设备所用的上一代密钥加密: %v", err)
+	}
+
+	// 设备换用新密钥
+	if _, _, err := m.DecryptFrame(connID, deviceSealedFrame(t, newKey, physicalID, 3, constants.CmdDeviceHeart, cryptoHeartbeatPayload)); err != nil {
+		t.Fatalf("应接受当前密钥: %v", err)
+	}
+	out, _ = m.EncryptFrame(connID, command)
+	if _, err := deviceOpenFrame(newKey, out); err != nil {
+		t.Fatalf("设备换用新密钥后下行应以当前密钥加密: %v", err)
+	}
+
+	// 宽限期结束：上一代密钥被拒绝
+	now = rotatedAt.Add(73 * time.Hour)
+	if _, _, err := m.DecryptFrame(connID, deviceSealedFrame(t, oldKey, physicalID, 4, constants.CmdDeviceHeart, cryptoHeartbeatPayload)); err == nil {
+		t.Fatal("宽限期结束后应拒绝上一代密钥")
+	}
+	stats := m.Stats()
+	if stats.PreviousKey != 1 || stats.Failures[payloadcrypto.FailureAuth] != 1 {
+		t.Fatalf("统计错误: %+v", stats)
+	}
+
+	// 未知密钥ID
+	const unknownConn = uint64(171104)
+	unknown := dny_protocol.BuildFrame(physicalID+1, 1, constants.CmdDeviceRegister, payloadcrypto.AppendRegisterKeyID(cryptoRegisterPayload, 99))
+	m.BindRegister(unknownConn, unknown)
+	defer m.Release(unknownConn)
+	if _, _, err := m.DecryptFrame(unknownConn, deviceSealedFrame(t, newKey, physicalID+1, 2, constants.CmdDeviceHeart, cryptoHeartbeatPayload)); !errors.Is(err, payloadcrypto.ErrUnknownKey) {
+		t.Fatalf("未知密钥ID应返回 ErrUnknownKey: %v", err)
+	}
+	if m.Stats().Failures[payloadcrypto.FailureUnknownKey] != 1 {
+		t.Fatal("未知密钥ID应计数")
+	}
+}
+
+// TestPayloadCryptoEndpoint 加密状态接口：未启用返回503，启用后列出加密连接与失败计数
+func TestPayloadCryptoEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	payloadcrypto.SetGlobalManager(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/payload-crypto", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用时应返回503，实际 %d", w.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	payloadKeyFile(t, path, map[string]interface{}{"id": 3, "key": "000102030405060708090a0b0c0d0e0f"})
+	store, err := payloadcrypto.NewFileKeyStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := usePayloadCrypto(t, store, 0)
+	register := dny_protocol.BuildFrame(0x04A2C503, 1, constants.CmdDeviceRegister, payloadcrypto.AppendRegisterKeyID(cryptoRegisterPayload, 3))
+	m.BindRegister(171105, register)
+	m.MarkRegistered(171105, "04A2C503")
+
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/payload-crypto", "")
+	if w.Code != http.StatusOK || resp.Code != 0 {
+		t.Fatalf("查询失败: %d %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data struct {
+			Stats payloadcrypto.Stats  `json:"stats"`
+			Links []payloadcrypto.Link `json:"links"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data.Links) != 1 || body.Data.Links[0].DeviceID != "04A2C503" || body.Data.Links[0].KeyID != 3 || body.Data.Stats.Links != 1 {
+		t.Fatalf("加密连接列表错误: %s", w.Body.String())
+	}
+	if _, ok := body.Data.Stats.Failures[payloadcrypto.FailureAuth]; !ok {
+		t.Fatalf("应列出各失败原因的计数: %s", w.Body.String())
+	}
+}
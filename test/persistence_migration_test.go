@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/energy"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+	"github.com/bujia-iot/iot-zinx/pkg/persistence"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+)
+
+// copyFixtures 将旧格式样例复制到临时目录（迁移会回写小型存储）
+func copyFixtures(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join("testdata", "persistence", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestPersistenceMigration 加载旧格式样例：台账会话补齐租户（读取时迁移、不回写），计数器、延迟命令与消息ID序列启动时迁移并回写为信封格式，
+// 变更记录与结算段的旧记录读取时迁移、新记录以信封写入；
+// 版本高于当前支持的记录默认拒绝加载，archive 策略下归档后跳过
+func TestPersistenceMigration(t *testing.T) {
+	registry := persistence.Default()
+	registry.ResetReport()
+	asset.SetGlobalResolver(stubTenantResolver{"04A26CF3": {AssetCode: "ST-1", TenantID: "operator-a"}})
+	t.Cleanup(func() {
+		asset.SetGlobalResolver(nil)
+		_ = registry.Configure(config.PersistenceConfig{})
+		registry.ResetReport()
+	})
+
+	t.Run("台账会话v1迁移补齐租户", func(t *testing.T) {
+		dir := copyFixtures(t, "sessions-2026-10-01.jsonl", "settlements-2026-10-01.jsonl")
+		before, _ := os.ReadFile(filepath.Join(dir, "sessions-2026-10-01.jsonl"))
+		ledger, err := reconcile.NewLedger(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, ok := ledger.Session("ORD_V1_A"); !ok || s.Tenant != "operator-a" || s.Value != 3600 || s.Status != "charging" {
+			t.Fatalf("已映射设备的会话应补齐租户: %+v", s)
+		}
+		if s, ok := ledger.Session("ORD_V1_B"); !ok || s.Tenant != "" || s.Reason != "充满" {
+			t.Fatalf("未映射设备的会话租户应为空: %+v", s)
+		}
+		if s, ok := ledger.Session("ORD_V2_C"); !ok || s.Tenant != "operator-b" {
+			t.Fatalf("当前版本的会话应原样加载: %+v", s)
+		}
+		if _, ok := ledger.Session("ORD_V1_TORN"); ok {
+			t.Fatal("写一半的行应忽略")
+		}
+		if s, ok := ledger.Settlement("ORD_V1_B"); !ok || s.TotalFee != 100 {
+			t.Fatalf("结算应加载: %+v", s)
+		}
+		// 大型台账读取时迁移，不回写旧文件；新记录以当前版本信封追加
+		after, _ := os.ReadFile(filepath.Join(dir, "sessions-2026-10-01.jsonl"))
+		if !bytes.Equal(before, after) {
+			t.Fatal("台账旧行不应回写")
+		}
+		ledger.RecordSession(reconcile.SessionRecord{OrderNo: "ORD_V1_A", DeviceID: "04A26CF3", Tenant: "operator-a", Port: 1, Status: "completed"})
+		after, _ = os.ReadFile(filepath.Join(dir, "sessions-2026-10-01.jsonl"))
+		lines := strings.Split(strings.TrimSpace(string(after)), "\n")
+		if last := lines[len(lines)-1]; !strings.HasPrefix(last, `{"type":"reconcile_session","schemaVersion":2,`) || !strings.Contains(last, `"tenant":"operator-a"`) {
+			t.Fatalf("新记录应以v2信封追加: %s", last)
+		}
+		reloaded, err := reconcile.NewLedger(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := reloaded.Session("ORD_V1_A"); s.Status != "completed" || s.Tenant != "operator-a" {
+			t.Fatalf("重新加载应以最后一行为准: %+v", s)
+		}
+
+		session := registry.Report().Types[reconcile.SessionRecordType]
+		if session.CurrentVersion != 2 || session.FromVersions[1] != 4 || session.Migrated != 4 {
+			t.Fatalf("会话迁移计数错误: %+v", session)
+		}
+	})
+
+	t.Run("小型存储启动时迁移并回写", func(t *testing.T) {
+		dir := copyFixtures(t, "port_energy.json", "deferred_commands.json")
+		store := energy.NewFileStore(filepath.Join(dir, "port_energy.json"))
+		c, err := energy.NewCounters(store, energy.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, ok := c.Port("04A16900", 2, time.Date(2026, 10, 15, 12, 0, 0, 0, time.Local)); !ok || p.TotalWh != 125000 || p.Sessions != 42 {
+			t.Fatalf("计数器应从旧格式恢复: %+v", p)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "port_energy.json"))
+		if !strings.HasPrefix(string(data), `{"type":"energy_counters","schemaVersion":1,`) {
+			t.Fatalf("计数器文件应回写为信封格式: %.80s", data)
+		}
+
+		q := gateway.NewDeferredQueue(config.DeferredCommandsConfig{File: filepath.Join(dir, "deferred_commands.json")}, func(string) bool { return false })
+		if pending, _ := q.List("04A16900"); len(pending) != 1 || pending[0].ID != "dfr_v1fixture01" || pending[0].Kind != gateway.DeferredKindReboot {
+			t.Fatalf("延迟命令应从旧格式恢复: %+v", pending)
+		}
+		data, _ = os.ReadFile(filepath.Join(dir, "deferred_commands.json"))
+		if !strings.Contains(string(data), `"type": "deferred_commands"`) || !strings.Contains(string(data), `"schemaVersion": 1`) {
+			t.Fatalf("延迟命令文件应回写为信封格式: %s", data)
+		}
+
+		// 回写后再次加载不再计为迁移
+		migrated := registry.Report().Types[energy.SnapshotRecordType].Migrated
+		if _, err := energy.NewCounters(store, energy.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		report := registry.Report()
+		if counters := report.Types[energy.SnapshotRecordType]; migrated != 1 || counters.Migrated != 1 || counters.Read != 2 {
+			t.Fatalf("计数器迁移计数错误: %+v", counters)
+		}
+		if deferred := report.Types[gateway.DeferredRecordType]; deferred.Migrated != 1 {
+			t.Fatalf("延迟命令迁移计数错误: %+v", deferred)
+		}
+		if !strings.Contains(report.Summary(), "energy_counters(v1) 读取2 迁移1") {
+			t.Fatalf("迁移报告错误: %s", report.Summary())
+		}
+	})
+
+	t.Run("单键存储与逐条记录的旧格式", func(t *testing.T) {
+		dir := t.TempDir()
+		seqPath := filepath.Join(dir, "message_id.json")
+		if err := os.WriteFile(seqPath, []byte(`{"lastMessageId":1234,"savedAt":"2026-10-01T00:00:00Z"}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if record, err := msgid.NewFileStore(seqPath).Load(); err != nil || record == nil || record.LastMessageID != 1234 {
+			t.Fatalf("消息ID序列应从旧格式恢复: %+v %v", record, err)
+		}
+		if data, _ := os.ReadFile(seqPath); !strings.HasPrefix(string(data), `{"type":"msgid_sequence","schemaVersion":1,`) {
+			t.Fatalf("消息ID序列文件应回写为信封格式: %s", data)
+		}
+
+		// 变更记录：旧行读取时迁移，新记录以信封追加
+		logPath := filepath.Join(dir, "changelog.jsonl")
+		if err := os.WriteFile(logPath, []byte(`{"id":1,"method":"POST","endpoint":"/api/v1/charging/start","status":200}`+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		logStore := changelog.NewFileStore(logPath, 10)
+		if err := logStore.Append([]changelog.Record{{ID: 2, Method: "POST", Endpoint: "/api/v1/charging/stop", Status: 200}}); err != nil {
+			t.Fatal(err)
+		}
+		records, err := logStore.LoadRecent(10)
+		if err != nil || len(records) != 2 || records[0].Endpoint != "/api/v1/charging/start" || records[1].ID != 2 {
+			t.Fatalf("变更记录应同时读取旧行与信封行: %+v %v", records, err)
+		}
+		if data, _ := os.ReadFile(logPath); !strings.Contains(string(data), `{"type":"changelog_record","schemaVersion":1,`) {
+			t.Fatalf("新变更记录应以信封追加: %s", data)
+		}
+
+		// 结算段：旧记录（裸JSON）可读取，新记录以信封写入
+		cfg := config.SettlementStoreConfig{Enabled: true, Dir: filepath.Join(dir, "settlements"), SyncMaxLatencyMs: -1}
+		legacy, _ := json.Marshal(settlementRecord("ORD1690A", "04A26CF3", 100, time.Now()))
+		frame := make([]byte, 8+len(legacy))
+		binary.LittleEndian.PutUint32(frame, uint32(len(legacy)))
+		binary.LittleEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(legacy))
+		copy(frame[8:], legacy)
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		segment := filepath.Join(cfg.Dir, "settlements-00000001.seg")
+		if err := os.WriteFile(segment, frame, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		settlements, err := settlement.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer settlements.Close()
+		if found, err := settlements.Lookup("ORD1690A"); err != nil || len(found) != 1 || found[0].TotalFee != 100 {
+			t.Fatalf("旧格式结算应可读取: %+v %v", found, err)
+		}
+		if _, _, err := settlements.Append(settlementRecord("ORD1690B", "04A26CF3", 120, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(segment); !bytes.Contains(data, []byte(`{"type":"settlement_record","schemaVersion":1,`)) {
+			t.Fatal("新结算应以信封写入")
+		}
+	})
+
+	future := `{"type":"reconcile_session","schemaVersion":3,"data":{"order_no":"ORD_V3","device_id":"04A16900","port":1}}` + "\n"
+
+	t.Run("未知版本默认拒绝", func(t *testing.T) {
+		dir := copyFixtures(t, "sessions-2026-10-01.jsonl")
+		if err := os.WriteFile(filepath.Join(dir, "sessions-2026-10-02.jsonl"), []byte(future), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := reconcile.NewLedger(dir)
+		if !errors.Is(err, persistence.ErrFutureVersion) || !strings.Contains(err.Error(), "reconcile_session v3") {
+			t.Fatalf("未知版本应拒绝加载: %v", err)
+		}
+		if refused := registry.Report().Refused; len(refused) != 1 || !strings.Contains(refused[0], "reconcile_session v3") {
+			t.Fatalf("报告应记录拒绝原因: %v", refused)
+		}
+	})
+
+	t.Run("archive策略归档后跳过", func(t *testing.T) {
+		archiveDir := t.TempDir()
+		if err := registry.Configure(config.PersistenceConfig{UnknownVersionPolicy: persistence.PolicyArchive, ArchiveDir: archiveDir}); err != nil {
+			t.Fatal(err)
+		}
+		dir := copyFixtures(t, "sessions-2026-10-01.jsonl")
+		if err := os.WriteFile(filepath.Join(dir, "sessions-2026-10-02.jsonl"), []byte(future), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ledger, err := reconcile.NewLedger(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ledger.Session("ORD_V3"); ok {
+			t.Fatal("未知版本的记录应跳过")
+		}
+		if _, ok := ledger.Session("ORD_V1_A"); !ok {
+			t.Fatal("其余记录应正常加载")
+		}
+		archived, err := os.ReadFile(filepath.Join(archiveDir, "reconcile_session.jsonl"))
+		if err != nil || !strings.Contains(string(archived), `"order_no":"ORD_V3"`) {
+			t.Fatalf("未知版本的记录应原样归档: %v %s", err, archived)
+		}
+
+		// 单文件存储：整份归档后视为无记录
+		energyPath := filepath.Join(t.TempDir(), "port_energy.json")
+		_ = os.WriteFile(energyPath, []byte(`{"type":"energy_counters","schemaVersion":9,"data":{}}`), 0o644)
+		if snapshot, err := energy.NewFileStore(energyPath).Load(); err != nil || snapshot != nil {
+			t.Fatalf("归档后应视为无记录: %+v %v", snapshot, err)
+		}
+		if counters := registry.Report().Types[energy.SnapshotRecordType]; counters.Archived != 1 {
+			t.Fatalf("归档计数错误: %+v", counters)
+		}
+		if err := registry.Configure(config.PersistenceConfig{UnknownVersionPolicy: "skip"}); err == nil {
+			t.Fatal("不支持的策略应返回错误")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
+	"github.com/gin-gonic/gin"
+)
+
+func availabilityDay(t *testing.T, days []availability.DayBucket, date string) availability.DayBucket {
+	t.Helper()
+	for _, d := range days {
+		if d.Date == date {
+			return d
+		}
+	}
+	t.Fatalf("缺少 %s 的按天聚合: %+v", date, days)
+	return availability.DayBucket{}
+}
+
+// TestPortAvailabilityMonthBoundary 跨月的状态时长按本地日期拆分到各自月份
+func TestPortAvailabilityMonthBoundary(t *testing.T) {
+	tracker, _ := availability.NewTracker(nil, availability.Options{})
+	const deviceID = "04B16850"
+	jan31 := time.Date(2026, 1, 31, 22, 0, 0, 0, time.Local)
+	tracker.OnPortStatuses(deviceID, []uint8{0x00, 0x01}, jan31)
+	tracker.OnPortStatus(deviceID, 1, 0x04, jan31.Add(4*time.Hour)) // 2月1日02:00 故障
+	now := jan31.Add(6 * time.Hour)
+	tracker.Sweep(now)
+
+	jan, _ := availability.ParseMonth("2026-01", now)
+	report, ok := tracker.Port(deviceID, 1, jan, now)
+	if !ok {
+		t.Fatal("端口应有状态历史")
+	}
+	if report.AvailableSeconds != 7200 || report.FaultedSeconds != 0 || report.MonitoredSeconds != 7200 {
+		t.Fatalf("1月应只有31日22:00起的2小时可用: %+v", report.Totals)
+	}
+	if want := float64(31*86400 - 7200); report.UnmonitoredSeconds != want {
+		t.Fatalf("跟踪开始前应计为未监控: %v != %v", report.UnmonitoredSeconds, want)
+	}
+	if report.UptimePercent == nil || *report.UptimePercent != 100 || len(report.Days) != 1 {
+		t.Fatalf("1月可用率错误: %+v", report)
+	}
+
+	feb, _ := availability.ParseMonth("2026-02", now)
+	report, _ = tracker.Port(deviceID, 1, feb, now)
+	if report.AvailableSeconds != 7200 || report.FaultedSeconds != 7200 || *report.UptimePercent != 50 {
+		t.Fatalf("2月应可用2小时、故障2小时: %+v", report.Totals)
+	}
+	if len(report.Transitions) != 1 || report.Transitions[0].To != availability.StateFaulted || report.Transitions[0].Source != availability.SourceDevice {
+		t.Fatalf("2月应只包含当月的状态转换: %+v", report.Transitions)
+	}
+	if !report.To.Equal(now) || report.CurrentState != availability.StateFaulted {
+		t.Fatalf("当月统计应截至查询时刻: %+v", report)
+	}
+
+	if _, err := availability.ParseMonth("2026-03", now); err == nil {
+		t.Fatal("晚于当月的月份应被拒绝")
+	}
+	if _, err := availability.ParseMonth("2026/02", now); err == nil {
+		t.Fatal("格式错误的月份应被拒绝")
+	}
+}
+
+// TestPortAvailabilityOfflineWholeDays 设备整天离线时每天均计满离线时长，重新上报后恢复可用
+func TestPortAvailabilityOfflineWholeDays(t *testing.T) {
+	tracker, _ := availability.NewTracker(nil, availability.Options{MaxTransitions: 3})
+	const deviceID = "04B16851"
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	tracker.OnPortStatuses(deviceID, []uint8{0x00}, start)
+	tracker.OnDeviceOffline(deviceID, start.Add(12*time.Hour))
+	for day := 1; day <= 3; day++ {
+		tracker.Sweep(start.Add(time.Duration(day) * 24 * time.Hour))
+	}
+	back := start.AddDate(0, 0, 3).Add(12 * time.Hour)
+	tracker.OnPortStatuses(deviceID, []uint8{0x01}, back)
+	now := start.AddDate(0, 0, 4)
+
+	report, _ := tracker.Port(deviceID, 1, start, now)
+	if d := availabilityDay(t, report.Days, "2026-03-01"); d.AvailableSeconds != 43200 || d.OfflineSeconds != 43200 {
+		t.Fatalf("3月1日应半天可用半天离线: %+v", d)
+	}
+	for _, date := range []string{"2026-03-02", "2026-03-03"} {
+		if d := availabilityDay(t, report.Days, date); d.OfflineSeconds != 86400 || d.AvailableSeconds != 0 {
+			t.Fatalf("%s 应整天离线: %+v", date, d)
+		}
+	}
+	if report.OfflineSeconds != 43200+2*86400+43200 || report.AvailableSeconds != 43200+43200 {
+		t.Fatalf("离线总时长错误: %+v", report.Totals)
+	}
+	if *report.UptimePercent != 25 || report.UnmonitoredSeconds != 0 {
+		t.Fatalf("可用率应为25%%且无未监控时长: %+v", report.Totals)
+	}
+	last := report.Transitions[len(report.Transitions)-1]
+	if last.From != availability.StateOffline || last.To != availability.StateAvailable || last.Source != availability.SourceDevice {
+		t.Fatalf("重新上报应记录离线→可用: %+v", report.Transitions)
+	}
+	if report.Transitions[1].Source != availability.SourceInferred {
+		t.Fatalf("离线应为推断来源: %+v", report.Transitions)
+	}
+
+	// 状态转换历史有上限
+	for i := 0; i < 4; i++ {
+		tracker.OnPortStatus(deviceID, 1, uint8(4*(i%2)), now.Add(time.Duration(i)*time.Minute))
+	}
+	if report, _ := tracker.Port(deviceID, 1, start, now.Add(time.Hour)); len(report.Transitions) != 3 {
+		t.Fatalf("单设备只保留最近3条状态转换: %d", len(report.Transitions))
+	}
+}
+
+// TestPortAvailabilityRestartGap 网关重启间隙计为未监控而非停机，宽限期内未重新上报的端口推断为离线；按天聚合持久化后可恢复
+func TestPortAvailabilityRestartGap(t *testing.T) {
+	store := availability.NewFileStore(filepath.Join(t.TempDir(), "availability.json"))
+	tracker, err := availability.NewTracker(store, availability.Options{RestartGrace: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const deviceID = "04B16852"
+	start := time.Date(2026, 5, 10, 8, 0, 0, 0, time.Local)
+	tracker.OnPortStatuses(deviceID, []uint8{0x00, 0x00}, start)
+	tracker.Sweep(start.Add(time.Hour)) // 最后一次聚合后网关停止
+	if err := tracker.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := availability.NewTracker(store, availability.Options{RestartGrace: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumeAt := start.Add(3 * time.Hour)
+	if n := restarted.Resume(resumeAt); n != 2 {
+		t.Fatalf("两个端口应转为未监控: %d", n)
+	}
+	restarted.OnPortStatus(deviceID, 1, 0x01, resumeAt.Add(5*time.Minute))
+	restarted.Sweep(resumeAt.Add(10 * time.Minute)) // 端口2宽限期内未上报
+	now := start.Add(5 * time.Hour)
+
+	p1, _ := restarted.Port(deviceID, 1, start, now)
+	wantAvailable := float64(3600 + 2*3600 - 5*60)
+	if p1.AvailableSeconds != wantAvailable || p1.OfflineSeconds != 0 || *p1.UptimePercent != 100 {
+		t.Fatalf("重启间隙不应计入停机: %+v", p1.Totals)
+	}
+	if d := availabilityDay(t, p1.Days, "2026-05-10"); d.UnmonitoredSeconds != 2*3600+5*60 {
+		t.Fatalf("重启间隙应记为未监控: %+v", d)
+	}
+
+	p2, _ := restarted.Port(deviceID, 2, start, now)
+	if p2.AvailableSeconds != 3600 || p2.OfflineSeconds != float64(2*3600-10*60) || p2.CurrentState != availability.StateOffline {
+		t.Fatalf("宽限期结束仍未上报的端口应推断为离线: %+v", p2)
+	}
+	if !p2.CurrentSince.Equal(resumeAt.Add(10 * time.Minute)) {
+		t.Fatalf("离线应从宽限期结束时开始: %v", p2.CurrentSince)
+	}
+
+	rollup := restarted.Rollup([]string{deviceID, "04B16853"}, start, now)
+	if rollup.Ports != 2 || len(rollup.Devices) != 1 || len(rollup.Untracked) != 1 || rollup.Untracked[0] != "04B16853" {
+		t.Fatalf("站点汇总设备统计错误: %+v", rollup)
+	}
+	if rollup.AvailableSeconds != p1.AvailableSeconds+p2.AvailableSeconds || rollup.OfflineSeconds != p2.OfflineSeconds {
+		t.Fatalf("站点汇总应为各端口时长之和: %+v", rollup.Totals)
+	}
+}
+
+// TestPortAvailabilityAPI 端口可用率接口：月份校验与查询结果
+func TestPortAvailabilityAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracker, _ := availability.NewTracker(nil, availability.Options{})
+	previous := availability.GetGlobalTracker()
+	availability.SetGlobalTracker(tracker)
+	t.Cleanup(func() { availability.SetGlobalTracker(previous) })
+
+	const deviceID = "04B16854"
+	tracker.OnPortStatuses(deviceID, []uint8{0x00}, time.Now().Add(-time.Minute))
+
+	r := gin.New()
+	r.GET("/api/v1/device/:deviceId/ports/:port/availability", apihttp.NewEnergyHandlers().HandlePortAvailability)
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	code, data := get("/api/v1/device/" + deviceID + "/ports/1/availability")
+	if code != http.StatusOK {
+		t.Fatalf("查询失败: %d %+v", code, data)
+	}
+	report := data["availability"].(map[string]interface{})
+	if report["uptimePercent"].(float64) != 100 || report["currentState"] != availability.StateAvailable {
+		t.Fatalf("可用率错误: %+v", report)
+	}
+	if code, _ := get("/api/v1/device/" + deviceID + "/ports/1/availability?month=2026-13"); code != http.StatusBadRequest {
+		t.Fatalf("非法月份应返回400: %d", code)
+	}
+	next := time.Now().AddDate(0, 1, 0).Format("2006-01")
+	if code, _ := get("/api/v1/device/" + deviceID + "/ports/1/availability?month=" + next); code != http.StatusBadRequest {
+		t.Fatalf("未来月份应返回400: %d", code)
+	}
+	if code, _ := get("/api/v1/device/" + deviceID + "/ports/2/availability"); code != http.StatusNotFound {
+		t.Fatalf("无历史的端口应返回404: %d", code)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+	"github.com/gin-gonic/gin"
+)
+
+// TestPortStatusEndpoint 模拟设备2号端口连续上报不同功率的功率心跳，GET /api/v1/device/{id}/ports 立即反映状态、功率与订单电量；
+// 0x82受理将端口置为充电中，超过过期窗口未上报的端口标记stale，设备列表附端口汇总
+func TestPortStatusEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quietLogger(t)
+	const (
+		deviceID = "04A27165"
+		iccid    = "89860000000000176501"
+		orderNo  = "ORD-1765-A"
+	)
+	conn := registerSharedGroup(t, 1765001, iccid, []string{deviceID})
+	device := simulator.NewDevice(0x04A27165, iccid, dialect.AP3000)
+	g := gateway.GetGlobalDeviceGateway()
+	feed := func(handler ziface.IRouter) func(frame []byte, err error) {
+		return func(frame []byte, err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, command, _ := frameHeader(frame)
+			req := znet.NewRequest(conn, zpack.NewMsgPackage(uint32(command), frame))
+			req.BindRouter(handler)
+			req.Call()
+		}
+	}
+
+	h := apihttp.NewDeviceHandlers()
+	r := gin.New()
+	r.GET("/api/v1/device/:deviceId/ports", h.HandleDevicePorts)
+	r.GET("/api/v1/devices", h.HandleDeviceList)
+	port := func(n int) map[string]interface{} {
+		t.Helper()
+		w, resp := callAPI(r, http.MethodGet, "/api/v1/device/"+deviceID+"/ports", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("查询端口状态失败: %s", w.Body.String())
+		}
+		for _, item := range resp.Data["ports"].([]interface{}) {
+			p := item.(map[string]interface{})
+			if int(p["port"].(float64)) == n {
+				return p
+			}
+		}
+		t.Fatalf("缺少%d号端口: %s", n, w.Body.String())
+		return nil
+	}
+
+	for i, power := range []uint16{12000, 18500, 9000} {
+		sent := time.Now()
+		feed(handlers.NewPowerHeartbeatHandler())(device.PowerHeartbeat(simulator.PowerHeartbeat{
+			Port: 1, Status: 1, Duration: uint16(60 * (i + 1)), Energy: uint16(15 * (i + 1)), Power: power, OrderNo: orderNo,
+		}))
+		p := port(2)
+		if p["state"] != gateway.PortStateCharging || p["powerW"].(float64) != float64(power)/10 || p["energyWh"].(float64) != float64(15*(i+1)) || p["stale"] != false {
+			t.Fatalf("第%d次功率心跳未反映到端口状态: %+v", i+1, p)
+		}
+		updated, err := time.Parse(time.RFC3339Nano, p["lastUpdate"].(string))
+		if err != nil || updated.Before(sent.Add(-time.Second)) || time.Since(updated) > time.Second {
+			t.Fatalf("lastUpdate应为本次上报时间: %v %v", p["lastUpdate"], err)
+		}
+	}
+	// 充满后端口有充电器但未充电：功率归零
+	feed(handlers.NewPowerHeartbeatHandler())(device.PowerHeartbeat(simulator.PowerHeartbeat{Port: 1, Status: 3, Energy: 60, OrderNo: orderNo}))
+	if p := port(2); p["state"] != gateway.PortStateOccupiedNoCharge || p["powerW"].(float64) != 0 {
+		t.Fatalf("已充满端口应为occupied_no_charge且功率为0: %+v", p)
+	}
+
+	// 0x82受理开始充电：端口置为充电中，电量从0开始
+	if _, err := g.StartChargingWithRequest("", gateway.ChargeRequest{DeviceID: deviceID, Port: 1, OrderNo: "ORD-1765-B", Mode: 0, Value: 3600, Balance: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	down, err := device.ParseDownlink(waitFrames(t, conn, 1, nil)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed(&handlers.ChargeControlHandler{})(device.ChargeControlResponse(down.MessageID, dialect.ChargeControlResponse{Port: 0, OrderNo: "ORD-1765-B"}))
+	if p := port(1); p["state"] != gateway.PortStateCharging || p["energyWh"].(float64) != 0 || p["orderNo"] != "ORD-1765-B" {
+		t.Fatalf("受理后端口应为充电中: %+v", p)
+	}
+
+	// 故障端口与超过过期窗口未上报的端口
+	agg := g.GetStationAggregator()
+	agg.OnPortSample(deviceID, 3, gateway.PortSample{Status: 0x08}, time.Now())
+	agg.OnPortSample(deviceID, 4, gateway.PortSample{Status: 0x01, PowerW: 800}, time.Now().Add(-agg.PortStaleWindow()-time.Minute))
+	if p := port(3); p["state"] != gateway.PortStateFault || p["stale"] != false {
+		t.Fatalf("0x08应为故障端口: %+v", p)
+	}
+	if p := port(4); p["stale"] != true || p["powerW"].(float64) != 0 {
+		t.Fatalf("过期端口应标记stale且不展示最后功率: %+v", p)
+	}
+
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/devices?noCache=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("设备列表查询失败: %s", w.Body.String())
+	}
+	var summary map[string]interface{}
+	for _, item := range resp.Data["devices"].([]interface{}) {
+		if d := item.(map[string]interface{}); d["deviceId"] == deviceID {
+			summary, _ = d["portSummary"].(map[string]interface{})
+		}
+	}
+	if summary == nil || summary["portsTotal"].(float64) != 4 || summary["portsCharging"].(float64) != 1 || summary["portsFault"].(float64) != 1 || summary["portsStale"].(float64) != 1 {
+		t.Fatalf("设备列表端口汇总错误: %+v", summary)
+	}
+}
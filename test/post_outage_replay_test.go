@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/journal"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/bujia-iot/iot-zinx/pkg/replay"
+	"github.com/gin-gonic/gin"
+)
+
+// writeAliveMarker 模拟上次运行在 at 时刻停机
+func writeAliveMarker(t *testing.T, path string, at time.Time) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]interface{}{"lastAliveAt": at})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func replayCategoryPlan(t *testing.T, plan replay.Plan, category string) replay.CategoryPlan {
+	t.Helper()
+	for _, cp := range plan.Categories {
+		if cp.Category == category {
+			return cp
+		}
+	}
+	t.Fatalf("重放计划缺少类别 %s: %+v", category, plan.Categories)
+	return replay.CategoryPlan{}
+}
+
+func waitReplay(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("等待超时: %s", what)
+}
+
+// TestPostOutageReplay 停机6小时后重启：延迟命令、通知暂存与关键帧日志在批准前均不发送；按类别批准、限速、暂停与恢复
+func TestPostOutageReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stateFile := filepath.Join(t.TempDir(), "last_alive.json")
+	outageAt := time.Now().Add(-6 * time.Hour)
+	writeAliveMarker(t, stateFile, outageAt)
+
+	coordinator, err := replay.New(replay.Options{StateFile: stateFile, Threshold: time.Hour, RatePerSecond: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.SetGlobalCoordinator(coordinator)
+	defer replay.SetGlobalCoordinator(nil)
+	defer coordinator.Stop()
+
+	// 延迟命令：设备在线，停机前入队3条
+	var commandsSent atomic.Int32
+	deferred := gateway.NewDeferredQueue(config.DeferredCommandsConfig{}, func(string) bool { return true })
+	deferred.RegisterExecutor("noop", func(cmd gateway.DeferredCommand) (interface{}, error) {
+		commandsSent.Add(1)
+		return nil, nil
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := deferred.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF3", Kind: "noop"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 通知暂存：停机前暂存3条
+	spoolDir := t.TempDir()
+	spool, err := notification.OpenSpool(spoolDir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err := spool.Append(notification.SpoolEntry{
+			Event:     &notification.NotificationEvent{EventID: fmt.Sprintf("outage-%d", i), EventType: notification.EventTypeSettlement, DeviceID: "04A26CF3", Timestamp: outageAt},
+			Endpoint:  "billing",
+			SpooledAt: outageAt.Add(-time.Duration(3-i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink := newRoutingSink(http.StatusOK)
+	defer sink.server.Close()
+	svc, err := notification.NewNotificationService(&notification.NotificationConfig{
+		Enabled: true,
+		Endpoints: []notification.NotificationEndpoint{
+			{Name: "billing", URL: sink.server.URL, Timeout: time.Second, EventTypes: []string{"*"}, Enabled: true},
+		},
+		Retry: notification.RetryConfig{MaxAttempts: 1, InitialInterval: time.Millisecond},
+		Spool: notification.SpoolConfig{Enabled: true, Dir: spoolDir, ReplayInterval: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 关键帧日志：停机前已应答、未处理完的结算
+	frameJournal, err := journal.Open(config.FrameJournalConfig{Enabled: true, Dir: t.TempDir(), Commands: []int{constants.CmdSettlement}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frameJournal.Close()
+	if _, err := frameJournal.Append(journalEntry("04A26CF3", "outage-settle-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	coordinator.Register(replay.CategoryDeferredCommands, "延迟命令", deferred.ReplaySource())
+	coordinator.Register(replay.CategoryNotificationSpool, "通知暂存", svc.SpoolReplaySource())
+	coordinator.Register(replay.CategoryFrameJournal, "关键帧日志", handlers.FrameJournalReplaySource(frameJournal))
+	coordinator.Start()
+
+	// 各子系统的常规重放路径：设备上线下发、定时重新投递、启动重放
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = svc.Stop(context.Background()) }()
+	if deferred.Drain("04A26CF3") {
+		t.Fatal("暂缓期间设备上线不应下发延迟命令")
+	}
+	if !coordinator.Held(replay.CategoryFrameJournal) {
+		t.Fatal("暂缓期间关键帧日志不应在启动时重放")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if n := commandsSent.Load(); n != 0 {
+		t.Fatalf("批准前不应下发延迟命令: %d", n)
+	}
+	if got := sink.events(); len(got) != 0 {
+		t.Fatalf("批准前不应重新投递暂存通知: %v", got)
+	}
+	if n := len(frameJournal.Pending()); n != 1 {
+		t.Fatalf("批准前关键帧日志应保持未处理: %d", n)
+	}
+
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	t.Run("重放计划", func(t *testing.T) {
+		w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/replay-plan", "")
+		if w.Code != http.StatusOK || resp.Data["held"] != true {
+			t.Fatalf("停机6小时应暂缓重放: %d %s", w.Code, w.Body.String())
+		}
+		plan := coordinator.Plan()
+		if plan.DowntimeSeconds < int64(6*time.Hour/time.Second)-60 || plan.ThresholdSeconds != 3600 {
+			t.Fatalf("停机时长错误: %+v", plan)
+		}
+		want := map[string]int{replay.CategoryDeferredCommands: 3, replay.CategoryNotificationSpool: 3, replay.CategoryFrameJournal: 1}
+		for category, count := range want {
+			cp := replayCategoryPlan(t, plan, category)
+			if cp.State != replay.StatePendingApproval || cp.Count != count || cp.EstimatedOutbound != count || cp.OldestAt == nil {
+				t.Fatalf("%s 计划错误: %+v", category, cp)
+			}
+		}
+		spoolPlan := replayCategoryPlan(t, plan, replay.CategoryNotificationSpool)
+		if spoolPlan.MaxAgeSeconds < int64(6*time.Hour/time.Second) || spoolPlan.MaxAgeSeconds-spoolPlan.MinAgeSeconds != 120 {
+			t.Fatalf("积压时长范围错误: %+v", spoolPlan)
+		}
+	})
+
+	t.Run("按类别批准", func(t *testing.T) {
+		if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/replay-plan/approve", `{"categories":["unknown"]}`); w.Code != http.StatusNotFound {
+			t.Fatalf("未知类别应返回404: %d", w.Code)
+		}
+		if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/replay-plan/"+replay.CategoryNotificationSpool+"/pause", ""); w.Code != http.StatusConflict {
+			t.Fatalf("待审批的类别不可暂停: %d", w.Code)
+		}
+		w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/replay-plan/approve", `{"categories":["notification_spool"]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("批准失败: %d %s", w.Code, w.Body.String())
+		}
+		waitReplay(t, "暂存通知重放完成", func() bool {
+			return replayCategoryPlan(t, coordinator.Plan(), replay.CategoryNotificationSpool).State == replay.StateCompleted
+		})
+		if got := sink.events(); len(got) != 3 || got[0] != "outage-0" || got[2] != "outage-2" {
+			t.Fatalf("暂存通知应按序重新投递: %v", got)
+		}
+		progress := replayCategoryPlan(t, coordinator.Plan(), replay.CategoryNotificationSpool).Progress
+		if progress.Total != 3 || progress.Replayed != 3 || progress.FinishedAt == nil {
+			t.Fatalf("进度错误: %+v", progress)
+		}
+		if coordinator.Held(replay.CategoryNotificationSpool) || !coordinator.Held(replay.CategoryDeferredCommands) {
+			t.Fatal("只应放行已批准的类别")
+		}
+		if n := commandsSent.Load(); n != 0 || len(frameJournal.Pending()) != 1 {
+			t.Fatalf("未批准的类别不应重放: %d %d", n, len(frameJournal.Pending()))
+		}
+	})
+
+	t.Run("限速与暂停", func(t *testing.T) {
+		if _, err := coordinator.Approve(replay.ApproveRequest{Categories: []string{replay.CategoryDeferredCommands}, RatePerSecond: 5}); err != nil {
+			t.Fatal(err)
+		}
+		waitReplay(t, "首条延迟命令下发", func() bool { return commandsSent.Load() >= 1 })
+		if err := coordinator.Pause(replay.CategoryDeferredCommands); err != nil {
+			t.Fatal(err)
+		}
+		paused := commandsSent.Load()
+		time.Sleep(500 * time.Millisecond)
+		if n := commandsSent.Load(); n != paused || n == 3 {
+			t.Fatalf("暂停期间不应继续下发: %d → %d", paused, n)
+		}
+		cp := replayCategoryPlan(t, coordinator.Plan(), replay.CategoryDeferredCommands)
+		if cp.State != replay.StatePaused || cp.RatePerSecond != 5 || cp.Progress.Replayed != int(paused) {
+			t.Fatalf("暂停状态错误: %+v", cp)
+		}
+		if deferred.Drain("04A26CF3") {
+			t.Fatal("暂停期间设备上线不应绕过重放下发")
+		}
+		if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/replay-plan/"+replay.CategoryDeferredCommands+"/resume", ""); w.Code != http.StatusOK {
+			t.Fatalf("恢复失败: %d", w.Code)
+		}
+		waitReplay(t, "延迟命令重放完成", func() bool {
+			return replayCategoryPlan(t, coordinator.Plan(), replay.CategoryDeferredCommands).State == replay.StateCompleted
+		})
+		if n := commandsSent.Load(); n != 3 {
+			t.Fatalf("延迟命令应全部下发: %d", n)
+		}
+	})
+
+	t.Run("批准其余类别", func(t *testing.T) {
+		w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/replay-plan/approve", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("批准失败: %d %s", w.Code, w.Body.String())
+		}
+		waitReplay(t, "关键帧日志重放完成", func() bool { return !coordinator.Held(replay.CategoryFrameJournal) })
+		if n := len(frameJournal.Pending()); n != 0 {
+			t.Fatalf("关键帧日志应全部重放: %d", n)
+		}
+		if cp := replayCategoryPlan(t, coordinator.Plan(), replay.CategoryFrameJournal); cp.Progress.Replayed != 1 {
+			t.Fatalf("关键帧日志进度错误: %+v", cp.Progress)
+		}
+	})
+
+	t.Run("重放完成后按常规流程重启", func(t *testing.T) {
+		coordinator.Stop()
+		restarted, err := replay.New(replay.Options{StateFile: stateFile, Threshold: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restarted.Downtime() > time.Minute || restarted.Held(replay.CategoryDeferredCommands) {
+			t.Fatalf("短暂重启不应暂缓重放: %s", restarted.Downtime())
+		}
+		if _, err := restarted.Approve(replay.ApproveRequest{}); !errors.Is(err, replay.ErrNotHeld) {
+			t.Fatalf("未暂缓时批准应返回 ErrNotHeld: %v", err)
+		}
+	})
+}
+
+// TestPostOutageReplayCarryOver 暂缓的积压未重放完就再次停机时，即使停机时长很短也继续暂缓；自动批准时启动后直接按速率重放
+func TestPostOutageReplayCarryOver(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "last_alive.json")
+	writeAliveMarker(t, stateFile, time.Now().Add(-6*time.Hour))
+
+	first, err := replay.New(replay.Options{StateFile: stateFile, Threshold: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deferred := gateway.NewDeferredQueue(config.DeferredCommandsConfig{}, func(string) bool { return true })
+	var sent atomic.Int32
+	deferred.RegisterExecutor("noop", func(cmd gateway.DeferredCommand) (interface{}, error) {
+		sent.Add(1)
+		return nil, nil
+	})
+	if _, err := deferred.Enqueue(gateway.DeferredRequest{DeviceID: "04A26CF4", Kind: "noop"}); err != nil {
+		t.Fatal(err)
+	}
+	first.Register(replay.CategoryDeferredCommands, "延迟命令", deferred.ReplaySource())
+	first.Start()
+	first.Stop()
+
+	second, err := replay.New(replay.Options{StateFile: stateFile, Threshold: time.Hour, AutoApprove: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Stop()
+	if !second.Held(replay.CategoryDeferredCommands) {
+		t.Fatal("上次暂缓的积压未重放完，本次应继续暂缓")
+	}
+	if sent.Load() != 0 {
+		t.Fatal("批准前不应下发")
+	}
+	second.Register(replay.CategoryDeferredCommands, "延迟命令", deferred.ReplaySource())
+	second.Start()
+	waitReplay(t, "自动批准后重放完成", func() bool { return !second.Held(replay.CategoryDeferredCommands) })
+	if sent.Load() != 1 {
+		t.Fatalf("自动批准后应下发: %d", sent.Load())
+	}
+	if cp := replayCategoryPlan(t, second.Plan(), replay.CategoryDeferredCommands); cp.ApprovedBy != "auto" {
+		t.Fatalf("应记录自动批准: %+v", cp)
+	}
+}
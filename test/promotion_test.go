@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// TestPromotionPolicy 充电促销策略测试
+func TestPromotionPolicy(t *testing.T) {
+	timeMode := 0
+	policy, err := gateway.NewConfigPromotionPolicy(config.PromotionConfig{
+		Enabled: true,
+		Rules: []config.PromotionRuleConfig{
+			{
+				ID:              "weekend_free30",
+				Tag:             "FREE30",
+				Start:           "2025-06-07 00:00:00",
+				End:             "2025-06-08 23:59:59",
+				Weekdays:        []int{0, 6},
+				DeviceIDs:       []string{"04a26cf3"},
+				Tenants:         []string{"tenant_a"},
+				Free:            true,
+				RateMode:        &timeMode,
+				DurationSeconds: 1800,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建促销策略失败: %v", err)
+	}
+
+	saturday := time.Date(2025, 6, 7, 10, 0, 0, 0, time.Local)
+	req := gateway.ChargeRequest{DeviceID: "04A26CF3", TenantID: "tenant_a", Port: 1, OrderNo: "ORDER_PROMO_001", Mode: 1, Value: 100, Balance: 500}
+
+	promo, ok := policy.Apply(req, saturday)
+	if !ok {
+		t.Fatal("窗口内且在范围内的请求应命中促销")
+	}
+	if promo.Tag != "FREE30" || promo.Mode != 0 || promo.Value != 1800 || promo.Balance != 500 {
+		t.Fatalf("促销覆盖结果错误: %+v", promo)
+	}
+	if promo.OriginalMode != 1 || promo.OriginalValue != 100 {
+		t.Fatalf("应保留原始参数: %+v", promo)
+	}
+
+	if _, ok := policy.Apply(req, saturday.AddDate(0, 0, 7)); ok {
+		t.Fatal("窗口外不应命中")
+	}
+	other := req
+	other.TenantID = "tenant_b"
+	if _, ok := policy.Apply(other, saturday); ok {
+		t.Fatal("其他租户不应命中")
+	}
+	other = req
+	other.DeviceID = "04A228CD"
+	if _, ok := policy.Apply(other, saturday); ok {
+		t.Fatal("其他设备不应命中")
+	}
+
+	t.Run("免费会话结算对账", func(t *testing.T) {
+		g := gateway.NewDeviceGateway()
+		om := g.GetOrderManager()
+		if err := om.CreateOrder(req.DeviceID, req.Port, req.OrderNo, promo.Mode, promo.Value, promo.Balance); err != nil {
+			t.Fatalf("创建订单失败: %v", err)
+		}
+		if err := om.SetOrderPromotion(req.DeviceID, req.Port, promo); err != nil {
+			t.Fatalf("记录促销失败: %v", err)
+		}
+
+		if check := g.CheckPromotionSettlement(req.OrderNo, 0); check == nil || check.Discrepancy {
+			t.Fatalf("费用为0不应产生差异: %+v", check)
+		}
+		check := g.CheckPromotionSettlement(req.OrderNo, 120)
+		if check == nil || !check.Discrepancy || check.Promotion.Tag != "FREE30" {
+			t.Fatalf("免费会话非0费用应产生差异: %+v", check)
+		}
+		if g.CheckPromotionSettlement("ORDER_UNKNOWN", 120) != nil {
+			t.Fatal("无促销订单不应返回对账结果")
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aceld/zinx/znet"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/gin-gonic/gin"
+)
+
+// TestProtocolCatalogCoversRegisteredDecoders 注册了处理器的命令码必须都在协议目录中，保证代码与文档同步
+func TestProtocolCatalogCoversRegisteredDecoders(t *testing.T) {
+	server := znet.NewServer()
+	handlers.RegisterRouters(server)
+	msgHandler, ok := server.GetMsgHandler().(*znet.MsgHandle)
+	if !ok {
+		t.Fatal("无法获取路由表")
+	}
+	registered := 0
+	for msgID := range msgHandler.Apis {
+		if msgID > 0xFF {
+			continue // 特殊消息（ICCID/link心跳/未知数据）不是DNY命令码
+		}
+		registered++
+		if !dny_protocol.IsKnownCommand(uint8(msgID)) {
+			t.Errorf("命令码 0x%02X 已注册处理器但不在协议目录中，请补充 pkg/constants/command_definitions.go", msgID)
+		}
+	}
+	if registered == 0 {
+		t.Fatal("未发现任何DNY命令处理器")
+	}
+}
+
+// TestProtocolCatalogAPI 命令码表与枚举表接口、日志命令标识
+func TestProtocolCatalogAPI(t *testing.T) {
+	if got := dny_protocol.CommandLabel(constants.CmdChargeControl); got != "0x82 服务器开始、停止充电操作" {
+		t.Fatalf("命令标识错误: %s", got)
+	}
+	if got := dny_protocol.CommandLabel(0x07); got != "0x07 未知命令" {
+		t.Fatalf("未知命令标识错误: %s", got)
+	}
+	if got := dny_protocol.StopReasonName(dny_protocol.StopReasonServerStop); got != "服务器控制停止" {
+		t.Fatalf("停止原因名称错误: %s", got)
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := apihttp.NewToolHandlers()
+	r := gin.New()
+	r.GET("/api/v1/protocol/commands", h.HandleProtocolCommands)
+	r.GET("/api/v1/protocol/enums", h.HandleProtocolEnums)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/protocol/commands", nil))
+	var commands struct {
+		Data []dny_protocol.CommandEntry `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &commands); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("命令码表接口错误: %d %s", w.Code, w.Body.String())
+	}
+	var register *dny_protocol.CommandEntry
+	for i, cmd := range commands.Data {
+		if i > 0 && commands.Data[i-1].Code >= cmd.Code {
+			t.Fatal("命令码表应按命令码升序")
+		}
+		if cmd.Code == constants.CmdDeviceRegister {
+			register = &commands.Data[i]
+		}
+	}
+	if register == nil || register.Hex != "0x20" || register.Direction != dny_protocol.DirectionUpstream {
+		t.Fatalf("注册命令条目错误: %+v", register)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/protocol/enums", nil))
+	var enums struct {
+		Data []dny_protocol.ProtocolEnum `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &enums); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("枚举表接口错误: %d %s", w.Code, w.Body.String())
+	}
+	keys := map[string]int{}
+	for _, e := range enums.Data {
+		keys[e.Key] = len(e.Values)
+	}
+	for _, key := range []string{"responseCode", "chargeResponse", "rateMode", "stopReason"} {
+		if keys[key] == 0 {
+			t.Fatalf("缺少枚举表 %s: %v", key, keys)
+		}
+	}
+}
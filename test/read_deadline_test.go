@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+)
+
+// readDeadlineTestConn 记录是否被断开，GetConnection 返回nil（不设置套接字读超时）
+type readDeadlineTestConn struct {
+	ziface.IConnection
+	id      uint64
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (c *readDeadlineTestConn) GetConnID() uint64       { return c.id }
+func (c *readDeadlineTestConn) GetConnection() net.Conn { return nil }
+func (c *readDeadlineTestConn) Stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+}
+func (c *readDeadlineTestConn) isStopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stopped
+}
+
+// TestReadDeadlineEscalation 按帧间隔自适应读超时：不同上报间隔均无误断连，对端失联后先探测再及时断开
+func TestReadDeadlineEscalation(t *testing.T) {
+	const sweepStep = 5 * time.Second
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 运行 [from, to) 区间内的巡检，返回首次断开的时间点
+	sweepUntil := func(tracker *network.ReadDeadlineTracker, conn *readDeadlineTestConn, from, to time.Time) (time.Time, bool) {
+		for now := from; now.Before(to); now = now.Add(sweepStep) {
+			tracker.Sweep(now)
+			if conn.isStopped() {
+				return now, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	for _, tc := range []struct {
+		name      string
+		interval  time.Duration
+		effective time.Duration // 稳定后的有效读超时
+	}{
+		{"30秒上报", 30 * time.Second, 90 * time.Second},    // 3×30=90，恰为下限
+		{"60秒上报", 60 * time.Second, 180 * time.Second},   // 3×60
+		{"300秒上报", 300 * time.Second, 900 * time.Second}, // 3×300=900，恰为上限
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := network.NewReadDeadlineTracker(network.ReadDeadlineOptions{})
+			var probed []string
+			tracker.SetProbe(func(deviceID string) error {
+				probed = append(probed, deviceID)
+				return nil
+			})
+			conn := &readDeadlineTestConn{id: 1676000 + uint64(tc.interval.Seconds())}
+			tracker.OnConnect(conn, base)
+			tracker.OnFrame(conn, base) // 注册包
+			tracker.MarkRegistered(conn, "04B16760", base)
+
+			// 上报间隔抖动 ±20%，其中一次保活延迟到 1.8 倍间隔
+			now := base
+			for i := 0; i < 30; i++ {
+				gap := tc.interval
+				switch {
+				case i == 20:
+					gap = tc.interval * 18 / 10
+				case i%3 == 1:
+					gap = tc.interval * 12 / 10
+				case i%3 == 2:
+					gap = tc.interval * 8 / 10
+				}
+				next := now.Add(gap)
+				if at, stopped := sweepUntil(tracker, conn, now, next); stopped {
+					t.Fatalf("第%d帧前误断连: %s", i, at.Sub(base))
+				}
+				tracker.OnFrame(conn, next)
+				// 同一批上报的紧随帧不计入帧间隔样本
+				tracker.OnFrame(conn, next.Add(100*time.Millisecond))
+				now = next
+			}
+			if len(probed) != 0 {
+				t.Fatalf("正常上报不应触发探测: %v", probed)
+			}
+			status, ok := tracker.Status(conn.id)
+			if !ok || !status.Registered || status.Stage != network.DeadlineStageNormal || status.Samples != 30 {
+				t.Fatalf("状态异常: %+v", status)
+			}
+			if ewma := time.Duration(status.EWMASeconds * float64(time.Second)); ewma < tc.interval*8/10 || ewma > tc.interval*14/10 {
+				t.Fatalf("EWMA应接近上报间隔 %s，实际 %s", tc.interval, ewma)
+			}
+			effective := time.Duration(status.EffectiveSeconds * float64(time.Second))
+			if effective < 90*time.Second || effective > 900*time.Second ||
+				effective < tc.effective*8/10 || effective > tc.effective*14/10 {
+				t.Fatalf("有效读超时应接近 %s 且限制在[90s,900s]: %s", tc.effective, effective)
+			}
+
+			// 对端失联：超过有效读超时先告警并探测，宽限期后断开
+			lastFrame := now.Add(100 * time.Millisecond)
+			warnAt, closeAt := lastFrame.Add(effective), lastFrame.Add(effective+30*time.Second)
+			if !status.WarnAt.Equal(warnAt) || !status.CloseAt.Equal(closeAt) {
+				t.Fatalf("告警/断开时间点错误: %+v", status)
+			}
+			stoppedAt, stopped := sweepUntil(tracker, conn, now.Add(sweepStep), closeAt.Add(time.Minute))
+			if !stopped || stoppedAt.Before(closeAt) || stoppedAt.Sub(closeAt) > sweepStep {
+				t.Fatalf("应在 %s 后一个巡检周期内断开，实际 %v/%s", closeAt.Sub(lastFrame), stopped, stoppedAt.Sub(lastFrame))
+			}
+			if len(probed) != 1 || probed[0] != "04B16760" {
+				t.Fatalf("断开前应探测一次: %v", probed)
+			}
+			if _, ok := tracker.Status(conn.id); ok {
+				t.Fatal("断开后应移除连接状态")
+			}
+		})
+	}
+
+	t.Run("30秒设备失联约2分钟内断开", func(t *testing.T) {
+		tracker := network.NewReadDeadlineTracker(network.ReadDeadlineOptions{})
+		conn := &readDeadlineTestConn{id: 1676101}
+		tracker.OnConnect(conn, base)
+		tracker.MarkRegistered(conn, "04B16761", base)
+		now := base
+		for i := 0; i < 10; i++ {
+			now = now.Add(30 * time.Second)
+			tracker.OnFrame(conn, now)
+		}
+		stoppedAt, stopped := sweepUntil(tracker, conn, now, now.Add(10*time.Minute))
+		if !stopped || stoppedAt.Sub(now) > 125*time.Second {
+			t.Fatalf("失联检测过慢（固定300秒读超时的问题）: %v/%s", stopped, stoppedAt.Sub(now))
+		}
+	})
+
+	t.Run("探测应答后恢复", func(t *testing.T) {
+		tracker := network.NewReadDeadlineTracker(network.ReadDeadlineOptions{})
+		conn := &readDeadlineTestConn{id: 1676102}
+		probes := 0
+		tracker.SetProbe(func(string) error { probes++; return nil })
+		tracker.OnConnect(conn, base)
+		tracker.MarkRegistered(conn, "04B16762", base)
+		tracker.OnFrame(conn, base.Add(30*time.Second))
+		warnAt := base.Add(30*time.Second + 90*time.Second)
+		tracker.Sweep(warnAt)
+		if status, _ := tracker.Status(conn.id); status.Stage != network.DeadlineStageWarning || status.Probes != 1 || probes != 1 {
+			t.Fatalf("应进入告警阶段并探测: %+v", status)
+		}
+		tracker.OnFrame(conn, warnAt.Add(2*time.Second)) // 探测应答
+		tracker.Sweep(warnAt.Add(40 * time.Second))
+		if status, _ := tracker.Status(conn.id); conn.isStopped() || status.Stage != network.DeadlineStageNormal {
+			t.Fatalf("收到应答后应恢复正常: %+v", status)
+		}
+	})
+
+	t.Run("未注册连接短读超时", func(t *testing.T) {
+		tracker := network.NewReadDeadlineTracker(network.ReadDeadlineOptions{})
+		conn := &readDeadlineTestConn{id: 1676103}
+		probes := 0
+		tracker.SetProbe(func(string) error { probes++; return nil })
+		tracker.OnConnect(conn, base)
+		tracker.OnFrame(conn, base.Add(2*time.Second)) // ICCID
+		if status, _ := tracker.Status(conn.id); status.Stage != network.DeadlineStagePreRegistration || status.EffectiveSeconds != 60 {
+			t.Fatalf("未注册阶段应使用固定读超时: %+v", status)
+		}
+		tracker.Sweep(base.Add(61 * time.Second))
+		if conn.isStopped() {
+			t.Fatal("未到读超时不应断开")
+		}
+		tracker.Sweep(base.Add(62 * time.Second))
+		if !conn.isStopped() || probes != 0 {
+			t.Fatalf("未注册连接超时应直接断开且不探测: stopped=%v probes=%d", conn.isStopped(), probes)
+		}
+	})
+
+	t.Run("参数限制", func(t *testing.T) {
+		opts := network.NewReadDeadlineTracker(network.ReadDeadlineOptions{Min: 600 * time.Second, Max: 300 * time.Second, Alpha: 2}).Options()
+		if opts.Max != opts.Min || opts.Alpha <= 0 || opts.Alpha > 1 || opts.Factor != 3 {
+			t.Fatalf("参数未按默认值修正: %+v", opts)
+		}
+	})
+}
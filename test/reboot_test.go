@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// TestDeviceReboot 远程重启安全联锁与跟踪测试
+func TestDeviceReboot(t *testing.T) {
+	const deviceID = "04A26CF3"
+
+	t.Run("离线设备拒绝重启", func(t *testing.T) {
+		g := gateway.NewDeviceGateway()
+		if _, err := g.RebootDevice("req-reboot-1", deviceID, true); err == nil {
+			t.Fatal("离线设备不应下发重启")
+		}
+		if len(g.GetRebootTracker().History(deviceID)) != 0 {
+			t.Fatal("下发失败不应产生重启记录")
+		}
+	})
+
+	t.Run("进行中会话错误信息", func(t *testing.T) {
+		err := &gateway.ActiveSessionsError{
+			DeviceID: deviceID,
+			Sessions: []*gateway.OrderState{{DeviceID: deviceID, Port: 1, OrderNo: "ORDER_REBOOT_001"}},
+		}
+		if !strings.Contains(err.Error(), "1:ORDER_REBOOT_001") || !strings.Contains(err.Error(), "force=true") {
+			t.Fatalf("错误信息应包含会话与处理提示: %s", err.Error())
+		}
+	})
+
+	t.Run("无进行中重启时注册与超时检查为空操作", func(t *testing.T) {
+		g := gateway.NewDeviceGateway()
+		events := make(chan gateway.RebootEvent, 1)
+		g.GetRebootTracker().RegisterHandler(func(e gateway.RebootEvent) { events <- e })
+
+		g.OnDeviceRegistered(deviceID)
+		if fired := g.CheckRebootTimeouts(time.Now().Add(time.Hour)); len(fired) != 0 {
+			t.Fatalf("不应触发重启超时: %+v", fired)
+		}
+		select {
+		case e := <-events:
+			t.Fatalf("不应产生重启事件: %+v", e)
+		default:
+		}
+		if _, ok := g.GetRebootTracker().Wait(deviceID, "reboot_unknown", 10*time.Millisecond); ok {
+			t.Fatal("未知重启记录不应返回")
+		}
+	})
+
+	t.Run("中断状态字符串", func(t *testing.T) {
+		if gateway.OrderStatusInterruptedByReboot.String() != "interrupted_by_reboot" {
+			t.Fatalf("状态字符串错误: %s", gateway.OrderStatusInterruptedByReboot.String())
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+)
+
+// TestReconcileDailyReport 会话与结算按订单号匹配：零点后宽限期内的结算计入当日、取消会话单列、无会话结算、重启后报告仍可获取
+func TestReconcileDailyReport(t *testing.T) {
+	dir := t.TempDir()
+	r, err := reconcile.NewReconciler(reconcile.Options{Dir: dir, Grace: time.Hour})
+	if err != nil {
+		t.Fatalf("创建对账器失败: %v", err)
+	}
+	ledger := r.Ledger()
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	session := func(orderNo string, start time.Time, status string) {
+		ledger.RecordSession(reconcile.SessionRecord{OrderNo: orderNo, DeviceID: "04A2715A", Port: 1, StartTime: start, Status: status, UpdatedAt: start})
+	}
+	settle := func(orderNo string, received time.Time, energy, fee uint32) {
+		ledger.RecordSettlement(reconcile.SettlementRecord{OrderNo: orderNo, DeviceID: "04A2715A", Port: 1, EnergyWh: energy, TotalFee: fee, ReceivedAt: received})
+	}
+
+	session("ORDER_A", at(10, 0), "charging")
+	settle("ORDER_A", at(18, 0), 1000, 150)
+	session("ORDER_B", at(23, 50), "charging")
+	settle("ORDER_B", at(24, 20), 200, 30) // 次日00:20，宽限期内
+	session("ORDER_C", at(12, 0), "charging")
+	session("ORDER_D", at(13, 0), "pending")
+	ledger.RecordSession(reconcile.SessionRecord{OrderNo: "ORDER_D", Status: "cancelled", Reason: "排队超时自动取消", UpdatedAt: at(13, 30)})
+	session("ORDER_E", at(23, 55), "charging")
+	settle("ORDER_E", at(26, 0), 300, 40) // 次日02:00，超出宽限期
+	settle("ORDER_X", at(15, 0), 500, 70) // 无对应会话
+	session("ORDER_P", at(-1, 0), "charging")
+	settle("ORDER_P", at(0, 10), 400, 60) // 前一日开始的会话，不计为无会话结算
+	if ledger.RecordSettlement(reconcile.SettlementRecord{OrderNo: "ORDER_A", ReceivedAt: at(19, 0)}) {
+		t.Fatal("重复结算不应再次记录")
+	}
+
+	report, err := r.Run(day, reconcile.TriggerManual)
+	if err != nil {
+		t.Fatalf("对账失败: %v", err)
+	}
+	if report.SessionCount != 5 || report.MatchedCount != 2 || report.LateCount != 1 || report.ExplainedCount != 1 ||
+		report.MissingCount != 2 || report.OrphanCount != 1 || report.SettlementCount != 3 || report.Provisional {
+		t.Fatalf("对账计数错误: %+v", report.Summary())
+	}
+	if report.MatchedTotals.EnergyWh != 1200 || report.MatchedTotals.TotalFee != 180 || report.OrphanTotals.TotalFee != 70 {
+		t.Fatalf("合计错误: %+v %+v", report.MatchedTotals, report.OrphanTotals)
+	}
+	explained := report.ExplainedSessions[0]
+	if explained.OrderNo != "ORDER_D" || explained.Reason != "排队超时自动取消" || !explained.StartTime.Equal(at(13, 0)) {
+		t.Fatalf("取消会话应保留开始时间与原因: %+v", explained)
+	}
+	if report.MissingSettlements[0].OrderNo != "ORDER_C" || report.MissingSettlements[1].OrderNo != "ORDER_E" {
+		t.Fatalf("缺失结算列表错误: %+v", report.MissingSettlements)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("导出CSV失败: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 7 || rows[0][0] != "category" {
+		t.Fatalf("CSV行数错误: %d %v", len(rows), err)
+	}
+
+	// 重启后台账与报告均可恢复
+	reloaded, err := reconcile.NewReconciler(reconcile.Options{Dir: dir, Grace: time.Hour})
+	if err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if saved, ok := reloaded.GetReport("2026-10-01"); !ok || saved.MissingCount != 2 {
+		t.Fatal("重启后应能获取已保存的报告")
+	}
+	if s, ok := reloaded.Ledger().Session("ORDER_D"); !ok || s.Status != "cancelled" {
+		t.Fatalf("重启后会话应为最后已知状态: %+v", s)
+	}
+	if rerun, _ := reloaded.Run(day, reconcile.TriggerManual); rerun.MatchedCount != 2 || rerun.OrphanCount != 1 {
+		t.Fatalf("重启后对账结果应一致: %+v", rerun.Summary())
+	}
+}
+
+// TestOrderChangesFeedReconcileLedger 订单创建与状态变更记入对账台账
+func TestOrderChangesFeedReconcileLedger(t *testing.T) {
+	r, err := reconcile.NewReconciler(reconcile.Options{})
+	if err != nil {
+		t.Fatalf("创建对账器失败: %v", err)
+	}
+	om := gateway.NewOrderManager()
+	defer om.Shutdown()
+	om.RegisterChangeHandler(func(order gateway.OrderState) {
+		r.Ledger().RecordSession(reconcile.SessionRecord{
+			OrderNo: order.OrderNo, DeviceID: order.DeviceID, Port: order.Port,
+			StartTime: order.StartTime, Status: order.Status.String(), Reason: order.ErrorReason,
+		})
+	})
+
+	if err := om.CreateOrder("04A2715A", 1, "ORDER_1656", 0, 60, 0); err != nil {
+		t.Fatalf("创建订单失败: %v", err)
+	}
+	_ = om.UpdateOrderStatus("04A2715A", 1, gateway.OrderStatusCharging, "充电命令发送成功")
+	_ = om.UpdateOrderStatus("04A2715A", 9, gateway.OrderStatusCharging, "") // 不存在的订单不触发回调
+
+	s, ok := r.Ledger().Session("ORDER_1656")
+	if !ok || s.Status != "charging" || s.Port != 1 || s.StartTime.IsZero() {
+		t.Fatalf("台账会话记录错误: %+v", s)
+	}
+	if om.ChangeHandlerCount() != 1 {
+		t.Fatal("回调数量错误")
+	}
+}
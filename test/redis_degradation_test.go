@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/lifecycle"
+	infraredis "github.com/bujia-iot/iot-zinx/internal/infrastructure/redis"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/changelog"
+	"github.com/bujia-iot/iot-zinx/pkg/cluster"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/idempotency"
+	"github.com/bujia-iot/iot-zinx/pkg/msgid"
+	"github.com/bujia-iot/iot-zinx/pkg/notification"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// TestRedisDegradation 运行中停止Redis：闸门进入降级并只回调一次，幂等改用本地LRU、持久化写入有界暂存、集群归属按单实例运行，
+// /readyz 返回200并标注 degraded；Redis恢复后回放暂存（同键取最新值）并回调一次恢复，各功能回切Redis
+func TestRedisDegradation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		localDevice  = "04B16931"
+		remoteDevice = "04B16932"
+	)
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr(), MaxRetries: -1, DialTimeout: 200 * time.Millisecond, ReadTimeout: 200 * time.Millisecond})
+	defer client.Close()
+
+	health := infraredis.NewHealth(client, infraredis.HealthOptions{Interval: 20 * time.Millisecond, ProbeTimeout: 200 * time.Millisecond, FailureThreshold: 2, SpoolMaxBytes: 4096})
+	infraredis.SetGlobalHealth(health)
+	defer infraredis.SetGlobalHealth(nil)
+	var mu sync.Mutex
+	var transitions []infraredis.Transition
+	health.RegisterHandler(func(tr infraredis.Transition) {
+		mu.Lock()
+		transitions = append(transitions, tr)
+		mu.Unlock()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	health.Start(ctx)
+	defer health.Stop()
+
+	readiness := lifecycle.GetReadiness()
+	readiness.AddDegradationCheck("redis", infraredis.DegradedReason)
+	readiness.MarkStarted(lifecycle.ComponentHTTP)
+	readiness.MarkStarted(lifecycle.ComponentTCP)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	registerSharedGroup(t, 1693001, "89860400000016930001", []string{localDevice})
+	guard := idempotency.NewGuard(client, time.Minute, 100)
+	idempotency.SetGlobalGuard(guard)
+	defer idempotency.SetGlobalGuard(nil)
+	startCharging := func(orderNo string) (int, replicaResponse) {
+		w, resp := callAPI(r, http.MethodPost, "/api/v1/charging/start", `{"deviceId":"`+localDevice+`","port":1,"mode":0,"value":60,"balance":1000,"orderNo":"`+orderNo+`"}`)
+		return w.Code, resp
+	}
+
+	seqStore := msgid.NewRedisStore(client, "test:msgid")
+	changes := changelog.NewRedisStore(client, "test:changelog", 10)
+	ownerStore := cluster.NewRedisStore(client, "test:owner:")
+	self := cluster.NewOwnership(cluster.Options{Enabled: true, InstanceID: "gw-a", Store: ownerStore, Local: fakeLocalDevices{localDevice: true}, LookupCacheTTL: time.Nanosecond})
+	peer := cluster.NewOwnership(cluster.Options{Enabled: true, InstanceID: "gw-b", APIBaseURL: "http://10.0.0.12:7055", Store: ownerStore, Local: fakeLocalDevices{remoteDevice: true}})
+
+	waitStatus := func(want infraredis.Status) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for health.Status() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待Redis状态 %s 超时，当前 %s", want, health.Status())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	readyz := func() (int, replicaResponse) {
+		w, resp := callAPI(r, http.MethodGet, "/readyz", "")
+		return w.Code, resp
+	}
+
+	t.Run("Redis可用", func(t *testing.T) {
+		if code, resp := startCharging("ORD1693A"); code != http.StatusOK {
+			t.Fatalf("首次下单应成功: %d %v", code, resp)
+		}
+		if code, resp := startCharging("ORD1693A"); code != http.StatusConflict || resp.Data["errorCode"] != apihttp.ErrorCodeDuplicateOrder || resp.Data["source"] != idempotency.SourceRedis {
+			t.Fatalf("窗口内重复订单号应经Redis拒绝: %d %v", code, resp.Data)
+		}
+		if err := seqStore.Save(msgid.Record{LastMessageID: 1}); err != nil {
+			t.Fatal(err)
+		}
+		peer.Sync()
+		if owner, ok := self.LookupRemote(remoteDevice); !ok || owner.InstanceID != "gw-b" {
+			t.Fatalf("应查到其他实例持有的设备: %v %v", owner, ok)
+		}
+		if code, resp := readyz(); code != http.StatusOK || resp.Data["status"] != apihttp.ReadyStatusReady {
+			t.Fatalf("Redis可用时应为ready: %d %v", code, resp.Data)
+		}
+	})
+
+	t.Run("运行中停止Redis进入降级", func(t *testing.T) {
+		mr.Close()
+		waitStatus(infraredis.StatusDegraded)
+		time.Sleep(60 * time.Millisecond) // 后续探测仍失败，不应重复回调
+		mu.Lock()
+		if len(transitions) != 1 || transitions[0].To != infraredis.StatusDegraded || transitions[0].Reason == "" {
+			t.Fatalf("降级应只回调一次: %+v", transitions)
+		}
+		mu.Unlock()
+
+		code, resp := readyz()
+		degraded, _ := resp.Data["degraded"].(map[string]interface{})
+		if code != http.StatusOK || resp.Data["status"] != apihttp.ReadyStatusDegraded || degraded["redis"] == nil {
+			t.Fatalf("降级运行应返回200并标注degraded: %d %v", code, resp.Data)
+		}
+
+		// 幂等：中断前登记的订单号在本实例仍可识别，新订单号改用本地LRU
+		if code, resp := startCharging("ORD1693A"); code != http.StatusConflict || resp.Data["source"] != idempotency.SourceLocal {
+			t.Fatalf("中断前登记的订单号仍应拒绝: %d %v", code, resp.Data)
+		}
+		if fresh, source := guard.Claim("ORD1693B"); !fresh || source != idempotency.SourceLocal {
+			t.Fatalf("降级期间新订单号应经本地LRU放行: %v %s", fresh, source)
+		}
+		if fresh, _ := guard.Claim("ORD1693B"); fresh {
+			t.Fatal("降级期间本地LRU应拒绝重复订单号")
+		}
+
+		// 持久化：写入有界暂存，超出上限丢弃最早的暂存；同键只保留最新值
+		for i := 0; i < 8; i++ {
+			_ = infraredis.SetOrSpool(context.Background(), client, fmt.Sprintf("test:bulk:%d", i), []byte(strings.Repeat("x", 700)))
+		}
+		bulk := health.Stats()
+		if bulk.SpoolBytes > 4096 || bulk.SpoolDropped == 0 {
+			t.Fatalf("暂存应有上限并丢弃最早的写入: %+v", bulk)
+		}
+		for id := uint16(2); id <= 3; id++ {
+			if err := seqStore.Save(msgid.Record{LastMessageID: id}); err != nil {
+				t.Fatalf("降级期间写入应暂存成功: %v", err)
+			}
+		}
+		if err := changes.Append([]changelog.Record{{ID: 1, Endpoint: "/api/v1/charging/start"}, {ID: 2, Endpoint: "/api/v1/charging/stop"}}); err != nil {
+			t.Fatal(err)
+		}
+		if stats := health.Stats(); stats.SpoolEntries != bulk.SpoolEntries+2 || stats.SpoolDropped != bulk.SpoolDropped {
+			t.Fatalf("同键暂存应只保留最新值: %+v", stats)
+		}
+
+		// 集群归属：按单实例运行，本实例设备归属本实例，其他设备视为无归属且不等待Redis超时
+		start := time.Now()
+		if _, ok := self.LookupRemote(remoteDevice); ok || time.Since(start) > 50*time.Millisecond {
+			t.Fatalf("降级期间不应查询其他实例的归属: %v %s", ok, time.Since(start))
+		}
+		if owner, ok := self.Lookup(localDevice); !ok || !owner.Self {
+			t.Fatalf("本实例设备仍归属本实例: %v", owner)
+		}
+		self.Sync()
+	})
+
+	t.Run("Redis恢复后回放暂存并回切", func(t *testing.T) {
+		if err := mr.Restart(); err != nil {
+			t.Fatal(err)
+		}
+		waitStatus(infraredis.StatusUp)
+		mu.Lock()
+		if len(transitions) != 2 || transitions[1].To != infraredis.StatusUp || transitions[1].Replayed == 0 || transitions[1].Dropped == 0 {
+			t.Fatalf("恢复应只回调一次并附回放与丢弃数: %+v", transitions)
+		}
+		mu.Unlock()
+		if stats := health.Stats(); stats.SpoolEntries != 0 || stats.Status != infraredis.StatusUp {
+			t.Fatalf("恢复后暂存应已回放: %+v", stats)
+		}
+
+		record, err := seqStore.Load()
+		if err != nil || record == nil || record.LastMessageID != 3 {
+			t.Fatalf("回放应写入最新值: %+v %v", record, err)
+		}
+		if recent, err := changes.LoadRecent(0); err != nil || len(recent) != 2 {
+			t.Fatalf("追加写入应按序回放: %+v %v", recent, err)
+		}
+		if _, err := client.Get(context.Background(), "test:bulk:7").Result(); err != nil {
+			t.Fatalf("最新的暂存应保留: %v", err)
+		}
+		if _, err := client.Get(context.Background(), "test:bulk:0").Result(); err != goredis.Nil {
+			t.Fatalf("最早的暂存应已丢弃: %v", err)
+		}
+
+		if fresh, source := guard.Claim("ORD1693C"); !fresh || source != idempotency.SourceRedis {
+			t.Fatalf("恢复后幂等应回切Redis: %v %s", fresh, source)
+		}
+		self.Sync()
+		if owner, ok := self.LookupRemote(remoteDevice); !ok || owner.InstanceID != "gw-b" {
+			t.Fatalf("恢复后应重新查询共享归属: %v %v", owner, ok)
+		}
+		if code, resp := readyz(); code != http.StatusOK || resp.Data["status"] != apihttp.ReadyStatusReady {
+			t.Fatalf("恢复后应为ready: %d %v", code, resp.Data)
+		}
+	})
+
+	t.Run("降级与恢复通知归入系统主题", func(t *testing.T) {
+		for _, eventType := range []string{notification.EventTypeRedisDegraded, notification.EventTypeRedisRecovered} {
+			if got := notification.TopicForEvent(eventType); got != events.TopicSystem {
+				t.Fatalf("%s 应归入系统主题: %s", eventType, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/constants"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+)
+
+// backfillClient 模拟重启后重连、只上报ICCID的设备
+type backfillClient struct {
+	ziface.IConnection
+	id       uint64
+	deviceID string
+	iccid    string
+	mute     bool // 收到注册请求也不注册
+}
+
+func (c *backfillClient) GetConnID() uint64 { return c.id }
+func (c *backfillClient) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 1, byte(c.id/250), byte(c.id%250)), Port: 40000}
+}
+func (c *backfillClient) GetProperty(string) (interface{}, error) {
+	return nil, fmt.Errorf("not found")
+}
+
+// TestRegistrationBackfill 重启后50个静默设备的注册补齐测试
+func TestRegistrationBackfill(t *testing.T) {
+	tm := core.NewTCPManager(nil)
+	clients := make(map[uint64]*backfillClient)
+
+	var (
+		backfill *gateway.RegistrationBackfill
+		mu       sync.Mutex
+		sends    = make(map[uint64]int)
+	)
+	register := func(c *backfillClient, now time.Time) {
+		if err := tm.RegisterDevice(c, c.deviceID, c.deviceID, c.iccid); err != nil {
+			t.Errorf("设备注册失败: %v", err)
+			return
+		}
+		backfill.OnRegistered(c.id, now)
+	}
+	var now time.Time
+	backfill = gateway.NewRegistrationBackfill(config.RegistrationBackfillConfig{
+		Enabled:                     true,
+		DelaySeconds:                30,
+		WindowSeconds:               600,
+		RatePerSecond:               10,
+		MaxAttempts:                 2,
+		RetryIntervalSeconds:        60,
+		MassDisconnectThreshold:     20,
+		MassDisconnectWindowSeconds: 10,
+	}, tm, func(conn ziface.IConnection) error {
+		mu.Lock()
+		sends[conn.GetConnID()]++
+		mu.Unlock()
+		// 收到0x81后立即上发0x20
+		if c := clients[conn.GetConnID()]; !c.mute {
+			register(c, now)
+		}
+		return nil
+	})
+
+	// 重启：50个客户端重连并上报ICCID，其中5个自行注册、5个始终不响应
+	for i := 0; i < 50; i++ {
+		c := &backfillClient{id: uint64(1649000 + i), deviceID: fmt.Sprintf("04B1%04X", i), iccid: fmt.Sprintf("8986%016d", i), mute: i >= 45}
+		clients[c.id] = c
+		if _, err := tm.RegisterConnection(c); err != nil {
+			t.Fatal(err)
+		}
+		_ = tm.UpdateConnectionStateByConnID(c.id, constants.StateICCIDReceived)
+	}
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		register(clients[uint64(1649000+i)], base.Add(5*time.Second))
+	}
+
+	sweep := func(offset time.Duration) int {
+		now = base.Add(offset)
+		return backfill.Sweep(now, 10)
+	}
+
+	if n := sweep(10 * time.Second); n != 0 {
+		t.Fatalf("未超过等待时长不应请求: %d", n)
+	}
+
+	// 限速：每轮最多10个，45个未注册连接需5轮
+	total := 0
+	for i := 0; i < 5; i++ {
+		n := sweep(time.Duration(31+i) * time.Second)
+		if n > 10 {
+			t.Fatalf("单轮下发超过限额: %d", n)
+		}
+		total += n
+	}
+	if total != 45 {
+		t.Fatalf("首轮应向45个未注册连接各请求一次: %d", total)
+	}
+	if n := sweep(40 * time.Second); n != 0 {
+		t.Fatalf("重试间隔内不应重复请求: %d", n)
+	}
+
+	// 静默连接重试至上限后停止
+	if n := sweep(100 * time.Second); n != 5 {
+		t.Fatalf("应仅重试5个未响应连接: %d", n)
+	}
+	if n := sweep(170 * time.Second); n != 0 {
+		t.Fatalf("达到请求上限后不应再请求: %d", n)
+	}
+	mu.Lock()
+	for id, c := range clients {
+		want := 1
+		if c.mute {
+			want = 2
+		}
+		if id >= 1649005 && sends[id] != want {
+			t.Fatalf("连接 %d 请求次数错误: %d", id, sends[id])
+		}
+	}
+	mu.Unlock()
+
+	stats := backfill.Stats()
+	if stats.SolicitedRegistrations != 40 || stats.SpontaneousRegistrations != 5 {
+		t.Fatalf("主动/自发注册统计错误: %+v", stats)
+	}
+	if stats.Solicitations != 50 || stats.Exhausted != 5 || stats.Pending != 0 {
+		t.Fatalf("请求统计错误: %+v", stats)
+	}
+
+	// 窗口结束后不再请求；大规模断连重新激活
+	if n := sweep(700 * time.Second); n != 0 {
+		t.Fatalf("窗口结束后不应请求: %d", n)
+	}
+	if backfill.IsActive(base.Add(700 * time.Second)) {
+		t.Fatal("窗口应已结束")
+	}
+	for i := 0; i < 20; i++ {
+		backfill.NoteDisconnect(base.Add(700*time.Second + time.Duration(i)*100*time.Millisecond))
+	}
+	if !backfill.IsActive(base.Add(705 * time.Second)) {
+		t.Fatal("大规模断连后应重新激活窗口")
+	}
+	if n := sweep(740 * time.Second); n != 5 {
+		t.Fatalf("重新激活后应再次请求未注册连接: %d", n)
+	}
+	if got := backfill.Stats(); got.Activations != 2 || got.LastTrigger != gateway.BackfillTriggerMassDisconnect {
+		t.Fatalf("激活统计错误: %+v", got)
+	}
+}
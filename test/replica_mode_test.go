@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/availability"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
+	"github.com/gin-gonic/gin"
+)
+
+type replicaResponse struct {
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+func callAPI(r *gin.Engine, method, path, body string) (*httptest.ResponseRecorder, replicaResponse) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var resp replicaResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// TestReplicaMode 主实例与只读副本共用一个快照存储（模拟同一Redis）：副本的设备列表/详情/端口/统计/历史与主实例一致且滞后不超过
+// 发布间隔+缓存时间，响应标注 dataSource=replica 与快照时间；写操作返回503 REPLICA_READ_ONLY；只读网关拒绝下发命令
+func TestReplicaMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const (
+		deviceA    = "04B16911"
+		deviceB    = "04B16912"
+		primaryURL = "http://10.0.0.11:7055"
+	)
+	registerSharedGroup(t, 1691001, "89860400000016910001", []string{deviceA})
+	registerSharedGroup(t, 1691002, "89860400000016910002", []string{deviceB})
+
+	// 主实例：路由按实时状态应答，周期发布快照
+	primary := gin.New()
+	router.RegisterUnifiedAPIHandlers(primary)
+	store := replica.NewMemoryStore()
+	publisher := replica.NewPublisher(store, gateway.GetGlobalDeviceGateway(), "gw-primary", 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher.Start(ctx)
+	defer publisher.Stop()
+
+	// 副本：同一进程内以全局副本读取构造路由（等同 -read-only 启动）
+	historyStore := availability.NewFileStore(filepath.Join(t.TempDir(), "port_availability.json"))
+	reader := replica.NewReader(replica.Options{
+		Store:           store,
+		History:         historyStore,
+		PublishInterval: 50 * time.Millisecond,
+		RefreshInterval: 20 * time.Millisecond,
+		MaxStaleness:    time.Second,
+		PrimaryURL:      primaryURL,
+	})
+	replica.SetGlobalReader(reader)
+	defer replica.SetGlobalReader(nil)
+	secondary := gin.New()
+	router.RegisterUnifiedAPIHandlers(secondary)
+	bound := reader.StalenessBound() + 100*time.Millisecond // 调度余量
+
+	waitFor := func(what string, cond func() bool) time.Duration {
+		t.Helper()
+		start := time.Now()
+		for !cond() {
+			if time.Since(start) > 3*time.Second {
+				t.Fatalf("等待超时: %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return time.Since(start)
+	}
+
+	t.Run("设备列表与详情和主实例一致", func(t *testing.T) {
+		waitFor("快照包含两台设备", func() bool {
+			w, resp := callAPI(secondary, http.MethodGet, "/api/v1/device/"+deviceB+"/status", "")
+			return w.Code == http.StatusOK && resp.Data["deviceId"] == deviceB
+		})
+		w, resp := callAPI(secondary, http.MethodGet, "/api/v1/devices", "")
+		if w.Code != http.StatusOK || resp.Data["dataSource"] != replica.DataSourceReplica || w.Header().Get(apihttp.HeaderDataSource) != replica.DataSourceReplica {
+			t.Fatalf("副本列表应标注数据来源: %d %v", w.Code, resp.Data)
+		}
+		stateAt, err := time.Parse(time.RFC3339Nano, w.Header().Get(apihttp.HeaderDataStateAt))
+		if err != nil || time.Since(stateAt) > bound || resp.Data["stale"] != false {
+			t.Fatalf("快照时间应在时效上限内: %v %s %v", err, time.Since(stateAt), resp.Data["stale"])
+		}
+		listed := map[string]map[string]interface{}{}
+		for _, d := range resp.Data["devices"].([]interface{}) {
+			detail := d.(map[string]interface{})
+			listed[detail["deviceId"].(string)] = detail
+		}
+		for _, id := range []string{deviceA, deviceB} {
+			_, live := callAPI(primary, http.MethodGet, "/api/v1/device/"+id+"/status", "")
+			_, replicated := callAPI(secondary, http.MethodGet, "/api/v1/device/"+id+"/status", "")
+			for _, field := range []string{"deviceId", "iccid", "physicalId", "isOnline", "connectedAtTs", "registeredAtTs"} {
+				if live.Data[field] != replicated.Data[field] || listed[id][field] != live.Data[field] {
+					t.Fatalf("%s 字段 %s 不一致: 主=%v 副本=%v 列表=%v", id, field, live.Data[field], replicated.Data[field], listed[id][field])
+				}
+			}
+			if owner := replicated.Data["owner"].(map[string]interface{}); owner["instanceId"] != "gw-primary" {
+				t.Fatalf("副本应标注发布快照的主实例: %v", owner)
+			}
+			_, livePorts := callAPI(primary, http.MethodGet, "/api/v1/device/"+id+"/ports", "")
+			_, replicaPorts := callAPI(secondary, http.MethodGet, "/api/v1/device/"+id+"/ports", "")
+			if livePorts.Data["total"] != replicaPorts.Data["total"] || replicaPorts.Data["dataSource"] != replica.DataSourceReplica {
+				t.Fatalf("端口状态不一致: %v %v", livePorts.Data, replicaPorts.Data)
+			}
+		}
+
+		w, resp = callAPI(secondary, http.MethodGet, "/api/v1/stats", "")
+		online, _ := resp.Data["onlineDevices"].([]interface{})
+		if w.Code != http.StatusOK || resp.Data["dataSource"] != replica.DataSourceReplica || resp.Data["publishedInstances"] != float64(1) || len(online) == 0 {
+			t.Fatalf("副本统计错误: %d %v", w.Code, resp.Data)
+		}
+	})
+
+	t.Run("主实例状态变化在时效上限内反映到副本", func(t *testing.T) {
+		disconnectedAt := time.Now()
+		_ = core.GetGlobalTCPManager().UnregisterConnection(1691002)
+		elapsed := waitFor("副本反映设备离线", func() bool {
+			w, _ := callAPI(secondary, http.MethodGet, "/api/v1/device/"+deviceB+"/status", "")
+			return w.Code == http.StatusNotFound
+		})
+		if elapsed > bound {
+			t.Fatalf("副本滞后 %s 超过时效上限 %s", elapsed, bound)
+		}
+		w, resp := callAPI(secondary, http.MethodGet, "/api/v1/device/"+deviceB+"/status", "")
+		stateAt, _ := time.Parse(time.RFC3339Nano, w.Header().Get(apihttp.HeaderDataStateAt))
+		if resp.Data["dataSource"] != replica.DataSourceReplica || stateAt.Before(disconnectedAt) {
+			t.Fatalf("离线判定应来自断开之后的快照: %v %s", resp.Data, stateAt)
+		}
+		if w, _ := callAPI(secondary, http.MethodGet, "/api/v1/device/"+deviceA+"/status", ""); w.Code != http.StatusOK {
+			t.Fatalf("其他设备不受影响: %d", w.Code)
+		}
+	})
+
+	t.Run("写操作返回503并指向主实例", func(t *testing.T) {
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodPost, "/api/v1/charging/start", `{"deviceId":"` + deviceA + `","port":1,"orderNo":"ORD1691"}`},
+			{http.MethodPost, "/api/v1/device/" + deviceA + "/reboot", `{}`},
+			{http.MethodDelete, "/api/v1/device/" + deviceA + "/deferred/dfr_1", ""},
+			{http.MethodPut, "/api/v1/config-templates/default", `{}`},
+		} {
+			w, resp := callAPI(secondary, req.method, req.path, req.body)
+			if w.Code != http.StatusServiceUnavailable || resp.Data["errorCode"] != apihttp.ErrorCodeReplicaReadOnly ||
+				resp.Data["primary"] != primaryURL || resp.Data["redirect"] != primaryURL+req.path {
+				t.Fatalf("%s %s 应返回503: %d %v", req.method, req.path, w.Code, resp.Data)
+			}
+		}
+		if w, _ := callAPI(secondary, http.MethodPost, "/api/v1/tools/parse-frame", `{"hex":"00"}`); w.Code == http.StatusServiceUnavailable {
+			t.Fatal("不修改状态的帧解析不应拒绝")
+		}
+		if w, _ := callAPI(primary, http.MethodDelete, "/api/v1/device/"+deviceA+"/deferred/dfr_1", ""); w.Code == http.StatusServiceUnavailable {
+			t.Fatal("主实例不受只读限制")
+		}
+
+		g := gateway.GetGlobalDeviceGateway()
+		g.SetReadOnly(true)
+		err := g.SendCommandToDevice(deviceA, 0x81, nil)
+		g.SetReadOnly(false)
+		if !errors.Is(err, gateway.ErrReadOnlyReplica) {
+			t.Fatalf("只读网关应拒绝下发命令: %v", err)
+		}
+	})
+
+	t.Run("端口状态历史读取主实例持久化的历史", func(t *testing.T) {
+		if w, resp := callAPI(secondary, http.MethodGet, "/api/v1/device/"+deviceA+"/ports/1/availability", ""); w.Code != http.StatusServiceUnavailable || resp.Data["errorCode"] != apihttp.ErrorCodeReplicaNoHistory {
+			t.Fatalf("主实例尚未持久化历史时应返回503: %d %v", w.Code, resp.Data)
+		}
+		tracker, err := availability.NewTracker(historyStore, availability.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker.OnPortStatus(deviceA, 1, 0, time.Now().Add(-time.Minute))
+		if err := tracker.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(30 * time.Millisecond) // 等待副本缓存过期
+		w, resp := callAPI(secondary, http.MethodGet, "/api/v1/device/"+deviceA+"/ports/1/availability", "")
+		if w.Code != http.StatusOK || resp.Data["dataSource"] != replica.DataSourceReplica || resp.Data["availability"] == nil {
+			t.Fatalf("副本应返回端口状态历史: %d %v", w.Code, resp.Data)
+		}
+	})
+
+	t.Run("快照过期标记stale，主实例停止后无数据可用", func(t *testing.T) {
+		old := replica.State{InstanceID: "gw-old", PublishedAt: time.Now().Add(-5 * time.Second), Stats: map[string]interface{}{}}
+		data, err := replica.Encode(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		staleStore := replica.NewMemoryStore()
+		_ = staleStore.Put(context.Background(), old.InstanceID, data)
+		staleReader := replica.NewReader(replica.Options{Store: staleStore, MaxStaleness: time.Second})
+		r := gin.New()
+		r.GET("/api/v1/devices", apihttp.NewReplicaHandlers(staleReader).HandleDeviceList)
+		if _, resp := callAPI(r, http.MethodGet, "/api/v1/devices", ""); resp.Data["stale"] != true || resp.Data["stalenessMs"].(float64) < 5000 {
+			t.Fatalf("过期快照应标记stale: %v", resp.Data)
+		}
+
+		publisher.Stop()
+		waitFor("主实例停止后副本无快照", func() bool {
+			w, resp := callAPI(secondary, http.MethodGet, "/api/v1/devices", "")
+			return w.Code == http.StatusServiceUnavailable && resp.Data["errorCode"] == apihttp.ErrorCodeReplicaNoState
+		})
+	})
+}
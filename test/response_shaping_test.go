@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/shaping"
+	"github.com/gin-gonic/gin"
+)
+
+// TestResponseShaping 允许列表外的环境（含未配置与生产环境）拒绝启用、按路由与调用方匹配、注入错误/延迟/不完整分页及标记头、规则到期
+func TestResponseShaping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("生产环境拒绝启用", func(t *testing.T) {
+		for _, environment := range []string{"", "prod-eu", "live", "Production"} {
+			if _, err := shaping.NewShaper(shaping.Options{Environment: environment}); !errors.Is(err, shaping.ErrEnvironmentNotAllowed) {
+				t.Fatalf("环境 %q 不在允许列表内，应拒绝启用: %v", environment, err)
+			}
+		}
+		if _, err := shaping.NewShaper(shaping.Options{Environment: " Test "}); err != nil {
+			t.Fatalf("test 环境应允许启用: %v", err)
+		}
+
+		cfg := config.GetConfig()
+		saved := *cfg
+		defer func() { *cfg = saved }()
+		cfg.Environment = "production"
+		cfg.ResponseShaping = config.ResponseShapingConfig{Enabled: true}
+		if err := shaping.InitGlobalShaper(); !errors.Is(err, shaping.ErrEnvironmentNotAllowed) || shaping.GetGlobalShaper() != nil {
+			t.Fatalf("生产环境应拒绝启用: %v", err)
+		}
+
+		r := gin.New()
+		admin := apihttp.NewAdminHandlers()
+		r.POST("/api/v1/admin/response-shaping", admin.HandleCreateShapingRule)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/response-shaping", strings.NewReader(`{"route":"*","latencyMs":10}`)))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("生产环境下发规则应返回403: %d", w.Code)
+		}
+	})
+
+	s, err := shaping.NewShaper(shaping.Options{
+		Environment: "staging",
+		Presets: map[string]shaping.RuleSpec{
+			"timeouts": {Route: "/api/v1/charging/*", ErrorRate: 1, Errors: []string{shaping.ErrorCommandTimeout}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建规则集失败: %v", err)
+	}
+	shaping.SetGlobalShaper(s)
+	defer shaping.SetGlobalShaper(nil)
+
+	handled := 0
+	r := gin.New()
+	r.Use(apihttp.ResponseShapingMiddleware())
+	admin := apihttp.NewAdminHandlers()
+	r.GET("/api/v1/admin/response-shaping", admin.HandleResponseShaping)
+	r.POST("/api/v1/admin/response-shaping", admin.HandleCreateShapingRule)
+	r.DELETE("/api/v1/admin/response-shaping/:ruleId", admin.HandleDeleteShapingRule)
+	r.POST("/api/v1/charging/start", func(c *gin.Context) {
+		handled++
+		c.JSON(http.StatusOK, apihttp.APIResponse{Code: 0, Message: "成功"})
+	})
+	r.GET("/api/v1/devices", func(c *gin.Context) {
+		c.JSON(http.StatusOK, apihttp.APIResponse{Code: 0, Message: "成功", Data: gin.H{"devices": []int{1, 2, 3, 4}, "total": 4}})
+	})
+	do := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set("X-API-Key-Name", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	addRule := func(body string) string {
+		w := do(http.MethodPost, "/api/v1/admin/response-shaping", "", body)
+		var resp struct {
+			Data shaping.Rule `json:"data"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil {
+			t.Fatalf("下发规则失败: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Data.ID
+	}
+
+	t.Run("按调用方注入错误", func(t *testing.T) {
+		id := addRule(`{"preset":"timeouts","apiKey":"partner-a","ttlSeconds":60}`)
+		w := do(http.MethodPost, "/api/v1/charging/start", "partner-a", `{}`)
+		if w.Code != http.StatusGatewayTimeout || w.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(w.Body.String(), "COMMAND_TIMEOUT") {
+			t.Fatalf("应注入 COMMAND_TIMEOUT problem+json: %d %s", w.Code, w.Body.String())
+		}
+		if marker := w.Header().Get(apihttp.HeaderSyntheticFault); !strings.Contains(marker, "rule="+id) || !strings.Contains(marker, "error=COMMAND_TIMEOUT") {
+			t.Fatalf("缺少注入标记头: %q", marker)
+		}
+		if handled != 0 {
+			t.Fatal("注入错误时不应执行处理器")
+		}
+		w = do(http.MethodPost, "/api/v1/charging/start", "partner-b", `{}`)
+		if w.Code != http.StatusOK || w.Header().Get(apihttp.HeaderSyntheticFault) != "" || handled != 1 {
+			t.Fatalf("其他调用方不应受影响: %d", w.Code)
+		}
+		if w := do(http.MethodDelete, "/api/v1/admin/response-shaping/"+id, "", ""); w.Code != http.StatusOK {
+			t.Fatalf("删除规则失败: %d", w.Code)
+		}
+	})
+
+	t.Run("延迟与不完整分页", func(t *testing.T) {
+		addRule(`{"route":"/api/v1/devices","latencyMs":50,"partialPageRate":1,"ttlSeconds":60}`)
+		start := time.Now()
+		w := do(http.MethodGet, "/api/v1/devices", "", "")
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("应注入延迟: %s", elapsed)
+		}
+		var resp struct {
+			Data struct {
+				Devices []int `json:"devices"`
+				Total   int   `json:"total"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || len(resp.Data.Devices) != 2 || resp.Data.Total != 4 {
+			t.Fatalf("应只返回部分条目且total不变: %s", w.Body.String())
+		}
+		if marker := w.Header().Get(apihttp.HeaderSyntheticFault); !strings.Contains(marker, "partial-page") || !strings.Contains(marker, "latency=50ms") {
+			t.Fatalf("标记头错误: %q", marker)
+		}
+	})
+
+	t.Run("规则校验与到期", func(t *testing.T) {
+		if w := do(http.MethodPost, "/api/v1/admin/response-shaping", "", `{"route":"*","errorRate":0.5,"errors":["500"]}`); w.Code != http.StatusBadRequest {
+			t.Fatalf("不支持的错误应返回400: %d", w.Code)
+		}
+		if w := do(http.MethodPost, "/api/v1/admin/response-shaping", "", `{"preset":"missing"}`); w.Code != http.StatusNotFound {
+			t.Fatalf("未知预设应返回404: %d", w.Code)
+		}
+		now := time.Now()
+		if _, err := s.Add("", shaping.RuleSpec{Route: "*", ErrorRate: 1, Errors: []string{shaping.ErrorUnavailable}}, time.Minute, now); err != nil {
+			t.Fatalf("添加规则失败: %v", err)
+		}
+		if _, ok := s.Shape(http.MethodGet, "/api/v1/health", "/api/v1/health", "", now.Add(2*time.Minute)); ok {
+			t.Fatal("到期规则不应生效")
+		}
+		for _, rule := range s.Rules(now.Add(2 * time.Minute)) {
+			if rule.Route == "*" {
+				t.Fatal("到期规则不应列出")
+			}
+		}
+	})
+}
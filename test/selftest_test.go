@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/bootstrap"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/selftest"
+	"github.com/gin-gonic/gin"
+)
+
+// TestProtocolSelfTest 启动自检全部通过、覆盖每个已注册命令，结果经运维接口查询与按需重跑
+func TestProtocolSelfTest(t *testing.T) {
+	startup := bootstrap.InitForTest().SelfTest
+	if startup == nil || startup.Trigger != selftest.TriggerStartup || !startup.OK {
+		t.Fatalf("启动自检应执行且全部通过: %+v", startup)
+	}
+
+	report := selftest.Run(selftest.TriggerManual)
+	if !report.OK || report.Failed != 0 || report.Passed != report.Total || report.Version != gateway.GatewayVersion {
+		t.Fatalf("自检失败: %s", report.Summary())
+	}
+	covered := make(map[string]map[string]bool)
+	for _, c := range report.Checks {
+		if covered[c.Group] == nil {
+			covered[c.Group] = make(map[string]bool)
+		}
+		covered[c.Group][c.Name] = true
+	}
+	for _, entry := range dny_protocol.Commands() {
+		if !covered[selftest.GroupFrame][entry.Hex] || !covered[selftest.GroupChecksum][entry.Hex] {
+			t.Fatalf("命令 %s 未覆盖帧往返与校验和检查", entry.Hex)
+		}
+	}
+	for _, name := range []string{"settlement", "power_heartbeat", "charge_control", "device_register"} {
+		if !covered[selftest.GroupTyped][name] {
+			t.Fatalf("缺少负载结构体检查 %s", name)
+		}
+	}
+	if len(covered[selftest.GroupChargeControl]) < 2 || !covered[selftest.GroupStream]["iccid_link_dny"] {
+		t.Fatalf("缺少黄金向量或字节流检查: %v", covered)
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := apihttp.NewAdminHandlers()
+	r := gin.New()
+	r.GET("/api/v1/admin/self-test", h.HandleSelfTest)
+	r.POST("/api/v1/admin/self-test", h.HandleRunSelfTest)
+	get := func(method string) selftest.Report {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/api/v1/admin/self-test", nil))
+		var resp struct {
+			Code int             `json:"code"`
+			Data selftest.Report `json:"data"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.Code != 0 {
+			t.Fatalf("%s 自检接口返回错误: %d %s", method, w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+	if last := get(http.MethodGet); last.Trigger != selftest.TriggerManual || last.Total != report.Total || !last.StartedAt.Equal(report.StartedAt) {
+		t.Fatalf("应返回最近一次自检结果: %+v", last)
+	}
+	if rerun := get(http.MethodPost); !rerun.OK || rerun.StartedAt.Before(report.StartedAt) {
+		t.Fatalf("按需自检结果错误: %+v", rerun)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+)
+
+// sendFailureTestConn 写入前 okWrites 次成功、之后失败的连接桩（failing=false 时恢复写入）
+type sendFailureTestConn struct {
+	disconnectTestConn
+	writes   atomic.Int32
+	okWrites int32
+	failing  atomic.Bool
+	stopped  atomic.Bool
+}
+
+func (c *sendFailureTestConn) GetConnection() net.Conn    { return nil }
+func (c *sendFailureTestConn) GetTCPConnection() net.Conn { return &sendFailureTestNetConn{owner: c} }
+func (c *sendFailureTestConn) Stop()                      { c.stopped.Store(true) }
+
+type sendFailureTestNetConn struct {
+	net.Conn
+	owner *sendFailureTestConn
+}
+
+func (c *sendFailureTestNetConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *sendFailureTestNetConn) Write(b []byte) (int, error) {
+	if c.owner.writes.Add(1) > c.owner.okWrites && c.owner.failing.Load() {
+		return 0, errors.New("write tcp 10.0.0.1:7054: write: broken pipe")
+	}
+	return len(b), nil
+}
+
+// TestSendFailureAutoClose 连续发送失败计数、成功清零与超过阈值后以 write_failed 关闭连接
+func TestSendFailureAutoClose(t *testing.T) {
+	g := gateway.NewDeviceGateway() // 注入发送结果观察者
+	tcpManager := core.GetGlobalTCPManager()
+	tcpManager.SetSendFailureConfig(&core.SendFailureConfig{Enabled: true, Threshold: 3, WriteBlock: time.Second})
+	t.Cleanup(func() { tcpManager.SetSendFailureConfig(core.DefaultSendFailureConfig()) })
+
+	register := func(id uint64, deviceID string) *sendFailureTestConn {
+		t.Helper()
+		conn := &sendFailureTestConn{disconnectTestConn: disconnectTestConn{id: id}, okWrites: 2}
+		conn.failing.Store(true)
+		if _, err := tcpManager.RegisterConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+		if err := tcpManager.RegisterDevice(conn, deviceID, deviceID, "8986040000001670"+deviceID[4:]); err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	packet := protocol.BuildUnifiedDNYPacket(0x04B16701, 0x0001, 0x81, nil)
+	send := func(conn *sendFailureTestConn) error { return pkg.Protocol.SendDNYPacket(conn, packet) }
+	health := func(connID uint64) core.SendHealth {
+		t.Helper()
+		session, ok := tcpManager.GetSessionByConnID(connID)
+		if !ok {
+			t.Fatalf("连接 %d 不应被关闭", connID)
+		}
+		return session.GetSendHealth()
+	}
+
+	conn := register(1670001, "04B16701")
+	for i := 0; i < 2; i++ {
+		if err := send(conn); err != nil {
+			t.Fatalf("前两次写入应成功: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := send(conn); err == nil {
+			t.Fatal("第三次起写入应失败")
+		}
+	}
+	if h := health(conn.id); h.SendFailures != 3 || h.ConsecutiveSendFailures != 3 || h.LastSendError == "" || h.LastSendFailureAt.IsZero() {
+		t.Fatalf("失败计数错误: %+v", h)
+	}
+	detail, err := g.GetDeviceDetail("04B16701")
+	if err != nil || detail["consecutiveSendFailures"] != int64(3) || detail["sendFailures"] != int64(3) {
+		t.Fatalf("设备详情应包含发送失败计数: %v %v", detail, err)
+	}
+
+	// 任一次成功清零连续失败计数，累计计数保留
+	conn.failing.Store(false)
+	if err := send(conn); err != nil {
+		t.Fatal(err)
+	}
+	if h := health(conn.id); h.ConsecutiveSendFailures != 0 || h.SendFailures != 3 {
+		t.Fatalf("成功发送应清零连续失败计数: %+v", h)
+	}
+
+	// 连续失败超过阈值（3）时关闭连接并移除设备
+	conn.failing.Store(true)
+	for i := 0; i < 3; i++ {
+		_ = send(conn)
+	}
+	if conn.stopped.Load() || health(conn.id).ConsecutiveSendFailures != 3 {
+		t.Fatal("未超过阈值时不应关闭连接")
+	}
+	_ = send(conn)
+	if !conn.stopped.Load() {
+		t.Fatal("连续失败超过阈值后应关闭连接")
+	}
+	if _, ok := tcpManager.GetSessionByConnID(conn.id); ok {
+		t.Fatal("连接会话应被清理")
+	}
+	if g.IsDeviceOnline("04B16701") {
+		t.Fatal("设备应转为离线，等待重连")
+	}
+	stats := g.GetDeviceStatistics()["sendHealth"].(map[string]interface{})
+	if stats["writeFailedDisconnects"].(int64) < 1 || stats["sendFailures"].(int64) < 7 {
+		t.Fatalf("监控统计应包含发送失败与关闭次数: %+v", stats)
+	}
+
+	// 单次发送阻塞超过写截止时长：首次失败即关闭
+	blocked := register(1670002, "04B16702")
+	if tcpManager.RecordSendResult(blocked.id, errors.New("i/o timeout"), 500*time.Millisecond) {
+		t.Fatal("阻塞未超过写截止时长时不应关闭")
+	}
+	if !tcpManager.RecordSendResult(blocked.id, errors.New("i/o timeout"), 2*time.Second) || !blocked.stopped.Load() {
+		t.Fatal("阻塞超过写截止时长应立即关闭连接")
+	}
+}
+
+var _ ziface.IConnection = (*sendFailureTestConn)(nil)
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/sessionarchive"
+	"github.com/gin-gonic/gin"
+)
+
+// archiveClock 可推进的假时钟
+type archiveClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *archiveClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *archiveClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func archivedSession(connID uint64, ip, iccid string, devices []string, connectedAt time.Time, duration time.Duration) sessionarchive.Record {
+	return sessionarchive.FromClosedSession(core.ClosedSession{
+		ConnID:         connID,
+		RemoteAddr:     fmt.Sprintf("%s:%d", ip, 40000+connID%1000),
+		ICCID:          iccid,
+		DeviceIDs:      devices,
+		ConnectedAt:    connectedAt,
+		DisconnectedAt: connectedAt.Add(duration),
+		BytesIn:        int64(connID * 10),
+		BytesOut:       int64(connID * 3),
+		Reason:         "timeout",
+	})
+}
+
+func newTestArchive(t *testing.T, opts sessionarchive.Options, clock *archiveClock) *sessionarchive.Archive {
+	t.Helper()
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	archive, err := sessionarchive.New(opts)
+	if err != nil {
+		t.Fatalf("创建会话归档失败: %v", err)
+	}
+	archive.SetNowFunc(clock.Now)
+	return archive
+}
+
+// TestSessionArchiveQueryFilters 按IP/ICCID/设备/时间范围过滤，按断开时间倒序分页；过往日文件只读
+func TestSessionArchiveQueryFilters(t *testing.T) {
+	base := time.Date(2026, 10, 10, 9, 0, 0, 0, time.Local)
+	clock := &archiveClock{now: base}
+	archive := newTestArchive(t, sessionarchive.Options{}, clock)
+
+	// 10月10日：两条；10月12日：三条
+	archive.Submit(archivedSession(1, "10.0.0.1", "89860000000000000001", []string{"04A26CF3"}, base, time.Hour))
+	archive.Submit(archivedSession(2, "10.0.0.2", "89860000000000000002", []string{"04A228CD", "04A228CE"}, base.Add(2*time.Hour), time.Hour))
+	archive.Flush()
+	day3 := base.AddDate(0, 0, 2)
+	clock.Set(day3)
+	archive.Submit(archivedSession(3, "10.0.0.1", "89860000000000000001", []string{"04A26CF3"}, day3, 30*time.Minute))
+	archive.Submit(archivedSession(4, "10.0.0.3", "89860000000000000003", nil, day3.Add(time.Hour), time.Minute))
+	archive.Submit(archivedSession(5, "10.0.0.1", "89860000000000000004", []string{"04a26cf3"}, day3.Add(2*time.Hour), time.Minute))
+	archive.Flush()
+
+	cases := []struct {
+		name  string
+		query sessionarchive.Query
+		want  []uint64
+	}{
+		{"全部", sessionarchive.Query{}, []uint64{5, 4, 3, 2, 1}},
+		{"按IP", sessionarchive.Query{IP: "10.0.0.1"}, []uint64{5, 3, 1}},
+		{"IP前缀不匹配", sessionarchive.Query{IP: "10.0.0"}, nil},
+		{"按ICCID", sessionarchive.Query{ICCID: "89860000000000000001"}, []uint64{3, 1}},
+		{"按设备（不区分大小写）", sessionarchive.Query{DeviceID: "04A26CF3"}, []uint64{5, 3, 1}},
+		{"多设备会话", sessionarchive.Query{DeviceID: "04A228CE"}, []uint64{2}},
+		{"时间交集", sessionarchive.Query{From: base.Add(150 * time.Minute), To: day3.Add(10 * time.Minute)}, []uint64{3, 2}},
+		{"起始时间跳过旧日文件", sessionarchive.Query{From: day3}, []uint64{5, 4, 3}},
+		{"组合条件", sessionarchive.Query{IP: "10.0.0.1", ICCID: "89860000000000000001", From: day3}, []uint64{3}},
+	}
+	for _, tc := range cases {
+		page, err := archive.Search(tc.query)
+		if err != nil {
+			t.Fatalf("%s: 查询失败: %v", tc.name, err)
+		}
+		var got []uint64
+		for _, rec := range page.Records {
+			got = append(got, rec.ConnID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) || page.Total != len(tc.want) {
+			t.Fatalf("%s: 期望 %v，实际 %v (total=%d)", tc.name, tc.want, got, page.Total)
+		}
+	}
+
+	page, _ := archive.Search(sessionarchive.Query{Offset: 2, Limit: 2})
+	if page.Total != 5 || len(page.Records) != 2 || page.Records[0].ConnID != 3 || page.Records[1].ConnID != 2 {
+		t.Fatalf("分页结果错误: %+v", page)
+	}
+	if page, _ = archive.Search(sessionarchive.Query{Offset: 10, Limit: 2}); page.Total != 5 || len(page.Records) != 0 {
+		t.Fatalf("超出范围的页应为空: %+v", page)
+	}
+
+	first, _ := archive.Search(sessionarchive.Query{IP: "10.0.0.2"})
+	if got := first.Records[0]; got.RemoteIP != "10.0.0.2" || got.DurationSeconds != 3600 || got.BytesIn != 20 || got.Reason != "timeout" {
+		t.Fatalf("归档字段错误: %+v", got)
+	}
+
+	// 写入第三天后，第一天的日文件已只读
+	info, err := os.Stat(filepath.Join(archive.Stats().Dir, "sessions-2026-10-10.jsonl"))
+	if err != nil {
+		t.Fatalf("缺少日文件: %v", err)
+	}
+	if info.Mode().Perm()&0o222 != 0 {
+		t.Fatalf("过往日文件应为只读，实际权限 %v", info.Mode().Perm())
+	}
+}
+
+// TestSessionArchiveRetention 超过保留天数的日文件被清理，当天文件保留；总大小超限时从最早的日文件开始删除
+func TestSessionArchiveRetention(t *testing.T) {
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.Local)
+	clock := &archiveClock{now: start}
+	archive := newTestArchive(t, sessionarchive.Options{RetentionDays: 90}, clock)
+	for day := 0; day < 100; day += 10 {
+		now := start.AddDate(0, 0, day)
+		clock.Set(now)
+		archive.Submit(archivedSession(uint64(day+1), "10.1.0.1", "", nil, now, time.Minute))
+		archive.Flush()
+	}
+	if stats := archive.Stats(); stats.Files != 10 {
+		t.Fatalf("应有10个日文件，实际 %d", stats.Files)
+	}
+
+	// 第101天清理：第0天与第10天的文件已超过90天保留期
+	clock.Set(start.AddDate(0, 0, 101))
+	archive.Purge()
+	stats := archive.Stats()
+	if stats.Files != 8 || stats.Purged != 2 {
+		t.Fatalf("应清理2个过期日文件: %+v", stats)
+	}
+	page, _ := archive.Search(sessionarchive.Query{})
+	if page.Total != 8 || page.Records[len(page.Records)-1].ConnID != 21 {
+		t.Fatalf("清理后最早的会话应为第20天: %+v", page)
+	}
+
+	// 总大小上限：仅保留当天文件
+	clock2 := &archiveClock{now: start}
+	capped := newTestArchive(t, sessionarchive.Options{MaxTotalBytes: 1}, clock2)
+	for day := 0; day < 3; day++ {
+		clock2.Set(start.AddDate(0, 0, day))
+		capped.Submit(archivedSession(uint64(day+1), "10.1.0.2", "", nil, clock2.Now(), time.Minute))
+		capped.Flush()
+	}
+	if stats := capped.Stats(); stats.Files != 1 || stats.Purged != 2 {
+		t.Fatalf("超过总大小上限应只保留当天文件: %+v", stats)
+	}
+}
+
+// TestSessionArchiveVolume 10万条会话：批量写入不丢弃，按条件查询结果准确且耗时可接受
+func TestSessionArchiveVolume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short 模式跳过大批量归档测试")
+	}
+	const total = 100000
+	base := time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local)
+	clock := &archiveClock{now: base}
+	archive := newTestArchive(t, sessionarchive.Options{QueueSize: total}, clock)
+	archive.Start(t.Context())
+	defer archive.Stop()
+
+	for day := 0; day < 10; day++ {
+		clock.Set(base.AddDate(0, 0, day))
+		for i := 0; i < total/10; i++ {
+			id := uint64(day*total/10 + i)
+			ip := fmt.Sprintf("10.2.%d.%d", id%200, id%250)
+			iccid := fmt.Sprintf("8986%016d", id%5000)
+			device := fmt.Sprintf("04A%05X", id%20000)
+			archive.Submit(archivedSession(id, ip, iccid, []string{device}, clock.Now().Add(time.Duration(i)*time.Second), time.Minute))
+		}
+		archive.Flush()
+	}
+	stats := archive.Stats()
+	if stats.Archived != total || stats.Dropped != 0 || stats.Files != 10 {
+		t.Fatalf("归档统计错误: %+v", stats)
+	}
+
+	begin := time.Now()
+	page, err := archive.Search(sessionarchive.Query{ICCID: fmt.Sprintf("8986%016d", 1234), Limit: 5})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if page.Total != total/5000 || len(page.Records) != 5 {
+		t.Fatalf("按ICCID应匹配 %d 条: total=%d", total/5000, page.Total)
+	}
+	page, _ = archive.Search(sessionarchive.Query{DeviceID: "04A004D2", From: base.AddDate(0, 0, 5)})
+	if page.Total != 2 { // id%20000 == 1234 的5条分布在第0/2/4/6/8天，第5天之后为后两条
+		t.Fatalf("按设备与起始时间应匹配2条，实际 %d", page.Total)
+	}
+	if elapsed := time.Since(begin); elapsed > 10*time.Second {
+		t.Fatalf("10万条归档查询过慢: %s", elapsed)
+	}
+}
+
+// TestSessionArchiveEndpoint 连接清理经观察者异步归档，管理接口按条件分页查询并支持CSV导出
+func TestSessionArchiveEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	previous := sessionarchive.GetGlobalArchive()
+	defer sessionarchive.SetGlobalArchive(previous)
+	sessionarchive.SetGlobalArchive(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/session-archive", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用归档时应返回503，实际 %d", w.Code)
+	}
+
+	archive, err := sessionarchive.New(sessionarchive.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("创建会话归档失败: %v", err)
+	}
+	sessionarchive.SetGlobalArchive(archive)
+
+	tcpManager := core.GetGlobalTCPManager()
+	defer tcpManager.SetClosedSessionObserver(nil)
+	tcpManager.SetClosedSessionObserver(func(s core.ClosedSession) {
+		archive.Submit(sessionarchive.FromClosedSession(s))
+	})
+	conn := &disconnectTestConn{id: 1710001}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	if err := tcpManager.RegisterDevice(conn, "04A2AB01", "04A2AB01", "89860000000000171001"); err != nil {
+		t.Fatalf("注册设备失败: %v", err)
+	}
+	core.RecordConnTraffic(conn.id, 120, 0)
+	core.RecordConnTraffic(conn.id, 0, 45)
+	_ = tcpManager.UnregisterConnection(conn.id)
+	archive.Flush()
+
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/session-archive?deviceId=04A2AB01", "")
+	if w.Code != http.StatusOK || resp.Code != 0 {
+		t.Fatalf("查询失败: %d %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data struct {
+			Records []sessionarchive.Record `json:"records"`
+			Total   int                     `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if body.Data.Total != 1 {
+		t.Fatalf("应归档1条会话: %s", w.Body.String())
+	}
+	got := body.Data.Records[0]
+	if got.ConnID != conn.id || got.ICCID != "89860000000000171001" || got.RemoteIP != "10.0.0.1" ||
+		got.BytesIn != 120 || got.BytesOut != 45 || got.Reason != "unregister" || len(got.DeviceIDs) != 1 {
+		t.Fatalf("归档内容错误: %+v", got)
+	}
+
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/session-archive?iccid=89860000000000171001&page=0", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("page=0 应返回400，实际 %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/session-archive?ip=10.0.0.1&format=csv", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("CSV导出失败: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(rows) != 2 || rows[0][0] != "connId" || rows[1][3] != "89860000000000171001" {
+		t.Fatalf("CSV内容错误: %v %v", rows, err)
+	}
+}
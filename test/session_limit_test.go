@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// TestSessionLimits 设备并发会话上限：两个开始充电请求同时竞争最后一个名额只放行一个，拒绝时附进行中的端口；
+// 上限经API即时生效并展示在设备详情；智能降功率启用时超出满功率名额的会话以降功率接入
+func TestSessionLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shortConfirmTimeout(t)
+	const deviceID = "04B16941"
+	conn := registerSharedGroup(t, 1694001, "89860400000016940001", []string{deviceID})
+	g := gateway.GetGlobalDeviceGateway()
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	defer g.GetSessionLimiter().Delete(deviceID)
+
+	startCharging := func(port int, orderNo string) (int, replicaResponse) {
+		w, resp := callAPI(r, http.MethodPost, "/api/v1/charging/start", fmt.Sprintf(`{"deviceId":"%s","port":%d,"mode":0,"value":60,"balance":1000,"orderNo":"%s"}`, deviceID, port, orderNo))
+		return w.Code, resp
+	}
+	limitPath := "/api/v1/device/" + deviceID + "/session-limit"
+
+	t.Run("两个请求竞争最后一个名额", func(t *testing.T) {
+		if w, resp := callAPI(r, http.MethodPut, limitPath, `{"maxConcurrent":2,"reason":"供电容量"}`); w.Code != http.StatusOK || resp.Data["maxConcurrent"] != float64(2) || resp.Data["available"] != float64(2) {
+			t.Fatalf("设置上限失败: %d %v", w.Code, resp.Data)
+		}
+		if code, resp := startCharging(1, "ORD1694P1"); code != http.StatusOK {
+			t.Fatalf("第一个会话应放行: %d %v", code, resp)
+		}
+
+		var wg sync.WaitGroup
+		codes := make([]int, 2)
+		resps := make([]replicaResponse, 2)
+		for i, port := range []int{2, 3} {
+			wg.Add(1)
+			go func(i, port int) {
+				defer wg.Done()
+				codes[i], resps[i] = startCharging(port, fmt.Sprintf("ORD1694P%d", port))
+			}(i, port)
+		}
+		wg.Wait()
+		winner, loser := 0, 1
+		if codes[0] != http.StatusOK {
+			winner, loser = 1, 0
+		}
+		if codes[winner] != http.StatusOK || codes[loser] != http.StatusConflict {
+			t.Fatalf("最后一个名额只能放行一个请求: %v %v", codes, resps)
+		}
+		rejected := resps[loser].Data
+		active, _ := rejected["activePorts"].([]interface{})
+		winnerPort := float64(2 + winner)
+		if rejected["errorCode"] != apihttp.ErrorCodeSessionLimitReached || rejected["maxConcurrent"] != float64(2) ||
+			len(active) != 2 || active[0] != float64(1) || active[1] != winnerPort {
+			t.Fatalf("拒绝应附上限与进行中的端口: %v", rejected)
+		}
+		if order := g.GetOrderManager().GetOrder(deviceID, 3-winner); order != nil {
+			t.Fatalf("被拒绝的请求不应创建会话: %+v", order)
+		}
+		conn.take()
+	})
+
+	t.Run("设备详情展示上限与占用端口", func(t *testing.T) {
+		w, resp := callAPI(r, http.MethodGet, "/api/v1/device/"+deviceID+"/status", "")
+		limit, _ := resp.Data["sessionLimit"].(map[string]interface{})
+		if w.Code != http.StatusOK || limit["source"] != gateway.SessionLimitSourceDevice || limit["available"] != float64(0) || len(limit["activePorts"].([]interface{})) != 2 {
+			t.Fatalf("设备详情应展示并发上限: %d %v", w.Code, resp.Data["sessionLimit"])
+		}
+		w, resp = callAPI(r, http.MethodGet, "/api/v1/charging/session-limits", "")
+		if w.Code != http.StatusOK || resp.Data["total"] != float64(1) {
+			t.Fatalf("上限列表错误: %d %v", w.Code, resp.Data)
+		}
+	})
+
+	t.Run("会话结束后释放名额", func(t *testing.T) {
+		g.FinalizeChargingSession(deviceID, 1, "ORD1694P1", "测试结束")
+		if code, resp := startCharging(4, "ORD1694P4"); code != http.StatusOK {
+			t.Fatalf("会话结束后应放行: %d %v", code, resp)
+		}
+		conn.take()
+	})
+
+	t.Run("智能降功率启用时降功率接入", func(t *testing.T) {
+		if w, _ := callAPI(r, http.MethodPut, limitPath, `{"maxConcurrent":2,"reducedPowerSlots":1}`); w.Code != http.StatusBadRequest {
+			t.Fatalf("降功率名额与功率需同时配置: %d", w.Code)
+		}
+		if w, _ := callAPI(r, http.MethodPut, limitPath, `{"maxConcurrent":2,"reducedPowerSlots":1,"reducedPowerW":800}`); w.Code != http.StatusOK {
+			t.Fatalf("设置降功率名额失败: %d", w.Code)
+		}
+		dpc := gateway.GetDynamicPowerController()
+		defer dpc.SetEnabled(config.GetConfig().SmartCharging.Enabled)
+
+		dpc.SetEnabled(false)
+		if code, resp := startCharging(5, "ORD1694P5"); code != http.StatusConflict || resp.Data["errorCode"] != apihttp.ErrorCodeSessionLimitReached {
+			t.Fatalf("未启用智能降功率时应拒绝: %d %v", code, resp.Data)
+		}
+
+		dpc.SetEnabled(true)
+		code, resp := startCharging(5, "ORD1694P5")
+		if code != http.StatusOK || resp.Data["overloadPowerW"] != float64(800) {
+			t.Fatalf("应以降功率接入: %d %v", code, resp.Data)
+		}
+		frames := waitFrames(t, conn, 1, nil)
+		_, _, _, payload := frameHeader(frames[len(frames)-1])
+		if binary.LittleEndian.Uint16(payload[27:29]) != 800 {
+			t.Fatalf("开始充电帧应携带过载功率: %X", payload)
+		}
+		if w, _ := dpc.Overload(deviceID, 5, "ORD1694P5"); w != 800 {
+			t.Fatalf("智能降功率应从接入功率开始调整: %d", w)
+		}
+		if code, _ := startCharging(6, "ORD1694P6"); code != http.StatusConflict {
+			t.Fatalf("降功率名额用尽后应拒绝: %d", code)
+		}
+	})
+
+	t.Run("删除上限恢复默认", func(t *testing.T) {
+		if w, resp := callAPI(r, http.MethodDelete, limitPath, ""); w.Code != http.StatusOK || resp.Data["defaultMaxConcurrent"] != float64(0) {
+			t.Fatalf("删除上限失败: %d %v", w.Code, resp.Data)
+		}
+		if w, _ := callAPI(r, http.MethodDelete, limitPath, ""); w.Code != http.StatusNotFound {
+			t.Fatalf("重复删除应返回404: %d", w.Code)
+		}
+		if _, ok := g.GetSessionLimiter().Status(deviceID); ok {
+			t.Fatal("默认不限制时设备详情不应展示上限")
+		}
+		for port := 2; port <= 5; port++ {
+			g.FinalizeChargingSession(deviceID, port, fmt.Sprintf("ORD1694P%d", port), "测试结束")
+		}
+	})
+}
+
+// TestSessionLimiterConcurrentAdmit 多个请求同时竞争同一设备的最后一个名额：校验与预占原子完成，只有一个获得名额，归还后可再次获得
+func TestSessionLimiterConcurrentAdmit(t *testing.T) {
+	limiter := gateway.NewSessionLimiter(config.SessionLimitsConfig{}, func(string) []int { return []int{1, 2} }, nil)
+	if _, err := limiter.Set(gateway.SessionLimit{DeviceID: "04B16942", MaxConcurrent: 3}); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		admitted []*gateway.SessionAdmission
+		rejected int
+	)
+	for port := 3; port <= 10; port++ {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			admission, err := limiter.Admit("04B16942", port)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				rejected++
+				return
+			}
+			admitted = append(admitted, admission)
+		}(port)
+	}
+	wg.Wait()
+	if len(admitted) != 1 || rejected != 7 {
+		t.Fatalf("只应有一个请求获得最后一个名额: admitted=%d rejected=%d", len(admitted), rejected)
+	}
+	admitted[0].Release()
+	admitted[0].Release() // 重复归还无副作用
+	if _, err := limiter.Admit("04B16942", 9); err != nil {
+		t.Fatalf("归还后应可再次获得名额: %v", err)
+	}
+}
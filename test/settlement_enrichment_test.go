@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+)
+
+// TestSettlementEnrichment 富化结算文档：正常充电各部分齐全，孤立结算缺失部分显式为 null
+func TestSettlementEnrichment(t *testing.T) {
+	g := gateway.NewDeviceGateway()
+	asset.SetGlobalResolver(stubTenantResolver{"04B16720": {AssetCode: "ST-0167-P1", StationID: "ST-0167", TenantID: "operator-a"}})
+	defer asset.SetGlobalResolver(nil)
+
+	t.Run("正常充电", func(t *testing.T) {
+		conn := &disconnectTestConn{id: 1672001}
+		tcpManager := core.GetGlobalTCPManager()
+		if _, err := tcpManager.RegisterConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+		defer tcpManager.UnregisterConnection(conn.id)
+		if err := tcpManager.RegisterDeviceWithDetails(conn, "04B16720", "04B16720", "89860400000016720001", 0x04, "V2.31"); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local)
+		queuedAt := start.Add(-2 * time.Minute)
+		reconcile.GetGlobalReconciler().Ledger().RecordSession(reconcile.SessionRecord{
+			OrderNo: "ORD1672A", DeviceID: "04B16720", Port: 1, Mode: 0, Value: 3600,
+			StartTime: start, Status: "charging", PromotionTag: "weekend-free", QueuedAt: &queuedAt,
+		})
+		metering := g.GetMeteringTracker()
+		for i := 0; i <= 12; i++ {
+			metering.OnPowerSample("04B16720", 0, "ORD1672A", 1000, start.Add(time.Duration(i)*5*time.Minute))
+		}
+
+		doc := g.EnrichSettlement(gateway.SettledCharge{
+			OrderNo: "ORD1672A", DeviceID: "04B16720", Port: 0, EnergyWh: 1050, TotalFee: 120,
+			StartTime: start, EndTime: start.Add(time.Hour), ReceivedAt: start.Add(time.Hour),
+		})
+		if !doc.Complete || len(doc.Missing) != 0 {
+			t.Fatalf("正常充电应完整: %+v", doc.Missing)
+		}
+		if s := doc.Session; s == nil || *s.RequestedDurationSeconds != 3600 || *s.PromotionTag != "weekend-free" || !s.QueuedAt.Equal(queuedAt) || !s.StartTime.Equal(start) {
+			t.Fatalf("会话字段错误: %+v", doc.Session)
+		}
+		d := doc.Device
+		if *d.ICCID != "89860400000016720001" || *d.FirmwareVersion != "V2.31" || *d.TenantID != "operator-a" || *d.AssetCode != "ST-0167-P1" || *d.StationID != "ST-0167" {
+			t.Fatalf("设备上下文错误: %+v", d)
+		}
+		if m := doc.Metering; m == nil || m.IntegratedWh != 1000 || m.DeltaWh != 50 || *m.DeltaPercent != 5 || m.Samples != 13 || m.Gaps != 0 {
+			t.Fatalf("计量对比错误: %+v", doc.Metering)
+		}
+
+		data := doc.ToMap()
+		assertKeys(t, data, "settlement", "session", "device", "metering", "complete", "missing", "generated_at")
+		assertKeys(t, data["session"].(map[string]interface{}), "start_time", "mode", "requested_value", "requested_duration_seconds", "promotion_tag", "queued_at", "status")
+		assertKeys(t, data["device"].(map[string]interface{}), "device_id", "iccid", "firmware_version", "tenant_id", "asset_code", "station_id")
+		assertKeys(t, data["metering"].(map[string]interface{}), "integrated_wh", "reported_wh", "delta_wh", "delta_percent", "samples", "gaps", "first_sample_at", "last_sample_at")
+		if data["settlement"].(map[string]interface{})["orderNo"] != "ORD1672A" {
+			t.Fatalf("结算字段错误: %+v", data["settlement"])
+		}
+	})
+
+	t.Run("孤立结算", func(t *testing.T) {
+		doc := g.EnrichSettlement(gateway.SettledCharge{OrderNo: "ORD1672-ORPHAN", DeviceID: "04B16799", Port: 1, EnergyWh: 300})
+		want := []string{gateway.EnrichmentMissingSession, gateway.EnrichmentMissingDevice, gateway.EnrichmentMissingAsset, gateway.EnrichmentMissingMetering}
+		if doc.Complete || !reflect.DeepEqual(doc.Missing, want) {
+			t.Fatalf("孤立结算应标记缺失部分: complete=%v missing=%v", doc.Complete, doc.Missing)
+		}
+
+		data := doc.ToMap()
+		assertKeys(t, data, "settlement", "session", "device", "metering", "complete", "missing", "generated_at")
+		if data["session"] != nil || data["metering"] != nil {
+			t.Fatalf("缺失的会话与计量应为 null: %+v", data)
+		}
+		device := data["device"].(map[string]interface{})
+		for _, key := range []string{"iccid", "firmware_version", "tenant_id", "asset_code", "station_id"} {
+			if v, ok := device[key]; !ok || v != nil {
+				t.Fatalf("设备字段 %s 应显式为 null: %+v", key, device)
+			}
+		}
+	})
+}
+
+// assertKeys 校验文档包含全部字段（缺失部分也须以 null 出现）
+func assertKeys(t *testing.T, data map[string]interface{}, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if _, ok := data[key]; !ok {
+			t.Fatalf("缺少字段 %s: %+v", key, data)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/domain/dny_protocol"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/zinx_server/handlers"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/gin-gonic/gin"
+)
+
+// settlementFrame 设备04A26CF3上报的结算帧：时长3600秒、最大功率2200、电量125、端口0、卡号12345678、停止原因1、
+// 订单ORD2025101500001、时间戳1760486400
+const settlementFrame = "444E592E00F36CA204030003100E98087D00000178563412014F524432303235313031353030303031340800E4EE680000510B"
+
+// TestSettlementParse 结算(0x03)载荷解析：完整帧解出订单号、端口、电量、时长、停止原因与卡号；长度不足与订单编号非ASCII的载荷以专门错误拒绝
+func TestSettlementParse(t *testing.T) {
+	frame, err := protocol.ParseDNYHexString(settlementFrame)
+	if err != nil || !frame.ChecksumValid || frame.Command != 0x03 || frame.PhysicalID != 0x04A26CF3 {
+		t.Fatalf("结算帧解析失败: %+v %v", frame, err)
+	}
+	payload := frame.Data
+	withOrderNo := func(orderNo []byte) []byte {
+		p := append([]byte(nil), payload...)
+		copy(p[13:29], make([]byte, 16))
+		copy(p[13:29], orderNo)
+		return p
+	}
+
+	cases := []struct {
+		name     string
+		payload  []byte
+		wantErr  error
+		orderNo  string
+		energy   uint32
+		duration time.Duration
+	}{
+		{name: "完整载荷", payload: payload, orderNo: "ORD2025101500001", energy: 125, duration: time.Hour},
+		{name: "无占位时长的35字节载荷", payload: payload[:35], orderNo: "ORD2025101500001", energy: 125, duration: time.Hour},
+		{name: "空载荷", payload: nil, wantErr: dny_protocol.ErrSettlementTooShort},
+		{name: "截断到订单编号", payload: payload[:20], wantErr: dny_protocol.ErrSettlementTooShort},
+		{name: "订单编号含控制字符", payload: withOrderNo([]byte("ORD\x01202510")), wantErr: dny_protocol.ErrSettlementOrderNo},
+		{name: "订单编号含非ASCII字节", payload: withOrderNo([]byte("订单001")), wantErr: dny_protocol.ErrSettlementOrderNo},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s dny_protocol.SettlementData
+			err := s.UnmarshalBinary(tc.payload)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("应返回 %v，实际 %v", tc.wantErr, err)
+				}
+				if s.OrderID != "" {
+					t.Fatalf("被拒绝的载荷不应填充字段: %+v", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.OrderID != tc.orderNo || s.GunNumber != 0 || s.ElectricEnergy != tc.energy || s.CardNumber != "12345678" || s.StopReason != 1 {
+				t.Fatalf("解码字段错误: %+v", s)
+			}
+			if s.EndTime.Unix() != 1760486400 || s.EndTime.Sub(s.StartTime) != tc.duration {
+				t.Fatalf("时长应按设备时间戳倒推: start=%v end=%v", s.StartTime, s.EndTime)
+			}
+		})
+	}
+}
+
+// TestSettlementHandlerStore 结算帧经处理器写入结算日志存储并可按订单号查询；不合法载荷按原因计数且不写入
+func TestSettlementHandlerStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quietLogger(t)
+	store, err := settlement.Open(config.SettlementStoreConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settlement.SetGlobalStore(store)
+	t.Cleanup(func() {
+		settlement.SetGlobalStore(nil)
+		_ = store.Close()
+	})
+
+	tcpManager := core.GetGlobalTCPManager()
+	conn := &frameCaptureConn{disconnectTestConn: disconnectTestConn{id: 1764001}}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := tcpManager.RegisterDevice(conn, "04A26CF3", "04A26CF3", "89860000000000176401"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcpManager.UnregisterConnection(conn.id) })
+	feed := func(frame []byte) {
+		t.Helper()
+		req := znet.NewRequest(conn, zpack.NewMsgPackage(0x03, frame))
+		req.BindRouter(&handlers.SettlementHandler{})
+		req.Call()
+	}
+	ackStatus := func() byte {
+		t.Helper()
+		got := waitFrames(t, conn, 1, nil)
+		_, _, command, data := frameHeader(got[len(got)-1])
+		if command != 0x03 || len(data) != 1 {
+			t.Fatalf("应答应为0x03单字节状态: % X", got[len(got)-1])
+		}
+		return data[0]
+	}
+
+	raw, _ := hex.DecodeString(settlementFrame)
+	feed(raw)
+	if status := ackStatus(); status != 0x00 {
+		t.Fatalf("合法结算应答应为成功: %d", status)
+	}
+
+	before := settlement.RejectedCounts()
+	frame, _ := protocol.ParseDNYHexString(settlementFrame)
+	badOrder := append([]byte(nil), frame.Data...)
+	badOrder[15] = 0xFF
+	feed(protocol.BuildUnifiedDNYPacket(0x04A26CF3, 0x0004, 0x03, badOrder))
+	if status := ackStatus(); status == 0x00 {
+		t.Fatal("订单编号不合法应答应为失败")
+	}
+	feed(protocol.BuildUnifiedDNYPacket(0x04A26CF3, 0x0005, 0x03, frame.Data[:6]))
+	if status := ackStatus(); status == 0x00 {
+		t.Fatal("长度不足应答应为失败")
+	}
+	after := settlement.RejectedCounts()
+	if after[settlement.RejectOrderNo]-before[settlement.RejectOrderNo] != 1 || after[settlement.RejectTooShort]-before[settlement.RejectTooShort] != 1 {
+		t.Fatalf("拒绝计数错误: before=%v after=%v", before, after)
+	}
+	if stats := store.Stats(); stats.Records != 1 {
+		t.Fatalf("只应写入合法结算: %+v", stats)
+	}
+
+	h := apihttp.NewSettlementHandlers()
+	r := gin.New()
+	r.GET("/api/v1/settlements/:orderNo", h.HandleGetSettlement)
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/settlements/ORD2025101500001", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("按订单号查询失败: %s", w.Body.String())
+	}
+	rec := resp.Data["settlement"].(map[string]interface{})
+	if rec["device_id"] != "04A26CF3" || rec["energy_wh"].(float64) != 125 || rec["card_number"] != "12345678" || rec["stop_reason"].(float64) != 1 {
+		t.Fatalf("结算记录字段错误: %+v", rec)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/reconcile"
+	"github.com/bujia-iot/iot-zinx/pkg/settlement"
+	"github.com/gin-gonic/gin"
+)
+
+func settlementRecord(orderNo, deviceID string, fee uint32, receivedAt time.Time) settlement.Record {
+	payload := make([]byte, 35)
+	copy(payload, orderNo)
+	payload[30] = byte(fee)
+	return settlement.Record{
+		OrderNo:    orderNo,
+		DeviceID:   deviceID,
+		Port:       1,
+		EnergyWh:   1000,
+		TotalFee:   fee,
+		Payload:    payload,
+		RawFrame:   append([]byte("DNY"), payload...),
+		ReceivedAt: receivedAt,
+	}
+}
+
+// TestSettlementStore 结算日志存储：写入去重、崩溃截断恢复、重建索引、区间扫描、轮转与保留期、合并fsync
+func TestSettlementStore(t *testing.T) {
+	day := time.Date(2026, 10, 14, 0, 0, 0, 0, time.Local)
+
+	t.Run("崩溃截断到最后一条完整记录", func(t *testing.T) {
+		cfg := config.SettlementStoreConfig{Dir: t.TempDir()}
+		store, err := settlement.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, orderNo := range []string{"ORD1695A", "ORD1695B", "ORD1695C"} {
+			if _, duplicate, err := store.Append(settlementRecord(orderNo, "04A26CF3", 100, day.Add(time.Duration(i)*time.Hour))); err != nil || duplicate {
+				t.Fatalf("写入失败: %v %v", duplicate, err)
+			}
+		}
+		// 设备重发：载荷相同去重，载荷不同保留为新版本
+		rec, duplicate, err := store.Append(settlementRecord("ORD1695A", "04A26CF3", 100, day.Add(5*time.Hour)))
+		if err != nil || !duplicate || rec.Seq != 1 {
+			t.Fatalf("相同载荷应去重并返回原记录: %v %+v %v", duplicate, rec, err)
+		}
+		if _, duplicate, _ := store.Append(settlementRecord("ORD1695A", "04A26CF3", 120, day.Add(5*time.Hour))); duplicate {
+			t.Fatal("载荷不同的结算应保留")
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := store.Append(settlementRecord("ORD1695D", "04A26CF3", 100, day)); !errors.Is(err, settlement.ErrStoreClosed) {
+			t.Fatalf("关闭后应拒绝写入: %v", err)
+		}
+
+		// 最后一条记录只写了一半
+		segment := filepath.Join(cfg.Dir, "settlements-00000001.seg")
+		info, err := os.Stat(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(segment, info.Size()-20); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err = settlement.Open(cfg)
+		if err != nil {
+			t.Fatalf("截断后应能打开: %v", err)
+		}
+		defer store.Close()
+		stats := store.Stats()
+		if stats.Records != 3 || stats.Orders != 3 || stats.Truncated == 0 || stats.LastSeq != 3 {
+			t.Fatalf("应恢复到最后一条完整记录: %+v", stats)
+		}
+		revisions, err := store.Lookup("ORD1695A")
+		if err != nil || len(revisions) != 1 || revisions[0].TotalFee != 100 || len(revisions[0].RawFrame) != 38 {
+			t.Fatalf("未完整写入的版本应被丢弃、完整记录保持原样: %+v %v", revisions, err)
+		}
+		if records, err := store.Lookup("ORD1695C"); err != nil || !records[0].ReceivedAt.Equal(day.Add(2*time.Hour)) {
+			t.Fatalf("截断点之前的记录应完整: %+v %v", records, err)
+		}
+		rec, duplicate, err = store.Append(settlementRecord("ORD1695A", "04A26CF3", 120, day.Add(6*time.Hour)))
+		if err != nil || duplicate || rec.Seq != 4 {
+			t.Fatalf("恢复后设备重发的结算应写入: %v %+v %v", duplicate, rec, err)
+		}
+	})
+
+	t.Run("按设备与日期扫描", func(t *testing.T) {
+		store, err := settlement.Open(config.SettlementStoreConfig{Dir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		for i := 0; i < 6; i++ {
+			device := "04A26CF3"
+			if i%2 == 1 {
+				device = "04A2715A"
+			}
+			if _, _, err := store.Append(settlementRecord(fmt.Sprintf("ORD1695S%d", i), device, 100, day.Add(time.Duration(i*10)*time.Hour))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		records, more, err := store.Scan(settlement.Query{DeviceID: "04A26CF3", From: day, To: day.AddDate(0, 0, 3)})
+		if err != nil || more || len(records) != 3 || records[0].OrderNo != "ORD1695S0" || records[2].OrderNo != "ORD1695S4" {
+			t.Fatalf("设备区间扫描错误: %+v %v", records, err)
+		}
+		records, _, _ = store.Scan(settlement.Query{DeviceID: "04A26CF3", From: day.Add(12 * time.Hour), To: day.Add(41 * time.Hour)})
+		if len(records) != 2 || records[0].OrderNo != "ORD1695S2" {
+			t.Fatalf("跨日不足整日的区间应覆盖末日: %+v", records)
+		}
+		records, more, _ = store.Scan(settlement.Query{Limit: 4})
+		if len(records) != 4 || !more {
+			t.Fatalf("达到上限应返回 more: %d %v", len(records), more)
+		}
+		records, more, _ = store.Scan(settlement.Query{AfterSeq: records[3].Seq, Limit: 4})
+		if len(records) != 2 || more || records[0].Seq != 5 {
+			t.Fatalf("翻页错误: %+v %v", records, more)
+		}
+	})
+
+	t.Run("轮转与保留期", func(t *testing.T) {
+		cfg := config.SettlementStoreConfig{Dir: t.TempDir(), SegmentMaxBytes: 512, RetentionDays: 30}
+		store, err := settlement.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 8; i++ {
+			if _, _, err := store.Append(settlementRecord(fmt.Sprintf("ORD1695R%d", i), "04A26CF3", 100, day)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if stats := store.Stats(); stats.Segments < 3 {
+			t.Fatalf("超过段上限应轮转: %+v", stats)
+		}
+		_ = store.Close()
+
+		old := time.Now().AddDate(0, 0, -31)
+		if err := os.Chtimes(filepath.Join(cfg.Dir, "settlements-00000001.seg"), old, old); err != nil {
+			t.Fatal(err)
+		}
+		store, err = settlement.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		if _, err := os.Stat(filepath.Join(cfg.Dir, "settlements-00000001.seg")); !os.IsNotExist(err) {
+			t.Fatal("超过保留期的段应删除")
+		}
+		if _, err := store.Lookup("ORD1695R0"); !errors.Is(err, settlement.ErrNotFound) {
+			t.Fatalf("已删除段的索引应移除: %v", err)
+		}
+		if _, err := store.Lookup("ORD1695R7"); err != nil {
+			t.Fatalf("保留期内的记录应保留: %v", err)
+		}
+	})
+
+	t.Run("并发写入合并fsync", func(t *testing.T) {
+		store, err := settlement.Open(config.SettlementStoreConfig{Dir: t.TempDir(), SyncMaxLatencyMs: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if _, _, err := store.Append(settlementRecord(fmt.Sprintf("ORD1695G%d", i), "04A26CF3", 100, day)); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		stats := store.Stats()
+		if stats.Appended != 32 || stats.Syncs >= 32 {
+			t.Fatalf("并发写入应合并fsync: %+v", stats)
+		}
+		_ = store.Close()
+	})
+}
+
+// TestSettlementStoreAPI 结算查询接口与对账结算来源
+func TestSettlementStoreAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	settlement.SetGlobalStore(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/settlements", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用时应返回503: %d", w.Code)
+	}
+
+	store, err := settlement.Open(config.SettlementStoreConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settlement.SetGlobalStore(store)
+	defer settlement.StopGlobalStore()
+
+	day := time.Date(2026, 10, 13, 0, 0, 0, 0, time.Local)
+	_, _, _ = store.Append(settlementRecord("ORD1695H1", "04A26CF3", 100, day.Add(10*time.Hour)))
+	_, _, _ = store.Append(settlementRecord("ORD1695H1", "04A26CF3", 110, day.Add(11*time.Hour)))
+	_, _, _ = store.Append(settlementRecord("ORD1695H2", "04A2715A", 200, day.Add(12*time.Hour)))
+
+	w, resp := callAPI(r, http.MethodGet, fmt.Sprintf("/api/v1/settlements?deviceId=04A26CF3&from=%d&to=%d&limit=1", day.Unix(), day.AddDate(0, 0, 1).Unix()), "")
+	if w.Code != http.StatusOK || resp.Data["count"] != float64(1) || resp.Data["more"] != true || resp.Data["nextAfterSeq"] != float64(1) {
+		t.Fatalf("结算列表错误: %d %v", w.Code, resp.Data)
+	}
+	w, resp = callAPI(r, http.MethodGet, "/api/v1/settlements/ORD1695H1", "")
+	latest, _ := resp.Data["settlement"].(map[string]interface{})
+	if w.Code != http.StatusOK || len(resp.Data["revisions"].([]interface{})) != 2 || latest["total_fee"] != float64(110) {
+		t.Fatalf("订单结算查询错误: %d %v", w.Code, resp.Data)
+	}
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/settlements/ORD1695NONE", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("不存在的订单应返回404: %d", w.Code)
+	}
+
+	// 对账：结算仅在存储中时也能匹配会话，同一订单以首条结算为准
+	rec, err := reconcile.NewReconciler(reconcile.Options{Grace: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.SetSettlementSource(settlement.ReconcileSource(store))
+	rec.Ledger().RecordSession(reconcile.SessionRecord{OrderNo: "ORD1695H1", DeviceID: "04A26CF3", Port: 1, StartTime: day.Add(9 * time.Hour), Status: "charging"})
+	rec.Ledger().RecordSettlement(reconcile.SettlementRecord{OrderNo: "ORD1695H3", DeviceID: "04A26CF3", TotalFee: 50, ReceivedAt: day.Add(13 * time.Hour)})
+	report, err := rec.Run(day, reconcile.TriggerManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MatchedCount != 1 || report.MatchedTotals.TotalFee != 100 || report.OrphanCount != 2 || report.OrphanTotals.TotalFee != 250 {
+		t.Fatalf("对账应合并存储与台账的结算: %+v", report.Summary())
+	}
+}
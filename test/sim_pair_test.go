@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// TestSIMPairFailover 双卡设备：卡对声明校验、切换后设备信息连续、按ICCID计连接、稳定期防抖
+func TestSIMPairFailover(t *testing.T) {
+	const (
+		deviceID  = "04A2715A"
+		primary   = "89860404192080617692"
+		secondary = "89860404192080617693"
+	)
+	tm := core.NewTCPManager(nil)
+	registry := tm.GetSIMPairRegistry()
+	registry.SetWindows(time.Hour, time.Minute)
+
+	if _, err := registry.Declare(core.SIMPair{DeviceID: deviceID, PrimaryICCID: primary, SecondaryICCID: primary}); err == nil {
+		t.Fatal("主副卡相同应拒绝")
+	}
+	if _, err := registry.Declare(core.SIMPair{DeviceID: deviceID, PrimaryICCID: primary, SecondaryICCID: secondary, Source: core.SIMPairSourceAPI}); err != nil {
+		t.Fatalf("声明卡对失败: %v", err)
+	}
+	if _, err := registry.Declare(core.SIMPair{DeviceID: "04A2715B", PrimaryICCID: secondary, SecondaryICCID: "89860404192080617694"}); err == nil {
+		t.Fatal("ICCID已属于其他设备的卡对应拒绝")
+	}
+
+	var failovers []core.SIMFailover
+	registry.RegisterHandler(func(f core.SIMFailover) { failovers = append(failovers, f) })
+	var cleanupReasons []string
+	tm.SetConnectionCleanupHandler(func(_ uint64, _ []string, reason string) { cleanupReasons = append(cleanupReasons, reason) })
+
+	register := func(connID uint64, iccid string) error {
+		conn := &disconnectTestConn{id: connID}
+		if _, err := tm.RegisterConnection(conn); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+		return tm.RegisterDeviceWithDetails(conn, deviceID, deviceID, iccid, 0x21, "V2.1")
+	}
+
+	// 主卡上线
+	if err := register(1654001, primary); err != nil {
+		t.Fatalf("主卡注册失败: %v", err)
+	}
+	device, _ := tm.GetDeviceByID(deviceID)
+	registeredAt := device.RegisteredAt
+	_ = tm.UpdateHeartbeat(deviceID)
+
+	// 主卡连接未断开时副卡注册：视为切换（两张卡短暂重叠），旧连接按切换原因清理
+	conn2 := &disconnectTestConn{id: 1654002}
+	_, _ = tm.RegisterConnection(conn2)
+	if err := tm.RegisterDevice(conn2, deviceID, deviceID, secondary); err != nil {
+		t.Fatalf("副卡注册失败: %v", err)
+	}
+	if len(failovers) != 1 || failovers[0].FromICCID != primary || failovers[0].ToICCID != secondary || !failovers[0].Overlap || failovers[0].FromConnID != 1654001 {
+		t.Fatalf("切换事件错误: %+v", failovers)
+	}
+	if len(cleanupReasons) != 1 || cleanupReasons[0] != core.CleanupReasonSIMFailover {
+		t.Fatalf("旧卡连接应按切换原因清理: %v", cleanupReasons)
+	}
+	device, _ = tm.GetDeviceByID(deviceID)
+	if device.ICCID != secondary || !device.RegisteredAt.Equal(registeredAt) || device.HeartbeatCount != 1 || device.DeviceType != 0x21 || device.DeviceVersion != "V2.1" {
+		t.Fatalf("切换后设备信息应连续: %+v", device)
+	}
+
+	detail, err := tm.GetDeviceDetail(deviceID)
+	if err != nil || detail["activeIccid"] != secondary || detail["pairedIccid"] != primary || detail["lastFailoverAt"] == "" {
+		t.Fatalf("设备详情缺少卡对信息: %v %v", detail, err)
+	}
+
+	// 稳定期内主卡抢占存活的副卡连接：拒绝
+	if err := register(1654003, primary); err == nil {
+		t.Fatal("稳定期内旧卡注册应拒绝")
+	}
+	if status, _ := registry.Get(deviceID); status.ActiveICCID != secondary || status.Failovers != 1 {
+		t.Fatalf("稳定期内当前卡不应变化: %+v", status)
+	}
+
+	// 每张卡各自计数连接
+	status, _ := registry.Get(deviceID)
+	if status.Usage[primary].Connections != 1 || status.Usage[secondary].Connections != 1 || status.Usage[primary].LastDisconnectedAt.IsZero() {
+		t.Fatalf("按ICCID的连接统计错误: %+v %+v", status.Usage[primary], status.Usage[secondary])
+	}
+
+	if !registry.Remove(deviceID) || registry.Remove(deviceID) {
+		t.Fatal("删除卡对结果错误")
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/sla"
+	"github.com/gin-gonic/gin"
+)
+
+// slaClock 可推进的假时钟
+type slaClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *slaClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *slaClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func slaWindow(t *testing.T, snapshot sla.TenantSLA, name string) sla.WindowStats {
+	t.Helper()
+	for _, w := range snapshot.Windows {
+		if w.Window == name {
+			return w
+		}
+	}
+	t.Fatalf("缺少窗口 %s: %+v", name, snapshot.Windows)
+	return sla.WindowStats{}
+}
+
+func recordN(tracker *sla.Tracker, tenant string, class sla.Class, n int) {
+	for i := 0; i < n; i++ {
+		tracker.Record(tenant, class)
+	}
+}
+
+// TestSLASlidingWindows 假时钟跨越分钟/小时/天桶边界：旧桶滑出窗口后不再计入；离线与否定应答单独列出、不扣减SLA成功率
+func TestSLASlidingWindows(t *testing.T) {
+	clock := &slaClock{now: time.Date(2026, 10, 15, 8, 0, 30, 0, time.UTC)}
+	tracker := sla.NewTracker(sla.Options{})
+	tracker.SetNowFunc(clock.Now)
+
+	recordN(tracker, "tenant-a", sla.ClassSuccess, 90)
+	recordN(tracker, "tenant-a", sla.ClassGatewayError, 5)
+	recordN(tracker, "tenant-a", sla.ClassDeviceTimeout, 5)
+	recordN(tracker, "tenant-a", sla.ClassDeviceOffline, 30)
+	recordN(tracker, "tenant-a", sla.ClassDeviceRejected, 10)
+	tracker.Record("", sla.ClassSuccess)
+
+	snapshot, ok := tracker.Snapshot("tenant-a")
+	if !ok {
+		t.Fatal("应有租户统计")
+	}
+	for _, name := range []string{sla.Window1h, sla.Window24h, sla.Window30d} {
+		w := slaWindow(t, snapshot, name)
+		if w.Total != 140 || w.Success != 90 || w.Counted != 100 || w.AttributableFailures != 10 || w.SuccessRate != 90 {
+			t.Fatalf("%s 窗口统计错误: %+v", name, w)
+		}
+		if w.RawSuccessRate != 64.286 || w.Breakdown[sla.ClassDeviceOffline].Count != 30 || w.Breakdown[sla.ClassDeviceOffline].Attributable ||
+			!w.Breakdown[sla.ClassGatewayError].Attributable || w.Breakdown[sla.ClassDeviceRejected].Percent != 7.143 {
+			t.Fatalf("%s 窗口失败分布错误: %+v", name, w)
+		}
+	}
+	if _, ok := tracker.Snapshot(sla.UnassignedTenant); !ok {
+		t.Fatal("未标注租户的命令应计入 _unassigned")
+	}
+	if _, ok := tracker.Snapshot("tenant-b"); ok {
+		t.Fatal("没有命令的租户不应有统计")
+	}
+
+	// 59分钟后仍在1h窗口内（首个分钟桶为当前桶之前的第59个）
+	clock.Advance(59 * time.Minute)
+	tracker.Record("tenant-a", sla.ClassSuccess)
+	snapshot, _ = tracker.Snapshot("tenant-a")
+	if w := slaWindow(t, snapshot, sla.Window1h); w.Total != 141 {
+		t.Fatalf("59分钟内的命令应仍在1h窗口: %+v", w)
+	}
+
+	// 跨越分钟桶边界：08:00 的分钟桶滑出1h窗口，24h/30d 不受影响
+	clock.Advance(time.Minute)
+	snapshot, _ = tracker.Snapshot("tenant-a")
+	if w := slaWindow(t, snapshot, sla.Window1h); w.Total != 1 || w.SuccessRate != 100 {
+		t.Fatalf("1h窗口应只剩最近的命令: %+v", w)
+	}
+	tracker.Record("tenant-a", sla.ClassSuccess) // 09:00:30
+	snapshot, _ = tracker.Snapshot("tenant-a")
+	if w := slaWindow(t, snapshot, sla.Window24h); w.Total != 142 || w.Success != 92 {
+		t.Fatalf("24h窗口应保留全部命令: %+v", w)
+	}
+
+	// 跨越小时桶边界：次日08:00后 08时 的小时桶滑出24h窗口，09时的命令保留
+	clock.Advance(23 * time.Hour)
+	snapshot, _ = tracker.Snapshot("tenant-a")
+	if w := slaWindow(t, snapshot, sla.Window24h); w.Total != 1 || w.Success != 1 {
+		t.Fatalf("24h窗口应只剩09时的命令: %+v", w)
+	}
+	if w := slaWindow(t, snapshot, sla.Window30d); w.Total != 142 {
+		t.Fatalf("30d窗口应保留全部命令: %+v", w)
+	}
+
+	// 跨越天桶边界：30天后 10-15 的天桶滑出30d窗口；环形缓冲复用槽位时旧计数清零
+	clock.Advance(29 * 24 * time.Hour)
+	tracker.Record("tenant-a", sla.ClassGatewayError)
+	snapshot, _ = tracker.Snapshot("tenant-a")
+	if w := slaWindow(t, snapshot, sla.Window30d); w.Total != 1 || w.SuccessRate != 0 || w.DominantFailure != sla.ClassGatewayError {
+		t.Fatalf("30d窗口应只剩最新的命令: %+v", w)
+	}
+	if w := slaWindow(t, snapshot, sla.Window1h); w.Total != 1 || w.BucketSeconds != 60 || w.WindowSeconds != 3600 {
+		t.Fatalf("1h窗口槽位复用错误: %+v", w)
+	}
+}
+
+// TestSLAAlerts 24h成功率低于阈值时告警并给出占比最高的可归责失败分类；设备离线不触发告警；窗口滑过后恢复
+func TestSLAAlerts(t *testing.T) {
+	clock := &slaClock{now: time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)}
+	tracker := sla.NewTracker(sla.Options{Rules: []sla.Rule{
+		{Name: "success_below_95", MinSuccessPercent: 95, MinCommands: 50},
+		{Name: "vip_below_99", MinSuccessPercent: 99, Tenants: []string{"tenant-vip"}},
+		{Name: "invalid", MinSuccessPercent: 120},
+	}})
+	tracker.SetNowFunc(clock.Now)
+	if rules := tracker.Options().Rules; len(rules) != 2 {
+		t.Fatalf("无效规则应被忽略: %+v", rules)
+	}
+	var notified []sla.Alert
+	tracker.RegisterHandler(func(a sla.Alert) { notified = append(notified, a) })
+
+	// 设备离线大量失败：不计入SLA，不告警
+	recordN(tracker, "tenant-a", sla.ClassSuccess, 60)
+	recordN(tracker, "tenant-a", sla.ClassDeviceOffline, 60)
+	if len(notified) != 0 {
+		t.Fatalf("设备离线不应触发SLA告警: %+v", notified)
+	}
+
+	// 命令量不足 minCommands 时不告警
+	recordN(tracker, "tenant-b", sla.ClassDeviceTimeout, 10)
+	if len(notified) != 0 {
+		t.Fatalf("命令量不足时不应告警: %+v", notified)
+	}
+
+	// 第4个设备超时时 60/64=93.75% < 95%
+	recordN(tracker, "tenant-a", sla.ClassDeviceTimeout, 4)
+	recordN(tracker, "tenant-a", sla.ClassGatewayError, 2)
+	if len(notified) != 1 {
+		t.Fatalf("成功率低于阈值应告警一次: %+v", notified)
+	}
+	alert := notified[0]
+	if alert.State != sla.StateFiring || alert.TenantID != "tenant-a" || alert.Rule != "success_below_95" ||
+		alert.DominantFailure != sla.ClassDeviceTimeout || alert.DominantCount != 4 || alert.Failures[sla.ClassDeviceOffline] != 60 ||
+		alert.Counted != 64 || alert.SuccessRate != 93.75 {
+		t.Fatalf("告警内容错误: %+v", alert)
+	}
+	// 告警期间继续失败只更新最低成功率与失败分布，不重复通知：60/76
+	clock.Advance(30 * time.Minute)
+	recordN(tracker, "tenant-a", sla.ClassGatewayError, 10)
+	if len(notified) != 1 {
+		t.Fatalf("进行中的告警不应重复通知: %+v", notified)
+	}
+	active := tracker.Active()
+	if len(active) != 1 || active[0].LowestRate != 78.947 || active[0].DominantFailure != sla.ClassGatewayError {
+		t.Fatalf("成功率继续下降时应更新失败分布: %+v", active)
+	}
+	snapshot, _ := tracker.Snapshot("tenant-a")
+	if len(snapshot.ActiveAlerts) != 1 || len(snapshot.RecentAlerts) != 1 {
+		t.Fatalf("租户快照应包含进行中的告警: %+v", snapshot)
+	}
+
+	// 租户限定规则：首个失败时 94/95 低于99%，第6个失败时 94/100 低于95%
+	recordN(tracker, "tenant-vip", sla.ClassSuccess, 94)
+	recordN(tracker, "tenant-vip", sla.ClassGatewayError, 6)
+	if len(notified) != 3 {
+		t.Fatalf("VIP租户应触发两条规则: %+v", notified)
+	}
+
+	// 24h后失败所在的小时桶滑出窗口，定时判定时恢复
+	clock.Advance(24 * time.Hour)
+	tracker.Evaluate()
+	if len(tracker.Active()) != 0 {
+		t.Fatalf("窗口滑过后告警应恢复: %+v", tracker.Active())
+	}
+	resolved := 0
+	for _, a := range notified[3:] {
+		if a.State == sla.StateResolved && a.ResolvedAt != nil {
+			resolved++
+		}
+	}
+	if resolved != 3 {
+		t.Fatalf("应通知三条告警恢复: %+v", notified)
+	}
+	if history := tracker.History(); len(history) != 3 || history[2].TenantID != "tenant-a" || history[2].State != sla.StateResolved {
+		t.Fatalf("告警记录错误: %+v", history)
+	}
+}
+
+// TestSLACommandOutcomes 命令管理器与发送路径的结束结果分类：确认、否定应答、断线（等待重发的命令不计入）与离线设备下发
+func TestSLACommandOutcomes(t *testing.T) {
+	const pid = uint32(0x04A27081)
+	var mu sync.Mutex
+	outcomes := make(map[string][]network.CommandOutcome)
+	network.SetCommandOutcomeObserver(func(r network.CommandResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		outcomes[r.DeviceID] = append(outcomes[r.DeviceID], r.Outcome)
+	})
+	defer network.SetCommandOutcomeObserver(nil)
+	taken := func(deviceID string) []network.CommandOutcome {
+		mu.Lock()
+		defer mu.Unlock()
+		out := outcomes[deviceID]
+		delete(outcomes, deviceID)
+		return out
+	}
+
+	cm := network.GetCommandManager()
+	conn := &disconnectTestConn{id: 1708001}
+	cm.RegisterCommand(conn, pid, 0x0301, 0x82, []byte{0x01})
+	cm.ConfirmCommand(pid, 0x0301, 0x82)
+	cm.RegisterCommand(conn, pid, 0x0302, 0x96, []byte{0x01})
+	cm.HandleNegativeAck(decodeNAKFrame(t, pid, 0x0302, 0x96, []byte{0xFE}))
+	cm.RegisterCommandWithOptions(conn, pid, 0x0303, 0x83, []byte{0x01}, network.CommandOptions{})
+	cm.RegisterCommandWithOptions(conn, pid, 0x0304, 0x8A, []byte{0x01}, network.CommandOptions{ResendOnReconnect: true})
+	cm.FailConnectionCommands(conn.id, "test")
+
+	got := taken("04A27081")
+	want := []network.CommandOutcome{network.OutcomeSuccess, network.OutcomeDeviceRejected, network.OutcomeDeviceOffline}
+	if len(got) != len(want) {
+		t.Fatalf("命令结果错误（等待重发的命令不应计入）: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("命令结果错误: %v", got)
+		}
+	}
+
+	// 离线设备：发送路径未进入命令管理器即失败
+	if err := gateway.GetGlobalDeviceGateway().SendCommandToDevice("04A27082", 0x96, nil); err == nil {
+		t.Fatal("离线设备下发应失败")
+	}
+	if got := taken("04A27082"); len(got) != 1 || got[0] != network.OutcomeDeviceOffline {
+		t.Fatalf("离线设备下发应记为 device_offline: %v", got)
+	}
+}
+
+// TestTenantSLAEndpoint GET /api/v1/tenants/{tenant}/sla：按资产映射归属租户统计；未启用时503，无统计的租户404
+func TestTenantSLAEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	sla.SetGlobalTracker(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/tenants/tenant-x/sla", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用时应返回503: %d", w.Code)
+	}
+
+	tracker := sla.NewTracker(sla.Options{})
+	sla.SetGlobalTracker(tracker)
+	defer sla.SetGlobalTracker(nil)
+	previous := asset.GetGlobalResolver()
+	asset.SetGlobalResolver(stubTenantResolver{"04A27083": {TenantID: "tenant-x"}})
+	defer asset.SetGlobalResolver(previous)
+	network.SetCommandOutcomeObserver(func(result network.CommandResult) {
+		tenant := ""
+		if info, ok := asset.Lookup(result.DeviceID); ok {
+			tenant = info.TenantID
+		}
+		tracker.Record(tenant, sla.Class(result.Outcome))
+	})
+	defer network.SetCommandOutcomeObserver(nil)
+
+	cm := network.GetCommandManager()
+	conn := &disconnectTestConn{id: 1708002}
+	cm.RegisterCommand(conn, 0x04A27083, 0x0401, 0x82, []byte{0x01})
+	cm.ConfirmCommand(0x04A27083, 0x0401, 0x82)
+	cm.RegisterCommand(conn, 0x04A27083, 0x0402, 0x83, []byte{0x01})
+	cm.FailConnectionCommands(conn.id, "test")
+
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/tenants/tenant-y/sla", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("无统计的租户应返回404: %d", w.Code)
+	}
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/tenants/tenant-x/sla", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("查询失败: %d %s", w.Code, w.Body.String())
+	}
+	var snapshot sla.TenantSLA
+	raw, _ := json.Marshal(resp.Data)
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.TenantID != "tenant-x" || len(snapshot.Windows) != 3 {
+		t.Fatalf("快照错误: %+v", snapshot)
+	}
+	day := slaWindow(t, snapshot, sla.Window24h)
+	if day.Total != 2 || day.Success != 1 || day.SuccessRate != 100 || day.Breakdown[sla.ClassDeviceOffline].Count != 1 {
+		t.Fatalf("断线失败不应扣减SLA成功率: %+v", day)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/replica"
+	"github.com/bujia-iot/iot-zinx/pkg/standby"
+	"github.com/gin-gonic/gin"
+)
+
+// takeoverFakeInstance 热备测试中的实例桩：记录接入开关、导入与关闭的连接
+type takeoverFakeInstance struct {
+	mu        sync.Mutex
+	accepting bool
+	conns     []uint64
+	closed    []uint64
+	imported  []gateway.HandoverState
+	restored  []gateway.HandoverDevice
+	stopCount atomic.Int32
+}
+
+func (f *takeoverFakeInstance) hooks(state gateway.HandoverState) standby.Hooks {
+	return standby.Hooks{
+		Export: func() gateway.HandoverState { return state },
+		Import: func(s gateway.HandoverState) (int, int) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.imported = append(f.imported, s)
+			return len(s.Orders), len(s.Deferred)
+		},
+		Restore: func(prior gateway.HandoverDevice) bool {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.restored = append(f.restored, prior)
+			return true
+		},
+		StopAccepting: func() {
+			f.stopCount.Add(1)
+			f.mu.Lock()
+			f.accepting = false
+			f.mu.Unlock()
+		},
+		ResumeAccepting: func() {
+			f.mu.Lock()
+			f.accepting = true
+			f.mu.Unlock()
+		},
+		Connections: func() []uint64 {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return append([]uint64(nil), f.conns...)
+		},
+		CloseConnection: func(connID uint64) bool {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.closed = append(f.closed, connID)
+			return true
+		},
+	}
+}
+
+func (f *takeoverFakeInstance) snapshot() (accepting bool, closed, imported, restored int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accepting, len(f.closed), len(f.imported), len(f.restored)
+}
+
+func waitHandover(t *testing.T, c *standby.Controller, cond func(h *standby.Handover) bool) standby.Handover {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if h := c.Status().Handover; h != nil && cond(h) {
+			return *h
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatalf("接管未在时限内到达预期状态: %+v", c.Status().Handover)
+	return standby.Handover{}
+}
+
+// TestStandbyTakeover 热备应用主实例复制的交接状态；演练执行全部阶段但不关闭连接并恢复原状；
+// 正式接管分批关闭连接、热备导入订单与延迟命令并恢复接入，交接设备重新注册时延续统计并计入每分钟重新注册数；
+// 关闭阶段中止后主实例恢复接入、热备退回待命；管理接口按角色返回503/409
+func TestStandbyTakeover(t *testing.T) {
+	state := gateway.HandoverState{
+		Devices: []gateway.HandoverDevice{
+			{DeviceID: "04A26CF3", ICCID: "898604D9162390488297", HeartbeatCount: 120},
+			{DeviceID: "04A2715A", ICCID: "898604D9162390488297", HeartbeatCount: 80},
+			{DeviceID: "04A228CD", ICCID: "898604D9162390488298", HeartbeatCount: 40},
+		},
+		Orders:   []gateway.OrderState{{OrderNo: "ORD1698", DeviceID: "04A26CF3", Port: 1, Status: gateway.OrderStatusCharging}},
+		Deferred: []gateway.DeferredCommand{{ID: "def-1", DeviceID: "04A228CD"}},
+	}
+	newPair := func(batchInterval time.Duration) (*standby.Controller, *standby.Controller, *takeoverFakeInstance, *takeoverFakeInstance) {
+		store := replica.NewMemoryStore()
+		opts := standby.Options{
+			Store:              store,
+			PublishInterval:    5 * time.Millisecond,
+			PollInterval:       2 * time.Millisecond,
+			SyncTimeout:        2 * time.Second,
+			ActivateTimeout:    2 * time.Second,
+			CloseBatchSize:     2,
+			CloseBatchInterval: batchInterval,
+		}
+		primaryInst := &takeoverFakeInstance{accepting: true, conns: []uint64{11, 12, 13, 14, 15}}
+		standbyInst := &takeoverFakeInstance{}
+		opts.InstanceID, opts.Role = "gw-a", standby.RolePrimary
+		primary, err := standby.New(opts, primaryInst.hooks(state))
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.InstanceID, opts.Role = "gw-b", standby.RoleStandby
+		sb, err := standby.New(opts, standbyInst.hooks(gateway.HandoverState{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return primary, sb, primaryInst, standbyInst
+	}
+
+	// 复制：热备应用主实例发布的交接状态
+	primary, sb, primaryInst, standbyInst := newPair(time.Millisecond)
+	seq, err := primary.Publish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if s := sb.Status(); s.AppliedSeq != seq || s.ReplicatedDevices != 3 || s.Active || s.Peer == nil || s.Peer.InstanceID != "gw-a" {
+		t.Fatalf("热备应复制主实例交接状态: %+v", s)
+	}
+	if _, err := sb.BeginTakeover(false); err != standby.ErrNotPrimary {
+		t.Fatalf("热备实例不能发起接管: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary.Start(ctx)
+	sb.Start(ctx)
+	defer primary.Stop()
+	defer sb.Stop()
+
+	// 演练：不关闭连接，完成后主实例恢复接入，热备未激活
+	if _, err := primary.BeginTakeover(true); err != nil {
+		t.Fatal(err)
+	}
+	h := waitHandover(t, primary, func(h *standby.Handover) bool { return h.Phase.Terminal() })
+	if h.Phase != standby.PhaseCompleted || !h.Rehearsal || h.Standby != "gw-b" || h.Connections != 5 || h.Batches != 3 || h.Closed != 0 {
+		t.Fatalf("演练结果错误: %+v", h)
+	}
+	if len(h.Phases) != 4 || h.Phases[0].Phase != standby.PhaseSyncing || h.Phases[3].Phase != standby.PhaseClosing {
+		t.Fatalf("演练应经历全部阶段: %+v", h.Phases)
+	}
+	if accepting, closed, _, _ := primaryInst.snapshot(); !accepting || closed != 0 || primaryInst.stopCount.Load() != 1 {
+		t.Fatalf("演练后主实例应恢复接入且未关闭连接: accepting=%v closed=%d", accepting, closed)
+	}
+	if _, _, imported, _ := standbyInst.snapshot(); imported != 0 || sb.Status().Active {
+		t.Fatalf("演练不应激活热备: imported=%d", imported)
+	}
+
+	// 正式接管：分批关闭连接，热备导入交接状态并接入设备
+	if _, err := primary.BeginTakeover(false); err != nil {
+		t.Fatal(err)
+	}
+	h = waitHandover(t, primary, func(h *standby.Handover) bool { return h.Phase.Terminal() })
+	if h.Phase != standby.PhaseCompleted || h.Rehearsal || h.Closed != 5 || h.Batches != 3 || h.Devices != 3 || h.Orders != 1 || h.Deferred != 1 {
+		t.Fatalf("正式接管结果错误: %+v", h)
+	}
+	if accepting, closed, _, _ := primaryInst.snapshot(); accepting || closed != 5 {
+		t.Fatalf("正式接管后主实例应保持停止接入: accepting=%v closed=%d", accepting, closed)
+	}
+	accepting, _, imported, _ := standbyInst.snapshot()
+	if !accepting || imported != 1 || !sb.Status().Active {
+		t.Fatalf("热备应激活并恢复接入: accepting=%v imported=%d", accepting, imported)
+	}
+
+	// 交接设备重新注册：延续统计、计入每分钟重新注册数；非交接设备不计
+	sb.OnDeviceRegistered("04A26CF3")
+	sb.OnDeviceRegistered("04A2715A")
+	sb.OnDeviceRegistered("04A26CF3")
+	sb.OnDeviceRegistered("04A99999")
+	s := sb.Status()
+	if s.ReRegistered != 2 || s.ReRegisteredPerMin != 2 || s.PendingReRegister != 1 {
+		t.Fatalf("重新注册统计错误: %+v", s)
+	}
+	if _, _, _, restored := standbyInst.snapshot(); restored != 2 || standbyInst.restored[0].HeartbeatCount != 120 {
+		t.Fatalf("应以交接前统计恢复设备: %+v", standbyInst.restored)
+	}
+	var metrics strings.Builder
+	primary.WritePrometheus(&metrics)
+	sb.WritePrometheus(&metrics)
+	for _, want := range []string{"iot_handover_duration_seconds{phase=\"completed\",rehearsal=\"false\"}", "iot_handover_total{result=\"completed\"} 2", "iot_standby_reregistered_devices_per_minute 2"} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Fatalf("指标缺少 %s:\n%s", want, metrics.String())
+		}
+	}
+
+	// 关闭阶段中止：主实例恢复接入，热备退回待命并停止接入
+	primary2, sb2, primaryInst2, standbyInst2 := newPair(time.Hour)
+	primary2.Start(ctx)
+	sb2.Start(ctx)
+	defer primary2.Stop()
+	defer sb2.Stop()
+	if _, err := primary2.BeginTakeover(false); err != nil {
+		t.Fatal(err)
+	}
+	waitHandover(t, primary2, func(h *standby.Handover) bool { return h.Phase == standby.PhaseClosing && h.Batches == 1 })
+	if _, err := primary2.BeginTakeover(false); err != standby.ErrHandoverRunning {
+		t.Fatalf("进行中的接管不能重复发起: %v", err)
+	}
+	h, err = primary2.Abort()
+	if err != nil || h.Phase != standby.PhaseAborted || h.Closed != 2 {
+		t.Fatalf("中止结果错误: %v %+v", err, h)
+	}
+	if accepting, _, _, _ := primaryInst2.snapshot(); !accepting {
+		t.Fatal("中止后主实例应恢复接入")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sb2.Status().Active && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	if accepting, _, _, _ := standbyInst2.snapshot(); sb2.Status().Active || accepting {
+		t.Fatalf("中止后热备应退回待命: %+v", sb2.Status())
+	}
+	if _, err := primary2.Abort(); err != standby.ErrNoHandover {
+		t.Fatalf("无进行中的接管时中止应报错: %v", err)
+	}
+
+	// 管理接口
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	standby.SetGlobalController(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/takeover", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用热备应返回503: %d", w.Code)
+	}
+	standby.SetGlobalController(sb)
+	defer standby.SetGlobalController(nil)
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/takeover", `{"rehearsal":true}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("热备实例发起接管应返回503: %d", w.Code)
+	}
+	standby.SetGlobalController(primary)
+	w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/takeover", "")
+	if handover, _ := resp.Data["handover"].(map[string]interface{}); w.Code != http.StatusOK || resp.Data["role"] != standby.RolePrimary || handover["phase"] != string(standby.PhaseCompleted) {
+		t.Fatalf("接管状态查询错误: %d %v", w.Code, resp.Data)
+	}
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/takeover/abort", ""); w.Code != http.StatusConflict {
+		t.Fatalf("无进行中的接管时中止应返回409: %d", w.Code)
+	}
+}
+
+// TestHandoverStateRoundTrip 网关导出的交接状态在另一实例导入：进行中订单与延迟命令恢复，重复导入不产生重复项
+func TestHandoverStateRoundTrip(t *testing.T) {
+	src := gateway.NewDeviceGateway()
+	if err := src.GetOrderManager().CreateOrder("04A26CF3", 1, "ORD-HANDOVER-1", 0, 60, 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.GetDeferredQueue().Enqueue(gateway.DeferredRequest{
+		DeviceID: "04A228CD",
+		Kind:     gateway.DeferredKindReboot,
+		Params:   gateway.DeferredRebootParams{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	state := src.ExportHandoverState()
+	if len(state.Orders) != 1 || len(state.Deferred) != 1 {
+		t.Fatalf("导出的交接状态不完整: %+v", state)
+	}
+
+	dst := gateway.NewDeviceGateway()
+	orders, deferred := dst.ImportHandoverState(state)
+	if orders != 1 || deferred != 1 {
+		t.Fatalf("导入数错误: orders=%d deferred=%d", orders, deferred)
+	}
+	if order := dst.GetOrderManager().GetOrder("04A26CF3", 1); order == nil || order.OrderNo != "ORD-HANDOVER-1" {
+		t.Fatalf("订单应恢复: %+v", order)
+	}
+	if pending, _ := dst.GetDeferredQueue().List("04A228CD"); len(pending) != 1 || pending[0].ID != state.Deferred[0].ID {
+		t.Fatalf("延迟命令应恢复: %+v", pending)
+	}
+	if orders, deferred := dst.ImportHandoverState(state); orders != 0 || deferred != 0 {
+		t.Fatalf("重复导入不应产生重复项: orders=%d deferred=%d", orders, deferred)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/events"
+	"github.com/bujia-iot/iot-zinx/pkg/network"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump"
+	"github.com/bujia-iot/iot-zinx/pkg/statedump/capture"
+	"github.com/gin-gonic/gin"
+)
+
+// TestStateDump 状态转储：归档分段、设备时间线、差异比较、大小上限与保留策略
+func TestStateDump(t *testing.T) {
+	conn := registerSharedGroup(t, 73001, "89860000000000073001", []string{"04A27301"})
+	network.GetCommandManager().RegisterCommand(conn, 0x04A27301, 0x0731, 0x82, []byte{0x01})
+	events.GetGlobalBus().Publish(events.TopicDevice, "device_online", "04A27301", map[string]interface{}{"reason": "test"})
+
+	dir := t.TempDir()
+	dumper := statedump.New(statedump.Options{Dir: dir}, capture.Sections(100))
+	first, err := dumper.Dump("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Bytes <= 0 || len(first.Manifest.Sections) != 8 {
+		t.Fatalf("转储结果错误: %+v", first)
+	}
+	for _, s := range first.Manifest.Sections {
+		if s.Error != "" || s.Bytes == 0 {
+			t.Fatalf("分段 %s 采集失败: %+v", s.Name, s)
+		}
+	}
+
+	archive, err := statedump.Open(first.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, err := archive.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range devices {
+		found = found || d.DeviceID == "04A27301"
+	}
+	if !found {
+		t.Fatalf("归档应包含在线设备: %+v", devices)
+	}
+	sources := map[string]bool{}
+	for _, e := range archive.Timeline("04A27301") {
+		sources[e.Source] = true
+	}
+	if !sources[statedump.TimelineSourceSession] || !sources[statedump.TimelineSourceCommand] || !sources[statedump.TimelineSourceEvent] {
+		t.Fatalf("设备时间线应合并会话、命令与事件: %v", sources)
+	}
+	if heap, ok := archive.File(statedump.SectionHeap); !ok || len(heap) == 0 {
+		t.Fatal("归档应包含heap剖析")
+	}
+
+	registerSharedGroup(t, 73002, "89860000000000073002", []string{"04A27302"})
+	second, err := dumper.Dump("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := statedump.Open(second.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := statedump.Diff(archive, later)
+	added := false
+	for _, id := range diff.DevicesAdded {
+		added = added || id == "04A27302"
+	}
+	if !added || len(diff.Stats) == 0 {
+		t.Fatalf("差异应包含新上线设备与统计变化: %+v", diff)
+	}
+
+	t.Run("超出大小上限跳过剩余分段", func(t *testing.T) {
+		small := statedump.New(statedump.Options{Dir: t.TempDir(), MaxBytes: 1}, capture.Sections(100))
+		result, err := small.Dump("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		skipped := 0
+		for _, s := range result.Manifest.Sections {
+			if s.Skipped {
+				skipped++
+			}
+		}
+		if !result.Manifest.Truncated || skipped != len(result.Manifest.Sections)-1 {
+			t.Fatalf("首个分段之后应全部跳过: %+v", result.Manifest)
+		}
+		if _, err := statedump.Open(result.Path); err != nil {
+			t.Fatalf("截断的归档仍应可读取: %v", err)
+		}
+	})
+
+	t.Run("按数量清理旧归档", func(t *testing.T) {
+		retained := statedump.New(statedump.Options{Dir: t.TempDir(), MaxDumps: 2}, nil)
+		var last *statedump.Result
+		for i := 0; i < 3; i++ {
+			if last, err = retained.Dump("test"); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		dumps, _ := statedump.List(retained.Options().Dir)
+		if len(dumps) != 2 || len(last.Removed) != 1 || dumps[0].Name != last.Manifest.CreatedAt.Format("statedump-20060102-150405.000.tar.gz") {
+			t.Fatalf("应保留最新2个归档: %+v removed=%v", dumps, last.Removed)
+		}
+	})
+
+	t.Run("同一时刻只执行一次转储", func(t *testing.T) {
+		release := make(chan struct{})
+		started := make(chan struct{})
+		blocking := statedump.New(statedump.Options{Dir: t.TempDir()}, []statedump.Section{{
+			Name: "slow", File: "slow.json",
+			Capture: func() (interface{}, error) { close(started); <-release; return "ok", nil },
+		}})
+		done := make(chan error, 1)
+		go func() { _, err := blocking.Dump("test"); done <- err }()
+		<-started
+		if _, err := blocking.Dump("test"); !errors.Is(err, statedump.ErrDumpRunning) {
+			t.Fatalf("应返回正在转储: %v", err)
+		}
+		close(release)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// TestRedactedConfig 配置中的密码、密钥与令牌字段在归档中脱敏
+func TestRedactedConfig(t *testing.T) {
+	cfg := map[string]interface{}{
+		"redis":  map[string]interface{}{"address": "127.0.0.1:6379", "password": "p@ss"},
+		"hooks":  []interface{}{map[string]interface{}{"source": "ops", "secret": "s3"}},
+		"access": map[string]interface{}{"authToken": "", "keyHeader": "X-API-Key-Name"},
+	}
+	redacted, err := statedump.RedactedConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis := redacted["redis"].(map[string]interface{})
+	hook := redacted["hooks"].([]interface{})[0].(map[string]interface{})
+	access := redacted["access"].(map[string]interface{})
+	if redis["password"] != "***" || redis["address"] != "127.0.0.1:6379" || hook["secret"] != "***" {
+		t.Fatalf("敏感字段应脱敏: %v", redacted)
+	}
+	if access["authToken"] != "" || access["keyHeader"] != "X-API-Key-Name" {
+		t.Fatalf("空值与非敏感字段应保留: %v", access)
+	}
+}
+
+// TestStateDumpAPI POST /api/v1/admin/state-dump 写入归档并返回各分段耗时
+func TestStateDumpAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	statedump.SetGlobalDumper(statedump.New(statedump.Options{Dir: t.TempDir()}, capture.Sections(10)))
+	defer statedump.SetGlobalDumper(nil)
+
+	w, resp := callAPI(r, http.MethodPost, "/api/v1/admin/state-dump", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("转储应返回200: %d %s", w.Code, w.Body.String())
+	}
+	path, _ := resp.Data["path"].(string)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("归档应已写入: %v", err)
+	}
+	manifest, _ := resp.Data["manifest"].(map[string]interface{})
+	if sections, _ := manifest["sections"].([]interface{}); len(sections) != 8 {
+		t.Fatalf("应返回各分段耗时: %v", manifest)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apihttp "github.com/bujia-iot/iot-zinx/internal/adapter/http"
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// stationMapping 可变的设备 → 站点映射（模拟映射重新加载）
+type stationMapping map[string]string
+
+func (m stationMapping) lookup(deviceID string) (asset.AssetInfo, bool) {
+	stationID, ok := m[deviceID]
+	return asset.AssetInfo{StationID: stationID}, ok
+}
+
+// TestStationAggregation 站点聚合：增量汇总、离线降级、映射重新加载后迁移、HTTP与指标导出
+func TestStationAggregation(t *testing.T) {
+	now := time.Now()
+	mapping := stationMapping{"04A26CF3": "ST-A", "04A26CF4": "ST-A", "04A26CF5": "ST-B"}
+	agg := gateway.NewStationAggregator(config.StationsConfig{DegradedOfflineFraction: 0.5})
+	agg.SetLookup(mapping.lookup)
+
+	agg.OnDeviceOnline("04A26CF3", now)
+	agg.OnPortStatuses("04A26CF3", []uint8{0x01, 0x00, 0x07}, now)
+	agg.OnPortPower("04A26CF3", 1, 0x01, 150.5, now)
+	agg.OnDeviceOnline("04A26CF4", now)
+	agg.OnPortStatuses("04A26CF4", []uint8{0x00, 0x00}, now)
+	agg.OnDeviceOffline("04A26CF4", now)
+	agg.OnDeviceOnline("04A26CF5", now)
+	agg.OnDeviceOffline("04A26CF5", now)
+	agg.OnDeviceOnline("04FFFFFF", now) // 未映射站点
+
+	t.Run("增量汇总与降级判定", func(t *testing.T) {
+		stations := agg.ListStations()
+		if len(stations) != 2 || stations[0].StationID != "ST-A" || stations[1].StationID != "ST-B" {
+			t.Fatalf("站点列表错误: %+v", stations)
+		}
+		a := stations[0]
+		if a.DeviceCount != 2 || a.OnlineCount != 1 || a.TotalPorts != 5 || a.PortsCharging != 1 || a.PortsIdle != 1 || a.PortsFaulted != 1 || a.PowerW != 150.5 {
+			t.Fatalf("站点A汇总错误: %+v", a)
+		}
+		if a.Degraded {
+			t.Fatal("离线占比未超过阈值不应降级")
+		}
+		if !stations[1].Degraded || stations[1].OfflineFraction != 1 {
+			t.Fatalf("全部离线的站点应降级: %+v", stations[1])
+		}
+		if agg.UnassignedDevices() != 1 {
+			t.Fatal("未映射设备应单独计数")
+		}
+
+		// 端口停止充电后功率归零
+		agg.OnPortPower("04A26CF3", 1, 0x03, 0, now)
+		if a, _ := agg.GetStation("ST-A"); a.PowerW != 0 || a.PortsCharging != 0 || a.PortsIdle != 2 {
+			t.Fatalf("停止充电后汇总错误: %+v", a.StationSummary)
+		}
+	})
+
+	t.Run("映射重新加载后设备迁移站点", func(t *testing.T) {
+		mapping["04A26CF4"] = "ST-B"
+		if moved := agg.Remap(); moved != 1 {
+			t.Fatalf("应迁移1台设备: %d", moved)
+		}
+		a, _ := agg.GetStation("ST-A")
+		b, _ := agg.GetStation("ST-B")
+		if a.DeviceCount != 1 || a.OfflineCount != 0 || len(a.Devices) != 1 {
+			t.Fatalf("迁出后站点A错误: %+v", a)
+		}
+		if b.DeviceCount != 2 || b.TotalPorts != 2 || len(b.Devices) != 2 || b.Devices[0].DeviceID != "04A26CF4" {
+			t.Fatalf("迁入后站点B错误: %+v", b)
+		}
+
+		delete(mapping, "04A26CF5")
+		agg.Remap()
+		if b, _ := agg.GetStation("ST-B"); b.DeviceCount != 1 {
+			t.Fatalf("移出映射的设备不应再计入站点: %+v", b.StationSummary)
+		}
+	})
+
+	t.Run("HTTP接口与指标导出", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		global := gateway.GetGlobalDeviceGateway().GetStationAggregator()
+		global.SetLookup(stationMapping{"04B00001": "ST-\"X\""}.lookup)
+		defer global.SetLookup(asset.Lookup)
+		global.OnDeviceOnline("04B00001", now)
+		global.OnPortPower("04B00001", 2, 0x01, 300, now)
+		defer global.OnDeviceOffline("04B00001", now)
+
+		h := apihttp.NewStationHandlers()
+		r := gin.New()
+		r.GET("/metrics", h.HandleMetrics)
+		r.GET("/api/v1/stations", h.HandleListStations)
+		r.GET("/api/v1/stations/:stationId", h.HandleStationDetail)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stations", nil))
+		var list struct {
+			Data struct {
+				Stations []gateway.StationSummary `json:"stations"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &list)
+		if w.Code != http.StatusOK || len(list.Data.Stations) != 1 || list.Data.Stations[0].PowerW != 300 {
+			t.Fatalf("站点列表接口错误: %d %s", w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stations/ST-NONE", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("未知站点应返回404: %d", w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := w.Body.String()
+		if !strings.Contains(body, `iot_station_power_watts{station="ST-\"X\""} 300`) || !strings.Contains(body, "# TYPE iot_station_degraded gauge") {
+			t.Fatalf("指标导出错误:\n%s", body)
+		}
+	})
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/config"
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/asset"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// recordingPowerApplier 记录下发的端口上限，不实际发送0x82
+type recordingPowerApplier struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (a *recordingPowerApplier) ApplyPowerLimit(deviceID string, port int, _ string, limitW int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls[fmt.Sprintf("%s|%d", deviceID, port)] = limitW
+	return nil
+}
+
+func (a *recordingPowerApplier) take() map[string]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	calls := a.calls
+	a.calls = make(map[string]int)
+	return calls
+}
+
+// TestPowerBudgetMath 爬坡步进、注水分配与时段匹配
+func TestPowerBudgetMath(t *testing.T) {
+	for _, c := range []struct{ current, target, step, want int }{
+		{6000, 2000, 1000, 5000},
+		{2500, 2000, 1000, 2000}, // 差值不超过一步直接到达
+		{2000, 6000, 1500, 3500},
+		{6000, 2000, 0, 2000}, // 不爬坡
+		{3000, 3000, 500, 3000},
+	} {
+		if got := gateway.RampBudget(c.current, c.target, c.step); got != c.want {
+			t.Fatalf("RampBudget(%d,%d,%d)=%d，期望%d", c.current, c.target, c.step, got, c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		budget, minW int
+		caps, want   []int
+	}{
+		{3000, 80, []int{0, 0, 0}, []int{1000, 1000, 1000}},
+		{3000, 80, []int{0, 300, 0, 0}, []int{900, 300, 900, 900}}, // 自身上限低的会话余量由其余会话均分
+		{1000, 80, []int{2000, 0}, []int{500, 500}},                // 自身上限高于均分值时不提高
+		{100, 80, []int{0, 0, 0}, []int{80, 80, 80}},               // 不低于最低功率
+		{200000, 80, []int{0, 0}, []int{0xFFFF, 0xFFFF}},           // 不超过过载功率字段范围
+		{2000, 80, []int{60, 0}, []int{60, 1940}},                  // 自身上限低于最低功率时取自身上限
+		{0, 80, nil, []int{}},
+	} {
+		got := gateway.SplitPowerBudget(c.budget, c.caps, c.minW)
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Fatalf("SplitPowerBudget(%d,%v)=%v，期望%v", c.budget, c.caps, got, c.want)
+		}
+	}
+
+	day := gateway.PowerWindow{Start: "08:00", End: "12:00"}
+	night := gateway.PowerWindow{Start: "22:00", End: "06:00"}
+	allDay := gateway.PowerWindow{Start: "00:00", End: "00:00"}
+	for _, c := range []struct {
+		w          gateway.PowerWindow
+		hour, min  int
+		wantInside bool
+	}{
+		{day, 7, 59, false}, {day, 8, 0, true}, {day, 11, 59, true}, {day, 12, 0, false},
+		{night, 21, 59, false}, {night, 22, 0, true}, {night, 3, 0, true}, {night, 6, 0, false},
+		{allDay, 15, 30, true},
+	} {
+		if got := c.w.Contains(time.Date(2030, 1, 7, c.hour, c.min, 0, 0, time.Local)); got != c.wantInside {
+			t.Fatalf("%s-%s 在 %02d:%02d 应为%v", c.w.Start, c.w.End, c.hour, c.min, c.wantInside)
+		}
+	}
+}
+
+// TestStationPowerProfiles 站点功率时段：时段切换按步长爬坡并在站点会话间重新分配；人工覆盖优先且到期恢复；
+// 新会话按接入后的分配上限开始充电，降功率接入会话的上限与智能降功率下调不被预算提高
+func TestStationPowerProfiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shortConfirmTimeout(t)
+	const station = "ST-1700"
+	const dev1, dev2 = "04B17001", "04B17002"
+	conn := registerSharedGroup(t, 1700001, "89860400000017000001", []string{dev1, dev2})
+	g := gateway.GetGlobalDeviceGateway()
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	aggregator := g.GetStationAggregator()
+	aggregator.SetLookup(stationMapping{dev1: station, dev2: station}.lookup)
+	defer aggregator.SetLookup(asset.Lookup)
+	for _, dev := range []string{dev1, dev2} {
+		aggregator.OnDeviceOnline(dev, time.Now())
+		defer aggregator.OnDeviceOffline(dev, time.Now())
+	}
+
+	dpc := gateway.GetDynamicPowerController()
+	applier := &recordingPowerApplier{calls: make(map[string]int)}
+	dpc.SetPowerLimitApplier(applier)
+	defer dpc.SetPowerLimitApplier(nil)
+	defer dpc.SetEnabled(config.GetConfig().SmartCharging.Enabled)
+
+	// 独立调度器：定时评估使用真实时间，时段切换用固定日期驱动
+	scheduler := gateway.NewPowerProfileScheduler(config.PowerProfilesConfig{}, dpc)
+	at := func(hour, min int) time.Time { return time.Date(2030, 1, 7, hour, min, 0, 0, time.Local) }
+	if _, err := scheduler.SetProfile(gateway.PowerProfile{
+		StationID: station,
+		CapacityW: 6000,
+		Windows:   []gateway.PowerWindow{{Start: "08:00", End: "12:00", BudgetW: 2000}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.DeleteProfile(station)
+
+	limits := func() map[string]int {
+		_, ports, _ := dpc.StationBudget(station)
+		got := make(map[string]int)
+		for _, p := range ports {
+			if !p.Applied {
+				t.Fatalf("端口上限应已下发: %+v", p)
+			}
+			got[fmt.Sprintf("%s|%d", p.DeviceID, p.Port)] = p.LimitW
+		}
+		return got
+	}
+	expectLimits := func(step string, want map[string]int) {
+		t.Helper()
+		if got := limits(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%s: 端口分配 %v，期望 %v", step, got, want)
+		}
+	}
+	startCharging := func(deviceID string, port int) uint16 {
+		t.Helper()
+		w, resp := callAPI(r, http.MethodPost, "/api/v1/charging/start", fmt.Sprintf(`{"deviceId":"%s","port":%d,"mode":0,"value":60,"balance":1000,"orderNo":"ORD1700%s%d"}`, deviceID, port, deviceID[6:], port))
+		if w.Code != http.StatusOK {
+			t.Fatalf("开始充电失败: %d %v", w.Code, resp)
+		}
+		frames := waitFrames(t, conn, 1, nil)
+		_, _, _, payload := frameHeader(frames[len(frames)-1])
+		return binary.LittleEndian.Uint16(payload[27:29])
+	}
+	defer func() {
+		for _, dev := range []string{dev1, dev2} {
+			for port := 1; port <= 2; port++ {
+				g.FinalizeChargingSession(dev, port, fmt.Sprintf("ORD1700%s%d", dev[6:], port), "测试结束")
+			}
+		}
+	}()
+
+	scheduler.Tick(at(7, 0))
+	if s, _ := scheduler.Status(station, at(7, 0)); s.Source != gateway.PowerBudgetSourceCapacity || s.CurrentW != 6000 || s.Ramping {
+		t.Fatalf("时段外应取供电容量: %+v", s)
+	}
+
+	t.Run("新会话按接入后的分配上限开始充电", func(t *testing.T) {
+		if w := startCharging(dev1, 1); w != 6000 {
+			t.Fatalf("第一个会话应分得全部预算: %d", w)
+		}
+		if calls := applier.take(); len(calls) != 0 {
+			t.Fatalf("开始充电帧已携带上限，不应再次下发: %v", calls)
+		}
+		if w := startCharging(dev1, 2); w != 3000 {
+			t.Fatalf("第二个会话应分得一半预算: %d", w)
+		}
+		if calls := applier.take(); fmt.Sprint(calls) != fmt.Sprint(map[string]int{dev1 + "|1": 3000}) {
+			t.Fatalf("已有会话应下调: %v", calls)
+		}
+	})
+
+	t.Run("进入时段按步长爬坡", func(t *testing.T) {
+		scheduler.SetRamp(1000, 0)
+		scheduler.Tick(at(8, 0))
+		s, _ := scheduler.Status(station, at(8, 0))
+		if s.Source != gateway.PowerBudgetSourceWindow || s.ActiveWindow == nil || s.ActiveWindow.Start != "08:00" || s.TargetW != 2000 || s.CurrentW != 5000 || !s.Ramping {
+			t.Fatalf("进入时段第一步应为5000: %+v", s)
+		}
+		expectLimits("第一步", map[string]int{dev1 + "|1": 2500, dev1 + "|2": 2500})
+		for _, minute := range []int{1, 2, 3} {
+			scheduler.Tick(at(8, minute))
+		}
+		if s, _ := scheduler.Status(station, at(8, 3)); s.CurrentW != 2000 || s.Ramping {
+			t.Fatalf("三步后应到达时段预算: %+v", s)
+		}
+		expectLimits("到达目标", map[string]int{dev1 + "|1": 1000, dev1 + "|2": 1000})
+		applier.take()
+		scheduler.Tick(at(8, 4))
+		if calls := applier.take(); len(calls) != 0 {
+			t.Fatalf("分配不变时不应重复下发: %v", calls)
+		}
+
+		scheduler.Tick(at(12, 0))
+		if s, _ := scheduler.Status(station, at(12, 0)); s.Source != gateway.PowerBudgetSourceCapacity || s.CurrentW != 3000 {
+			t.Fatalf("离开时段应向供电容量爬坡: %+v", s)
+		}
+		expectLimits("离开时段", map[string]int{dev1 + "|1": 1500, dev1 + "|2": 1500})
+	})
+
+	t.Run("人工覆盖优先并参与会话接入", func(t *testing.T) {
+		if _, err := scheduler.SetOverride(gateway.PowerOverride{StationID: "ST-NONE", BudgetW: 1000, ExpiresAt: at(13, 0)}); err != gateway.ErrPowerProfileNotFound {
+			t.Fatalf("未配置时段的站点不能覆盖: %v", err)
+		}
+		if _, err := scheduler.SetOverride(gateway.PowerOverride{StationID: station, BudgetW: 2400, Reason: "变压器检修", ExpiresAt: at(13, 0)}); err != nil {
+			t.Fatal(err)
+		}
+		scheduler.Tick(at(12, 10))
+		s, _ := scheduler.Status(station, at(12, 10))
+		if s.Source != gateway.PowerBudgetSourceOverride || s.Override == nil || s.CurrentW != 2400 {
+			t.Fatalf("覆盖应优先于时段: %+v", s)
+		}
+		expectLimits("覆盖", map[string]int{dev1 + "|1": 1200, dev1 + "|2": 1200})
+
+		if w := startCharging(dev2, 1); w != 800 {
+			t.Fatalf("第三个会话应分得800W: %d", w)
+		}
+		expectLimits("第三个会话", map[string]int{dev1 + "|1": 800, dev1 + "|2": 800, dev2 + "|1": 800})
+
+		// 设备并发上限：超出满功率名额以300W降功率接入，预算分配不提高其上限
+		limiter := g.GetSessionLimiter()
+		if _, err := limiter.Set(gateway.SessionLimit{DeviceID: dev2, MaxConcurrent: 1, ReducedPowerSlots: 1, ReducedPowerW: 300}); err != nil {
+			t.Fatal(err)
+		}
+		defer limiter.Delete(dev2)
+		dpc.SetEnabled(true)
+		if w := startCharging(dev2, 2); w != 300 {
+			t.Fatalf("降功率接入会话应取自身上限: %d", w)
+		}
+		if order := g.GetOrderManager().GetOrder(dev2, 2); order == nil || order.OverloadPowerW != 300 {
+			t.Fatalf("降功率接入应记录过载功率: %+v", order)
+		}
+		expectLimits("降功率接入", map[string]int{dev1 + "|1": 700, dev1 + "|2": 700, dev2 + "|1": 700, dev2 + "|2": 300})
+
+		// 智能降功率下调不超过预算分配的上限
+		applier.take()
+		dpc.OnPowerHeartbeat(dev1, 1, "ORD1700"+dev1[6:]+"1", 2000, true, time.Now())
+		if calls := applier.take(); calls[dev1+"|1"] != 700 {
+			t.Fatalf("智能降功率目标应受预算上限约束: %v", calls)
+		}
+	})
+
+	t.Run("覆盖到期与会话结束后重新分配", func(t *testing.T) {
+		scheduler.Tick(at(13, 0))
+		if s, _ := scheduler.Status(station, at(13, 0)); s.Source != gateway.PowerBudgetSourceCapacity || s.Override != nil || s.CurrentW != 3400 {
+			t.Fatalf("覆盖到期后应向供电容量爬坡: %+v", s)
+		}
+		if err := scheduler.ClearOverride(station); err != gateway.ErrPowerOverrideNotFound {
+			t.Fatalf("到期的覆盖应已清理: %v", err)
+		}
+
+		g.FinalizeChargingSession(dev1, 1, "ORD1700"+dev1[6:]+"1", "测试结束")
+		scheduler.Tick(at(13, 1))
+		expectLimits("会话结束", map[string]int{dev1 + "|2": 2050, dev2 + "|1": 2050, dev2 + "|2": 300})
+	})
+}
+
+// TestStationPowerProfileAPI 站点功率时段接口：设置、查询、人工覆盖与删除
+func TestStationPowerProfileAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+	const path = "/api/v1/stations/ST-1700-API/power-profile"
+	const overridePath = "/api/v1/stations/ST-1700-API/power-override"
+
+	if w, _ := callAPI(r, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("未配置时段应返回404: %d", w.Code)
+	}
+	if w, _ := callAPI(r, http.MethodPut, overridePath, `{"budgetW":1000,"durationMinutes":30}`); w.Code != http.StatusNotFound {
+		t.Fatalf("未配置时段的站点不能覆盖: %d", w.Code)
+	}
+	if w, _ := callAPI(r, http.MethodPut, path, `{"capacityW":6000,"windows":[{"start":"25:00","end":"06:00","budgetW":2000}]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效时段应返回400: %d", w.Code)
+	}
+	w, resp := callAPI(r, http.MethodPut, path, `{"name":"峰谷","capacityW":6000,"windows":[{"start":"00:00","end":"00:00","budgetW":4000}]}`)
+	if w.Code != http.StatusOK || resp.Data["source"] != gateway.PowerBudgetSourceWindow || resp.Data["targetW"] != float64(4000) || resp.Data["currentW"] != float64(4000) {
+		t.Fatalf("设置时段失败: %d %v", w.Code, resp.Data)
+	}
+
+	if w, _ := callAPI(r, http.MethodPut, overridePath, `{"budgetW":0,"durationMinutes":30}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效覆盖应返回400: %d", w.Code)
+	}
+	w, resp = callAPI(r, http.MethodPut, overridePath, `{"budgetW":1500,"durationMinutes":30,"reason":"检修"}`)
+	override, _ := resp.Data["override"].(map[string]interface{})
+	if w.Code != http.StatusOK || resp.Data["source"] != gateway.PowerBudgetSourceOverride || override["reason"] != "检修" || resp.Data["targetW"] != float64(1500) {
+		t.Fatalf("设置覆盖失败: %d %v", w.Code, resp.Data)
+	}
+	if w, resp := callAPI(r, http.MethodDelete, overridePath, ""); w.Code != http.StatusOK || resp.Data["source"] != gateway.PowerBudgetSourceWindow {
+		t.Fatalf("结束覆盖失败: %d %v", w.Code, resp.Data)
+	}
+	if w, _ := callAPI(r, http.MethodDelete, overridePath, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("重复结束覆盖应返回404: %d", w.Code)
+	}
+
+	if w, _ := callAPI(r, http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("删除时段失败: %d", w.Code)
+	}
+	if _, _, ok := gateway.GetDynamicPowerController().StationBudget("ST-1700-API"); ok {
+		t.Fatal("删除时段后应移除站点预算")
+	}
+	if w, _ := callAPI(r, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("删除后应返回404: %d", w.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/utils"
+)
+
+// TestRollingCounter 滑动窗口计数器测试
+func TestRollingCounter(t *testing.T) {
+	c := utils.NewRollingCounter(time.Hour)
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.Local)
+
+	c.AddAt(base, 2)
+	c.AddAt(base.Add(30*time.Minute), 3)
+	if got := c.Sum(base.Add(30 * time.Minute)); got != 5 {
+		t.Fatalf("窗口内计数错误: 期望 5, 实际 %d", got)
+	}
+	if got := c.Sum(base.Add(61 * time.Minute)); got != 3 {
+		t.Fatalf("过期桶应被排除: 期望 3, 实际 %d", got)
+	}
+	// 同一槽位复用时旧计数应被覆盖
+	c.AddAt(base.Add(2*time.Hour), 1)
+	if got := c.Sum(base.Add(2 * time.Hour)); got != 1 {
+		t.Fatalf("槽位复用错误: 期望 1, 实际 %d", got)
+	}
+}
+
+// TestFleetSummary 仪表盘汇总测试
+func TestFleetSummary(t *testing.T) {
+	g := gateway.NewDeviceGateway()
+	om := g.GetOrderManager()
+	if err := om.CreateOrder("04A26CF3", 1, "ORDER_SUMMARY_001", 0, 3600, 1000); err != nil {
+		t.Fatalf("创建订单失败: %v", err)
+	}
+	_ = om.UpdateOrderStatus("04A26CF3", 1, gateway.OrderStatusCharging, "充电命令发送成功")
+
+	s := g.GetFleetSummary(time.Now())
+	if s.Charging.ActiveSessions != 1 || s.Charging.StartsLastHour != 1 {
+		t.Fatalf("充电汇总错误: %+v", s.Charging)
+	}
+	for _, severity := range []string{gateway.AlarmSeverityCritical, gateway.AlarmSeverityHigh, gateway.AlarmSeverityWarning} {
+		if _, ok := s.Alarms[severity]; !ok {
+			t.Fatalf("告警级别 %s 应始终存在", severity)
+		}
+	}
+
+	om.CleanupOrder("04A26CF3", 1, "测试结束")
+	if s = g.GetFleetSummary(time.Now()); s.Charging.ActiveSessions != 0 || s.Charging.StopsLastHour != 1 {
+		t.Fatalf("结束后充电汇总错误: %+v", s.Charging)
+	}
+	if s.Version != gateway.GatewayVersion || s.UptimeSec < 0 {
+		t.Fatalf("运行信息错误: %+v", s)
+	}
+}
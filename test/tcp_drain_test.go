@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+)
+
+// drainTestConn 记录是否被关闭的模拟设备连接
+type drainTestConn struct {
+	disconnectTestConn
+	stopped atomic.Bool
+}
+
+func (c *drainTestConn) Stop() { c.stopped.Store(true) }
+
+// newDrainTestManager 独立的TCP管理器：groups 个设备组，每组 perGroup 台设备共享一个连接
+func newDrainTestManager(t *testing.T, groups, perGroup int) (*core.TCPManager, []*drainTestConn) {
+	t.Helper()
+	manager := core.NewTCPManager(nil)
+	conns := make([]*drainTestConn, 0, groups)
+	for g := 0; g < groups; g++ {
+		conn := &drainTestConn{disconnectTestConn: disconnectTestConn{id: uint64(1752000 + g)}}
+		if _, err := manager.RegisterConnection(conn); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+		iccid := fmt.Sprintf("898600000000017520%02d", g)
+		for d := 0; d < perGroup; d++ {
+			deviceID := fmt.Sprintf("05%02X%02X%02X", 0x52, g, d)
+			if err := manager.RegisterDevice(conn, deviceID, deviceID, iccid); err != nil {
+				t.Fatalf("注册设备失败: %v", err)
+			}
+		}
+		conns = append(conns, conn)
+	}
+	return manager, conns
+}
+
+// TestTCPManagerDrain 停机排空：拒绝新注册、逐组通知、宽限期内等待命令，到期关闭全部连接并汇总未应答命令；
+// ctx 取消（阶段时限到期）时跳过剩余通知
+func TestTCPManagerDrain(t *testing.T) {
+	quietLogger(t)
+
+	t.Run("宽限期到期关闭全部连接", func(t *testing.T) {
+		manager, conns := newDrainTestManager(t, 25, 2) // 50台模拟设备
+		var mu sync.Mutex
+		notified := map[string]string{}
+		const grace = 300 * time.Millisecond
+
+		begin := time.Now()
+		result := manager.Drain(context.Background(), core.DrainOptions{
+			GracePeriod: grace,
+			Pending:     func() int { return 3 },
+			Notify: func(_ context.Context, iccid, deviceID string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				notified[iccid] = deviceID
+				if iccid == "89860000000001752000" {
+					return errors.New("发送失败")
+				}
+				return nil
+			},
+		})
+		elapsed := time.Since(begin)
+
+		if elapsed < grace || elapsed > grace+time.Second {
+			t.Fatalf("应在宽限期结束后关闭连接，实际耗时 %s", elapsed)
+		}
+		if result.Groups != 25 || result.Notified != 24 || result.NotifyFailed != 1 || len(notified) != 25 {
+			t.Fatalf("停机通知结果错误: %+v", result)
+		}
+		if notified["89860000000001752001"] != "05520100" {
+			t.Fatalf("应通知设备组的主设备，实际 %s", notified["89860000000001752001"])
+		}
+		if result.PendingAtStart != 3 || result.PendingAtClose != 3 || result.Closed != 25 {
+			t.Fatalf("排空结果错误: %+v", result)
+		}
+		for _, conn := range conns {
+			if !conn.stopped.Load() {
+				t.Fatalf("连接 %d 未关闭", conn.id)
+			}
+			if _, ok := manager.GetSessionByConnID(conn.id); ok {
+				t.Fatalf("连接 %d 未清理", conn.id)
+			}
+		}
+		if _, ok := manager.GetSessionByDeviceID("05520000"); ok {
+			t.Fatal("设备应随连接清理")
+		}
+
+		if !manager.IsDraining() {
+			t.Fatal("排空后应保持排空状态")
+		}
+		late := &drainTestConn{disconnectTestConn: disconnectTestConn{id: 1752999}}
+		if _, err := manager.RegisterConnection(late); !errors.Is(err, core.ErrDraining) {
+			t.Fatalf("排空中应拒绝新连接，实际 %v", err)
+		}
+	})
+
+	t.Run("命令全部应答后提前关闭", func(t *testing.T) {
+		manager, conns := newDrainTestManager(t, 2, 1)
+		var remaining atomic.Int32
+		remaining.Store(2)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			remaining.Store(0)
+		}()
+		begin := time.Now()
+		result := manager.Drain(context.Background(), core.DrainOptions{
+			GracePeriod: 10 * time.Second,
+			Pending:     func() int { return int(remaining.Load()) },
+		})
+		if elapsed := time.Since(begin); elapsed > 2*time.Second {
+			t.Fatalf("命令应答后应提前结束等待，实际耗时 %s", elapsed)
+		}
+		if result.PendingAtStart != 2 || result.PendingAtClose != 0 || result.Closed != 2 || result.Notified != 0 {
+			t.Fatalf("排空结果错误: %+v", result)
+		}
+		for _, conn := range conns {
+			if !conn.stopped.Load() {
+				t.Fatalf("连接 %d 未关闭", conn.id)
+			}
+		}
+	})
+
+	t.Run("ctx取消后不再发送剩余通知", func(t *testing.T) {
+		manager, conns := newDrainTestManager(t, 5, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var calls int
+		result := manager.Drain(ctx, core.DrainOptions{
+			GracePeriod: time.Minute,
+			Pending:     func() int { return 1 },
+			Notify: func(_ context.Context, iccid, deviceID string) error {
+				calls++
+				if calls == 2 {
+					cancel() // 阶段时限到期
+				}
+				return nil
+			},
+		})
+		if calls != 2 || result.Notified != 2 || result.NotifySkipped != 3 || result.PendingAtClose != 1 || result.Closed != 5 {
+			t.Fatalf("ctx 取消后应跳过剩余通知并直接关闭连接: calls=%d %+v", calls, result)
+		}
+		for _, conn := range conns {
+			if !conn.stopped.Load() {
+				t.Fatalf("连接 %d 未关闭", conn.id)
+			}
+		}
+	})
+
+	t.Run("设备组队列卡住时宽限期内返回", func(t *testing.T) {
+		manager, conns := newDrainTestManager(t, 3, 1)
+		manager.SetCommandQueueConfig(&core.CommandQueueConfig{ConfirmTimeout: 10 * time.Millisecond, MaxWait: 30 * time.Second})
+		// 第一个设备组的出站队列被一条写入卡住的命令占用
+		release := make(chan struct{})
+		defer close(release)
+		wedged := make(chan struct{})
+		go func() {
+			_ = manager.EnqueueCommand(context.Background(), "05520000", 0x82, func(ziface.IConnection) (core.CommandWait, error) {
+				close(wedged)
+				<-release
+				return nil, nil
+			})
+		}()
+		<-wedged
+
+		const grace = 300 * time.Millisecond
+		var notified atomic.Int32
+		begin := time.Now()
+		result := manager.Drain(context.Background(), core.DrainOptions{
+			GracePeriod: grace,
+			Pending:     func() int { return 1 },
+			Notify: func(ctx context.Context, _, deviceID string) error {
+				return manager.EnqueueCommand(ctx, deviceID, 0x81, func(ziface.IConnection) (core.CommandWait, error) {
+					notified.Add(1)
+					return nil, nil
+				})
+			},
+		})
+		if elapsed := time.Since(begin); elapsed > grace+200*time.Millisecond {
+			t.Fatalf("队列卡住的设备组不应拖延排空，实际耗时 %s（宽限期 %s）", elapsed, grace)
+		}
+		if result.NotifyFailed != 1 || result.NotifySkipped != 2 || notified.Load() != 0 || result.Closed != 3 {
+			t.Fatalf("卡住的设备组通知应在宽限期结束时失败，其余跳过并关闭全部连接: %+v", result)
+		}
+		for _, conn := range conns {
+			if !conn.stopped.Load() {
+				t.Fatalf("连接 %d 未关闭", conn.id)
+			}
+		}
+	})
+
+	t.Run("排空中拒绝设备注册", func(t *testing.T) {
+		manager := core.NewTCPManager(nil)
+		conn := &drainTestConn{disconnectTestConn: disconnectTestConn{id: 1752100}}
+		if _, err := manager.RegisterConnection(conn); err != nil {
+			t.Fatalf("注册连接失败: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			manager.Drain(ctx, core.DrainOptions{GracePeriod: time.Minute, Pending: func() int { return 1 }})
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("ctx 取消后应立即结束等待")
+		}
+		if err := manager.RegisterDevice(conn, "05529900", "05529900", "89860000000001752100"); !errors.Is(err, core.ErrDraining) {
+			t.Fatalf("排空中应拒绝设备注册，实际 %v", err)
+		}
+	})
+}
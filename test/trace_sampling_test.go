@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/internal/router"
+	"github.com/bujia-iot/iot-zinx/pkg/commlog"
+	"github.com/bujia-iot/iot-zinx/pkg/core"
+	"github.com/bujia-iot/iot-zinx/pkg/tracesample"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestSampler(tb testing.TB, opts tracesample.Options) *tracesample.Sampler {
+	tb.Helper()
+	if opts.Dir == "" {
+		opts.Dir = tb.TempDir()
+	}
+	sampler, err := tracesample.New(opts)
+	if err != nil {
+		tb.Fatalf("创建抽样失败: %v", err)
+	}
+	tb.Cleanup(sampler.Stop)
+	return sampler
+}
+
+// readTraceDir 按文件名顺序读取目录中的全部跟踪文件
+func readTraceDir(t *testing.T, dir string) (files []string, records []commlog.Record) {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "trace-*.dnyc"))
+	if err != nil {
+		t.Fatalf("列出跟踪文件失败: %v", err)
+	}
+	sort.Strings(matches)
+	for _, path := range matches {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("打开跟踪文件失败: %v", err)
+		}
+		recs, err := commlog.ReadCapture(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("跟踪文件 %s 不是有效的抓包文件: %v", path, err)
+		}
+		records = append(records, recs...)
+	}
+	return matches, records
+}
+
+func dirSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取目录失败: %v", err)
+	}
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// TestTraceSamplingCapturesSession 被抽样连接从接入到断开的收发字节与注释写入抓包文件，断开后跟踪结束
+func TestTraceSamplingCapturesSession(t *testing.T) {
+	dir := t.TempDir()
+	sampler := newTestSampler(t, tracesample.Options{Dir: dir, Rate: 1})
+	tcpManager := core.GetGlobalTCPManager()
+	defer tcpManager.SetConnTraceSampler(nil)
+	tcpManager.SetConnTraceSampler(sampler)
+
+	conn := &disconnectTestConn{id: 1713001}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	uplink := []byte("DNY\x0c\x00\xcd\x28\xa2\x04\x01\x00\x20\x00\x00\x00")
+	downlink := []byte("DNY\x0a\x00\xcd\x28\xa2\x04\x01\x00\x20\x00\x00")
+	trace := core.RecordConnInbound(conn.id, uplink)
+	if trace == nil {
+		t.Fatal("比例为1时连接应被抽样")
+	}
+	trace.Note("decode error: 校验和错误", time.Now())
+	core.RecordConnOutbound(conn.id, downlink)
+
+	status := sampler.Status()
+	if status.ActiveConnections != 1 || status.Sampled != 1 || status.Active[0].Reason != tracesample.ReasonRate {
+		t.Fatalf("抽样状态错误: %+v", status)
+	}
+	_ = tcpManager.UnregisterConnection(conn.id)
+	if got := sampler.Status().ActiveConnections; got != 0 {
+		t.Fatalf("连接断开后跟踪应结束，仍有 %d 个", got)
+	}
+
+	files, records := readTraceDir(t, dir)
+	if len(files) != 1 || len(records) != 5 {
+		t.Fatalf("应有1个文件5条记录，实际 %d 个文件 %d 条", len(files), len(records))
+	}
+	wantDirs := []commlog.Direction{commlog.DirectionAnnotation, commlog.DirectionUplink, commlog.DirectionAnnotation, commlog.DirectionDownlink, commlog.DirectionAnnotation}
+	for i, rec := range records {
+		if rec.Direction != wantDirs[i] {
+			t.Fatalf("第%d条记录方向 %s，期望 %s", i+1, rec.Direction, wantDirs[i])
+		}
+	}
+	if string(records[1].Frame) != string(uplink) || string(records[3].Frame) != string(downlink) {
+		t.Fatal("收发字节与原始数据不一致")
+	}
+	if !strings.HasPrefix(string(records[0].Frame), "trace start") || string(records[2].Frame) != "decode error: 校验和错误" ||
+		!strings.Contains(string(records[4].Frame), "reason=unregister") {
+		t.Fatalf("注释记录错误: %q / %q / %q", records[0].Frame, records[2].Frame, records[4].Frame)
+	}
+
+	// 比例为0时不抽样，收发路径返回nil
+	if err := sampler.SetRate(0); err != nil {
+		t.Fatalf("设置比例失败: %v", err)
+	}
+	other := &disconnectTestConn{id: 1713002}
+	if _, err := tcpManager.RegisterConnection(other); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(other.id)
+	if core.RecordConnInbound(other.id, uplink) != nil {
+		t.Fatal("比例为0时不应抽样")
+	}
+}
+
+// TestTraceSamplingWatchList 关注名单中的设备ID/ICCID在身份确定后强制抽样
+func TestTraceSamplingWatchList(t *testing.T) {
+	dir := t.TempDir()
+	sampler := newTestSampler(t, tracesample.Options{Dir: dir, WatchDeviceIDs: []string{"04a2ab13"}, WatchICCIDs: []string{"89860000000000171302"}})
+	tcpManager := core.GetGlobalTCPManager()
+	defer tcpManager.SetConnTraceSampler(nil)
+	tcpManager.SetConnTraceSampler(sampler)
+
+	byDevice := &disconnectTestConn{id: 1713011}
+	if _, err := tcpManager.RegisterConnection(byDevice); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(byDevice.id)
+	if core.RecordConnInbound(byDevice.id, []byte("x")) != nil {
+		t.Fatal("身份确定前不应抽样")
+	}
+	if err := tcpManager.RegisterDevice(byDevice, "04A2AB13", "04A2AB13", "89860000000000171301"); err != nil {
+		t.Fatalf("注册设备失败: %v", err)
+	}
+	if core.RecordConnInbound(byDevice.id, []byte("y")) == nil {
+		t.Fatal("关注设备注册后应强制抽样")
+	}
+
+	byICCID := &disconnectTestConn{id: 1713012}
+	if _, err := tcpManager.RegisterConnection(byICCID); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(byICCID.id)
+	if err := tcpManager.UpdateICCIDByConnID(byICCID.id, "89860000000000171302"); err != nil {
+		t.Fatalf("更新ICCID失败: %v", err)
+	}
+	if core.RecordConnInbound(byICCID.id, []byte("z")) == nil {
+		t.Fatal("关注ICCID上报后应强制抽样")
+	}
+
+	status := sampler.Status()
+	if status.Forced != 2 || status.Sampled != 0 || status.ActiveConnections != 2 {
+		t.Fatalf("强制抽样计数错误: %+v", status)
+	}
+	for _, a := range status.Active {
+		if a.Reason != tracesample.ReasonWatch {
+			t.Fatalf("抽样原因应为watch: %+v", a)
+		}
+	}
+}
+
+// TestTraceSamplingDiskBound 单文件超限轮转，目录总大小严格受限，从最早的已结束文件开始删除
+func TestTraceSamplingDiskBound(t *testing.T) {
+	dir := t.TempDir()
+	const maxTotal = 4096
+	sampler := newTestSampler(t, tracesample.Options{Dir: dir, Rate: 1, MaxFileBytes: 1024, MaxTotalBytes: maxTotal})
+	frame := make([]byte, 100)
+
+	first := sampler.Accept(1, "10.0.0.1:1")
+	for i := 0; i < 25; i++ {
+		first.Frame(true, frame, time.Now())
+	}
+	first.Close("test")
+	files, _ := readTraceDir(t, dir)
+	if len(files) < 3 {
+		t.Fatalf("超过单文件上限应轮转，实际 %d 个文件", len(files))
+	}
+	oldest := files[0]
+
+	for id := uint64(2); id <= 6; id++ {
+		trace := sampler.Accept(id, "10.0.0.1:1")
+		for i := 0; i < 8; i++ {
+			trace.Frame(i%2 == 0, frame, time.Now())
+		}
+		trace.Close("test")
+		if size := dirSize(t, dir); size > maxTotal {
+			t.Fatalf("目录大小 %d 超过上限 %d", size, maxTotal)
+		}
+	}
+	if _, err := os.Stat(oldest); !os.IsNotExist(err) {
+		t.Fatal("最早的跟踪文件应被删除")
+	}
+	status := sampler.Status()
+	if status.DeletedFiles == 0 || status.DiskUsageBytes != dirSize(t, dir) || status.DiskUsageBytes > maxTotal {
+		t.Fatalf("空间统计错误: %+v 实际 %d", status, dirSize(t, dir))
+	}
+	readTraceDir(t, dir) // 剩余文件均为完整抓包文件
+
+	// 进行中的跟踪占满空间时丢弃记录而不超限
+	big := newTestSampler(t, tracesample.Options{Dir: t.TempDir(), Rate: 1, MaxFileBytes: 1024, MaxTotalBytes: 1024})
+	a, b := big.Accept(7, "10.0.0.1:1"), big.Accept(8, "10.0.0.1:2")
+	for i := 0; i < 5; i++ {
+		a.Frame(true, frame, time.Now())
+		b.Frame(true, frame, time.Now())
+	}
+	if st := big.Status(); st.DroppedRecords == 0 || st.DiskUsageBytes > 1024 {
+		t.Fatalf("空间不足时应丢弃记录: %+v", st)
+	}
+
+	// 重启后已有文件计入占用
+	reopened := newTestSampler(t, tracesample.Options{Dir: dir, Rate: 1, MaxFileBytes: 1024, MaxTotalBytes: maxTotal})
+	if got := reopened.Status(); got.DiskUsageBytes != dirSize(t, dir) || got.Files == 0 {
+		t.Fatalf("重启后应统计已有文件: %+v", got)
+	}
+}
+
+// TestTraceSamplingEndpoint 管理接口查询状态并热更新比例与关注名单
+func TestTraceSamplingEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	router.RegisterUnifiedAPIHandlers(r)
+
+	previous := tracesample.GetGlobalSampler()
+	defer tracesample.SetGlobalSampler(previous)
+	tracesample.SetGlobalSampler(nil)
+	if w, _ := callAPI(r, http.MethodGet, "/api/v1/admin/trace-sampling", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未启用时应返回503，实际 %d", w.Code)
+	}
+
+	sampler := newTestSampler(t, tracesample.Options{Rate: 0.01, WatchICCIDs: []string{"89860000000000171303"}})
+	tracesample.SetGlobalSampler(sampler)
+
+	if w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/trace-sampling", `{"rate":1.5}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("比例超出范围应返回400，实际 %d", w.Code)
+	}
+	w, _ := callAPI(r, http.MethodPost, "/api/v1/admin/trace-sampling", `{"rate":0.25,"watchDeviceIds":["04a2ab14"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("热更新失败: %d %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Data tracesample.Status `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	got := body.Data
+	if got.Rate != 0.25 || len(got.WatchDeviceIDs) != 1 || got.WatchDeviceIDs[0] != "04A2AB14" ||
+		len(got.WatchICCIDs) != 1 || got.WatchICCIDs[0] != "89860000000000171303" {
+		t.Fatalf("热更新结果错误: %+v", got)
+	}
+	if sampler.Rate() != 0.25 {
+		t.Fatalf("抽样比例未生效: %v", sampler.Rate())
+	}
+	if w, resp := callAPI(r, http.MethodGet, "/api/v1/admin/trace-sampling", ""); w.Code != http.StatusOK || resp.Code != 0 {
+		t.Fatalf("查询状态失败: %d %s", w.Code, w.Body.String())
+	}
+}
+
+// TestTraceSamplingUnsampledNoAlloc 未抽样的连接在收发路径上不产生额外分配
+func TestTraceSamplingUnsampledNoAlloc(t *testing.T) {
+	sampler := newTestSampler(t, tracesample.Options{Rate: 0})
+	tcpManager := core.GetGlobalTCPManager()
+	defer tcpManager.SetConnTraceSampler(nil)
+	tcpManager.SetConnTraceSampler(sampler)
+
+	conn := &disconnectTestConn{id: 1713021}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(conn.id)
+	data := make([]byte, 64)
+	allocs := testing.AllocsPerRun(1000, func() {
+		if trace := core.RecordConnInbound(conn.id, data); trace != nil {
+			t.Fatal("不应抽样")
+		}
+		core.RecordConnOutbound(conn.id, data)
+	})
+	if allocs != 0 {
+		t.Fatalf("未抽样路径每帧分配 %v 次", allocs)
+	}
+}
+
+func benchmarkConnTrace(b *testing.B, rate float64) {
+	quietLogger(b)
+	sampler := newTestSampler(b, tracesample.Options{Rate: rate, MaxTotalBytes: 1 << 30})
+	tcpManager := core.GetGlobalTCPManager()
+	defer tcpManager.SetConnTraceSampler(nil)
+	tcpManager.SetConnTraceSampler(sampler)
+
+	conn := &disconnectTestConn{id: 1713031}
+	if _, err := tcpManager.RegisterConnection(conn); err != nil {
+		b.Fatalf("注册连接失败: %v", err)
+	}
+	defer tcpManager.UnregisterConnection(conn.id)
+	data := make([]byte, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		core.RecordConnInbound(conn.id, data)
+	}
+}
+
+// BenchmarkConnTraceUnsampled 未抽样连接：与抽样前相比只多一次判空
+func BenchmarkConnTraceUnsampled(b *testing.B) { benchmarkConnTrace(b, 0) }
+
+// BenchmarkConnTraceSampled 抽样连接：记录写入缓冲
+func BenchmarkConnTraceSampled(b *testing.B) { benchmarkConnTrace(b, 1) }
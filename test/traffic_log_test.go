@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bujia-iot/iot-zinx/internal/infrastructure/logger"
+	"github.com/bujia-iot/iot-zinx/pkg/dialect"
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/protocol"
+	"github.com/bujia-iot/iot-zinx/pkg/simulator"
+)
+
+// syncBuffer 并发安全的流量日志输出
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records(t *testing.T) []logger.TrafficRecord {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []logger.TrafficRecord
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var record logger.TrafficRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("流量日志每行应为JSON: %v %s", err, scanner.Text())
+		}
+		records = append(records, record)
+	}
+	b.buf.Reset()
+	return records
+}
+
+// TestTrafficLog 200台设备各上报10次心跳，按1%抽样只记录20行；开始充电的下行0x82与设备应答各记一行且消息ID一致，
+// 十六进制按配置截断，记录原始长度与解析/写入结果
+func TestTrafficLog(t *testing.T) {
+	quietLogger(t)
+	out := &syncBuffer{}
+	l := logger.NewTrafficLogger(logger.TrafficOptions{
+		MaxHexBytes: 32,
+		SampleRates: map[string]float64{"0x21": 0.01, "0x01": 0.01, "link": 0.01},
+	}, out)
+	logger.SetTrafficLogger(l)
+	t.Cleanup(func() { logger.SetTrafficLogger(nil) })
+
+	decoder := protocol.NewDNYDecoder().(*protocol.DNY_Decoder)
+	for i := 0; i < 200; i++ {
+		connID := uint64(1768000 + i)
+		device := simulator.NewDevice(uint32(0x04A30000+i), fmt.Sprintf("898600000000017680%02d", i%100), dialect.AP3000)
+		for n := 0; n < 10; n++ {
+			frame, err := device.Heartbeat(dialect.Heartbeat{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, msg := decoder.DecodeFrame(connID, frame); msg == nil || msg.MessageType != "standard" {
+				t.Fatalf("心跳帧应解码成功: %+v", msg)
+			}
+		}
+		decoder.ReleaseConnection(connID)
+	}
+	heartbeats := out.records(t)
+	if len(heartbeats) != 20 {
+		t.Fatalf("2000帧心跳按1%%抽样应记录20行，实际%d行", len(heartbeats))
+	}
+	for _, record := range heartbeats {
+		if record.Direction != logger.TrafficInbound || record.Command != "0x21" || record.Result != "ok" || record.DeviceID == "" {
+			t.Fatalf("心跳记录内容错误: %+v", record)
+		}
+	}
+	if stats := l.Stats(); stats.ByKey["0x21"] != 2000 || stats.Written != 20 || stats.Sampled != 1980 {
+		t.Fatalf("抽样统计错误: %+v", stats)
+	}
+
+	// 开始充电：下行与应答全量记录，消息ID一致
+	const deviceID = "04A27169"
+	conn := registerSharedGroup(t, 1768500, "89860000000000176850", []string{deviceID})
+	device := simulator.NewDevice(0x04A27169, "89860000000000176850", dialect.AP3000)
+	if _, err := gateway.GetGlobalDeviceGateway().StartChargingWithRequest("", gateway.ChargeRequest{DeviceID: deviceID, Port: 1, OrderNo: "ORD-1768-A", Mode: 0, Value: 3600, Balance: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	down, err := device.ParseDownlink(waitFrames(t, conn, 1, nil)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := device.ChargeControlResponse(down.MessageID, dialect.ChargeControlResponse{Port: 0, OrderNo: "ORD-1768-A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder.DecodeFrame(1768500, response)
+	decoder.ReleaseConnection(1768500)
+
+	records := out.records(t)
+	if len(records) != 2 {
+		t.Fatalf("下行与应答应各记录一行: %+v", records)
+	}
+	request, reply := records[0], records[1]
+	messageID := fmt.Sprintf("0x%04X", down.MessageID)
+	if request.Direction != logger.TrafficOutbound || reply.Direction != logger.TrafficInbound ||
+		request.Command != "0x82" || reply.Command != "0x82" || request.MessageID != messageID || reply.MessageID != messageID ||
+		request.DeviceID != deviceID || reply.DeviceID != deviceID || request.Result != "ok" || reply.Result != "ok" {
+		t.Fatalf("充电命令的下行与应答记录错误: %+v / %+v", request, reply)
+	}
+	if request.Length <= 32 || !request.Truncated || len(request.Hex) != 64 || reply.Length != len(response) {
+		t.Fatalf("十六进制应截断到32字节并记录原始长度: %+v", request)
+	}
+}
+
+// TestTrafficLogDefaultSampleRate 未配置默认抽样率时全量记录；显式配置为0时只记录 sampleRates 中列出的命令
+func TestTrafficLogDefaultSampleRate(t *testing.T) {
+	frame := func(command uint8) logger.TrafficFrame {
+		return logger.TrafficFrame{Direction: logger.TrafficInbound, ConnID: 1768900, Kind: logger.TrafficKindDNY, Command: command, Data: []byte{0x44, 0x4E, 0x59}}
+	}
+
+	unset := logger.NewTrafficLogger(logger.TrafficOptions{SampleRates: map[string]float64{"0x21": 0}}, &syncBuffer{})
+	for i := 0; i < 5; i++ {
+		unset.Log(frame(0x21))
+		unset.Log(frame(0x82))
+	}
+	if stats := unset.Stats(); stats.Written != 5 || stats.Sampled != 5 {
+		t.Fatalf("未配置默认抽样率时未列出的命令应全量记录: %+v", stats)
+	}
+
+	zero := 0.0
+	out := &syncBuffer{}
+	listedOnly := logger.NewTrafficLogger(logger.TrafficOptions{DefaultSampleRate: &zero, SampleRates: map[string]float64{"0x82": 1}}, out)
+	for i := 0; i < 5; i++ {
+		listedOnly.Log(frame(0x21))
+		listedOnly.Log(frame(0x82))
+	}
+	if stats := listedOnly.Stats(); stats.Written != 5 || stats.Sampled != 5 {
+		t.Fatalf("默认抽样率为0时只应记录列出的命令: %+v", stats)
+	}
+	for _, record := range out.records(t) {
+		if record.Command != "0x82" {
+			t.Fatalf("未列出的命令不应记录: %+v", record)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bujia-iot/iot-zinx/pkg/gateway"
+	"github.com/bujia-iot/iot-zinx/pkg/virtual"
+)
+
+// TestVirtualDevice 多端口机柜虚拟子设备拆分/寻址/持久化/归并测试
+func TestVirtualDevice(t *testing.T) {
+	const parentID = "04A26CF3"
+
+	t.Run("按端口拆分生成派生ID", func(t *testing.T) {
+		virtuals, err := virtual.BuildVirtuals(parentID, virtual.SplitPlan{PortsPerVirtual: 1, TotalPorts: 12}, time.Now())
+		if err != nil {
+			t.Fatalf("拆分失败: %v", err)
+		}
+		if len(virtuals) != 12 {
+			t.Fatalf("应生成12个虚拟设备，实际 %d", len(virtuals))
+		}
+		if virtuals[0].VirtualID != "04A26CF3-P01" || virtuals[11].VirtualID != "04A26CF3-P12" {
+			t.Fatalf("派生ID错误: %s .. %s", virtuals[0].VirtualID, virtuals[11].VirtualID)
+		}
+		if p, err := virtuals[4].PhysicalPort(1); err != nil || p != 5 {
+			t.Fatalf("P05 虚拟端口1应映射物理端口5: %d %v", p, err)
+		}
+		if p, err := virtuals[4].PhysicalPort(0); err != nil || p != 5 {
+			t.Fatalf("单端口虚拟设备省略端口应映射物理端口5: %d %v", p, err)
+		}
+		if _, err := virtuals[4].PhysicalPort(2); err == nil {
+			t.Fatal("越界虚拟端口应报错")
+		}
+	})
+
+	t.Run("拆分参数校验", func(t *testing.T) {
+		cases := map[string]virtual.SplitPlan{
+			"缺少参数": {},
+			"端口越界": {Mapping: []virtual.PortMapping{{Ports: []int{0}}}},
+			"端口重复": {Mapping: []virtual.PortMapping{{Ports: []int{1, 2}}, {Ports: []int{2, 3}}}},
+			"后缀重复": {Mapping: []virtual.PortMapping{{Suffix: "A", Ports: []int{1}}, {Suffix: "a", Ports: []int{2}}}},
+			"方式冲突": {PortsPerVirtual: 1, Mapping: []virtual.PortMapping{{Ports: []int{1}}}},
+		}
+		for name, plan := range cases {
+			if _, err := virtual.BuildVirtuals(parentID, plan, time.Now()); err == nil {
+				t.Fatalf("%s: 应返回错误", name)
+			}
+		}
+	})
+
+	t.Run("文件持久化重启后恢复", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "virtual_devices.json")
+		r, err := virtual.NewRegistry(virtual.NewFileStore(path))
+		if err != nil {
+			t.Fatalf("创建注册表失败: %v", err)
+		}
+		plan := virtual.SplitPlan{Mapping: []virtual.PortMapping{{Suffix: "L", Ports: []int{1, 2}}, {Suffix: "R", Ports: []int{3, 4}}}}
+		if _, err := r.Split(parentID, plan); err != nil {
+			t.Fatalf("拆分失败: %v", err)
+		}
+		var splitErr *virtual.AlreadySplitError
+		if _, err := r.Split(parentID, plan); !errors.As(err, &splitErr) {
+			t.Fatalf("重复拆分应返回 AlreadySplitError，实际 %v", err)
+		}
+
+		reloaded, err := virtual.NewRegistry(virtual.NewFileStore(path))
+		if err != nil {
+			t.Fatalf("重新加载失败: %v", err)
+		}
+		v, ok := reloaded.Resolve("04a26cf3-r")
+		if !ok || v.ParentID != parentID {
+			t.Fatalf("重新加载后应能解析虚拟ID: %+v", v)
+		}
+		if v, port, ok := reloaded.LookupPort(parentID, 4); !ok || v.VirtualID != "04A26CF3-R" || port != 2 {
+			t.Fatalf("物理端口4应归属 04A26CF3-R 端口2: %+v %d", v, port)
+		}
+		if _, _, ok := reloaded.LookupPort(parentID, 5); ok {
+			t.Fatal("未映射的物理端口不应归属虚拟设备")
+		}
+
+		if _, err := reloaded.Remove(parentID); err != nil {
+			t.Fatalf("删除拆分失败: %v", err)
+		}
+		again, _ := virtual.NewRegistry(virtual.NewFileStore(path))
+		if len(again.Get(parentID)) != 0 {
+			t.Fatal("删除拆分应持久化")
+		}
+	})
+
+	t.Run("充电寻址转换与归并", func(t *testing.T) {
+		registry, _ := virtual.NewRegistry(nil)
+		virtual.SetGlobalRegistry(registry)
+		defer virtual.SetGlobalRegistry(nil)
+
+		g := gateway.NewDeviceGateway()
+		if _, err := g.SplitVirtualDevices(parentID, virtual.SplitPlan{PortsPerVirtual: 2, TotalPorts: 4}); err != nil {
+			t.Fatalf("拆分失败: %v", err)
+		}
+
+		if _, ok, _ := g.ResolveVirtualTarget(parentID, 1); ok {
+			t.Fatal("物理设备ID不应解析为虚拟设备")
+		}
+		target, ok, err := g.ResolveVirtualTarget("04A26CF3-P02", 2)
+		if !ok || err != nil {
+			t.Fatalf("虚拟设备解析失败: %v", err)
+		}
+		if target.ParentID != parentID || target.PhysicalPort != 4 || target.VirtualPort != 2 {
+			t.Fatalf("转换结果错误: %+v", target)
+		}
+		if _, ok, err := g.ResolveVirtualTarget("04A26CF3-P02", 3); !ok || err == nil {
+			t.Fatal("虚拟端口越界应报错")
+		}
+
+		om := g.GetOrderManager()
+		if err := om.CreateOrder(parentID, target.PhysicalPort, "ORDER_VIRTUAL_001", 0, 3600, 1000); err != nil {
+			t.Fatalf("创建订单失败: %v", err)
+		}
+		_ = om.UpdateOrderStatus(parentID, target.PhysicalPort, gateway.OrderStatusCharging, "充电命令发送成功")
+
+		removed, sessions, err := g.MergeVirtualDevices(parentID)
+		if err != nil {
+			t.Fatalf("归并失败: %v", err)
+		}
+		if len(removed) != 2 || len(sessions) != 1 || sessions[0].OrderNo != "ORDER_VIRTUAL_001" {
+			t.Fatalf("归并结果错误: removed=%d sessions=%+v", len(removed), sessions)
+		}
+		if _, ok := virtual.Resolve("04A26CF3-P02"); ok {
+			t.Fatal("归并后虚拟ID不应再可解析")
+		}
+		if order := om.GetOrder(parentID, 4); order == nil || order.OrderNo != "ORDER_VIRTUAL_001" {
+			t.Fatal("归并后会话应保留在物理设备端口上")
+		}
+	})
+}